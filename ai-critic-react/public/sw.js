@@ -0,0 +1,32 @@
+// Service worker showing the push notifications the server sends (see
+// server/notifications). A message is the JSON of a notification.
+
+self.addEventListener('push', (event) => {
+    let data = {};
+    try {
+        data = event.data ? event.data.json() : {};
+    } catch {
+        data = { title: event.data ? event.data.text() : 'AI Critic' };
+    }
+    event.waitUntil(self.registration.showNotification(data.title || 'AI Critic', {
+        body: data.body || '',
+        icon: '/ai-critic.svg',
+        tag: data.event,
+        requireInteraction: !!data.urgent,
+        data: { url: data.url || '/' },
+    }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    const url = new URL(event.notification.data?.url || '/', self.location.origin).href;
+    event.waitUntil((async () => {
+        const windows = await self.clients.matchAll({ type: 'window', includeUncontrolled: true });
+        for (const client of windows) {
+            if (client.url === url && 'focus' in client) {
+                return client.focus();
+            }
+        }
+        return self.clients.openWindow(url);
+    })());
+});
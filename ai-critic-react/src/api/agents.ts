@@ -1,3 +1,6 @@
+import type { ArtifactSummary } from './artifacts';
+import { cachedFetch } from './cachedFetch';
+
 // ---- Types ----
 
 export interface AgentDef {
@@ -27,6 +30,49 @@ export interface AgentSessionInfo {
     created_at: string;
     status: AgentSessionStatus;
     error?: string;
+    artifacts?: ArtifactSummary;
+    /** made before the session started; restore it with all to undo the session */
+    checkpoint?: SessionCheckpoint;
+    /** how the resource limits apply; absent when none are set */
+    limits?: AgentLimitStatus;
+    /** latest resource sample of the agent process and its descendants; absent when not running */
+    usage?: AgentProcessUsage;
+}
+
+export interface AgentProcessUsage {
+    /** since the previous sample, 100 per core */
+    cpu_percent: number;
+    rss_bytes: number;
+    /** descendants running now */
+    children: number;
+    /** descendants seen since the session started */
+    children_started: number;
+    sampled_at: string;
+}
+
+export interface SessionCheckpoint {
+    project: string;
+    id: number;
+}
+
+/** Limits for process-backed agent sessions; 0 or empty means no limit. */
+export interface AgentResourceLimits {
+    /** 100 per core */
+    cpu_percent?: number;
+    memory_mb?: number;
+    /** Go duration, e.g. "2h" */
+    max_duration?: string;
+    /** delegated cgroup v2 directory; default: below the server's cgroup */
+    cgroup_parent?: string;
+}
+
+export interface AgentLimitStatus extends AgentResourceLimits {
+    /** "cgroup" (kernel-enforced) or "watchdog" (sampled by the server) */
+    enforcement: 'cgroup' | 'watchdog';
+    /** why cgroups are not used */
+    note?: string;
+    /** the limit that stopped the session */
+    exceeded?: string;
 }
 
 export interface AgentSessionsResponse {
@@ -139,7 +185,7 @@ export async function fetchAgentSessions(page?: number, pageSize?: number): Prom
     if (pageSize) params.set('page_size', pageSize.toString());
     
     const url = params.toString() ? `/api/agents/sessions?${params}` : '/api/agents/sessions';
-    const resp = await fetch(url);
+    const resp = await cachedFetch(url);
     const data = await resp.json();
     
     // Handle both paginated and legacy response formats
@@ -155,21 +201,44 @@ export async function fetchAgentSessionsPaginated(page: number = 1, pageSize: nu
         page_size: pageSize.toString(),
     });
     
-    const resp = await fetch(`/api/agents/sessions?${params}`);
+    const resp = await cachedFetch(`/api/agents/sessions?${params}`);
     return resp.json();
 }
 
+/**
+ * Follows the caller's sessions with their resource usage, sent now and
+ * after every sample. Returns a function that stops following.
+ */
+export function subscribeAgentSessions(onSessions: (sessions: AgentSessionInfo[]) => void): () => void {
+    const source = new EventSource('/api/agents/sessions/stream');
+    source.onmessage = (msg) => {
+        try {
+            const data = JSON.parse(msg.data);
+            if (data.type === 'sessions') {
+                onSessions(data.sessions || []);
+            }
+        } catch {
+            // Skip malformed SSE data
+        }
+    };
+    return () => source.close();
+}
+
 export interface LaunchAgentOptions {
     agentId: string;
     projectDir: string;
     apiKey?: string; // Optional API key (e.g., for cursor-agent)
+    artifacts?: string[]; // Output paths to collect after each run
 }
 
-export async function launchAgentSession(agentId: string, projectDir: string, apiKey?: string): Promise<AgentSessionInfo> {
-    const body: Record<string, string> = { agent_id: agentId, project_dir: projectDir };
+export async function launchAgentSession(agentId: string, projectDir: string, apiKey?: string, artifacts?: string[]): Promise<AgentSessionInfo> {
+    const body: Record<string, string | string[]> = { agent_id: agentId, project_dir: projectDir };
     if (apiKey) {
         body.api_key = apiKey;
     }
+    if (artifacts?.length) {
+        body.artifacts = artifacts;
+    }
     const resp = await fetch('/api/agents/sessions', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
@@ -380,6 +449,12 @@ export function agentEventUrl(sessionId: string): string {
 export interface AgentSettings {
     prompt_append_message: string;
     followup_append_message: string;
+    /** Claude Code only: default, acceptEdits (the default), plan or bypassPermissions. */
+    permission_mode?: string;
+    /** Codex only: read-only, workspace-write (the default) or danger-full-access. */
+    sandbox?: string;
+    /** Codex only: overrides model_reasoning_effort of the codex config. */
+    reasoning_effort?: string;
 }
 
 export async function fetchAgentSettings(sessionId: string): Promise<AgentSettings> {
@@ -438,6 +513,26 @@ export async function updateAgentPathConfig(agentId: string, binaryPath: string)
 }
 
 
+export async function fetchAgentLimits(): Promise<AgentResourceLimits> {
+    const resp = await fetch('/api/agents/limits');
+    if (!resp.ok) throw new Error('Failed to fetch agent limits');
+    return resp.json();
+}
+
+/** Applies to sessions launched afterwards. */
+export async function updateAgentLimits(limits: AgentResourceLimits): Promise<AgentResourceLimits> {
+    const resp = await fetch('/api/agents/limits', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(limits),
+    });
+    if (!resp.ok) {
+        const text = await resp.text();
+        throw new Error(text || 'Failed to update agent limits');
+    }
+    return resp.json();
+}
+
 export interface AgentEffectivePath {
     effective_path: string;
     found: boolean;
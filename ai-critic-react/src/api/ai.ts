@@ -1,5 +1,9 @@
+// API spoken by a provider; empty infers it from the base URL (default openai)
+export type AIProviderType = '' | 'openai' | 'anthropic' | 'gemini' | 'ollama';
+
 export interface AIProvider {
     name: string;
+    type?: AIProviderType;
     base_url: string;
     api_key: string;
 }
@@ -9,6 +13,10 @@ export interface AIModel {
     model: string;
     display_name?: string;
     max_tokens?: number;
+    /** USD per million prompt tokens, for usage cost reports */
+    input_price?: number;
+    /** USD per million completion tokens */
+    output_price?: number;
 }
 
 export interface AIConfig {
@@ -0,0 +1,73 @@
+// Agent artifacts API client
+
+export interface ArtifactSummary {
+    task: string;
+    files: number;
+    bytes: number;
+    collected_at?: string;
+}
+
+export interface ArtifactTask {
+    id: string;
+    session_id: string;
+    agent: string;
+    project_dir: string;
+    /** Declared output paths: globs relative to the project, or absolute. */
+    paths?: string[];
+    created_at: string;
+    collected_at?: string;
+}
+
+export interface ArtifactTaskInfo extends ArtifactTask {
+    files: number;
+    bytes: number;
+}
+
+export interface Artifact {
+    path: string;
+    size: number;
+    modified_at: string;
+}
+
+export interface ArtifactTaskDetail {
+    task: ArtifactTask;
+    files: Artifact[];
+}
+
+export interface CollectResult extends ArtifactTaskDetail {
+    copied: number;
+    /** Set when some files could not be collected. */
+    error?: string;
+}
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+export function listArtifactTasks(projectDir?: string): Promise<ArtifactTaskInfo[]> {
+    const qs = projectDir ? `?project_dir=${encodeURIComponent(projectDir)}` : '';
+    return request(`/api/artifacts${qs}`, undefined, 'Failed to list artifacts');
+}
+
+export function getArtifactTask(taskId: string): Promise<ArtifactTaskDetail> {
+    return request(`/api/artifacts/${encodeURIComponent(taskId)}`, undefined, 'Failed to get artifacts');
+}
+
+export function collectArtifacts(taskId: string): Promise<CollectResult> {
+    return request(`/api/artifacts/${encodeURIComponent(taskId)}/collect`, { method: 'POST' }, 'Failed to collect artifacts');
+}
+
+export function deleteArtifactTask(taskId: string): Promise<{ status: string }> {
+    return request(`/api/artifacts/${encodeURIComponent(taskId)}`, { method: 'DELETE' }, 'Failed to delete artifacts');
+}
+
+/** URL of one artifact; inline shows it in the browser instead of downloading. */
+export function artifactUrl(taskId: string, path: string, inline?: boolean): string {
+    const encoded = path.split('/').map(encodeURIComponent).join('/');
+    return `/api/artifacts/${encodeURIComponent(taskId)}/files/${encoded}${inline ? '?inline=1' : ''}`;
+}
@@ -72,12 +72,12 @@ export async function fetchCredentials(): Promise<MaskedCredential[]> {
     return data.credentials || [];
 }
 
-/** Start SSH key test, returns raw Response for SSE streaming. */
-export async function testSshKey(host: string, encryptedPrivateKey: string): Promise<Response> {
+/** Start SSH key test, returns raw Response for SSE streaming. user defaults to "git". */
+export async function testSshKey(host: string, encryptedPrivateKey: string, user?: string): Promise<Response> {
     const resp = await fetch('/api/ssh-keys/test', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ host, private_key: encryptedPrivateKey }),
+        body: JSON.stringify({ host, private_key: encryptedPrivateKey, user }),
     });
     if (!resp.ok) {
         const data = await resp.json().catch(() => ({}));
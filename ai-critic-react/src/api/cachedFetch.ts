@@ -0,0 +1,72 @@
+// Conditional fetch for polled read endpoints (diff, status, file tree,
+// branches, sessions). Bodies are kept with their ETag: repeat requests send
+// If-None-Match and a 304 Not Modified is answered from the kept body, so
+// polling an unchanged repository costs a few bytes. When the network is
+// down the kept body is returned, marked with X-From-Cache: offline.
+
+interface CachedBody {
+    etag: string;
+    body: string;
+    contentType: string;
+}
+
+// Bounded; Map iteration order makes the first key the least recently used.
+const MAX_ENTRIES = 100;
+const bodies = new Map<string, CachedBody>();
+
+function cacheKey(url: string, init?: RequestInit): string {
+    const method = init?.method || 'GET';
+    const body = typeof init?.body === 'string' ? init.body : '';
+    return `${method} ${url} ${body}`;
+}
+
+function remember(key: string, entry: CachedBody) {
+    bodies.delete(key);
+    bodies.set(key, entry);
+    if (bodies.size > MAX_ENTRIES) {
+        const oldest = bodies.keys().next().value;
+        if (oldest !== undefined) {
+            bodies.delete(oldest);
+        }
+    }
+}
+
+function fromCache(entry: CachedBody, source: 'revalidated' | 'offline'): Response {
+    return new Response(entry.body, {
+        status: 200,
+        headers: { 'Content-Type': entry.contentType, 'ETag': entry.etag, 'X-From-Cache': source },
+    });
+}
+
+/** fetch with ETag revalidation and an offline fallback; see above. */
+export async function cachedFetch(url: string, init?: RequestInit): Promise<Response> {
+    const key = cacheKey(url, init);
+    const cached = bodies.get(key);
+    const headers = new Headers(init?.headers);
+    if (cached) {
+        headers.set('If-None-Match', cached.etag);
+    }
+
+    let resp: Response;
+    try {
+        resp = await fetch(url, { ...init, headers });
+    } catch (err) {
+        if (cached) {
+            return fromCache(cached, 'offline');
+        }
+        throw err;
+    }
+
+    if (resp.status === 304 && cached) {
+        remember(key, cached);
+        return fromCache(cached, 'revalidated');
+    }
+    const etag = resp.headers.get('ETag');
+    if (resp.ok && etag) {
+        const body = await resp.clone().text();
+        remember(key, { etag, body, contentType: resp.headers.get('Content-Type') || 'application/json' });
+    } else if (!resp.ok) {
+        bodies.delete(key);
+    }
+    return resp;
+}
@@ -4,6 +4,8 @@ export interface CheckpointSummary {
     id: number;
     name: string;
     timestamp: string;
+    /** agent session an automatic checkpoint was made before */
+    session?: string;
     file_count: number;
 }
 
@@ -16,6 +18,9 @@ export interface CheckpointDetail {
     id: number;
     name: string;
     timestamp: string;
+    /** git HEAD the checkpoint was made on; missing for old checkpoints */
+    commit?: string;
+    session?: string;
     files: ChangedFile[];
 }
 
@@ -90,6 +95,115 @@ export async function fetchCheckpointDiff(project: string, id: number): Promise<
     return resp.json();
 }
 
+// Diffs a checkpoint against the working tree or against another
+// checkpoint (from `id` to `otherId`); files unchanged between the two are omitted.
+export async function fetchCheckpointWorkingDiff(project: string, id: number, projectDir: string): Promise<FileDiff[]> {
+    const resp = await fetch(`/api/checkpoints/${id}/diff?project=${encodeURIComponent(project)}&against=working&project_dir=${encodeURIComponent(projectDir)}`);
+    if (!resp.ok) throw new Error('Failed to fetch diff');
+    return resp.json();
+}
+
+export async function fetchCheckpointsDiff(project: string, id: number, otherId: number): Promise<FileDiff[]> {
+    const resp = await fetch(`/api/checkpoints/${id}/diff?project=${encodeURIComponent(project)}&against=${otherId}`);
+    if (!resp.ok) throw new Error('Failed to fetch diff');
+    return resp.json();
+}
+
+export interface PruneCheckpointsRequest {
+    keep_last?: number;
+    max_total_size?: number;
+    /** Go duration, e.g. "168h" */
+    max_age?: string;
+    /** only automatic checkpoints made before agent sessions */
+    sessions?: boolean;
+    dry_run?: boolean;
+}
+
+export interface PrunedCheckpoint extends CheckpointSummary {
+    size: number;
+}
+
+export interface PruneCheckpointsResult {
+    removed: PrunedCheckpoint[];
+    kept: number;
+    freed_bytes: number;
+    total_size: number;
+    dry_run?: boolean;
+}
+
+export async function pruneCheckpoints(project: string, req: PruneCheckpointsRequest): Promise<PruneCheckpointsResult> {
+    const resp = await fetch(`/api/checkpoints/prune?project=${encodeURIComponent(project)}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    });
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to prune checkpoints');
+    }
+    return resp.json();
+}
+
+export interface RestoreCheckpointRequest {
+    project_dir: string;
+    /** files to restore; all files of the checkpoint when omitted */
+    paths?: string[];
+    /** also revert files changed since the checkpoint that it did not record */
+    all?: boolean;
+    dry_run?: boolean;
+}
+
+export interface RestoredFile {
+    path: string;
+    action: 'write' | 'delete' | 'unchanged';
+}
+
+export interface RestoreCheckpointResult {
+    files: RestoredFile[];
+    /** working tree to checkpoint, for dry runs */
+    diffs?: FileDiff[];
+    dry_run?: boolean;
+}
+
+export async function restoreCheckpoint(project: string, id: number, req: RestoreCheckpointRequest): Promise<RestoreCheckpointResult> {
+    const resp = await fetch(`/api/checkpoints/${id}/restore?project=${encodeURIComponent(project)}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    });
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to restore checkpoint');
+    }
+    return resp.json();
+}
+
+export interface CheckpointPolicy {
+    auto_checkpoint: boolean;
+    keep_last?: number;
+    max_age?: string;
+    max_total_size?: number;
+}
+
+export async function fetchCheckpointPolicy(): Promise<CheckpointPolicy> {
+    const resp = await fetch('/api/checkpoints/policy');
+    if (!resp.ok) throw new Error('Failed to fetch checkpoint policy');
+    return resp.json();
+}
+
+export async function saveCheckpointPolicy(policy: CheckpointPolicy): Promise<CheckpointPolicy> {
+    const resp = await fetch('/api/checkpoints/policy', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(policy),
+    });
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to save checkpoint policy');
+    }
+    return resp.json();
+}
+
 export async function fetchCurrentDiff(project: string, projectDir: string): Promise<FileDiff[]> {
     const resp = await fetch(`/api/checkpoints/current/diff?project=${encodeURIComponent(project)}&project_dir=${encodeURIComponent(projectDir)}`);
     if (!resp.ok) throw new Error('Failed to fetch current diff');
@@ -122,7 +236,10 @@ export async function fetchFiles(projectDir: string, path?: string): Promise<Fil
 export async function fetchFileContent(projectDir: string, path: string): Promise<string> {
     const resp = await fetch(`/api/files/content?project_dir=${encodeURIComponent(projectDir)}&path=${encodeURIComponent(path)}`);
     if (!resp.ok) throw new Error('Failed to fetch file content');
+    // the response is a FileContent: binary and oversized files come without content
     const data = await resp.json();
+    if (data.binary) throw new Error('Binary file, not shown');
+    if (data.too_large) throw new Error(`File too large to show (${data.size} bytes)`);
     return data.content;
 }
 
@@ -6,6 +6,9 @@ export interface CustomAgent {
   model?: string;
   tools: Record<string, boolean>;
   permissions?: Record<string, string>;
+  // 'jsonl' agents run their own command, see server/agents/custom/protocol.go
+  protocol?: 'opencode' | 'jsonl';
+  command?: string[];
   hasSystemPrompt: boolean;
 }
 
@@ -21,6 +24,8 @@ export interface CreateCustomAgentRequest {
   model?: string;
   tools?: Record<string, boolean>;
   permissions?: Record<string, string>;
+  protocol?: 'opencode' | 'jsonl';
+  command?: string[];
   template?: string;
   systemPrompt?: string;
 }
@@ -32,6 +37,8 @@ export interface UpdateCustomAgentRequest {
   model?: string;
   tools?: Record<string, boolean>;
   permissions?: Record<string, string>;
+  protocol?: 'opencode' | 'jsonl';
+  command?: string[];
   systemPrompt?: string;
 }
 
@@ -0,0 +1,79 @@
+// Dependency update assistant API client
+
+export interface DepModule {
+    ecosystem: 'go' | 'npm';
+    /** Relative to the project dir; "." for the root. */
+    dir: string;
+}
+
+export interface DepUpdate {
+    ecosystem: 'go' | 'npm';
+    dir: string;
+    name: string;
+    current: string;
+    wanted?: string;
+    latest: string;
+    target: string;
+    kind: 'patch' | 'minor' | 'major' | 'unknown';
+    indirect?: boolean;
+    planned: boolean;
+    reason?: string;
+}
+
+export interface OutdatedReport {
+    dir: string;
+    modules: DepModule[];
+    updates: DepUpdate[];
+    planned: number;
+    warnings?: string[];
+}
+
+export interface ApplyDepsRequest {
+    dir: string;
+    /** Defaults to the planned updates. */
+    updates?: DepUpdate[];
+    branch?: string;
+    /** Only create the branch and return a prompt for an agent. */
+    agent?: boolean;
+    commit?: boolean;
+    skip_verify?: boolean;
+}
+
+export async function fetchOutdated(dir: string, indirect = false): Promise<OutdatedReport> {
+    const params = new URLSearchParams({ dir });
+    if (indirect) params.set('indirect', 'true');
+    const resp = await fetch(`/api/deps/outdated?${params}`);
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to check dependencies');
+    }
+    return resp.json();
+}
+
+/**
+ * Starts an apply job and streams it as SSE (see /api/jobs/stream). The done
+ * event carries branch, applied, build, test, steps, commit and, in agent
+ * mode, prompt.
+ */
+export function applyDepsStreaming(req: ApplyDepsRequest): Promise<Response> {
+    return fetch('/api/deps/apply', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Accept': 'text/event-stream',
+        },
+        body: JSON.stringify(req),
+    });
+}
+
+/** Runs build and tests of every module in dir, streamed as SSE. */
+export function verifyDepsStreaming(dir: string): Promise<Response> {
+    return fetch('/api/deps/verify', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Accept': 'text/event-stream',
+        },
+        body: JSON.stringify({ dir }),
+    });
+}
@@ -0,0 +1,111 @@
+// Event bus client: one multiplexed SSE connection to /api/events shared by
+// every feature that follows server events, instead of one per feature.
+
+export type EventTopic = 'activity' | 'ports' | 'exec-approvals' | 'notifications';
+
+export interface ServerEvent<T = unknown> {
+    seq: number;
+    /** 'events' for the bus's own reset event, delivered to every handler. */
+    topic: EventTopic | 'events';
+    type: string;
+    time: string;
+    data?: T;
+}
+
+/**
+ * Called for each event of the followed topic, and with a 'reset' event when
+ * events were missed (e.g. after the server restarted): refetch the state.
+ */
+export type ServerEventHandler<T = unknown> = (event: ServerEvent<T>) => void;
+
+const handlers = new Map<EventTopic, Set<ServerEventHandler>>();
+let source: EventSource | null = null;
+let sourceTopics = '';
+/** Resume ID of the last event received, sent back on reconnect. */
+let lastEventId = '';
+let reconnectTimer: ReturnType<typeof setTimeout> | null = null;
+let retryDelay = 1000;
+
+function dispatch(event: ServerEvent) {
+    if (event.topic === 'events') {
+        handlers.forEach((set) => set.forEach((h) => h(event)));
+        return;
+    }
+    handlers.get(event.topic)?.forEach((h) => h(event));
+}
+
+function connect() {
+    reconnectTimer = null;
+    const topics = [...handlers.keys()].sort().join(',');
+    if (source && topics === sourceTopics) {
+        return;
+    }
+    source?.close();
+    source = null;
+    sourceTopics = topics;
+    if (!topics) {
+        return;
+    }
+
+    const params = new URLSearchParams({ topics });
+    if (lastEventId) {
+        params.set('since', lastEventId);
+    }
+    const es = new EventSource(`/api/events?${params}`);
+    source = es;
+    es.onopen = () => {
+        retryDelay = 1000;
+    };
+    es.onmessage = (msg) => {
+        if (msg.lastEventId) {
+            lastEventId = msg.lastEventId;
+        }
+        try {
+            dispatch(JSON.parse(msg.data));
+        } catch {
+            // Skip malformed SSE data
+        }
+    };
+    es.onerror = () => {
+        // EventSource retries by itself unless the server refused the stream
+        if (es.readyState !== EventSource.CLOSED || source !== es) {
+            return;
+        }
+        source = null;
+        sourceTopics = '';
+        scheduleConnect(retryDelay);
+        retryDelay = Math.min(retryDelay * 2, 30000);
+    };
+}
+
+function scheduleConnect(delay: number) {
+    if (reconnectTimer) {
+        clearTimeout(reconnectTimer);
+    }
+    reconnectTimer = setTimeout(connect, delay);
+}
+
+/**
+ * Follows a topic over the shared event stream. Subscriptions made in the
+ * same tick share one reconnect. Returns a function that stops following.
+ */
+export function subscribeEvents<T = unknown>(topic: EventTopic, handler: ServerEventHandler<T>): () => void {
+    let set = handlers.get(topic);
+    if (!set) {
+        set = new Set();
+        handlers.set(topic, set);
+    }
+    set.add(handler as ServerEventHandler);
+    scheduleConnect(0);
+    return () => {
+        const set = handlers.get(topic);
+        if (!set) {
+            return;
+        }
+        set.delete(handler as ServerEventHandler);
+        if (set.size === 0) {
+            handlers.delete(topic);
+            scheduleConnect(0);
+        }
+    };
+}
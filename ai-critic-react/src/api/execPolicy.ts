@@ -0,0 +1,137 @@
+// Exec policy API client (admin only): allow, deny or ask rules for commands
+// run through /api/exec, for starting terminal sessions and for coding agents'
+// shell commands. Terminals are judged by the shell they launch; commands
+// typed into them are not checked. Agents lose shell access while a rule could
+// stop their commands, except cursor approvals, which are checked on approve.
+
+import { subscribeEvents } from './events';
+
+export type ExecAction = 'allow' | 'deny' | 'ask';
+export type ExecSource = 'exec' | 'terminal' | 'agent';
+
+export interface ExecRule {
+    /**
+     * Matched against the program's base name and arguments; * matches anything.
+     * Allow rules never match lines with shell metacharacters (; & | ` < > $().
+     */
+    pattern: string;
+    action: ExecAction;
+    /** Empty means every source. */
+    sources?: ExecSource[];
+    note?: string;
+}
+
+export interface ExecPolicy {
+    /** Decides commands no rule matches; empty means allow. */
+    default?: ExecAction;
+    /** Tried in order; the first match decides. */
+    rules: ExecRule[];
+    /** Go duration an ask waits before it is denied; default 5m. */
+    approval_timeout?: string;
+}
+
+export interface ExecApproval {
+    id: string;
+    source: ExecSource;
+    user: string;
+    command: string;
+    argv: string[];
+    dir?: string;
+    rule?: string;
+    requested_at: string;
+    expires_at: string;
+}
+
+export interface ExecApprovalEvent {
+    type: 'pending' | 'resolved';
+    approval: ExecApproval;
+    /** Set on resolved events. */
+    decision?: 'allowed' | 'denied';
+}
+
+export interface ExecDecision {
+    time: string;
+    source: ExecSource;
+    user: string;
+    command: string;
+    dir?: string;
+    decision: 'allowed' | 'denied';
+    reason: 'rule' | 'default' | 'approved' | 'rejected' | 'timeout' | 'canceled';
+    rule?: string;
+    by?: string;
+}
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+function jsonInit(method: string, body: unknown): RequestInit {
+    return {
+        method,
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+    };
+}
+
+export async function fetchExecPolicy(): Promise<ExecPolicy> {
+    return request('/api/exec-policy', undefined, 'Failed to fetch exec policy');
+}
+
+export async function saveExecPolicy(policy: ExecPolicy): Promise<ExecPolicy> {
+    return request('/api/exec-policy', jsonInit('PUT', policy), 'Failed to save exec policy');
+}
+
+/** Evaluates a command against the saved policy without running it. */
+export async function checkExecPolicy(argv: string[], source?: ExecSource): Promise<{ action: ExecAction; rule: ExecRule | null }> {
+    return request('/api/exec-policy/check', jsonInit('POST', { source, argv }), 'Failed to check command');
+}
+
+export async function fetchExecApprovals(): Promise<ExecApproval[]> {
+    const data = await request<{ approvals: ExecApproval[] }>('/api/exec-policy/approvals', undefined, 'Failed to fetch approvals');
+    return data.approvals || [];
+}
+
+export async function answerExecApproval(id: string, approve: boolean): Promise<void> {
+    await request('/api/exec-policy/approvals', jsonInit('POST', { id, approve }), 'Failed to answer approval');
+}
+
+/**
+ * Follows approval events over the shared event stream: first a pending
+ * event per waiting command, then every new one. Returns a function that
+ * stops following.
+ */
+export function subscribeExecApprovals(onEvent: (event: ExecApprovalEvent) => void): () => void {
+    let stopped = false;
+    const sendPending = () => {
+        fetchExecApprovals()
+            .then((approvals) => {
+                if (!stopped) {
+                    approvals.forEach((approval) => onEvent({ type: 'pending', approval }));
+                }
+            })
+            .catch(() => { /* the stream still delivers new approvals */ });
+    };
+    const unsubscribe = subscribeEvents<ExecApprovalEvent>('exec-approvals', (event) => {
+        if (event.type === 'reset') {
+            sendPending();
+        } else if (event.data && (event.data.type === 'pending' || event.data.type === 'resolved')) {
+            onEvent(event.data);
+        }
+    });
+    sendPending();
+    return () => {
+        stopped = true;
+        unsubscribe();
+    };
+}
+
+export async function fetchExecDecisions(limit?: number): Promise<ExecDecision[]> {
+    const params = limit ? `?limit=${limit}` : '';
+    const data = await request<{ decisions: ExecDecision[] }>(`/api/exec-policy/decisions${params}`, undefined, 'Failed to fetch decisions');
+    return data.decisions || [];
+}
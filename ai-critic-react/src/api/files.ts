@@ -1,5 +1,7 @@
 // File API for server file management
 
+import { cachedFetch } from './cachedFetch';
+
 export interface FilePartialResult {
     content: string;
     totalSize: number;
@@ -53,6 +55,96 @@ export async function fetchServerFiles(basePath: string, path?: string): Promise
     return resp.json();
 }
 
+export interface TreeEntry {
+    name: string;
+    path: string; // relative to the project dir
+    is_dir: boolean;
+    is_symlink?: boolean;
+    size: number;
+    mod_time: string;
+    git_status?: 'modified' | 'added' | 'deleted' | 'renamed' | 'copied' | 'untracked' | 'ignored' | 'conflicted';
+    staged?: boolean;
+    changes?: number; // changed files below a directory
+    is_git_dir?: boolean;
+    is_git_worktree?: boolean;
+}
+
+export interface TreeListing {
+    dir: string;
+    path: string;
+    is_repo: boolean;
+    entries: TreeEntry[];
+}
+
+// List one directory of a project with git status, for lazy tree browsing
+export async function fetchFileTree(dir: string, path: string = '', includeIgnored: boolean = true): Promise<TreeListing> {
+    let url = `/api/files/tree?dir=${encodeURIComponent(dir)}&path=${encodeURIComponent(path)}`;
+    if (!includeIgnored) url += '&ignored=false';
+    const resp = await cachedFetch(url);
+    if (!resp.ok) {
+        const err = await resp.json().catch(() => ({ error: 'Failed to list directory' }));
+        throw new Error(err.error || 'Failed to list directory');
+    }
+    return resp.json();
+}
+
+export interface ProjectFileContent {
+    path: string;
+    size: number;
+    mod_time: string;
+    hash: string; // pass back as expectedHash when saving
+    language: string;
+    binary?: boolean;
+    too_large?: boolean;
+    content: string; // empty for binary and too large files
+}
+
+// Thrown by saveProjectFileContent when the file changed since it was loaded
+export class FileConflictError extends Error {
+    current: ProjectFileContent | null;
+    constructor(message: string, current: ProjectFileContent | null) {
+        super(message);
+        this.name = 'FileConflictError';
+        this.current = current;
+    }
+}
+
+// Read a project file for editing
+export async function fetchProjectFileContent(dir: string, path: string, maxSize?: number): Promise<ProjectFileContent> {
+    let url = `/api/files/content?dir=${encodeURIComponent(dir)}&path=${encodeURIComponent(path)}`;
+    if (maxSize) url += `&max_size=${maxSize}`;
+    const resp = await fetch(url);
+    if (!resp.ok) {
+        const err = await resp.json().catch(() => ({ error: 'Failed to read file' }));
+        throw new Error(err.error || 'Failed to read file');
+    }
+    return resp.json();
+}
+
+// Save a project file if it still has expectedHash; create requires it not to exist
+export async function saveProjectFileContent(
+    dir: string,
+    path: string,
+    content: string,
+    expectedHash: string,
+    create: boolean = false,
+): Promise<ProjectFileContent> {
+    const resp = await fetch('/api/files/content', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ dir, path, content, expected_hash: expectedHash, create }),
+    });
+    if (resp.status === 409) {
+        const err = await resp.json().catch(() => ({}));
+        throw new FileConflictError(err.error || 'File has changed', err.current || null);
+    }
+    if (!resp.ok) {
+        const err = await resp.json().catch(() => ({ error: 'Failed to save file' }));
+        throw new Error(err.error || 'Failed to save file');
+    }
+    return resp.json();
+}
+
 export async function fetchHomeDir(): Promise<string> {
     const resp = await fetch('/api/files/home');
     if (!resp.ok) throw new Error('Failed to fetch home directory');
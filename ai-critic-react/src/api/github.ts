@@ -0,0 +1,77 @@
+// Pull request API client for GitHub, GitLab (merge requests) and
+// Bitbucket; the forge follows from the origin of dir. For GitHub the token
+// is the one from the OAuth flow (see fetchGithubRepos), for the others a
+// personal or repository access token.
+
+export type Forge = 'github' | 'gitlab' | 'bitbucket';
+
+export interface PullRequest {
+    forge: Forge;
+    number: number;
+    title: string;
+    body?: string;
+    author: string;
+    draft: boolean;
+    head_ref: string;
+    head_sha: string;
+    base_ref: string;
+    html_url: string;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface PullRequestDetail {
+    pull: PullRequest;
+    /** Unified diff; pass it as diffContext to the review endpoints. */
+    diff: string;
+}
+
+export interface PullReviewComment {
+    path: string;
+    line: number;
+    start_line?: number;
+    body: string;
+}
+
+export interface PullReviewRequest {
+    body?: string;
+    event?: 'COMMENT' | 'APPROVE' | 'REQUEST_CHANGES';
+    /** head_sha of the reviewed version. GitLab has no REQUEST_CHANGES. */
+    commit_id?: string;
+    comments?: PullReviewComment[];
+}
+
+export interface PullReview {
+    id: number;
+    state: string;
+    html_url: string;
+}
+
+async function request<T>(url: string, token: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, {
+        ...init,
+        headers: { ...init?.headers, Authorization: `token ${token}` },
+    });
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+// List the open pull requests of the repository dir's origin points to
+export function listPullRequests(token: string, dir: string): Promise<PullRequest[]> {
+    return request(`/api/git/pulls?dir=${encodeURIComponent(dir)}`, token, undefined, 'Failed to list pull requests');
+}
+
+export function getPullRequest(token: string, dir: string, number: number): Promise<PullRequestDetail> {
+    return request(`/api/git/pulls/${number}?dir=${encodeURIComponent(dir)}`, token, undefined, 'Failed to get pull request');
+}
+
+export function postPullReview(token: string, dir: string, number: number, review: PullReviewRequest): Promise<PullReview> {
+    return request(`/api/git/pulls/${number}/reviews?dir=${encodeURIComponent(dir)}`, token, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(review),
+    }, 'Failed to post review');
+}
@@ -0,0 +1,82 @@
+// In-app help API client
+
+export interface HelpEndpointSummary {
+    id: string;
+    method: string;
+    path: string;
+    summary: string;
+}
+
+export interface HelpTopic {
+    name: string;
+    description: string;
+    /** Web UI pages the topic belongs to. */
+    routes: string[];
+    endpoints: HelpEndpointSummary[];
+}
+
+export interface HelpIndex {
+    title: string;
+    version: string;
+    description: string;
+    topics: HelpTopic[];
+}
+
+export interface HelpContext {
+    route: string;
+    /** False when no topic claims the route; topics then lists all of them. */
+    matched: boolean;
+    topics: HelpTopic[];
+}
+
+export interface HelpParameter {
+    name: string;
+    in: 'query' | 'path';
+    type?: string;
+    enum?: string[];
+    required?: boolean;
+    description?: string;
+    example?: string;
+}
+
+export interface HelpResponse {
+    status: string;
+    description: string;
+    content_type?: string;
+    example?: unknown;
+}
+
+export interface HelpEndpoint {
+    id: string;
+    method: string;
+    path: string;
+    topic: string;
+    summary: string;
+    description?: string;
+    parameters?: HelpParameter[];
+    request_example?: unknown;
+    request_required?: boolean;
+    responses: HelpResponse[];
+    curl: string;
+}
+
+async function getJSON<T>(url: string, what: string): Promise<T> {
+    const resp = await fetch(url);
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || `Failed to fetch ${what}`);
+    }
+    return resp.json();
+}
+
+export function fetchHelpIndex(): Promise<HelpIndex> {
+    return getJSON('/api/help', 'help');
+}
+
+export function fetchHelpContext(route: string): Promise<HelpContext> {
+    return getJSON(`/api/help/context?route=${encodeURIComponent(route)}`, 'help');
+}
+
+export function fetchHelpEndpoint(id: string): Promise<HelpEndpoint> {
+    return getJSON(`/api/help/endpoints/${encodeURIComponent(id)}`, 'endpoint help');
+}
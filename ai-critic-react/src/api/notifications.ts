@@ -0,0 +1,118 @@
+// Notifications API client: delivery settings (admin only) and the Web Push
+// subscription of this browser.
+
+export type NotificationEvent = 'agent_finished' | 'review_done' | 'push_failed' | 'tunnel_degraded';
+
+export interface NotificationTarget {
+    id?: string;
+    type: 'ntfy' | 'webhook';
+    /** ntfy topic URL, e.g. https://ntfy.sh/my-topic, or webhook URL. */
+    url: string;
+    /** Bearer token for protected ntfy topics. */
+    token?: string;
+}
+
+export interface NotificationSettings {
+    /** Turns event types on or off; types not listed are on. */
+    events: Partial<Record<NotificationEvent, boolean>>;
+    targets: NotificationTarget[];
+    /** mailto: or https: URL identifying the sender to push services. */
+    subject?: string;
+}
+
+export interface NotificationSettingsResponse {
+    settings: NotificationSettings;
+    event_types: NotificationEvent[];
+}
+
+export interface DeliveryResult {
+    /** Target ID or push subscription endpoint. */
+    target: string;
+    error?: string;
+}
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+function jsonInit(method: string, body: unknown): RequestInit {
+    return {
+        method,
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+    };
+}
+
+export async function fetchNotificationSettings(): Promise<NotificationSettingsResponse> {
+    return request('/api/settings/notifications', undefined, 'Failed to fetch notification settings');
+}
+
+export async function saveNotificationSettings(settings: NotificationSettings): Promise<NotificationSettingsResponse> {
+    return request('/api/settings/notifications', jsonInit('POST', settings), 'Failed to save notification settings');
+}
+
+/** Sends a test notification everywhere and reports each delivery. */
+export async function testNotifications(): Promise<DeliveryResult[]> {
+    const data = await request<{ results: DeliveryResult[] }>('/api/settings/notifications/test', { method: 'POST' }, 'Failed to send test notification');
+    return data.results || [];
+}
+
+export function pushSupported(): boolean {
+    return 'serviceWorker' in navigator && 'PushManager' in window && 'Notification' in window;
+}
+
+async function fetchVapidPublicKey(): Promise<string> {
+    const data = await request<{ key: string }>('/api/notifications/vapid-public-key', undefined, 'Failed to fetch push key');
+    return data.key;
+}
+
+function base64UrlToBytes(s: string): Uint8Array<ArrayBuffer> {
+    const b64 = s.replace(/-/g, '+').replace(/_/g, '/') + '='.repeat((4 - (s.length % 4)) % 4);
+    const raw = atob(b64);
+    const bytes = new Uint8Array(raw.length);
+    for (let i = 0; i < raw.length; i++) {
+        bytes[i] = raw.charCodeAt(i);
+    }
+    return bytes;
+}
+
+/** Returns the push subscription of this browser, if any. */
+export async function currentPushSubscription(): Promise<PushSubscription | null> {
+    if (!pushSupported()) {
+        return null;
+    }
+    const reg = await navigator.serviceWorker.getRegistration('/');
+    return reg ? reg.pushManager.getSubscription() : null;
+}
+
+/** Asks for permission and subscribes this browser to push notifications. */
+export async function subscribePush(): Promise<void> {
+    if (!pushSupported()) {
+        throw new Error('Push notifications are not supported by this browser');
+    }
+    if (await Notification.requestPermission() !== 'granted') {
+        throw new Error('Notification permission was denied');
+    }
+    const reg = await navigator.serviceWorker.register('/sw.js');
+    await navigator.serviceWorker.ready;
+    const sub = await reg.pushManager.subscribe({
+        userVisibleOnly: true,
+        applicationServerKey: base64UrlToBytes(await fetchVapidPublicKey()),
+    });
+    await request('/api/notifications/subscriptions', jsonInit('POST', sub.toJSON()), 'Failed to save push subscription');
+}
+
+/** Unsubscribes this browser from push notifications. */
+export async function unsubscribePush(): Promise<void> {
+    const sub = await currentPushSubscription();
+    if (!sub) {
+        return;
+    }
+    await request(`/api/notifications/subscriptions?endpoint=${encodeURIComponent(sub.endpoint)}`, { method: 'DELETE' }, 'Failed to remove push subscription');
+    await sub.unsubscribe();
+}
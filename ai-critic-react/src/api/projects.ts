@@ -122,6 +122,61 @@ export async function updateProject(id: string, updates: ProjectUpdate): Promise
     return resp.json();
 }
 
+// ---- Clone into the workspace ----
+
+export interface ProjectCloneRequest {
+    repo_url: string;
+    branch?: string;
+    /** Project and directory name; the repository name by default. */
+    name?: string;
+    /** Encrypted with the server's public key; the clone then uses SSH. */
+    ssh_key?: string;
+    ssh_key_id?: string;
+}
+
+/** Clone into a new workspace directory and register it; the response streams SSE progress ending in done {dir, projectId}. */
+export async function cloneProject(req: ProjectCloneRequest): Promise<Response> {
+    return fetch('/api/projects/clone', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    });
+}
+
+// ---- Active project ----
+// Review, file, search and agent requests without a dir work on the
+// session's active project; send PROJECT_HEADER to pick one per request.
+
+export const PROJECT_HEADER = 'X-Project-ID';
+
+export type ActiveProject = Omit<ProjectInfo, 'dir_exists' | 'git_status'>;
+
+export async function fetchActiveProject(): Promise<ActiveProject | null> {
+    const resp = await fetch('/api/projects/active');
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || 'Failed to get active project');
+    }
+    return data.project;
+}
+
+export async function setActiveProject(id: string): Promise<ActiveProject> {
+    const resp = await fetch('/api/projects/active', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id }),
+    });
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || 'Failed to set active project');
+    }
+    return data.project;
+}
+
+export async function clearActiveProject(): Promise<void> {
+    await fetch('/api/projects/active', { method: 'DELETE' });
+}
+
 // ---- Git Operations (SSE streaming) ----
 
 const GitOps = {
@@ -2,6 +2,7 @@ import type {
     GitDiffResult, 
     ConfigResponse,
 } from '../components/code-review/types';
+import { cachedFetch } from './cachedFetch';
 
 // Get configuration including initial directory and available providers/models
 export async function getConfig(): Promise<ConfigResponse> {
@@ -11,7 +12,7 @@ export async function getConfig(): Promise<ConfigResponse> {
 
 // Get git diff for a directory
 export async function getDiff(dir?: string): Promise<GitDiffResult> {
-    const response = await fetch('/api/review/diff', {
+    const response = await cachedFetch('/api/review/diff', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ dir }),
@@ -86,11 +87,12 @@ export interface GitStatusFile {
 export interface GitStatusResult {
     branch: string;
     files: GitStatusFile[];
+    commitHooks?: string[]; // git hooks a commit from the UI will run
 }
 
 // Get git status with staged/unstaged separation
 export async function getGitStatus(dir?: string): Promise<GitStatusResult> {
-    const response = await fetch('/api/review/status', {
+    const response = await cachedFetch('/api/review/status', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ dir }),
@@ -102,20 +104,6 @@ export async function getGitStatus(dir?: string): Promise<GitStatusResult> {
     return response.json();
 }
 
-// List contents of an untracked directory
-export async function listUntrackedDir(subDirPath: string, dir?: string): Promise<{ files: GitStatusFile[] }> {
-    const response = await fetch('/api/review/list-untracked-dir', {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ dir, subDirPath }),
-    });
-    if (!response.ok) {
-        const error = await response.json();
-        throw new Error(error.error || 'Failed to list directory');
-    }
-    return response.json();
-}
-
 // Git commit result
 export interface GitCommitResult {
     status: string;
@@ -182,7 +170,7 @@ export interface Worktree {
 
 // List branches sorted by recent commit date
 export async function getGitBranches(dir?: string): Promise<GitBranch[]> {
-    const response = await fetch('/api/review/branches', {
+    const response = await cachedFetch('/api/review/branches', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ dir }),
@@ -335,3 +323,96 @@ export async function gitPushStream(dir?: string, sshKey?: string): Promise<Resp
     }
     return response;
 }
+
+// A review finding anchored to lines of the new version of a file
+export interface ReviewFinding {
+    file: string;
+    startLine: number; // 0 for a finding about the whole file
+    endLine: number;
+    rule?: string;
+    severity: 'error' | 'warning' | 'info';
+    message: string;
+    suggestion?: string;
+    inDiff: boolean; // whether the lines are inside a hunk of the diff
+}
+
+export interface FindingsResult {
+    findings: ReviewFinding[];
+    model: string;
+    parts: number;
+    cached: boolean;
+    repaired: boolean;
+    dropped: number;
+}
+
+export interface RuleSelection {
+    enable?: string[];
+    disable?: string[];
+}
+
+export interface FindingsOptions {
+    dir?: string;
+    diffContext?: string; // reviewed instead of the changes in dir
+    provider?: string;
+    model?: string;
+    sessionId?: string;
+    noCache?: boolean;
+    rules?: RuleSelection; // rule packs to turn on or off for this review
+}
+
+// Review a diff into structured findings for inline annotations
+export async function getReviewFindings(options: FindingsOptions): Promise<FindingsResult> {
+    const response = await fetch('/api/review/findings', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(options),
+    });
+    if (!response.ok) {
+        const error = await response.json();
+        throw new Error(error.error || 'Failed to get review findings');
+    }
+    return response.json();
+}
+
+export interface GitHook {
+    name: string;
+    path: string;
+    size: number;
+    executable: boolean; // git ignores hooks that are not executable
+    manager?: 'husky' | 'pre-commit' | 'lefthook';
+}
+
+export interface GitHooksInfo {
+    dir: string; // effective hooks directory
+    hooksPath?: string; // configured core.hooksPath
+    hooks: GitHook[];
+    disabled: boolean; // commits made by the server skip the hooks
+    commitHooks: string[];
+}
+
+async function postHooks<T>(path: string, body: Record<string, unknown>, failure: string): Promise<T> {
+    const response = await fetch(path, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body),
+    });
+    if (!response.ok) {
+        const error = await response.json();
+        throw new Error(error.error || failure);
+    }
+    return response.json();
+}
+
+// List the git hooks installed in a repository
+export function listGitHooks(dir?: string): Promise<GitHooksInfo> {
+    return postHooks('/api/review/hooks', { dir }, 'Failed to list git hooks');
+}
+
+export function showGitHook(name: string, dir?: string): Promise<{ hook: GitHook; content: string }> {
+    return postHooks('/api/review/hooks/show', { dir, name }, 'Failed to show git hook');
+}
+
+// Skip (or run again) the hooks for commits the server makes in dir
+export function setGitHooksDisabled(disabled: boolean, dir?: string): Promise<GitHooksInfo> {
+    return postHooks('/api/review/hooks/disable', { dir, disabled }, 'Failed to update git hooks');
+}
@@ -0,0 +1,68 @@
+// Review rule packs API client
+
+export type RulePackSource = 'builtin' | 'user' | 'project';
+
+export interface RuleFile {
+    name: string;
+    content: string;
+}
+
+export interface RulePack {
+    name: string;
+    description?: string;
+    /** Enabled packs apply to reviews that do not choose otherwise. */
+    enabled: boolean;
+    source: RulePackSource;
+    /** Source of the pack of the same name this one replaces. */
+    overrides?: RulePackSource;
+    files: RuleFile[];
+}
+
+export interface RulePackUpdate {
+    description?: string;
+    enabled?: boolean;
+    files?: RuleFile[];
+}
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+function dirQuery(dir?: string): string {
+    return dir ? `?dir=${encodeURIComponent(dir)}` : '';
+}
+
+// List the rule packs; with dir, the project's .ai-critic/rules packs are included
+export function listRulePacks(dir?: string): Promise<RulePack[]> {
+    return request(`/api/rules${dirQuery(dir)}`, undefined, 'Failed to list rule packs');
+}
+
+export function getRulePack(name: string, dir?: string): Promise<RulePack> {
+    return request(`/api/rules/${encodeURIComponent(name)}${dirQuery(dir)}`, undefined, 'Failed to get rule pack');
+}
+
+export function createRulePack(pack: Omit<RulePack, 'source' | 'overrides'>): Promise<RulePack> {
+    return request('/api/rules', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(pack),
+    }, 'Failed to create rule pack');
+}
+
+// Builtin and project packs only accept enabled
+export function updateRulePack(name: string, update: RulePackUpdate, dir?: string): Promise<RulePack> {
+    return request(`/api/rules/${encodeURIComponent(name)}${dirQuery(dir)}`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(update),
+    }, 'Failed to update rule pack');
+}
+
+export async function deleteRulePack(name: string): Promise<void> {
+    await request(`/api/rules/${encodeURIComponent(name)}`, { method: 'DELETE' }, 'Failed to delete rule pack');
+}
@@ -0,0 +1,59 @@
+// Project scaffolding API client
+
+export interface TemplateVariable {
+    name: string;
+    description?: string;
+    /** May reference earlier variables, e.g. "example.com/{{.name}}". */
+    default?: string;
+    required?: boolean;
+}
+
+export interface ScaffoldTemplate {
+    name: string;
+    description?: string;
+    /** False for custom templates under .ai-critic/templates. */
+    builtin: boolean;
+    variables: TemplateVariable[];
+}
+
+export interface GenerateProjectRequest {
+    template: string;
+    /** Directory to create; must not exist or be empty. */
+    dir: string;
+    /** Defaults to the base name of dir. */
+    name?: string;
+    vars?: Record<string, string>;
+    no_git?: boolean;
+    parent_id?: string;
+}
+
+export interface GenerateProjectResult {
+    dir: string;
+    name: string;
+    files: string[];
+    vars: Record<string, string>;
+    git: boolean;
+    project_id: string;
+}
+
+export async function fetchScaffoldTemplates(): Promise<ScaffoldTemplate[]> {
+    const resp = await fetch('/api/scaffold/templates');
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to fetch templates');
+    }
+    return resp.json();
+}
+
+export async function generateProject(req: GenerateProjectRequest): Promise<GenerateProjectResult> {
+    const resp = await fetch('/api/scaffold/generate', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    });
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to generate project');
+    }
+    return resp.json();
+}
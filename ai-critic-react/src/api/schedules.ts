@@ -0,0 +1,85 @@
+// Schedules API client: built-in maintenance tasks run on cron expressions
+// (5 fields, UTC).
+
+export interface ScheduleRun {
+    started_at: string;
+    finished_at: string;
+    output?: string;
+    error?: string;
+}
+
+export interface Schedule {
+    id: string;
+    name: string;
+    task: string;
+    cron: string;
+    params?: Record<string, string>;
+    enabled: boolean;
+    created_at: string;
+    updated_at: string;
+    last_run?: ScheduleRun;
+    running: boolean;
+    /** Absent when disabled. */
+    next_run_at?: string;
+}
+
+export interface ScheduleTask {
+    name: string;
+    description: string;
+    /** Accepted params and their defaults. */
+    params?: Record<string, string>;
+}
+
+export interface ScheduleRequest {
+    name?: string;
+    task: string;
+    cron: string;
+    params?: Record<string, string>;
+    enabled: boolean;
+}
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+function scheduleURL(id: string): string {
+    return `/api/schedules/${encodeURIComponent(id)}`;
+}
+
+export function listSchedules(): Promise<Schedule[]> {
+    return request('/api/schedules', undefined, 'Failed to list schedules');
+}
+
+export function listScheduleTasks(): Promise<ScheduleTask[]> {
+    return request('/api/schedules/tasks', undefined, 'Failed to list schedule tasks');
+}
+
+export function createSchedule(req: ScheduleRequest): Promise<Schedule> {
+    return request('/api/schedules', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    }, 'Failed to create schedule');
+}
+
+export function updateSchedule(id: string, req: ScheduleRequest): Promise<Schedule> {
+    return request(scheduleURL(id), {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    }, 'Failed to update schedule');
+}
+
+export function deleteSchedule(id: string): Promise<{ status: string }> {
+    return request(scheduleURL(id), { method: 'DELETE' }, 'Failed to delete schedule');
+}
+
+/** Start a run now; poll the schedule for its last_run. */
+export function runSchedule(id: string): Promise<Schedule> {
+    return request(`${scheduleURL(id)}/run`, { method: 'POST' }, 'Failed to run schedule');
+}
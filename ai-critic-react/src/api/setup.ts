@@ -0,0 +1,62 @@
+// First-run setup wizard API client
+
+export interface SetupState {
+    credentials: boolean;
+    encryption_keys: boolean;
+    config_file: boolean;
+    config_error?: string;
+    domains: string[];
+    cloudflared_installed: boolean;
+    cloudflared_authenticated: boolean;
+    complete: boolean;
+}
+
+export interface SetupOptions {
+    /** Login credential; empty generates one. */
+    credential?: string;
+    /** Public domain to serve through a Cloudflare tunnel; empty skips the tunnel. */
+    domain?: string;
+    tunnel_name?: string;
+    /** Start the tunnel right away instead of on the next server start. */
+    start_tunnel?: boolean;
+    /** Test the configured AI providers' API keys and the domain's DNS. */
+    verify?: boolean;
+}
+
+export interface SetupStepResult {
+    name: string;
+    status: 'existing' | 'created' | 'skipped' | 'failed' | 'passed' | 'warning';
+    detail?: string;
+}
+
+export interface SetupResult {
+    steps: SetupStepResult[];
+    /** Set only when the wizard generated the credential; shown once. */
+    credential?: string;
+    url?: string;
+}
+
+export async function fetchSetupStatus(): Promise<SetupState> {
+    const resp = await fetch('/api/setup/status');
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to fetch setup status');
+    }
+    return resp.json();
+}
+
+/**
+ * Runs the wizard, streaming progress as SSE. The stream carries log events,
+ * one {"type":"result","result":SetupResult} event (use consumeSSEStream's
+ * onCustom), then done or error.
+ */
+export function runSetupStreaming(opts: SetupOptions): Promise<Response> {
+    return fetch('/api/setup/run', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Accept': 'text/event-stream',
+        },
+        body: JSON.stringify(opts),
+    });
+}
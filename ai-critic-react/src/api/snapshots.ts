@@ -0,0 +1,46 @@
+// Snapshot API client: read-only copies of a project at a past commit or
+// checkpoint. Browse and search a snapshot's dir like a project directory.
+
+export interface Snapshot {
+    id: string;
+    repo_dir: string;
+    ref?: string;
+    commit: string;
+    project?: string;
+    checkpoint?: number;
+    dir: string;
+    created_at: string;
+    /** Extended each time the snapshot is requested again. */
+    expires_at: string;
+    note?: string;
+}
+
+export type SnapshotRequest =
+    | { dir: string; ref: string }
+    | { dir: string; project: string; checkpoint: number };
+
+async function request<T>(url: string, init: RequestInit | undefined, failure: string): Promise<T> {
+    const resp = await fetch(url, init);
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || failure);
+    }
+    return data;
+}
+
+export function listSnapshots(): Promise<Snapshot[]> {
+    return request('/api/snapshots', undefined, 'Failed to list snapshots');
+}
+
+/** Materialize a snapshot, or get the existing one of the same commit or checkpoint. */
+export function createSnapshot(req: SnapshotRequest): Promise<Snapshot> {
+    return request('/api/snapshots', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req),
+    }, 'Failed to create snapshot');
+}
+
+export function deleteSnapshot(id: string): Promise<{ status: string }> {
+    return request(`/api/snapshots/${encodeURIComponent(id)}`, { method: 'DELETE' }, 'Failed to delete snapshot');
+}
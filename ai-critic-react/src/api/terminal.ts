@@ -3,6 +3,9 @@ export interface TerminalSessionInfo {
     name: string;
     cwd: string;
     created_at: string;
+    /** "running", or "exited" once the shell ends */
+    status?: string;
+    /** whether any client is attached; a running session without one can be reconnected to */
     connected: boolean;
 }
 
@@ -40,6 +43,104 @@ export async function fetchTerminalSessionsPaginated(page: number = 1, pageSize:
     return resp.json();
 }
 
+/** Recent raw output of a session, the last `lines` lines (default: the configured scrollback_lines). */
+export async function fetchTerminalScrollback(sessionId: string, lines?: number): Promise<string> {
+    const params = lines ? `?lines=${lines}` : '';
+    const resp = await fetch(`/api/terminal/sessions/${encodeURIComponent(sessionId)}/scrollback${params}`);
+    if (!resp.ok) throw new Error('Failed to fetch scrollback');
+    return resp.text();
+}
+
 export async function deleteTerminalSession(sessionId: string): Promise<void> {
     await fetch(`/api/terminal/sessions?id=${encodeURIComponent(sessionId)}`, { method: 'DELETE' });
 }
+
+export interface TerminalTakeoverRequest {
+    id: string;
+    name?: string;
+    requested_at: string;
+}
+
+/** A link to a terminal session; guests connect to `url` read-only. */
+export interface TerminalShare {
+    token: string;
+    session_id: string;
+    created_at: string;
+    expires_at: string;
+    /** "owner", or "guest" while a takeover is granted */
+    control: 'owner' | 'guest';
+    /** the pending takeover request */
+    request?: TerminalTakeoverRequest;
+    /** the granted request while control is "guest" */
+    guest?: TerminalTakeoverRequest;
+    observers: number;
+    url: string;
+}
+
+export async function createTerminalShare(sessionId: string, ttlMinutes?: number): Promise<TerminalShare> {
+    const resp = await fetch('/api/terminal/shares', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ session_id: sessionId, ttl_minutes: ttlMinutes }),
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to share session');
+    return data;
+}
+
+export async function fetchTerminalShares(): Promise<TerminalShare[]> {
+    const resp = await fetch('/api/terminal/shares');
+    if (!resp.ok) throw new Error('Failed to fetch shares');
+    return resp.json();
+}
+
+export async function revokeTerminalShare(token: string): Promise<void> {
+    const resp = await fetch(`/api/terminal/shares?token=${encodeURIComponent(token)}`, { method: 'DELETE' });
+    if (!resp.ok) {
+        const data = await resp.json();
+        throw new Error(data.error || 'Failed to revoke share');
+    }
+}
+
+/** The owner's answer to a takeover request; connections whose role changes are closed and should reconnect. */
+export async function answerTerminalTakeover(token: string, action: 'grant' | 'deny' | 'reclaim'): Promise<TerminalShare> {
+    const resp = await fetch('/api/terminal/shares/takeover', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token, action }),
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to answer takeover');
+    return data;
+}
+
+export interface TerminalTakeoverStatus {
+    session_id: string;
+    expires_at: string;
+    control: 'owner' | 'guest';
+    /** whether the asking guest's request awaits an answer */
+    pending: boolean;
+    /** whether the asking guest has control; reconnect with `request` set to write */
+    granted: boolean;
+}
+
+/** Asks the owner for control of a shared session, returning the request ID. */
+export async function requestTerminalTakeover(token: string, name?: string): Promise<string> {
+    const resp = await fetch(`/api/terminal/shared/takeover?token=${encodeURIComponent(token)}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name }),
+    });
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to request control');
+    return data.request_id;
+}
+
+export async function fetchTakeoverStatus(token: string, requestId?: string): Promise<TerminalTakeoverStatus> {
+    const params = new URLSearchParams({ token });
+    if (requestId) params.set('request', requestId);
+    const resp = await fetch(`/api/terminal/shared/takeover?${params}`);
+    const data = await resp.json();
+    if (!resp.ok) throw new Error(data.error || 'Failed to fetch takeover status');
+    return data;
+}
@@ -5,6 +5,8 @@ export interface TerminalConfig {
     shell?: string;       // shell path or name (default: "bash")
     shell_flags?: string[]; // shell flags (default: ["-i"])
     ps1?: string;         // custom PS1 prompt string
+    scrollback_lines?: number; // scrollback returned by default (default: 5000)
+    kill_on_disconnect?: boolean; // end a shell when its client disconnects instead of keeping it for reconnects
 }
 
 export async function fetchTerminalConfig(): Promise<TerminalConfig> {
@@ -0,0 +1,73 @@
+// AI token usage and cost API client
+
+export interface UsageTotals {
+    requests: number;
+    prompt_tokens: number;
+    completion_tokens: number;
+    total_tokens: number;
+    cost_usd: number;
+}
+
+export interface UsageGroup extends UsageTotals {
+    key: string;
+}
+
+export interface DayUsage extends UsageTotals {
+    date: string;
+    provider: string;
+    model: string;
+}
+
+export interface UsageSummary {
+    from: string;
+    to: string;
+    total: UsageTotals;
+    by_provider: UsageGroup[];
+    /** Keyed "provider/model". */
+    by_model: UsageGroup[];
+    by_day: UsageGroup[];
+    entries: DayUsage[];
+}
+
+export interface SessionUsage extends UsageTotals {
+    id: string;
+    kind: 'chat' | 'auto-review' | 'findings';
+    project?: string;
+    provider: string;
+    model: string;
+    first_at: string;
+    last_at: string;
+}
+
+export interface UsageQuery {
+    /** YYYY-MM-DD; defaults to `days` days before `to`. */
+    from?: string;
+    to?: string;
+    days?: number;
+    provider?: string;
+    model?: string;
+}
+
+export async function fetchUsageSummary(query: UsageQuery = {}): Promise<UsageSummary> {
+    const params = new URLSearchParams();
+    for (const [key, value] of Object.entries(query)) {
+        if (value !== undefined && value !== '') params.set(key, String(value));
+    }
+    const resp = await fetch(`/api/usage?${params}`);
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to fetch usage');
+    }
+    return resp.json();
+}
+
+export async function fetchUsageSessions(kind?: string, limit = 50): Promise<SessionUsage[]> {
+    const params = new URLSearchParams({ limit: String(limit) });
+    if (kind) params.set('kind', kind);
+    const resp = await fetch(`/api/usage/sessions?${params}`);
+    if (!resp.ok) {
+        const data = await resp.json().catch(() => ({}));
+        throw new Error(data.error || 'Failed to fetch usage sessions');
+    }
+    return resp.json();
+}
@@ -34,6 +34,10 @@ const INITIAL_MESSAGE: Message = {
 Just ask me anything about your code changes!`
 };
 
+function newChatSessionId(): string {
+    return `chat-${Date.now().toString(36)}-${Math.random().toString(36).slice(2, 8)}`;
+}
+
 export function ChatPanel({ 
     diffContext, 
     provider, 
@@ -48,9 +52,12 @@ export function ChatPanel({
     const [messages, setMessages] = useState<Message[]>([INITIAL_MESSAGE]);
     const [input, setInput] = useState('');
     const [loading, setLoading] = useState(false);
+    const [progress, setProgress] = useState<string | null>(null);
     const messagesEndRef = useRef<HTMLDivElement>(null);
     const messagesContainerRef = useRef<HTMLDivElement>(null);
     const [shouldAutoScroll, setShouldAutoScroll] = useState(true);
+    // Groups this conversation's requests in the server's usage report
+    const sessionIdRef = useRef(newChatSessionId());
 
     const scrollToBottom = () => {
         if (shouldAutoScroll) {
@@ -93,6 +100,7 @@ export function ChatPanel({
                     diffContext,
                     provider,
                     model,
+                    sessionId: sessionIdRef.current,
                 }),
             });
 
@@ -106,6 +114,7 @@ export function ChatPanel({
             const decoder = new TextDecoder();
             let assistantMessage = '';
             let thinkingMessage = '';
+            setProgress(null);
 
             setMessages(prev => [...prev, { role: 'assistant', content: '', thinking: '' }]);
 
@@ -123,7 +132,10 @@ export function ChatPanel({
                             if (data === '[DONE]') continue;
                             try {
                                 const parsed = JSON.parse(data);
-                                if (parsed.content) {
+                                if (parsed.type === 'progress') {
+                                    // large diffs are reviewed in parts first
+                                    setProgress(parsed.message);
+                                } else if (parsed.content) {
                                     if (parsed.type === 'thinking') {
                                         thinkingMessage += parsed.content;
                                     } else {
@@ -153,6 +165,7 @@ export function ChatPanel({
             }]);
         } finally {
             setLoading(false);
+            setProgress(null);
         }
     };
 
@@ -178,6 +191,7 @@ export function ChatPanel({
 
     const handleClear = () => {
         setMessages([INITIAL_MESSAGE]);
+        sessionIdRef.current = newChatSessionId();
         setInput('');
     };
 
@@ -289,7 +303,7 @@ export function ChatPanel({
                         fontSize: '12px',
                         padding: '8px',
                     }}>
-                        Thinking...
+                        {progress || 'Thinking...'}
                     </div>
                 )}
                 <div ref={messagesEndRef} />
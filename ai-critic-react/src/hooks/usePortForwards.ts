@@ -1,11 +1,13 @@
-import { useState, useEffect, useRef, useCallback } from 'react';
+import { useState, useEffect, useCallback } from 'react';
 import { useCurrent } from './useCurrent';
 import {
     fetchProviders as apiFetchProviders,
+    fetchPorts as apiFetchPorts,
     addPort as apiAddPort,
     removePort as apiRemovePort,
 } from '../api/ports';
 import type { ProviderInfo as ApiProviderInfo, AddPortRequest } from '../api/ports';
+import { subscribeEvents } from '../api/events';
 
 // Port forward status
 export const PortStatuses = {
@@ -58,7 +60,6 @@ export function usePortForwards(): UsePortForwardsReturn {
     const [loading, setLoading] = useState(true);
     const [error, setError] = useState<string | null>(null);
     const portsRef = useCurrent(ports);
-    const retryTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
 
     // Fetch available providers once on mount
     useEffect(() => {
@@ -67,49 +68,36 @@ export function usePortForwards(): UsePortForwardsReturn {
             .catch(() => { /* ignore provider fetch errors */ });
     }, []);
 
-    // SSE connection for real-time port status updates
+    // Real-time port status updates over the shared event stream
     useEffect(() => {
-        let es: EventSource | null = null;
-        let retryDelay = 1000;
         let cancelled = false;
-
-        function connect() {
-            if (cancelled) return;
-
-            es = new EventSource('/api/ports/events');
-
-            es.onmessage = (event) => {
-                try {
-                    const data = JSON.parse(event.data) as PortForward[];
-                    setPorts(data);
+        const refresh = () => {
+            apiFetchPorts()
+                .then((data) => {
+                    if (cancelled) return;
+                    setPorts(data as PortForward[]);
                     setError(null);
                     setLoading(false);
-                    retryDelay = 1000; // reset on success
-                } catch {
-                    // ignore parse errors
-                }
-            };
-
-            es.onerror = () => {
-                es?.close();
-                es = null;
-                if (!cancelled) {
-                    // Exponential backoff reconnect, max 30s
-                    retryTimerRef.current = setTimeout(connect, retryDelay);
-                    retryDelay = Math.min(retryDelay * 2, 30000);
-                    setError('Connection lost, reconnecting…');
-                }
-            };
-        }
-
-        connect();
-
+                })
+                .catch((err: Error) => {
+                    if (cancelled) return;
+                    setError(err.message);
+                    setLoading(false);
+                });
+        };
+        const unsubscribe = subscribeEvents<PortForward[]>('ports', (event) => {
+            if (event.type === 'reset') {
+                refresh();
+                return;
+            }
+            setPorts(event.data ?? []);
+            setError(null);
+            setLoading(false);
+        });
+        refresh();
         return () => {
             cancelled = true;
-            es?.close();
-            if (retryTimerRef.current) {
-                clearTimeout(retryTimerRef.current);
-            }
+            unsubscribe();
         };
     }, []);
 
@@ -19,8 +19,10 @@ import { ProjectDetailIcon } from '../pure-view/icons/ProjectDetailIcon';
 import { LayoutIcon } from '../pure-view/icons/LayoutIcon';
 import { ServerIcon } from '../pure-view/icons/ServerIcon';
 import { UploadIcon } from '../pure-view/icons/UploadIcon';
+import { HelpIcon } from '../pure-view/icons/HelpIcon';
 import { NavButton } from '../pure-view/buttons/NavButton';
 import { ProjectDropdown } from './mcc/ProjectDropdown';
+import { HelpPanel } from './mcc/HelpPanel';
 import { TerminalManager } from './mcc/terminal/TerminalManager';
 import type { TerminalManagerHandle } from './mcc/terminal/TerminalManager';
 import { fetchTerminalSessions } from '../api/terminal';
@@ -190,6 +192,7 @@ function MobileCodingConnectorInner() {
     };
 
     const [menuOpen, setMenuOpen] = useState(false);
+    const [helpOpen, setHelpOpen] = useState(false);
 
     const handleMenuNavigate = (path: string) => {
         setMenuOpen(false);
@@ -264,6 +267,10 @@ function MobileCodingConnectorInner() {
                         <BeakerIcon />
                         <span>Experimental</span>
                     </button>
+                    <button className="mcc-drawer-item" onClick={() => { setMenuOpen(false); setHelpOpen(true); }}>
+                        <HelpIcon />
+                        <span>What can I do here?</span>
+                    </button>
                     {serverConfig?.enableMockupInMenu && (
                         <button className="mcc-drawer-item" onClick={() => handleMenuNavigate('/mockups')}>
                             <LayoutIcon />
@@ -274,6 +281,8 @@ function MobileCodingConnectorInner() {
                 </nav>
             </div>
 
+            {helpOpen && <HelpPanel route={location.pathname} onClose={() => setHelpOpen(false)} />}
+
             {/* Main Content */}
             <div className="mcc-content">
                 <div className="mcc-content-inner">
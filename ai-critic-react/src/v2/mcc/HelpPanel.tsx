@@ -0,0 +1,105 @@
+import { useEffect, useState } from 'react';
+import { fetchHelpContext, fetchHelpEndpoint } from '../../api/help';
+import type { HelpContext, HelpEndpoint } from '../../api/help';
+import './KillProcessModal.css';
+import './HelpPanel.css';
+
+export interface HelpPanelProps {
+    /** Path of the current page, e.g. location.pathname. */
+    route: string;
+    onClose: () => void;
+}
+
+function formatExample(example: unknown): string {
+    return typeof example === 'string' ? example : JSON.stringify(example, null, 2);
+}
+
+// HelpPanel answers "what can I do here": the API topics of the current page,
+// with the usage doc and a curl command for each endpoint.
+export function HelpPanel({ route, onClose }: HelpPanelProps) {
+    const [context, setContext] = useState<HelpContext | null>(null);
+    const [selected, setSelected] = useState<HelpEndpoint | null>(null);
+    const [error, setError] = useState<string | null>(null);
+
+    useEffect(() => {
+        setContext(null);
+        setSelected(null);
+        setError(null);
+        fetchHelpContext(route)
+            .then(setContext)
+            .catch(err => setError(String(err)));
+    }, [route]);
+
+    const openEndpoint = (id: string) => {
+        setError(null);
+        fetchHelpEndpoint(id)
+            .then(setSelected)
+            .catch(err => setError(String(err)));
+    };
+
+    return (
+        <div className="mcc-modal-overlay" onClick={onClose}>
+            <div className="mcc-modal mcc-help" onClick={e => e.stopPropagation()}>
+                <div className="mcc-modal-header">
+                    {selected ? (
+                        <button className="mcc-help-back" onClick={() => setSelected(null)}>‹ Back</button>
+                    ) : (
+                        <h3>What can I do here?</h3>
+                    )}
+                    <button className="mcc-modal-close" onClick={onClose}>×</button>
+                </div>
+                <div className="mcc-modal-body mcc-help-body">
+                    {error && <div className="mcc-modal-error">{error}</div>}
+                    {!error && !context && <p>Loading...</p>}
+                    {!selected && context && (
+                        <>
+                            {!context.matched && <p className="mcc-help-note">No specific help for this page; showing everything.</p>}
+                            {context.topics.map(topic => (
+                                <div key={topic.name} className="mcc-help-topic">
+                                    <div className="mcc-help-topic-name">{topic.name}</div>
+                                    <p>{topic.description}</p>
+                                    {topic.endpoints.map(e => (
+                                        <button key={e.id} className="mcc-help-endpoint" onClick={() => openEndpoint(e.id)}>
+                                            <span className="mcc-help-method">{e.method}</span>
+                                            <span>{e.summary}</span>
+                                        </button>
+                                    ))}
+                                </div>
+                            ))}
+                        </>
+                    )}
+                    {selected && (
+                        <div className="mcc-help-doc">
+                            <div className="mcc-help-topic-name">{selected.summary}</div>
+                            <code>{selected.method} {selected.path}</code>
+                            {selected.description && <p>{selected.description}</p>}
+                            {selected.parameters && selected.parameters.length > 0 && (
+                                <ul>
+                                    {selected.parameters.map(p => (
+                                        <li key={p.name}>
+                                            <code>{p.name}</code>{p.required ? ' (required)' : ''}: {p.description}
+                                        </li>
+                                    ))}
+                                </ul>
+                            )}
+                            {selected.request_example !== undefined && (
+                                <>
+                                    <div className="mcc-help-label">Request body</div>
+                                    <pre>{formatExample(selected.request_example)}</pre>
+                                </>
+                            )}
+                            <div className="mcc-help-label">Responses</div>
+                            <ul>
+                                {selected.responses.map(r => (
+                                    <li key={r.status}><b>{r.status}</b> {r.description}</li>
+                                ))}
+                            </ul>
+                            <div className="mcc-help-label">Try it</div>
+                            <pre>{selected.curl}</pre>
+                        </div>
+                    )}
+                </div>
+            </div>
+        </div>
+    );
+}
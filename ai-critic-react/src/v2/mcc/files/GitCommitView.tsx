@@ -1,7 +1,8 @@
 import { useState, useEffect, useMemo, useRef } from 'react';
 import { Link } from 'react-router-dom';
 import { projectPath, toolsPath } from '../../../route/route';
-import { getGitStatus, getDiff, stageFile, unstageFile, gitCommit, gitCheckout, gitRemove, listUntrackedDir, generateCommitMessage } from '../../../api/review';
+import { getGitStatus, getDiff, stageFile, unstageFile, gitCommit, gitCheckout, gitRemove, generateCommitMessage } from '../../../api/review';
+import { fetchFileTree } from '../../../api/files';
 import type { GitStatusFile } from '../../../api/review';
 import type { DiffFile } from '../../../components/code-review/types';
 import { DiffViewer } from '../../DiffViewer';
@@ -191,8 +192,16 @@ export function GitCommitView({ projectName, projectDir, sshKeyId, onBack }: Git
         setLoadingBrowsed(true);
         setError('');
         try {
-            const result = await listUntrackedDir(normalizedPath, projectDir);
-            setBrowsedFiles(result.files);
+            const result = await fetchFileTree(projectDir, normalizedPath, false);
+            setBrowsedFiles(result.entries.map(e => ({
+                path: e.path,
+                status: e.git_status || 'untracked',
+                isStaged: !!e.staged,
+                isDir: e.is_dir,
+                isGitDir: e.is_git_dir,
+                isGitWorktree: e.is_git_worktree,
+                size: e.size,
+            })));
             setBrowsePath(normalizedPath);
         } catch (e) {
             setError(e instanceof Error ? e.message : 'Failed to list directory');
@@ -1,5 +1,5 @@
 import { useState, useEffect } from 'react';
-import { fetchAIConfig, saveAIConfig, type AIProvider, type AIModel } from '../../../../api/ai';
+import { fetchAIConfig, saveAIConfig, type AIProvider, type AIProviderType, type AIModel } from '../../../../api/ai';
 import { EditIcon } from '../../../../pure-view/icons/EditIcon';
 import { FlexInput } from '../../../../pure-view/FlexInput';
 import { Loading } from '../../../../pure-view/Loading';
@@ -27,6 +27,7 @@ export function AIModelsSection() {
     const [draftDefaultModel, setDraftDefaultModel] = useState('');
 
     const [newProviderName, setNewProviderName] = useState('');
+    const [newProviderType, setNewProviderType] = useState<AIProviderType>('');
     const [newProviderBaseURL, setNewProviderBaseURL] = useState('');
     const [newProviderAPIKey, setNewProviderAPIKey] = useState('');
 
@@ -86,6 +87,7 @@ export function AIModelsSection() {
     const startEditProviders = () => {
         setDraftProviders([...providers]);
         setNewProviderName('');
+        setNewProviderType('');
         setNewProviderBaseURL('');
         setNewProviderAPIKey('');
         setEditingProviders(true);
@@ -122,7 +124,8 @@ export function AIModelsSection() {
         const baseURL = newProviderBaseURL.trim();
         const apiKey = newProviderAPIKey.trim();
 
-        if (!name || !baseURL) {
+        // Anthropic and Gemini have default endpoints; OpenAI-compatible ones vary
+        if (!name || (!baseURL && (newProviderType === '' || newProviderType === 'openai'))) {
             setError('Provider name and base URL are required');
             return;
         }
@@ -132,8 +135,11 @@ export function AIModelsSection() {
             return;
         }
 
-        setDraftProviders([...draftProviders, { name, base_url: baseURL, api_key: apiKey }]);
+        const provider: AIProvider = { name, base_url: baseURL, api_key: apiKey };
+        if (newProviderType) provider.type = newProviderType;
+        setDraftProviders([...draftProviders, provider]);
         setNewProviderName('');
+        setNewProviderType('');
         setNewProviderBaseURL('');
         setNewProviderAPIKey('');
         setError(null);
@@ -263,7 +269,7 @@ export function AIModelsSection() {
                                         <div key={i} className="ai-models-item">
                                             <div className="ai-models-item-content">
                                                 <div className="ai-models-item-name">{p.name}</div>
-                                                <div className="ai-models-item-details">{p.base_url}</div>
+                                                <div className="ai-models-item-details">{p.type ? `${p.type} · ` : ''}{p.base_url}</div>
                                                 {p.api_key && (
                                                     <div className="ai-models-item-details">API Key: {'*'.repeat(Math.min(p.api_key.length, 8))}</div>
                                                 )}
@@ -280,7 +286,7 @@ export function AIModelsSection() {
                                             <div key={i} className="ai-models-item ai-models-item-editable">
                                                 <div className="ai-models-item-content">
                                                     <div className="ai-models-item-name">{p.name}</div>
-                                                    <div className="ai-models-item-details">{p.base_url}</div>
+                                                    <div className="ai-models-item-details">{p.type ? `${p.type} · ` : ''}{p.base_url}</div>
                                                     {p.api_key && (
                                                         <div className="ai-models-item-details">API Key: {'*'.repeat(Math.min(p.api_key.length, 8))}</div>
                                                     )}
@@ -304,6 +310,17 @@ export function AIModelsSection() {
                                         onChange={setNewProviderName}
                                         placeholder="Provider name (e.g., openai)"
                                     />
+                                    <select
+                                        className="ai-models-select"
+                                        value={newProviderType}
+                                        onChange={e => setNewProviderType(e.target.value as AIProviderType)}
+                                    >
+                                        <option value="">API: detect from base URL</option>
+                                        <option value="openai">OpenAI-compatible</option>
+                                        <option value="anthropic">Anthropic</option>
+                                        <option value="gemini">Google Gemini</option>
+                                        <option value="ollama">Ollama (local, no API key)</option>
+                                    </select>
                                     <FlexInput
                                         inputClassName="ai-models-input"
                                         value={newProviderBaseURL}
@@ -320,7 +337,7 @@ export function AIModelsSection() {
                                     <button
                                         className="mcc-port-action-btn"
                                         onClick={handleAddDraftProvider}
-                                        disabled={!newProviderName.trim() || !newProviderBaseURL.trim()}
+                                        disabled={!newProviderName.trim() || (!newProviderBaseURL.trim() && (newProviderType === '' || newProviderType === 'openai'))}
                                     >
                                         Add Provider
                                     </button>
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// EditorLinks is returned by EditorLinks.
+type EditorLinks struct {
+	Path  string            `json:"path"`
+	Links map[string]string `json:"links"` // editor -> deep link
+}
+
+// EditorOpen is a request, relayed by the server, to open a file locally.
+type EditorOpen struct {
+	Dir    string
+	Path   string
+	Line   int
+	Col    int
+	Editor string
+}
+
+// EditorLinks fetches deep links for dir/path via GET /api/editor/link.
+func (c *Client) EditorLinks(dir, path string, line int) (*EditorLinks, error) {
+	q := url.Values{}
+	q.Set("dir", dir)
+	q.Set("path", path)
+	if line > 0 {
+		q.Set("line", strconv.Itoa(line))
+	}
+	var out EditorLinks
+	if err := c.getJSON("/api/editor/link?"+q.Encode(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EditorCompanion registers as an editor companion named name and calls
+// onOpen for every open request until the stream ends. It always returns a
+// non-nil error, since the server never completes the stream.
+func (c *Client) EditorCompanion(name string, onOpen func(EditorOpen)) error {
+	path := "/api/editor/companion?name=" + url.QueryEscape(name)
+	return c.consumeStream("GET", path, nil, func(ev StreamEvent, raw map[string]any) error {
+		if ev.Type != "open" {
+			return nil
+		}
+		onOpen(EditorOpen{
+			Dir:    stringField(raw, "dir"),
+			Path:   stringField(raw, "path"),
+			Line:   intField(raw, "line"),
+			Col:    intField(raw, "col"),
+			Editor: stringField(raw, "editor"),
+		})
+		return nil
+	})
+}
+
+func intField(m map[string]any, key string) int {
+	f, _ := m[key].(float64)
+	return int(f)
+}
@@ -290,6 +290,10 @@ func (c *Client) uploadChunk(uploadID string, chunkIndex int, chunk []byte) erro
 	if err := mw.WriteField("chunk_index", strconv.Itoa(chunkIndex)); err != nil {
 		return err
 	}
+	// lets the server reject a chunk corrupted in transit
+	if err := mw.WriteField("chunk_sha256", hashBytes(chunk)); err != nil {
+		return err
+	}
 
 	part, err := mw.CreateFormFile("chunk", fmt.Sprintf("chunk_%d", chunkIndex))
 	if err != nil {
@@ -80,6 +80,9 @@ func IsRetryableUploadError(err error) bool {
 		switch he.statusCode {
 		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
 			return true
+		case http.StatusUnprocessableEntity:
+			// the chunk was corrupted on the way; sending it again can succeed
+			return true
 		}
 		if he.statusCode >= 500 {
 			return true
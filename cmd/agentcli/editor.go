@@ -0,0 +1,171 @@
+package agentcli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xhd2015/ai-critic/client"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+const editorHelp = `Usage: remote-agent editor <subcommand> [args...]
+
+Open files from the server in a local editor (vscode, cursor, zed).
+
+Subcommands:
+  link <remote-dir> <path> [--line N]
+      Print deep links (vscode://, cursor://, zed://) for a file.
+
+  companion [--editor vscode|cursor|zed] [--name NAME]
+      Run on your desktop: wait for "open in editor" requests sent from the
+      review screen and open each file in the local editor. Remote project
+      dirs are mapped to local checkouts via 'project bind-local'.
+`
+
+const editorCompanionHelp = `Usage: remote-agent editor companion [--editor vscode|cursor|zed] [--name NAME]
+
+Connect to the server as an editor companion and open requested files locally.
+Reconnects automatically until interrupted.
+
+Options:
+  --editor EDITOR   Editor used when a request names none (default: vscode)
+  --name NAME       Companion name shown on the server (default: hostname)
+`
+
+// companionReconnectDelay is how long the companion waits before
+// reconnecting after its stream drops.
+const companionReconnectDelay = 3 * time.Second
+
+func runEditor(resolve func() (*client.Client, error), args []string) error {
+	if len(args) == 0 {
+		fmt.Print(editorHelp)
+		return nil
+	}
+	sub := args[0]
+	rest := args[1:]
+	switch sub {
+	case "link":
+		return runEditorLink(resolve, rest)
+	case "companion":
+		return runEditorCompanion(resolve, rest)
+	case "-h", "--help":
+		fmt.Print(editorHelp)
+		return nil
+	default:
+		return fmt.Errorf("unknown editor subcommand: %s", sub)
+	}
+}
+
+func runEditorLink(resolve func() (*client.Client, error), args []string) error {
+	var line int
+	args, err := flags.
+		Int("--line", &line).
+		Help("-h,--help", "Usage: remote-agent editor link <remote-dir> <path> [--line N]\n").
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: remote-agent editor link <remote-dir> <path> [--line N]")
+	}
+	cli, err := resolve()
+	if err != nil {
+		return err
+	}
+	res, err := cli.EditorLinks(args[0], args[1], line)
+	if err != nil {
+		return err
+	}
+	editors := make([]string, 0, len(res.Links))
+	for e := range res.Links {
+		editors = append(editors, e)
+	}
+	sort.Strings(editors)
+	for _, e := range editors {
+		fmt.Printf("%-8s %s\n", e, res.Links[e])
+	}
+	return nil
+}
+
+func runEditorCompanion(resolve func() (*client.Client, error), args []string) error {
+	editor := "vscode"
+	var name string
+	args, err := flags.
+		String("--editor", &editor).
+		String("--name", &name).
+		Help("-h,--help", editorCompanionHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("editor companion takes no positional arguments")
+	}
+	if _, err := editorCommand(editor, "", 0, 0); err != nil {
+		return err
+	}
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	cli, err := resolve()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Editor companion %q connected to %s (default editor: %s)\n", name, cli.Server, editor)
+	for {
+		err := cli.EditorCompanion(name, func(req client.EditorOpen) {
+			if err := openInEditor(cli.Server, editor, req); err != nil {
+				fmt.Fprintf(os.Stderr, "open %s: %v\n", req.Path, err)
+			}
+		})
+		fmt.Fprintf(os.Stderr, "companion stream ended: %v; reconnecting in %s\n", err, companionReconnectDelay)
+		time.Sleep(companionReconnectDelay)
+	}
+}
+
+func openInEditor(server, defaultEditor string, req client.EditorOpen) error {
+	localDir := resolveProjectLocalDir(server, req.Dir)
+	if localDir == "" {
+		if st, err := os.Stat(req.Dir); err == nil && st.IsDir() {
+			localDir = req.Dir
+		} else {
+			return fmt.Errorf("no local checkout bound for %s; run 'remote-agent project bind-local'", req.Dir)
+		}
+	}
+	editor := req.Editor
+	if editor == "" {
+		editor = defaultEditor
+	}
+	cmd, err := editorCommand(editor, filepath.Join(localDir, req.Path), req.Line, req.Col)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Opening %s in %s\n", cmd.Args[len(cmd.Args)-1], editor)
+	return cmd.Start()
+}
+
+// editorCommand returns the command that opens file at line:col in editor.
+func editorCommand(editor, file string, line, col int) (*exec.Cmd, error) {
+	target := file
+	if line > 0 {
+		target = fmt.Sprintf("%s:%d", file, line)
+		if col > 0 {
+			target = fmt.Sprintf("%s:%d", target, col)
+		}
+	}
+	switch editor {
+	case "vscode":
+		return exec.Command("code", "-g", target), nil
+	case "cursor":
+		return exec.Command("cursor", "-g", target), nil
+	case "zed":
+		return exec.Command("zed", target), nil
+	default:
+		return nil, fmt.Errorf("unsupported editor: %q (want vscode, cursor or zed)", editor)
+	}
+}
@@ -39,6 +39,7 @@ Commands:
   Git & projects
     git                  Server-side git operations
     project              Project metadata and git identity
+    editor               Open server files in a local editor
     settings             Server settings (git users, etc.)
 
   Machine
@@ -97,6 +98,7 @@ Commands:
   Git & projects
     git                  Server-side git operations
     project              Project metadata and git identity
+    editor               Open server files in a local editor
     settings             Server settings (git users, etc.)
 
   Machine
@@ -99,6 +99,8 @@ func Run(profile Profile, args []string) error {
 		return runProxy(resolve, rest)
 	case "project":
 		return runProject(resolve, rest)
+	case "editor":
+		return runEditor(resolve, rest)
 	case "machine":
 		return runMachine(resolve, rest)
 	case "settings":
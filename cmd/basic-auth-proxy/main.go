@@ -4,8 +4,10 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	_ "embed"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +19,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/xhd2015/ai-critic/server/auth/ratelimit"
 	"github.com/xhd2015/less-gen/flags"
 )
 
@@ -35,6 +38,11 @@ If the backend returns 401, login fails. Otherwise, a session
 token is created and stored in an encrypted cookie.
 
 Token expiration: 7 days (auto-extended on activity)
+
+Failed logins are throttled per client IP with exponential backoff and a
+temporary lockout, configured in .ai-critic/auth-rate-limit.json (shared
+with the server). Lockout state is kept in .ai-critic/basic-auth-lockouts.json
+so the server's /api/auth/lockouts endpoint can inspect and reset it.
 `
 
 const cookieName = "basic-auth-token"
@@ -42,6 +50,8 @@ const tokenDuration = 7 * 24 * time.Hour
 
 var configDir = ".ai-critic"
 var configFile = "basic-auth-config.json"
+var rateLimitFile = "auth-rate-limit.json"
+var lockoutsFile = "basic-auth-lockouts.json"
 
 type tokenData struct {
 	Username  string `json:"username"`
@@ -94,7 +104,12 @@ func run(args []string) error {
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/login", handleLogin(proxy, backendPort, secretKey))
+	limiter := ratelimit.NewFile(
+		ratelimit.LoadConfig(filepath.Join(configDir, rateLimitFile)),
+		filepath.Join(configDir, lockoutsFile),
+	)
+
+	mux.HandleFunc("/login", handleLogin(proxy, backendPort, secretKey, limiter))
 	mux.HandleFunc("/", handleProxy(proxy, backendPort, secretKey))
 
 	fmt.Printf("Basic auth proxy listening on :%d -> backend :%d\n", port, backendPort)
@@ -219,7 +234,7 @@ func decryptToken(key []byte, encrypted string) (*tokenData, error) {
 	return &data, nil
 }
 
-func handleLogin(proxy *httputil.ReverseProxy, backendPort int, secretKey []byte) http.HandlerFunc {
+func handleLogin(proxy *httputil.ReverseProxy, backendPort int, secretKey []byte, limiter *ratelimit.Limiter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			serveLoginPage(w, r, "")
@@ -245,6 +260,18 @@ func handleLogin(proxy *httputil.ReverseProxy, backendPort int, secretKey []byte
 			return
 		}
 
+		ip := ratelimit.ClientIP(r)
+		if wait, ok := limiter.Allow(ip); !ok {
+			secs := int((wait + time.Second - 1) / time.Second)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", secs))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Too many failed attempts. Try again in %s.", wait.Round(time.Second)),
+			})
+			return
+		}
+
 		valid, err := testBackendAuth(backendPort, req.Username, req.Password)
 		if err != nil {
 			serveLoginPage(w, r, fmt.Sprintf("Backend error: %v", err))
@@ -252,9 +279,11 @@ func handleLogin(proxy *httputil.ReverseProxy, backendPort int, secretKey []byte
 		}
 
 		if !valid {
+			limiter.Fail(ip, attemptFingerprint(req.Username, req.Password))
 			serveLoginPage(w, r, "Invalid username or password")
 			return
 		}
+		limiter.Succeed(ip)
 
 		token, err := encryptToken(secretKey, &tokenData{
 			Username:  req.Username,
@@ -280,6 +309,13 @@ func handleLogin(proxy *httputil.ReverseProxy, backendPort int, secretKey []byte
 	}
 }
 
+// attemptFingerprint identifies a credential pair without storing it, so
+// resubmitting the same wrong password is not counted twice.
+func attemptFingerprint(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(sum[:8])
+}
+
 func testBackendAuth(backendPort int, username, password string) (bool, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
 	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/", backendPort), nil)
@@ -4,12 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
-	"syscall"
 
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 	"github.com/xhd2015/less-gen/flags"
 )
 
@@ -60,12 +59,8 @@ func run(args []string) error {
 		return nil
 	}
 
-	signal := syscall.SIGTERM // default
-	if sig9 {
-		signal = syscall.SIGKILL
-	} else if sig15 {
-		signal = syscall.SIGTERM
-	}
+	// SIGTERM by default (-15), SIGKILL with -9
+	force := sig9
 
 	pidStr := args[0]
 	pid, err := strconv.Atoi(pidStr)
@@ -73,23 +68,19 @@ func run(args []string) error {
 		return fmt.Errorf("invalid pid: %s", pidStr)
 	}
 
-	return killProcess(pid, signal)
+	return killProcess(pid, force)
 }
 
-func killProcess(pid int, signal syscall.Signal) error {
+func killProcess(pid int, force bool) error {
 	if pid == 1 {
 		return fmt.Errorf("cannot kill init process (PID 1)")
 	}
 
-	err := syscall.Kill(pid, syscall.Signal(0))
-	if err != nil {
-		if err == syscall.ESRCH {
-			return fmt.Errorf("process not found")
-		}
-		return fmt.Errorf("cannot access process: %v", err)
+	if !procctl.Alive(pid) {
+		return fmt.Errorf("process not found")
 	}
 
-	ports, err := getPortsForPID(pid)
+	ports, err := portpid.PortsForPID(pid)
 	if err != nil {
 		return fmt.Errorf("failed to get ports for pid: %w", err)
 	}
@@ -105,8 +96,11 @@ func killProcess(pid int, signal syscall.Signal) error {
 		}
 	}
 
-	cmd := exec.Command("kill", "-s", strconv.Itoa(int(signal)), strconv.Itoa(pid))
-	err = cmd.Run()
+	if force {
+		err = procctl.Kill(pid)
+	} else {
+		err = procctl.Terminate(pid)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to kill process: %v", err)
 	}
@@ -115,35 +109,6 @@ func killProcess(pid int, signal syscall.Signal) error {
 	return nil
 }
 
-func getPortsForPID(pid int) ([]int, error) {
-	cmd := exec.Command("lsof", "-iTCP", "-sTCP:LISTEN", "-n", "-P", "-a", "-p", strconv.Itoa(pid))
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, err
-	}
-
-	var ports []int
-	lines := strings.Split(string(output), "\n")
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue
-		}
-		fields := strings.Fields(line)
-		if len(fields) < 9 {
-			continue
-		}
-		nameField := fields[8]
-		if idx := strings.LastIndex(nameField, ":"); idx != -1 {
-			portStr := nameField[idx+1:]
-			port, err := strconv.Atoi(portStr)
-			if err == nil && port > 0 {
-				ports = append(ports, port)
-			}
-		}
-	}
-	return ports, nil
-}
-
 func loadProtectedPorts() (map[int]bool, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
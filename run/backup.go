@@ -0,0 +1,147 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/databackup"
+	"github.com/xhd2015/ai-critic/server/env"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+var backupHelp = fmt.Sprintf(`
+Usage: ai-critic backup [options]
+
+Writes an encrypted backup of the data directory (%s): settings,
+credentials, keys, domains, checkpoint metadata and the rest, plus the
+cloudflared tunnel credentials in ~/.cloudflared. Caches, process state and
+checkpoint file contents are left out. Restore it on another machine with
+'ai-critic restore'.
+
+The passphrase is read from $%s, or asked for.
+
+Options:
+  -o, --output FILE    Backup file to write (default: ai-critic-backup-<time>.tar.gz.enc)
+  -h, --help           Show this help message
+`, config.DataDir, env.EnvBackupPassphrase)
+
+var restoreHelp = fmt.Sprintf(`
+Usage: ai-critic restore [options] FILE
+
+Restores a backup written by 'ai-critic backup' (or downloaded from
+/api/admin/backup) into the data directory (%s) and ~/.cloudflared,
+overwriting the files it contains. Restart a running server afterwards.
+
+The passphrase is read from $%s, or asked for.
+
+Options:
+  --force       Overwrite an existing setup's credentials
+  -h, --help    Show this help message
+`, config.DataDir, env.EnvBackupPassphrase)
+
+func runBackup(args []string) error {
+	var output string
+	args, err := flags.
+		String("-o,--output", &output).
+		Help("-h,--help", backupHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	if output == "" {
+		output = databackup.FileName(time.Now())
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	m, err := databackup.Create(&buf, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %d file(s), %d bytes, to %s\n", len(m.Files), m.Bytes, output)
+	return nil
+}
+
+func runRestore(args []string) error {
+	var force bool
+	args, err := flags.
+		Bool("--force", &force).
+		Help("-h,--help", restoreHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("requires a backup FILE")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args[1:], " "))
+	}
+	if _, err := os.Stat(config.CredentialsFile); err == nil && !force {
+		return fmt.Errorf("%s already has credentials; use --force to overwrite them with the backup's", config.DataDir)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return err
+	}
+	m, err := databackup.Restore(f, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d file(s) from a backup of %s made %s\n", len(m.Files), m.Hostname, m.CreatedAt.Local().Format(time.DateTime))
+	if isPortInUse(config.DefaultServerPort) {
+		fmt.Printf("A server is running on port %d; restart it to load the restored data.\n", config.DefaultServerPort)
+	}
+	return nil
+}
+
+// readPassphrase takes the backup passphrase from the environment or the
+// terminal, asking twice when creating a backup.
+func readPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv(env.EnvBackupPassphrase); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal to ask for the passphrase; set $%s", env.EnvBackupPassphrase)
+	}
+	fmt.Print("Backup passphrase: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Print("Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(p, again) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(p), nil
+}
@@ -0,0 +1,72 @@
+package run
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+const defaultConfigFile = ".config.local.json"
+
+var configHelp = `
+Usage: ai-critic config validate [FILE]
+
+Validates a configuration file (default: .config.local.json) the same way
+the server does at startup: JSON syntax, value types, unknown keys and
+references between sections. Each problem is reported with its line and
+column. Exits with code 1 if there are errors; warnings alone pass.
+
+Options:
+  -h, --help       Show this help message
+`
+
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		fmt.Print(configHelp)
+		return fmt.Errorf("missing subcommand")
+	}
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "-h", "--help":
+		fmt.Print(configHelp)
+		return nil
+	}
+	return fmt.Errorf("unknown config subcommand: %s", args[0])
+}
+
+func runConfigValidate(args []string) error {
+	args, err := flags.
+		Help("-h,--help", configHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	file := defaultConfigFile
+	switch len(args) {
+	case 0:
+	case 1:
+		file = args[0]
+	default:
+		return fmt.Errorf("expected at most one file, got %d", len(args))
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	_, res := config.Validate(data)
+	for _, issue := range res.Errors {
+		fmt.Printf("%s: error: %s\n", file, issue)
+	}
+	for _, issue := range res.Warnings {
+		fmt.Printf("%s: warning: %s\n", file, issue)
+	}
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("%s: %d error(s), %d warning(s)", file, len(res.Errors), len(res.Warnings))
+	}
+	fmt.Printf("%s: OK (%d warning(s))\n", file, len(res.Warnings))
+	return nil
+}
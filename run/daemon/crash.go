@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/crashreport"
+)
+
+const (
+	// StableUptime is how long the server must run for a crash not to count
+	// towards a restart loop.
+	StableUptime = 1 * time.Minute
+	// CrashBackoffMax caps the wait between restarts in a crash loop.
+	CrashBackoffMax = 5 * time.Minute
+)
+
+// CrashBackoffDelay returns the wait before restarting after consecutive
+// crashes: RestartDelay for the first, doubling up to CrashBackoffMax.
+func CrashBackoffDelay(consecutiveCrashes int) time.Duration {
+	delay := RestartDelay
+	for i := 1; i < consecutiveCrashes; i++ {
+		delay *= 2
+		if delay >= CrashBackoffMax {
+			return CrashBackoffMax
+		}
+	}
+	return delay
+}
+
+// serverLogSize is where the next server's output starts in the server log,
+// so a crash report only shows what that process wrote.
+func serverLogSize() int64 {
+	info, err := os.Stat(config.ServerLogFile)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// crashedProcess is what the run loop knows about a server that died.
+type crashedProcess struct {
+	reason    string
+	pid       int
+	binPath   string
+	startedAt time.Time
+	logOffset int64 // start of its output in the server log; -1 if unknown
+	state     *os.ProcessState
+}
+
+// nextCrashDelay counts a crash after the given uptime towards the restart
+// loop and returns the back-off before the next start.
+func (d *Daemon) nextCrashDelay(uptime time.Duration) time.Duration {
+	if uptime >= StableUptime {
+		d.consecutiveCrashes = 0
+	}
+	d.consecutiveCrashes++
+	return CrashBackoffDelay(d.consecutiveCrashes)
+}
+
+// handleCrash records a server that exited on its own or was killed for
+// failing health checks, and returns the back-off before restarting it.
+func (d *Daemon) handleCrash(reason ExitReasonType, cmd *exec.Cmd, binPath string, startedAt time.Time, logOffset int64) time.Duration {
+	delay := d.nextCrashDelay(time.Since(startedAt))
+	if d.consecutiveCrashes > 1 {
+		Logger("Restart loop: %d crashes without a stable run of %v, backing off", d.consecutiveCrashes, StableUptime)
+	}
+	d.recordCrash(crashedProcess{
+		reason:    string(reason),
+		pid:       cmd.Process.Pid,
+		binPath:   binPath,
+		startedAt: startedAt,
+		logOffset: logOffset,
+		state:     d.healthChecker.LastExit(),
+	}, delay)
+	return delay
+}
+
+// recordCrash saves a crash report for p. Errors are logged: a missing report
+// must never keep the server down.
+func (d *Daemon) recordCrash(p crashedProcess, restartDelay time.Duration) {
+	r := crashreport.Report{
+		Source:         crashreport.SourceKeepAlive,
+		Reason:         p.reason,
+		PID:            p.pid,
+		Binary:         filepath.Base(p.binPath),
+		Consecutive:    d.consecutiveCrashes,
+		RestartDelayMS: restartDelay.Milliseconds(),
+	}
+	if !p.startedAt.IsZero() {
+		r.UptimeMS = time.Since(p.startedAt).Milliseconds()
+	}
+	if p.state != nil {
+		if ws, ok := p.state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			r.Signal = ws.Signal().String()
+		} else {
+			code := p.state.ExitCode()
+			r.ExitCode = &code
+		}
+	}
+
+	// the runtime's own crash output is exact; fall back to the log tail
+	output := crashreport.TakePanicOutput()
+	if output == "" {
+		offset := p.logOffset
+		if offset < 0 {
+			offset = 0
+		}
+		output = crashreport.TailFile(config.ServerLogFile, offset)
+	}
+	r.Output, r.Panic = crashreport.ExtractPanic(output)
+
+	if err := crashreport.Save(r); err != nil {
+		Logger("Warning: failed to save crash report: %v", err)
+		return
+	}
+	Logger("Crash report saved (reason=%s, pid=%d, panic=%v, consecutive=%d, restartDelay=%v)",
+		p.reason, p.pid, r.Panic, d.consecutiveCrashes, restartDelay)
+}
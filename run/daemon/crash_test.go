@@ -0,0 +1,28 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrashBackoff(t *testing.T) {
+	d := &Daemon{}
+	steps := []struct {
+		uptime time.Duration
+		want   time.Duration
+	}{
+		{5 * time.Second, RestartDelay},
+		{2 * time.Second, 2 * RestartDelay},
+		{time.Second, 4 * RestartDelay},
+		// a stable run ends the loop
+		{10 * time.Minute, RestartDelay},
+	}
+	for i, s := range steps {
+		if got := d.nextCrashDelay(s.uptime); got != s.want {
+			t.Errorf("step %d: delay = %v, want %v", i, got, s.want)
+		}
+	}
+	if got := CrashBackoffDelay(100); got != CrashBackoffMax {
+		t.Errorf("capped delay = %v", got)
+	}
+}
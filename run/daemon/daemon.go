@@ -7,11 +7,11 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/ai-critic/macosapp/debuglog"
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 const keepAliveSkipServerPortCheckEnv = "AI_CRITIC_KEEPALIVE_SKIP_SERVER_PORT_CHECK"
@@ -28,6 +28,8 @@ type Daemon struct {
 	serverArgs     []string
 	startupTimeout time.Duration
 	detach         bool
+	// consecutiveCrashes counts crashes without a stable run in between
+	consecutiveCrashes int
 }
 
 // DualLogger writes to both stdout/stderr and a log file
@@ -143,7 +145,7 @@ func (d *Daemon) Run(forever bool, logPath string) error {
 	d.state.SetDetach(wantDetach)
 	// Own process group so test harness / operators can signal the daemon tree
 	// without killing the parent (e.g. doctest teardown uses kill -pgid).
-	if err := syscall.Setpgid(0, 0); err != nil {
+	if err := procctl.SetOwnGroup(); err != nil {
 		Logger("Warning: could not set keep-alive process group: %v", err)
 	}
 
@@ -247,7 +249,8 @@ func (d *Daemon) runLoop() error {
 				}
 				setCurrentCommand(cmd)
 				d.state.SetServerPID(cmd.Process.Pid)
-				d.state.SetStartedAt(time.Now())
+				reconnectedAt := time.Now()
+				d.state.SetStartedAt(reconnectedAt)
 				Logger("Reconnected to server (PID=%d)", cmd.Process.Pid)
 
 				// Pause health checks temporarily to give the server time to stabilize after exec-restart
@@ -270,8 +273,9 @@ func (d *Daemon) runLoop() error {
 					Logger("Daemon restart requested, stopping and waiting for exec...")
 					return nil
 				default:
-					Logger("Server exited (%s), restarting in %v...", exitReason, RestartDelay)
-					time.Sleep(RestartDelay)
+					delay := d.handleCrash(exitReason, cmd, currentBin, reconnectedAt, -1)
+					Logger("Server exited (%s), restarting in %v...", exitReason, delay)
+					time.Sleep(delay)
 				}
 				continue
 			}
@@ -279,6 +283,7 @@ func (d *Daemon) runLoop() error {
 		}
 
 		// Start the server process with dual logging
+		logOffset := serverLogSize()
 		cmd, err := d.startServerWithLogging(currentBin, d.serverArgs)
 		if err != nil {
 			Logger("Failed to start server: %v", err)
@@ -299,6 +304,13 @@ func (d *Daemon) runLoop() error {
 			backoff := StartupBackoffDelay(consecutiveStartupFailures)
 			Logger("ERROR: Server failed to become ready within %v", d.startupTimeout)
 			d.processManager.KillProcessGroup(cmd)
+			d.recordCrash(crashedProcess{
+				reason:    "server failed to become ready",
+				pid:       pid,
+				binPath:   currentBin,
+				startedAt: d.state.GetStartedAt(),
+				logOffset: logOffset,
+			}, backoff)
 			d.state.SetServerPID(0)
 			setCurrentCommand(nil)
 			Logger("Startup failure %d, restarting in %v (exponential backoff)...", consecutiveStartupFailures, backoff)
@@ -353,8 +365,9 @@ func (d *Daemon) runLoop() error {
 			Logger("Daemon restart requested, stopping and waiting for exec...")
 			return nil
 		default:
-			Logger("Server exited (%s), restarting in %v...", exitReason, RestartDelay)
-			time.Sleep(RestartDelay)
+			delay := d.handleCrash(exitReason, cmd, currentBin, startedAt, logOffset)
+			Logger("Server exited (%s), restarting in %v...", exitReason, delay)
+			time.Sleep(delay)
 		}
 	}
 }
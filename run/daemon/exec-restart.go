@@ -14,6 +14,12 @@ import (
 	"github.com/xhd2015/ai-critic/server/config"
 )
 
+// RequestServerExecRestart asks the server on the default port to restart
+// in place via exec, picking up a replaced binary with its flags preserved.
+func RequestServerExecRestart() bool {
+	return callExecRestartEndpoint()
+}
+
 // callExecRestartEndpoint calls the server's /api/server/exec-restart endpoint
 // which performs a graceful shutdown and then uses syscall.Exec to replace
 // the current process with the new binary (preserving PID).
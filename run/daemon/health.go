@@ -5,11 +5,13 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // ExitReasonType represents why the health check loop exited
@@ -26,6 +28,9 @@ const (
 // HealthChecker handles health checking and monitoring of the server process
 type HealthChecker struct {
 	state *State
+	// lastExit is the exit status of the process watched by the last Run,
+	// when it could be waited for
+	lastExit atomic.Pointer[os.ProcessState]
 }
 
 // NewHealthChecker creates a new health checker
@@ -52,6 +57,7 @@ func (hc *HealthChecker) Run(port int, cmd *exec.Cmd, currentBinPath string, fin
 			port, pid, time.Since(runStart), exitReason)
 	}()
 	Logger("[health-check] Run started for port %d (PID=%d, currentBin=%s)", port, pid, currentBinPath)
+	hc.lastExit.Store(nil)
 
 	// Channel to receive process exit notification
 	done := make(chan struct{}, 1)
@@ -60,7 +66,9 @@ func (hc *HealthChecker) Run(port int, cmd *exec.Cmd, currentBinPath string, fin
 			LogPanic(fmt.Sprintf("health checker wait goroutine (port=%d, pid=%d)", port, pid), recover())
 		}()
 		Logger("[health-check] Wait goroutine started for port %d (PID=%d)", port, pid)
-		cmd.Process.Wait()
+		if ps, err := cmd.Process.Wait(); err == nil {
+			hc.lastExit.Store(ps)
+		}
 		Logger("[health-check] Wait goroutine observed process exit for port %d (PID=%d)", port, pid)
 		close(done)
 	}()
@@ -155,7 +163,7 @@ func (hc *HealthChecker) Run(port int, cmd *exec.Cmd, currentBinPath string, fin
 				Logger("[health-check] Step 1/2 PASSED: TCP connectivity confirmed in %v", time.Since(tcpStart))
 				if IsProcessStopped(pid) {
 					Logger("[health-check] server process PID=%d is stopped (State T); sending SIGCONT", pid)
-					_ = syscall.Kill(pid, syscall.SIGCONT)
+					_ = procctl.Resume(pid)
 					time.Sleep(500 * time.Millisecond)
 					if !IsProcessStopped(pid) {
 						Logger("[health-check] server PID=%d resumed after SIGCONT", pid)
@@ -237,6 +245,12 @@ func (hc *HealthChecker) Run(port int, cmd *exec.Cmd, currentBinPath string, fin
 	}
 }
 
+// LastExit returns the exit status of the process watched by the last Run,
+// or nil if it is unknown (e.g. a reconnected process that is not our child).
+func (hc *HealthChecker) LastExit() *os.ProcessState {
+	return hc.lastExit.Load()
+}
+
 func formatMaybeTime(t time.Time) string {
 	if t.IsZero() {
 		return "<zero>"
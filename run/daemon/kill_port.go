@@ -1,12 +1,11 @@
 package daemon
 
 import (
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
-	"os/exec"
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // KillListenersOnPort sends SIGTERM to processes listening on port, then SIGKILL if needed.
@@ -22,7 +21,7 @@ func KillListenersOnPort(port int) {
 			continue
 		}
 		Logger("Kill-existing: sending SIGTERM to PID %d on port %d", pid, port)
-		_ = syscall.Kill(pid, syscall.SIGTERM)
+		_ = procctl.Terminate(pid)
 	}
 
 	time.Sleep(300 * time.Millisecond)
@@ -31,27 +30,15 @@ func KillListenersOnPort(port int) {
 		if pid <= 0 || pid == selfPID {
 			continue
 		}
-		if syscall.Kill(pid, 0) == nil {
+		if procctl.Alive(pid) {
 			Logger("Kill-existing: sending SIGKILL to PID %d on port %d", pid, port)
-			_ = syscall.Kill(pid, syscall.SIGKILL)
+			_ = procctl.Kill(pid)
 		}
 	}
 }
 
 // listenerPIDs returns PIDs with a TCP listener on the given port.
 func listenerPIDs(port int) []int {
-	cmd := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t")
-	output, err := cmd.Output()
-	if err != nil || len(output) == 0 {
-		return nil
-	}
-	var pids []int
-	for _, pidStr := range strings.Fields(strings.TrimSpace(string(output))) {
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil || pid <= 0 {
-			continue
-		}
-		pids = append(pids, pid)
-	}
+	pids, _ := portpid.PIDsOnPort(port)
 	return pids
-}
\ No newline at end of file
+}
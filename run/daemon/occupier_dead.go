@@ -4,7 +4,8 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
-	"syscall"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // TestExported_OccupierDead reports whether a port-occupier PID is gone or defunct (zombie).
@@ -22,5 +23,5 @@ func TestExported_OccupierDead(pid int) bool {
 	if state == "" || state == "Z" {
 		return true
 	}
-	return syscall.Kill(pid, 0) != nil
+	return !procctl.Alive(pid)
 }
\ No newline at end of file
@@ -2,8 +2,12 @@
 
 package daemon
 
-import "syscall"
+import (
+	"syscall"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
+)
 
 func serverChildProcAttr(detach bool) *syscall.SysProcAttr {
-	return &syscall.SysProcAttr{Setpgid: true}
+	return procctl.GroupAttr()
 }
\ No newline at end of file
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // ProcessManager handles the lifecycle of the managed server process
@@ -132,7 +134,7 @@ func (pm *ProcessManager) GracefulStopGroup(cmd *exec.Cmd) {
 		return
 	}
 
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	pgid, err := procctl.GroupOf(cmd.Process.Pid)
 	if err != nil {
 		// Fallback: kill just the process
 		Logger("Warning: could not get process group, falling back to process kill")
@@ -144,14 +146,14 @@ func (pm *ProcessManager) GracefulStopGroup(cmd *exec.Cmd) {
 
 	// Send SIGTERM to the entire process group
 	Logger("Sending SIGTERM to process group %d", pgid)
-	syscall.Kill(-pgid, syscall.SIGTERM)
+	procctl.TerminateGroup(pgid)
 
 	// Wait up to 5 seconds for graceful shutdown
 	time.Sleep(5 * time.Second)
 
 	// Force kill the entire process group
 	Logger("Sending SIGKILL to process group %d", pgid)
-	syscall.Kill(-pgid, syscall.SIGKILL)
+	procctl.KillGroup(pgid)
 }
 
 // KillProcessGroup kills the entire process group immediately
@@ -160,7 +162,7 @@ func (pm *ProcessManager) KillProcessGroup(cmd *exec.Cmd) {
 		return
 	}
 
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	pgid, err := procctl.GroupOf(cmd.Process.Pid)
 	if err != nil {
 		// Fallback: kill just the process
 		Logger("Warning: could not get process group, falling back to process kill")
@@ -169,7 +171,7 @@ func (pm *ProcessManager) KillProcessGroup(cmd *exec.Cmd) {
 	}
 
 	Logger("Killing process group %d", pgid)
-	syscall.Kill(-pgid, syscall.SIGKILL)
+	procctl.KillGroup(pgid)
 }
 
 // WaitForDone waits for the done signal with a timeout
@@ -229,28 +231,15 @@ func IsPortReachable(port int) bool {
 
 // FindPortPID finds the PID using a specific port (for conflict detection)
 func FindPortPID(port int) string {
-	// Prefer TCP LISTEN sockets only; plain `lsof -ti :port` can match unrelated PIDs on macOS.
-	cmd := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t")
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		return strings.TrimSpace(string(output))
+	pids, err := portpid.PIDsOnPort(port)
+	if err != nil {
+		return ""
 	}
-
-	// Fallback for platforms without -sTCP:LISTEN support.
-	cmd = exec.Command("lsof", "-ti", fmt.Sprintf(":%d", port))
-	output, err = cmd.Output()
-	if err == nil && len(output) > 0 {
-		return strings.TrimSpace(string(output))
+	strs := make([]string, len(pids))
+	for i, pid := range pids {
+		strs[i] = strconv.Itoa(pid)
 	}
-
-	// Try netstat as fallback
-	cmd = exec.Command("sh", "-c", fmt.Sprintf("netstat -tlnp 2>/dev/null | grep ':%d ' | awk '{print $7}' | cut -d'/' -f1", port))
-	output, err = cmd.Output()
-	if err == nil && len(output) > 0 {
-		return string(output)
-	}
-
-	return ""
+	return strings.Join(strs, "\n")
 }
 
 // IsPortInUse checks if a port is already in use
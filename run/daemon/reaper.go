@@ -1,9 +1,6 @@
 package daemon
 
-import (
-	"syscall"
-	"time"
-)
+import "time"
 
 // ZombieReapInterval controls how often the daemon sweeps for defunct
 // (zombie) child processes. The daemon spawns the server via
@@ -46,26 +43,3 @@ func zombieReapLoop() {
 		}
 	}
 }
-
-// reapZombiesOnce drains all currently-reapable child processes using
-// non-blocking wait4. Returns the number of children reaped.
-func reapZombiesOnce() int {
-	n := 0
-	for {
-		var ws syscall.WaitStatus
-		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
-		if err != nil {
-			// ECHILD: no children at all, or all remaining children
-			// are already being waited on by another goroutine. Either
-			// way, nothing more to do this cycle.
-			return n
-		}
-		if pid == 0 {
-			// Children exist but none are ready to be reaped.
-			return n
-		}
-		// Successfully reaped one.
-		Logger("[reaper] reaped child pid=%d (exit=%d, signal=%v)", pid, ws.ExitStatus(), ws.Signal())
-		n++
-	}
-}
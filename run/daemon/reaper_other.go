@@ -0,0 +1,8 @@
+//go:build !unix
+
+package daemon
+
+// reapZombiesOnce does nothing: only Unix leaves exited children as zombies.
+func reapZombiesOnce() int {
+	return 0
+}
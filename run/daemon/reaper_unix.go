@@ -0,0 +1,28 @@
+//go:build unix
+
+package daemon
+
+import "syscall"
+
+// reapZombiesOnce drains all currently-reapable child processes using
+// non-blocking wait4. Returns the number of children reaped.
+func reapZombiesOnce() int {
+	n := 0
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err != nil {
+			// ECHILD: no children at all, or all remaining children
+			// are already being waited on by another goroutine. Either
+			// way, nothing more to do this cycle.
+			return n
+		}
+		if pid == 0 {
+			// Children exist but none are ready to be reaped.
+			return n
+		}
+		// Successfully reaped one.
+		Logger("[reaper] reaped child pid=%d (exit=%d, signal=%v)", pid, ws.ExitStatus(), ws.Signal())
+		n++
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 const daemonShutdownDrainDelay = 200 * time.Millisecond
@@ -128,7 +129,7 @@ func killProcess(cmd *exec.Cmd) {
 		return
 	}
 
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	pgid, err := procctl.GroupOf(cmd.Process.Pid)
 	if err != nil {
 		Logger("Warning: could not get process group, falling back to process kill")
 		cmd.Process.Signal(syscall.SIGTERM)
@@ -138,7 +139,7 @@ func killProcess(cmd *exec.Cmd) {
 	}
 
 	Logger("Killing process group %d", pgid)
-	syscall.Kill(-pgid, syscall.SIGKILL)
+	procctl.KillGroup(pgid)
 }
 
 // loadFirstToken reads the first non-empty line from the credentials file.
@@ -0,0 +1,176 @@
+package run
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	cloudflareSettings "github.com/xhd2015/ai-critic/server/cloudflare"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/firstrun"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+var initHelp = fmt.Sprintf(`
+Usage: ai-critic init [options]
+
+Interactive first-run setup. Creates the data directory (%s), a login
+credential, the encryption key pair and a config file with its AI
+providers, and optionally a Cloudflare tunnel serving a public domain.
+Each step is then verified: every AI provider's API key with a test call,
+and the domain with a DNS lookup. Steps already done are kept, so it is
+safe to run again, e.g. to add a provider or the tunnel later.
+
+Questions not answered by flags are asked interactively.
+'ai-critic setup' is an alias.
+
+Options:
+  --config-file FILE      Config file to create (default: %s)
+  --project-dir DIR       Project directory recorded in a new config file
+  --credential TOKEN      Login credential (default: generate one)
+  --provider NAME         AI provider to add to the config file
+  --provider-type TYPE    Its API: openai, anthropic, gemini or ollama (default: from the base URL)
+  --base-url URL          Its API endpoint
+  --api-key KEY           Its API key
+  --domain DOMAIN         Public domain to serve through a Cloudflare tunnel
+  --tunnel-name NAME      Cloudflare tunnel name (default: derived from the domain)
+  --no-verify             Skip the API key and DNS checks
+  -y, --yes               Do not ask; use flags and defaults
+  -h, --help              Show this help message
+`, config.DataDir, defaultConfigFile)
+
+func runInit(args []string) error {
+	var configFile string
+	var projectDir string
+	var credential string
+	var provider config.ProviderConfig
+	var domain string
+	var tunnelName string
+	var noVerify bool
+	var yes bool
+	args, err := flags.
+		String("--config-file", &configFile).
+		String("--project-dir", &projectDir).
+		String("--credential", &credential).
+		String("--provider", &provider.Name).
+		String("--provider-type", &provider.Type).
+		String("--base-url", &provider.BaseURL).
+		String("--api-key", &provider.APIKey).
+		String("--domain", &domain).
+		String("--tunnel-name", &tunnelName).
+		Bool("--no-verify", &noVerify).
+		Bool("-y,--yes", &yes).
+		Help("-h,--help", initHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+
+	interactive := !yes && term.IsTerminal(int(os.Stdin.Fd()))
+	in := bufio.NewReader(os.Stdin)
+	ask := func(question, def string) string {
+		if !interactive {
+			return def
+		}
+		if def != "" {
+			fmt.Printf("%s [%s]: ", question, def)
+		} else {
+			fmt.Printf("%s: ", question)
+		}
+		line, _ := in.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+		return def
+	}
+
+	if configFile == "" {
+		configFile = ask("Config file", defaultConfigFile)
+	}
+	if projectDir == "" {
+		cwd, _ := os.Getwd()
+		projectDir = ask("Project directory", cwd)
+	}
+	if credential == "" && !auth.Initialized() {
+		credential = ask("Login credential (empty: generate one)", "")
+	}
+	var providers []config.ProviderConfig
+	if provider.Name != "" {
+		providers = append(providers, provider)
+	} else if provider.BaseURL != "" || provider.APIKey != "" {
+		return fmt.Errorf("--base-url and --api-key need --provider")
+	}
+	for interactive {
+		name := ask("AI provider to add, e.g. openai or deepseek (empty: done)", "")
+		if name == "" {
+			break
+		}
+		p := config.ProviderConfig{Name: name}
+		p.BaseURL = ask("  Base URL (empty: the provider type's default)", "")
+		p.Type = ask("  Type: openai, anthropic, gemini or ollama (empty: from the base URL)", "")
+		p.APIKey = ask("  API key", "")
+		providers = append(providers, p)
+	}
+	if domain == "" {
+		domain = ask("Public domain for a Cloudflare tunnel (empty: skip)", "")
+	}
+	if domain != "" && interactive {
+		if err := ensureCloudflaredLogin(ask); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	res := firstrun.Run(firstrun.Options{
+		ConfigFile: configFile,
+		ProjectDir: projectDir,
+		Credential: credential,
+		Domain:     domain,
+		TunnelName: tunnelName,
+		Providers:  providers,
+		Verify:     !noVerify,
+	}, func(msg string) { fmt.Println("  " + msg) })
+
+	fmt.Println()
+	if res.Credential != "" {
+		fmt.Printf("Generated login credential (shown once, keep it safe):\n\n  %s\n\n", res.Credential)
+	}
+	if res.Failed() {
+		return fmt.Errorf("setup finished with errors; fix them and run 'ai-critic init' again")
+	}
+	fmt.Println("Setup complete. Start the server with:")
+	fmt.Printf("\n  ai-critic keep-alive --config-file %s\n\n", configFile)
+	if res.URL != "" {
+		fmt.Printf("It will be reachable at %s once the tunnel connects.\n", res.URL)
+	}
+	return nil
+}
+
+// ensureCloudflaredLogin offers to run 'cloudflared tunnel login' when the
+// tunnel step would otherwise fail for lack of authentication.
+func ensureCloudflaredLogin(ask func(question, def string) string) error {
+	if !cloudflareSettings.IsCommandAvailable("cloudflared") {
+		fmt.Println("cloudflared is not installed; the tunnel step will fail. Install it and run init again.")
+		return nil
+	}
+	if cloudflareSettings.CheckStatus().Authenticated {
+		return nil
+	}
+	if answer := ask("cloudflared is not logged in. Log in now? (y/n)", "y"); !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return nil
+	}
+	cmd := exec.Command("cloudflared", "tunnel", "login")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cloudflared login: %v", err)
+	}
+	return nil
+}
@@ -72,7 +72,7 @@ func runKeepAlive(args []string) error {
 		return err
 	}
 
-	port := config.DefaultServerPort
+	port := config.ServerPort()
 	if portFlag > 0 {
 		port = portFlag
 	}
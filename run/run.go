@@ -4,20 +4,24 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
-	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/term"
 
+	"github.com/xhd2015/ai-critic/script/devcmd"
 	"github.com/xhd2015/ai-critic/server"
 	"github.com/xhd2015/ai-critic/server/auth"
 	"github.com/xhd2015/ai-critic/server/config"
 	"github.com/xhd2015/ai-critic/server/domains"
 	"github.com/xhd2015/ai-critic/server/encrypt"
 	serverenv "github.com/xhd2015/ai-critic/server/env"
+	"github.com/xhd2015/ai-critic/server/faults"
+	"github.com/xhd2015/ai-critic/server/firstrun"
+	"github.com/xhd2015/ai-critic/server/portpid"
 	"github.com/xhd2015/ai-critic/server/quicktest"
+	"github.com/xhd2015/ai-critic/server/restartstate"
 
 	"github.com/xhd2015/less-gen/flags"
 )
@@ -37,7 +41,17 @@ Usage: ai-critic [options]
        ai-critic keep-alive request <action>     Request action from keep-alive daemon (info, restart)
        ai-critic rebuild --repo-dir DIR [opts]   Rebuild from source and restart
        ai-critic check-port --port PORT          Check if a port is accessible
+       ai-critic config validate [FILE]          Validate a config file (default: .config.local.json)
+       ai-critic init [options]                  Interactive first-run setup (credential, keys, config
+                                                 with AI providers, tunnel), verified; alias: setup
+       ai-critic service install|uninstall|start|stop|status
+                                                 Run the server as a systemd/launchd service
+       ai-critic update [--check]                Update to the latest GitHub release
+       ai-critic backup [-o FILE]                Write an encrypted backup of the data directory
+       ai-critic restore [--force] FILE          Restore a backup, e.g. on a new machine
 
+Development (run from the repository root):
+%s
 Options:
   --dev                   Run in development mode (auto-start vite dev server)
   --frontend-port PORT    Proxy frontend to PORT (assumes vite/frontend started externally)
@@ -46,6 +60,8 @@ Options:
                         - Listens on port 3580
                         - Exits after 10 minutes of no requests
                         - Extends life by +10min when a new request comes in
+  --inject-faults         Inject latency, 5xx errors and dropped event streams per route,
+                          configured through /api/debug/faults (for testing the frontend)
   --keep                 Keep the server running indefinitely (disable auto-shutdown in quick-test mode)
   --dir DIR               Set the initial directory for code review (defaults to current working directory)
   --port PORT             Port to listen on (defaults to auto-find starting from %d)
@@ -53,7 +69,7 @@ Options:
   --credentials-file FILE Path to credentials file (defaults to "%s")
   --enc-key-file FILE     Path to encryption key file (defaults to "%s")
   --domains-file FILE     Path to domains JSON file (defaults to "%s")
-  --rules-dir DIR         Directory containing REVIEW_RULES.md (defaults to "rules")
+  --rules-dir DIR         Builtin review rules: REVIEW_RULES.md, plus one rule pack per subdirectory (defaults to "rules")
   --project-dir DIR       Project root directory (for finding ai-critic-react in dev mode)
   --component             Serve a specific component
   -h, --help              Show this help message
@@ -69,7 +85,16 @@ Keep-Alive Commands:
   request info            Get current status from keep-alive daemon
   request status          Get current status from keep-alive daemon
   request restart         Request keep-alive daemon to restart the server
-`, config.DefaultServerPort, config.CredentialsFile, config.EncKeyFile, config.DomainsFile)
+
+Environment:
+  AI_CRITIC_<PATH>        Override a config value over the config file; PATH is its
+                          JSON path with keys joined by "__", e.g.
+                          AI_CRITIC_AI__PROVIDERS__0__API_KEY, AI_CRITIC_SERVER__PORT.
+                          Flags take precedence. Also read from .env and .env.local.
+  AI_CRITIC_PORT, AI_CRITIC_PROJECT_DIR, AI_CRITIC_DEFAULT_PROVIDER,
+  AI_CRITIC_DEFAULT_MODEL, AI_CRITIC_CLOUDFLARE_DOMAIN
+                          Short names for common values
+`, devcmd.HelpLines(41), config.DefaultServerPort, config.CredentialsFile, config.EncKeyFile, config.DomainsFile)
 
 func Run(args []string) error {
 	if err := serverenv.Load(); err != nil {
@@ -100,6 +125,21 @@ func Run(args []string) error {
 			return runRebuild(append([]string{"--script"}, args[1:]...))
 		case "check-port":
 			return runCheckPort(args[1:])
+		case "config":
+			return runConfig(args[1:])
+		case "init", "setup":
+			return runInit(args[1:])
+		case "service":
+			return runService(args[1:])
+		case "update":
+			return runUpdate(args[1:])
+		case "backup":
+			return runBackup(args[1:])
+		case "restore":
+			return runRestore(args[1:])
+		}
+		if devcmd.IsCommand(args[0]) {
+			return devcmd.Run(args)
 		}
 	}
 
@@ -108,6 +148,7 @@ func Run(args []string) error {
 	var frontendHostFlag string
 	var quickTestMode bool
 	var quickTestKeep bool
+	var injectFaults bool
 	var component string
 	var dirFlag string
 	var configFile string
@@ -123,6 +164,7 @@ func Run(args []string) error {
 		String("--frontend-host", &frontendHostFlag).
 		Bool("--quick-test", &quickTestMode).
 		Bool("--keep", &quickTestKeep).
+		Bool("--inject-faults", &injectFaults).
 		String("--component", &component).
 		String("--dir", &dirFlag).
 		Int("--port", &portFlag).
@@ -142,6 +184,23 @@ func Run(args []string) error {
 		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
 	}
 
+	// After an exec-restart, restore what the flags do not carry
+	restored, err := restartstate.Take()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read restart state: %v\n", err)
+	}
+	if restored != nil {
+		quickTestMode = quickTestMode || restored.QuickTest
+		quickTestKeep = quickTestKeep || restored.QuickTestKeep
+		if frontendPortFlag <= 0 {
+			frontendPortFlag = restored.FrontendPort
+		}
+		if frontendHostFlag == "" {
+			frontendHostFlag = restored.FrontendHost
+		}
+		server.SetRestoredState(restored)
+	}
+
 	if frontendPortFlag > 0 {
 		server.SetFrontendPort(frontendPortFlag)
 	}
@@ -165,6 +224,16 @@ func Run(args []string) error {
 		config.Set(cfg)
 		// Set the config file path for saving server settings
 		server.SetConfigFilePath(configFile)
+		firstrun.SetConfigFile(configFile)
+	} else {
+		// Without a config file, AI_CRITIC_* variables may still configure the server
+		cfg, err := config.LoadEnv()
+		if err != nil {
+			return fmt.Errorf("failed to load config from environment: %v", err)
+		}
+		if cfg != nil {
+			fmt.Printf("Loaded config from %s* environment variables\n", config.EnvPrefix)
+		}
 	}
 
 	// Load AI configuration (from new file if exists, otherwise from legacy)
@@ -174,6 +243,8 @@ func Run(args []string) error {
 	}
 	// Set the AI config in the server
 	server.SetAIConfigAdapter(aiCfg)
+	// Pick up edits to the config files without restarting the server
+	config.StartWatcher(configFile, server.SetAIConfigAdapter)
 
 	if credentialsFileFlag != "" {
 		auth.SetCredentialsFile(credentialsFileFlag)
@@ -212,10 +283,11 @@ func Run(args []string) error {
 			port = quickTestPort
 		}
 	} else if port <= 0 {
-		port = config.DefaultServerPort
+		port = config.ServerPort()
 	}
-	// Check if port is already in use
-	if isPortInUse(port) {
+	// Check if port is already in use; after an exec-restart it is
+	// the inherited listener answering
+	if !server.HasInheritedListener() && isPortInUse(port) {
 		pid := findPortPID(port)
 		if pid != "" {
 			return fmt.Errorf("port %d is already in use by process %s", port, pid)
@@ -236,6 +308,11 @@ func Run(args []string) error {
 		}
 	}
 
+	if injectFaults {
+		faults.SetEnabled(true)
+		fmt.Println("Fault injection enabled: configure it at /api/debug/faults")
+	}
+
 	// Side effects run after HTTP listener binds inside server.Serve / ServeComponent.
 	ignoreJobControlStop()
 
@@ -278,40 +355,9 @@ func isPortInUse(port int) bool {
 
 // findPortPID attempts to find the PID of the process LISTENING on the given port.
 func findPortPID(port int) string {
-	portStr := fmt.Sprintf("%d", port)
-
-	switch runtime.GOOS {
-	case "darwin", "linux":
-		// Try lsof with -sTCP:LISTEN to find only the listening socket
-		cmd := exec.Command("lsof", "-ti", fmt.Sprintf("tcp:%s", portStr), "-sTCP:LISTEN")
-		out, err := cmd.Output()
-		if err == nil {
-			pid := strings.TrimSpace(string(out))
-			if idx := strings.IndexByte(pid, '\n'); idx > 0 {
-				pid = pid[:idx]
-			}
-			if pid != "" {
-				return pid
-			}
-		}
-		// Fallback on Linux: try ss
-		if runtime.GOOS == "linux" {
-			cmd = exec.Command("ss", "-tlnp", fmt.Sprintf("sport = :%s", portStr))
-			out, err = cmd.Output()
-			if err != nil {
-				return ""
-			}
-			for _, line := range strings.Split(string(out), "\n") {
-				if idx := strings.Index(line, "pid="); idx >= 0 {
-					rest := line[idx+4:]
-					if end := strings.IndexAny(rest, ",) \t\n"); end > 0 {
-						return rest[:end]
-					}
-				}
-			}
-		}
-		return ""
-	default:
+	pids, err := portpid.PIDsOnPort(port)
+	if err != nil || len(pids) == 0 {
 		return ""
 	}
+	return strconv.Itoa(pids[0])
 }
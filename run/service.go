@@ -0,0 +1,218 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/xhd2015/ai-critic/run/service"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+const defaultServiceLogFile = "ai-critic-service.log"
+
+var serviceHelp = fmt.Sprintf(`
+Usage: ai-critic service install [options] [-- SERVER_ARGS...]
+       ai-critic service uninstall [--system]
+       ai-critic service start [--system]
+       ai-critic service stop [--system]
+       ai-critic service status [--system]
+
+Runs the server as a system service: a systemd unit on Linux, a launchd
+job on macOS. The service starts at boot (or login), is restarted when it
+fails, and logs to a file rotated by size.
+
+install writes the unit (%s.service) or plist (%s.plist),
+enables it and starts it; run it again to change options. The server runs
+in the current directory, so its data directory (%s) and config
+file resolve there.
+
+Install Options:
+  --port PORT             Port to listen on (default: %d)
+  --config-file FILE      Configuration file (JSON), made absolute
+  --log FILE              Log file (default: %s in the current directory)
+  --log-max-size MB       Rotate the log at this size (default: %d)
+  --log-max-files N       Rotated logs to keep (default: %d)
+  --user USER             User to run a --system service as (default: the invoking user)
+  SERVER_ARGS             Further server options, e.g. -- --rules-dir rules
+
+Options:
+  --system                System-wide service (needs root) instead of a per-user one
+  -h, --help              Show this help message
+`, service.Name, service.Label, config.DataDir, config.DefaultServerPort,
+	defaultServiceLogFile, service.DefaultLogMaxSizeMB, service.DefaultLogMaxFiles)
+
+func runService(args []string) error {
+	if len(args) == 0 {
+		fmt.Print(serviceHelp)
+		return fmt.Errorf("missing subcommand")
+	}
+	switch args[0] {
+	case "install":
+		return runServiceInstall(args[1:])
+	case "uninstall", "start", "stop", "status":
+		return runServiceControl(args[0], args[1:])
+	case "run":
+		return runServiceRun(args[1:])
+	case "-h", "--help":
+		fmt.Print(serviceHelp)
+		return nil
+	}
+	return fmt.Errorf("unknown service subcommand: %s", args[0])
+}
+
+func runServiceInstall(args []string) error {
+	var system bool
+	var port int
+	var configFile string
+	var logFile string
+	var logMaxSize int
+	var logMaxFiles int
+	var userName string
+	args, err := flags.
+		Bool("--system", &system).
+		Int("--port", &port).
+		String("--config-file", &configFile).
+		String("--log", &logFile).
+		Int("--log-max-size", &logMaxSize).
+		Int("--log-max-files", &logMaxFiles).
+		String("--user", &userName).
+		Help("-h,--help", serviceHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if port <= 0 {
+		port = config.ServerPort()
+	}
+	// --port also keeps the server from delegating to keep-alive, which it
+	// does when started without arguments and without a terminal
+	serverArgs := []string{"--port", fmt.Sprint(port)}
+	if configFile != "" {
+		if configFile, err = filepath.Abs(configFile); err != nil {
+			return err
+		}
+		serverArgs = append(serverArgs, "--config-file", configFile)
+	}
+	serverArgs = append(serverArgs, args...)
+	if logFile == "" {
+		logFile = defaultServiceLogFile
+	}
+	if logFile, err = filepath.Abs(logFile); err != nil {
+		return err
+	}
+	if logMaxSize <= 0 {
+		logMaxSize = service.DefaultLogMaxSizeMB
+	}
+	if logMaxFiles <= 0 {
+		logMaxFiles = service.DefaultLogMaxFiles
+	}
+	if system && userName == "" {
+		// under sudo, run as the user who invoked it rather than root
+		userName = os.Getenv("SUDO_USER")
+		if userName == "" {
+			if u, err := user.Current(); err == nil {
+				userName = u.Username
+			}
+		}
+	}
+
+	m, err := service.For(system)
+	if err != nil {
+		return err
+	}
+	err = m.Install(service.Options{
+		Executable:   exe,
+		WorkingDir:   wd,
+		ServerArgs:   serverArgs,
+		Path:         os.Getenv("PATH"),
+		LogFile:      logFile,
+		LogMaxSizeMB: logMaxSize,
+		LogMaxFiles:  logMaxFiles,
+		System:       system,
+		User:         userName,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s\n", m.Path())
+	fmt.Printf("Logs: %s\n", logFile)
+	return nil
+}
+
+func runServiceControl(action string, args []string) error {
+	var system bool
+	args, err := flags.
+		Bool("--system", &system).
+		Help("-h,--help", serviceHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %v", args)
+	}
+	m, err := service.For(system)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "uninstall":
+		if err := m.Uninstall(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", m.Path())
+		return nil
+	case "start":
+		return m.Start()
+	case "stop":
+		return m.Stop()
+	}
+	return m.Status()
+}
+
+// runServiceRun is the command the service manager starts; see
+// service.Options.Command.
+func runServiceRun(args []string) error {
+	var logFile string
+	var logMaxSize int
+	var logMaxFiles int
+	args, err := flags.
+		String("--log", &logFile).
+		Int("--log-max-size", &logMaxSize).
+		Int("--log-max-files", &logMaxFiles).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if logFile == "" {
+		return fmt.Errorf("--log is required")
+	}
+	if logMaxSize <= 0 {
+		logMaxSize = service.DefaultLogMaxSizeMB
+	}
+	log, err := service.OpenLogFile(logFile, int64(logMaxSize)<<20, logMaxFiles)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return service.Supervise(exe, args, log)
+}
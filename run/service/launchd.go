@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type launchd struct {
+	dir    string
+	domain string // gui/<uid> or system
+}
+
+func (l *launchd) Path() string {
+	return filepath.Join(l.dir, Label+".plist")
+}
+
+func (l *launchd) target() string {
+	return l.domain + "/" + Label
+}
+
+func (l *launchd) loaded() bool {
+	return exec.Command("launchctl", "print", l.target()).Run() == nil
+}
+
+func (l *launchd) Install(o Options) error {
+	if l.loaded() {
+		if err := run("launchctl", "bootout", l.target()); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(l.Path(), LaunchdPlist(o)); err != nil {
+		return err
+	}
+	return run("launchctl", "bootstrap", l.domain, l.Path())
+}
+
+func (l *launchd) Uninstall() error {
+	if _, err := os.Stat(l.Path()); err != nil {
+		return fmt.Errorf("service not installed: %w", err)
+	}
+	if l.loaded() {
+		if err := run("launchctl", "bootout", l.target()); err != nil {
+			return err
+		}
+	}
+	return os.Remove(l.Path())
+}
+
+// Start loads the job, which starts it as it runs at load; a job that is
+// already loaded is restarted.
+func (l *launchd) Start() error {
+	if l.loaded() {
+		return run("launchctl", "kickstart", "-k", l.target())
+	}
+	return run("launchctl", "bootstrap", l.domain, l.Path())
+}
+
+// Stop unloads the job; otherwise KeepAlive would have launchd start it
+// again. It stays installed and loads again at the next login or boot.
+func (l *launchd) Stop() error {
+	if !l.loaded() {
+		return nil
+	}
+	return run("launchctl", "bootout", l.target())
+}
+
+func (l *launchd) Status() error {
+	if !l.loaded() {
+		if _, err := os.Stat(l.Path()); err != nil {
+			fmt.Println("not installed")
+		} else {
+			fmt.Println("stopped")
+		}
+		return nil
+	}
+	return run("launchctl", "print", l.target())
+}
+
+// LaunchdPlist renders the job plist for o.
+func LaunchdPlist(o Options) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	plistString(&b, "Label", Label)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range o.Command() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(arg))
+	}
+	b.WriteString("\t</array>\n")
+	plistString(&b, "WorkingDirectory", o.WorkingDir)
+	if o.System && o.User != "" {
+		plistString(&b, "UserName", o.User)
+	}
+	if o.Path != "" {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		fmt.Fprintf(&b, "\t\t<key>PATH</key>\n\t\t<string>%s</string>\n", html.EscapeString(o.Path))
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	// restart on failure only, like systemd's Restart=on-failure
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func plistString(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, html.EscapeString(value))
+}
@@ -0,0 +1,122 @@
+// Package service installs the server as a system service: a systemd unit
+// on Linux or a launchd job on macOS. The service manager restarts the
+// server when it fails and starts it at boot; the server's output goes to
+// a log file that is rotated by size (see Supervise).
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Name is the systemd unit name, without the .service suffix.
+const Name = "ai-critic"
+
+// Label is the launchd job label.
+const Label = "com.xhd2015.ai-critic-server"
+
+// Default log rotation limits.
+const (
+	DefaultLogMaxSizeMB = 10
+	DefaultLogMaxFiles  = 5
+)
+
+// Options describe the installed service.
+type Options struct {
+	// Executable is the ai-critic binary the service runs.
+	Executable string
+	// WorkingDir is where the server runs; the data directory and
+	// relative config paths resolve against it.
+	WorkingDir string
+	// ServerArgs are passed to the server, e.g. --port 23712.
+	ServerArgs []string
+	// Path is the PATH the server runs with, so it finds git, agents and
+	// cloudflared as in the shell it was installed from rather than on the
+	// service manager's minimal PATH.
+	Path string
+	// LogFile receives the server's stdout and stderr.
+	LogFile      string
+	LogMaxSizeMB int
+	LogMaxFiles  int
+	// System installs a system-wide service instead of a per-user one.
+	// It needs root.
+	System bool
+	// User runs a system service as this user (systemd only).
+	User string
+}
+
+// Command is the command line the service manager starts: the binary's
+// hidden "service run" supervisor, which writes the rotated log and runs
+// the server with ServerArgs.
+func (o Options) Command() []string {
+	args := []string{
+		o.Executable, "service", "run",
+		"--log", o.LogFile,
+		"--log-max-size", fmt.Sprint(o.LogMaxSizeMB),
+		"--log-max-files", fmt.Sprint(o.LogMaxFiles),
+		"--",
+	}
+	return append(args, o.ServerArgs...)
+}
+
+// Manager controls the service through the platform's service manager.
+type Manager interface {
+	// Path is the unit or plist file.
+	Path() string
+	// Install writes the unit, enables it at boot and starts it.
+	Install(o Options) error
+	// Uninstall stops and disables the service and removes the unit.
+	Uninstall() error
+	Start() error
+	Stop() error
+	// Status prints the service manager's view of the service.
+	Status() error
+}
+
+// For returns the service manager of this platform. system selects the
+// system-wide service over the per-user one.
+func For(system bool) (Manager, error) {
+	home, err := os.UserHomeDir()
+	if err != nil && !system {
+		return nil, err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		dir := filepath.Join(home, ".config", "systemd", "user")
+		if system {
+			dir = "/etc/systemd/system"
+		}
+		return &systemd{dir: dir, system: system}, nil
+	case "darwin":
+		dir := filepath.Join(home, "Library", "LaunchAgents")
+		domain := fmt.Sprintf("gui/%d", os.Getuid())
+		if system {
+			dir = "/Library/LaunchDaemons"
+			domain = "system"
+		}
+		return &launchd{dir: dir, domain: domain}, nil
+	}
+	return nil, fmt.Errorf("system services are not supported on %s; use keep-alive instead", runtime.GOOS)
+}
+
+// run runs a service manager command with its output on the console.
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
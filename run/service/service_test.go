@@ -0,0 +1,104 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var testOptions = Options{
+	Executable:   "/opt/ai critic/ai-critic",
+	WorkingDir:   "/srv/ai-critic",
+	ServerArgs:   []string{"--port", "23712", "--rules-dir", "100%"},
+	Path:         "/usr/bin:/bin",
+	LogFile:      "/srv/ai-critic/ai-critic-service.log",
+	LogMaxSizeMB: 10,
+	LogMaxFiles:  5,
+	System:       true,
+	User:         "dev",
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := SystemdUnit(testOptions)
+	for _, line := range []string{
+		`WorkingDirectory=/srv/ai-critic`,
+		`Environment=PATH=/usr/bin:/bin`,
+		`User=dev`,
+		`ExecStart="/opt/ai critic/ai-critic" service run --log /srv/ai-critic/ai-critic-service.log --log-max-size 10 --log-max-files 5 -- --port 23712 --rules-dir 100%%`,
+		`Restart=on-failure`,
+		`WantedBy=multi-user.target`,
+	} {
+		if !strings.Contains(unit, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, unit)
+		}
+	}
+
+	user := testOptions
+	user.System = false
+	unit = SystemdUnit(user)
+	if strings.Contains(unit, "User=") || !strings.Contains(unit, "WantedBy=default.target\n") {
+		t.Errorf("user unit:\n%s", unit)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	o := testOptions
+	o.ServerArgs = []string{"--config-file", "a&b.json"}
+	plist := LaunchdPlist(o)
+	for _, s := range []string{
+		"<string>" + Label + "</string>",
+		"<string>/opt/ai critic/ai-critic</string>\n\t\t<string>service</string>\n\t\t<string>run</string>",
+		"<string>a&amp;b.json</string>",
+		"<key>UserName</key>\n\t<string>dev</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+	} {
+		if !strings.Contains(plist, s) {
+			t.Errorf("missing %q in:\n%s", s, plist)
+		}
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	l, err := OpenLogFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := l.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	for file, want := range map[string]string{
+		path:        "dddddd\n",
+		path + ".1": "cccccc\n",
+		path + ".2": "bbbbbb\n",
+	} {
+		data, err := os.ReadFile(file)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(file), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more than 2 rotated files")
+	}
+}
+
+func TestSuperviseReportsExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	var log bytes.Buffer
+	err := Supervise("sh", []string{"-c", "echo hello; exit 3"}, &log)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("err = %v, want exit status 3", err)
+	}
+	if !strings.Contains(log.String(), "hello\n") || !strings.Contains(log.String(), "[service] starting server: sh -c") {
+		t.Errorf("log:\n%s", log.String())
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
+)
+
+// Supervise runs the server (exe with args) as the service's main process,
+// writing its stdout and stderr to log, and returns when it exits. A stop
+// signal from the service manager is passed on to the server; the server
+// exiting on its own is reported as an error, so that the service manager
+// restarts it.
+func Supervise(exe string, args []string, log io.Writer) error {
+	logf := func(format string, a ...any) {
+		fmt.Fprintf(log, "[%s] [service] %s\n", time.Now().Format("2006-01-02T15:04:05"), fmt.Sprintf(format, a...))
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	logf("starting server: %s %s", exe, strings.Join(args, " "))
+	if err := cmd.Start(); err != nil {
+		logf("start failed: %v", err)
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	stopping := false
+	for {
+		select {
+		case sig := <-sigs:
+			logf("received %v, stopping server (pid %d)", sig, cmd.Process.Pid)
+			stopping = true
+			if err := procctl.Terminate(cmd.Process.Pid); err != nil {
+				logf("stop server: %v", err)
+			}
+		case err := <-done:
+			if stopping {
+				logf("server stopped")
+				return nil
+			}
+			if err == nil {
+				err = fmt.Errorf("server exited")
+			}
+			logf("%v", err)
+			return err
+		}
+	}
+}
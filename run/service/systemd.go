@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type systemd struct {
+	dir    string
+	system bool
+}
+
+func (s *systemd) Path() string {
+	return filepath.Join(s.dir, Name+".service")
+}
+
+func (s *systemd) systemctl(args ...string) error {
+	if !s.system {
+		args = append([]string{"--user"}, args...)
+	}
+	return run("systemctl", args...)
+}
+
+func (s *systemd) Install(o Options) error {
+	if err := writeFile(s.Path(), SystemdUnit(o)); err != nil {
+		return err
+	}
+	if err := s.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := s.systemctl("enable", "--now", Name); err != nil {
+		return err
+	}
+	if !s.system {
+		fmt.Printf("To start the service at boot without logging in, run: loginctl enable-linger %s\n", os.Getenv("USER"))
+	}
+	return nil
+}
+
+func (s *systemd) Uninstall() error {
+	if _, err := os.Stat(s.Path()); err != nil {
+		return fmt.Errorf("service not installed: %w", err)
+	}
+	if err := s.systemctl("disable", "--now", Name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.Path()); err != nil {
+		return err
+	}
+	return s.systemctl("daemon-reload")
+}
+
+func (s *systemd) Start() error { return s.systemctl("start", Name) }
+func (s *systemd) Stop() error  { return s.systemctl("stop", Name) }
+
+func (s *systemd) Status() error {
+	err := s.systemctl("status", "--no-pager", Name)
+	// systemctl status exits 3 for a stopped unit, which it has printed
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	return err
+}
+
+// SystemdUnit renders the unit file for o.
+func SystemdUnit(o Options) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=ai-critic server\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=simple\n")
+	if o.System && o.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", o.User)
+	}
+	// WorkingDirectory takes the path verbatim, only specifiers expand
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", strings.ReplaceAll(o.WorkingDir, "%", "%%"))
+	if o.Path != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("PATH="+o.Path))
+	}
+	quoted := make([]string, 0, len(o.Command()))
+	for _, arg := range o.Command() {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	b.WriteString("\n[Install]\n")
+	if o.System {
+		b.WriteString("WantedBy=multi-user.target\n")
+	} else {
+		b.WriteString("WantedBy=default.target\n")
+	}
+	return b.String()
+}
+
+// systemdQuote quotes s for a unit file: specifiers (%) and variables ($)
+// are escaped, and words with spaces or quotes are double-quoted.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,79 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/run/daemon"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/selfupdate"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+var updateHelp = fmt.Sprintf(`
+Usage: ai-critic update [options]
+
+Updates this binary to the latest release of %s on GitHub.
+The platform's binary is downloaded, verified against the release's
+%s and swapped in place of this binary. A server running on port
+%d is then restarted in place with its flags preserved.
+
+Options:
+  --check          Only report whether an update is available
+  --force          Reinstall even if already up to date
+  --no-restart     Do not restart the running server
+  -h, --help       Show this help message
+`, selfupdate.Repo, selfupdate.ChecksumsAsset, config.DefaultServerPort)
+
+func runUpdate(args []string) error {
+	var check bool
+	var force bool
+	var noRestart bool
+	args, err := flags.
+		Bool("--check", &check).
+		Bool("--force", &force).
+		Bool("--no-restart", &noRestart).
+		Help("-h,--help", updateHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+
+	ctx := context.Background()
+	rel, err := selfupdate.Check(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Latest release: %s (%s)\n", rel.Tag, rel.URL)
+	if rel.Current {
+		fmt.Println("This binary is up to date.")
+		if !force {
+			return nil
+		}
+	} else {
+		fmt.Println("An update is available.")
+	}
+	if check {
+		return nil
+	}
+
+	fmt.Printf("Downloading %s...\n", rel.Asset)
+	bin, err := selfupdate.Apply(ctx, rel)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checksum verified, installed %s at %s\n", rel.Tag, bin)
+
+	if noRestart || !isPortInUse(config.DefaultServerPort) {
+		return nil
+	}
+	fmt.Printf("Restarting the server on port %d...\n", config.DefaultServerPort)
+	if !daemon.RequestServerExecRestart() {
+		return fmt.Errorf("server restart failed; restart it to run the update")
+	}
+	return nil
+}
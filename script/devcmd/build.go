@@ -0,0 +1,76 @@
+package devcmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/xhd2015/ai-critic/script/lib"
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/xgo/support/cmd"
+)
+
+const buildHelp = `
+Usage: ai-critic build [options]
+
+Builds the frontend (ai-critic-react), installing its dependencies first
+if needed, then the Go server binary embedding it.
+
+Options:
+  -o, --output PATH   Output binary path (default: /tmp/ai-critic)
+  --server-only       Build only the server, embedding the existing frontend build
+  -h, --help          Show this help message
+`
+
+// Build builds the frontend and the server binary.
+func Build(args []string) error {
+	var output string
+	var serverOnly bool
+	args, err := flags.
+		String("-o,--output", &output).
+		Bool("--server-only", &serverOnly).
+		Help("-h,--help", buildHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := noExtraArgs(args); err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = "/tmp/ai-critic"
+		if runtime.GOOS == "windows" {
+			output = "/tmp/ai-critic.exe"
+		}
+	}
+
+	if !serverOnly {
+		// Step 1: Build frontend
+		fmt.Println("=== Building frontend ===")
+
+		// Check if node_modules exists, run npm install if not
+		if _, err := os.Stat("ai-critic-react/node_modules"); err != nil {
+			fmt.Println("node_modules not found, running npm install...")
+			err := cmd.Debug().Dir("ai-critic-react").Run("npm", "install")
+			if err != nil {
+				return fmt.Errorf("npm install failed: %v", err)
+			}
+		}
+		if err := lib.BuildFrontend(); err != nil {
+			return err
+		}
+		fmt.Println("\n=== Building server ===")
+	}
+
+	// Step 2: Build server
+	if err := lib.BuildServer(lib.BuildServerOptions{
+		Output: output,
+	}); err != nil {
+		return fmt.Errorf("server build failed: %v", err)
+	}
+	if !serverOnly {
+		fmt.Println("\nBuild complete!")
+	}
+	return nil
+}
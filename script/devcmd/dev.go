@@ -0,0 +1,170 @@
+package devcmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/xhd2015/agent-pro/pkgs/containers/podman"
+	"github.com/xhd2015/ai-critic/script/lib"
+	"github.com/xhd2015/less-gen/flags"
+	"github.com/xhd2015/xgo/support/cmd"
+)
+
+const devHelp = `
+Usage: ai-critic dev [options]
+
+Builds the server, starts the Vite dev server and runs the server with
+--dev, picking up .config.local.json and rules/ when present. Run it from
+the repository root.
+
+Options:
+  --dir DIR   Set the initial directory for code review (defaults to current working directory)
+  -h, --help  Show this help message
+`
+
+// Dev runs the server and the Vite dev server until either exits.
+func Dev(args []string) error {
+	var dirFlag string
+	args, err := flags.
+		String("--dir", &dirFlag).
+		Help("-h,--help", devHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := noExtraArgs(args); err != nil {
+		return err
+	}
+
+	// Create context for managing subprocesses
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle signals to gracefully shutdown subprocesses
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Println("\nShutting down...")
+		cancel()
+	}()
+
+	// Check if bun installed
+	if _, err := exec.LookPath("bun"); err != nil {
+		return fmt.Errorf("bun is not installed, install it from https://bun.sh/docs/installation")
+	}
+
+	// Check if ai-critic-react/node_modules exists
+	if _, err := os.Stat("ai-critic-react/node_modules"); err != nil {
+		fmt.Println("Installing frontend dependencies...")
+		err := cmd.Debug().Dir("ai-critic-react").Run("bun", "install")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Build the Go server
+	fmt.Println("Building Go server...")
+	err = cmd.Debug().Run("go", "build", "-o", "/tmp/ai-critic", "./")
+	if err != nil {
+		return fmt.Errorf("failed to build Go server: %v", err)
+	}
+
+	// Start vite dev server in background
+	fmt.Println("Starting Vite dev server...")
+	viteCmd := exec.CommandContext(ctx, "bun", "run", "dev")
+	viteCmd.Dir = "ai-critic-react"
+	viteCmd.Stdout = os.Stdout
+	viteCmd.Stderr = os.Stderr
+	if err := viteCmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Vite dev server: %v", err)
+	}
+
+	// Wait for Vite to be ready
+	fmt.Print("Waiting for Vite server to be ready")
+	viteReady := false
+	for i := 0; i < 30; i++ {
+		if podman.CheckPort(lib.ViteDevPort) {
+			viteReady = true
+			break
+		}
+		time.Sleep(1 * time.Second)
+		fmt.Print(".")
+	}
+	fmt.Println()
+
+	if !viteReady {
+		return fmt.Errorf("Vite server failed to start within timeout")
+	}
+	fmt.Println("Vite server is ready!")
+
+	// Use --dir flag if provided, otherwise use current working directory
+	targetDir := dirFlag
+	if targetDir == "" {
+		targetDir, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %v", err)
+		}
+	}
+
+	// Build command args
+	serverArgs := []string{"--dev", "--dir", targetDir}
+
+	// Check for .config.local.json in the current directory (ai-critic)
+	configFile := ".config.local.json"
+	if _, err := os.Stat(configFile); err == nil {
+		fmt.Printf("Found config file: %s\n", configFile)
+		serverArgs = append(serverArgs, "--config-file", configFile)
+	}
+
+	// Check for rules directory
+	rulesDir := "rules"
+	if _, err := os.Stat(rulesDir); err == nil {
+		fmt.Printf("Found rules directory: %s\n", rulesDir)
+		serverArgs = append(serverArgs, "--rules-dir", rulesDir)
+	}
+
+	// Start the Go server in dev mode
+	fmt.Println("Starting Go server in dev mode...")
+	fmt.Printf("Initial directory: %s\n", targetDir)
+	goServerCmd := exec.CommandContext(ctx, "/tmp/ai-critic", serverArgs...)
+	goServerCmd.Stdout = os.Stdout
+	goServerCmd.Stderr = os.Stderr
+	goServerCmd.Stdin = os.Stdin
+	if err := goServerCmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Go server: %v", err)
+	}
+
+	// Wait for either process to exit or context to be cancelled
+	done := make(chan error, 2)
+	go func() {
+		done <- viteCmd.Wait()
+	}()
+	go func() {
+		done <- goServerCmd.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Context cancelled, kill processes
+		if viteCmd.Process != nil {
+			viteCmd.Process.Kill()
+		}
+		if goServerCmd.Process != nil {
+			goServerCmd.Process.Kill()
+		}
+	case err := <-done:
+		// One process exited, cancel context to kill the other
+		cancel()
+		if err != nil {
+			return fmt.Errorf("process exited with error: %v", err)
+		}
+	}
+
+	return nil
+}
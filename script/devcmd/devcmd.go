@@ -0,0 +1,96 @@
+// Package devcmd implements the development commands of the ai-critic CLI:
+// dev, build, tunnel, sandbox and release. They used to be separate
+// go run ./script/... entrypoints; those remain as thin wrappers around
+// the functions here, and the logic they share lives in script/lib.
+//
+// Every command parses its own flags, answers -h/--help and rejects
+// unknown arguments.
+package devcmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	usage   string // arguments shown after the name in help
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the development commands in the order help shows them.
+var commands = []command{
+	{"dev", "[options]", "Run the server in dev mode with the Vite dev server", Dev},
+	{"build", "[options]", "Build the frontend and the server binary", Build},
+	{"tunnel", "setup [options]", "Set up the Cloudflare tunnel of .config.local.json", Tunnel},
+	{"sandbox", "<command> [opts]", "Run the server in a podman container (create, boot, fresh-setup)", Sandbox},
+	{"release", "[options]", "Cross-compile the release binaries and their checksums", Release},
+}
+
+// IsCommand reports whether name is a development command.
+func IsCommand(name string) bool {
+	return lookup(name) != nil
+}
+
+// Run runs the development command named by args[0].
+func Run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command, one of: %s", strings.Join(names(), ", "))
+	}
+	c := lookup(args[0])
+	if c == nil {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return c.run(args[1:])
+}
+
+// HelpLines describes the commands for the CLI's usage text, one
+// "ai-critic <name> <usage>  <summary>" line each, aligned to width.
+func HelpLines(width int) string {
+	var b strings.Builder
+	for _, c := range commands {
+		fmt.Fprintf(&b, "       %-*s %s\n", width, "ai-critic "+c.name+" "+c.usage, c.summary)
+	}
+	return b.String()
+}
+
+func lookup(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func names() []string {
+	var out []string
+	for _, c := range commands {
+		out = append(out, c.name)
+	}
+	return out
+}
+
+// runSubcommand dispatches to one of subs by args[0], showing help when
+// there is none.
+func runSubcommand(args []string, help string, subs map[string]func(args []string) error) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(help)
+		return nil
+	}
+	run, ok := subs[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand: %s", args[0])
+	}
+	return run(args[1:])
+}
+
+// noExtraArgs rejects the positional arguments left after flag parsing.
+func noExtraArgs(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unrecognized extra args: %s", strings.Join(args, " "))
+	}
+	return nil
+}
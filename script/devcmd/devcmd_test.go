@@ -0,0 +1,35 @@
+package devcmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunRejectsUnknown(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "missing command"},
+		{[]string{"deploy"}, "unknown command: deploy"},
+		{[]string{"sandbox", "destroy"}, "unknown subcommand: destroy"},
+		// checked before anything is built
+		{[]string{"release", "linux"}, "unrecognized extra args: linux"},
+		{[]string{"build", "--server-only", "x"}, "unrecognized extra args: x"},
+	}
+	for _, tt := range tests {
+		err := Run(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Run(%q) = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestHelpLinesListsEveryCommand(t *testing.T) {
+	help := HelpLines(30)
+	for _, c := range commands {
+		if !strings.Contains(help, "ai-critic "+c.name+" ") {
+			t.Errorf("help misses %s:\n%s", c.name, help)
+		}
+	}
+}
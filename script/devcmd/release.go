@@ -0,0 +1,115 @@
+package devcmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/script/lib"
+	"github.com/xhd2015/ai-critic/server/selfupdate"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+// checksumsFile lists the SHA-256 sums of the binaries.
+const checksumsFile = selfupdate.ChecksumsAsset
+
+const releaseHelp = `
+Usage: ai-critic release [options]
+
+Cross-compiles the server for release targets and writes their SHA256SUMS.
+
+Options:
+  -h, --help    Show this help message
+`
+
+// releaseTargets defines the cross-compilation targets for release.
+var releaseTargets = []struct {
+	GOOS   string
+	GOARCH string
+}{
+	{"linux", "amd64"},
+	{"linux", "arm64"},
+	{"windows", "amd64"},
+}
+
+// Release cross-compiles the release binaries into the current directory.
+func Release(args []string) error {
+	args, err := flags.Help("-h,--help", releaseHelp).Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := noExtraArgs(args); err != nil {
+		return err
+	}
+
+	// Step 1: Build frontend (shared across all targets)
+	fmt.Println("=== Building frontend ===")
+	if err := lib.BuildFrontend(); err != nil {
+		return err
+	}
+
+	// Step 2: Cross-compile for each target
+	for _, t := range releaseTargets {
+		output := releaseOutputName(t.GOOS, t.GOARCH)
+		fmt.Printf("\n=== Building %s/%s -> %s ===\n", t.GOOS, t.GOARCH, output)
+		if err := lib.BuildServer(lib.BuildServerOptions{
+			Output: output,
+			GOOS:   t.GOOS,
+			GOARCH: t.GOARCH,
+		}); err != nil {
+			return fmt.Errorf("build %s/%s failed: %v", t.GOOS, t.GOARCH, err)
+		}
+	}
+
+	// Step 3: Checksums, which ai-critic update verifies downloads against
+	var outputs []string
+	for _, t := range releaseTargets {
+		outputs = append(outputs, releaseOutputName(t.GOOS, t.GOARCH))
+	}
+	if err := writeChecksums(checksumsFile, outputs); err != nil {
+		return fmt.Errorf("write %s: %v", checksumsFile, err)
+	}
+
+	fmt.Println("\n=== Release build complete! ===")
+	fmt.Println("Binaries:")
+	for _, output := range outputs {
+		fmt.Printf("  %s\n", output)
+	}
+	fmt.Printf("  %s\n", checksumsFile)
+	fmt.Println("\nUpload these files to a GitHub release.")
+	return nil
+}
+
+// writeChecksums writes the SHA-256 sums of files to path in the format
+// of sha256sum.
+func writeChecksums(path string, files []string) error {
+	var b strings.Builder
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), file)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// releaseOutputName is the release binary name for a target, e.g.
+// ai-critic-server-linux-amd64 or ai-critic-server-windows-amd64.exe.
+// ai-critic update looks binaries up by these names.
+func releaseOutputName(goos, goarch string) string {
+	name := fmt.Sprintf("%s-%s-%s", lib.BinaryName, goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
@@ -0,0 +1,194 @@
+package devcmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xhd2015/agent-pro/pkgs/containers/podman"
+	"github.com/xhd2015/ai-critic/script/lib"
+	"github.com/xhd2015/less-gen/flags"
+)
+
+const sandboxHelp = `
+Usage: ai-critic sandbox <command> [options]
+
+Commands:
+  create        Create a Debian container and open a shell in it
+  boot          Build the server and run it in a reused container
+  fresh-setup   Build the server and run it in a fresh container
+`
+
+const sandboxCreateHelp = `
+Usage: ai-critic sandbox create
+
+Creates a baremetal Debian container and drops you into a shell.
+The container is kept running after exit (use "podman rm -f ai-critic-sandbox" to remove).
+
+Steps:
+  1. Check podman is installed and machine is running
+  2. Create and start a Debian container
+  3. Exec into the container with an interactive shell
+
+Options:
+  -h, --help    Show this help message
+`
+
+const sandboxBootHelp = `
+Usage: ai-critic sandbox boot [options]
+
+Builds the frontend and Go server as a single Linux binary,
+then runs it inside a podman container.
+
+Unlike fresh-setup, the container is reused across runs — user changes
+inside the container are preserved between restarts.
+
+Options:
+  --arch ARCH   Target architecture: auto, amd64, arm64 (default: auto)
+  --dev         Dev mode: skip frontend build, proxy to host Vite dev server for hot-reload
+  --recreate-container        Destroy existing container and start fresh (prompts for confirmation)
+  --force-recreate-container  Same as --recreate-container but skips confirmation
+  -h, --help    Show this help message
+
+Steps:
+  1. npm install + npm run build (frontend) — skipped with --dev
+  2. GOOS=linux GOARCH=<arch> go build (server with embedded frontend)
+  3. Reuse or create podman container
+
+Examples:
+  # Run with default settings
+  ai-critic sandbox boot
+
+  # Force recreate container without confirmation
+  ai-critic sandbox boot --force-recreate-container
+
+  # Run in dev mode (skip frontend build, proxy to host Vite dev server)
+  ai-critic sandbox boot --dev
+`
+
+const sandboxFreshSetupHelp = `
+Usage: ai-critic sandbox fresh-setup [options]
+
+Builds the frontend and Go server as a single Linux binary,
+then runs it inside a podman container.
+
+Options:
+  --arch ARCH   Target architecture: auto, amd64, arm64 (default: auto)
+  -h, --help    Show this help message
+
+Steps:
+  1. npm install + npm run build (frontend)
+  2. GOOS=linux GOARCH=<arch> go build (server with embedded frontend)
+  3. podman create + podman cp + podman start
+`
+
+// Sandbox runs a sandbox subcommand.
+func Sandbox(args []string) error {
+	return runSubcommand(args, sandboxHelp, map[string]func([]string) error{
+		"create":      sandboxCreate,
+		"boot":        sandboxBoot,
+		"fresh-setup": sandboxFreshSetup,
+	})
+}
+
+func sandboxBoot(args []string) error {
+	return lib.RunSandboxBoot(args, lib.SandboxBootOptions{
+		Help: sandboxBootHelp,
+		Sandbox: lib.SandboxOptions{
+			ScriptSubDir:  "script/sandbox/boot",
+			FreshSetup:    false,
+			ContainerPort: lib.QuickTestPort,
+			ContainerName: lib.ContainerName,
+		},
+	})
+}
+
+func sandboxFreshSetup(args []string) error {
+	var archFlag string
+	args, err := flags.
+		String("--arch", &archFlag).
+		Help("-h,--help", sandboxFreshSetupHelp).
+		Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := noExtraArgs(args); err != nil {
+		return err
+	}
+	if archFlag == "" {
+		archFlag = "auto"
+	}
+
+	return lib.RunSandbox(lib.SandboxOptions{
+		ArchFlag:      archFlag,
+		ScriptSubDir:  "script/sandbox/fresh-setup",
+		FreshSetup:    true,
+		ContainerPort: lib.QuickTestPort,
+		ContainerName: lib.ContainerNameFresh,
+	})
+}
+
+func sandboxCreate(args []string) error {
+	args, err := flags.Help("-h,--help", sandboxCreateHelp).Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := noExtraArgs(args); err != nil {
+		return err
+	}
+
+	// Step 0: Ensure podman is available and the machine is running
+	if err := podman.EnsurePodman(); err != nil {
+		return err
+	}
+
+	// Step 1: Check if container already exists
+	fmt.Println("\n=== Creating container ===")
+
+	inspectCmd := exec.Command("podman", "inspect", "--format", "{{.State.Status}}", lib.ContainerName)
+	var inspectBuf bytes.Buffer
+	inspectCmd.Stdout = &inspectBuf
+	inspectCmd.Stderr = &inspectBuf
+
+	if err := inspectCmd.Run(); err == nil {
+		status := strings.TrimSpace(inspectBuf.String())
+		if status == "running" {
+			fmt.Printf("Container %q is already running. Attaching...\n", lib.ContainerName)
+			return execSandboxShell()
+		}
+		// Container exists but is stopped — start it
+		fmt.Printf("Container %q exists (status: %s). Starting...\n", lib.ContainerName, status)
+		if err := podman.Run("podman", "start", lib.ContainerName); err != nil {
+			return fmt.Errorf("failed to start container: %v", err)
+		}
+		return execSandboxShell()
+	}
+
+	// Container doesn't exist — create it
+	fmt.Printf("Creating container %q from %s...\n", lib.ContainerName, lib.ContainerImage)
+	createArgs := []string{
+		"run", "-d",
+		"--name", lib.ContainerName,
+		lib.ContainerImage,
+		"sleep", "infinity",
+	}
+	if err := podman.Run("podman", createArgs...); err != nil {
+		return fmt.Errorf("failed to create container: %v", err)
+	}
+
+	return execSandboxShell()
+}
+
+// execSandboxShell opens an interactive shell inside the container.
+func execSandboxShell() error {
+	fmt.Printf("\nDropping into shell in container %q...\n", lib.ContainerName)
+	fmt.Println("(Type 'exit' to leave the container. It will keep running.)")
+
+	shellCmd := exec.Command("podman", "exec", "-it", lib.ContainerName, "/bin/bash")
+	shellCmd.Stdin = os.Stdin
+	shellCmd.Stdout = os.Stdout
+	shellCmd.Stderr = os.Stderr
+	return shellCmd.Run()
+}
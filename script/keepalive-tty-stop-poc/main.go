@@ -41,6 +41,7 @@ import (
 	"time"
 
 	"github.com/creack/pty"
+	"github.com/xhd2015/ai-critic/server/portpid"
 )
 
 const stateFileName = "ai-critic-keepalive-tty-stop-poc.json"
@@ -421,16 +422,14 @@ func runReproduceKeepalive(args []string) {
 }
 
 func pidListeningOn(port int) (int, error) {
-	out, err := exec.Command("lsof", "-nP", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-t").Output()
+	pids, err := portpid.PIDsOnPort(port)
 	if err != nil {
-		return 0, fmt.Errorf("lsof port %d: %w", port, err)
+		return 0, fmt.Errorf("port %d: %w", port, err)
 	}
-	line := strings.TrimSpace(string(out))
-	if line == "" {
+	if len(pids) == 0 {
 		return 0, fmt.Errorf("no listener on port %d", port)
 	}
-	first := strings.Split(line, "\n")[0]
-	return strconv.Atoi(strings.TrimSpace(first))
+	return pids[0], nil
 }
 
 type DetectReport struct {
@@ -608,4 +607,4 @@ func procStatusState(pid int) string {
 		}
 	}
 	return ""
-}
\ No newline at end of file
+}
@@ -4,51 +4,12 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/xhd2015/ai-critic/script/lib"
+	"github.com/xhd2015/ai-critic/script/devcmd"
 )
 
-var help = `
-Usage: go run ./script/sandbox/boot [options]
-
-Builds the frontend and Go server as a single Linux binary,
-then runs it inside a podman container.
-
-Unlike fresh-setup, the container is reused across runs — user changes
-inside the container are preserved between restarts.
-
-Options:
-  --arch ARCH   Target architecture: auto, amd64, arm64 (default: auto)
-  --dev         Dev mode: skip frontend build, proxy to host Vite dev server for hot-reload
-  --recreate-container        Destroy existing container and start fresh (prompts for confirmation)
-  --force-recreate-container  Same as --recreate-container but skips confirmation
-  -h, --help    Show this help message
-
-Steps:
-  1. npm install + npm run build (frontend) — skipped with --dev
-  2. GOOS=linux GOARCH=<arch> go build (server with embedded frontend)
-  3. Reuse or create podman container
-
-Examples:
-  # Run with default settings
-  go run ./script/sandbox/boot
-
-  # Force recreate container without confirmation
-  go run ./script/sandbox/boot --force-recreate-container
-
-  # Run in dev mode (skip frontend build, proxy to host Vite dev server)
-  go run ./script/sandbox/boot --dev
-`
-
+// Same as: ai-critic sandbox boot
 func main() {
-	if err := lib.RunSandboxBoot(os.Args[1:], lib.SandboxBootOptions{
-		Help: help,
-		Sandbox: lib.SandboxOptions{
-			ScriptSubDir:  "script/sandbox/boot",
-			FreshSetup:    false,
-			ContainerPort: lib.QuickTestPort,
-			ContainerName: lib.ContainerName,
-		},
-	}); err != nil {
+	if err := devcmd.Sandbox(append([]string{"boot"}, os.Args[1:]...)); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
@@ -9,12 +9,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // Action represents a user-defined custom action
@@ -449,7 +449,7 @@ func RunActionWithID(actionID string, projectDir string, script string, w http.R
 	cmd.Dir = projectDir
 
 	// Create process group to ensure child processes are killed together
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = procctl.GroupAttr()
 
 	// Set up environment with PATH additions
 	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
@@ -538,10 +538,9 @@ func StopAction(actionID string, projectName string) error {
 	fmt.Println(logMsg)
 
 	// Kill the entire process group (including child processes)
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	pgid, err := procctl.GroupOf(cmd.Process.Pid)
 	if err == nil {
-		// Kill the entire process group with negative PID
-		syscall.Kill(-pgid, syscall.SIGKILL)
+		procctl.KillGroup(pgid)
 		fmt.Printf("Sent SIGKILL to process group %d for action %s\n", pgid, actionID)
 	} else {
 		// Fallback to killing just the process
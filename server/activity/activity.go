@@ -0,0 +1,242 @@
+// Package activity keeps a per-project timeline of what happened: agent tasks,
+// reviews, pushes and tunnel events recorded by other modules, merged with the
+// project's git commits when queried.
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/events"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Event kinds.
+const (
+	KindCommit = "commit"
+	KindAgent  = "agent"
+	KindReview = "review"
+	KindPush   = "push"
+	KindTunnel = "tunnel"
+)
+
+const (
+	// maxEventsPerProject caps stored events for each project (oldest dropped).
+	maxEventsPerProject = 1000
+	// maxCommits bounds the git log read for one timeline query.
+	maxCommits = 500
+
+	defaultPageSize = 50
+)
+
+// Event is one entry on a project timeline.
+type Event struct {
+	Time    string `json:"time"` // RFC3339
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Detail  string `json:"detail,omitempty"`
+	Project string `json:"project,omitempty"` // project directory; empty for server-wide events
+	Status  string `json:"status,omitempty"`  // e.g. "ok", "error"
+	Ref     string `json:"ref,omitempty"`     // commit SHA, session ID, tunnel ID...
+}
+
+type store struct {
+	// Projects maps a project directory ("" for server-wide) to its events, oldest first.
+	Projects map[string][]Event `json:"projects"`
+}
+
+var (
+	mu   sync.Mutex
+	file = jsonfile.New[store](config.DataDir + "/activity.json")
+)
+
+// Record appends an event to the project's timeline. projectDir may be empty
+// for server-wide events such as tunnels, which appear on every timeline.
+// Errors are logged, never returned: activity is best effort.
+func Record(projectDir string, ev Event) {
+	if projectDir != "" {
+		if abs, err := filepath.Abs(projectDir); err == nil {
+			projectDir = abs
+		}
+	}
+	ev.Project = projectDir
+	if ev.Time == "" {
+		ev.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	err := file.Update(func(s *store) error {
+		if s.Projects == nil {
+			s.Projects = make(map[string][]Event)
+		}
+		events := append(s.Projects[projectDir], ev)
+		if len(events) > maxEventsPerProject {
+			events = events[len(events)-maxEventsPerProject:]
+		}
+		s.Projects[projectDir] = events
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[activity] failed to record %s event: %v\n", ev.Kind, err)
+	}
+	events.Publish(events.TopicActivity, ev.Kind, ev)
+}
+
+// Timeline is one page of a project's activity, newest first.
+type Timeline struct {
+	Events     []Event `json:"events"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	Total      int     `json:"total"`
+	TotalPages int     `json:"total_pages"`
+}
+
+// Query returns recorded events and git commits for projectDir newer than
+// since (zero for all), paginated newest first. kinds filters by event kind.
+func Query(projectDir string, since time.Time, kinds []string, page, pageSize int) (*Timeline, error) {
+	if abs, err := filepath.Abs(projectDir); err == nil {
+		projectDir = abs
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+
+	mu.Lock()
+	s, err := file.Get()
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	events = append(events, s.Projects[projectDir]...)
+	events = append(events, s.Projects[""]...)
+	if gitrunner.IsRepo(projectDir) {
+		events = append(events, gitCommits(projectDir, since)...)
+	}
+
+	wanted := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		wanted[k] = true
+	}
+	filtered := events[:0]
+	for _, ev := range events {
+		if len(wanted) > 0 && !wanted[ev.Kind] {
+			continue
+		}
+		if !since.IsZero() {
+			if t, err := time.Parse(time.RFC3339, ev.Time); err != nil || !t.After(since) {
+				continue
+			}
+		}
+		filtered = append(filtered, ev)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339, filtered[i].Time)
+		tj, _ := time.Parse(time.RFC3339, filtered[j].Time)
+		return ti.After(tj)
+	})
+
+	total := len(filtered)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return &Timeline{
+		Events:     append([]Event{}, filtered[start:end]...),
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}, nil
+}
+
+// gitCommits lists commits reachable from HEAD as timeline events.
+func gitCommits(dir string, since time.Time) []Event {
+	args := []string{"log", fmt.Sprintf("--max-count=%d", maxCommits), "--format=%H%x1f%cI%x1f%an%x1f%s"}
+	if !since.IsZero() {
+		args = append(args, "--since="+since.Format(time.RFC3339))
+	}
+	out, err := gitrunner.NewCommand(args...).Dir(dir).Output()
+	if err != nil {
+		return nil
+	}
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			continue
+		}
+		events = append(events, Event{
+			Time:    t.UTC().Format(time.RFC3339),
+			Kind:    KindCommit,
+			Title:   fields[3],
+			Detail:  fields[2],
+			Project: dir,
+			Ref:     fields[0],
+		})
+	}
+	return events
+}
+
+// RegisterAPI registers the timeline endpoint:
+// GET /api/activity?dir=...&since=RFC3339&kind=push,agent&page=1&page_size=50
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/activity", handleTimeline)
+}
+
+func handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	dir := q.Get("dir")
+	if dir == "" {
+		http.Error(w, "dir is required", http.StatusBadRequest)
+		return
+	}
+	var since time.Time
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	var kinds []string
+	if v := q.Get("kind"); v != "" {
+		kinds = strings.Split(v, ",")
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+
+	timeline, err := Query(dir, since, kinds, page, pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
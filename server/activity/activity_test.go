@@ -0,0 +1,60 @@
+package activity
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func TestQueryMergesCommitsAndPaginates(t *testing.T) {
+	file = jsonfile.New[store](filepath.Join(t.TempDir(), "activity.json"))
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "first"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "GIT_COMMITTER_DATE=2024-01-01T00:00:00Z")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	Record(dir, Event{Kind: KindPush, Title: "Pushed main", Time: "2024-01-03T00:00:00Z"})
+	Record(dir, Event{Kind: KindAgent, Title: "Agent started", Time: "2024-01-02T00:00:00Z"})
+	Record("", Event{Kind: KindTunnel, Title: "Tunnel started", Time: "2024-01-04T00:00:00Z"})
+	Record(t.TempDir(), Event{Kind: KindPush, Title: "other project"})
+
+	tl, err := Query(dir, time.Time{}, nil, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tl.Total != 4 || tl.TotalPages != 2 {
+		t.Fatalf("total = %d, pages = %d, want 4, 2", tl.Total, tl.TotalPages)
+	}
+	if got := []string{tl.Events[0].Title, tl.Events[1].Title}; got[0] != "Tunnel started" || got[1] != "Pushed main" {
+		t.Errorf("page 1 = %v", got)
+	}
+
+	tl, err = Query(dir, time.Time{}, nil, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.Events) != 2 || tl.Events[1].Kind != KindCommit || tl.Events[1].Title != "first" {
+		t.Errorf("page 2 = %+v", tl.Events)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2024-01-01T12:00:00Z")
+	tl, err = Query(dir, since, []string{KindPush, KindCommit}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tl.Total != 1 || tl.Events[0].Title != "Pushed main" {
+		t.Errorf("filtered = %+v", tl.Events)
+	}
+}
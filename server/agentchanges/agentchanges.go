@@ -0,0 +1,324 @@
+// Package agentchanges attributes working-tree changes to the agent sessions
+// that made them. A Tracker snapshots the dirty files when a session starts;
+// after each agent run, files whose content changed since the last snapshot
+// are recorded as that session's changeset and, when the project's
+// AgentChanges setting is "stage", added to the git index.
+package agentchanges
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// deletedHash stands in for the content hash of a file removed from disk.
+const deletedHash = "deleted"
+
+// Attribution records that an agent session last modified a file.
+type Attribution struct {
+	Path      string `json:"path"`
+	SessionID string `json:"session_id"`
+	Agent     string `json:"agent"`
+	Model     string `json:"model,omitempty"`
+	ChangedAt string `json:"changed_at"` // RFC3339
+	Hash      string `json:"hash"`       // content hash after the agent's change
+	Staged    bool   `json:"staged"`     // whether it was auto-staged
+	// EditedAfter is set when the file changed again after the agent touched it.
+	EditedAfter bool `json:"edited_after,omitempty"`
+}
+
+type store struct {
+	// Projects maps a repository directory to path -> attribution.
+	Projects map[string]map[string]Attribution `json:"projects"`
+}
+
+var (
+	mu   sync.Mutex
+	file = jsonfile.New[store](config.DataDir + "/agent-changes.json")
+	log  = logging.New("agent-changes")
+)
+
+// snapshot maps the paths of dirty files to their content hash.
+type snapshot map[string]string
+
+// Tracker attributes changes in one directory to one agent session.
+type Tracker struct {
+	dir       string
+	sessionID string
+	agent     string
+
+	mu       sync.Mutex
+	baseline snapshot
+}
+
+// NewTracker snapshots dir so that only changes made from now on are
+// attributed to the session. It returns nil if dir is not a git repository.
+func NewTracker(dir, sessionID, agent string) *Tracker {
+	snap, err := takeSnapshot(dir)
+	if err != nil {
+		return nil
+	}
+	return &Tracker{dir: dir, sessionID: sessionID, agent: agent, baseline: snap}
+}
+
+// Capture attributes files changed since the previous snapshot to the
+// session, according to the project's AgentChanges mode, and returns them.
+// model is the model the agent ran with, if known. With the mode off it only
+// moves the baseline forward.
+func (t *Tracker) Capture(model string) ([]Attribution, error) {
+	if t == nil {
+		return nil, nil
+	}
+	return t.capture(ModeFor(t.dir), model)
+}
+
+func (t *Tracker) capture(mode, model string) ([]Attribution, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, err := takeSnapshot(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	changed := changedPaths(t.baseline, current)
+	t.baseline = current
+
+	if mode == projects.AgentChangesOff || len(changed) == 0 {
+		return nil, nil
+	}
+
+	staged := false
+	if mode == projects.AgentChangesStage {
+		args := append([]string{"-A", "--"}, changed...)
+		if out, err := gitrunner.Add(args...).Dir(t.dir).Run(); err != nil {
+			log.Warnf("auto-stage in %s failed: %v: %s", t.dir, err, strings.TrimSpace(string(out)))
+		} else {
+			staged = true
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	attrs := make([]Attribution, 0, len(changed))
+	for _, p := range changed {
+		attrs = append(attrs, Attribution{
+			Path:      p,
+			SessionID: t.sessionID,
+			Agent:     t.agent,
+			Model:     model,
+			ChangedAt: now,
+			Hash:      current[p],
+			Staged:    staged,
+		})
+	}
+	if err := record(t.dir, attrs); err != nil {
+		return nil, err
+	}
+	log.Infof("%s changed %d file(s) in %s (mode %s)", t.agent, len(attrs), t.dir, mode)
+	return attrs, nil
+}
+
+// ModeFor returns the AgentChanges setting of the project registered for
+// dir, or off if there is none.
+func ModeFor(dir string) string {
+	p, err := projects.FindByDir(dir)
+	if err != nil || p == nil {
+		return projects.AgentChangesOff
+	}
+	return p.AgentChanges
+}
+
+// List returns the attributions of files in dir that still have uncommitted
+// changes, sorted by path. Entries for files that are clean again (committed
+// or reverted) are dropped from the store.
+func List(dir string) ([]Attribution, error) {
+	current, err := takeSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	key := storeKey(dir)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var result []Attribution
+	err = file.Update(func(s *store) error {
+		attrs := s.Projects[key]
+		for p, a := range attrs {
+			hash, dirty := current[p]
+			if !dirty {
+				delete(attrs, p)
+				continue
+			}
+			a.EditedAfter = hash != a.Hash
+			result = append(result, a)
+		}
+		if len(attrs) == 0 {
+			delete(s.Projects, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// Lookup returns the attributions for dir keyed by path without pruning,
+// for annotating status listings cheaply.
+func Lookup(dir string) map[string]Attribution {
+	mu.Lock()
+	defer mu.Unlock()
+	s, err := file.Get()
+	if err != nil {
+		return nil
+	}
+	attrs := make(map[string]Attribution, len(s.Projects[storeKey(dir)]))
+	for p, a := range s.Projects[storeKey(dir)] {
+		attrs[p] = a
+	}
+	return attrs
+}
+
+// Dismiss forgets the attributions of a session's changeset in dir, or of
+// all sessions when sessionID is empty. The files themselves are untouched.
+func Dismiss(dir, sessionID string) (int, error) {
+	key := storeKey(dir)
+	mu.Lock()
+	defer mu.Unlock()
+	n := 0
+	err := file.Update(func(s *store) error {
+		attrs := s.Projects[key]
+		for p, a := range attrs {
+			if sessionID == "" || a.SessionID == sessionID {
+				delete(attrs, p)
+				n++
+			}
+		}
+		if len(attrs) == 0 {
+			delete(s.Projects, key)
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Stage adds the files of a session's changeset to the git index.
+func Stage(dir, sessionID string) ([]string, error) {
+	attrs, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, a := range attrs {
+		if a.SessionID == sessionID {
+			paths = append(paths, a.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no pending changes for session %s", sessionID)
+	}
+	args := append([]string{"-A", "--"}, paths...)
+	if out, err := gitrunner.Add(args...).Dir(dir).Run(); err != nil {
+		return nil, fmt.Errorf("git add: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	key := storeKey(dir)
+	mu.Lock()
+	defer mu.Unlock()
+	err = file.Update(func(s *store) error {
+		for _, p := range paths {
+			if a, ok := s.Projects[key][p]; ok {
+				a.Staged = true
+				s.Projects[key][p] = a
+			}
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func record(dir string, attrs []Attribution) error {
+	key := storeKey(dir)
+	mu.Lock()
+	defer mu.Unlock()
+	return file.Update(func(s *store) error {
+		if s.Projects == nil {
+			s.Projects = make(map[string]map[string]Attribution)
+		}
+		if s.Projects[key] == nil {
+			s.Projects[key] = make(map[string]Attribution)
+		}
+		for _, a := range attrs {
+			s.Projects[key][a.Path] = a
+		}
+		return nil
+	})
+}
+
+func storeKey(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return filepath.Clean(dir)
+}
+
+// changedPaths returns the dirty paths whose hash differs between two
+// snapshots. Files that became clean have nothing left to attribute.
+func changedPaths(before, after snapshot) []string {
+	var paths []string
+	for p, h := range after {
+		if before[p] != h {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// takeSnapshot hashes every file git reports as changed or untracked.
+func takeSnapshot(dir string) (snapshot, error) {
+	out, err := gitrunner.Status("--porcelain=v1", "-z", "--untracked-files=all").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status in %s: %v", dir, err)
+	}
+	snap := make(snapshot)
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if len(e) < 4 {
+			continue
+		}
+		if e[0] == 'R' || e[0] == 'C' {
+			i++ // the original path of a rename or copy follows
+		}
+		p := e[3:]
+		snap[p] = hashFile(filepath.Join(dir, p))
+	}
+	return snap, nil
+}
+
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return deletedHash
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return deletedHash
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
@@ -0,0 +1,152 @@
+package agentchanges
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+func TestCaptureAttributesOnlyAgentChanges(t *testing.T) {
+	file = jsonfile.New[store](filepath.Join(t.TempDir(), "agent-changes.json"))
+
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "a\n")
+	write("b.txt", "b\n")
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+
+	// Pre-existing edit by the user: not attributed to the agent
+	write("a.txt", "user edit\n")
+	tr := NewTracker(repo, "s1", "opencode")
+	if tr == nil {
+		t.Fatal("tracker is nil for a git repo")
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		edit       func()
+		wantPaths  []string
+		wantStaged string // git diff --cached --name-only
+	}{
+		{
+			name:      "off only moves the baseline",
+			mode:      projects.AgentChangesOff,
+			edit:      func() { write("b.txt", "ignored\n") },
+			wantPaths: nil,
+		},
+		{
+			name:      "changeset records without staging",
+			mode:      projects.AgentChangesChangeset,
+			edit:      func() { write("c.txt", "new\n") },
+			wantPaths: []string{"c.txt"},
+		},
+		{
+			name:       "stage adds the changed files",
+			mode:       projects.AgentChangesStage,
+			edit:       func() { write("b.txt", "agent\n"); os.Remove(filepath.Join(repo, "c.txt")) },
+			wantPaths:  []string{"b.txt"},
+			wantStaged: "b.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.edit()
+			attrs, err := tr.capture(tt.mode, "m1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, a := range attrs {
+				paths = append(paths, a.Path)
+				if a.SessionID != "s1" || a.Staged != (tt.mode == projects.AgentChangesStage) {
+					t.Errorf("attribution = %+v", a)
+				}
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.wantPaths, ",") {
+				t.Errorf("paths = %v, want %v", paths, tt.wantPaths)
+			}
+			if staged := strings.TrimSpace(git("diff", "--cached", "--name-only")); staged != tt.wantStaged {
+				t.Errorf("staged = %q, want %q", staged, tt.wantStaged)
+			}
+		})
+	}
+
+	// c.txt was removed again, so only b.txt remains pending; an edit after
+	// the agent's is flagged.
+	write("b.txt", "user again\n")
+	attrs, err := List(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 1 || attrs[0].Path != "b.txt" || !attrs[0].EditedAfter {
+		t.Errorf("List = %+v", attrs)
+	}
+	if n, _ := Dismiss(repo, "s1"); n != 1 || len(Lookup(repo)) != 0 {
+		t.Errorf("Dismiss removed %d, left %v", n, Lookup(repo))
+	}
+}
+
+func TestAppendTrailers(t *testing.T) {
+	attrs := []Attribution{
+		{Path: "a.go", SessionID: "agent-session-1", Agent: "OpenCode", Model: "gpt-5"},
+		{Path: "b.go", SessionID: "agent-session-1", Agent: "OpenCode", Model: "gpt-5"},
+		{Path: "c.go", SessionID: "agent-session-2", Agent: "Cursor Agent"},
+	}
+	trailers := Trailers(attrs)
+	want := "Generated-by: OpenCode\nAgent-Model: gpt-5\nAgent-Session: agent-session-1\nGenerated-by: Cursor Agent\nAgent-Session: agent-session-2"
+	if got := strings.Join(trailers, "\n"); got != want {
+		t.Fatalf("Trailers =\n%s\nwant\n%s", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "subject only",
+			message: "Fix parser\n",
+			want:    "Fix parser\n\n" + want,
+		},
+		{
+			name:    "joins an existing trailer block",
+			message: "Fix parser\n\nBody text.\n\nSigned-off-by: Dev <dev@example.com>",
+			want:    "Fix parser\n\nBody text.\n\nSigned-off-by: Dev <dev@example.com>\n" + want,
+		},
+		{
+			name:    "skips trailers already present",
+			message: "Fix parser\n\n" + want,
+			want:    "Fix parser\n\n" + want,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AppendTrailers(tt.message, trailers); got != tt.want {
+				t.Errorf("AppendTrailers =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
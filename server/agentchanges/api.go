@@ -0,0 +1,114 @@
+package agentchanges
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// Changeset groups the pending changes of one agent session.
+type Changeset struct {
+	SessionID string        `json:"session_id"`
+	Agent     string        `json:"agent"`
+	UpdatedAt string        `json:"updated_at"`
+	Files     []Attribution `json:"files"`
+}
+
+// RegisterAPI registers the agent change endpoints:
+//
+//	GET  /api/agent-changes?dir=...                      mode and pending changesets
+//	POST /api/agent-changes/stage?dir=...&session_id=... stage a session's changeset
+//	POST /api/agent-changes/dismiss?dir=...&session_id=... forget attributions (all sessions if session_id is empty)
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/agent-changes", handleList)
+	mux.HandleFunc("/api/agent-changes/stage", handleStage)
+	mux.HandleFunc("/api/agent-changes/dismiss", handleDismiss)
+}
+
+func handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	dir := projects.Dir(r.Context(), r.URL.Query().Get("dir"))
+	if dir == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dir is required"})
+		return
+	}
+	attrs, err := List(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"mode":       ModeFor(dir),
+		"changesets": groupBySession(attrs),
+	})
+}
+
+func handleStage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	dir := projects.Dir(r.Context(), r.URL.Query().Get("dir"))
+	sessionID := r.URL.Query().Get("session_id")
+	if dir == "" || sessionID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dir and session_id are required"})
+		return
+	}
+	paths, err := Stage(dir, sessionID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"staged": paths})
+}
+
+func handleDismiss(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	dir := projects.Dir(r.Context(), r.URL.Query().Get("dir"))
+	if dir == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dir is required"})
+		return
+	}
+	n, err := Dismiss(dir, r.URL.Query().Get("session_id"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"dismissed": n})
+}
+
+// groupBySession turns path-sorted attributions into changesets, most
+// recently updated first.
+func groupBySession(attrs []Attribution) []Changeset {
+	result := []Changeset{}
+	index := make(map[string]int)
+	for _, a := range attrs {
+		i, ok := index[a.SessionID]
+		if !ok {
+			i = len(result)
+			index[a.SessionID] = i
+			result = append(result, Changeset{SessionID: a.SessionID, Agent: a.Agent})
+		}
+		cs := &result[i]
+		cs.Files = append(cs.Files, a)
+		if a.ChangedAt > cs.UpdatedAt {
+			cs.UpdatedAt = a.ChangedAt
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].UpdatedAt > result[j].UpdatedAt })
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
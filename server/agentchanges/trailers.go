@@ -0,0 +1,103 @@
+package agentchanges
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// Commit trailers naming the agent sessions whose changes a commit contains.
+const (
+	TrailerGeneratedBy = "Generated-by"
+	TrailerModel       = "Agent-Model"
+	TrailerSession     = "Agent-Session"
+)
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z0-9-]+: `)
+
+// StagedAttributions returns the attributions of the files staged in dir.
+func StagedAttributions(dir string) ([]Attribution, error) {
+	out, err := gitrunner.NewCommand("diff", "--cached", "--name-only", "-z").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list staged files: %v", err)
+	}
+	staged := make(map[string]bool)
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			staged[p] = true
+		}
+	}
+	attrs, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []Attribution
+	for _, a := range attrs {
+		if staged[a.Path] {
+			result = append(result, a)
+		}
+	}
+	return result, nil
+}
+
+// Trailers returns the commit trailers for attrs: a Generated-by, Agent-Model
+// (when known) and Agent-Session line per session, in order of appearance.
+func Trailers(attrs []Attribution) []string {
+	var trailers []string
+	seen := make(map[string]bool)
+	for _, a := range attrs {
+		if seen[a.SessionID] {
+			continue
+		}
+		seen[a.SessionID] = true
+		trailers = append(trailers, TrailerGeneratedBy+": "+a.Agent)
+		if a.Model != "" {
+			trailers = append(trailers, TrailerModel+": "+a.Model)
+		}
+		trailers = append(trailers, TrailerSession+": "+a.SessionID)
+	}
+	return trailers
+}
+
+// AppendTrailers adds trailers to a commit message, skipping lines already
+// present. They join an existing trailer block, or start a new paragraph.
+func AppendTrailers(message string, trailers []string) string {
+	message = strings.TrimRight(message, " \t\n")
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(message, "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+	var add []string
+	for _, t := range trailers {
+		if !existing[t] {
+			add = append(add, t)
+		}
+	}
+	if len(add) == 0 {
+		return message
+	}
+
+	sep := "\n\n"
+	if i := strings.LastIndex(message, "\n\n"); i >= 0 {
+		inBlock := true
+		for _, line := range strings.Split(message[i+2:], "\n") {
+			if !trailerLine.MatchString(line) {
+				inBlock = false
+				break
+			}
+		}
+		if inBlock {
+			sep = "\n"
+		}
+	}
+	return message + sep + strings.Join(add, "\n")
+}
+
+// Prune drops the attributions of files in dir that are clean again, e.g.
+// after a commit, so a later edit to them is not attributed to the agent.
+func Prune(dir string) error {
+	_, err := List(dir)
+	return err
+}
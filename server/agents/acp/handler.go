@@ -185,7 +185,7 @@ func handleAgentConnect(w http.ResponseWriter, r *http.Request, agent Agent) {
 	// If no cwd but we have project info, resolve the directory
 	var resolvedDir string
 	if cwd == "" && body.ProjectName != "" {
-		resolvedCwd, err := projects.ResolveProjectDir(body.ProjectName, body.WorktreeID)
+		resolvedCwd, err := projects.ForContext(r.Context()).ResolveProjectDir(body.ProjectName, body.WorktreeID)
 		if err == nil && resolvedCwd != "" {
 			cwd = resolvedCwd
 			cwdSource = "project-resolve"
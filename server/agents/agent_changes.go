@@ -0,0 +1,60 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/activity"
+)
+
+// captureChanges attributes the files modified by the session's last run
+// and, depending on the project's AgentChanges setting, stages them.
+func (s *agentSession) captureChanges() {
+	attrs, err := s.changes.Capture(s.currentModel())
+	if err != nil {
+		log.Warnf("capture changes of %s: %v", s.id, err)
+		return
+	}
+	if len(attrs) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		paths = append(paths, a.Path)
+	}
+	verb := "changed"
+	if attrs[0].Staged {
+		verb = "changed and staged"
+	}
+	activity.Record(s.projectDir, activity.Event{
+		Kind:   activity.KindAgent,
+		Title:  fmt.Sprintf("%s %s %d file(s)", s.agentName, verb, len(attrs)),
+		Detail: strings.Join(paths, "\n"),
+		Ref:    s.id,
+	})
+}
+
+// currentModel returns the model the session's agent is configured with, or
+// "" if it cannot be determined.
+func (s *agentSession) currentModel() string {
+	if s.adapter != nil {
+		return s.adapter.GetModel()
+	}
+	if s.port == 0 {
+		return ""
+	}
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/config", s.port))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	var config struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(resp.Body).Decode(&config)
+	return config.Model
+}
@@ -1,6 +1,7 @@
 package agents
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,15 +18,30 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/agentchanges"
+	"github.com/xhd2015/ai-critic/server/agents/claude"
+	"github.com/xhd2015/ai-critic/server/agents/codex"
 	"github.com/xhd2015/ai-critic/server/agents/cursor"
 	"github.com/xhd2015/ai-critic/server/agents/cursor_acp"
 	"github.com/xhd2015/ai-critic/server/agents/opencode/common_opencode"
 	opencode_exposed "github.com/xhd2015/ai-critic/server/agents/opencode/exposed_opencode"
 	opencode_internal "github.com/xhd2015/ai-critic/server/agents/opencode/internal_opencode"
 	"github.com/xhd2015/ai-critic/server/agents/opencode_serve_children"
+	"github.com/xhd2015/ai-critic/server/artifacts"
+	"github.com/xhd2015/ai-critic/server/env"
+	"github.com/xhd2015/ai-critic/server/httpcache"
+	"github.com/xhd2015/ai-critic/server/jobs"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/metrics"
+	"github.com/xhd2015/ai-critic/server/notifications"
+	"github.com/xhd2015/ai-critic/server/projects"
+	"github.com/xhd2015/ai-critic/server/quota"
 	"github.com/xhd2015/ai-critic/server/settings"
+	"github.com/xhd2015/ai-critic/server/tenant"
 )
 
 // AgentDef defines a supported coding agent
@@ -69,14 +85,16 @@ var agentDefs = []AgentDef{
 	{
 		ID:          AgentIDClaudeCode,
 		Name:        "Claude Code",
-		Description: "Anthropic's Claude coding agent (CLI)",
+		Description: "Anthropic's Claude coding agent (chat mode via stream-json adapter)",
 		Command:     "claude",
+		Headless:    true,
 	},
 	{
 		ID:          AgentIDCodex,
 		Name:        "Codex",
-		Description: "OpenAI Codex CLI agent",
+		Description: "OpenAI Codex CLI agent (chat mode via exec --json adapter)",
 		Command:     "codex",
+		Headless:    true,
 	},
 	{
 		ID:          AgentIDCursorAgent,
@@ -97,6 +115,25 @@ type AgentSessionInfo struct {
 	CreatedAt  string `json:"created_at"`
 	Status     string `json:"status"` // "starting", "running", "stopped", "error"
 	Error      string `json:"error,omitempty"`
+	// Owner is the tenant that launched the session; empty for the global
+	// namespace.
+	Owner string `json:"owner,omitempty"`
+	// Review is the automatic review of the changes produced by the last run.
+	Review *AutoReviewResult `json:"review,omitempty"`
+	// ChangesReview is the review of the changes the session made, run
+	// on request; nil if never run.
+	ChangesReview *SessionReview `json:"changes_review,omitempty"`
+	// Artifacts summarizes the output files collected from the session.
+	Artifacts *artifacts.Summary `json:"artifacts,omitempty"`
+	// Checkpoint was made before the session started; nil if automatic
+	// checkpoints are off or the project is not a git checkout.
+	Checkpoint *SessionCheckpoint `json:"checkpoint,omitempty"`
+	// Limits is how the resource limits apply to the session; nil if none
+	// are set or the session runs in-process.
+	Limits *LimitStatus `json:"limits,omitempty"`
+	// Usage is the latest sample of the resources the agent process uses;
+	// nil for in-process sessions and ones not running.
+	Usage *ProcessUsage `json:"usage,omitempty"`
 }
 
 // AgentSessionsResponse holds paginated agent sessions response
@@ -116,16 +153,44 @@ type agentSession struct {
 	projectDir string
 	port       int
 	createdAt  time.Time
+	owner      string // tenant.Name of the launching request
 	cmd        *exec.Cmd
 	proxy      *httputil.ReverseProxy
 
-	// For cursor-agent adapter mode (no external HTTP server, handled in-process)
-	cursorAdapter *cursor.Adapter
+	// For adapter mode (cursor-agent, Claude Code, Codex): no external HTTP server,
+	// the adapter runs the CLI per prompt and serves the chat API in-process
+	adapter chatAdapter
 
 	mu     sync.Mutex
 	status string // "starting", "running", "stopped", "error"
 	err    string
 	done   chan struct{}
+
+	// review is the latest post-run review; reviewGen discards stale results.
+	review    *AutoReviewResult
+	reviewGen int
+
+	// changesReview is the latest review of only the session's changes;
+	// changesReviewGen discards stale results.
+	changesReview    *SessionReview
+	changesReviewGen int
+
+	// changes attributes files modified by this session (nil outside git repos).
+	changes *agentchanges.Tracker
+
+	// artifacts collects the session's output files; artifactsSummary is
+	// its state as of the last collection.
+	artifacts        *artifacts.Task
+	artifactsSummary *artifacts.Summary
+
+	checkpoint *SessionCheckpoint
+
+	// limits enforces the resource limits on cmd; nil if none are set.
+	limits *limiter
+
+	// usage is the latest sample; usageState what sampling keeps.
+	usage      *ProcessUsage
+	usageState usageState
 }
 
 type agentSessionManager struct {
@@ -137,6 +202,11 @@ type agentSessionManager struct {
 
 var sessionMgr = newSessionManager()
 
+// metricsOnce guards the registration of the agent_sessions metric.
+var metricsOnce sync.Once
+
+var log = logging.New("agents")
+
 func newSessionManager() *agentSessionManager {
 	store, _ := settings.NewStore(".settings")
 	return &agentSessionManager{
@@ -147,10 +217,20 @@ func newSessionManager() *agentSessionManager {
 
 // RegisterAPI registers agent-related API endpoints
 func RegisterAPI(mux *http.ServeMux) {
+	quota.SetAgentSessionCounter(sessionMgr.countActive)
+	metricsOnce.Do(func() {
+		metrics.GaugeFunc("agent_sessions", "Agent sessions, by status.", []string{"status"}, sessionMgr.countByStatus)
+	})
+	startSampler.Do(func() { go sessionMgr.sampleUsageLoop() })
+
 	mux.HandleFunc("/api/agents", handleListAgents)
 	mux.HandleFunc("/api/agents/config", handleAgentConfig)
+	mux.HandleFunc("/api/agents/limits", handleAgentLimits)
 	mux.HandleFunc("/api/agents/effective-path", handleAgentEffectivePath)
 	mux.HandleFunc("/api/agents/opencode/auth", handleOpencodeAuth)
+	mux.HandleFunc("/api/agents/opencode/auth/login", handleOpencodeAuthLogin)
+	mux.HandleFunc("/api/agents/opencode/auth/login/stream", handleOpencodeAuthLoginStream)
+	mux.HandleFunc("/api/agents/opencode/auth/login/input", handleOpencodeAuthLoginInput)
 	mux.HandleFunc("/api/agents/opencode/auth-keys", handleOpencodeAuthKeys)
 	mux.HandleFunc("/api/agents/opencode/providers", handleOpencodeProviders)
 	mux.HandleFunc("/api/agents/opencode/settings", handleOpencodeSettings)
@@ -167,10 +247,14 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/agents/codex/session-messages", handleCodexSessionMessages)
 	mux.HandleFunc("/api/agents/codex/ws", handleCodexWebSocket)
 	mux.HandleFunc("/api/agents/sessions", handleAgentSessions)
-	// Proxy: /api/agents/sessions/{sessionID}/proxy/... -> opencode server
+	mux.HandleFunc("/api/agents/sessions/review", handleAgentSessionReview)
+	mux.HandleFunc("/api/agents/sessions/stream", handleAgentSessionsStream)
+	// Proxy: /api/agents/sessions/{sessionID}/proxy/... -> opencode server,
+	// and /api/agents/sessions/{sessionID}/review
 	mux.HandleFunc("/api/agents/sessions/", handleAgentSessionProxy)
 	// External opencode sessions (from CLI/web)
 	mux.HandleFunc("/api/agents/external-sessions", handleExternalSessions)
+	mux.HandleFunc("/api/agents/external-sessions/bulk", handleExternalSessionsBulk)
 
 	// Cursor ACP API
 	cursor_acp.RegisterAPI(mux)
@@ -179,10 +263,10 @@ func RegisterAPI(mux *http.ServeMux) {
 
 // Shutdown stops the agents module and cleans up opencode serve children.
 func Shutdown() {
-	fmt.Println("Stopping opencode health check...")
+	log.Infof("Stopping opencode health check...")
 	opencode_exposed.StopHealthCheck()
 	if err := CleanupAllOpencodeServe(); err != nil {
-		fmt.Printf("Warning: failed to cleanup opencode serve children: %v\n", err)
+		log.Warnf("failed to cleanup opencode serve children: %v", err)
 	}
 }
 
@@ -213,7 +297,23 @@ func findFreePort() (int, error) {
 	return port, nil
 }
 
-func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agentSession, error) {
+// settingsFor returns the settings store of a tenant; the shared store for
+// the global namespace.
+func (m *agentSessionManager) settingsFor(owner string) *settings.Store {
+	if owner == "" {
+		return m.settingsStore
+	}
+	store, err := settings.NewStore(filepath.Join(tenant.DirOf(owner), "settings"))
+	if err != nil {
+		log.Warnf("settings store for %s: %v", owner, err)
+		return m.settingsStore
+	}
+	return store
+}
+
+// launch starts a session of agentID in projectDir. id is empty for a new
+// session, or the ID of a session being restored after an exec-restart.
+func (m *agentSessionManager) launch(id, owner, agentID, projectDir, apiKey string, artifactPaths []string) (*agentSession, error) {
 	aid := AgentID(agentID)
 	// Find the agent def
 	var agentDef *AgentDef
@@ -236,13 +336,46 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 	}
 
 	m.mu.Lock()
-	m.counter++
-	id := fmt.Sprintf("agent-session-%d", m.counter)
+	if id == "" {
+		m.counter++
+		id = fmt.Sprintf("agent-session-%d", m.counter)
+	} else if _, ok := m.sessions[id]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("session %s already exists", id)
+	} else {
+		// new sessions must not reuse the restored one's ID
+		var n int
+		if _, err := fmt.Sscanf(id, "agent-session-%d", &n); err == nil && n > m.counter {
+			m.counter = n
+		}
+	}
 	m.mu.Unlock()
 
-	// For cursor-agent, use the in-process adapter instead of an external HTTP server
-	if agentDef.ID == AgentIDCursorAgent {
-		return m.launchCursorAdapter(id, agentDef, projectDir, apiKey)
+	task, err := artifacts.NewTask(owner, id, agentDef.Name, projectDir, append(projectArtifactPaths(projectDir), artifactPaths...))
+	if err != nil {
+		return nil, err
+	}
+
+	// For cursor-agent, Claude Code and Codex, use an in-process adapter instead of an external HTTP server
+	switch agentDef.ID {
+	case AgentIDCursorAgent:
+		adapter, err := cursor.NewAdapter(projectDir, m.settingsFor(owner), apiKey)
+		if err != nil {
+			return nil, err
+		}
+		return m.launchAdapter(owner, id, agentDef, projectDir, adapter, task), nil
+	case AgentIDClaudeCode, AgentIDCodex:
+		cmdPath, err := getAgentBinaryPath(agentDef.ID, agentDef.Command)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s is not installed (%s not found)", agentDef.Name, agentDef.Command)
+		}
+		var adapter chatAdapter
+		if agentDef.ID == AgentIDClaudeCode {
+			adapter = claude.NewAdapter(projectDir, cmdPath, m.settingsFor(owner), apiKey)
+		} else {
+			adapter = codex.NewAdapter(projectDir, cmdPath, m.settingsFor(owner), apiKey)
+		}
+		return m.launchAdapter(owner, id, agentDef, projectDir, adapter, task), nil
 	}
 
 	// Check command is installed and get full path (considering custom binary path)
@@ -250,6 +383,8 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 	if err != nil {
 		return nil, fmt.Errorf("agent %s is not installed (%s not found)", agentDef.Name, agentDef.Command)
 	}
+	// before the agent can modify anything
+	cp := checkpointBeforeSession(projectDir, id)
 
 	// Find a free port
 	port, err := findFreePort()
@@ -262,7 +397,7 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 
 	cmd := exec.Command(cmdPath, args...)
 	cmd.Dir = projectDir
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color", env.EnvArtifactsDir+"="+task.Dir())
 	cmd.Env = tool_resolve.AppendExtraPaths(cmd.Env)
 	// Do not inherit server stdout/stderr — children would keep parent pipe open after server exit.
 	cmd.Stdout = io.Discard
@@ -282,6 +417,7 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 			AgentID:    agentID,
 		})
 	}
+	limits := applyLimits(id, cmd)
 
 	waitForHeadlessAgentHealth(port, 10*time.Second)
 
@@ -295,21 +431,28 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 	}
 
 	s := &agentSession{
-		id:         id,
-		agentID:    agentID,
-		agentName:  agentDef.Name,
-		projectDir: projectDir,
-		port:       port,
-		createdAt:  time.Now(),
-		cmd:        cmd,
-		proxy:      proxy,
-		status:     "starting",
-		done:       make(chan struct{}),
+		id:               id,
+		agentID:          agentID,
+		agentName:        agentDef.Name,
+		projectDir:       projectDir,
+		port:             port,
+		createdAt:        time.Now(),
+		owner:            owner,
+		cmd:              cmd,
+		proxy:            proxy,
+		status:           "starting",
+		done:             make(chan struct{}),
+		changes:          agentchanges.NewTracker(projectDir, id, agentDef.Name),
+		artifacts:        task,
+		artifactsSummary: &artifacts.Summary{Task: task.ID},
+		checkpoint:       cp,
+		limits:           limits,
 	}
 
 	m.mu.Lock()
 	m.sessions[id] = s
 	m.mu.Unlock()
+	recordAgentStarted(s)
 
 	// Wait for agent server to be ready, then apply preferred model
 	go func() {
@@ -319,16 +462,23 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 		s.mu.Unlock()
 		if status == "running" {
 			s.applyPreferredModel()
+			s.watchPromptDone()
 		}
 	}()
 
 	// Monitor process exit
 	go func() {
 		err := cmd.Wait()
+		var exceeded string
+		if limits != nil {
+			exceeded = limits.release().Exceeded
+		}
 		s.mu.Lock()
 		if s.status != "stopped" {
 			s.status = "error"
-			if err != nil {
+			if exceeded != "" {
+				s.err = "stopped: " + exceeded
+			} else if err != nil {
 				s.err = err.Error()
 			} else {
 				s.err = "process exited unexpectedly"
@@ -336,35 +486,102 @@ func (m *agentSessionManager) launch(agentID, projectDir, apiKey string) (*agent
 		}
 		s.mu.Unlock()
 		_ = opencode_serve_children.Remove("", id)
+		s.captureChanges()
+		s.collectArtifacts()
 		close(s.done)
 	}()
 
 	return s, nil
 }
 
-// launchCursorAdapter creates a cursor adapter session (no external process, in-process HTTP handler).
-func (m *agentSessionManager) launchCursorAdapter(id string, agentDef *AgentDef, projectDir, apiKey string) (*agentSession, error) {
-	adapter, err := cursor.NewAdapter(projectDir, m.settingsStore, apiKey)
-	if err != nil {
-		return nil, err
-	}
+// chatAdapter is an in-process agent adapter serving the chat API.
+type chatAdapter interface {
+	http.Handler
+	GetModel() string
+	SetPromptDoneHook(fn func(chatID string))
+}
+
+// launchAdapter creates an adapter session (no external process, in-process HTTP handler).
+func (m *agentSessionManager) launchAdapter(owner, id string, agentDef *AgentDef, projectDir string, adapter chatAdapter, task *artifacts.Task) *agentSession {
+	// before the agent can modify anything
+	cp := checkpointBeforeSession(projectDir, id)
 
 	s := &agentSession{
-		id:            id,
-		agentID:       string(agentDef.ID),
-		agentName:     agentDef.Name,
-		projectDir:    projectDir,
-		createdAt:     time.Now(),
-		cursorAdapter: adapter,
-		status:        "running",
-		done:          make(chan struct{}),
+		id:               id,
+		agentID:          string(agentDef.ID),
+		agentName:        agentDef.Name,
+		projectDir:       projectDir,
+		createdAt:        time.Now(),
+		owner:            owner,
+		adapter:          adapter,
+		status:           "running",
+		done:             make(chan struct{}),
+		changes:          agentchanges.NewTracker(projectDir, id, agentDef.Name),
+		artifacts:        task,
+		artifactsSummary: &artifacts.Summary{Task: task.ID},
+		checkpoint:       cp,
 	}
 
 	m.mu.Lock()
 	m.sessions[id] = s
 	m.mu.Unlock()
+	recordAgentStarted(s)
 
-	return s, nil
+	// Review the working tree each time a prompt run finishes.
+	adapter.SetPromptDoneHook(s.promptDone)
+
+	return s
+}
+
+// promptDone records that a prompt run of chatID is over, then captures the
+// changes and artifacts it left and reviews the working tree.
+func (s *agentSession) promptDone(chatID string) {
+	activity.Record(s.projectDir, activity.Event{
+		Kind:  activity.KindAgent,
+		Title: fmt.Sprintf("%s finished a task", s.agentName),
+		Ref:   chatID,
+	})
+	notifyTaskFinished(s)
+	s.captureChanges()
+	s.collectArtifacts()
+	s.startAutoReview()
+}
+
+// watchPromptDone calls promptDone each time a session of the opencode
+// server goes idle, until the session ends. Prompts are mostly sent with
+// prompt_async, so the proxied request does not tell when a run is over.
+func (s *agentSession) watchPromptDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.done
+		cancel()
+	}()
+	for ctx.Err() == nil {
+		_ = opencode_exposed.WatchIdle(ctx, s.port, s.promptDone)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func recordAgentStarted(s *agentSession) {
+	activity.Record(s.projectDir, activity.Event{
+		Kind:  activity.KindAgent,
+		Title: fmt.Sprintf("%s session started", s.agentName),
+		Ref:   s.id,
+	})
+}
+
+// notifyTaskFinished tells users that a prompt run of s is over.
+func notifyTaskFinished(s *agentSession) {
+	notifications.Notify(notifications.Notification{
+		Event:   notifications.EventAgentFinished,
+		Title:   fmt.Sprintf("%s finished a task", s.agentName),
+		Body:    filepath.Base(s.projectDir),
+		Project: s.projectDir,
+	})
 }
 
 func (s *agentSession) waitReady() {
@@ -498,17 +715,69 @@ func (m *agentSessionManager) get(id string) *agentSession {
 	return m.sessions[id]
 }
 
+// getFor returns session id if the request may use it: members only reach
+// the sessions they launched, everyone else reaches all of them.
+func (m *agentSessionManager) getFor(ctx context.Context, id string) *agentSession {
+	s := m.get(id)
+	if s == nil {
+		return nil
+	}
+	if owner := tenant.Name(ctx); owner != "" && s.owner != owner {
+		return nil
+	}
+	return s
+}
+
 func (m *agentSessionManager) list() []AgentSessionInfo {
-	return m.listPaginated(1, 1000).Sessions // default to high limit for backward compatibility
+	return m.listPaginated("", 1, 1000).Sessions // default to high limit for backward compatibility
 }
 
-func (m *agentSessionManager) listPaginated(page, pageSize int) *AgentSessionsResponse {
+// countActive returns how many sessions of owner are starting or running.
+func (m *agentSessionManager) countActive(owner string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, s := range m.sessions {
+		if s.owner != owner {
+			continue
+		}
+		s.mu.Lock()
+		if s.status == "starting" || s.status == "running" {
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// countByStatus reports the number of sessions in each status, for the
+// agent_sessions metric.
+func (m *agentSessionManager) countByStatus(set func(v float64, labelValues ...string)) {
+	counts := map[string]int{"starting": 0, "running": 0, "stopped": 0, "error": 0}
+	m.mu.Lock()
+	for _, s := range m.sessions {
+		s.mu.Lock()
+		counts[s.status]++
+		s.mu.Unlock()
+	}
+	m.mu.Unlock()
+	for status, n := range counts {
+		set(float64(n), status)
+	}
+}
+
+// listPaginated lists the sessions of owner, or all sessions when owner is
+// empty.
+func (m *agentSessionManager) listPaginated(owner string, page, pageSize int) *AgentSessionsResponse {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Convert sessions to slice for sorting
 	sessionList := make([]*agentSession, 0, len(m.sessions))
 	for _, s := range m.sessions {
+		if owner != "" && s.owner != owner {
+			continue
+		}
 		sessionList = append(sessionList, s)
 	}
 
@@ -548,6 +817,8 @@ func (m *agentSessionManager) listPaginated(page, pageSize int) *AgentSessionsRe
 			CreatedAt:  s.createdAt.Format(time.RFC3339),
 			Status:     s.status,
 			Error:      s.err,
+			Owner:      s.owner,
+			Review:     s.reviewSnapshot(),
 		}
 		s.mu.Unlock()
 		sessions = append(sessions, info)
@@ -562,6 +833,19 @@ func (m *agentSessionManager) listPaginated(page, pageSize int) *AgentSessionsRe
 	}
 }
 
+// ListSessions returns the headless agent sessions started by this server,
+// newest first.
+func ListSessions() []AgentSessionInfo {
+	return sessionMgr.list()
+}
+
+// RestoreSession relaunches a session that was active before an
+// exec-restart under its previous ID, so clients keep reaching it.
+func RestoreSession(id, owner, agentID, projectDir string) error {
+	_, err := sessionMgr.launch(id, owner, agentID, projectDir, "", nil)
+	return err
+}
+
 func (m *agentSessionManager) stop(id string) {
 	m.mu.Lock()
 	s, ok := m.sessions[id]
@@ -577,6 +861,14 @@ func (m *agentSessionManager) stop(id string) {
 	s.mu.Lock()
 	s.status = "stopped"
 	s.mu.Unlock()
+	// Process-backed sessions capture changes when the process exits.
+	if s.adapter != nil {
+		go func() {
+			notifyTaskFinished(s)
+			s.captureChanges()
+			s.collectArtifacts()
+		}()
+	}
 
 	if s.cmd != nil && s.cmd.Process != nil {
 		opencode_serve_children.KillChild(s.cmd.Process.Pid, s.port)
@@ -588,17 +880,51 @@ func (s *agentSession) info() AgentSessionInfo {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return AgentSessionInfo{
-		ID:         s.id,
-		AgentID:    s.agentID,
-		AgentName:  s.agentName,
-		ProjectDir: s.projectDir,
-		Port:       s.port,
-		CreatedAt:  s.createdAt.Format(time.RFC3339),
-		Status:     s.status,
-		Error:      s.err,
+		ID:            s.id,
+		AgentID:       s.agentID,
+		AgentName:     s.agentName,
+		ProjectDir:    s.projectDir,
+		Port:          s.port,
+		CreatedAt:     s.createdAt.Format(time.RFC3339),
+		Status:        s.status,
+		Error:         s.err,
+		Owner:         s.owner,
+		Review:        s.reviewSnapshot(),
+		ChangesReview: s.changesReviewSnapshot(),
+		Artifacts:     s.artifactsSummary,
+		Checkpoint:    s.checkpoint,
+		Limits:        s.limitStatus(),
+		Usage:         s.usageSnapshot(),
 	}
 }
 
+// usageSnapshot returns a copy of the latest usage; s.mu must be held.
+func (s *agentSession) usageSnapshot() *ProcessUsage {
+	if s.usage == nil {
+		return nil
+	}
+	u := *s.usage
+	return &u
+}
+
+// limitStatus returns the enforcement status of the session's limits.
+func (s *agentSession) limitStatus() *LimitStatus {
+	if s.limits == nil {
+		return nil
+	}
+	st := s.limits.snapshot()
+	return &st
+}
+
+// reviewSnapshot returns a copy of the session's review; s.mu must be held.
+func (s *agentSession) reviewSnapshot() *AutoReviewResult {
+	if s.review == nil {
+		return nil
+	}
+	review := *s.review
+	return &review
+}
+
 // ------ HTTP Handlers ------
 
 func handleListAgents(w http.ResponseWriter, r *http.Request) {
@@ -607,15 +933,19 @@ func handleListAgents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Backends())
+}
+
+// Backends returns the supported agents with Installed set.
+func Backends() []AgentDef {
 	agents := make([]AgentDef, len(agentDefs))
 	copy(agents, agentDefs)
 
 	for i := range agents {
 		agents[i].Installed = isAgentInstalled(agents[i].ID, agents[i].Command)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(agents)
+	return agents
 }
 
 // isAgentInstalled checks if an agent is installed, considering custom binary paths
@@ -1050,14 +1380,13 @@ func handleOpencodeWebServerDomainMapStreaming(w http.ResponseWriter, r *http.Re
 		provider = req.Provider
 	}
 
-	// Start or get existing session
-	session, err := opencode_exposed.MapDomainViaCloudflareStreaming(provider, sessionID)
+	// Start or get existing session; the mapping runs as a background job
+	job, err := opencode_exposed.MapDomainViaCloudflareStreaming(provider, sessionID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Setup SSE
 	sseWriter := sse.NewWriter(w)
 	if sseWriter == nil {
 		http.Error(w, "streaming not supported", http.StatusInternalServerError)
@@ -1067,95 +1396,9 @@ func handleOpencodeWebServerDomainMapStreaming(w http.ResponseWriter, r *http.Re
 	// Send session ID for reconnection
 	sseWriter.Send(map[string]string{
 		"type":       "session",
-		"session_id": session.ID,
+		"session_id": job.ID(),
 	})
-
-	// If this is a reconnection and session is already done, send completion
-	if session.IsDone() {
-		sseWriter.SendStatus(session.Status, map[string]string{
-			"public_url": session.PublicURL,
-		})
-		if session.Success {
-			sseWriter.SendDone(map[string]string{
-				"success":    "true",
-				"message":    "Domain mapping completed",
-				"public_url": session.PublicURL,
-			})
-		} else {
-			sseWriter.SendDone(map[string]string{
-				"success": "false",
-				"message": session.Error,
-			})
-		}
-		return
-	}
-
-	// Send any logs that were already generated (for reconnection)
-	if startIndex > 0 {
-		existingLogs := session.GetLogsSince(0)
-		for _, log := range existingLogs {
-			if log.IsError {
-				sseWriter.SendError(log.Message)
-			} else {
-				sseWriter.SendLog(log.Message)
-			}
-		}
-	}
-
-	// Stream logs until completion
-	currentIndex := len(session.Logs)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-r.Context().Done():
-			// Client disconnected - they can reconnect with session_id
-			return
-
-		case <-session.WaitDone():
-			// Send any remaining logs
-			logs := session.GetLogsSince(currentIndex)
-			for _, log := range logs {
-				if log.IsError {
-					sseWriter.SendError(log.Message)
-				} else {
-					sseWriter.SendLog(log.Message)
-				}
-			}
-
-			// Send final status
-			sseWriter.SendStatus(session.Status, map[string]string{
-				"public_url": session.PublicURL,
-			})
-
-			if session.Success {
-				sseWriter.SendDone(map[string]string{
-					"success":    "true",
-					"message":    "Domain mapping completed successfully",
-					"public_url": session.PublicURL,
-				})
-			} else {
-				sseWriter.SendDone(map[string]string{
-					"success": "false",
-					"message": session.Error,
-				})
-			}
-			return
-
-		case <-ticker.C:
-			// Send new logs
-			logs := session.GetLogsSince(currentIndex)
-			for _, log := range logs {
-				if log.IsError {
-					sseWriter.SendError(log.Message)
-				} else {
-					sseWriter.SendLog(log.Message)
-				}
-			}
-			currentIndex = len(session.Logs)
-		}
-	}
+	jobs.StreamSSE(r.Context(), sseWriter, job, startIndex)
 }
 
 // handleAgentEffectivePath returns the effective binary path for an agent
@@ -1253,7 +1496,9 @@ func handleAgentConfig(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleExternalSessions returns sessions from external opencode servers (CLI/web)
+// handleExternalSessions returns sessions from external opencode servers (CLI/web).
+// Optional filters: project_dir, max_age, older_than (Go durations); sessions whose
+// project directory no longer exists are hidden unless include_missing=true.
 func handleExternalSessions(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1275,6 +1520,12 @@ func handleExternalSessions(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	filter, err := parseExternalSessionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get or start the opencode server
 	server, err := opencode_internal.GetOrStartOpencodeServer()
 	if err != nil {
@@ -1283,22 +1534,14 @@ func handleExternalSessions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch sessions from opencode server
-	url := fmt.Sprintf("http://127.0.0.1:%d/session", server.Port)
-	resp, err := http.Get(url)
+	fetched, authRequired, err := fetchExternalSessions(server.Port)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
-
-	// Accept both 200 (no auth) and 401 (requires auth) as valid responses
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
-		http.Error(w, fmt.Sprintf("opencode server returned status %d", resp.StatusCode), http.StatusInternalServerError)
-		return
-	}
 
 	// If 401, return empty sessions (user needs to authenticate)
-	if resp.StatusCode == http.StatusUnauthorized {
+	if authRequired {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"items":       []interface{}{},
@@ -1312,11 +1555,8 @@ func handleExternalSessions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var allSessions []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&allSessions); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	// Hide sessions whose project directory is gone unless asked otherwise
+	allSessions, hidden := filter.apply(fetched, time.Now())
 
 	// Apply pagination
 	total := len(allSessions)
@@ -1346,6 +1586,7 @@ func handleExternalSessions(w http.ResponseWriter, r *http.Request) {
 		"total":       total,
 		"total_pages": totalPages,
 		"port":        server.Port,
+		"hidden":      hidden,
 	})
 }
 
@@ -1367,21 +1608,28 @@ func handleAgentSessions(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		sessions := sessionMgr.listPaginated(page, pageSize)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(sessions)
+		sessions := sessionMgr.listPaginated(tenant.Name(r.Context()), page, pageSize)
+		httpcache.WriteJSON(w, r, sessions)
 
 	case http.MethodPost:
 		var req struct {
 			AgentID    string `json:"agent_id"`
 			ProjectDir string `json:"project_dir"`
-			APIKey     string `json:"api_key,omitempty"` // Optional API key for cursor-agent
+			APIKey     string `json:"api_key,omitempty"` // Optional API key for cursor-agent, Claude Code or Codex
+			// Artifacts are output paths to collect after each run, in
+			// addition to the project's artifact_paths.
+			Artifacts []string `json:"artifacts,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "invalid request body", http.StatusBadRequest)
 			return
 		}
-		s, err := sessionMgr.launch(req.AgentID, req.ProjectDir, req.APIKey)
+		owner := tenant.Name(r.Context())
+		if err := quota.CheckAgentSessions(r.Context(), sessionMgr.countActive(owner)); err != nil {
+			quota.WriteError(w, err)
+			return
+		}
+		s, err := sessionMgr.launch("", owner, req.AgentID, projects.Dir(r.Context(), req.ProjectDir), req.APIKey, req.Artifacts)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -1395,6 +1643,10 @@ func handleAgentSessions(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "missing id", http.StatusBadRequest)
 			return
 		}
+		if sessionMgr.getFor(r.Context(), id) == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
 		sessionMgr.stop(id)
 		w.WriteHeader(http.StatusOK)
 
@@ -1419,6 +1671,17 @@ func handleExternalSessionProxy(w http.ResponseWriter, r *http.Request, parts []
 	r.URL.Path = restPath
 	r.URL.RawPath = ""
 
+	if websocket.IsWebSocketUpgrade(r) {
+		if restPath == "/event" || restPath == "/global/event" {
+			serveSSEOverWebSocket(w, r, func(w http.ResponseWriter, r *http.Request) {
+				opencode_exposed.ProxySSE(w, r, server.Port)
+			})
+			return
+		}
+		proxyWebSocket(w, r, server.Port, restPath)
+		return
+	}
+
 	if strings.Contains(restPath, "/message") && r.Method == http.MethodGet {
 		opencode_exposed.ProxyMessages(w, r, server.Port)
 		return
@@ -1436,11 +1699,16 @@ func handleExternalSessionProxy(w http.ResponseWriter, r *http.Request, parts []
 
 // handleAgentSessionProxy proxies requests to the agent's opencode server.
 // URL format: /api/agents/sessions/{sessionID}/proxy/{rest...}
+// Both plain HTTP/SSE and WebSocket upgrades are supported.
 func handleAgentSessionProxy(w http.ResponseWriter, r *http.Request) {
 	// Parse path: /api/agents/sessions/{sessionID}/proxy/{rest}
 	const prefix = "/api/agents/sessions/"
 	path := strings.TrimPrefix(r.URL.Path, prefix)
 	parts := strings.SplitN(path, "/", 3)
+	if len(parts) == 2 && parts[1] == "review" {
+		handleSessionChangesReview(w, r, parts[0])
+		return
+	}
 	if len(parts) < 2 || parts[1] != "proxy" {
 		http.NotFound(w, r)
 		return
@@ -1450,11 +1718,16 @@ func handleAgentSessionProxy(w http.ResponseWriter, r *http.Request) {
 
 	// Handle external sessions (e.g., /api/agents/sessions/external/proxy/...)
 	if sessionID == "external" {
+		// the internal opencode server's sessions belong to no tenant
+		if tenant.Name(r.Context()) != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 		handleExternalSessionProxy(w, r, parts)
 		return
 	}
 
-	s := sessionMgr.get(sessionID)
+	s := sessionMgr.getFor(r.Context(), sessionID)
 	if s == nil {
 		http.Error(w, "session not found", http.StatusNotFound)
 		return
@@ -1485,9 +1758,28 @@ func handleAgentSessionProxy(w http.ResponseWriter, r *http.Request) {
 	r.URL.Path = restPath
 	r.URL.RawPath = ""
 
-	// If this session uses the cursor adapter, route to it
-	if s.cursorAdapter != nil {
-		s.cursorAdapter.ServeHTTP(w, r)
+	// WebSocket clients: event streams are bridged from SSE, anything else is
+	// relayed to the agent's own WebSocket endpoint.
+	if websocket.IsWebSocketUpgrade(r) {
+		isEvent := restPath == "/event" || restPath == "/global/event"
+		switch {
+		case isEvent && s.adapter != nil:
+			serveSSEOverWebSocket(w, r, s.adapter.ServeHTTP)
+		case isEvent:
+			serveSSEOverWebSocket(w, r, func(w http.ResponseWriter, r *http.Request) {
+				opencode_exposed.ProxySSE(w, r, s.port)
+			})
+		case s.adapter != nil:
+			http.Error(w, "websocket not supported for this endpoint", http.StatusBadRequest)
+		default:
+			proxyWebSocket(w, r, s.port, restPath)
+		}
+		return
+	}
+
+	// If this session uses an in-process adapter, route to it
+	if s.adapter != nil {
+		s.adapter.ServeHTTP(w, r)
 		return
 	}
 
@@ -1509,5 +1801,6 @@ func handleAgentSessionProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Prompt runs are tracked by watchPromptDone.
 	s.proxy.ServeHTTP(w, r)
 }
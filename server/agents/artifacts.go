@@ -0,0 +1,41 @@
+package agents
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// projectArtifactPaths returns the artifact paths declared by the project
+// registered for dir.
+func projectArtifactPaths(dir string) []string {
+	p, err := projects.FindByDir(dir)
+	if err != nil || p == nil {
+		return nil
+	}
+	return p.ArtifactPaths
+}
+
+// collectArtifacts copies the output files of the session's last run into
+// its artifact directory.
+func (s *agentSession) collectArtifacts() {
+	if s.artifacts == nil {
+		return
+	}
+	n, err := s.artifacts.Collect()
+	if err != nil {
+		log.Warnf("collect artifacts of %s: %v", s.id, err)
+	}
+	summary := s.artifacts.Summary()
+	s.mu.Lock()
+	s.artifactsSummary = &summary
+	s.mu.Unlock()
+	if n > 0 {
+		activity.Record(s.projectDir, activity.Event{
+			Kind:  activity.KindAgent,
+			Title: fmt.Sprintf("%s produced %d artifact(s)", s.agentName, n),
+			Ref:   s.artifacts.ID,
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/notifications"
+)
+
+// Auto-review statuses reported in AutoReviewResult.Status.
+const (
+	AutoReviewRunning = "running"
+	AutoReviewDone    = "done"
+	AutoReviewSkipped = "skipped"
+	AutoReviewError   = "error"
+)
+
+// autoReviewTimeout bounds a single post-run review so a hung AI call does
+// not leave the session stuck in "running".
+const autoReviewTimeout = 5 * time.Minute
+
+// AutoReviewResult is the review attached to an agent session after a run.
+type AutoReviewResult struct {
+	Status     string   `json:"status"` // "running", "done", "skipped", "error"
+	StartedAt  string   `json:"started_at"`
+	FinishedAt string   `json:"finished_at,omitempty"`
+	Files      int      `json:"files"`             // number of changed files reviewed
+	Findings   []string `json:"findings"`          // one entry per reported problem
+	Summary    string   `json:"summary,omitempty"` // raw AI output
+	Model      string   `json:"model,omitempty"`   // model used for the review
+	Error      string   `json:"error,omitempty"`
+}
+
+// AutoReviewer reviews the uncommitted changes in projectDir.
+// It is provided by the server package, which owns the review rules and AI config.
+// Implementations return a result with Status AutoReviewSkipped when there is
+// nothing to review or no AI provider is configured.
+type AutoReviewer func(ctx context.Context, projectDir string) (*AutoReviewResult, error)
+
+var (
+	autoReviewerMu sync.Mutex
+	autoReviewer   AutoReviewer
+)
+
+// SetAutoReviewer installs the reviewer run after each agent prompt completes.
+// Passing nil disables post-run reviews.
+func SetAutoReviewer(fn AutoReviewer) {
+	autoReviewerMu.Lock()
+	defer autoReviewerMu.Unlock()
+	autoReviewer = fn
+}
+
+func getAutoReviewer() AutoReviewer {
+	autoReviewerMu.Lock()
+	defer autoReviewerMu.Unlock()
+	return autoReviewer
+}
+
+// startAutoReview runs the reviewer over the session's project directory in
+// the background. A newer review supersedes one still in flight.
+func (s *agentSession) startAutoReview() bool {
+	reviewer := getAutoReviewer()
+	if reviewer == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	s.reviewGen++
+	gen := s.reviewGen
+	s.review = &AutoReviewResult{
+		Status:    AutoReviewRunning,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Findings:  []string{},
+	}
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autoReviewTimeout)
+		defer cancel()
+		if s.owner != "" {
+			// review with the rule packs of the member who launched the session
+			ctx = auth.WithIdentity(ctx, &auth.Identity{User: s.owner, Role: auth.RoleMember})
+		}
+
+		res, err := reviewer(ctx, s.projectDir)
+		if res == nil {
+			res = &AutoReviewResult{Findings: []string{}}
+		}
+		if err != nil {
+			res.Status = AutoReviewError
+			res.Error = err.Error()
+		} else if res.Status == "" {
+			res.Status = AutoReviewDone
+		}
+
+		s.mu.Lock()
+		if s.reviewGen != gen {
+			s.mu.Unlock()
+			return
+		}
+		res.StartedAt = s.review.StartedAt
+		res.FinishedAt = time.Now().Format(time.RFC3339)
+		s.review = res
+		s.mu.Unlock()
+
+		recordReviewActivity(s, res)
+	}()
+	return true
+}
+
+// recordReviewActivity adds a finished review to the project timeline
+// and notifies users about it.
+func recordReviewActivity(s *agentSession, res *AutoReviewResult) {
+	ev := activity.Event{
+		Kind: activity.KindReview,
+		Ref:  s.id,
+	}
+	switch res.Status {
+	case AutoReviewDone:
+		ev.Title = fmt.Sprintf("Review: %d finding(s) in %d file(s)", len(res.Findings), res.Files)
+		ev.Detail = strings.Join(res.Findings, "\n")
+		ev.Status = "ok"
+	case AutoReviewError:
+		ev.Title = "Review failed"
+		ev.Detail = res.Error
+		ev.Status = "error"
+	default:
+		return
+	}
+	activity.Record(s.projectDir, ev)
+	notifyReview(s, ev)
+}
+
+// notifyReview notifies users about a finished review recorded as ev.
+func notifyReview(s *agentSession, ev activity.Event) {
+	notifications.Notify(notifications.Notification{
+		Event:   notifications.EventReviewDone,
+		Title:   ev.Title,
+		Body:    ev.Detail,
+		Project: s.projectDir,
+		Urgent:  ev.Status == "error",
+	})
+}
+
+// handleAgentSessionReview returns (GET) or re-runs (POST) the post-run
+// review for a session: /api/agents/sessions/review?id=...
+func handleAgentSessionReview(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	s := sessionMgr.getFor(r.Context(), id)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !s.startAutoReview() {
+			http.Error(w, "auto review is not available", http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	review := s.reviewSnapshot()
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
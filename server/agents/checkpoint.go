@@ -0,0 +1,33 @@
+package agents
+
+import (
+	"path/filepath"
+
+	"github.com/xhd2015/ai-critic/server/checkpoint"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// SessionCheckpoint is the automatic checkpoint made before a session
+// started. Restoring it with all set undoes everything the session did.
+type SessionCheckpoint struct {
+	Project string `json:"project"`
+	ID      int    `json:"id"`
+}
+
+// checkpointBeforeSession checkpoints the working tree at dir for session
+// id, under the name of the project registered for dir. It returns nil if
+// automatic checkpoints are off or dir is not a git checkout.
+func checkpointBeforeSession(dir, id string) *SessionCheckpoint {
+	name := filepath.Base(dir)
+	if p, err := projects.FindByDir(dir); err == nil && p != nil {
+		name = p.Name
+	}
+	cp, err := checkpoint.CreateSessionCheckpoint(name, dir, id)
+	if err != nil {
+		log.Warnf("checkpoint before %s: %v", id, err)
+	}
+	if cp == nil {
+		return nil
+	}
+	return &SessionCheckpoint{Project: name, ID: cp.ID}
+}
@@ -0,0 +1,244 @@
+// Package claude provides a Go adapter for Claude Code's stream-json output,
+// exposing it through the same HTTP API as the cursor adapter so the
+// frontend's chat interface drives both.
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/agents/procadapter"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+	"github.com/xhd2015/ai-critic/server/settings"
+)
+
+// AdapterSettings holds configurable settings for the claude adapter.
+type AdapterSettings struct {
+	PromptAppendMessage   string `json:"prompt_append_message"`
+	FollowupAppendMessage string `json:"followup_append_message"`
+	// PermissionMode is passed to claude --permission-mode: "default",
+	// "acceptEdits", "plan" or "bypassPermissions". Empty means
+	// defaultPermissionMode. Tools that would ask for permission are denied,
+	// since nobody answers the prompt in print mode. Whatever the mode, Bash
+	// is disallowed while the exec policy could stop an agent command.
+	PermissionMode string `json:"permission_mode,omitempty"`
+}
+
+const settingsNamespace = "claude-code"
+
+// defaultPermissionMode lets Claude Code edit files in the project without
+// asking, like cursor-agent in print mode.
+const defaultPermissionMode = "acceptEdits"
+
+var permissionModes = []string{"default", "acceptEdits", "plan", "bypassPermissions"}
+
+// models are the aliases Claude Code resolves to the latest model of each
+// family; claude has no command listing them.
+var models = []procadapter.Model{
+	{ID: "sonnet", Name: "Claude Sonnet"},
+	{ID: "opus", Name: "Claude Opus"},
+	{ID: "haiku", Name: "Claude Haiku"},
+}
+
+// ChatSession is a chat session with Claude Code.
+type ChatSession = procadapter.Session
+
+// Adapter manages Claude Code chat sessions.
+type Adapter struct {
+	*procadapter.Adapter
+	projectDir string
+	cmdPath    string
+	apiKey     string // optional Anthropic API key
+	settings   *procadapter.Settings[AdapterSettings]
+}
+
+// NewAdapter creates a new claude adapter running the claude binary at
+// cmdPath in projectDir. The settingsStore persists adapter settings; the
+// apiKey is optional and passed to claude as ANTHROPIC_API_KEY if set.
+func NewAdapter(projectDir, cmdPath string, settingsStore *settings.Store, apiKey string) *Adapter {
+	a := &Adapter{
+		projectDir: projectDir,
+		cmdPath:    cmdPath,
+		apiKey:     apiKey,
+		settings:   procadapter.NewSettings(settingsStore, settingsNamespace, validateSettings),
+	}
+	a.Adapter = procadapter.New(procadapter.Agent{
+		Name:          "claude",
+		SessionPrefix: "claude",
+		Info: procadapter.Info{
+			Name:       "Claude Code",
+			Version:    "1.0.0",
+			ProviderID: "anthropic",
+			Capabilities: map[string]bool{
+				"chat":       true,
+				"streaming":  true,
+				"tool_calls": true,
+				"file_edit":  true,
+				"shell_exec": true,
+				"cancel":     false,
+			},
+		},
+		Command:       a.command,
+		ProcessStream: processStream,
+		PromptSuffix:  func() string { return a.settings.Get().PromptAppendMessage },
+		Settings:      a.settings,
+		Providers: func() procadapter.Provider {
+			return procadapter.Provider{
+				ID:      "anthropic",
+				Name:    "Anthropic",
+				Models:  models,
+				Context: 200000,
+				Output:  32000,
+			}
+		},
+	}, "")
+	return a
+}
+
+func validateSettings(s AdapterSettings) error {
+	return procadapter.OneOf("permission_mode", s.PermissionMode, permissionModes)
+}
+
+// command runs claude on the prompt, resuming the session's previous
+// conversation.
+func (a *Adapter) command(run procadapter.Run) (*exec.Cmd, error) {
+	permissionMode := defaultPermissionMode
+	if m := a.settings.Get().PermissionMode; m != "" {
+		permissionMode = m
+	}
+	// The prompt goes in on stdin, so one starting with "-" is not taken
+	// for a flag.
+	args := []string{"-p", "--output-format", "stream-json", "--verbose", "--permission-mode", permissionMode}
+	if run.Model != "" {
+		args = append(args, "--model", run.Model)
+	}
+	if run.ResumeID != "" {
+		args = append(args, "--resume", run.ResumeID)
+	}
+	if execpolicy.Restricts(execpolicy.SourceAgent) {
+		// claude cannot wait for the policy to answer
+		args = append(args, "--disallowedTools", "Bash")
+	}
+
+	cmd := exec.Command(a.cmdPath, args...)
+	cmd.Dir = a.projectDir
+	cmd.Stdin = strings.NewReader(run.Prompt)
+	if a.apiKey != "" {
+		cmd.Env = append(os.Environ(), "ANTHROPIC_API_KEY="+a.apiKey)
+	}
+	return cmd, nil
+}
+
+// processStream reads claude's stream-json output and converts events to
+// chat messages, attributing them to runModel until claude reports the model
+// it resolved. It reports whether the run ended with a result event.
+func processStream(s *ChatSession, r io.Reader, runModel string) bool {
+	scanner := bufio.NewScanner(r)
+	// Tool results can hold whole files
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var currentAssistant *ChatMessage
+	gotResult := false
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var event ClaudeEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+
+		// Every run gets a new session_id, which the next one resumes
+		if event.SessionID != "" {
+			s.SetResumeID(event.SessionID)
+		}
+
+		switch event.Type {
+		case "system":
+			if event.Model != "" {
+				runModel = event.Model
+			}
+
+		case "assistant":
+			if event.Message == nil {
+				continue
+			}
+			for _, b := range event.Message.Content {
+				switch b.Type {
+				case "text":
+					if b.Text != "" {
+						currentAssistant = s.AppendText(currentAssistant, "text/plain", b.Text, runModel)
+					}
+				case "thinking":
+					if b.Thinking != "" {
+						currentAssistant = s.AppendText(currentAssistant, "text/thinking", b.Thinking, runModel)
+					}
+				case "tool_use":
+					currentAssistant = appendToolCall(s, currentAssistant, b, runModel)
+				}
+			}
+
+		case "user":
+			// Claude Code reports tool results as user messages
+			if event.Message == nil {
+				continue
+			}
+			for _, b := range event.Message.Content {
+				if b.Type == "tool_result" {
+					completeToolCall(s, b)
+				}
+			}
+
+		case "result":
+			gotResult = true
+			if event.IsError && currentAssistant == nil {
+				text := event.Result
+				if text == "" {
+					text = "claude failed: " + event.Subtype
+				}
+				currentAssistant = s.AppendText(nil, "text/plain", text, runModel)
+			}
+			s.Complete(currentAssistant, event.Usage.Normalize())
+			currentAssistant = nil
+		}
+	}
+	return gotResult
+}
+
+// appendToolCall adds a running tool/call part for a tool_use block.
+func appendToolCall(s *ChatSession, current *ChatMessage, b ClaudeContentBlock, model string) *ChatMessage {
+	metadata := toolUseMetadata(b.Name, b.Input)
+	metadata["status"] = "running"
+	metadata["call_id"] = b.ID
+	part := MessagePart{
+		ID:          "tool-" + b.ID,
+		ContentType: "tool/call",
+		Content:     string(b.Input),
+		Name:        b.Name,
+		Metadata:    metadata,
+	}
+	return s.AppendPart(current, part, model, false)
+}
+
+// completeToolCall records a tool_result on the tool/call part it answers.
+func completeToolCall(s *ChatSession, b ClaudeContentBlock) {
+	meta := map[string]interface{}{"status": "completed"}
+	if b.IsError {
+		meta["status"] = "error"
+	}
+	output := b.resultText()
+	if len(output) > 200 {
+		output = output[:200] + "..."
+	}
+	if output != "" {
+		meta["output"] = output
+	}
+	s.UpdateToolCall(b.ToolUseID, meta)
+}
@@ -0,0 +1,112 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+const stream = `{"type":"system","subtype":"init","session_id":"s-1","model":"claude-sonnet-4-5"}
+{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"thinking","thinking":"Let me look."},{"type":"text","text":"Checking the tests."}]},"session_id":"s-1"}
+{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go test ./..."}}]},"session_id":"s-1"}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"ok"}]}]},"session_id":"s-1"}
+{"type":"assistant","message":{"id":"m2","role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"Edit","input":{"file_path":"a.go","old_string":"x","new_string":"y"}}]},"session_id":"s-1"}
+{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_2","content":"no such file","is_error":true}]},"session_id":"s-1"}
+{"type":"assistant","message":{"id":"m3","role":"assistant","content":[{"type":"text","text":"All tests pass."}]},"session_id":"s-1"}
+{"type":"result","subtype":"success","is_error":false,"result":"All tests pass.","session_id":"s-1","usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":100}}
+`
+
+func TestProcessStream(t *testing.T) {
+	a := NewAdapter(t.TempDir(), "claude", nil, "")
+	s := a.CreateSession()
+	if !processStream(s, strings.NewReader(stream), "") {
+		t.Fatal("no result")
+	}
+	if s.ResumeID != "s-1" {
+		t.Errorf("resume id %q", s.ResumeID)
+	}
+
+	msgs := s.GetMessages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1: %+v", len(msgs), msgs)
+	}
+	m := msgs[0]
+	if m.Role != "agent" || m.Model != "claude-sonnet-4-5" {
+		t.Errorf("message %+v", m)
+	}
+	if m.Usage == nil || m.Usage.TotalTokens != 15 || m.Usage.CacheReadTokens != 100 {
+		t.Errorf("usage %+v", m.Usage)
+	}
+	var kinds []string
+	for _, p := range m.Parts {
+		kinds = append(kinds, p.ContentType)
+	}
+	want := "text/thinking,text/plain,tool/call,tool/call,text/plain"
+	if got := strings.Join(kinds, ","); got != want {
+		t.Fatalf("parts %s, want %s", got, want)
+	}
+
+	bash, edit := m.Parts[2].Metadata, m.Parts[3].Metadata
+	if bash["kind"] != cursor.ToolKindShell || bash["command"] != "go test ./..." || bash["status"] != "completed" || bash["output"] != "ok" {
+		t.Errorf("bash metadata %v", bash)
+	}
+	if edit["kind"] != cursor.ToolKindFileEdit || edit["file"] != "a.go" || edit["new_string"] != "y" || edit["status"] != "error" {
+		t.Errorf("edit metadata %v", edit)
+	}
+}
+
+func TestSendPrompt(t *testing.T) {
+	dir := t.TempDir()
+	// The fake claude echoes its arguments and stdin back as the answer.
+	script := `#!/bin/sh
+prompt=$(cat)
+echo '{"type":"system","subtype":"init","session_id":"s-2"}'
+printf '{"type":"assistant","message":{"content":[{"type":"text","text":"%s|%s"}]}}\n' "$*" "$prompt"
+echo '{"type":"result","subtype":"success","session_id":"s-2"}'
+`
+	bin := filepath.Join(dir, "claude")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAdapter(dir, bin, nil, "")
+	a.SetModel("opus")
+	done := make(chan string, 1)
+	a.SetPromptDoneHook(func(id string) { done <- id })
+	s := a.CreateSession()
+
+	if err := s.SendPrompt("-fix it"); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-done; id != s.ID {
+		t.Errorf("done hook got %q", id)
+	}
+	if err := s.SendPrompt("again"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := s.GetMessages()
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4", len(msgs))
+	}
+	first, second := msgs[1].Parts[0].Content, msgs[3].Parts[0].Content
+	if first != "-p --output-format stream-json --verbose --permission-mode acceptEdits --model opus|-fix it" {
+		t.Errorf("first run %q", first)
+	}
+	if !strings.HasSuffix(second, "--model opus --resume s-2|again") {
+		t.Errorf("second run %q", second)
+	}
+}
+
+func TestSetSettingsRejectsUnknownPermissionMode(t *testing.T) {
+	a := NewAdapter(t.TempDir(), "claude", nil, "")
+	if err := a.settings.Set(AdapterSettings{PermissionMode: "yolo"}); err == nil {
+		t.Error("accepted an unknown permission mode")
+	}
+	if err := a.settings.Set(AdapterSettings{PermissionMode: "plan"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,65 @@
+package claude
+
+import (
+	"encoding/json"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// maxPreviewBytes caps file contents and tool output copied into tool call
+// metadata.
+const maxPreviewBytes = 32 * 1024
+
+// toolKind maps a Claude Code tool to the kind the frontend renders it as.
+func toolKind(name string) string {
+	switch name {
+	case "Edit", "MultiEdit", "Write", "NotebookEdit":
+		return cursor.ToolKindFileEdit
+	case "Bash":
+		return cursor.ToolKindShell
+	case "Read", "LS", "NotebookRead":
+		return cursor.ToolKindRead
+	case "Grep", "Glob":
+		return cursor.ToolKindSearch
+	default:
+		return cursor.ToolKindOther
+	}
+}
+
+// toolUseMetadata extracts the structured fields (file path, command, edit
+// preview) of a tool_use block.
+func toolUseMetadata(name string, input json.RawMessage) map[string]interface{} {
+	meta := map[string]interface{}{"kind": toolKind(name)}
+	var in toolInput
+	if json.Unmarshal(input, &in) != nil {
+		return meta
+	}
+	switch name {
+	case "Bash":
+		meta["command"] = in.Command
+	case "Read", "Edit", "MultiEdit", "NotebookEdit":
+		meta["file"] = in.FilePath
+	case "Write":
+		meta["file"] = in.FilePath
+		meta["new_string"] = truncatePreview(in.Content)
+	case "Grep", "Glob", "LS":
+		if in.Pattern != "" {
+			meta["pattern"] = in.Pattern
+		}
+		if in.Path != "" {
+			meta["file"] = in.Path
+		}
+	}
+	if name == "Edit" && (in.OldString != "" || in.NewString != "") {
+		meta["old_string"] = truncatePreview(in.OldString)
+		meta["new_string"] = truncatePreview(in.NewString)
+	}
+	return meta
+}
+
+func truncatePreview(s string) string {
+	if len(s) > maxPreviewBytes {
+		return s[:maxPreviewBytes] + "\n... (truncated)"
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+package claude
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// The chat protocol is the one the cursor adapter speaks, so the frontend
+// renders both agents with the same components.
+type (
+	ChatMessage = cursor.ChatMessage
+	MessagePart = cursor.MessagePart
+	ACPEvent    = cursor.ACPEvent
+	TokenUsage  = cursor.TokenUsage
+)
+
+// ClaudeEvent is one line of `claude -p --output-format stream-json --verbose`.
+type ClaudeEvent struct {
+	Type      string `json:"type"`    // "system", "assistant", "user", "result"
+	Subtype   string `json:"subtype"` // "init" for system; "success", "error_max_turns", ... for result
+	SessionID string `json:"session_id"`
+	// For "system" init events
+	Model string `json:"model"`
+	// For "assistant" and "user" events
+	Message *ClaudeMessage `json:"message"`
+	// For "result" events
+	Result     string       `json:"result"`
+	IsError    bool         `json:"is_error"`
+	DurationMs int          `json:"duration_ms"`
+	Usage      *ClaudeUsage `json:"usage"`
+}
+
+// ClaudeMessage is an Anthropic API message as Claude Code echoes it.
+type ClaudeMessage struct {
+	ID      string               `json:"id"`
+	Role    string               `json:"role"`
+	Model   string               `json:"model"`
+	Content []ClaudeContentBlock `json:"content"`
+}
+
+// ClaudeContentBlock is a content block of a message.
+type ClaudeContentBlock struct {
+	Type string `json:"type"` // "text", "thinking", "tool_use", "tool_result"
+	Text string `json:"text"`
+	// For "thinking" blocks
+	Thinking string `json:"thinking"`
+	// For "tool_use" blocks
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+	// For "tool_result" blocks; Content is a string or a list of text blocks
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// ClaudeUsage is the token usage reported on "result" events.
+type ClaudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+// Normalize converts the raw usage into TokenUsage, or nil if empty.
+func (u *ClaudeUsage) Normalize() *TokenUsage {
+	if u == nil {
+		return nil
+	}
+	t := &TokenUsage{
+		InputTokens:     u.InputTokens + u.CacheCreationInputTokens,
+		OutputTokens:    u.OutputTokens,
+		CacheReadTokens: u.CacheReadInputTokens,
+	}
+	t.TotalTokens = t.InputTokens + t.OutputTokens
+	if t.TotalTokens == 0 && t.CacheReadTokens == 0 {
+		return nil
+	}
+	return t
+}
+
+// resultText returns the text of a tool_result block's content.
+func (b *ClaudeContentBlock) resultText() string {
+	if len(b.Content) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(b.Content, &s) == nil {
+		return s
+	}
+	var blocks []ClaudeContentBlock
+	if json.Unmarshal(b.Content, &blocks) != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, c := range blocks {
+		if c.Type == "text" {
+			sb.WriteString(c.Text)
+		}
+	}
+	return sb.String()
+}
+
+// toolInput holds the input fields of Claude Code's built-in tools that the
+// chat shows.
+type toolInput struct {
+	Command   string `json:"command"`    // Bash
+	FilePath  string `json:"file_path"`  // Read, Write, Edit, MultiEdit
+	Path      string `json:"path"`       // Grep, Glob, LS
+	Pattern   string `json:"pattern"`    // Grep, Glob
+	OldString string `json:"old_string"` // Edit
+	NewString string `json:"new_string"` // Edit
+	Content   string `json:"content"`    // Write
+}
@@ -0,0 +1,281 @@
+// Package codex provides a Go adapter for the JSON event stream of
+// `codex exec`, exposing it through the same HTTP API as the cursor adapter
+// so the frontend's chat interface drives both.
+package codex
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+	"github.com/xhd2015/ai-critic/server/agents/procadapter"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+	"github.com/xhd2015/ai-critic/server/settings"
+)
+
+// AdapterSettings holds configurable settings for the codex adapter.
+type AdapterSettings struct {
+	PromptAppendMessage   string `json:"prompt_append_message"`
+	FollowupAppendMessage string `json:"followup_append_message"`
+	// Sandbox is the codex sandbox mode: "read-only", "workspace-write" or
+	// "danger-full-access". Empty means defaultSandbox. codex exec never
+	// asks for approval, so commands the sandbox blocks fail. While the exec
+	// policy could stop an agent command the sandbox is read-only, whatever
+	// is set here.
+	Sandbox string `json:"sandbox,omitempty"`
+	// ReasoningEffort overrides model_reasoning_effort of the codex config.
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+}
+
+const settingsNamespace = "codex"
+
+// defaultSandbox lets Codex edit files in the project, but not outside it.
+const defaultSandbox = "workspace-write"
+
+var sandboxModes = []string{"read-only", "workspace-write", "danger-full-access"}
+
+// ChatSession is a chat session with Codex.
+type ChatSession = procadapter.Session
+
+// Adapter manages Codex chat sessions.
+type Adapter struct {
+	*procadapter.Adapter
+	projectDir string
+	cmdPath    string
+	apiKey     string // optional OpenAI API key
+	settings   *procadapter.Settings[AdapterSettings]
+}
+
+// NewAdapter creates a new codex adapter running the codex binary at
+// cmdPath in projectDir. The settingsStore persists adapter settings; the
+// apiKey is optional and passed to codex as CODEX_API_KEY if set.
+func NewAdapter(projectDir, cmdPath string, settingsStore *settings.Store, apiKey string) *Adapter {
+	a := &Adapter{
+		projectDir: projectDir,
+		cmdPath:    cmdPath,
+		apiKey:     apiKey,
+		settings:   procadapter.NewSettings(settingsStore, settingsNamespace, validateSettings),
+	}
+	a.Adapter = procadapter.New(procadapter.Agent{
+		Name:          "codex",
+		SessionPrefix: "codex",
+		Info: procadapter.Info{
+			Name:       "Codex",
+			Version:    "1.0.0",
+			ProviderID: "openai",
+			Capabilities: map[string]bool{
+				"chat":       true,
+				"streaming":  true,
+				"tool_calls": true,
+				"file_edit":  true,
+				"shell_exec": true,
+				"cancel":     false,
+			},
+		},
+		Command:       a.command,
+		ProcessStream: processStream,
+		PromptSuffix:  func() string { return a.settings.Get().PromptAppendMessage },
+		Settings:      a.settings,
+		Providers:     a.providers,
+	}, "")
+	return a
+}
+
+func validateSettings(s AdapterSettings) error {
+	return procadapter.OneOf("sandbox", s.Sandbox, sandboxModes)
+}
+
+// command runs codex on the prompt, resuming the session's previous
+// conversation.
+func (a *Adapter) command(run procadapter.Run) (*exec.Cmd, error) {
+	restricted := execpolicy.Restricts(execpolicy.SourceAgent)
+	cmd := exec.Command(a.cmdPath, execArgs(a.settings.Get(), run.Model, run.ResumeID, restricted)...)
+	cmd.Dir = a.projectDir
+	cmd.Stdin = strings.NewReader(run.Prompt)
+	cmd.Env = tool_resolve.AppendExtraPaths(os.Environ())
+	if a.apiKey != "" {
+		cmd.Env = append(cmd.Env, "CODEX_API_KEY="+a.apiKey)
+	}
+	return cmd, nil
+}
+
+// execArgs builds the arguments of `codex exec` for a prompt read from
+// stdin, resuming thread resumeID if it is set. The sandbox is set through
+// a config override, which `exec resume` accepts as well; restricted forces
+// it read-only, as codex runs its commands without asking.
+func execArgs(settings AdapterSettings, model, resumeID string, restricted bool) []string {
+	args := []string{"exec"}
+	if resumeID != "" {
+		args = append(args, "resume")
+	}
+	args = append(args, "--json", "--skip-git-repo-check")
+	sandbox := settings.Sandbox
+	if sandbox == "" {
+		sandbox = defaultSandbox
+	}
+	if restricted {
+		sandbox = "read-only"
+	}
+	if sandbox == "danger-full-access" {
+		args = append(args, "--dangerously-bypass-approvals-and-sandbox")
+	} else {
+		args = append(args, "-c", fmt.Sprintf("sandbox_mode=%q", sandbox))
+	}
+	if model != "" {
+		args = append(args, "--model", model)
+	}
+	if settings.ReasoningEffort != "" {
+		args = append(args, "-c", fmt.Sprintf("model_reasoning_effort=%q", settings.ReasoningEffort))
+	}
+	if resumeID != "" {
+		args = append(args, resumeID)
+	}
+	return append(args, "-")
+}
+
+// processStream reads the events of codex exec --json and converts them to
+// chat messages of runModel. It reports whether the turn ended, completed or
+// failed.
+func processStream(s *ChatSession, r io.Reader, runModel string) bool {
+	scanner := bufio.NewScanner(r)
+	// Command output can be large
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var currentAssistant *ChatMessage
+	turnEnded := false
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var event CodexEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "thread.started":
+			if event.ThreadID != "" {
+				s.SetResumeID(event.ThreadID)
+			}
+
+		case "item.started", "item.updated", "item.completed":
+			if event.Item == nil {
+				continue
+			}
+			item := *event.Item
+			if event.Type == "item.completed" && item.Status == "" {
+				item.Status = "completed"
+			}
+			currentAssistant = handleItem(s, currentAssistant, &item, event.Type == "item.completed", runModel)
+
+		case "error":
+			// transient errors, such as reconnecting to the API
+			if event.Message != "" {
+				currentAssistant = s.AppendPart(currentAssistant, MessagePart{ContentType: "text/plain", Content: event.Message}, runModel, false)
+			}
+
+		case "turn.completed", "turn.failed":
+			turnEnded = true
+			if event.Error != nil && event.Error.Message != "" {
+				currentAssistant = s.AppendText(currentAssistant, "text/plain", "Turn failed: "+event.Error.Message, runModel)
+			}
+			s.Complete(currentAssistant, event.Usage.Normalize())
+			currentAssistant = nil
+		}
+	}
+	return turnEnded
+}
+
+// handleItem records an item event: text once the item completes, tool
+// calls as they start and progress. It returns the current message.
+func handleItem(s *ChatSession, current *ChatMessage, item *CodexItem, completed bool, model string) *ChatMessage {
+	switch item.Type {
+	case "agent_message":
+		if completed && item.Text != "" {
+			return s.AppendText(current, "text/plain", item.Text, model)
+		}
+		return current
+	case "reasoning":
+		if completed && item.Text != "" {
+			return s.AppendText(current, "text/thinking", item.Text, model)
+		}
+		return current
+	case "error":
+		if text := item.Message + item.Text; text != "" {
+			return s.AppendText(current, "text/plain", "Error: "+text, model)
+		}
+		return current
+	}
+	name, args, meta, ok := toolCall(item)
+	if !ok {
+		return current
+	}
+	if s.UpdateToolCall(item.ID, meta) {
+		return current
+	}
+	part := MessagePart{
+		ID:          "tool-" + item.ID,
+		ContentType: "tool/call",
+		Content:     args,
+		Name:        name,
+		Metadata:    meta,
+	}
+	return s.AppendPart(current, part, model, false)
+}
+
+// listModels runs `codex debug models` and returns the listed models.
+func (a *Adapter) listModels() ([]procadapter.Model, error) {
+	cmd := exec.Command(a.cmdPath, "debug", "models")
+	cmd.Env = tool_resolve.AppendExtraPaths(os.Environ())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("list models: %w", err)
+	}
+	var catalog struct {
+		Models []struct {
+			Slug        string `json:"slug"`
+			DisplayName string `json:"display_name"`
+			Visibility  string `json:"visibility"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(out, &catalog); err != nil {
+		return nil, fmt.Errorf("parse models: %w", err)
+	}
+	var models []procadapter.Model
+	for _, m := range catalog.Models {
+		if m.Slug == "" || (m.Visibility != "" && m.Visibility != "list") {
+			continue
+		}
+		name := m.DisplayName
+		if name == "" {
+			name = m.Slug
+		}
+		models = append(models, procadapter.Model{ID: m.Slug, Name: name})
+	}
+	return models, nil
+}
+
+// providers lists the models of `codex debug models`, or the default of the
+// codex config if there are none.
+func (a *Adapter) providers() procadapter.Provider {
+	models, err := a.listModels()
+	if err != nil || len(models) == 0 {
+		// codex picks the model of its config
+		models = []procadapter.Model{{ID: "", Name: "Default"}}
+	}
+	return procadapter.Provider{
+		ID:      "openai",
+		Name:    "OpenAI",
+		Models:  models,
+		Context: 272000,
+		Output:  128000,
+	}
+}
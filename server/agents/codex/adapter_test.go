@@ -0,0 +1,123 @@
+package codex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+const stream = `{"type":"thread.started","thread_id":"0199a213-81c0-7800-8aa1-bbab2a035a53"}
+{"type":"turn.started"}
+{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"**Running the tests**"}}
+{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"bash -lc 'go test ./...'","aggregated_output":"","exit_code":null,"status":"in_progress"}}
+{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"bash -lc 'go test ./...'","aggregated_output":"FAIL\n","exit_code":1,"status":"completed"}}
+{"type":"item.completed","item":{"id":"item_2","type":"file_change","changes":[{"path":"a.go","kind":"update"}],"status":"completed"}}
+{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"Fixed the failing test."}}
+{"type":"turn.completed","usage":{"input_tokens":1000,"cached_input_tokens":800,"output_tokens":50}}
+`
+
+func TestProcessStream(t *testing.T) {
+	a := NewAdapter(t.TempDir(), "codex", nil, "")
+	s := a.CreateSession()
+	if !processStream(s, strings.NewReader(stream), "gpt-5-codex") {
+		t.Fatal("turn did not end")
+	}
+	if s.ResumeID != "0199a213-81c0-7800-8aa1-bbab2a035a53" {
+		t.Errorf("resume id %q", s.ResumeID)
+	}
+
+	msgs := s.GetMessages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1: %+v", len(msgs), msgs)
+	}
+	m := msgs[0]
+	if m.Model != "gpt-5-codex" {
+		t.Errorf("model %q", m.Model)
+	}
+	if m.Usage == nil || m.Usage.InputTokens != 200 || m.Usage.CacheReadTokens != 800 || m.Usage.TotalTokens != 250 {
+		t.Errorf("usage %+v", m.Usage)
+	}
+	var kinds []string
+	for _, p := range m.Parts {
+		kinds = append(kinds, p.ContentType)
+	}
+	want := "text/thinking,tool/call,tool/call,text/plain"
+	if got := strings.Join(kinds, ","); got != want {
+		t.Fatalf("parts %s, want %s", got, want)
+	}
+
+	shell, edit := m.Parts[1].Metadata, m.Parts[2].Metadata
+	if shell["kind"] != cursor.ToolKindShell || shell["status"] != "error" || shell["exit_code"] != 1 || shell["output"] != "FAIL\n" {
+		t.Errorf("shell metadata %v", shell)
+	}
+	if edit["kind"] != cursor.ToolKindFileEdit || edit["file"] != "a.go" || edit["status"] != "completed" {
+		t.Errorf("edit metadata %v", edit)
+	}
+}
+
+func TestProcessStreamTurnFailed(t *testing.T) {
+	a := NewAdapter(t.TempDir(), "codex", nil, "")
+	s := a.CreateSession()
+	processStream(s, strings.NewReader(`{"type":"turn.failed","error":{"message":"quota exceeded"}}`+"\n"), "")
+	msgs := s.GetMessages()
+	if len(msgs) != 1 || !strings.Contains(msgs[0].Parts[0].Content, "quota exceeded") {
+		t.Errorf("messages %+v", msgs)
+	}
+}
+
+func TestExecArgs(t *testing.T) {
+	tests := []struct {
+		settings   AdapterSettings
+		model      string
+		resume     string
+		restricted bool
+		want       string
+	}{
+		{AdapterSettings{}, "", "", false, `exec --json --skip-git-repo-check -c sandbox_mode="workspace-write" -`},
+		{AdapterSettings{Sandbox: "danger-full-access", ReasoningEffort: "high"}, "gpt-5", "t-1", false,
+			`exec resume --json --skip-git-repo-check --dangerously-bypass-approvals-and-sandbox --model gpt-5 -c model_reasoning_effort="high" t-1 -`},
+		{AdapterSettings{Sandbox: "danger-full-access"}, "", "", true, `exec --json --skip-git-repo-check -c sandbox_mode="read-only" -`},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(execArgs(tt.settings, tt.model, tt.resume, tt.restricted), " "); got != tt.want {
+			t.Errorf("execArgs = %s\nwant %s", got, tt.want)
+		}
+	}
+}
+
+func TestSendPrompt(t *testing.T) {
+	dir := t.TempDir()
+	// The fake codex echoes the prompt back as the answer.
+	script := `#!/bin/sh
+prompt=$(cat)
+echo '{"type":"thread.started","thread_id":"t-2"}'
+printf '{"type":"item.completed","item":{"id":"item_0","type":"agent_message","text":"%s"}}\n' "$prompt"
+echo '{"type":"turn.completed","usage":{"input_tokens":1,"output_tokens":1}}'
+`
+	bin := filepath.Join(dir, "codex")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAdapter(dir, bin, nil, "")
+	s := a.CreateSession()
+	if err := s.SendPrompt("hello"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := s.GetMessages()
+	if len(msgs) != 2 || msgs[1].Parts[0].Content != "hello" || s.ResumeID != "t-2" {
+		t.Errorf("messages %+v, resume %q", msgs, s.ResumeID)
+	}
+
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho 'not logged in' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s.SendPrompt("again")
+	msgs = s.GetMessages()
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Parts[0].Content, "not logged in") {
+		t.Errorf("failed run reported %+v", last)
+	}
+}
@@ -0,0 +1,74 @@
+package codex
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// maxOutputBytes caps the command output copied into tool call metadata.
+const maxOutputBytes = 200
+
+// toolCall describes a tool item as a tool/call part: its name, arguments
+// and metadata. ok is false for items that are not tool calls.
+func toolCall(item *CodexItem) (name, args string, meta map[string]interface{}, ok bool) {
+	meta = map[string]interface{}{}
+	switch item.Type {
+	case "command_execution":
+		name, args = "shell", item.Command
+		meta["kind"] = cursor.ToolKindShell
+		meta["command"] = item.Command
+		if item.ExitCode != nil {
+			meta["exit_code"] = *item.ExitCode
+		}
+		if out := item.AggregatedOutput; out != "" && item.Status != "in_progress" {
+			if len(out) > maxOutputBytes {
+				out = out[:maxOutputBytes] + "..."
+			}
+			meta["output"] = out
+		}
+	case "file_change":
+		name = "edit_file"
+		meta["kind"] = cursor.ToolKindFileEdit
+		paths := make([]string, 0, len(item.Changes))
+		for _, c := range item.Changes {
+			paths = append(paths, c.Path)
+		}
+		if len(paths) > 0 {
+			meta["file"] = paths[0]
+		}
+		args = strings.Join(paths, "\n")
+	case "mcp_tool_call":
+		name = item.Server + "." + item.Tool
+		meta["kind"] = cursor.ToolKindOther
+	case "web_search":
+		name, args = "web_search", item.Query
+		meta["kind"] = cursor.ToolKindSearch
+	case "todo_list":
+		name = "todo"
+		meta["kind"] = cursor.ToolKindOther
+		data, _ := json.Marshal(item.Items)
+		args = string(data)
+	default:
+		return "", "", nil, false
+	}
+	meta["call_id"] = item.ID
+	meta["status"] = toolStatus(item)
+	return name, args, meta, true
+}
+
+// toolStatus maps an item's status to the part status the frontend shows.
+func toolStatus(item *CodexItem) string {
+	switch item.Status {
+	case "", "in_progress":
+		return "running"
+	case "completed":
+		if item.ExitCode != nil && *item.ExitCode != 0 {
+			return "error"
+		}
+		return "completed"
+	default: // "failed", "declined"
+		return "error"
+	}
+}
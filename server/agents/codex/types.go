@@ -0,0 +1,98 @@
+package codex
+
+import (
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// The chat protocol is the one the cursor adapter speaks, so the frontend
+// renders both agents with the same components.
+type (
+	ChatMessage = cursor.ChatMessage
+	MessagePart = cursor.MessagePart
+	ACPEvent    = cursor.ACPEvent
+	TokenUsage  = cursor.TokenUsage
+)
+
+// CodexEvent is one line of `codex exec --json`.
+type CodexEvent struct {
+	// "thread.started", "turn.started", "turn.completed", "turn.failed",
+	// "item.started", "item.updated", "item.completed", "error"
+	Type string `json:"type"`
+	// For "thread.started" events
+	ThreadID string `json:"thread_id"`
+	// For "item.*" events
+	Item *CodexItem `json:"item"`
+	// For "turn.completed" events
+	Usage *CodexUsage `json:"usage"`
+	// For "turn.failed" events
+	Error *CodexError `json:"error"`
+	// For "error" events
+	Message string `json:"message"`
+}
+
+// CodexItem is a thread item: a message, a reasoning summary or a tool call.
+type CodexItem struct {
+	ID string `json:"id"`
+	// "agent_message", "reasoning", "command_execution", "file_change",
+	// "mcp_tool_call", "web_search", "todo_list", "error"
+	Type   string `json:"type"`
+	Status string `json:"status"` // "in_progress", "completed", "failed", "declined"
+	// For agent_message, reasoning and error items
+	Text    string `json:"text"`
+	Message string `json:"message"`
+	// For command_execution items
+	Command          string `json:"command"`
+	AggregatedOutput string `json:"aggregated_output"`
+	ExitCode         *int   `json:"exit_code"`
+	// For file_change items
+	Changes []CodexFileChange `json:"changes"`
+	// For mcp_tool_call items
+	Server string `json:"server"`
+	Tool   string `json:"tool"`
+	// For web_search items
+	Query string `json:"query"`
+	// For todo_list items
+	Items []CodexTodo `json:"items"`
+}
+
+// CodexFileChange is a file a file_change item touched.
+type CodexFileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"` // "add", "delete", "update"
+}
+
+// CodexTodo is an entry of the agent's plan.
+type CodexTodo struct {
+	Text      string `json:"text"`
+	Completed bool   `json:"completed"`
+}
+
+// CodexUsage is the token usage of a turn.
+type CodexUsage struct {
+	InputTokens       int `json:"input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+// CodexError is why a turn failed.
+type CodexError struct {
+	Message string `json:"message"`
+}
+
+// Normalize converts the raw usage into TokenUsage, or nil if empty. Codex
+// counts cached tokens as part of the input.
+func (u *CodexUsage) Normalize() *TokenUsage {
+	if u == nil {
+		return nil
+	}
+	t := &TokenUsage{
+		InputTokens:     u.InputTokens - u.CachedInputTokens,
+		OutputTokens:    u.OutputTokens,
+		CacheReadTokens: u.CachedInputTokens,
+	}
+	t.TotalTokens = t.InputTokens + t.OutputTokens
+	if t.TotalTokens == 0 && t.CacheReadTokens == 0 {
+		return nil
+	}
+	return t
+}
@@ -13,11 +13,12 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 var codexWSUpgrader = websocket.Upgrader{
@@ -688,7 +689,7 @@ func (r *codexActiveRun) runCodex(ctx context.Context, cmdPath, projectDir, prom
 	cmd := exec.CommandContext(ctx, cmdPath, args...)
 	cmd.Dir = projectDir
 	cmd.Env = tool_resolve.AppendExtraPaths(append(os.Environ(), "TERM=xterm-256color"))
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = procctl.GroupAttr()
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -1012,7 +1013,7 @@ func (r *codexActiveRun) cancelRun() {
 	}
 	if cmd != nil && cmd.Process != nil {
 		if cmd.Process.Pid > 0 {
-			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			_ = procctl.KillGroup(cmd.Process.Pid)
 		}
 		_ = cmd.Process.Kill()
 	}
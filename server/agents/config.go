@@ -19,6 +19,8 @@ type AgentConfig struct {
 type AgentsConfig struct {
 	// Agents maps agent ID to its config
 	Agents map[string]AgentConfig `json:"agents"`
+	// Limits bound every process-backed agent session; nil means none.
+	Limits *ResourceLimits `json:"limits,omitempty"`
 }
 
 var (
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+	"github.com/xhd2015/ai-critic/server/auth"
 	"github.com/xhd2015/ai-critic/server/settings"
 )
 
@@ -27,6 +28,7 @@ type ChatMessage struct {
 	Parts []MessagePart `json:"parts"`
 	Time  int64         `json:"time,omitempty"`  // Unix timestamp in seconds
 	Model string        `json:"model,omitempty"` // Model ID (agent messages only)
+	Usage *TokenUsage   `json:"usage,omitempty"` // Token usage for the run (agent messages only)
 }
 
 // MessagePart follows ACP message part format.
@@ -57,12 +59,21 @@ type ChatSession struct {
 	subscribers map[chan SSEEvent]struct{}
 	// Track if a prompt is currently running
 	busy bool
+
+	// ApprovalMode holds proposed file writes and shell commands as pending
+	// actions until they are approved via the approvals API.
+	ApprovalMode bool `json:"approval_mode"`
+	approvals    []*PendingAction
+	approvalSeq  int
+	shadow       map[string]*shadowFile     // files touched by the running prompt, by absolute path
+	inflight     map[string]json.RawMessage // started file edit tool calls, by call key
 }
 
 // ACPEvent is a standard ACP SSE event sent to subscribers.
 type ACPEvent struct {
-	Type    string      `json:"type"` // "acp.message.created", "acp.message.updated", "acp.message.completed"
-	Message ChatMessage `json:"message"`
+	Type     string         `json:"type"` // "acp.message.created", "acp.message.updated", "acp.message.completed", "acp.approval.*"
+	Message  ChatMessage    `json:"message"`
+	Approval *PendingAction `json:"approval,omitempty"` // For acp.approval.* events
 }
 
 // ACP event type constants.
@@ -103,6 +114,9 @@ type Adapter struct {
 	settings      AdapterSettings
 	settingsStore *settings.Store
 	globalSubs    map[chan SSEEvent]struct{}
+
+	// onPromptDone is called after a prompt's cursor-agent process exits.
+	onPromptDone func(sessionID string)
 }
 
 // NewAdapter creates a new cursor adapter for the given project directory.
@@ -132,6 +146,14 @@ func NewAdapter(projectDir string, settingsStore *settings.Store, apiKey string)
 	return a, nil
 }
 
+// SetPromptDoneHook registers fn to be called (in the prompt's goroutine)
+// each time a session finishes processing a prompt.
+func (a *Adapter) SetPromptDoneHook(fn func(sessionID string)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onPromptDone = fn
+}
+
 // listModels runs `cursor-agent models` and parses the output.
 func (a *Adapter) listModels() ([]CursorModel, error) {
 	cmd := exec.Command(a.cmdPath, "models")
@@ -336,6 +358,9 @@ func (a *Adapter) ListSessions(page, pageSize int) *PaginatedResponse {
 func (a *Adapter) DeleteSession(id string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	if s := a.sessions[id]; s != nil {
+		os.RemoveAll(s.shadowDir())
+	}
 	delete(a.sessions, id)
 }
 
@@ -381,8 +406,17 @@ func (s *ChatSession) SendPrompt(prompt string) error {
 	}
 	args = append(args, prompt)
 
+	// In approval mode the agent works on a shadow copy of the project; its
+	// edits reach the working tree only once approved.
+	approvalMode := s.approvalModeOn()
 	cmd := exec.Command(s.CommandPath, args...)
 	cmd.Dir = s.ProjectDir
+	if approvalMode {
+		if err := s.beginShadowRun(); err != nil {
+			return err
+		}
+		cmd.Dir = s.shadowDir()
+	}
 
 	// Pass API key via environment variable if set
 	if s.APIKey != "" {
@@ -395,6 +429,9 @@ func (s *ChatSession) SendPrompt(prompt string) error {
 	}
 
 	if err := cmd.Start(); err != nil {
+		if approvalMode {
+			s.holdShadowEdits()
+		}
 		return fmt.Errorf("start cursor-agent: %w", err)
 	}
 
@@ -404,6 +441,19 @@ func (s *ChatSession) SendPrompt(prompt string) error {
 	// Wait for process to finish
 	cmd.Wait()
 
+	if approvalMode {
+		s.holdShadowEdits()
+	}
+
+	if s.adapter != nil {
+		s.adapter.mu.Lock()
+		hook := s.adapter.onPromptDone
+		s.adapter.mu.Unlock()
+		if hook != nil {
+			hook(s.ID)
+		}
+	}
+
 	return nil
 }
 
@@ -415,6 +465,7 @@ func (s *ChatSession) processStream(r io.Reader) {
 
 	var currentAssistant *ChatMessage
 	var currentToolMsgID string
+	runModel := s.Model
 
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -445,53 +496,35 @@ func (s *ChatSession) processStream(r io.Reader) {
 				continue
 			}
 
-			now := time.Now()
-			if currentAssistant == nil {
-				msg := ChatMessage{
-					ID:    fmt.Sprintf("msg-%d", now.UnixMilli()),
-					Role:  "agent",
-					Time:  now.Unix(),
-					Parts: []MessagePart{{ID: fmt.Sprintf("part-%d-0", now.UnixMilli()), ContentType: "text/plain", Content: text}},
-				}
-				currentAssistant = &msg
-				s.mu.Lock()
-				s.messages = append(s.messages, msg)
-				s.mu.Unlock()
-				s.broadcast(ACPEvent{Type: ACPMessageCreated, Message: msg})
-			} else {
-				// Append to existing assistant message
-				s.mu.Lock()
-				idx := len(s.messages) - 1
-				for i := len(s.messages) - 1; i >= 0; i-- {
-					if s.messages[i].ID == currentAssistant.ID {
-						idx = i
-						break
-					}
-				}
-				// Append text to last text/plain part
-				appended := false
-				for j := len(s.messages[idx].Parts) - 1; j >= 0; j-- {
-					if s.messages[idx].Parts[j].ContentType == "text/plain" {
-						s.messages[idx].Parts[j].Content += text
-						appended = true
-						break
-					}
-				}
-				if !appended {
-					partID := fmt.Sprintf("part-%s-%d", s.messages[idx].ID, len(s.messages[idx].Parts))
-					s.messages[idx].Parts = append(s.messages[idx].Parts, MessagePart{ID: partID, ContentType: "text/plain", Content: text})
-				}
-				updated := s.messages[idx]
-				s.mu.Unlock()
-				s.broadcast(ACPEvent{Type: ACPMessageUpdated, Message: updated})
+			currentAssistant = s.appendAssistantPart(currentAssistant, "text/plain", text, runModel)
+
+		case "system":
+			if event.Model != "" {
+				runModel = event.Model
 			}
 
+		case "thinking":
+			if event.Text == "" {
+				continue
+			}
+			currentAssistant = s.appendAssistantPart(currentAssistant, "text/thinking", event.Text, runModel)
+
 		case "tool_call":
 			s.handleToolCall(&event, currentAssistant, &currentToolMsgID)
 
 		case "result":
 			if currentAssistant != nil {
-				s.broadcast(ACPEvent{Type: ACPMessageCompleted, Message: *currentAssistant})
+				completed := *currentAssistant
+				s.mu.Lock()
+				for i := len(s.messages) - 1; i >= 0; i-- {
+					if s.messages[i].ID == currentAssistant.ID {
+						s.messages[i].Usage = event.Usage.Normalize()
+						completed = s.messages[i]
+						break
+					}
+				}
+				s.mu.Unlock()
+				s.broadcast(ACPEvent{Type: ACPMessageCompleted, Message: completed})
 			}
 			currentAssistant = nil
 			currentToolMsgID = ""
@@ -499,25 +532,93 @@ func (s *ChatSession) processStream(r io.Reader) {
 	}
 }
 
+// appendAssistantPart appends text to the current assistant message, extending
+// its last part of the same content type or adding a new part. A new message is
+// created when there is no current one. It returns the current message.
+func (s *ChatSession) appendAssistantPart(current *ChatMessage, contentType, text, model string) *ChatMessage {
+	now := time.Now()
+	if current == nil {
+		msg := ChatMessage{
+			ID:    fmt.Sprintf("msg-%d", now.UnixMilli()),
+			Role:  "agent",
+			Time:  now.Unix(),
+			Model: model,
+			Parts: []MessagePart{{ID: fmt.Sprintf("part-%d-0", now.UnixMilli()), ContentType: contentType, Content: text}},
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		s.broadcast(ACPEvent{Type: ACPMessageCreated, Message: msg})
+		return &msg
+	}
+
+	s.mu.Lock()
+	idx := len(s.messages) - 1
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].ID == current.ID {
+			idx = i
+			break
+		}
+	}
+	// Extend the trailing part when it has the same type; otherwise start a new part
+	parts := s.messages[idx].Parts
+	if n := len(parts); n > 0 && parts[n-1].ContentType == contentType {
+		parts[n-1].Content += text
+	} else {
+		partID := fmt.Sprintf("part-%s-%d", s.messages[idx].ID, len(parts))
+		s.messages[idx].Parts = append(parts, MessagePart{ID: partID, ContentType: contentType, Content: text})
+	}
+	updated := s.messages[idx]
+	s.mu.Unlock()
+	s.broadcast(ACPEvent{Type: ACPMessageUpdated, Message: updated})
+	return current
+}
+
 // handleToolCall processes a tool_call event.
+// Started and completed events are correlated by call_id when present,
+// falling back to the most recent running call of the same tool.
 func (s *ChatSession) handleToolCall(event *CursorEvent, currentAssistant *ChatMessage, currentToolMsgID *string) {
 	if event.ToolCall == nil {
 		return
 	}
 
 	toolName, toolArgs, toolOutput, toolStatus := parseToolCall(event.ToolCall, event.Subtype)
+	details := toolCallMetadata(event.ToolCall, event.Subtype)
+
+	if s.approvalModeOn() {
+		callKey := event.CallID
+		if callKey == "" {
+			callKey = toolName
+		}
+		if event.Subtype == "started" {
+			for k, v := range s.gateToolStarted(callKey, event.ToolCall) {
+				details[k] = v
+			}
+		} else if event.Subtype == "completed" {
+			s.gateToolCompleted(callKey)
+		}
+	}
 
 	if event.Subtype == "started" {
 		now := time.Now()
 		msgID := fmt.Sprintf("msg-%d", now.UnixMilli())
 		*currentToolMsgID = msgID
 
+		metadata := map[string]interface{}{"status": "running"}
+		for k, v := range details {
+			metadata[k] = v
+		}
+		partID := fmt.Sprintf("tool-%s-%s", toolName, msgID)
+		if event.CallID != "" {
+			metadata["call_id"] = event.CallID
+			partID = "tool-" + event.CallID
+		}
 		part := MessagePart{
-			ID:          fmt.Sprintf("tool-%s-%s", toolName, msgID),
+			ID:          partID,
 			ContentType: "tool/call",
 			Content:     toolArgs,
 			Name:        toolName,
-			Metadata:    map[string]interface{}{"status": "running"},
+			Metadata:    metadata,
 		}
 
 		if currentAssistant == nil {
@@ -552,15 +653,26 @@ func (s *ChatSession) handleToolCall(event *CursorEvent, currentAssistant *ChatM
 		for i := len(s.messages) - 1; i >= 0; i-- {
 			for j := len(s.messages[i].Parts) - 1; j >= 0; j-- {
 				p := &s.messages[i].Parts[j]
-				if p.ContentType == "tool/call" && p.Name == toolName && p.Metadata != nil && p.Metadata["status"] == "running" {
-					p.Metadata["status"] = toolStatus
-					if toolOutput != "" {
-						p.Metadata["output"] = toolOutput
+				if p.ContentType != "tool/call" || p.Metadata == nil || p.Metadata["status"] != "running" {
+					continue
+				}
+				if event.CallID != "" && p.Metadata["call_id"] != nil {
+					if p.Metadata["call_id"] != event.CallID {
+						continue
 					}
-					msg := s.messages[i]
-					updatedMsg = &msg
-					break
+				} else if p.Name != toolName {
+					continue
+				}
+				p.Metadata["status"] = toolStatus
+				if toolOutput != "" {
+					p.Metadata["output"] = toolOutput
 				}
+				for k, v := range details {
+					p.Metadata[k] = v
+				}
+				msg := s.messages[i]
+				updatedMsg = &msg
+				break
 			}
 			if updatedMsg != nil {
 				break
@@ -756,6 +868,20 @@ func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/prompt_async") && r.Method == http.MethodPost:
 		sessionID := extractSessionID(path, "/prompt_async")
 		a.handlePromptAsync(w, r, sessionID)
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/approval-mode"):
+		sessionID := extractSessionID(path, "/approval-mode")
+		a.handleApprovalMode(w, r, sessionID)
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/approvals") && r.Method == http.MethodGet:
+		sessionID := extractSessionID(path, "/approvals")
+		a.handleListApprovals(w, r, sessionID)
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/approvals/preview") && r.Method == http.MethodGet:
+		sessionID := extractSessionID(path, "/approvals/preview")
+		a.handlePreviewApprovals(w, r, sessionID)
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/approvals/batch") && r.Method == http.MethodPost:
+		sessionID := extractSessionID(path, "/approvals/batch")
+		a.handleResolvePendingEdits(w, r, sessionID)
+	case strings.HasPrefix(path, "/session/") && strings.Contains(path, "/approvals/") && r.Method == http.MethodPost:
+		a.handleResolveApproval(w, r, path)
 	case path == "/event" || path == "/global/event":
 		a.handleEvents(w, r)
 	case path == "/global/health" || path == "/health":
@@ -806,12 +932,24 @@ func (a *Adapter) handleListSessions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(sessions)
 }
 
-func (a *Adapter) handleCreateSession(w http.ResponseWriter, _ *http.Request) {
+func (a *Adapter) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	// Optional body: {"approval_mode": true}
+	var req struct {
+		ApprovalMode bool `json:"approval_mode"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	}
 	s := a.CreateSession()
+	s.SetApprovalMode(req.ApprovalMode)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"id":         s.ID,
-		"created_at": s.CreatedAt,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":            s.ID,
+		"created_at":    s.CreatedAt,
+		"approval_mode": req.ApprovalMode,
 	})
 }
 
@@ -1014,3 +1152,113 @@ func (a *Adapter) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(s)
 }
+
+// handleApprovalMode reads (GET) or sets (PUT {"enabled": bool}) a session's approval mode.
+func (a *Adapter) handleApprovalMode(w http.ResponseWriter, r *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		s.SetApprovalMode(req.Enabled)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": s.approvalModeOn()})
+}
+
+func (a *Adapter) handleListApprovals(w http.ResponseWriter, _ *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Approvals())
+}
+
+// handleResolveApproval handles POST /session/{id}/approvals/{approvalID}
+// with body {"decision": "approve" | "reject"}.
+func (a *Adapter) handleResolveApproval(w http.ResponseWriter, r *http.Request, path string) {
+	rest := strings.TrimPrefix(path, "/session/")
+	sessionID, approvalID, _ := strings.Cut(rest, "/approvals/")
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Decision string `json:"decision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "reject" {
+		http.Error(w, `decision must be "approve" or "reject"`, http.StatusBadRequest)
+		return
+	}
+	action, err := s.ResolveApproval(approvalID, req.Decision == "approve", auth.UserName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(action)
+}
+
+// handlePreviewApprovals returns all pending edits of a session as one unified diff.
+func (a *Adapter) handlePreviewApprovals(w http.ResponseWriter, _ *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	preview, err := s.PreviewPendingEdits()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// handleResolvePendingEdits handles POST /session/{id}/approvals/batch with body
+// {"decision": "approve" | "reject"}, applying or discarding every pending edit at once.
+func (a *Adapter) handleResolvePendingEdits(w http.ResponseWriter, r *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Decision string `json:"decision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "reject" {
+		http.Error(w, `decision must be "approve" or "reject"`, http.StatusBadRequest)
+		return
+	}
+	resolved, err := s.ResolvePendingEdits(req.Decision == "approve")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resolved)
+}
@@ -0,0 +1,496 @@
+package cursor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+)
+
+// Approval status values for a PendingAction.
+const (
+	ApprovalPending  = "pending"
+	ApprovalRunning  = "running" // approved shell command still executing
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalFailed   = "failed"
+)
+
+// ACP event types for approval gates.
+const (
+	ACPApprovalRequested = "acp.approval.requested"
+	ACPApprovalResolved  = "acp.approval.resolved"
+)
+
+// approvedShellTimeout bounds a shell command run after approval.
+const approvedShellTimeout = 10 * time.Minute
+
+// PendingAction is a file modification or shell command proposed by the agent
+// while the session is in approval mode. Nothing touches the working tree or
+// runs until it is approved.
+type PendingAction struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Kind      string `json:"kind"` // ToolKindFileEdit or ToolKindShell
+	File      string `json:"file,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Delete    bool   `json:"delete,omitempty"`
+	Status    string `json:"status"`
+	Output    string `json:"output,omitempty"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+
+	absPath string
+	before  string
+	existed bool
+	after   string
+}
+
+// shadowFile tracks one file touched during an approval-mode run: the
+// working tree original and the content the agent's edits produce in the
+// shadow copy (see shadowDir).
+type shadowFile struct {
+	original string
+	existed  bool
+	content  string
+	exists   bool
+}
+
+// SetApprovalMode turns "ask before acting" on or off for the session.
+func (s *ChatSession) SetApprovalMode(enabled bool) {
+	s.mu.Lock()
+	s.ApprovalMode = enabled
+	s.mu.Unlock()
+}
+
+// Approvals returns the session's proposed actions, oldest first.
+func (s *ChatSession) Approvals() []PendingAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]PendingAction, 0, len(s.approvals))
+	for _, a := range s.approvals {
+		result = append(result, *a)
+	}
+	return result
+}
+
+func (s *ChatSession) approvalModeOn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ApprovalMode
+}
+
+// resolvePath maps a path reported by the agent to the working tree; paths
+// in the shadow copy map to the file they shadow.
+func (s *ChatSession) resolvePath(p string) string {
+	if !filepath.IsAbs(p) {
+		return filepath.Join(s.ProjectDir, p)
+	}
+	p = filepath.Clean(p)
+	if rel, err := filepath.Rel(s.shadowDir(), p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join(s.ProjectDir, rel)
+	}
+	return p
+}
+
+func (s *ChatSession) displayPath(abs string) string {
+	rel, err := filepath.Rel(s.ProjectDir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+	return filepath.ToSlash(rel)
+}
+
+// gateToolStarted records what a gated tool call is about to do and returns
+// metadata to merge into its tool/call part. Shell commands become pending
+// actions right away; file edits are tracked against the working tree
+// original.
+func (s *ChatSession) gateToolStarted(callKey string, raw json.RawMessage) map[string]interface{} {
+	name, val := firstToolCall(raw)
+	switch toolKind(name) {
+	case ToolKindShell:
+		var d ShellToolCallData
+		if json.Unmarshal(val, &d) != nil || d.Args == nil || d.Args.Command == "" {
+			return nil
+		}
+		action := s.addApproval(&PendingAction{Kind: ToolKindShell, Command: d.Args.Command})
+		return map[string]interface{}{"approval_id": action.ID, "approval_status": ApprovalPending}
+
+	case ToolKindFileEdit:
+		path := editPath(name, val)
+		if path == "" {
+			return nil
+		}
+		abs := s.resolvePath(path)
+		s.mu.Lock()
+		if s.shadow == nil {
+			s.shadow = make(map[string]*shadowFile)
+		}
+		if _, ok := s.shadow[abs]; !ok {
+			data, err := os.ReadFile(abs)
+			shadowData, shadowErr := os.ReadFile(s.shadowPath(abs))
+			s.shadow[abs] = &shadowFile{
+				original: string(data),
+				existed:  err == nil,
+				content:  string(shadowData),
+				exists:   shadowErr == nil,
+			}
+		}
+		if s.inflight == nil {
+			s.inflight = make(map[string]json.RawMessage)
+		}
+		s.inflight[callKey] = raw
+		s.mu.Unlock()
+		return map[string]interface{}{"approval_status": "held"}
+	}
+	return nil
+}
+
+// gateToolCompleted folds a finished file edit into the shadow. If the CLI
+// already wrote the shadow copy that result is taken; otherwise the edit is
+// replayed from its arguments.
+func (s *ChatSession) gateToolCompleted(callKey string) {
+	s.mu.Lock()
+	raw, ok := s.inflight[callKey]
+	delete(s.inflight, callKey)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	name, val := firstToolCall(raw)
+	path := editPath(name, val)
+	if path == "" {
+		return
+	}
+	abs := s.resolvePath(path)
+
+	data, err := os.ReadFile(s.shadowPath(abs))
+	diskContent, diskExists := string(data), err == nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sf := s.shadow[abs]
+	if sf == nil {
+		return
+	}
+	if diskContent != sf.content || diskExists != sf.exists {
+		sf.content, sf.exists = diskContent, diskExists
+		return
+	}
+	switch name {
+	case "edit_file":
+		var d EditToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			oldText, newText := d.Args.OldString, d.Args.NewString
+			if d.Args.StrReplace != nil {
+				oldText, newText = d.Args.StrReplace.OldText, d.Args.StrReplace.NewText
+			}
+			if oldText == "" {
+				sf.content = newText
+			} else {
+				sf.content = strings.Replace(sf.content, oldText, newText, 1)
+			}
+			sf.exists = true
+		}
+	case "write_file":
+		var d WriteToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			sf.content, sf.exists = d.Args.FileText, true
+		}
+	case "delete_file":
+		sf.content, sf.exists = "", false
+	}
+}
+
+// beginShadowRun prepares the shadow copy for an approval-mode prompt: it is
+// synced from the working tree, then edits still pending from earlier
+// prompts are laid onto it so the agent builds on its own proposals. The
+// working tree itself is not touched.
+func (s *ChatSession) beginShadowRun() error {
+	if err := s.syncShadow(); err != nil {
+		return fmt.Errorf("prepare shadow copy: %w", err)
+	}
+
+	s.mu.Lock()
+	s.shadow = make(map[string]*shadowFile)
+	s.inflight = make(map[string]json.RawMessage)
+	var pending []*PendingAction
+	for _, a := range s.approvals {
+		if a.Kind == ToolKindFileEdit && a.Status == ApprovalPending {
+			pending = append(pending, a)
+		}
+	}
+	for _, a := range pending {
+		s.shadow[a.absPath] = &shadowFile{
+			original: a.before,
+			existed:  a.existed,
+			content:  a.after,
+			exists:   !a.Delete,
+		}
+	}
+	s.mu.Unlock()
+
+	for _, a := range pending {
+		path := s.shadowPath(a.absPath)
+		if !a.Delete {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+		}
+		if err := restoreFile(path, a.after, !a.Delete); err != nil {
+			return fmt.Errorf("overlay %s: %w", a.File, err)
+		}
+	}
+	return nil
+}
+
+// holdShadowEdits runs after an approval-mode prompt finishes: every file the
+// agent changed in the shadow copy is held as one pending action per file,
+// updating the file's existing action if any. Approval writes it to the
+// working tree.
+func (s *ChatSession) holdShadowEdits() {
+	s.mu.Lock()
+	shadow := s.shadow
+	s.shadow = nil
+	s.inflight = nil
+	s.mu.Unlock()
+
+	for abs, sf := range shadow {
+		unchanged := sf.content == sf.original && sf.exists == sf.existed
+
+		s.mu.Lock()
+		existing := s.pendingEditLocked(abs)
+		if existing != nil {
+			if unchanged {
+				existing.Status = ApprovalRejected
+				existing.Error = "reverted by the agent"
+			} else {
+				existing.after = sf.content
+				existing.Delete = !sf.exists
+			}
+		}
+		s.mu.Unlock()
+
+		switch {
+		case existing != nil && unchanged:
+			s.finishApproval(existing)
+		case existing != nil:
+			s.mu.Lock()
+			snapshot := *existing
+			s.mu.Unlock()
+			s.broadcast(ACPEvent{Type: ACPApprovalRequested, Approval: &snapshot})
+		case !unchanged:
+			s.addApproval(&PendingAction{
+				Kind:    ToolKindFileEdit,
+				File:    s.displayPath(abs),
+				Delete:  !sf.exists,
+				absPath: abs,
+				before:  sf.original,
+				existed: sf.existed,
+				after:   sf.content,
+			})
+		}
+	}
+}
+
+// pendingEditLocked returns the pending file edit for abs. s.mu must be held.
+func (s *ChatSession) pendingEditLocked(abs string) *PendingAction {
+	for _, a := range s.approvals {
+		if a.Kind == ToolKindFileEdit && a.Status == ApprovalPending && a.absPath == abs {
+			return a
+		}
+	}
+	return nil
+}
+
+func (s *ChatSession) addApproval(action *PendingAction) *PendingAction {
+	s.mu.Lock()
+	s.approvalSeq++
+	action.ID = fmt.Sprintf("approval-%d", s.approvalSeq)
+	action.SessionID = s.ID
+	action.Status = ApprovalPending
+	action.CreatedAt = time.Now().Unix()
+	s.approvals = append(s.approvals, action)
+	if action.Kind == ToolKindFileEdit {
+		// Link the held tool calls for this file to the new approval
+		for i := range s.messages {
+			for j := range s.messages[i].Parts {
+				md := s.messages[i].Parts[j].Metadata
+				if md != nil && md["approval_status"] == "held" && md["file"] != nil &&
+					s.resolvePath(fmt.Sprint(md["file"])) == action.absPath {
+					md["approval_id"] = action.ID
+					md["approval_status"] = ApprovalPending
+				}
+			}
+		}
+	}
+	snapshot := *action
+	s.mu.Unlock()
+
+	s.broadcast(ACPEvent{Type: ACPApprovalRequested, Approval: &snapshot})
+	return action
+}
+
+// ResolveApproval approves or rejects a pending action for user by. Approved
+// file edits are written (refusing if the file changed since the proposal);
+// approved shell commands are checked against the exec policy and run in the
+// background, reporting back via the event stream.
+func (s *ChatSession) ResolveApproval(id string, approve bool, by string) (*PendingAction, error) {
+	s.mu.Lock()
+	var action *PendingAction
+	for _, a := range s.approvals {
+		if a.ID == id {
+			action = a
+			break
+		}
+	}
+	if action == nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("approval %s not found", id)
+	}
+	if action.Status != ApprovalPending {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("approval %s is already %s", id, action.Status)
+	}
+	if !approve {
+		action.Status = ApprovalRejected
+		snapshot := *action
+		s.mu.Unlock()
+		s.finishApproval(action)
+		return &snapshot, nil
+	}
+	if action.Kind == ToolKindShell {
+		action.Status = ApprovalRunning
+		s.mu.Unlock()
+		go s.runApprovedCommand(action, by)
+		snapshot := *action
+		return &snapshot, nil
+	}
+	s.mu.Unlock()
+
+	if err := applyFileAction(action); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	action.Status = ApprovalApproved
+	snapshot := *action
+	s.mu.Unlock()
+	s.finishApproval(action)
+	return &snapshot, nil
+}
+
+func (s *ChatSession) runApprovedCommand(action *PendingAction, by string) {
+	// approving the agent's proposal does not override the exec policy
+	err := execpolicy.AuthorizeAs(context.Background(), by, execpolicy.SourceAgent, execpolicy.ShellArgv(action.Command), s.ProjectDir)
+	var out []byte
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), approvedShellTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", action.Command)
+		cmd.Dir = s.ProjectDir
+		out, err = cmd.CombinedOutput()
+	}
+
+	s.mu.Lock()
+	action.Output = truncatePreview(string(out))
+	action.Status = ApprovalApproved
+	if err != nil {
+		action.Status = ApprovalFailed
+		action.Error = err.Error()
+	}
+	s.mu.Unlock()
+	s.finishApproval(action)
+}
+
+// finishApproval mirrors the final status into the linked tool/call parts and
+// broadcasts the resolution.
+func (s *ChatSession) finishApproval(action *PendingAction) {
+	s.mu.Lock()
+	snapshot := *action
+	var updated []ChatMessage
+	for i := range s.messages {
+		changed := false
+		for j := range s.messages[i].Parts {
+			md := s.messages[i].Parts[j].Metadata
+			if md != nil && md["approval_id"] == action.ID {
+				md["approval_status"] = action.Status
+				changed = true
+			}
+		}
+		if changed {
+			updated = append(updated, s.messages[i])
+		}
+	}
+	s.mu.Unlock()
+
+	for _, msg := range updated {
+		s.broadcast(ACPEvent{Type: ACPMessageUpdated, Message: msg})
+	}
+	s.broadcast(ACPEvent{Type: ACPApprovalResolved, Approval: &snapshot})
+}
+
+// applyFileAction writes an approved file edit, failing if the file no longer
+// matches the content the proposal was based on.
+func applyFileAction(action *PendingAction) error {
+	if err := checkFileAction(action); err != nil {
+		return err
+	}
+	if action.Delete {
+		return os.Remove(action.absPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(action.absPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(action.absPath, []byte(action.after), 0644)
+}
+
+// checkFileAction reports a conflict if the file no longer matches the
+// content the proposal was based on.
+func checkFileAction(action *PendingAction) error {
+	data, err := os.ReadFile(action.absPath)
+	if (err == nil) != action.existed || string(data) != action.before {
+		return fmt.Errorf("%s changed since the edit was proposed", action.File)
+	}
+	return nil
+}
+
+func restoreFile(abs, content string, existed bool) error {
+	if !existed {
+		err := os.Remove(abs)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(abs, []byte(content), 0644)
+}
+
+func firstToolCall(raw json.RawMessage) (name string, val json.RawMessage) {
+	var toolMap map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &toolMap); err != nil {
+		return "", nil
+	}
+	for key, v := range toolMap {
+		return toolCallKeyToName(key), v
+	}
+	return "", nil
+}
+
+func editPath(name string, val json.RawMessage) string {
+	var d struct {
+		Args *struct {
+			Path string `json:"path"`
+		} `json:"args"`
+	}
+	if toolKind(name) != ToolKindFileEdit || json.Unmarshal(val, &d) != nil || d.Args == nil {
+		return ""
+	}
+	return d.Args.Path
+}
@@ -0,0 +1,149 @@
+package cursor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// ApprovalPreview is every pending edit of a session rendered as one patch,
+// plus the shell commands still waiting for approval.
+type ApprovalPreview struct {
+	Diff     string          `json:"diff"`
+	Files    []PendingAction `json:"files"`
+	Commands []PendingAction `json:"commands,omitempty"`
+}
+
+// PreviewPendingEdits renders the pending file edits as a single unified diff
+// against the working tree, in file path order.
+func (s *ChatSession) PreviewPendingEdits() (*ApprovalPreview, error) {
+	s.mu.Lock()
+	preview := &ApprovalPreview{}
+	var edits []PendingAction
+	for _, a := range s.approvals {
+		if a.Status != ApprovalPending {
+			continue
+		}
+		if a.Kind == ToolKindShell {
+			preview.Commands = append(preview.Commands, *a)
+		} else {
+			edits = append(edits, *a)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].File < edits[j].File })
+	var diff bytes.Buffer
+	for i := range edits {
+		d, err := unifiedDiff(&edits[i])
+		if err != nil {
+			return nil, fmt.Errorf("diff %s: %w", edits[i].File, err)
+		}
+		diff.WriteString(d)
+	}
+	preview.Diff = diff.String()
+	preview.Files = edits
+	if preview.Files == nil {
+		preview.Files = []PendingAction{}
+	}
+	return preview, nil
+}
+
+// ResolvePendingEdits approves or rejects all pending file edits as one unit.
+// On approve every file is checked for conflicts before anything is written,
+// and files already written are rolled back if a later write fails.
+// Pending shell commands are left untouched.
+func (s *ChatSession) ResolvePendingEdits(approve bool) ([]PendingAction, error) {
+	s.mu.Lock()
+	var edits []*PendingAction
+	for _, a := range s.approvals {
+		if a.Kind == ToolKindFileEdit && a.Status == ApprovalPending {
+			edits = append(edits, a)
+		}
+	}
+	s.mu.Unlock()
+
+	if approve {
+		var conflicts []error
+		for _, a := range edits {
+			if err := checkFileAction(a); err != nil {
+				conflicts = append(conflicts, err)
+			}
+		}
+		if len(conflicts) > 0 {
+			return nil, errors.Join(conflicts...)
+		}
+		var applied []*PendingAction
+		for _, a := range edits {
+			if err := applyFileAction(a); err != nil {
+				for _, done := range applied {
+					_ = restoreFile(done.absPath, done.before, done.existed)
+				}
+				return nil, fmt.Errorf("apply %s: %w (all edits rolled back)", a.File, err)
+			}
+			applied = append(applied, a)
+		}
+	}
+
+	status := ApprovalRejected
+	if approve {
+		status = ApprovalApproved
+	}
+	result := make([]PendingAction, 0, len(edits))
+	for _, a := range edits {
+		s.mu.Lock()
+		a.Status = status
+		result = append(result, *a)
+		s.mu.Unlock()
+		s.finishApproval(a)
+	}
+	return result, nil
+}
+
+// unifiedDiff renders one pending edit with `git diff --no-index`, using the
+// project-relative path in the headers.
+func unifiedDiff(a *PendingAction) (string, error) {
+	dir, err := os.MkdirTemp("", "approval-diff-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	oldPath, newPath := "/dev/null", "/dev/null"
+	if a.existed {
+		oldPath = filepath.Join("a", a.File)
+		if err := writeTemp(dir, oldPath, a.before); err != nil {
+			return "", err
+		}
+	}
+	if !a.Delete {
+		newPath = filepath.Join("b", a.File)
+		if err := writeTemp(dir, newPath, a.after); err != nil {
+			return "", err
+		}
+	}
+
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color", "--no-prefix", "--", oldPath, newPath)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		// Exit status 1 means the inputs differ
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return "", err
+		}
+	}
+	return string(out), nil
+}
+
+func writeTemp(dir, rel, content string) error {
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,238 @@
+package cursor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+)
+
+func newTestSession(t *testing.T) *ChatSession {
+	t.Helper()
+	root := shadowRoot
+	t.Cleanup(func() { shadowRoot = root })
+	shadowRoot = t.TempDir()
+	return &ChatSession{
+		ID:           "test",
+		ProjectDir:   t.TempDir(),
+		ApprovalMode: true,
+		subscribers:  make(map[chan SSEEvent]struct{}),
+	}
+}
+
+func TestApprovalHoldsFileEdits(t *testing.T) {
+	s := newTestSession(t)
+	file := filepath.Join(s.ProjectDir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.beginShadowRun(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit that the CLI did not apply: replayed from its arguments.
+	edit := json.RawMessage(`{"editToolCall":{"args":{"path":"a.txt","strReplace":{"oldText":"world","newText":"there"}}}}`)
+	s.gateToolStarted("c1", edit)
+	s.gateToolCompleted("c1")
+
+	// Write that the CLI applied in the shadow copy, reported by absolute path.
+	shadowB := filepath.Join(s.shadowDir(), "b.txt")
+	write := json.RawMessage(`{"writeToolCall":{"args":{"path":` + strconv.Quote(shadowB) + `,"fileText":"new"}}}`)
+	s.gateToolStarted("c2", write)
+	if err := os.WriteFile(shadowB, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.gateToolCompleted("c2")
+
+	s.holdShadowEdits()
+
+	if data, _ := os.ReadFile(file); string(data) != "hello world\n" {
+		t.Fatalf("a.txt modified before approval: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(s.ProjectDir, "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("b.txt written before approval")
+	}
+
+	approvals := s.Approvals()
+	if len(approvals) != 2 {
+		t.Fatalf("got %d approvals, want 2", len(approvals))
+	}
+	for _, a := range approvals {
+		approve := a.File == "a.txt"
+		if _, err := s.ResolveApproval(a.ID, approve, ""); err != nil {
+			t.Fatalf("resolve %s: %v", a.File, err)
+		}
+	}
+
+	if data, _ := os.ReadFile(file); string(data) != "hello there\n" {
+		t.Errorf("a.txt after approval = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(s.ProjectDir, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("rejected b.txt was written")
+	}
+	if _, err := s.ResolveApproval(approvals[0].ID, true, ""); err == nil {
+		t.Errorf("resolving twice succeeded")
+	}
+}
+
+func TestApprovalConflict(t *testing.T) {
+	s := newTestSession(t)
+	file := filepath.Join(s.ProjectDir, "a.txt")
+	os.WriteFile(file, []byte("v1"), 0644)
+
+	s.beginShadowRun()
+	s.gateToolStarted("c1", json.RawMessage(`{"writeToolCall":{"args":{"path":"a.txt","fileText":"v2"}}}`))
+	s.gateToolCompleted("c1")
+	s.holdShadowEdits()
+
+	os.WriteFile(file, []byte("edited by hand"), 0644)
+	if _, err := s.ResolveApproval(s.Approvals()[0].ID, true, ""); err == nil {
+		t.Fatalf("approval applied over a concurrent change")
+	}
+}
+
+func TestPreviewAndResolvePendingEdits(t *testing.T) {
+	s := newTestSession(t)
+	os.WriteFile(filepath.Join(s.ProjectDir, "a.txt"), []byte("one\ntwo\n"), 0644)
+
+	// First prompt edits a.txt; the second builds on it and adds b.txt.
+	s.beginShadowRun()
+	s.gateToolStarted("c1", json.RawMessage(`{"editToolCall":{"args":{"path":"a.txt","strReplace":{"oldText":"one","newText":"uno"}}}}`))
+	s.gateToolCompleted("c1")
+	s.holdShadowEdits()
+
+	s.beginShadowRun()
+	if data, _ := os.ReadFile(filepath.Join(s.shadowDir(), "a.txt")); string(data) != "uno\ntwo\n" {
+		t.Fatalf("pending edit not overlaid on the shadow copy: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.ProjectDir, "a.txt")); string(data) != "one\ntwo\n" {
+		t.Fatalf("pending edit written to the working tree: %q", data)
+	}
+	s.gateToolStarted("c2", json.RawMessage(`{"editToolCall":{"args":{"path":"a.txt","strReplace":{"oldText":"two","newText":"dos"}}}}`))
+	s.gateToolCompleted("c2")
+	s.gateToolStarted("c3", json.RawMessage(`{"writeToolCall":{"args":{"path":"b.txt","fileText":"new\n"}}}`))
+	s.gateToolCompleted("c3")
+	s.holdShadowEdits()
+
+	preview, err := s.PreviewPendingEdits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Files) != 2 {
+		t.Fatalf("got %d pending files, want 2", len(preview.Files))
+	}
+	for _, want := range []string{"--- a/a.txt", "+++ b/a.txt", "+uno", "+dos", "--- /dev/null", "+++ b/b.txt", "+new"} {
+		if !strings.Contains(preview.Diff, want) {
+			t.Errorf("diff missing %q:\n%s", want, preview.Diff)
+		}
+	}
+
+	// A conflict on one file blocks the whole batch.
+	os.WriteFile(filepath.Join(s.ProjectDir, "b.txt"), []byte("mine\n"), 0644)
+	if _, err := s.ResolvePendingEdits(true); err == nil {
+		t.Fatalf("batch applied despite a conflict")
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.ProjectDir, "a.txt")); string(data) != "one\ntwo\n" {
+		t.Fatalf("a.txt written by failed batch: %q", data)
+	}
+
+	os.Remove(filepath.Join(s.ProjectDir, "b.txt"))
+	resolved, err := s.ResolvePendingEdits(true)
+	if err != nil || len(resolved) != 2 {
+		t.Fatalf("ResolvePendingEdits: %v, %d", err, len(resolved))
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.ProjectDir, "a.txt")); string(data) != "uno\ndos\n" {
+		t.Errorf("a.txt = %q", data)
+	}
+}
+
+func TestShadowRunKeepsUserEdits(t *testing.T) {
+	s := newTestSession(t)
+	file := filepath.Join(s.ProjectDir, "a.txt")
+	os.WriteFile(file, []byte("v1"), 0644)
+
+	s.beginShadowRun()
+	s.gateToolStarted("c1", json.RawMessage(`{"writeToolCall":{"args":{"path":"a.txt","fileText":"agent"}}}`))
+	os.WriteFile(filepath.Join(s.shadowDir(), "a.txt"), []byte("agent"), 0644)
+	s.gateToolCompleted("c1")
+
+	// the user saves the same file while the agent runs
+	os.WriteFile(file, []byte("mine"), 0644)
+	s.holdShadowEdits()
+
+	if data, _ := os.ReadFile(file); string(data) != "mine" {
+		t.Fatalf("user edit lost when the run ended: %q", data)
+	}
+	if _, err := s.ResolveApproval(s.Approvals()[0].ID, true, ""); err == nil {
+		t.Fatalf("approval applied over the user's edit")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "mine" {
+		t.Errorf("user edit overwritten: %q", data)
+	}
+}
+
+func TestApprovedCommandFollowsExecPolicy(t *testing.T) {
+	s := newTestSession(t)
+	dir := t.TempDir()
+	execpolicy.SetFiles(filepath.Join(dir, "exec-policy.json"), filepath.Join(dir, "exec-decisions.log"))
+	t.Cleanup(func() { execpolicy.SetFiles(config.ExecPolicyFile, config.ExecDecisionsLogFile) })
+	if err := execpolicy.SetPolicy(execpolicy.Policy{Rules: []execpolicy.Rule{
+		{Pattern: "touch denied*", Action: execpolicy.ActionDeny, Sources: []string{execpolicy.SourceAgent}},
+		{Pattern: "touch *", Action: execpolicy.ActionAllow, Sources: []string{execpolicy.SourceAgent}},
+	}, Default: execpolicy.ActionDeny}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.beginShadowRun(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(s.shadowDir(), ".cursor", "cli.json")); err != nil || !strings.Contains(string(data), `"Shell(*)"`) {
+		t.Fatalf("shadow copy does not deny shell commands: %s %v", data, err)
+	}
+
+	run := func(command string) PendingAction {
+		t.Helper()
+		s.gateToolStarted(command, json.RawMessage(`{"shellToolCall":{"args":{"command":`+strconv.Quote(command)+`}}}`))
+		approvals := s.Approvals()
+		id := approvals[len(approvals)-1].ID
+		if _, err := s.ResolveApproval(id, true, "carol"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 200; i++ {
+			for _, a := range s.Approvals() {
+				if a.ID == id && a.Status != ApprovalRunning {
+					return a
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s still running", command)
+		return PendingAction{}
+	}
+
+	if a := run("touch denied.txt"); a.Status != ApprovalFailed || !strings.Contains(a.Error, "denied by exec policy") {
+		t.Errorf("denied command: %+v", a)
+	}
+	if _, err := os.Stat(filepath.Join(s.ProjectDir, "denied.txt")); !os.IsNotExist(err) {
+		t.Errorf("denied command ran")
+	}
+	if a := run("touch allowed.txt"); a.Status != ApprovalApproved {
+		t.Errorf("allowed command: %+v", a)
+	}
+	if _, err := os.Stat(filepath.Join(s.ProjectDir, "allowed.txt")); err != nil {
+		t.Errorf("allowed command did not run in the project: %v", err)
+	}
+	if a := run("touch chained.txt; touch escaped.txt"); a.Status != ApprovalFailed || !strings.Contains(a.Error, "denied by exec policy") {
+		t.Errorf("chained command: %+v", a)
+	}
+	if _, err := os.Stat(filepath.Join(s.ProjectDir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("chained command ran")
+	}
+}
@@ -0,0 +1,296 @@
+package cursor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// shadowRoot holds the shadow copies of approval-mode sessions, replaced in
+// tests. It is private to the server user: the copies hold the project's
+// files.
+var shadowRoot = config.CursorShadowDir
+
+// shadowDir is where the session's approval-mode prompts run: a copy of the
+// project that the agent edits instead of the working tree. The path is
+// absolute, to compare with the paths the CLI reports, and stable so
+// cursor-agent can resume its chat in the same workspace.
+func (s *ChatSession) shadowDir() string {
+	root, err := filepath.Abs(shadowRoot)
+	if err != nil {
+		root = shadowRoot
+	}
+	return filepath.Join(root, s.ID)
+}
+
+// shadowPath maps abs, a path in the project, into the shadow copy.
+func (s *ChatSession) shadowPath(abs string) string {
+	rel, err := filepath.Rel(s.ProjectDir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return filepath.Join(s.shadowDir(), rel)
+}
+
+// shadowCLIConfig is cursor-agent's project config in the shadow copy, and
+// denyShell the permission it adds: shell commands are held for approval
+// (see gateToolStarted) rather than run by the CLI.
+const (
+	shadowCLIConfig = ".cursor/cli.json"
+	denyShell       = "Shell(*)"
+)
+
+// syncShadow brings the shadow copy up to date with the working tree. In a
+// git repository the tracked and untracked, non-ignored files are copied;
+// otherwise everything but .git. Files unchanged since the last sync are
+// kept and entries gone from the project are removed.
+func (s *ChatSession) syncShadow() error {
+	if err := os.MkdirAll(shadowRoot, 0700); err != nil {
+		return err
+	}
+	// created by an older version with the default mode
+	if err := os.Chmod(shadowRoot, 0700); err != nil {
+		return err
+	}
+	dir := s.shadowDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// rewritten below, so its deny rule is not added twice
+	if err := os.Remove(filepath.Join(dir, shadowCLIConfig)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	files, err := projectFiles(s.ProjectDir)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(files))
+	for _, rel := range files {
+		for p := rel; p != "." && !keep[p]; p = filepath.Dir(p) {
+			keep[p] = true
+		}
+		if err := s.copyEntry(rel); err != nil {
+			return err
+		}
+	}
+	if err := removeStale(dir, keep); err != nil {
+		return err
+	}
+	return denyShellIn(filepath.Join(dir, shadowCLIConfig))
+}
+
+// removeStale removes the entries of the shadow dir that are not in keep,
+// the project files and their parent directories relative to dir.
+func removeStale(dir string, keep map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if keep[rel] {
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// denyShellIn adds denyShell to the permissions of the cursor-agent config
+// at path, keeping whatever else the project configured.
+func denyShellIn(path string) error {
+	cfg := map[string]interface{}{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("parse %s: %w", shadowCLIConfig, err)
+		}
+	}
+	perms, _ := cfg["permissions"].(map[string]interface{})
+	if perms == nil {
+		perms = map[string]interface{}{}
+	}
+	deny, _ := perms["deny"].([]interface{})
+	perms["deny"] = append(deny, denyShell)
+	cfg["permissions"] = perms
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// a copied symlink would be written through, into the project
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// projectFiles lists the files of dir to copy into a shadow, relative to dir.
+func projectFiles(dir string) ([]string, error) {
+	cmd := exec.Command("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = dir
+	if out, err := cmd.Output(); err == nil {
+		var files []string
+		for _, f := range bytes.Split(out, []byte{0}) {
+			if len(f) > 0 {
+				files = append(files, filepath.FromSlash(string(f)))
+			}
+		}
+		return files, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// copyEntry copies the regular file or symlink rel of the project into the
+// shadow copy, unless the copy is already up to date; anything else, or a
+// file deleted but still tracked, is skipped.
+func (s *ChatSession) copyEntry(rel string) error {
+	src := filepath.Join(s.ProjectDir, rel)
+	dst := filepath.Join(s.shadowDir(), rel)
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cur, err := os.Lstat(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		target = s.shadowLink(src, target)
+		if cur != nil && cur.Mode()&os.ModeSymlink != 0 {
+			if t, err := os.Readlink(dst); err == nil && t == target {
+				return nil
+			}
+		}
+		if err := replaceable(dst, cur); err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case info.Mode().IsRegular():
+		// copies keep the mtime of their source, so one the agent edited
+		// since differs
+		if cur != nil && cur.Mode().IsRegular() && cur.Size() == info.Size() && cur.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+		if err := replaceable(dst, cur); err != nil {
+			return err
+		}
+		if err := copyFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// shadowLink returns the target of the shadow copy of the symlink src to
+// target. A link into the project points to the shadow copy instead, so
+// writes through it do not reach the working tree; a relative link out of
+// the project is made absolute, as it would resolve elsewhere from the
+// shadow.
+func (s *ChatSession) shadowLink(src, target string) string {
+	abs := target
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(filepath.Dir(src), target)
+	}
+	rel, ok := withinDir(s.ProjectDir, abs)
+	if !ok {
+		if real, err := filepath.EvalSymlinks(s.ProjectDir); err == nil {
+			rel, ok = withinDir(real, abs)
+		}
+	}
+	if !ok {
+		return abs
+	}
+	if !filepath.IsAbs(target) {
+		// the same relative path leads to the same place in the shadow
+		return target
+	}
+	return filepath.Join(s.shadowDir(), rel)
+}
+
+// withinDir reports whether path is dir or under it, and path relative to
+// dir if so.
+func withinDir(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// replaceable clears the way for a new copy at dst, whose current entry
+// is cur (nil if there is none): a file is replaced, not written through,
+// and a directory where the project now has a file is removed.
+func replaceable(dst string, cur os.FileInfo) error {
+	if cur != nil {
+		return os.RemoveAll(dst)
+	}
+	return os.MkdirAll(filepath.Dir(dst), 0755)
+}
+
+// copyFile copies the regular file src to dst, created with perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
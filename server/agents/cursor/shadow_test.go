@@ -0,0 +1,83 @@
+package cursor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncShadow(t *testing.T) {
+	s := newTestSession(t)
+	os.Chmod(shadowRoot, 0755)
+	for name, content := range map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/c.txt": "c",
+	} {
+		path := filepath.Join(s.ProjectDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(s.ProjectDir, "a.txt"), filepath.Join(s.ProjectDir, "abs-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("sub", "c.txt"), filepath.Join(s.ProjectDir, "rel-link")); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Symlink(filepath.Join("..", filepath.Base(outside)), filepath.Join(s.ProjectDir, "out-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.syncShadow(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(shadowRoot); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("shadow root is not private: %v %v", info.Mode(), err)
+	}
+
+	// Writes through links into the project land in the shadow copy.
+	if err := os.WriteFile(filepath.Join(s.shadowDir(), "abs-link"), []byte("agent"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.shadowDir(), "rel-link"), []byte("agent"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "sub/c.txt"} {
+		if data, _ := os.ReadFile(filepath.Join(s.ProjectDir, name)); string(data) == "agent" {
+			t.Fatalf("write through the shadow link reached %s in the project", name)
+		}
+	}
+	if target, _ := os.Readlink(filepath.Join(s.shadowDir(), "out-link")); target != outside {
+		t.Fatalf("link out of the project points to %q, want %q", target, outside)
+	}
+
+	bInfo, err := os.Stat(filepath.Join(s.shadowDir(), "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(s.shadowDir(), "stale.txt"), []byte("x"), 0644)
+	os.Remove(filepath.Join(s.ProjectDir, "sub", "c.txt"))
+
+	if err := s.syncShadow(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(s.shadowDir(), "b.txt")); err != nil || !os.SameFile(bInfo, info) {
+		t.Fatalf("unchanged file was copied again: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(s.shadowDir(), "a.txt")); string(data) != "a" {
+		t.Fatalf("edited shadow file not synced: %q", data)
+	}
+	for _, name := range []string{"stale.txt", "sub"} {
+		if _, err := os.Lstat(filepath.Join(s.shadowDir(), name)); !os.IsNotExist(err) {
+			t.Fatalf("%s not removed from the shadow copy: %v", name, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(s.shadowDir(), shadowCLIConfig))
+	if err != nil || strings.Count(string(data), denyShell) != 1 {
+		t.Fatalf("shadow config should deny shell once: %s %v", data, err)
+	}
+}
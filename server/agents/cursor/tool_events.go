@@ -0,0 +1,135 @@
+package cursor
+
+import (
+	"encoding/json"
+)
+
+// Tool kinds reported in tool/call part metadata ("kind"), shared with the
+// frontend so edit previews and approval prompts render the same for every agent.
+const (
+	ToolKindFileEdit = "file_edit"
+	ToolKindShell    = "shell"
+	ToolKindRead     = "read"
+	ToolKindSearch   = "search"
+	ToolKindOther    = "other"
+)
+
+// maxPreviewBytes caps file contents copied into tool call metadata.
+const maxPreviewBytes = 32 * 1024
+
+// toolCallMetadata extracts structured fields (file path, command, diff,
+// line counts) from a cursor tool_call payload. For "started" events it reads
+// args, for "completed" events it reads the result.
+func toolCallMetadata(raw json.RawMessage, subtype string) map[string]interface{} {
+	meta := map[string]interface{}{}
+
+	var toolMap map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &toolMap); err != nil {
+		return meta
+	}
+	for key, val := range toolMap {
+		name := toolCallKeyToName(key)
+		meta["kind"] = toolKind(name)
+		if subtype == "started" {
+			addArgsMetadata(meta, name, val)
+		} else if subtype == "completed" {
+			addResultMetadata(meta, name, val)
+		}
+		break // Only process the first key
+	}
+	return meta
+}
+
+func toolKind(name string) string {
+	switch name {
+	case "edit_file", "write_file", "delete_file":
+		return ToolKindFileEdit
+	case "shell":
+		return ToolKindShell
+	case "read_file", "list_dir":
+		return ToolKindRead
+	case "grep", "glob":
+		return ToolKindSearch
+	default:
+		return ToolKindOther
+	}
+}
+
+func addArgsMetadata(meta map[string]interface{}, name string, val json.RawMessage) {
+	switch name {
+	case "shell":
+		var d ShellToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			meta["command"] = d.Args.Command
+		}
+	case "read_file":
+		var d ReadToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			meta["file"] = d.Args.Path
+		}
+	case "edit_file":
+		var d EditToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			meta["file"] = d.Args.Path
+			oldText, newText := d.Args.OldString, d.Args.NewString
+			if d.Args.StrReplace != nil {
+				oldText, newText = d.Args.StrReplace.OldText, d.Args.StrReplace.NewText
+			}
+			if oldText != "" || newText != "" {
+				meta["old_string"] = truncatePreview(oldText)
+				meta["new_string"] = truncatePreview(newText)
+			}
+		}
+	case "write_file":
+		var d WriteToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			meta["file"] = d.Args.Path
+			meta["new_string"] = truncatePreview(d.Args.FileText)
+		}
+	case "delete_file":
+		var d DeleteToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Args != nil {
+			meta["file"] = d.Args.Path
+		}
+	}
+}
+
+func addResultMetadata(meta map[string]interface{}, name string, val json.RawMessage) {
+	switch name {
+	case "shell":
+		var d ShellToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Result != nil && d.Result.Success != nil {
+			meta["exit_code"] = d.Result.Success.ExitCode
+		}
+	case "edit_file":
+		var d EditToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Result != nil && d.Result.Success != nil {
+			s := d.Result.Success
+			if s.Path != "" {
+				meta["file"] = s.Path
+			}
+			if s.DiffString != "" {
+				meta["diff"] = truncatePreview(s.DiffString)
+			}
+			meta["lines_added"] = s.LinesAdded
+			meta["lines_removed"] = s.LinesRemoved
+		}
+	case "write_file":
+		var d WriteToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Result != nil && d.Result.Success != nil {
+			meta["lines_added"] = d.Result.Success.LinesCreated
+		}
+	case "delete_file":
+		var d DeleteToolCallData
+		if json.Unmarshal(val, &d) == nil && d.Result != nil && d.Result.Rejected != nil {
+			meta["reason"] = d.Result.Rejected.Reason
+		}
+	}
+}
+
+func truncatePreview(s string) string {
+	if len(s) > maxPreviewBytes {
+		return s[:maxPreviewBytes] + "\n... (truncated)"
+	}
+	return s
+}
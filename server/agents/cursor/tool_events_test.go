@@ -0,0 +1,53 @@
+package cursor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToolCallMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		subtype string
+		want    map[string]interface{}
+	}{
+		{
+			name:    "edit started",
+			raw:     `{"editToolCall":{"args":{"path":"a.go","strReplace":{"oldText":"x","newText":"y"}}}}`,
+			subtype: "started",
+			want:    map[string]interface{}{"kind": ToolKindFileEdit, "file": "a.go", "old_string": "x", "new_string": "y"},
+		},
+		{
+			name:    "edit completed",
+			raw:     `{"editToolCall":{"result":{"success":{"path":"a.go","diffString":"-x\n+y","linesAdded":1,"linesRemoved":1}}}}`,
+			subtype: "completed",
+			want:    map[string]interface{}{"kind": ToolKindFileEdit, "file": "a.go", "diff": "-x\n+y", "lines_added": 1, "lines_removed": 1},
+		},
+		{
+			name:    "shell started",
+			raw:     `{"shellToolCall":{"args":{"command":"go test ./..."}}}`,
+			subtype: "started",
+			want:    map[string]interface{}{"kind": ToolKindShell, "command": "go test ./..."},
+		},
+		{
+			name:    "invalid json",
+			raw:     `not json`,
+			subtype: "started",
+			want:    map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toolCallMetadata(json.RawMessage(tt.raw), tt.subtype)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %#v, want %#v", k, got[k], v)
+				}
+			}
+		})
+	}
+}
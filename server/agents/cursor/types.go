@@ -5,13 +5,57 @@ import "encoding/json"
 // CursorEvent represents a single event from cursor-agent's --output-format stream-json output.
 // The stream produces one JSON object per line (NDJSON).
 type CursorEvent struct {
-	Type      string          `json:"type"`       // "user", "assistant", "tool_call", "result"
-	Subtype   string          `json:"subtype"`    // For tool_call: "started", "completed"; For result: subtype
+	Type      string          `json:"type"`       // "system", "user", "assistant", "thinking", "tool_call", "result"
+	Subtype   string          `json:"subtype"`    // For tool_call: "started", "completed"; For thinking: "delta", "completed"; For result: subtype
 	Message   *CursorMessage  `json:"message"`    // Present for "user" and "assistant" types
 	ToolCall  json.RawMessage `json:"tool_call"`  // Present for "tool_call" type (varies by tool)
+	CallID    string          `json:"call_id"`    // Correlates tool_call started/completed events
 	SessionID string          `json:"session_id"` // Cursor session ID
+	// For "system" init events
+	Model string `json:"model"`
+	// For "thinking" type
+	Text string `json:"text"`
 	// For "result" type
-	DurationMs int `json:"duration_ms"`
+	DurationMs int          `json:"duration_ms"`
+	IsError    bool         `json:"is_error"`
+	Usage      *CursorUsage `json:"usage"`
+}
+
+// CursorUsage is the token usage reported on "result" events. cursor-agent
+// has used both camelCase and snake_case keys across versions.
+type CursorUsage struct {
+	InputTokens          int `json:"inputTokens"`
+	OutputTokens         int `json:"outputTokens"`
+	CacheReadTokens      int `json:"cacheReadTokens"`
+	CacheWriteTokens     int `json:"cacheWriteTokens"`
+	InputTokensSnake     int `json:"input_tokens"`
+	OutputTokensSnake    int `json:"output_tokens"`
+	CacheReadTokensSnake int `json:"cache_read_input_tokens"`
+}
+
+// TokenUsage is the normalized token usage attached to agent messages.
+type TokenUsage struct {
+	InputTokens     int `json:"input_tokens"`
+	OutputTokens    int `json:"output_tokens"`
+	CacheReadTokens int `json:"cache_read_tokens,omitempty"`
+	TotalTokens     int `json:"total_tokens"`
+}
+
+// Normalize converts the raw usage into TokenUsage, or nil if empty.
+func (u *CursorUsage) Normalize() *TokenUsage {
+	if u == nil {
+		return nil
+	}
+	t := &TokenUsage{
+		InputTokens:     u.InputTokens + u.InputTokensSnake,
+		OutputTokens:    u.OutputTokens + u.OutputTokensSnake,
+		CacheReadTokens: u.CacheReadTokens + u.CacheReadTokensSnake,
+	}
+	t.TotalTokens = t.InputTokens + t.OutputTokens
+	if t.TotalTokens == 0 && t.CacheReadTokens == 0 {
+		return nil
+	}
+	return t
 }
 
 // CursorMessage represents a user or assistant message.
@@ -87,14 +131,26 @@ type EditToolCallData struct {
 }
 
 type EditArgs struct {
-	Path string `json:"path"`
+	Path       string `json:"path"`
+	OldString  string `json:"oldString"`
+	NewString  string `json:"newString"`
+	StrReplace *struct {
+		OldText string `json:"oldText"`
+		NewText string `json:"newText"`
+	} `json:"strReplace"`
 }
 
 type EditResult struct {
-	Success *EditSuccess `json:"success"`
+	Success  *EditSuccess    `json:"success"`
+	Rejected *DeleteRejected `json:"rejected"`
 }
 
-type EditSuccess struct{}
+type EditSuccess struct {
+	Path         string `json:"path"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesRemoved int    `json:"linesRemoved"`
+	DiffString   string `json:"diffString"`
+}
 
 // WriteToolCall represents a file write operation.
 type WriteToolCall struct {
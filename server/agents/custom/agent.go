@@ -28,6 +28,10 @@ type AgentConfig struct {
 	Model       string            `json:"model,omitempty"`
 	Tools       map[string]bool   `json:"tools"`
 	Permissions map[string]string `json:"permissions,omitempty"`
+	// Protocol is how the agent is driven: ProtocolOpencode (empty) or
+	// ProtocolJSONL, which runs Command headlessly.
+	Protocol string   `json:"protocol,omitempty"`
+	Command  []string `json:"command,omitempty"`
 }
 
 type CustomAgent struct {
@@ -38,10 +42,15 @@ type CustomAgent struct {
 	Model           string            `json:"model,omitempty"`
 	Tools           map[string]bool   `json:"tools"`
 	Permissions     map[string]string `json:"permissions,omitempty"`
+	Protocol        string            `json:"protocol,omitempty"`
+	Command         []string          `json:"command,omitempty"`
 	HasSystemPrompt bool              `json:"hasSystemPrompt"`
 }
 
 func (a *AgentConfig) Validate() error {
+	if err := validateProtocol(a.Protocol, a.Command); err != nil {
+		return err
+	}
 	if a.Name == "" {
 		return nil // will use ID as name
 	}
@@ -155,6 +164,8 @@ func LoadAgent(agentID string) (*CustomAgent, error) {
 		Model:           cfg.Model,
 		Tools:           cfg.Tools,
 		Permissions:     cfg.Permissions,
+		Protocol:        cfg.Protocol,
+		Command:         cfg.Command,
 		HasSystemPrompt: hasSystemPrompt,
 	}, nil
 }
@@ -0,0 +1,194 @@
+package custom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+	"github.com/xhd2015/ai-critic/server/agents/procadapter"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+)
+
+// ProcessChat is a chat with a jsonl agent.
+type ProcessChat = procadapter.Session
+
+// GenericProcessAdapter drives a custom agent speaking ProtocolJSONL and
+// serves the same chat API as the cursor adapter, so the frontend's chat
+// interface drives it.
+type GenericProcessAdapter struct {
+	*procadapter.Adapter
+	agentID      string
+	projectDir   string
+	command      []string
+	systemPrompt string
+}
+
+// NewGenericProcessAdapter creates an adapter running the command of the
+// jsonl agent agentID in projectDir.
+func NewGenericProcessAdapter(agentID, projectDir string) (*GenericProcessAdapter, error) {
+	agent, err := LoadAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if agent == nil {
+		return nil, fmt.Errorf("agent not found: %s", agentID)
+	}
+	if agent.Protocol != ProtocolJSONL {
+		return nil, fmt.Errorf("agent %s does not speak the %s protocol", agentID, ProtocolJSONL)
+	}
+	if err := validateProtocol(agent.Protocol, agent.Command); err != nil {
+		return nil, err
+	}
+	systemPrompt, _ := GetSystemPrompt(agentID)
+	a := &GenericProcessAdapter{
+		agentID:      agentID,
+		projectDir:   projectDir,
+		command:      agent.Command,
+		systemPrompt: systemPrompt,
+	}
+	a.Adapter = procadapter.New(procadapter.Agent{
+		Name:          "agent",
+		SessionPrefix: agentID,
+		Info: procadapter.Info{
+			Name:       agentID,
+			Version:    ProtocolVersion,
+			ProviderID: "custom",
+			Capabilities: map[string]bool{
+				"chat":       true,
+				"streaming":  true,
+				"tool_calls": true,
+				"cancel":     false,
+			},
+		},
+		Command:       a.buildCommand,
+		ProcessStream: processStream,
+	}, agent.Model)
+	return a, nil
+}
+
+// buildCommand runs the agent's command with the prompt's request on stdin.
+func (a *GenericProcessAdapter) buildCommand(run procadapter.Run) (*exec.Cmd, error) {
+	req := ProtocolRequest{
+		Type:         "prompt",
+		Prompt:       run.Prompt,
+		SessionID:    run.ResumeID,
+		Model:        run.Model,
+		SystemPrompt: a.systemPrompt,
+	}
+	if execpolicy.Restricts(execpolicy.SourceAgent) {
+		req.Shell = ShellDeny
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(a.command[0], a.command[1:]...)
+	cmd.Dir = a.projectDir
+	cmd.Stdin = bytes.NewReader(append(line, '\n'))
+	cmd.Env = tool_resolve.AppendExtraPaths(append(os.Environ(), "AI_CRITIC_PROTOCOL="+ProtocolVersion))
+	return cmd, nil
+}
+
+// processStream reads the agent's events and converts them to chat messages
+// of model. It reports whether the run ended with a result event.
+func processStream(s *ProcessChat, r io.Reader, model string) bool {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var currentAssistant *ChatMessage
+	gotResult := false
+
+	for scanner.Scan() {
+		var event ProtocolEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "session":
+			if event.SessionID != "" {
+				s.SetResumeID(event.SessionID)
+			}
+
+		case "text":
+			if event.Text != "" {
+				currentAssistant = s.AppendText(currentAssistant, "text/plain", event.Text, model)
+			}
+
+		case "thinking":
+			if event.Text != "" {
+				currentAssistant = s.AppendText(currentAssistant, "text/thinking", event.Text, model)
+			}
+
+		case "tool_call":
+			currentAssistant = appendToolCall(s, currentAssistant, &event, model)
+
+		case "tool_result":
+			completeToolCall(s, &event)
+
+		case "result":
+			gotResult = true
+			if event.IsError {
+				text := event.Error
+				if text == "" {
+					text = "the agent failed"
+				}
+				currentAssistant = s.AppendPart(currentAssistant, MessagePart{ContentType: "text/plain", Content: "Error: " + text}, model, false)
+			}
+			s.Complete(currentAssistant, event.Usage.normalize())
+			currentAssistant = nil
+		}
+	}
+	return gotResult
+}
+
+// appendToolCall adds a running tool/call part for a tool_call event.
+func appendToolCall(s *ProcessChat, current *ChatMessage, event *ProtocolEvent, model string) *ChatMessage {
+	kind := event.Kind
+	switch kind {
+	case cursor.ToolKindFileEdit, cursor.ToolKindShell, cursor.ToolKindRead, cursor.ToolKindSearch:
+	default:
+		kind = cursor.ToolKindOther
+	}
+	// the input is shown as is, a string unquoted
+	args := string(event.Input)
+	var str string
+	if json.Unmarshal(event.Input, &str) == nil {
+		args = str
+	}
+	part := MessagePart{
+		ID:          "tool-" + event.ID,
+		ContentType: "tool/call",
+		Content:     args,
+		Name:        event.Name,
+		Metadata: map[string]interface{}{
+			"kind":    kind,
+			"status":  "running",
+			"call_id": event.ID,
+		},
+	}
+	return s.AppendPart(current, part, model, false)
+}
+
+// completeToolCall records a tool_result on the tool/call part it answers.
+func completeToolCall(s *ProcessChat, event *ProtocolEvent) {
+	meta := map[string]interface{}{"status": "completed"}
+	if event.Status == "error" {
+		meta["status"] = "error"
+	}
+	output := event.Output
+	if len(output) > 200 {
+		output = output[:200] + "..."
+	}
+	if output != "" {
+		meta["output"] = output
+	}
+	s.UpdateToolCall(event.ID, meta)
+}
@@ -0,0 +1,116 @@
+package custom
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+func TestAgentConfigValidateProtocol(t *testing.T) {
+	tests := []struct {
+		cfg     AgentConfig
+		wantErr bool
+	}{
+		{AgentConfig{}, false},
+		{AgentConfig{Protocol: ProtocolOpencode}, false},
+		{AgentConfig{Protocol: ProtocolJSONL, Command: []string{"./agent"}}, false},
+		{AgentConfig{Protocol: ProtocolJSONL}, true},
+		{AgentConfig{Protocol: "acp"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v, want error %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenericProcessAdapter(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	// The fake agent answers with the request it read, then edits a file.
+	script := `#!/bin/sh
+read -r req
+echo "starting" >&2
+echo '{"type":"session","session_id":"s-1"}'
+echo 'not json'
+echo '{"type":"thinking","text":"Hmm."}'
+printf '{"type":"text","text":%s}\n' "$(printf '%s' "$AI_CRITIC_PROTOCOL $req" | sed 's/\\/\\\\/g; s/"/\\"/g; s/^/"/; s/$/"/')"
+echo '{"type":"tool_call","id":"t1","name":"edit","kind":"file_edit","input":{"path":"a.go"}}'
+echo '{"type":"tool_result","id":"t1","status":"error","output":"no such file"}'
+echo '{"type":"result","usage":{"input_tokens":10,"output_tokens":5}}'
+`
+	bin := filepath.Join(dir, "agent")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAgent("fake", &AgentConfig{Name: "fake", Protocol: ProtocolJSONL, Command: []string{bin}, Model: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewGenericProcessAdapter("fake", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := a.CreateSession()
+	if err := s.SendPrompt("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if s.ResumeID != "s-1" {
+		t.Errorf("resume id %q", s.ResumeID)
+	}
+
+	msgs := s.GetMessages()
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	m := msgs[1]
+	if m.Model != "m1" || m.Usage == nil || m.Usage.TotalTokens != 15 {
+		t.Errorf("message %+v", m)
+	}
+	if len(m.Parts) != 3 {
+		t.Fatalf("parts %+v", m.Parts)
+	}
+	if want := `jsonl/1 {"type":"prompt","prompt":"hello","model":"m1"}`; m.Parts[1].Content != want {
+		t.Errorf("text %q, want %q", m.Parts[1].Content, want)
+	}
+	tool := m.Parts[2]
+	if tool.Name != "edit" || tool.Content != `{"path":"a.go"}` || tool.Metadata["kind"] != cursor.ToolKindFileEdit ||
+		tool.Metadata["status"] != "error" || tool.Metadata["output"] != "no such file" {
+		t.Errorf("tool part %+v", tool)
+	}
+
+	// the next prompt continues the conversation
+	if err := s.SendPrompt("again"); err != nil {
+		t.Fatal(err)
+	}
+	msgs = s.GetMessages()
+	if !strings.Contains(msgs[3].Parts[1].Content, `"session_id":"s-1"`) {
+		t.Errorf("second run %q", msgs[3].Parts[1].Content)
+	}
+}
+
+func TestGenericProcessAdapterReportsFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "agent")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho 'missing API key' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAgent("broken", &AgentConfig{Protocol: ProtocolJSONL, Command: []string{bin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewGenericProcessAdapter("broken", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := a.CreateSession()
+	s.SendPrompt("hi")
+	msgs := s.GetMessages()
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Parts[0].Content, "missing API key") {
+		t.Errorf("failed run reported %+v", last)
+	}
+}
@@ -0,0 +1,115 @@
+package custom
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// jsonl agents are chatted with in the protocol of the cursor adapter, so
+// the frontend renders them with the same components.
+type (
+	ChatMessage = cursor.ChatMessage
+	MessagePart = cursor.MessagePart
+	ACPEvent    = cursor.ACPEvent
+	TokenUsage  = cursor.TokenUsage
+)
+
+// Protocols a custom agent can be driven by.
+const (
+	// ProtocolOpencode (the default) runs the agent as an opencode agent
+	// generated from its config, behind `opencode serve`.
+	ProtocolOpencode = "opencode"
+	// ProtocolJSONL runs the agent's own command once per prompt and talks
+	// to it in JSON lines, see ProtocolRequest and ProtocolEvent.
+	ProtocolJSONL = "jsonl"
+)
+
+// ProtocolVersion is passed to jsonl agents as AI_CRITIC_PROTOCOL.
+const ProtocolVersion = "jsonl/1"
+
+// ProtocolRequest is the single line a jsonl agent reads from stdin before
+// stdin is closed. The agent runs in the project directory with
+// AI_CRITIC_PROTOCOL set to ProtocolVersion.
+type ProtocolRequest struct {
+	Type   string `json:"type"` // always "prompt"
+	Prompt string `json:"prompt"`
+	// SessionID is the id the agent reported for the conversation in an
+	// earlier run, empty for the first prompt of a chat.
+	SessionID    string `json:"session_id,omitempty"`
+	Model        string `json:"model,omitempty"`
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Shell is "deny" while the exec policy could stop an agent command:
+	// the agent must not run shell commands, since nothing can ask the
+	// policy for it. Empty means they are allowed.
+	Shell string `json:"shell,omitempty"`
+}
+
+// ShellDeny is the ProtocolRequest.Shell that forbids shell commands.
+const ShellDeny = "deny"
+
+// ProtocolEvent is a line a jsonl agent writes to stdout. Lines that are not
+// JSON objects are ignored, so the agent may log to stdout, but stderr is
+// where diagnostics belong: its tail is shown if the agent fails.
+//
+//	{"type":"session","session_id":"abc"}           id to continue the conversation with
+//	{"type":"text","text":"..."}                    answer text, appended to the message
+//	{"type":"thinking","text":"..."}                reasoning, appended the same way
+//	{"type":"tool_call","id":"t1","name":"shell","kind":"shell","input":{"command":"ls"}}
+//	{"type":"tool_result","id":"t1","status":"completed","output":"..."}
+//	{"type":"result","usage":{"input_tokens":10,"output_tokens":5}}
+//	{"type":"result","is_error":true,"error":"..."} the run failed
+//
+// A run ends with one result event. The kind of a tool call is one of
+// "file_edit", "shell", "read", "search" and "other" (the default); the
+// status of a result is "completed" (the default) or "error".
+type ProtocolEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+	// For tool_call and tool_result events
+	ID     string          `json:"id,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Kind   string          `json:"kind,omitempty"`
+	Input  json.RawMessage `json:"input,omitempty"`
+	Status string          `json:"status,omitempty"`
+	Output string          `json:"output,omitempty"`
+	// For result events
+	IsError bool           `json:"is_error,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Usage   *ProtocolUsage `json:"usage,omitempty"`
+}
+
+// ProtocolUsage is the token usage of a run.
+type ProtocolUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// validateProtocol checks that protocol is known and that a jsonl agent
+// has a command to run.
+func validateProtocol(protocol string, command []string) error {
+	switch protocol {
+	case "", ProtocolOpencode:
+		return nil
+	case ProtocolJSONL:
+		if len(command) == 0 || command[0] == "" {
+			return fmt.Errorf("a %s agent needs a command", ProtocolJSONL)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown protocol %q, want %q or %q", protocol, ProtocolOpencode, ProtocolJSONL)
+	}
+}
+
+func (u *ProtocolUsage) normalize() *TokenUsage {
+	if u == nil || u.InputTokens+u.OutputTokens == 0 {
+		return nil
+	}
+	return &TokenUsage{
+		InputTokens:  u.InputTokens,
+		OutputTokens: u.OutputTokens,
+		TotalTokens:  u.InputTokens + u.OutputTokens,
+	}
+}
@@ -72,6 +72,10 @@ func LaunchCustomAgent(agentID string, projectDir string, resumeSessionID string
 		return nil, fmt.Errorf("invalid project directory: %s", projectDir)
 	}
 
+	if agent.Protocol == custom.ProtocolJSONL {
+		return launchJSONLCustomAgent(agent, projectDir, sessionID, createdAt)
+	}
+
 	if err := custom.GenerateOpencodeConfig(agentID); err != nil {
 		return nil, fmt.Errorf("failed to generate config: %w", err)
 	}
@@ -167,6 +171,58 @@ func LaunchCustomAgent(agentID string, projectDir string, resumeSessionID string
 	}, nil
 }
 
+// launchJSONLCustomAgent starts a session of a jsonl agent: no process runs
+// until a prompt arrives, the adapter runs the agent's command per prompt.
+func launchJSONLCustomAgent(agent *custom.CustomAgent, projectDir, sessionID string, createdAt time.Time) (*LaunchCustomAgentResult, error) {
+	adapter, err := custom.NewGenericProcessAdapter(agent.ID, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	if sessionID == "" {
+		sessionID = fmt.Sprintf("%s-%d", agent.ID, now.UnixMilli())
+	}
+
+	session := &customAgentSession{
+		id:         sessionID,
+		agentID:    agent.ID,
+		agentName:  agent.Name,
+		projectDir: projectDir,
+		createdAt:  createdAt,
+		adapter:    adapter,
+	}
+	sessionsMu.Lock()
+	if customAgentSessions == nil {
+		customAgentSessions = make(map[string]*customAgentSession)
+	}
+	customAgentSessions[sessionID] = session
+	sessionsMu.Unlock()
+
+	custom.SaveSession(&custom.SessionData{
+		ID:         sessionID,
+		AgentID:    agent.ID,
+		AgentName:  agent.Name,
+		ProjectDir: projectDir,
+		CreatedAt:  createdAt.Format(time.RFC3339),
+		Status:     "running",
+	})
+	return &LaunchCustomAgentResult{SessionID: sessionID}, nil
+}
+
+// CustomAgentAdapter returns the in-process handler of a running jsonl
+// agent session, or nil if the session runs behind opencode serve.
+func CustomAgentAdapter(sessionID string) http.Handler {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if session := customAgentSessions[sessionID]; session != nil && session.adapter != nil {
+		return session.adapter
+	}
+	return nil
+}
+
 func monitorCustomAgentProcess(session *customAgentSession) {
 	if session.cmd == nil {
 		return
@@ -196,6 +252,8 @@ type customAgentSession struct {
 	port       int
 	createdAt  time.Time
 	cmd        *exec.Cmd
+	// adapter serves jsonl agents in-process; cmd is nil for them
+	adapter *custom.GenericProcessAdapter
 }
 
 var (
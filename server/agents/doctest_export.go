@@ -27,7 +27,7 @@ func TestExported_StripOpencodeResolutionForDoctest(t *testing.T) {
 
 func TestExported_LaunchAgentSession(agentID, projectDir, model string) (AgentSessionInfo, error) {
 	_ = model
-	s, err := sessionMgr.launch(agentID, projectDir, "")
+	s, err := sessionMgr.launch("", "", agentID, projectDir, "", nil)
 	if err != nil {
 		return AgentSessionInfo{}, err
 	}
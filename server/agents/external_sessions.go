@@ -0,0 +1,331 @@
+package agents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	opencode_internal "github.com/xhd2015/ai-critic/server/agents/opencode/internal_opencode"
+)
+
+// Bulk actions accepted by /api/agents/external-sessions/bulk.
+const (
+	externalSessionActionDelete  = "delete"
+	externalSessionActionArchive = "archive"
+)
+
+// externalSessionFilter narrows the sessions reported by the opencode server.
+type externalSessionFilter struct {
+	// ProjectDir keeps only sessions whose directory equals this path.
+	ProjectDir string
+	// MaxAge keeps only sessions updated within this duration (0 = no limit).
+	MaxAge time.Duration
+	// OlderThan keeps only sessions not updated within this duration (0 = no limit).
+	OlderThan time.Duration
+	// IncludeMissing keeps sessions whose project directory no longer exists.
+	IncludeMissing bool
+	// OnlyMissing keeps only sessions whose project directory no longer exists.
+	OnlyMissing bool
+}
+
+// parseExternalSessionFilter reads project_dir, max_age, older_than,
+// include_missing and only_missing from the query string.
+func parseExternalSessionFilter(r *http.Request) (externalSessionFilter, error) {
+	q := r.URL.Query()
+	f := externalSessionFilter{
+		ProjectDir:     q.Get("project_dir"),
+		IncludeMissing: q.Get("include_missing") == "true" || q.Get("include_missing") == "1",
+		OnlyMissing:    q.Get("only_missing") == "true" || q.Get("only_missing") == "1",
+	}
+	var err error
+	if v := q.Get("max_age"); v != "" {
+		if f.MaxAge, err = time.ParseDuration(v); err != nil {
+			return f, fmt.Errorf("invalid max_age: %w", err)
+		}
+	}
+	if v := q.Get("older_than"); v != "" {
+		if f.OlderThan, err = time.ParseDuration(v); err != nil {
+			return f, fmt.Errorf("invalid older_than: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// externalSessionDir returns the session's project directory, or "".
+func externalSessionDir(session map[string]interface{}) string {
+	dir, _ := session["directory"].(string)
+	return dir
+}
+
+// externalSessionUpdated returns the session's last update time
+// (falling back to its creation time), or the zero time if unknown.
+func externalSessionUpdated(session map[string]interface{}) time.Time {
+	t, _ := session["time"].(map[string]interface{})
+	for _, key := range []string{"updated", "created"} {
+		if ms, ok := t[key].(float64); ok && ms > 0 {
+			return time.UnixMilli(int64(ms))
+		}
+	}
+	return time.Time{}
+}
+
+// dirExists reports whether dir exists, caching lookups in cache.
+func dirExists(dir string, cache map[string]bool) bool {
+	if exists, ok := cache[dir]; ok {
+		return exists
+	}
+	info, err := os.Stat(dir)
+	exists := err == nil && info.IsDir()
+	cache[dir] = exists
+	return exists
+}
+
+// apply returns the sessions matching f and the number hidden because
+// their project directory no longer exists.
+func (f externalSessionFilter) apply(sessions []map[string]interface{}, now time.Time) (kept []map[string]interface{}, hidden int) {
+	projectDir := ""
+	if f.ProjectDir != "" {
+		projectDir = filepath.Clean(f.ProjectDir)
+	}
+	existsCache := make(map[string]bool)
+	kept = []map[string]interface{}{}
+	for _, s := range sessions {
+		dir := externalSessionDir(s)
+		if projectDir != "" && filepath.Clean(dir) != projectDir {
+			continue
+		}
+		updated := externalSessionUpdated(s)
+		if f.MaxAge > 0 && (updated.IsZero() || now.Sub(updated) > f.MaxAge) {
+			continue
+		}
+		if f.OlderThan > 0 && !updated.IsZero() && now.Sub(updated) <= f.OlderThan {
+			continue
+		}
+		missing := dir != "" && !dirExists(dir, existsCache)
+		if f.OnlyMissing {
+			if !missing {
+				continue
+			}
+		} else if missing && !f.IncludeMissing {
+			hidden++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept, hidden
+}
+
+// fetchExternalSessions lists all sessions known to the opencode server.
+// authRequired is true when the server rejected the request with 401.
+func fetchExternalSessions(port int) (sessions []map[string]interface{}, authRequired bool, err error) {
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/session", port))
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("opencode server returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return nil, false, err
+	}
+	return sessions, false, nil
+}
+
+// externalSessionBulkRequest selects sessions either explicitly by IDs or by
+// the same filters as the list endpoint.
+type externalSessionBulkRequest struct {
+	Action      string   `json:"action"` // "delete" or "archive"
+	IDs         []string `json:"ids,omitempty"`
+	ProjectDir  string   `json:"project_dir,omitempty"`
+	OlderThan   string   `json:"older_than,omitempty"` // Go duration, e.g. "720h"
+	OnlyMissing bool     `json:"only_missing,omitempty"`
+	DryRun      bool     `json:"dry_run,omitempty"`
+}
+
+type externalSessionBulkResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// targets resolves the sessions a bulk request acts on: its IDs, or else
+// the sessions matching its filter, of which there must be one. Running
+// sessions are never touched; they are returned as failed results instead.
+func (req externalSessionBulkRequest) targets(sessions []map[string]interface{}, running map[string]bool, now time.Time) (ids []string, skipped []externalSessionBulkResult, err error) {
+	candidates := req.IDs
+	if len(candidates) == 0 {
+		f := externalSessionFilter{
+			ProjectDir:     req.ProjectDir,
+			OnlyMissing:    req.OnlyMissing,
+			IncludeMissing: true,
+		}
+		if req.OlderThan != "" {
+			if f.OlderThan, err = time.ParseDuration(req.OlderThan); err != nil {
+				return nil, nil, fmt.Errorf("invalid older_than: %w", err)
+			}
+		}
+		if f.ProjectDir == "" && f.OlderThan == 0 && !f.OnlyMissing {
+			return nil, nil, fmt.Errorf("refusing to act on all sessions: pass ids or a filter")
+		}
+		matched, _ := f.apply(sessions, now)
+		for _, s := range matched {
+			if id, _ := s["id"].(string); id != "" {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+	for _, id := range candidates {
+		if running[id] {
+			skipped = append(skipped, externalSessionBulkResult{ID: id, Error: "session is running"})
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, skipped, nil
+}
+
+// fetchRunningExternalSessions returns the IDs of the sessions the opencode
+// server is working on. Servers too old to report session status are
+// treated as having none.
+func fetchRunningExternalSessions(port int) (map[string]bool, error) {
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/session/status", port))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	running := make(map[string]bool)
+	if resp.StatusCode != http.StatusOK {
+		return running, nil
+	}
+	var statuses map[string]struct {
+		Type string `json:"type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return nil, err
+	}
+	for id, st := range statuses {
+		if st.Type != "" && st.Type != "idle" {
+			running[id] = true
+		}
+	}
+	return running, nil
+}
+
+// handleExternalSessionsBulk archives or deletes many external sessions in one
+// call by passing each operation through to the opencode server. Sessions
+// that are running are skipped.
+func handleExternalSessionsBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req externalSessionBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Action != externalSessionActionDelete && req.Action != externalSessionActionArchive {
+		http.Error(w, fmt.Sprintf("unknown action %q (want delete or archive)", req.Action), http.StatusBadRequest)
+		return
+	}
+
+	server, err := opencode_internal.GetOrStartOpencodeServer()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// sessions are only needed to resolve a filter
+	var sessions []map[string]interface{}
+	if len(req.IDs) == 0 {
+		var authRequired bool
+		sessions, authRequired, err = fetchExternalSessions(server.Port)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if authRequired {
+			http.Error(w, "opencode server requires authentication", http.StatusUnauthorized)
+			return
+		}
+	}
+	running, err := fetchRunningExternalSessions(server.Port)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ids, skipped, err := req.targets(sessions, running, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]externalSessionBulkResult, 0, len(ids)+len(skipped))
+	results = append(results, skipped...)
+	for _, id := range ids {
+		res := externalSessionBulkResult{ID: id, OK: true}
+		if !req.DryRun {
+			if err := applyExternalSessionAction(server.Port, req.Action, id); err != nil {
+				res.OK = false
+				res.Error = err.Error()
+			}
+		}
+		results = append(results, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"action":  req.Action,
+		"dry_run": req.DryRun,
+		"results": results,
+	})
+}
+
+// applyExternalSessionAction deletes or archives one session on the opencode server.
+func applyExternalSessionAction(port int, action, id string) error {
+	if strings.ContainsAny(id, "/?#") {
+		return fmt.Errorf("invalid session id")
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/session/%s", port, id)
+
+	var req *http.Request
+	var err error
+	switch action {
+	case externalSessionActionDelete:
+		req, err = http.NewRequest(http.MethodDelete, url, nil)
+	case externalSessionActionArchive:
+		body, _ := json.Marshal(map[string]interface{}{
+			"time": map[string]int64{"archived": time.Now().UnixMilli()},
+		})
+		req, err = http.NewRequest(http.MethodPatch, url, bytes.NewReader(body))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("opencode server returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package agents
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func externalSession(id, dir string, updated time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        id,
+		"directory": dir,
+		"time":      map[string]interface{}{"updated": float64(updated.UnixMilli())},
+	}
+}
+
+func sessionIDs(sessions []map[string]interface{}) []string {
+	ids := []string{}
+	for _, s := range sessions {
+		ids = append(ids, s["id"].(string))
+	}
+	return ids
+}
+
+func TestExternalSessionFilterApply(t *testing.T) {
+	now := time.Now()
+	project := t.TempDir()
+	gone := project + "/gone"
+	sessions := []map[string]interface{}{
+		externalSession("fresh", project, now.Add(-time.Hour)),
+		externalSession("old", project, now.Add(-48*time.Hour)),
+		externalSession("orphan", gone, now.Add(-time.Hour)),
+		externalSession("other", t.TempDir(), now.Add(-time.Hour)),
+		{"id": "undated", "directory": project},
+	}
+
+	tests := []struct {
+		name       string
+		filter     externalSessionFilter
+		want       []string
+		wantHidden int
+	}{
+		{"default hides missing dirs", externalSessionFilter{}, []string{"fresh", "old", "other", "undated"}, 1},
+		{"include missing", externalSessionFilter{IncludeMissing: true}, []string{"fresh", "old", "orphan", "other", "undated"}, 0},
+		{"only missing", externalSessionFilter{OnlyMissing: true}, []string{"orphan"}, 0},
+		{"project dir", externalSessionFilter{ProjectDir: project + "/"}, []string{"fresh", "old", "undated"}, 0},
+		{"max age drops undated", externalSessionFilter{MaxAge: 24 * time.Hour}, []string{"fresh", "other"}, 1},
+		{"older than keeps undated", externalSessionFilter{OlderThan: 24 * time.Hour}, []string{"old", "undated"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, hidden := tt.filter.apply(sessions, now)
+			if got := sessionIDs(kept); !reflect.DeepEqual(got, tt.want) || hidden != tt.wantHidden {
+				t.Errorf("apply = %v, %d hidden; want %v, %d hidden", got, hidden, tt.want, tt.wantHidden)
+			}
+		})
+	}
+}
+
+func TestExternalSessionBulkTargets(t *testing.T) {
+	now := time.Now()
+	project := t.TempDir()
+	sessions := []map[string]interface{}{
+		externalSession("old", project, now.Add(-48*time.Hour)),
+		externalSession("busy", project, now.Add(-48*time.Hour)),
+		externalSession("fresh", project, now.Add(-time.Hour)),
+	}
+	running := map[string]bool{"busy": true}
+
+	tests := []struct {
+		name        string
+		req         externalSessionBulkRequest
+		wantIDs     []string
+		wantSkipped []string
+		wantErr     bool
+	}{
+		{"no selection", externalSessionBulkRequest{}, nil, nil, true},
+		{"empty ids", externalSessionBulkRequest{IDs: []string{}}, nil, nil, true},
+		{"bad duration", externalSessionBulkRequest{OlderThan: "a month"}, nil, nil, true},
+		{"filter matches nothing", externalSessionBulkRequest{ProjectDir: t.TempDir()}, nil, nil, false},
+		{"filter skips running", externalSessionBulkRequest{OlderThan: "24h"}, []string{"old"}, []string{"busy"}, false},
+		{"ids skip running", externalSessionBulkRequest{IDs: []string{"busy", "fresh"}}, []string{"fresh"}, []string{"busy"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, skipped, err := tt.req.targets(sessions, running, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			var skippedIDs []string
+			for _, r := range skipped {
+				if r.OK || r.Error == "" {
+					t.Errorf("skipped result %+v is not a failure", r)
+				}
+				skippedIDs = append(skippedIDs, r.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(skippedIDs, tt.wantSkipped) {
+				t.Errorf("targets = %v, skipped %v; want %v, skipped %v", ids, skippedIDs, tt.wantIDs, tt.wantSkipped)
+			}
+		})
+	}
+}
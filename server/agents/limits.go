@@ -0,0 +1,312 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceLimits bound each process-backed agent session. Zero values mean
+// no limit.
+type ResourceLimits struct {
+	// CPUPercent is the CPU the session may use, 100 per core.
+	CPUPercent int `json:"cpu_percent,omitempty"`
+	// MemoryMB is the memory the session may use.
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// MaxDuration is how long the session may run, a Go duration like "2h".
+	MaxDuration string `json:"max_duration,omitempty"`
+	// CgroupParent is a delegated cgroup v2 directory to create session
+	// cgroups in; by default they go below the server's own cgroup.
+	CgroupParent string `json:"cgroup_parent,omitempty"`
+}
+
+// Enforcement of the limits of a session.
+const (
+	// EnforcementCgroup: the kernel throttles CPU and kills the session
+	// when it runs out of memory (Linux, cgroup v2).
+	EnforcementCgroup = "cgroup"
+	// EnforcementWatchdog: the server samples the agent process and kills
+	// it when it goes over a limit. Rlimits on address space would be the
+	// usual fallback, but the JavaScript runtimes agents run on reserve far
+	// more virtual memory than they use.
+	EnforcementWatchdog = "watchdog"
+)
+
+// LimitStatus is how the limits of a session are enforced.
+type LimitStatus struct {
+	ResourceLimits
+	Enforcement string `json:"enforcement"`
+	// Note says why cgroups are not used, if they are not.
+	Note string `json:"note,omitempty"`
+	// Exceeded describes the limit that ended the session.
+	Exceeded string `json:"exceeded,omitempty"`
+}
+
+// watchdogInterval is how often the watchdog samples; cpuWindow samples
+// make up the span the CPU use is averaged over.
+var (
+	watchdogInterval = 5 * time.Second
+	cpuWindow        = 6
+)
+
+func (l ResourceLimits) set() bool {
+	return l.CPUPercent > 0 || l.MemoryMB > 0 || l.MaxDuration != ""
+}
+
+// Validate checks l.
+func (l ResourceLimits) Validate() error {
+	if l.CPUPercent < 0 || l.MemoryMB < 0 {
+		return fmt.Errorf("cpu_percent and memory_mb must not be negative")
+	}
+	if l.MaxDuration != "" {
+		if d, err := time.ParseDuration(l.MaxDuration); err != nil || d <= 0 {
+			return fmt.Errorf("max_duration must be a positive duration like 2h")
+		}
+	}
+	return nil
+}
+
+// GetResourceLimits returns the limits for agent sessions.
+func GetResourceLimits() ResourceLimits {
+	cfg, err := LoadConfig()
+	if err != nil || cfg.Limits == nil {
+		return ResourceLimits{}
+	}
+	return *cfg.Limits
+}
+
+// SetResourceLimits validates and saves the limits for agent sessions
+// launched from now on.
+func SetResourceLimits(l ResourceLimits) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		cfg = &AgentsConfig{Agents: make(map[string]AgentConfig)}
+	}
+	cfg.Limits = nil
+	if l.set() {
+		cfg.Limits = &l
+	}
+	return SaveConfig(cfg)
+}
+
+// limiter enforces the limits of one session's process.
+type limiter struct {
+	pid    int
+	cgroup *cgroup
+	stop   chan struct{}
+	timer  *time.Timer
+
+	mu     sync.Mutex
+	status LimitStatus
+}
+
+// applyLimits puts the started cmd of session id under the configured
+// limits, killing it when one is exceeded. It returns nil if none are set.
+func applyLimits(id string, cmd *exec.Cmd) *limiter {
+	limits := GetResourceLimits()
+	if !limits.set() || cmd.Process == nil {
+		return nil
+	}
+	l := &limiter{
+		pid:    cmd.Process.Pid,
+		stop:   make(chan struct{}),
+		status: LimitStatus{ResourceLimits: limits},
+	}
+	if limits.CPUPercent > 0 || limits.MemoryMB > 0 {
+		cg, err := newCgroup(limits.CgroupParent, id, limits)
+		if err == nil {
+			err = cg.add(l.pid)
+			if err != nil {
+				cg.remove()
+			}
+		}
+		if err != nil {
+			log.Infof("agent session %s: no cgroup, using the watchdog: %v", id, err)
+			l.status.Enforcement = EnforcementWatchdog
+			l.status.Note = err.Error()
+			go l.watch(limits)
+		} else {
+			l.cgroup = cg
+			l.status.Enforcement = EnforcementCgroup
+		}
+	} else {
+		l.status.Enforcement = EnforcementWatchdog
+	}
+	if d, err := time.ParseDuration(limits.MaxDuration); err == nil && d > 0 {
+		l.timer = time.AfterFunc(d, func() {
+			l.exceed(fmt.Sprintf("ran longer than the time limit of %s", d))
+		})
+	}
+	return l
+}
+
+// exceed records the limit exceeded, if it is the first, and kills the
+// process.
+func (l *limiter) exceed(reason string) {
+	l.mu.Lock()
+	if l.status.Exceeded != "" {
+		l.mu.Unlock()
+		return
+	}
+	l.status.Exceeded = reason
+	l.mu.Unlock()
+	if l.cgroup == nil || l.cgroup.kill() != nil {
+		if p, err := os.FindProcess(l.pid); err == nil {
+			p.Kill()
+		}
+	}
+}
+
+// watch samples the process until release, killing it when its memory or
+// CPU use goes over the limits.
+func (l *limiter) watch(limits ResourceLimits) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	type sample struct {
+		at  time.Time
+		cpu time.Duration
+	}
+	var samples []sample
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		rssKB, cpu, err := processUsage(l.pid)
+		if err != nil {
+			continue // exited, or ps is missing
+		}
+		if limits.MemoryMB > 0 && rssKB > int64(limits.MemoryMB)*1024 {
+			l.exceed(fmt.Sprintf("used %d MB of memory, over the limit of %d MB", rssKB/1024, limits.MemoryMB))
+			return
+		}
+		if limits.CPUPercent <= 0 {
+			continue
+		}
+		samples = append(samples, sample{time.Now(), cpu})
+		if len(samples) <= cpuWindow {
+			continue
+		}
+		samples = samples[1:]
+		first, last := samples[0], samples[len(samples)-1]
+		percent := int(100 * (last.cpu - first.cpu) / last.at.Sub(first.at))
+		if percent > limits.CPUPercent {
+			l.exceed(fmt.Sprintf("used %d%% CPU over %s, over the limit of %d%%", percent, last.at.Sub(first.at).Round(time.Second), limits.CPUPercent))
+			return
+		}
+	}
+}
+
+// release stops enforcing after the process exited, noting an out of
+// memory kill by the cgroup, and returns the final status.
+func (l *limiter) release() LimitStatus {
+	close(l.stop)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	if l.cgroup != nil {
+		if l.cgroup.oomKilled() {
+			l.mu.Lock()
+			if l.status.Exceeded == "" {
+				l.status.Exceeded = fmt.Sprintf("ran out of its memory limit of %d MB", l.status.MemoryMB)
+			}
+			l.mu.Unlock()
+		}
+		l.cgroup.remove()
+	}
+	return l.snapshot()
+}
+
+func (l *limiter) snapshot() LimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// processUsage returns the resident memory and the CPU time used so far
+// by pid, as ps reports them on Linux and macOS.
+func processUsage(pid int) (int64, time.Duration, error) {
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected ps output %q", out)
+	}
+	rss, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parse rss %q: %w", fields[0], err)
+	}
+	cpu, err := parseCPUTime(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return rss, cpu, nil
+}
+
+// parseCPUTime parses ps's cumulative CPU time, [DD-][HH:]MM:SS[.ss].
+func parseCPUTime(s string) (time.Duration, error) {
+	var days time.Duration
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("parse cpu time %q", s)
+		}
+		days, s = time.Duration(n)*24*time.Hour, rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("parse cpu time %q", s)
+	}
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse cpu time %q", s)
+	}
+	total := days + time.Duration(sec*float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("parse cpu time %q", s)
+		}
+		total += time.Duration(n) * unit
+		unit *= 60
+	}
+	return total, nil
+}
+
+// handleAgentLimits gets and sets the resource limits of agent sessions.
+//
+//	GET /api/agents/limits                  -> ResourceLimits
+//	PUT /api/agents/limits {ResourceLimits} -> ResourceLimits
+func handleAgentLimits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var l ResourceLimits
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := SetResourceLimits(l); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetResourceLimits())
+}
@@ -0,0 +1,132 @@
+package agents
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupMount is where the cgroup v2 hierarchy is mounted.
+const cgroupMount = "/sys/fs/cgroup"
+
+// cpuPeriod is the cpu.max period, in microseconds.
+const cpuPeriod = 100000
+
+// cgroup is the cgroup v2 directory of one session.
+type cgroup struct {
+	dir string
+}
+
+// newCgroup creates the cgroup of session id below parent, or below the
+// server's own cgroup if parent is empty, with the limits written.
+func newCgroup(parent, id string, limits ResourceLimits) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", cgroupMount)
+	}
+	if parent == "" {
+		own, err := ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+		// a cgroup with processes in it cannot pass controllers to children,
+		// so the sessions share a child of the server's cgroup
+		parent = filepath.Join(own, "ai-critic-agents")
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return nil, fmt.Errorf("create cgroup: %w", err)
+		}
+		if err := enableControllers(own); err != nil {
+			return nil, err
+		}
+	}
+	if err := enableControllers(parent); err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: filepath.Join(parent, id)}
+	if err := os.Mkdir(cg.dir, 0755); err != nil {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+	err := cg.write("memory.oom.group", "1")
+	if err == nil && limits.MemoryMB > 0 {
+		err = cg.write("memory.max", strconv.FormatInt(int64(limits.MemoryMB)<<20, 10))
+		cg.write("memory.swap.max", "0") // absent without swap accounting
+	}
+	if err == nil && limits.CPUPercent > 0 {
+		err = cg.write("cpu.max", fmt.Sprintf("%d %d", limits.CPUPercent*cpuPeriod/100, cpuPeriod))
+	}
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	return cg, nil
+}
+
+// ownCgroup returns the directory of the server's cgroup.
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return filepath.Join(cgroupMount, path), nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+func enableControllers(dir string) error {
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644); err != nil {
+		return fmt.Errorf("enable cpu and memory controllers in %s: %w", dir, err)
+	}
+	return nil
+}
+
+func (cg *cgroup) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(cg.dir, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("set %s: %w", file, err)
+	}
+	return nil
+}
+
+// add moves pid into the cgroup. Processes it started before then stay
+// outside.
+func (cg *cgroup) add(pid int) error {
+	return cg.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// kill kills every process in the cgroup.
+func (cg *cgroup) kill() error {
+	return cg.write("cgroup.kill", "1")
+}
+
+// oomKilled reports whether the kernel killed the cgroup for running out
+// of memory.
+func (cg *cgroup) oomKilled() bool {
+	data, err := os.ReadFile(filepath.Join(cg.dir, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if n, ok := strings.CutPrefix(line, "oom_kill "); ok {
+			return n != "0"
+		}
+	}
+	return false
+}
+
+// remove deletes the cgroup once its processes are gone.
+func (cg *cgroup) remove() {
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(cg.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	log.Warnf("remove cgroup %s: still in use", cg.dir)
+}
@@ -0,0 +1,90 @@
+package agents
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCPUTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"00:00:07", 7 * time.Second},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"2-00:00:01", 48*time.Hour + time.Second},
+		{"1:23.50", time.Minute + 23500*time.Millisecond},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUTime(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseCPUTime(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	if _, err := parseCPUTime("soon"); err == nil {
+		t.Error("parsed garbage")
+	}
+}
+
+// useLimits makes applyLimits see l, with cgroups unavailable.
+func useLimits(t *testing.T, l ResourceLimits) {
+	t.Helper()
+	l.CgroupParent = filepath.Join(t.TempDir(), "missing")
+	configMu.Lock()
+	old := agentConfig
+	agentConfig = &AgentsConfig{Agents: map[string]AgentConfig{}, Limits: &l}
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		agentConfig = old
+		configMu.Unlock()
+	})
+}
+
+func runLimited(t *testing.T, name string, args ...string) LimitStatus {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	l := applyLimits("agent-session-test", cmd)
+	if l == nil {
+		cmd.Process.Kill()
+		t.Fatal("no limiter")
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("limit not enforced")
+	}
+	return l.release()
+}
+
+func TestTimeLimit(t *testing.T) {
+	useLimits(t, ResourceLimits{MaxDuration: "200ms"})
+	st := runLimited(t, "sleep", "30")
+	if st.Enforcement != EnforcementWatchdog || !strings.Contains(st.Exceeded, "time limit") {
+		t.Errorf("status %+v", st)
+	}
+}
+
+func TestWatchdogCPULimit(t *testing.T) {
+	oldInterval, oldWindow := watchdogInterval, cpuWindow
+	watchdogInterval, cpuWindow = 100*time.Millisecond, 5
+	t.Cleanup(func() { watchdogInterval, cpuWindow = oldInterval, oldWindow })
+
+	useLimits(t, ResourceLimits{CPUPercent: 10})
+	st := runLimited(t, "sh", "-c", "while :; do :; done")
+	if st.Enforcement != EnforcementWatchdog || st.Note == "" || !strings.Contains(st.Exceeded, "CPU") {
+		t.Errorf("status %+v", st)
+	}
+}
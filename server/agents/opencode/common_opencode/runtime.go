@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"os/exec"
-	"syscall"
 	"time"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // IsCmdAlive checks whether the provided process is still alive.
@@ -13,7 +14,7 @@ func IsCmdAlive(cmd *exec.Cmd) bool {
 	if cmd == nil || cmd.Process == nil {
 		return false
 	}
-	return syscall.Kill(cmd.Process.Pid, 0) == nil
+	return procctl.Alive(cmd.Process.Pid)
 }
 
 // WaitDone returns a channel closed when cmd exits.
@@ -0,0 +1,294 @@
+package exposed_opencode
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creack/pty"
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+)
+
+// Auth login event types streamed to clients.
+const (
+	AuthLoginEventOutput = "output" // CLI output as read from the PTY, escape sequences included
+	AuthLoginEventURL    = "url"    // verification URL detected in output
+	AuthLoginEventCode   = "code"   // device/user code detected in output
+	AuthLoginEventDone   = "done"   // process exited; Error set on failure
+)
+
+// authLoginRetain is how long a finished login stays queryable.
+const authLoginRetain = 10 * time.Minute
+
+var (
+	ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07]*\x07|\r`)
+	authURLRe    = regexp.MustCompile(`https?://[^\s"'<>]+`)
+	authCodeRe   = regexp.MustCompile(`\b[A-Z0-9]{4,}-[A-Z0-9]{4,}\b`)
+)
+
+// detect looks for the verification URL and device code in the complete
+// lines of text, returning the trailing partial line to be continued by
+// the next read. A match is only taken from a complete line, so one split
+// across reads is not reported truncated.
+func (l *AuthLogin) detect(text string) string {
+	i := strings.LastIndexByte(text, '\n')
+	if i < 0 {
+		// keep escape sequences intact until their line is complete
+		if len(text) > 64*1024 {
+			return text[len(text)-64*1024:]
+		}
+		return text
+	}
+	for _, line := range strings.Split(ansiEscapeRe.ReplaceAllString(text[:i], ""), "\n") {
+		if u := authURLRe.FindString(line); u != "" {
+			l.mu.Lock()
+			isNew := u != l.url
+			l.url = u
+			l.mu.Unlock()
+			if isNew {
+				l.emit(AuthLoginEvent{Type: AuthLoginEventURL, URL: u})
+			}
+		}
+		if c := authCodeRe.FindString(line); c != "" {
+			l.mu.Lock()
+			isNew := c != l.code
+			l.code = c
+			l.mu.Unlock()
+			if isNew {
+				l.emit(AuthLoginEvent{Type: AuthLoginEventCode, Code: c})
+			}
+		}
+	}
+	return text[i+1:]
+}
+
+// utf8SafeLen returns the length of data without a trailing incomplete
+// UTF-8 sequence.
+func utf8SafeLen(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// AuthLoginEvent is one event of an auth login session.
+type AuthLoginEvent struct {
+	Type  string `json:"type"`
+	Text  string `json:"text,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// AuthLoginInfo summarizes an auth login session.
+type AuthLoginInfo struct {
+	ID        string `json:"id"`
+	StartedAt string `json:"started_at"`
+	URL       string `json:"url,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AuthLogin drives one `opencode auth login` process inside a PTY so the
+// interactive prompts, verification URL and device code can be relayed to a
+// remote client and answered from there.
+type AuthLogin struct {
+	id        string
+	startedAt time.Time
+	cmd       *exec.Cmd
+	ptmx      *os.File
+
+	mu     sync.Mutex
+	events []AuthLoginEvent
+	subs   map[chan AuthLoginEvent]struct{}
+	url    string
+	code   string
+	done   bool
+	err    string
+}
+
+var (
+	authLoginsMu sync.Mutex
+	authLogins   = make(map[string]*AuthLogin)
+	authLoginSeq int
+)
+
+// StartAuthLogin launches `<binPath> auth login [args...]` in a PTY.
+// Any login still running is cancelled first: opencode writes a single auth.json.
+func StartAuthLogin(binPath string, args ...string) (*AuthLogin, error) {
+	authLoginsMu.Lock()
+	for _, l := range authLogins {
+		l.Cancel()
+	}
+	authLoginSeq++
+	id := fmt.Sprintf("auth-login-%d", authLoginSeq)
+	authLoginsMu.Unlock()
+
+	cmd := exec.Command(binPath, append([]string{"auth", "login"}, args...)...)
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Env = tool_resolve.AppendExtraPaths(cmd.Env)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: 40, Cols: 120})
+	if err != nil {
+		return nil, fmt.Errorf("start opencode auth login: %w", err)
+	}
+
+	l := &AuthLogin{
+		id:        id,
+		startedAt: time.Now(),
+		cmd:       cmd,
+		ptmx:      ptmx,
+		subs:      make(map[chan AuthLoginEvent]struct{}),
+	}
+
+	authLoginsMu.Lock()
+	authLogins[id] = l
+	authLoginsMu.Unlock()
+
+	go l.pump()
+	return l, nil
+}
+
+// GetAuthLogin returns the login session with the given ID, or nil.
+func GetAuthLogin(id string) *AuthLogin {
+	authLoginsMu.Lock()
+	defer authLoginsMu.Unlock()
+	return authLogins[id]
+}
+
+// Info returns a snapshot of the session state.
+func (l *AuthLogin) Info() AuthLoginInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return AuthLoginInfo{
+		ID:        l.id,
+		StartedAt: l.startedAt.Format(time.RFC3339),
+		URL:       l.url,
+		Code:      l.code,
+		Done:      l.done,
+		Error:     l.err,
+	}
+}
+
+// Subscribe returns all events so far and a channel for subsequent ones.
+// The channel is closed when the process exits; call cancel to stop early.
+func (l *AuthLogin) Subscribe() (backlog []AuthLoginEvent, ch <-chan AuthLoginEvent, cancel func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	backlog = append([]AuthLoginEvent(nil), l.events...)
+	c := make(chan AuthLoginEvent, 64)
+	if l.done {
+		close(c)
+		return backlog, c, func() {}
+	}
+	l.subs[c] = struct{}{}
+	return backlog, c, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.subs[c]; ok {
+			delete(l.subs, c)
+			close(c)
+		}
+	}
+}
+
+// WriteInput sends text to the CLI as if typed; a trailing newline is added
+// unless raw is set (raw is used for arrow keys and other control sequences).
+func (l *AuthLogin) WriteInput(input string, raw bool) error {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+	if done {
+		return fmt.Errorf("auth login already finished")
+	}
+	if !raw {
+		input += "\r"
+	}
+	_, err := l.ptmx.Write([]byte(input))
+	return err
+}
+
+// Cancel kills the login process if it is still running.
+func (l *AuthLogin) Cancel() {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+	if !done && l.cmd.Process != nil {
+		_ = l.cmd.Process.Kill()
+	}
+}
+
+func (l *AuthLogin) emit(ev AuthLoginEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, ev)
+	for c := range l.subs {
+		select {
+		case c <- ev:
+		default:
+			// Slow subscriber; it can recover the full log from a new Subscribe.
+		}
+	}
+}
+
+func (l *AuthLogin) pump() {
+	// Output is relayed as it is read: prompts such as a provider menu or
+	// "paste API key:" end without a newline and would otherwise never
+	// reach the client.
+	var pending []byte // incomplete UTF-8 sequence carried to the next read
+	var line string    // current line, stripped, for URL and code detection
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := l.ptmx.Read(buf)
+		if n > 0 {
+			data := append(pending, buf[:n]...)
+			cut := utf8SafeLen(data)
+			chunk := string(data[:cut])
+			pending = append([]byte(nil), data[cut:]...)
+			if chunk != "" {
+				l.emit(AuthLoginEvent{Type: AuthLoginEventOutput, Text: chunk})
+				line = l.detect(line + chunk)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	l.detect(line + "\n")
+
+	waitErr := l.cmd.Wait()
+	l.ptmx.Close()
+
+	done := AuthLoginEvent{Type: AuthLoginEventDone}
+	if waitErr != nil {
+		done.Error = waitErr.Error()
+	}
+	l.emit(done)
+
+	l.mu.Lock()
+	l.done = true
+	l.err = done.Error
+	for c := range l.subs {
+		close(c)
+	}
+	l.subs = nil
+	l.mu.Unlock()
+
+	time.AfterFunc(authLoginRetain, func() {
+		authLoginsMu.Lock()
+		defer authLoginsMu.Unlock()
+		if authLogins[l.id] == l {
+			delete(authLogins, l.id)
+		}
+	})
+}
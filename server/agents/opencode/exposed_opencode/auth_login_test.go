@@ -0,0 +1,112 @@
+package exposed_opencode
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthLoginDetectsURLAndCode(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "fake-opencode")
+	content := "#!/bin/sh\n" +
+		"printf 'Go to \\033[1mhttps://github.com/login/device\\033[0m\\n'\n" +
+		"printf 'Enter code: ABCD-1234\\n'\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := StartAuthLogin(script)
+	if err != nil {
+		t.Fatalf("StartAuthLogin: %v", err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	for !login.Info().Done {
+		select {
+		case <-deadline:
+			t.Fatalf("auth login did not finish")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	info := login.Info()
+	if info.URL != "https://github.com/login/device" {
+		t.Errorf("URL = %q", info.URL)
+	}
+	if info.Code != "ABCD-1234" {
+		t.Errorf("Code = %q", info.Code)
+	}
+	if info.Error != "" {
+		t.Errorf("Error = %q", info.Error)
+	}
+
+	backlog, _, cancel := login.Subscribe()
+	defer cancel()
+	if last := backlog[len(backlog)-1]; last.Type != AuthLoginEventDone {
+		t.Errorf("last event = %+v, want done", last)
+	}
+	if GetAuthLogin(info.ID) != login {
+		t.Errorf("GetAuthLogin(%q) did not return the session", info.ID)
+	}
+}
+
+func TestAuthLoginRelaysPromptWithoutNewline(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "fake-opencode")
+	content := "#!/bin/sh\n" +
+		"printf 'Paste API key: '\n" +
+		"read key\n" +
+		"printf 'saved %s\\n' \"$key\"\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := StartAuthLogin(script)
+	if err != nil {
+		t.Fatalf("StartAuthLogin: %v", err)
+	}
+	defer login.Cancel()
+	backlog, events, cancel := login.Subscribe()
+	defer cancel()
+
+	var output strings.Builder
+	for _, ev := range backlog {
+		output.WriteString(ev.Text)
+	}
+	deadline := time.After(10 * time.Second)
+	for !strings.Contains(output.String(), "Paste API key:") {
+		select {
+		case ev := <-events:
+			output.WriteString(ev.Text)
+		case <-deadline:
+			t.Fatalf("prompt not relayed, got %q", output.String())
+		}
+	}
+	if err := login.WriteInput("sk-123", false); err != nil {
+		t.Fatal(err)
+	}
+	for !strings.Contains(output.String(), "saved sk-123") {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("login ended, got %q", output.String())
+			}
+			output.WriteString(ev.Text)
+		case <-deadline:
+			t.Fatalf("reply not processed, got %q", output.String())
+		}
+	}
+}
+
+func TestAuthLoginDetectsSplitURL(t *testing.T) {
+	l := &AuthLogin{subs: make(map[chan AuthLoginEvent]struct{})}
+	rest := l.detect("Open https://github.com/lo")
+	if l.url != "" {
+		t.Fatalf("URL taken from a partial line: %q", l.url)
+	}
+	l.detect(rest + "gin/device\r\n")
+	if l.url != "https://github.com/login/device" {
+		t.Errorf("URL = %q", l.url)
+	}
+}
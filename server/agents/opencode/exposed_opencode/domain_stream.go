@@ -2,292 +2,119 @@ package exposed_opencode
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
 	"time"
 
+	"github.com/xhd2015/ai-critic/server/jobs"
 	"github.com/xhd2015/ai-critic/server/proxy/portforward"
 )
 
-// StreamSession represents an active domain mapping streaming session.
-type StreamSession struct {
-	ID        string
-	Port      int
-	Domain    string
-	Provider  string
-	Status    string
-	Logs      []LogEntry
-	PublicURL string
-	Error     string
-	Done      bool
-	Success   bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	mu        sync.RWMutex
-	doneChan  chan struct{}
-}
-
-// LogEntry represents a single log line with timestamp.
-type LogEntry struct {
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
-	IsError   bool      `json:"is_error"`
-}
-
-// SessionManager manages active streaming sessions.
-type SessionManager struct {
-	sessions map[string]*StreamSession
-	mu       sync.RWMutex
-}
-
-var (
-	sessionManager     *SessionManager
-	sessionManagerOnce sync.Once
-)
-
-// GetSessionManager returns the global session manager singleton.
-func GetSessionManager() *SessionManager {
-	sessionManagerOnce.Do(func() {
-		sessionManager = &SessionManager{
-			sessions: make(map[string]*StreamSession),
-		}
-	})
-	return sessionManager
-}
-
-// CreateSession creates a new streaming session.
-func (sm *SessionManager) CreateSession(id string, port int, domain string, provider string) *StreamSession {
-	session := &StreamSession{
-		ID:        id,
-		Port:      port,
-		Domain:    domain,
-		Provider:  provider,
-		Status:    "starting",
-		Logs:      make([]LogEntry, 0),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		doneChan:  make(chan struct{}),
-	}
-
-	sm.mu.Lock()
-	sm.sessions[id] = session
-	sm.mu.Unlock()
-
-	// Clean up old sessions after 1 hour.
-	go sm.cleanupOldSessions()
-
-	return session
-}
-
-// GetSession retrieves a session by ID.
-func (sm *SessionManager) GetSession(id string) (*StreamSession, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	session, ok := sm.sessions[id]
-	return session, ok
-}
+// DomainMapJobKind is the jobs kind of a streaming domain mapping.
+const DomainMapJobKind = "domain-map"
 
-// cleanupOldSessions removes sessions older than 1 hour.
-func (sm *SessionManager) cleanupOldSessions() {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// domainMapTimeout bounds how long a mapping waits for the tunnel to become active.
+const domainMapTimeout = 5 * time.Minute
 
-	cutoff := time.Now().Add(-1 * time.Hour)
-	for id, session := range sm.sessions {
-		if session.CreatedAt.Before(cutoff) {
-			delete(sm.sessions, id)
+// MapDomainViaCloudflareStreaming starts a domain mapping as a background job,
+// or returns the existing job when sessionID names one (reconnection).
+// Progress is in the job log; on success the job result carries "public_url".
+func MapDomainViaCloudflareStreaming(provider string, sessionID string) (*jobs.Job, error) {
+	if sessionID != "" {
+		if j, ok := jobs.Get(sessionID); ok {
+			return j, nil
 		}
 	}
-}
-
-// AddLog adds a log entry to the session.
-func (s *StreamSession) AddLog(message string, isError bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Logs = append(s.Logs, LogEntry{
-		Timestamp: time.Now(),
-		Message:   message,
-		IsError:   isError,
-	})
-	s.UpdatedAt = time.Now()
-}
 
-// SetStatus updates the session status.
-func (s *StreamSession) SetStatus(status string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Status = status
-	s.UpdatedAt = time.Now()
-}
-
-// SetResult sets the final result and marks session as done.
-func (s *StreamSession) SetResult(success bool, publicURL string, err string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.Done = true
-	s.Success = success
-	s.PublicURL = publicURL
-	s.Error = err
-	s.UpdatedAt = time.Now()
-	close(s.doneChan)
-}
-
-// GetLogsSince returns logs after a specific index.
-func (s *StreamSession) GetLogsSince(startIndex int) []LogEntry {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if startIndex >= len(s.Logs) {
-		return []LogEntry{}
-	}
-	return s.Logs[startIndex:]
-}
-
-// WaitDone returns a channel that closes when the session is done.
-func (s *StreamSession) WaitDone() <-chan struct{} {
-	return s.doneChan
-}
-
-// IsDone checks if the session is complete.
-func (s *StreamSession) IsDone() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.Done
-}
-
-// MapDomainViaCloudflareStreaming starts a domain mapping operation with streaming support.
-func MapDomainViaCloudflareStreaming(provider string, sessionID string) (*StreamSession, error) {
 	settings, err := LoadSettings()
 	if err != nil {
 		return nil, err
 	}
-
-	manager := GetSessionManager()
-	var session *StreamSession
-
-	if sessionID != "" {
-		if existingSession, ok := manager.GetSession(sessionID); ok {
-			session = existingSession
-		}
+	if provider == "" {
+		provider = portforward.ProviderCloudflareOwned
 	}
 
-	if session == nil {
-		if sessionID == "" {
-			sessionID = fmt.Sprintf("domain-map-%d", time.Now().UnixNano())
-		}
-
-		if settings.DefaultDomain == "" {
-			session = manager.CreateSession(sessionID, 0, "", provider)
-			session.AddLog("Error: No default domain configured", true)
-			session.SetResult(false, "", "No default domain configured")
-			return session, nil
-		}
-
-		if !IsWebServerRunning(settings.WebServer.Port) {
-			session = manager.CreateSession(sessionID, settings.WebServer.Port, settings.DefaultDomain, provider)
-			session.AddLog("Error: Web server is not running", true)
-			session.SetResult(false, "", "Web server is not running")
-			return session, nil
-		}
-
-		matches, _ := DomainMatchesOwned(settings.DefaultDomain)
-		if !matches {
-			session = manager.CreateSession(sessionID, settings.WebServer.Port, settings.DefaultDomain, provider)
-			session.AddLog(fmt.Sprintf("Error: Domain %s does not match any owned domain", settings.DefaultDomain), true)
-			session.SetResult(false, "", fmt.Sprintf("Domain %s does not match any owned domain", settings.DefaultDomain))
-			return session, nil
-		}
-
-		if provider == "" {
-			provider = portforward.ProviderCloudflareOwned
+	title := fmt.Sprintf("Map %s via %s", settings.DefaultDomain, provider)
+	return jobs.Start(DomainMapJobKind, title, func(ctx context.Context, j *jobs.Job) error {
+		err := runDomainMapping(ctx, j, settings, provider)
+		if err != nil {
+			j.SetResult("message", err.Error())
 		}
-
-		session = manager.CreateSession(sessionID, settings.WebServer.Port, settings.DefaultDomain, provider)
-		go runDomainMapping(session, settings, provider)
-	}
-
-	return session, nil
+		return err
+	}), nil
 }
 
 // runDomainMapping performs the actual domain mapping with progress logging.
-func runDomainMapping(session *StreamSession, settings *Settings, provider string) {
-	session.AddLog(fmt.Sprintf("Starting domain mapping for %s via %s...", session.Domain, provider), false)
-	session.SetStatus("mapping")
+func runDomainMapping(ctx context.Context, j *jobs.Job, settings *Settings, provider string) error {
+	domain := settings.DefaultDomain
+	port := settings.WebServer.Port
+	if domain == "" {
+		return errors.New("No default domain configured")
+	}
+	if !IsWebServerRunning(port) {
+		return errors.New("Web server is not running")
+	}
+	if matches, _ := DomainMatchesOwned(domain); !matches {
+		return fmt.Errorf("Domain %s does not match any owned domain", domain)
+	}
 
-	label := session.Domain
+	j.Logf("Starting domain mapping for %s via %s...", domain, provider)
+	j.SetStage("mapping")
 
 	pfManager := portforward.GetDefaultManager()
 	subID, subChan := pfManager.Subscribe()
 	defer pfManager.Unsubscribe(subID)
 
-	session.AddLog("Creating Cloudflare tunnel...", false)
-	pf, err := pfManager.Add(session.Port, label, provider)
+	j.Logf("Creating Cloudflare tunnel...")
+	pf, err := pfManager.Add(port, domain, provider)
 	if err != nil {
-		session.AddLog(fmt.Sprintf("Failed to create port forward: %v", err), true)
-		session.SetResult(false, "", fmt.Sprintf("Failed to create port forward: %v", err))
-		return
+		return fmt.Errorf("Failed to create port forward: %v", err)
 	}
 
-	session.AddLog(fmt.Sprintf("Port forward created with status: %s", pf.Status), false)
+	j.Logf("Port forward created with status: %s", pf.Status)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, domainMapTimeout)
 	defer cancel()
 
 	for {
 		select {
 		case <-ctx.Done():
-			session.AddLog("Timeout waiting for tunnel to become active", true)
-			session.SetResult(false, "", "Timeout waiting for tunnel to become active")
-			return
-		case <-session.WaitDone():
-			return
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.New("Timeout waiting for tunnel to become active")
+			}
+			return ctx.Err()
 		case ports, ok := <-subChan:
 			if !ok {
-				session.AddLog("Port forward subscription closed", true)
-				session.SetResult(false, "", "Port forward subscription closed")
-				return
+				return errors.New("Port forward subscription closed")
 			}
 
-			for _, port := range ports {
-				if port.LocalPort == session.Port {
-					switch port.Status {
-					case portforward.StatusActive:
-						session.AddLog(fmt.Sprintf("✓ Tunnel is active! Public URL: %s", port.PublicURL), false)
-						session.SetStatus("active")
-
-						settings.WebServer.ExposedDomain = port.PublicURL
-						SaveSettings(settings)
-
-						session.SetResult(true, port.PublicURL, "")
-						return
-					case portforward.StatusError:
-						session.AddLog(fmt.Sprintf("✗ Tunnel failed: %s", port.Error), true)
-						session.SetStatus("error")
-						session.SetResult(false, "", port.Error)
-						return
-					case portforward.StatusConnecting:
-						session.AddLog("Tunnel is connecting...", false)
-						session.SetStatus("connecting")
-					case portforward.StatusStopped:
-						session.AddLog("Tunnel was stopped", true)
-						session.SetStatus("stopped")
-						session.SetResult(false, "", "Tunnel was stopped")
-						return
-					}
-					break
+			for _, p := range ports {
+				if p.LocalPort != port {
+					continue
 				}
+				switch p.Status {
+				case portforward.StatusActive:
+					j.Logf("✓ Tunnel is active! Public URL: %s", p.PublicURL)
+					j.SetStage("active")
+
+					settings.WebServer.ExposedDomain = p.PublicURL
+					SaveSettings(settings)
+
+					j.SetResult("public_url", p.PublicURL)
+					j.SetResult("message", "Domain mapping completed successfully")
+					return nil
+				case portforward.StatusError:
+					j.SetStage("error")
+					return fmt.Errorf("✗ Tunnel failed: %s", p.Error)
+				case portforward.StatusConnecting:
+					j.Logf("Tunnel is connecting...")
+					j.SetStage("connecting")
+				case portforward.StatusStopped:
+					j.SetStage("stopped")
+					return errors.New("Tunnel was stopped")
+				}
+				break
 			}
 		}
 	}
 }
-
-// GetSessionLogs returns all logs from a session starting from a given index.
-func GetSessionLogs(sessionID string, startIndex int) ([]LogEntry, bool, error) {
-	manager := GetSessionManager()
-	session, ok := manager.GetSession(sessionID)
-	if !ok {
-		return nil, false, fmt.Errorf("session not found: %s", sessionID)
-	}
-
-	logs := session.GetLogsSince(startIndex)
-	return logs, session.IsDone(), nil
-}
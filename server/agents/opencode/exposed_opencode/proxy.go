@@ -2,6 +2,7 @@ package exposed_opencode
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -67,6 +68,45 @@ func ProxySSE(w http.ResponseWriter, r *http.Request, port int) {
 	}
 }
 
+// WatchIdle follows the event stream of the opencode server on port and
+// calls fn with the session ID each time a session goes idle, that is when
+// a prompt run is over, however it was started. It returns when ctx is done
+// or the stream ends.
+func WatchIdle(ctx context.Context, port int, fn func(sessionID string)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("http://127.0.0.1:%d/event", port), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := (&http.Client{Timeout: 0}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event stream: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Type       string `json:"type"`
+			Properties struct {
+				SessionID string `json:"sessionID"`
+			} `json:"properties"`
+		}
+		if json.Unmarshal([]byte(data), &ev) == nil && ev.Type == "session.idle" {
+			fn(ev.Properties.SessionID)
+		}
+	}
+	return scanner.Err()
+}
+
 // ProxyConfigUpdate handles PATCH /config by transforming the model field
 // from object format {model: {modelID: "xxx"}} to string format {model: "xxx"}.
 func ProxyConfigUpdate(w http.ResponseWriter, r *http.Request, port int) {
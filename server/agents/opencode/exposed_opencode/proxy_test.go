@@ -0,0 +1,38 @@
+package exposed_opencode
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWatchIdle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/event" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"server.connected\",\"properties\":{}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"session.status\",\"properties\":{\"sessionID\":\"ses_1\",\"status\":{\"type\":\"busy\"}}}\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"session.idle\",\"properties\":{\"sessionID\":\"ses_1\"}}\n\n")
+		fmt.Fprint(w, "data: not json\n\n")
+		fmt.Fprint(w, "data: {\"type\":\"session.idle\",\"properties\":{\"sessionID\":\"ses_2\"}}\n\n")
+	}))
+	defer srv.Close()
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	var port int
+	fmt.Sscan(portStr, &port)
+
+	var idle []string
+	if err := WatchIdle(context.Background(), port, func(id string) { idle = append(idle, id) }); err != nil {
+		t.Fatalf("WatchIdle: %v", err)
+	}
+	if want := []string{"ses_1", "ses_2"}; !reflect.DeepEqual(idle, want) {
+		t.Errorf("idle sessions = %v, want %v", idle, want)
+	}
+}
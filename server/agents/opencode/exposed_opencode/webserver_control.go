@@ -2,15 +2,15 @@ package exposed_opencode
 
 import (
 	"fmt"
-	"os/exec"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	common "github.com/xhd2015/ai-critic/server/agents/opencode/common_opencode"
 	"github.com/xhd2015/ai-critic/server/cloudflare"
 	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 	"github.com/xhd2015/ai-critic/server/proxy/basic_auth_proxy"
 )
 
@@ -181,23 +181,13 @@ func forceStopProcessOnPort(port int) error {
 		return nil
 	}
 
-	out, err := exec.Command("lsof", "-ti", fmt.Sprintf("tcp:%d", port)).Output()
+	pids, err := portpid.PIDsOnPort(port)
 	if err != nil {
-		// lsof exits non-zero when no process is bound to the port.
-		if _, ok := err.(*exec.ExitError); ok {
-			return nil
-		}
 		return err
 	}
-
-	pids := strings.Fields(strings.TrimSpace(string(out)))
-	for _, pidStr := range pids {
-		pid, err := strconv.Atoi(pidStr)
-		if err != nil {
-			continue
-		}
-		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-			_ = syscall.Kill(pid, syscall.SIGKILL)
+	for _, pid := range pids {
+		if err := procctl.Terminate(pid); err != nil {
+			_ = procctl.Kill(pid)
 		}
 	}
 	return nil
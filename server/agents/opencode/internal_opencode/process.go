@@ -8,7 +8,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // PortProcessInfo holds information about a process using a specific port
@@ -39,11 +40,11 @@ func KillProcessByPort(port int) error {
 		}
 
 		// Try graceful termination first (SIGTERM)
-		err := syscall.Kill(proc.PID, syscall.SIGTERM)
+		err := procctl.Terminate(proc.PID)
 		if err != nil {
 			lastErr = fmt.Errorf("failed to send SIGTERM to PID %d: %w", proc.PID, err)
 			// Try SIGKILL as fallback
-			err = syscall.Kill(proc.PID, syscall.SIGKILL)
+			err = procctl.Kill(proc.PID)
 			if err != nil {
 				lastErr = fmt.Errorf("failed to send SIGKILL to PID %d: %w", proc.PID, err)
 				continue
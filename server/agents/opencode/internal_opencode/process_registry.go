@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 type InternalServerInfo struct {
@@ -35,16 +35,16 @@ func WithLock(fn func() error) error {
 	}
 
 	lockFile := lockPath()
-	fd, err := syscall.Open(lockFile, syscall.O_CREAT|syscall.O_RDWR, 0644)
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open lock file: %w", err)
 	}
-	defer syscall.Close(fd)
+	defer f.Close()
 
-	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+	if err := procctl.Lock(f); err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
-	defer syscall.Flock(fd, syscall.LOCK_UN)
+	defer procctl.Unlock(f)
 
 	return fn()
 }
@@ -98,8 +98,7 @@ func IsProcessAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	err := syscall.Kill(pid, 0)
-	return err == nil
+	return procctl.Alive(pid)
 }
 
 func IsPortReachable(port int) bool {
@@ -115,3 +114,35 @@ func IsPortReachable(port int) bool {
 	defer resp.Body.Close()
 	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized
 }
+
+// ServerStatus describes the internal opencode server without starting it.
+type ServerStatus struct {
+	Registered bool      `json:"registered"` // a server has been recorded in the registry
+	PID        int       `json:"pid,omitempty"`
+	Port       int       `json:"port,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	Alive      bool      `json:"alive"`     // the recorded process exists
+	Reachable  bool      `json:"reachable"` // the port answers /session
+}
+
+// GetServerStatus reports the state of the registered internal server.
+// Unlike GetOrStartOpencodeServer it never starts one.
+func GetServerStatus() (*ServerStatus, error) {
+	info, err := LoadRegistry()
+	if err != nil {
+		return nil, err
+	}
+	status := &ServerStatus{}
+	if info == nil {
+		return status, nil
+	}
+	status.Registered = true
+	status.PID = info.PID
+	status.Port = info.Port
+	if info.StartTime > 0 {
+		status.StartedAt = time.Unix(info.StartTime, 0)
+	}
+	status.Alive = IsProcessAlive(info.PID)
+	status.Reachable = status.Alive && IsPortReachable(info.Port)
+	return status, nil
+}
@@ -0,0 +1,127 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	opencode_exposed "github.com/xhd2015/ai-critic/server/agents/opencode/exposed_opencode"
+)
+
+// handleOpencodeAuthLogin starts (POST) or cancels (DELETE ?id=) an
+// `opencode auth login` session so a headless host can be logged in remotely.
+// GET ?id= returns the session summary, including any detected URL and code.
+func handleOpencodeAuthLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			// URL is passed through to `opencode auth login <url>` for
+			// well-known auth endpoints; usually empty.
+			URL string `json:"url,omitempty"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		binPath, err := getAgentBinaryPath(AgentIDOpenCode, "opencode")
+		if err != nil {
+			http.Error(w, "opencode is not installed", http.StatusBadRequest)
+			return
+		}
+		var args []string
+		if req.URL != "" {
+			args = append(args, req.URL)
+		}
+		login, err := opencode_exposed.StartAuthLogin(binPath, args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(login.Info())
+
+	case http.MethodGet, http.MethodDelete:
+		login := opencode_exposed.GetAuthLogin(r.URL.Query().Get("id"))
+		if login == nil {
+			http.Error(w, "auth login not found", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			login.Cancel()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(login.Info())
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOpencodeAuthLoginStream streams the login's output, verification URL
+// and device code as SSE frames until the CLI exits.
+func handleOpencodeAuthLoginStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	login := opencode_exposed.GetAuthLogin(r.URL.Query().Get("id"))
+	if login == nil {
+		http.Error(w, "auth login not found", http.StatusNotFound)
+		return
+	}
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	backlog, events, cancel := login.Subscribe()
+	defer cancel()
+	for _, ev := range backlog {
+		sw.Send(ev)
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			sw.Send(ev)
+		}
+	}
+}
+
+// handleOpencodeAuthLoginInput forwards a reply (provider choice, pasted
+// code, API key) to the running login.
+func handleOpencodeAuthLoginInput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID    string `json:"id"`
+		Input string `json:"input"`
+		// Raw sends Input without a trailing Enter (e.g. "\x1b[B" for arrow down).
+		Raw bool `json:"raw,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	login := opencode_exposed.GetAuthLogin(req.ID)
+	if login == nil {
+		http.Error(w, "auth login not found", http.StatusNotFound)
+		return
+	}
+	if err := login.WriteInput(req.Input, req.Raw); err != nil {
+		http.Error(w, fmt.Sprintf("write input: %v", err), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(login.Info())
+}
@@ -2,15 +2,15 @@ package opencode_serve_children
 
 import (
 	"encoding/json"
-	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // CollectPIDs returns deduplicated PIDs from registry children and listeners on extraPorts.
@@ -198,18 +198,7 @@ func pidsOnPort(port int) []int {
 	if port <= 0 {
 		return nil
 	}
-	out, err := exec.Command("lsof", "-ti", fmt.Sprintf("tcp:%d", port)).Output()
-	if err != nil || len(out) == 0 {
-		return nil
-	}
-	var pids []int
-	for _, field := range strings.Fields(strings.TrimSpace(string(out))) {
-		pid, convErr := strconv.Atoi(field)
-		if convErr != nil || pid <= 0 {
-			continue
-		}
-		pids = append(pids, pid)
-	}
+	pids, _ := portpid.PIDsOnPort(port)
 	return pids
 }
 
@@ -242,19 +231,6 @@ func processRunning(pid int) bool {
 	return !strings.HasPrefix(stat, "Z")
 }
 
-func reapChild(pid int) {
-	var status syscall.WaitStatus
-	for i := 0; i < 20; i++ {
-		wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
-		if wpid > 0 || err != nil {
-			return
-		}
-		if !processRunning(pid) {
-			return
-		}
-		time.Sleep(50 * time.Millisecond)
-	}
-}
 
 func killPID(pid int) bool {
 	if pid <= 0 {
@@ -263,10 +239,10 @@ func killPID(pid int) bool {
 	if !isOpencodeServeProcess(pid) {
 		return false
 	}
-	_ = syscall.Kill(pid, syscall.SIGTERM)
+	_ = procctl.Terminate(pid)
 	time.Sleep(300 * time.Millisecond)
 	if processRunning(pid) {
-		_ = syscall.Kill(pid, syscall.SIGKILL)
+		_ = procctl.Kill(pid)
 		time.Sleep(100 * time.Millisecond)
 	}
 	reapChild(pid)
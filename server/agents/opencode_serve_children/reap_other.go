@@ -0,0 +1,6 @@
+//go:build !unix
+
+package opencode_serve_children
+
+// reapChild does nothing: only Unix leaves exited children as zombies.
+func reapChild(pid int) {}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package opencode_serve_children
+
+import (
+	"syscall"
+	"time"
+)
+
+func reapChild(pid int) {
+	var status syscall.WaitStatus
+	for i := 0; i < 20; i++ {
+		wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if wpid > 0 || err != nil {
+			return
+		}
+		if !processRunning(pid) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 const (
@@ -59,16 +59,16 @@ func WithLock(configHome string, fn func() error) error {
 	}
 
 	lockFile := lockPath(configHome)
-	fd, err := syscall.Open(lockFile, syscall.O_CREAT|syscall.O_RDWR, 0644)
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open lock file: %w", err)
 	}
-	defer syscall.Close(fd)
+	defer f.Close()
 
-	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+	if err := procctl.Lock(f); err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
-	defer syscall.Flock(fd, syscall.LOCK_UN)
+	defer procctl.Unlock(f)
 
 	return fn()
 }
@@ -0,0 +1,221 @@
+// Package procadapter serves the chat API of the cursor adapter for agents
+// run as one process per prompt, such as Claude Code, Codex and jsonl custom
+// agents. It keeps the sessions, their messages and the SSE subscribers;
+// each agent supplies the command a prompt runs and the parser of its
+// output.
+package procadapter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// The chat protocol is the one the cursor adapter speaks, so the frontend
+// renders every agent with the same components.
+type (
+	ChatMessage = cursor.ChatMessage
+	MessagePart = cursor.MessagePart
+	ACPEvent    = cursor.ACPEvent
+	TokenUsage  = cursor.TokenUsage
+)
+
+// maxStderrBytes caps the stderr kept to explain a failed run.
+const maxStderrBytes = 4096
+
+// Run is a prompt to run in a session.
+type Run struct {
+	Session *Session
+	Prompt  string
+	// Model is the selected model, empty means the agent's default.
+	Model string
+	// ResumeID is what the agent reported to continue the conversation
+	// with, empty for the first prompt of a session.
+	ResumeID string
+}
+
+// Agent is what an Adapter needs to know about the agent it runs.
+type Agent struct {
+	// Name names the agent in errors, such as "claude".
+	Name string
+	// SessionPrefix starts the IDs of sessions, "<prefix>-chat-<ms>-<n>".
+	SessionPrefix string
+	// Info is served at /config.
+	Info Info
+	// Command builds the process answering run; its stdout and stderr are
+	// set by the adapter.
+	Command func(run Run) (*exec.Cmd, error)
+	// ProcessStream reads the process's stdout into s, attributing the
+	// messages to model until the agent reports another. It reports
+	// whether the agent ended the run itself, in which case a failed exit
+	// is not reported again.
+	ProcessStream func(s *Session, r io.Reader, model string) bool
+	// PromptSuffix, if set, returns text appended to prompts posted to
+	// prompt_async.
+	PromptSuffix func() string
+	// Settings, if set, serves the agent's settings at /settings, see
+	// Settings.
+	Settings http.Handler
+	// Providers, if set, lists the agent's models at /config/providers.
+	Providers func() Provider
+}
+
+// Info describes the agent at /config.
+type Info struct {
+	Name         string
+	Version      string
+	ProviderID   string
+	Capabilities map[string]bool
+}
+
+// Adapter manages the chat sessions of an agent.
+type Adapter struct {
+	agent Agent
+
+	mu         sync.Mutex
+	sessions   map[string]*Session
+	counter    int
+	model      string // selected model ID, empty means default
+	globalSubs map[chan ACPEvent]struct{}
+
+	// onPromptDone is called after a prompt's process exits.
+	onPromptDone func(sessionID string)
+}
+
+// New creates an adapter running agent, with model selected.
+func New(agent Agent, model string) *Adapter {
+	return &Adapter{
+		agent:      agent,
+		sessions:   make(map[string]*Session),
+		model:      model,
+		globalSubs: make(map[chan ACPEvent]struct{}),
+	}
+}
+
+// SetPromptDoneHook registers fn to be called (in the prompt's goroutine)
+// each time a session finishes processing a prompt.
+func (a *Adapter) SetPromptDoneHook(fn func(sessionID string)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onPromptDone = fn
+}
+
+// SetModel sets the model to use for future prompts.
+func (a *Adapter) SetModel(model string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.model = model
+}
+
+// GetModel returns the current model.
+func (a *Adapter) GetModel() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.model
+}
+
+// globalBroadcast sends an event to all SSE subscribers.
+func (a *Adapter) globalBroadcast(event ACPEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for ch := range a.globalSubs {
+		select {
+		case ch <- event:
+		default:
+			// Drop if subscriber is slow
+		}
+	}
+}
+
+// GlobalSubscribe creates a new SSE subscriber channel, receiving the
+// events of all sessions.
+func (a *Adapter) GlobalSubscribe() chan ACPEvent {
+	ch := make(chan ACPEvent, 64)
+	a.mu.Lock()
+	a.globalSubs[ch] = struct{}{}
+	a.mu.Unlock()
+	return ch
+}
+
+// GlobalUnsubscribe removes an SSE subscriber.
+func (a *Adapter) GlobalUnsubscribe(ch chan ACPEvent) {
+	a.mu.Lock()
+	delete(a.globalSubs, ch)
+	a.mu.Unlock()
+	close(ch)
+}
+
+// CreateSession creates a new chat session.
+func (a *Adapter) CreateSession() *Session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counter++
+	s := &Session{
+		ID:        fmt.Sprintf("%s-chat-%d-%d", a.agent.SessionPrefix, time.Now().UnixMilli(), a.counter),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		adapter:   a,
+		seq:       a.counter,
+		messages:  []ChatMessage{},
+	}
+	a.sessions[s.ID] = s
+	return s
+}
+
+// GetSession returns a session by ID.
+func (a *Adapter) GetSession(id string) *Session {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessions[id]
+}
+
+// PaginatedResponse holds paginated response data
+type PaginatedResponse struct {
+	Items      []map[string]string `json:"items"`
+	Page       int                 `json:"page"`
+	PageSize   int                 `json:"page_size"`
+	Total      int                 `json:"total"`
+	TotalPages int                 `json:"total_pages"`
+}
+
+// ListSessions returns the sessions, newest first, paginated.
+func (a *Adapter) ListSessions(page, pageSize int) *PaginatedResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sessionList := make([]*Session, 0, len(a.sessions))
+	for _, s := range a.sessions {
+		sessionList = append(sessionList, s)
+	}
+	sort.Slice(sessionList, func(i, j int) bool {
+		return sessionList[i].seq > sessionList[j].seq
+	})
+
+	total := len(sessionList)
+	totalPages := (total + pageSize - 1) / pageSize
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+
+	items := make([]map[string]string, 0, end-start)
+	for _, s := range sessionList[start:end] {
+		s.mu.Lock()
+		items = append(items, map[string]string{
+			"id":           s.ID,
+			"created_at":   s.CreatedAt,
+			"firstMessage": s.FirstMessage,
+		})
+		s.mu.Unlock()
+	}
+	return &PaginatedResponse{
+		Items:      items,
+		Page:       page,
+		PageSize:   pageSize,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+}
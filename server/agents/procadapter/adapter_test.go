@@ -0,0 +1,124 @@
+package procadapter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// echoAgent answers each prompt with "<model>|<resume id>|<prompt>" and
+// reports "r-<n>" to resume with.
+func echoAgent() Agent {
+	return Agent{
+		Name:          "echo",
+		SessionPrefix: "echo",
+		Info:          Info{Name: "Echo", ProviderID: "echo"},
+		Command: func(run Run) (*exec.Cmd, error) {
+			cmd := exec.Command("cat")
+			cmd.Stdin = strings.NewReader(run.Model + "|" + run.ResumeID + "|" + run.Prompt)
+			return cmd, nil
+		},
+		ProcessStream: func(s *Session, r io.Reader, model string) bool {
+			out, _ := io.ReadAll(r)
+			s.SetResumeID("r-" + string(out))
+			s.Complete(s.AppendText(nil, "text/plain", string(out), model), nil)
+			return true
+		},
+		PromptSuffix: func() string { return "be brief" },
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	a := New(echoAgent(), "m1")
+	done := make(chan string, 1)
+	a.SetPromptDoneHook(func(id string) { done <- id })
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, path, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	var created struct{ ID string }
+	json.Unmarshal(do(http.MethodPost, "/session", "").Body.Bytes(), &created)
+	if !strings.HasPrefix(created.ID, "echo-chat-") {
+		t.Fatalf("session id %q", created.ID)
+	}
+
+	do(http.MethodPost, "/session/"+created.ID+"/prompt_async", `{"parts":[{"type":"text","text":"hi"}]}`)
+	if id := <-done; id != created.ID {
+		t.Errorf("done hook got %q", id)
+	}
+	do(http.MethodPatch, "/config", `{"model":{"modelID":"m2"}}`)
+	do(http.MethodPost, "/session/"+created.ID+"/prompt_async", `{"content":"again"}`)
+	<-done
+
+	var msgs []ChatMessage
+	json.Unmarshal(do(http.MethodGet, "/session/"+created.ID+"/message", "").Body.Bytes(), &msgs)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(msgs), msgs)
+	}
+	if got := msgs[1].Parts[0].Content; got != "m1||hi\nbe brief" {
+		t.Errorf("first answer %q", got)
+	}
+	if got := msgs[3].Parts[0].Content; got != "m2|r-m1||hi\nbe brief|again\nbe brief" {
+		t.Errorf("second answer %q", got)
+	}
+
+	var list PaginatedResponse
+	json.Unmarshal(do(http.MethodGet, "/session", "").Body.Bytes(), &list)
+	if list.Total != 1 || list.Items[0]["firstMessage"] != "hi\nbe brief" {
+		t.Errorf("sessions %+v", list)
+	}
+}
+
+func TestSendPromptReportsFailedExit(t *testing.T) {
+	agent := echoAgent()
+	agent.Command = func(run Run) (*exec.Cmd, error) {
+		return exec.Command("sh", "-c", "echo 'not logged in' >&2; exit 1"), nil
+	}
+	agent.ProcessStream = func(*Session, io.Reader, string) bool { return false }
+	s := New(agent, "").CreateSession()
+	if err := s.SendPrompt("hi"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := s.GetMessages()
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Parts[0].Content, "echo exited: exit status 1\nnot logged in") {
+		t.Errorf("failed run reported %+v", last)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	type mode struct {
+		Mode string `json:"mode"`
+	}
+	agent := echoAgent()
+	agent.Settings = NewSettings(nil, "echo", func(m mode) error {
+		return OneOf("mode", m.Mode, []string{"fast", "slow"})
+	})
+	a := New(agent, "")
+
+	tests := []struct {
+		method, body string
+		wantCode     int
+		wantBody     string
+	}{
+		{http.MethodPut, `{"mode":"yolo"}`, http.StatusBadRequest, "mode must be one of fast, slow\n"},
+		{http.MethodPut, `{"mode":"slow"}`, http.StatusOK, `{"mode":"slow"}` + "\n"},
+		{http.MethodGet, "", http.StatusOK, `{"mode":"slow"}` + "\n"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest(tt.method, "/settings", strings.NewReader(tt.body)))
+		if rec.Code != tt.wantCode || rec.Body.String() != tt.wantBody {
+			t.Errorf("%s %s: %d %q, want %d %q", tt.method, tt.body, rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package procadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ServeHTTP handles proxied requests from the agent session proxy.
+func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == "/session" && r.Method == http.MethodGet:
+		a.handleListSessions(w, r)
+	case path == "/session" && r.Method == http.MethodPost:
+		a.handleCreateSession(w, r)
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/message") && r.Method == http.MethodGet:
+		a.handleGetMessages(w, r, extractSessionID(path, "/message"))
+	case strings.HasPrefix(path, "/session/") && strings.HasSuffix(path, "/prompt_async") && r.Method == http.MethodPost:
+		a.handlePromptAsync(w, r, extractSessionID(path, "/prompt_async"))
+	case path == "/event" || path == "/global/event":
+		a.handleEvents(w, r)
+	case path == "/global/health" || path == "/health":
+		writeJSON(w, map[string]string{"status": "ok"})
+	case path == "/config" && r.Method == http.MethodPatch:
+		a.handleConfigUpdate(w, r)
+	case path == "/config":
+		a.handleConfig(w, r)
+	case path == "/config/providers" && a.agent.Providers != nil:
+		ServeProviders(w, a.agent.Providers())
+	case path == "/settings" && a.agent.Settings != nil:
+		a.agent.Settings.ServeHTTP(w, r)
+	case path == "/templates" && r.Method == http.MethodGet:
+		writeJSON(w, []struct{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func extractSessionID(path, suffix string) string {
+	// path: /session/{id}/suffix
+	path = strings.TrimPrefix(path, "/session/")
+	path = strings.TrimSuffix(path, suffix)
+	return strings.TrimSuffix(path, "/")
+}
+
+func (a *Adapter) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	page, pageSize := 1, 50
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if ps, err := strconv.Atoi(r.URL.Query().Get("page_size")); err == nil && ps > 0 && ps <= 100 {
+		pageSize = ps
+	}
+	writeJSON(w, a.ListSessions(page, pageSize))
+}
+
+func (a *Adapter) handleCreateSession(w http.ResponseWriter, _ *http.Request) {
+	s := a.CreateSession()
+	writeJSON(w, map[string]interface{}{
+		"id":         s.ID,
+		"created_at": s.CreatedAt,
+	})
+}
+
+func (a *Adapter) handleGetMessages(w http.ResponseWriter, _ *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, s.GetMessages())
+}
+
+func (a *Adapter) handlePromptAsync(w http.ResponseWriter, r *http.Request, sessionID string) {
+	s := a.GetSession(sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Parts   []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"parts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Extract prompt text from either content or parts
+	prompt := req.Content
+	for _, p := range req.Parts {
+		if prompt != "" {
+			break
+		}
+		if p.Type == "text" {
+			prompt = p.Text
+		}
+	}
+	if prompt == "" {
+		http.Error(w, "empty prompt", http.StatusBadRequest)
+		return
+	}
+
+	if a.agent.PromptSuffix != nil {
+		if suffix := a.agent.PromptSuffix(); suffix != "" {
+			prompt += "\n" + suffix
+		}
+	}
+
+	// Run prompt asynchronously
+	go s.SendPrompt(prompt)
+
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+func (a *Adapter) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// Use global subscription to receive events from all sessions
+	ch := a.GlobalSubscribe()
+	defer a.GlobalUnsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func (a *Adapter) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	info := a.agent.Info
+	resp := map[string]interface{}{
+		"name":         info.Name,
+		"version":      info.Version,
+		"capabilities": info.Capabilities,
+	}
+	if model := a.GetModel(); model != "" {
+		resp["model"] = map[string]string{
+			"modelID":    model,
+			"providerID": info.ProviderID,
+		}
+	}
+	writeJSON(w, resp)
+}
+
+func (a *Adapter) handleConfigUpdate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model struct {
+			ModelID string `json:"modelID"`
+		} `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.SetModel(body.Model.ModelID)
+
+	writeJSON(w, map[string]string{"status": "ok", "model": body.Model.ModelID})
+}
+
+// Model is a model an agent offers.
+type Model struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Provider lists the models of an agent at /config/providers.
+type Provider struct {
+	ID     string
+	Name   string
+	Models []Model // the first is the default
+	// Context and Output are the token limits of every model.
+	Context, Output int
+}
+
+// ServeProviders writes p in the form of opencode's /config/providers.
+func ServeProviders(w http.ResponseWriter, p Provider) {
+	modelsMap := make(map[string]interface{}, len(p.Models))
+	for _, m := range p.Models {
+		modelsMap[m.ID] = map[string]interface{}{
+			"id":   m.ID,
+			"name": m.Name,
+			"limit": map[string]int{
+				"context": p.Context,
+				"output":  p.Output,
+			},
+		}
+	}
+	defaultModel := ""
+	if len(p.Models) > 0 {
+		defaultModel = p.Models[0].ID
+	}
+	writeJSON(w, map[string]interface{}{
+		"providers": []map[string]interface{}{
+			{
+				"id":     p.ID,
+				"name":   p.Name,
+				"models": modelsMap,
+			},
+		},
+		"default": map[string]string{
+			p.ID: defaultModel,
+		},
+	})
+}
@@ -0,0 +1,246 @@
+package procadapter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/agents/cursor"
+)
+
+// Session is a chat with the agent.
+type Session struct {
+	ID           string `json:"id"`
+	CreatedAt    string `json:"created_at"`
+	FirstMessage string `json:"firstMessage,omitempty"`
+	// ResumeID is what the agent reported to continue the conversation
+	// with, passed to the next prompt's Command.
+	ResumeID string   `json:"-"`
+	adapter  *Adapter // parent adapter for the agent and broadcast
+	seq      int      // creation order within the adapter
+
+	mu       sync.Mutex
+	messages []ChatMessage
+	// Track if a prompt is currently running
+	busy bool
+}
+
+// tailBuffer keeps the last maxStderrBytes written to it.
+type tailBuffer struct {
+	bytes.Buffer
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n, _ := b.Buffer.Write(p)
+	if extra := b.Len() - maxStderrBytes; extra > 0 {
+		b.Next(extra)
+	}
+	return n, nil
+}
+
+// SendPrompt runs the agent on the prompt, continuing the session's previous
+// conversation, and streams the response to subscribers.
+func (s *Session) SendPrompt(prompt string) error {
+	s.mu.Lock()
+	if s.busy {
+		s.mu.Unlock()
+		return fmt.Errorf("session is busy processing a prompt")
+	}
+	s.busy = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.busy = false
+		s.mu.Unlock()
+	}()
+
+	// Add user message
+	now := time.Now()
+	userMsg := ChatMessage{
+		ID:    fmt.Sprintf("msg-%d", now.UnixMilli()),
+		Role:  "user",
+		Time:  now.Unix(),
+		Parts: []MessagePart{{ID: fmt.Sprintf("part-%d-0", now.UnixMilli()), ContentType: "text/plain", Content: prompt}},
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, userMsg)
+	if s.FirstMessage == "" {
+		s.FirstMessage = prompt
+	}
+	resumeID := s.ResumeID
+	s.mu.Unlock()
+	s.broadcast(ACPEvent{Type: cursor.ACPMessageCreated, Message: userMsg})
+
+	a := s.adapter
+	model := a.GetModel()
+	cmd, err := a.agent.Command(Run{Session: s, Prompt: prompt, Model: model, ResumeID: resumeID})
+	if err != nil {
+		return err
+	}
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		s.ReportError(fmt.Sprintf("Failed to start %s: %v", a.agent.Name, err))
+		return fmt.Errorf("start %s: %w", a.agent.Name, err)
+	}
+
+	ended := a.agent.ProcessStream(s, stdout, model)
+
+	if err := cmd.Wait(); err != nil && !ended {
+		msg := fmt.Sprintf("%s exited: %v", a.agent.Name, err)
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			msg += "\n" + tail
+		}
+		s.ReportError(msg)
+	}
+
+	a.mu.Lock()
+	hook := a.onPromptDone
+	a.mu.Unlock()
+	if hook != nil {
+		hook(s.ID)
+	}
+
+	return nil
+}
+
+// SetResumeID records the id the agent reported to continue the
+// conversation with.
+func (s *Session) SetResumeID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ResumeID = id
+}
+
+// ReportError adds a completed agent message with text.
+func (s *Session) ReportError(text string) {
+	msg := s.AppendText(nil, "text/plain", text, "")
+	s.broadcast(ACPEvent{Type: cursor.ACPMessageCompleted, Message: *msg})
+}
+
+// messageIndex returns the index of message id, or -1. s.mu must be held.
+func (s *Session) messageIndex(id string) int {
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// AppendText appends text to the current agent message, extending its last
+// part of the same content type or adding a new part. A new message is
+// created when there is no current one. It returns the current message.
+func (s *Session) AppendText(current *ChatMessage, contentType, text, model string) *ChatMessage {
+	return s.AppendPart(current, MessagePart{ContentType: contentType, Content: text}, model, true)
+}
+
+// AppendPart adds part to the current message, or to a new one of model if
+// there is none. With merge, text is appended to a trailing part of the same
+// type. It returns the current message.
+func (s *Session) AppendPart(current *ChatMessage, part MessagePart, model string, merge bool) *ChatMessage {
+	now := time.Now()
+	if current == nil {
+		msgID := fmt.Sprintf("msg-%d", now.UnixNano())
+		if part.ID == "" {
+			part.ID = fmt.Sprintf("part-%s-0", msgID)
+		}
+		msg := ChatMessage{
+			ID:    msgID,
+			Role:  "agent",
+			Time:  now.Unix(),
+			Model: model,
+			Parts: []MessagePart{part},
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+		s.broadcast(ACPEvent{Type: cursor.ACPMessageCreated, Message: msg})
+		return &msg
+	}
+
+	s.mu.Lock()
+	idx := s.messageIndex(current.ID)
+	if idx < 0 {
+		s.mu.Unlock()
+		return s.AppendPart(nil, part, model, merge)
+	}
+	parts := s.messages[idx].Parts
+	if n := len(parts); merge && n > 0 && parts[n-1].ContentType == part.ContentType {
+		parts[n-1].Content += part.Content
+	} else {
+		if part.ID == "" {
+			part.ID = fmt.Sprintf("part-%s-%d", s.messages[idx].ID, len(parts))
+		}
+		s.messages[idx].Parts = append(parts, part)
+	}
+	updated := s.messages[idx]
+	s.mu.Unlock()
+	s.broadcast(ACPEvent{Type: cursor.ACPMessageUpdated, Message: updated})
+	return current
+}
+
+// UpdateToolCall merges meta into the metadata of the tool/call part with
+// call_id id, reporting false if there is no such part.
+func (s *Session) UpdateToolCall(id string, meta map[string]interface{}) bool {
+	s.mu.Lock()
+	var updated *ChatMessage
+	for i := len(s.messages) - 1; i >= 0 && updated == nil; i-- {
+		for j := range s.messages[i].Parts {
+			p := &s.messages[i].Parts[j]
+			if p.ContentType != "tool/call" || p.Metadata == nil || p.Metadata["call_id"] != id {
+				continue
+			}
+			for k, v := range meta {
+				p.Metadata[k] = v
+			}
+			msg := s.messages[i]
+			updated = &msg
+			break
+		}
+	}
+	s.mu.Unlock()
+	if updated == nil {
+		return false
+	}
+	s.broadcast(ACPEvent{Type: cursor.ACPMessageUpdated, Message: *updated})
+	return true
+}
+
+// Complete ends the current message, recording the run's usage on it. It
+// does nothing without a current message.
+func (s *Session) Complete(current *ChatMessage, usage *TokenUsage) {
+	if current == nil {
+		return
+	}
+	completed := *current
+	s.mu.Lock()
+	if i := s.messageIndex(current.ID); i >= 0 {
+		s.messages[i].Usage = usage
+		completed = s.messages[i]
+	}
+	s.mu.Unlock()
+	s.broadcast(ACPEvent{Type: cursor.ACPMessageCompleted, Message: completed})
+}
+
+// broadcast sends an event to the adapter's SSE subscribers.
+func (s *Session) broadcast(event ACPEvent) {
+	s.adapter.globalBroadcast(event)
+}
+
+// GetMessages returns all messages in the session.
+func (s *Session) GetMessages() []ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]ChatMessage, len(s.messages))
+	copy(result, s.messages)
+	return result
+}
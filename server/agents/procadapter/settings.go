@@ -0,0 +1,87 @@
+package procadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/settings"
+)
+
+// Settings holds an agent's settings of type T, persisted in a settings
+// store under a namespace and served at /settings.
+type Settings[T any] struct {
+	namespace string
+	store     *settings.Store
+	validate  func(T) error
+
+	mu    sync.Mutex
+	value T
+}
+
+// NewSettings loads the settings saved under namespace in store, which may
+// be nil to keep them in memory. validate, if set, checks settings before
+// they are saved.
+func NewSettings[T any](store *settings.Store, namespace string, validate func(T) error) *Settings[T] {
+	s := &Settings[T]{namespace: namespace, store: store, validate: validate}
+	if store != nil {
+		_ = store.Load(namespace, &s.value)
+	}
+	return s
+}
+
+// Get returns a copy of the settings.
+func (s *Settings[T]) Get() T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+// Set validates and updates the settings and persists them to disk.
+func (s *Settings[T]) Set(v T) error {
+	if s.validate != nil {
+		if err := s.validate(v); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.value = v
+	s.mu.Unlock()
+
+	if s.store != nil {
+		return s.store.Save(s.namespace, v)
+	}
+	return nil
+}
+
+// ServeHTTP returns the settings on GET and replaces them on PUT.
+func (s *Settings[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Get())
+	case http.MethodPut:
+		var v T
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Set(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, v)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// OneOf checks that the setting name, if set, is one of allowed.
+func OneOf(name, value string, allowed []string) error {
+	if value != "" && !slices.Contains(allowed, value) {
+		return fmt.Errorf("%s must be one of %s", name, strings.Join(allowed, ", "))
+	}
+	return nil
+}
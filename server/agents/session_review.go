@@ -0,0 +1,270 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/agentchanges"
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/checkpoint"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// Where a session review found the files the session changed, reported in
+// SessionReview.Source.
+const (
+	// SourceCheckpoint diffs the working tree against the checkpoint made
+	// before the session started.
+	SourceCheckpoint = "checkpoint"
+	// SourceAttribution diffs the files attributed to the session (see
+	// agentchanges) against git HEAD.
+	SourceAttribution = "attribution"
+)
+
+// SessionFinding is one issue found in the changes of a session, anchored
+// to lines of the file's current content.
+type SessionFinding struct {
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line"` // 0 for a finding about the whole file
+	EndLine    int    `json:"end_line"`
+	Rule       string `json:"rule,omitempty"`
+	Severity   string `json:"severity"` // "error", "warning" or "info"
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// SessionReview is the review of only the changes an agent session made,
+// as opposed to the post-run review of everything uncommitted.
+type SessionReview struct {
+	Status     string           `json:"status"` // "running", "done", "skipped", "error"
+	StartedAt  string           `json:"started_at"`
+	FinishedAt string           `json:"finished_at,omitempty"`
+	Source     string           `json:"source,omitempty"` // SourceCheckpoint or SourceAttribution
+	Files      []string         `json:"files"`            // files the session changed
+	Findings   []SessionFinding `json:"findings"`
+	Summary    string           `json:"summary,omitempty"` // why a review was skipped
+	Model      string           `json:"model,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// SessionReviewer reviews diff, the changes session sessionID made in
+// projectDir. It is provided by the server package, which owns the review
+// pipeline. Implementations return a review with Status AutoReviewSkipped
+// when no AI provider is configured.
+type SessionReviewer func(ctx context.Context, sessionID, projectDir, diff string) (*SessionReview, error)
+
+var (
+	sessionReviewerMu sync.Mutex
+	sessionReviewer   SessionReviewer
+)
+
+// SetSessionReviewer installs the reviewer of session changes.
+func SetSessionReviewer(fn SessionReviewer) {
+	sessionReviewerMu.Lock()
+	defer sessionReviewerMu.Unlock()
+	sessionReviewer = fn
+}
+
+func getSessionReviewer() SessionReviewer {
+	sessionReviewerMu.Lock()
+	defer sessionReviewerMu.Unlock()
+	return sessionReviewer
+}
+
+// sessionDiff returns the changes the session made as a unified diff, the
+// files they touch and where they were found. It returns no files if the
+// session changed nothing, and an error if there is no record of what it
+// changed.
+func (s *agentSession) sessionDiff() (diff string, files []string, source string, err error) {
+	s.mu.Lock()
+	cp := s.checkpoint
+	s.mu.Unlock()
+
+	var diffs []checkpoint.FileDiff
+	if cp != nil {
+		source = SourceCheckpoint
+		diffs, err = checkpoint.GetChangesSinceCheckpoint(cp.Project, cp.ID, s.projectDir)
+		if err != nil {
+			return "", nil, "", err
+		}
+	} else {
+		source = SourceAttribution
+		attrs, err := agentchanges.List(s.projectDir)
+		if err != nil {
+			return "", nil, "", err
+		}
+		var paths []string
+		for _, a := range attrs {
+			if a.SessionID == s.id {
+				paths = append(paths, a.Path)
+			}
+		}
+		if len(paths) == 0 && agentchanges.ModeFor(s.projectDir) == projects.AgentChangesOff {
+			return "", nil, "", fmt.Errorf("no record of the files the session changed: turn on automatic checkpoints or agent change tracking")
+		}
+		for _, path := range paths {
+			fd, err := checkpoint.GetSingleFileDiff(s.projectDir, path)
+			if err != nil {
+				return "", nil, "", err
+			}
+			if fd.Status != "unchanged" {
+				diffs = append(diffs, *fd)
+			}
+		}
+	}
+
+	var b strings.Builder
+	files = make([]string, 0, len(diffs))
+	for i := range diffs {
+		b.WriteString(diffs[i].Unified())
+		files = append(files, diffs[i].Path)
+	}
+	return b.String(), files, source, nil
+}
+
+// startSessionReview reviews the session's changes in the background as
+// identity, superseding a review still in flight.
+func (s *agentSession) startSessionReview(identity *auth.Identity) bool {
+	reviewer := getSessionReviewer()
+	if reviewer == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	s.changesReviewGen++
+	gen := s.changesReviewGen
+	s.changesReview = &SessionReview{
+		Status:    AutoReviewRunning,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Files:     []string{},
+		Findings:  []SessionFinding{},
+	}
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autoReviewTimeout)
+		defer cancel()
+		if identity != nil {
+			ctx = auth.WithIdentity(ctx, identity)
+		}
+
+		res, err := s.reviewChanges(ctx, reviewer)
+		if err != nil {
+			res = &SessionReview{Status: AutoReviewError, Error: err.Error()}
+		}
+		if res.Files == nil {
+			res.Files = []string{}
+		}
+		if res.Findings == nil {
+			res.Findings = []SessionFinding{}
+		}
+
+		s.mu.Lock()
+		if s.changesReviewGen != gen {
+			s.mu.Unlock()
+			return
+		}
+		res.StartedAt = s.changesReview.StartedAt
+		res.FinishedAt = time.Now().Format(time.RFC3339)
+		s.changesReview = res
+		s.mu.Unlock()
+
+		recordSessionReviewActivity(s, res)
+	}()
+	return true
+}
+
+func (s *agentSession) reviewChanges(ctx context.Context, reviewer SessionReviewer) (*SessionReview, error) {
+	diff, files, source, err := s.sessionDiff()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return &SessionReview{Status: AutoReviewSkipped, Source: source, Summary: "The session changed no files"}, nil
+	}
+	res, err := reviewer(ctx, s.id, s.projectDir, diff)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status == "" {
+		res.Status = AutoReviewDone
+	}
+	res.Source = source
+	res.Files = files
+	return res, nil
+}
+
+// recordSessionReviewActivity adds a finished review to the project timeline
+// and notifies users about it.
+func recordSessionReviewActivity(s *agentSession, res *SessionReview) {
+	ev := activity.Event{
+		Kind: activity.KindReview,
+		Ref:  s.id,
+	}
+	switch res.Status {
+	case AutoReviewDone:
+		ev.Title = fmt.Sprintf("Session review: %d finding(s) in %d file(s)", len(res.Findings), len(res.Files))
+		var lines []string
+		for _, f := range res.Findings {
+			lines = append(lines, fmt.Sprintf("%s:%d: %s", f.File, f.StartLine, f.Message))
+		}
+		ev.Detail = strings.Join(lines, "\n")
+		ev.Status = "ok"
+	case AutoReviewError:
+		ev.Title = "Session review failed"
+		ev.Detail = res.Error
+		ev.Status = "error"
+	default:
+		return
+	}
+	activity.Record(s.projectDir, ev)
+	notifyReview(s, ev)
+}
+
+// changesReviewSnapshot returns a copy of the session's review of its
+// changes; s.mu must be held.
+func (s *agentSession) changesReviewSnapshot() *SessionReview {
+	if s.changesReview == nil {
+		return nil
+	}
+	review := *s.changesReview
+	return &review
+}
+
+// handleSessionChangesReview returns (GET) or starts (POST) the review of
+// the changes a session made:
+//
+//	GET  /api/agents/sessions/{id}/review -> SessionReview, null if never run
+//	POST /api/agents/sessions/{id}/review -> SessionReview with status "running"
+func handleSessionChangesReview(w http.ResponseWriter, r *http.Request, sessionID string) {
+	s := sessionMgr.getFor(r.Context(), sessionID)
+	if s == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !s.startSessionReview(auth.FromContext(r.Context())) {
+			http.Error(w, "session review is not available", http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	review := s.changesReviewSnapshot()
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
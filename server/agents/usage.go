@@ -0,0 +1,293 @@
+package agents
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// ProcessUsage is the resource use of a session's agent process and its
+// descendants.
+type ProcessUsage struct {
+	// CPUPercent is the CPU used since the previous sample, 100 per core;
+	// 0 in the first sample.
+	CPUPercent float64 `json:"cpu_percent"`
+	RSSBytes   int64   `json:"rss_bytes"`
+	// Children counts the descendants running now; ChildrenStarted the
+	// ones seen since the session started.
+	Children        int    `json:"children"`
+	ChildrenStarted int    `json:"children_started"`
+	SampledAt       string `json:"sampled_at"`
+}
+
+// usageInterval is how often the usage of running sessions is sampled.
+var usageInterval = 5 * time.Second
+
+// streamKeepalive keeps the sessions stream alive while nothing runs.
+const streamKeepalive = 30 * time.Second
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc, which Linux fixes
+// at 100 on every architecture it runs agents on.
+const clockTicks = 100
+
+// procInfo is a process in the process table.
+type procInfo struct {
+	ppid int
+	rss  int64
+	cpu  time.Duration
+}
+
+// usageState is what the sampler keeps between samples of a session.
+type usageState struct {
+	at       time.Time
+	cpu      time.Duration
+	children map[int]bool
+	started  int
+}
+
+var usageSubs = struct {
+	sync.Mutex
+	chans map[chan struct{}]struct{}
+}{chans: make(map[chan struct{}]struct{})}
+
+var startSampler sync.Once
+
+// sampleUsageLoop samples the running sessions every usageInterval.
+func (m *agentSessionManager) sampleUsageLoop() {
+	ticker := time.NewTicker(usageInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if m.sampleUsage() {
+			notifyUsage()
+		}
+	}
+}
+
+// sampleUsage updates the usage of every process-backed session, returning
+// false if there is none.
+func (m *agentSessionManager) sampleUsage() bool {
+	m.mu.Lock()
+	var list []*agentSession
+	for _, s := range m.sessions {
+		if s.cmd != nil && s.cmd.Process != nil {
+			list = append(list, s)
+		}
+	}
+	m.mu.Unlock()
+	if len(list) == 0 {
+		return false
+	}
+	table, err := readProcessTable()
+	if err != nil {
+		log.Warnf("sample agent usage: %v", err)
+		return false
+	}
+	now := time.Now()
+	for _, s := range list {
+		s.mu.Lock()
+		s.usage = nil
+		if s.status == "starting" || s.status == "running" {
+			s.usage = s.usageState.update(table, s.cmd.Process.Pid, now)
+		}
+		s.mu.Unlock()
+	}
+	return true
+}
+
+// update computes the usage of the tree rooted at pid from table and
+// records the sample; nil if pid is gone.
+func (st *usageState) update(table map[int]procInfo, pid int, now time.Time) *ProcessUsage {
+	root, ok := table[pid]
+	if !ok {
+		return nil
+	}
+	childrenOf := make(map[int][]int)
+	for p, info := range table {
+		childrenOf[info.ppid] = append(childrenOf[info.ppid], p)
+	}
+	rss, cpu := root.rss, root.cpu
+	children := make(map[int]bool)
+	queue := childrenOf[pid]
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if children[p] {
+			continue
+		}
+		children[p] = true
+		rss += table[p].rss
+		cpu += table[p].cpu
+		queue = append(queue, childrenOf[p]...)
+	}
+
+	u := &ProcessUsage{RSSBytes: rss, Children: len(children), SampledAt: now.UTC().Format(time.RFC3339)}
+	for p := range children {
+		if !st.children[p] {
+			st.started++
+		}
+	}
+	u.ChildrenStarted = st.started
+	// children that exited take their CPU time with them
+	if !st.at.IsZero() && cpu > st.cpu {
+		u.CPUPercent = float64(cpu-st.cpu) / float64(now.Sub(st.at)) * 100
+	}
+	st.at, st.cpu, st.children = now, cpu, children
+	return u
+}
+
+// readProcessTable reads every process's parent, resident memory and CPU
+// time, from /proc where there is one and from ps otherwise.
+func readProcessTable() (map[int]procInfo, error) {
+	if _, err := os.Stat("/proc/self/stat"); err == nil {
+		return readProc()
+	}
+	return readPS()
+}
+
+func readProc() (map[int]procInfo, error) {
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+	pageSize := int64(os.Getpagesize())
+	table := make(map[int]procInfo, len(dirs))
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			continue // exited meanwhile
+		}
+		info, err := parseProcStat(data, pageSize)
+		if err != nil {
+			continue
+		}
+		table[pid] = info
+	}
+	return table, nil
+}
+
+// parseProcStat parses /proc/PID/stat. The command name, in parentheses,
+// may contain spaces, so the fields are counted from after it.
+func parseProcStat(data []byte, pageSize int64) (procInfo, error) {
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return procInfo{}, fmt.Errorf("no command in stat")
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// fields[0] is field 3 of proc(5): state
+	if len(fields) < 22 {
+		return procInfo{}, fmt.Errorf("short stat")
+	}
+	ppid, err1 := strconv.Atoi(fields[1])
+	utime, err2 := strconv.ParseInt(fields[11], 10, 64)
+	stime, err3 := strconv.ParseInt(fields[12], 10, 64)
+	rss, err4 := strconv.ParseInt(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return procInfo{}, fmt.Errorf("malformed stat")
+	}
+	return procInfo{
+		ppid: ppid,
+		rss:  rss * pageSize,
+		cpu:  time.Duration(utime+stime) * time.Second / clockTicks,
+	}, nil
+}
+
+func readPS() (map[int]procInfo, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,rss=,time=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ps: %w", err)
+	}
+	table := make(map[int]procInfo)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		rss, err3 := strconv.ParseInt(fields[2], 10, 64)
+		cpu, err4 := parseCPUTime(fields[3])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		table[pid] = procInfo{ppid: ppid, rss: rss * 1024, cpu: cpu}
+	}
+	return table, nil
+}
+
+func subscribeUsage() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	usageSubs.Lock()
+	usageSubs.chans[ch] = struct{}{}
+	usageSubs.Unlock()
+	return ch, func() {
+		usageSubs.Lock()
+		delete(usageSubs.chans, ch)
+		usageSubs.Unlock()
+	}
+}
+
+func notifyUsage() {
+	usageSubs.Lock()
+	defer usageSubs.Unlock()
+	for ch := range usageSubs.chans {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type sessionsEvent struct {
+	Type     string             `json:"type"`
+	Sessions []AgentSessionInfo `json:"sessions"`
+}
+
+// handleAgentSessionsStream sends the caller's sessions, with their usage,
+// now and after every sample until the client disconnects. Each SSE message
+// is {"type":"sessions","sessions":[AgentSessionInfo]}.
+//
+//	GET /api/agents/sessions/stream
+func handleAgentSessionsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	owner := tenant.Name(r.Context())
+	ch, unsubscribe := subscribeUsage()
+	defer unsubscribe()
+	ticker := time.NewTicker(streamKeepalive)
+	defer ticker.Stop()
+	send := func() {
+		sw.Send(sessionsEvent{Type: "sessions", Sessions: sessionMgr.listPaginated(owner, 1, 1000).Sessions})
+	}
+	send()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			sw.SendStatus("alive", nil)
+		case <-ch:
+			send()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package agents
+
+import (
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat := "4242 (my (odd) cmd) S 17 4242 4242 0 -1 4194560 500 0 0 0 250 50 0 0 20 0 1 0 1000 10000000 300 18446744073709551615\n"
+	info, err := parseProcStat([]byte(stat), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ppid != 17 || info.cpu != 3*time.Second || info.rss != 300*4096 {
+		t.Errorf("parsed %+v", info)
+	}
+}
+
+func TestUsageStateUpdate(t *testing.T) {
+	var st usageState
+	t0 := time.Now()
+	table := map[int]procInfo{
+		10: {ppid: 1, rss: 100, cpu: time.Second},
+		11: {ppid: 10, rss: 50, cpu: time.Second},
+		12: {ppid: 11, rss: 25},
+		99: {ppid: 1, rss: 1 << 30, cpu: time.Hour}, // not ours
+	}
+	u := st.update(table, 10, t0)
+	if u.RSSBytes != 175 || u.Children != 2 || u.ChildrenStarted != 2 || u.CPUPercent != 0 {
+		t.Errorf("first sample %+v", u)
+	}
+
+	delete(table, 12)
+	table[13] = procInfo{ppid: 10}
+	table[10] = procInfo{ppid: 1, rss: 100, cpu: 3 * time.Second} // two more seconds over 5s
+	u = st.update(table, 10, t0.Add(5*time.Second))
+	if u.Children != 2 || u.ChildrenStarted != 3 || u.CPUPercent != 40 {
+		t.Errorf("second sample %+v", u)
+	}
+
+	if st.update(map[int]procInfo{}, 10, t0) != nil {
+		t.Error("usage of a gone process")
+	}
+}
+
+func TestReadProcessTable(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		exec.Command("pkill", "-P", strconv.Itoa(cmd.Process.Pid)).Run()
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var st usageState
+	var u *ProcessUsage
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		table, err := readProcessTable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u = st.update(table, cmd.Process.Pid, time.Now()); u != nil && u.Children == 2 {
+			break
+		}
+	}
+	if u == nil || u.Children != 2 || u.RSSBytes <= 0 {
+		t.Errorf("usage %+v", u)
+	}
+}
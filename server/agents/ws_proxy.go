@@ -0,0 +1,177 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var proxyWSUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsProxyHandshakeTimeout bounds dialing the agent's WebSocket endpoint.
+const wsProxyHandshakeTimeout = 10 * time.Second
+
+// proxyWebSocket relays a WebSocket connection to ws://127.0.0.1:{port}{path}.
+// Messages are copied in both directions and a close frame from either side
+// is forwarded to the other with its code and reason.
+func proxyWebSocket(w http.ResponseWriter, r *http.Request, port int, path string) {
+	target := fmt.Sprintf("ws://127.0.0.1:%d%s", port, path)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	reqHeader := http.Header{}
+	for _, h := range []string{"Authorization", "Cookie", "Origin"} {
+		if v := r.Header.Get(h); v != "" {
+			reqHeader.Set(h, v)
+		}
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: wsProxyHandshakeTimeout,
+		Subprotocols:     websocket.Subprotocols(r),
+	}
+	backend, resp, err := dialer.DialContext(r.Context(), target, reqHeader)
+	if err != nil {
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		http.Error(w, fmt.Sprintf("websocket proxy error: %v", err), status)
+		return
+	}
+	defer backend.Close()
+
+	var respHeader http.Header
+	if proto := backend.Subprotocol(); proto != "" {
+		respHeader = http.Header{"Sec-Websocket-Protocol": {proto}}
+	}
+	client, err := proxyWSUpgrader.Upgrade(w, r, respHeader)
+	if err != nil {
+		// Upgrade already wrote an HTTP error response
+		return
+	}
+	defer client.Close()
+
+	errc := make(chan error, 2)
+	go func() { errc <- copyWebSocket(backend, client) }()
+	go func() { errc <- copyWebSocket(client, backend) }()
+	<-errc
+}
+
+// copyWebSocket copies messages from src to dst until src fails or closes.
+// A close frame received on src is sent to dst before returning.
+func copyWebSocket(dst, src *websocket.Conn) error {
+	for {
+		msgType, data, err := src.ReadMessage()
+		if err != nil {
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+			if ce, ok := err.(*websocket.CloseError); ok && ce.Code != websocket.CloseNoStatusReceived {
+				closeMsg = websocket.FormatCloseMessage(ce.Code, ce.Text)
+			}
+			_ = dst.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			return err
+		}
+		if err := dst.WriteMessage(msgType, data); err != nil {
+			return err
+		}
+	}
+}
+
+// serveSSEOverWebSocket upgrades the request and runs an SSE handler against
+// it, sending the data of each SSE event as one text message. This lets
+// clients subscribe to the same event streams over a WebSocket.
+func serveSSEOverWebSocket(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	conn, err := proxyWSUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// The client only sends control frames; reading surfaces its close.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sseReq := r.Clone(ctx)
+	for _, h := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions"} {
+		sseReq.Header.Del(h)
+	}
+	sseReq.Header.Set("Accept", "text/event-stream")
+
+	sw := &sseFrameWriter{conn: conn, header: http.Header{}, cancel: cancel}
+	serve(sw, sseReq)
+
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "stream ended"),
+		time.Now().Add(time.Second))
+}
+
+// sseFrameWriter is an http.ResponseWriter that parses the SSE byte stream
+// written to it and forwards each event's data over a WebSocket.
+type sseFrameWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *sseFrameWriter) Header() http.Header { return s.header }
+
+func (s *sseFrameWriter) WriteHeader(status int) {
+	if status >= 400 {
+		_ = s.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, http.StatusText(status)),
+			time.Now().Add(time.Second))
+		s.cancel()
+	}
+}
+
+func (s *sseFrameWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(p)
+	for {
+		raw := s.buf.Bytes()
+		end := bytes.Index(raw, []byte("\n\n"))
+		if end < 0 {
+			return len(p), nil
+		}
+		event := string(raw[:end])
+		s.buf.Next(end + 2)
+
+		var data []string
+		for _, line := range strings.Split(event, "\n") {
+			if v, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, strings.TrimPrefix(v, " "))
+			}
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if err := s.conn.WriteMessage(websocket.TextMessage, []byte(strings.Join(data, "\n"))); err != nil {
+			s.cancel()
+			return 0, err
+		}
+	}
+}
+
+// Flush is a no-op: complete events are sent as soon as they are written.
+func (s *sseFrameWriter) Flush() {}
@@ -0,0 +1,240 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CallCompletion calls the configured provider for a non-streaming completion
+func CallCompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
+	switch cfg.Provider {
+	case ProviderAnthropic:
+		return anthropicCompletion(ctx, cfg, messages)
+	case ProviderGemini:
+		return geminiCompletion(ctx, cfg, messages)
+	case ProviderOllama:
+		return ollamaCompletion(ctx, cfg, messages)
+	case ProviderOpenAI, "":
+		return openAICompletion(ctx, cfg, messages)
+	}
+	return "", fmt.Errorf("unsupported AI provider type %q", cfg.Provider)
+}
+
+// CallStream calls the configured provider with streaming enabled. Every
+// provider reports thinking and content chunks, then one done chunk carrying
+// the token usage.
+func CallStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
+	switch cfg.Provider {
+	case ProviderAnthropic:
+		return anthropicStream(ctx, cfg, messages, callback)
+	case ProviderGemini:
+		return geminiStream(ctx, cfg, messages, callback)
+	case ProviderOllama:
+		return ollamaStream(ctx, cfg, messages, callback)
+	case ProviderOpenAI, "":
+		return openAIStream(ctx, cfg, messages, callback)
+	}
+	return fmt.Errorf("unsupported AI provider type %q", cfg.Provider)
+}
+
+type usageReporterKey struct{}
+
+// WithUsageReporter returns a context whose AI calls report the tokens they
+// consumed to fn, e.g. for per-user quotas.
+func WithUsageReporter(ctx context.Context, fn func(TokenUsage)) context.Context {
+	return context.WithValue(ctx, usageReporterKey{}, fn)
+}
+
+// UsageRecorder receives the token usage of every AI call, with the config
+// it was made with.
+type UsageRecorder func(ctx context.Context, cfg Config, usage TokenUsage)
+
+var usageRecorder UsageRecorder
+
+// SetUsageRecorder installs the recorder called after every call that used
+// tokens, in addition to any context reporter. It must be called before AI
+// calls are made; nil disables recording.
+func SetUsageRecorder(fn UsageRecorder) {
+	usageRecorder = fn
+}
+
+func reportUsage(ctx context.Context, cfg Config, usage TokenUsage) {
+	if usage.TotalTokens <= 0 {
+		return
+	}
+	if fn, ok := ctx.Value(usageReporterKey{}).(func(TokenUsage)); ok {
+		fn(usage)
+	}
+	if usageRecorder != nil {
+		usageRecorder(ctx, cfg, usage)
+	}
+}
+
+// estimateUsage approximates token counts (about 4 characters per token)
+// for providers that don't report usage.
+func estimateUsage(messages []Message, completion int) TokenUsage {
+	prompt := 0
+	for _, m := range messages {
+		prompt += len(m.Content)
+	}
+	u := TokenUsage{PromptTokens: (prompt + 3) / 4, CompletionTokens: (completion + 3) / 4}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// NewModelsRequest builds the provider's list-models request, which needs
+// a valid API key (except for Ollama) and so doubles as a credentials check.
+func NewModelsRequest(ctx context.Context, cfg Config) (*http.Request, error) {
+	var url string
+	header := http.Header{}
+	switch cfg.Provider {
+	case ProviderAnthropic:
+		base, h, _ := anthropicCall(cfg, nil, false)
+		url, header = strings.TrimSuffix(base, "/messages")+"/models", h
+	case ProviderGemini:
+		u, h, _ := geminiCall(cfg, nil, "generateContent")
+		url, header = u[:strings.LastIndex(u, "/")], h
+	case ProviderOllama:
+		_, h, _ := ollamaCall(cfg, nil, false)
+		url, header = OllamaBaseURL(cfg.BaseURL)+"/api/tags", h
+	default:
+		base := strings.TrimSuffix(cfg.BaseURL, "/")
+		if base == "" {
+			base = "https://api.openai.com/v1"
+		}
+		url = base + "/models"
+		header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	return req, nil
+}
+
+// splitSystem separates the system messages, which Anthropic and Gemini take
+// as a separate instruction, from the conversation. Consecutive messages of
+// the same role are merged since both APIs expect the roles to alternate.
+func splitSystem(messages []Message) (system string, conversation []Message) {
+	var systemParts []string
+	for _, m := range messages {
+		if m.Role == "system" {
+			systemParts = append(systemParts, m.Content)
+			continue
+		}
+		role := m.Role
+		if role != "assistant" {
+			role = "user"
+		}
+		if n := len(conversation); n > 0 && conversation[n-1].Role == role {
+			conversation[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		conversation = append(conversation, Message{Role: role, Content: m.Content})
+	}
+	return strings.Join(systemParts, "\n\n"), conversation
+}
+
+// postJSON sends body to url and returns the response if its status is 2xx.
+// Otherwise the error carries the message from the provider's error body.
+func postJSON(ctx context.Context, url string, header http.Header, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("%s: %s", resp.Status, errorMessage(msg))
+	}
+	return resp, nil
+}
+
+// errorMessage extracts {"error": {"message": ...}}, the error shape of both
+// Anthropic and Gemini, or Ollama's {"error": "..."}, falling back to the
+// raw body.
+func errorMessage(body []byte) string {
+	var e struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && len(e.Error) > 0 {
+		var msg string
+		var obj struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(e.Error, &msg) == nil && msg != "" {
+			return msg
+		}
+		if json.Unmarshal(e.Error, &obj) == nil && obj.Message != "" {
+			return obj.Message
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// readSSE calls fn with the event name and data of each server-sent event
+// in r until fn returns an error or the stream ends.
+func readSSE(r io.Reader, fn func(event string, data []byte) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 8<<20)
+	var event string
+	var data []byte
+	for sc.Scan() {
+		line := sc.Bytes()
+		switch {
+		case len(line) == 0:
+			if len(data) > 0 {
+				if err := fn(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" "))...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fn(event, data)
+	}
+	return nil
+}
+
+// streamError maps the errors of an interrupted stream like openAIStream does.
+func streamError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Printf("[AI] Stream canceled by client\n")
+		return fmt.Errorf("request canceled by client")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Printf("[AI] Stream timed out\n")
+		return fmt.Errorf("stream timed out")
+	}
+	fmt.Printf("[AI] Stream error: %v\n", err)
+	return fmt.Errorf("stream error: %w", err)
+}
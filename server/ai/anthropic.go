@@ -0,0 +1,196 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+	anthropicDefaultModel   = "claude-3-5-haiku-latest"
+	// anthropicDefaultMaxTokens is sent when the model config has none, as
+	// the Messages API requires max_tokens.
+	anthropicDefaultMaxTokens = 8192
+)
+
+// anthropicRequest is the body of POST /v1/messages.
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"` // "user" or "assistant"
+	Content string `json:"content"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// anthropicCall builds the request: system messages move to the system
+// field and the conversation must start with a user turn.
+func anthropicCall(cfg Config, messages []Message, stream bool) (string, http.Header, anthropicRequest) {
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	if base == "" {
+		base = anthropicDefaultBaseURL
+	}
+	base = strings.TrimSuffix(base, "/v1")
+
+	header := http.Header{}
+	header.Set("x-api-key", cfg.APIKey)
+	header.Set("anthropic-version", anthropicVersion)
+
+	system, conversation := splitSystem(messages)
+	if len(conversation) == 0 || conversation[0].Role != "user" {
+		conversation = append([]Message{{Role: "user", Content: "Continue."}}, conversation...)
+	}
+	req := anthropicRequest{
+		Model:     cfg.Model,
+		MaxTokens: cfg.MaxTokens,
+		System:    system,
+		Messages:  make([]anthropicMessage, len(conversation)),
+		Stream:    stream,
+	}
+	if req.Model == "" {
+		req.Model = anthropicDefaultModel
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = anthropicDefaultMaxTokens
+	}
+	for i, m := range conversation {
+		req.Messages[i] = anthropicMessage{Role: m.Role, Content: m.Content}
+	}
+	return base + "/v1/messages", header, req
+}
+
+// anthropicCompletion calls the Anthropic Messages API
+func anthropicCompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
+	url, header, req := anthropicCall(cfg, messages, false)
+	resp, err := postJSON(ctx, url, header, req)
+	if err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): %w", req.Model, err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): invalid response: %w", req.Model, err)
+	}
+	var text strings.Builder
+	for _, block := range out.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no response from AI")
+	}
+
+	usage := out.Usage.tokenUsage()
+	if usage.TotalTokens == 0 {
+		usage = estimateUsage(messages, text.Len())
+	}
+	reportUsage(ctx, cfg, usage)
+	return text.String(), nil
+}
+
+// anthropicStream streams from the Anthropic Messages API. Input tokens
+// arrive with message_start and output tokens with message_delta.
+func anthropicStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
+	url, header, req := anthropicCall(cfg, messages, true)
+	fmt.Printf("[AI] Creating Anthropic stream for model: %s\n", req.Model)
+	resp, err := postJSON(ctx, url, header, req)
+	if err != nil {
+		return fmt.Errorf("failed to create stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var usage anthropicUsage
+	completion := 0
+	var callbackErr error
+	err = readSSE(resp.Body, func(event string, data []byte) error {
+		var ev struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type     string `json:"type"`
+				Text     string `json:"text"`
+				Thinking string `json:"thinking"`
+			} `json:"delta"`
+			Usage *anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil // e.g. ping events
+		}
+		switch ev.Type {
+		case "message_start":
+			usage.InputTokens = ev.Message.Usage.InputTokens
+		case "message_delta":
+			if ev.Usage != nil {
+				usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			var chunk StreamChunk
+			switch ev.Delta.Type {
+			case "text_delta":
+				chunk = StreamChunk{Type: ChunkTypeContent, Content: ev.Delta.Text}
+			case "thinking_delta":
+				chunk = StreamChunk{Type: ChunkTypeThinking, Content: ev.Delta.Thinking}
+			}
+			if chunk.Content == "" {
+				return nil
+			}
+			completion += len(chunk.Content)
+			if err := callback(chunk); err != nil {
+				callbackErr = err
+				return err
+			}
+		case "error":
+			return fmt.Errorf("%s", ev.Error.Message)
+		}
+		return nil
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	if err != nil {
+		return streamError(err)
+	}
+	fmt.Printf("[AI] Stream EOF\n")
+
+	tokens := usage.tokenUsage()
+	if tokens.TotalTokens == 0 {
+		tokens = estimateUsage(messages, completion)
+	}
+	reportUsage(ctx, cfg, tokens)
+	callback(StreamChunk{Type: ChunkTypeDone, Content: "", TokenUsage: &tokens})
+	return nil
+}
@@ -0,0 +1,234 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a cached response is served.
+const DefaultCacheTTL = 24 * time.Hour
+
+// cachePruneInterval bounds how often Put sweeps expired entries.
+const cachePruneInterval = time.Hour
+
+// CachedResponse is a complete streamed response stored by Cache.
+type CachedResponse struct {
+	Key       string      `json:"key"`
+	Provider  Provider    `json:"provider"`
+	Model     string      `json:"model"`
+	CreatedAt time.Time   `json:"created_at"`
+	Thinking  string      `json:"thinking,omitempty"`
+	Content   string      `json:"content"`
+	Usage     *TokenUsage `json:"usage,omitempty"`
+}
+
+// Replay sends the response through callback as a thinking chunk, a content
+// chunk and a done chunk. The done chunk carries no usage: nothing was spent.
+func (r *CachedResponse) Replay(callback StreamCallback) error {
+	if r.Thinking != "" {
+		if err := callback(StreamChunk{Type: ChunkTypeThinking, Content: r.Thinking}); err != nil {
+			return err
+		}
+	}
+	if err := callback(StreamChunk{Type: ChunkTypeContent, Content: r.Content}); err != nil {
+		return err
+	}
+	return callback(StreamChunk{Type: ChunkTypeDone})
+}
+
+// Cache is a content-addressed store of streamed responses, one JSON file
+// per key, so an unchanged request (same diff, rules, question and model)
+// is answered without calling the provider.
+type Cache struct {
+	dir string
+	ttl time.Duration
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewCache returns a cache storing entries in dir; ttl <= 0 uses
+// DefaultCacheTTL.
+func NewCache(dir string, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// TTL returns how long entries are served.
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// CacheKey hashes everything that determines a response: provider, base
+// URL, model, token limit and messages. The API key is left out.
+func CacheKey(cfg Config, messages []Message) string {
+	data, _ := json.Marshal(struct {
+		Provider  Provider  `json:"provider"`
+		BaseURL   string    `json:"base_url"`
+		Model     string    `json:"model"`
+		MaxTokens int       `json:"max_tokens"`
+		Messages  []Message `json:"messages"`
+	}{cfg.Provider, cfg.BaseURL, cfg.Model, cfg.MaxTokens, messages})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validCacheKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the unexpired entry for key.
+func (c *Cache) Get(key string) (*CachedResponse, bool) {
+	if !validCacheKey(key) {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var r CachedResponse
+	if err := json.Unmarshal(data, &r); err != nil || time.Since(r.CreatedAt) > c.ttl {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return &r, true
+}
+
+// Put stores r under r.Key.
+func (c *Cache) Put(r *CachedResponse) error {
+	if !validCacheKey(r.Key) {
+		return fmt.Errorf("invalid cache key %q", r.Key)
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	if time.Since(c.lastPruned) > cachePruneInterval {
+		c.lastPruned = time.Now()
+		c.pruneLocked(false)
+	}
+	return os.WriteFile(c.path(r.Key), data, 0644)
+}
+
+// Invalidate removes the entry for key, reporting whether it existed.
+func (c *Cache) Invalidate(key string) bool {
+	if !validCacheKey(key) {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return os.Remove(c.path(key)) == nil
+}
+
+// Clear removes every entry and returns how many there were.
+func (c *Cache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pruneLocked(true)
+}
+
+// CacheStats describes the entries on disk.
+type CacheStats struct {
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// Stats counts the entries on disk, expired ones included until pruned.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CacheStats{TTLSeconds: int64(c.ttl / time.Second)}
+	entries, _ := os.ReadDir(c.dir)
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			stats.Entries++
+			stats.Bytes += info.Size()
+		}
+	}
+	return stats
+}
+
+// pruneLocked removes expired entries, or all entries when all is set, and
+// returns the number removed.
+func (c *Cache) pruneLocked(all bool) int {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if !all {
+			info, err := e.Info()
+			if err != nil || time.Since(info.ModTime()) <= c.ttl {
+				continue
+			}
+		}
+		if os.Remove(filepath.Join(c.dir, e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Stream calls CallStream and, if the response completes without error,
+// stores it under key.
+func (c *Cache) Stream(ctx context.Context, key string, cfg Config, messages []Message, callback StreamCallback) error {
+	r := &CachedResponse{Key: key, Provider: cfg.Provider, Model: cfg.Model}
+	var thinking, content strings.Builder
+	failed := false
+	err := CallStream(ctx, cfg, messages, func(chunk StreamChunk) error {
+		switch chunk.Type {
+		case ChunkTypeThinking:
+			thinking.WriteString(chunk.Content)
+		case ChunkTypeContent:
+			content.WriteString(chunk.Content)
+		case ChunkTypeDone:
+			r.Usage = chunk.TokenUsage
+		case ChunkTypeError:
+			failed = true
+		}
+		return callback(chunk)
+	})
+	if err != nil || failed || ctx.Err() != nil || content.Len() == 0 {
+		return err
+	}
+	r.CreatedAt = time.Now()
+	r.Thinking = thinking.String()
+	r.Content = content.String()
+	if err := c.Put(r); err != nil {
+		fmt.Printf("[AI] Failed to cache response: %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheStream(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"plan","thought":true}]}}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Looks good"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3,"totalTokenCount":13}}
+
+`)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := Config{Provider: ProviderGemini, APIKey: "k", BaseURL: srv.URL, Model: "gemini-x"}
+	cache := NewCache(t.TempDir(), time.Hour)
+	key := CacheKey(cfg, testMessages)
+
+	var content string
+	err := cache.Stream(context.Background(), key, cfg, testMessages, func(c StreamChunk) error {
+		if c.Type == ChunkTypeContent {
+			content += c.Content
+		}
+		return nil
+	})
+	if err != nil || content != "Looks good" || calls != 1 {
+		t.Fatalf("stream: err %v, content %q, calls %d", err, content, calls)
+	}
+
+	cached, ok := cache.Get(key)
+	if !ok {
+		t.Fatal("response not cached")
+	}
+	var thinking string
+	content = ""
+	cached.Replay(func(c StreamChunk) error {
+		switch c.Type {
+		case ChunkTypeThinking:
+			thinking += c.Content
+		case ChunkTypeContent:
+			content += c.Content
+		}
+		return nil
+	})
+	if thinking != "plan" || content != "Looks good" || cached.Usage == nil || cached.Usage.TotalTokens != 13 {
+		t.Errorf("replay: thinking %q, content %q, usage %+v", thinking, content, cached.Usage)
+	}
+
+	other := append([]Message(nil), testMessages...)
+	other[0].Content = "be thorough"
+	if CacheKey(cfg, other) == key {
+		t.Error("different messages must hash differently")
+	}
+	withKey := cfg
+	withKey.APIKey = "other"
+	if CacheKey(withKey, testMessages) != key {
+		t.Error("API key must not affect the key")
+	}
+
+	if !cache.Invalidate(key) {
+		t.Error("Invalidate: entry not found")
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Error("entry served after Invalidate")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(dir, time.Minute)
+	key := CacheKey(Config{Model: "m"}, testMessages)
+	if err := cache.Put(&CachedResponse{Key: key, Content: "x", CreatedAt: time.Now().Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Error("expired entry served")
+	}
+	if _, err := os.Stat(filepath.Join(dir, key+".json")); !os.IsNotExist(err) {
+		t.Error("expired entry not removed")
+	}
+
+	cache.Put(&CachedResponse{Key: key, Content: "x", CreatedAt: time.Now()})
+	if n := cache.Clear(); n != 1 {
+		t.Errorf("Clear removed %d, want 1", n)
+	}
+	if err := cache.Put(&CachedResponse{Key: "../escape"}); err == nil {
+		t.Error("invalid key accepted")
+	}
+}
@@ -0,0 +1,201 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	geminiDefaultBaseURL = "https://generativelanguage.googleapis.com"
+	geminiDefaultModel   = "gemini-2.0-flash"
+)
+
+// geminiRequest is the body of generateContent and streamGenerateContent.
+type geminiRequest struct {
+	Contents          []geminiContent  `json:"contents"`
+	SystemInstruction *geminiContent   `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // "user" or "model"
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text    string `json:"text"`
+	Thought bool   `json:"thought,omitempty"`
+}
+
+type geminiGenConfig struct {
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+}
+
+// geminiResponse is a generateContent response, or one streamed chunk.
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (r *geminiResponse) tokenUsage() (TokenUsage, bool) {
+	if r.UsageMetadata == nil {
+		return TokenUsage{}, false
+	}
+	m := r.UsageMetadata
+	return TokenUsage{
+		PromptTokens:     m.PromptTokenCount,
+		CompletionTokens: m.CandidatesTokenCount + m.ThoughtsTokenCount,
+		TotalTokens:      m.TotalTokenCount,
+	}, true
+}
+
+// geminiCall builds the request for method (generateContent or
+// streamGenerateContent). The assistant role is called "model" in Gemini.
+func geminiCall(cfg Config, messages []Message, method string) (string, http.Header, geminiRequest) {
+	base := strings.TrimRight(cfg.BaseURL, "/")
+	if base == "" {
+		base = geminiDefaultBaseURL
+	}
+	// also accept the base URL of Gemini's OpenAI-compatible endpoint
+	base = strings.TrimSuffix(base, "/openai")
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "/v1beta"), "/v1")
+
+	model := cfg.Model
+	if model == "" {
+		model = geminiDefaultModel
+	}
+	model = strings.TrimPrefix(model, "models/")
+
+	header := http.Header{}
+	header.Set("x-goog-api-key", cfg.APIKey)
+
+	system, conversation := splitSystem(messages)
+	req := geminiRequest{Contents: make([]geminiContent, len(conversation))}
+	for i, m := range conversation {
+		role := "user"
+		if m.Role == "assistant" {
+			role = "model"
+		}
+		req.Contents[i] = geminiContent{Role: role, Parts: []geminiPart{{Text: m.Content}}}
+	}
+	if system != "" {
+		req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	if cfg.MaxTokens > 0 {
+		req.GenerationConfig = &geminiGenConfig{MaxOutputTokens: cfg.MaxTokens}
+	}
+
+	u := fmt.Sprintf("%s/v1beta/models/%s:%s", base, url.PathEscape(model), method)
+	if method == "streamGenerateContent" {
+		u += "?alt=sse"
+	}
+	return u, header, req
+}
+
+// geminiCompletion calls the Gemini generateContent API
+func geminiCompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
+	u, header, req := geminiCall(cfg, messages, "generateContent")
+	resp, err := postJSON(ctx, u, header, req)
+	if err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): %w", cfg.Model, err)
+	}
+	defer resp.Body.Close()
+
+	var out geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): invalid response: %w", cfg.Model, err)
+	}
+	var text strings.Builder
+	if len(out.Candidates) > 0 {
+		for _, part := range out.Candidates[0].Content.Parts {
+			if !part.Thought {
+				text.WriteString(part.Text)
+			}
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no response from AI")
+	}
+
+	usage, ok := out.tokenUsage()
+	if !ok || usage.TotalTokens == 0 {
+		usage = estimateUsage(messages, text.Len())
+	}
+	reportUsage(ctx, cfg, usage)
+	return text.String(), nil
+}
+
+// geminiStream streams from the Gemini streamGenerateContent API. Every
+// chunk repeats the usage so far; the last one is final.
+func geminiStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
+	u, header, req := geminiCall(cfg, messages, "streamGenerateContent")
+	fmt.Printf("[AI] Creating Gemini stream for model: %s\n", cfg.Model)
+	resp, err := postJSON(ctx, u, header, req)
+	if err != nil {
+		return fmt.Errorf("failed to create stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var usage *TokenUsage
+	completion := 0
+	var callbackErr error
+	err = readSSE(resp.Body, func(event string, data []byte) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s", chunk.Error.Message)
+		}
+		if u, ok := chunk.tokenUsage(); ok {
+			usage = &u
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			typ := ChunkTypeContent
+			if part.Thought {
+				typ = ChunkTypeThinking
+			}
+			completion += len(part.Text)
+			if err := callback(StreamChunk{Type: typ, Content: part.Text}); err != nil {
+				callbackErr = err
+				return err
+			}
+		}
+		return nil
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	if err != nil {
+		return streamError(err)
+	}
+	fmt.Printf("[AI] Stream EOF\n")
+
+	if usage == nil || usage.TotalTokens == 0 {
+		estimated := estimateUsage(messages, completion)
+		usage = &estimated
+	}
+	reportUsage(ctx, cfg, *usage)
+	callback(StreamChunk{Type: ChunkTypeDone, Content: "", TokenUsage: usage})
+	return nil
+}
@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// OllamaDefaultBaseURL is where a local Ollama daemon listens by default.
+	OllamaDefaultBaseURL = "http://localhost:11434"
+	// envOllamaHost is Ollama's own setting for its address, e.g. 0.0.0.0:11434.
+	envOllamaHost = "OLLAMA_HOST"
+)
+
+// ollamaRequest is the body of POST /api/chat.
+type ollamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  *ollamaOptions `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	NumPredict int `json:"num_predict,omitempty"`
+}
+
+// ollamaResponse is a non-streaming /api/chat response, or one line of a
+// streamed one; the last line has Done set and carries the token counts.
+type ollamaResponse struct {
+	Message struct {
+		Content  string `json:"content"`
+		Thinking string `json:"thinking"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+func (r *ollamaResponse) tokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// OllamaBaseURL returns the root URL of the Ollama API for a configured base
+// URL: empty means OLLAMA_HOST or the local default, and the /v1 suffix of
+// Ollama's OpenAI-compatible endpoint is dropped.
+func OllamaBaseURL(baseURL string) string {
+	base := strings.TrimSpace(baseURL)
+	if base == "" {
+		base = os.Getenv(envOllamaHost)
+	}
+	if base == "" {
+		return OllamaDefaultBaseURL
+	}
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	base = strings.TrimRight(base, "/")
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "/v1"), "/api")
+	// 0.0.0.0 is a listen address; connect locally
+	return strings.Replace(base, "://0.0.0.0", "://localhost", 1)
+}
+
+// OllamaModel is a model pulled into an Ollama daemon.
+type OllamaModel struct {
+	Name          string `json:"name"` // e.g. "llama3.2:latest"
+	Size          int64  `json:"size"`
+	ParameterSize string `json:"parameter_size,omitempty"` // e.g. "3.2B"
+}
+
+// ListOllamaModels lists the models of the Ollama daemon at baseURL via
+// GET /api/tags. It fails fast when no daemon is running, so it also serves
+// to detect one; bound it with ctx.
+func ListOllamaModels(ctx context.Context, baseURL string) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, OllamaBaseURL(baseURL)+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama: %s", resp.Status)
+	}
+	var out struct {
+		Models []struct {
+			Name    string `json:"name"`
+			Size    int64  `json:"size"`
+			Details struct {
+				ParameterSize string `json:"parameter_size"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("ollama: invalid /api/tags response: %w", err)
+	}
+	models := make([]OllamaModel, len(out.Models))
+	for i, m := range out.Models {
+		models[i] = OllamaModel{Name: m.Name, Size: m.Size, ParameterSize: m.Details.ParameterSize}
+	}
+	return models, nil
+}
+
+// ollamaCall builds the /api/chat request. Ollama needs no API key, but one
+// is sent if configured, for daemons behind an authenticating proxy.
+func ollamaCall(cfg Config, messages []Message, stream bool) (string, http.Header, ollamaRequest) {
+	header := http.Header{}
+	if cfg.APIKey != "" {
+		header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	req := ollamaRequest{Model: cfg.Model, Messages: messages, Stream: stream}
+	if req.Messages == nil {
+		req.Messages = []Message{}
+	}
+	if cfg.MaxTokens > 0 {
+		req.Options = &ollamaOptions{NumPredict: cfg.MaxTokens}
+	}
+	return OllamaBaseURL(cfg.BaseURL) + "/api/chat", header, req
+}
+
+// ollamaCompletion calls the Ollama chat API
+func ollamaCompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
+	url, header, req := ollamaCall(cfg, messages, false)
+	resp, err := postJSON(ctx, url, header, req)
+	if err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): %w", cfg.Model, err)
+	}
+	defer resp.Body.Close()
+
+	var out ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("AI API error (model: %s): invalid response: %w", cfg.Model, err)
+	}
+	if out.Error != "" {
+		return "", fmt.Errorf("AI API error (model: %s): %s", cfg.Model, out.Error)
+	}
+	if out.Message.Content == "" {
+		return "", fmt.Errorf("no response from AI")
+	}
+
+	usage := out.tokenUsage()
+	if usage.TotalTokens == 0 {
+		usage = estimateUsage(messages, len(out.Message.Content))
+	}
+	reportUsage(ctx, cfg, usage)
+	return out.Message.Content, nil
+}
+
+// ollamaStream streams from the Ollama chat API, which sends one JSON object
+// per line rather than server-sent events.
+func ollamaStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
+	url, header, req := ollamaCall(cfg, messages, true)
+	fmt.Printf("[AI] Creating Ollama stream for model: %s\n", cfg.Model)
+	resp, err := postJSON(ctx, url, header, req)
+	if err != nil {
+		return fmt.Errorf("failed to create stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var usage TokenUsage
+	completion := 0
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 8<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return streamError(fmt.Errorf("invalid stream chunk: %w", err))
+		}
+		if chunk.Error != "" {
+			return streamError(fmt.Errorf("%s", chunk.Error))
+		}
+		for _, c := range []StreamChunk{
+			{Type: ChunkTypeThinking, Content: chunk.Message.Thinking},
+			{Type: ChunkTypeContent, Content: chunk.Message.Content},
+		} {
+			if c.Content == "" {
+				continue
+			}
+			completion += len(c.Content)
+			if err := callback(c); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			usage = chunk.tokenUsage()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return streamError(err)
+	}
+	fmt.Printf("[AI] Stream EOF\n")
+
+	if usage.TotalTokens == 0 {
+		usage = estimateUsage(messages, completion)
+	}
+	reportUsage(ctx, cfg, usage)
+	callback(StreamChunk{Type: ChunkTypeDone, Content: "", TokenUsage: &usage})
+	return nil
+}
@@ -18,8 +18,8 @@ func getClient(cfg Config) *openaisdk.Client {
 	return openaisdk.NewClientWithConfig(clientCfg)
 }
 
-// CallCompletion calls the AI API for a non-streaming completion
-func CallCompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
+// openAICompletion calls an OpenAI-compatible chat completions API
+func openAICompletion(ctx context.Context, cfg Config, messages []Message) (string, error) {
 	client := getClient(cfg)
 
 	// Convert messages to OpenAI format
@@ -53,11 +53,21 @@ func CallCompletion(ctx context.Context, cfg Config, messages []Message) (string
 		return "", fmt.Errorf("no response from AI")
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	content := resp.Choices[0].Message.Content
+	usage := TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage = estimateUsage(messages, len(content))
+	}
+	reportUsage(ctx, cfg, usage)
+	return content, nil
 }
 
-// CallStream calls the AI API with streaming enabled using the official SDK
-func CallStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
+// openAIStream streams an OpenAI-compatible chat completion using the SDK
+func openAIStream(ctx context.Context, cfg Config, messages []Message, callback StreamCallback) error {
 	client := getClient(cfg)
 
 	// Convert messages to OpenAI format
@@ -78,6 +88,8 @@ func CallStream(ctx context.Context, cfg Config, messages []Message, callback St
 		Model:    model,
 		Messages: openaiMessages,
 		Stream:   true,
+		// the final chunk then carries the token usage
+		StreamOptions: &openaisdk.StreamOptions{IncludeUsage: true},
 	}
 	if cfg.MaxTokens > 0 {
 		streamReq.MaxTokens = cfg.MaxTokens
@@ -92,11 +104,22 @@ func CallStream(ctx context.Context, cfg Config, messages []Message, callback St
 	defer stream.Close()
 	fmt.Printf("[AI] Stream created, waiting for responses...\n")
 
+	var usage *TokenUsage
+	completion := 0
+	finish := func() {
+		if usage == nil {
+			estimated := estimateUsage(messages, completion)
+			usage = &estimated
+		}
+		reportUsage(ctx, cfg, *usage)
+		callback(StreamChunk{Type: ChunkTypeDone, Content: "", TokenUsage: usage})
+	}
+	finished := false
 	for {
 		response, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
 			fmt.Printf("[AI] Stream EOF\n")
-			callback(StreamChunk{Type: ChunkTypeDone, Content: ""})
+			finish()
 			return nil
 		}
 		if err != nil {
@@ -112,16 +135,24 @@ func CallStream(ctx context.Context, cfg Config, messages []Message, callback St
 			return fmt.Errorf("stream error: %w", err)
 		}
 
-		if len(response.Choices) == 0 {
+		if response.Usage != nil {
+			usage = &TokenUsage{
+				PromptTokens:     response.Usage.PromptTokens,
+				CompletionTokens: response.Usage.CompletionTokens,
+				TotalTokens:      response.Usage.TotalTokens,
+			}
+		}
+		if len(response.Choices) == 0 || finished {
 			continue
 		}
 
 		choice := response.Choices[0]
 
 		if choice.FinishReason == openaisdk.FinishReasonStop {
+			// keep reading: the usage chunk follows the stop chunk
 			fmt.Printf("[AI] Stream finished (stop reason)\n")
-			callback(StreamChunk{Type: ChunkTypeDone, Content: ""})
-			return nil
+			finished = true
+			continue
 		}
 
 		// Handle reasoning/thinking content
@@ -135,6 +166,7 @@ func CallStream(ctx context.Context, cfg Config, messages []Message, callback St
 
 		// Handle normal content
 		content := choice.Delta.Content
+		completion += len(reasoningContent) + len(content)
 		if content != "" {
 			// fmt.Printf("[AI] Stream content: %s\n", content)
 			if err := callback(StreamChunk{Type: ChunkTypeContent, Content: content}); err != nil {
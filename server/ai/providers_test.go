@@ -0,0 +1,251 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveProvider(t *testing.T) {
+	tests := []struct {
+		typ, baseURL string
+		want         Provider
+	}{
+		{"", "https://api.openai.com/v1", ProviderOpenAI},
+		{"", "https://api.deepseek.com", ProviderOpenAI},
+		{"", "https://api.anthropic.com", ProviderAnthropic},
+		{"", "https://generativelanguage.googleapis.com/v1beta/openai/", ProviderGemini},
+		{"openai", "https://api.anthropic.com/v1", ProviderOpenAI},
+		{"Anthropic", "https://gateway.local", ProviderAnthropic},
+		{"gemini", "", ProviderGemini},
+		{"", "http://localhost:11434/v1", ProviderOllama},
+		{"ollama", "http://gpu-box:8080", ProviderOllama},
+	}
+	for _, tt := range tests {
+		if got := ResolveProvider(tt.typ, tt.baseURL); got != tt.want {
+			t.Errorf("ResolveProvider(%q, %q) = %q, want %q", tt.typ, tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+var testMessages = []Message{
+	{Role: "system", Content: "be brief"},
+	{Role: "user", Content: "hi"},
+	{Role: "user", Content: "there"},
+	{Role: "assistant", Content: "hello"},
+	{Role: "user", Content: "review"},
+}
+
+// fakeProvider records one request and replies with body.
+func fakeProvider(t *testing.T, body string, got *map[string]interface{}, gotHeader *http.Header, gotPath *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gotPath = r.URL.RequestURI()
+		*gotHeader = r.Header.Clone()
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, got)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func collect(t *testing.T, cfg Config) (thinking, content string, usage *TokenUsage) {
+	t.Helper()
+	var reported TokenUsage
+	ctx := WithUsageReporter(context.Background(), func(u TokenUsage) { reported = u })
+	err := CallStream(ctx, cfg, testMessages, func(c StreamChunk) error {
+		switch c.Type {
+		case ChunkTypeThinking:
+			thinking += c.Content
+		case ChunkTypeContent:
+			content += c.Content
+		case ChunkTypeDone:
+			usage = c.TokenUsage
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage == nil || reported != *usage {
+		t.Errorf("reported usage %+v, done chunk %+v", reported, usage)
+	}
+	return thinking, content, usage
+}
+
+func TestAnthropicStream(t *testing.T) {
+	stream := `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Looks "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"good"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+	var body map[string]interface{}
+	var header http.Header
+	var path string
+	srv := fakeProvider(t, stream, &body, &header, &path)
+
+	thinking, content, usage := collect(t, Config{Provider: ProviderAnthropic, APIKey: "sk-ant", BaseURL: srv.URL + "/v1", Model: "claude-x"})
+	if thinking != "hmm" || content != "Looks good" {
+		t.Errorf("thinking %q, content %q", thinking, content)
+	}
+	if *usage != (TokenUsage{PromptTokens: 12, CompletionTokens: 7, TotalTokens: 19}) {
+		t.Errorf("usage = %+v", usage)
+	}
+	if path != "/v1/messages" || header.Get("x-api-key") != "sk-ant" || header.Get("anthropic-version") == "" {
+		t.Errorf("request %s, headers %v", path, header)
+	}
+	wantMessages := []interface{}{
+		map[string]interface{}{"role": "user", "content": "hi\n\nthere"},
+		map[string]interface{}{"role": "assistant", "content": "hello"},
+		map[string]interface{}{"role": "user", "content": "review"},
+	}
+	if body["system"] != "be brief" || !reflect.DeepEqual(body["messages"], wantMessages) || body["max_tokens"] != float64(anthropicDefaultMaxTokens) {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	stream := `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"plan","thought":true}]}}],"usageMetadata":{"promptTokenCount":10}}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Looks good"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":3,"thoughtsTokenCount":2,"totalTokenCount":15}}
+
+`
+	var body map[string]interface{}
+	var header http.Header
+	var path string
+	srv := fakeProvider(t, stream, &body, &header, &path)
+
+	thinking, content, usage := collect(t, Config{Provider: ProviderGemini, APIKey: "g-key", BaseURL: srv.URL, Model: "gemini-x", MaxTokens: 100})
+	if thinking != "plan" || content != "Looks good" {
+		t.Errorf("thinking %q, content %q", thinking, content)
+	}
+	if *usage != (TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}) {
+		t.Errorf("usage = %+v", usage)
+	}
+	if path != "/v1beta/models/gemini-x:streamGenerateContent?alt=sse" || header.Get("x-goog-api-key") != "g-key" {
+		t.Errorf("request %s, headers %v", path, header)
+	}
+	contents, _ := json.Marshal(body["contents"])
+	if string(contents) != `[{"parts":[{"text":"hi\n\nthere"}],"role":"user"},{"parts":[{"text":"hello"}],"role":"model"},{"parts":[{"text":"review"}],"role":"user"}]` {
+		t.Errorf("contents = %s", contents)
+	}
+	system, _ := json.Marshal(body["systemInstruction"])
+	if string(system) != `{"parts":[{"text":"be brief"}]}` {
+		t.Errorf("systemInstruction = %s", system)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	stream := `{"model":"llama3","message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":"Looks "},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":"good"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":20,"eval_count":4}
+`
+	var body map[string]interface{}
+	var header http.Header
+	var path string
+	srv := fakeProvider(t, stream, &body, &header, &path)
+
+	thinking, content, usage := collect(t, Config{Provider: ProviderOllama, BaseURL: srv.URL + "/v1", Model: "llama3", MaxTokens: 50})
+	if thinking != "hmm" || content != "Looks good" {
+		t.Errorf("thinking %q, content %q", thinking, content)
+	}
+	if *usage != (TokenUsage{PromptTokens: 20, CompletionTokens: 4, TotalTokens: 24}) {
+		t.Errorf("usage = %+v", usage)
+	}
+	if path != "/api/chat" || header.Get("Authorization") != "" {
+		t.Errorf("request %s, headers %v", path, header)
+	}
+	if body["model"] != "llama3" || body["stream"] != true || len(body["messages"].([]interface{})) != len(testMessages) {
+		t.Errorf("body = %v", body)
+	}
+	if opts, _ := json.Marshal(body["options"]); string(opts) != `{"num_predict":50}` {
+		t.Errorf("options = %s", opts)
+	}
+}
+
+func TestOllamaModelsAndBaseURL(t *testing.T) {
+	for _, tt := range []struct{ in, env, want string }{
+		{"", "", OllamaDefaultBaseURL},
+		{"", "0.0.0.0:11434", "http://localhost:11434"},
+		{"http://gpu-box:11434/v1/", "", "http://gpu-box:11434"},
+		{"https://ollama.example.com/api", "", "https://ollama.example.com"},
+	} {
+		t.Setenv("OLLAMA_HOST", tt.env)
+		if got := OllamaBaseURL(tt.in); got != tt.want {
+			t.Errorf("OllamaBaseURL(%q) with OLLAMA_HOST=%q = %q, want %q", tt.in, tt.env, got, tt.want)
+		}
+	}
+
+	var body map[string]interface{}
+	var header http.Header
+	var path string
+	srv := fakeProvider(t, `{"models":[{"name":"llama3.2:latest","size":2019393189,"details":{"parameter_size":"3.2B"}},{"name":"qwen2.5-coder:7b","size":4683087332,"details":{}}]}`, &body, &header, &path)
+	models, err := ListOllamaModels(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OllamaModel{
+		{Name: "llama3.2:latest", Size: 2019393189, ParameterSize: "3.2B"},
+		{Name: "qwen2.5-coder:7b", Size: 4683087332},
+	}
+	if path != "/api/tags" || !reflect.DeepEqual(models, want) {
+		t.Errorf("GET %s = %+v", path, models)
+	}
+}
+
+func TestProviderCompletionAndErrors(t *testing.T) {
+	var body map[string]interface{}
+	var header http.Header
+	var path string
+	srv := fakeProvider(t, `{"content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":3,"output_tokens":1}}`, &body, &header, &path)
+	var reported TokenUsage
+	ctx := WithUsageReporter(context.Background(), func(u TokenUsage) { reported = u })
+	out, err := CallCompletion(ctx, Config{Provider: ProviderAnthropic, BaseURL: srv.URL, Model: "m"}, testMessages)
+	if err != nil || out != "ok" || reported.TotalTokens != 4 {
+		t.Errorf("anthropic completion = %q, %v, usage %+v", out, err, reported)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`)
+	}))
+	defer failing.Close()
+	err = CallStream(context.Background(), Config{Provider: ProviderGemini, BaseURL: failing.URL}, testMessages, func(StreamChunk) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "API key not valid") {
+		t.Errorf("gemini error = %v", err)
+	}
+
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"llama9\" not found, try pulling it first"}`)
+	}))
+	defer missing.Close()
+	_, err = CallCompletion(context.Background(), Config{Provider: ProviderOllama, BaseURL: missing.URL, Model: "llama9"}, testMessages)
+	if err == nil || !strings.Contains(err.Error(), "try pulling it first") {
+		t.Errorf("ollama error = %v", err)
+	}
+}
@@ -1,12 +1,47 @@
 package ai
 
+import "strings"
+
 // Provider represents an AI provider type
 type Provider string
 
 const (
-	ProviderOpenAI Provider = "openai"
+	// ProviderOpenAI is the OpenAI chat completions API and the many
+	// gateways compatible with it
+	ProviderOpenAI    Provider = "openai"
+	ProviderAnthropic Provider = "anthropic"
+	ProviderGemini    Provider = "gemini"
+	// ProviderOllama is a local Ollama daemon; it needs no API key
+	ProviderOllama Provider = "ollama"
 )
 
+// ResolveProvider returns the provider for a configured provider type. An
+// empty type is inferred from the base URL, so a provider configured with
+// https://api.anthropic.com just works; anything else is OpenAI-compatible.
+func ResolveProvider(typ string, baseURL string) Provider {
+	switch Provider(strings.ToLower(typ)) {
+	case ProviderOpenAI:
+		return ProviderOpenAI
+	case ProviderAnthropic:
+		return ProviderAnthropic
+	case ProviderGemini:
+		return ProviderGemini
+	case ProviderOllama:
+		return ProviderOllama
+	case "":
+		switch {
+		case strings.Contains(baseURL, "anthropic.com"):
+			return ProviderAnthropic
+		case strings.Contains(baseURL, "generativelanguage.googleapis.com"):
+			return ProviderGemini
+		case strings.Contains(baseURL, ":11434"):
+			return ProviderOllama
+		}
+		return ProviderOpenAI
+	}
+	return Provider(typ)
+}
+
 // ChunkType represents the type of a streamed chunk
 type ChunkType string
 
@@ -43,6 +78,12 @@ type Config struct {
 	MaxTokens int      `json:"max_tokens,omitempty"`
 }
 
+// Configured reports whether cfg can be used: it has an API key, or its
+// provider needs none.
+func (c Config) Configured() bool {
+	return c.APIKey != "" || c.Provider == ProviderOllama
+}
+
 // TokenUsage represents token usage statistics
 type TokenUsage struct {
 	PromptTokens     int `json:"promptTokens,omitempty"`
@@ -27,6 +27,7 @@ func handleAIConfig(w http.ResponseWriter, r *http.Request) {
 // AIProviderResponse represents a provider in the API response
 type AIProviderResponse struct {
 	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
 	BaseURL string `json:"base_url"`
 	APIKey  string `json:"api_key,omitempty"`
 }
@@ -86,6 +87,7 @@ func handleGetAIConfig(w http.ResponseWriter, r *http.Request) {
 	for _, p := range cfg.Providers {
 		resp.Providers = append(resp.Providers, AIProviderResponse{
 			Name:    p.Name,
+			Type:    p.Type,
 			BaseURL: p.BaseURL,
 			APIKey:  p.APIKey,
 		})
@@ -114,6 +116,7 @@ type SaveAIConfigRequest struct {
 // AIProviderRequest represents a provider in the save request
 type AIProviderRequest struct {
 	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
 	BaseURL string `json:"base_url"`
 	APIKey  string `json:"api_key"`
 }
@@ -145,6 +148,7 @@ func handleSaveAIConfig(w http.ResponseWriter, r *http.Request) {
 	for _, p := range req.Providers {
 		cfg.Providers = append(cfg.Providers, config.ProviderConfig{
 			Name:    p.Name,
+			Type:    p.Type,
 			BaseURL: p.BaseURL,
 			APIKey:  p.APIKey,
 		})
@@ -165,8 +169,13 @@ func handleSaveAIConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update in-memory config
-	newAdapter := config.NewConfigAdapter(cfg)
+	// Update in-memory config, re-reading the file so environment
+	// overrides keep taking precedence over what was saved
+	newAdapter, err := config.GetEffectiveAIConfig(config.Get())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
 	SetAIConfigAdapter(newAdapter)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
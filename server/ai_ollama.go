@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// localOllamaProvider is the provider name under which a local Ollama daemon
+// is offered when no Ollama provider is configured, so review chat works
+// offline with zero configuration.
+const localOllamaProvider = "ollama"
+
+const (
+	// ollamaProbeTimeout bounds a model listing; a daemon that is not
+	// running refuses the connection at once.
+	ollamaProbeTimeout = 500 * time.Millisecond
+	// ollamaDiscoveryTTL is how long a listing is reused, since
+	// /api/review/config is fetched on every page load.
+	ollamaDiscoveryTTL = 30 * time.Second
+)
+
+type ollamaDiscovery struct {
+	at     time.Time
+	models []string
+	err    error
+}
+
+var (
+	ollamaDiscoveryMu    sync.Mutex
+	ollamaDiscoveryCache = map[string]ollamaDiscovery{}
+)
+
+// discoverOllamaModels lists the models of the Ollama daemon at baseURL
+// (empty for the local one). The result, including failure, is cached.
+func discoverOllamaModels(baseURL string) ([]string, error) {
+	key := ai.OllamaBaseURL(baseURL)
+	ollamaDiscoveryMu.Lock()
+	defer ollamaDiscoveryMu.Unlock()
+	if d, ok := ollamaDiscoveryCache[key]; ok && time.Since(d.at) < ollamaDiscoveryTTL {
+		return d.models, d.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ollamaProbeTimeout)
+	defer cancel()
+	list, err := ai.ListOllamaModels(ctx, key)
+	var models []string
+	for _, m := range list {
+		models = append(models, m.Name)
+	}
+	ollamaDiscoveryCache[key] = ollamaDiscovery{at: time.Now(), models: models, err: err}
+	return models, err
+}
+
+// hasOllamaProvider reports whether an Ollama provider is configured.
+func hasOllamaProvider(cfg *config.ConfigAdapter) bool {
+	if cfg == nil {
+		return false
+	}
+	for _, p := range cfg.GetAvailableProviders() {
+		if ai.ResolveProvider(p.Type, p.BaseURL) == ai.ProviderOllama {
+			return true
+		}
+	}
+	return false
+}
+
+// localOllamaModels returns the models of the local Ollama daemon when it is
+// to be offered as localOllamaProvider: no Ollama provider is configured, no
+// configured provider takes the name, and the daemon is running with models.
+func localOllamaModels(cfg *config.ConfigAdapter) []string {
+	if hasOllamaProvider(cfg) || (cfg != nil && cfg.GetProvider(localOllamaProvider) != nil) {
+		return nil
+	}
+	models, err := discoverOllamaModels("")
+	if err != nil {
+		return nil
+	}
+	return models
+}
+
+// addOllamaModels adds the models pulled into Ollama daemons to the review
+// config: those of configured Ollama providers that are not configured
+// explicitly, and those of the local daemon as localOllamaProvider.
+func addOllamaModels(info *ConfigInfo, cfg *config.ConfigAdapter) {
+	if cfg != nil {
+		for _, p := range cfg.GetAvailableProviders() {
+			if ai.ResolveProvider(p.Type, p.BaseURL) != ai.ProviderOllama {
+				continue
+			}
+			models, err := discoverOllamaModels(p.BaseURL)
+			if err != nil {
+				continue
+			}
+			for _, m := range models {
+				if cfg.GetModel(p.Name, m) == nil {
+					info.Models = append(info.Models, ModelInfo{Provider: p.Name, Model: m})
+				}
+			}
+		}
+	}
+
+	models := localOllamaModels(cfg)
+	if len(models) == 0 {
+		return
+	}
+	info.Providers = append(info.Providers, ProviderInfo{Name: localOllamaProvider})
+	for _, m := range models {
+		info.Models = append(info.Models, ModelInfo{Provider: localOllamaProvider, Model: m, DisplayName: m + " (local)"})
+	}
+	if info.DefaultProvider == "" && (cfg == nil || len(cfg.GetAvailableProviders()) == 0) {
+		info.DefaultProvider = localOllamaProvider
+		info.DefaultModel = models[0]
+	}
+}
+
+// localOllamaConfig returns the ai.Config of the local Ollama daemon with
+// model, or its first model if empty. ok is false if it is not offered.
+func localOllamaConfig(cfg *config.ConfigAdapter, model string) (ai.Config, bool) {
+	models := localOllamaModels(cfg)
+	if len(models) == 0 {
+		return ai.Config{}, false
+	}
+	if model == "" {
+		model = models[0]
+	}
+	return ai.Config{Provider: ai.ProviderOllama, Model: model}, true
+}
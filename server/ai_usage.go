@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+)
+
+// setupAIUsage records the tokens of every AI call, priced with the
+// input_price/output_price of the configured model.
+func setupAIUsage() {
+	aiusage.SetPricer(func(provider, model string) (float64, float64) {
+		effectiveCfg := getEffectiveAIConfig()
+		if effectiveCfg == nil {
+			return 0, 0
+		}
+		m := effectiveCfg.GetModel(provider, model)
+		if m == nil {
+			return 0, 0
+		}
+		return m.InputPrice, m.OutputPrice
+	})
+	ai.SetUsageRecorder(aiusage.Record)
+}
+
+// withUsageSession tags the AI calls made with ctx for usage tracking,
+// naming the configured provider cfg was resolved from.
+func withUsageSession(ctx context.Context, cfg ai.Config, s aiusage.Session) context.Context {
+	s.Provider = aiProviderName(cfg)
+	return aiusage.WithSession(ctx, s)
+}
+
+// aiProviderName returns the name of the configured provider cfg talks to,
+// or "" when it matches none.
+func aiProviderName(cfg ai.Config) string {
+	if effectiveCfg := getEffectiveAIConfig(); effectiveCfg != nil {
+		for _, p := range effectiveCfg.GetAvailableProviders() {
+			if ai.ResolveProvider(p.Type, p.BaseURL) == cfg.Provider && p.BaseURL == cfg.BaseURL && p.APIKey == cfg.APIKey {
+				return p.Name
+			}
+		}
+	}
+	if cfg.Provider == ai.ProviderOllama {
+		return localOllamaProvider
+	}
+	return ""
+}
@@ -0,0 +1,334 @@
+// Package aiusage records the tokens spent by AI calls (review chat,
+// automatic reviews) and what they cost. Usage is aggregated per
+// provider, model and UTC day, and per session, in usage.json under the
+// data dir.
+//
+// Install Record with ai.SetUsageRecorder and tag requests with
+// WithSession; calls without a session only count toward the daily totals.
+package aiusage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/metrics"
+)
+
+// Session kinds.
+const (
+	KindChat       = "chat"
+	KindAutoReview = "auto-review"
+	KindFindings   = "findings"
+)
+
+const (
+	// sessionRetention is how long sessions are kept after their last call;
+	// daily totals are kept forever.
+	sessionRetention = 90 * 24 * time.Hour
+	maxSessions      = 5000
+
+	dateLayout = "2006-01-02"
+)
+
+// Session identifies what an AI call was made for.
+type Session struct {
+	Kind    string
+	ID      string
+	Project string
+	// Provider is the configured provider name; defaults to the API type.
+	Provider string
+}
+
+type sessionKey struct{}
+
+// WithSession tags the AI calls made with ctx as part of s.
+func WithSession(ctx context.Context, s Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// Totals are summed token counts and cost.
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.TotalTokens += o.TotalTokens
+	t.CostUSD += o.CostUSD
+}
+
+// DayUsage is the usage of one provider and model on one UTC day.
+type DayUsage struct {
+	Date     string `json:"date"` // YYYY-MM-DD
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Totals
+}
+
+// SessionUsage is the usage of one session.
+type SessionUsage struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Project  string `json:"project,omitempty"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	FirstAt  string `json:"first_at"` // RFC3339
+	LastAt   string `json:"last_at"`
+	Totals
+}
+
+type store struct {
+	Days     []DayUsage     `json:"days"`
+	Sessions []SessionUsage `json:"sessions"`
+}
+
+var (
+	mu   sync.Mutex
+	file = jsonfile.New[store](config.AIUsageFile)
+
+	pricer func(provider, model string) (input, output float64)
+)
+
+// SetFile points the store at path instead of the data directory's
+// usage.json, e.g. at a temp file in tests of packages that make AI calls.
+func SetFile(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	file = jsonfile.New[store](path)
+}
+
+// SetPricer installs the lookup of USD prices per million prompt and
+// completion tokens. Without one, costs are recorded as zero.
+func SetPricer(fn func(provider, model string) (input, output float64)) {
+	mu.Lock()
+	defer mu.Unlock()
+	pricer = fn
+}
+
+// Record adds one AI call to the store; it matches ai.UsageRecorder.
+// Errors are logged, never returned: usage tracking is best effort.
+func Record(ctx context.Context, cfg ai.Config, u ai.TokenUsage) {
+	s, _ := ctx.Value(sessionKey{}).(Session)
+	provider := s.Provider
+	if provider == "" {
+		provider = string(cfg.Provider)
+	}
+	if provider == "" {
+		provider = string(ai.ProviderOpenAI)
+	}
+	record(time.Now().UTC(), s, provider, cfg.Model, u)
+}
+
+var (
+	requestsTotal = metrics.NewCounter("ai_requests_total",
+		"AI calls, by provider and model.", "provider", "model")
+	tokensTotal = metrics.NewCounter("ai_tokens_total",
+		"AI tokens spent, by provider, model and type (prompt or completion).", "provider", "model", "type")
+)
+
+func record(now time.Time, s Session, provider, model string, u ai.TokenUsage) {
+	requestsTotal.Inc(provider, model)
+	tokensTotal.Add(float64(u.PromptTokens), provider, model, "prompt")
+	tokensTotal.Add(float64(u.CompletionTokens), provider, model, "completion")
+
+	mu.Lock()
+	defer mu.Unlock()
+	t := Totals{
+		Requests:         1,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if pricer != nil {
+		in, out := pricer(provider, model)
+		t.CostUSD = (float64(u.PromptTokens)*in + float64(u.CompletionTokens)*out) / 1e6
+	}
+	date := now.Format(dateLayout)
+	stamp := now.Format(time.RFC3339)
+
+	err := file.Update(func(st *store) error {
+		found := false
+		for i := range st.Days {
+			d := &st.Days[i]
+			if d.Date == date && d.Provider == provider && d.Model == model {
+				d.add(t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			st.Days = append(st.Days, DayUsage{Date: date, Provider: provider, Model: model, Totals: t})
+		}
+
+		if s.ID == "" {
+			return nil
+		}
+		found = false
+		for i := range st.Sessions {
+			ss := &st.Sessions[i]
+			if ss.ID == s.ID && ss.Kind == s.Kind {
+				ss.add(t)
+				ss.LastAt = stamp
+				ss.Provider = provider
+				ss.Model = model
+				found = true
+				break
+			}
+		}
+		if !found {
+			st.Sessions = append(st.Sessions, SessionUsage{
+				ID:       s.ID,
+				Kind:     s.Kind,
+				Project:  s.Project,
+				Provider: provider,
+				Model:    model,
+				FirstAt:  stamp,
+				LastAt:   stamp,
+				Totals:   t,
+			})
+		}
+		st.Sessions = pruneSessions(st.Sessions, now)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[aiusage] failed to record usage: %v\n", err)
+	}
+}
+
+// pruneSessions drops sessions idle past the retention period and then the
+// least recently used ones beyond maxSessions.
+func pruneSessions(sessions []SessionUsage, now time.Time) []SessionUsage {
+	cutoff := now.Add(-sessionRetention).Format(time.RFC3339)
+	kept := sessions[:0]
+	for _, s := range sessions {
+		if s.LastAt >= cutoff {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) > maxSessions {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].LastAt < kept[j].LastAt })
+		kept = kept[len(kept)-maxSessions:]
+	}
+	return kept
+}
+
+// Group is the usage of one provider, model or day within a summary.
+type Group struct {
+	Key string `json:"key"`
+	Totals
+}
+
+// Summary aggregates the usage between two dates.
+type Summary struct {
+	From       string     `json:"from"` // YYYY-MM-DD, inclusive
+	To         string     `json:"to"`
+	Total      Totals     `json:"total"`
+	ByProvider []Group    `json:"by_provider"`
+	ByModel    []Group    `json:"by_model"` // keyed "provider/model"
+	ByDay      []Group    `json:"by_day"`
+	Entries    []DayUsage `json:"entries"`
+}
+
+// Summarize returns the usage from from through to (YYYY-MM-DD, inclusive),
+// optionally limited to one provider and model.
+func Summarize(from, to, provider, model string) (*Summary, error) {
+	mu.Lock()
+	st, err := file.Get()
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sum := &Summary{From: from, To: to, Entries: []DayUsage{}}
+	byProvider := map[string]*Totals{}
+	byModel := map[string]*Totals{}
+	byDay := map[string]*Totals{}
+	addTo := func(m map[string]*Totals, key string, t Totals) {
+		if m[key] == nil {
+			m[key] = &Totals{}
+		}
+		m[key].add(t)
+	}
+	for _, d := range st.Days {
+		if d.Date < from || d.Date > to {
+			continue
+		}
+		if (provider != "" && d.Provider != provider) || (model != "" && d.Model != model) {
+			continue
+		}
+		sum.Entries = append(sum.Entries, d)
+		sum.Total.add(d.Totals)
+		addTo(byProvider, d.Provider, d.Totals)
+		addTo(byModel, d.Provider+"/"+d.Model, d.Totals)
+		addTo(byDay, d.Date, d.Totals)
+	}
+	sum.ByProvider = groups(byProvider, byCost)
+	sum.ByModel = groups(byModel, byCost)
+	sum.ByDay = groups(byDay, byKey)
+	sort.Slice(sum.Entries, func(i, j int) bool {
+		a, b := sum.Entries[i], sum.Entries[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Model < b.Model
+	})
+	return sum, nil
+}
+
+const (
+	byCost = iota
+	byKey
+)
+
+func groups(m map[string]*Totals, order int) []Group {
+	list := make([]Group, 0, len(m))
+	for k, t := range m {
+		list = append(list, Group{Key: k, Totals: *t})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if order == byCost && list[i].CostUSD != list[j].CostUSD {
+			return list[i].CostUSD > list[j].CostUSD
+		}
+		if order == byCost && list[i].TotalTokens != list[j].TotalTokens {
+			return list[i].TotalTokens > list[j].TotalTokens
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// Sessions returns recorded sessions, most recently used first, filtered
+// by kind and project when set. limit <= 0 returns all.
+func Sessions(kind, project string, limit int) ([]SessionUsage, error) {
+	mu.Lock()
+	st, err := file.Get()
+	mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	list := []SessionUsage{}
+	for _, s := range st.Sessions {
+		if (kind == "" || s.Kind == kind) && (project == "" || s.Project == project) {
+			list = append(list, s)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].LastAt > list[j].LastAt })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
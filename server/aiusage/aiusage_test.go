@@ -0,0 +1,96 @@
+package aiusage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func TestRecordAndSummarize(t *testing.T) {
+	file = jsonfile.New[store](filepath.Join(t.TempDir(), "usage.json"))
+	SetPricer(func(provider, model string) (float64, float64) {
+		if provider == "deepseek" && model == "deepseek-chat" {
+			return 1, 2
+		}
+		return 0, 0
+	})
+	defer SetPricer(nil)
+
+	day1 := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	chat := Session{Kind: KindChat, ID: "c1"}
+	record(day1, chat, "deepseek", "deepseek-chat", ai.TokenUsage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500})
+	record(day2, chat, "deepseek", "deepseek-chat", ai.TokenUsage{PromptTokens: 2000, CompletionTokens: 0, TotalTokens: 2000})
+	record(day2, Session{}, "ollama", "llama3", ai.TokenUsage{PromptTokens: 10, CompletionTokens: 10, TotalTokens: 20})
+
+	sum, err := Summarize("2026-10-01", "2026-10-02", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Total.Requests != 3 || sum.Total.TotalTokens != 3520 {
+		t.Errorf("total = %+v", sum.Total)
+	}
+	// 1000*1/1e6 + 500*2/1e6 + 2000*1/1e6
+	if math.Abs(sum.Total.CostUSD-0.004) > 1e-9 {
+		t.Errorf("cost = %v, want 0.004", sum.Total.CostUSD)
+	}
+	if len(sum.ByProvider) != 2 || sum.ByProvider[0].Key != "deepseek" {
+		t.Errorf("by provider = %+v", sum.ByProvider)
+	}
+	if len(sum.ByDay) != 2 || sum.ByDay[0].Key != "2026-10-01" || sum.ByDay[1].Requests != 2 {
+		t.Errorf("by day = %+v", sum.ByDay)
+	}
+
+	sum, _ = Summarize("2026-10-02", "2026-10-02", "ollama", "")
+	if sum.Total.Requests != 1 || sum.ByModel[0].Key != "ollama/llama3" {
+		t.Errorf("filtered = %+v", sum)
+	}
+
+	sessions, err := Sessions(KindChat, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Requests != 2 || sessions[0].TotalTokens != 3500 {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	if sessions[0].FirstAt != day1.Format(time.RFC3339) || sessions[0].LastAt != day2.Format(time.RFC3339) {
+		t.Errorf("session times = %s..%s", sessions[0].FirstAt, sessions[0].LastAt)
+	}
+}
+
+func TestRecordUsesSessionProvider(t *testing.T) {
+	file = jsonfile.New[store](filepath.Join(t.TempDir(), "usage.json"))
+	ctx := WithSession(context.Background(), Session{Kind: KindChat, ID: "x", Provider: "my-gateway"})
+	Record(ctx, ai.Config{Provider: ai.ProviderOpenAI, Model: "gpt"}, ai.TokenUsage{TotalTokens: 5})
+	Record(context.Background(), ai.Config{Provider: ai.ProviderAnthropic, Model: "claude"}, ai.TokenUsage{TotalTokens: 7})
+
+	today := time.Now().UTC().Format(dateLayout)
+	sum, err := Summarize(today, today, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for _, g := range sum.ByProvider {
+		got[g.Key] = g.TotalTokens
+	}
+	if got["my-gateway"] != 5 || got["anthropic"] != 7 {
+		t.Errorf("by provider = %v", got)
+	}
+}
+
+func TestPruneSessions(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sessions := []SessionUsage{
+		{ID: "old", LastAt: now.Add(-sessionRetention - time.Hour).Format(time.RFC3339)},
+		{ID: "new", LastAt: now.Format(time.RFC3339)},
+	}
+	kept := pruneSessions(sessions, now)
+	if len(kept) != 1 || kept[0].ID != "new" {
+		t.Errorf("kept = %+v", kept)
+	}
+}
@@ -0,0 +1,83 @@
+package aiusage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultDays = 30
+
+// RegisterAPI registers the usage endpoints:
+//
+//	GET /api/usage?from=YYYY-MM-DD&to=YYYY-MM-DD&days=N&provider=...&model=...   -> Summary
+//	GET /api/usage/sessions?kind=chat|auto-review&project=...&limit=N            -> []SessionUsage
+//
+// Without from, the summary covers the last days days (default 30) up to
+// to, which defaults to today (UTC).
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/usage", handleSummary)
+	mux.HandleFunc("/api/usage/sessions", handleSessions)
+}
+
+func handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	to := time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "to must be YYYY-MM-DD"})
+			return
+		}
+		to = t
+	}
+	days := defaultDays
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be a positive integer"})
+			return
+		}
+		days = n
+	}
+	from := to.AddDate(0, 0, -(days - 1)).Format(dateLayout)
+	if v := q.Get("from"); v != "" {
+		if _, err := time.Parse(dateLayout, v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be YYYY-MM-DD"})
+			return
+		}
+		from = v
+	}
+	sum, err := Summarize(from, to.Format(dateLayout), q.Get("provider"), q.Get("model"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, sum)
+}
+
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	list, err := Sessions(q.Get("kind"), q.Get("project"), limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
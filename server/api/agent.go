@@ -26,6 +26,8 @@ type createCustomAgentRequest struct {
 	Model        string            `json:"model,omitempty"`
 	Tools        map[string]bool   `json:"tools"`
 	Permissions  map[string]string `json:"permissions,omitempty"`
+	Protocol     string            `json:"protocol,omitempty"`
+	Command      []string          `json:"command,omitempty"`
 	Template     string            `json:"template,omitempty"`
 	SystemPrompt string            `json:"systemPrompt,omitempty"`
 }
@@ -37,6 +39,8 @@ type updateCustomAgentRequest struct {
 	Model        string            `json:"model,omitempty"`
 	Tools        map[string]bool   `json:"tools"`
 	Permissions  map[string]string `json:"permissions,omitempty"`
+	Protocol     string            `json:"protocol,omitempty"`
+	Command      []string          `json:"command,omitempty"`
 	SystemPrompt string            `json:"systemPrompt,omitempty"`
 }
 
@@ -209,10 +213,16 @@ func handleCreateCustomAgent(w http.ResponseWriter, r *http.Request) {
 		Model:       req.Model,
 		Tools:       req.Tools,
 		Permissions: req.Permissions,
+		Protocol:    req.Protocol,
+		Command:     req.Command,
 	}
 	if cfg.Mode == "" {
 		cfg.Mode = "primary"
 	}
+	if err := cfg.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if req.Template != "" {
 		template := custom.GetTemplate(req.Template)
@@ -284,10 +294,16 @@ func handleUpdateCustomAgent(w http.ResponseWriter, r *http.Request, agentID str
 		Model:       req.Model,
 		Tools:       req.Tools,
 		Permissions: req.Permissions,
+		Protocol:    req.Protocol,
+		Command:     req.Command,
 	}
 	if cfg.Mode == "" {
 		cfg.Mode = "primary"
 	}
+	if err := cfg.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err := custom.SaveAgent(agentID, cfg); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
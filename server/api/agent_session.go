@@ -120,6 +120,11 @@ func handleCustomAgentSessionProxy(w http.ResponseWriter, r *http.Request, sessi
 	r.URL.Path = restPath
 	r.URL.RawPath = ""
 
+	if adapter := agents.CustomAgentAdapter(sessionID); adapter != nil {
+		adapter.ServeHTTP(w, r)
+		return
+	}
+
 	if restPath == "/event" || restPath == "/global/event" {
 		opencode_exposed.ProxySSE(w, r, session.Port)
 		return
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/httpcache"
+	"github.com/xhd2015/ai-critic/server/vcs"
+)
+
+// repoCache holds recent results of expensive repository reads (diffs,
+// status), keyed on the state of the working copy they were read from.
+var repoCache = httpcache.New(64)
+
+// cachedRepoRead returns read's result for dir, reusing an earlier result
+// of the same kind while the working copy has not changed. Results are
+// shared between requests: callers must not modify them. Repositories
+// whose state cannot be fingerprinted are read every time.
+func cachedRepoRead[T any](kind, dir string, read func() (T, error)) (T, error) {
+	state, ok := repoState(dir)
+	if !ok {
+		return read()
+	}
+	key := kind + "\x00" + dir + "\x00" + state
+	if v, _, ok := repoCache.Get(key); ok {
+		return v.(T), nil
+	}
+	v, err := read()
+	if err != nil {
+		return v, err
+	}
+	repoCache.Put(key, v)
+	return v, nil
+}
+
+// repoState fingerprints a git working copy: HEAD, the branch, the index
+// and the status, size and modification time of every changed path. Any
+// change to what git diff or git status report changes the fingerprint.
+// ok is false for other version control systems and on errors.
+func repoState(dir string) (string, bool) {
+	v, err := vcs.For(dir)
+	if err != nil || v.Name() != "git" {
+		return "", false
+	}
+	// porcelain v2 with --branch also reports HEAD's commit
+	status, err := gitrunner.Status("--porcelain=v2", "--branch", "-z").Dir(dir).Output()
+	if err != nil {
+		return "", false
+	}
+	paths, err := gitrunner.RevParse("--show-toplevel", "--git-path", "index").Dir(dir).Output()
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimSpace(string(paths)), "\n")
+	if len(lines) != 2 {
+		return "", false
+	}
+	root, index := lines[0], lines[1]
+	if !filepath.IsAbs(index) {
+		index = filepath.Join(dir, index)
+	}
+
+	h := sha256.New()
+	h.Write(status)
+	stamp := func(path string) {
+		if info, err := os.Lstat(path); err == nil {
+			fmt.Fprintf(h, "\x00%s %d %d", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	stamp(index)
+	for _, path := range porcelainV2Paths(status) {
+		stamp(filepath.Join(root, filepath.FromSlash(path)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// porcelainV2Paths returns the paths of git status --porcelain=v2 -z
+// output, relative to the repository root.
+func porcelainV2Paths(out []byte) []string {
+	var paths []string
+	records := strings.Split(string(out), "\x00")
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		if rec == "" {
+			continue
+		}
+		// the path follows a fixed number of fields per record type
+		var fields int
+		switch rec[0] {
+		case '1':
+			fields = 8
+		case '2':
+			fields = 9
+			i++ // the original path of the rename
+		case 'u':
+			fields = 10
+		case '?', '!':
+			fields = 1
+		default: // # headers
+			continue
+		}
+		if parts := strings.SplitN(rec, " ", fields+1); len(parts) == fields+1 {
+			paths = append(paths, parts[fields])
+		}
+	}
+	return paths
+}
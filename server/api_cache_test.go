@@ -0,0 +1,101 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepoState(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	// distinct modification times even on coarse file systems
+	mtime := time.Now().Add(-time.Hour)
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(repo, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		os.Chtimes(path, mtime, mtime)
+	}
+	state := func() string {
+		t.Helper()
+		s, ok := repoState(repo)
+		if !ok {
+			t.Fatal("no repository state")
+		}
+		return s
+	}
+
+	git("init", "-q", "-b", "main")
+	write("a.txt", "a\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	clean := state()
+	if state() != clean {
+		t.Fatal("state not stable")
+	}
+
+	write("a.txt", "b\n")
+	modified := state()
+	if modified == clean {
+		t.Error("edit not detected")
+	}
+	// still " M a.txt" in git status, but the diff changed
+	write("a.txt", "c\n")
+	if state() == modified {
+		t.Error("second edit of a modified file not detected")
+	}
+	git("add", "a.txt")
+	staged := state()
+	write("new dir/b.txt", "b\n")
+	if state() == staged {
+		t.Error("untracked file not detected")
+	}
+
+	if _, ok := repoState(t.TempDir()); ok {
+		t.Error("state of a directory outside any repository")
+	}
+
+	reads := 0
+	read := func() (string, error) {
+		reads++
+		return "result", nil
+	}
+	cachedRepoRead("test", repo, read)
+	cachedRepoRead("test", repo, read)
+	write("a.txt", "d\n")
+	cachedRepoRead("test", repo, read)
+	if reads != 2 {
+		t.Errorf("read %d times, want 2", reads)
+	}
+}
+
+func TestPorcelainV2Paths(t *testing.T) {
+	out := "# branch.oid abc\x00# branch.head main\x00" +
+		"1 .M N... 100644 100644 100644 h1 h2 src/a file.go\x00" +
+		"2 R. N... 100644 100644 100644 h1 h2 R100 new.go\x00old.go\x00" +
+		"u UU N... 100644 100644 100644 100644 h1 h2 h3 c.go\x00" +
+		"? dir/\x00"
+	want := []string{"src/a file.go", "new.go", "c.go", "dir/"}
+	if got := porcelainV2Paths([]byte(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+const (
+	// defaultContentMaxSize is the largest file returned by GET
+	// /api/files/content unless the client asks for less; larger files are
+	// reported as too large without content.
+	defaultContentMaxSize = 2 << 20
+	// maxContentSize bounds both max_size and the body of a PUT.
+	maxContentSize = 10 << 20
+	// binarySniffLen is how much of a file is checked for NUL bytes.
+	binarySniffLen = 8000
+)
+
+// FileContent is the response of GET /api/files/content, and without
+// Content the response of a successful PUT.
+type FileContent struct {
+	Path    string    `json:"path"` // slash-separated, relative to the project dir
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Hash is the hex SHA-256 of the file; send it back as expected_hash
+	// when saving.
+	Hash     string `json:"hash"`
+	Language string `json:"language"`
+	// Binary files and files over the size limit are returned without
+	// Content.
+	Binary   bool   `json:"binary,omitempty"`
+	TooLarge bool   `json:"too_large,omitempty"`
+	Content  string `json:"content"`
+}
+
+// SaveFileContentRequest is the body of PUT /api/files/content.
+type SaveFileContentRequest struct {
+	Dir     string `json:"dir"`
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// ExpectedHash is the Hash the edit started from. The write fails with
+	// 409 Conflict if the file has changed since, e.g. by the agent.
+	ExpectedHash string `json:"expected_hash"`
+	// Create writes a new file; it fails with 409 Conflict if one exists.
+	Create bool `json:"create,omitempty"`
+}
+
+// contentWriteMu serializes the hash check and the write of saves, so two
+// saves from the same starting point cannot both succeed.
+var contentWriteMu sync.Mutex
+
+var errContentConflict = errors.New("file has changed since it was loaded")
+
+func registerFileContentAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/files/content", handleFileContent)
+}
+
+// handleFileContent reads and writes a text file of a project.
+//
+//	GET /api/files/content?dir=/project&path=src/main.go[&max_size=N] -> FileContent
+//	PUT /api/files/content  SaveFileContentRequest                   -> FileContent without content
+//
+// A PUT whose expected_hash no longer matches fails with 409 Conflict and
+// {"error", "current": FileContent} so the client can merge.
+func handleFileContent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		// project_dir is what the checkpoint file browser sends.
+		dirParam := q.Get("dir")
+		if dirParam == "" {
+			dirParam = q.Get("project_dir")
+		}
+		dir, ok := resolveRequestDir(w, r, dirParam, "")
+		if !ok || !checkAllowed(w, r, projectFilePath(dir, q.Get("path"))) {
+			return
+		}
+		maxSize := int64(defaultContentMaxSize)
+		if s := q.Get("max_size"); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n <= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "max_size must be a positive integer"})
+				return
+			}
+			maxSize = min(n, maxContentSize)
+		}
+		fc, err := readFileContent(dir, q.Get("path"), maxSize)
+		if err != nil {
+			writeJSON(w, fileContentErrorStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, fc)
+	case http.MethodPut:
+		r.Body = http.MaxBytesReader(w, r.Body, maxContentSize+64<<10)
+		var req SaveFileContentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("content exceeds %d bytes", maxContentSize)})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+			return
+		}
+		if len(req.Content) > maxContentSize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("content exceeds %d bytes", maxContentSize)})
+			return
+		}
+		if req.ExpectedHash == "" && !req.Create {
+			writeJSON(w, http.StatusPreconditionRequired, map[string]string{"error": "expected_hash is required to overwrite a file"})
+			return
+		}
+		if tenant.Name(r.Context()) != "" && inGitDir(req.Path) {
+			// git runs what its config and hooks say
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "members may not write inside .git"})
+			return
+		}
+		dir, ok := resolveRequestDir(w, r, req.Dir, "")
+		if !ok || !checkAllowed(w, r, projectFilePath(dir, req.Path)) {
+			return
+		}
+		fc, err := saveFileContent(dir, req)
+		if errors.Is(err, errContentConflict) {
+			current, _ := readFileContent(dir, req.Path, defaultContentMaxSize)
+			writeJSON(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "current": current})
+			return
+		}
+		if err != nil {
+			writeJSON(w, fileContentErrorStatus(err), map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, fc)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
+
+func fileContentErrorStatus(err error) int {
+	switch {
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case errors.As(err, new(treePathError)):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// projectFilePath returns the file at the slash-separated path sub of dir,
+// confined to dir as contentPath does; it may still be a symlink out of
+// dir, which checkAllowed resolves.
+func projectFilePath(dir, sub string) string {
+	return filepath.Join(dir, filepath.Clean("/"+filepath.FromSlash(sub)))
+}
+
+// inGitDir reports whether the slash-separated path sub is inside a .git
+// directory.
+func inGitDir(sub string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(sub), "/") {
+		if strings.EqualFold(part, ".git") {
+			return true
+		}
+	}
+	return false
+}
+
+// contentPath confines a slash-separated path to dir, as listFileTree does.
+func contentPath(dir, sub string) (string, string, error) {
+	sub = strings.Trim(filepath.ToSlash(filepath.Clean("/"+sub)), "/")
+	if sub == "" {
+		return "", "", treePathError("path is required")
+	}
+	return filepath.Join(dir, filepath.FromSlash(sub)), sub, nil
+}
+
+// readFileContent reads a file for editing. Content is left empty for
+// binary files and files larger than maxSize; the hash covers the whole file
+// either way.
+func readFileContent(dir, sub string, maxSize int64) (*FileContent, error) {
+	fullPath, sub, err := contentPath(dir, sub)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, treePathError("path is a directory")
+	}
+
+	fc := &FileContent{Path: sub, Size: info.Size(), ModTime: info.ModTime()}
+	h := sha256.New()
+	if info.Size() > maxSize {
+		// hash without keeping the content; sniff the head for binary
+		head := make([]byte, binarySniffLen)
+		n, _ := io.ReadFull(f, head)
+		h.Write(head[:n])
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		fc.Hash = hex.EncodeToString(h.Sum(nil))
+		fc.Binary = bytes.IndexByte(head[:n], 0) >= 0
+		fc.TooLarge = true
+		fc.Language = detectLanguage(sub, head[:n])
+		return fc, nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(data)
+	fc.Hash = hex.EncodeToString(h.Sum(nil))
+	fc.Size = int64(len(data))
+	fc.Binary = isBinaryContent(data)
+	fc.Language = detectLanguage(sub, data)
+	if !fc.Binary {
+		fc.Content = string(data)
+	}
+	return fc, nil
+}
+
+// saveFileContent writes req.Content if the file still has req.ExpectedHash.
+// The file is replaced atomically and keeps its permissions.
+func saveFileContent(dir string, req SaveFileContentRequest) (*FileContent, error) {
+	fullPath, sub, err := contentPath(dir, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	contentWriteMu.Lock()
+	defer contentWriteMu.Unlock()
+
+	mode := os.FileMode(0644)
+	info, err := os.Stat(fullPath)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, treePathError("path is a directory")
+	case err == nil && req.Create:
+		return nil, fmt.Errorf("%w: %s already exists", errContentConflict, sub)
+	case err == nil:
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		if hashContent(data) != req.ExpectedHash {
+			return nil, errContentConflict
+		}
+		mode = info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return nil, err
+	case !req.Create:
+		// deleted since it was loaded
+		return nil, errContentConflict
+	default:
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.WriteString(req.Content); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return nil, err
+	}
+
+	fc, err := readFileContent(dir, sub, maxContentSize)
+	if err != nil {
+		return nil, err
+	}
+	fc.Content = ""
+	return fc, nil
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isBinaryContent reports a NUL byte near the start, as git does, or
+// content that is not UTF-8 and so cannot be edited as text.
+func isBinaryContent(data []byte) bool {
+	if bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0 {
+		return true
+	}
+	return !utf8.Valid(data)
+}
+
+// languageByExt maps file extensions to syntax types, using the names of
+// the frontend's getFileLanguage.
+var languageByExt = map[string]string{
+	".ts": "typescript", ".tsx": "typescript", ".mts": "typescript", ".cts": "typescript",
+	".js": "javascript", ".jsx": "javascript", ".mjs": "javascript", ".cjs": "javascript",
+	".go": "go", ".py": "python", ".rb": "ruby", ".rs": "rust", ".java": "java",
+	".kt": "kotlin", ".kts": "kotlin", ".swift": "swift", ".php": "php", ".lua": "lua",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".cc": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".hh": "cpp",
+	".cs": "csharp", ".m": "objective-c", ".dart": "dart", ".scala": "scala",
+	".css": "css", ".scss": "scss", ".less": "less", ".html": "html", ".htm": "html",
+	".vue": "vue", ".svelte": "svelte", ".xml": "xml", ".svg": "xml",
+	".json": "json", ".jsonc": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".ini": "ini", ".md": "markdown", ".markdown": "markdown", ".sql": "sql",
+	".sh": "shell", ".bash": "shell", ".zsh": "shell", ".proto": "protobuf",
+	".graphql": "graphql", ".gql": "graphql", ".tf": "hcl", ".hcl": "hcl",
+}
+
+// languageByName maps well-known file names without a telling extension.
+var languageByName = map[string]string{
+	"dockerfile": "dockerfile", "containerfile": "dockerfile",
+	"makefile": "makefile", "gnumakefile": "makefile",
+	"go.mod": "go.mod", "go.sum": "go.sum", "go.work": "go.mod",
+	".bashrc": "shell", ".zshrc": "shell", ".profile": "shell",
+	".gitignore": "ignore", ".dockerignore": "ignore",
+}
+
+// detectLanguage guesses the syntax type of a file from its name, then from
+// a shebang line; "plaintext" if neither tells.
+func detectLanguage(path string, head []byte) string {
+	base := strings.ToLower(filepath.Base(path))
+	if lang, ok := languageByName[base]; ok {
+		return lang
+	}
+	if strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile") {
+		return "dockerfile"
+	}
+	if lang, ok := languageByExt[filepath.Ext(base)]; ok {
+		return lang
+	}
+	if bytes.HasPrefix(head, []byte("#!")) {
+		line, _, _ := bytes.Cut(head, []byte("\n"))
+		fields := strings.Fields(string(line[2:]))
+		if len(fields) > 0 {
+			interp := filepath.Base(fields[0])
+			if interp == "env" && len(fields) > 1 {
+				interp = fields[1]
+			}
+			switch {
+			case interp == "sh" || interp == "bash" || interp == "zsh" || interp == "dash":
+				return "shell"
+			case strings.HasPrefix(interp, "python"):
+				return "python"
+			case interp == "node" || interp == "deno" || interp == "bun":
+				return "javascript"
+			case interp == "ruby":
+				return "ruby"
+			case interp == "perl":
+				return "perl"
+			}
+		}
+	}
+	return "plaintext"
+}
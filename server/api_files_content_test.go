@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+func TestFileContent(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src/main.go"), []byte("package main\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/usr/bin/env python3\nprint(1)\n"), 0755)
+	os.WriteFile(filepath.Join(dir, "image.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00"), 0644)
+	os.WriteFile(filepath.Join(dir, "big.txt"), bytes.Repeat([]byte("x"), 100), 0644)
+
+	get := func(path, maxSize string) (int, FileContent) {
+		t.Helper()
+		q := url.Values{"dir": {dir}, "path": {path}}
+		if maxSize != "" {
+			q.Set("max_size", maxSize)
+		}
+		rec := httptest.NewRecorder()
+		handleFileContent(rec, httptest.NewRequest(http.MethodGet, "/api/files/content?"+q.Encode(), nil))
+		var fc FileContent
+		json.Unmarshal(rec.Body.Bytes(), &fc)
+		return rec.Code, fc
+	}
+	put := func(req SaveFileContentRequest) (int, map[string]json.RawMessage) {
+		t.Helper()
+		req.Dir = dir
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handleFileContent(rec, httptest.NewRequest(http.MethodPut, "/api/files/content", bytes.NewReader(body)))
+		var resp map[string]json.RawMessage
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, fc := get("src/main.go", "")
+	if code != http.StatusOK || fc.Content != "package main\n" || fc.Language != "go" || fc.Hash != hashContent([]byte("package main\n")) {
+		t.Fatalf("get main.go: %d %+v", code, fc)
+	}
+	if _, fc := get("tool", ""); fc.Language != "python" {
+		t.Errorf("shebang language = %q, want python", fc.Language)
+	}
+	if _, fc := get("image.png", ""); !fc.Binary || fc.Content != "" {
+		t.Errorf("binary file: %+v", fc)
+	}
+	if _, fc := get("big.txt", "10"); !fc.TooLarge || fc.Content != "" || fc.Size != 100 || fc.Hash == "" {
+		t.Errorf("too large file: %+v", fc)
+	}
+	if code, _ := get("missing.txt", ""); code != http.StatusNotFound {
+		t.Errorf("missing file: %d, want 404", code)
+	}
+	if code, _ := get("src", ""); code != http.StatusBadRequest {
+		t.Errorf("directory: %d, want 400", code)
+	}
+	if _, fc := get("../../src/main.go", ""); fc.Path != "src/main.go" {
+		t.Errorf("path escaped the dir: %+v", fc)
+	}
+
+	if code, _ := put(SaveFileContentRequest{Path: "src/main.go", Content: "x"}); code != http.StatusPreconditionRequired {
+		t.Errorf("save without expected_hash: %d, want 428", code)
+	}
+	code, resp := put(SaveFileContentRequest{Path: "src/main.go", Content: "package main // v2\n", ExpectedHash: fc.Hash})
+	if code != http.StatusOK {
+		t.Fatalf("save: %d %v", code, resp)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "src/main.go"))
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode after save = %v, want 0600", info.Mode().Perm())
+	}
+
+	// a second save from the same starting point conflicts
+	code, resp = put(SaveFileContentRequest{Path: "src/main.go", Content: "package main // v3\n", ExpectedHash: fc.Hash})
+	if code != http.StatusConflict {
+		t.Fatalf("stale save: %d %v, want 409", code, resp)
+	}
+	var current FileContent
+	json.Unmarshal(resp["current"], &current)
+	if current.Content != "package main // v2\n" {
+		t.Errorf("conflict current = %+v", current)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "src/main.go")); string(data) != "package main // v2\n" {
+		t.Errorf("stale save overwrote the file: %q", data)
+	}
+
+	if code, _ := put(SaveFileContentRequest{Path: "notes/new.md", Content: "# new\n", Create: true}); code != http.StatusOK {
+		t.Errorf("create: %d", code)
+	}
+	if code, _ := put(SaveFileContentRequest{Path: "notes/new.md", Content: "again", Create: true}); code != http.StatusConflict {
+		t.Errorf("create existing: %d, want 409", code)
+	}
+}
+
+func TestFileContentConfinesMembers(t *testing.T) {
+	t.Chdir(t.TempDir()) // the workspace and registry live under the working directory
+	member := auth.WithIdentity(context.Background(), &auth.Identity{User: "carol", Role: auth.RoleMember})
+
+	app, _ := filepath.Abs(filepath.Join(projects.Workspace("carol"), "app"))
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(app, ".git"), 0755)
+	os.WriteFile(filepath.Join(app, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret\n"), 0644)
+	os.Symlink(outside, filepath.Join(app, "escape"))
+	if _, err := projects.ForContext(member).Add(projects.Project{Name: "app", Dir: app}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(dir, path string) int {
+		t.Helper()
+		q := url.Values{"dir": {dir}, "path": {path}}
+		rec := httptest.NewRecorder()
+		handleFileContent(rec, httptest.NewRequest(http.MethodGet, "/api/files/content?"+q.Encode(), nil).WithContext(member))
+		return rec.Code
+	}
+	put := func(path string) int {
+		t.Helper()
+		body, _ := json.Marshal(SaveFileContentRequest{Dir: app, Path: path, Content: "x", Create: true})
+		rec := httptest.NewRecorder()
+		handleFileContent(rec, httptest.NewRequest(http.MethodPut, "/api/files/content", bytes.NewReader(body)).WithContext(member))
+		return rec.Code
+	}
+
+	if code := get(app, "main.go"); code != http.StatusOK {
+		t.Errorf("project file: %d, want 200", code)
+	}
+	if code := get(outside, "secret"); code != http.StatusForbidden {
+		t.Errorf("dir outside the projects: %d, want 403", code)
+	}
+	if code := get(app, "escape/secret"); code != http.StatusForbidden {
+		t.Errorf("file through a symlink out: %d, want 403", code)
+	}
+	if code := put("escape/new"); code != http.StatusForbidden {
+		t.Errorf("create through a symlink out: %d, want 403", code)
+	}
+	if code := put(".git/config"); code != http.StatusForbidden {
+		t.Errorf("write into .git: %d, want 403", code)
+	}
+	if code := put("notes.md"); code != http.StatusOK {
+		t.Errorf("create in the project: %d, want 200", code)
+	}
+}
+
+// TestRegisterAPI catches routes registered twice (such as
+// /api/files/content by the checkpoint package), which make ServeMux panic
+// at startup.
+func TestRegisterAPI(t *testing.T) {
+	if err := RegisterAPI(http.NewServeMux()); err != nil {
+		t.Fatal(err)
+	}
+}
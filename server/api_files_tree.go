@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/httpcache"
+	"github.com/xhd2015/ai-critic/server/vcs"
+)
+
+// TreeEntry is one child of a directory listed by /api/files/tree.
+type TreeEntry struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // slash-separated, relative to the project dir
+	IsDir     bool      `json:"is_dir"`
+	IsSymlink bool      `json:"is_symlink,omitempty"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	// GitStatus is "modified", "added", "deleted", "renamed", "copied",
+	// "untracked", "ignored" or "conflicted"; empty for clean entries.
+	// Deleted files are listed although they are gone from disk.
+	GitStatus string `json:"git_status,omitempty"`
+	Staged    bool   `json:"staged,omitempty"`
+	// Changes counts changed files below a directory, so the client can mark
+	// directories to expand without listing them.
+	Changes       int  `json:"changes,omitempty"`
+	IsGitDir      bool `json:"is_git_dir,omitempty"`
+	IsGitWorktree bool `json:"is_git_worktree,omitempty"`
+}
+
+// TreeListing is the response of GET /api/files/tree.
+type TreeListing struct {
+	Dir     string      `json:"dir"`
+	Path    string      `json:"path"`
+	IsRepo  bool        `json:"is_repo"`
+	Entries []TreeEntry `json:"entries"`
+}
+
+// treeStatus is one path from git status, relative to the project dir.
+type treeStatus struct {
+	path   string // a trailing slash marks a collapsed untracked or ignored directory
+	status string
+	staged bool
+}
+
+func registerFileTreeAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/files/tree", handleFileTree)
+}
+
+// handleFileTree lists one directory of a project, annotated with git status.
+// GET /api/files/tree?dir=/project&path=sub/dir[&ignored=false]
+//
+// Only the requested directory is read, so clients load the tree lazily as
+// the user expands it. ignored=false leaves out git-ignored entries.
+func handleFileTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	dir, ok := resolveRequestDir(w, r, q.Get("dir"), "")
+	if !ok || !checkAllowed(w, r, projectFilePath(dir, q.Get("path"))) {
+		return
+	}
+	listing, err := listFileTree(dir, q.Get("path"), q.Get("ignored") != "false")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		} else if _, ok := err.(treePathError); ok {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	httpcache.WriteJSON(w, r, listing)
+}
+
+type treePathError string
+
+func (e treePathError) Error() string { return string(e) }
+
+func listFileTree(dir, sub string, includeIgnored bool) (*TreeListing, error) {
+	// cleaning under a root confines sub to dir
+	sub = strings.Trim(filepath.ToSlash(filepath.Clean("/"+sub)), "/")
+	fullPath := filepath.Join(dir, filepath.FromSlash(sub))
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, treePathError("path is not a directory")
+	}
+	dirEntries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &TreeListing{Dir: dir, Path: sub, IsRepo: gitrunner.IsRepo(dir), Entries: []TreeEntry{}}
+	var statuses []treeStatus
+	if listing.IsRepo {
+		statuses, err = treeGitStatus(dir, sub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byName := make(map[string]int, len(dirEntries))
+	for _, de := range dirEntries {
+		if listing.IsRepo && de.Name() == ".git" {
+			continue
+		}
+		entry := TreeEntry{Name: de.Name(), Path: joinTreePath(sub, de.Name())}
+		if info, err := de.Info(); err == nil {
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime()
+		}
+		entry.IsSymlink = de.Type()&os.ModeSymlink != 0
+		_, entry.IsDir, entry.IsGitDir, entry.IsGitWorktree = getFileSize(fullPath, de.Name())
+		if entry.IsDir {
+			entry.Size = 0
+		}
+		byName[entry.Name] = len(listing.Entries)
+		listing.Entries = append(listing.Entries, entry)
+	}
+
+	for _, st := range statuses {
+		// a status on the listed directory or above applies to every entry
+		if st.path == "" || (strings.HasSuffix(st.path, "/") && strings.HasPrefix(sub+"/", st.path)) {
+			for i := range listing.Entries {
+				listing.Entries[i].GitStatus = st.status
+			}
+			continue
+		}
+		rel := st.path
+		if sub != "" {
+			if !strings.HasPrefix(rel, sub+"/") {
+				continue
+			}
+			rel = rel[len(sub)+1:]
+		}
+		name, rest, nested := strings.Cut(rel, "/")
+		i, ok := byName[name]
+		if !ok {
+			if st.status != "deleted" {
+				continue
+			}
+			// gone from disk: a deleted file, or a directory of them
+			i = len(listing.Entries)
+			byName[name] = i
+			listing.Entries = append(listing.Entries, TreeEntry{Name: name, Path: joinTreePath(sub, name), IsDir: nested})
+		}
+		e := &listing.Entries[i]
+		if !nested || rest == "" {
+			e.GitStatus, e.Staged = st.status, st.staged
+		} else if st.status != "ignored" {
+			e.Changes++
+		}
+	}
+
+	entries := listing.Entries[:0]
+	for _, e := range listing.Entries {
+		if e.GitStatus == "ignored" && !includeIgnored {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	listing.Entries = entries
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return listing, nil
+}
+
+func joinTreePath(sub, name string) string {
+	if sub == "" {
+		return name
+	}
+	return sub + "/" + name
+}
+
+// treeGitStatus runs git status limited to sub and returns paths relative
+// to dir. Untracked and ignored directories are reported collapsed.
+func treeGitStatus(dir, sub string) ([]treeStatus, error) {
+	pathspec := sub
+	if pathspec == "" {
+		pathspec = "."
+	}
+	out, err := gitrunner.Status("--porcelain=v1", "-z", "--ignored", "--", pathspec).Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %v", err)
+	}
+	// porcelain paths are relative to the repository root, not to dir
+	prefix, err := gitrunner.RevParse("--show-prefix").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository prefix: %v", err)
+	}
+	return parseTreeStatus(out, strings.TrimSpace(string(prefix))), nil
+}
+
+// parseTreeStatus parses `git status --porcelain=v1 -z` output, keeping the
+// paths under prefix with the prefix removed.
+func parseTreeStatus(out []byte, prefix string) []treeStatus {
+	var result []treeStatus
+	records := bytes.Split(out, []byte{0})
+	for i := 0; i < len(records); i++ {
+		rec := string(records[i])
+		if len(rec) < 4 {
+			continue
+		}
+		x, y, path := rec[0], rec[1], rec[3:]
+		if x == 'R' || x == 'C' {
+			i++ // the source path of a rename or copy follows
+		}
+		switch {
+		case prefix == "":
+		case strings.HasSuffix(path, "/") && strings.HasPrefix(prefix, path):
+			path = "" // an untracked or ignored directory containing dir
+		case strings.HasPrefix(path, prefix):
+			path = path[len(prefix):]
+		default:
+			continue
+		}
+		status, staged := classifyTreeStatus(x, y)
+		result = append(result, treeStatus{path: path, status: status, staged: staged})
+	}
+	return result
+}
+
+// classifyTreeStatus maps the XY codes of porcelain v1 to one status.
+// Staged reports whether the change is in the index.
+func classifyTreeStatus(x, y byte) (string, bool) {
+	switch {
+	case x == '?' && y == '?':
+		return "untracked", false
+	case x == '!' && y == '!':
+		return "ignored", false
+	case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+		return "conflicted", false
+	case x != ' ':
+		return vcs.GitStatusName(x), true
+	}
+	return vcs.GitStatusName(y), false
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFileTree(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		path := filepath.Join(repo, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	git("init", "-q", "-b", "main")
+	write(".gitignore", "build/\n")
+	write("clean.txt", "c\n")
+	write("edited.txt", "e\n")
+	write("gone.txt", "g\n")
+	write("src/a.go", "package a\n")
+	write("src/b.go", "package a\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+
+	write("edited.txt", "e2\n")
+	os.Remove(filepath.Join(repo, "gone.txt"))
+	write("staged.txt", "s\n")
+	git("add", "staged.txt")
+	write("src/a.go", "package a // changed\n")
+	write("src/new.go", "package a\n")
+	write("build/out.bin", "x")
+	write("notes/todo.md", "t\n")
+
+	list := func(path, ignored string) TreeListing {
+		t.Helper()
+		q := url.Values{"dir": {repo}, "path": {path}, "ignored": {ignored}}
+		rec := httptest.NewRecorder()
+		handleFileTree(rec, httptest.NewRequest(http.MethodGet, "/api/files/tree?"+q.Encode(), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("tree %q: %d %s", path, rec.Code, rec.Body.String())
+		}
+		var listing TreeListing
+		json.Unmarshal(rec.Body.Bytes(), &listing)
+		return listing
+	}
+	summary := func(l TreeListing) string {
+		var parts []string
+		for _, e := range l.Entries {
+			s := e.Path + "=" + e.GitStatus
+			if e.Staged {
+				s += "+staged"
+			}
+			if e.Changes > 0 {
+				s += "/" + strconv.Itoa(e.Changes)
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	root := list("", "")
+	if !root.IsRepo {
+		t.Error("is_repo = false")
+	}
+	want := "build=ignored notes=untracked src=/2 .gitignore= clean.txt= edited.txt=modified gone.txt=deleted staged.txt=added+staged"
+	if got := summary(root); got != want {
+		t.Errorf("root:\n got %s\nwant %s", got, want)
+	}
+	if got := summary(list("", "false")); strings.Contains(got, "build") {
+		t.Errorf("ignored=false still lists build: %s", got)
+	}
+	if got, want := summary(list("src", "")), "src/a.go=modified src/b.go= src/new.go=untracked"; got != want {
+		t.Errorf("src: %s, want %s", got, want)
+	}
+	// everything inside an untracked directory is untracked
+	if got, want := summary(list("notes", "")), "notes/todo.md=untracked"; got != want {
+		t.Errorf("notes: %s, want %s", got, want)
+	}
+	// paths cannot climb out of dir
+	if l := list("../..", ""); l.Path != "" || len(l.Entries) != len(root.Entries) {
+		t.Errorf("escaped dir: %+v", l)
+	}
+}
+
+func TestParseTreeStatus(t *testing.T) {
+	out := []byte("R  sub/new.go\x00sub/old.go\x00 M sub/x.go\x00?? other/\x00!! sub/\x00")
+	got := parseTreeStatus(out, "sub/")
+	want := []treeStatus{
+		{path: "new.go", status: "renamed", staged: true},
+		{path: "x.go", status: "modified"},
+		{path: "", status: "ignored"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTreeStatus = %+v, want %+v", got, want)
+	}
+}
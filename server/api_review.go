@@ -2,22 +2,40 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/xhd2015/agent-pro/agent/commit_msg"
 	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/agentchanges"
 	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+	"github.com/xhd2015/ai-critic/server/audit"
 	"github.com/xhd2015/ai-critic/server/config"
 	"github.com/xhd2015/ai-critic/server/env"
 	"github.com/xhd2015/ai-critic/server/github"
+	"github.com/xhd2015/ai-critic/server/highlight"
+	"github.com/xhd2015/ai-critic/server/httpcache"
+	"github.com/xhd2015/ai-critic/server/jobs"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/notifications"
 	"github.com/xhd2015/ai-critic/server/projects"
+	"github.com/xhd2015/ai-critic/server/quota"
+	"github.com/xhd2015/ai-critic/server/rules"
+	"github.com/xhd2015/ai-critic/server/tenant"
+	"github.com/xhd2015/ai-critic/server/vcs"
 )
 
 // initialDir stores the initial directory set via --dir flag
@@ -26,8 +44,18 @@ var initialDir string
 // aiConfig stores the AI configuration (legacy)
 var aiConfig *config.Config
 
-// aiConfigAdapter stores the AI configuration (new)
-var aiConfigAdapter *config.ConfigAdapter
+// aiConfigAdapter stores the AI configuration (new).
+// It is swapped atomically when the config files are hot-reloaded.
+var aiConfigAdapter atomic.Pointer[config.ConfigAdapter]
+
+var (
+	reviewLog = logging.New("review")
+	chatLog   = logging.New("chat")
+)
+
+// reviewChatCache holds review chat answers keyed by diff, rules, messages
+// and model.
+var reviewChatCache = ai.NewCache(config.AICacheDir, ai.DefaultCacheTTL)
 
 // SetInitialDir sets the initial directory for code review
 func SetInitialDir(dir string) {
@@ -51,18 +79,18 @@ func GetAIConfig() *config.Config {
 
 // SetAIConfigAdapter sets the AI configuration using the new adapter
 func SetAIConfigAdapter(adapter *config.ConfigAdapter) {
-	aiConfigAdapter = adapter
+	aiConfigAdapter.Store(adapter)
 }
 
 // GetAIConfigAdapter returns the AI configuration adapter
 func GetAIConfigAdapter() *config.ConfigAdapter {
-	return aiConfigAdapter
+	return aiConfigAdapter.Load()
 }
 
 // getEffectiveAIConfig returns the effective AI config (adapter first, then legacy)
 func getEffectiveAIConfig() *config.ConfigAdapter {
-	if aiConfigAdapter != nil {
-		return aiConfigAdapter
+	if adapter := aiConfigAdapter.Load(); adapter != nil {
+		return adapter
 	}
 	if aiConfig != nil {
 		return config.NewConfigAdapter(&config.AIModelsConfig{
@@ -78,9 +106,15 @@ func getEffectiveAIConfig() *config.ConfigAdapter {
 // CodeReviewRequest represents a request to review code changes
 type CodeReviewRequest struct {
 	Dir      string `json:"dir"`      // Directory to run git diff in, defaults to initial dir
+	Worktree string `json:"worktree"` // Worktree of Dir to use instead: path, branch or worktree ID (optional)
 	Provider string `json:"provider"` // AI provider to use (optional)
 	Model    string `json:"model"`    // AI model to use (optional)
 	SSHKey   string `json:"ssh_key"`  // Encrypted SSH private key for git operations (optional)
+	// Background returns {"job_id"} right away for push/fetch instead of
+	// waiting; follow the job via /api/jobs/stream.
+	Background bool `json:"background"`
+	// Highlight adds per-line syntax tokens to each file of /api/review/diff.
+	Highlight bool `json:"highlight"`
 }
 
 // GitDiffResult holds the result of git diff commands
@@ -98,6 +132,9 @@ type DiffFile struct {
 	Diff       string `json:"diff"`       // The diff content for this file
 	IsStaged   bool   `json:"isStaged"`   // Whether this is a staged change
 	TotalLines int    `json:"totalLines"` // Total lines in the file
+	// Tokens holds syntax tokens per line of Diff (nil for header and hunk
+	// lines); only set when the request asks for highlighting.
+	Tokens [][]highlight.Token `json:"tokens,omitempty"`
 }
 
 // ChatMessage represents a message in the chat
@@ -112,26 +149,63 @@ type ChatRequest struct {
 	DiffContext string        `json:"diffContext"` // The diff context for the chat
 	Provider    string        `json:"provider"`    // AI provider to use
 	Model       string        `json:"model"`       // AI model to use
+	SessionID   string        `json:"sessionId"`   // Chat session, for usage tracking (optional)
+	NoCache     bool          `json:"noCache"`     // Bypass the response cache
+	// Dir is the reviewed project, whose .ai-critic/rules packs apply
+	// (optional; defaults to the --dir directory).
+	Dir string `json:"dir"`
+	// Rules turns rule packs on or off for this request.
+	Rules rules.Selection `json:"rules"`
+	// NoChunking sends a large diff in one prompt instead of reviewing it
+	// in parts; see reviewChunkThreshold.
+	NoChunking bool `json:"noChunking"`
 }
 
 func registerReviewAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/review/config", handleGetConfig)
 	mux.HandleFunc("/api/review/diff", handleGetDiff)
 	mux.HandleFunc("/api/review/chat", handleChat)
+	mux.HandleFunc("/api/review/chat/cache", handleChatCache)
+	mux.HandleFunc("/api/review/findings", handleReviewFindings)
 	mux.HandleFunc("/api/review/stage", handleStageFile)
 	mux.HandleFunc("/api/review/unstage", handleUnstageFile)
+	mux.HandleFunc("/api/review/stage-hunk", handleStageHunk)
+	mux.HandleFunc("/api/review/unstage-hunk", handleUnstageHunk)
 	mux.HandleFunc("/api/review/checkout", handleGitCheckout)
 	mux.HandleFunc("/api/review/remove", handleGitRemove)
 	mux.HandleFunc("/api/review/commit", handleGitCommit)
+	mux.HandleFunc("/api/review/amend", handleGitAmend)
+	mux.HandleFunc("/api/review/rebase", handleGitRebase)
+	mux.HandleFunc("/api/review/conflicts", handleGitConflicts)
+	mux.HandleFunc("/api/review/conflicts/resolve", handleGitResolve)
+	mux.HandleFunc("/api/review/merge-continue", handleGitMergeContinue)
+	mux.HandleFunc("/api/review/apply-patch", handleApplyPatch)
+	mux.HandleFunc("/api/review/read-state", handleReadState)
+	mux.HandleFunc("/api/review/read-state/mark", handleMarkReviewed)
+	mux.HandleFunc("/api/review/read-state/unmark", handleUnmarkReviewed)
 	mux.HandleFunc("/api/review/push", handleGitPush)
 	mux.HandleFunc("/api/review/fetch", handleGitFetch)
 	mux.HandleFunc("/api/review/status", handleGitStatus)
 	mux.HandleFunc("/api/review/branches", handleGitBranches)
+	mux.HandleFunc("/api/review/branch/create", handleBranchCreate)
+	mux.HandleFunc("/api/review/branch/switch", handleBranchSwitch)
+	mux.HandleFunc("/api/review/branch/delete", handleBranchDelete)
+	mux.HandleFunc("/api/review/branch/merge", handleBranchMerge)
+	mux.HandleFunc("/api/review/stash/list", handleStashList)
+	mux.HandleFunc("/api/review/stash/push", handleStashPush)
+	mux.HandleFunc("/api/review/stash/apply", handleStashApply)
+	mux.HandleFunc("/api/review/stash/pop", handleStashPop)
+	mux.HandleFunc("/api/review/stash/drop", handleStashDrop)
+	mux.HandleFunc("/api/review/stash/show", handleStashShow)
+	mux.HandleFunc("/api/review/hooks", handleListHooks)
+	mux.HandleFunc("/api/review/hooks/show", handleShowHook)
+	mux.HandleFunc("/api/review/hooks/disable", handleDisableHooks)
+	mux.HandleFunc("/api/review/log", handleGitLog)
+	mux.HandleFunc("/api/review/show/", handleGitShow)
 	mux.HandleFunc("/api/review/worktrees", handleListWorktrees)
 	mux.HandleFunc("/api/review/worktrees/create", handleCreateWorktree)
 	mux.HandleFunc("/api/review/worktrees/remove", handleRemoveWorktree)
 	mux.HandleFunc("/api/review/worktrees/move", handleMoveWorktree)
-	mux.HandleFunc("/api/review/list-untracked-dir", handleListUntrackedDir)
 	mux.HandleFunc("/api/review/generate-commit-message", handleGenerateCommitMessage)
 }
 
@@ -158,8 +232,10 @@ type ConfigInfo struct {
 
 // handleGetConfig returns the initial configuration including the default directory
 func handleGetConfig(w http.ResponseWriter, r *http.Request) {
-	cfg := ConfigInfo{
-		InitialDir: initialDir,
+	cfg := ConfigInfo{}
+	if tenant.Name(r.Context()) == "" {
+		// members do not work there, see resolveDir
+		cfg.InitialDir = initialDir
 	}
 
 	// Add providers and models from config (use adapter if available)
@@ -178,6 +254,7 @@ func handleGetConfig(w http.ResponseWriter, r *http.Request) {
 		cfg.DefaultProvider = effectiveCfg.GetDefaultProvider()
 		cfg.DefaultModel = effectiveCfg.GetDefaultModel()
 	}
+	addOllamaModels(&cfg, effectiveCfg)
 
 	writeJSON(w, http.StatusOK, cfg)
 }
@@ -195,32 +272,40 @@ func handleGetDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := req.Dir
-	if dir == "" {
-		dir = initialDir
-		if dir == "" {
-			var err error
-			dir, err = os.Getwd()
-			if err != nil {
-				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get current directory"})
-				return
-			}
-		}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
 	}
 
-	result, err := getGitDiff(dir)
+	kind := "diff"
+	if req.Highlight {
+		kind = "diff-highlight"
+	}
+	result, err := cachedRepoRead(kind, dir, func() (*GitDiffResult, error) {
+		result, err := getGitDiff(dir)
+		if err != nil {
+			return nil, err
+		}
+		if req.Highlight {
+			for i := range result.Files {
+				result.Files[i].Tokens = highlight.UnifiedDiff(result.Files[i].Path, result.Files[i].Diff)
+			}
+		}
+		return result, nil
+	})
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	httpcache.WriteJSON(w, r, result)
 }
 
 // StageFileRequest represents a request to stage a file
 type StageFileRequest struct {
-	Dir  string `json:"dir"`  // Directory to run git add in
-	Path string `json:"path"` // File path to stage
+	Dir      string `json:"dir"`      // Directory to run git add in
+	Worktree string `json:"worktree"` // Worktree of Dir to use instead (optional)
+	Path     string `json:"path"`     // File path to stage
 }
 
 // handleStageFile handles requests to stage a file using git add
@@ -236,17 +321,9 @@ func handleStageFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := req.Dir
-	if dir == "" {
-		dir = initialDir
-		if dir == "" {
-			var err error
-			dir, err = os.Getwd()
-			if err != nil {
-				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to get current directory"})
-				return
-			}
-		}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
 	}
 
 	if req.Path == "" {
@@ -254,10 +331,12 @@ func handleStageFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run git add
-	output, err := gitrunner.Add(req.Path).Dir(dir).Run()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to stage file: %s", string(output))})
+	v, ok := repoVCS(w, dir)
+	if !ok {
+		return
+	}
+	if err := v.Stage(dir, req.Path); err != nil {
+		writeJSON(w, vcsErrorStatus(err), map[string]string{"error": fmt.Sprintf("Failed to stage file: %v", err)})
 		return
 	}
 
@@ -277,9 +356,8 @@ func handleUnstageFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
@@ -288,9 +366,12 @@ func handleUnstageFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output, err := gitrunner.Reset(req.Path).Dir(dir).Run()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to unstage file: %s", string(output))})
+	v, ok := repoVCS(w, dir)
+	if !ok {
+		return
+	}
+	if err := v.Unstage(dir, req.Path); err != nil {
+		writeJSON(w, vcsErrorStatus(err), map[string]string{"error": fmt.Sprintf("Failed to unstage file: %v", err)})
 		return
 	}
 
@@ -310,9 +391,8 @@ func handleGitCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
@@ -349,9 +429,8 @@ func handleGitRemove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok {
 		return
 	}
 
@@ -372,9 +451,13 @@ func handleGitRemove(w http.ResponseWriter, r *http.Request) {
 // GitCommitRequest represents a request to commit changes
 type GitCommitRequest struct {
 	Dir       string `json:"dir"`
+	Worktree  string `json:"worktree"` // Worktree of Dir to commit in (optional)
 	Message   string `json:"message"`
 	UserName  string `json:"user_name"`
 	UserEmail string `json:"user_email"`
+	// NoAgentTrailers skips the Generated-by trailers added when staged files
+	// were written by an agent session
+	NoAgentTrailers bool `json:"no_agent_trailers"`
 }
 
 // handleGitCommit handles requests to commit staged changes
@@ -390,9 +473,8 @@ func handleGitCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
@@ -401,27 +483,65 @@ func handleGitCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set git user config if provided
-	if req.UserName != "" {
-		if output, err := gitrunner.Config("user.name", req.UserName).Dir(dir).Run(); err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to set git user.name: %s", string(output))})
-			return
-		}
+	v, ok := repoVCS(w, dir)
+	if !ok {
+		return
 	}
-	if req.UserEmail != "" {
-		if output, err := gitrunner.Config("user.email", req.UserEmail).Dir(dir).Run(); err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to set git user.email: %s", string(output))})
-			return
+
+	message := req.Message
+	var agentAttrs []agentchanges.Attribution
+	if !req.NoAgentTrailers {
+		attrs, err := agentchanges.StagedAttributions(dir)
+		if err != nil {
+			reviewLog.Warnf("look up agent changes in %s: %v", dir, err)
+		}
+		if len(attrs) > 0 {
+			agentAttrs = attrs
+			message = agentchanges.AppendTrailers(message, agentchanges.Trailers(attrs))
 		}
 	}
 
-	output, err := gitrunner.Commit(req.Message, false).Dir(dir).Run()
+	hooks := commitHooksOf(dir)
+	output, err := v.Commit(dir, message, vcs.Author{Name: req.UserName, Email: req.UserEmail})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to commit: %s", string(output))})
+		resp := map[string]string{"error": fmt.Sprintf("Failed to commit: %v", err)}
+		if len(hooks) > 0 {
+			// a failing hook is the usual reason a commit is refused
+			resp["hooks"] = strings.Join(hooks, ",")
+		}
+		writeJSON(w, vcsErrorStatus(err), resp)
 		return
 	}
+	if len(agentAttrs) > 0 {
+		recordAgentCommit(r, dir, agentAttrs)
+	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": string(output)})
+	resp := map[string]string{"status": "ok", "output": output}
+	if len(hooks) > 0 {
+		resp["hooks"] = strings.Join(hooks, ",")
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// recordAgentCommit audits which agent sessions wrote the files of the commit
+// just made in dir, and forgets attributions of files it left clean.
+func recordAgentCommit(r *http.Request, dir string, attrs []agentchanges.Attribution) {
+	sha, _ := gitrunner.RevParse("HEAD").Dir(dir).Output()
+	bySession := make(map[string][]string)
+	var sessions []agentchanges.Attribution
+	for _, a := range attrs {
+		if _, ok := bySession[a.SessionID]; !ok {
+			sessions = append(sessions, a)
+		}
+		bySession[a.SessionID] = append(bySession[a.SessionID], a.Path)
+	}
+	for _, a := range sessions {
+		audit.Record(r, "agent-commit", fmt.Sprintf("commit %s in %s includes agent changes: agent=%s model=%s session=%s files=%s",
+			strings.TrimSpace(string(sha)), dir, a.Agent, a.Model, a.SessionID, strings.Join(bySession[a.SessionID], ",")))
+	}
+	if err := agentchanges.Prune(dir); err != nil {
+		reviewLog.Warnf("prune agent changes in %s: %v", dir, err)
+	}
 }
 
 // handleGitPush handles requests to push to remote with SSE streaming
@@ -437,9 +557,8 @@ func handleGitPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
@@ -448,7 +567,11 @@ func handleGitPush(w http.ResponseWriter, r *http.Request) {
 	wantStream := acceptHeader == "text/event-stream"
 
 	// Get current branch first
-	branch, err := gitrunner.GetCurrentBranch(dir)
+	v, err := vcs.For(dir)
+	var branch string
+	if err == nil {
+		branch, err = v.CurrentBranch(dir)
+	}
 	if err != nil {
 		if wantStream {
 			sseWriter := sse.NewWriter(w)
@@ -462,8 +585,9 @@ func handleGitPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build git push command using gitrunner
+	// Prepare the SSH key for the push command
 	var keyPath string
+	cleanup := func() {}
 	if req.SSHKey != "" {
 		keyFile, err := github.PrepareSSHKeyFile(req.SSHKey)
 		if err != nil {
@@ -478,38 +602,63 @@ func handleGitPush(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to prepare SSH key: %v", err)})
 			return
 		}
-		defer keyFile.Cleanup()
 		keyPath = keyFile.Path
+		cleanup = keyFile.Cleanup
 	}
-	cmd := gitrunner.Push(branch, keyPath).Dir(dir).Exec()
 
-	if wantStream {
-		// Use SSE streaming
-		sseWriter := sse.NewWriter(w)
-		if sseWriter == nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
-			return
-		}
-
-		sseWriter.SendLog(fmt.Sprintf("Starting git push origin HEAD:%s...", branch))
-		err = sseWriter.StreamCmd(cmd)
+	// Run as a job so the push completes even if the client disconnects
+	var output string
+	job := jobs.Start("git-push", fmt.Sprintf("Push %s (%s)", branch, filepath.Base(dir)), func(ctx context.Context, j *jobs.Job) error {
+		defer cleanup()
+		j.Logf("Starting git push origin HEAD:%s...", branch)
+		var err error
+		output, err = j.RunCmd(ctx, v.PushCmd(dir, branch, keyPath))
+		recordPush(dir, branch, err)
 		if err != nil {
-			sseWriter.SendError(fmt.Sprintf("Push failed: %v", err))
-			sseWriter.SendDone(map[string]string{"success": "false"})
-			return
+			return fmt.Errorf("Push failed: %v", err)
 		}
-		sseWriter.SendDone(map[string]string{"success": "true", "message": "Push completed successfully"})
+		j.SetResult("message", "Push completed successfully")
+		return nil
+	})
+
+	if wantStream {
+		jobs.ServeSSE(w, r, job, 0)
+		return
+	}
+	if req.Background {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "job_id": job.ID()})
 		return
 	}
 
 	// Non-streaming fallback
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to push: %s", string(output))})
+	if info := job.Wait(); info.Status != jobs.StatusSucceeded {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to push: %s", output), "job_id": job.ID()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": string(output)})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": output, "job_id": job.ID()})
+}
+
+func recordPush(dir, branch string, err error) {
+	ev := activity.Event{
+		Kind:   activity.KindPush,
+		Title:  fmt.Sprintf("Pushed %s", branch),
+		Status: "ok",
+		Ref:    branch,
+	}
+	if err != nil {
+		ev.Title = fmt.Sprintf("Push of %s failed", branch)
+		ev.Status = "error"
+		ev.Detail = err.Error()
+		notifications.Notify(notifications.Notification{
+			Event:   notifications.EventPushFailed,
+			Title:   ev.Title,
+			Body:    ev.Detail,
+			Project: dir,
+			Urgent:  true,
+		})
+	}
+	activity.Record(dir, ev)
 }
 
 func handleGitFetch(w http.ResponseWriter, r *http.Request) {
@@ -524,9 +673,8 @@ func handleGitFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
@@ -536,6 +684,7 @@ func handleGitFetch(w http.ResponseWriter, r *http.Request) {
 
 	// Build git pull command using gitrunner
 	var keyPath string
+	cleanup := func() {}
 	if req.SSHKey != "" {
 		keyFile, err := github.PrepareSSHKeyFile(req.SSHKey)
 		if err != nil {
@@ -550,37 +699,39 @@ func handleGitFetch(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Failed to prepare SSH key: %v", err)})
 			return
 		}
-		defer keyFile.Cleanup()
 		keyPath = keyFile.Path
+		cleanup = keyFile.Cleanup
 	}
-	cmd := gitrunner.PullFFOnly(keyPath).Dir(dir).Exec()
 
-	if wantStream {
-		sseWriter := sse.NewWriter(w)
-		if sseWriter == nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
-			return
-		}
-
-		sseWriter.SendLog("Starting git pull --ff-only...")
-		err := sseWriter.StreamCmd(cmd)
+	var output string
+	job := jobs.Start("git-pull", fmt.Sprintf("Pull %s", filepath.Base(dir)), func(ctx context.Context, j *jobs.Job) error {
+		defer cleanup()
+		j.Logf("Starting git pull --ff-only...")
+		var err error
+		output, err = j.RunCmd(ctx, gitrunner.PullFFOnly(keyPath).Dir(dir).Exec())
 		if err != nil {
-			sseWriter.SendError(fmt.Sprintf("Pull failed: %v", err))
-			sseWriter.SendDone(map[string]string{"success": "false"})
-			return
+			return fmt.Errorf("Pull failed: %v", err)
 		}
-		sseWriter.SendDone(map[string]string{"success": "true", "message": "Pull completed successfully"})
+		j.SetResult("message", "Pull completed successfully")
+		return nil
+	})
+
+	if wantStream {
+		jobs.ServeSSE(w, r, job, 0)
+		return
+	}
+	if req.Background {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "job_id": job.ID()})
 		return
 	}
 
 	// Non-streaming fallback
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to pull: %s", string(output))})
+	if info := job.Wait(); info.Status != jobs.StatusSucceeded {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to pull: %s", output), "job_id": job.ID()})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": string(output)})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": output, "job_id": job.ID()})
 }
 
 // GitStatusFile represents a single file in git status output
@@ -592,12 +743,17 @@ type GitStatusFile struct {
 	IsDir         bool   `json:"isDir"`         // Whether this is a directory
 	IsGitDir      bool   `json:"isGitDir"`      // Whether this directory is a git repository
 	IsGitWorktree bool   `json:"isGitWorktree"` // Whether this directory is a git worktree
+	// Agent is set when an agent session made this change
+	Agent *agentchanges.Attribution `json:"agent,omitempty"`
 }
 
 // GitStatusResult represents the result of git status
 type GitStatusResult struct {
 	Branch string          `json:"branch"`
 	Files  []GitStatusFile `json:"files"`
+	// CommitHooks are the git hooks a commit made from the UI will run
+	// (see /api/review/hooks)
+	CommitHooks []string `json:"commitHooks,omitempty"`
 }
 
 // handleGitStatus returns the git status with separated staged/unstaged files
@@ -613,101 +769,62 @@ func handleGitStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
 		return
 	}
 
-	result, err := getGitStatus(dir)
+	cached, err := cachedRepoRead("status", dir, func() (*GitStatusResult, error) {
+		return getGitStatus(dir)
+	})
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
-
-	writeJSON(w, http.StatusOK, result)
-}
-
-// ListUntrackedDirRequest represents a request to list contents of an untracked directory
-type ListUntrackedDirRequest struct {
-	Dir        string `json:"dir"`        // Git repository directory
-	SubDirPath string `json:"subDirPath"` // Path within the untracked directory to list
-}
-
-// handleListUntrackedDir lists contents of an untracked directory for navigation
-func handleListUntrackedDir(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
-		return
-	}
-
-	var req ListUntrackedDirRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-		return
+	// attributions and hooks change without the repository changing
+	result := *cached
+	result.Files = append([]GitStatusFile(nil), cached.Files...)
+	if attrs := agentchanges.Lookup(dir); len(attrs) > 0 {
+		for i := range result.Files {
+			if a, ok := attrs[result.Files[i].Path]; ok {
+				result.Files[i].Agent = &a
+			}
+		}
 	}
+	result.CommitHooks = commitHooksOf(dir)
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
-		return
-	}
+	httpcache.WriteJSON(w, r, &result)
+}
 
-	fullPath := filepath.Join(dir, req.SubDirPath)
-	entries, err := os.ReadDir(fullPath)
+// repoVCS returns the version control backend of dir, answering the
+// request itself when dir is not a repository
+func repoVCS(w http.ResponseWriter, dir string) (vcs.VCS, bool) {
+	v, err := vcs.For(dir)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to read directory: %v", err)})
-		return
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
 	}
+	return v, true
+}
 
-	var files []GitStatusFile
-	for _, entry := range entries {
-		entryPath := filepath.Join(req.SubDirPath, entry.Name())
-
-		// Skip files/dirs that are ignored by git
-		if gitrunner.IsIgnored(dir, entryPath) {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		// Check if this directory is a git repository
-		// Git repos have either a .git directory (normal repos) or a .git file (worktrees)
-		isGitDir := false
-		isGitWorktree := false
-		if entry.IsDir() {
-			gitPath := filepath.Join(fullPath, entry.Name(), ".git")
-			if gitInfo, err := os.Stat(gitPath); err == nil {
-				isGitDir = true
-				// Check if it's a worktree (.git is a file, not a directory)
-				if !gitInfo.IsDir() {
-					isGitWorktree = true
-				}
-			}
-		}
-
-		files = append(files, GitStatusFile{
-			Path:          entryPath,
-			Status:        "untracked",
-			IsStaged:      false,
-			Size:          info.Size(),
-			IsDir:         entry.IsDir(),
-			IsGitDir:      isGitDir,
-			IsGitWorktree: isGitWorktree,
-		})
+// vcsErrorStatus is the status of a failed version control operation
+func vcsErrorStatus(err error) int {
+	if errors.Is(err, vcs.ErrUnsupported) {
+		return http.StatusBadRequest
 	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{"files": files})
+	return http.StatusInternalServerError
 }
 
-// resolveDir resolves the git directory from the request, falling back to initialDir or cwd
-func resolveDir(dir string) string {
-	if dir != "" {
+// resolveDir resolves the git directory from the request, falling back to
+// the request's project (see projects.Middleware), initialDir or cwd.
+// Members only get the first two: initialDir is the admin's.
+func resolveDir(ctx context.Context, dir string) string {
+	if dir := projects.Dir(ctx, dir); dir != "" {
 		return dir
 	}
+	if tenant.Name(ctx) != "" {
+		return ""
+	}
 	if initialDir != "" {
 		return initialDir
 	}
@@ -718,81 +835,101 @@ func resolveDir(dir string) string {
 	return d
 }
 
-// getGitStatus runs git status --porcelain=v1 -b and parses the output
-func getGitStatus(dir string) (*GitStatusResult, error) {
-	if err := gitrunner.EnsureAvailable(); err != nil {
-		return nil, err
+// resolveRequestDir resolves the project and worktree of a request, writing
+// the error response when they are invalid or a member may not work there
+// (see projects.Allowed).
+func resolveRequestDir(w http.ResponseWriter, r *http.Request, reqDir, worktree string) (string, bool) {
+	dir := resolveDir(r.Context(), reqDir)
+	if dir == "" {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+		return "", false
 	}
-	if err := gitrunner.RevParse("--git-dir").Dir(dir).RunSilent(); err != nil {
-		return nil, fmt.Errorf("not a git repository: %s", dir)
+	if !checkAllowed(w, r, dir) {
+		return "", false
 	}
-
-	// Get branch name
-	branchOutput, err := gitrunner.Branch("--show-current").Dir(dir).Output()
+	if worktree == "" {
+		return dir, true
+	}
+	// a worktree may be anywhere, not only in the project
+	dir, err := resolveWorktreeDir(dir, worktree)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get branch: %v", err)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return "", false
+	}
+	if !checkAllowed(w, r, dir) {
+		return "", false
 	}
-	branch := strings.TrimSpace(string(branchOutput))
+	return dir, true
+}
 
-	// Get status with porcelain format
-	output, err := gitrunner.Status("--porcelain=v1").Dir(dir).Output()
+// checkAllowed fails the request with 403 if a member may not work in path,
+// a directory or a file in one.
+func checkAllowed(w http.ResponseWriter, r *http.Request, path string) bool {
+	ok, err := projects.Allowed(r.Context(), path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get git status: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return false
 	}
-
-	result := &GitStatusResult{
-		Branch: branch,
-		Files:  []GitStatusFile{},
+	if !ok {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "directory is outside your projects: " + path})
 	}
+	return ok
+}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if len(line) < 3 {
-			continue
-		}
-
-		indexStatus := line[0]    // staged status
-		workTreeStatus := line[1] // unstaged status
-		filePath := strings.TrimSpace(line[3:])
+// worktreePath returns where git, run in dir, takes a worktree path to be.
+func worktreePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
 
-		// Handle renamed files - format is "old -> new"
-		if idx := strings.Index(filePath, " -> "); idx >= 0 {
-			filePath = filePath[idx+4:]
+// resolveWorktreeDir selects a worktree of the repository at dir. worktree may
+// be the worktree path, its checked-out branch or its worktree ID; empty
+// returns dir unchanged.
+func resolveWorktreeDir(dir, worktree string) (string, error) {
+	if worktree == "" {
+		return dir, nil
+	}
+	worktrees, err := projects.GetWorktreesForProject(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, wt := range worktrees {
+		if wt.Path == worktree || wt.Branch == worktree || strconv.Itoa(wt.WorktreeID) == worktree {
+			return wt.Path, nil
 		}
+	}
+	return "", fmt.Errorf("worktree not found: %s", worktree)
+}
 
-		// Get file size and check if directory
-		size, isDir, isGitDir, isGitWorktree := getFileSize(dir, filePath)
-
-		// Staged change
-		if indexStatus != ' ' && indexStatus != '?' {
-			status := parseStatusChar(indexStatus)
-			result.Files = append(result.Files, GitStatusFile{
-				Path:          filePath,
-				Status:        status,
-				IsStaged:      true,
-				Size:          size,
-				IsDir:         isDir,
-				IsGitDir:      isGitDir,
-				IsGitWorktree: isGitWorktree,
-			})
-		}
+// getGitStatus lists the changed files of the working copy at dir,
+// separating staged and unstaged changes
+func getGitStatus(dir string) (*GitStatusResult, error) {
+	v, err := vcs.For(dir)
+	if err != nil {
+		return nil, err
+	}
+	st, err := v.Status(dir)
+	if err != nil {
+		return nil, err
+	}
 
-		// Unstaged change
-		if workTreeStatus != ' ' {
-			status := parseStatusChar(workTreeStatus)
-			if workTreeStatus == '?' {
-				status = "untracked"
-			}
-			result.Files = append(result.Files, GitStatusFile{
-				Path:          filePath,
-				Status:        status,
-				IsStaged:      false,
-				Size:          size,
-				IsDir:         isDir,
-				IsGitDir:      isGitDir,
-				IsGitWorktree: isGitWorktree,
-			})
-		}
+	result := &GitStatusResult{
+		Branch: st.Branch,
+		Files:  []GitStatusFile{},
+	}
+	for _, f := range st.Files {
+		size, isDir, isGitDir, isGitWorktree := getFileSize(dir, f.Path)
+		result.Files = append(result.Files, GitStatusFile{
+			Path:          f.Path,
+			Status:        f.Status,
+			IsStaged:      f.Staged,
+			Size:          size,
+			IsDir:         isDir,
+			IsGitDir:      isGitDir,
+			IsGitWorktree: isGitWorktree,
+		})
 	}
 
 	return result, nil
@@ -823,26 +960,6 @@ func getFileSize(dir, filePath string) (int64, bool, bool, bool) {
 	return info.Size(), info.IsDir(), isGitDir, isGitWorktree
 }
 
-// parseStatusChar converts a git status character to a human-readable status
-func parseStatusChar(c byte) string {
-	switch c {
-	case 'A':
-		return "added"
-	case 'M':
-		return "modified"
-	case 'D':
-		return "deleted"
-	case 'R':
-		return "renamed"
-	case 'C':
-		return "copied"
-	case '?':
-		return "untracked"
-	default:
-		return "modified"
-	}
-}
-
 // GitBranch represents a git branch
 type GitBranch struct {
 	Name      string `json:"name"`
@@ -863,9 +980,8 @@ func handleGitBranches(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok {
 		return
 	}
 
@@ -875,75 +991,44 @@ func handleGitBranches(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, branches)
+	httpcache.WriteJSON(w, r, branches)
 }
 
 // getGitBranches returns local branches sorted by most recent commit date
 func getGitBranches(dir string) ([]GitBranch, error) {
-	// Use git for-each-ref to list branches sorted by -committerdate (most recent first)
-	output, err := gitrunner.ForEachRef(
-		"--sort=-committerdate",
-		"--format=%(refname:short)\t%(committerdate:iso8601)\t%(HEAD)",
-		"refs/heads/",
-	).Dir(dir).Output()
+	v, err := vcs.For(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list branches: %v", err)
+		return nil, err
+	}
+	list, err := v.Branches(dir)
+	if err != nil {
+		return nil, err
 	}
-
 	var branches []GitBranch
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, "\t", 3)
-		if len(parts) < 3 {
-			continue
-		}
-		branches = append(branches, GitBranch{
-			Name:      parts[0],
-			Date:      strings.TrimSpace(parts[1]),
-			IsCurrent: strings.TrimSpace(parts[2]) == "*",
-		})
+	for _, b := range list {
+		branches = append(branches, GitBranch{Name: b.Name, IsCurrent: b.IsCurrent, Date: b.Date})
 	}
-
 	return branches, nil
 }
 
-// getGitDiff runs git diff commands and returns the results
+// getGitDiff returns the unstaged and staged changes of the working copy at dir
 func getGitDiff(dir string) (*GitDiffResult, error) {
-	if err := gitrunner.EnsureAvailable(); err != nil {
+	v, err := vcs.For(dir)
+	if err != nil {
 		return nil, err
 	}
-	if err := gitrunner.RevParse("--git-dir").Dir(dir).RunSilent(); err != nil {
-		return nil, fmt.Errorf("not a git repository: %s", dir)
-	}
-
-	result := &GitDiffResult{
-		Files: []DiffFile{},
-	}
-
-	// Get unstaged changes (working tree diff)
-	output, err := gitrunner.Diff().Dir(dir).Output()
+	working, staged, err := v.Diff(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get working tree diff: %v", err)
+		return nil, err
 	}
-	result.WorkingTreeDiff = string(output)
 
-	// Parse unstaged files
-	unstagedFiles := parseGitDiff(string(output), false)
-	result.Files = append(result.Files, unstagedFiles...)
-
-	// Get staged changes
-	output, err = gitrunner.DiffCached().Dir(dir).Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get staged diff: %v", err)
+	result := &GitDiffResult{
+		Files:           []DiffFile{},
+		WorkingTreeDiff: working,
+		StagedDiff:      staged,
 	}
-	result.StagedDiff = string(output)
-
-	// Parse staged files
-	stagedFiles := parseGitDiff(string(output), true)
-	result.Files = append(result.Files, stagedFiles...)
+	result.Files = append(result.Files, parseGitDiff(working, false)...)
+	result.Files = append(result.Files, parseGitDiff(staged, true)...)
 
 	// Count total lines for each file
 	for i := range result.Files {
@@ -1038,23 +1123,32 @@ func parseGitDiff(diffOutput string, isStaged bool) []DiffFile {
 	return files
 }
 
-// rulesDir is the directory containing review rules
-var rulesDir = "rules"
-
-// SetRulesDir sets the directory for review rules
+// SetRulesDir sets the directory of the builtin review rule packs
 func SetRulesDir(dir string) {
-	rulesDir = dir
+	rules.SetBuiltinDir(dir)
 }
 
-// loadReviewRules reads the REVIEW_RULES.md file
-func loadReviewRules() string {
-	rulesFile := rulesDir + "/REVIEW_RULES.md"
-	content, err := os.ReadFile(rulesFile)
+// loadReviewRules returns the rules of the packs that apply to a review of
+// dir, adjusted by the request's selection; see package rules.
+func loadReviewRules(ctx context.Context, dir string, sel rules.Selection) (string, error) {
+	if dir != "" {
+		// the project's own rules are read from dir
+		ok, err := projects.Allowed(ctx, dir)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("directory is outside your projects: %s", dir)
+		}
+	}
+	packs, err := rules.Resolve(tenant.Name(ctx), dir, sel)
 	if err != nil {
-		fmt.Printf("[Review] Warning: Could not read rules file %s: %v\n", rulesFile, err)
-		return ""
+		return "", err
 	}
-	return string(content)
+	if len(packs) == 0 {
+		reviewLog.Warnf("No review rules apply to %s", dir)
+	}
+	return rules.Text(packs), nil
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -1063,74 +1157,49 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// handleChat handles streaming chat requests
-func handleChat(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-		return
-	}
-
-	// Log request for debugging
-	fmt.Printf("[Chat] Request received: provider=%s, model=%s, messages=%d, diffContext=%d bytes\n",
-		req.Provider, req.Model, len(req.Messages), len(req.DiffContext))
-
-	// Get AI config
-	var cfg ai.Config
+// defaultAIConfig returns the configured default provider/model, falling back
+// to the OPENAI_* environment variables when no config is loaded, then to a
+// local Ollama daemon. The result is not Configured if nothing is available.
+func defaultAIConfig() ai.Config {
 	effectiveCfg := getEffectiveAIConfig()
-	if effectiveCfg != nil && req.Provider != "" && req.Model != "" {
-		provider := effectiveCfg.GetProvider(req.Provider)
-		if provider == nil {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unknown provider: %s", req.Provider)})
-			return
-		}
-		cfg = ai.Config{
-			Provider: ai.ProviderOpenAI,
-			APIKey:   provider.APIKey,
-			BaseURL:  provider.BaseURL,
-			Model:    req.Model,
-		}
-	} else if effectiveCfg != nil {
+	var cfg ai.Config
+	if effectiveCfg != nil {
 		baseURL, apiKey, model := effectiveCfg.GetDefaultAIConfig()
+		var providerType string
+		if p := effectiveCfg.GetDefaultProviderConfig(); p != nil {
+			providerType = p.Type
+		}
 		cfg = ai.Config{
-			Provider: ai.ProviderOpenAI,
+			Provider: ai.ResolveProvider(providerType, baseURL),
 			APIKey:   apiKey,
 			BaseURL:  baseURL,
 			Model:    model,
 		}
 	} else {
-		apiKey := os.Getenv(env.EnvOpenAIAPIKey)
-		if apiKey == "" {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key not configured"})
-			return
-		}
 		cfg = ai.Config{
 			Provider: ai.ProviderOpenAI,
-			APIKey:   apiKey,
+			APIKey:   os.Getenv(env.EnvOpenAIAPIKey),
 			Model:    os.Getenv(env.EnvOpenAIModel),
 		}
 		if baseURL := os.Getenv(env.EnvOpenAIBaseURL); baseURL != "" {
 			cfg.BaseURL = baseURL
 		}
 	}
-
-	if cfg.APIKey == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key not configured"})
-		return
+	if !cfg.Configured() {
+		if local, ok := localOllamaConfig(effectiveCfg, ""); ok {
+			return local
+		}
 	}
+	return cfg
+}
 
-	// Build messages with system context
-	rules := loadReviewRules()
-	var systemPrompt string
+// buildReviewSystemPrompt builds the system prompt for reviewing diffContext.
+// When rules is non-empty the model is restricted to reporting rule violations.
+func buildReviewSystemPrompt(diffContext string, rules string) string {
 	if rules != "" {
-		systemPrompt = `You are a code review assistant. Code changes (git diff):
+		return `You are a code review assistant. Code changes (git diff):
 
-` + req.DiffContext + `
+` + diffContext + `
 
 Review rules to check:
 
@@ -1141,14 +1210,80 @@ STRICT RULES:
 - NO "good practices observed", NO "additional observations", NO suggestions beyond the rules
 - Be BRIEF: [file]: [rule violated] - [one-line fix]
 - If no violations, just say "No issues found."`
-	} else {
-		systemPrompt = `You are a code review assistant. Code changes (git diff):
+	}
+	return `You are a code review assistant. Code changes (git diff):
 
-` + req.DiffContext + `
+` + diffContext + `
 
 Be concise and helpful.`
+}
+
+// resolveChatAIConfig picks the provider and model a review request asked
+// for, or the default ones when it names none. The result may not be
+// Configured.
+func resolveChatAIConfig(providerName, model string) (ai.Config, error) {
+	effectiveCfg := getEffectiveAIConfig()
+	var provider *config.ProviderConfig
+	if effectiveCfg != nil && providerName != "" {
+		provider = effectiveCfg.GetProvider(providerName)
+	}
+	switch {
+	case provider != nil && model != "":
+		return ai.Config{
+			Provider: ai.ResolveProvider(provider.Type, provider.BaseURL),
+			APIKey:   provider.APIKey,
+			BaseURL:  provider.BaseURL,
+			Model:    model,
+		}, nil
+	case provider == nil && providerName == localOllamaProvider:
+		cfg, ok := localOllamaConfig(effectiveCfg, model)
+		if !ok {
+			return ai.Config{}, fmt.Errorf("Ollama is not running")
+		}
+		return cfg, nil
+	case provider == nil && effectiveCfg != nil && providerName != "" && model != "":
+		return ai.Config{}, fmt.Errorf("Unknown provider: %s", providerName)
+	default:
+		return defaultAIConfig(), nil
+	}
+}
+
+// handleChat handles streaming chat requests
+func handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Log request for debugging
+	chatLog.Infof("Request received: provider=%s, model=%s, messages=%d, diffContext=%d bytes",
+		req.Provider, req.Model, len(req.Messages), len(req.DiffContext))
+
+	// Get AI config
+	cfg, err := resolveChatAIConfig(req.Provider, req.Model)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !cfg.Configured() {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key not configured"})
+		return
 	}
 
+	// Build messages with system context
+	reviewRules, err := loadReviewRules(r.Context(), resolveDir(r.Context(), req.Dir), req.Rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	systemPrompt := buildReviewSystemPrompt(req.DiffContext, reviewRules)
+
 	messages := []ai.Message{
 		{Role: "system", Content: systemPrompt},
 	}
@@ -1156,6 +1291,20 @@ Be concise and helpful.`
 		messages = append(messages, ai.Message{Role: msg.Role, Content: msg.Content})
 	}
 
+	// An unchanged diff, rules, question and model get the cached answer;
+	// it costs no tokens, so it is served even over quota.
+	cacheKey := ai.CacheKey(cfg, messages)
+	var cached *ai.CachedResponse
+	if !req.NoCache {
+		cached, _ = reviewChatCache.Get(cacheKey)
+	}
+	if cached == nil {
+		if err := quota.CheckAITokens(r.Context()); err != nil {
+			quota.WriteError(w, err)
+			return
+		}
+	}
+
 	// Set up SSE streaming
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -1167,33 +1316,81 @@ Be concise and helpful.`
 		return
 	}
 
-	fmt.Printf("[Chat] Starting stream with model: %s, baseURL: %s\n", cfg.Model, cfg.BaseURL)
-
-	// Stream the response
-	err := ai.CallStream(r.Context(), cfg, messages, func(chunk ai.StreamChunk) error {
+	// parts of a chunked review report progress concurrently
+	var writeMu sync.Mutex
+	sendEvent := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	sendChunk := func(chunk ai.StreamChunk) error {
 		if chunk.Content != "" {
-			data, _ := json.Marshal(map[string]interface{}{
+			sendEvent(map[string]interface{}{
 				"type":    string(chunk.Type),
 				"content": chunk.Content,
 			})
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
 		}
 		return nil
-	})
+	}
+
+	if cached != nil {
+		chatLog.Infof("Serving cached response %s from %s", cacheKey[:12], cached.CreatedAt.Format(time.RFC3339))
+		sendEvent(map[string]interface{}{
+			"type":       "cached",
+			"key":        cacheKey,
+			"created_at": cached.CreatedAt,
+		})
+		err = cached.Replay(sendChunk)
+	} else {
+		chatLog.Infof("Starting stream with model: %s, baseURL: %s", cfg.Model, cfg.BaseURL)
+
+		// Stream the response
+		ctx := ai.WithUsageReporter(r.Context(), func(u ai.TokenUsage) {
+			quota.RecordAITokens(r.Context(), u.TotalTokens)
+		})
+		ctx = withUsageSession(ctx, cfg, aiusage.Session{Kind: aiusage.KindChat, ID: req.SessionID})
+		if !req.NoChunking && len(req.DiffContext) > reviewChunkThreshold {
+			err = streamChunkedReview(ctx, cacheKey, cfg, req.DiffContext, reviewRules, messages[1:], sendEvent, sendChunk)
+		} else {
+			err = reviewChatCache.Stream(ctx, cacheKey, cfg, messages, sendChunk)
+		}
+	}
 
 	if err != nil {
-		fmt.Printf("[Chat] Stream error: %v\n", err)
+		chatLog.Errorf("Stream error: %v", err)
 		data, _ := json.Marshal(map[string]string{"error": err.Error()})
 		fmt.Fprintf(w, "data: %s\n\n", data)
 		flusher.Flush()
 	}
 
-	fmt.Printf("[Chat] Stream completed\n")
+	chatLog.Infof("Stream completed")
 	fmt.Fprintf(w, "data: [DONE]\n\n")
 	flusher.Flush()
 }
 
+// handleChatCache reports (GET) or invalidates (DELETE ?key=..., all
+// entries without key) the review chat cache.
+func handleChatCache(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, reviewChatCache.Stats())
+	case http.MethodDelete:
+		if key := r.URL.Query().Get("key"); key != "" {
+			if !reviewChatCache.Invalidate(key) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "cache entry not found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]int{"removed": 1})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": reviewChatCache.Clear()})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
+
 func handleGenerateCommitMessage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1208,31 +1405,27 @@ func handleGenerateCommitMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := resolveDir(req.Dir)
-	if dir == "" {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to resolve directory"})
-		return
-	}
-
-	sw := sse.NewWriter(w)
-	if sw == nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok {
 		return
 	}
 
-	msg, err := commit_msg.Generate(dir, commit_msg.GenerateOptions{Logger: &sseLogger{sw}})
-	if err != nil {
-		sw.SendError(err.Error())
-		sw.SendDone(nil)
-		return
-	}
-	sw.SendDone(map[string]string{"message": msg})
+	job := jobs.Start("commit-message", fmt.Sprintf("Generate commit message (%s)", filepath.Base(dir)), func(ctx context.Context, j *jobs.Job) error {
+		msg, err := commit_msg.Generate(dir, commit_msg.GenerateOptions{Logger: jobLogger{j}})
+		if err != nil {
+			return err
+		}
+		j.SetResult("message", msg)
+		return nil
+	})
+	jobs.ServeSSE(w, r, job, 0)
 }
 
-type sseLogger struct{ w *sse.Writer }
+// jobLogger adapts a job log to the commit_msg logger.
+type jobLogger struct{ j *jobs.Job }
 
-func (l *sseLogger) Log(msg string)   { l.w.SendLog(msg) }
-func (l *sseLogger) Error(msg string) { l.w.SendError(msg) }
+func (l jobLogger) Log(msg string)   { l.j.Logf("%s", msg) }
+func (l jobLogger) Error(msg string) { l.j.LogErrorf("%s", msg) }
 
 // handleListWorktrees lists all worktrees for a repository
 func handleListWorktrees(w http.ResponseWriter, r *http.Request) {
@@ -1249,7 +1442,11 @@ func handleListWorktrees(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	worktrees, err := projects.GetWorktreesForProject(req.Dir)
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok {
+		return
+	}
+	worktrees, err := projects.ForContext(r.Context()).GetWorktrees(dir)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
@@ -1281,16 +1478,17 @@ func handleCreateWorktree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok || !checkAllowed(w, r, worktreePath(dir, req.Path)) {
+		return
+	}
+
 	args := []string{"worktree", "add"}
 	if req.NewBranch != "" {
 		// Resolve the from-branch to a commit SHA to avoid
 		// "already checked out" errors when the source branch
 		// is currently checked out in another worktree.
-		revParseCmd := exec.Command("git", "rev-parse", req.Branch)
-		if req.Dir != "" {
-			revParseCmd.Dir = req.Dir
-		}
-		commitSHA, revErr := revParseCmd.Output()
+		commitSHA, revErr := gitrunner.RevParse(req.Branch).Dir(dir).Output()
 		if revErr != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{
 				"error": fmt.Sprintf("Failed to resolve branch %q: %v", req.Branch, revErr),
@@ -1301,11 +1499,7 @@ func handleCreateWorktree(w http.ResponseWriter, r *http.Request) {
 	} else {
 		args = append(args, req.Path, req.Branch)
 	}
-	cmd := exec.Command("git", args...)
-	if req.Dir != "" {
-		cmd.Dir = req.Dir
-	}
-	output, err := cmd.CombinedOutput()
+	output, err := gitrunner.NewCommand(args...).Dir(dir).Run()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": fmt.Sprintf("Failed to create worktree: %s", string(output)),
@@ -1341,17 +1535,18 @@ func handleRemoveWorktree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok || !checkAllowed(w, r, worktreePath(dir, req.Path)) {
+		return
+	}
+
 	args := []string{"worktree", "remove"}
 	if req.Force {
 		args = append(args, "--force")
 	}
 	args = append(args, req.Path)
 
-	cmd := exec.Command("git", args...)
-	if req.Dir != "" {
-		cmd.Dir = req.Dir
-	}
-	output, err := cmd.CombinedOutput()
+	output, err := gitrunner.NewCommand(args...).Dir(dir).Run()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": fmt.Sprintf("Failed to remove worktree: %s", string(output)),
@@ -1387,12 +1582,13 @@ func handleMoveWorktree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Git worktree move command: git worktree move <old-path> <new-path>
-	cmd := exec.Command("git", "worktree", "move", req.OldPath, req.NewPath)
-	if req.Dir != "" {
-		cmd.Dir = req.Dir
+	dir, ok := resolveRequestDir(w, r, req.Dir, "")
+	if !ok || !checkAllowed(w, r, worktreePath(dir, req.OldPath)) || !checkAllowed(w, r, worktreePath(dir, req.NewPath)) {
+		return
 	}
-	output, err := cmd.CombinedOutput()
+
+	// Git worktree move command: git worktree move <old-path> <new-path>
+	output, err := gitrunner.NewCommand("worktree", "move", req.OldPath, req.NewPath).Dir(dir).Run()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error": fmt.Sprintf("Failed to move worktree: %s", string(output)),
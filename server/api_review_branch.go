@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+)
+
+// GitBranchRequest is the body of the /api/review/branch/* endpoints
+type GitBranchRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	Name     string `json:"name"` // Branch to create, switch to, delete or merge
+	// StartPoint is where a new branch starts (create; default HEAD).
+	StartPoint string `json:"start_point"`
+	// Checkout switches to the new branch after creating it (create).
+	Checkout bool `json:"checkout"`
+	// Stash stashes uncommitted changes instead of refusing to switch
+	// away from a dirty tree (switch).
+	Stash bool `json:"stash"`
+	// AllMerged deletes every local branch already merged into HEAD,
+	// instead of Name (delete).
+	AllMerged bool `json:"all_merged"`
+}
+
+// handleBranchCreate creates a branch, from HEAD unless start_point is given
+func handleBranchCreate(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeBranchRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := checkBranchName(dir, req.Name); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	start := req.StartPoint
+	if start == "" {
+		start = "HEAD"
+	}
+	if strings.HasPrefix(start, "-") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid start_point: " + start})
+		return
+	}
+	args := []string{"branch", req.Name, start}
+	if req.Checkout {
+		args = []string{"switch", "-c", req.Name, start}
+	}
+	runGitSteps(w, r, dir, "Create branch", [][]string{args}, map[string]string{"branch": req.Name})
+}
+
+// handleBranchSwitch switches to another branch. A tree with uncommitted
+// changes to tracked files is refused with 409 and the dirty files, unless
+// stash is set, in which case the changes are stashed first.
+func handleBranchSwitch(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeBranchRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := checkBranchName(dir, req.Name); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	dirty, err := dirtyTrackedFiles(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	var steps [][]string
+	extra := map[string]string{"branch": req.Name}
+	if len(dirty) > 0 {
+		if !req.Stash {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": "working tree has uncommitted changes; commit them or switch with stash",
+				"dirty": dirty,
+			})
+			return
+		}
+		steps = append(steps, []string{"stash", "push", "-m", "auto-stash before switching to " + req.Name})
+		extra["stashed"] = "true"
+	}
+	steps = append(steps, []string{"switch", req.Name})
+	runGitSteps(w, r, dir, "Switch branch", steps, extra)
+}
+
+// handleBranchDelete deletes a merged branch, or all merged branches.
+// Unmerged branches are refused by git (branch -d).
+func handleBranchDelete(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeBranchRequest(w, r)
+	if !ok {
+		return
+	}
+	var names []string
+	if req.AllMerged {
+		merged, err := mergedBranches(dir)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		names = merged
+	} else {
+		if err := checkBranchName(dir, req.Name); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		names = []string{req.Name}
+	}
+	extra := map[string]string{"deleted": strings.Join(names, "\n")}
+	if len(names) == 0 {
+		runGitSteps(w, r, dir, "Delete branches", nil, extra)
+		return
+	}
+	runGitSteps(w, r, dir, "Delete branches", [][]string{append([]string{"branch", "-d", "--"}, names...)}, extra)
+}
+
+// handleBranchMerge fast-forwards the current branch to another one
+func handleBranchMerge(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeBranchRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := checkBranchName(dir, req.Name); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	runGitSteps(w, r, dir, "Fast-forward merge", [][]string{{"merge", "--ff-only", req.Name}}, map[string]string{"branch": req.Name})
+}
+
+func decodeBranchRequest(w http.ResponseWriter, r *http.Request) (*GitBranchRequest, string, bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return nil, "", false
+	}
+	var req GitBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return nil, "", false
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return nil, "", false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	return &req, dir, true
+}
+
+// checkBranchName rejects empty, option-like and malformed branch names.
+func checkBranchName(dir, name string) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid branch name: %s", name)
+	}
+	if err := gitrunner.NewCommand("check-ref-format", "--branch", name).Dir(dir).RunSilent(); err != nil {
+		return fmt.Errorf("invalid branch name: %s", name)
+	}
+	return nil
+}
+
+// dirtyTrackedFiles lists tracked files with uncommitted changes. Untracked
+// files don't block a switch unless the target branch has them, which git
+// reports itself.
+func dirtyTrackedFiles(dir string) ([]string, error) {
+	out, err := gitrunner.Status("--porcelain", "--untracked-files=no").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status failed: %s", gitErrorMessage(err))
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 3 {
+			files = append(files, line[3:])
+		}
+	}
+	return files, nil
+}
+
+// mergedBranches lists local branches merged into HEAD, except the current one.
+func mergedBranches(dir string) ([]string, error) {
+	out, err := gitrunner.Branch("--merged", "HEAD", "--format=%(HEAD)%(refname:short)").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git branch failed: %s", gitErrorMessage(err))
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "*") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, nil
+}
+
+// runGitSteps runs git commands in order, stopping at the first failure.
+// With Accept: text/event-stream the output is streamed and the done event
+// carries extra; otherwise the combined output is returned as JSON, with a
+// 409 when a command fails.
+func runGitSteps(w http.ResponseWriter, r *http.Request, dir, action string, steps [][]string, extra map[string]string) {
+	if r.Header.Get("Accept") == "text/event-stream" {
+		sseWriter := sse.NewWriter(w)
+		if sseWriter == nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+			return
+		}
+		for _, args := range steps {
+			sseWriter.SendLog(fmt.Sprintf("Running git %s...", strings.Join(args, " ")))
+			if err := sseWriter.StreamCmd(gitrunner.NewCommand(args...).Dir(dir).Exec()); err != nil {
+				sseWriter.SendError(fmt.Sprintf("%s failed: %v", action, err))
+				sseWriter.SendDone(map[string]string{"success": "false"})
+				return
+			}
+		}
+		done := map[string]string{"success": "true"}
+		for k, v := range extra {
+			done[k] = v
+		}
+		sseWriter.SendDone(done)
+		return
+	}
+
+	var output strings.Builder
+	for _, args := range steps {
+		out, err := gitrunner.NewCommand(args...).Dir(dir).Exec().CombinedOutput()
+		output.Write(out)
+		if err != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{
+				"status": "error",
+				"error":  fmt.Sprintf("%s failed: %s", action, strings.TrimSpace(string(out))),
+				"output": output.String(),
+			})
+			return
+		}
+	}
+	result := map[string]string{"status": "ok", "output": output.String()}
+	for k, v := range extra {
+		result[k] = v
+	}
+	writeJSON(w, http.StatusOK, result)
+}
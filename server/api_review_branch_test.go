@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBranchEndpoints(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	git("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(repo, "a"), []byte("a\n"), 0644)
+	git("add", "a")
+	git("commit", "-q", "-m", "base")
+
+	call := func(h http.HandlerFunc, req GitBranchRequest) (int, map[string]interface{}) {
+		t.Helper()
+		req.Dir = repo
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/api/review/branch", bytes.NewReader(body)))
+		var res map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec.Code, res
+	}
+
+	if code, res := call(handleBranchCreate, GitBranchRequest{Name: "feature", Checkout: true}); code != http.StatusOK {
+		t.Fatalf("create: %d %v", code, res)
+	}
+	if cur := git("branch", "--show-current"); cur != "feature" {
+		t.Fatalf("current branch = %q, want feature", cur)
+	}
+	if code, _ := call(handleBranchCreate, GitBranchRequest{Name: "bad..name"}); code != http.StatusBadRequest {
+		t.Errorf("create invalid name: %d", code)
+	}
+	if code, _ := call(handleBranchCreate, GitBranchRequest{Name: "-f"}); code != http.StatusBadRequest {
+		t.Errorf("create option-like name: %d", code)
+	}
+
+	os.WriteFile(filepath.Join(repo, "a"), []byte("a\nb\n"), 0644)
+	git("commit", "-q", "-am", "feature work")
+
+	// dirty tree blocks the switch unless stashing
+	os.WriteFile(filepath.Join(repo, "a"), []byte("dirty\n"), 0644)
+	code, res := call(handleBranchSwitch, GitBranchRequest{Name: "main"})
+	if code != http.StatusConflict || len(res["dirty"].([]interface{})) != 1 {
+		t.Fatalf("switch dirty: %d %v", code, res)
+	}
+	if code, res := call(handleBranchSwitch, GitBranchRequest{Name: "main", Stash: true}); code != http.StatusOK || res["stashed"] != "true" {
+		t.Fatalf("switch with stash: %d %v", code, res)
+	}
+	if list := git("stash", "list"); !strings.Contains(list, "auto-stash before switching to main") {
+		t.Errorf("stash list = %q", list)
+	}
+
+	// an unmerged branch is not deleted
+	if code, _ := call(handleBranchDelete, GitBranchRequest{Name: "feature"}); code != http.StatusConflict {
+		t.Errorf("delete unmerged: %d", code)
+	}
+	if code, res := call(handleBranchMerge, GitBranchRequest{Name: "feature"}); code != http.StatusOK {
+		t.Fatalf("merge: %d %v", code, res)
+	}
+	git("branch", "old", "HEAD~1")
+	if code, res := call(handleBranchDelete, GitBranchRequest{AllMerged: true}); code != http.StatusOK || res["deleted"] != "feature\nold" {
+		t.Fatalf("delete merged: %d %v", code, res)
+	}
+	if branches := git("branch", "--format=%(refname:short)"); branches != "main" {
+		t.Errorf("branches left = %q", branches)
+	}
+}
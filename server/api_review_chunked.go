@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+)
+
+// reviewChunkThreshold is the diff size above which the review chat reviews
+// the diff in parts instead of sending it in one prompt.
+const reviewChunkThreshold = 96 * 1024
+
+// reviewChunkSize caps the diff text of one part; a var so tests can
+// shrink it.
+var reviewChunkSize = 48 * 1024
+
+// reviewChunkParallelism bounds how many parts are reviewed at once.
+const reviewChunkParallelism = 3
+
+// diffChunk is one part of a large diff: whole files where possible, hunks
+// of one file when the file alone exceeds the part size.
+type diffChunk struct {
+	Files []string
+	Diff  string
+}
+
+// chunkDiff splits diff into parts of at most maxBytes, packing whole files
+// together. A file larger than maxBytes is split at hunk boundaries with its
+// header repeated; a single hunk larger than maxBytes is truncated.
+func chunkDiff(diff string, maxBytes int) []diffChunk {
+	var chunks []diffChunk
+	var cur diffChunk
+	var size int
+	flush := func() {
+		if size > 0 {
+			chunks = append(chunks, cur)
+		}
+		cur, size = diffChunk{}, 0
+	}
+	add := func(path, text string) {
+		if size > 0 && size+len(text) > maxBytes {
+			flush()
+		}
+		if len(cur.Files) == 0 || cur.Files[len(cur.Files)-1] != path {
+			cur.Files = append(cur.Files, path)
+		}
+		cur.Diff += text
+		size += len(text)
+	}
+
+	for _, f := range splitDiffFiles(diff) {
+		if len(f.diff) <= maxBytes {
+			add(f.path, f.diff)
+			continue
+		}
+		header, hunks, err := splitDiffHunks(f.diff)
+		if err != nil || len(hunks) == 0 {
+			add(f.path, truncateDiff(f.diff, maxBytes))
+			continue
+		}
+		// each part of a split file gets the header again so the model
+		// knows which file it is looking at
+		flush()
+		part := header
+		for _, h := range hunks {
+			if len(part) > len(header) && len(part)+len(h) > maxBytes {
+				add(f.path, part)
+				flush()
+				part = header
+			}
+			part += truncateDiff(h, maxBytes-len(header))
+		}
+		add(f.path, part)
+		flush()
+	}
+	flush()
+	return chunks
+}
+
+type diffFileText struct {
+	path string
+	diff string
+}
+
+// splitDiffFiles splits a multi-file diff at its "diff --git" lines. Text
+// before the first file is kept as a part of its own.
+func splitDiffFiles(diff string) []diffFileText {
+	var files []diffFileText
+	var cur *diffFileText
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			// "diff --git a/<path> b/<path>"; paths may contain spaces
+			path := strings.TrimSpace(strings.TrimPrefix(line, "diff --git "))
+			if i := strings.LastIndex(path, " b/"); i >= 0 {
+				path = path[i+len(" b/"):]
+			}
+			files = append(files, diffFileText{path: path})
+			cur = &files[len(files)-1]
+		} else if cur == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			files = append(files, diffFileText{})
+			cur = &files[len(files)-1]
+		}
+		cur.diff += line
+	}
+	return files
+}
+
+func truncateDiff(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	const note = "\n... (truncated)\n"
+	cut := maxBytes - len(note)
+	if cut < 0 {
+		cut = 0
+	}
+	if i := strings.LastIndexByte(text[:cut], '\n'); i >= 0 {
+		cut = i
+	}
+	return text[:cut] + note
+}
+
+// chunkProgress is a progress event of a chunked review, sent to the chat
+// client as {"type":"progress",...}.
+type chunkProgress struct {
+	Type    string   `json:"type"`
+	Stage   string   `json:"stage"` // "split", "part" or "synthesize"
+	Part    int      `json:"part,omitempty"`
+	Parts   int      `json:"parts"`
+	Files   []string `json:"files,omitempty"`
+	Status  string   `json:"status,omitempty"` // for "part": "started", "done" or "failed"
+	Error   string   `json:"error,omitempty"`
+	Message string   `json:"message"`
+}
+
+// reviewChunks reviews each chunk with the conversation as the question and
+// returns the answers in chunk order. A failed part is returned as a note
+// rather than failing the review; only when every part fails is the first
+// error returned.
+func reviewChunks(ctx context.Context, cfg ai.Config, chunks []diffChunk, rules string, conversation []ai.Message, progress func(chunkProgress)) ([]string, error) {
+	parallelism := reviewChunkParallelism
+	if cfg.Provider == ai.ProviderOllama {
+		// a local model serves one request at a time anyway
+		parallelism = 1
+	}
+	results := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			p := chunkProgress{Type: "progress", Stage: "part", Part: i + 1, Parts: len(chunks), Files: c.Files}
+			p.Status, p.Message = "started", fmt.Sprintf("Reviewing part %d/%d (%s)", i+1, len(chunks), describeFiles(c.Files))
+			progress(p)
+
+			messages := append([]ai.Message{{Role: "system", Content: buildReviewSystemPrompt(c.Diff, rules)}}, conversation...)
+			out, err := ai.CallCompletion(ctx, cfg, messages)
+			if err != nil {
+				errs[i] = err
+				p.Status, p.Error, p.Message = "failed", err.Error(), fmt.Sprintf("Part %d/%d failed: %v", i+1, len(chunks), err)
+				progress(p)
+				return
+			}
+			results[i] = strings.TrimSpace(out)
+			p.Status, p.Message = "done", fmt.Sprintf("Reviewed part %d/%d", i+1, len(chunks))
+			progress(p)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+		results[i] = fmt.Sprintf("(review of this part failed: %v)", err)
+	}
+	if failed == len(chunks) {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+func describeFiles(files []string) string {
+	switch len(files) {
+	case 0:
+		return "diff header"
+	case 1:
+		return files[0]
+	default:
+		return fmt.Sprintf("%s and %d more", files[0], len(files)-1)
+	}
+}
+
+// buildSynthesisPrompt is the system prompt that merges the per-part
+// reviews of a chunked review into one answer.
+func buildSynthesisPrompt(chunks []diffChunk, reviews []string, rules string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are a code review assistant. The code changes were too large to review at once, so they were split into %d parts and each part was answered separately. The answers per part are below.\n\n", len(chunks))
+	for i, c := range chunks {
+		fmt.Fprintf(&b, "## Part %d/%d: %s\n\n%s\n\n", i+1, len(chunks), strings.Join(c.Files, ", "), reviews[i])
+	}
+	b.WriteString("Combine them into one answer to the user's last message. Merge duplicates, keep file names, drop parts with nothing to report, and do not mention the split.")
+	if rules != "" {
+		b.WriteString(`
+
+STRICT RULES:
+- ONLY report rule violations, nothing else
+- Be BRIEF: [file]: [rule violated] - [one-line fix]
+- If no part found violations, just say "No issues found."`)
+	}
+	return b.String()
+}
+
+// streamChunkedReview answers the chat for a diff too large for one prompt:
+// it splits the diff into parts, reviews them (reporting progress through
+// sendEvent), then streams a synthesis of the part answers through
+// sendChunk. The synthesis is cached under key, the key of the unchunked
+// request, so asking again is answered from the cache.
+func streamChunkedReview(ctx context.Context, key string, cfg ai.Config, diff string, rules string, conversation []ai.Message, sendEvent func(interface{}), sendChunk ai.StreamCallback) error {
+	chunks := chunkDiff(diff, reviewChunkSize)
+	chatLog.Infof("Diff of %d bytes split into %d parts", len(diff), len(chunks))
+	sendEvent(chunkProgress{
+		Type:    "progress",
+		Stage:   "split",
+		Parts:   len(chunks),
+		Message: fmt.Sprintf("Large diff (%d KB): reviewing in %d parts", len(diff)/1024, len(chunks)),
+	})
+
+	reviews, err := reviewChunks(ctx, cfg, chunks, rules, conversation, func(p chunkProgress) { sendEvent(p) })
+	if err != nil {
+		return err
+	}
+
+	sendEvent(chunkProgress{Type: "progress", Stage: "synthesize", Parts: len(chunks), Message: "Combining the reviews"})
+	messages := append([]ai.Message{{Role: "system", Content: buildSynthesisPrompt(chunks, reviews, rules)}}, conversation...)
+	return reviewChatCache.Stream(ctx, key, cfg, messages, sendChunk)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func fileDiff(path string, hunks int, hunkLines int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\nindex 1..2 100644\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	for h := 0; h < hunks; h++ {
+		fmt.Fprintf(&b, "@@ -%d,1 +%d,%d @@\n", h*100+1, h*100+1, hunkLines)
+		for i := 0; i < hunkLines; i++ {
+			fmt.Fprintf(&b, "+line %d of hunk %d\n", i, h)
+		}
+	}
+	return b.String()
+}
+
+func TestChunkDiff(t *testing.T) {
+	small1, small2 := fileDiff("a.go", 1, 5), fileDiff("b.go", 1, 5)
+	big := fileDiff("big.go", 4, 20)
+	diff := small1 + small2 + big
+	maxBytes := len(small1) + len(small2) + 10
+
+	chunks := chunkDiff(diff, maxBytes)
+	if len(chunks) < 3 {
+		t.Fatalf("got %d chunks, want the small files together and big.go split", len(chunks))
+	}
+	if got := strings.Join(chunks[0].Files, ","); got != "a.go,b.go" || chunks[0].Diff != small1+small2 {
+		t.Errorf("first chunk files %s", got)
+	}
+	hunks := 0
+	for _, c := range chunks[1:] {
+		if len(c.Diff) > maxBytes {
+			t.Errorf("chunk of %d bytes exceeds %d", len(c.Diff), maxBytes)
+		}
+		if len(c.Files) != 1 || c.Files[0] != "big.go" || !strings.HasPrefix(c.Diff, "diff --git a/big.go b/big.go\n") {
+			t.Errorf("split part lacks the file header: %v %q", c.Files, c.Diff[:40])
+		}
+		hunks += strings.Count(c.Diff, "\n@@ ")
+	}
+	if hunks != 4 {
+		t.Errorf("split parts hold %d hunks, want 4", hunks)
+	}
+
+	// one hunk alone over the limit is truncated
+	huge := fileDiff("huge.go", 1, 200)
+	chunks = chunkDiff(huge, 1024)
+	if len(chunks) != 1 || len(chunks[0].Diff) > 1024 || !strings.Contains(chunks[0].Diff, "(truncated)") {
+		t.Errorf("huge hunk: %d chunks, %d bytes", len(chunks), len(chunks[0].Diff))
+	}
+}
+
+func TestSplitDiffFilesKeepsPreamble(t *testing.T) {
+	files := splitDiffFiles("Staged changes:\n" + fileDiff("a b.go", 1, 1))
+	if len(files) != 2 || files[0].path != "" || files[1].path != "a b.go" {
+		t.Errorf("files = %+v", files)
+	}
+}
+
+func TestStreamChunkedReview(t *testing.T) {
+	useTempAIUsage(t)
+	fileRe := regexp.MustCompile(`diff --git a/(\S+)`)
+	var mu sync.Mutex
+	var synthesisPrompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []ai.Message `json:"messages"`
+			Stream   bool         `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		system := req.Messages[0].Content
+		if req.Stream {
+			mu.Lock()
+			synthesisPrompt = system
+			mu.Unlock()
+			fmt.Fprintln(w, `{"message":{"content":"combined"}}`)
+			fmt.Fprintln(w, `{"done":true,"prompt_eval_count":5,"eval_count":1}`)
+			return
+		}
+		var found []string
+		for _, m := range fileRe.FindAllStringSubmatch(system, -1) {
+			found = append(found, m[1])
+		}
+		if strings.Contains(strings.Join(found, ","), "bad.go") {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]string{"content": "issues in " + strings.Join(found, ",")},
+			"done":    true,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	saved := reviewChatCache
+	reviewChatCache = ai.NewCache(t.TempDir(), time.Hour)
+	t.Cleanup(func() { reviewChatCache = saved })
+
+	cfg := ai.Config{Provider: ai.ProviderOllama, BaseURL: srv.URL, Model: "m"}
+	diff := fileDiff("a.go", 1, 50) + fileDiff("bad.go", 1, 50) + fileDiff("c.go", 1, 50)
+	conversation := []ai.Message{{Role: "user", Content: "Review"}}
+	key := ai.CacheKey(cfg, conversation)
+
+	savedSize := reviewChunkSize
+	reviewChunkSize = len(fileDiff("a.go", 1, 50)) + 10 // one file per part
+	t.Cleanup(func() { reviewChunkSize = savedSize })
+
+	var events []chunkProgress
+	var content string
+	err := streamChunkedReview(context.Background(), key, cfg, diff, "", conversation,
+		func(v interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, v.(chunkProgress))
+		},
+		func(c ai.StreamChunk) error { content += c.Content; return nil })
+	if err != nil || content != "combined" {
+		t.Fatalf("err %v, content %q", err, content)
+	}
+
+	parts := 0
+	for _, e := range events {
+		if e.Stage == "part" && e.Status != "started" {
+			parts++
+		}
+	}
+	if parts != 3 {
+		t.Errorf("%d parts finished, want 3", parts)
+	}
+	if events[0].Stage != "split" || events[len(events)-1].Stage != "synthesize" {
+		t.Errorf("events = %+v", events)
+	}
+	if !strings.Contains(synthesisPrompt, "review of this part failed") {
+		t.Errorf("synthesis prompt lacks the failed part:\n%s", synthesisPrompt)
+	}
+	if _, ok := reviewChatCache.Get(key); !ok {
+		t.Error("synthesis not cached under the request key")
+	}
+}
+
+// useTempAIUsage keeps the AI calls of a test from recording usage to the
+// real data directory.
+func useTempAIUsage(t *testing.T) {
+	t.Helper()
+	aiusage.SetFile(filepath.Join(t.TempDir(), "usage.json"))
+	t.Cleanup(func() { aiusage.SetFile(config.AIUsageFile) })
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+)
+
+// GitConflictsRequest is the body of /api/review/conflicts and
+// /api/review/merge-continue
+type GitConflictsRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	// Message is the merge commit message, for merge-continue of a merge;
+	// empty keeps git's prepared message.
+	Message string `json:"message,omitempty"`
+}
+
+// ConflictVersion is one side of a conflicted file, from the index stages
+type ConflictVersion struct {
+	SHA     string `json:"sha"`
+	Mode    string `json:"mode"`
+	Content string `json:"content,omitempty"` // Omitted for binary files
+}
+
+// ConflictFile is a conflicted path with its base, ours and theirs versions.
+// A nil version means the file does not exist on that side (e.g. deleted).
+// During a rebase "ours" is the branch being rebased onto and "theirs" the
+// commit being replayed.
+type ConflictFile struct {
+	Path    string           `json:"path"`
+	Base    *ConflictVersion `json:"base"`
+	Ours    *ConflictVersion `json:"ours"`
+	Theirs  *ConflictVersion `json:"theirs"`
+	Working string           `json:"working,omitempty"` // Work tree content with conflict markers
+	Binary  bool             `json:"binary,omitempty"`
+}
+
+// GitConflictsResult lists the conflicts of the operation in progress
+type GitConflictsResult struct {
+	// Operation is "merge", "rebase", "cherry-pick", "revert", or empty
+	// when none is in progress.
+	Operation string         `json:"operation"`
+	Files     []ConflictFile `json:"files"`
+}
+
+// ConflictResolution resolves one conflicted file
+type ConflictResolution struct {
+	Path string `json:"path"`
+	// Resolution is "ours", "theirs", "manual" (use Content) or "delete".
+	Resolution string `json:"resolution"`
+	Content    string `json:"content,omitempty"`
+}
+
+// GitResolveRequest is the body of /api/review/conflicts/resolve
+type GitResolveRequest struct {
+	Dir      string               `json:"dir"`
+	Worktree string               `json:"worktree"`
+	Files    []ConflictResolution `json:"files"`
+}
+
+// handleGitConflicts lists the conflicted files of a stopped merge, rebase,
+// cherry-pick or revert with the content of each side
+func handleGitConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req GitConflictsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	files, err := listConflicts(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	for i := range files {
+		loadConflictContent(dir, &files[i])
+	}
+	writeJSON(w, http.StatusOK, GitConflictsResult{Operation: conflictOperation(dir), Files: files})
+}
+
+// handleGitResolve applies per-file resolutions and stages the results
+func handleGitResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req GitResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if len(req.Files) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "files is required"})
+		return
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	conflicts, err := listConflicts(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	byPath := make(map[string]ConflictFile, len(conflicts))
+	for _, f := range conflicts {
+		byPath[f.Path] = f
+	}
+	// validate everything first so a bad entry leaves the index untouched
+	for _, res := range req.Files {
+		if _, ok := byPath[res.Path]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "not a conflicted file: " + res.Path})
+			return
+		}
+		switch res.Resolution {
+		case "ours", "theirs", "manual", "delete":
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf(`%s: resolution must be "ours", "theirs", "manual" or "delete"`, res.Path)})
+			return
+		}
+	}
+
+	for _, res := range req.Files {
+		if err := resolveConflict(dir, byPath[res.Path], res); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("%s: %v", res.Path, err)})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"remaining": unmergedFiles(dir),
+	})
+}
+
+// handleGitMergeContinue completes the stopped operation once every conflict
+// is resolved. With Accept: text/event-stream git's output is streamed; a
+// rebase may stop again at a later commit, reported as in_progress.
+func handleGitMergeContinue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req GitConflictsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	op := conflictOperation(dir)
+	if op == "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "no merge, rebase, cherry-pick or revert in progress"})
+		return
+	}
+	if remaining := unmergedFiles(dir); len(remaining) > 0 {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "resolve all conflicts first",
+			"remaining": remaining,
+		})
+		return
+	}
+	var args []string
+	switch op {
+	case "merge":
+		args = []string{"commit", "--no-verify"}
+		if req.Message != "" {
+			args = append(args, "-m", req.Message)
+		} else {
+			args = append(args, "--no-edit")
+		}
+	default:
+		args = []string{op, "--continue"}
+	}
+	// Never open an editor: keep the prepared messages
+	cmd := gitrunner.NewCommand(args...).Dir(dir).WithEnv("GIT_EDITOR", "true").Exec()
+
+	if r.Header.Get("Accept") == "text/event-stream" {
+		sseWriter := sse.NewWriter(w)
+		if sseWriter == nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+			return
+		}
+		sseWriter.SendLog(fmt.Sprintf("Running git %s...", strings.Join(args, " ")))
+		runErr := sseWriter.StreamCmd(cmd)
+		next := conflictOperation(dir)
+		done := map[string]string{
+			"success":     strconv.FormatBool(runErr == nil),
+			"operation":   op,
+			"in_progress": strconv.FormatBool(next != ""),
+		}
+		if conflicts := unmergedFiles(dir); len(conflicts) > 0 {
+			done["conflicts"] = strings.Join(conflicts, "\n")
+		}
+		if runErr != nil {
+			sseWriter.SendError(fmt.Sprintf("Continue %s failed: %v", op, runErr))
+		}
+		sseWriter.SendDone(done)
+		return
+	}
+
+	output, runErr := cmd.CombinedOutput()
+	status := http.StatusOK
+	result := map[string]interface{}{
+		"status":      "ok",
+		"output":      string(output),
+		"operation":   op,
+		"in_progress": conflictOperation(dir) != "",
+		"conflicts":   unmergedFiles(dir),
+	}
+	if runErr != nil {
+		status = http.StatusConflict
+		result["status"] = "error"
+		result["error"] = fmt.Sprintf("Continue %s failed: %s", op, strings.TrimSpace(string(output)))
+	}
+	writeJSON(w, status, result)
+}
+
+// conflictOperation returns the operation stopped in dir, or "".
+func conflictOperation(dir string) string {
+	markers := []struct{ path, op string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+	}
+	for _, m := range markers {
+		out, err := gitrunner.RevParse("--git-path", m.path).Dir(dir).Output()
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSpace(string(out))
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if _, err := os.Stat(p); err == nil {
+			return m.op
+		}
+	}
+	return ""
+}
+
+// listConflicts reads the unmerged index entries: stage 1 is the base,
+// 2 ours and 3 theirs.
+func listConflicts(dir string) ([]ConflictFile, error) {
+	out, err := gitrunner.NewCommand("ls-files", "-u", "-z").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %s", gitErrorMessage(err))
+	}
+	return parseUnmergedEntries(string(out)), nil
+}
+
+// parseUnmergedEntries parses `git ls-files -u -z` output, lines of
+// "<mode> <sha> <stage>\t<path>", keeping the order of first appearance.
+func parseUnmergedEntries(out string) []ConflictFile {
+	files := []ConflictFile{}
+	index := map[string]int{}
+	for _, entry := range strings.Split(out, "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 {
+			continue
+		}
+		i, seen := index[path]
+		if !seen {
+			i = len(files)
+			index[path] = i
+			files = append(files, ConflictFile{Path: path})
+		}
+		v := &ConflictVersion{Mode: fields[0], SHA: fields[1]}
+		switch fields[2] {
+		case "1":
+			files[i].Base = v
+		case "2":
+			files[i].Ours = v
+		case "3":
+			files[i].Theirs = v
+		}
+	}
+	return files
+}
+
+// loadConflictContent fills in the text of every side of f and of the work
+// tree file, or marks f binary.
+func loadConflictContent(dir string, f *ConflictFile) {
+	for _, v := range []*ConflictVersion{f.Base, f.Ours, f.Theirs} {
+		if v == nil {
+			continue
+		}
+		blob, err := gitrunner.NewCommand("cat-file", "blob", v.SHA).Dir(dir).Output()
+		if err != nil {
+			continue
+		}
+		if bytes.IndexByte(blob, 0) >= 0 {
+			f.Binary = true
+		}
+		v.Content = string(blob)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, f.Path)); err == nil {
+		if bytes.IndexByte(data, 0) >= 0 {
+			f.Binary = true
+		}
+		f.Working = string(data)
+	}
+	if f.Binary {
+		for _, v := range []*ConflictVersion{f.Base, f.Ours, f.Theirs} {
+			if v != nil {
+				v.Content = ""
+			}
+		}
+		f.Working = ""
+	}
+}
+
+// resolveConflict writes the chosen version of a conflicted file and stages it
+func resolveConflict(dir string, f ConflictFile, res ConflictResolution) error {
+	var side *ConflictVersion
+	switch res.Resolution {
+	case "ours":
+		side = f.Ours
+	case "theirs":
+		side = f.Theirs
+	case "manual":
+		if err := os.WriteFile(filepath.Join(dir, f.Path), []byte(res.Content), 0644); err != nil {
+			return err
+		}
+		return gitrunner.NewCommand("add", "--", f.Path).Dir(dir).RunSilent()
+	}
+	if side == nil {
+		// "delete", or the chosen side deleted the file
+		return gitrunner.NewCommand("rm", "--quiet", "--force", "--", f.Path).Dir(dir).RunSilent()
+	}
+	if err := gitrunner.NewCommand("checkout", "--"+res.Resolution, "--", f.Path).Dir(dir).RunSilent(); err != nil {
+		return err
+	}
+	return gitrunner.NewCommand("add", "--", f.Path).Dir(dir).RunSilent()
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseUnmergedEntries(t *testing.T) {
+	out := "100644 aaa 1\tboth.txt\x00100644 bbb 2\tboth.txt\x00100644 ccc 3\tboth.txt\x00" +
+		"100644 ddd 1\tgone.txt\x00100644 eee 3\tgone.txt\x00"
+	files := parseUnmergedEntries(out)
+	if len(files) != 2 {
+		t.Fatalf("got %d files", len(files))
+	}
+	if f := files[0]; f.Path != "both.txt" || f.Base.SHA != "aaa" || f.Ours.SHA != "bbb" || f.Theirs.SHA != "ccc" {
+		t.Errorf("both.txt = %+v", f)
+	}
+	if f := files[1]; f.Path != "gone.txt" || f.Ours != nil || f.Theirs.SHA != "eee" {
+		t.Errorf("gone.txt = %+v", f)
+	}
+}
+
+func TestConflictEndpoints(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		return strings.TrimSpace(string(out)), err
+	}
+	mustGit := func(args ...string) string {
+		t.Helper()
+		out, err := git(args...)
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return out
+	}
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(repo, name), []byte(content), 0644)
+	}
+	mustGit("init", "-q", "-b", "main")
+	write("a.txt", "base\n")
+	write("b.txt", "base\n")
+	mustGit("add", ".")
+	mustGit("commit", "-q", "-m", "base")
+	mustGit("checkout", "-q", "-b", "feature")
+	write("a.txt", "feature\n")
+	write("b.txt", "feature\n")
+	mustGit("commit", "-q", "-am", "feature")
+	mustGit("checkout", "-q", "main")
+	write("a.txt", "main\n")
+	write("b.txt", "main\n")
+	mustGit("commit", "-q", "-am", "main")
+	if _, err := git("merge", "feature"); err == nil {
+		t.Fatal("merge should conflict")
+	}
+
+	call := func(h http.HandlerFunc, req interface{}, out interface{}) int {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/api/review/conflicts", bytes.NewReader(body)))
+		if out != nil {
+			json.Unmarshal(rec.Body.Bytes(), out)
+		}
+		return rec.Code
+	}
+
+	var list GitConflictsResult
+	if code := call(handleGitConflicts, GitConflictsRequest{Dir: repo}, &list); code != http.StatusOK {
+		t.Fatalf("conflicts: %d", code)
+	}
+	if list.Operation != "merge" || len(list.Files) != 2 {
+		t.Fatalf("conflicts = %+v", list)
+	}
+	a := list.Files[0]
+	if a.Path != "a.txt" || a.Base.Content != "base\n" || a.Ours.Content != "main\n" || a.Theirs.Content != "feature\n" || !strings.Contains(a.Working, "<<<<<<<") {
+		t.Errorf("a.txt = %+v", a)
+	}
+
+	// continuing with unresolved files is refused
+	if code := call(handleGitMergeContinue, GitConflictsRequest{Dir: repo}, nil); code != http.StatusConflict {
+		t.Errorf("continue unresolved: %d", code)
+	}
+	if code := call(handleGitResolve, GitResolveRequest{Dir: repo, Files: []ConflictResolution{{Path: "c.txt", Resolution: "ours"}}}, nil); code != http.StatusBadRequest {
+		t.Errorf("resolve unknown file: %d", code)
+	}
+
+	var resolved struct {
+		Remaining []string `json:"remaining"`
+	}
+	code := call(handleGitResolve, GitResolveRequest{Dir: repo, Files: []ConflictResolution{
+		{Path: "a.txt", Resolution: "theirs"},
+		{Path: "b.txt", Resolution: "manual", Content: "merged\n"},
+	}}, &resolved)
+	if code != http.StatusOK || len(resolved.Remaining) != 0 {
+		t.Fatalf("resolve: %d %+v", code, resolved)
+	}
+
+	if code := call(handleGitMergeContinue, GitConflictsRequest{Dir: repo, Message: "merge feature"}, nil); code != http.StatusOK {
+		t.Fatalf("continue: %d", code)
+	}
+	if msg := mustGit("log", "-1", "--format=%s%n%P"); !strings.HasPrefix(msg, "merge feature\n") || len(strings.Fields(msg)) != 4 {
+		t.Errorf("merge commit = %q", msg)
+	}
+	if got := mustGit("show", "HEAD:a.txt") + "|" + mustGit("show", "HEAD:b.txt"); got != "feature|merged" {
+		t.Errorf("merged content = %q", got)
+	}
+}
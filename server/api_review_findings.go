@@ -0,0 +1,473 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+	"github.com/xhd2015/ai-critic/server/quota"
+	"github.com/xhd2015/ai-critic/server/rules"
+)
+
+// Finding severities, most severe first.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// ReviewFinding is one issue the model found, anchored to lines of the new
+// version of a file so it can be shown inline on the diff.
+type ReviewFinding struct {
+	File       string `json:"file"`
+	StartLine  int    `json:"startLine"` // 0 for a finding about the whole file
+	EndLine    int    `json:"endLine"`
+	Rule       string `json:"rule,omitempty"`
+	Severity   string `json:"severity"` // "error", "warning" or "info"
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+	// InDiff reports whether the lines fall inside a hunk of the diff, i.e.
+	// whether the finding can be drawn next to a changed line.
+	InDiff bool `json:"inDiff"`
+}
+
+// FindingsRequest asks for structured findings on a diff. Without
+// DiffContext the uncommitted changes of Dir are reviewed.
+type FindingsRequest struct {
+	Dir         string `json:"dir"`
+	DiffContext string `json:"diffContext"`
+	Provider    string `json:"provider"`
+	Model       string `json:"model"`
+	SessionID   string `json:"sessionId"`
+	NoCache     bool   `json:"noCache"`
+	// Rules turns rule packs on or off for this request.
+	Rules rules.Selection `json:"rules"`
+}
+
+// FindingsResult is the response of /api/review/findings.
+type FindingsResult struct {
+	Findings []ReviewFinding `json:"findings"`
+	Model    string          `json:"model"`
+	Parts    int             `json:"parts"` // how many prompts the diff took
+	Cached   bool            `json:"cached"`
+	// Repaired is set when the model's JSON had to be fixed up or
+	// re-requested before it could be read.
+	Repaired bool `json:"repaired"`
+	// Dropped counts findings discarded as unusable: no message, or a file
+	// that is not in the diff.
+	Dropped int `json:"dropped"`
+}
+
+// handleReviewFindings asks the model for findings as JSON instead of
+// free-form text:
+//
+//	POST /api/review/findings {dir, diffContext, provider, model, sessionId, noCache, rules} -> FindingsResult
+func handleReviewFindings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req FindingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	cfg, err := resolveChatAIConfig(req.Provider, req.Model)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !cfg.Configured() {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key not configured"})
+		return
+	}
+
+	diff := req.DiffContext
+	if diff == "" {
+		dir, ok := resolveRequestDir(w, r, req.Dir, "")
+		if !ok {
+			return
+		}
+		result, err := getGitDiff(dir)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		untracked, _ := untrackedFilesDiff(dir)
+		diff = result.StagedDiff + result.WorkingTreeDiff + untracked
+	}
+	if strings.TrimSpace(diff) == "" {
+		writeJSON(w, http.StatusOK, FindingsResult{Findings: []ReviewFinding{}, Model: cfg.Model})
+		return
+	}
+
+	reviewRules, err := loadReviewRules(r.Context(), resolveDir(r.Context(), req.Dir), req.Rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	key := ai.CacheKey(cfg, findingsMessages(diff, reviewRules))
+	if !req.NoCache {
+		if cached, ok := reviewChatCache.Get(key); ok {
+			var res FindingsResult
+			if json.Unmarshal([]byte(cached.Content), &res) == nil {
+				res.Cached = true
+				writeJSON(w, http.StatusOK, res)
+				return
+			}
+		}
+	}
+	if err := quota.CheckAITokens(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
+
+	ctx := ai.WithUsageReporter(r.Context(), func(u ai.TokenUsage) {
+		quota.RecordAITokens(r.Context(), u.TotalTokens)
+	})
+	ctx = withUsageSession(ctx, cfg, aiusage.Session{Kind: aiusage.KindFindings, ID: req.SessionID, Project: req.Dir})
+	res, err := reviewFindings(ctx, cfg, diff, reviewRules)
+	if err != nil {
+		reviewLog.Errorf("Findings failed: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if data, err := json.Marshal(res); err == nil {
+		reviewChatCache.Put(&ai.CachedResponse{Key: key, Provider: cfg.Provider, Model: cfg.Model, CreatedAt: time.Now(), Content: string(data)})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// reviewFindings asks for the findings of diff, one prompt per part when
+// the diff is too large for one, and validates them against the diff.
+func reviewFindings(ctx context.Context, cfg ai.Config, diff string, rules string) (*FindingsResult, error) {
+	parts := []string{diff}
+	if len(diff) > reviewChunkThreshold {
+		parts = nil
+		for _, c := range chunkDiff(diff, reviewChunkSize) {
+			parts = append(parts, c.Diff)
+		}
+	}
+
+	res := &FindingsResult{Model: cfg.Model, Parts: len(parts)}
+	var raw []rawFinding
+	for i, part := range parts {
+		items, repaired, err := askFindings(ctx, cfg, part, rules)
+		if err != nil {
+			if len(parts) == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("part %d/%d: %w", i+1, len(parts), err)
+		}
+		raw = append(raw, items...)
+		res.Repaired = res.Repaired || repaired
+	}
+	res.Findings, res.Dropped = normalizeFindings(raw, diffLineAnchors(diff))
+	return res, nil
+}
+
+// askFindings asks the model for the findings of one diff. An answer that
+// cannot be read as findings even after repair is sent back once with a
+// request to convert it.
+func askFindings(ctx context.Context, cfg ai.Config, diff string, rules string) ([]rawFinding, bool, error) {
+	out, err := ai.CallCompletion(ctx, cfg, findingsMessages(diff, rules))
+	if err != nil {
+		return nil, false, err
+	}
+	items, repaired, err := parseFindingsJSON(out)
+	if err == nil {
+		return items, repaired, nil
+	}
+	reviewLog.Warnf("Findings answer is not valid JSON (%v), asking the model to convert it", err)
+
+	fixed, err := ai.CallCompletion(ctx, cfg, []ai.Message{
+		{Role: "system", Content: "Convert the code review below into JSON. " + findingsFormat},
+		{Role: "user", Content: out},
+	})
+	if err != nil {
+		return nil, true, err
+	}
+	items, _, err = parseFindingsJSON(fixed)
+	if err != nil {
+		return nil, true, fmt.Errorf("model did not return findings as JSON: %v", err)
+	}
+	return items, true, nil
+}
+
+// findingsFormat describes the JSON the model must answer with.
+const findingsFormat = `Answer with JSON only, no prose and no code fences, in this shape:
+
+{"findings": [{"file": "path/as/in/the/diff", "start_line": 12, "end_line": 14, "rule": "short rule name", "severity": "error|warning|info", "message": "what is wrong", "suggestion": "how to fix it"}]}
+
+- Line numbers are those of the new version of the file (the + side of the hunk headers)
+- severity: "error" for bugs and rule violations that must be fixed, "warning" for likely problems, "info" for minor remarks
+- If there is nothing to report, answer {"findings": []}`
+
+func findingsMessages(diff string, rules string) []ai.Message {
+	var b strings.Builder
+	b.WriteString("You are a code review assistant. Code changes (git diff):\n\n")
+	b.WriteString(diff)
+	if rules != "" {
+		b.WriteString("\n\nReview rules to check:\n\n")
+		b.WriteString(rules)
+		b.WriteString("\n\nONLY report violations of these rules; use the rule's name as \"rule\".")
+	}
+	b.WriteString("\n\n")
+	b.WriteString(findingsFormat)
+	return []ai.Message{
+		{Role: "system", Content: b.String()},
+		{Role: "user", Content: "Review these changes."},
+	}
+}
+
+// rawFinding is a finding as models write it; the field names and line
+// formats vary, so several spellings are accepted.
+type rawFinding struct {
+	File         string  `json:"file"`
+	Path         string  `json:"path"`
+	Line         lineRef `json:"line"`
+	Lines        lineRef `json:"lines"`
+	StartLine    lineRef `json:"start_line"`
+	StartLineAlt lineRef `json:"startLine"`
+	EndLine      lineRef `json:"end_line"`
+	EndLineAlt   lineRef `json:"endLine"`
+	Rule         string  `json:"rule"`
+	Severity     string  `json:"severity"`
+	Message      string  `json:"message"`
+	Description  string  `json:"description"`
+	Suggestion   string  `json:"suggestion"`
+	Fix          string  `json:"fix"`
+}
+
+// lineRef is a line number or range written as 12, "12" or "12-14".
+type lineRef struct {
+	Start, End int
+}
+
+func (l *lineRef) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		l.Start, l.End = int(v), int(v)
+	case string:
+		a, b, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(v), "L"), "-")
+		l.Start, _ = strconv.Atoi(strings.TrimSpace(a))
+		l.End = l.Start
+		if n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(b), "L")); err == nil {
+			l.End = n
+		}
+	}
+	// null, arrays and objects leave the line unknown
+	return nil
+}
+
+var (
+	codeFenceRe     = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+	trailingCommaRe = regexp.MustCompile(`,(\s*[}\]])`)
+)
+
+// parseFindingsJSON reads the findings from a model answer. It repairs what
+// models commonly get wrong: code fences and prose around the JSON, trailing
+// commas, and an answer cut off mid-list, of which the complete findings
+// are kept. repaired reports whether any of that was needed.
+func parseFindingsJSON(out string) (items []rawFinding, repaired bool, err error) {
+	s := strings.TrimSpace(out)
+	var envelope struct {
+		Findings []rawFinding `json:"findings"`
+	}
+	if json.Unmarshal([]byte(s), &envelope) == nil {
+		return envelope.Findings, false, nil
+	}
+	if json.Unmarshal([]byte(s), &items) == nil {
+		return items, false, nil
+	}
+
+	if m := codeFenceRe.FindStringSubmatch(s); m != nil {
+		s = strings.TrimSpace(m[1])
+	}
+	s = trailingCommaRe.ReplaceAllString(s, "$1")
+
+	// decode the list element by element so a truncated answer keeps its
+	// complete findings
+	start := -1
+	if i := strings.Index(s, `"findings"`); i >= 0 {
+		if j := strings.IndexByte(s[i:], '['); j >= 0 {
+			start = i + j
+		}
+	} else if i := strings.IndexAny(s, "[{"); i >= 0 && s[i] == '[' {
+		start = i
+	}
+	if start < 0 {
+		if strings.Contains(strings.ToLower(s), strings.ToLower(noIssuesFound)) {
+			return nil, true, nil
+		}
+		return nil, true, fmt.Errorf("no findings list in the answer")
+	}
+	dec := json.NewDecoder(strings.NewReader(s[start:]))
+	if _, err := dec.Token(); err != nil {
+		return nil, true, err
+	}
+	for dec.More() {
+		var f rawFinding
+		if err := dec.Decode(&f); err != nil {
+			if len(items) == 0 {
+				return nil, true, err
+			}
+			break
+		}
+		items = append(items, f)
+	}
+	return items, true, nil
+}
+
+// lineRange is a range of new-file lines covered by a hunk.
+type lineRange struct{ start, end int }
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// diffLineAnchors maps each file of diff to the new-file line ranges of its
+// hunks.
+func diffLineAnchors(diff string) map[string][]lineRange {
+	anchors := make(map[string][]lineRange)
+	for _, f := range splitDiffFiles(diff) {
+		if f.path == "" {
+			continue
+		}
+		ranges := anchors[f.path]
+		for _, line := range strings.Split(f.diff, "\n") {
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			start, _ := strconv.Atoi(m[1])
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			}
+			ranges = append(ranges, lineRange{start, start + max(count, 1) - 1})
+		}
+		anchors[f.path] = ranges
+	}
+	return anchors
+}
+
+// normalizeFindings turns raw findings into ReviewFindings: file paths are
+// matched against the files of the diff, line ranges ordered, severities
+// mapped onto the three known ones. Findings without a message or whose
+// file is not in the diff are dropped and counted.
+func normalizeFindings(raw []rawFinding, anchors map[string][]lineRange) ([]ReviewFinding, int) {
+	findings := []ReviewFinding{}
+	dropped := 0
+	for _, r := range raw {
+		file := matchDiffFile(firstNonEmpty(r.File, r.Path), anchors)
+		message := strings.TrimSpace(firstNonEmpty(r.Message, r.Description))
+		if file == "" || message == "" {
+			dropped++
+			continue
+		}
+		start, end := r.StartLine.Start, r.EndLine.Start
+		if start == 0 {
+			start = r.StartLineAlt.Start
+		}
+		if end == 0 {
+			end = r.EndLineAlt.Start
+		}
+		for _, l := range []lineRef{r.Line, r.Lines} {
+			if start == 0 && l.Start > 0 {
+				start, end = l.Start, max(end, l.End)
+			}
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end < start {
+			end = start
+		}
+		f := ReviewFinding{
+			File:       file,
+			StartLine:  start,
+			EndLine:    end,
+			Rule:       strings.TrimSpace(r.Rule),
+			Severity:   normalizeSeverity(r.Severity),
+			Message:    message,
+			Suggestion: strings.TrimSpace(firstNonEmpty(r.Suggestion, r.Fix)),
+		}
+		if start > 0 {
+			for _, h := range anchors[file] {
+				if start <= h.end && end >= h.start {
+					f.InDiff = true
+					break
+				}
+			}
+		}
+		findings = append(findings, f)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].StartLine < findings[j].StartLine
+	})
+	return findings, dropped
+}
+
+// matchDiffFile returns the diff file a model's path refers to, accepting
+// a/ and b/ prefixes and paths shortened to a unique suffix.
+func matchDiffFile(path string, anchors map[string][]lineRange) string {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "./")
+	if _, ok := anchors[path]; ok {
+		return path
+	}
+	for _, p := range []string{"a/", "b/"} {
+		if _, ok := anchors[strings.TrimPrefix(path, p)]; ok && strings.HasPrefix(path, p) {
+			return strings.TrimPrefix(path, p)
+		}
+	}
+	if path == "" {
+		return ""
+	}
+	var match string
+	for f := range anchors {
+		if strings.HasSuffix(f, "/"+path) {
+			if match != "" {
+				return ""
+			}
+			match = f
+		}
+	}
+	return match
+}
+
+func normalizeSeverity(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "error", "critical", "high", "blocker", "major", "bug":
+		return SeverityError
+	case "info", "low", "minor", "note", "nit", "suggestion", "style":
+		return SeverityInfo
+	default:
+		return SeverityWarning
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+)
+
+func TestParseFindingsJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		want     int
+		repaired bool
+	}{
+		{"envelope", `{"findings":[{"file":"a.go","message":"m"}]}`, 1, false},
+		{"bare list", `[{"file":"a.go","message":"m"},{"file":"b.go","message":"m"}]`, 2, false},
+		{"empty", `{"findings": []}`, 0, false},
+		{"fenced with prose", "Here you go:\n```json\n{\"findings\": [{\"file\": \"a.go\", \"message\": \"m\"},]}\n```\nDone.", 1, true},
+		{"truncated", `{"findings": [{"file":"a.go","message":"m"}, {"file":"b.go","mess`, 1, true},
+		{"no issues", "No issues found.", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, repaired, err := parseFindingsJSON(tt.out)
+			if err != nil || len(items) != tt.want || repaired != tt.repaired {
+				t.Errorf("got %d items, repaired %v, err %v", len(items), repaired, err)
+			}
+		})
+	}
+	if _, _, err := parseFindingsJSON("The code looks risky in a.go."); err == nil {
+		t.Error("prose accepted as findings")
+	}
+}
+
+func TestNormalizeFindings(t *testing.T) {
+	diff := fileDiff("server/a.go", 1, 3) + fileDiff("web/b.ts", 1, 2)
+	anchors := diffLineAnchors(diff)
+	if got := anchors["server/a.go"]; len(got) != 1 || got[0] != (lineRange{1, 3}) {
+		t.Fatalf("anchors = %+v", anchors)
+	}
+
+	var raw []rawFinding
+	if err := json.Unmarshal([]byte(`[
+		{"file": "b/web/b.ts", "line": "2-5", "severity": "HIGH", "message": "m1", "fix": "f"},
+		{"path": "a.go", "startLine": 40, "end_line": 38, "severity": "nit", "description": "m2"},
+		{"file": "server/a.go", "message": "whole file"},
+		{"file": "other.go", "line": 1, "message": "not in diff"},
+		{"file": "server/a.go", "line": 1}
+	]`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	findings, dropped := normalizeFindings(raw, anchors)
+	if dropped != 2 || len(findings) != 3 {
+		t.Fatalf("dropped %d, findings %+v", dropped, findings)
+	}
+	want := []ReviewFinding{
+		{File: "server/a.go", Severity: SeverityWarning, Message: "whole file"},
+		{File: "server/a.go", StartLine: 40, EndLine: 40, Severity: SeverityInfo, Message: "m2"},
+		{File: "web/b.ts", StartLine: 2, EndLine: 5, Severity: SeverityError, Message: "m1", Suggestion: "f", InDiff: true},
+	}
+	for i := range want {
+		if findings[i] != want[i] {
+			t.Errorf("finding %d = %+v, want %+v", i, findings[i], want[i])
+		}
+	}
+}
+
+func TestReviewFindingsAsksToConvertProse(t *testing.T) {
+	useTempAIUsage(t)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		content := "a.go line 2 ignores an error."
+		if calls > 1 {
+			content = `{"findings":[{"file":"a.go","start_line":2,"severity":"error","message":"ignored error"}]}`
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": map[string]string{"content": content},
+			"done":    true,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := ai.Config{Provider: ai.ProviderOllama, BaseURL: srv.URL, Model: "m"}
+	res, err := reviewFindings(context.Background(), cfg, fileDiff("a.go", 1, 3), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || !res.Repaired || len(res.Findings) != 1 || !res.Findings[0].InDiff {
+		t.Errorf("calls %d, result %+v", calls, res)
+	}
+	if !strings.Contains(findingsMessages("d", "")[0].Content, `"findings"`) {
+		t.Error("prompt does not describe the JSON shape")
+	}
+}
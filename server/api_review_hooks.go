@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/xhd2015/ai-critic/server/audit"
+	"github.com/xhd2015/ai-critic/server/githooks"
+)
+
+// GitHooksRequest is the body of the /api/review/hooks endpoints
+type GitHooksRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	// Name selects the hook to show (show).
+	Name string `json:"name"`
+	// Disabled makes commits the server makes skip the hooks (disable).
+	Disabled bool `json:"disabled"`
+}
+
+func decodeHooksRequest(w http.ResponseWriter, r *http.Request) (*GitHooksRequest, string, bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return nil, "", false
+	}
+	var req GitHooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return nil, "", false
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return nil, "", false
+	}
+	return &req, dir, true
+}
+
+// handleListHooks lists the installed hooks and which ones a commit runs
+//
+//	POST /api/review/hooks {dir, worktree} -> githooks.Info
+func handleListHooks(w http.ResponseWriter, r *http.Request) {
+	_, dir, ok := decodeHooksRequest(w, r)
+	if !ok {
+		return
+	}
+	info, err := githooks.List(dir)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleShowHook returns the script of one hook
+//
+//	POST /api/review/hooks/show {dir, worktree, name} -> {hook, content}
+func handleShowHook(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeHooksRequest(w, r)
+	if !ok {
+		return
+	}
+	hook, content, err := githooks.Content(dir, req.Name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "hook not found: " + req.Name})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"hook": hook, "content": content})
+}
+
+// handleDisableHooks turns hooks off or on for the commits the server makes
+// in the repository
+//
+//	POST /api/review/hooks/disable {dir, worktree, disabled} -> githooks.Info
+func handleDisableHooks(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeHooksRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := githooks.SetDisabled(dir, req.Disabled); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	state := "enabled"
+	if req.Disabled {
+		state = "disabled"
+	}
+	audit.Record(r, "git-hooks", "hooks "+state+" for server commits in "+dir)
+	info, err := githooks.List(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// commitHooksOf lists the hooks a server commit in dir will run, for
+// warning about them; failures just leave the list empty.
+func commitHooksOf(dir string) []string {
+	info, err := githooks.List(dir)
+	if err != nil {
+		return nil
+	}
+	return info.CommitHooks
+}
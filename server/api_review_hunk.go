@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// StageHunkRequest represents a request to stage or unstage part of a file
+type StageHunkRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	Path     string `json:"path"` // File whose hunks are selected
+	// Hunks are 0-based indices of hunks in the file's diff: the unstaged diff
+	// for stage-hunk, the staged diff for unstage-hunk.
+	Hunks []int `json:"hunks"`
+	// Patch is a raw patch applied as-is instead of selecting Hunks.
+	Patch string `json:"patch"`
+}
+
+// handleStageHunk stages selected hunks of a file via git apply --cached
+func handleStageHunk(w http.ResponseWriter, r *http.Request) {
+	handleHunkApply(w, r, false)
+}
+
+// handleUnstageHunk removes selected hunks of a file from the index
+func handleUnstageHunk(w http.ResponseWriter, r *http.Request) {
+	handleHunkApply(w, r, true)
+}
+
+func handleHunkApply(w http.ResponseWriter, r *http.Request, unstage bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req StageHunkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if req.Patch == "" && (req.Path == "" || len(req.Hunks) == 0) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Either patch, or path and hunks, are required"})
+		return
+	}
+
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	patch := req.Patch
+	if patch == "" {
+		diffArgs := []string{"--no-color", "--no-ext-diff"}
+		if unstage {
+			diffArgs = append(diffArgs, "--cached")
+		}
+		diffArgs = append(diffArgs, "--", req.Path)
+		out, err := gitrunner.Diff(diffArgs...).Dir(dir).Output()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to diff %s: %v", req.Path, err)})
+			return
+		}
+		patch, err = selectHunks(string(out), req.Hunks)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	args := []string{"--cached"}
+	if unstage {
+		args = append(args, "-R")
+	}
+	output, err := runGitApply(dir, patch, args...)
+	if err != nil {
+		action := "stage"
+		if unstage {
+			action = "unstage"
+		}
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":    fmt.Sprintf("Failed to %s hunks: %s", action, output),
+			"rejected": parseApplyRejections(output),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// selectHunks keeps the file header of a single-file diff plus the hunks at
+// the given indices, producing a patch that applies on its own.
+func selectHunks(diff string, indices []int) (string, error) {
+	if strings.TrimSpace(diff) == "" {
+		return "", fmt.Errorf("no changes to select hunks from")
+	}
+	header, hunks, err := splitDiffHunks(diff)
+	if err != nil {
+		return "", err
+	}
+	if len(hunks) == 0 {
+		return "", fmt.Errorf("diff has no hunks (binary or mode-only change)")
+	}
+
+	selected := make(map[int]bool, len(indices))
+	for _, i := range indices {
+		if i < 0 || i >= len(hunks) {
+			return "", fmt.Errorf("hunk index %d out of range (file has %d hunks)", i, len(hunks))
+		}
+		selected[i] = true
+	}
+	var b strings.Builder
+	b.WriteString(header)
+	for i, h := range hunks {
+		if selected[i] {
+			b.WriteString(h)
+		}
+	}
+	return b.String(), nil
+}
+
+// splitDiffHunks splits a single-file diff into its header (everything
+// before the first @@) and its hunks, each starting with its @@ line.
+func splitDiffHunks(diff string) (string, []string, error) {
+	var header strings.Builder
+	var hunks []string
+	var current *strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") && (current != nil || header.Len() > 0) {
+			return "", nil, fmt.Errorf("hunk selection needs a single-file diff")
+		}
+		if strings.HasPrefix(line, "@@") {
+			if current != nil {
+				hunks = append(hunks, current.String())
+			}
+			current = &strings.Builder{}
+		}
+		if current != nil {
+			current.WriteString(line)
+		} else {
+			header.WriteString(line)
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, current.String())
+	}
+	return header.String(), hunks, nil
+}
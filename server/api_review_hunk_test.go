@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageAndUnstageHunk(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "line")
+	}
+	file := filepath.Join(repo, "f.txt")
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	git("init", "-q")
+	git("add", "f.txt")
+	git("commit", "-q", "-m", "init")
+
+	lines[1], lines[25] = "first change", "second change"
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	call := func(h http.HandlerFunc, req StageHunkRequest) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	call(handleStageHunk, StageHunkRequest{Dir: repo, Path: "f.txt", Hunks: []int{1}})
+	staged := git("diff", "--cached")
+	if !strings.Contains(staged, "+second change") || strings.Contains(staged, "+first change") {
+		t.Fatalf("unexpected staged diff:\n%s", staged)
+	}
+
+	call(handleUnstageHunk, StageHunkRequest{Dir: repo, Path: "f.txt", Hunks: []int{0}})
+	if staged := git("diff", "--cached"); staged != "" {
+		t.Fatalf("index not empty after unstage:\n%s", staged)
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/highlight"
+)
+
+const (
+	defaultGitLogLimit = 50
+	maxGitLogLimit     = 500
+)
+
+// gitLogFormat prints one commit per NUL-terminated record (with -z), its
+// fields separated by \x1f.
+const gitLogFormat = "--format=%H%x1f%h%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%cn%x1f%cI%x1f%s%x1f%b"
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,64}$`)
+
+// GitLogRequest selects a page of commit history
+type GitLogRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	Ref      string `json:"ref"`    // Branch, tag or commit to start from (default HEAD)
+	Skip     int    `json:"skip"`   // Commits to skip, for pagination
+	Limit    int    `json:"limit"`  // Page size (default 50, max 500)
+	Author   string `json:"author"` // Pattern matched against author name and email
+	Since    string `json:"since"`  // Any date git accepts, e.g. "2024-05-01" or "2 weeks ago"
+	Until    string `json:"until"`
+	Path     string `json:"path"` // Only commits touching this path
+}
+
+// GitCommit is one commit of the history
+type GitCommit struct {
+	SHA           string   `json:"sha"`
+	ShortSHA      string   `json:"shortSha"`
+	Parents       []string `json:"parents"`
+	AuthorName    string   `json:"authorName"`
+	AuthorEmail   string   `json:"authorEmail"`
+	AuthorDate    string   `json:"authorDate"` // ISO 8601
+	CommitterName string   `json:"committerName"`
+	CommitterDate string   `json:"committerDate"`
+	Subject       string   `json:"subject"`
+	Body          string   `json:"body,omitempty"`
+}
+
+// GitLogResult is a page of commits, newest first
+type GitLogResult struct {
+	Commits []GitCommit `json:"commits"`
+	Skip    int         `json:"skip"`
+	Limit   int         `json:"limit"`
+	HasMore bool        `json:"hasMore"`
+}
+
+// GitShowResult is a commit with its changes against the first parent
+type GitShowResult struct {
+	Commit GitCommit  `json:"commit"`
+	Files  []DiffFile `json:"files"`
+}
+
+// handleGitLog returns a page of commit history.
+//
+// With Accept: text/event-stream each commit is sent as it is read
+// ({"type":"commit","commit":{...}}), followed by
+// {"type":"done","hasMore":"true|false"}, so long pages render progressively.
+func handleGitLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req GitLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+	args, err := gitLogArgs(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if r.Header.Get("Accept") == "text/event-stream" {
+		streamGitLog(w, dir, args, req.Limit)
+		return
+	}
+
+	output, err := gitrunner.NewCommand(args...).Dir(dir).Output()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("git log failed: %s", gitErrorMessage(err))})
+		return
+	}
+	result := GitLogResult{Commits: []GitCommit{}, Skip: req.Skip, Limit: req.Limit}
+	scanGitLog(bytes.NewReader(output), func(c GitCommit) bool {
+		if len(result.Commits) == req.Limit {
+			result.HasMore = true
+			return false
+		}
+		result.Commits = append(result.Commits, c)
+		return true
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+func streamGitLog(w http.ResponseWriter, dir string, args []string, limit int) {
+	sseWriter := sse.NewWriter(w)
+	if sseWriter == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+		return
+	}
+	cmd := gitrunner.NewCommand(args...).Dir(dir).Exec()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		sseWriter.SendError(fmt.Sprintf("git log failed: %v", err))
+		sseWriter.SendDone(map[string]string{"success": "false"})
+		return
+	}
+
+	sent, hasMore := 0, false
+	scanGitLog(stdout, func(c GitCommit) bool {
+		if sent == limit {
+			hasMore = true
+			return false
+		}
+		sseWriter.Send(map[string]interface{}{"type": "commit", "commit": c})
+		sent++
+		return true
+	})
+	if hasMore {
+		// the extra commit was only read to detect another page
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && !hasMore {
+		sseWriter.SendError(fmt.Sprintf("git log failed: %s", strings.TrimSpace(stderr.String())))
+		sseWriter.SendDone(map[string]string{"success": "false"})
+		return
+	}
+	sseWriter.SendDone(map[string]string{"success": "true", "hasMore": fmt.Sprint(hasMore)})
+}
+
+// gitLogArgs validates req, applies defaults and builds the git log command
+// line. One commit beyond the limit is requested to report HasMore.
+func gitLogArgs(req *GitLogRequest) ([]string, error) {
+	if req.Limit <= 0 {
+		req.Limit = defaultGitLogLimit
+	}
+	if req.Limit > maxGitLogLimit {
+		req.Limit = maxGitLogLimit
+	}
+	if req.Skip < 0 {
+		return nil, fmt.Errorf("skip must not be negative")
+	}
+	ref := strings.TrimSpace(req.Ref)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// everything user-supplied is passed as an option value or after "--"
+	if strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("invalid ref: %s", ref)
+	}
+
+	args := []string{"log", "-z", gitLogFormat, fmt.Sprintf("--max-count=%d", req.Limit+1)}
+	if req.Skip > 0 {
+		args = append(args, fmt.Sprintf("--skip=%d", req.Skip))
+	}
+	if req.Author != "" {
+		args = append(args, "--author="+req.Author)
+	}
+	if req.Since != "" {
+		args = append(args, "--since="+req.Since)
+	}
+	if req.Until != "" {
+		args = append(args, "--until="+req.Until)
+	}
+	args = append(args, ref, "--")
+	if req.Path != "" {
+		args = append(args, req.Path)
+	}
+	return args, nil
+}
+
+// scanGitLog parses the output of git log -z with gitLogFormat, calling fn
+// for each commit until it returns false.
+func scanGitLog(r io.Reader, fn func(GitCommit) bool) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		c, ok := parseGitCommit(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !fn(c) {
+			return
+		}
+	}
+}
+
+func parseGitCommit(record string) (GitCommit, bool) {
+	fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 10)
+	if len(fields) < 10 {
+		return GitCommit{}, false
+	}
+	return GitCommit{
+		SHA:           fields[0],
+		ShortSHA:      fields[1],
+		Parents:       strings.Fields(fields[2]),
+		AuthorName:    fields[3],
+		AuthorEmail:   fields[4],
+		AuthorDate:    fields[5],
+		CommitterName: fields[6],
+		CommitterDate: fields[7],
+		Subject:       fields[8],
+		Body:          strings.TrimSpace(fields[9]),
+	}, true
+}
+
+// handleGitShow returns a commit and its per-file diff against its first
+// parent: GET /api/review/show/{sha}?dir=...&worktree=...&highlight=true
+func handleGitShow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	sha := strings.TrimPrefix(r.URL.Path, "/api/review/show/")
+	if !commitSHAPattern.MatchString(sha) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid commit SHA"})
+		return
+	}
+
+	q := r.URL.Query()
+	dir, ok := resolveRequestDir(w, r, q.Get("dir"), q.Get("worktree"))
+	if !ok {
+		return
+	}
+
+	result, err := getGitShow(dir, sha)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	if q.Get("highlight") == "true" {
+		for i := range result.Files {
+			result.Files[i].Tokens = highlight.UnifiedDiff(result.Files[i].Path, result.Files[i].Diff)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func getGitShow(dir, sha string) (*GitShowResult, error) {
+	output, err := gitrunner.NewCommand("log", "-z", "-1", gitLogFormat, sha, "--").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("commit not found: %s", sha)
+	}
+	var commit *GitCommit
+	scanGitLog(bytes.NewReader(output), func(c GitCommit) bool {
+		commit = &c
+		return false
+	})
+	if commit == nil {
+		return nil, fmt.Errorf("commit not found: %s", sha)
+	}
+
+	// merges are shown against their first parent, root commits against
+	// the empty tree
+	var diffCmd *gitrunner.Command
+	if len(commit.Parents) > 0 {
+		diffCmd = gitrunner.NewCommand("diff", "--no-color", "-M", commit.Parents[0], commit.SHA, "--")
+	} else {
+		diffCmd = gitrunner.NewCommand("diff-tree", "-p", "--root", "--no-color", "-M", commit.SHA, "--")
+	}
+	diff, err := diffCmd.Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %s", gitErrorMessage(err))
+	}
+	files := parseGitDiff(string(diff), false)
+	if files == nil {
+		files = []DiffFile{}
+	}
+	return &GitShowResult{Commit: *commit, Files: files}, nil
+}
+
+// gitErrorMessage returns git's stderr for a failed command run with
+// Output, falling back to the error itself.
+func gitErrorMessage(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+		return string(bytes.TrimSpace(exitErr.Stderr))
+	}
+	return err.Error()
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleGitLogAndShow(t *testing.T) {
+	repo := t.TempDir()
+	git := func(author string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME="+author, "GIT_AUTHOR_EMAIL="+author+"@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(author, file, content, msg string) string {
+		os.MkdirAll(filepath.Dir(filepath.Join(repo, file)), 0755)
+		os.WriteFile(filepath.Join(repo, file), []byte(content), 0644)
+		git(author, "add", file)
+		git(author, "commit", "-q", "-m", msg)
+		return git(author, "rev-parse", "HEAD")
+	}
+	git("t", "init", "-q", "-b", "main")
+	root := commit("alice", "README.md", "hello\n", "initial")
+	commit("bob", "src/main.go", "package main\n", "add main\n\nwith a body")
+	last := commit("alice", "README.md", "hello\nworld\n", "update readme")
+
+	gitLog := func(req GitLogRequest) GitLogResult {
+		t.Helper()
+		req.Dir = repo
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handleGitLog(rec, httptest.NewRequest(http.MethodPost, "/api/review/log", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("log status %d: %s", rec.Code, rec.Body.String())
+		}
+		var res GitLogResult
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return res
+	}
+	subjects := func(res GitLogResult) string {
+		var s []string
+		for _, c := range res.Commits {
+			s = append(s, c.Subject)
+		}
+		return strings.Join(s, ",")
+	}
+
+	tests := []struct {
+		name        string
+		req         GitLogRequest
+		want        string
+		wantHasMore bool
+	}{
+		{"all", GitLogRequest{}, "update readme,add main,initial", false},
+		{"first page", GitLogRequest{Limit: 2}, "update readme,add main", true},
+		{"second page", GitLogRequest{Limit: 2, Skip: 2}, "initial", false},
+		{"author", GitLogRequest{Author: "bob"}, "add main", false},
+		{"path", GitLogRequest{Path: "README.md"}, "update readme,initial", false},
+		{"ref", GitLogRequest{Ref: root}, "initial", false},
+	}
+	for _, tt := range tests {
+		res := gitLog(tt.req)
+		if got := subjects(res); got != tt.want || res.HasMore != tt.wantHasMore {
+			t.Errorf("%s: got %q (hasMore %v), want %q (hasMore %v)", tt.name, got, res.HasMore, tt.want, tt.wantHasMore)
+		}
+	}
+	if c := gitLog(GitLogRequest{Author: "bob"}).Commits[0]; c.Body != "with a body" || c.AuthorEmail != "bob@example.com" || len(c.Parents) != 1 {
+		t.Errorf("commit fields = %+v", c)
+	}
+
+	body, _ := json.Marshal(GitLogRequest{Dir: repo, Ref: "--output=/tmp/x"})
+	rec := httptest.NewRecorder()
+	handleGitLog(rec, httptest.NewRequest(http.MethodPost, "/api/review/log", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("option-like ref: status %d", rec.Code)
+	}
+
+	show := func(sha string) (int, GitShowResult) {
+		rec := httptest.NewRecorder()
+		handleGitShow(rec, httptest.NewRequest(http.MethodGet, "/api/review/show/"+sha+"?dir="+url.QueryEscape(repo), nil))
+		var res GitShowResult
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec.Code, res
+	}
+	code, res := show(last)
+	if code != http.StatusOK || res.Commit.Subject != "update readme" || len(res.Files) != 1 ||
+		res.Files[0].Path != "README.md" || !strings.Contains(res.Files[0].Diff, "+world") {
+		t.Errorf("show last: %d %+v", code, res)
+	}
+	code, res = show(root[:8])
+	if code != http.StatusOK || len(res.Files) != 1 || res.Files[0].Status != "added" {
+		t.Errorf("show root: %d %+v", code, res)
+	}
+	if code, _ := show("not-a-sha"); code != http.StatusBadRequest {
+		t.Errorf("show invalid sha: status %d", code)
+	}
+	if code, _ := show("deadbeef"); code != http.StatusNotFound {
+		t.Errorf("show unknown sha: status %d", code)
+	}
+}
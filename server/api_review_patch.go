@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// ApplyPatchRequest represents a request to apply a unified diff
+type ApplyPatchRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	Patch    string `json:"patch"` // Unified diff, as produced by git diff or an AI suggestion
+	// CheckOnly validates the patch without touching the working tree.
+	CheckOnly bool `json:"checkOnly"`
+	// Reverse reverts a previously applied patch (git apply -R).
+	Reverse bool `json:"reverse"`
+	// ThreeWay falls back to a 3-way merge, leaving conflict markers
+	// instead of failing when the context does not match.
+	ThreeWay bool `json:"threeWay"`
+	// Reject applies the hunks that fit and writes the rest to *.rej files.
+	Reject bool `json:"reject"`
+}
+
+// PatchRejection describes a hunk or file that did not apply
+type PatchRejection struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// ApplyPatchResult is the response of /api/review/apply-patch
+type ApplyPatchResult struct {
+	Applied   bool             `json:"applied"`
+	Clean     bool             `json:"clean"` // git apply --check passed
+	Rejected  []PatchRejection `json:"rejected,omitempty"`
+	Conflicts []string         `json:"conflicts,omitempty"` // Files left with conflict markers by ThreeWay
+	Output    string           `json:"output,omitempty"`
+}
+
+var (
+	patchFailedRe   = regexp.MustCompile(`^error: patch failed: (.+):(\d+)$`)
+	patchErrorRe    = regexp.MustCompile(`^error: (.+?): (.+)$`)
+	rejectedHunkRe  = regexp.MustCompile(`^Rejected hunk #(\d+)\.?$`)
+	applyingPatchRe = regexp.MustCompile(`^(?:Checking|Applying) patch (.+?)(?: with \d+ rejects?)?\.\.\.$`)
+)
+
+// handleApplyPatch validates and applies (or reverts) a unified diff in the working tree
+func handleApplyPatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req ApplyPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if strings.TrimSpace(req.Patch) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Patch is required"})
+		return
+	}
+	if req.ThreeWay && req.Reject {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "threeWay and reject cannot be combined"})
+		return
+	}
+
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	patch := req.Patch
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	var base []string
+	if req.Reverse {
+		base = append(base, "-R")
+	}
+
+	result := &ApplyPatchResult{}
+	checkOutput, checkErr := runGitApply(dir, patch, append([]string{"--check", "--verbose"}, base...)...)
+	result.Clean = checkErr == nil
+	if !result.Clean {
+		result.Rejected = parseApplyRejections(checkOutput)
+		result.Output = checkOutput
+	}
+
+	if req.CheckOnly || (!result.Clean && !req.ThreeWay && !req.Reject) {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	args := append([]string{"--verbose"}, base...)
+	if req.ThreeWay {
+		args = append(args, "--3way")
+	}
+	if req.Reject {
+		args = append(args, "--reject")
+	}
+	output, applyErr := runGitApply(dir, patch, args...)
+	result.Output = output
+	result.Applied = applyErr == nil
+	if applyErr != nil {
+		result.Rejected = parseApplyRejections(output)
+	}
+	if req.ThreeWay {
+		result.Conflicts = unmergedFiles(dir)
+		// A 3-way apply with conflicts still updates the tree
+		result.Applied = applyErr == nil || len(result.Conflicts) > 0
+	}
+	if req.Reject && len(result.Rejected) > 0 {
+		// Hunks that fit were applied; the rest are in *.rej files
+		result.Applied = true
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func runGitApply(dir, patch string, args ...string) (string, error) {
+	cmd := gitrunner.NewCommand(append([]string{"apply"}, args...)...).Dir(dir).Exec()
+	cmd.Stdin = strings.NewReader(patch)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// parseApplyRejections extracts failed files and hunks from `git apply --verbose` output
+func parseApplyRejections(output string) []PatchRejection {
+	var rejections []PatchRejection
+	var currentFile string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if m := applyingPatchRe.FindStringSubmatch(line); m != nil {
+			currentFile = m[1]
+			continue
+		}
+		if m := patchFailedRe.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[2])
+			rejections = append(rejections, PatchRejection{File: m[1], Line: n, Message: "patch does not apply"})
+			continue
+		}
+		if m := rejectedHunkRe.FindStringSubmatch(line); m != nil {
+			msg := fmt.Sprintf("hunk #%s rejected", m[1])
+			// --reject reports each failed hunk twice: "patch failed" while checking, then here
+			if n := len(rejections); n > 0 && rejections[n-1].File == currentFile && rejections[n-1].Message == "patch does not apply" {
+				rejections[n-1].Message = msg
+				continue
+			}
+			rejections = append(rejections, PatchRejection{File: currentFile, Message: msg})
+			continue
+		}
+		if m := patchErrorRe.FindStringSubmatch(line); m != nil && m[1] != "patch failed" {
+			if m[2] == "patch does not apply" && len(rejections) > 0 && rejections[len(rejections)-1].File == m[1] {
+				continue // already reported with a line number
+			}
+			rejections = append(rejections, PatchRejection{File: m[1], Message: m[2]})
+		}
+	}
+	return rejections
+}
+
+func unmergedFiles(dir string) []string {
+	out, err := gitrunner.Diff("--name-only", "--diff-filter=U").Dir(dir).Output()
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseApplyRejections(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []PatchRejection
+	}{
+		{
+			name:   "check failure",
+			output: "Checking patch f...\nerror: while searching for:\na\n\nerror: patch failed: f:1\nerror: f: patch does not apply\n",
+			want:   []PatchRejection{{File: "f", Line: 1, Message: "patch does not apply"}},
+		},
+		{
+			name:   "reject mode",
+			output: "Checking patch f...\nerror: patch failed: f:1\nApplying patch f with 1 reject...\nRejected hunk #1.\n",
+			want:   []PatchRejection{{File: "f", Line: 1, Message: "hunk #1 rejected"}},
+		},
+		{
+			name:   "index mismatch",
+			output: "Checking patch f...\nerror: f: does not match index\n",
+			want:   []PatchRejection{{File: "f", Message: "does not match index"}},
+		},
+		{
+			name:   "clean",
+			output: "Checking patch f...\nApplied patch f cleanly.\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseApplyRejections(tt.output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseApplyRejections() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Review read-state records which files and hunks of the current diff a user
+// has marked as reviewed. Marks are keyed by a hash of the file diff or hunk
+// content rather than by path, so they survive unrelated edits and staging;
+// a mark stops matching once the change it refers to is edited.
+
+// readStateMaxAge is how long marks are kept after they were last touched.
+const readStateMaxAge = 30 * 24 * time.Hour
+
+// ReadStateRequest marks or unmarks a file, or some of its hunks, as reviewed
+type ReadStateRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	Path     string `json:"path"`
+	Staged   bool   `json:"staged"` // Which diff of the file: staged or working tree
+	// Hunks are 0-based indices into the file's diff; empty means the whole file.
+	Hunks []int `json:"hunks,omitempty"`
+}
+
+// FileReadState is the review progress of one file diff
+type FileReadState struct {
+	Path          string `json:"path"`
+	Staged        bool   `json:"staged"`
+	Hash          string `json:"hash"`
+	Reviewed      bool   `json:"reviewed"`
+	TotalHunks    int    `json:"totalHunks"`
+	ReviewedHunks []int  `json:"reviewedHunks"`
+}
+
+// ReviewProgress summarizes review progress over the current diff
+type ReviewProgress struct {
+	DiffHash      string          `json:"diffHash"`
+	TotalFiles    int             `json:"totalFiles"`
+	ReviewedFiles int             `json:"reviewedFiles"`
+	TotalHunks    int             `json:"totalHunks"`
+	ReviewedHunks int             `json:"reviewedHunks"`
+	Files         []FileReadState `json:"files"`
+}
+
+// readMarks maps a content hash to the time it was marked (RFC3339)
+type readMarks map[string]string
+
+type readStateStore struct {
+	// Users maps auth.UserID -> repository dir -> marks
+	Users map[string]map[string]readMarks `json:"users"`
+}
+
+var (
+	readStateMu   sync.Mutex
+	readStateFile = jsonfile.New[readStateStore](config.DataDir + "/review-read-state.json")
+)
+
+// handleReadState returns review progress for the current diff
+func handleReadState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req ReadStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	updateReadState(w, r, req, nil)
+}
+
+// handleMarkReviewed marks a file or hunks as reviewed
+func handleMarkReviewed(w http.ResponseWriter, r *http.Request) {
+	handleReadStateMark(w, r, true)
+}
+
+// handleUnmarkReviewed clears the reviewed mark of a file or hunks
+func handleUnmarkReviewed(w http.ResponseWriter, r *http.Request) {
+	handleReadStateMark(w, r, false)
+}
+
+func handleReadStateMark(w http.ResponseWriter, r *http.Request, reviewed bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+	var req ReadStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if req.Path == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Path is required"})
+		return
+	}
+	updateReadState(w, r, req, &reviewed)
+}
+
+// updateReadState applies a mark (when reviewed is non-nil) and responds
+// with the progress over the current diff.
+func updateReadState(w http.ResponseWriter, r *http.Request, req ReadStateRequest, reviewed *bool) {
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+	diff, err := getGitDiff(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	files := make([]readStateDiff, 0, len(diff.Files))
+	for _, f := range diff.Files {
+		files = append(files, newReadStateDiff(f))
+	}
+
+	user := auth.UserID(r)
+	key := filepath.Clean(dir)
+	now := time.Now()
+
+	readStateMu.Lock()
+	defer readStateMu.Unlock()
+	var progress *ReviewProgress
+	var markErr error
+	err = readStateFile.Update(func(st *readStateStore) error {
+		if st.Users == nil {
+			st.Users = make(map[string]map[string]readMarks)
+		}
+		if st.Users[user] == nil {
+			st.Users[user] = make(map[string]readMarks)
+		}
+		marks := st.Users[user][key]
+		if marks == nil {
+			marks = make(readMarks)
+		}
+		if reviewed != nil {
+			markErr = applyReadMark(marks, files, req, *reviewed, now)
+			if markErr != nil {
+				return markErr
+			}
+		}
+		pruneReadMarks(marks, now)
+		if len(marks) == 0 {
+			delete(st.Users[user], key)
+		} else {
+			st.Users[user][key] = marks
+		}
+		progress = computeReviewProgress(files, marks)
+		return nil
+	})
+	if markErr != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": markErr.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, progress)
+}
+
+// readStateDiff is a file diff with the content hashes of it and its hunks
+type readStateDiff struct {
+	DiffFile
+	hash       string
+	hunkHashes []string
+}
+
+func newReadStateDiff(f DiffFile) readStateDiff {
+	rf := readStateDiff{DiffFile: f, hash: contentHash(f.Diff)}
+	_, hunks, _ := splitDiffHunks(f.Diff)
+	for _, h := range hunks {
+		// Drop the @@ line: its line numbers shift when other hunks change
+		body := h
+		if i := strings.IndexByte(h, '\n'); i >= 0 {
+			body = h[i+1:]
+		}
+		rf.hunkHashes = append(rf.hunkHashes, contentHash(f.Path+"\x00"+body))
+	}
+	return rf
+}
+
+func contentHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:12])
+}
+
+func applyReadMark(marks readMarks, files []readStateDiff, req ReadStateRequest, reviewed bool, now time.Time) error {
+	var file *readStateDiff
+	for i := range files {
+		if files[i].Path == req.Path && files[i].IsStaged == req.Staged {
+			file = &files[i]
+			break
+		}
+	}
+	if file == nil {
+		return fmt.Errorf("no diff for %s (staged=%v)", req.Path, req.Staged)
+	}
+
+	stamp := now.UTC().Format(time.RFC3339)
+	hunks := file.hunkHashes
+	if len(req.Hunks) > 0 {
+		hunks = nil
+		for _, i := range req.Hunks {
+			if i < 0 || i >= len(file.hunkHashes) {
+				return fmt.Errorf("hunk index %d out of range (file has %d hunks)", i, len(file.hunkHashes))
+			}
+			hunks = append(hunks, file.hunkHashes[i])
+		}
+	}
+	for _, h := range hunks {
+		if reviewed {
+			marks[h] = stamp
+		} else {
+			delete(marks, h)
+		}
+	}
+	switch {
+	case reviewed && len(req.Hunks) == 0:
+		marks[file.hash] = stamp
+	case !reviewed:
+		// Unmarking any hunk makes the file unreviewed again
+		delete(marks, file.hash)
+	}
+	return nil
+}
+
+// pruneReadMarks drops marks not touched for readStateMaxAge
+func pruneReadMarks(marks readMarks, now time.Time) {
+	for h, stamp := range marks {
+		t, err := time.Parse(time.RFC3339, stamp)
+		if err != nil || now.Sub(t) > readStateMaxAge {
+			delete(marks, h)
+		}
+	}
+}
+
+func computeReviewProgress(files []readStateDiff, marks readMarks) *ReviewProgress {
+	p := &ReviewProgress{Files: []FileReadState{}}
+	var hashes []string
+	for _, f := range files {
+		hashes = append(hashes, f.hash)
+		fs := FileReadState{
+			Path:          f.Path,
+			Staged:        f.IsStaged,
+			Hash:          f.hash,
+			TotalHunks:    len(f.hunkHashes),
+			ReviewedHunks: []int{},
+		}
+		_, fileMarked := marks[f.hash]
+		for i, h := range f.hunkHashes {
+			if _, ok := marks[h]; ok || fileMarked {
+				fs.ReviewedHunks = append(fs.ReviewedHunks, i)
+			}
+		}
+		// A file without hunks (binary, mode change) needs a file-level mark
+		fs.Reviewed = fileMarked || (fs.TotalHunks > 0 && len(fs.ReviewedHunks) == fs.TotalHunks)
+
+		p.TotalFiles++
+		p.TotalHunks += fs.TotalHunks
+		p.ReviewedHunks += len(fs.ReviewedHunks)
+		if fs.Reviewed {
+			p.ReviewedFiles++
+		}
+		p.Files = append(p.Files, fs)
+	}
+	sort.Strings(hashes)
+	p.DiffHash = contentHash(strings.Join(hashes, ","))
+	return p
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func TestReadStateMarksSurviveStaging(t *testing.T) {
+	readStateFile = jsonfile.New[readStateStore](filepath.Join(t.TempDir(), "read-state.json"))
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "line")
+	}
+	file := filepath.Join(repo, "f.txt")
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	git("init", "-q")
+	git("add", "f.txt")
+	git("commit", "-q", "-m", "init")
+	lines[1], lines[25] = "first change", "second change"
+	os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	call := func(h http.HandlerFunc, req ReadStateRequest) ReviewProgress {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var p ReviewProgress
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		return p
+	}
+
+	p := call(handleMarkReviewed, ReadStateRequest{Dir: repo, Path: "f.txt", Hunks: []int{1}})
+	if p.TotalHunks != 2 || p.ReviewedHunks != 1 || p.ReviewedFiles != 0 {
+		t.Fatalf("after marking hunk 1: %+v", p)
+	}
+
+	// Stage the reviewed hunk: its mark follows it into the staged diff
+	body, _ := json.Marshal(StageHunkRequest{Dir: repo, Path: "f.txt", Hunks: []int{1}})
+	handleStageHunk(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	p = call(handleReadState, ReadStateRequest{Dir: repo})
+	if p.TotalFiles != 2 || p.ReviewedFiles != 1 || p.ReviewedHunks != 1 {
+		t.Fatalf("after staging: %+v", p)
+	}
+	for _, f := range p.Files {
+		if f.Reviewed != f.Staged {
+			t.Errorf("file %s staged=%v reviewed=%v", f.Path, f.Staged, f.Reviewed)
+		}
+	}
+
+	p = call(handleMarkReviewed, ReadStateRequest{Dir: repo, Path: "f.txt"})
+	if p.ReviewedFiles != 2 {
+		t.Fatalf("after marking the unstaged file: %+v", p)
+	}
+	p = call(handleUnmarkReviewed, ReadStateRequest{Dir: repo, Path: "f.txt", Staged: true})
+	for _, f := range p.Files {
+		if f.Reviewed == f.Staged {
+			t.Errorf("after unmarking the staged file: %s staged=%v reviewed=%v", f.Path, f.Staged, f.Reviewed)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/githooks"
+)
+
+// GitAmendRequest represents a request to amend the last commit
+type GitAmendRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	// Message replaces the commit message; empty keeps the current one.
+	Message string `json:"message"`
+	// StageAll stages all tracked modifications before amending (git commit -a).
+	StageAll bool `json:"stage_all"`
+}
+
+// RebaseTodoItem is one line of an interactive rebase todo list
+type RebaseTodoItem struct {
+	Action  string `json:"action"`            // "pick", "reword", "squash", "fixup", "drop"
+	Commit  string `json:"commit"`            // Commit SHA (abbreviated is fine)
+	Message string `json:"message,omitempty"` // New message, for "reword"
+}
+
+// GitRebaseRequest represents a rebase request
+type GitRebaseRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	// Action is "start", "continue", "abort" or "skip".
+	Action string `json:"action"`
+	// Onto is the upstream to rebase onto, for "start".
+	Onto string `json:"onto"`
+	// Todo makes "start" an interactive rebase with this todo list,
+	// oldest commit first. Empty performs a plain rebase.
+	Todo []RebaseTodoItem `json:"todo,omitempty"`
+}
+
+// GitRebaseState describes an in-progress rebase
+type GitRebaseState struct {
+	InProgress bool     `json:"inProgress"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+}
+
+// handleGitAmend amends the last commit with staged changes and/or a new message
+func handleGitAmend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req GitAmendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	args := append(githooks.CommitArgs(dir), "commit", "--amend")
+	if req.StageAll {
+		args = append(args, "-a")
+	}
+	if req.Message != "" {
+		args = append(args, "-m", req.Message)
+	} else {
+		args = append(args, "--no-edit")
+	}
+
+	output, err := gitrunner.NewCommand(args...).Dir(dir).Run()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to amend: %s", string(output))})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "output": string(output)})
+}
+
+// handleGitRebase starts, continues, aborts or skips a rebase.
+// With Accept: text/event-stream the git output (e.g. "Rebasing (2/5)") is
+// streamed as it happens; the done event reports whether the rebase stopped.
+func handleGitRebase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return
+	}
+
+	var req GitRebaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return
+	}
+
+	var args []string
+	var todoDir string
+	sequenceEditor := "true"
+	switch req.Action {
+	case "start":
+		if req.Onto == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "onto is required"})
+			return
+		}
+		args = []string{"rebase"}
+		if len(req.Todo) > 0 {
+			todoFile, err := writeRebaseTodo(req.Todo)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			todoDir = filepath.Dir(todoFile)
+			// git runs "$GIT_SEQUENCE_EDITOR <todo path>"; replace its todo with ours
+			sequenceEditor = "cp " + strconv.Quote(todoFile)
+			args = append(args, "-i")
+		}
+		args = append(args, req.Onto)
+	case "continue", "abort", "skip":
+		args = []string{"rebase", "--" + req.Action}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": `action must be "start", "continue", "abort" or "skip"`})
+		return
+	}
+	// Never open an editor: squash/fixup keep the combined message
+	cmd := gitrunner.NewCommand(args...).Dir(dir).
+		WithEnv("GIT_EDITOR", "true").
+		WithEnv("GIT_SEQUENCE_EDITOR", sequenceEditor).
+		Exec()
+
+	if r.Header.Get("Accept") == "text/event-stream" {
+		sseWriter := sse.NewWriter(w)
+		if sseWriter == nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Streaming not supported"})
+			return
+		}
+		sseWriter.SendLog(fmt.Sprintf("Running git %s...", strings.Join(cmd.Args[1:], " ")))
+		runErr := sseWriter.StreamCmd(cmd)
+		state := getRebaseState(dir)
+		cleanupRebaseTodo(todoDir, state)
+		done := map[string]string{
+			"success":     strconv.FormatBool(runErr == nil),
+			"in_progress": strconv.FormatBool(state.InProgress),
+		}
+		if len(state.Conflicts) > 0 {
+			done["conflicts"] = strings.Join(state.Conflicts, "\n")
+		}
+		if runErr != nil {
+			sseWriter.SendError(fmt.Sprintf("Rebase %s failed: %v", req.Action, runErr))
+		}
+		sseWriter.SendDone(done)
+		return
+	}
+
+	output, runErr := cmd.CombinedOutput()
+	state := getRebaseState(dir)
+	cleanupRebaseTodo(todoDir, state)
+	status := http.StatusOK
+	result := map[string]interface{}{
+		"status": "ok",
+		"output": string(output),
+		"state":  state,
+	}
+	if runErr != nil {
+		status = http.StatusConflict
+		result["status"] = "error"
+		result["error"] = fmt.Sprintf("Rebase %s failed: %s", req.Action, string(output))
+	}
+	writeJSON(w, status, result)
+}
+
+// writeRebaseTodo writes the todo list to a temp file. "reword" is expanded to
+// a pick followed by an exec that amends the message, so no editor is needed.
+func writeRebaseTodo(items []RebaseTodoItem) (string, error) {
+	dir, err := os.MkdirTemp("", "rebase-todo-")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, item := range items {
+		if item.Commit == "" || strings.ContainsAny(item.Commit, " \n") {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("todo item %d: invalid commit %q", i, item.Commit)
+		}
+		switch item.Action {
+		case "pick", "squash", "fixup", "drop":
+			fmt.Fprintf(&b, "%s %s\n", item.Action, item.Commit)
+		case "reword":
+			if item.Message == "" {
+				os.RemoveAll(dir)
+				return "", fmt.Errorf("todo item %d: reword requires a message", i)
+			}
+			msgFile := filepath.Join(dir, fmt.Sprintf("msg-%d", i))
+			if err := os.WriteFile(msgFile, []byte(item.Message), 0644); err != nil {
+				os.RemoveAll(dir)
+				return "", err
+			}
+			fmt.Fprintf(&b, "pick %s\nexec git commit --amend --no-verify -F %s\n", item.Commit, strconv.Quote(msgFile))
+		default:
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("todo item %d: unsupported action %q", i, item.Action)
+		}
+	}
+	todoFile := filepath.Join(dir, "todo")
+	if err := os.WriteFile(todoFile, []byte(b.String()), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return todoFile, nil
+}
+
+// cleanupRebaseTodo removes the todo directory once the rebase is no longer
+// stopped; reword message files are still needed by a paused rebase.
+func cleanupRebaseTodo(todoDir string, state GitRebaseState) {
+	if todoDir != "" && !state.InProgress {
+		os.RemoveAll(todoDir)
+	}
+}
+
+// getRebaseState reports whether a rebase is stopped in dir and which files conflict
+func getRebaseState(dir string) GitRebaseState {
+	var state GitRebaseState
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		out, err := gitrunner.RevParse("--git-path", name).Dir(dir).Output()
+		if err != nil {
+			continue
+		}
+		p := strings.TrimSpace(string(out))
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if _, err := os.Stat(p); err == nil {
+			state.InProgress = true
+			break
+		}
+	}
+	if !state.InProgress {
+		return state
+	}
+	state.Conflicts = unmergedFiles(dir)
+	return state
+}
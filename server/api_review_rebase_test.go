@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleGitRebaseRewordAndSquash(t *testing.T) {
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "base")
+	var shas []string
+	for _, name := range []string{"a", "b"} {
+		os.WriteFile(filepath.Join(repo, name), []byte(name), 0644)
+		git("add", name)
+		git("commit", "-q", "-m", "add "+name+" typo")
+		shas = append(shas, git("rev-parse", "HEAD"))
+	}
+
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	body, _ := json.Marshal(GitRebaseRequest{
+		Dir:    repo,
+		Action: "start",
+		Onto:   "HEAD~2",
+		Todo: []RebaseTodoItem{
+			{Action: "reword", Commit: shas[0], Message: "add a and b"},
+			{Action: "fixup", Commit: shas[1]},
+		},
+	})
+	rec := httptest.NewRecorder()
+	handleGitRebase(rec, httptest.NewRequest(http.MethodPost, "/api/review/rebase", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if log := git("log", "--format=%s"); log != "add a and b\nbase" {
+		t.Errorf("log after rebase:\n%s", log)
+	}
+	if state := getRebaseState(repo); state.InProgress {
+		t.Errorf("rebase still in progress")
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/highlight"
+)
+
+// GitStashRequest is the body of the /api/review/stash/* endpoints
+type GitStashRequest struct {
+	Dir      string `json:"dir"`
+	Worktree string `json:"worktree"`
+	// Index selects stash@{index} (apply, pop, drop, show).
+	Index int `json:"index"`
+	// Message names the new stash (push).
+	Message string `json:"message"`
+	// IncludeUntracked also stashes untracked files (push).
+	IncludeUntracked bool `json:"include_untracked"`
+	// Highlight adds syntax tokens to the diff (show).
+	Highlight bool `json:"highlight"`
+}
+
+// GitStashEntry is one entry of the stash list, newest first
+type GitStashEntry struct {
+	Index   int    `json:"index"`
+	Ref     string `json:"ref"` // stash@{N}
+	SHA     string `json:"sha"`
+	Branch  string `json:"branch"`  // Branch the changes were stashed on
+	Message string `json:"message"` // Stash message, or the WIP commit subject
+	Date    string `json:"date"`    // ISO 8601
+}
+
+// GitStashShowResult is a stash entry with its changes
+type GitStashShowResult struct {
+	Stash GitStashEntry `json:"stash"`
+	Files []DiffFile    `json:"files"`
+}
+
+func decodeStashRequest(w http.ResponseWriter, r *http.Request) (*GitStashRequest, string, bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+		return nil, "", false
+	}
+	var req GitStashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return nil, "", false
+	}
+	dir, ok := resolveRequestDir(w, r, req.Dir, req.Worktree)
+	if !ok {
+		return nil, "", false
+	}
+	return &req, dir, true
+}
+
+// handleStashList lists the stash entries
+func handleStashList(w http.ResponseWriter, r *http.Request) {
+	_, dir, ok := decodeStashRequest(w, r)
+	if !ok {
+		return
+	}
+	entries, err := listStashes(dir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleStashPush stashes the working tree changes
+func handleStashPush(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeStashRequest(w, r)
+	if !ok {
+		return
+	}
+	args := []string{"stash", "push"}
+	if req.IncludeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if msg := strings.TrimSpace(req.Message); msg != "" {
+		args = append(args, "-m", msg)
+	}
+	runGitSteps(w, r, dir, "Stash", [][]string{args}, nil)
+}
+
+// handleStashApply applies a stash entry and keeps it
+func handleStashApply(w http.ResponseWriter, r *http.Request) {
+	runStashCommand(w, r, "apply", "Apply stash")
+}
+
+// handleStashPop applies a stash entry and drops it
+func handleStashPop(w http.ResponseWriter, r *http.Request) {
+	runStashCommand(w, r, "pop", "Pop stash")
+}
+
+// handleStashDrop discards a stash entry
+func handleStashDrop(w http.ResponseWriter, r *http.Request) {
+	runStashCommand(w, r, "drop", "Drop stash")
+}
+
+func runStashCommand(w http.ResponseWriter, r *http.Request, command, action string) {
+	req, dir, ok := decodeStashRequest(w, r)
+	if !ok {
+		return
+	}
+	ref, err := stashRef(dir, req.Index)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	runGitSteps(w, r, dir, action, [][]string{{"stash", command, ref}}, map[string]string{"ref": ref})
+}
+
+// handleStashShow returns the per-file diff of a stash entry so it can be
+// previewed before applying
+func handleStashShow(w http.ResponseWriter, r *http.Request) {
+	req, dir, ok := decodeStashRequest(w, r)
+	if !ok {
+		return
+	}
+	ref, err := stashRef(dir, req.Index)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	entries, err := listStashes(dir)
+	if err != nil || req.Index >= len(entries) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "stash not found: " + ref})
+		return
+	}
+	output, err := gitrunner.NewCommand("stash", "show", "-p", "--no-color", "-M", ref).Dir(dir).Output()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("git stash show failed: %s", gitErrorMessage(err))})
+		return
+	}
+	files := parseGitDiff(string(output), false)
+	if files == nil {
+		files = []DiffFile{}
+	}
+	if req.Highlight {
+		for i := range files {
+			files[i].Tokens = highlight.UnifiedDiff(files[i].Path, files[i].Diff)
+		}
+	}
+	writeJSON(w, http.StatusOK, GitStashShowResult{Stash: entries[req.Index], Files: files})
+}
+
+// stashRef returns stash@{index} after checking the entry exists.
+func stashRef(dir string, index int) (string, error) {
+	ref := fmt.Sprintf("stash@{%d}", index)
+	if index < 0 {
+		return "", fmt.Errorf("invalid stash index: %d", index)
+	}
+	if err := gitrunner.RevParse("--verify", "--quiet", ref).Dir(dir).RunSilent(); err != nil {
+		return "", fmt.Errorf("stash not found: %s", ref)
+	}
+	return ref, nil
+}
+
+func listStashes(dir string) ([]GitStashEntry, error) {
+	output, err := gitrunner.NewCommand("stash", "list", "--format=%gd%x1f%H%x1f%cI%x1f%gs").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git stash list failed: %s", gitErrorMessage(err))
+	}
+	entries := []GitStashEntry{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		branch, message := parseStashSubject(fields[3])
+		entries = append(entries, GitStashEntry{
+			Index:   len(entries),
+			Ref:     fields[0],
+			SHA:     fields[1],
+			Date:    fields[2],
+			Branch:  branch,
+			Message: message,
+		})
+	}
+	return entries, nil
+}
+
+// parseStashSubject splits a stash reflog subject, "On main: message" or
+// "WIP on main: abc1234 subject", into branch and message.
+func parseStashSubject(subject string) (branch, message string) {
+	rest := subject
+	switch {
+	case strings.HasPrefix(rest, "WIP on "):
+		rest = strings.TrimPrefix(rest, "WIP on ")
+	case strings.HasPrefix(rest, "On "):
+		rest = strings.TrimPrefix(rest, "On ")
+	default:
+		return "", subject
+	}
+	i := strings.Index(rest, ": ")
+	if i < 0 {
+		return "", subject
+	}
+	return rest[:i], rest[i+2:]
+}
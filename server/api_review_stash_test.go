@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStashSubject(t *testing.T) {
+	tests := []struct {
+		subject, branch, message string
+	}{
+		{"On main: wip login", "main", "wip login"},
+		{"WIP on feature/x: abc1234 base", "feature/x", "abc1234 base"},
+		{"autostash", "", "autostash"},
+	}
+	for _, tt := range tests {
+		branch, message := parseStashSubject(tt.subject)
+		if branch != tt.branch || message != tt.message {
+			t.Errorf("parseStashSubject(%q) = %q, %q, want %q, %q", tt.subject, branch, message, tt.branch, tt.message)
+		}
+	}
+}
+
+func TestStashEndpoints(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "t")
+	t.Setenv("GIT_AUTHOR_EMAIL", "t@t")
+	t.Setenv("GIT_COMMITTER_NAME", "t")
+	t.Setenv("GIT_COMMITTER_EMAIL", "t@t")
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(repo, "a"), []byte("a\n"), 0644)
+	git("add", "a")
+	git("commit", "-q", "-m", "base")
+
+	call := func(h http.HandlerFunc, req GitStashRequest, out interface{}) int {
+		t.Helper()
+		req.Dir = repo
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/api/review/stash", bytes.NewReader(body)))
+		if out != nil {
+			json.Unmarshal(rec.Body.Bytes(), out)
+		}
+		return rec.Code
+	}
+
+	os.WriteFile(filepath.Join(repo, "a"), []byte("a\nfirst\n"), 0644)
+	if code := call(handleStashPush, GitStashRequest{Message: "first"}, nil); code != http.StatusOK {
+		t.Fatalf("push first: %d", code)
+	}
+	os.WriteFile(filepath.Join(repo, "new"), []byte("untracked\n"), 0644)
+	if code := call(handleStashPush, GitStashRequest{Message: "second", IncludeUntracked: true}, nil); code != http.StatusOK {
+		t.Fatalf("push second: %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "new")); !os.IsNotExist(err) {
+		t.Errorf("untracked file not stashed: %v", err)
+	}
+
+	var entries []GitStashEntry
+	if code := call(handleStashList, GitStashRequest{}, &entries); code != http.StatusOK || len(entries) != 2 {
+		t.Fatalf("list: %d %+v", code, entries)
+	}
+	if e := entries[1]; e.Ref != "stash@{1}" || e.Branch != "main" || e.Message != "first" {
+		t.Errorf("entry 1 = %+v", e)
+	}
+
+	var show GitStashShowResult
+	if code := call(handleStashShow, GitStashRequest{Index: 1}, &show); code != http.StatusOK {
+		t.Fatalf("show: %d", code)
+	}
+	if show.Stash.Message != "first" || len(show.Files) != 1 || show.Files[0].Path != "a" || !strings.Contains(show.Files[0].Diff, "+first") {
+		t.Errorf("show = %+v", show)
+	}
+	if code := call(handleStashShow, GitStashRequest{Index: 5}, nil); code != http.StatusNotFound {
+		t.Errorf("show missing: %d", code)
+	}
+
+	if code := call(handleStashApply, GitStashRequest{Index: 1}, nil); code != http.StatusOK {
+		t.Fatalf("apply: %d", code)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "a")); string(data) != "a\nfirst\n" {
+		t.Errorf("after apply a = %q", data)
+	}
+	git("checkout", "--", "a")
+
+	if code := call(handleStashPop, GitStashRequest{Index: 0}, nil); code != http.StatusOK {
+		t.Fatalf("pop: %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "new")); err != nil {
+		t.Errorf("pop did not restore untracked file: %v", err)
+	}
+	if code := call(handleStashDrop, GitStashRequest{Index: 0}, nil); code != http.StatusOK {
+		t.Fatalf("drop: %d", code)
+	}
+	if list := git("stash", "list"); list != "" {
+		t.Errorf("stash list after drop = %q", list)
+	}
+}
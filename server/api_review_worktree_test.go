@@ -0,0 +1,40 @@
+package server
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveWorktreeDir(t *testing.T) {
+	repo := t.TempDir()
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git(repo, "init", "-q", "-b", "main")
+	git(repo, "-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "init")
+	wtPath := filepath.Join(t.TempDir(), "feature")
+	git(repo, "worktree", "add", "-q", "-b", "feature", wtPath)
+	wtPath, _ = filepath.EvalSymlinks(wtPath)
+
+	for _, sel := range []string{"feature", wtPath} {
+		got, err := resolveWorktreeDir(repo, sel)
+		if err != nil {
+			t.Fatalf("resolveWorktreeDir(%q): %v", sel, err)
+		}
+		if resolved, _ := filepath.EvalSymlinks(got); resolved != wtPath {
+			t.Errorf("resolveWorktreeDir(%q) = %q, want %q", sel, got, wtPath)
+		}
+	}
+	if got, err := resolveWorktreeDir(repo, ""); err != nil || got != repo {
+		t.Errorf("empty selection = %q, %v", got, err)
+	}
+	if _, err := resolveWorktreeDir(repo, "missing"); err == nil {
+		t.Errorf("expected error for unknown worktree")
+	}
+}
@@ -0,0 +1,113 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// RegisterAPI registers the artifact endpoints:
+//
+//	GET    /api/artifacts?project_dir=...         -> [TaskInfo], newest first
+//	GET    /api/artifacts/{task}                  -> {task, files}
+//	GET    /api/artifacts/{task}/files/{path}     download one artifact
+//	POST   /api/artifacts/{task}/collect          -> {task, files, copied, error}
+//	DELETE /api/artifacts/{task}
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/artifacts", handleList)
+	mux.HandleFunc("/api/artifacts/", handleTask)
+}
+
+func handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	tasks, err := List(tenant.Name(r.Context()), r.URL.Query().Get("project_dir"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func handleTask(w http.ResponseWriter, r *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/artifacts/"), "/")
+	owner := tenant.Name(r.Context())
+	t, err := Get(owner, id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		files, err := t.Files()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"task": t, "files": files})
+	case rest == "" && r.Method == http.MethodDelete:
+		if err := Remove(owner, id); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case rest == "collect" && r.Method == http.MethodPost:
+		copied, err := t.Collect()
+		files, _ := t.Files()
+		resp := map[string]interface{}{"task": t, "files": files, "copied": copied}
+		if err != nil {
+			// partial collections still report what was copied
+			resp["error"] = err.Error()
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case strings.HasPrefix(rest, "files/") && r.Method == http.MethodGet:
+		p, err := t.Open(strings.TrimPrefix(rest, "files/"))
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "artifact not found"})
+			return
+		}
+		serveFile(w, r, p)
+	case rest == "" || rest == "collect" || strings.HasPrefix(rest, "files/"):
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// serveFile sends an artifact as a download; ?inline=1 lets the browser
+// show it instead (HTML reports, screenshots).
+func serveFile(w http.ResponseWriter, r *http.Request, p string) {
+	f, err := os.Open(p)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "artifact not found"})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "1" {
+		disposition = "inline"
+		// an agent-written page must not run scripts against this origin
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, filepath.Base(p)))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,403 @@
+// Package artifacts keeps the files agent sessions produce besides source
+// changes — coverage reports, built binaries, screenshots — so they can be
+// listed and downloaded from the phone, even after the session is gone.
+//
+// Each agent session is a task with its own directory under
+// config.ArtifactsDir (inside the tenant's namespace for members). The agent
+// may write there directly through $AI_CRITIC_ARTIFACTS_DIR; in addition,
+// after each run the files matching the task's declared output paths are
+// copied in by Collect.
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+const (
+	// MaxFileBytes is the largest file Collect copies.
+	MaxFileBytes = 256 << 20
+	// MaxTaskBytes bounds the total size of one task's artifacts.
+	MaxTaskBytes = 1 << 30
+	// Retention is how long a task's artifacts are kept.
+	Retention = 30 * 24 * time.Hour
+
+	metaFile = "task.json"
+	filesDir = "files"
+)
+
+// Task is the artifact collection of one agent session.
+type Task struct {
+	ID         string `json:"id"`
+	SessionID  string `json:"session_id"`
+	Agent      string `json:"agent"`
+	ProjectDir string `json:"project_dir"`
+	// Paths are the declared output paths: globs relative to ProjectDir,
+	// or absolute for the global namespace. A matching directory is
+	// collected with its content.
+	Paths       []string `json:"paths,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+	CollectedAt string   `json:"collected_at,omitempty"`
+
+	owner string
+}
+
+// Artifact is one collected file.
+type Artifact struct {
+	Path       string `json:"path"` // relative to the task's files directory
+	Size       int64  `json:"size"`
+	ModifiedAt string `json:"modified_at"`
+}
+
+// Summary is what an agent session reports about its artifacts.
+type Summary struct {
+	Task        string `json:"task"`
+	Files       int    `json:"files"`
+	Bytes       int64  `json:"bytes"`
+	CollectedAt string `json:"collected_at,omitempty"`
+}
+
+// TaskInfo is a task with the size of its artifacts, for listings.
+type TaskInfo struct {
+	Task
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+var (
+	// collectMu serializes collections and removals; runs of one session
+	// can end close together.
+	collectMu sync.Mutex
+	log       = logging.New("artifacts")
+
+	validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// rootOf returns the artifacts directory of a tenant.
+func rootOf(owner string) string {
+	return tenant.PathOf(owner, config.ArtifactsDir)
+}
+
+// NewTask creates the artifact directory of a session. Members may only
+// declare paths inside the project.
+func NewTask(owner, sessionID, agent, projectDir string, paths []string) (*Task, error) {
+	clean, err := checkPaths(owner, paths)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	t := &Task{
+		ID:         sessionID + "-" + now.Format("20060102-150405"),
+		SessionID:  sessionID,
+		Agent:      agent,
+		ProjectDir: projectDir,
+		Paths:      clean,
+		CreatedAt:  now.UTC().Format(time.RFC3339),
+		owner:      owner,
+	}
+	if !validID.MatchString(t.ID) {
+		return nil, fmt.Errorf("invalid session id: %q", sessionID)
+	}
+	if err := os.MkdirAll(t.Dir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+	prune(owner)
+	return t, nil
+}
+
+func checkPaths(owner string, paths []string) ([]string, error) {
+	var clean []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid artifact path %q: %v", p, err)
+		}
+		if owner != "" {
+			c := filepath.Clean(p)
+			if filepath.IsAbs(c) || c == ".." || strings.HasPrefix(c, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("artifact path %q is outside the project", p)
+			}
+		}
+		seen[p] = true
+		clean = append(clean, p)
+	}
+	return clean, nil
+}
+
+// Get loads a task of owner.
+func Get(owner, id string) (*Task, error) {
+	if !validID.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(rootOf(owner), id, metaFile))
+	if err != nil {
+		return nil, err
+	}
+	var t Task
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	t.owner = owner
+	return &t, nil
+}
+
+// List returns owner's tasks, newest first; with projectDir only those of
+// that project.
+func List(owner, projectDir string) ([]TaskInfo, error) {
+	entries, err := os.ReadDir(rootOf(owner))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TaskInfo{}, nil
+		}
+		return nil, err
+	}
+	tasks := []TaskInfo{}
+	for _, e := range entries {
+		t, err := Get(owner, e.Name())
+		if err != nil || (projectDir != "" && t.ProjectDir != projectDir) {
+			continue
+		}
+		s := t.Summary()
+		tasks = append(tasks, TaskInfo{Task: *t, Files: s.Files, Bytes: s.Bytes})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt > tasks[j].CreatedAt })
+	return tasks, nil
+}
+
+// Remove deletes a task and its artifacts.
+func Remove(owner, id string) error {
+	if _, err := Get(owner, id); err != nil {
+		return err
+	}
+	collectMu.Lock()
+	defer collectMu.Unlock()
+	return os.RemoveAll(filepath.Join(rootOf(owner), id))
+}
+
+// prune removes owner's tasks older than Retention.
+func prune(owner string) {
+	entries, err := os.ReadDir(rootOf(owner))
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-Retention).UTC().Format(time.RFC3339)
+	for _, e := range entries {
+		if t, err := Get(owner, e.Name()); err == nil && t.CreatedAt < cutoff {
+			Remove(owner, t.ID)
+		}
+	}
+}
+
+// Dir is where the task's artifacts are kept; agents get it as
+// $AI_CRITIC_ARTIFACTS_DIR.
+func (t *Task) Dir() string {
+	return filepath.Join(rootOf(t.owner), t.ID, filesDir)
+}
+
+func (t *Task) save() error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(rootOf(t.owner), t.ID, metaFile), data, 0644)
+}
+
+// Files lists the task's artifacts sorted by path.
+func (t *Task) Files() ([]Artifact, error) {
+	files := []Artifact{}
+	err := filepath.WalkDir(t.Dir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == t.Dir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(t.Dir(), p)
+		files = append(files, Artifact{
+			Path:       filepath.ToSlash(rel),
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// Summary counts the task's artifacts.
+func (t *Task) Summary() Summary {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+	return t.summary()
+}
+
+func (t *Task) summary() Summary {
+	s := Summary{Task: t.ID, CollectedAt: t.CollectedAt}
+	files, _ := t.Files()
+	for _, f := range files {
+		s.Files++
+		s.Bytes += f.Size
+	}
+	return s
+}
+
+// Open returns the path of the artifact at rel, refusing paths that leave
+// the task's directory.
+func (t *Task) Open(rel string) (string, error) {
+	c := filepath.Clean(filepath.FromSlash(rel))
+	if rel == "" || filepath.IsAbs(c) || c == ".." || strings.HasPrefix(c, ".."+string(filepath.Separator)) {
+		return "", os.ErrNotExist
+	}
+	p := filepath.Join(t.Dir(), c)
+	info, err := os.Lstat(p)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", os.ErrNotExist
+	}
+	return p, nil
+}
+
+// Collect copies the files matching the declared paths into the task's
+// directory and returns how many were new or changed. Files inside the
+// project keep their project-relative path; others their absolute path
+// without the leading slash. Symlinks, .git directories, files over
+// MaxFileBytes and anything past MaxTaskBytes are skipped.
+func (t *Task) Collect() (int, error) {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+
+	total := t.summary().Bytes
+	copied := 0
+	var errs []string
+	for _, pattern := range t.Paths {
+		abs := pattern
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(t.ProjectDir, pattern)
+		}
+		matches, _ := filepath.Glob(abs)
+		for _, m := range matches {
+			err := filepath.WalkDir(m, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() && d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				n, err := t.copyFile(p, &total)
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+				copied += n
+				return nil
+			})
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	t.CollectedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := t.save(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if copied > 0 {
+		log.Infof("collected %d artifact(s) of %s", copied, t.ID)
+	}
+	if len(errs) > 0 {
+		return copied, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return copied, nil
+}
+
+// destName is where src is kept inside the task's directory.
+func (t *Task) destName(src string) string {
+	if rel, err := filepath.Rel(t.ProjectDir, src); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return strings.TrimLeft(filepath.ToSlash(src), "/")
+}
+
+func (t *Task) copyFile(src string, total *int64) (int, error) {
+	if strings.HasPrefix(src, rootOf(t.owner)+string(filepath.Separator)) {
+		return 0, nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return 0, nil
+	}
+	if info.Size() > MaxFileBytes {
+		return 0, fmt.Errorf("%s: larger than %d MB", src, MaxFileBytes>>20)
+	}
+	dst := filepath.Join(t.Dir(), t.destName(src))
+	var prevSize int64
+	if prev, err := os.Stat(dst); err == nil {
+		if prev.Size() == info.Size() && !info.ModTime().After(prev.ModTime()) {
+			return 0, nil
+		}
+		prevSize = prev.Size()
+	}
+	if *total-prevSize+info.Size() > MaxTaskBytes {
+		return 0, fmt.Errorf("%s: task artifacts would exceed %d MB", src, MaxTaskBytes>>20)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return 0, err
+	}
+	// keep the source's time so an unchanged file is not copied again
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	*total += info.Size() - prevSize
+	return 1, nil
+}
@@ -0,0 +1,149 @@
+package artifacts
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func setup(t *testing.T) string {
+	t.Helper()
+	savedData, saved := config.DataDir, config.ArtifactsDir
+	config.DataDir = t.TempDir()
+	config.ArtifactsDir = config.DataDir + "/artifacts"
+	t.Cleanup(func() { config.DataDir, config.ArtifactsDir = savedData, saved })
+	return t.TempDir()
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	project := setup(t)
+	outside := t.TempDir()
+	write(t, filepath.Join(project, "coverage.html"), "<html>")
+	write(t, filepath.Join(project, "bin/app"), "ELF")
+	write(t, filepath.Join(project, "bin/.git/HEAD"), "ref")
+	write(t, filepath.Join(outside, "shot.png"), "PNG")
+	os.Symlink("/etc/hostname", filepath.Join(project, "bin/link"))
+
+	task, err := NewTask("", "agent-session-1", "Opencode", project, []string{"coverage.html", "bin", outside + "/*.png", "missing/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := task.Collect()
+	if err != nil || n != 3 {
+		t.Fatalf("collected %d, err %v", n, err)
+	}
+	files, _ := task.Files()
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	want := "bin/app,coverage.html," + strings.TrimPrefix(filepath.ToSlash(outside), "/") + "/shot.png"
+	if strings.Join(paths, ",") != want {
+		t.Errorf("files = %v, want %s", paths, want)
+	}
+
+	// unchanged files are not copied again; changed ones are
+	if n, _ := task.Collect(); n != 0 {
+		t.Errorf("recollected %d unchanged files", n)
+	}
+	write(t, filepath.Join(project, "coverage.html"), "<html>v2")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(project, "coverage.html"), future, future)
+	if n, _ := task.Collect(); n != 1 {
+		t.Errorf("collected %d after a change, want 1", n)
+	}
+
+	got, err := Get("", task.ID)
+	if err != nil || got.CollectedAt == "" || got.ProjectDir != project {
+		t.Errorf("task = %+v, %v", got, err)
+	}
+	if s := got.Summary(); s.Files != 3 || s.Bytes != int64(len("ELF<html>v2PNG")) {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+func TestMembersCannotDeclareOutsidePaths(t *testing.T) {
+	project := setup(t)
+	for _, p := range []string{"/etc/*", "../other/*"} {
+		if _, err := NewTask("alice", "agent-session-1", "a", project, []string{p}); err == nil {
+			t.Errorf("member declared %s", p)
+		}
+	}
+	task, err := NewTask("alice", "agent-session-1", "a", project, []string{"out/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("", task.ID); err == nil {
+		t.Error("member task visible in the global namespace")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	project := setup(t)
+	write(t, filepath.Join(project, "report/index.html"), "<h1>report</h1>")
+	task, err := NewTask("", "agent-session-2", "a", project, []string{"report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	do := func(method, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/artifacts/"+task.ID+"/collect"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"copied":1`) {
+		t.Fatalf("collect: %d %s", rec.Code, rec.Body)
+	}
+	rec := do(http.MethodGet, "/api/artifacts/"+task.ID+"/files/report/index.html")
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusOK || string(body) != "<h1>report</h1>" || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("download: %d %q %v", rec.Code, body, rec.Header())
+	}
+	// the mux redirects such paths; the handler must refuse them as well
+	rec = httptest.NewRecorder()
+	handleTask(rec, httptest.NewRequest(http.MethodGet, "/api/artifacts/"+task.ID+"/files/../task.json", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("escape: %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/artifacts?project_dir="+project); !strings.Contains(rec.Body.String(), `"files":1`) {
+		t.Errorf("list: %s", rec.Body)
+	}
+
+	// another tenant does not see the task
+	req := httptest.NewRequest(http.MethodGet, "/api/artifacts/"+task.ID, nil)
+	req = req.WithContext(auth.WithIdentity(context.Background(), &auth.Identity{User: "bob", Role: auth.RoleMember}))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("other tenant: %d", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, "/api/artifacts/"+task.ID); rec.Code != http.StatusOK {
+		t.Errorf("delete: %d", rec.Code)
+	}
+	if _, err := Get("", task.ID); err == nil {
+		t.Error("task still exists")
+	}
+}
@@ -0,0 +1,318 @@
+// Package audit keeps an append-only log of state-changing API calls: who
+// (user and token fingerprint) called which endpoint with which parameters,
+// and how it ended. Entries are JSON lines in config.AuditLogFile.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+const (
+	// maxParamsBytes bounds how much of a request body is recorded.
+	maxParamsBytes = 16 * 1024
+	redacted       = "[redacted]"
+)
+
+// sensitiveKeys are lowercase substrings of parameter names whose values
+// are never written to the log.
+var sensitiveKeys = []string{"password", "token", "credential", "secret", "private", "api_key", "apikey", "passphrase"}
+
+// Entry is one audited call or event.
+type Entry struct {
+	Time   string          `json:"time"` // RFC3339
+	User   string          `json:"user"` // user name, or "anonymous"
+	Role   string          `json:"role,omitempty"`
+	Token  string          `json:"token,omitempty"` // token fingerprint
+	Remote string          `json:"remote,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Status int             `json:"status,omitempty"`
+	// Event and Detail describe entries recorded by handlers (e.g. "agent-commit")
+	Event  string `json:"event,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	logPath = config.AuditLogFile
+)
+
+// SetFile points the audit log at path (used by tests).
+func SetFile(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	logPath = path
+}
+
+// Middleware records every non-GET /api/ request after it has been served,
+// including ones rejected by authentication. It must wrap auth.Middleware so
+// denied calls are seen too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		params := captureParams(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		e := newEntry(r)
+		e.Method = r.Method
+		e.Query = RedactQuery(r.URL.Query())
+		e.Params = params
+		e.Status = rec.status
+		write(e)
+	})
+}
+
+// Record appends an event raised by a handler, attributed to the user
+// making request r.
+func Record(r *http.Request, event, detail string) {
+	e := newEntry(r)
+	e.Event = event
+	e.Detail = detail
+	write(e)
+}
+
+func newEntry(r *http.Request) Entry {
+	e := Entry{
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		User:   "anonymous",
+		Remote: remoteAddr(r),
+		Path:   r.URL.Path,
+	}
+	tokenID, fingerprint := auth.IdentifyRequest(r)
+	id := auth.FromContext(r.Context())
+	if id == nil {
+		id = tokenID
+	}
+	if id != nil {
+		e.User = id.User
+		e.Role = string(id.Role)
+	}
+	e.Token = fingerprint
+	return e
+}
+
+func write(e Entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// Filter selects entries in Query. Zero fields match everything.
+type Filter struct {
+	User  string
+	Path  string // prefix of the endpoint path
+	Since time.Time
+}
+
+// Query returns the newest entries matching f, newest first, at most limit.
+func Query(f Filter, limit int) ([]Entry, error) {
+	mu.Lock()
+	file, err := os.Open(logPath)
+	mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var matched []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*maxParamsBytes)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if f.User != "" && e.User != f.User {
+			continue
+		}
+		if f.Path != "" && !strings.HasPrefix(e.Path, f.Path) {
+			continue
+		}
+		if !f.Since.IsZero() {
+			if t, err := time.Parse(time.RFC3339, e.Time); err != nil || t.Before(f.Since) {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, min(len(matched), limit))
+	for i := len(matched) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, matched[i])
+	}
+	return result, nil
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// captureParams reads the request body, restores it for the handler, and
+// returns a redacted copy suitable for the log.
+func captureParams(r *http.Request) json.RawMessage {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct != "" && !strings.Contains(ct, "json") {
+		// Uploads and other binary bodies: record the size only.
+		if r.ContentLength > 0 {
+			return json.RawMessage(fmt.Sprintf(`{"_body":"%s, %d bytes"}`, strings.ReplaceAll(ct, `"`, ""), r.ContentLength))
+		}
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxParamsBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	if len(data) > maxParamsBytes {
+		return json.RawMessage(`{"_truncated":true}`)
+	}
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		return nil
+	}
+	out, err := json.Marshal(Redact(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// Redact replaces the values of sensitive keys in a decoded JSON value, in
+// place, and returns it.
+func Redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if IsSensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = Redact(val)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = Redact(v[i])
+		}
+	}
+	return v
+}
+
+// RedactQuery encodes q with the values of sensitive keys replaced.
+func RedactQuery(q url.Values) string {
+	for k, vals := range q {
+		if IsSensitive(k) {
+			for i := range vals {
+				vals[i] = redacted
+			}
+		}
+	}
+	return q.Encode()
+}
+
+// IsSensitive reports whether a parameter named key holds a secret.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr prefers the client address reported by Cloudflare or another
+// reverse proxy, since tunneled requests all arrive from localhost.
+func remoteAddr(r *http.Request) string {
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return ip
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// statusRecorder captures the response status while passing through
+// streaming (Flusher) support.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+func TestMiddlewareRecordsMutatingCalls(t *testing.T) {
+	dir := t.TempDir()
+	SetFile(filepath.Join(dir, "audit.log"))
+	credFile := filepath.Join(dir, "credentials")
+	os.WriteFile(credFile, []byte("secret-token\n"), 0600)
+	auth.SetCredentialsFile(credFile)
+	auth.SetUsersFile(filepath.Join(dir, "users.json"))
+
+	var gotBody string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		gotBody = string(data)
+	})
+	handler := Middleware(auth.Middleware(mux, nil))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{name: "commit", method: http.MethodPost, path: "/api/review/commit", token: "secret-token", body: `{"dir":"/repo","message":"m"}`, wantStatus: 200},
+		{name: "redacted params", method: http.MethodPost, path: "/api/auth/tokens", token: "secret-token", body: `{"user":"bob","password":"hunter2"}`, wantStatus: 200},
+		{name: "reads are not audited", method: http.MethodGet, path: "/api/review/status", token: "secret-token"},
+		{name: "rejected call", method: http.MethodDelete, path: "/api/projects?id=1", token: "wrong", wantStatus: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if tt.wantStatus == 200 && gotBody != tt.body {
+				t.Errorf("handler saw body %q, want %q", gotBody, tt.body)
+			}
+		})
+	}
+
+	entries, err := Query(Filter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+	// newest first
+	rejected, tokens, commit := entries[0], entries[1], entries[2]
+	if rejected.Status != 401 || rejected.User != "anonymous" || rejected.Query != "id=1" || rejected.Token == "" {
+		t.Errorf("rejected entry = %+v", rejected)
+	}
+	if strings.Contains(string(tokens.Params), "hunter2") || !strings.Contains(string(tokens.Params), `"user":"bob"`) {
+		t.Errorf("params not redacted: %s", tokens.Params)
+	}
+	if commit.User != "admin" || commit.Path != "/api/review/commit" || commit.Token != auth.Fingerprint("secret-token") {
+		t.Errorf("commit entry = %+v", commit)
+	}
+
+	if got, _ := Query(Filter{Path: "/api/review/"}, 10); len(got) != 1 {
+		t.Errorf("path filter returned %d entries", len(got))
+	}
+}
@@ -56,17 +56,44 @@ func loadCredentials() (map[string]bool, error) {
 	return tokens, scanner.Err()
 }
 
-// loadAndCheckToken loads the credentials file once and returns whether
-// the server is initialized and whether the given token is valid.
+// loadAndCheckToken reports whether the server is initialized (any
+// credentials-file token or active user token exists) and whether the given
+// token is valid.
 func loadAndCheckToken(token string) (initialized bool, valid bool) {
-	tokens, err := loadCredentials()
-	if err != nil || len(tokens) == 0 {
-		return false, false
+	id, initialized := identify(token)
+	return initialized, id != nil
+}
+
+// Initialized reports whether any credential or user token exists, i.e.
+// whether first-run setup has been done.
+func Initialized() bool {
+	initialized, _ := loadAndCheckToken("")
+	return initialized
+}
+
+// GenerateCredential returns a new random 64-character hex credential.
+func GenerateCredential() (string, error) {
+	// Generate 32 random bytes, then SHA-256 hash to produce a 64-char hex credential
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %v", err)
 	}
-	if token == "" {
-		return true, false
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// protectedPrefixes are the path prefixes that require authentication; the
+// rest (the frontend's static files) is public. Besides the API, they cover
+// endpoints whose paths are fixed by convention, such as /metrics.
+var protectedPrefixes = []string{"/api/", "/metrics", "/debug/pprof"}
+
+func protected(path string) bool {
+	for _, prefix := range protectedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
 	}
-	return true, tokens[token]
+	return false
 }
 
 // Middleware returns an http.Handler that checks for a valid auth cookie.
@@ -85,8 +112,8 @@ func Middleware(next http.Handler, skipPaths []string) http.Handler {
 			return
 		}
 
-		// Only check auth for /api/* paths
-		if !strings.HasPrefix(r.URL.Path, "/api/") {
+		// Only check auth for /api/* and the other protected paths
+		if !protected(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -124,8 +151,13 @@ func Middleware(next http.Handler, skipPaths []string) http.Handler {
 			token = bearerToken
 		}
 
-		// Load credentials once: check initialization and token validity
-		initialized, valid := loadAndCheckToken(token)
+		// Resolve the token to a user: checks initialization and validity,
+		// throttling clients that keep presenting bad tokens
+		id, initialized, wait := throttledIdentify(r, token)
+		if wait > 0 {
+			writeThrottled(w, wait, map[string]any{"error": "too_many_attempts"})
+			return
+		}
 
 		if !initialized {
 			w.Header().Set("Content-Type", "application/json")
@@ -134,17 +166,69 @@ func Middleware(next http.Handler, skipPaths []string) http.Handler {
 			return
 		}
 
-		if !valid {
+		if id == nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if !authorize(id, r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
 	})
 }
 
+// UserID returns a stable, non-secret identifier for the user or credential
+// the request was authenticated with, for keying per-user state. Named users
+// are keyed by name so all their tokens share state; credentials-file tokens
+// by their fingerprint. Requests without a token (e.g. quicktest mode)
+// share the ID "local".
+func UserID(r *http.Request) string {
+	if id := FromContext(r.Context()); id != nil && id.TokenID != "" {
+		return "user:" + id.User
+	}
+	token := requestToken(r)
+	if token == "" {
+		return "local"
+	}
+	return Fingerprint(token)
+}
+
+// Fingerprint returns a short non-secret identifier of a token.
+func Fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// requestToken returns the token from the auth cookie, or else from a
+// Bearer Authorization header.
+func requestToken(r *http.Request) string {
+	if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	return ""
+}
+
+// IdentifyRequest resolves the request's token outside of Middleware, e.g.
+// for handlers wrapping it. It returns nil and a "" fingerprint when the
+// request carries no token, and nil with the fingerprint for invalid ones.
+func IdentifyRequest(r *http.Request) (*Identity, string) {
+	token := requestToken(r)
+	if token == "" {
+		return nil, ""
+	}
+	id, _ := identify(token)
+	return id, Fingerprint(token)
+}
+
 // LoginRequest represents the login request body
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -240,6 +324,15 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/auth/credentials", handleListCredentials)
 	mux.HandleFunc("/api/auth/credentials/add", handleAddCredential)
 	mux.HandleFunc("/api/auth/credentials/generate", handleGenerateCredential)
+	mux.HandleFunc("/api/auth/me", handleMe)
+	mux.HandleFunc("/api/auth/users", handleUsers)
+	mux.HandleFunc("/api/auth/tokens", handleIssueToken)
+	mux.HandleFunc("/api/auth/tokens/revoke", handleRevokeToken)
+	mux.HandleFunc("/api/auth/lockouts", handleLockouts)
+	mux.HandleFunc("/api/auth/oidc", handleOIDCConfig)
+	mux.HandleFunc("/api/auth/sso", handleSSOInfo)
+	mux.HandleFunc("/api/auth/sso/login", handleSSOLogin)
+	mux.HandleFunc(callbackPath, handleSSOCallback)
 }
 
 func handleAuthCheck(w http.ResponseWriter, r *http.Request) {
@@ -272,7 +365,12 @@ func handleAuthCheck(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	initialized, valid := loadAndCheckToken(token)
+	id, initialized, wait := throttledIdentify(r, token)
+	if wait > 0 {
+		writeThrottled(w, wait, map[string]any{"error": "too_many_attempts"})
+		return
+	}
+	valid := id != nil
 
 	if !initialized {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -319,7 +417,12 @@ func handleAuthStatus(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	initialized, valid := loadAndCheckToken(token)
+	id, initialized, wait := throttledIdentify(r, token)
+	if wait > 0 {
+		writeThrottled(w, wait, map[string]any{"status": "too_many_attempts", "initialized": true})
+		return
+	}
+	valid := id != nil
 
 	if !initialized {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -444,16 +547,13 @@ func handleGenerateCredential(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate 32 random bytes, then SHA-256 hash to produce a 64-char hex credential
-	raw := make([]byte, 32)
-	if _, err := rand.Read(raw); err != nil {
+	credential, err := GenerateCredential()
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("failed to generate random bytes: %v", err)})
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
-	hash := sha256.Sum256(raw)
-	credential := hex.EncodeToString(hash[:])
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"credential": credential})
@@ -481,8 +581,12 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Password must match any line in the credentials file
-	_, valid := loadAndCheckToken(req.Password)
-	if !valid {
+	id, _, wait := throttledIdentify(r, req.Password)
+	if wait > 0 {
+		writeThrottled(w, wait, map[string]any{"error": throttledMessage(wait)})
+		return
+	}
+	if id == nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]string{"error": "invalid credentials"})
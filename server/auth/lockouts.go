@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth/ratelimit"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// Lockout sources reported by /api/auth/lockouts.
+const (
+	LockoutSourceServer = "server"
+	LockoutSourceProxy  = "basic-auth-proxy"
+)
+
+var (
+	// loginLimiter throttles token guesses against the API and /api/login.
+	loginLimiter = ratelimit.New(ratelimit.LoadConfig(config.AuthRateLimitFile))
+	// proxyLockouts is a view of the basic-auth-proxy's limiter, which runs
+	// in its own process and shares its state through a file.
+	proxyLockouts = ratelimit.NewFile(ratelimit.LoadConfig(config.AuthRateLimitFile), config.BasicAuthLockoutsFile)
+)
+
+// SetRateLimitConfig replaces the login limiter with a fresh one using cfg
+// (used by tests).
+func SetRateLimitConfig(cfg ratelimit.Config) {
+	loginLimiter = ratelimit.New(cfg)
+}
+
+// throttledIdentify resolves token like identify, subject to the per-IP
+// login limiter: while the client is backing off or locked out no token is
+// checked and wait is positive. Requests without a token are not counted.
+func throttledIdentify(r *http.Request, token string) (id *Identity, initialized bool, wait time.Duration) {
+	if token == "" {
+		id, initialized = identify(token)
+		return id, initialized, 0
+	}
+	ip := ratelimit.ClientIP(r)
+	if wait, ok := loginLimiter.Allow(ip); !ok {
+		return nil, true, wait
+	}
+	id, initialized = identify(token)
+	if !initialized {
+		return nil, false, 0
+	}
+	if id == nil {
+		loginLimiter.Fail(ip, Fingerprint(token))
+	} else {
+		loginLimiter.Succeed(ip)
+	}
+	return id, true, 0
+}
+
+// ThrottledIdentifyRequest is IdentifyRequest for handlers on paths that
+// skip Middleware: bad tokens count against the client's IP as they do
+// there, and while the client is locked out no token is checked and wait is
+// positive (answer with WriteThrottled).
+func ThrottledIdentifyRequest(r *http.Request) (id *Identity, wait time.Duration) {
+	id, _, wait = throttledIdentify(r, requestToken(r))
+	return id, wait
+}
+
+// WriteThrottled answers a request throttled by ThrottledIdentifyRequest.
+func WriteThrottled(w http.ResponseWriter, wait time.Duration) {
+	writeThrottled(w, wait, map[string]any{"error": "too_many_attempts"})
+}
+
+// writeThrottled answers a throttled request with 429 and Retry-After.
+func writeThrottled(w http.ResponseWriter, wait time.Duration, body map[string]any) {
+	secs := int((wait + time.Second - 1) / time.Second)
+	body["retry_after"] = secs
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+}
+
+func throttledMessage(wait time.Duration) string {
+	return fmt.Sprintf("too many failed attempts; try again in %s", wait.Round(time.Second))
+}
+
+// Lockout is a throttled client as reported by /api/auth/lockouts.
+type Lockout struct {
+	ratelimit.State
+	Source string `json:"source"`
+}
+
+// handleLockouts lists throttled clients of the server and the
+// basic-auth-proxy (GET), or resets them (POST {"ip": "", "source": ""};
+// empty fields match everything).
+func handleLockouts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lockouts := []Lockout{}
+		for _, s := range loginLimiter.List() {
+			lockouts = append(lockouts, Lockout{State: s, Source: LockoutSourceServer})
+		}
+		for _, s := range proxyLockouts.List() {
+			lockouts = append(lockouts, Lockout{State: s, Source: LockoutSourceProxy})
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"lockouts": lockouts,
+			"config":   ratelimit.LoadConfig(config.AuthRateLimitFile),
+		})
+	case http.MethodPost:
+		var req struct {
+			IP     string `json:"ip"`
+			Source string `json:"source"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		cleared := 0
+		switch req.Source {
+		case "":
+			cleared = loginLimiter.Reset(req.IP) + proxyLockouts.Reset(req.IP)
+		case LockoutSourceServer:
+			cleared = loginLimiter.Reset(req.IP)
+		case LockoutSourceProxy:
+			cleared = proxyLockouts.Reset(req.IP)
+		default:
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown source: " + req.Source})
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]int{"cleared": cleared})
+	default:
+		respondJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth/ratelimit"
+)
+
+func TestMiddlewareThrottlesBadTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	credFile := filepath.Join(tmpDir, "credentials")
+	SetCredentialsFile(credFile)
+	SetUsersFile(filepath.Join(tmpDir, "users.json"))
+	os.WriteFile(credFile, []byte("good-token\n"), 0600)
+	SetRateLimitConfig(ratelimit.Config{FreeAttempts: 2, LockoutAfter: 3, LockoutSeconds: 60})
+	defer SetRateLimitConfig(ratelimit.DefaultConfig)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+	call := func(remote, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/activity", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// repeating one stale token is not brute force
+	for i := 0; i < 5; i++ {
+		if code := call("203.0.113.1:1000", "stale").Code; code != http.StatusUnauthorized {
+			t.Fatalf("stale token call %d: code %d, want 401", i, code)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		call("203.0.113.2:1000", fmt.Sprintf("guess-%d", i))
+	}
+	rec := call("203.0.113.2:1000", "good-token")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locked-out client: code %d Retry-After %q, want 429 60", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if code := call("203.0.113.3:1000", "good-token").Code; code != http.StatusOK {
+		t.Errorf("other client: code %d, want 200", code)
+	}
+
+	// the admin endpoint lists and resets the lockout
+	list := httptest.NewRecorder()
+	handleLockouts(list, httptest.NewRequest(http.MethodGet, "/api/auth/lockouts", nil))
+	var resp struct {
+		Lockouts []Lockout `json:"lockouts"`
+	}
+	json.NewDecoder(list.Body).Decode(&resp)
+	found := false
+	for _, l := range resp.Lockouts {
+		if l.Key == "203.0.113.2" && l.LockedOut && l.Source == LockoutSourceServer {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("lockout not listed: %+v", resp.Lockouts)
+	}
+
+	reset := httptest.NewRecorder()
+	handleLockouts(reset, httptest.NewRequest(http.MethodPost, "/api/auth/lockouts", strings.NewReader(`{"ip":"203.0.113.2","source":"server"}`)))
+	if reset.Code != http.StatusOK {
+		t.Fatalf("reset: code %d %s", reset.Code, reset.Body)
+	}
+	if code := call("203.0.113.2:1000", "good-token").Code; code != http.StatusOK {
+		t.Errorf("after reset: code %d, want 200", code)
+	}
+}
+
+func TestThrottledIdentifyRequest(t *testing.T) {
+	tmpDir := t.TempDir()
+	credFile := filepath.Join(tmpDir, "credentials")
+	SetCredentialsFile(credFile)
+	SetUsersFile(filepath.Join(tmpDir, "users.json"))
+	os.WriteFile(credFile, []byte("good-token\n"), 0600)
+	SetRateLimitConfig(ratelimit.Config{FreeAttempts: 2, LockoutAfter: 3, LockoutSeconds: 60})
+	defer SetRateLimitConfig(ratelimit.DefaultConfig)
+
+	check := func(token string) (*Identity, time.Duration) {
+		req := httptest.NewRequest(http.MethodGet, "/api/setup/status", nil)
+		req.RemoteAddr = "203.0.113.4:1000"
+		req.Header.Set("Authorization", "Bearer "+token)
+		return ThrottledIdentifyRequest(req)
+	}
+	if id, wait := check("good-token"); id == nil || wait != 0 {
+		t.Fatalf("good token: %v, %v", id, wait)
+	}
+	for i := 0; i < 3; i++ {
+		check(fmt.Sprintf("guess-%d", i))
+	}
+	if id, wait := check("good-token"); id != nil || wait <= 0 {
+		t.Errorf("locked-out client: %v, %v; want no identity and a wait", id, wait)
+	}
+}
@@ -0,0 +1,487 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+// as an alternative to tokens. A successful login issues a user token and
+// sets it as the session cookie, like /api/login does.
+type OIDCConfig struct {
+	Enabled      bool     `json:"enabled"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"` // default: openid profile email
+	// RedirectURL overrides the callback URL registered with the provider;
+	// by default it is derived from the request host.
+	RedirectURL string `json:"redirect_url,omitempty"`
+
+	// UsernameClaim names the claim used as user name; default
+	// preferred_username, falling back to email.
+	UsernameClaim string `json:"username_claim,omitempty"`
+	// RolesClaim names a claim (string or array, e.g. "groups") whose
+	// values are looked up in RoleMapping. The most privileged match wins.
+	RolesClaim  string          `json:"roles_claim,omitempty"`
+	RoleMapping map[string]Role `json:"role_mapping,omitempty"`
+	// DefaultRole is given to new users no mapping matched; empty refuses
+	// them.
+	DefaultRole Role `json:"default_role,omitempty"`
+}
+
+var (
+	oidcMu   sync.Mutex
+	oidcFile = jsonfile.New[OIDCConfig](config.OIDCFile)
+)
+
+// SetOIDCFile points the OIDC configuration at path (used by tests).
+func SetOIDCFile(path string) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	oidcFile = jsonfile.New[OIDCConfig](path)
+}
+
+func getOIDCConfig() OIDCConfig {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	c, _ := oidcFile.Get()
+	return c
+}
+
+func (c OIDCConfig) active() bool {
+	return c.Enabled && c.Issuer != "" && c.ClientID != ""
+}
+
+func (c OIDCConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Issuer == "" || c.ClientID == "" {
+		return fmt.Errorf("issuer and client_id are required")
+	}
+	if u, err := url.Parse(c.Issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid issuer URL: %q", c.Issuer)
+	}
+	for value, role := range c.RoleMapping {
+		if !validRole(role) {
+			return fmt.Errorf("invalid role %q for %q", role, value)
+		}
+	}
+	if c.DefaultRole != "" && !validRole(c.DefaultRole) {
+		return fmt.Errorf("invalid default role: %q", c.DefaultRole)
+	}
+	return nil
+}
+
+func validRole(role Role) bool {
+	return role == RoleAdmin || role == RoleReviewer || role == RoleMember
+}
+
+// rolePriority orders roles from least to most privileged.
+var rolePriority = map[Role]int{RoleReviewer: 1, RoleMember: 2, RoleAdmin: 3}
+
+// mapClaims returns the user name and the role the claims map to; role is
+// empty when no mapping matched.
+func (c OIDCConfig) mapClaims(claims idTokenClaims) (name string, role Role) {
+	if c.UsernameClaim != "" {
+		name, _ = claims[c.UsernameClaim].(string)
+	} else if name, _ = claims["preferred_username"].(string); name == "" {
+		name, _ = claims["email"].(string)
+	}
+	if c.RolesClaim != "" {
+		for _, v := range claims.list(c.RolesClaim) {
+			if r, ok := c.RoleMapping[v]; ok && rolePriority[r] > rolePriority[role] {
+				role = r
+			}
+		}
+	}
+	return strings.TrimSpace(name), role
+}
+
+// ---- login flow ----
+
+const (
+	oidcStateCookie = "ai-critic-oidc-state"
+	oidcLoginTTL    = 10 * time.Minute
+	callbackPath    = "/api/auth/sso/callback"
+)
+
+// pendingLogin is a started authorization, keyed by its state parameter.
+type pendingLogin struct {
+	nonce       string
+	verifier    string // PKCE code verifier
+	redirectURI string
+	returnTo    string
+	expires     time.Time
+}
+
+var (
+	pendingMu     sync.Mutex
+	pendingLogins = map[string]pendingLogin{}
+)
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func redirectURI(c OIDCConfig, r *http.Request) string {
+	if c.RedirectURL != "" {
+		return c.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + callbackPath
+}
+
+// handleSSOInfo tells the login page whether SSO is available.
+func handleSSOInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !getOIDCConfig().active() {
+		respondJSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"enabled": true, "login_url": "/api/auth/sso/login"})
+}
+
+// handleSSOLogin redirects the browser to the provider's authorization
+// endpoint. ?return_to= is a local path to land on after login.
+func handleSSOLogin(w http.ResponseWriter, r *http.Request) {
+	c := getOIDCConfig()
+	if !c.active() {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+		return
+	}
+	p, err := discover(r.Context(), c.Issuer, false)
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	returnTo := r.URL.Query().Get("return_to")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = "/"
+	}
+	state := randomString()
+	login := pendingLogin{
+		nonce:       randomString(),
+		verifier:    randomString() + randomString(),
+		redirectURI: redirectURI(c, r),
+		returnTo:    returnTo,
+		expires:     time.Now().Add(oidcLoginTTL),
+	}
+	pendingMu.Lock()
+	for s, l := range pendingLogins {
+		if time.Now().After(l.expires) {
+			delete(pendingLogins, s)
+		}
+	}
+	pendingLogins[state] = login
+	pendingMu.Unlock()
+
+	// bind the state to this browser so a callback cannot be replayed in
+	// another one
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     callbackPath,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+	})
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	challenge := sha256.Sum256([]byte(login.verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {login.redirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// handleSSOCallback completes the login: it exchanges the code, verifies
+// the ID token, maps its claims to a user and starts a cookie session.
+func handleSSOCallback(w http.ResponseWriter, r *http.Request) {
+	c := getOIDCConfig()
+	if !c.active() {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "sign-in failed: " + e, "description": q.Get("error_description")})
+		return
+	}
+
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid login state"})
+		return
+	}
+	pendingMu.Lock()
+	login, ok := pendingLogins[state]
+	delete(pendingLogins, state)
+	pendingMu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "login expired, please try again"})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: callbackPath, MaxAge: -1})
+
+	p, err := discover(r.Context(), c.Issuer, false)
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	rawIDToken, err := exchangeCode(r, p, c, login, q.Get("code"))
+	if err != nil {
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	claims, err := verifyIDToken(r.Context(), p, c.Issuer, c.ClientID, login.nonce, rawIDToken)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+
+	name, err := provisionSSOUser(c, claims)
+	if err != nil {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+	var current string
+	if cookie, err := r.Cookie(cookieName); err == nil {
+		current = cookie.Value
+	}
+	secret, err := ssoSession(name, current)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    secret,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   365 * 24 * 3600, // 1 year
+	})
+	http.Redirect(w, r, login.returnTo, http.StatusFound)
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and
+// returns the raw ID token.
+func exchangeCode(r *http.Request, p *oidcProvider, c OIDCConfig, login pendingLogin, code string) (string, error) {
+	if code == "" {
+		return "", fmt.Errorf("missing authorization code")
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {login.redirectURI},
+		"code_verifier": {login.verifier},
+	}
+	if c.ClientSecret == "" {
+		form.Set("client_id", c.ClientID)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token request failed: %s %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// provisionSSOUser returns the user the provider account of claims signs
+// in as: the user created by its first login, whose role a matched role
+// mapping updates, or a new user named by the claims with the mapped role
+// or DefaultRole. A login is never attached to an existing user it did not
+// create, so a provider account cannot take over a local one of the same
+// name.
+func provisionSSOUser(c OIDCConfig, claims idTokenClaims) (string, error) {
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	if iss == "" || sub == "" {
+		return "", fmt.Errorf("id token has no iss or sub claim")
+	}
+	account := SSOAccount{Issuer: strings.TrimSuffix(iss, "/"), Subject: sub}
+	name, role := c.mapClaims(claims)
+
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	err := usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			u := &st.Users[i]
+			if u.SSO != nil && *u.SSO == account {
+				if role != "" {
+					u.Role = role
+				}
+				name = u.Name
+				return nil
+			}
+		}
+		if name == "" {
+			return fmt.Errorf("id token has no user name claim")
+		}
+		if name == legacyUser {
+			return fmt.Errorf("%q is reserved for credentials-file tokens", legacyUser)
+		}
+		for _, u := range st.Users {
+			if u.Name == name {
+				return fmt.Errorf("user %s exists and was not created by this single sign-on account", name)
+			}
+		}
+		if role == "" {
+			role = c.DefaultRole
+		}
+		if role == "" {
+			return fmt.Errorf("user %s is not allowed to sign in", name)
+		}
+		st.Users = append(st.Users, User{
+			Name:      name,
+			Role:      role,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			SSO:       &account,
+		})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ssoSession returns the session token of a single sign-on login of name.
+// The browser's current token is kept if it is still an SSO session of
+// name; otherwise a new one is issued and name's previous SSO sessions are
+// revoked, so logins do not pile up live tokens.
+func ssoSession(name, current string) (string, error) {
+	tok, secret, err := newToken("sso")
+	if err != nil {
+		return "", err
+	}
+	tok.SSO = true
+	currentHash := ""
+	if current != "" {
+		currentHash = hashToken(current)
+	}
+
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	err = usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			u := &st.Users[i]
+			if u.Name != name {
+				continue
+			}
+			for _, t := range u.Tokens {
+				if t.SSO && t.RevokedAt == "" && currentHash != "" && t.Hash == currentHash {
+					secret = current
+					return nil
+				}
+			}
+			now := time.Now().UTC().Format(time.RFC3339)
+			for j := range u.Tokens {
+				if u.Tokens[j].SSO && u.Tokens[j].RevokedAt == "" {
+					u.Tokens[j].RevokedAt = now
+				}
+			}
+			u.Tokens = append(u.Tokens, tok)
+			return nil
+		}
+		return fmt.Errorf("user not found: %s", name)
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// handleOIDCConfig reads (GET, secret masked) and replaces (POST) the SSO
+// configuration. Admin only, enforced by Middleware.
+func handleOIDCConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c OIDCConfig
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		c.Issuer = strings.TrimSuffix(strings.TrimSpace(c.Issuer), "/")
+		if err := c.validate(); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		oidcMu.Lock()
+		// the GET response only carries the masked secret back
+		if old, _ := oidcFile.Get(); c.ClientSecret == "" || c.ClientSecret == maskToken(old.ClientSecret) {
+			c.ClientSecret = old.ClientSecret
+		}
+		err := oidcFile.Set(c)
+		oidcMu.Unlock()
+		if err != nil {
+			respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := getOIDCConfig()
+	c.ClientSecret = maskToken(c.ClientSecret)
+	respondJSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a minimal OpenID provider issuing RS256 ID tokens with
+// the claims of the next login.
+type fakeProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+	nonce  string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "s3cret" || r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]any{"iss": p.URL, "aud": "client", "exp": time.Now().Add(time.Hour).Unix(), "nonce": p.nonce}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) sign(claims map[string]any) string {
+	seg := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := seg(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + seg(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestSSOLogin(t *testing.T) {
+	tmpDir := t.TempDir()
+	SetCredentialsFile(filepath.Join(tmpDir, "credentials"))
+	SetUsersFile(filepath.Join(tmpDir, "users.json"))
+	SetOIDCFile(filepath.Join(tmpDir, "oidc.json"))
+
+	p := newFakeProvider(t)
+	oidcFile.Set(OIDCConfig{
+		Enabled:      true,
+		Issuer:       p.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cret",
+		RolesClaim:   "groups",
+		RoleMapping:  map[string]Role{"devs": RoleMember, "ops": RoleAdmin},
+	})
+	SaveUser("erin", RoleReviewer)
+
+	// login starts the flow and returns the session cookie, or the status
+	// the callback failed with
+	login := func(claims map[string]any, code string, session ...*http.Cookie) (*http.Cookie, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleSSOLogin(rec, httptest.NewRequest(http.MethodGet, "/api/auth/sso/login?return_to=/projects", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login: %d %s", rec.Code, rec.Body.String())
+		}
+		loc, _ := url.Parse(rec.Header().Get("Location"))
+		q := loc.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+			t.Fatalf("authorize URL = %s", loc)
+		}
+		p.claims, p.nonce = claims, q.Get("nonce")
+
+		req := httptest.NewRequest(http.MethodGet, callbackPath+"?code="+code+"&state="+q.Get("state"), nil)
+		req.AddCookie(rec.Result().Cookies()[0])
+		for _, c := range session {
+			req.AddCookie(c)
+		}
+		rec = httptest.NewRecorder()
+		handleSSOCallback(rec, req)
+		if rec.Code != http.StatusFound {
+			return nil, rec.Code
+		}
+		if loc := rec.Header().Get("Location"); loc != "/projects" {
+			t.Errorf("callback redirect = %q", loc)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == cookieName {
+				return c, rec.Code
+			}
+		}
+		t.Fatal("callback set no session cookie")
+		return nil, 0
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		code   string
+		status int
+		role   Role
+	}{
+		{"mapped group creates member", map[string]any{"sub": "1", "preferred_username": "dave", "groups": []string{"devs"}}, "good-code", http.StatusFound, RoleMember},
+		{"most privileged group wins", map[string]any{"sub": "2", "preferred_username": "frank", "groups": []string{"devs", "ops"}}, "good-code", http.StatusFound, RoleAdmin},
+		{"local user not taken over", map[string]any{"sub": "3", "email": "erin", "groups": []string{"ops"}}, "good-code", http.StatusForbidden, ""},
+		{"other account with a taken name", map[string]any{"sub": "4", "preferred_username": "dave"}, "good-code", http.StatusForbidden, ""},
+		{"linked by sub, not name", map[string]any{"sub": "1", "preferred_username": "david"}, "good-code", http.StatusFound, RoleMember},
+		{"mapping updates a linked user", map[string]any{"sub": "1", "groups": []string{"ops"}}, "good-code", http.StatusFound, RoleAdmin},
+		{"no sub", map[string]any{"preferred_username": "gina", "groups": []string{"devs"}}, "good-code", http.StatusForbidden, ""},
+		{"unknown user refused", map[string]any{"sub": "5", "preferred_username": "mallory"}, "good-code", http.StatusForbidden, ""},
+		{"bad code", map[string]any{"sub": "1", "preferred_username": "dave"}, "bad-code", http.StatusBadGateway, ""},
+		{"wrong nonce", map[string]any{"sub": "1", "preferred_username": "dave", "nonce": "other"}, "good-code", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		cookie, status := login(tt.claims, tt.code)
+		if status != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.status)
+			continue
+		}
+		if cookie == nil {
+			continue
+		}
+		id, _ := identify(cookie.Value)
+		if id == nil || id.Role != tt.role {
+			t.Errorf("%s: session identity = %+v, want role %s", tt.name, id, tt.role)
+		}
+	}
+
+	if users, _ := ListUsers(); len(users) != 3 || users[0].Name != "dave" || users[1].Name != "erin" || users[1].Role != RoleReviewer || users[1].SSO != nil {
+		t.Errorf("users = %+v", users)
+	}
+
+	// a browser signing in again keeps its session; a new one replaces it
+	first, _ := login(map[string]any{"sub": "2"}, "good-code")
+	again, _ := login(map[string]any{"sub": "2"}, "good-code", first)
+	if again.Value != first.Value {
+		t.Errorf("signing in again issued a new token")
+	}
+	second, _ := login(map[string]any{"sub": "2"}, "good-code")
+	if id, _ := identify(first.Value); id != nil {
+		t.Errorf("previous SSO session still valid: %+v", id)
+	}
+	if id, _ := identify(second.Value); id == nil || id.User != "frank" {
+		t.Errorf("new SSO session = %+v", id)
+	}
+
+	// a callback without the browser's state cookie is rejected
+	rec := httptest.NewRecorder()
+	handleSSOCallback(rec, httptest.NewRequest(http.MethodGet, callbackPath+"?code=good-code&state=forged", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("forged state: %d", rec.Code)
+	}
+}
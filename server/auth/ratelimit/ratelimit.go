@@ -0,0 +1,356 @@
+// Package ratelimit throttles failed login attempts per client IP. Each
+// failure beyond a free allowance imposes an exponentially growing delay
+// before the next attempt is accepted, and enough consecutive failures lock
+// the client out for a while. A success clears the client's record.
+//
+// It depends only on the standard library so standalone binaries such as
+// basic-auth-proxy can share it with the server.
+package ratelimit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config tunes a Limiter. Durations are in seconds so the JSON file stays
+// hand-editable; zero fields take the DefaultConfig value.
+type Config struct {
+	// FreeAttempts failures are allowed before backoff starts.
+	FreeAttempts int `json:"free_attempts,omitempty"`
+	// BaseDelaySeconds is the delay after the first failure beyond
+	// FreeAttempts; it doubles with each further failure.
+	BaseDelaySeconds int `json:"base_delay_seconds,omitempty"`
+	// MaxDelaySeconds caps the backoff delay.
+	MaxDelaySeconds int `json:"max_delay_seconds,omitempty"`
+	// LockoutAfter consecutive failures lock the client out.
+	LockoutAfter int `json:"lockout_after,omitempty"`
+	// LockoutSeconds is how long a lockout lasts.
+	LockoutSeconds int `json:"lockout_seconds,omitempty"`
+	// ForgetAfterSeconds drops a client's record after this long without a
+	// failure.
+	ForgetAfterSeconds int `json:"forget_after_seconds,omitempty"`
+	// Disabled turns throttling off.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// DefaultConfig allows 5 free failures, then backs off from 1s up to 60s,
+// and locks a client out for 15 minutes after 10 consecutive failures.
+var DefaultConfig = Config{
+	FreeAttempts:       5,
+	BaseDelaySeconds:   1,
+	MaxDelaySeconds:    60,
+	LockoutAfter:       10,
+	LockoutSeconds:     15 * 60,
+	ForgetAfterSeconds: 60 * 60,
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig
+	if c.FreeAttempts > 0 {
+		d.FreeAttempts = c.FreeAttempts
+	}
+	if c.BaseDelaySeconds > 0 {
+		d.BaseDelaySeconds = c.BaseDelaySeconds
+	}
+	if c.MaxDelaySeconds > 0 {
+		d.MaxDelaySeconds = c.MaxDelaySeconds
+	}
+	if c.LockoutAfter > 0 {
+		d.LockoutAfter = c.LockoutAfter
+	}
+	if c.LockoutSeconds > 0 {
+		d.LockoutSeconds = c.LockoutSeconds
+	}
+	if c.ForgetAfterSeconds > 0 {
+		d.ForgetAfterSeconds = c.ForgetAfterSeconds
+	}
+	d.Disabled = c.Disabled
+	return d
+}
+
+// LoadConfig reads a Config from a JSON file, falling back to
+// DefaultConfig when the file is missing or invalid.
+func LoadConfig(path string) Config {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DefaultConfig
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return DefaultConfig
+	}
+	return c.withDefaults()
+}
+
+// State is the throttling state of one client.
+type State struct {
+	Key          string `json:"ip"`
+	Failures     int    `json:"failures"`
+	LastFailure  string `json:"last_failure"`            // RFC3339
+	BlockedUntil string `json:"blocked_until,omitempty"` // RFC3339; backoff or lockout end
+	LockedOut    bool   `json:"locked_out"`
+}
+
+// maxAttempts bounds the attempt fingerprints remembered per client.
+const maxAttempts = 32
+
+type entry struct {
+	Failures     int       `json:"failures"`
+	LastFailure  time.Time `json:"last_failure"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	LockedOut    bool      `json:"locked_out,omitempty"`
+	// Attempts are fingerprints of the failed credentials, so retrying the
+	// same bad credential (e.g. a stale cookie on every API call) counts once.
+	Attempts []string `json:"attempts,omitempty"`
+}
+
+func (e *entry) tried(attempt string) bool {
+	for _, a := range e.Attempts {
+		if a == attempt {
+			return true
+		}
+	}
+	return false
+}
+
+// Limiter tracks failed attempts by key (normally the client IP).
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     Config
+	path    string // optional state file shared with other processes
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+// New returns an in-memory Limiter using cfg; zero fields take
+// DefaultConfig values.
+func New(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg.withDefaults(), entries: make(map[string]*entry), now: time.Now}
+}
+
+// NewFile returns a Limiter whose state lives in the JSON file at path and
+// is re-read on every call, so another process can inspect and reset it.
+// Meant for low-volume callers such as a login handler.
+func NewFile(cfg Config, path string) *Limiter {
+	l := New(cfg)
+	l.path = path
+	return l
+}
+
+// SetConfig replaces the limiter's configuration, keeping recorded state.
+func (l *Limiter) SetConfig(cfg Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg.withDefaults()
+}
+
+// Allow reports whether key may attempt to authenticate now. When it may
+// not, wait is how long until it may.
+func (l *Limiter) Allow(key string) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cfg.Disabled {
+		return 0, true
+	}
+	l.load()
+	e := l.lookup(key)
+	if e == nil {
+		return 0, true
+	}
+	if now := l.now(); now.Before(e.BlockedUntil) {
+		return e.BlockedUntil.Sub(now), false
+	}
+	return 0, true
+}
+
+// Fail records a failed attempt by key and returns how long key must wait
+// before its next attempt (zero while within the free allowance). attempt
+// is a fingerprint of the rejected credential; repeating one already
+// recorded for key does not count again. Empty attempts always count.
+func (l *Limiter) Fail(key, attempt string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cfg.Disabled {
+		return 0
+	}
+	l.load()
+	now := l.now()
+	e := l.lookup(key)
+	if e == nil {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	if attempt != "" && e.tried(attempt) {
+		if now.Before(e.BlockedUntil) {
+			return e.BlockedUntil.Sub(now)
+		}
+		return 0
+	}
+	if attempt != "" {
+		e.Attempts = append(e.Attempts, attempt)
+		if len(e.Attempts) > maxAttempts {
+			e.Attempts = e.Attempts[len(e.Attempts)-maxAttempts:]
+		}
+	}
+	if e.LockedOut && !now.Before(e.BlockedUntil) {
+		// a served lockout starts the client over with backoff only
+		e.Failures = l.cfg.FreeAttempts
+		e.LockedOut = false
+	}
+	e.Failures++
+	e.LastFailure = now
+
+	var wait time.Duration
+	switch {
+	case e.Failures >= l.cfg.LockoutAfter:
+		e.LockedOut = true
+		wait = time.Duration(l.cfg.LockoutSeconds) * time.Second
+	case e.Failures > l.cfg.FreeAttempts:
+		wait = time.Duration(l.cfg.BaseDelaySeconds) * time.Second << (e.Failures - l.cfg.FreeAttempts - 1)
+		if max := time.Duration(l.cfg.MaxDelaySeconds) * time.Second; wait > max || wait <= 0 {
+			wait = max
+		}
+	}
+	e.BlockedUntil = now.Add(wait)
+	l.save()
+	return wait
+}
+
+// Succeed clears key's record after a successful authentication.
+func (l *Limiter) Succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.load()
+	if _, ok := l.entries[key]; ok {
+		delete(l.entries, key)
+		l.save()
+	}
+}
+
+// Reset clears key's record, or every record when key is empty. It
+// returns the number of records cleared.
+func (l *Limiter) Reset(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.load()
+	n := 0
+	if key == "" {
+		n = len(l.entries)
+		l.entries = make(map[string]*entry)
+	} else if _, ok := l.entries[key]; ok {
+		delete(l.entries, key)
+		n = 1
+	}
+	if n > 0 {
+		l.save()
+	}
+	return n
+}
+
+// List returns the state of every client with recorded failures, most
+// recent failure first.
+func (l *Limiter) List() []State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.load()
+	now := l.now()
+	result := make([]State, 0, len(l.entries))
+	for key := range l.entries {
+		e := l.lookup(key)
+		if e == nil {
+			continue
+		}
+		s := State{
+			Key:         key,
+			Failures:    e.Failures,
+			LastFailure: e.LastFailure.UTC().Format(time.RFC3339),
+			LockedOut:   e.LockedOut && now.Before(e.BlockedUntil),
+		}
+		if now.Before(e.BlockedUntil) {
+			s.BlockedUntil = e.BlockedUntil.UTC().Format(time.RFC3339)
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastFailure > result[j].LastFailure })
+	return result
+}
+
+// lookup returns key's entry, dropping it when it has been idle for
+// ForgetAfterSeconds and is not blocked. Callers hold l.mu.
+func (l *Limiter) lookup(key string) *entry {
+	e := l.entries[key]
+	if e == nil {
+		return nil
+	}
+	now := l.now()
+	idle := now.Sub(e.LastFailure) > time.Duration(l.cfg.ForgetAfterSeconds)*time.Second
+	if idle && !now.Before(e.BlockedUntil) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+// load replaces the in-memory state with the state file, if any. Callers
+// hold l.mu.
+func (l *Limiter) load() {
+	if l.path == "" {
+		return
+	}
+	entries := make(map[string]*entry)
+	if data, err := os.ReadFile(l.path); err == nil {
+		json.Unmarshal(data, &entries)
+	}
+	l.entries = entries
+}
+
+// save writes the in-memory state to the state file, if any. Callers hold
+// l.mu.
+func (l *Limiter) save() {
+	if l.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, l.path)
+}
+
+// ClientIP returns the IP address to throttle r by. Behind a Cloudflare
+// tunnel or local reverse proxy every request arrives from loopback, so the
+// forwarded client address is used then; forwarding headers from non-local
+// peers are ignored, since a remote client could set them to dodge limits.
+// CF-Connecting-IP is set by Cloudflare itself and preferred.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return strings.TrimSpace(ip)
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		// the last hop was added by the proxy; earlier ones are client-supplied
+		hops := strings.Split(fwd, ",")
+		return strings.TrimSpace(hops[len(hops)-1])
+	}
+	return host
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimiterBackoffAndLockout(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Config{FreeAttempts: 2, BaseDelaySeconds: 1, MaxDelaySeconds: 4, LockoutAfter: 6, LockoutSeconds: 600})
+	l.now = func() time.Time { return now }
+
+	// failures 1..6 -> expected wait after each
+	wantWaits := []time.Duration{0, 0, 1 * time.Second, 2 * time.Second, 4 * time.Second, 600 * time.Second}
+	for i, want := range wantWaits {
+		if _, ok := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("attempt %d: blocked before failing", i+1)
+		}
+		if got := l.Fail("1.2.3.4", fmt.Sprintf("guess-%d", i)); got != want {
+			t.Fatalf("failure %d: wait = %v, want %v", i+1, got, want)
+		}
+		if want > 0 {
+			if wait, ok := l.Allow("1.2.3.4"); ok || wait != want {
+				t.Fatalf("failure %d: Allow = %v, %v; want blocked for %v", i+1, wait, ok, want)
+			}
+		}
+		now = now.Add(want)
+	}
+
+	// other clients are unaffected
+	if _, ok := l.Allow("5.6.7.8"); !ok {
+		t.Error("unrelated client blocked")
+	}
+
+	// after a served lockout the client gets backoff, not another lockout
+	if got := l.Fail("1.2.3.4", "after-lockout"); got != time.Second {
+		t.Errorf("first failure after lockout: wait = %v, want 1s", got)
+	}
+
+	states := l.List()
+	if len(states) != 1 || states[0].Key != "1.2.3.4" || states[0].LockedOut {
+		t.Errorf("List() = %+v", states)
+	}
+
+	l.Succeed("1.2.3.4")
+	if len(l.List()) != 0 {
+		t.Error("Succeed did not clear the client")
+	}
+}
+
+func TestLimiterRepeatedAttemptCountsOnce(t *testing.T) {
+	l := New(Config{FreeAttempts: 1, LockoutAfter: 3})
+	for i := 0; i < 10; i++ {
+		l.Fail("1.2.3.4", "stale-cookie")
+	}
+	if states := l.List(); len(states) != 1 || states[0].Failures != 1 {
+		t.Errorf("List() = %+v, want a single failure", states)
+	}
+}
+
+func TestLimiterFileSharedState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockouts.json")
+	proxy := NewFile(Config{FreeAttempts: 1, LockoutAfter: 2}, path)
+	server := NewFile(Config{}, path)
+
+	proxy.Fail("1.2.3.4", "a")
+	proxy.Fail("1.2.3.4", "b")
+	if states := server.List(); len(states) != 1 || !states[0].LockedOut {
+		t.Fatalf("server view = %+v, want one locked-out client", states)
+	}
+	if n := server.Reset(""); n != 1 {
+		t.Fatalf("Reset cleared %d, want 1", n)
+	}
+	if _, ok := proxy.Allow("1.2.3.4"); !ok {
+		t.Error("proxy still blocks after reset from another limiter")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		cf     string
+		xff    string
+		want   string
+	}{
+		{name: "direct", remote: "203.0.113.7:5555", want: "203.0.113.7"},
+		{name: "direct ignores spoofed headers", remote: "203.0.113.7:5555", cf: "1.1.1.1", xff: "2.2.2.2", want: "203.0.113.7"},
+		{name: "tunnel uses cloudflare header", remote: "127.0.0.1:40000", cf: "198.51.100.9", xff: "9.9.9.9, 198.51.100.9", want: "198.51.100.9"},
+		{name: "local proxy uses last forwarded hop", remote: "[::1]:40000", xff: "9.9.9.9, 198.51.100.10", want: "198.51.100.10"},
+		{name: "plain loopback", remote: "127.0.0.1:40000", want: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/login", nil)
+			r.RemoteAddr = tt.remote
+			if tt.cf != "" {
+				r.Header.Set("CF-Connecting-IP", tt.cf)
+			}
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
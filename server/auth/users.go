@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Role controls what an authenticated user may do.
+type Role string
+
+const (
+	// RoleAdmin has full access, including user and token management.
+	RoleAdmin Role = "admin"
+	// RoleReviewer is read-only apart from the review endpoints allowed
+	// with AllowForReviewers.
+	RoleReviewer Role = "reviewer"
+	// RoleMember works in an isolated tenant: their own project registry,
+	// settings and data namespace (see package tenant). Instance-wide state
+	// such as tunnels and domains stays with admins.
+	RoleMember Role = "member"
+)
+
+// legacyUser is the identity of tokens from the shared credentials file.
+const legacyUser = "admin"
+
+// Identity is the user a request was authenticated as.
+type Identity struct {
+	User    string `json:"user"`
+	Role    Role   `json:"role"`
+	TokenID string `json:"token_id,omitempty"` // empty for credentials-file tokens
+}
+
+// User is a named account with its own tokens.
+type User struct {
+	Name      string  `json:"name"`
+	Role      Role    `json:"role"`
+	CreatedAt string  `json:"created_at"`
+	Tokens    []Token `json:"tokens,omitempty"`
+	// SSO is set on users created by single sign-on: only that provider
+	// account signs in as the user.
+	SSO *SSOAccount `json:"sso,omitempty"`
+}
+
+// SSOAccount is an account of an OpenID provider, identified by the iss and
+// sub claims of its ID tokens.
+type SSOAccount struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+}
+
+// Token is an issued credential. Only its hash is stored; the raw value is
+// returned once, when it is issued.
+type Token struct {
+	ID        string `json:"id"`
+	Label     string `json:"label,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+	// SSO marks the session token of a single sign-on login.
+	SSO bool `json:"sso,omitempty"`
+}
+
+type usersStore struct {
+	Users []User `json:"users"`
+}
+
+var (
+	usersMu   sync.Mutex
+	usersFile = jsonfile.New[usersStore](config.UsersFile)
+)
+
+// SetUsersFile points the users store at path (used by tests).
+func SetUsersFile(path string) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	usersFile = jsonfile.New[usersStore](path)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// identify resolves a token to an identity. initialized reports whether any
+// credential exists at all, so the setup flow can be offered when none does.
+func identify(token string) (id *Identity, initialized bool) {
+	tokens, _ := loadCredentials()
+	initialized = len(tokens) > 0
+	if token != "" && tokens[token] {
+		return &Identity{User: legacyUser, Role: RoleAdmin}, true
+	}
+
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	st, err := usersFile.Get()
+	if err != nil {
+		return nil, initialized
+	}
+	hash := ""
+	if token != "" {
+		hash = hashToken(token)
+	}
+	for _, u := range st.Users {
+		for _, t := range u.Tokens {
+			if t.RevokedAt != "" {
+				continue
+			}
+			initialized = true
+			if hash != "" && t.Hash == hash {
+				return &Identity{User: u.Name, Role: u.Role, TokenID: t.ID}, true
+			}
+		}
+	}
+	return nil, initialized
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity set by Middleware, or nil when the
+// request was not authenticated (skipped paths, quicktest mode).
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// UserName returns the name of the user making the request for audit and
+// attribution purposes, or "local" when the request carries no identity.
+func UserName(r *http.Request) string {
+	if id := FromContext(r.Context()); id != nil {
+		return id.User
+	}
+	return "local"
+}
+
+var (
+	reviewerMu    sync.RWMutex
+	reviewerPaths = map[string]bool{}
+)
+
+// AllowForReviewers lets reviewers call paths with any method. By default
+// reviewers may only make GET/HEAD requests; review endpoints that use POST
+// for reads (diff, status) or that record review state opt in here.
+func AllowForReviewers(paths ...string) {
+	reviewerMu.Lock()
+	defer reviewerMu.Unlock()
+	for _, p := range paths {
+		reviewerPaths[p] = true
+	}
+}
+
+// adminOnlyPrefixes are path prefixes reserved to admins regardless of method:
+// they manage credentials or expose server internals.
+var adminOnlyPrefixes = []string{
+	"/api/auth/users",
+	"/api/auth/tokens",
+	"/api/auth/credentials",
+	"/api/auth/lockouts",
+	"/api/auth/oidc",
+	"/api/audit",
+	"/api/debug/trace",
+	"/api/debug/faults",
+	"/api/debug/goroutines",
+	"/debug/pprof",
+	"/api/settings/",
+	"/api/server/",
+	"/api/admin/",
+	"/api/quotas",
+	"/api/exec-policy",
+	"/metrics",
+}
+
+// memberPrefixes are the paths members may use: their projects and the
+// review and file APIs working in them, whose handlers confine members to
+// their projects (see projects.Allowed), and state kept per tenant. The
+// rest is instance-wide, shared by every tenant, or runs commands as the
+// server user outside any tenant's projects, so a new route stays closed to
+// members until it is added here.
+var memberPrefixes = []string{
+	"/api/auth/me",
+	"/api/auth/status",
+	"/api/auth/check",
+	"/api/projects",
+	"/api/review/",
+	"/api/files/tree",
+	"/api/files/content",
+	"/api/rules",
+	"/api/artifacts",
+	"/api/quota", // /api/quotas is admin-only
+	"/api/features",
+	"/api/help",
+}
+
+// authorize reports whether id may make request r.
+func authorize(id *Identity, r *http.Request) bool {
+	if id.Role == RoleAdmin {
+		return true
+	}
+	for _, prefix := range adminOnlyPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+	if id.Role == RoleMember {
+		for _, prefix := range memberPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if id.Role != RoleReviewer {
+		return false
+	}
+	// WebSocket upgrades are GETs but open terminals and agent sessions.
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	reviewerMu.RLock()
+	defer reviewerMu.RUnlock()
+	return reviewerPaths[r.URL.Path]
+}
+
+// ListUsers returns all users sorted by name, without token hashes.
+func ListUsers() ([]User, error) {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	st, err := usersFile.Get()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(st.Users))
+	for _, u := range st.Users {
+		tokens := make([]Token, 0, len(u.Tokens))
+		for _, t := range u.Tokens {
+			t.Hash = ""
+			tokens = append(tokens, t)
+		}
+		u.Tokens = tokens
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+// SaveUser creates a user or changes the role of an existing one.
+func SaveUser(name string, role Role) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if name == legacyUser {
+		return fmt.Errorf("%q is reserved for credentials-file tokens", legacyUser)
+	}
+	if !validRole(role) {
+		return fmt.Errorf("invalid role: %q", role)
+	}
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	return usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			if st.Users[i].Name == name {
+				st.Users[i].Role = role
+				return nil
+			}
+		}
+		st.Users = append(st.Users, User{
+			Name:      name,
+			Role:      role,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		})
+		return nil
+	})
+}
+
+// DeleteUser removes a user and, with it, all of their tokens.
+func DeleteUser(name string) error {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	return usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			if st.Users[i].Name == name {
+				st.Users = append(st.Users[:i], st.Users[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("user not found: %s", name)
+	})
+}
+
+// IssueToken creates a new token for a user and returns its metadata and
+// raw value. The raw value cannot be retrieved again.
+func IssueToken(userName, label string) (Token, string, error) {
+	tok, secret, err := newToken(label)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	err = usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			if st.Users[i].Name == userName {
+				st.Users[i].Tokens = append(st.Users[i].Tokens, tok)
+				return nil
+			}
+		}
+		return fmt.Errorf("user not found: %s", userName)
+	})
+	if err != nil {
+		return Token{}, "", err
+	}
+	tok.Hash = ""
+	return tok, secret, nil
+}
+
+// newToken generates a token and its raw value.
+func newToken(label string) (Token, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Token{}, "", fmt.Errorf("failed to generate random bytes: %v", err)
+	}
+	secret := hex.EncodeToString(raw)
+	idBytes := make([]byte, 6)
+	rand.Read(idBytes)
+	return Token{
+		ID:        hex.EncodeToString(idBytes),
+		Label:     strings.TrimSpace(label),
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}, secret, nil
+}
+
+// RevokeToken marks a token as revoked; it stops authenticating immediately.
+func RevokeToken(tokenID string) error {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+	return usersFile.Update(func(st *usersStore) error {
+		for i := range st.Users {
+			for j := range st.Users[i].Tokens {
+				t := &st.Users[i].Tokens[j]
+				if t.ID != tokenID {
+					continue
+				}
+				if t.RevokedAt == "" {
+					t.RevokedAt = time.Now().UTC().Format(time.RFC3339)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("token not found: %s", tokenID)
+	})
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMiddlewareUserRoles(t *testing.T) {
+	tmpDir := t.TempDir()
+	credFile := filepath.Join(tmpDir, "credentials")
+	SetCredentialsFile(credFile)
+	SetUsersFile(filepath.Join(tmpDir, "users.json"))
+	os.WriteFile(credFile, []byte("legacy-token\n"), 0600)
+	AllowForReviewers("/api/review/diff")
+
+	if err := SaveUser("alice", RoleReviewer); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveUser("bob", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveUser("carol", RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	_, reviewerToken, err := IssueToken("alice", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, adminToken, _ := IssueToken("bob", "")
+	_, memberToken, _ := IssueToken("carol", "")
+	revoked, revokedToken, _ := IssueToken("alice", "old")
+	if err := RevokeToken(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = UserName(r)
+	}), nil)
+
+	tests := []struct {
+		name      string
+		token     string
+		method    string
+		path      string
+		websocket bool
+		wantCode  int
+		wantUser  string
+	}{
+		{name: "legacy token is admin", token: "legacy-token", method: http.MethodPost, path: "/api/auth/users", wantCode: 200, wantUser: "admin"},
+		{name: "admin user", token: adminToken, method: http.MethodPost, path: "/api/exec", wantCode: 200, wantUser: "bob"},
+		{name: "reviewer reads", token: reviewerToken, method: http.MethodGet, path: "/api/activity", wantCode: 200, wantUser: "alice"},
+		{name: "reviewer allowed POST", token: reviewerToken, method: http.MethodPost, path: "/api/review/diff", wantCode: 200, wantUser: "alice"},
+		{name: "reviewer cannot write", token: reviewerToken, method: http.MethodPost, path: "/api/review/commit", wantCode: 403},
+		{name: "reviewer cannot open websockets", token: reviewerToken, method: http.MethodGet, path: "/api/terminal", websocket: true, wantCode: 403},
+		{name: "reviewer cannot manage users", token: reviewerToken, method: http.MethodGet, path: "/api/auth/users", wantCode: 403},
+		{name: "member writes", token: memberToken, method: http.MethodPost, path: "/api/projects", wantCode: 200, wantUser: "carol"},
+		{name: "member reviews", token: memberToken, method: http.MethodPost, path: "/api/review/diff", wantCode: 200, wantUser: "carol"},
+		{name: "member cannot open agent sessions", token: memberToken, method: http.MethodGet, path: "/api/agents/sessions/s1/proxy/event", websocket: true, wantCode: 403},
+		{name: "member cannot open terminals", token: memberToken, method: http.MethodGet, path: "/api/terminal", websocket: true, wantCode: 403},
+		{name: "member cannot exec", token: memberToken, method: http.MethodPost, path: "/api/exec", wantCode: 403},
+		{name: "member cannot see tunnels", token: memberToken, method: http.MethodGet, path: "/api/cloudflare/status", wantCode: 403},
+		{name: "member cannot manage users", token: memberToken, method: http.MethodGet, path: "/api/auth/users", wantCode: 403},
+		{name: "admin scrapes metrics", token: adminToken, method: http.MethodGet, path: "/metrics", wantCode: 200, wantUser: "bob"},
+		{name: "reviewer cannot scrape metrics", token: reviewerToken, method: http.MethodGet, path: "/metrics", wantCode: 403},
+		{name: "metrics need a token", token: "", method: http.MethodGet, path: "/metrics", wantCode: 401},
+		{name: "member cannot profile", token: memberToken, method: http.MethodGet, path: "/debug/pprof/heap", wantCode: 403},
+		{name: "profiling needs a token", token: "", method: http.MethodGet, path: "/debug/pprof/", wantCode: 401},
+		{name: "revoked token", token: revokedToken, method: http.MethodGet, path: "/api/activity", wantCode: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.websocket {
+				req.Header.Set("Upgrade", "websocket")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantCode || gotUser != tt.wantUser {
+				t.Errorf("code = %d, user = %q; want %d, %q", w.Code, gotUser, tt.wantCode, tt.wantUser)
+			}
+		})
+	}
+
+	users, _ := ListUsers()
+	if len(users) != 3 || users[0].Name != "alice" || len(users[0].Tokens) != 2 || users[0].Tokens[0].Hash != "" {
+		t.Errorf("ListUsers = %+v", users)
+	}
+}
+
+func TestMembersCannotRunCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	SetCredentialsFile(filepath.Join(tmpDir, "credentials"))
+	SetUsersFile(filepath.Join(tmpDir, "users.json"))
+	if err := SaveUser("carol", RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	_, memberToken, err := IssueToken("carol", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), nil)
+
+	// each of these runs commands as the server user
+	paths := []string{
+		"/api/actions/run",
+		"/api/remote-agent/git/run",
+		"/api/remote-agent/machine/backup",
+		"/api/remote-agent/machine/restore",
+		"/api/tools/install",
+		"/api/services/start",
+		"/api/services/restart",
+		"/api/ports/local/kill",
+		"/api/deps/apply",
+		"/api/deps/verify",
+		"/api/quick-test/exec-restart",
+		"/api/agents/sessions",
+		"/api/exec",
+		"/api/terminal",
+	}
+	for _, path := range paths {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+memberToken)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: code = %d, want 403", path, w.Code)
+		}
+	}
+}
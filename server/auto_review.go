@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/agents"
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+	"github.com/xhd2015/ai-critic/server/quota"
+	"github.com/xhd2015/ai-critic/server/rules"
+)
+
+// maxAutoReviewUntrackedBytes is the largest untracked file included in
+// the diff sent for post-run review; larger ones are left out.
+const maxAutoReviewUntrackedBytes = 64 * 1024
+
+// noIssuesFound is the reply the review prompt asks for when nothing is wrong.
+const noIssuesFound = "No issues found."
+
+// runAutoReview reviews the uncommitted changes an agent left in projectDir
+// using the same rules and default model as the review chat.
+func runAutoReview(ctx context.Context, projectDir string) (*agents.AutoReviewResult, error) {
+	cfg := defaultAIConfig()
+	if !cfg.Configured() {
+		return &agents.AutoReviewResult{
+			Status:   agents.AutoReviewSkipped,
+			Findings: []string{},
+			Summary:  "AI provider not configured",
+		}, nil
+	}
+
+	diff, err := getGitDiff(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	untracked, untrackedFiles := untrackedFilesDiff(projectDir)
+
+	diffContext := diff.StagedDiff + diff.WorkingTreeDiff + untracked
+	files := len(diff.Files) + untrackedFiles
+	if strings.TrimSpace(diffContext) == "" {
+		return &agents.AutoReviewResult{
+			Status:   agents.AutoReviewSkipped,
+			Findings: []string{},
+			Summary:  "No changes to review",
+		}, nil
+	}
+
+	reviewRules, err := loadReviewRules(ctx, projectDir, rules.Selection{})
+	if err != nil {
+		return nil, err
+	}
+	messages := []ai.Message{
+		{Role: "system", Content: buildReviewSystemPrompt(diffContext, reviewRules)},
+		{Role: "user", Content: "Review these changes."},
+	}
+	fmt.Printf("[AutoReview] Reviewing %d file(s) in %s with model %s\n", files, projectDir, cfg.Model)
+	ctx = withUsageSession(ctx, cfg, aiusage.Session{Kind: aiusage.KindAutoReview, ID: projectDir, Project: projectDir})
+	out, err := ai.CallCompletion(ctx, cfg, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	return &agents.AutoReviewResult{
+		Status:   agents.AutoReviewDone,
+		Files:    files,
+		Findings: parseReviewFindings(out),
+		Summary:  out,
+		Model:    cfg.Model,
+	}, nil
+}
+
+// runSessionReview asks for findings on diff, the changes of one agent
+// session, the way /api/review/findings does for uncommitted changes.
+func runSessionReview(ctx context.Context, sessionID, projectDir, diff string) (*agents.SessionReview, error) {
+	cfg := defaultAIConfig()
+	if !cfg.Configured() {
+		return &agents.SessionReview{
+			Status:  agents.AutoReviewSkipped,
+			Summary: "AI provider not configured",
+		}, nil
+	}
+
+	reviewRules, err := loadReviewRules(ctx, projectDir, rules.Selection{})
+	if err != nil {
+		return nil, err
+	}
+	if err := quota.CheckAITokens(ctx); err != nil {
+		return nil, err
+	}
+	ctx = ai.WithUsageReporter(ctx, func(u ai.TokenUsage) {
+		quota.RecordAITokens(ctx, u.TotalTokens)
+	})
+	ctx = withUsageSession(ctx, cfg, aiusage.Session{Kind: aiusage.KindFindings, ID: sessionID, Project: projectDir})
+	res, err := reviewFindings(ctx, cfg, diff, reviewRules)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := make([]agents.SessionFinding, 0, len(res.Findings))
+	for _, f := range res.Findings {
+		findings = append(findings, agents.SessionFinding{
+			File:       f.File,
+			StartLine:  f.StartLine,
+			EndLine:    f.EndLine,
+			Rule:       f.Rule,
+			Severity:   f.Severity,
+			Message:    f.Message,
+			Suggestion: f.Suggestion,
+		})
+	}
+	return &agents.SessionReview{
+		Status:   agents.AutoReviewDone,
+		Findings: findings,
+		Model:    res.Model,
+	}, nil
+}
+
+// untrackedFilesDiff renders untracked, non-ignored files as "new file" diffs,
+// since agents commonly create files that git diff does not report. Binary
+// and oversized files are skipped, as they cost tokens without being
+// reviewable.
+func untrackedFilesDiff(dir string) (string, int) {
+	cmd := exec.Command("git", "ls-files", "--others", "--exclude-standard")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", 0
+	}
+
+	var b strings.Builder
+	count := 0
+	for _, path := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if path == "" {
+			continue
+		}
+		full := filepath.Join(dir, path)
+		info, err := os.Stat(full)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxAutoReviewUntrackedBytes {
+			continue
+		}
+		content, err := os.ReadFile(full)
+		if err != nil || isBinaryContent(content) {
+			continue
+		}
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\nnew file\n--- /dev/null\n+++ b/%s\n@@ -0,0 +1,%d @@\n", path, path, path, len(lines))
+		for _, line := range lines {
+			b.WriteString("+" + line + "\n")
+		}
+		count++
+	}
+	return b.String(), count
+}
+
+// parseReviewFindings splits the review output into one finding per
+// non-empty line, dropping list markers. "No issues found." yields none.
+func parseReviewFindings(out string) []string {
+	findings := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*•"))
+		if line == "" || strings.EqualFold(line, noIssuesFound) {
+			continue
+		}
+		findings = append(findings, line)
+	}
+	return findings
+}
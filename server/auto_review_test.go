@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReviewFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{name: "no issues", out: "No issues found.", want: []string{}},
+		{name: "empty", out: "\n\n", want: []string{}},
+		{
+			name: "bulleted",
+			out:  "- a.go: missing error check - handle err\n\n* b.go: naming - rename Foo\n",
+			want: []string{"a.go: missing error check - handle err", "b.go: naming - rename Foo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseReviewFindings(tt.out)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseReviewFindings(%q) = %#v, want %#v", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUntrackedFilesDiffSkipsBinaryAndOversized(t *testing.T) {
+	repo := t.TempDir()
+	cmd := exec.Command("git", "init")
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	os.WriteFile(filepath.Join(repo, "new.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "image.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00"), 0644)
+	os.WriteFile(filepath.Join(repo, "big.txt"), bytes.Repeat([]byte("x\n"), maxAutoReviewUntrackedBytes), 0644)
+
+	diff, count := untrackedFilesDiff(repo)
+	if count != 1 || !strings.Contains(diff, "+++ b/new.go\n") {
+		t.Fatalf("untrackedFilesDiff = %d file(s):\n%s\nwant only new.go", count, diff)
+	}
+	if strings.Contains(diff, "image.png") || strings.Contains(diff, "big.txt") {
+		t.Errorf("binary or oversized file included:\n%s", diff)
+	}
+}
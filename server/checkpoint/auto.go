@@ -0,0 +1,145 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Policy controls the automatic checkpoints made before agent sessions and
+// how long they are retained. Checkpoints made by hand are not subject to
+// it.
+type Policy struct {
+	// AutoCheckpoint makes a checkpoint of the changed files before each
+	// agent session starts.
+	AutoCheckpoint bool `json:"auto_checkpoint"`
+	// KeepLast, MaxAge and MaxTotalSize are the retention limits, as in
+	// PruneRequest; zero values mean no limit.
+	KeepLast     int    `json:"keep_last,omitempty"`
+	MaxAge       string `json:"max_age,omitempty"`
+	MaxTotalSize int64  `json:"max_total_size,omitempty"`
+}
+
+// defaultPolicy applies until the policy is saved.
+var defaultPolicy = Policy{
+	AutoCheckpoint: true,
+	KeepLast:       20,
+	MaxAge:         "168h",
+	MaxTotalSize:   512 << 20,
+}
+
+var policyFile = jsonfile.New[Policy](config.CheckpointPolicyFile)
+
+// GetPolicy returns the checkpoint policy.
+func GetPolicy() (Policy, error) {
+	if !policyFile.Exists() {
+		return defaultPolicy, nil
+	}
+	return policyFile.Get()
+}
+
+// SetPolicy validates and saves the checkpoint policy.
+func SetPolicy(p Policy) error {
+	if p.KeepLast < 0 || p.MaxTotalSize < 0 {
+		return fmt.Errorf("keep_last and max_total_size must not be negative")
+	}
+	if p.MaxAge != "" {
+		if d, err := time.ParseDuration(p.MaxAge); err != nil || d <= 0 {
+			return fmt.Errorf("max_age must be a positive duration like 168h")
+		}
+	}
+	return policyFile.Set(p)
+}
+
+// pruneRequest returns the retention limits of p for session checkpoints,
+// or false if p sets none.
+func (p Policy) pruneRequest() (PruneRequest, bool) {
+	req := PruneRequest{KeepLast: p.KeepLast, MaxAge: p.MaxAge, MaxTotalSize: p.MaxTotalSize, Sessions: true}
+	return req, p.KeepLast > 0 || p.MaxAge != "" || p.MaxTotalSize > 0
+}
+
+// CreateSessionCheckpoint checkpoints the changed files of the git checkout
+// at projectDir before agent session sessionID modifies them, then prunes
+// the project's session checkpoints. The checkpoint records the commit, so
+// restoring it with All undoes the whole session. It returns nil if
+// AutoCheckpoint is off.
+func CreateSessionCheckpoint(projectName, projectDir, sessionID string) (*CheckpointSummary, error) {
+	policy, err := GetPolicy()
+	if err != nil || !policy.AutoCheckpoint {
+		return nil, err
+	}
+	if gitHead(projectDir) == "" {
+		return nil, fmt.Errorf("%s is not a git checkout with commits", projectDir)
+	}
+	changed, err := gitChangedFiles(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(changed))
+	for i, f := range changed {
+		paths[i] = f.Path
+	}
+	summary, err := CreateCheckpoint(projectName, CreateCheckpointRequest{
+		ProjectDir: projectDir,
+		Name:       "Before " + sessionID,
+		Message:    "Automatic checkpoint before agent session " + sessionID,
+		FilePaths:  paths,
+		Session:    sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if req, ok := policy.pruneRequest(); ok {
+		if _, err := PruneCheckpoints(projectName, req); err != nil {
+			return summary, fmt.Errorf("prune: %w", err)
+		}
+	}
+	return summary, nil
+}
+
+// PruneSessionCheckpoints applies the retention limits of the policy to the
+// session checkpoints of a project.
+func PruneSessionCheckpoints(projectName string) (*PruneResult, error) {
+	policy, err := GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	req, ok := policy.pruneRequest()
+	if !ok {
+		return &PruneResult{Removed: []PrunedCheckpoint{}}, nil
+	}
+	return PruneCheckpoints(projectName, req)
+}
+
+// handlePolicy gets and sets the checkpoint policy.
+//
+//	GET /api/checkpoints/policy          -> Policy
+//	PUT /api/checkpoints/policy {Policy} -> Policy
+func handlePolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p, err := GetPolicy()
+		if err != nil {
+			respondErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		var p Policy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			respondErr(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := SetPolicy(p); err != nil {
+			respondErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusOK, p)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
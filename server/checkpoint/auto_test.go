@@ -0,0 +1,134 @@
+package checkpoint
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v %s", args, err, out)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionCheckpoint(t *testing.T) {
+	useTempBaseDir(t)
+	old := policyFile
+	policyFile = jsonfile.New[Policy](filepath.Join(t.TempDir(), "policy.json"))
+	t.Cleanup(func() { policyFile = old })
+
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	writeFiles(t, dir, map[string]string{"main.go": "v1\n", "util.go": "u1\n"})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "init")
+	writeFiles(t, dir, map[string]string{"main.go": "mine\n"}) // uncommitted work of the user
+
+	cp, err := CreateSessionCheckpoint("p", dir, "agent-session-1")
+	if err != nil || cp == nil || cp.Session != "agent-session-1" || cp.FileCount != 1 {
+		t.Fatalf("checkpoint = %+v, %v", cp, err)
+	}
+
+	// the agent edits, adds and deletes files, then the session is undone
+	writeFiles(t, dir, map[string]string{"main.go": "agent\n", "new.go": "n\n"})
+	os.Remove(filepath.Join(dir, "util.go"))
+	res, err := RestoreCheckpoint("p", cp.ID, RestoreRequest{ProjectDir: dir, All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != 3 {
+		t.Errorf("restored %+v", res.Files)
+	}
+	for path, want := range map[string]string{"main.go": "mine\n", "util.go": "u1\n"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, path)); string(data) != want {
+			t.Errorf("%s = %q, want %q", path, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.go")); !os.IsNotExist(err) {
+		t.Errorf("new.go not removed: %v", err)
+	}
+
+	// retention counts session checkpoints only and keeps manual ones
+	if err := SetPolicy(Policy{AutoCheckpoint: true, KeepLast: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateCheckpoint("p", CreateCheckpointRequest{ProjectDir: dir, Name: "manual"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"agent-session-2", "agent-session-3"} {
+		if _, err := CreateSessionCheckpoint("p", dir, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, _ := ListCheckpoints("p")
+	var names []string
+	for _, cp := range list {
+		names = append(names, cp.Name)
+	}
+	if len(list) != 3 || list[0].Name != "manual" || list[2].Session != "agent-session-3" {
+		t.Errorf("after retention: %v", names)
+	}
+
+	if err := SetPolicy(Policy{}); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := CreateSessionCheckpoint("p", dir, "agent-session-4"); cp != nil || err != nil {
+		t.Errorf("auto checkpoint off: %+v, %v", cp, err)
+	}
+	if err := SetPolicy(Policy{MaxAge: "yesterday"}); err == nil {
+		t.Error("invalid max_age accepted")
+	}
+}
+
+func TestChangesSinceCheckpoint(t *testing.T) {
+	useTempBaseDir(t)
+	old := policyFile
+	policyFile = jsonfile.New[Policy](filepath.Join(t.TempDir(), "policy.json"))
+	t.Cleanup(func() { policyFile = old })
+
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	writeFiles(t, dir, map[string]string{"main.go": "v1\n", "util.go": "u1\n", "keep.go": "k\n"})
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "init")
+	writeFiles(t, dir, map[string]string{"main.go": "mine\n", "keep.go": "k2\n"}) // uncommitted work of the user
+
+	cp, err := CreateSessionCheckpoint("p", dir, "agent-session-1")
+	if err != nil || cp == nil {
+		t.Fatalf("checkpoint = %+v, %v", cp, err)
+	}
+
+	// only what the agent does counts: keep.go was dirty before and is untouched
+	writeFiles(t, dir, map[string]string{"main.go": "mine\nagent\n", "new.go": "n\n"})
+	os.Remove(filepath.Join(dir, "util.go"))
+
+	diffs, err := GetChangesSinceCheckpoint("p", cp.ID, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diffStatuses(diffs); len(got) != 3 || got["main.go"] != "modified" || got["new.go"] != "added" || got["util.go"] != "deleted" {
+		t.Fatalf("diffs %v", got)
+	}
+
+	want := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n mine\n+agent\n"
+	if got := diffs[0].Unified(); got != want {
+		t.Errorf("unified diff\n%s\nwant\n%s", got, want)
+	}
+}
@@ -25,11 +25,18 @@ type FileSnapshot struct {
 
 // CheckpointMeta is the metadata stored in checkpoint.json.
 type CheckpointMeta struct {
-	ID        int            `json:"id"`
-	Name      string         `json:"name"`
-	Message   string         `json:"message,omitempty"`
-	Timestamp string         `json:"timestamp"`
-	Files     []FileSnapshot `json:"files"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Message   string `json:"message,omitempty"`
+	Timestamp string `json:"timestamp"`
+	// Commit is git HEAD when the checkpoint was made; the files are
+	// changes on top of it. Empty for checkpoints made before it was
+	// recorded.
+	Commit string `json:"commit,omitempty"`
+	// Session is the agent session the checkpoint was made before; empty
+	// for checkpoints made by hand.
+	Session string         `json:"session,omitempty"`
+	Files   []FileSnapshot `json:"files"`
 }
 
 // Checkpoint is a named snapshot of changed files at a point in time.
@@ -45,6 +52,7 @@ type CheckpointSummary struct {
 	Name      string `json:"name"`
 	Message   string `json:"message,omitempty"`
 	Timestamp string `json:"timestamp"`
+	Session   string `json:"session,omitempty"`
 	FileCount int    `json:"file_count"`
 }
 
@@ -215,7 +223,13 @@ func saveOriginalContent(cpDir, filePath, content string) error {
 // gitChangedFiles returns list of changed files in the working tree compared to HEAD.
 // Uses git diff --name-status.
 func gitChangedFiles(projectDir string) ([]ChangedFile, error) {
-	out, err := gitrunner.Diff("--name-status", "HEAD").Dir(projectDir).Output()
+	return gitChangedFilesSince(projectDir, "HEAD")
+}
+
+// gitChangedFilesSince lists the files of the working tree that differ from
+// commit, untracked files included.
+func gitChangedFilesSince(projectDir, commit string) ([]ChangedFile, error) {
+	out, err := gitrunner.Diff("--name-status", commit, "--").Dir(projectDir).Output()
 	if err != nil {
 		return nil, fmt.Errorf("git diff failed: %w", err)
 	}
@@ -257,6 +271,15 @@ func gitChangedFiles(projectDir string) ([]ChangedFile, error) {
 	return files, nil
 }
 
+// gitHead returns the commit HEAD points to, empty if there is none.
+func gitHead(projectDir string) string {
+	out, err := gitrunner.RevParse("HEAD").Dir(projectDir).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
 func parseGitStatus(s string) string {
 	switch {
 	case strings.HasPrefix(s, "A"):
@@ -277,7 +300,11 @@ func readFileContent(projectDir, path string) (string, error) {
 }
 
 func gitFileContent(projectDir, path string) (string, error) {
-	out, err := gitrunner.Show("HEAD:" + path).Dir(projectDir).Output()
+	return gitFileContentAt(projectDir, "HEAD", path)
+}
+
+func gitFileContentAt(projectDir, commit, path string) (string, error) {
+	out, err := gitrunner.Show(commit + ":" + path).Dir(projectDir).Output()
 	if err != nil {
 		return "", err
 	}
@@ -303,6 +330,7 @@ func ListCheckpoints(projectName string) ([]CheckpointSummary, error) {
 			Name:      cp.Name,
 			Message:   cp.Message,
 			Timestamp: cp.Timestamp,
+			Session:   cp.Session,
 			FileCount: len(cp.Files),
 		}
 	}
@@ -351,6 +379,7 @@ type CreateCheckpointRequest struct {
 	Name       string   `json:"name"`        // optional user-provided name
 	Message    string   `json:"message"`     // optional user-provided message
 	FilePaths  []string `json:"file_paths"`  // list of files to include (from changed files)
+	Session    string   `json:"session"`     // agent session, for automatic checkpoints
 }
 
 // CreateCheckpoint creates a new checkpoint from the specified changed files.
@@ -430,6 +459,8 @@ func CreateCheckpoint(projectName string, req CreateCheckpointRequest) (*Checkpo
 		Name:      name,
 		Message:   req.Message,
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Commit:    gitHead(req.ProjectDir),
+		Session:   req.Session,
 		Files:     files,
 	}
 
@@ -443,6 +474,7 @@ func CreateCheckpoint(projectName string, req CreateCheckpointRequest) (*Checkpo
 		Name:      meta.Name,
 		Message:   meta.Message,
 		Timestamp: meta.Timestamp,
+		Session:   meta.Session,
 		FileCount: len(meta.Files),
 	}
 	return summary, nil
@@ -547,8 +579,10 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/checkpoints/", handleCheckpointByID)
 	mux.HandleFunc("/api/checkpoints/diff", handleCurrentDiff)
 	mux.HandleFunc("/api/checkpoints/diff/file", handleSingleFileDiff)
+	mux.HandleFunc("/api/checkpoints/prune", handlePruneCheckpoints)
+	mux.HandleFunc("/api/checkpoints/policy", handlePolicy)
 	mux.HandleFunc("/api/files", handleListFiles)
-	mux.HandleFunc("/api/files/content", handleReadFile)
+	// /api/files/content is owned by the server package (read/write with conflict detection).
 	// /api/files/home is owned by server/fileupload (returns {home, home_dir, cwd}).
 	mux.HandleFunc("/api/server/files", handleListServerFiles)
 	mux.HandleFunc("/api/server/files/content", handleServerFileContent)
@@ -571,6 +605,9 @@ func handleCurrentDiff(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if highlightRequested(r) {
+		highlightDiffs(diffs)
+	}
 	respondJSON(w, http.StatusOK, diffs)
 }
 
@@ -597,6 +634,9 @@ func handleSingleFileDiff(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if highlightRequested(r) {
+		diff.Highlight()
+	}
 	respondJSON(w, http.StatusOK, diff)
 }
 
@@ -680,6 +720,9 @@ func handleCheckpointByID(w http.ResponseWriter, r *http.Request) {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
+		if highlightRequested(r) {
+			highlightDiffs(diffs)
+		}
 		respondJSON(w, http.StatusOK, diffs)
 		return
 	}
@@ -698,17 +741,68 @@ func handleCheckpointByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Handle /api/checkpoints/{id}/diff
+	// Handle /api/checkpoints/{id}/diff. By default the diff is against git
+	// HEAD at checkpoint time; against=working compares to the working tree
+	// (needs project_dir) and against={id} to another checkpoint.
 	if suffix == "diff" {
-		diffs, diffErr := GetCheckpointDiff(project, id)
+		var diffs []FileDiff
+		var diffErr error
+		switch against := r.URL.Query().Get("against"); against {
+		case "", "head":
+			diffs, diffErr = GetCheckpointDiff(project, id)
+		case "working":
+			projectDir := r.URL.Query().Get("project_dir")
+			if projectDir == "" {
+				respondErr(w, http.StatusBadRequest, "project_dir is required")
+				return
+			}
+			diffs, diffErr = GetCheckpointWorkingDiff(project, id, projectDir)
+		default:
+			otherID, err := strconv.Atoi(against)
+			if err != nil {
+				respondErr(w, http.StatusBadRequest, "against must be head, working or a checkpoint id")
+				return
+			}
+			diffs, diffErr = GetCheckpointsDiff(project, id, otherID)
+		}
 		if diffErr != nil {
 			respondErr(w, http.StatusNotFound, diffErr.Error())
 			return
 		}
+		if highlightRequested(r) {
+			highlightDiffs(diffs)
+		}
 		respondJSON(w, http.StatusOK, diffs)
 		return
 	}
 
+	// Handle /api/checkpoints/{id}/restore
+	if suffix == "restore" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req RestoreRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if _, err := GetCheckpoint(project, id); err != nil {
+			respondErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		result, err := RestoreCheckpoint(project, id, req)
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if highlightRequested(r) {
+			highlightDiffs(result.Diffs)
+		}
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		cp, err := GetCheckpoint(project, id)
@@ -725,9 +819,11 @@ func handleCheckpointByID(w http.ResponseWriter, r *http.Request) {
 			ID        int        `json:"id"`
 			Name      string     `json:"name"`
 			Timestamp string     `json:"timestamp"`
+			Commit    string     `json:"commit,omitempty"`
+			Session   string     `json:"session,omitempty"`
 			Files     []FileInfo `json:"files"`
 		}
-		resp := DetailResp{ID: cp.ID, Name: cp.Name, Timestamp: cp.Timestamp}
+		resp := DetailResp{ID: cp.ID, Name: cp.Name, Timestamp: cp.Timestamp, Commit: cp.Commit, Session: cp.Session}
 		for _, f := range cp.Files {
 			resp.Files = append(resp.Files, FileInfo{Path: f.Path, Status: f.Status})
 		}
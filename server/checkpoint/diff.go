@@ -3,10 +3,12 @@ package checkpoint
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/highlight"
 )
 
 // FileDiff represents the unified diff for a single file.
@@ -31,6 +33,49 @@ type DiffLine struct {
 	Content string `json:"content"`
 	OldNum  int    `json:"old_num,omitempty"`
 	NewNum  int    `json:"new_num,omitempty"`
+	// Tokens is the highlighted Content, set only when requested with
+	// highlight=true.
+	Tokens []highlight.Token `json:"tokens,omitempty"`
+}
+
+// Highlight fills in Tokens for every line of the diff. Files without a
+// known lexer are left unchanged.
+func (fd *FileDiff) Highlight() {
+	var lines []highlight.Line
+	for _, h := range fd.Hunks {
+		for _, l := range h.Lines {
+			kind := byte(highlight.Context)
+			switch l.Type {
+			case "add":
+				kind = highlight.Add
+			case "delete":
+				kind = highlight.Delete
+			}
+			lines = append(lines, highlight.Line{Kind: kind, Text: l.Content})
+		}
+	}
+	tokens := highlight.Diff(fd.Path, lines)
+	if tokens == nil {
+		return
+	}
+	i := 0
+	for h := range fd.Hunks {
+		for l := range fd.Hunks[h].Lines {
+			fd.Hunks[h].Lines[l].Tokens = tokens[i]
+			i++
+		}
+	}
+}
+
+// highlightRequested reports whether the request asked for tokens.
+func highlightRequested(r *http.Request) bool {
+	return r.URL.Query().Get("highlight") == "true"
+}
+
+func highlightDiffs(diffs []FileDiff) {
+	for i := range diffs {
+		diffs[i].Highlight()
+	}
 }
 
 // GetCheckpointDiff computes diffs for all files in a checkpoint.
@@ -91,6 +136,240 @@ func GetCheckpointDiff(projectName string, id int) ([]FileDiff, error) {
 	return diffs, nil
 }
 
+// findCheckpoint returns the checkpoint with id from list.
+func findCheckpoint(list []Checkpoint, id int) (*Checkpoint, error) {
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("checkpoint %d not found", id)
+}
+
+// snapshotState is a file as recorded by a checkpoint.
+type snapshotState struct {
+	content  string
+	exists   bool
+	recorded bool // false if the checkpoint did not record the file
+	original string
+	hasOrig  bool // original holds the git HEAD content at checkpoint time
+}
+
+func checkpointFileState(cp *Checkpoint, path string) snapshotState {
+	for _, f := range cp.Files {
+		if f.Path != path {
+			continue
+		}
+		st := snapshotState{recorded: true}
+		if f.Status != "deleted" {
+			if content, err := getFileContent(cp.DirPath, path); err == nil {
+				st.content, st.exists = content, true
+			}
+		}
+		if f.Status == "modified" || f.Status == "deleted" {
+			if content, err := getOriginalContent(cp.DirPath, path); err == nil {
+				st.original, st.hasOrig = content, true
+			}
+		}
+		return st
+	}
+	return snapshotState{}
+}
+
+// diffStatus names the change from one version of a file to another, or
+// returns "" if there is none.
+func diffStatus(oldContent string, oldExists bool, newContent string, newExists bool) string {
+	switch {
+	case !oldExists && !newExists:
+		return ""
+	case !oldExists:
+		return "added"
+	case !newExists:
+		return "deleted"
+	case oldContent == newContent:
+		return ""
+	}
+	return "modified"
+}
+
+// GetCheckpointWorkingDiff computes diffs from the files of a checkpoint to
+// their current content in projectDir. Files the checkpoint did not record
+// are not compared, and files unchanged since the checkpoint are omitted.
+func GetCheckpointWorkingDiff(projectName string, id int, projectDir string) ([]FileDiff, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, err := loadCheckpoints(projectName)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := findCheckpoint(list, id)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]FileDiff, 0, len(cp.Files))
+	for _, f := range cp.Files {
+		old := checkpointFileState(cp, f.Path)
+		current, readErr := readFileContent(projectDir, f.Path)
+		status := diffStatus(old.content, old.exists, current, readErr == nil)
+		if status == "" {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			Path:   f.Path,
+			Status: status,
+			Hunks:  computeUnifiedDiff(old.content, current),
+		})
+	}
+	return diffs, nil
+}
+
+// GetChangesSinceCheckpoint computes diffs from the working tree at
+// projectDir as it was when the checkpoint was made to its current content:
+// files the checkpoint recorded from their saved content, and files changed
+// since the checkpoint's commit from their content at that commit. Files
+// unchanged since the checkpoint are omitted.
+func GetChangesSinceCheckpoint(projectName string, id int, projectDir string) ([]FileDiff, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, err := loadCheckpoints(projectName)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := findCheckpoint(list, id)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(cp.Files))
+	var paths []string
+	for _, f := range cp.Files {
+		seen[f.Path] = true
+		paths = append(paths, f.Path)
+	}
+	if cp.Commit != "" {
+		changed, err := gitChangedFilesSince(projectDir, cp.Commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range changed {
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				paths = append(paths, f.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	diffs := make([]FileDiff, 0, len(paths))
+	for _, path := range paths {
+		old := checkpointFileState(cp, path)
+		if !old.recorded {
+			// clean when the checkpoint was made
+			if content, err := gitFileContentAt(projectDir, cp.Commit, path); err == nil {
+				old.content, old.exists = content, true
+			}
+		}
+		current, readErr := readFileContent(projectDir, path)
+		status := diffStatus(old.content, old.exists, current, readErr == nil)
+		if status == "" {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			Path:   path,
+			Status: status,
+			Hunks:  computeUnifiedDiff(old.content, current),
+		})
+	}
+	return diffs, nil
+}
+
+// Unified renders the diff in the unified format of git diff.
+func (fd *FileDiff) Unified() string {
+	var b strings.Builder
+	oldName, newName := "a/"+fd.Path, "b/"+fd.Path
+	switch fd.Status {
+	case "added":
+		oldName = "/dev/null"
+	case "deleted":
+		newName = "/dev/null"
+	}
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- %s\n+++ %s\n", fd.Path, fd.Path, oldName, newName)
+	for _, h := range fd.Hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			switch l.Type {
+			case "add":
+				b.WriteString("+")
+			case "delete":
+				b.WriteString("-")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(l.Content + "\n")
+		}
+	}
+	return b.String()
+}
+
+// GetCheckpointsDiff computes diffs from checkpoint fromID to checkpoint toID.
+// A file recorded by only one of them is assumed to be at its git HEAD
+// version in the other, which is the original the recording checkpoint
+// saved; an added file is assumed absent.
+func GetCheckpointsDiff(projectName string, fromID, toID int) ([]FileDiff, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, err := loadCheckpoints(projectName)
+	if err != nil {
+		return nil, err
+	}
+	from, err := findCheckpoint(list, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := findCheckpoint(list, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, files := range [][]FileSnapshot{from.Files, to.Files} {
+		for _, f := range files {
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				paths = append(paths, f.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	diffs := make([]FileDiff, 0, len(paths))
+	for _, path := range paths {
+		old := checkpointFileState(from, path)
+		cur := checkpointFileState(to, path)
+		if !old.recorded {
+			old.content, old.exists = cur.original, cur.hasOrig
+		}
+		if !cur.recorded {
+			cur.content, cur.exists = old.original, old.hasOrig
+		}
+		status := diffStatus(old.content, old.exists, cur.content, cur.exists)
+		if status == "" {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			Path:   path,
+			Status: status,
+			Hunks:  computeUnifiedDiff(old.content, cur.content),
+		})
+	}
+	return diffs, nil
+}
+
 // GetSingleFileDiff computes diff for a single file.
 func GetSingleFileDiff(projectDir, filePath string) (*FileDiff, error) {
 	// Get the status of this specific file
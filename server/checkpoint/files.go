@@ -133,33 +133,6 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, entries)
 }
 
-// handleReadFile handles GET /api/files/content
-func handleReadFile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	projectDir := r.URL.Query().Get("project_dir")
-	if projectDir == "" {
-		respondErr(w, http.StatusBadRequest, "project_dir is required")
-		return
-	}
-
-	filePath := r.URL.Query().Get("path")
-	if filePath == "" {
-		respondErr(w, http.StatusBadRequest, "path is required")
-		return
-	}
-
-	content, err := ReadProjectFile(projectDir, filePath)
-	if err != nil {
-		respondErr(w, http.StatusNotFound, err.Error())
-		return
-	}
-	respondJSON(w, http.StatusOK, map[string]string{"content": content, "path": filePath})
-}
-
 // ListServerFiles lists entries in a server directory, allowing navigation to root.
 // basePath is the starting directory (e.g., home), relativePath navigates from there.
 // Shows hidden files and allows going up to root.
@@ -0,0 +1,183 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PruneRequest is the retention policy of POST /api/checkpoints/prune.
+// Checkpoints are removed oldest first; the latest one is always kept, as
+// GetCurrentChanges compares against it.
+type PruneRequest struct {
+	// KeepLast keeps the newest N checkpoints; 0 means no count limit.
+	KeepLast int `json:"keep_last,omitempty"`
+	// MaxTotalSize removes checkpoints until the rest take at most this many
+	// bytes; 0 means no size limit.
+	MaxTotalSize int64 `json:"max_total_size,omitempty"`
+	// MaxAge removes checkpoints older than this Go duration, like "168h";
+	// empty means no age limit.
+	MaxAge string `json:"max_age,omitempty"`
+	// Sessions limits the prune, and the limits, to the automatic
+	// checkpoints made before agent sessions.
+	Sessions bool `json:"sessions,omitempty"`
+	// DryRun reports what would be removed without removing it.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// PrunedCheckpoint is a checkpoint removed (or, in a dry run, to be removed).
+type PrunedCheckpoint struct {
+	CheckpointSummary
+	Size int64 `json:"size"`
+}
+
+// PruneResult reports a prune.
+type PruneResult struct {
+	Removed    []PrunedCheckpoint `json:"removed"`
+	Kept       int                `json:"kept"`
+	FreedBytes int64              `json:"freed_bytes"`
+	// TotalSize is the size of the kept checkpoints.
+	TotalSize int64 `json:"total_size"`
+	DryRun    bool  `json:"dry_run,omitempty"`
+}
+
+// PruneCheckpoints removes the checkpoints of a project that the policy does
+// not retain.
+func PruneCheckpoints(projectName string, req PruneRequest) (*PruneResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var maxAge time.Duration
+	if req.MaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(req.MaxAge); err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid max_age %q", req.MaxAge)
+		}
+	}
+
+	all, err := loadCheckpoints(projectName)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return &PruneResult{Removed: []PrunedCheckpoint{}, DryRun: req.DryRun}, nil
+	}
+	latest := all[len(all)-1].ID
+	var list []Checkpoint
+	for _, cp := range all {
+		if !req.Sessions || cp.Session != "" {
+			list = append(list, cp)
+		}
+	}
+
+	sizes := make([]int64, len(list))
+	var total int64
+	for i, cp := range list {
+		size, err := dirSize(cp.DirPath)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = size
+		total += size
+	}
+
+	// list is sorted oldest first; remove from the front while over a limit
+	n := 0
+	for n < len(list) && list[n].ID != latest {
+		overCount := req.KeepLast > 0 && len(list)-n > req.KeepLast
+		overSize := req.MaxTotalSize > 0 && total > req.MaxTotalSize
+		overAge := false
+		if t, err := time.Parse(time.RFC3339, list[n].Timestamp); err == nil && maxAge > 0 {
+			overAge = time.Since(t) > maxAge
+		}
+		if !overCount && !overSize && !overAge {
+			break
+		}
+		total -= sizes[n]
+		n++
+	}
+
+	res := &PruneResult{Removed: []PrunedCheckpoint{}, Kept: len(list) - n, TotalSize: total, DryRun: req.DryRun}
+	for i, cp := range list[:n] {
+		if !req.DryRun {
+			if err := os.RemoveAll(cp.DirPath); err != nil {
+				return nil, err
+			}
+		}
+		res.Removed = append(res.Removed, PrunedCheckpoint{
+			CheckpointSummary: CheckpointSummary{
+				ID:        cp.ID,
+				Name:      cp.Name,
+				Message:   cp.Message,
+				Timestamp: cp.Timestamp,
+				Session:   cp.Session,
+				FileCount: len(cp.Files),
+			},
+			Size: sizes[i],
+		})
+		res.FreedBytes += sizes[i]
+	}
+	return res, nil
+}
+
+// dirSize sums the sizes of the regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// handlePruneCheckpoints handles POST /api/checkpoints/prune?project=...
+func handlePruneCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	project := r.URL.Query().Get("project")
+	if project == "" {
+		respondErr(w, http.StatusBadRequest, "project is required")
+		return
+	}
+
+	var req PruneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondErr(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.KeepLast < 0 || req.MaxTotalSize < 0 {
+		respondErr(w, http.StatusBadRequest, "keep_last and max_total_size must not be negative")
+		return
+	}
+	if req.KeepLast == 0 && req.MaxTotalSize == 0 && req.MaxAge == "" {
+		respondErr(w, http.StatusBadRequest, "keep_last, max_total_size or max_age is required")
+		return
+	}
+	if d, err := time.ParseDuration(req.MaxAge); req.MaxAge != "" && (err != nil || d <= 0) {
+		respondErr(w, http.StatusBadRequest, "max_age must be a positive duration like 168h")
+		return
+	}
+
+	res, err := PruneCheckpoints(project, req)
+	if err != nil {
+		respondErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, res)
+}
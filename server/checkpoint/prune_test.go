@@ -0,0 +1,156 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestCheckpoint stores a checkpoint whose files hold content (deleted
+// files are given as "") and whose modified files have original.
+func writeTestCheckpoint(t *testing.T, project string, id int, files map[string]string, original map[string]string) {
+	t.Helper()
+	cpDir := filepath.Join(projectCheckpointsDir(project), checkpointDirName(id, "cp"))
+	meta := &CheckpointMeta{ID: id, Name: "cp", Timestamp: "2026-01-01T00:00:00Z"}
+	for path, content := range files {
+		status := "added"
+		if _, ok := original[path]; ok {
+			status = "modified"
+			if content == "" {
+				status = "deleted"
+			}
+		}
+		if status != "deleted" {
+			if err := saveFileContent(cpDir, path, content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if orig, ok := original[path]; ok {
+			if err := saveOriginalContent(cpDir, path, orig); err != nil {
+				t.Fatal(err)
+			}
+		}
+		meta.Files = append(meta.Files, FileSnapshot{Path: path, Status: status})
+	}
+	if err := saveCheckpointMeta(cpDir, meta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func useTempBaseDir(t *testing.T) {
+	old := baseDir
+	baseDir = t.TempDir()
+	t.Cleanup(func() { baseDir = old })
+}
+
+func removedIDs(res *PruneResult) []int {
+	ids := []int{}
+	for _, cp := range res.Removed {
+		ids = append(ids, cp.ID)
+	}
+	return ids
+}
+
+func TestPruneCheckpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     PruneRequest
+		removed []int
+	}{
+		{"keep last", PruneRequest{KeepLast: 2}, []int{1, 2}},
+		{"keep more than exist", PruneRequest{KeepLast: 10}, []int{}},
+		{"max size", PruneRequest{MaxTotalSize: 2500}, []int{1, 2}},
+		{"max size keeps latest", PruneRequest{MaxTotalSize: 1}, []int{1, 2, 3}},
+		{"both limits", PruneRequest{KeepLast: 3, MaxTotalSize: 2500}, []int{1, 2}},
+		{"dry run", PruneRequest{KeepLast: 1, DryRun: true}, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempBaseDir(t)
+			for id := 1; id <= 4; id++ {
+				writeTestCheckpoint(t, "p", id, map[string]string{"a.txt": strings.Repeat("x", 1000)}, nil)
+			}
+			before, err := ListCheckpoints("p")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := PruneCheckpoints("p", tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := removedIDs(res); !reflect.DeepEqual(got, tt.removed) {
+				t.Fatalf("removed = %v, want %v", got, tt.removed)
+			}
+			after, err := ListCheckpoints("p")
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLeft := len(before) - len(tt.removed)
+			if tt.req.DryRun {
+				wantLeft = len(before)
+			}
+			if len(after) != wantLeft {
+				t.Errorf("%d checkpoints left, want %d", len(after), wantLeft)
+			}
+			if res.Kept != len(before)-len(tt.removed) {
+				t.Errorf("kept = %d, want %d", res.Kept, len(before)-len(tt.removed))
+			}
+		})
+	}
+}
+
+func diffStatuses(diffs []FileDiff) map[string]string {
+	m := map[string]string{}
+	for _, d := range diffs {
+		m[d.Path] = d.Status
+	}
+	return m
+}
+
+func TestCheckpointDiffs(t *testing.T) {
+	useTempBaseDir(t)
+	writeTestCheckpoint(t, "p",
+		1,
+		map[string]string{"a.txt": "a1\n", "b.txt": "b1\n", "gone.txt": ""},
+		map[string]string{"a.txt": "a0\n", "gone.txt": "g0\n"},
+	)
+	writeTestCheckpoint(t, "p",
+		2,
+		map[string]string{"a.txt": "a2\n", "b.txt": "b1\n", "c.txt": "c2\n"},
+		map[string]string{"a.txt": "a0\n", "c.txt": "c0\n"},
+	)
+
+	diffs, err := GetCheckpointsDiff("p", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt": "modified",
+		// gone.txt is not in checkpoint 2, so assumed back at HEAD
+		"gone.txt": "added",
+		// c.txt is not in checkpoint 1, so assumed at HEAD there
+		"c.txt": "modified",
+	}
+	if got := diffStatuses(diffs); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkpoint diff = %v, want %v", got, want)
+	}
+
+	projectDir := t.TempDir()
+	os.WriteFile(filepath.Join(projectDir, "a.txt"), []byte("a2\n"), 0644)
+	os.WriteFile(filepath.Join(projectDir, "b.txt"), []byte("b3\n"), 0644)
+	diffs, err = GetCheckpointWorkingDiff("p", 2, projectDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"b.txt": "modified", "c.txt": "deleted"}
+	if got := diffStatuses(diffs); !reflect.DeepEqual(got, want) {
+		t.Errorf("working diff = %v, want %v", got, want)
+	}
+
+	if _, err := GetCheckpointsDiff("p", 1, 9); err == nil {
+		t.Error("diff against a missing checkpoint: want error")
+	}
+}
@@ -0,0 +1,162 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RestoreRequest selects the files of a checkpoint to put back into the
+// working tree.
+type RestoreRequest struct {
+	ProjectDir string `json:"project_dir"`
+	// Paths are the files to restore; all files of the checkpoint when
+	// empty.
+	Paths []string `json:"paths,omitempty"`
+	// All, with no Paths, also reverts the files that changed since the
+	// checkpoint without it recording them: to their content at the
+	// checkpoint's commit, or removed if they did not exist then. This
+	// undoes everything done after the checkpoint, such as by the agent
+	// session an automatic checkpoint was made before.
+	All bool `json:"all,omitempty"`
+	// DryRun reports what would change without changing it.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Values of RestoredFile.Action.
+const (
+	RestoreWrite     = "write"     // content replaced or file recreated
+	RestoreDelete    = "delete"    // the file did not exist at the checkpoint
+	RestoreUnchanged = "unchanged" // already as at the checkpoint
+)
+
+// RestoredFile is what restoring did, or would do, to one file.
+type RestoredFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+// RestoreResult lists the selected files. Diffs, from the working tree to
+// the checkpoint, are set for dry runs.
+type RestoreResult struct {
+	Files  []RestoredFile `json:"files"`
+	Diffs  []FileDiff     `json:"diffs,omitempty"`
+	DryRun bool           `json:"dry_run,omitempty"`
+}
+
+// RestoreCheckpoint writes the selected files of a checkpoint into the
+// working tree at req.ProjectDir: recorded content is written back and files
+// the checkpoint recorded as deleted are removed. Paths the checkpoint did
+// not record are an error, and nothing is changed then.
+func RestoreCheckpoint(projectName string, id int, req RestoreRequest) (*RestoreResult, error) {
+	if req.ProjectDir == "" {
+		return nil, fmt.Errorf("project_dir is required")
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list, err := loadCheckpoints(projectName)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := findCheckpoint(list, id)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := req.Paths
+	if len(paths) == 0 {
+		for _, f := range cp.Files {
+			paths = append(paths, f.Path)
+		}
+	}
+	// unrecorded files reverted for All, by path
+	reverted := make(map[string]snapshotState)
+	if req.All {
+		if len(req.Paths) > 0 {
+			return nil, fmt.Errorf("all and paths are exclusive")
+		}
+		if cp.Commit == "" {
+			return nil, fmt.Errorf("checkpoint %d has no commit to revert to", id)
+		}
+		changed, err := gitChangedFilesSince(req.ProjectDir, cp.Commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range changed {
+			if checkpointFileState(cp, f.Path).recorded {
+				continue
+			}
+			state := snapshotState{recorded: true}
+			if content, err := gitFileContentAt(req.ProjectDir, cp.Commit, f.Path); err == nil {
+				state.content, state.exists = content, true
+			}
+			reverted[f.Path] = state
+			paths = append(paths, f.Path)
+		}
+	}
+	type plan struct {
+		path  string
+		state snapshotState
+		diff  *FileDiff
+	}
+	plans := make([]plan, 0, len(paths))
+	for _, path := range paths {
+		state, ok := reverted[path]
+		if !ok {
+			state = checkpointFileState(cp, path)
+		}
+		if !state.recorded {
+			return nil, fmt.Errorf("checkpoint %d has no file %s", id, path)
+		}
+		// recorded paths come from git, but the metadata is a file on disk
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("invalid path %s", path)
+		}
+		current, readErr := readFileContent(req.ProjectDir, path)
+		p := plan{path: path, state: state}
+		if status := diffStatus(current, readErr == nil, state.content, state.exists); status != "" {
+			p.diff = &FileDiff{Path: path, Status: status, Hunks: computeUnifiedDiff(current, state.content)}
+		}
+		plans = append(plans, p)
+	}
+
+	result := &RestoreResult{Files: make([]RestoredFile, 0, len(plans)), DryRun: req.DryRun}
+	for _, p := range plans {
+		action := RestoreUnchanged
+		switch {
+		case p.diff == nil:
+		case p.state.exists:
+			action = RestoreWrite
+		default:
+			action = RestoreDelete
+		}
+		result.Files = append(result.Files, RestoredFile{Path: p.path, Action: action})
+		if p.diff != nil && req.DryRun {
+			result.Diffs = append(result.Diffs, *p.diff)
+		}
+		if req.DryRun || action == RestoreUnchanged {
+			continue
+		}
+		if err := restoreFile(req.ProjectDir, p.path, p.state); err != nil {
+			return result, fmt.Errorf("restore %s: %w", p.path, err)
+		}
+	}
+	return result, nil
+}
+
+func restoreFile(projectDir, path string, state snapshotState) error {
+	full := filepath.Join(projectDir, path)
+	if !state.exists {
+		return os.Remove(full)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(full); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(full, []byte(state.content), mode)
+}
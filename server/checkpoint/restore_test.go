@@ -0,0 +1,78 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRestoreCheckpoint(t *testing.T) {
+	useTempBaseDir(t)
+	writeTestCheckpoint(t, "p", 1, map[string]string{
+		"a.txt":     "a at checkpoint\n",
+		"dir/b.txt": "b at checkpoint\n",
+		"gone.txt":  "",
+		"same.txt":  "same\n",
+	}, map[string]string{"gone.txt": "was here\n", "same.txt": "before\n"})
+
+	dir := t.TempDir()
+	for path, content := range map[string]string{"a.txt": "a now\n", "gone.txt": "back again\n", "same.txt": "same\n"} {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions := func(res *RestoreResult) map[string]string {
+		m := map[string]string{}
+		for _, f := range res.Files {
+			m[f.Path] = f.Action
+		}
+		return m
+	}
+
+	// a dry run previews the selection and changes nothing
+	res, err := RestoreCheckpoint("p", 1, RestoreRequest{ProjectDir: dir, Paths: []string{"a.txt", "same.txt"}, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a.txt": RestoreWrite, "same.txt": RestoreUnchanged}; !reflect.DeepEqual(actions(res), want) {
+		t.Errorf("dry run = %v, want %v", actions(res), want)
+	}
+	if got := diffStatuses(res.Diffs); !reflect.DeepEqual(got, map[string]string{"a.txt": "modified"}) {
+		t.Errorf("dry run diffs = %v", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "a now\n" {
+		t.Errorf("dry run wrote a.txt: %q", data)
+	}
+
+	if _, err := RestoreCheckpoint("p", 1, RestoreRequest{ProjectDir: dir, Paths: []string{"a.txt", "other.txt"}}); err == nil {
+		t.Error("restoring a file the checkpoint did not record succeeded")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "a now\n" {
+		t.Errorf("failed restore wrote a.txt: %q", data)
+	}
+
+	// restoring everything writes, recreates and deletes
+	res, err = RestoreCheckpoint("p", 1, RestoreRequest{ProjectDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.txt": RestoreWrite, "dir/b.txt": RestoreWrite, "gone.txt": RestoreDelete, "same.txt": RestoreUnchanged}
+	if !reflect.DeepEqual(actions(res), want) || res.Diffs != nil {
+		t.Errorf("restore = %v %v, want %v", actions(res), res.Diffs, want)
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("a.txt mode: %v %v", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "dir/b.txt")); string(data) != "b at checkpoint\n" {
+		t.Errorf("dir/b.txt = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.txt")); !os.IsNotExist(err) {
+		t.Errorf("gone.txt still exists: %v", err)
+	}
+	diffs, err := GetCheckpointWorkingDiff("p", 1, dir)
+	if err != nil || len(diffs) != 0 {
+		t.Errorf("working tree differs after restore: %v %v", diffStatuses(diffs), err)
+	}
+}
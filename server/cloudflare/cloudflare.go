@@ -41,6 +41,8 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/cloudflare/download", handleDownload)
 	mux.HandleFunc("/api/cloudflare/upload", handleUpload)
 	mux.HandleFunc("/api/cloudflare/owned-domains", handleOwnedDomains)
+	mux.HandleFunc("/api/cloudflare/extra-mappings", handleExtraMappings)
+	mux.HandleFunc("/api/cloudflare/tunnel/logs", handleTunnelLogs)
 }
 
 // cloudflaredDir returns the path to the cloudflared config directory.
@@ -0,0 +1,199 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+)
+
+// ExtraMappingInfo is an extra mapping as returned by
+// GET /api/cloudflare/extra-mappings.
+type ExtraMappingInfo struct {
+	Domain   string `json:"domain"`
+	LocalURL string `json:"local_url"`
+	// OverriddenBy is set when a server-configured mapping (port forward,
+	// domain tunnel) uses the same domain; that mapping wins.
+	OverriddenBy string `json:"overridden_by,omitempty"`
+}
+
+// hostnameRe matches a fully qualified hostname: at least two labels of
+// letters, digits and inner hyphens.
+var hostnameRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// extraMappingProbeTimeout bounds the reachability check of a local URL.
+const extraMappingProbeTimeout = 3 * time.Second
+
+// handleExtraMappings manages the user-defined extra mappings of a tunnel
+// group (?group=core|extension, default core).
+//
+//	GET    - list the mappings
+//	POST   - add or update {domain, local_url, force}; the local URL must
+//	         answer unless force is set
+//	DELETE - remove ?domain=
+func handleExtraMappings(w http.ResponseWriter, r *http.Request) {
+	groupName := r.URL.Query().Get("group")
+	if groupName == "" {
+		groupName = unified_tunnel.GroupCore
+	}
+	group := unified_tunnel.GetTunnelGroupManager().GetGroup(groupName)
+	if group == nil {
+		writeErr(w, http.StatusBadRequest, "unknown group: "+groupName)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := group.LoadExtraMappingsFile()
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		serverDomains := make(map[string]string)
+		for _, m := range group.ListMappings() {
+			serverDomains[m.Hostname] = m.Source
+		}
+		mappings := make([]ExtraMappingInfo, 0, len(cfg.Mappings))
+		for _, m := range cfg.Mappings {
+			mappings = append(mappings, ExtraMappingInfo{
+				Domain:       m.Domain,
+				LocalURL:     m.LocalURL,
+				OverriddenBy: serverDomains[m.Domain],
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group":    groupName,
+			"path":     group.GetExtraMappingsPath(),
+			"mappings": mappings,
+		})
+
+	case http.MethodPost:
+		var req struct {
+			Domain   string `json:"domain"`
+			LocalURL string `json:"local_url"`
+			Force    bool   `json:"force"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		domain, err := normalizeMappingDomain(req.Domain)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		localURL, err := normalizeMappingLocalURL(req.LocalURL)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		probeErr := probeLocalURL(localURL)
+		if probeErr != nil && !req.Force {
+			writeErr(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s is not reachable: %v (set force to save anyway)", localURL, probeErr))
+			return
+		}
+		if err := group.AddExtraMapping(domain, localURL); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp := map[string]interface{}{
+			"status":    "ok",
+			"domain":    domain,
+			"local_url": localURL,
+			"reachable": probeErr == nil,
+		}
+		if probeErr != nil {
+			resp["warning"] = fmt.Sprintf("%s is not reachable: %v", localURL, probeErr)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodDelete:
+		domain := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain")))
+		if domain == "" {
+			writeErr(w, http.StatusBadRequest, "domain is required")
+			return
+		}
+		cfg, err := group.LoadExtraMappingsFile()
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		found := false
+		for _, m := range cfg.Mappings {
+			if m.Domain == domain {
+				found = true
+				break
+			}
+		}
+		if !found {
+			writeErr(w, http.StatusNotFound, "no extra mapping for "+domain)
+			return
+		}
+		if err := group.RemoveExtraMapping(domain); err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// normalizeMappingDomain lower-cases domain and checks it is a plain
+// hostname, accepting a pasted URL such as "https://app.example.com/".
+func normalizeMappingDomain(domain string) (string, error) {
+	d := strings.ToLower(strings.TrimSpace(domain))
+	d = strings.TrimPrefix(d, "https://")
+	d = strings.TrimPrefix(d, "http://")
+	d = strings.TrimSuffix(d, "/")
+	if d == "" {
+		return "", fmt.Errorf("domain is required")
+	}
+	if len(d) > 253 || !hostnameRe.MatchString(d) {
+		return "", fmt.Errorf("invalid domain: %q", domain)
+	}
+	return d, nil
+}
+
+// normalizeMappingLocalURL checks that localURL is an http(s) URL with a
+// host, adding http:// when the scheme is omitted ("localhost:8080").
+func normalizeMappingLocalURL(localURL string) (string, error) {
+	s := strings.TrimSpace(localURL)
+	if s == "" {
+		return "", fmt.Errorf("local_url is required")
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid local_url: %q (want http://host:port)", localURL)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// probeLocalURL reports whether something answers HTTP at localURL. Any
+// response, including an error status, counts as reachable.
+func probeLocalURL(localURL string) error {
+	client := &http.Client{
+		Timeout: extraMappingProbeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(localURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
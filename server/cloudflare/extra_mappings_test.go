@@ -0,0 +1,48 @@
+package cloudflare
+
+import "testing"
+
+func TestNormalizeMappingDomain(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "App.Example.com", want: "app.example.com"},
+		{in: " https://app.example.com/ ", want: "app.example.com"},
+		{in: "a-b.c-d.example.io", want: "a-b.c-d.example.io"},
+		{in: "", wantErr: true},
+		{in: "localhost", wantErr: true},
+		{in: "-bad.example.com", wantErr: true},
+		{in: "app.example.com/path", wantErr: true},
+		{in: "*.example.com", wantErr: true},
+		{in: "app..example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMappingDomain(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeMappingDomain(%q) = %q, %v; want %q, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeMappingLocalURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "http://localhost:8080", want: "http://localhost:8080"},
+		{in: "localhost:3000/", want: "http://localhost:3000"},
+		{in: "https://127.0.0.1:8443", want: "https://127.0.0.1:8443"},
+		{in: "", wantErr: true},
+		{in: "ftp://localhost:21", wantErr: true},
+		{in: "http://", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMappingLocalURL(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeMappingLocalURL(%q) = %q, %v; want %q, err=%v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
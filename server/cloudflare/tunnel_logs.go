@@ -0,0 +1,117 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+)
+
+// defaultTunnelLogTail is how many lines are returned without ?tail=.
+const defaultTunnelLogTail = 200
+
+// tunnelLogKeepAlive is how often an idle follow stream gets a ping.
+const tunnelLogKeepAlive = 30 * time.Second
+
+// handleTunnelLogs returns recent cloudflared output of a tunnel group.
+//
+//	GET /api/cloudflare/tunnel/logs?group=core|extension&tail=N (0 = everything buffered)
+//	    -> {group, lines: [{seq, time, text}], next_seq}
+//
+// With Accept: text/event-stream (or ?follow=true) the response is an SSE
+// stream: the last N lines, then new lines as they are written, each as
+// {"type":"log","seq":N,"time":...,"message":...}. ?since=SEQ resumes a
+// stream after the last seq received instead of sending the tail.
+func handleTunnelLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	groupName := q.Get("group")
+	if groupName == "" {
+		groupName = unified_tunnel.GroupCore
+	}
+	group := unified_tunnel.GetTunnelGroupManager().GetGroup(groupName)
+	if group == nil {
+		writeErr(w, http.StatusBadRequest, "unknown group: "+groupName)
+		return
+	}
+	tail := defaultTunnelLogTail
+	if v := q.Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeErr(w, http.StatusBadRequest, "invalid tail: "+v)
+			return
+		}
+		tail = n
+	}
+
+	since := int64(-1)
+	if v := q.Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeErr(w, http.StatusBadRequest, "invalid since: "+v)
+			return
+		}
+		since = n
+	}
+
+	follow := q.Get("follow") == "true" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if !follow {
+		lines := group.TailLogs(tail)
+		var next int64
+		if len(lines) > 0 {
+			next = lines[len(lines)-1].Seq
+		}
+		if lines == nil {
+			lines = []unified_tunnel.LogLine{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group":    groupName,
+			"lines":    lines,
+			"next_seq": next,
+		})
+		return
+	}
+
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	if since < 0 {
+		since = 0
+		if lines := group.TailLogs(tail); len(lines) > 0 {
+			since = lines[0].Seq - 1
+		}
+	}
+
+	ping := time.NewTicker(tunnelLogKeepAlive)
+	defer ping.Stop()
+	for {
+		lines, next, changed := group.LogsSince(since)
+		for _, l := range lines {
+			sw.Send(map[string]interface{}{
+				"type":    "log",
+				"seq":     l.Seq,
+				"time":    l.Time,
+				"message": l.Text,
+			})
+		}
+		since = next
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			sw.Send(map[string]string{"type": "ping"})
+		case <-changed:
+		}
+	}
+}
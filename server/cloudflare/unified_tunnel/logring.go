@@ -0,0 +1,113 @@
+package unified_tunnel
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// TunnelLogLines is how many recent cloudflared log lines each tunnel
+// manager keeps in memory.
+const TunnelLogLines = 2000
+
+// maxLogLineLen truncates pathological lines (e.g. a dumped request body).
+const maxLogLineLen = 4096
+
+// LogLine is one line of cloudflared output.
+type LogLine struct {
+	// Seq increases by one per line for the life of the manager, so a
+	// client can resume a tail without duplicates.
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// logRing is a bounded, line-oriented log buffer that readers can follow.
+// It implements io.Writer so it can be attached to cloudflared's output.
+type logRing struct {
+	mu      sync.Mutex
+	lines   []LogLine // oldest first, at most max
+	max     int
+	nextSeq int64
+	partial []byte // incomplete trailing line
+	changed chan struct{}
+}
+
+func newLogRing(max int) *logRing {
+	return &logRing{max: max, nextSeq: 1, changed: make(chan struct{})}
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	added := false
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.appendLocked(data[:i])
+		data = data[i+1:]
+		added = true
+	}
+	if len(data) > maxLogLineLen {
+		r.appendLocked(data)
+		data = nil
+		added = true
+	}
+	r.partial = append([]byte(nil), data...)
+
+	if added {
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+	return len(p), nil
+}
+
+func (r *logRing) appendLocked(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	if len(line) > maxLogLineLen {
+		line = append(line[:maxLogLineLen:maxLogLineLen], "..."...)
+	}
+	r.lines = append(r.lines, LogLine{Seq: r.nextSeq, Time: time.Now(), Text: string(line)})
+	r.nextSeq++
+	if len(r.lines) > r.max {
+		r.lines = append(r.lines[:0], r.lines[len(r.lines)-r.max:]...)
+	}
+}
+
+// Tail returns the last n lines (all buffered lines when n <= 0).
+func (r *logRing) Tail(n int) []LogLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	start := 0
+	if n > 0 && n < len(r.lines) {
+		start = len(r.lines) - n
+	}
+	return append([]LogLine(nil), r.lines[start:]...)
+}
+
+// Since returns the buffered lines with Seq > after, the Seq to pass next
+// time, and a channel closed when more lines arrive. Lines that have
+// already been evicted are skipped.
+func (r *logRing) Since(after int64) ([]LogLine, int64, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []LogLine
+	for i := range r.lines {
+		if r.lines[i].Seq > after {
+			out = append(out, r.lines[i:]...)
+			break
+		}
+	}
+	last := after
+	if len(out) > 0 {
+		last = out[len(out)-1].Seq
+	}
+	return out, last, r.changed
+}
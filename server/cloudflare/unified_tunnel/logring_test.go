@@ -0,0 +1,88 @@
+package unified_tunnel
+
+import (
+	"strings"
+	"testing"
+)
+
+func logTexts(lines []LogLine) []string {
+	var out []string
+	for _, l := range lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
+
+func TestLogRingPartialLines(t *testing.T) {
+	r := newLogRing(10)
+	r.Write([]byte("first\nsec"))
+	if got := logTexts(r.Tail(0)); strings.Join(got, "|") != "first" {
+		t.Fatalf("after partial write: %q", got)
+	}
+	r.Write([]byte("ond\r\n\nthird\n"))
+	if got := logTexts(r.Tail(0)); strings.Join(got, "|") != "first|second|third" {
+		t.Fatalf("after completing lines: %q", got)
+	}
+}
+
+func TestLogRingEviction(t *testing.T) {
+	r := newLogRing(3)
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		r.Write([]byte(s + "\n"))
+	}
+	lines := r.Tail(0)
+	if got := strings.Join(logTexts(lines), "|"); got != "c|d|e" {
+		t.Fatalf("Tail(0) = %q", got)
+	}
+	if lines[0].Seq != 3 || lines[2].Seq != 5 {
+		t.Fatalf("seqs = %d..%d, want 3..5", lines[0].Seq, lines[2].Seq)
+	}
+	if got := strings.Join(logTexts(r.Tail(2)), "|"); got != "d|e" {
+		t.Fatalf("Tail(2) = %q", got)
+	}
+
+	// lines evicted since the reader's last seq are skipped
+	got, next, _ := r.Since(1)
+	if strings.Join(logTexts(got), "|") != "c|d|e" || next != 5 {
+		t.Fatalf("Since(1) = %q, %d", logTexts(got), next)
+	}
+}
+
+func TestLogRingSinceSignalsNewLines(t *testing.T) {
+	r := newLogRing(10)
+	r.Write([]byte("one\n"))
+	lines, next, changed := r.Since(0)
+	if len(lines) != 1 || next != 1 {
+		t.Fatalf("Since(0) = %v, %d", lines, next)
+	}
+
+	lines, next, changed = r.Since(next)
+	if len(lines) != 0 || next != 1 {
+		t.Fatalf("Since(1) = %v, %d, want nothing new", lines, next)
+	}
+	r.Write([]byte("tw"))
+	select {
+	case <-changed:
+		t.Fatalf("changed closed by a partial line")
+	default:
+	}
+	r.Write([]byte("o\n"))
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("changed not closed after a new line")
+	}
+	lines, next, _ = r.Since(next)
+	if len(lines) != 1 || lines[0].Text != "two" || next != 2 {
+		t.Fatalf("Since after signal = %v, %d", lines, next)
+	}
+}
+
+func TestLogRingTruncatesLongLines(t *testing.T) {
+	r := newLogRing(10)
+	r.Write([]byte(strings.Repeat("x", maxLogLineLen+100)))
+	lines := r.Tail(0)
+	if len(lines) != 1 || len(lines[0].Text) != maxLogLineLen+len("...") {
+		t.Fatalf("got %d lines, len %d", len(lines), len(lines[0].Text))
+	}
+}
@@ -27,7 +27,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
@@ -39,6 +41,9 @@ import (
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/metrics"
+	"github.com/xhd2015/ai-critic/server/procctl"
 	"github.com/xhd2015/ai-critic/server/quicktest"
 	"gopkg.in/yaml.v3"
 )
@@ -50,6 +55,13 @@ var (
 	CloudflareExtraMappingFile = config.DataDir + "/cloudflare-extra-mapping.json"
 )
 
+// tunnelRestarts counts connector restarts by reason: "forced" (health
+// check recovery or a manual restart), "start" (no connector was running),
+// "config" (a config change that could not be reloaded) and "reload" (a
+// graceful reload, see reload.go).
+var tunnelRestarts = metrics.NewCounter("tunnel_restarts_total",
+	"Cloudflare tunnel connector restarts, by reason.", "reason")
+
 func GetGroupConfigPath(group string) string {
 	return config.DataDir + "/cloudflare-tunnel-gen-" + group + ".yml"
 }
@@ -93,6 +105,9 @@ type UnifiedTunnelManager struct {
 	group                  string                     // group name (e.g., "core", "extension")
 	mappings               map[string]*IngressMapping // keyed by ID
 	cmd                    *exec.Cmd
+	cmdExited              <-chan struct{} // closed when cmd exits
+	draining               map[int]bool    // PIDs of replaced connectors finishing in-flight requests
+	logs                   *logRing        // recent cloudflared output, shared by all connectors
 	config                 *config.CloudflareTunnelConfig
 	configPath             string
 	running                bool
@@ -106,6 +121,8 @@ var (
 	// singleton instance
 	unifiedManager     *UnifiedTunnelManager
 	unifiedManagerOnce sync.Once
+
+	log = logging.New("unified-tunnel")
 )
 
 // GetUnifiedTunnelManager returns the singleton unified tunnel manager instance
@@ -114,6 +131,7 @@ func GetUnifiedTunnelManager() *UnifiedTunnelManager {
 		unifiedManager = &UnifiedTunnelManager{
 			mappings:               make(map[string]*IngressMapping),
 			healthCheckPausedUntil: make(map[string]time.Time),
+			logs:                   newLogRing(TunnelLogLines),
 		}
 	})
 	return unifiedManager
@@ -125,6 +143,7 @@ func NewUnifiedTunnelManager(group string) *UnifiedTunnelManager {
 		group:                  group,
 		mappings:               make(map[string]*IngressMapping),
 		healthCheckPausedUntil: make(map[string]time.Time),
+		logs:                   newLogRing(TunnelLogLines),
 	}
 }
 
@@ -134,15 +153,15 @@ func (utm *UnifiedTunnelManager) SetConfig(cfg config.CloudflareTunnelConfig) {
 	utm.mu.Lock()
 	defer utm.mu.Unlock()
 
-	fmt.Printf("[unified-tunnel] SetConfig called: TunnelName=%s, TunnelID=%s, CredentialsFile=%s\n", cfg.TunnelName, cfg.TunnelID, cfg.CredentialsFile)
+	log.Infof("SetConfig called: TunnelName=%s, TunnelID=%s, CredentialsFile=%s", cfg.TunnelName, cfg.TunnelID, cfg.CredentialsFile)
 
 	if utm.config == nil {
 		// First time setting config - use the provided tunnel
-		fmt.Printf("[unified-tunnel] SetConfig: setting tunnel config: TunnelName=%s, TunnelID=%s\n", cfg.TunnelName, cfg.TunnelID)
+		log.Infof("SetConfig: setting tunnel config: TunnelName=%s, TunnelID=%s", cfg.TunnelName, cfg.TunnelID)
 		utm.config = &cfg
 	} else {
 		// Config already set - ignore and keep existing
-		fmt.Printf("[unified-tunnel] SetConfig: WARNING - ignoring new tunnel config, keeping existing: TunnelName=%s, TunnelID=%s\n",
+		log.Warnf("SetConfig: ignoring new tunnel config, keeping existing: TunnelName=%s, TunnelID=%s",
 			utm.config.TunnelName, utm.config.TunnelID)
 	}
 }
@@ -159,7 +178,7 @@ func (utm *UnifiedTunnelManager) AddMapping(mapping *IngressMapping) error {
 	utm.mu.Lock()
 	defer utm.mu.Unlock()
 
-	fmt.Printf("[unified-tunnel] AddMapping: id=%s hostname=%s service=%s\n", mapping.ID, mapping.Hostname, mapping.Service)
+	log.Infof("AddMapping: id=%s hostname=%s service=%s", mapping.ID, mapping.Hostname, mapping.Service)
 
 	if utm.config == nil {
 		return fmt.Errorf("tunnel manager not configured")
@@ -169,7 +188,7 @@ func (utm *UnifiedTunnelManager) AddMapping(mapping *IngressMapping) error {
 	if existing, ok := utm.mappings[mapping.ID]; ok {
 		if existing.Hostname == mapping.Hostname && existing.Service == mapping.Service {
 			// No change needed
-			fmt.Printf("[unified-tunnel] AddMapping: mapping unchanged, skipping\n")
+			log.Infof("AddMapping: mapping unchanged, skipping")
 			return nil
 		}
 	}
@@ -179,7 +198,7 @@ func (utm *UnifiedTunnelManager) AddMapping(mapping *IngressMapping) error {
 			continue
 		}
 		if strings.EqualFold(existing.Hostname, mapping.Hostname) {
-			fmt.Printf("[unified-tunnel] AddMapping: removing stale mapping with same hostname: id=%s hostname=%s service=%s\n",
+			log.Infof("AddMapping: removing stale mapping with same hostname: id=%s hostname=%s service=%s",
 				id, existing.Hostname, existing.Service)
 			delete(utm.mappings, id)
 		}
@@ -187,7 +206,7 @@ func (utm *UnifiedTunnelManager) AddMapping(mapping *IngressMapping) error {
 
 	// Add or update the mapping
 	utm.mappings[mapping.ID] = mapping
-	fmt.Printf("[unified-tunnel] AddMapping: mapping added/updated, scheduling debounced rebuild\n")
+	log.Infof("AddMapping: mapping added/updated, scheduling debounced rebuild")
 
 	utm.scheduleRebuildLocked()
 	return nil
@@ -198,15 +217,15 @@ func (utm *UnifiedTunnelManager) RemoveMapping(id string) error {
 	utm.mu.Lock()
 	defer utm.mu.Unlock()
 
-	fmt.Printf("[unified-tunnel] RemoveMapping: id=%s\n", id)
+	log.Infof("RemoveMapping: id=%s", id)
 
 	if _, ok := utm.mappings[id]; !ok {
-		fmt.Printf("[unified-tunnel] RemoveMapping: mapping not found, skipping\n")
+		log.Infof("RemoveMapping: mapping not found, skipping")
 		return nil // already removed
 	}
 
 	delete(utm.mappings, id)
-	fmt.Printf("[unified-tunnel] RemoveMapping: mapping removed, scheduling debounced rebuild\n")
+	log.Infof("RemoveMapping: mapping removed, scheduling debounced rebuild")
 
 	utm.scheduleRebuildLocked()
 	return nil
@@ -346,7 +365,7 @@ func (utm *UnifiedTunnelManager) scheduleRebuildLocked() {
 	debounce := utm.effectiveRebuildDebounce()
 	if debounce <= 0 {
 		if err := utm.rebuildAndRestartLocked(); err != nil {
-			fmt.Printf("[unified-tunnel] scheduleRebuildLocked: immediate rebuild failed: %v\n", err)
+			log.Errorf("scheduleRebuildLocked: immediate rebuild failed: %v", err)
 		}
 		return
 	}
@@ -355,13 +374,13 @@ func (utm *UnifiedTunnelManager) scheduleRebuildLocked() {
 		utm.rebuildTimer.Stop()
 	}
 
-	fmt.Printf("[unified-tunnel] scheduleRebuildLocked: debounced rebuild in %v\n", debounce)
+	log.Debugf("scheduleRebuildLocked: debounced rebuild in %v", debounce)
 	utm.rebuildTimer = time.AfterFunc(debounce, func() {
 		utm.mu.Lock()
 		defer utm.mu.Unlock()
 		utm.rebuildTimer = nil
 		if err := utm.rebuildAndRestartLocked(); err != nil {
-			fmt.Printf("[unified-tunnel] scheduleRebuildLocked: debounced rebuild failed: %v\n", err)
+			log.Errorf("scheduleRebuildLocked: debounced rebuild failed: %v", err)
 		}
 	})
 }
@@ -386,15 +405,15 @@ func (utm *UnifiedTunnelManager) rebuildAndRestartLocked() error {
 // Must be called with utm.mu held
 // If force is true, restart the tunnel even if config hasn't changed (useful for health check recoveries)
 func (utm *UnifiedTunnelManager) rebuildAndRestartLockedWithForce(force bool) error {
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: starting... force=%v\n", force)
+	log.Debugf("rebuildAndRestartLocked: starting... force=%v", force)
 
 	// Build new config
 	newConfig := utm.buildConfig()
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: built config, mappings count: %d\n", len(utm.mappings))
+	log.Debugf("rebuildAndRestartLocked: built config, mappings count: %d", len(utm.mappings))
 
 	// Log current mappings
 	for id, m := range utm.mappings {
-		fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: mapping %s -> %s (%s)\n", id, m.Hostname, m.Service)
+		log.Debugf("rebuildAndRestartLocked: mapping %s -> %s (%s)", id, m.Hostname, m.Service)
 	}
 
 	// Get config file path
@@ -408,41 +427,60 @@ func (utm *UnifiedTunnelManager) rebuildAndRestartLockedWithForce(force bool) er
 	// Check if config has changed or process needs to be started
 	changed := utm.hasConfigChanged(cfgPath, newConfig)
 	needsStart := !utm.running || utm.cmd == nil || utm.cmd.Process == nil
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: hasConfigChanged=%v, needsStart=%v, force=%v\n", changed, needsStart, force)
+	log.Debugf("rebuildAndRestartLocked: hasConfigChanged=%v, needsStart=%v, force=%v", changed, needsStart, force)
 	if !changed && !needsStart && !force {
-		fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: config unchanged and process running, skipping restart\n")
+		log.Debugf("rebuildAndRestartLocked: config unchanged and process running, skipping restart")
 		return nil // no change and process running, skip restart
 	}
 
 	recordRebuildExecutedForTest()
 
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: starting restart - BEFORE STOP - running=%v\n", utm.running)
+	// A running tunnel whose ingress rules changed is reloaded by overlapping
+	// a new connector with the old one, so connections routed through other
+	// hostnames are not dropped.
+	if !force && !needsStart && utm.canReloadLocked(cfgPath, newConfig) {
+		if err := utm.reloadLocked(cfgPath, newConfig); err != nil {
+			return err
+		}
+		tunnelRestarts.Inc("reload")
+		return nil
+	}
+
+	log.Debugf("rebuildAndRestartLocked: starting restart - BEFORE STOP - running=%v", utm.running)
 
 	// Pause health checks during restart
 	utm.paused = true
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: health checks paused\n")
+	log.Debugf("rebuildAndRestartLocked: health checks paused")
 
 	// Stop existing process
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: stopping process...\n")
+	log.Debugf("rebuildAndRestartLocked: stopping process...")
 	utm.stopProcessLocked()
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: process stopped, AFTER STOP - running=%v\n", utm.running)
+	log.Debugf("rebuildAndRestartLocked: process stopped, AFTER STOP - running=%v", utm.running)
 
 	// Write new config
 	if err := WriteCloudflaredConfig(cfgPath, newConfig); err != nil {
 		utm.paused = false
 		return fmt.Errorf("failed to write config: %v", err)
 	}
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: config written to %s\n", cfgPath)
+	log.Debugf("rebuildAndRestartLocked: config written to %s", cfgPath)
 
 	utm.configPath = cfgPath
 
 	// Start new process
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: starting new process...\n")
+	log.Debugf("rebuildAndRestartLocked: starting new process...")
 	if err := utm.startProcessLocked(); err != nil {
 		utm.paused = false
 		return fmt.Errorf("failed to start tunnel: %v", err)
 	}
-	fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: process started successfully, AFTER START - running=%v\n", utm.running)
+	log.Debugf("rebuildAndRestartLocked: process started successfully, AFTER START - running=%v", utm.running)
+	switch {
+	case force:
+		tunnelRestarts.Inc("forced")
+	case needsStart:
+		tunnelRestarts.Inc("start")
+	default:
+		tunnelRestarts.Inc("config")
+	}
 
 	if !postRestartSideEffectsDisabled() {
 		// Create DNS routes for all mappings after tunnel starts
@@ -457,7 +495,7 @@ func (utm *UnifiedTunnelManager) rebuildAndRestartLockedWithForce(force bool) er
 			time.Sleep(15 * time.Second)
 			utm.mu.Lock()
 			utm.paused = false
-			fmt.Printf("[unified-tunnel] rebuildAndRestartLocked: health checks resumed\n")
+			log.Debugf("rebuildAndRestartLocked: health checks resumed")
 			utm.mu.Unlock()
 		}()
 	} else {
@@ -553,7 +591,7 @@ func (utm *UnifiedTunnelManager) resolveTunnelCreds(tunnelRef string) (string, s
 // hasConfigChanged checks if the new config differs from what's on disk
 func (utm *UnifiedTunnelManager) hasConfigChanged(cfgPath string, newConfig *CloudflaredConfig) bool {
 	if newConfig == nil {
-		fmt.Printf("[unified-tunnel] hasConfigChanged: newConfig is nil, returning false\n")
+		log.Debugf("hasConfigChanged: newConfig is nil, returning false")
 		return false
 	}
 
@@ -561,7 +599,7 @@ func (utm *UnifiedTunnelManager) hasConfigChanged(cfgPath string, newConfig *Clo
 	existingData, err := os.ReadFile(cfgPath)
 	if err != nil {
 		// File doesn't exist or can't be read - treat as changed
-		fmt.Printf("[unified-tunnel] hasConfigChanged: config file not found or error reading: %v, treating as changed\n", err)
+		log.Debugf("hasConfigChanged: config file not found or error reading: %v, treating as changed", err)
 		return true
 	}
 
@@ -569,7 +607,7 @@ func (utm *UnifiedTunnelManager) hasConfigChanged(cfgPath string, newConfig *Clo
 	newData, err := yaml.Marshal(newConfig)
 	if err != nil {
 		// Can't marshal - treat as changed
-		fmt.Printf("[unified-tunnel] hasConfigChanged: error marshaling config: %v, treating as changed\n", err)
+		log.Debugf("hasConfigChanged: error marshaling config: %v, treating as changed", err)
 		return true
 	}
 
@@ -577,10 +615,10 @@ func (utm *UnifiedTunnelManager) hasConfigChanged(cfgPath string, newConfig *Clo
 	existingTrimmed := bytes.TrimSpace(existingData)
 	newTrimmed := bytes.TrimSpace(newData)
 	eq := bytes.Equal(existingTrimmed, newTrimmed)
-	fmt.Printf("[unified-tunnel] hasConfigChanged: comparing lengths old=%d new=%d, equal=%v\n", len(existingTrimmed), len(newTrimmed), eq)
+	log.Debugf("hasConfigChanged: comparing lengths old=%d new=%d, equal=%v", len(existingTrimmed), len(newTrimmed), eq)
 	if !eq {
-		fmt.Printf("[unified-tunnel] hasConfigChanged: old config:\n%s\n", string(existingTrimmed))
-		fmt.Printf("[unified-tunnel] hasConfigChanged: new config:\n%s\n", string(newTrimmed))
+		log.Debugf("hasConfigChanged: old config:\n%s", string(existingTrimmed))
+		log.Debugf("hasConfigChanged: new config:\n%s", string(newTrimmed))
 	}
 	return !eq
 }
@@ -592,11 +630,38 @@ func (utm *UnifiedTunnelManager) startProcessLocked() error {
 		return hook(utm)
 	}
 
-	fmt.Printf("[unified-tunnel] startProcessLocked: starting...\n")
+	log.Debugf("startProcessLocked: starting...")
 	if utm.config == nil {
 		return fmt.Errorf("tunnel manager not configured")
 	}
 
+	cfgPath := utm.GetConfigPath()
+
+	// Ensure data directory exists
+	if err := utm.ensureDataDir(); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+
+	// Kill any orphaned or stale cloudflared connectors for this tunnel.
+	log.Debugf("startProcessLocked: reconciling stale tunnel connectors")
+	utm.killOrphanedProcess(cfgPath)
+	if killed, err := utm.reconcileStaleConnectorsLocked(0); err != nil {
+		log.Warnf("startProcessLocked: stale connector cleanup error: %v", err)
+	} else if len(killed) > 0 {
+		log.Debugf("startProcessLocked: killed stale connector PIDs: %v", killed)
+	}
+
+	_, err := utm.spawnProcessLocked()
+	return err
+}
+
+// spawnProcessLocked starts a cloudflared connector for the current config
+// file and makes it the managed process. It does not touch other connectors,
+// so a reload can overlap the new process with the old one.
+// The returned channel is closed once the connector has registered a
+// connection with the Cloudflare edge.
+// Must be called with utm.mu held
+func (utm *UnifiedTunnelManager) spawnProcessLocked() (<-chan struct{}, error) {
 	tunnelRef := utm.config.TunnelName
 	if tunnelRef == "" {
 		tunnelRef = utm.config.TunnelID
@@ -604,77 +669,69 @@ func (utm *UnifiedTunnelManager) startProcessLocked() error {
 
 	cfgPath := utm.GetConfigPath()
 	logPath := utm.GetLogPath()
-	fmt.Printf("[unified-tunnel] startProcessLocked: tunnelRef=%s cfgPath=%s logPath=%s\n", tunnelRef, cfgPath, logPath)
-
-	// Ensure data directory exists
-	if err := utm.ensureDataDir(); err != nil {
-		return fmt.Errorf("failed to create data directory: %v", err)
-	}
+	log.Debugf("spawnProcessLocked: tunnelRef=%s cfgPath=%s logPath=%s", tunnelRef, cfgPath, logPath)
 
 	// Open log file
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		logFile = nil
-		fmt.Printf("[unified-tunnel] startProcessLocked: could not open log file: %v\n", err)
+		log.Errorf("spawnProcessLocked: could not open log file: %v", err)
 	}
 
-	// Kill any orphaned or stale cloudflared connectors for this tunnel.
-	fmt.Printf("[unified-tunnel] startProcessLocked: reconciling stale tunnel connectors\n")
-	utm.killOrphanedProcess(cfgPath)
-	if killed, err := utm.reconcileStaleConnectorsLocked(0); err != nil {
-		fmt.Printf("[unified-tunnel] startProcessLocked: stale connector cleanup error: %v\n", err)
-	} else if len(killed) > 0 {
-		fmt.Printf("[unified-tunnel] startProcessLocked: killed stale connector PIDs: %v\n", killed)
-	}
-
-	// Start cloudflared
-	cmd := exec.Command("cloudflared", "tunnel", "--config", cfgPath, "run", tunnelRef)
-	fmt.Printf("[unified-tunnel] startProcessLocked: executing: cloudflared tunnel --config %s run %s\n", cfgPath, tunnelRef)
+	// Start cloudflared. The grace period lets a connector being replaced
+	// by a reload finish in-flight requests after SIGTERM.
+	args := []string{"tunnel", "--grace-period", ReloadDrainTimeout.String(), "--config", cfgPath, "run", tunnelRef}
+	cmd := exec.Command("cloudflared", args...)
+	log.Debugf("spawnProcessLocked: executing: cloudflared %s", strings.Join(args, " "))
 
+	// cloudflared logs to stderr; keep it in memory for the logs API and
+	// watch it for the first registered connection
+	ready := newReadyWriter()
+	output := io.Writer(utm.logs)
 	if logFile != nil {
-		cmd.Stdout = logFile
-		cmd.Stderr = logFile
-	} else {
-		cmd.Stdout = nil
-		cmd.Stderr = nil
+		output = io.MultiWriter(logFile, utm.logs)
 	}
+	cmd.Stdout = output
+	cmd.Stderr = io.MultiWriter(output, ready)
+	fmt.Fprintf(utm.logs, "[unified-tunnel] starting: cloudflared %s\n", strings.Join(args, " "))
 
 	// Run in its own process group
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
-		Pgid:    0,
-	}
+	cmd.SysProcAttr = procctl.GroupAttr()
 
 	if err := cmd.Start(); err != nil {
 		if logFile != nil {
 			logFile.Close()
 		}
-		fmt.Printf("[unified-tunnel] startProcessLocked: failed to start: %v\n", err)
-		return err
+		log.Errorf("spawnProcessLocked: failed to start: %v", err)
+		return nil, err
 	}
 
+	exited := make(chan struct{})
 	utm.cmd = cmd
+	utm.cmdExited = exited
 	utm.running = true
-	fmt.Printf("[unified-tunnel] startProcessLocked: process started with PID %d\n", cmd.Process.Pid)
+	log.Debugf("spawnProcessLocked: process started with PID %d", cmd.Process.Pid)
 	quicktest.LogHeavyOperationWithCallerStack("[unified-tunnel] startProcessLocked: PID=%d", cmd.Process.Pid)
 
 	// Start goroutine to wait for process
 	go func() {
-		fmt.Printf("[unified-tunnel] startProcessLocked: waiting for process to exit...\n")
+		log.Debugf("spawnProcessLocked: waiting for process to exit...")
 		cmd.Wait()
-		fmt.Printf("[unified-tunnel] startProcessLocked: process exited\n")
+		close(exited)
+		log.Debugf("spawnProcessLocked: process exited")
 		if logFile != nil {
 			logFile.Close()
 		}
 		utm.mu.Lock()
 		if utm.cmd == cmd {
 			utm.cmd = nil
+			utm.cmdExited = nil
 			utm.running = false
 		}
 		utm.mu.Unlock()
 	}()
 
-	return nil
+	return ready.Ready(), nil
 }
 
 // stopProcessLocked stops the running cloudflared process
@@ -685,9 +742,9 @@ func (utm *UnifiedTunnelManager) stopProcessLocked() {
 		return
 	}
 
-	fmt.Printf("[unified-tunnel] stopProcessLocked: starting... cmd=%+v\n", utm.cmd)
+	log.Infof("stopProcessLocked: starting... cmd=%+v", utm.cmd)
 	if utm.cmd == nil || utm.cmd.Process == nil {
-		fmt.Printf("[unified-tunnel] stopProcessLocked: no process to stop\n")
+		log.Infof("stopProcessLocked: no process to stop")
 		return
 	}
 
@@ -702,45 +759,52 @@ func (utm *UnifiedTunnelManager) stopProcessLocked() {
 	pid := utm.cmd.Process.Pid
 
 	// Try graceful shutdown first
-	fmt.Printf("[unified-tunnel] stopProcessLocked: sending SIGTERM to PID %d\n", pid)
+	log.Infof("stopProcessLocked: sending SIGTERM to PID %d", pid)
+	fmt.Fprintf(utm.logs, "[unified-tunnel] stopping PID %d\n", pid)
 	utm.cmd.Process.Signal(syscall.SIGTERM)
 
-	// Wait up to 5 seconds for graceful shutdown
-	done := make(chan struct{})
-	go func() {
-		utm.cmd.Wait()
-		close(done)
-	}()
+	// Wait up to 5 seconds for graceful shutdown. The process is already
+	// being waited on by spawnProcessLocked; a second Wait would race it.
+	done := utm.cmdExited
+	if done == nil {
+		ch := make(chan struct{})
+		go func(cmd *exec.Cmd) {
+			cmd.Wait()
+			close(ch)
+		}(utm.cmd)
+		done = ch
+	}
 
 	select {
 	case <-done:
 		// Graceful shutdown completed
-		fmt.Printf("[unified-tunnel] stopProcessLocked: process terminated gracefully\n")
+		log.Infof("stopProcessLocked: process terminated gracefully")
 	case <-time.After(5 * time.Second):
 		// Force kill
-		fmt.Printf("[unified-tunnel] stopProcessLocked: graceful shutdown timed out, sending SIGKILL\n")
+		log.Infof("stopProcessLocked: graceful shutdown timed out, sending SIGKILL")
 		utm.cmd.Process.Kill()
-		utm.cmd.Wait()
-		fmt.Printf("[unified-tunnel] stopProcessLocked: process killed\n")
+		<-done
+		log.Infof("stopProcessLocked: process killed")
 	}
 
 	// Cleanup tunnel connections via cloudflared to ensure clean shutdown
 	if tunnelID != "" {
-		fmt.Printf("[unified-tunnel] stopProcessLocked: cleaning up tunnel %s connections\n", tunnelID)
+		log.Infof("stopProcessLocked: cleaning up tunnel %s connections", tunnelID)
 		if out, err := exec.Command("cloudflared", "tunnel", "cleanup", tunnelID).CombinedOutput(); err != nil {
-			fmt.Printf("[unified-tunnel] stopProcessLocked: tunnel cleanup output: %s, err: %v\n", string(out), err)
+			log.Infof("stopProcessLocked: tunnel cleanup output: %s, err: %v", string(out), err)
 		} else {
-			fmt.Printf("[unified-tunnel] stopProcessLocked: tunnel cleanup succeeded: %s\n", string(out))
+			log.Infof("stopProcessLocked: tunnel cleanup succeeded: %s", string(out))
 		}
 		// Also try to cleanup any lingering processes
 		if out, err := exec.Command("pkill", "-f", fmt.Sprintf("cloudflared.*%s", tunnelID)).CombinedOutput(); err == nil {
-			fmt.Printf("[unified-tunnel] stopProcessLocked: killed lingering processes: %s\n", string(out))
+			log.Infof("stopProcessLocked: killed lingering processes: %s", string(out))
 		}
 	}
 
 	utm.cmd = nil
+	utm.cmdExited = nil
 	utm.running = false
-	fmt.Printf("[unified-tunnel] stopProcessLocked: done\n")
+	log.Infof("stopProcessLocked: done")
 }
 
 // ReconcileStaleConnectors kills cloudflared connectors for this tunnel that use a
@@ -816,6 +880,18 @@ func (utm *UnifiedTunnelManager) TryIsRunning() (bool, bool) {
 	return utm.running, true
 }
 
+// TailLogs returns the last n lines of cloudflared output (all buffered
+// lines when n <= 0).
+func (utm *UnifiedTunnelManager) TailLogs(n int) []LogLine {
+	return utm.logs.Tail(n)
+}
+
+// LogsSince returns the buffered log lines after seq, the seq to pass next
+// time, and a channel closed when more lines arrive.
+func (utm *UnifiedTunnelManager) LogsSince(seq int64) ([]LogLine, int64, <-chan struct{}) {
+	return utm.logs.Since(seq)
+}
+
 // GetTunnelStatus returns the current status of the unified tunnel
 func (utm *UnifiedTunnelManager) GetTunnelStatus() map[string]interface{} {
 	utm.mu.RLock()
@@ -826,6 +902,14 @@ func (utm *UnifiedTunnelManager) GetTunnelStatus() map[string]interface{} {
 		"mappings":    len(utm.mappings),
 		"config_path": utm.configPath,
 	}
+	if len(utm.draining) > 0 {
+		pids := make([]int, 0, len(utm.draining))
+		for pid := range utm.draining {
+			pids = append(pids, pid)
+		}
+		sort.Ints(pids)
+		status["draining_pids"] = pids
+	}
 
 	if utm.config != nil {
 		status["tunnel_name"] = utm.config.TunnelName
@@ -890,7 +974,7 @@ func (utm *UnifiedTunnelManager) createDNSRoutesForMappings() {
 	defer utm.mu.RUnlock()
 
 	if utm.config == nil {
-		fmt.Printf("[unified-tunnel] createDNSRoutesForMappings: no tunnel config, skipping\n")
+		log.Infof("createDNSRoutesForMappings: no tunnel config, skipping")
 		return
 	}
 
@@ -902,9 +986,9 @@ func (utm *UnifiedTunnelManager) createDNSRoutesForMappings() {
 	// Create DNS for server mappings
 	for _, m := range utm.mappings {
 		if err := CreateDNSRoute(tunnelRef, m.Hostname); err != nil {
-			fmt.Printf("[unified-tunnel] createDNSRoutesForMappings: failed to create DNS for %s: %v\n", m.Hostname, err)
+			log.Errorf("createDNSRoutesForMappings: failed to create DNS for %s: %v", m.Hostname, err)
 		} else {
-			fmt.Printf("[unified-tunnel] createDNSRoutesForMappings: created DNS for %s\n", m.Hostname)
+			log.Infof("createDNSRoutesForMappings: created DNS for %s", m.Hostname)
 		}
 	}
 
@@ -922,9 +1006,9 @@ func (utm *UnifiedTunnelManager) createDNSRoutesForMappings() {
 			continue
 		}
 		if err := CreateDNSRoute(tunnelRef, em.Domain); err != nil {
-			fmt.Printf("[unified-tunnel] createDNSRoutesForMappings: failed to create DNS for extra mapping %s: %v\n", em.Domain, err)
+			log.Errorf("createDNSRoutesForMappings: failed to create DNS for extra mapping %s: %v", em.Domain, err)
 		} else {
-			fmt.Printf("[unified-tunnel] createDNSRoutesForMappings: created DNS for extra mapping %s\n", em.Domain)
+			log.Infof("createDNSRoutesForMappings: created DNS for extra mapping %s", em.Domain)
 		}
 	}
 }
@@ -970,11 +1054,11 @@ func (utm *UnifiedTunnelManager) StartHealthChecks(callback MappingHealthCallbac
 				utm.mu.RUnlock()
 
 				if paused {
-					fmt.Printf("[unified-tunnel] StartHealthChecks: health checks paused, skipping\n")
+					log.Infof("StartHealthChecks: health checks paused, skipping")
 					continue
 				}
 
-				fmt.Printf("[unified-tunnel] StartHealthChecks: checking %d mappings\n", len(mappings))
+				log.Debugf("StartHealthChecks: checking %d mappings", len(mappings))
 				for _, m := range mappings {
 					// Check if this mapping is paused (recently restarted)
 					utm.mu.RLock()
@@ -983,7 +1067,7 @@ func (utm *UnifiedTunnelManager) StartHealthChecks(callback MappingHealthCallbac
 
 					now := time.Now()
 					if isPaused && now.Before(pauseUntil) {
-						fmt.Printf("[unified-tunnel] StartHealthChecks: skipping paused mapping id=%s hostname=%s (paused until %v)\n",
+						log.Infof("StartHealthChecks: skipping paused mapping id=%s hostname=%s (paused until %v)",
 							m.ID, m.Hostname, pauseUntil.Format("2006-01-02T15:04:05"))
 						continue
 					}
@@ -992,7 +1076,7 @@ func (utm *UnifiedTunnelManager) StartHealthChecks(callback MappingHealthCallbac
 					if isPaused && now.After(pauseUntil) {
 						utm.mu.Lock()
 						delete(utm.healthCheckPausedUntil, m.ID)
-						fmt.Printf("[unified-tunnel] StartHealthChecks: pause period expired for mapping id=%s hostname=%s, resuming health checks and resetting failure counter\n",
+						log.Infof("StartHealthChecks: pause period expired for mapping id=%s hostname=%s, resuming health checks and resetting failure counter",
 							m.ID, m.Hostname)
 						utm.mu.Unlock()
 
@@ -1003,7 +1087,7 @@ func (utm *UnifiedTunnelManager) StartHealthChecks(callback MappingHealthCallbac
 						}
 					}
 
-					fmt.Printf("[unified-tunnel] StartHealthChecks: checking mapping id=%s hostname=%s\n", m.ID, m.Hostname)
+					log.Debugf("StartHealthChecks: checking mapping id=%s hostname=%s", m.ID, m.Hostname)
 					healthy := utm.checkMappingHealth(m.Hostname)
 
 					state, exists := states[m.ID]
@@ -1039,7 +1123,7 @@ func (utm *UnifiedTunnelManager) StartHealthChecks(callback MappingHealthCallbac
 // checkMappingHealth checks if a mapping's hostname is reachable via HTTPS ping
 // It checks root path and /ping, accepting any 2xx/3xx or 530 as "healthy"
 func (utm *UnifiedTunnelManager) checkMappingHealth(hostname string) bool {
-	fmt.Printf("[unified-tunnel] checkMappingHealth: checking health for hostname=%s\n", hostname)
+	log.Debugf("checkMappingHealth: checking health for hostname=%s", hostname)
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -1050,29 +1134,29 @@ func (utm *UnifiedTunnelManager) checkMappingHealth(hostname string) bool {
 	}
 
 	for _, url := range urls {
-		fmt.Printf("[unified-tunnel] checkMappingHealth: trying %s\n", url)
+		log.Debugf("checkMappingHealth: trying %s", url)
 		resp, err := client.Get(url)
 		if err != nil {
-			fmt.Printf("[unified-tunnel] checkMappingHealth: %s failed: %v\n", url, err)
+			log.Warnf("checkMappingHealth: %s failed: %v", url, err)
 			continue
 		}
 		resp.Body.Close()
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 500 {
-			fmt.Printf("[unified-tunnel] checkMappingHealth: %s returned status %d, healthy=true\n", url, resp.StatusCode)
+			log.Debugf("checkMappingHealth: %s returned status %d, healthy=true", url, resp.StatusCode)
 			return true
 		}
-		fmt.Printf("[unified-tunnel] checkMappingHealth: %s returned status %d, unhealthy\n", url, resp.StatusCode)
+		log.Debugf("checkMappingHealth: %s returned status %d, unhealthy", url, resp.StatusCode)
 	}
 
-	fmt.Printf("[unified-tunnel] checkMappingHealth: all URLs failed for %s, marking unhealthy\n", hostname)
+	log.Errorf("checkMappingHealth: all URLs failed for %s, marking unhealthy", hostname)
 	return false
 }
 
 // RestartMapping triggers a single tunnel restart to refresh the connection
 // The previous implementation did remove+add which caused double restarts - now we just do one restart
 func (utm *UnifiedTunnelManager) RestartMapping(mappingID string) error {
-	fmt.Printf("[unified-tunnel] RestartMapping: triggering restart for mappingID=%s\n", mappingID)
+	log.Infof("RestartMapping: triggering restart for mappingID=%s", mappingID)
 
 	utm.mu.Lock()
 	_, exists := utm.mappings[mappingID]
@@ -1082,7 +1166,7 @@ func (utm *UnifiedTunnelManager) RestartMapping(mappingID string) error {
 	}
 
 	// Log current state before restart
-	fmt.Printf("[unified-tunnel] RestartMapping: current state - running=%v, pid=%d\n", utm.running, func() int {
+	log.Infof("RestartMapping: current state - running=%v, pid=%d", utm.running, func() int {
 		if utm.cmd != nil && utm.cmd.Process != nil {
 			return utm.cmd.Process.Pid
 		}
@@ -1091,10 +1175,10 @@ func (utm *UnifiedTunnelManager) RestartMapping(mappingID string) error {
 
 	utm.cancelRebuildDebounceLocked()
 
-	fmt.Printf("[unified-tunnel] RestartMapping: calling rebuildAndRestartLockedWithForce(force=true)\n")
+	log.Infof("RestartMapping: calling rebuildAndRestartLockedWithForce(force=true)")
 	err := utm.rebuildAndRestartLockedWithForce(true)
 
-	fmt.Printf("[unified-tunnel] RestartMapping: after restart - running=%v, pid=%d, err=%v\n", utm.running, func() int {
+	log.Infof("RestartMapping: after restart - running=%v, pid=%d, err=%v", utm.running, func() int {
 		if utm.cmd != nil && utm.cmd.Process != nil {
 			return utm.cmd.Process.Pid
 		}
@@ -1106,12 +1190,12 @@ func (utm *UnifiedTunnelManager) RestartMapping(mappingID string) error {
 	if err == nil {
 		pauseUntil := time.Now().Add(1 * time.Minute)
 		utm.healthCheckPausedUntil[mappingID] = pauseUntil
-		fmt.Printf("[unified-tunnel] RestartMapping: paused health checks for mapping %s until %v (1 minute cooldown)\n",
+		log.Infof("RestartMapping: paused health checks for mapping %s until %v (1 minute cooldown)",
 			mappingID, pauseUntil.Format("2006-01-02T15:04:05"))
 	}
 
 	// Run cloudflared tunnel info to check status
-	fmt.Printf("[unified-tunnel] RestartMapping: checking tunnel status...\n")
+	log.Infof("RestartMapping: checking tunnel status...")
 	tunnelID := ""
 	if utm.config != nil {
 		tunnelID = utm.config.TunnelID
@@ -1123,9 +1207,9 @@ func (utm *UnifiedTunnelManager) RestartMapping(mappingID string) error {
 
 	if tunnelID != "" {
 		if out, err := exec.Command("cloudflared", "tunnel", "info", tunnelID).Output(); err == nil {
-			fmt.Printf("[unified-tunnel] RestartMapping: tunnel info:\n%s\n", string(out))
+			log.Infof("RestartMapping: tunnel info:\n%s", string(out))
 		} else {
-			fmt.Printf("[unified-tunnel] RestartMapping: failed to get tunnel info: %v\n", err)
+			log.Errorf("RestartMapping: failed to get tunnel info: %v", err)
 		}
 	}
 
@@ -1164,57 +1248,45 @@ func (utm *UnifiedTunnelManager) IsHealthCheckPaused(mappingID string) bool {
 	return time.Now().Before(pauseUntil)
 }
 
-// globalHealthCheckCancel tracks the global health check cancel function
-var globalHealthCheckCancel context.CancelFunc
-var globalHealthCheckOnce sync.Once
-
-// StartGlobalHealthChecks starts a global health check goroutine that monitors
-// all mappings in the unified tunnel. It automatically restarts mappings after
-// 3 consecutive failures.
-func StartGlobalHealthChecks() {
-	globalHealthCheckOnce.Do(func() {
-		utm := GetUnifiedTunnelManager()
-		fmt.Printf("[unified-tunnel] StartGlobalHealthChecks: setting up health check callback\n")
-
-		globalHealthCheckCancel = utm.StartHealthChecks(func(mappingID, hostname string, healthy bool, consecutiveFailures int) {
-			// Skip health checks for opencode web server mapping
-			if isOpenCodeWebServerMapping(mappingID) {
-				fmt.Printf("[unified-tunnel] Skipping health check for opencode web server mapping %s (%s)\n", mappingID, hostname)
-				return
-			}
-
-			// Skip health checks for exposed URLs (mapping IDs starting with "exposed-")
-			if strings.HasPrefix(mappingID, "exposed-") {
-				fmt.Printf("[unified-tunnel] Skipping health check for exposed URL mapping %s (%s)\n", mappingID, hostname)
-				return
-			}
-
-			fmt.Printf("[unified-tunnel] healthCheckCallback: mappingID=%s hostname=%s healthy=%v failures=%d\n", mappingID, hostname, healthy, consecutiveFailures)
-			if healthy {
-				fmt.Printf("[unified-tunnel] Health check recovered for %s (%s)\n", hostname, mappingID)
-			} else {
-				fmt.Printf("[unified-tunnel] Health check failed for %s (%s): %d/3\n", hostname, mappingID, consecutiveFailures)
-				if consecutiveFailures >= 3 {
-					fmt.Printf("[unified-tunnel] Restarting mapping %s (%s) after 3 failures...\n", mappingID, hostname)
-					if err := utm.RestartMapping(mappingID); err != nil {
-						fmt.Printf("[unified-tunnel] Failed to restart mapping %s: %v\n", mappingID, err)
-					} else {
-						fmt.Printf("[unified-tunnel] Mapping %s restarted successfully\n", mappingID)
-					}
+// RestartUnhealthyMappings checks every mapping whose health checks are not
+// paused and restarts the tunnel for each one failing `checks` consecutive
+// checks `interval` apart. Mappings of the opencode web server and exposed
+// URLs are skipped; they have their own health checks. It returns the IDs of
+// the restarted mappings and is run by the scheduler's restart-tunnels task.
+func RestartUnhealthyMappings(ctx context.Context, checks int, interval time.Duration) ([]string, error) {
+	utm := GetUnifiedTunnelManager()
+	if checks < 1 {
+		checks = 1
+	}
+
+	var restarted []string
+	var errs []error
+	for _, m := range utm.ListMappings() {
+		if isOpenCodeWebServerMapping(m.ID) || strings.HasPrefix(m.ID, "exposed-") || utm.IsHealthCheckPaused(m.ID) {
+			continue
+		}
+		failures := 0
+		for failures < checks && !utm.checkMappingHealth(m.Hostname) {
+			failures++
+			if failures < checks {
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+					return restarted, ctx.Err()
 				}
 			}
-		})
-		fmt.Println("[unified-tunnel] Global health checks started")
-	})
-}
-
-// StopGlobalHealthChecks stops the global health check goroutine
-func StopGlobalHealthChecks() {
-	if globalHealthCheckCancel != nil {
-		globalHealthCheckCancel()
-		globalHealthCheckCancel = nil
-		fmt.Println("[unified-tunnel] Global health checks stopped")
+		}
+		if failures < checks {
+			continue
+		}
+		log.Infof("RestartUnhealthyMappings: restarting mapping %s (%s) after %d failures", m.ID, m.Hostname, failures)
+		if err := utm.RestartMapping(m.ID); err != nil {
+			errs = append(errs, fmt.Errorf("restart %s: %w", m.ID, err))
+			continue
+		}
+		restarted = append(restarted, m.ID)
 	}
+	return restarted, errors.Join(errs...)
 }
 
 // isOpenCodeWebServerMapping checks if a mapping ID belongs to the opencode web server
@@ -1263,7 +1335,7 @@ func isOpenCodeWebServerMapping(mappingID string) bool {
 
 // LoadExtraMappingsFile loads all extra mappings from the JSON file
 func (utm *UnifiedTunnelManager) LoadExtraMappingsFile() (*ExtraMappingsConfig, error) {
-	data, err := os.ReadFile(CloudflareExtraMappingFile)
+	data, err := os.ReadFile(utm.GetExtraMappingsPath())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &ExtraMappingsConfig{Mappings: []ExtraMapping{}}, nil
@@ -1290,7 +1362,7 @@ func (utm *UnifiedTunnelManager) SaveExtraMappingsFile(cfg *ExtraMappingsConfig)
 		return err
 	}
 
-	return os.WriteFile(CloudflareExtraMappingFile, append(data, '\n'), 0644)
+	return os.WriteFile(utm.GetExtraMappingsPath(), append(data, '\n'), 0644)
 }
 
 // AddExtraMapping adds a mapping to the extra mappings file and triggers a tunnel restart if needed
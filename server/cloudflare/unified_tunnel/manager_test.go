@@ -218,4 +218,46 @@ func TestGeneratedConfigSortedHostnames(t *testing.T) {
 		t.Fatalf("hostnames not sorted in YAML:\n%s", text)
 	}
 	_ = cfg
-}
\ No newline at end of file
+}
+
+// Extra mappings are stored in the group's own file and reach the generated
+// config; server mappings still win for the same hostname.
+func TestExtraMappingsUseGroupFile(t *testing.T) {
+	utm, _ := testTunnelManager(t)
+
+	if err := utm.AddMapping(&IngressMapping{ID: "owned-port-1", Hostname: "alpha.example.com", Service: "http://localhost:1"}); err != nil {
+		t.Fatalf("AddMapping: %v", err)
+	}
+	if err := utm.AddExtraMapping("extra.example.com", "http://localhost:9000"); err != nil {
+		t.Fatalf("AddExtraMapping: %v", err)
+	}
+	if err := utm.AddExtraMapping("alpha.example.com", "http://localhost:9001"); err != nil {
+		t.Fatalf("AddExtraMapping: %v", err)
+	}
+	if _, err := os.Stat(GetGroupExtraMappingPath("test")); err != nil {
+		t.Fatalf("group extra mapping file: %v", err)
+	}
+	cfg, err := utm.LoadExtraMappingsFile()
+	if err != nil || len(cfg.Mappings) != 2 {
+		t.Fatalf("LoadExtraMappingsFile() = %+v, %v; want 2 mappings", cfg, err)
+	}
+
+	waitForRebuildCount(t, 1, time.Second)
+	hosts := hostnamesInConfig(readGeneratedConfig(t, utm))
+	if !containsString(hosts, "extra.example.com") {
+		t.Fatalf("config missing extra hostname, got %v", hosts)
+	}
+	for _, m := range utm.ListAllMappings() {
+		if m.Hostname == "alpha.example.com" && m.Service != "http://localhost:1" {
+			t.Fatalf("extra mapping overrode server mapping: %+v", m)
+		}
+	}
+
+	if err := utm.RemoveExtraMapping("extra.example.com"); err != nil {
+		t.Fatalf("RemoveExtraMapping: %v", err)
+	}
+	waitForRebuildCount(t, 2, time.Second)
+	if cfg, _ := utm.LoadExtraMappingsFile(); len(cfg.Mappings) != 1 || cfg.Mappings[0].Domain != "alpha.example.com" {
+		t.Fatalf("after remove: %+v", cfg.Mappings)
+	}
+}
@@ -0,0 +1,180 @@
+package unified_tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Graceful reload
+//
+// cloudflared has no way to reload a locally-managed ingress config in
+// place, so a config change used to stop the connector and start a new one,
+// dropping every connection routed through the tunnel. Instead, a reload:
+//
+//  1. writes the new config and starts a second connector for the same
+//     tunnel (Cloudflare load-balances a tunnel across its connectors),
+//  2. waits until the new connector has registered with the edge,
+//  3. sends SIGTERM to the old connector, which unregisters from the edge
+//     and finishes in-flight requests (SSE streams included) for up to
+//     ReloadDrainTimeout before exiting.
+//
+// A full restart is still used when the tunnel itself changes, when no
+// connector is running, and for forced restarts (health check recovery).
+
+const (
+	// ReloadDrainTimeout is how long a replaced connector may keep serving
+	// in-flight requests. It is passed to cloudflared as --grace-period.
+	ReloadDrainTimeout = 5 * time.Minute
+
+	// reloadReadyTimeout is how long to wait for the new connector to
+	// register before draining the old one anyway.
+	reloadReadyTimeout = 30 * time.Second
+)
+
+// registeredMarker is logged by cloudflared for each edge connection.
+var registeredMarker = []byte("Registered tunnel connection")
+
+// readyWriter watches cloudflared's log output and closes its channel on
+// the first registered connection.
+type readyWriter struct {
+	mu    sync.Mutex
+	tail  []byte // end of the previous write, for markers split across writes
+	ready chan struct{}
+	done  bool
+}
+
+func newReadyWriter() *readyWriter {
+	return &readyWriter{ready: make(chan struct{})}
+}
+
+func (rw *readyWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.done {
+		return len(p), nil
+	}
+	buf := append(rw.tail, p...)
+	if bytes.Contains(buf, registeredMarker) {
+		rw.done = true
+		rw.tail = nil
+		close(rw.ready)
+		return len(p), nil
+	}
+	if keep := len(registeredMarker) - 1; len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	rw.tail = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// Ready returns a channel closed once a connection has been registered.
+func (rw *readyWriter) Ready() <-chan struct{} {
+	return rw.ready
+}
+
+// canReloadLocked reports whether the running connector can be replaced by
+// an overlapping one: it must be a real process serving the same tunnel
+// with the same credentials as newConfig.
+// Must be called with utm.mu held
+func (utm *UnifiedTunnelManager) canReloadLocked(cfgPath string, newConfig *CloudflaredConfig) bool {
+	if getTestStartProcessHook() != nil || newConfig == nil {
+		return false
+	}
+	if !utm.running || utm.cmd == nil || utm.cmd.Process == nil || utm.cmdExited == nil {
+		return false
+	}
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return false
+	}
+	var current CloudflaredConfig
+	if err := yaml.Unmarshal(data, &current); err != nil {
+		return false
+	}
+	return current.Tunnel != "" && current.Tunnel == newConfig.Tunnel && current.CredentialsFile == newConfig.CredentialsFile
+}
+
+// reloadLocked writes newConfig and replaces the running connector with a
+// new one without dropping connections. See "Graceful reload" above.
+// Must be called with utm.mu held
+func (utm *UnifiedTunnelManager) reloadLocked(cfgPath string, newConfig *CloudflaredConfig) error {
+	oldCmd, oldExited := utm.cmd, utm.cmdExited
+	oldPID := oldCmd.Process.Pid
+	oldData, _ := os.ReadFile(cfgPath)
+
+	if err := WriteCloudflaredConfig(cfgPath, newConfig); err != nil {
+		return err
+	}
+	utm.configPath = cfgPath
+
+	ready, err := utm.spawnProcessLocked()
+	if err != nil {
+		// the old connector keeps serving; restore its config on disk
+		log.Errorf("reloadLocked: failed to start new connector, keeping PID %d: %v", oldPID, err)
+		os.WriteFile(cfgPath, oldData, 0644)
+		return err
+	}
+	newCmd, newExited := utm.cmd, utm.cmdExited
+	log.Infof("reloadLocked: started connector PID %d to replace PID %d", newCmd.Process.Pid, oldPID)
+	fmt.Fprintf(utm.logs, "[unified-tunnel] reload: started PID %d, PID %d drains once it registers\n", newCmd.Process.Pid, oldPID)
+
+	if utm.draining == nil {
+		utm.draining = make(map[int]bool)
+	}
+	utm.draining[oldPID] = true
+
+	go func() {
+		select {
+		case <-ready:
+			log.Infof("reloadLocked: PID %d registered, draining PID %d", newCmd.Process.Pid, oldPID)
+		case <-newExited:
+			// the new connector died: keep the old one. Restore its config
+			// on disk so the next rebuild sees the change as still pending.
+			log.Errorf("reloadLocked: new connector PID %d exited before registering, keeping PID %d", newCmd.Process.Pid, oldPID)
+			utm.mu.Lock()
+			delete(utm.draining, oldPID)
+			select {
+			case <-oldExited:
+			default:
+				if utm.cmd == nil || utm.cmd == newCmd {
+					os.WriteFile(cfgPath, oldData, 0644)
+					utm.cmd, utm.cmdExited, utm.running = oldCmd, oldExited, true
+				}
+			}
+			utm.mu.Unlock()
+			return
+		case <-time.After(reloadReadyTimeout):
+			log.Warnf("reloadLocked: PID %d not registered after %v, draining PID %d anyway", newCmd.Process.Pid, reloadReadyTimeout, oldPID)
+		}
+
+		if !postRestartSideEffectsDisabled() {
+			go utm.createDNSRoutesForMappings()
+		}
+		drainProcess(oldCmd, oldExited, ReloadDrainTimeout)
+
+		utm.mu.Lock()
+		delete(utm.draining, oldPID)
+		utm.mu.Unlock()
+	}()
+	return nil
+}
+
+// drainProcess asks a connector to shut down gracefully and kills it if it
+// is still running after timeout.
+func drainProcess(cmd *exec.Cmd, exited <-chan struct{}, timeout time.Duration) {
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+		log.Infof("drainProcess: PID %d exited", cmd.Process.Pid)
+	case <-time.After(timeout + 10*time.Second):
+		log.Warnf("drainProcess: PID %d still running after %v, killing", cmd.Process.Pid, timeout)
+		cmd.Process.Kill()
+	}
+}
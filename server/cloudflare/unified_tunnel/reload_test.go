@@ -0,0 +1,120 @@
+package unified_tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func TestReadyWriterSplitMarker(t *testing.T) {
+	rw := newReadyWriter()
+	rw.Write([]byte("2024-01-01T00:00:00Z INF Starting tunnel\n2024-01-01T00:00:01Z INF Registered tun"))
+	select {
+	case <-rw.Ready():
+		t.Fatalf("ready before the marker was complete")
+	default:
+	}
+	rw.Write([]byte("nel connection connIndex=0 location=sjc01\n"))
+	select {
+	case <-rw.Ready():
+	default:
+		t.Fatalf("not ready after the marker")
+	}
+	// later writes are ignored
+	rw.Write([]byte("Registered tunnel connection connIndex=1\n"))
+}
+
+// fakeCloudflared is a cloudflared stand-in: `tunnel ... run` registers
+// immediately and runs until SIGTERM; every other subcommand succeeds.
+const fakeCloudflared = `#!/bin/sh
+case " $* " in *" run "*) ;; *) exit 0 ;; esac
+trap 'exit 0' TERM
+echo "INF Registered tunnel connection connIndex=0" >&2
+while true; do sleep 0.05; done
+`
+
+// A mapping change on a running tunnel starts a new connector before the
+// old one is drained, instead of stopping the tunnel first.
+func TestReloadOverlapsConnectors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as cloudflared")
+	}
+	dataDir := t.TempDir()
+	oldDataDir := config.DataDir
+	config.DataDir = dataDir
+	testPostRestartSideEffectsOff = true
+	t.Cleanup(func() {
+		config.DataDir = oldDataDir
+		testPostRestartSideEffectsOff = false
+	})
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "cloudflared"), []byte(fakeCloudflared), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	credPath := filepath.Join(dataDir, "tunnel-creds.json")
+	if err := os.WriteFile(credPath, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	utm := NewUnifiedTunnelManager("reload")
+	utm.SetConfig(config.CloudflareTunnelConfig{
+		TunnelID:        "0b9a3c1e-6f2d-4d8e-9a51-3c7e2b1f4a60",
+		CredentialsFile: credPath,
+	})
+	t.Cleanup(utm.Stop)
+
+	rebuild := func(m *IngressMapping) {
+		t.Helper()
+		utm.mu.Lock()
+		defer utm.mu.Unlock()
+		utm.mappings[m.ID] = m
+		if err := utm.rebuildAndRestartLocked(); err != nil {
+			t.Fatalf("rebuild: %v", err)
+		}
+	}
+
+	rebuild(&IngressMapping{ID: "a", Hostname: "a.example.com", Service: "http://localhost:1"})
+	utm.mu.Lock()
+	oldPID, oldExited := utm.cmd.Process.Pid, utm.cmdExited
+	utm.mu.Unlock()
+
+	rebuild(&IngressMapping{ID: "b", Hostname: "b.example.com", Service: "http://localhost:2"})
+	utm.mu.Lock()
+	newPID, draining := utm.cmd.Process.Pid, utm.draining[oldPID]
+	utm.mu.Unlock()
+	if newPID == oldPID || !draining {
+		t.Fatalf("after reload: pid %d (old %d), draining old = %v", newPID, oldPID, draining)
+	}
+
+	select {
+	case <-oldExited:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("old connector %d was not drained", oldPID)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		utm.mu.Lock()
+		n, running, pid := len(utm.draining), utm.running, utm.cmd.Process.Pid
+		utm.mu.Unlock()
+		if n == 0 {
+			if !running || pid != newPID {
+				t.Fatalf("new connector lost: running=%v pid=%d", running, pid)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("draining set not cleared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	hosts := hostnamesInConfig(readGeneratedConfig(t, utm))
+	if len(hosts) != 2 {
+		t.Fatalf("config hostnames = %v, want both mappings", hosts)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/logging"
 )
 
 type TunnelGroup struct {
@@ -22,6 +24,24 @@ type TunnelGroup struct {
 	healthCancel context.CancelFunc
 
 	onHealthChange MappingHealthCallback
+
+	// health is the last health check result per mapping ID
+	health map[string]*MappingHealth
+
+	log *logging.Logger
+}
+
+// MappingHealth is the latest health check result of a mapping.
+type MappingHealth struct {
+	ID                  string    `json:"id"`
+	Hostname            string    `json:"hostname"`
+	Service             string    `json:"service"`
+	Checked             bool      `json:"checked"` // false until the first check ran
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastChecked         time.Time `json:"last_checked,omitempty"`
+	LastHealthy         time.Time `json:"last_healthy,omitempty"`
+	Paused              bool      `json:"paused,omitempty"` // recently restarted, checks skipped
 }
 
 func NewTunnelGroup(name string, tunnelMgr *UnifiedTunnelManager) *TunnelGroup {
@@ -29,6 +49,8 @@ func NewTunnelGroup(name string, tunnelMgr *UnifiedTunnelManager) *TunnelGroup {
 		name:                   name,
 		tunnelMgr:              tunnelMgr,
 		healthCheckPausedUntil: make(map[string]time.Time),
+		health:                 make(map[string]*MappingHealth),
+		log:                    logging.New("tunnel-group").With("group", name),
 	}
 }
 
@@ -43,12 +65,12 @@ func (tg *TunnelGroup) Name() string {
 }
 
 func (tg *TunnelGroup) AddMapping(mapping *IngressMapping) error {
-	fmt.Printf("[tunnel-group:%s] AddMapping: id=%s hostname=%s service=%s\n", tg.name, mapping.ID, mapping.Hostname, mapping.Service)
+	tg.log.Infof("AddMapping: id=%s hostname=%s service=%s", mapping.ID, mapping.Hostname, mapping.Service)
 	return tg.tunnelMgr.AddMapping(mapping)
 }
 
 func (tg *TunnelGroup) RemoveMapping(id string) error {
-	fmt.Printf("[tunnel-group:%s] RemoveMapping: id=%s\n", tg.name, id)
+	tg.log.Infof("RemoveMapping: id=%s", id)
 	return tg.tunnelMgr.RemoveMapping(id)
 }
 
@@ -85,8 +107,8 @@ func (tg *TunnelGroup) PauseHealthCheck(mappingID string, duration time.Duration
 	defer tg.mu.Unlock()
 	pauseUntil := time.Now().Add(duration)
 	tg.healthCheckPausedUntil[mappingID] = pauseUntil
-	fmt.Printf("[tunnel-group:%s] PauseHealthCheck: paused health checks for mapping %s until %v\n",
-		tg.name, mappingID, pauseUntil.Format("2006-01-02T15:04:05"))
+	tg.log.Infof("PauseHealthCheck: paused health checks for mapping %s until %v",
+		mappingID, pauseUntil.Format("2006-01-02T15:04:05"))
 }
 
 func (tg *TunnelGroup) IsHealthCheckPaused(mappingID string) bool {
@@ -106,7 +128,7 @@ func (tg *TunnelGroup) IsHealthCheckPaused(mappingID string) bool {
 }
 
 func (tg *TunnelGroup) RestartMapping(mappingID string) error {
-	fmt.Printf("[tunnel-group:%s] RestartMapping: triggering restart for mappingID=%s\n", tg.name, mappingID)
+	tg.log.Infof("RestartMapping: triggering restart for mappingID=%s", mappingID)
 
 	tg.mu.Lock()
 	_, exists := tg.tunnelMgr.mappings[mappingID]
@@ -159,11 +181,11 @@ func (tg *TunnelGroup) StartHealthChecks(callback MappingHealthCallback) {
 				tg.mu.RUnlock()
 
 				if paused {
-					fmt.Printf("[tunnel-group:%s] StartHealthChecks: health checks paused, skipping\n", tg.name)
+					tg.log.Infof("StartHealthChecks: health checks paused, skipping")
 					continue
 				}
 
-				fmt.Printf("[tunnel-group:%s] StartHealthChecks: checking %d mappings\n", tg.name, len(mappings))
+				tg.log.Debugf("StartHealthChecks: checking %d mappings", len(mappings))
 				for _, m := range mappings {
 					tg.mu.RLock()
 					pauseUntil, isPaused := tg.healthCheckPausedUntil[m.ID]
@@ -171,8 +193,8 @@ func (tg *TunnelGroup) StartHealthChecks(callback MappingHealthCallback) {
 
 					now := time.Now()
 					if isPaused && now.Before(pauseUntil) {
-						fmt.Printf("[tunnel-group:%s] StartHealthChecks: skipping paused mapping id=%s hostname=%s (paused until %v)\n",
-							tg.name, m.ID, m.Hostname, pauseUntil.Format("2006-01-02T15:04:05"))
+						tg.log.Infof("StartHealthChecks: skipping paused mapping id=%s hostname=%s (paused until %v)",
+							m.ID, m.Hostname, pauseUntil.Format("2006-01-02T15:04:05"))
 						continue
 					}
 
@@ -187,7 +209,7 @@ func (tg *TunnelGroup) StartHealthChecks(callback MappingHealthCallback) {
 						}
 					}
 
-					fmt.Printf("[tunnel-group:%s] StartHealthChecks: checking mapping id=%s hostname=%s\n", tg.name, m.ID, m.Hostname)
+					tg.log.Debugf("StartHealthChecks: checking mapping id=%s hostname=%s", m.ID, m.Hostname)
 					healthy := tg.checkMappingHealth(m.Hostname)
 
 					state, exists := states[m.ID]
@@ -211,24 +233,72 @@ func (tg *TunnelGroup) StartHealthChecks(callback MappingHealthCallback) {
 							callback(m.ID, m.Hostname, false, state.consecutiveFailures)
 						}
 					}
+					tg.recordHealth(m.ID, healthy, state.consecutiveFailures, now)
 				}
 			}
 		}
 	}()
 
-	fmt.Printf("[tunnel-group:%s] Health checks started\n", tg.name)
+	tg.log.Infof("Health checks started")
+}
+
+func (tg *TunnelGroup) recordHealth(mappingID string, healthy bool, failures int, at time.Time) {
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	h := tg.health[mappingID]
+	if h == nil {
+		h = &MappingHealth{}
+		tg.health[mappingID] = h
+	}
+	h.Checked = true
+	h.Healthy = healthy
+	h.ConsecutiveFailures = failures
+	h.LastChecked = at
+	if healthy {
+		h.LastHealthy = at
+	}
+}
+
+// MappingHealth returns the latest health check result of every current
+// mapping, sorted by hostname. Mappings not checked yet have Checked=false.
+func (tg *TunnelGroup) MappingHealth() []MappingHealth {
+	mappings := tg.ListMappings()
+	now := time.Now()
+
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	out := make([]MappingHealth, 0, len(mappings))
+	live := make(map[string]bool, len(mappings))
+	for _, m := range mappings {
+		live[m.ID] = true
+		var h MappingHealth
+		if rec := tg.health[m.ID]; rec != nil {
+			h = *rec
+		}
+		h.ID, h.Hostname, h.Service = m.ID, m.Hostname, m.Service
+		h.Paused = tg.paused || now.Before(tg.healthCheckPausedUntil[m.ID])
+		out = append(out, h)
+	}
+	// forget removed mappings
+	for id := range tg.health {
+		if !live[id] {
+			delete(tg.health, id)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hostname < out[j].Hostname })
+	return out
 }
 
 func (tg *TunnelGroup) StopHealthChecks() {
 	if tg.healthCancel != nil {
 		tg.healthCancel()
 		tg.healthCancel = nil
-		fmt.Printf("[tunnel-group:%s] Health checks stopped\n", tg.name)
+		tg.log.Infof("Health checks stopped")
 	}
 }
 
 func (tg *TunnelGroup) checkMappingHealth(hostname string) bool {
-	fmt.Printf("[tunnel-group:%s] checkMappingHealth: checking health for hostname=%s\n", tg.name, hostname)
+	tg.log.Debugf("checkMappingHealth: checking health for hostname=%s", hostname)
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -239,22 +309,22 @@ func (tg *TunnelGroup) checkMappingHealth(hostname string) bool {
 	}
 
 	for _, url := range urls {
-		fmt.Printf("[tunnel-group:%s] checkMappingHealth: trying %s\n", tg.name, url)
+		tg.log.Debugf("checkMappingHealth: trying %s", url)
 		resp, err := client.Get(url)
 		if err != nil {
-			fmt.Printf("[tunnel-group:%s] checkMappingHealth: %s failed: %v\n", tg.name, url, err)
+			tg.log.Warnf("checkMappingHealth: %s failed: %v", url, err)
 			continue
 		}
 		resp.Body.Close()
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 500 {
-			fmt.Printf("[tunnel-group:%s] checkMappingHealth: %s returned status %d, healthy=true\n", tg.name, url, resp.StatusCode)
+			tg.log.Debugf("checkMappingHealth: %s returned status %d, healthy=true", url, resp.StatusCode)
 			return true
 		}
-		fmt.Printf("[tunnel-group:%s] checkMappingHealth: %s returned status %d, unhealthy\n", tg.name, url, resp.StatusCode)
+		tg.log.Debugf("checkMappingHealth: %s returned status %d, unhealthy", url, resp.StatusCode)
 	}
 
-	fmt.Printf("[tunnel-group:%s] checkMappingHealth: all URLs failed for %s, marking unhealthy\n", tg.name, hostname)
+	tg.log.Errorf("checkMappingHealth: all URLs failed for %s, marking unhealthy", hostname)
 	return false
 }
 
@@ -285,3 +355,19 @@ func (tg *TunnelGroup) LoadExtraMappingsFile() (*ExtraMappingsConfig, error) {
 func (tg *TunnelGroup) SaveExtraMappingsFile(cfg *ExtraMappingsConfig) error {
 	return tg.tunnelMgr.SaveExtraMappingsFile(cfg)
 }
+
+func (tg *TunnelGroup) AddExtraMapping(domain, localURL string) error {
+	return tg.tunnelMgr.AddExtraMapping(domain, localURL)
+}
+
+func (tg *TunnelGroup) RemoveExtraMapping(domain string) error {
+	return tg.tunnelMgr.RemoveExtraMapping(domain)
+}
+
+func (tg *TunnelGroup) TailLogs(n int) []LogLine {
+	return tg.tunnelMgr.TailLogs(n)
+}
+
+func (tg *TunnelGroup) LogsSince(seq int64) ([]LogLine, int64, <-chan struct{}) {
+	return tg.tunnelMgr.LogsSince(seq)
+}
@@ -1,8 +1,9 @@
 package unified_tunnel
 
 import (
-	"fmt"
 	"sync"
+
+	"github.com/xhd2015/ai-critic/server/logging"
 )
 
 const (
@@ -17,10 +18,12 @@ type TunnelGroupManager struct {
 }
 
 var (
-	groupManager         *TunnelGroupManager
-	groupManagerOnce     sync.Once
-	extensionConfigured  = make(chan struct{})
-	extensionNotifyOnce  sync.Once
+	groupManager        *TunnelGroupManager
+	groupManagerOnce    sync.Once
+	extensionConfigured = make(chan struct{})
+	extensionNotifyOnce sync.Once
+
+	groupManagerLog = logging.New("tunnel-group-manager")
 )
 
 func NotifyExtensionConfigured() {
@@ -47,7 +50,7 @@ func (m *TunnelGroupManager) GetCoreGroup() *TunnelGroup {
 	if m.core == nil {
 		tunnelMgr := NewUnifiedTunnelManager(GroupCore)
 		m.core = NewTunnelGroup(GroupCore, tunnelMgr)
-		fmt.Printf("[tunnel-group-manager] Created core group with tunnel manager\n")
+		groupManagerLog.Infof("Created core group with tunnel manager")
 	}
 	return m.core
 }
@@ -59,11 +62,26 @@ func (m *TunnelGroupManager) GetExtensionGroup() *TunnelGroup {
 	if m.extension == nil {
 		tunnelMgr := NewUnifiedTunnelManager(GroupExtension)
 		m.extension = NewTunnelGroup(GroupExtension, tunnelMgr)
-		fmt.Printf("[tunnel-group-manager] Created extension group with tunnel manager\n")
+		groupManagerLog.Infof("Created extension group with tunnel manager")
 	}
 	return m.extension
 }
 
+// Groups returns the groups created so far, core first, without creating
+// the ones that have not been used yet.
+func (m *TunnelGroupManager) Groups() []*TunnelGroup {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var groups []*TunnelGroup
+	if m.core != nil {
+		groups = append(groups, m.core)
+	}
+	if m.extension != nil {
+		groups = append(groups, m.extension)
+	}
+	return groups
+}
+
 func (m *TunnelGroupManager) GetGroup(name string) *TunnelGroup {
 	switch name {
 	case GroupCore:
@@ -0,0 +1,32 @@
+package unified_tunnel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMappingHealthMergesCurrentMappings(t *testing.T) {
+	utm := NewUnifiedTunnelManager(GroupCore)
+	utm.mappings["b"] = &IngressMapping{ID: "b", Hostname: "b.example.com", Service: "http://localhost:2"}
+	utm.mappings["a"] = &IngressMapping{ID: "a", Hostname: "a.example.com", Service: "http://localhost:1"}
+	tg := NewTunnelGroup(GroupCore, utm)
+
+	now := time.Now()
+	tg.recordHealth("b", false, 2, now)
+	tg.recordHealth("gone", true, 0, now)
+	tg.PauseHealthCheck("a", time.Minute)
+
+	got := tg.MappingHealth()
+	if len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Fatalf("MappingHealth() = %+v, want a then b", got)
+	}
+	if got[0].Checked || !got[0].Paused {
+		t.Errorf("a: %+v, want unchecked and paused", got[0])
+	}
+	if !got[1].Checked || got[1].Healthy || got[1].ConsecutiveFailures != 2 || got[1].Service != "http://localhost:2" {
+		t.Errorf("b: %+v, want checked, unhealthy, 2 failures", got[1])
+	}
+	if _, ok := tg.health["gone"]; ok {
+		t.Errorf("health of a removed mapping was kept")
+	}
+}
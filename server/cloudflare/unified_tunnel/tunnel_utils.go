@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/xhd2015/ai-critic/server/cmdjson"
-	"github.com/xhd2015/dot-pkgs/go-pkgs/cloudflare"
+	"gopkg.in/yaml.v3"
 )
 
 // TunnelInfo represents a Cloudflare tunnel.
@@ -34,9 +34,20 @@ type IngressRule struct {
 }
 
 // IsUUID checks if a string looks like a UUID (8-4-4-4-12 hex format).
-// Delegates to the shared cloudflare package.
 func IsUUID(s string) bool {
-	return cloudflare.IsUUID(s)
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if c != '-' {
+				return false
+			}
+		} else if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
 }
 
 // FindTunnelIDAndCreds resolves the tunnel ID and credentials file for the given tunnel reference (name or ID).
@@ -160,23 +171,24 @@ func CreateDNSRoute(tunnelRef, hostname string) error {
 	return nil
 }
 
-// WriteCloudflaredConfig writes a cloudflared config YAML file.
-// Delegates to the shared cloudflare.WriteConfig.
+// WriteCloudflaredConfig writes a cloudflared config YAML file, creating
+// its directory if needed.
 func WriteCloudflaredConfig(path string, cfg *CloudflaredConfig) error {
 	if cfg == nil {
 		return fmt.Errorf("config is nil")
 	}
-	shared := &cloudflare.Config{
-		Tunnel:          cfg.Tunnel,
-		CredentialsFile: cfg.CredentialsFile,
+	cfgDir := filepath.Dir(path)
+	if err := os.MkdirAll(cfgDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory %s: %v", cfgDir, err)
 	}
-	for _, rule := range cfg.Ingress {
-		shared.Ingress = append(shared.Ingress, cloudflare.IngressRule{
-			Hostname: rule.Hostname,
-			Service:  rule.Service,
-		})
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
 	}
-	return cloudflare.WriteConfig(path, shared)
+	return nil
 }
 
 // DefaultConfigDir returns the default cloudflared config directory (~/.cloudflared).
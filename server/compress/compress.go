@@ -0,0 +1,241 @@
+// Package compress compresses responses with brotli or gzip, whichever the
+// client prefers, so large diffs and file trees cost a fraction of their
+// size over a cellular link.
+//
+// Bodies are buffered up to MinSize before deciding: smaller responses and
+// content that is already compressed (images, archives) go out as they
+// are. Event streams and WebSocket upgrades are never touched, and other
+// streaming responses stay streaming: Flush flushes the compressor.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// MinSize is the smallest body worth compressing.
+const MinSize = 1024
+
+// encoder is a compressor that can be flushed mid-stream and reused.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encodings are the supported content codings, in server preference order.
+var encodings = []struct {
+	name string
+	pool *sync.Pool
+}{
+	// quality 4 compresses better than gzip at a similar speed
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, 4) }}},
+	{"gzip", &sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression); return w }}},
+}
+
+// Middleware compresses the responses of next.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := negotiate(r.Header.Get("Accept-Encoding"))
+		if enc < 0 || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &writer{ResponseWriter: w, enc: enc}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate returns the index in encodings of the coding to use for an
+// Accept-Encoding header, or -1 for none.
+func negotiate(accept string) int {
+	best, bestQ := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		for i, e := range encodings {
+			if !strings.EqualFold(strings.TrimSpace(name), e.name) || q <= 0 {
+				continue
+			}
+			// a higher q wins; at equal q the server's order does
+			if q > bestQ || (q == bestQ && i < best) {
+				best, bestQ = i, q
+			}
+		}
+	}
+	return best
+}
+
+// writer buffers the start of a body to decide whether to compress it.
+type writer struct {
+	http.ResponseWriter
+	enc     int
+	status  int
+	decided bool
+	buf     bytes.Buffer
+	encoder encoder // nil when passing the body through
+}
+
+func (w *writer) WriteHeader(code int) {
+	if code < http.StatusOK {
+		// informational responses precede the real one
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() < MinSize && !w.streaming() {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what is buffered, compressing it if the response qualifies:
+// a streaming response cannot wait for MinSize.
+func (w *writer) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(true)
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// streaming reports whether the response is an event stream, which is sent
+// as it is written.
+func (w *writer) streaming() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// decide writes the header, compressing the body from here on if want is
+// set and the response qualifies, and then the buffered start of the body.
+func (w *writer) decide(want bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		// what net/http would otherwise sniff from the uncompressed body
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	if want && w.compressible() {
+		e := encodings[w.enc]
+		w.encoder = e.pool.Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", e.name)
+		// the compressed bytes differ, but the entity is the same
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// compressible reports whether the response is worth compressing.
+func (w *writer) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || w.streaming() {
+		return false
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < MinSize {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return compressibleType(mediaType)
+}
+
+// compressibleType reports whether a media type is text-like, rather than
+// something that is already compressed.
+func compressibleType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/javascript",
+		"application/xml", "application/wasm", "application/manifest+json",
+		"image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// close ends the body: a short response is sent as it is, a compressed
+// one gets its trailer and the encoder goes back to the pool.
+func (w *writer) close() {
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			// the handler wrote nothing; net/http sends its default 200
+			return
+		}
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(nil)
+		encodings[w.enc].pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
@@ -0,0 +1,145 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func serve(h http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rec := httptest.NewRecorder()
+	Middleware(h).ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader = rec.Body
+	switch rec.Header().Get("Content-Encoding") {
+	case "gzip":
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(rec.Body)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompressesLargeText(t *testing.T) {
+	diff := strings.Repeat("+added line\n", 1000)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(diff[:10]))
+		w.Write([]byte(diff[10:]))
+	}
+	for _, tt := range []struct{ accept, want string }{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, identity", ""},
+	} {
+		rec := serve(h, tt.accept)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%s: encoding %q, want %q", tt.accept, got, tt.want)
+		}
+		if got := decode(t, rec); got != diff {
+			t.Errorf("%s: body differs after decoding", tt.accept)
+		}
+		if tt.want != "" {
+			if rec.Body.Len() >= len(diff)/10 {
+				t.Errorf("%s: %d bytes compressed", tt.accept, rec.Body.Len())
+			}
+			if rec.Header().Get("ETag") != `W/"abc"` {
+				t.Errorf("%s: ETag %q", tt.accept, rec.Header().Get("ETag"))
+			}
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: Vary %q", tt.accept, rec.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestLeavesAlone(t *testing.T) {
+	large := strings.Repeat("x", 4*MinSize)
+	for name, h := range map[string]http.HandlerFunc{
+		"small": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"ok"}`))
+		},
+		"image": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(large))
+		},
+		"already encoded": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write([]byte(large))
+		},
+		"event stream": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: " + large + "\n\n"))
+			w.(http.Flusher).Flush()
+		},
+		"not modified": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		},
+	} {
+		rec := serve(h, "gzip, br")
+		if enc := rec.Header().Get("Content-Encoding"); enc != "" && name != "already encoded" {
+			t.Errorf("%s: compressed with %s", name, enc)
+		}
+		if name == "not modified" && (rec.Code != http.StatusNotModified || rec.Body.Len() != 0) {
+			t.Errorf("%s: %d %q", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestStreamingFlushes(t *testing.T) {
+	flushed := make(chan string, 1)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte(`{"type":"stdout","data":"hi"}` + "\n"))
+		w.(http.Flusher).Flush()
+		// the first line is decodable before the handler ends
+		rec := w.(*writer).ResponseWriter.(*httptest.ResponseRecorder)
+		zr, err := gzip.NewReader(strings.NewReader(rec.Body.String()))
+		if err != nil {
+			flushed <- err.Error()
+			return
+		}
+		line := make([]byte, 31)
+		n, _ := io.ReadFull(zr, line)
+		flushed <- string(line[:n])
+	}
+	rec := serve(h, "gzip")
+	if got := <-flushed; got != `{"type":"stdout","data":"hi"}`+"\n" {
+		t.Errorf("after flush: %q", got)
+	}
+	if decode(t, rec) != `{"type":"stdout","data":"hi"}`+"\n" {
+		t.Errorf("body %q", decode(t, rec))
+	}
+}
+
+func TestSniffsContentType(t *testing.T) {
+	rec := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html>" + strings.Repeat("<p>hi</p>", 500)))
+	}, "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("headers %v", rec.Header())
+	}
+}
@@ -16,6 +16,9 @@ func LoadAIConfig(legacyCfg *Config) (*AIModelsConfig, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := applyAIEnv(cfg); err != nil {
+			return nil, err
+		}
 		globalAIModelsConfig = cfg
 		return cfg, nil
 	}
@@ -102,18 +105,14 @@ func (c *ConfigAdapter) GetModel(provider, model string) *ModelConfig {
 
 // GetDefaultAIConfig returns the default AI configuration for making API calls
 func (c *ConfigAdapter) GetDefaultAIConfig() (baseURL, apiKey, model string) {
-	providerName := c.ai.DefaultProvider
 	modelName := c.ai.DefaultModel
 
-	// Fall back to first provider/model if not specified
-	if providerName == "" && len(c.ai.Providers) > 0 {
-		providerName = c.ai.Providers[0].Name
-	}
+	// Fall back to first model if not specified
 	if modelName == "" && len(c.ai.Models) > 0 {
 		modelName = c.ai.Models[0].Model
 	}
 
-	provider := c.GetProvider(providerName)
+	provider := c.GetDefaultProviderConfig()
 	if provider != nil {
 		baseURL = provider.BaseURL
 		apiKey = provider.APIKey
@@ -123,6 +122,16 @@ func (c *ConfigAdapter) GetDefaultAIConfig() (baseURL, apiKey, model string) {
 	return
 }
 
+// GetDefaultProviderConfig returns the default provider, falling back to the
+// first one. Returns nil if none is configured.
+func (c *ConfigAdapter) GetDefaultProviderConfig() *ProviderConfig {
+	providerName := c.ai.DefaultProvider
+	if providerName == "" && len(c.ai.Providers) > 0 {
+		providerName = c.ai.Providers[0].Name
+	}
+	return c.GetProvider(providerName)
+}
+
 // GetModelsForProvider returns all models for a given provider
 func (c *ConfigAdapter) GetModelsForProvider(provider string) []ModelConfig {
 	var models []ModelConfig
@@ -172,6 +181,7 @@ func (c *ConfigAdapter) UpdateFromRequest(req map[string]interface{}) error {
 			if provMap, ok := p.(map[string]interface{}); ok {
 				prov := ProviderConfig{
 					Name:    getString(provMap, "name"),
+					Type:    getString(provMap, "type"),
 					BaseURL: getString(provMap, "base_url"),
 					APIKey:  getString(provMap, "api_key"),
 				}
@@ -192,6 +202,12 @@ func (c *ConfigAdapter) UpdateFromRequest(req map[string]interface{}) error {
 				if maxTokens, ok := modelMap["max_tokens"].(float64); ok {
 					model.MaxTokens = int(maxTokens)
 				}
+				if price, ok := modelMap["input_price"].(float64); ok {
+					model.InputPrice = price
+				}
+				if price, ok := modelMap["output_price"].(float64); ok {
+					model.OutputPrice = price
+				}
 				c.ai.Models = append(c.ai.Models, model)
 			}
 		}
@@ -223,6 +239,7 @@ func getString(m map[string]interface{}, key string) string {
 
 // GetEffectiveAIConfig returns the effective AI configuration.
 // It checks the new AI models file first, then falls back to legacy config.
+// AI_CRITIC_AI__* environment overrides apply over either.
 func GetEffectiveAIConfig(legacyCfg *Config) (*ConfigAdapter, error) {
 	// Check if new AI models file exists
 	if AIModelsFileExists() {
@@ -230,6 +247,9 @@ func GetEffectiveAIConfig(legacyCfg *Config) (*ConfigAdapter, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to load AI models config: %w", err)
 		}
+		if err := applyAIEnv(cfg); err != nil {
+			return nil, err
+		}
 		return NewConfigAdapter(cfg), nil
 	}
 
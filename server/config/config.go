@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync/atomic"
 )
 
 // Config represents the application configuration
@@ -16,6 +17,9 @@ type Config struct {
 
 	// Server configuration
 	Server ServerConfig `json:"server,omitempty"`
+
+	// Cloudflare is read by the tunnel setup script (script/cloudflare/setup)
+	Cloudflare *CloudflareConfig `json:"cloudflare,omitempty"`
 }
 
 // ServerConfig represents the server configuration
@@ -23,6 +27,25 @@ type ServerConfig struct {
 	// ProjectDir is the explicitly configured project directory.
 	// When set, this overrides the auto-detected project directory.
 	ProjectDir string `json:"project_dir,omitempty"`
+
+	// Port is the port to listen on when --port is not given.
+	// Default: DefaultServerPort
+	Port int `json:"port,omitempty"`
+}
+
+// CloudflareConfig is the tunnel serving the server itself on a domain
+type CloudflareConfig struct {
+	// Domain is the public hostname of the server. Required.
+	Domain string `json:"domain"`
+
+	// TunnelID is the tunnel name. Default: derived from Domain
+	TunnelID string `json:"tunnel_id,omitempty"`
+
+	// LocalPort is the port the tunnel forwards to. Default: the server port
+	LocalPort string `json:"local_port,omitempty"`
+
+	// ConfigPath is the cloudflared config directory. Default: ~/.cloudflared
+	ConfigPath string `json:"config_path,omitempty"`
 }
 
 // PortForwardingConfig represents the port forwarding configuration
@@ -95,6 +118,10 @@ type ProviderConfig struct {
 	// Name is the unique identifier for this provider (e.g., "deepseek", "moonshot-cn", "openai")
 	Name string `json:"name"`
 
+	// Type is the API the provider speaks: "openai" (also any OpenAI-compatible
+	// gateway), "anthropic", "gemini" or "ollama". Default: inferred from BaseURL, else openai
+	Type string `json:"type,omitempty"`
+
 	// BaseURL is the API endpoint for this provider
 	BaseURL string `json:"base_url"`
 
@@ -115,36 +142,50 @@ type ModelConfig struct {
 
 	// MaxTokens is the max tokens for this model (optional)
 	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// InputPrice and OutputPrice are the USD cost per million prompt and
+	// completion tokens, used for usage cost reports (optional)
+	InputPrice  float64 `json:"input_price,omitempty"`
+	OutputPrice float64 `json:"output_price,omitempty"`
 }
 
-// global config instance
-var globalConfig *Config
+// global config instance, swapped atomically on hot-reload
+var globalConfig atomic.Pointer[Config]
 
-// Load loads configuration from a JSON file
+// Load loads configuration from a JSON file. The file is validated first:
+// errors are returned as a *ValidationError listing each problem with its
+// line, and warnings such as unknown keys are printed. AI_CRITIC_*
+// environment overrides are then applied (see EnvPrefix).
 func Load(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	cfg, res := Validate(data)
+	for _, w := range res.Warnings {
+		fmt.Fprintf(os.Stderr, "[config] warning: %s: %s\n", configPath, w)
+	}
+	if cfg == nil {
+		return nil, &ValidationError{File: configPath, Issues: res.Errors}
+	}
+	if err := applyConfigEnv(cfg, configPath, res.Warnings); err != nil {
+		return nil, err
 	}
 
-	globalConfig = &cfg
-	return &cfg, nil
+	globalConfig.Store(cfg)
+	return cfg, nil
 }
 
 // Get returns the global config instance
 // Returns nil if config is not loaded
 func Get() *Config {
-	return globalConfig
+	return globalConfig.Load()
 }
 
 // Set sets the global config instance
 func Set(cfg *Config) {
-	globalConfig = cfg
+	globalConfig.Store(cfg)
 }
 
 // GetAI returns the AI configuration
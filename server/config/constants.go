@@ -35,6 +35,12 @@ const (
 // File paths relative to DataDir.
 var (
 	CredentialsFile                = DataDir + "/server-credentials"
+	UsersFile                      = DataDir + "/users.json"
+	OIDCFile                       = DataDir + "/oidc.json"
+	AuditLogFile                   = DataDir + "/audit.log"
+	DebugTraceLogFile              = DataDir + "/debug-trace.log"
+	AuthRateLimitFile              = DataDir + "/auth-rate-limit.json"
+	BasicAuthLockoutsFile          = DataDir + "/basic-auth-lockouts.json"
 	EncKeyFile                     = DataDir + "/enc-key"
 	EncKeyPubFile                  = DataDir + "/enc-key.pub"
 	DomainsFile                    = DataDir + "/server-domains.json"
@@ -47,12 +53,25 @@ var (
 	ProjectsDir                    = DataDir + "/projects"
 	ServerProjectFile              = DataDir + "/server-project.json"
 	AIModelsFile                   = DataDir + "/ai-models.json"
+	AIUsageFile                    = DataDir + "/usage.json"
+	AICacheDir                     = DataDir + "/ai-cache"
 	SSHServerFile                  = DataDir + "/ssh-servers.json"
 	OpencodeInternalServerRegistry = DataDir + "/opencode-internal-server.json"
 	OpencodeInternalServerLock     = DataDir + "/opencode-internal-server.lock"
 	OpencodeServeChildrenRegistry  = DataDir + "/opencode-serve-children.json"
 	OpencodeServeChildrenLock      = DataDir + "/opencode-serve-children.lock"
 	FileTransferDir                = DataDir + "/file-transfer"
+	TemplatesDir                   = DataDir + "/templates"
+	ArtifactsDir                   = DataDir + "/artifacts"
+	RulePacksDir                   = DataDir + "/rule-packs"
+	SnapshotsDir                   = DataDir + "/snapshots"
+	SchedulesFile                  = DataDir + "/schedules.json"
+	WorkspacesDir                  = DataDir + "/workspaces"
+	CursorShadowDir                = DataDir + "/cursor-shadow"
+	CheckpointPolicyFile           = DataDir + "/checkpoint-policy.json"
+	ExecPolicyFile                 = DataDir + "/exec-policy.json"
+	ExecDecisionsLogFile           = DataDir + "/exec-decisions.log"
+	RestartStateFile               = DataDir + "/restart-state.json"
 )
 
 // Process management directory and paths
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment overrides let deployments such as containers configure the
+// server without a config file. Precedence, lowest first:
+//
+//  1. built-in defaults
+//  2. the config file (--config-file); for the ai section, .ai-critic/ai-models.json
+//     when it exists
+//  3. AI_CRITIC_* environment variables
+//  4. command-line flags such as --port
+//
+// A variable names a config value by its JSON path: keys are separated by a
+// double underscore, list elements by their index, and matching is
+// case-insensitive:
+//
+//	AI_CRITIC_AI__DEFAULT_MODEL=deepseek-chat        -> ai.default_model
+//	AI_CRITIC_AI__PROVIDERS__0__API_KEY=sk-...       -> ai.providers[0].api_key
+//	AI_CRITIC_SERVER__PORT=8080                      -> server.port
+//
+// An index past the end of a list grows it. Values are parsed by the type of
+// the field: strings as-is, numbers and booleans with strconv. The common
+// settings also have the short names in envAliases.
+const EnvPrefix = "AI_CRITIC_"
+
+// envPathSep separates keys in a variable name. A single underscore cannot,
+// since keys such as api_key contain one.
+const envPathSep = "__"
+
+// envAliases are short names for frequently set values.
+var envAliases = map[string]string{
+	EnvPrefix + "PORT":              "server.port",
+	EnvPrefix + "PROJECT_DIR":       "server.project_dir",
+	EnvPrefix + "DEFAULT_PROVIDER":  "ai.default_provider",
+	EnvPrefix + "DEFAULT_MODEL":     "ai.default_model",
+	EnvPrefix + "CLOUDFLARE_DOMAIN": "cloudflare.domain",
+}
+
+// envOverride is one AI_CRITIC_* variable that names a config value.
+type envOverride struct {
+	name  string
+	path  []string // lower-case JSON keys and list indexes
+	value string
+}
+
+// envOverrides picks the config overrides out of environ, sorted by name so
+// they apply in a stable order. Variables without a double underscore are
+// other settings (such as AI_CRITIC_HOME) unless they are aliases.
+func envOverrides(environ []string) []envOverride {
+	var overrides []envOverride
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		var path []string
+		if alias, ok := envAliases[name]; ok {
+			path = strings.Split(alias, ".")
+		} else if rest := name[len(EnvPrefix):]; strings.Contains(rest, envPathSep) {
+			path = strings.Split(strings.ToLower(rest), envPathSep)
+		} else {
+			continue
+		}
+		overrides = append(overrides, envOverride{name: name, path: path, value: value})
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].name < overrides[j].name })
+	return overrides
+}
+
+// ApplyEnv sets the fields of v, a pointer to a struct with JSON tags, from
+// the AI_CRITIC_* variables in environ (as returned by os.Environ). It
+// returns the names of the variables applied and of those naming no field
+// of v. An error means a value could not be parsed; v may then be partly
+// updated.
+func ApplyEnv(v any, environ []string) (applied []string, unknown []string, err error) {
+	root := reflect.ValueOf(v)
+	if root.Kind() != reflect.Pointer || root.Elem().Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("ApplyEnv: want a pointer to a struct, got %T", v)
+	}
+	for _, o := range envOverrides(environ) {
+		found, err := setPath(root.Elem(), o.path, o.value)
+		if err != nil {
+			return applied, unknown, fmt.Errorf("%s: %v", o.name, err)
+		}
+		if !found {
+			unknown = append(unknown, o.name)
+			continue
+		}
+		applied = append(applied, o.name)
+	}
+	return applied, unknown, nil
+}
+
+// setPath walks path from v, allocating nil pointers and growing lists, and
+// parses value into the field it ends at. It reports false if path does not
+// name a field, in which case v is left unchanged.
+func setPath(v reflect.Value, path []string, value string) (bool, error) {
+	if !pathExists(v.Type(), path) {
+		return false, nil
+	}
+	for _, seg := range path {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			v = v.FieldByIndex(envField(v.Type(), seg).Index)
+		case reflect.Slice:
+			i, _ := strconv.Atoi(seg)
+			if i >= v.Len() {
+				grown := reflect.MakeSlice(v.Type(), i+1, i+1)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+			v = v.Index(i)
+		}
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return true, setScalar(v, value)
+}
+
+// pathExists reports whether path names a scalar field below t.
+func pathExists(t reflect.Type, path []string) bool {
+	for _, seg := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f := envField(t, seg)
+			if f == nil {
+				return false
+			}
+			t = f.Type
+		case reflect.Slice:
+			if i, err := strconv.Atoi(seg); err != nil || i < 0 {
+				return false
+			}
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		return false
+	}
+	return len(path) > 0
+}
+
+// envField finds the field whose JSON name matches key case-insensitively.
+func envField(t reflect.Type, key string) *reflect.StructField {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name != "" && name != "-" && strings.EqualFold(name, key) {
+			return &f
+		}
+	}
+	return nil
+}
+
+func setScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot set a %s from the environment", v.Kind())
+	}
+	return nil
+}
+
+// applyConfigEnv applies the environment to cfg and validates the result, so
+// an override cannot smuggle in, say, a model of an unknown provider.
+// Warnings already reported for the file are passed in to avoid repeating them.
+func applyConfigEnv(cfg *Config, source string, fileWarnings []Issue) error {
+	applied, unknown, err := ApplyEnv(cfg, os.Environ())
+	if err != nil {
+		return fmt.Errorf("invalid environment override %v", err)
+	}
+	for _, name := range unknown {
+		fmt.Fprintf(os.Stderr, "[config] warning: %s does not name a config value, ignored\n", name)
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	res := checkConfig(cfg)
+	for _, w := range res.Warnings {
+		if !containsIssue(fileWarnings, w) {
+			fmt.Fprintf(os.Stderr, "[config] warning: %s: %s\n", source, w)
+		}
+	}
+	if len(res.Errors) > 0 {
+		return &ValidationError{File: fmt.Sprintf("%s with %s", source, strings.Join(applied, ", ")), Issues: res.Errors}
+	}
+	return nil
+}
+
+func containsIssue(issues []Issue, issue Issue) bool {
+	for _, i := range issues {
+		if i.Path == issue.Path && i.Message == issue.Message {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadEnv builds the config from AI_CRITIC_* variables alone, for running
+// without a config file, and makes it the global config. It returns nil if
+// no override is set.
+func LoadEnv() (*Config, error) {
+	if len(envOverrides(os.Environ())) == 0 {
+		return nil, nil
+	}
+	cfg := &Config{AI: AIConfig{Providers: []ProviderConfig{}, Models: []ModelConfig{}}}
+	if err := applyConfigEnv(cfg, "environment", nil); err != nil {
+		return nil, err
+	}
+	globalConfig.Store(cfg)
+	return cfg, nil
+}
+
+// applyAIEnv applies the AI_CRITIC_AI__* overrides to the AI models file
+// config, which takes the place of the ai section of the config file.
+// Other overrides are ignored here.
+func applyAIEnv(cfg *AIModelsConfig) error {
+	wrapper := struct {
+		AI *AIModelsConfig `json:"ai"`
+	}{AI: cfg}
+	if _, _, err := ApplyEnv(&wrapper, os.Environ()); err != nil {
+		return fmt.Errorf("invalid environment override %v", err)
+	}
+	return nil
+}
+
+// ServerPort is the port the server listens on without --port: server.port
+// from the loaded config or, when none is loaded, from AI_CRITIC_PORT and
+// AI_CRITIC_SERVER__PORT; else DefaultServerPort.
+func ServerPort() int {
+	cfg := Get()
+	if cfg == nil {
+		cfg = &Config{}
+		ApplyEnv(cfg, os.Environ())
+	}
+	if cfg.Server.Port > 0 {
+		return cfg.Server.Port
+	}
+	return DefaultServerPort
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     []string
+		want    func(*Config)
+		unknown []string
+		err     string
+	}{
+		{
+			name: "nested path and list index",
+			env:  []string{"AI_CRITIC_AI__PROVIDERS__0__API_KEY=sk-env"},
+			want: func(c *Config) { c.AI.Providers[0].APIKey = "sk-env" },
+		},
+		{
+			name: "case-insensitive keys and growing a list",
+			env:  []string{"AI_CRITIC_ai__Providers__1__NAME=moonshot", "AI_CRITIC_AI__PROVIDERS__1__BASE_URL=https://m"},
+			want: func(c *Config) {
+				c.AI.Providers = append(c.AI.Providers, ProviderConfig{Name: "moonshot", BaseURL: "https://m"})
+			},
+		},
+		{
+			name: "aliases",
+			env:  []string{"AI_CRITIC_PORT=8080", "AI_CRITIC_CLOUDFLARE_DOMAIN=dev.example.com"},
+			want: func(c *Config) {
+				c.Server.Port = 8080
+				c.Cloudflare = &CloudflareConfig{Domain: "dev.example.com"}
+			},
+		},
+		{
+			name: "pointer to bool",
+			env:  []string{"AI_CRITIC_PORT_FORWARDING__PROVIDERS__0__ENABLED=false"},
+			want: func(c *Config) {
+				c.PortForwarding.Providers = []PortForwardProviderConfig{{Enabled: new(bool)}}
+			},
+		},
+		{
+			name: "other settings are not overrides",
+			env:  []string{"AI_CRITIC_HOME=/data", "AI_CRITIC_NO_OPEN_BROWSER=1", "OTHER__KEY=x"},
+			want: func(c *Config) {},
+		},
+		{
+			name:    "unknown path",
+			env:     []string{"AI_CRITIC_AI__PROVIDER__0__NAME=x", "AI_CRITIC_AI__PROVIDERS=x"},
+			want:    func(c *Config) {},
+			unknown: []string{"AI_CRITIC_AI__PROVIDERS", "AI_CRITIC_AI__PROVIDER__0__NAME"},
+		},
+		{
+			name: "invalid integer",
+			env:  []string{"AI_CRITIC_SERVER__PORT=http"},
+			err:  `AI_CRITIC_SERVER__PORT: invalid integer "http"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := func() *Config {
+				return &Config{AI: AIConfig{Providers: []ProviderConfig{{Name: "deepseek", BaseURL: "https://d"}}}}
+			}
+			got := base()
+			_, unknown, err := ApplyEnv(got, tt.env)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := base()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("config = %+v, want %+v", got, want)
+			}
+			if !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("unknown = %v, want %v", unknown, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestLoadAppliesEnv(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	data := `{"ai": {"providers": [{"name": "deepseek", "base_url": "https://d"}], "models": [{"provider": "deepseek", "model": "chat"}]}}`
+	if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AI_CRITIC_AI__PROVIDERS__0__API_KEY", "sk-env")
+	t.Setenv("AI_CRITIC_PORT", "8080")
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AI.Providers[0].APIKey != "sk-env" || cfg.Server.Port != 8080 {
+		t.Errorf("overrides not applied: %+v", cfg)
+	}
+	if got := ServerPort(); got != 8080 {
+		t.Errorf("ServerPort() = %d, want 8080", got)
+	}
+
+	// overrides are validated like the file
+	t.Setenv("AI_CRITIC_AI__MODELS__1__MODEL", "other")
+	_, err = Load(configPath)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "ai.models[1].provider: provider is required") {
+		t.Errorf("err = %v, want a validation error for ai.models[1].provider", err)
+	}
+}
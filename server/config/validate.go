@@ -0,0 +1,381 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// knownPortForwardTypes mirrors the provider names in server/proxy/portforward,
+// which imports this package and so cannot be referenced from here.
+var knownPortForwardTypes = []string{
+	"localtunnel",
+	"cloudflare_quick",
+	"cloudflare_tunnel",
+	"cloudflare_owned",
+	"ngrok",
+	"tailscale_funnel",
+}
+
+// knownProviderTypes mirrors the provider types of server/ai.
+var knownProviderTypes = []string{"openai", "anthropic", "gemini", "ollama"}
+
+// Issue is one problem found in a config file.
+type Issue struct {
+	// Line and Column are 1-based; zero when the position is unknown.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	// Path locates the value, e.g. "ai.providers[0].name".
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	if i.Line > 0 {
+		fmt.Fprintf(&b, "line %d, column %d: ", i.Line, i.Column)
+	}
+	if i.Path != "" {
+		b.WriteString(i.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// ValidationResult holds everything Validate found. Errors make the config
+// unusable; warnings (such as unknown keys) are reported but not fatal.
+type ValidationResult struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// ValidationError is returned by Load when the config file has errors.
+type ValidationError struct {
+	File   string
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config file %s:", e.File)
+	for _, issue := range e.Issues {
+		b.WriteString("\n  ")
+		b.WriteString(issue.String())
+	}
+	return b.String()
+}
+
+// Validate checks data against the Config schema: JSON syntax, value types,
+// unknown keys, and cross references such as models naming a configured
+// provider. The returned Config is nil if there are errors.
+func Validate(data []byte) (*Config, *ValidationResult) {
+	res := &ValidationResult{Errors: []Issue{}, Warnings: []Issue{}}
+	w := &schemaWalker{
+		data:    data,
+		dec:     json.NewDecoder(bytes.NewReader(data)),
+		offsets: make(map[string]int64),
+		res:     res,
+	}
+	w.dec.UseNumber()
+	if err := w.walk("", reflect.TypeOf(Config{})); err != nil {
+		res.Errors = append(res.Errors, w.syntaxIssue(err))
+		return nil, res
+	}
+	if _, err := w.dec.Token(); err != io.EOF {
+		res.Errors = append(res.Errors, w.issue(w.dec.InputOffset(), "", "unexpected data after the top-level object"))
+		return nil, res
+	}
+	if len(res.Errors) > 0 {
+		return nil, res
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		// the walk above should have caught anything Unmarshal rejects
+		res.Errors = append(res.Errors, Issue{Message: err.Error()})
+		return nil, res
+	}
+	w.checkSemantics(&cfg)
+	if len(res.Errors) > 0 {
+		return nil, res
+	}
+	return &cfg, res
+}
+
+// checkConfig runs the cross-reference checks of Validate on a config built
+// in memory, such as one with environment overrides applied. Issues carry a
+// path but no position.
+func checkConfig(cfg *Config) *ValidationResult {
+	res := &ValidationResult{Errors: []Issue{}, Warnings: []Issue{}}
+	w := &schemaWalker{offsets: make(map[string]int64), res: res}
+	w.checkSemantics(cfg)
+	return res
+}
+
+// schemaWalker walks the JSON token stream alongside the Go type it decodes
+// into, so every problem can be reported with its line and column.
+type schemaWalker struct {
+	data    []byte
+	dec     *json.Decoder
+	offsets map[string]int64 // path -> offset of its value, for semantic checks
+	res     *ValidationResult
+}
+
+func (w *schemaWalker) walk(path string, t reflect.Type) error {
+	start := w.dec.InputOffset()
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	w.offsets[path] = start
+	if tok == nil {
+		// null leaves the field at its zero value
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	got := tokenKind(tok)
+	want := typeKind(t)
+	if got != want && !(want == "number" && got == "integer") {
+		w.errorf(start, path, "expected %s, got %s", want, got)
+		if d, ok := tok.(json.Delim); ok && (d == '{' || d == '[') {
+			return w.skip(1)
+		}
+		return nil
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for w.dec.More() {
+			keyStart := w.dec.InputOffset()
+			keyTok, err := w.dec.Token()
+			if err != nil {
+				return err
+			}
+			key := keyTok.(string)
+			field, ok := fieldByJSONName(t, key)
+			if !ok {
+				w.warnf(keyStart, joinPath(path, key), "unknown key %q", key)
+				if err := w.skipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := w.walk(joinPath(path, key), field.Type); err != nil {
+				return err
+			}
+		}
+		_, err := w.dec.Token() // '}'
+		return err
+	case json.Delim('['):
+		for i := 0; w.dec.More(); i++ {
+			if err := w.walk(fmt.Sprintf("%s[%d]", path, i), t.Elem()); err != nil {
+				return err
+			}
+		}
+		_, err := w.dec.Token() // ']'
+		return err
+	}
+	return nil
+}
+
+// skipValue consumes the next value, however deeply nested.
+func (w *schemaWalker) skipValue() error {
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); ok && (d == '{' || d == '[') {
+		return w.skip(1)
+	}
+	return nil
+}
+
+// skip consumes tokens until depth open delimiters have been closed.
+func (w *schemaWalker) skip(depth int) error {
+	for depth > 0 {
+		tok, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+func (w *schemaWalker) checkSemantics(cfg *Config) {
+	providers := make(map[string]bool, len(cfg.AI.Providers))
+	for i, p := range cfg.AI.Providers {
+		path := fmt.Sprintf("ai.providers[%d]", i)
+		switch {
+		case p.Name == "":
+			w.errorf(w.offsets[path], path+".name", "provider name is required")
+		case providers[p.Name]:
+			w.errorf(w.offsets[path+".name"], path+".name", "duplicate provider %q", p.Name)
+		}
+		providers[p.Name] = true
+		if p.Type != "" && !slices.Contains(knownProviderTypes, p.Type) {
+			w.errorf(w.offsets[path+".type"], path+".type", "unknown type %q, expected one of %s", p.Type, strings.Join(knownProviderTypes, ", "))
+		}
+	}
+
+	models := make(map[string]bool, len(cfg.AI.Models))
+	for i, m := range cfg.AI.Models {
+		path := fmt.Sprintf("ai.models[%d]", i)
+		if m.Model == "" {
+			w.errorf(w.offsets[path], path+".model", "model is required")
+		}
+		models[m.Model] = true
+		if m.Provider == "" {
+			w.errorf(w.offsets[path], path+".provider", "provider is required")
+		} else if !providers[m.Provider] {
+			w.errorf(w.offsets[path+".provider"], path+".provider", "unknown provider %q, not listed in ai.providers", m.Provider)
+		}
+	}
+	if p := cfg.AI.DefaultProvider; p != "" && !providers[p] {
+		w.errorf(w.offsets["ai.default_provider"], "ai.default_provider", "unknown provider %q, not listed in ai.providers", p)
+	}
+	if m := cfg.AI.DefaultModel; m != "" && !models[m] {
+		w.warnf(w.offsets["ai.default_model"], "ai.default_model", "model %q is not listed in ai.models", m)
+	}
+
+	for i, p := range cfg.PortForwarding.Providers {
+		path := fmt.Sprintf("port_forwarding.providers[%d]", i)
+		if p.Type == "" {
+			w.errorf(w.offsets[path], path+".type", "type is required, one of %s", strings.Join(knownPortForwardTypes, ", "))
+			continue
+		}
+		if !slices.Contains(knownPortForwardTypes, p.Type) {
+			w.errorf(w.offsets[path+".type"], path+".type", "unknown type %q, expected one of %s", p.Type, strings.Join(knownPortForwardTypes, ", "))
+			continue
+		}
+		if p.Type == "cloudflare_tunnel" {
+			if p.Cloudflare == nil || p.Cloudflare.BaseDomain == "" {
+				w.errorf(w.offsets[path], path+".cloudflare.base_domain", "base_domain is required for cloudflare_tunnel")
+			}
+		} else if p.Cloudflare != nil {
+			w.warnf(w.offsets[path+".cloudflare"], path+".cloudflare", "only used by type cloudflare_tunnel, ignored for %s", p.Type)
+		}
+	}
+}
+
+func (w *schemaWalker) errorf(offset int64, path string, format string, args ...any) {
+	w.res.Errors = append(w.res.Errors, w.issue(offset, path, fmt.Sprintf(format, args...)))
+}
+
+func (w *schemaWalker) warnf(offset int64, path string, format string, args ...any) {
+	w.res.Warnings = append(w.res.Warnings, w.issue(offset, path, fmt.Sprintf(format, args...)))
+}
+
+// issue positions a message at the first significant byte at or after offset.
+// Decoder offsets point just past the previous token, so separators and
+// whitespace are skipped first.
+func (w *schemaWalker) issue(offset int64, path, msg string) Issue {
+	if w.data == nil {
+		return Issue{Path: path, Message: msg}
+	}
+	i := int(offset)
+	for i < len(w.data) && strings.IndexByte(" \t\r\n:,", w.data[i]) >= 0 {
+		i++
+	}
+	line, col := lineColumn(w.data, i)
+	return Issue{Line: line, Column: col, Path: path, Message: msg}
+}
+
+func (w *schemaWalker) syntaxIssue(err error) Issue {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// the offset of a syntax error is just past the offending byte
+		line, col := lineColumn(w.data, int(syntaxErr.Offset)-1)
+		return Issue{Line: line, Column: col, Message: "invalid JSON: " + syntaxErr.Error()}
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		line, col := lineColumn(w.data, len(w.data))
+		return Issue{Line: line, Column: col, Message: "invalid JSON: unexpected end of file"}
+	}
+	return Issue{Message: "invalid JSON: " + err.Error()}
+}
+
+// lineColumn converts a byte offset into 1-based line and column numbers.
+func lineColumn(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := offset - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+func fieldByJSONName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func tokenKind(tok json.Token) string {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return "object"
+		}
+		return "array"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+func typeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return t.Kind().String()
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		errors   []string // prefixes of Issue.String()
+		warnings []string
+	}{
+		{
+			name: "valid",
+			data: `{
+  "ai": {
+    "providers": [{"name": "deepseek", "base_url": "https://api.deepseek.com"}],
+    "models": [{"provider": "deepseek", "model": "deepseek-chat", "max_tokens": 8192}],
+    "default_provider": "deepseek"
+  },
+  "cloudflare": {"domain": "example.com"},
+  "port_forwarding": {"providers": [{"type": "cloudflare_quick", "enabled": false}]}
+}`,
+		},
+		{
+			name:   "syntax error",
+			data:   "{\n  \"ai\": {\n    \"providers\": [}\n}",
+			errors: []string{"line 3, column 19: invalid JSON"},
+		},
+		{
+			name:   "truncated",
+			data:   "{\n  \"ai\": {",
+			errors: []string{"line 2, column 9: invalid JSON: unexpected end"},
+		},
+		{
+			name: "wrong types",
+			data: `{
+  "ai": {"providers": [{"name": 1, "base_url": "x"}], "models": {}},
+  "port_forwarding": {"providers": [{"type": "ngrok", "enabled": "yes"}]}
+}`,
+			errors: []string{
+				"line 2, column 33: ai.providers[0].name: expected string, got integer",
+				"line 2, column 65: ai.models: expected array, got object",
+				"line 3, column 66: port_forwarding.providers[0].enabled: expected boolean, got string",
+			},
+		},
+		{
+			name: "unknown keys warn",
+			data: `{
+  "server": {"project_dir": "/p", "projectDir": "/q"},
+  "extra": {"a": [1, {"b": 2}]}
+}`,
+			warnings: []string{
+				"line 2, column 35: server.projectDir: unknown key",
+				"line 3, column 3: extra: unknown key",
+			},
+		},
+		{
+			name: "references",
+			data: `{
+  "ai": {
+    "providers": [{"name": "a", "base_url": "x"}],
+    "models": [{"provider": "b", "model": "m"}],
+    "default_provider": "c",
+    "default_model": "n"
+  },
+  "port_forwarding": {"providers": [{"type": "frp"}, {"type": "cloudflare_tunnel"}]}
+}`,
+			errors: []string{
+				"line 4, column 29: ai.models[0].provider: unknown provider \"b\"",
+				"line 5, column 25: ai.default_provider: unknown provider \"c\"",
+				"line 8, column 46: port_forwarding.providers[0].type: unknown type \"frp\"",
+				"line 8, column 54: port_forwarding.providers[1].cloudflare.base_domain: base_domain is required",
+			},
+			warnings: []string{"line 6, column 22: ai.default_model: model \"n\" is not listed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, res := Validate([]byte(tt.data))
+			if (cfg == nil) != (len(tt.errors) > 0) {
+				t.Errorf("cfg = %v with errors %v", cfg, res.Errors)
+			}
+			checkIssues(t, "error", res.Errors, tt.errors)
+			checkIssues(t, "warning", res.Warnings, tt.warnings)
+		})
+	}
+}
+
+func checkIssues(t *testing.T, kind string, got []Issue, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%ss = %v, want %q", kind, got, want)
+	}
+	for i, issue := range got {
+		if !strings.HasPrefix(issue.String(), want[i]) {
+			t.Errorf("%s %d = %q, want prefix %q", kind, i, issue.String(), want[i])
+		}
+	}
+}
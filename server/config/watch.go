@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often the watcher stats the config files.
+// Polling (rather than inotify) survives editors that replace files via rename.
+const watchInterval = 2 * time.Second
+
+// fileStamp identifies one version of a file on disk.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statStamp(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// Watcher reloads the legacy config file (.config.local.json) and the AI
+// models file when either changes on disk, and hands the resulting
+// ConfigAdapter to a callback so callers can swap it in atomically.
+type Watcher struct {
+	configPath string
+	onReload   func(*ConfigAdapter)
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+	stop   chan struct{}
+}
+
+var (
+	defaultWatcherMu sync.Mutex
+	defaultWatcher   *Watcher
+)
+
+// StartWatcher starts the process-wide config watcher. configPath is the
+// --config-file path and may be empty, in which case only the AI models file
+// is watched. Calling it again replaces the previous watcher.
+func StartWatcher(configPath string, onReload func(*ConfigAdapter)) *Watcher {
+	w := NewWatcher(configPath, onReload)
+	defaultWatcherMu.Lock()
+	prev := defaultWatcher
+	defaultWatcher = w
+	defaultWatcherMu.Unlock()
+	if prev != nil {
+		prev.Stop()
+	}
+	w.Start()
+	return w
+}
+
+// StopWatcher stops the process-wide config watcher, if any.
+func StopWatcher() {
+	defaultWatcherMu.Lock()
+	w := defaultWatcher
+	defaultWatcher = nil
+	defaultWatcherMu.Unlock()
+	if w != nil {
+		w.Stop()
+	}
+}
+
+// NewWatcher creates a watcher; the current file states are recorded so that
+// only subsequent edits trigger a reload.
+func NewWatcher(configPath string, onReload func(*ConfigAdapter)) *Watcher {
+	w := &Watcher{
+		configPath: configPath,
+		onReload:   onReload,
+		stamps:     make(map[string]fileStamp),
+	}
+	for _, path := range w.paths() {
+		w.stamps[path] = statStamp(path)
+	}
+	return w
+}
+
+func (w *Watcher) paths() []string {
+	if w.configPath == "" {
+		return []string{AIModelsFile}
+	}
+	return []string{w.configPath, AIModelsFile}
+}
+
+// Start begins polling in the background.
+func (w *Watcher) Start() {
+	w.mu.Lock()
+	if w.stop != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.stop = make(chan struct{})
+	stop := w.stop
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				w.Check()
+			}
+		}
+	}()
+}
+
+// Stop ends polling.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+// Check reloads the config if any watched file changed since the last check.
+// It reports whether a reload was applied. A file that fails to parse is
+// logged and the previous config stays in effect.
+func (w *Watcher) Check() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := false
+	for _, path := range w.paths() {
+		stamp := statStamp(path)
+		if stamp != w.stamps[path] {
+			w.stamps[path] = stamp
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+
+	if w.configPath != "" {
+		if _, err := os.Stat(w.configPath); err == nil {
+			if _, err := Load(w.configPath); err != nil {
+				fmt.Printf("[config] reload of %s failed, keeping previous config: %v\n", w.configPath, err)
+				return false
+			}
+		}
+	}
+
+	adapter, err := GetEffectiveAIConfig(Get())
+	if err != nil {
+		fmt.Printf("[config] reload of AI config failed, keeping previous config: %v\n", err)
+		return false
+	}
+	fmt.Printf("[config] reloaded configuration (%d providers, %d models)\n",
+		len(adapter.GetAvailableProviders()), len(adapter.GetAvailableModels()))
+	if w.onReload != nil {
+		w.onReload(adapter)
+	}
+	return true
+}
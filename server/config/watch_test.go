@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	origAIModels := AIModelsFile
+	AIModelsFile = filepath.Join(dir, "ai-models.json")
+	t.Cleanup(func() { AIModelsFile = origAIModels })
+
+	configPath := filepath.Join(dir, ".config.local.json")
+	writeConfig := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Force a distinct mtime so the change is visible on coarse clocks.
+		if err := os.Chtimes(configPath, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Now().Add(-time.Hour)
+	writeConfig(`{"ai":{"providers":[{"name":"a","base_url":"http://a"}]}}`, base)
+
+	var got *ConfigAdapter
+	w := NewWatcher(configPath, func(a *ConfigAdapter) { got = a })
+
+	if w.Check() {
+		t.Fatalf("Check() reloaded without a change")
+	}
+
+	writeConfig(`{"ai":{"providers":[{"name":"a"},{"name":"b"}],"default_provider":"b"}}`, base.Add(time.Minute))
+	if !w.Check() {
+		t.Fatalf("Check() did not reload after change")
+	}
+	if got == nil || got.GetDefaultProvider() != "b" || len(got.GetAvailableProviders()) != 2 {
+		t.Fatalf("unexpected reloaded adapter: %+v", got)
+	}
+
+	// Broken JSON keeps the previous config.
+	got = nil
+	writeConfig(`{"ai":`, base.Add(2*time.Minute))
+	if w.Check() {
+		t.Fatalf("Check() applied an invalid config")
+	}
+	if got != nil {
+		t.Fatalf("onReload called for invalid config")
+	}
+	if Get() == nil || Get().AI.DefaultProvider != "b" {
+		t.Fatalf("previous config not retained: %+v", Get())
+	}
+}
@@ -0,0 +1,256 @@
+// Package crashreport records unexpected server exits so they can be read
+// back after recovery. The keep-alive supervisor saves a report whenever the
+// managed server dies, with the tail of its output; the server itself routes
+// fatal panics into a crash output file, which is turned into a report on
+// the next start when no supervisor picked it up.
+package crashreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+const (
+	// maxReports bounds the number of reports kept on disk (oldest dropped).
+	maxReports = 20
+	// MaxOutput bounds the captured output of one crash.
+	MaxOutput = 64 * 1024
+
+	panicOutputName = "panic-output.log"
+)
+
+// Report sources.
+const (
+	SourceKeepAlive = "keep-alive" // recorded by the supervisor
+	SourceStartup   = "startup"    // recovered from the crash output on the next start
+)
+
+// Report describes one unexpected exit.
+type Report struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Reason   string    `json:"reason"` // e.g. "process exited", "port unreachable"
+	PID      int       `json:"pid,omitempty"`
+	Binary   string    `json:"binary,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"` // nil when unknown or killed by a signal
+	Signal   string    `json:"signal,omitempty"`
+	// UptimeMS is how long the process ran; zero when unknown.
+	UptimeMS int64 `json:"uptime_ms,omitempty"`
+	Panic    bool  `json:"panic"`
+	// Output is the last stderr output, starting at the panic when there is one.
+	Output string `json:"output,omitempty"`
+	// Consecutive counts crashes in a row without a stable run in between,
+	// and RestartDelayMS the back-off the supervisor applied before restarting.
+	Consecutive    int   `json:"consecutive,omitempty"`
+	RestartDelayMS int64 `json:"restart_delay_ms,omitempty"`
+}
+
+var (
+	mu  sync.Mutex
+	dir = config.DataDir + "/crashes"
+)
+
+// SetDir points the reports at another directory (used by tests).
+func SetDir(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir = path
+}
+
+func reportDir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir
+}
+
+// Save writes a report and prunes the oldest beyond maxReports.
+func Save(r Report) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	d := reportDir()
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("crash-%s.json", r.Time.UTC().Format("20060102T150405.000000000"))
+	if err := os.WriteFile(filepath.Join(d, name), data, 0644); err != nil {
+		return err
+	}
+	names, err := reportNames(d)
+	if err != nil {
+		return err
+	}
+	for len(names) > maxReports {
+		os.Remove(filepath.Join(d, names[0]))
+		names = names[1:]
+	}
+	return nil
+}
+
+// reportNames lists report files, oldest first.
+func reportNames(d string) ([]string, error) {
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "crash-") && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// List returns the saved reports, newest first.
+func List() ([]Report, error) {
+	d := reportDir()
+	names, err := reportNames(d)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(filepath.Join(d, names[i]))
+		if err != nil {
+			continue
+		}
+		var r Report
+		if json.Unmarshal(data, &r) == nil {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+// Clear removes all saved reports.
+func Clear() error {
+	d := reportDir()
+	names, err := reportNames(d)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(d, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func panicOutputPath() string {
+	return filepath.Join(reportDir(), panicOutputName)
+}
+
+// EnableCrashOutput makes the Go runtime copy fatal panics and errors of
+// this process into the crash output file, in addition to stderr.
+func EnableCrashOutput() error {
+	if err := os.MkdirAll(reportDir(), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(panicOutputPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // SetCrashOutput keeps its own duplicate
+	return debug.SetCrashOutput(f, debug.CrashOptions{})
+}
+
+// TakePanicOutput returns what the runtime wrote to the crash output file
+// and empties it, so each crash is reported once.
+func TakePanicOutput() string {
+	path := panicOutputPath()
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	os.Truncate(path, 0)
+	if len(data) > MaxOutput {
+		data = data[len(data)-MaxOutput:]
+	}
+	return string(data)
+}
+
+// CollectPending saves the panic left by a previous run of this process
+// that no supervisor reported, if any. It returns whether one was found.
+func CollectPending() bool {
+	var crashedAt time.Time
+	if info, err := os.Stat(panicOutputPath()); err == nil {
+		crashedAt = info.ModTime()
+	}
+	out := TakePanicOutput()
+	if out == "" {
+		return false
+	}
+	r := Report{Time: crashedAt, Source: SourceStartup, Reason: "fatal panic in previous run", Panic: true, Output: out}
+	if err := Save(r); err != nil {
+		fmt.Fprintf(os.Stderr, "[crashreport] failed to save crash report: %v\n", err)
+	}
+	return true
+}
+
+// TailFile returns at most MaxOutput bytes from the end of path, reading no
+// earlier than offset.
+func TailFile(path string, offset int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	if start := info.Size() - MaxOutput; start > offset {
+		offset = start
+	}
+	if offset < 0 || offset > info.Size() {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return ""
+	}
+	data, _ := io.ReadAll(io.LimitReader(f, MaxOutput))
+	return string(data)
+}
+
+// ExtractPanic trims output to the last fatal panic or runtime error it
+// contains, reporting whether there was one. Without a panic the output is
+// returned unchanged.
+func ExtractPanic(output string) (string, bool) {
+	at := -1
+	for i := 0; i < len(output); {
+		line := output[i:]
+		// nested panics are indented; only a line start begins a report
+		if strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "fatal error: ") {
+			at = i
+		}
+		nl := strings.IndexByte(line, '\n')
+		if nl < 0 {
+			break
+		}
+		i += nl + 1
+	}
+	if at < 0 {
+		return output, false
+	}
+	return output[at:], true
+}
@@ -0,0 +1,88 @@
+package crashreport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveListPrune(t *testing.T) {
+	SetDir(t.TempDir())
+	base := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < maxReports+3; i++ {
+		if err := Save(Report{Time: base.Add(time.Duration(i) * time.Second), PID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reports, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != maxReports {
+		t.Fatalf("kept %d reports, want %d", len(reports), maxReports)
+	}
+	if reports[0].PID != maxReports+2 || reports[len(reports)-1].PID != 3 {
+		t.Errorf("order: newest PID %d, oldest PID %d", reports[0].PID, reports[len(reports)-1].PID)
+	}
+	if err := Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if reports, _ := List(); len(reports) != 0 {
+		t.Errorf("after clear: %d reports", len(reports))
+	}
+}
+
+func TestCollectPending(t *testing.T) {
+	dir := t.TempDir()
+	SetDir(dir)
+	if CollectPending() {
+		t.Fatal("nothing to collect yet")
+	}
+	os.WriteFile(filepath.Join(dir, panicOutputName), []byte("panic: boom\n\ngoroutine 1 [running]:\n"), 0644)
+	if !CollectPending() {
+		t.Fatal("pending panic not collected")
+	}
+	// reported once
+	if CollectPending() {
+		t.Error("panic collected twice")
+	}
+	reports, _ := List()
+	if len(reports) != 1 || !reports[0].Panic || reports[0].Source != SourceStartup || !strings.HasPrefix(reports[0].Output, "panic: boom") {
+		t.Errorf("reports = %+v", reports)
+	}
+}
+
+func TestExtractPanic(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+		panic  bool
+	}{
+		{"no panic", "listening on :23712\nbye\n", "listening on :23712\nbye\n", false},
+		{"panic after logs", "request ok\npanic: nil map\n\ngoroutine 7 [running]:\nmain.f()\n", "panic: nil map\n\ngoroutine 7 [running]:\nmain.f()\n", true},
+		{"nested panic keeps first line", "log\npanic: a [recovered]\n\tpanic: b\n\ngoroutine 1:\n", "panic: a [recovered]\n\tpanic: b\n\ngoroutine 1:\n", true},
+		{"runtime fatal error", "old\npanic: earlier\nfatal error: concurrent map writes\n\ngoroutine 3:\n", "fatal error: concurrent map writes\n\ngoroutine 3:\n", true},
+	}
+	for _, tt := range tests {
+		got, isPanic := ExtractPanic(tt.output)
+		if got != tt.want || isPanic != tt.panic {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", tt.name, got, isPanic, tt.want, tt.panic)
+		}
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	os.WriteFile(path, []byte("previous run\nthis run\n"), 0644)
+	if got := TailFile(path, int64(len("previous run\n"))); got != "this run\n" {
+		t.Errorf("from offset: %q", got)
+	}
+	big := strings.Repeat("x", MaxOutput) + "end"
+	os.WriteFile(path, []byte(big), 0644)
+	if got := TailFile(path, 0); len(got) != MaxOutput || !strings.HasSuffix(got, "end") {
+		t.Errorf("tail of large file: %d bytes", len(got))
+	}
+}
@@ -11,11 +11,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 const (
@@ -800,7 +800,7 @@ func processAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	return syscall.Kill(pid, 0) == nil
+	return procctl.Alive(pid)
 }
 
 // --- process execution ---
@@ -889,7 +889,7 @@ func (m *Manager) startTask(id string) error {
 	cmd.Env = env
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = procctl.GroupAttr()
 
 	if err := cmd.Start(); err != nil {
 		_, _ = logFile.WriteString(fmt.Sprintf("[%s] failed to start: %v\n", time.Now().Format(time.RFC3339), err))
@@ -1118,15 +1118,15 @@ func stopProcessGroup(pid int) error {
 	if pid <= 0 {
 		return nil
 	}
-	pgid, err := syscall.Getpgid(pid)
+	pgid, err := procctl.GroupOf(pid)
 	target := pid
 	if err == nil {
 		target = pgid
 	}
 	// Graceful first (process group), then escalate quickly so timeout windows
 	// in tests (and production) actually free the PID within a second or two.
-	_ = syscall.Kill(-target, syscall.SIGTERM)
-	_ = syscall.Kill(pid, syscall.SIGTERM)
+	_ = procctl.TerminateGroup(target)
+	_ = procctl.Terminate(pid)
 	deadline := time.Now().Add(200 * time.Millisecond)
 	for time.Now().Before(deadline) {
 		if !processAlive(pid) {
@@ -1134,11 +1134,11 @@ func stopProcessGroup(pid int) error {
 		}
 		time.Sleep(20 * time.Millisecond)
 	}
-	_ = syscall.Kill(-target, syscall.SIGKILL)
-	_ = syscall.Kill(pid, syscall.SIGKILL)
+	_ = procctl.KillGroup(target)
+	_ = procctl.Kill(pid)
 	// Also SIGKILL the process group again in case children reparented slowly.
 	if target != pid {
-		_ = syscall.Kill(-target, syscall.SIGKILL)
+		_ = procctl.KillGroup(target)
 	}
 	deadline = time.Now().Add(2 * time.Second)
 	for time.Now().Before(deadline) {
@@ -1312,6 +1312,12 @@ func validateCronExpr(expr string) error {
 	return nil
 }
 
+// NextCron returns the first minute after from (UTC) matching the 5-field
+// cron expression; it is the parser the scheduler package shares.
+func NextCron(expr string, from time.Time) (time.Time, error) {
+	return nextCronUTC(expr, from)
+}
+
 // nextCronUTC returns the next time at or after `from` (UTC) matching the expr.
 // Supports: *, N, N-M, */step, N-M/step, lists of those. No names.
 func nextCronUTC(expr string, from time.Time) (time.Time, error) {
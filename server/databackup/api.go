@@ -0,0 +1,88 @@
+package databackup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PassphraseHeader carries the passphrase of POST /api/admin/restore, whose
+// body is the backup itself.
+const PassphraseHeader = "X-Backup-Passphrase"
+
+// maxRestoreSize bounds the uploaded backup.
+const maxRestoreSize = 512 << 20
+
+// RegisterAPI registers the backup endpoints (admin only):
+//
+//	POST /api/admin/backup {passphrase}  -> encrypted backup file
+//	POST /api/admin/restore  body: backup file, X-Backup-Passphrase header  -> {manifest, restart_required}
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/admin/backup", handleBackup)
+	mux.HandleFunc("/api/admin/restore", handleRestore)
+}
+
+// FileName is the suggested name of a backup made at t.
+func FileName(t time.Time) string {
+	return fmt.Sprintf("ai-critic-backup-%s.tar.gz.enc", t.Format("2006-01-02T15-04-05"))
+}
+
+func handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if err := checkPassphrase(req.Passphrase); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	// buffered, so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	m, err := Create(&buf, req.Passphrase)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", FileName(m.CreatedAt)))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+func handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m, err := Restore(http.MaxBytesReader(w, r.Body, maxRestoreSize), r.Header.Get(PassphraseHeader))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"manifest":         m,
+		"restart_required": true,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
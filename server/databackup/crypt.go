@@ -0,0 +1,96 @@
+package databackup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// An encrypted backup is magic | salt | nonce | AES-256-GCM ciphertext,
+// keyed by scrypt(passphrase, salt). The header is authenticated too.
+var magic = []byte("AICRITIC-BACKUP1")
+
+const (
+	saltSize = 16
+	keySize  = 32
+
+	// MinPassphraseLen is the shortest passphrase a backup is created with.
+	MinPassphraseLen = 8
+)
+
+// scrypt cost, replaced in tests.
+var scryptN = 1 << 15
+
+// ErrWrongPassphrase is returned by Restore when the backup does not
+// decrypt, either because of the passphrase or because it was modified.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted backup")
+
+func checkPassphrase(passphrase string) error {
+	if len(passphrase) < MinPassphraseLen {
+		return fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLen)
+	}
+	return nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header := append(append(append([]byte{}, magic...), salt...), nonce...)
+	return aead.Seal(header, nonce, plain, header), nil
+}
+
+func open(sealed []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, magic) {
+		return nil, fmt.Errorf("not an ai-critic backup")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+	rest := sealed[len(magic):]
+	if len(rest) < saltSize {
+		return nil, ErrWrongPassphrase
+	}
+	salt := rest[:saltSize]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(magic) + saltSize + aead.NonceSize()
+	if len(sealed) < headerLen {
+		return nil, ErrWrongPassphrase
+	}
+	header := sealed[:headerLen]
+	nonce := header[len(magic)+saltSize:]
+	plain, err := aead.Open(nil, nonce, sealed[headerLen:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
@@ -0,0 +1,372 @@
+// Package databackup backs up and restores the server's own state: the
+// data directory (settings, credentials, keys, domains, checkpoint metadata,
+// ...) plus the cloudflared tunnel credentials, so the server can be moved
+// to a new machine in one step.
+//
+// A backup is a gzip-compressed tar, encrypted with a key derived from a
+// passphrase. It is not tied to this server's encryption key pair, which is
+// itself part of the backup.
+package databackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+const manifestVersion = 1
+
+// Archive path prefixes. Data directory files keep their path relative to
+// the directory, so a backup restores into whatever AI_CRITIC_HOME is.
+const (
+	manifestName     = "manifest.json"
+	prefixData       = "data/"
+	prefixCloudflare = "cloudflared/"
+)
+
+// Replaced in tests.
+var (
+	dataDir        = config.DataDir
+	cloudflaredDir = func() string {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".cloudflared")
+		}
+		return ""
+	}
+)
+
+// excludedDirs are data directory subtrees that are runtime state, caches
+// or bulky content that can be rebuilt; they are not backed up.
+var excludedDirs = []string{
+	"procs",
+	"ai-cache",
+	"file-transfer",
+	"snapshots",
+	"workspaces",
+}
+
+// excludedFiles are data directory files that only make sense to the
+// process that wrote them.
+var excludedFiles = []string{
+	"restart-state.json",
+	"debug-trace.log",
+	config.ServerLogFile,
+}
+
+// Manifest describes a backup. It is the first archive entry.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Hostname  string    `json:"hostname,omitempty"`
+	// Files are the archive paths of the backed-up files.
+	Files []string `json:"files"`
+	Bytes int64    `json:"bytes"`
+}
+
+// included reports whether the data directory file at rel (slash-separated)
+// belongs in a backup.
+func included(rel string) bool {
+	for _, dir := range excludedDirs {
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return false
+		}
+	}
+	base := path.Base(rel)
+	for _, name := range excludedFiles {
+		if rel == name {
+			return false
+		}
+	}
+	if strings.HasSuffix(base, ".lock") || strings.HasSuffix(base, ".tmp") {
+		return false
+	}
+	// checkpoints keep only their metadata: projects/<p>/checkpoints/<c>/files/... holds the file contents
+	parts := strings.Split(rel, "/")
+	if len(parts) > 5 && parts[0] == "projects" && parts[2] == "checkpoints" && parts[4] == "files" {
+		return false
+	}
+	return true
+}
+
+// cloudflareFile reports whether a file in the cloudflared directory is a
+// tunnel credential or config worth backing up.
+func cloudflareFile(name string) bool {
+	return name == "cert.pem" || strings.HasSuffix(name, ".json") ||
+		strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")
+}
+
+// Create writes an encrypted backup to w.
+func Create(w io.Writer, passphrase string) (*Manifest, error) {
+	if err := checkPassphrase(passphrase); err != nil {
+		return nil, err
+	}
+	files, err := collect()
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	m := &Manifest{
+		Version:   manifestVersion,
+		CreatedAt: time.Now().UTC(),
+		Hostname:  host,
+	}
+	for _, f := range files {
+		m.Files = append(m.Files, f.name)
+		m.Bytes += f.size
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, 0600, m.CreatedAt, manifest); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f.src)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeEntry(tw, f.name, f.mode, f.modTime, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(buf.Bytes(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(sealed); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type sourceFile struct {
+	name    string // archive path
+	src     string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+}
+
+// collect lists the files to back up. Symlinks are skipped.
+func collect() ([]sourceFile, error) {
+	var files []sourceFile
+	err := filepath.WalkDir(dataDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dataDir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dataDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && !included(rel) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !included(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, sourceFile{prefixData + rel, p, info.Mode().Perm(), info.ModTime(), info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", dataDir, err)
+	}
+
+	cfDir := cloudflaredDir()
+	if cfDir == "" {
+		return files, nil
+	}
+	entries, err := os.ReadDir(cfDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !cloudflareFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, sourceFile{prefixCloudflare + e.Name(), filepath.Join(cfDir, e.Name()), info.Mode().Perm(), info.ModTime(), info.Size()})
+	}
+	return files, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, mode fs.FileMode, modTime time.Time, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(mode),
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Restore decrypts a backup and writes its files back, overwriting
+// existing ones; files not in the backup are left alone. Nothing is written
+// unless the whole backup decrypts and parses. A running server keeps its
+// in-memory state, so it must be restarted afterwards.
+func Restore(r io.Reader, passphrase string) (*Manifest, error) {
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(sealed, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	m, entries, err := readArchive(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	cfDir := cloudflaredDir()
+	for _, e := range entries {
+		var dst string
+		switch {
+		case strings.HasPrefix(e.name, prefixData):
+			dst = filepath.Join(dataDir, filepath.FromSlash(strings.TrimPrefix(e.name, prefixData)))
+		case strings.HasPrefix(e.name, prefixCloudflare):
+			if cfDir == "" {
+				return nil, fmt.Errorf("cannot restore %s: no home directory", e.name)
+			}
+			dst = filepath.Join(cfDir, strings.TrimPrefix(e.name, prefixCloudflare))
+		}
+		if err := writeFile(dst, e.data, e.mode); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+type entry struct {
+	name string
+	mode fs.FileMode
+	data []byte
+}
+
+// readArchive parses the decrypted tar.gz, rejecting entries that would
+// land outside the data or cloudflared directory.
+func readArchive(data []byte) (*Manifest, []entry, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	var m *Manifest
+	var entries []entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("unexpected entry %s in backup", hdr.Name)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if hdr.Name == manifestName {
+			m = &Manifest{}
+			if err := json.Unmarshal(body, m); err != nil {
+				return nil, nil, fmt.Errorf("parse manifest: %w", err)
+			}
+			if m.Version > manifestVersion {
+				return nil, nil, fmt.Errorf("backup version %d is newer than this server supports (%d)", m.Version, manifestVersion)
+			}
+			continue
+		}
+		if !validName(hdr.Name) {
+			return nil, nil, fmt.Errorf("invalid path %s in backup", hdr.Name)
+		}
+		entries = append(entries, entry{hdr.Name, fs.FileMode(hdr.Mode).Perm(), body})
+	}
+	if m == nil {
+		return nil, nil, fmt.Errorf("backup has no %s", manifestName)
+	}
+	return m, entries, nil
+}
+
+func validName(name string) bool {
+	var rel string
+	switch {
+	case strings.HasPrefix(name, prefixData):
+		rel = strings.TrimPrefix(name, prefixData)
+	case strings.HasPrefix(name, prefixCloudflare):
+		rel = strings.TrimPrefix(name, prefixCloudflare)
+		if strings.Contains(rel, "/") {
+			return false
+		}
+	default:
+		return false
+	}
+	return rel != "" && fs.ValidPath(rel)
+}
+
+// writeFile replaces dst through a temporary file, so a failed restore
+// never leaves a file half-written.
+func writeFile(dst string, data []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if mode == 0 {
+		mode = 0600
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	// WriteFile does not change the mode of an existing file
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package databackup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func useTempDirs(t *testing.T) (data, cf string) {
+	t.Helper()
+	data = filepath.Join(t.TempDir(), ".ai-critic")
+	cf = filepath.Join(t.TempDir(), ".cloudflared")
+	oldData, oldCF, oldN := dataDir, cloudflaredDir, scryptN
+	dataDir, cloudflaredDir, scryptN = data, func() string { return cf }, 1<<10
+	t.Cleanup(func() { dataDir, cloudflaredDir, scryptN = oldData, oldCF, oldN })
+	return data, cf
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateRestore(t *testing.T) {
+	data, cf := useTempDirs(t)
+	writeFiles(t, data, map[string]string{
+		"server-credentials":                          "secret",
+		"server-domains.json":                         `{"domains":[]}`,
+		"projects/p/checkpoints/0_cp/checkpoint.json": `{"id":0}`,
+		"projects/p/checkpoints/0_cp/files/main.go":   "package main",
+		"procs/opencode-web/lock":                     "",
+		"ai-cache/x":                                  "cached",
+		"restart-state.json":                          "{}",
+		"users.json.tmp":                              "",
+	})
+	writeFiles(t, cf, map[string]string{
+		"cert.pem":    "cert",
+		"abc.json":    "{}",
+		"config.yml":  "tunnel: abc",
+		"cloudflared": "binary",
+	})
+
+	var buf bytes.Buffer
+	m, err := Create(&buf, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"cloudflared/abc.json",
+		"cloudflared/cert.pem",
+		"cloudflared/config.yml",
+		"data/projects/p/checkpoints/0_cp/checkpoint.json",
+		"data/server-credentials",
+		"data/server-domains.json",
+	}
+	got := append([]string(nil), m.Files...)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %v, want %v", got, want)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Error("backup is not encrypted")
+	}
+	backup := buf.Bytes()
+
+	if _, err := Restore(bytes.NewReader(backup), "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Restore with wrong passphrase: %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	// restore onto a fresh machine
+	data, cf = useTempDirs(t)
+	if _, err := Restore(bytes.NewReader(backup), "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		filepath.Join(data, "server-credentials"):                          "secret",
+		filepath.Join(data, "projects/p/checkpoints/0_cp/checkpoint.json"): `{"id":0}`,
+		filepath.Join(cf, "config.yml"):                                    "tunnel: abc",
+	} {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(data, "server-credentials")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("restored credentials mode: %v, %v", info.Mode(), err)
+	}
+	if _, err := os.Stat(filepath.Join(data, "projects/p/checkpoints/0_cp/files/main.go")); !os.IsNotExist(err) {
+		t.Errorf("checkpoint contents restored: %v", err)
+	}
+}
+
+func TestCreateRejectsShortPassphrase(t *testing.T) {
+	useTempDirs(t)
+	if _, err := Create(&bytes.Buffer{}, "short"); err == nil {
+		t.Error("Create with a short passphrase succeeded")
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"data/users.json":          true,
+		"data/projects/p/x.json":   true,
+		"cloudflared/cert.pem":     true,
+		"data/../escape":           false,
+		"data//etc/passwd":         false,
+		"cloudflared/sub/cert.pem": false,
+		"other/file":               false,
+		"data/":                    false,
+	} {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
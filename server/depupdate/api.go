@@ -0,0 +1,113 @@
+package depupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/jobs"
+)
+
+// checkTimeout bounds GET /api/deps/outdated; both go list -u and npm
+// outdated query remote registries.
+const checkTimeout = 5 * time.Minute
+
+// RegisterAPI registers the dependency update endpoints:
+//
+//	GET  /api/deps/outdated?dir=...&indirect=true   -> Report
+//	POST /api/deps/apply  ApplyOptions              -> job
+//	POST /api/deps/verify {dir}                     -> job
+//
+// Apply and verify run as jobs (kind "deps-update"). With
+// Accept: text/event-stream the job is streamed as by jobs.ServeSSE;
+// otherwise the response is 202 {"status":"started","job_id":...}.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/deps/outdated", handleOutdated)
+	mux.HandleFunc("/api/deps/apply", handleApply)
+	mux.HandleFunc("/api/deps/verify", handleVerify)
+}
+
+func handleOutdated(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	report, err := Check(ctx, r.URL.Query().Get("dir"), CheckOptions{
+		Indirect: r.URL.Query().Get("indirect") == "true",
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var opts ApplyOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if _, err := validateDir(opts.Dir); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	job := jobs.Start(JobKind, fmt.Sprintf("Update dependencies (%s)", filepath.Base(opts.Dir)), func(ctx context.Context, j *jobs.Job) error {
+		return Apply(ctx, j, opts)
+	})
+	respondJob(w, r, job)
+}
+
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		Dir string `json:"dir"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	dir, err := validateDir(req.Dir)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	modules, err := FindModules(dir)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	job := jobs.Start(JobKind, fmt.Sprintf("Verify build and tests (%s)", filepath.Base(dir)), func(ctx context.Context, j *jobs.Job) error {
+		if !Verify(ctx, j, dir, modules) {
+			return fmt.Errorf("build or tests failed")
+		}
+		return nil
+	})
+	respondJob(w, r, job)
+}
+
+func respondJob(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	if r.Header.Get("Accept") == "text/event-stream" {
+		jobs.ServeSSE(w, r, job, 0)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "job_id": job.ID()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
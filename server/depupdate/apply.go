@@ -0,0 +1,283 @@
+package depupdate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/githooks"
+	"github.com/xhd2015/ai-critic/server/jobs"
+)
+
+// JobKind is the jobs kind of apply and verify runs.
+const JobKind = "deps-update"
+
+// Check steps and their statuses.
+const (
+	StepBuild = "build"
+	StepTest  = "test"
+
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// ApplyOptions is the JSON body for POST /api/deps/apply.
+type ApplyOptions struct {
+	Dir string `json:"dir"`
+	// Updates to apply; empty means the planned updates of a fresh Check.
+	Updates []Update `json:"updates,omitempty"`
+	// Branch to create; defaults to deps/update-<timestamp>.
+	Branch string `json:"branch,omitempty"`
+	// Agent only creates the branch and returns a prompt for an agent
+	// session to apply the plan; verify afterwards with /api/deps/verify.
+	Agent bool `json:"agent,omitempty"`
+	// Commit commits the changes when build and tests pass.
+	Commit     bool `json:"commit,omitempty"`
+	SkipVerify bool `json:"skip_verify,omitempty"`
+}
+
+// StepResult is the outcome of one build or test step.
+type StepResult struct {
+	Module  Module `json:"module"`
+	Step    string `json:"step"`
+	Command string `json:"command,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Apply is the body of an apply job: it creates the branch, installs the
+// updates, runs build and tests and optionally commits. Results are
+// reported through j.SetResult: branch, applied, build, test, steps (JSON
+// []StepResult), commit, and prompt in agent mode.
+func Apply(ctx context.Context, j *jobs.Job, opts ApplyOptions) error {
+	dir, err := validateDir(opts.Dir)
+	if err != nil {
+		return err
+	}
+	j.SetStage("checking")
+	if out, err := run(ctx, dir, "git", "status", "--porcelain"); err != nil {
+		return err
+	} else if len(strings.TrimSpace(string(out))) > 0 {
+		return fmt.Errorf("working tree has uncommitted changes; commit or stash them first")
+	}
+
+	updates := opts.Updates
+	if len(updates) == 0 {
+		report, err := Check(ctx, dir, CheckOptions{})
+		if err != nil {
+			return err
+		}
+		for _, w := range report.Warnings {
+			j.LogErrorf("%s", w)
+		}
+		for _, u := range report.Updates {
+			if u.Planned {
+				updates = append(updates, u)
+			}
+		}
+	}
+	if len(updates) == 0 {
+		j.SetResult("applied", "0")
+		j.SetResult("message", "All dependencies are up to date")
+		return nil
+	}
+
+	branch := opts.Branch
+	if branch == "" {
+		branch = "deps/update-" + time.Now().Format("20060102-150405")
+	}
+	j.SetStage("branching")
+	j.Logf("Creating branch %s", branch)
+	if _, err := j.RunCmd(ctx, command(ctx, dir, "git", "checkout", "-b", branch)); err != nil {
+		return fmt.Errorf("create branch %s: %v", branch, err)
+	}
+	j.SetResult("branch", branch)
+
+	if opts.Agent {
+		j.SetResult("prompt", AgentPrompt(updates))
+		j.SetResult("message", "Branch created; apply the plan with an agent, then verify")
+		return nil
+	}
+
+	j.SetStage("updating")
+	modules, err := install(ctx, j, dir, updates)
+	if err != nil {
+		return err
+	}
+	j.SetResult("applied", fmt.Sprint(len(updates)))
+
+	if !opts.SkipVerify {
+		if !Verify(ctx, j, dir, modules) {
+			return fmt.Errorf("build or tests failed on branch %s", branch)
+		}
+	}
+	if opts.Commit {
+		j.SetStage("committing")
+		if _, err := j.RunCmd(ctx, command(ctx, dir, "git", "add", "-A")); err != nil {
+			return err
+		}
+		commitArgs := append(githooks.CommitArgs(dir), "commit", "-m", commitMessage(updates))
+		if _, err := j.RunCmd(ctx, command(ctx, dir, "git", commitArgs...)); err != nil {
+			return fmt.Errorf("commit: %v", err)
+		}
+		if out, err := run(ctx, dir, "git", "rev-parse", "--short", "HEAD"); err == nil {
+			j.SetResult("commit", strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// install applies updates module by module and returns the modules touched.
+func install(ctx context.Context, j *jobs.Job, dir string, updates []Update) ([]Module, error) {
+	var modules []Module
+	byModule := make(map[Module][]Update)
+	for _, u := range updates {
+		m := Module{Ecosystem: u.Ecosystem, Dir: u.Dir}
+		if m.Dir == "" {
+			m.Dir = "."
+		}
+		if _, ok := byModule[m]; !ok {
+			modules = append(modules, m)
+		}
+		byModule[m] = append(byModule[m], u)
+	}
+	for _, m := range modules {
+		mdir := filepath.Join(dir, m.Dir)
+		var specs []string
+		for _, u := range byModule[m] {
+			if u.Name == "" || u.Target == "" {
+				return nil, fmt.Errorf("update of %q has no target version", u.Name)
+			}
+			specs = append(specs, u.Name+"@"+u.Target)
+		}
+		var cmds []*exec.Cmd
+		switch m.Ecosystem {
+		case EcosystemGo:
+			cmds = append(cmds,
+				command(ctx, mdir, "go", append([]string{"get"}, specs...)...),
+				command(ctx, mdir, "go", "mod", "tidy"))
+		case EcosystemNpm:
+			cmds = append(cmds, command(ctx, mdir, "npm", append([]string{"install"}, specs...)...))
+		default:
+			return nil, fmt.Errorf("unknown ecosystem: %s", m.Ecosystem)
+		}
+		for _, cmd := range cmds {
+			j.Logf("$ %s (in %s)", strings.Join(cmd.Args, " "), m.Dir)
+			if _, err := j.RunCmd(ctx, cmd); err != nil {
+				return nil, fmt.Errorf("%s: %v", strings.Join(cmd.Args[:2], " "), err)
+			}
+		}
+	}
+	return modules, nil
+}
+
+// Verify runs the build and test steps of each module, logging to j and
+// recording build, test and steps results. It reports whether nothing
+// failed.
+func Verify(ctx context.Context, j *jobs.Job, dir string, modules []Module) bool {
+	j.SetStage("verifying")
+	var results []StepResult
+	summary := map[string]string{StepBuild: StatusSkipped, StepTest: StatusSkipped}
+	for _, m := range modules {
+		mdir := filepath.Join(dir, m.Dir)
+		for _, step := range []string{StepBuild, StepTest} {
+			res := StepResult{Module: m, Step: step, Status: StatusSkipped}
+			if args := stepCommand(mdir, m.Ecosystem, step); args != nil {
+				res.Command = strings.Join(args, " ")
+				j.Logf("$ %s (in %s)", res.Command, m.Dir)
+				if _, err := j.RunCmd(ctx, command(ctx, mdir, args[0], args[1:]...)); err != nil {
+					res.Status = StatusFailed
+					res.Error = err.Error()
+					j.LogErrorf("%s %s failed: %v", m.Dir, step, err)
+				} else {
+					res.Status = StatusOK
+				}
+			}
+			if res.Status == StatusFailed || (res.Status == StatusOK && summary[step] == StatusSkipped) {
+				summary[step] = res.Status
+			}
+			results = append(results, res)
+		}
+	}
+	data, _ := json.Marshal(results)
+	j.SetResult("steps", string(data))
+	j.SetResult(StepBuild, summary[StepBuild])
+	j.SetResult(StepTest, summary[StepTest])
+	return summary[StepBuild] != StatusFailed && summary[StepTest] != StatusFailed
+}
+
+// stepCommand returns the command for a step, or nil when the module has
+// none (an npm package without the script).
+func stepCommand(dir string, ecosystem string, step string) []string {
+	switch ecosystem {
+	case EcosystemGo:
+		if step == StepBuild {
+			return []string{"go", "build", "./..."}
+		}
+		return []string{"go", "test", "./..."}
+	case EcosystemNpm:
+		scripts := npmScripts(dir)
+		script, ok := scripts[step]
+		if !ok || (step == StepTest && strings.Contains(script, "no test specified")) {
+			return nil
+		}
+		if step == StepTest {
+			return []string{"npm", "test"}
+		}
+		return []string{"npm", "run", step}
+	}
+	return nil
+}
+
+func npmScripts(dir string) map[string]string {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	json.Unmarshal(data, &pkg)
+	return pkg.Scripts
+}
+
+func command(ctx context.Context, dir string, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// AgentPrompt describes the plan as instructions for a coding agent.
+func AgentPrompt(updates []Update) string {
+	var b strings.Builder
+	b.WriteString("Update the following dependencies. After each module, fix any compile errors or API changes the update causes, then make sure the build and tests pass. Do not update anything else.\n\n")
+	writeUpdateList(&b, updates)
+	return b.String()
+}
+
+func commitMessage(updates []Update) string {
+	var b strings.Builder
+	if len(updates) == 1 {
+		fmt.Fprintf(&b, "Update %s to %s\n\n", updates[0].Name, updates[0].Target)
+	} else {
+		fmt.Fprintf(&b, "Update %d dependencies\n\n", len(updates))
+	}
+	writeUpdateList(&b, updates)
+	return b.String()
+}
+
+func writeUpdateList(b *strings.Builder, updates []Update) {
+	for _, u := range updates {
+		dir := u.Dir
+		if dir == "" {
+			dir = "."
+		}
+		fmt.Fprintf(b, "- %s %s (%s): %s -> %s\n", u.Ecosystem, u.Name, dir, u.Current, u.Target)
+	}
+}
@@ -0,0 +1,327 @@
+// Package depupdate finds outdated Go modules and npm packages in a project,
+// proposes an update plan, applies it on a fresh branch and verifies the
+// result with the project's build and tests.
+//
+// Go modules are checked with `go list -m -u`, npm packages with
+// `npm outdated`. Both are looked for in the project root and its immediate
+// subdirectories, so a Go server with a frontend next to it is covered.
+package depupdate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ecosystems.
+const (
+	EcosystemGo  = "go"
+	EcosystemNpm = "npm"
+)
+
+// Values of Update.Kind, from the current to the target version. A minor
+// bump of a v0 version counts as major since it may break callers.
+const (
+	KindPatch   = "patch"
+	KindMinor   = "minor"
+	KindMajor   = "major"
+	KindUnknown = "unknown"
+)
+
+// Module is a go.mod or package.json found in the project.
+type Module struct {
+	Ecosystem string `json:"ecosystem"`
+	// Dir is relative to the project dir; "." for the root.
+	Dir string `json:"dir"`
+}
+
+// Update is one outdated dependency.
+type Update struct {
+	Ecosystem string `json:"ecosystem"`
+	Dir       string `json:"dir"`
+	Name      string `json:"name"`
+	Current   string `json:"current"`
+	// Wanted is the newest version the package.json range allows (npm only).
+	Wanted string `json:"wanted,omitempty"`
+	Latest string `json:"latest"`
+	// Target is the version the plan would install and Kind its distance
+	// from Current.
+	Target   string `json:"target"`
+	Kind     string `json:"kind"`
+	Indirect bool   `json:"indirect,omitempty"`
+	// Planned is set for updates included in the default plan; Reason says
+	// why an update was left out.
+	Planned bool   `json:"planned"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Report is the result of Check.
+type Report struct {
+	Dir      string   `json:"dir"`
+	Modules  []Module `json:"modules"`
+	Updates  []Update `json:"updates"`
+	Planned  int      `json:"planned"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CheckOptions controls Check.
+type CheckOptions struct {
+	// Indirect includes indirect Go dependencies; they are never planned.
+	Indirect bool
+}
+
+// Check lists the outdated dependencies of every module in dir. A module
+// whose check fails is reported as a warning rather than failing the report.
+func Check(ctx context.Context, dir string, opts CheckOptions) (*Report, error) {
+	dir, err := validateDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	modules, err := FindModules(dir)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Dir: dir, Modules: modules, Updates: []Update{}}
+	for _, m := range modules {
+		var updates []Update
+		var err error
+		switch m.Ecosystem {
+		case EcosystemGo:
+			updates, err = checkGo(ctx, filepath.Join(dir, m.Dir), opts.Indirect)
+		case EcosystemNpm:
+			updates, err = checkNpm(ctx, filepath.Join(dir, m.Dir))
+		}
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %s: %v", m.Ecosystem, m.Dir, err))
+			continue
+		}
+		for _, u := range updates {
+			u.Dir = m.Dir
+			plan(&u)
+			if u.Planned {
+				report.Planned++
+			}
+			report.Updates = append(report.Updates, u)
+		}
+	}
+	return report, nil
+}
+
+func validateDir(dir string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		return "", fmt.Errorf("dir is required")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid dir: %w", err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("cannot access dir: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("dir is not a directory: %s", abs)
+	}
+	return abs, nil
+}
+
+// FindModules returns the go.mod and package.json files in dir and its
+// immediate subdirectories.
+func FindModules(dir string) ([]Module, error) {
+	var modules []Module
+	add := func(rel string) {
+		for _, c := range []struct{ file, eco string }{{"go.mod", EcosystemGo}, {"package.json", EcosystemNpm}} {
+			if _, err := os.Stat(filepath.Join(dir, rel, c.file)); err == nil {
+				modules = append(modules, Module{Ecosystem: c.eco, Dir: rel})
+			}
+		}
+	}
+	add(".")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+			continue
+		}
+		add(name)
+	}
+	return modules, nil
+}
+
+// goModule is the subset of `go list -m -json` output used here.
+type goModule struct {
+	Path     string
+	Version  string
+	Main     bool
+	Indirect bool
+	Update   *struct{ Version string }
+}
+
+func checkGo(ctx context.Context, dir string, indirect bool) ([]Update, error) {
+	out, err := run(ctx, dir, "go", "list", "-m", "-u", "-json", "all")
+	if err != nil {
+		return nil, err
+	}
+	return parseGoList(out, indirect)
+}
+
+// parseGoList parses the concatenated JSON objects of `go list -m -u -json`.
+func parseGoList(out []byte, indirect bool) ([]Update, error) {
+	var updates []Update
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var m goModule
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("parse go list output: %w", err)
+		}
+		if m.Main || m.Update == nil || (m.Indirect && !indirect) {
+			continue
+		}
+		updates = append(updates, Update{
+			Ecosystem: EcosystemGo,
+			Name:      m.Path,
+			Current:   m.Version,
+			Latest:    m.Update.Version,
+			Target:    m.Update.Version,
+			Indirect:  m.Indirect,
+		})
+	}
+	return updates, nil
+}
+
+// npmOutdated is one entry of `npm outdated --json`.
+type npmOutdated struct {
+	Current string `json:"current"`
+	Wanted  string `json:"wanted"`
+	Latest  string `json:"latest"`
+}
+
+func checkNpm(ctx context.Context, dir string) ([]Update, error) {
+	// npm outdated exits 1 when anything is outdated.
+	out, err := run(ctx, dir, "npm", "outdated", "--json")
+	if err != nil && len(bytes.TrimSpace(out)) == 0 {
+		return nil, err
+	}
+	return parseNpmOutdated(out)
+}
+
+func parseNpmOutdated(out []byte) ([]Update, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var entries map[string]npmOutdated
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return nil, fmt.Errorf("parse npm outdated output: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var updates []Update
+	for _, name := range names {
+		e := entries[name]
+		u := Update{
+			Ecosystem: EcosystemNpm,
+			Name:      name,
+			Current:   e.Current,
+			Wanted:    e.Wanted,
+			Latest:    e.Latest,
+			Target:    e.Latest,
+		}
+		// Prefer the newest version within the same major line.
+		if classify(e.Current, e.Latest) == KindMajor && e.Wanted != "" {
+			u.Target = e.Wanted
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// plan classifies u and decides whether the default plan includes it.
+func plan(u *Update) {
+	u.Kind = classify(u.Current, u.Target)
+	switch {
+	case u.Current == "":
+		u.Reason = "not installed"
+	case u.Target == "" || u.Target == u.Current:
+		u.Reason = fmt.Sprintf("latest %s is a major update; review it manually", u.Latest)
+	case u.Indirect:
+		u.Reason = "indirect dependency"
+	case u.Kind == KindMajor:
+		u.Reason = "major update; review it manually"
+	case u.Kind == KindUnknown:
+		u.Reason = "version is not semver"
+	default:
+		u.Planned = true
+	}
+}
+
+// classify reports the semver distance between two versions.
+func classify(from, to string) string {
+	a, ok1 := parseSemver(from)
+	b, ok2 := parseSemver(to)
+	if !ok1 || !ok2 {
+		return KindUnknown
+	}
+	switch {
+	case a[0] != b[0]:
+		return KindMajor
+	case a[1] != b[1]:
+		if a[0] == 0 {
+			return KindMajor
+		}
+		return KindMinor
+	default:
+		return KindPatch
+	}
+}
+
+// parseSemver parses "v1.2.3" or "1.2.3-rc.1+meta" into major, minor, patch.
+func parseSemver(v string) ([3]int, bool) {
+	var n [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return n, false
+	}
+	for i, p := range parts {
+		x, err := strconv.Atoi(p)
+		if err != nil {
+			return n, false
+		}
+		n[i] = x
+	}
+	return n, true
+}
+
+// run runs a command in dir and returns its stdout; stderr is folded into
+// the error.
+func run(ctx context.Context, dir string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s %s: %v: %s", name, args[0], err, msg)
+		}
+		return out, fmt.Errorf("%s %s: %v", name, args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package depupdate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct{ from, to, want string }{
+		{"v1.2.3", "v1.2.4", KindPatch},
+		{"v1.2.3", "v1.3.0", KindMinor},
+		{"v1.2.3", "v2.0.0", KindMajor},
+		{"v0.3.1", "v0.4.0", KindMajor},
+		{"1.0.0", "1.0.1-rc.1", KindPatch},
+		{"v0.0.0-20240101000000-abcdef", "v0.0.0-20240201000000-123456", KindPatch},
+		{"latest", "1.0.0", KindUnknown},
+	}
+	for _, c := range cases {
+		if got := classify(c.from, c.to); got != c.want {
+			t.Errorf("classify(%q, %q) = %q, want %q", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestParseGoList(t *testing.T) {
+	out := `{"Path":"example.com/app","Main":true}
+{"Path":"github.com/a/b","Version":"v1.2.0","Update":{"Version":"v1.3.0"}}
+{"Path":"github.com/c/d","Version":"v1.0.0"}
+{"Path":"github.com/e/f","Version":"v0.1.0","Indirect":true,"Update":{"Version":"v0.1.1"}}
+`
+	updates, err := parseGoList([]byte(out), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].Name != "github.com/a/b" || updates[0].Target != "v1.3.0" {
+		t.Fatalf("updates = %+v", updates)
+	}
+	updates, _ = parseGoList([]byte(out), true)
+	if len(updates) != 2 || !updates[1].Indirect {
+		t.Fatalf("with indirect: %+v", updates)
+	}
+	plan(&updates[1])
+	if updates[1].Planned {
+		t.Errorf("indirect update must not be planned")
+	}
+}
+
+func TestParseNpmOutdated(t *testing.T) {
+	out := `{
+  "react": {"current": "18.2.0", "wanted": "18.3.1", "latest": "19.0.0"},
+  "vite": {"current": "5.4.0", "wanted": "5.4.0", "latest": "6.0.1"},
+  "zod": {"current": "3.22.0", "wanted": "3.23.8", "latest": "3.23.8"}
+}`
+	updates, err := parseNpmOutdated([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range updates {
+		plan(&updates[i])
+	}
+	got := map[string]Update{}
+	for _, u := range updates {
+		got[u.Name] = u
+	}
+	if u := got["react"]; u.Target != "18.3.1" || u.Kind != KindMinor || !u.Planned {
+		t.Errorf("react = %+v", u)
+	}
+	if u := got["vite"]; u.Planned || !strings.Contains(u.Reason, "major") {
+		t.Errorf("vite = %+v", u)
+	}
+	if u := got["zod"]; u.Target != "3.23.8" || !u.Planned {
+		t.Errorf("zod = %+v", u)
+	}
+}
+
+func TestFindModules(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+	os.MkdirAll(filepath.Join(dir, "web"), 0755)
+	os.WriteFile(filepath.Join(dir, "web", "package.json"), []byte("{}"), 0644)
+	os.MkdirAll(filepath.Join(dir, "node_modules", "y"), 0755)
+	os.WriteFile(filepath.Join(dir, "node_modules", "package.json"), []byte("{}"), 0644)
+
+	modules, err := FindModules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Module{{EcosystemGo, "."}, {EcosystemNpm, "web"}}
+	if len(modules) != len(want) || modules[0] != want[0] || modules[1] != want[1] {
+		t.Errorf("modules = %+v, want %+v", modules, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Package diagnostics exposes runtime diagnostics for catching goroutine
+// leaks and blocked handlers on a live server: the standard pprof
+// endpoints under /debug/pprof/, and GET /api/debug/goroutines, a
+// goroutine dump with identical stacks grouped together. Both are admin
+// only, enforced by auth.Middleware.
+package diagnostics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RegisterAPI registers the diagnostics endpoints.
+//
+//	GET /debug/pprof/...          the net/http/pprof handlers
+//	GET /api/debug/goroutines     -> {total, groups}
+//	GET /api/debug/goroutines?raw=1  the full text dump
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/api/debug/goroutines", handleGoroutines)
+}
+
+// Group is a set of goroutines with the same stack.
+type Group struct {
+	Count int `json:"count"`
+	// States counts the goroutines per scheduler state, e.g. "chan receive".
+	States map[string]int `json:"states"`
+	// WaitMinutes is the longest time one of them has been blocked, as
+	// reported by the runtime (only for waits of a minute or more).
+	WaitMinutes int `json:"waitMinutes,omitempty"`
+	// Stack is the shared stack, with argument values elided.
+	Stack string `json:"stack"`
+}
+
+// Dump is a grouped goroutine dump.
+type Dump struct {
+	Total  int     `json:"total"`
+	Groups []Group `json:"groups"` // largest first
+}
+
+func handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var buf bytes.Buffer
+	runtimepprof.Lookup("goroutine").WriteTo(&buf, 2)
+	if r.URL.Query().Get("raw") != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Parse(buf.String()))
+}
+
+var (
+	// goroutine 42 [chan receive, 12 minutes]:
+	headerRe = regexp.MustCompile(`^goroutine \d+ \[([^,\]]+)(?:, (\d+) minutes)?[^\]]*\]:$`)
+	// argument values and goroutine IDs differ between otherwise equal stacks
+	argsRe    = regexp.MustCompile(`\((0x[0-9a-f]+|\.\.\.|, )*\)$`)
+	creatorRe = regexp.MustCompile(` in goroutine \d+$`)
+)
+
+// Parse groups a goroutine dump in the format of the goroutine profile at
+// debug level 2 (runtime.Stack with all goroutines).
+func Parse(dump string) Dump {
+	var d Dump
+	byStack := make(map[string]*Group)
+	for _, block := range strings.Split(strings.TrimSpace(dump), "\n\n") {
+		header, stack, _ := strings.Cut(block, "\n")
+		m := headerRe.FindStringSubmatch(header)
+		if m == nil {
+			continue
+		}
+		lines := strings.Split(stack, "\n")
+		for i, l := range lines {
+			l = argsRe.ReplaceAllString(l, "(...)")
+			lines[i] = creatorRe.ReplaceAllString(l, "")
+		}
+		stack = strings.Join(lines, "\n")
+
+		g := byStack[stack]
+		if g == nil {
+			g = &Group{States: make(map[string]int), Stack: stack}
+			byStack[stack] = g
+		}
+		g.Count++
+		g.States[m[1]]++
+		if wait, _ := strconv.Atoi(m[2]); wait > g.WaitMinutes {
+			g.WaitMinutes = wait
+		}
+		d.Total++
+	}
+	d.Groups = make([]Group, 0, len(byStack))
+	for _, g := range byStack {
+		d.Groups = append(d.Groups, *g)
+	}
+	sort.Slice(d.Groups, func(i, j int) bool {
+		if d.Groups[i].Count != d.Groups[j].Count {
+			return d.Groups[i].Count > d.Groups[j].Count
+		}
+		return d.Groups[i].Stack < d.Groups[j].Stack
+	})
+	return d
+}
@@ -0,0 +1,75 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const sampleDump = `goroutine 1 [running]:
+main.main()
+	/src/main.go:10 +0x1d
+
+goroutine 7 [chan receive, 12 minutes]:
+example.com/app.worker(0xc000012345, 0x2)
+	/src/worker.go:20 +0x45
+created by example.com/app.start in goroutine 1
+	/src/worker.go:10 +0x65
+
+goroutine 8 [chan receive]:
+example.com/app.worker(0xc000099999, 0x3)
+	/src/worker.go:20 +0x45
+created by example.com/app.start in goroutine 1
+	/src/worker.go:10 +0x65
+
+goroutine 9 [select, 3 minutes, locked to thread]:
+example.com/app.worker(...)
+	/src/worker.go:20 +0x45
+created by example.com/app.start in goroutine 2
+	/src/worker.go:10 +0x65
+`
+
+func TestParse(t *testing.T) {
+	d := Parse(sampleDump)
+	if d.Total != 4 || len(d.Groups) != 2 {
+		t.Fatalf("dump %+v", d)
+	}
+	g := d.Groups[0]
+	if g.Count != 3 || g.States["chan receive"] != 2 || g.States["select"] != 1 || g.WaitMinutes != 12 {
+		t.Errorf("group %+v", g)
+	}
+	if !strings.HasPrefix(g.Stack, "example.com/app.worker(...)\n") || strings.Contains(g.Stack, "in goroutine") {
+		t.Errorf("stack %q", g.Stack)
+	}
+	if d.Groups[1].Count != 1 || d.Groups[1].States["running"] != 1 {
+		t.Errorf("group %+v", d.Groups[1])
+	}
+}
+
+func TestGoroutinesEndpoint(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 3; i++ {
+		go func() { <-block }()
+	}
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/debug/goroutines", nil))
+	var d Dump
+	if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, g := range d.Groups {
+		if g.Count >= 3 && strings.Contains(g.Stack, "TestGoroutinesEndpoint") {
+			found = true
+		}
+	}
+	if d.Total < 4 || !found {
+		t.Errorf("blocked goroutines not grouped: %+v", d)
+	}
+}
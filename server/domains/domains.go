@@ -354,15 +354,12 @@ func handleTunnelStart(w http.ResponseWriter, r *http.Request) {
 		sw.SendLog(message)
 	}
 
-	status, err := cloudflareSettings.StartDomainTunnel(req.Domain, port, tunnelName, logFn)
+	status, err := startTunnel(req.Domain, port, tunnelName, logFn)
 	if err != nil {
 		sw.SendError(fmt.Sprintf("Failed to start tunnel: %v", err))
 		return
 	}
 
-	// Start health check for manually started tunnels too
-	startDomainHealthCheck(req.Domain, port, tunnelName)
-
 	sw.SendDone(map[string]string{
 		"message":    "Tunnel started successfully",
 		"status":     status.Status,
@@ -370,6 +367,41 @@ func handleTunnelStart(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// startTunnel starts the tunnel of a domain together with its health check.
+func startTunnel(domain string, port int, tunnelName string, logFn cloudflareSettings.LogFunc) (*cloudflareSettings.DomainTunnelStatus, error) {
+	status, err := cloudflareSettings.StartDomainTunnel(domain, port, tunnelName, logFn)
+	if err != nil {
+		return nil, err
+	}
+	// Start health check for manually started tunnels too
+	startDomainHealthCheck(domain, port, tunnelName)
+	return status, nil
+}
+
+// StartTunnel starts the Cloudflare tunnel of a configured domain on the
+// running server, e.g. right after the setup wizard added it.
+func StartTunnel(domain string, logFn cloudflareSettings.LogFunc) (*cloudflareSettings.DomainTunnelStatus, error) {
+	cfg, err := LoadDomains()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load domains: %v", err)
+	}
+	found := false
+	for _, d := range cfg.Domains {
+		if d.Domain == domain && d.Provider == ProviderCloudflare {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cloudflare domain %s not found in config", domain)
+	}
+	port := getServerPort()
+	if port == 0 {
+		return nil, fmt.Errorf("server port not configured")
+	}
+	return startTunnel(domain, port, cfg.TunnelName, logFn)
+}
+
 func handleTunnelStop(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -0,0 +1,138 @@
+package editor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+// companionKeepAlive is how often an idle companion stream gets a ping, so
+// proxies and tunnels do not drop it.
+const companionKeepAlive = 30 * time.Second
+
+// RegisterAPI registers the editor endpoints:
+//
+//	GET  /api/editor/link?dir=...&path=...&line=N&col=N   deep links for each editor
+//	POST /api/editor/open {dir, path, line, col, editor, companion}   relay to companions
+//	GET  /api/editor/companions                             connected companions
+//	GET  /api/editor/companion?name=...                     SSE stream a companion listens on
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/editor/link", handleLink)
+	mux.HandleFunc("/api/editor/open", handleOpen)
+	mux.HandleFunc("/api/editor/companions", handleCompanions)
+	mux.HandleFunc("/api/editor/companion", handleCompanionStream)
+}
+
+func handleLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	abs, err := ResolvePath(q.Get("dir"), q.Get("path"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	line, _ := strconv.Atoi(q.Get("line"))
+	col, _ := strconv.Atoi(q.Get("col"))
+	links := make(map[string]string, len(Editors))
+	for _, e := range Editors {
+		link, err := Link(e, abs, line, col)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		links[e] = link
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"path": abs, "links": links})
+}
+
+func handleOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		OpenRequest
+		// Companion targets one companion by name or ID; empty means all.
+		Companion string `json:"companion"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if _, err := ResolvePath(req.Dir, req.Path); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Editor != "" && !IsSupported(req.Editor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported editor: " + req.Editor})
+		return
+	}
+	n := defaultHub.send(req.Companion, req.OpenRequest)
+	if n == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no companion connected; run 'remote-agent editor companion' on your desktop"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"delivered": n})
+}
+
+func handleCompanions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"companions": defaultHub.list()})
+}
+
+// handleCompanionStream holds an SSE stream open for a companion, sending a
+// {"type":"hello"} event, then {"type":"open",...} events and periodic pings.
+func handleCompanionStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "companion"
+	}
+	id, ch := defaultHub.connect(Companion{Name: name, User: auth.UserName(r), Remote: r.RemoteAddr})
+	defer defaultHub.disconnect(id)
+
+	sw.Send(map[string]string{"type": "hello", "id": id})
+	ticker := time.NewTicker(companionKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			sw.Send(map[string]string{"type": "ping"})
+		case req := <-ch:
+			sw.Send(map[string]interface{}{
+				"type":   "open",
+				"dir":    req.Dir,
+				"path":   req.Path,
+				"line":   req.Line,
+				"col":    req.Col,
+				"editor": req.Editor,
+			})
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,155 @@
+// Package editor bridges review on the phone with fixes on the desktop: it
+// builds deep links that open a file at a line in a local editor, and relays
+// "open this" requests to companions — remote-agent processes running on a
+// desktop that launch the editor there.
+package editor
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Editors supported for deep links and companion launches.
+const (
+	EditorVSCode = "vscode"
+	EditorCursor = "cursor"
+	EditorZed    = "zed"
+)
+
+// Editors lists the supported editors in display order.
+var Editors = []string{EditorVSCode, EditorCursor, EditorZed}
+
+// IsSupported reports whether editor is one of Editors.
+func IsSupported(editor string) bool {
+	for _, e := range Editors {
+		if e == editor {
+			return true
+		}
+	}
+	return false
+}
+
+// Link returns the deep link opening absPath at line and col (1-based; 0
+// omits them) in editor. All supported editors use the
+// <scheme>://file/<path>:<line>:<col> form.
+func Link(editor, absPath string, line, col int) (string, error) {
+	if !IsSupported(editor) {
+		return "", fmt.Errorf("unsupported editor: %q", editor)
+	}
+	if !filepath.IsAbs(absPath) {
+		return "", fmt.Errorf("path must be absolute: %s", absPath)
+	}
+	p := filepath.ToSlash(absPath)
+	if line > 0 {
+		p += fmt.Sprintf(":%d", line)
+		if col > 0 {
+			p += fmt.Sprintf(":%d", col)
+		}
+	}
+	u := url.URL{Scheme: editor, Host: "file", Path: p}
+	return u.String(), nil
+}
+
+// ResolvePath joins a project-relative path onto dir, rejecting paths that
+// escape it.
+func ResolvePath(dir, rel string) (string, error) {
+	if dir == "" || rel == "" {
+		return "", fmt.Errorf("dir and path are required")
+	}
+	abs := filepath.Join(dir, rel)
+	if filepath.IsAbs(rel) {
+		abs = filepath.Clean(rel)
+	}
+	if abs != filepath.Clean(dir) && !strings.HasPrefix(abs, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside %s", rel, dir)
+	}
+	return abs, nil
+}
+
+// OpenRequest asks companions to open a file. Dir is the project directory
+// on the server; companions map it to their local checkout.
+type OpenRequest struct {
+	Dir    string `json:"dir"`
+	Path   string `json:"path"` // relative to Dir
+	Line   int    `json:"line,omitempty"`
+	Col    int    `json:"col,omitempty"`
+	Editor string `json:"editor,omitempty"` // empty: the companion's default
+}
+
+// Companion is a connected companion.
+type Companion struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	User        string `json:"user,omitempty"`
+	Remote      string `json:"remote,omitempty"`
+	ConnectedAt string `json:"connected_at"`
+}
+
+type companionConn struct {
+	info Companion
+	ch   chan OpenRequest
+}
+
+// hub tracks connected companions and fans open requests out to them.
+type hub struct {
+	mu         sync.Mutex
+	nextID     int
+	companions map[string]*companionConn
+}
+
+var defaultHub = &hub{companions: make(map[string]*companionConn)}
+
+// connect registers a companion; the caller must call disconnect with the
+// returned ID when its stream ends.
+func (h *hub) connect(info Companion) (string, <-chan OpenRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	info.ID = fmt.Sprintf("companion-%d", h.nextID)
+	info.ConnectedAt = time.Now().UTC().Format(time.RFC3339)
+	c := &companionConn{info: info, ch: make(chan OpenRequest, 8)}
+	h.companions[info.ID] = c
+	return info.ID, c.ch
+}
+
+func (h *hub) disconnect(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.companions, id)
+}
+
+// send delivers req to the companion named target, or to all companions
+// when target is empty. It returns the number reached; companions whose
+// queue is full are skipped.
+func (h *hub) send(target string, req OpenRequest) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, c := range h.companions {
+		if target != "" && c.info.Name != target && c.info.ID != target {
+			continue
+		}
+		select {
+		case c.ch <- req:
+			n++
+		default:
+		}
+	}
+	return n
+}
+
+func (h *hub) list() []Companion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]Companion, 0, len(h.companions))
+	for _, c := range h.companions {
+		result = append(result, c.info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ConnectedAt < result[j].ConnectedAt })
+	return result
+}
@@ -0,0 +1,78 @@
+package editor
+
+import "testing"
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		editor  string
+		path    string
+		line    int
+		col     int
+		want    string
+		wantErr bool
+	}{
+		{name: "vscode line", editor: EditorVSCode, path: "/repo/main.go", line: 12, want: "vscode://file/repo/main.go:12"},
+		{name: "cursor line col", editor: EditorCursor, path: "/repo/main.go", line: 12, col: 3, want: "cursor://file/repo/main.go:12:3"},
+		{name: "zed no line", editor: EditorZed, path: "/repo/a b.go", want: "zed://file/repo/a%20b.go"},
+		{name: "col without line ignored", editor: EditorVSCode, path: "/repo/x.go", col: 4, want: "vscode://file/repo/x.go"},
+		{name: "unsupported", editor: "vim", path: "/repo/x.go", wantErr: true},
+		{name: "relative", editor: EditorVSCode, path: "x.go", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Link(tt.editor, tt.path, tt.line, tt.col)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Link() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{rel: "src/main.go", want: "/repo/src/main.go"},
+		{rel: "/repo/src/main.go", want: "/repo/src/main.go"},
+		{rel: "../etc/passwd", wantErr: true},
+		{rel: "/etc/passwd", wantErr: true},
+		{rel: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ResolvePath("/repo", tt.rel)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, %v; want %q, wantErr %v", tt.rel, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHubSend(t *testing.T) {
+	h := &hub{companions: make(map[string]*companionConn)}
+	if n := h.send("", OpenRequest{Dir: "/repo", Path: "a.go"}); n != 0 {
+		t.Fatalf("send with no companions delivered to %d", n)
+	}
+	laptopID, laptop := h.connect(Companion{Name: "laptop"})
+	_, desktop := h.connect(Companion{Name: "desktop"})
+
+	if n := h.send("laptop", OpenRequest{Dir: "/repo", Path: "a.go", Line: 3}); n != 1 {
+		t.Fatalf("targeted send delivered to %d, want 1", n)
+	}
+	if req := <-laptop; req.Path != "a.go" || req.Line != 3 {
+		t.Errorf("laptop got %+v", req)
+	}
+	if n := h.send("", OpenRequest{Dir: "/repo", Path: "b.go"}); n != 2 {
+		t.Fatalf("broadcast delivered to %d, want 2", n)
+	}
+	<-desktop
+
+	h.disconnect(laptopID)
+	if got := h.list(); len(got) != 1 || got[0].Name != "desktop" {
+		t.Errorf("list() = %+v", got)
+	}
+}
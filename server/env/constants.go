@@ -10,6 +10,15 @@ const (
 	EnvQuickTestPort         = "QUICK_TEST_PORT"
 	EnvDebugPreferSandbox    = "DEBUG_QUICK_TEST_PREFER_SANDBOX"
 	EnvNoOpenBrowser         = "AI_CRITIC_NO_OPEN_BROWSER"
+	// EnvArtifactsDir tells an agent session where to put output files
+	// that should be kept as artifacts of its task.
+	EnvArtifactsDir = "AI_CRITIC_ARTIFACTS_DIR"
+	// EnvListenFD passes the listening socket to the server exec'd in
+	// place of this one, so no connection is refused during a restart.
+	EnvListenFD = "AI_CRITIC_LISTEN_FD"
+	// EnvBackupPassphrase supplies the passphrase of 'ai-critic backup'
+	// and 'ai-critic restore' without a prompt, e.g. in scripts.
+	EnvBackupPassphrase = "AI_CRITIC_BACKUP_PASSPHRASE"
 
 	QuickTestPortUnset = "UNSET"
 )
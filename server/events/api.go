@@ -0,0 +1,128 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+// keepalive is how often an idle stream sends a comment, so proxies and
+// tunnels do not close it.
+const keepalive = 30 * time.Second
+
+// RegisterAPI registers the event stream:
+//
+//	GET /api/events?topics=ports,activity[&since=<id>] -> SSE of Event
+//
+// Each SSE message carries the event's resume ID; a reconnecting
+// EventSource sends it back as Last-Event-ID, or clients pass it as since,
+// and missed events are replayed before new ones.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/events", handleEvents)
+}
+
+// Topics returns the topics id may follow.
+func Topics(id *auth.Identity) []string {
+	var list []string
+	for t, a := range topicAccess {
+		if allowed(id, a) {
+			list = append(list, t)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func allowed(id *auth.Identity, a Access) bool {
+	// nil when auth is off: the local user owns the server
+	if id == nil || id.Role == auth.RoleAdmin {
+		return true
+	}
+	switch a {
+	case AccessAll:
+		return true
+	case AccessInstance:
+		return id.Role != auth.RoleMember
+	}
+	return false
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := auth.FromContext(r.Context())
+	var topics []string
+	for _, t := range strings.Split(r.URL.Query().Get("topics"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		a, ok := topicAccess[t]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown topic %q, known topics: %s", t, strings.Join(Topics(nil), ", ")), http.StatusBadRequest)
+			return
+		}
+		if !allowed(id, a) {
+			http.Error(w, fmt.Sprintf("topic %q is not available to you", t), http.StatusForbidden)
+			return
+		}
+		topics = append(topics, t)
+	}
+	if len(topics) == 0 {
+		http.Error(w, "topics is required", http.StatusBadRequest)
+		return
+	}
+	since := r.URL.Query().Get("since")
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		since = last
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	replay, ch, cancel := defaultBus.Subscribe(topics, since)
+	defer cancel()
+	for _, e := range replay {
+		writeEvent(w, defaultBus.ID(e), e)
+	}
+	// tells the client the stream is open even if nothing is published
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				// fell behind: the client reconnects and resumes
+				return
+			}
+			writeEvent(w, defaultBus.ID(e), e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, id string, e Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, data)
+}
@@ -0,0 +1,193 @@
+// Package events is the server's event bus. Features publish typed events
+// to topics; clients follow any set of topics over a single SSE stream
+// (GET /api/events) instead of opening one connection per feature, and
+// resume from the last event they saw after a reconnect.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topics. Each has an access level, see topicAccess.
+const (
+	// TopicActivity carries every activity.Event as it is recorded; the
+	// event type is the activity kind.
+	TopicActivity = "activity"
+	// TopicPorts carries the full port forward list after every change.
+	TopicPorts = "ports"
+	// TopicExecApprovals carries execpolicy approval events.
+	TopicExecApprovals = "exec-approvals"
+	// TopicNotifications carries every notifications.Notification; the
+	// event type is the notification's event type.
+	TopicNotifications = "notifications"
+
+	// TopicEvents is the bus's own topic, delivered to every stream. Its
+	// only event, TypeReset, tells the client that events it asked to
+	// resume from are gone and it must refetch the state it follows.
+	TopicEvents = "events"
+	TypeReset   = "reset"
+)
+
+// Access says who may follow a topic.
+type Access int
+
+const (
+	// AccessAll lets every authenticated user follow the topic.
+	AccessAll Access = iota
+	// AccessInstance is for instance-wide state: admins and reviewers,
+	// not members.
+	AccessInstance
+	// AccessAdmin is for admins only.
+	AccessAdmin
+)
+
+var topicAccess = map[string]Access{
+	TopicActivity:      AccessInstance,
+	TopicPorts:         AccessAll,
+	TopicExecApprovals: AccessAdmin,
+	TopicNotifications: AccessInstance,
+}
+
+const (
+	// historySize is how many events are kept for resuming streams.
+	historySize = 1000
+	// subscriberBuffer is how many events a stream may lag behind before
+	// it is closed; the client then resumes from its last event.
+	subscriberBuffer = 256
+)
+
+// Event is one published event.
+type Event struct {
+	Seq   uint64 `json:"seq"`
+	Topic string `json:"topic"`
+	Type  string `json:"type"`
+	Time  string `json:"time"` // RFC3339
+	Data  any    `json:"data,omitempty"`
+}
+
+// Bus keeps recent events and fans new ones out to subscribers.
+type Bus struct {
+	// epoch tells apart the sequence numbers of different server runs, so
+	// a client resuming across a restart is told to reset.
+	epoch   string
+	mu      sync.Mutex
+	seq     uint64
+	history []Event // oldest first
+	subs    map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	topics map[string]bool
+	ch     chan Event
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:  make(map[*subscriber]struct{}),
+	}
+}
+
+var defaultBus = NewBus()
+
+// Publish publishes an event on the default bus.
+func Publish(topic, typ string, data any) {
+	defaultBus.Publish(topic, typ, data)
+}
+
+// Publish records an event and sends it to the subscribers of its topic.
+// It never blocks: a subscriber that cannot keep up is dropped and its
+// stream closed.
+func (b *Bus) Publish(topic, typ string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e := Event{
+		Seq:   b.seq,
+		Topic: topic,
+		Type:  typ,
+		Time:  time.Now().UTC().Format(time.RFC3339),
+		Data:  data,
+	}
+	b.history = append(b.history, e)
+	if len(b.history) > historySize {
+		b.history = append(b.history[:0:0], b.history[len(b.history)-historySize:]...)
+	}
+	for s := range b.subs {
+		if !s.topics[topic] {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// ID returns the resume ID of e, sent as the SSE event id.
+func (b *Bus) ID(e Event) string {
+	return fmt.Sprintf("%s-%d", b.epoch, e.Seq)
+}
+
+// Subscribe follows topics. If since is the ID of an earlier event, the
+// events after it are returned to replay first. If some of them are no
+// longer kept (or since is from an earlier server run), replay is a single
+// TypeReset event instead. The channel is closed when the subscription is
+// canceled or falls behind.
+func (b *Bus) Subscribe(topics []string, since string) (replay []Event, ch <-chan Event, cancel func()) {
+	s := &subscriber{
+		topics: make(map[string]bool, len(topics)),
+		ch:     make(chan Event, subscriberBuffer),
+	}
+	for _, t := range topics {
+		s.topics[t] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if since != "" {
+		after, ok := b.parseID(since)
+		if !ok || after > b.seq || len(b.history) > 0 && b.history[0].Seq > after+1 {
+			// carries the current sequence number: resuming from it
+			// misses nothing
+			replay = []Event{{
+				Seq:   b.seq,
+				Topic: TopicEvents,
+				Type:  TypeReset,
+				Time:  time.Now().UTC().Format(time.RFC3339),
+			}}
+		} else {
+			for _, e := range b.history {
+				if e.Seq > after && s.topics[e.Topic] {
+					replay = append(replay, e)
+				}
+			}
+		}
+	}
+	b.subs[s] = struct{}{}
+	return replay, s.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[s]; ok {
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// parseID returns the sequence number of a resume ID of this run.
+func (b *Bus) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+func TestReplayAndReset(t *testing.T) {
+	b := NewBus()
+	b.Publish(TopicPorts, "ports", 1)
+	b.Publish(TopicActivity, "push", 2)
+	b.Publish(TopicPorts, "ports", 3)
+
+	first := b.ID(Event{Seq: 1})
+	replay, ch, cancel := b.Subscribe([]string{TopicPorts}, first)
+	if len(replay) != 1 || replay[0].Data != 3 {
+		t.Errorf("replay %+v", replay)
+	}
+	b.Publish(TopicActivity, "push", 4)
+	b.Publish(TopicPorts, "ports", 5)
+	if e := <-ch; e.Data != 5 || e.Seq != 5 {
+		t.Errorf("live event %+v", e)
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel open after cancel")
+	}
+
+	for _, since := range []string{"other-1", b.ID(Event{Seq: 99})} {
+		replay, _, cancel := b.Subscribe([]string{TopicPorts}, since)
+		cancel()
+		if len(replay) != 1 || replay[0].Type != TypeReset || b.ID(replay[0]) != b.ID(Event{Seq: 5}) {
+			t.Errorf("since %s: replay %+v", since, replay)
+		}
+	}
+
+	for i := 0; i < historySize; i++ {
+		b.Publish(TopicActivity, "push", i)
+	}
+	if replay, _, cancel := b.Subscribe([]string{TopicPorts}, first); len(replay) != 1 || replay[0].Type != TypeReset {
+		t.Errorf("evicted: replay %+v", replay)
+	} else {
+		cancel()
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBus()
+	_, ch, cancel := b.Subscribe([]string{TopicPorts}, "")
+	defer cancel()
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(TopicPorts, "ports", i)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("received %d events before close, want %d", n, subscriberBuffer)
+	}
+}
+
+func TestTopicAccess(t *testing.T) {
+	member := &auth.Identity{User: "m", Role: auth.RoleMember}
+	if got := strings.Join(Topics(member), ","); got != TopicPorts {
+		t.Errorf("member topics %s", got)
+	}
+	for _, tt := range []struct {
+		id     *auth.Identity
+		topics string
+		code   int
+	}{
+		{member, "ports,activity", http.StatusForbidden},
+		{&auth.Identity{User: "r", Role: auth.RoleReviewer}, "exec-approvals", http.StatusForbidden},
+		{nil, "nope", http.StatusBadRequest},
+		{nil, "", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/events?topics="+tt.topics, nil)
+		if tt.id != nil {
+			req = req.WithContext(auth.WithIdentity(req.Context(), tt.id))
+		}
+		rec := httptest.NewRecorder()
+		handleEvents(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%v %s: %d %s", tt.id, tt.topics, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(handleEvents))
+	defer srv.Close()
+
+	Publish(TopicActivity, "push", "before")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?topics=ports,activity", nil)
+	req.Header.Set("Last-Event-ID", defaultBus.ID(Event{Seq: defaultBus.seq - 1}))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	next := func() (id string, e Event) {
+		t.Helper()
+		for sc.Scan() {
+			line := sc.Text()
+			if v, ok := strings.CutPrefix(line, "id: "); ok {
+				id = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(v), &e); err != nil {
+					t.Fatal(err)
+				}
+				return id, e
+			}
+		}
+		t.Fatalf("stream ended: %v", sc.Err())
+		return
+	}
+
+	if _, e := next(); e.Data != "before" {
+		t.Errorf("replayed %+v", e)
+	}
+	Publish(TopicNotifications, "review_done", "not followed")
+	Publish(TopicPorts, "ports", "after")
+	if id, e := next(); e.Data != "after" || id != defaultBus.ID(e) {
+		t.Errorf("live %s %+v", id, e)
+	}
+}
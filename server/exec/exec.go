@@ -8,7 +8,7 @@
 //
 // Both endpoints resolve binaries via tool_exec so the server's configured
 // PATH extensions apply the same way they do for other server-managed
-// processes.
+// processes, and run only commands the exec policy (see execpolicy) allows.
 //
 // NDJSON event protocol (one JSON object per line):
 //
@@ -42,6 +42,7 @@ import (
 	"github.com/gorilla/websocket"
 
 	"github.com/xhd2015/agent-pro/agent/exec/tool_exec"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
 	"github.com/xhd2015/ai-critic/server/ndjsonstream"
 )
 
@@ -51,6 +52,9 @@ type ExecRequest struct {
 	// rest are passed as arguments. The binary is resolved via tool_exec,
 	// which honours the server's PATH extensions.
 	Argv []string `json:"argv"`
+	// Dir is the directory to run the command in, the server's working
+	// directory when empty.
+	Dir string `json:"dir,omitempty"`
 }
 
 type execControlMessage struct {
@@ -113,6 +117,9 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("failed to resolve command: %v", err))
 		return
 	}
+	if req.Dir != "" {
+		prepared.Dir = req.Dir
+	}
 
 	// Bind the child process to the request context so a client
 	// disconnection terminates it instead of leaving orphans.
@@ -139,6 +146,13 @@ func handleExec(w http.ResponseWriter, r *http.Request) {
 		heartbeatDone.Wait()
 	}()
 
+	// After the stream starts, so heartbeats flow while a command the
+	// policy asks about waits for approval.
+	if err := execpolicy.Authorize(r, execpolicy.SourceExec, req.Argv, prepared.Dir); err != nil {
+		stream.SendError(err.Error())
+		return
+	}
+
 	stdoutPipe, err := ctxCmd.StdoutPipe()
 	if err != nil {
 		stream.SendError(fmt.Sprintf("stdout pipe: %v", err))
@@ -203,6 +217,13 @@ func handleExecWebSocket(w http.ResponseWriter, r *http.Request) {
 		_ = writeExecWSError(conn, fmt.Sprintf("failed to resolve command: %v", err))
 		return
 	}
+	if req.Dir != "" {
+		prepared.Dir = req.Dir
+	}
+	if err := execpolicy.Authorize(r, execpolicy.SourceExec, req.Argv, prepared.Dir); err != nil {
+		_ = writeExecWSError(conn, err.Error())
+		return
+	}
 
 	ctxCmd := exec.CommandContext(r.Context(), prepared.Path, prepared.Args[1:]...)
 	ctxCmd.Env = prepared.Env
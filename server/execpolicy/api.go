@@ -0,0 +1,174 @@
+package execpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+const (
+	defaultDecisionsLimit = 200
+	eventsKeepalive       = 30 * time.Second
+)
+
+// RegisterAPI registers the exec policy endpoints (admin only):
+//
+//	GET  /api/exec-policy                         -> Policy
+//	PUT  /api/exec-policy {Policy}                -> Policy
+//	POST /api/exec-policy/check {source, argv}    -> {action, rule}
+//	GET  /api/exec-policy/approvals               -> {approvals}
+//	POST /api/exec-policy/approvals {id, approve}
+//	GET  /api/exec-policy/approvals/events        SSE of Event, starting with the pending ones
+//	GET  /api/exec-policy/decisions?limit=N       -> {decisions} newest first
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/exec-policy", handlePolicy)
+	mux.HandleFunc("/api/exec-policy/check", handleCheck)
+	mux.HandleFunc("/api/exec-policy/approvals", handleApprovals)
+	mux.HandleFunc("/api/exec-policy/approvals/events", handleApprovalEvents)
+	mux.HandleFunc("/api/exec-policy/decisions", handleDecisions)
+}
+
+func handlePolicy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		p, err := GetPolicy()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		var p Policy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if err := SetPolicy(p); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if p.Rules == nil {
+			p.Rules = []Rule{}
+		}
+		writeJSON(w, http.StatusOK, p)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// handleCheck evaluates a command against the saved policy without running
+// or logging it, to try out rules.
+func handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		Source string   `json:"source"`
+		Argv   []string `json:"argv"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Argv) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "argv is required"})
+		return
+	}
+	p, err := GetPolicy()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	action, rule := p.Evaluate(req.Source, req.Argv)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"action": action, "rule": rule})
+}
+
+func handleApprovals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"approvals": Pending()})
+	case http.MethodPost:
+		var req struct {
+			ID      string `json:"id"`
+			Approve bool   `json:"approve"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if err := Answer(req.ID, req.Approve, auth.UserName(r)); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errNoApproval) {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// handleApprovalEvents sends a "pending" event for each waiting command,
+// then every event until the client disconnects, so the UI can prompt as
+// soon as a command asks.
+func handleApprovalEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	list, ch, unsubscribe := Subscribe()
+	defer unsubscribe()
+	for _, a := range list {
+		sw.Send(Event{Type: "pending", Approval: a})
+	}
+
+	ticker := time.NewTicker(eventsKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			sw.SendStatus("alive", nil)
+		case e := <-ch:
+			sw.Send(e)
+		}
+	}
+}
+
+func handleDecisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	limit := defaultDecisionsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+	list, err := Decisions(limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"decisions": list})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
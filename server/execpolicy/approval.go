@@ -0,0 +1,223 @@
+package execpolicy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/events"
+)
+
+// Approval is a command waiting for someone to allow or deny it.
+type Approval struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`
+	User        string    `json:"user"`
+	Command     string    `json:"command"`
+	Argv        []string  `json:"argv"`
+	Dir         string    `json:"dir,omitempty"`
+	Rule        string    `json:"rule,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	answer chan answer
+}
+
+type answer struct {
+	approve bool
+	by      string
+}
+
+// Event is sent to subscribers when an approval is queued or settled.
+type Event struct {
+	// Type is "pending" or "resolved".
+	Type     string    `json:"type"`
+	Approval *Approval `json:"approval"`
+	// Decision is the Decision of a resolved approval.
+	Decision string `json:"decision,omitempty"`
+}
+
+// subscriberBuffer bounds the events queued per subscriber; a subscriber
+// that falls behind misses events, not the commands.
+const subscriberBuffer = 16
+
+var (
+	mu      sync.Mutex
+	pending = make(map[string]*Approval)
+	subs    = make(map[chan Event]struct{})
+)
+
+// ErrDenied is wrapped by the errors Authorize returns for commands that
+// may not run.
+var ErrDenied = errors.New("denied by exec policy")
+
+var errNoApproval = errors.New("no such pending approval")
+
+// Authorize decides whether the user making r may run argv in dir, waiting
+// for an answer if the policy asks. It logs the decision and returns nil if
+// the command may run; otherwise the error wraps ErrDenied and says why.
+func Authorize(r *http.Request, source string, argv []string, dir string) error {
+	return AuthorizeAs(r.Context(), auth.UserName(r), source, argv, dir)
+}
+
+// AuthorizeAs is Authorize for a command run on behalf of user outside of
+// the request that asked for it; an ask waits until ctx ends.
+func AuthorizeAs(ctx context.Context, user, source string, argv []string, dir string) error {
+	p, err := GetPolicy()
+	if err != nil {
+		return fmt.Errorf("load exec policy: %w", err)
+	}
+	d := Decision{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Source:  source,
+		User:    user,
+		Command: CommandLine(argv),
+		Dir:     dir,
+	}
+	action, rule := p.Evaluate(source, argv)
+	if rule != nil {
+		d.Rule = rule.Pattern
+	}
+	switch action {
+	case ActionAllow:
+		d.Decision, d.Reason = DecisionAllowed, reasonFor(rule)
+	case ActionDeny:
+		d.Decision, d.Reason = DecisionDenied, reasonFor(rule)
+	case ActionAsk:
+		d.Decision, d.Reason, d.By = waitForApproval(ctx, &d, argv, p.approvalTimeout())
+	}
+	writeDecision(d)
+	if d.Decision != DecisionAllowed {
+		if d.Rule != "" {
+			return fmt.Errorf("%w: %s (%s, rule %q)", ErrDenied, d.Command, d.Reason, d.Rule)
+		}
+		return fmt.Errorf("%w: %s (%s)", ErrDenied, d.Command, d.Reason)
+	}
+	return nil
+}
+
+func reasonFor(rule *Rule) string {
+	if rule == nil {
+		return ReasonDefault
+	}
+	return ReasonRule
+}
+
+// waitForApproval queues the command and waits until it is answered, the
+// timeout passes or ctx ends, returning the decision, reason and answerer.
+func waitForApproval(ctx context.Context, d *Decision, argv []string, timeout time.Duration) (string, string, string) {
+	id, err := newID()
+	if err != nil {
+		return DecisionDenied, err.Error(), ""
+	}
+	now := time.Now().UTC()
+	a := &Approval{
+		ID:          id,
+		Source:      d.Source,
+		User:        d.User,
+		Command:     d.Command,
+		Argv:        argv,
+		Dir:         d.Dir,
+		Rule:        d.Rule,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(timeout),
+		answer:      make(chan answer, 1),
+	}
+	mu.Lock()
+	pending[id] = a
+	publishLocked(Event{Type: "pending", Approval: a})
+	mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	decision, reason, by := DecisionDenied, ReasonTimeout, ""
+	select {
+	case ans := <-a.answer:
+		by = ans.by
+		if ans.approve {
+			decision, reason = DecisionAllowed, ReasonApproved
+		} else {
+			reason = ReasonRejected
+		}
+	case <-timer.C:
+	case <-ctx.Done():
+		reason = ReasonCanceled
+	}
+
+	mu.Lock()
+	delete(pending, id)
+	publishLocked(Event{Type: "resolved", Approval: a, Decision: decision})
+	mu.Unlock()
+	return decision, reason, by
+}
+
+// Answer approves or rejects a pending command on behalf of user.
+func Answer(id string, approve bool, user string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	a, ok := pending[id]
+	if !ok {
+		return errNoApproval
+	}
+	select {
+	case a.answer <- answer{approve: approve, by: user}:
+		return nil
+	default:
+		return errNoApproval // answered already
+	}
+}
+
+// Pending returns the commands waiting for approval, oldest first.
+func Pending() []*Approval {
+	mu.Lock()
+	defer mu.Unlock()
+	return pendingLocked()
+}
+
+func pendingLocked() []*Approval {
+	list := make([]*Approval, 0, len(pending))
+	for _, a := range pending {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RequestedAt.Before(list[j].RequestedAt) })
+	return list
+}
+
+// Subscribe returns the pending approvals and a channel receiving every
+// later event, with a function that ends the subscription.
+func Subscribe() ([]*Approval, <-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	mu.Lock()
+	defer mu.Unlock()
+	subs[ch] = struct{}{}
+	return pendingLocked(), ch, func() {
+		mu.Lock()
+		delete(subs, ch)
+		mu.Unlock()
+	}
+}
+
+func publishLocked(e Event) {
+	events.Publish(events.TopicExecApprovals, e.Type, e)
+	for ch := range subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate approval id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,111 @@
+package execpolicy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Decisions.
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+)
+
+// Reasons for a decision.
+const (
+	ReasonRule     = "rule"     // a rule allowed or denied it
+	ReasonDefault  = "default"  // no rule matched
+	ReasonApproved = "approved" // someone allowed it
+	ReasonRejected = "rejected" // someone denied it
+	ReasonTimeout  = "timeout"  // nobody answered in time
+	ReasonCanceled = "canceled" // the client went away while waiting
+)
+
+// Decision is one entry of the decision log.
+type Decision struct {
+	Time     string `json:"time"` // RFC3339
+	Source   string `json:"source"`
+	User     string `json:"user"`
+	Command  string `json:"command"`
+	Dir      string `json:"dir,omitempty"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+	// Rule is the pattern of the deciding rule.
+	Rule string `json:"rule,omitempty"`
+	// By is who answered an ask.
+	By string `json:"by,omitempty"`
+}
+
+var (
+	logMu   sync.Mutex
+	logPath = config.ExecDecisionsLogFile
+)
+
+// SetFiles points the policy and the decision log at other files (used by
+// tests).
+func SetFiles(policyPath, decisionsPath string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	policyFile = jsonfile.New[Policy](policyPath)
+	logPath = decisionsPath
+}
+
+func writeDecision(d Decision) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "exec policy: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exec policy: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// Decisions returns the newest logged decisions, newest first, at most
+// limit.
+func Decisions(limit int) ([]Decision, error) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	file, err := os.Open(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Decision{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var all []Decision
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var d Decision
+		if json.Unmarshal(scanner.Bytes(), &d) == nil {
+			all = append(all, d)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	result := make([]Decision, 0, min(len(all), limit))
+	for i := len(all) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, all[i])
+	}
+	return result, nil
+}
@@ -0,0 +1,227 @@
+// Package execpolicy decides whether a command may run on the server. The
+// exec API and the terminal run anything they are given; a policy of allow,
+// deny and ask rules, kept in config.ExecPolicyFile, narrows that. Commands
+// matching an ask rule wait for someone to approve them from the UI, and
+// every decision is appended to config.ExecDecisionsLogFile.
+//
+// For terminals the policy decides whether a session may start, judged by
+// the shell or ssh command it launches. What is then typed into the shell,
+// by its owner or by a share guest granted control, is not checked: a PTY
+// carries keystrokes, not command lines. To keep interactive shells from
+// running commands, deny or ask the launch itself.
+//
+// Coding agents (Claude Code, Codex, cursor-agent, jsonl custom agents) run
+// shell commands themselves and cannot wait for an answer. When the policy
+// could stop an agent command (see Restricts), their adapters take shell
+// access away at the CLI's own permission level; commands cursor-agent
+// proposes in approval mode are authorized when someone approves them.
+package execpolicy
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Actions a rule, or the policy default, takes.
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	ActionAsk   = "ask"
+)
+
+// Sources of commands.
+const (
+	// SourceExec is POST /api/exec and its WebSocket, as used by tool_exec
+	// in remote agents.
+	SourceExec = "exec"
+	// SourceTerminal is a terminal session's shell or ssh command, checked
+	// when the session starts; commands typed into it are not.
+	SourceTerminal = "terminal"
+	// SourceAgent is a shell command of a coding agent, matched as the
+	// command line the agent wrote (see ShellArgv).
+	SourceAgent = "agent"
+)
+
+// DefaultApprovalTimeout is how long an ask waits when the policy sets no
+// timeout; the command is denied when it passes.
+const DefaultApprovalTimeout = 5 * time.Minute
+
+// Rule matches commands by a pattern over the command line: the program's
+// base name followed by its arguments, space separated. "*" matches any
+// run of characters, so "git push*" matches every push and "rm -rf *" any
+// forced recursive removal; without "*" the whole line must match.
+//
+// An allow rule never matches a line with shell metacharacters (see
+// shellMeta): run by a shell, "go test; curl x | sh" is more than the "go *"
+// it starts with. Such lines fall through to the later rules and the
+// default, which deny and ask rules still decide.
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Action  string `json:"action"`
+	// Sources limits the rule to commands from these sources; empty means
+	// all.
+	Sources []string `json:"sources,omitempty"`
+	Note    string   `json:"note,omitempty"`
+}
+
+// Policy is an ordered list of rules: the first matching rule decides, and
+// Default decides commands no rule matches.
+type Policy struct {
+	// Default is allow, deny or ask; empty means allow.
+	Default string `json:"default,omitempty"`
+	Rules   []Rule `json:"rules"`
+	// ApprovalTimeout is a Go duration like "2m"; empty means
+	// DefaultApprovalTimeout.
+	ApprovalTimeout string `json:"approval_timeout,omitempty"`
+}
+
+var policyFile = jsonfile.New[Policy](config.ExecPolicyFile)
+
+// GetPolicy returns the policy; without a policy file every command is
+// allowed.
+func GetPolicy() (Policy, error) {
+	p, err := policyFile.Get()
+	if p.Rules == nil {
+		p.Rules = []Rule{}
+	}
+	return p, err
+}
+
+// SetPolicy validates and saves the policy.
+func SetPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return policyFile.Set(p)
+}
+
+// Validate checks the actions, sources and timeout of p.
+func (p Policy) Validate() error {
+	if p.Default != "" && !validAction(p.Default) {
+		return fmt.Errorf("default must be %s, %s or %s", ActionAllow, ActionDeny, ActionAsk)
+	}
+	for i, r := range p.Rules {
+		if strings.TrimSpace(r.Pattern) == "" {
+			return fmt.Errorf("rule %d: pattern is required", i+1)
+		}
+		if !validAction(r.Action) {
+			return fmt.Errorf("rule %d: action must be %s, %s or %s", i+1, ActionAllow, ActionDeny, ActionAsk)
+		}
+		for _, s := range r.Sources {
+			if s != SourceExec && s != SourceTerminal && s != SourceAgent {
+				return fmt.Errorf("rule %d: unknown source %q", i+1, s)
+			}
+		}
+	}
+	if p.ApprovalTimeout != "" {
+		if d, err := time.ParseDuration(p.ApprovalTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("approval_timeout must be a positive duration like 2m")
+		}
+	}
+	return nil
+}
+
+func validAction(a string) bool {
+	return a == ActionAllow || a == ActionDeny || a == ActionAsk
+}
+
+func (p Policy) approvalTimeout() time.Duration {
+	if d, err := time.ParseDuration(p.ApprovalTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultApprovalTimeout
+}
+
+// Evaluate returns the action p takes on argv from source, and the rule
+// that decided it, nil for the default.
+func (p Policy) Evaluate(source string, argv []string) (string, *Rule) {
+	line := CommandLine(argv)
+	chained := hasShellMeta(line)
+	for i, r := range p.Rules {
+		if len(r.Sources) > 0 && !slices.Contains(r.Sources, source) {
+			continue
+		}
+		if chained && r.Action == ActionAllow {
+			continue
+		}
+		if matchPattern(strings.TrimSpace(r.Pattern), line) {
+			return r.Action, &p.Rules[i]
+		}
+	}
+	if p.Default == "" {
+		return ActionAllow, nil
+	}
+	return p.Default, nil
+}
+
+// Restricts reports whether p could stop a command from source: a rule for
+// it denies or asks, or the default does.
+func (p Policy) Restricts(source string) bool {
+	if p.Default != "" && p.Default != ActionAllow {
+		return true
+	}
+	for _, r := range p.Rules {
+		if r.Action != ActionAllow && (len(r.Sources) == 0 || slices.Contains(r.Sources, source)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricts reports whether the saved policy could stop a command from
+// source. A policy that fails to load restricts everything.
+func Restricts(source string) bool {
+	p, err := GetPolicy()
+	return err != nil || p.Restricts(source)
+}
+
+// shellMeta are the characters with which a shell line runs more than one
+// command, or redirects one; "$(" is checked apart.
+const shellMeta = ";&|`<>\n"
+
+func hasShellMeta(line string) bool {
+	return strings.ContainsAny(line, shellMeta) || strings.Contains(line, "$(")
+}
+
+// ShellArgv splits a shell command line into the words rules match, for
+// commands given as one line rather than an argv.
+func ShellArgv(command string) []string {
+	return strings.Fields(command)
+}
+
+// CommandLine is the line rules match argv against.
+func CommandLine(argv []string) string {
+	if len(argv) == 0 {
+		return ""
+	}
+	parts := append([]string{filepath.Base(argv[0])}, argv[1:]...)
+	return strings.Join(parts, " ")
+}
+
+// matchPattern reports whether s matches pattern, where "*" matches any
+// run of characters, including none.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
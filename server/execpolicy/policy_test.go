@@ -0,0 +1,175 @@
+package execpolicy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func usePolicy(t *testing.T, p Policy) {
+	t.Helper()
+	oldPolicy, oldLog := policyFile.GetPath(), logPath
+	dir := t.TempDir()
+	SetFiles(filepath.Join(dir, "exec-policy.json"), filepath.Join(dir, "exec-decisions.log"))
+	t.Cleanup(func() { SetFiles(oldPolicy, oldLog) })
+	if err := SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"ls", "ls", true},
+		{"ls", "ls -la", false},
+		{"git push*", "git push origin main", true},
+		{"git push*", "git pull", false},
+		{"rm -rf *", "rm -rf /", true},
+		{"*--force*", "git push --force origin", true},
+		{"a*b*b", "ab", false},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := Policy{
+		Default: ActionDeny,
+		Rules: []Rule{
+			{Pattern: "rm *", Action: ActionDeny},
+			{Pattern: "bash*", Action: ActionAsk, Sources: []string{SourceTerminal}},
+			{Pattern: "*", Action: ActionAllow, Sources: []string{SourceExec}},
+		},
+	}
+	tests := []struct {
+		source string
+		argv   []string
+		want   string
+	}{
+		{SourceExec, []string{"/bin/rm", "-rf", "x"}, ActionDeny},
+		{SourceExec, []string{"go", "test"}, ActionAllow},
+		{SourceTerminal, []string{"bash", "-i"}, ActionAsk},
+		{SourceTerminal, []string{"ssh", "me@host"}, ActionDeny},
+		// allow rules do not match chained commands, deny rules still do
+		{SourceExec, []string{"go", "test;", "curl", "x", "|", "sh"}, ActionDeny},
+		{SourceExec, []string{"echo", "$(id)"}, ActionDeny},
+		{SourceExec, []string{"ls;", "rm", "-rf", "x"}, ActionDeny},
+	}
+	for _, tt := range tests {
+		if got, _ := p.Evaluate(tt.source, tt.argv); got != tt.want {
+			t.Errorf("Evaluate(%s, %v) = %s, want %s", tt.source, tt.argv, got, tt.want)
+		}
+	}
+	if got, rule := (Policy{}).Evaluate(SourceExec, []string{"anything"}); got != ActionAllow || rule != nil {
+		t.Errorf("empty policy: %s %v", got, rule)
+	}
+	if err := (Policy{Rules: []Rule{{Pattern: "x", Action: "maybe"}}}).Validate(); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
+
+func TestAuthorizeAsk(t *testing.T) {
+	usePolicy(t, Policy{Rules: []Rule{
+		{Pattern: "git push*", Action: ActionAsk},
+		{Pattern: "rm *", Action: ActionDeny},
+	}})
+	r := httptest.NewRequest("POST", "/api/exec", nil)
+
+	if err := Authorize(r, SourceExec, []string{"rm", "-rf", "/"}, ""); !errors.Is(err, ErrDenied) {
+		t.Fatalf("rm: %v", err)
+	}
+	if err := Authorize(r, SourceExec, []string{"ls"}, ""); err != nil {
+		t.Fatalf("ls: %v", err)
+	}
+
+	_, events, unsubscribe := Subscribe()
+	defer unsubscribe()
+	answer := func(approve bool) {
+		select {
+		case e := <-events:
+			if e.Type != "pending" || e.Approval.Command != "git push origin" {
+				t.Errorf("event %+v", e)
+			}
+			if err := Answer(e.Approval.ID, approve, "admin"); err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("no pending event")
+		}
+		<-events // resolved
+	}
+
+	go answer(true)
+	if err := Authorize(r, SourceExec, []string{"git", "push", "origin"}, ""); err != nil {
+		t.Fatalf("approved push: %v", err)
+	}
+	go answer(false)
+	if err := Authorize(r, SourceExec, []string{"git", "push", "origin"}, ""); !errors.Is(err, ErrDenied) {
+		t.Fatalf("rejected push: %v", err)
+	}
+	if len(Pending()) != 0 {
+		t.Errorf("pending after answers: %d", len(Pending()))
+	}
+
+	list, err := Decisions(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ decision, reason string }{
+		{DecisionDenied, ReasonRejected},
+		{DecisionAllowed, ReasonApproved},
+		{DecisionAllowed, ReasonDefault},
+		{DecisionDenied, ReasonRule},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("decisions: %+v", list)
+	}
+	for i, w := range want {
+		if list[i].Decision != w.decision || list[i].Reason != w.reason {
+			t.Errorf("decision %d: %+v, want %s/%s", i, list[i], w.decision, w.reason)
+		}
+	}
+	if list[0].By != "admin" {
+		t.Errorf("answered by %q", list[0].By)
+	}
+}
+
+func TestAuthorizeTimeout(t *testing.T) {
+	usePolicy(t, Policy{Default: ActionAsk, ApprovalTimeout: "50ms"})
+	r := httptest.NewRequest("POST", "/api/exec", nil)
+	if err := Authorize(r, SourceExec, []string{"ls"}, ""); !errors.Is(err, ErrDenied) {
+		t.Fatalf("unanswered: %v", err)
+	}
+	list, _ := Decisions(1)
+	if len(list) != 1 || list[0].Reason != ReasonTimeout {
+		t.Errorf("decisions: %+v", list)
+	}
+}
+
+func TestRestricts(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Policy
+		want bool
+	}{
+		{"empty", Policy{}, false},
+		{"allow rules only", Policy{Rules: []Rule{{Pattern: "*", Action: ActionAllow}}}, false},
+		{"deny default", Policy{Default: ActionDeny}, true},
+		{"ask for every source", Policy{Rules: []Rule{{Pattern: "git push*", Action: ActionAsk}}}, true},
+		{"deny for terminals only", Policy{Rules: []Rule{{Pattern: "bash*", Action: ActionDeny, Sources: []string{SourceTerminal}}}}, false},
+		{"deny for agents", Policy{Rules: []Rule{{Pattern: "rm *", Action: ActionDeny, Sources: []string{SourceAgent}}}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.p.Restricts(SourceAgent); got != tt.want {
+			t.Errorf("%s: Restricts = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
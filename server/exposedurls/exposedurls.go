@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/xhd2015/ai-critic/server/activity"
 	cf "github.com/xhd2015/ai-critic/server/cloudflare"
 	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
 	"github.com/xhd2015/ai-critic/server/jsonfile"
@@ -395,6 +396,12 @@ func (m *Manager) StartTunnel(id string) error {
 		return fmt.Errorf("failed to add mapping to extension tunnel: %v", err)
 	}
 
+	activity.Record("", activity.Event{
+		Kind:  activity.KindTunnel,
+		Title: fmt.Sprintf("Tunnel started: %s", externalDomain),
+		Ref:   tunnelID,
+	})
+
 	// Update status to active after a brief delay to allow tunnel to establish
 	go func() {
 		time.Sleep(3 * time.Second)
@@ -439,8 +446,14 @@ func (m *Manager) StopTunnel(id string) error {
 	url.Status = "stopped"
 	url.TunnelURL = ""
 	url.Error = ""
+	externalDomain := url.ExternalDomain
 
 	m.mu.Unlock()
+	activity.Record("", activity.Event{
+		Kind:  activity.KindTunnel,
+		Title: fmt.Sprintf("Tunnel stopped: %s", externalDomain),
+		Ref:   id,
+	})
 	return nil
 }
 
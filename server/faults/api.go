@@ -0,0 +1,50 @@
+package faults
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RegisterAPI registers the fault rule endpoints (admin only). Call it only
+// when Enabled.
+//
+//	GET    /api/debug/faults          -> {enabled, rules, stats}
+//	PUT    /api/debug/faults {rules}  replace all rules
+//	DELETE /api/debug/faults          remove all rules
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc(selfPrefix, handleRules)
+}
+
+func handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Rules []Rule `json:"rules"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if _, err := SetRules(req.Rules); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	case http.MethodDelete:
+		SetRules(nil)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": Enabled(),
+		"rules":   Rules(),
+		"stats":   GetStats(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
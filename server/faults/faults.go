@@ -0,0 +1,289 @@
+// Package faults injects latency, server errors and dropped event streams
+// into selected routes, so the frontend's offline and retry handling can be
+// exercised against the kind of flaky connection a tunnel to a phone gives,
+// without being on a bad network.
+//
+// It is a development aid: the middleware and its API only exist when the
+// server runs with --inject-faults. Rules are set per path prefix through
+// /api/debug/faults and are kept in memory.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxLatency bounds the delay a rule may add.
+	MaxLatency = time.Minute
+	// DefaultErrorStatus is returned for injected errors when a rule sets
+	// none.
+	DefaultErrorStatus = http.StatusServiceUnavailable
+	// DefaultDropAfter is how long a stream runs before it is dropped when
+	// a rule sets no time.
+	DefaultDropAfter = 5 * time.Second
+
+	// selfPrefix is the faults API itself, which must keep working to
+	// switch faults off.
+	selfPrefix = "/api/debug/faults"
+)
+
+// Rule describes the faults injected into requests whose path starts with
+// Prefix. Each request picks its outcome independently.
+type Rule struct {
+	Prefix string `json:"prefix"`
+	// LatencyMS delays every matching request, plus a random extra of up
+	// to JitterMS.
+	LatencyMS int `json:"latency_ms,omitempty"`
+	JitterMS  int `json:"jitter_ms,omitempty"`
+	// ErrorRate is the chance (0-1) that a request fails with ErrorStatus
+	// instead of reaching its handler.
+	ErrorRate   float64 `json:"error_rate,omitempty"`
+	ErrorStatus int     `json:"error_status,omitempty"`
+	// DropRate is the chance (0-1) that an event stream is cut off
+	// DropAfterMS after it starts, without a clean end.
+	DropRate    float64 `json:"drop_rate,omitempty"`
+	DropAfterMS int     `json:"drop_after_ms,omitempty"`
+}
+
+// Stats counts what was injected since the rules were last set.
+type Stats struct {
+	Delayed int64 `json:"delayed"`
+	Failed  int64 `json:"failed"`
+	Dropped int64 `json:"dropped"`
+}
+
+var (
+	enabled atomic.Bool
+
+	mu    sync.RWMutex
+	rules []Rule
+
+	delayed, failed, dropped atomic.Int64
+
+	// chance reports whether an event of probability p happens; a var so
+	// tests can make faults deterministic.
+	chance = func(p float64) bool { return p > 0 && rand.Float64() < p }
+)
+
+// SetEnabled switches fault injection on; see the --inject-faults flag.
+func SetEnabled(v bool) {
+	enabled.Store(v)
+}
+
+// Enabled reports whether the server runs with fault injection.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Validate checks a rule and fills in its defaults.
+func (r *Rule) Validate() error {
+	if !strings.HasPrefix(r.Prefix, "/") {
+		return fmt.Errorf("prefix must start with /: %q", r.Prefix)
+	}
+	if strings.HasPrefix(r.Prefix, selfPrefix) {
+		return fmt.Errorf("cannot inject faults into %s", selfPrefix)
+	}
+	if r.LatencyMS < 0 || r.JitterMS < 0 || r.DropAfterMS < 0 {
+		return fmt.Errorf("%s: durations must not be negative", r.Prefix)
+	}
+	if time.Duration(r.LatencyMS+r.JitterMS)*time.Millisecond > MaxLatency {
+		return fmt.Errorf("%s: latency plus jitter exceeds %s", r.Prefix, MaxLatency)
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 || r.DropRate < 0 || r.DropRate > 1 {
+		return fmt.Errorf("%s: rates must be between 0 and 1", r.Prefix)
+	}
+	if r.ErrorStatus == 0 {
+		r.ErrorStatus = DefaultErrorStatus
+	}
+	if r.ErrorStatus < 500 || r.ErrorStatus > 599 {
+		return fmt.Errorf("%s: error_status must be a 5xx code", r.Prefix)
+	}
+	if r.DropAfterMS == 0 {
+		r.DropAfterMS = int(DefaultDropAfter / time.Millisecond)
+	}
+	return nil
+}
+
+// SetRules validates and replaces all rules, and resets the stats.
+func SetRules(rs []Rule) ([]Rule, error) {
+	seen := make(map[string]bool, len(rs))
+	for i := range rs {
+		if err := rs[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[rs[i].Prefix] {
+			return nil, fmt.Errorf("duplicate prefix %q", rs[i].Prefix)
+		}
+		seen[rs[i].Prefix] = true
+	}
+	mu.Lock()
+	rules = append([]Rule(nil), rs...)
+	mu.Unlock()
+	delayed.Store(0)
+	failed.Store(0)
+	dropped.Store(0)
+	return Rules(), nil
+}
+
+// Rules returns a copy of the current rules.
+func Rules() []Rule {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Rule{}, rules...)
+}
+
+// GetStats returns the injection counters.
+func GetStats() Stats {
+	return Stats{Delayed: delayed.Load(), Failed: failed.Load(), Dropped: dropped.Load()}
+}
+
+// match returns the rule with the longest prefix of path.
+func match(path string) (Rule, bool) {
+	if strings.HasPrefix(path, selfPrefix) {
+		return Rule{}, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	var best Rule
+	found := false
+	for _, r := range rules {
+		if strings.HasPrefix(path, r.Prefix) && (!found || len(r.Prefix) > len(best.Prefix)) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// Middleware applies the matching rule to each request. It should wrap
+// everything else so injected failures look like the network's, not the
+// server's.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := match(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if d := delay(rule); d > 0 {
+			delayed.Add(1)
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+
+		if chance(rule.ErrorRate) {
+			failed.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Fault-Injected", "error")
+			w.WriteHeader(rule.ErrorStatus)
+			fmt.Fprintf(w, "{\"error\":\"injected fault: %d\"}\n", rule.ErrorStatus)
+			return
+		}
+
+		if !chance(rule.DropRate) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		dw := &dropWriter{ResponseWriter: w, after: time.Duration(rule.DropAfterMS) * time.Millisecond, cancel: cancel}
+		defer dw.stop()
+		next.ServeHTTP(dw, r.WithContext(ctx))
+		if dw.dropped.Load() {
+			abort(w)
+		}
+	})
+}
+
+// abort ends the response without the closing chunk, so the client sees a
+// broken connection rather than a finished stream. It runs after the
+// handler has returned, so none of the handler's cleanup is skipped.
+func abort(w http.ResponseWriter) {
+	if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+		conn.Close()
+		return
+	}
+	// HTTP/2 cannot be hijacked; aborting resets the stream instead
+	panic(http.ErrAbortHandler)
+}
+
+func delay(rule Rule) time.Duration {
+	d := time.Duration(rule.LatencyMS) * time.Millisecond
+	if rule.JitterMS > 0 {
+		d += time.Duration(rand.IntN(rule.JitterMS+1)) * time.Millisecond
+	}
+	return d
+}
+
+// errDropped is what writes to a dropped stream fail with, as writes to a
+// connection the client closed would.
+var errDropped = errors.New("injected fault: stream dropped")
+
+// dropWriter cuts an event stream off some time after its headers are
+// written. Other responses pass through untouched.
+type dropWriter struct {
+	http.ResponseWriter
+	after   time.Duration
+	cancel  context.CancelFunc
+	started bool
+	timer   *time.Timer
+	dropped atomic.Bool
+}
+
+func (d *dropWriter) start() {
+	if d.started {
+		return
+	}
+	d.started = true
+	if !strings.HasPrefix(d.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	d.timer = time.AfterFunc(d.after, func() {
+		d.dropped.Store(true)
+		dropped.Add(1)
+		// let the handler notice, as it would a client going away
+		d.cancel()
+	})
+}
+
+func (d *dropWriter) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+func (d *dropWriter) WriteHeader(code int) {
+	d.start()
+	d.ResponseWriter.WriteHeader(code)
+}
+
+func (d *dropWriter) Write(b []byte) (int, error) {
+	d.start()
+	if d.dropped.Load() {
+		return 0, errDropped
+	}
+	return d.ResponseWriter.Write(b)
+}
+
+func (d *dropWriter) Flush() {
+	if f, ok := d.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (d *dropWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
@@ -0,0 +1,141 @@
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setRules(t *testing.T, rs ...Rule) {
+	t.Helper()
+	if _, err := SetRules(rs); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetRules(nil) })
+}
+
+func always(t *testing.T) {
+	saved := chance
+	chance = func(p float64) bool { return p > 0 }
+	t.Cleanup(func() { chance = saved })
+}
+
+func TestInjectedError(t *testing.T) {
+	always(t)
+	setRules(t, Rule{Prefix: "/api/", ErrorRate: 1}, Rule{Prefix: "/api/files", LatencyMS: 20})
+
+	reached := 0
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached++ }))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/projects", nil))
+	if rec.Code != DefaultErrorStatus || rec.Header().Get("X-Fault-Injected") != "error" || reached != 0 {
+		t.Errorf("got %d, handler reached %d times", rec.Code, reached)
+	}
+
+	// the longer prefix wins: delayed but not failed
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/files/content", nil))
+	if rec.Code != http.StatusOK || reached != 1 || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("got %d after %s", rec.Code, time.Since(start))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/debug/faults", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("faults API itself got %d", rec.Code)
+	}
+	if s := GetStats(); s.Failed != 1 || s.Delayed != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestDroppedStream(t *testing.T) {
+	always(t)
+	setRules(t, Rule{Prefix: "/api/stream", DropRate: 1, DropAfterMS: 30})
+
+	handlerErr := make(chan error, 1)
+	srv := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/stream/plain" {
+			w.Write([]byte("ok"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		tick := time.NewTicker(5 * time.Millisecond)
+		defer tick.Stop()
+		for i := 0; i < 100; i++ {
+			select {
+			case <-r.Context().Done():
+				handlerErr <- r.Context().Err()
+				return
+			case <-tick.C:
+			}
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+		handlerErr <- nil
+	})))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/api/stream/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body strings.Builder
+	buf := make([]byte, 512)
+	for {
+		n, err := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		if err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("stream ended with %v, want a broken connection", err)
+			}
+			break
+		}
+	}
+	resp.Body.Close()
+	if !strings.Contains(body.String(), "data: 0") || strings.Contains(body.String(), "data: 99") {
+		t.Errorf("body = %q", body.String())
+	}
+	if err := <-handlerErr; err == nil {
+		t.Error("handler was not cancelled")
+	}
+
+	// responses that are not event streams are left alone
+	resp, err = http.Get(srv.URL + "/api/stream/plain")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("plain response: %v", err)
+	}
+	resp.Body.Close()
+	if s := GetStats(); s.Dropped != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestSetRulesValidates(t *testing.T) {
+	t.Cleanup(func() { SetRules(nil) })
+	for _, r := range []Rule{
+		{Prefix: "api"},
+		{Prefix: "/api/debug/faults"},
+		{Prefix: "/api", ErrorRate: 1.5},
+		{Prefix: "/api", ErrorStatus: 404},
+		{Prefix: "/api", LatencyMS: int(2 * MaxLatency / time.Millisecond)},
+	} {
+		if _, err := SetRules([]Rule{r}); err == nil {
+			t.Errorf("rule %+v accepted", r)
+		}
+	}
+	if _, err := SetRules([]Rule{{Prefix: "/a"}, {Prefix: "/a"}}); err == nil {
+		t.Error("duplicate prefix accepted")
+	}
+	rs, err := SetRules([]Rule{{Prefix: "/api", DropRate: 0.5}})
+	if err != nil || rs[0].ErrorStatus != DefaultErrorStatus || rs[0].DropAfterMS != 5000 {
+		t.Errorf("defaults not filled: %+v %v", rs, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/quota"
 )
 
 const (
@@ -101,6 +102,10 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if err := quota.CheckDisk(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
 
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
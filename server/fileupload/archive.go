@@ -0,0 +1,287 @@
+package fileupload
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// archiveEntry is one file or symlink put into an archive.
+type archiveEntry struct {
+	rel  string // slash-separated, relative to the archived directory
+	info fs.FileInfo
+}
+
+// handleArchive streams a directory as a tar.gz or zip.
+// GET /api/files/archive?path=/dir&format=tar.gz|zip[&gitignore=false]
+//
+// Inside a git work tree, files ignored by .gitignore are left out unless
+// gitignore=false. The archive is deterministic for unchanged files and
+// carries an ETag, so an interrupted download can be resumed with a Range
+// request (and If-Range); ranges are served from a temporary copy.
+func handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	dirPath := q.Get("path")
+	if dirPath == "" {
+		writeJSONError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = "tar.gz"
+	case "tar.gz", "tgz", "zip":
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be tar.gz or zip")
+		return
+	}
+	if format == "tgz" {
+		format = "tar.gz"
+	}
+
+	cleanPath := filepath.Clean(dirPath)
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSONError(w, http.StatusNotFound, "directory not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to stat path: %v", err))
+		return
+	}
+	if !info.IsDir() {
+		writeJSONError(w, http.StatusBadRequest, "path is not a directory, use /api/files/download")
+		return
+	}
+
+	entries, err := listArchiveEntries(cleanPath, q.Get("gitignore") != "false")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to list files: %v", err))
+		return
+	}
+
+	name := filepath.Base(cleanPath)
+	if name == string(filepath.Separator) || name == "." {
+		name = "root"
+	}
+	etag := archiveETag(entries, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+
+	write := func(out io.Writer) error {
+		if format == "zip" {
+			return writeZip(out, cleanPath, name, entries)
+		}
+		return writeTarGz(out, cleanPath, name, entries)
+	}
+
+	if r.Header.Get("Range") == "" {
+		if r.Method == http.MethodHead {
+			return
+		}
+		// the common case: stream without buffering the whole archive
+		if err := write(w); err != nil {
+			fmt.Printf("[fileupload] archive %s: %v\n", cleanPath, err)
+		}
+		return
+	}
+
+	// A resumed download: build the archive once more and serve the range.
+	tmp, err := os.CreateTemp("", "archive-*."+format)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create temp file: %v", err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := write(tmp); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to build archive: %v", err))
+		return
+	}
+	// ServeContent checks If-Range against the ETag set above
+	http.ServeContent(w, r, "", time.Time{}, tmp)
+}
+
+// listArchiveEntries lists regular files and symlinks under dir, sorted.
+// With useGitignore inside a git work tree, it asks git for tracked and
+// untracked-but-not-ignored files instead of walking the tree.
+func listArchiveEntries(dir string, useGitignore bool) ([]archiveEntry, error) {
+	var rels []string
+	if useGitignore && gitrunner.IsRepo(dir) {
+		out, err := gitrunner.NewCommand("ls-files", "--cached", "--others", "--exclude-standard", "-z").Dir(dir).Output()
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range strings.Split(string(out), "\x00") {
+			if rel != "" {
+				rels = append(rels, rel)
+			}
+		}
+	} else {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rels = append(rels, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(rels)
+	entries := make([]archiveEntry, 0, len(rels))
+	seen := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		if seen[rel] {
+			continue // ls-files repeats conflicted paths
+		}
+		seen[rel] = true
+		info, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			continue // tracked but deleted from the work tree
+		}
+		if !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			continue // sockets, devices, submodule directories
+		}
+		entries = append(entries, archiveEntry{rel: rel, info: info})
+	}
+	return entries, nil
+}
+
+// archiveETag identifies an archive by its format and each entry's path,
+// size, mode and modification time.
+func archiveETag(entries []archiveEntry, format string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", format)
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\n", e.rel, e.info.Size(), e.info.Mode(), e.info.ModTime().UnixNano())
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+func writeTarGz(out io.Writer, dir, prefix string, entries []archiveEntry) error {
+	gz := gzip.NewWriter(out) // no timestamp in the header: output stays reproducible
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		path := filepath.Join(dir, filepath.FromSlash(e.rel))
+		var link string
+		if e.info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			link = target
+		}
+		hdr, err := tar.FileInfoHeader(e.info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + "/" + e.rel
+		// owner names differ between machines and say nothing useful here
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.Format = tar.FormatPAX
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if link == "" {
+			if err := copyFileTo(tw, path, e.info.Size()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(out io.Writer, dir, prefix string, entries []archiveEntry) error {
+	zw := zip.NewWriter(out)
+	for _, e := range entries {
+		path := filepath.Join(dir, filepath.FromSlash(e.rel))
+		hdr, err := zip.FileInfoHeader(e.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + "/" + e.rel
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if e.info.Mode()&fs.ModeSymlink != 0 {
+			// zip stores a symlink as a file holding its target
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(fw, target); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := copyFileTo(fw, path, e.info.Size()); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyFileTo copies exactly size bytes of path, the size recorded in the
+// header: a file growing or shrinking meanwhile must not corrupt the archive.
+func copyFileTo(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	if n < size {
+		// pad a file truncated while archiving
+		_, err = io.CopyN(w, zeroReader{}, size-n)
+	}
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
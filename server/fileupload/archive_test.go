@@ -0,0 +1,128 @@
+package fileupload
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getArchive(dir, format, rangeHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/files/archive?path="+url.QueryEscape(dir)+"&format="+format, nil)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rec := httptest.NewRecorder()
+	handleArchive(rec, req)
+	return rec
+}
+
+func tarNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := filepath.Join(t.TempDir(), "proj")
+	writeFiles(t, dir, map[string]string{
+		".gitignore":     "build/\n*.log\n",
+		"main.go":        "package main\n",
+		"docs/readme.md": "# readme\n",
+		"build/app":      "binary",
+		"debug.log":      "noise",
+	})
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+
+	// ignored files are left out, untracked ones are included
+	rec := getArchive(dir, "tar.gz", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("tar.gz: %d %s", rec.Code, rec.Body.String())
+	}
+	want := []string{"proj/.gitignore", "proj/docs/readme.md", "proj/main.go"}
+	if got := tarNames(t, rec.Body.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("tar entries = %v, want %v", got, want)
+	}
+	full := rec.Body.Bytes()
+
+	// a resumed download gets the rest of the same bytes
+	rec = getArchive(dir, "tar.gz", "bytes=10-")
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), full[10:]) {
+		t.Errorf("range: %d, %d bytes, want %d", rec.Code, rec.Body.Len(), len(full)-10)
+	}
+
+	rec = getArchive(dir, "zip", "")
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("zip entries = %v, want %v", names, want)
+	}
+
+	// outside git, or with gitignore=false, everything is included
+	entries, err := listArchiveEntries(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) < 5 {
+		t.Errorf("without gitignore: %d entries", len(entries))
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shot.png")
+	writeFiles(t, filepath.Dir(path), map[string]string{"shot.png": "0123456789"})
+	req := httptest.NewRequest(http.MethodGet, "/api/files/download?path="+url.QueryEscape(path), nil)
+	req.Header.Set("Range", "bytes=4-")
+	rec := httptest.NewRecorder()
+	handleDownload(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "456789" || rec.Header().Get("Content-Length") != "6" {
+		t.Errorf("range download: %d %q length=%s", rec.Code, rec.Body.String(), rec.Header().Get("Content-Length"))
+	}
+}
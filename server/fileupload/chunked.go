@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,8 +12,11 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/xhd2015/ai-critic/server/quota"
 )
 
 // chunkSession tracks an in-progress chunked upload.
@@ -22,8 +26,10 @@ type chunkSession struct {
 	TotalChunks int
 	TotalSize   int64
 	ChmodExec   bool
+	SHA256      string // expected hash of the whole file; empty skips the check
 	TempDir     string
 	CreatedAt   time.Time
+	LastActive  time.Time    // last init or chunk; idle sessions expire
 	Received    map[int]bool // chunk index -> received
 }
 
@@ -32,23 +38,21 @@ var (
 	sessions  = map[string]*chunkSession{}
 )
 
-func init() {
-	// Periodically clean up stale sessions (older than 30 minutes)
-	go func() {
-		for {
-			time.Sleep(5 * time.Minute)
-			cleanupStaleSessions(30 * time.Minute)
-		}
-	}()
+// CleanupStale removes upload sessions and upload caches idle for longer
+// than the session TTL. The scheduler's disk-cleanup task runs it.
+func CleanupStale() {
+	ttl := GetLimits().sessionTTL()
+	cleanupStaleSessions(ttl)
+	cleanupStaleUploadCaches(ttl)
 }
 
-func cleanupStaleSessions(maxAge time.Duration) {
+func cleanupStaleSessions(maxIdle time.Duration) {
 	sessionMu.Lock()
 	defer sessionMu.Unlock()
 
-	cutoff := time.Now().Add(-maxAge)
+	cutoff := time.Now().Add(-maxIdle)
 	for id, s := range sessions {
-		if s.CreatedAt.Before(cutoff) {
+		if s.LastActive.Before(cutoff) {
 			os.RemoveAll(s.TempDir)
 			delete(sessions, id)
 		}
@@ -64,11 +68,20 @@ func generateUploadID() string {
 // handleUploadInit starts a new chunked upload session.
 // POST /api/files/upload/init
 // Body: { "path": "/dest/path", "total_chunks": 5, "total_size": 10485760 }
+//
+// With "file_hash" (the SHA-256 of the whole file) the upload is resumable:
+// the hash is the resume token, chunks are kept on disk across restarts and
+// calling init again returns the chunks already received. Without it,
+// "sha256" optionally names the hash the assembled file must match.
 func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if err := quota.CheckDisk(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
 
 	var req struct {
 		Path        string `json:"path"`
@@ -76,6 +89,7 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 		TotalSize   int64  `json:"total_size"`
 		ChmodExec   bool   `json:"chmod_exec"`
 		FileHash    string `json:"file_hash"`
+		SHA256      string `json:"sha256"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSONError(w, http.StatusBadRequest, "invalid request body")
@@ -89,6 +103,19 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, "total_chunks must be positive")
 		return
 	}
+	limits := GetLimits()
+	if req.TotalSize < 0 || req.TotalSize > limits.MaxFileSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file size %d exceeds the limit of %d bytes", req.TotalSize, limits.MaxFileSize))
+		return
+	}
+	if req.TotalSize > int64(req.TotalChunks)*limits.MaxChunkSize {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%d chunks cannot hold %d bytes with the chunk limit of %d bytes", req.TotalChunks, req.TotalSize, limits.MaxChunkSize))
+		return
+	}
+	if req.SHA256 != "" && !isFileHash(req.SHA256) {
+		writeJSONError(w, http.StatusBadRequest, "invalid sha256")
+		return
+	}
 
 	destPath := filepath.Clean(req.Path)
 
@@ -107,6 +134,7 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 			TotalChunks: req.TotalChunks,
 			TotalSize:   req.TotalSize,
 			ChmodExec:   req.ChmodExec,
+			SHA256:      req.FileHash,
 		}); err != nil {
 			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to save upload meta: %v", err))
 			return
@@ -119,6 +147,7 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, map[string]any{
 			"upload_id":       req.FileHash,
 			"received_chunks": received,
+			"max_chunk_size":  limits.MaxChunkSize,
 		})
 		return
 	}
@@ -137,8 +166,10 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 		TotalChunks: req.TotalChunks,
 		TotalSize:   req.TotalSize,
 		ChmodExec:   req.ChmodExec,
+		SHA256:      req.SHA256,
 		TempDir:     tempDir,
 		CreatedAt:   time.Now(),
+		LastActive:  time.Now(),
 		Received:    make(map[int]bool),
 	}
 
@@ -146,21 +177,82 @@ func handleUploadInit(w http.ResponseWriter, r *http.Request) {
 	sessions[id] = session
 	sessionMu.Unlock()
 
-	writeJSON(w, map[string]string{
-		"upload_id": id,
+	writeJSON(w, map[string]any{
+		"upload_id":       id,
+		"received_chunks": []int{},
+		"max_chunk_size":  limits.MaxChunkSize,
+	})
+}
+
+// handleUploadStatus reports which chunks of an upload were received, so a
+// client that lost its connection knows where to resume.
+// GET /api/files/upload/status?upload_id=...
+func handleUploadStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	uploadID := r.URL.Query().Get("upload_id")
+
+	var meta uploadMeta
+	var received []int
+	if isFileHash(uploadID) {
+		dir, err := uploadCacheDir(uploadID)
+		if err == nil {
+			meta, err = loadUploadMeta(dir)
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "upload session not found")
+			return
+		}
+		received, _ = listCachedChunkIndices(dir)
+	} else {
+		sessionMu.Lock()
+		session, ok := sessions[uploadID]
+		if ok {
+			meta = uploadMeta{DestPath: session.DestPath, TotalChunks: session.TotalChunks, TotalSize: session.TotalSize}
+			for i := range session.Received {
+				received = append(received, i)
+			}
+		}
+		sessionMu.Unlock()
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "upload session not found")
+			return
+		}
+		sort.Ints(received)
+	}
+	if received == nil {
+		received = []int{}
+	}
+	writeJSON(w, map[string]any{
+		"upload_id":       uploadID,
+		"path":            meta.DestPath,
+		"total_chunks":    meta.TotalChunks,
+		"total_size":      meta.TotalSize,
+		"received_chunks": received,
 	})
 }
 
 // handleUploadChunk receives a single chunk.
 // POST /api/files/upload/chunk (multipart form: upload_id, chunk_index, chunk)
+// An optional chunk_sha256 field is checked against the received bytes; on
+// a mismatch the chunk is discarded and can be sent again.
 func handleUploadChunk(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse multipart form (max 4MB per chunk)
+	// Bound the body to one chunk plus room for the form fields
+	maxChunk := GetLimits().MaxChunkSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxChunk+64<<10)
 	if err := r.ParseMultipartForm(4 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("chunk exceeds the limit of %d bytes", maxChunk))
+			return
+		}
 		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse form: %v", err))
 		return
 	}
@@ -179,8 +271,14 @@ func handleUploadChunk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	chunkHash := r.FormValue("chunk_sha256")
+	if chunkHash != "" && !isFileHash(chunkHash) {
+		writeJSONError(w, http.StatusBadRequest, "invalid chunk_sha256")
+		return
+	}
+
 	if isFileHash(uploadID) {
-		handleHashUploadChunk(w, uploadID, chunkIndex, r)
+		handleHashUploadChunk(w, uploadID, chunkIndex, chunkHash, maxChunk, r)
 		return
 	}
 
@@ -197,31 +295,22 @@ func handleUploadChunk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the chunk file
-	chunkFile, _, err := r.FormFile("chunk")
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("chunk file is required: %v", err))
+	data, ok := readChunk(w, r, chunkHash, maxChunk)
+	if !ok {
 		return
 	}
-	defer chunkFile.Close()
 
 	// Save chunk to temp dir
 	chunkPath := filepath.Join(session.TempDir, fmt.Sprintf("chunk_%05d", chunkIndex))
-	dst, err := os.Create(chunkPath)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create chunk file: %v", err))
-		return
-	}
-	defer dst.Close()
-
-	written, err := io.Copy(dst, chunkFile)
-	if err != nil {
+	if err := os.WriteFile(chunkPath, data, 0644); err != nil {
 		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to write chunk: %v", err))
 		return
 	}
+	written := len(data)
 
 	sessionMu.Lock()
 	session.Received[chunkIndex] = true
+	session.LastActive = time.Now()
 	receivedCount := len(session.Received)
 	sessionMu.Unlock()
 
@@ -283,15 +372,6 @@ func handleUploadComplete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Combine chunks in order
-	dst, err := os.OpenFile(session.DestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		os.RemoveAll(session.TempDir)
-		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create destination file: %v", err))
-		return
-	}
-	defer dst.Close()
-
 	// List and sort chunk files
 	chunkFiles, err := filepath.Glob(filepath.Join(session.TempDir, "chunk_*"))
 	if err != nil {
@@ -301,27 +381,16 @@ func handleUploadComplete(w http.ResponseWriter, r *http.Request) {
 	}
 	sort.Strings(chunkFiles) // chunk_00000, chunk_00001, ... sorts correctly
 
-	var totalWritten int64
-	for _, chunkPath := range chunkFiles {
-		src, err := os.Open(chunkPath)
-		if err != nil {
-			os.RemoveAll(session.TempDir)
-			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read chunk: %v", err))
-			return
-		}
-		n, err := io.Copy(dst, src)
-		src.Close()
-		if err != nil {
-			os.RemoveAll(session.TempDir)
-			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to write chunk to destination: %v", err))
-			return
-		}
-		totalWritten += n
-	}
+	totalWritten, sum, err := assembleChunks(chunkFiles, session.DestPath, session.TotalSize, session.SHA256)
 
 	// Cleanup temp directory
 	os.RemoveAll(session.TempDir)
 
+	if err != nil {
+		writeAssembleError(w, err)
+		return
+	}
+
 	if session.ChmodExec {
 		if err := os.Chmod(session.DestPath, 0755); err != nil {
 			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to chmod destination file: %v", err))
@@ -339,10 +408,47 @@ func handleUploadComplete(w http.ResponseWriter, r *http.Request) {
 		"status": "ok",
 		"path":   absPath,
 		"size":   totalWritten,
+		"sha256": sum,
 	})
 }
 
-func handleHashUploadChunk(w http.ResponseWriter, uploadID string, chunkIndex int, r *http.Request) {
+// readChunk reads the "chunk" form file, enforcing the size limit and the
+// optional expected hash, and writes the error response on failure.
+func readChunk(w http.ResponseWriter, r *http.Request, wantHash string, maxChunk int64) ([]byte, bool) {
+	chunkFile, _, err := r.FormFile("chunk")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("chunk file is required: %v", err))
+		return nil, false
+	}
+	defer chunkFile.Close()
+	data, err := io.ReadAll(io.LimitReader(chunkFile, maxChunk+1))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read chunk: %v", err))
+		return nil, false
+	}
+	if int64(len(data)) > maxChunk {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("chunk exceeds the limit of %d bytes", maxChunk))
+		return nil, false
+	}
+	if wantHash != "" && !strings.EqualFold(hashBytes(data), wantHash) {
+		writeJSONError(w, http.StatusUnprocessableEntity, "chunk checksum mismatch, please resend")
+		return nil, false
+	}
+	return data, true
+}
+
+// writeAssembleError reports a failed assembly; a size or checksum mismatch
+// is the client's to fix.
+func writeAssembleError(w http.ResponseWriter, err error) {
+	var mismatch *integrityError
+	if errors.As(err, &mismatch) {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to assemble file: %v", err))
+}
+
+func handleHashUploadChunk(w http.ResponseWriter, uploadID string, chunkIndex int, chunkHash string, maxChunk int64, r *http.Request) {
 	dir, err := uploadCacheDir(uploadID)
 	if err != nil {
 		writeJSONError(w, http.StatusNotFound, "upload session not found")
@@ -357,15 +463,8 @@ func handleHashUploadChunk(w http.ResponseWriter, uploadID string, chunkIndex in
 		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("chunk_index out of range [0, %d)", meta.TotalChunks))
 		return
 	}
-	chunkFile, _, err := r.FormFile("chunk")
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("chunk file is required: %v", err))
-		return
-	}
-	defer chunkFile.Close()
-	data, err := io.ReadAll(chunkFile)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read chunk: %v", err))
+	data, ok := readChunk(w, r, chunkHash, maxChunk)
+	if !ok {
 		return
 	}
 	if path, ok := findCachedChunk(dir, chunkIndex); ok && chunkMatchesHash(path, data) {
@@ -417,9 +516,14 @@ func handleHashUploadComplete(w http.ResponseWriter, uploadID string) {
 		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create directory: %v", err))
 		return
 	}
-	totalWritten, err := assembleCachedFile(dir, meta, meta.DestPath)
+	totalWritten, sum, err := assembleCachedFile(dir, meta, meta.DestPath)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to assemble file: %v", err))
+		var mismatch *integrityError
+		if errors.As(err, &mismatch) {
+			// a corrupted cache cannot complete; start over
+			removeUploadCache(dir)
+		}
+		writeAssembleError(w, err)
 		return
 	}
 	if meta.ChmodExec {
@@ -437,5 +541,6 @@ func handleHashUploadComplete(w http.ResponseWriter, uploadID string) {
 		"status": "ok",
 		"path":   absPath,
 		"size":   totalWritten,
+		"sha256": sum,
 	})
 }
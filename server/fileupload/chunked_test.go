@@ -0,0 +1,153 @@
+package fileupload
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func useLimits(t *testing.T, l Limits) {
+	t.Helper()
+	old := limitsFile
+	limitsFile = jsonfile.New[Limits](filepath.Join(t.TempDir(), "upload-limits.json"))
+	if err := limitsFile.Set(l); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { limitsFile = old })
+}
+
+func postJSON(h http.HandlerFunc, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+	return rec
+}
+
+func postChunk(uploadID string, index int, data []byte, chunkHash string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("upload_id", uploadID)
+	mw.WriteField("chunk_index", strconv.Itoa(index))
+	if chunkHash != "" {
+		mw.WriteField("chunk_sha256", chunkHash)
+	}
+	part, _ := mw.CreateFormFile("chunk", "chunk")
+	part.Write(data)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/files/upload/chunk", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handleUploadChunk(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return out
+}
+
+func TestUploadInitLimits(t *testing.T) {
+	useLimits(t, Limits{MaxFileSize: 100, MaxChunkSize: 10})
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	tests := []struct {
+		name   string
+		chunks int
+		size   int64
+		status int
+	}{
+		{"within limits", 10, 100, http.StatusOK},
+		{"file too large", 11, 101, http.StatusRequestEntityTooLarge},
+		{"chunks too large", 2, 30, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := postJSON(handleUploadInit, map[string]any{"path": dest, "total_chunks": tt.chunks, "total_size": tt.size})
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.status, rec.Body.String())
+		}
+	}
+
+	// a single oversized chunk is refused as well
+	rec := postJSON(handleUploadInit, map[string]any{"path": dest, "total_chunks": 10, "total_size": 100})
+	id := decode(t, rec)["upload_id"].(string)
+	if rec := postChunk(id, 0, bytes.Repeat([]byte("x"), 11), ""); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized chunk: status = %d", rec.Code)
+	}
+}
+
+func TestUploadResumeAndVerify(t *testing.T) {
+	useLimits(t, Limits{MaxChunkSize: 4})
+	dest := filepath.Join(t.TempDir(), "out.bin")
+	content := []byte("hello world!")
+	parts := [][]byte{content[:4], content[4:8], content[8:]}
+
+	init := func(sha string) string {
+		t.Helper()
+		rec := postJSON(handleUploadInit, map[string]any{"path": dest, "total_chunks": 3, "total_size": len(content), "sha256": sha})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("init: %d %s", rec.Code, rec.Body.String())
+		}
+		return decode(t, rec)["upload_id"].(string)
+	}
+
+	id := init(hashBytes(content))
+
+	// a chunk corrupted in transit is rejected and not recorded
+	if rec := postChunk(id, 0, []byte("HELL"), hashBytes(parts[0])); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("corrupted chunk: status = %d", rec.Code)
+	}
+	if rec := postChunk(id, 0, parts[0], hashBytes(parts[0])); rec.Code != http.StatusOK {
+		t.Fatalf("chunk 0: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := postChunk(id, 2, parts[2], ""); rec.Code != http.StatusOK {
+		t.Fatalf("chunk 2: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// after a dropped connection the client asks what is missing
+	rec := httptest.NewRecorder()
+	handleUploadStatus(rec, httptest.NewRequest(http.MethodGet, "/api/files/upload/status?upload_id="+id, nil))
+	if got := decode(t, rec)["received_chunks"]; len(got.([]any)) != 2 {
+		t.Fatalf("received_chunks = %v", got)
+	}
+	postChunk(id, 1, parts[1], "")
+
+	rec = postJSON(handleUploadComplete, map[string]string{"upload_id": id})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("complete: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := decode(t, rec)["sha256"]; got != hashBytes(content) {
+		t.Errorf("sha256 = %v", got)
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, content) {
+		t.Errorf("content = %q", data)
+	}
+
+	// a file not matching the announced hash never replaces the destination
+	id = init(strings.Repeat("0", 64))
+	for i, p := range parts {
+		postChunk(id, i, p, "")
+	}
+	rec = postJSON(handleUploadComplete, map[string]string{"upload_id": id})
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "checksum mismatch") {
+		t.Errorf("mismatch: %d %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(dest); !bytes.Equal(data, content) {
+		t.Errorf("destination changed to %q", data)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(dest), ".*")); len(leftovers) > 0 {
+		t.Errorf("temp files left: %v", leftovers)
+	}
+}
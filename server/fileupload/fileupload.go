@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/xhd2015/ai-critic/server/quota"
 )
 
 // FileInfo represents information about a file on the server
@@ -25,13 +27,18 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/files/check", handleCheck)
 	mux.HandleFunc("/api/files/upload", handleUpload)
 	mux.HandleFunc("/api/files/download", handleDownload)
+	mux.HandleFunc("/api/files/archive", handleArchive)
 	mux.HandleFunc("/api/files/browse", handleBrowse)
 	mux.HandleFunc("/api/files/home", handleHome)
+	mux.HandleFunc("/api/files/image", handleImage)
+	mux.HandleFunc("/api/files/image/presets", handleImagePresets)
 
 	// Chunked upload endpoints
 	mux.HandleFunc("/api/files/upload/init", handleUploadInit)
 	mux.HandleFunc("/api/files/upload/chunk", handleUploadChunk)
 	mux.HandleFunc("/api/files/upload/complete", handleUploadComplete)
+	mux.HandleFunc("/api/files/upload/status", handleUploadStatus)
+	mux.HandleFunc("/api/settings/upload-limits", handleLimits)
 }
 
 // handleHome returns the server's user home directory and current working
@@ -108,6 +115,10 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if err := quota.CheckDisk(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
 
 	// Parse multipart form (max 100MB)
 	if err := r.ParseMultipartForm(100 << 20); err != nil {
@@ -162,8 +173,11 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleDownload serves a single file as an attachment. Range requests are
+// supported, so an interrupted download can be resumed.
+// GET /api/files/download?path=/file
 func handleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -191,7 +205,8 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(cleanPath)))
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
+	// ServeFile sets Content-Length itself; a fixed full length would be
+	// wrong for a 206 partial response
 	http.ServeFile(w, r, cleanPath)
 }
 
@@ -0,0 +1,198 @@
+package fileupload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/imageproc"
+)
+
+// maxImageFileSize bounds the input files /api/files/image will process.
+const maxImageFileSize = 64 << 20
+
+// imageCacheMaxAge is how long processed images stay in the cache dir.
+const imageCacheMaxAge = 7 * 24 * time.Hour
+
+var imageCacheDir = config.DataDir + "/image-cache"
+
+// handleImage serves a resized, re-encoded copy of an image file.
+//
+//	GET /api/files/image?path=P[&preset=thumb|low|medium|high][&w=W][&h=H][&q=Q][&format=auto|webp|avif|jpeg|png]
+//
+// Explicit w/h/q override the preset. Results are cached on disk keyed by
+// the file's path, size and mtime, so repeated views cost nothing.
+func handleImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filePath := q.Get("path")
+	if filePath == "" {
+		writeJSONError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+	opts, err := parseImageOptions(q.Get("preset"), q.Get("w"), q.Get("h"), q.Get("q"), q.Get("format"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Accept = r.Header.Get("Accept")
+
+	cleanPath := filepath.Clean(filePath)
+	info, err := os.Stat(cleanPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSONError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to stat file: %v", err))
+		return
+	}
+	if info.IsDir() {
+		writeJSONError(w, http.StatusBadRequest, "path is a directory, not a file")
+		return
+	}
+	if info.Size() > maxImageFileSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "image file too large")
+		return
+	}
+
+	key := imageCacheKey(cleanPath, info, opts)
+	etag := `"` + key + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("Vary", "Accept")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if data, contentType, ok := readImageCache(key); ok {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Original-Size", strconv.FormatInt(info.Size(), 10))
+		w.Write(data)
+		return
+	}
+
+	data, err := os.ReadFile(cleanPath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("failed to read file: %v", err))
+		return
+	}
+	res, err := imageproc.Process(data, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeImageCache(key, res)
+
+	w.Header().Set("Content-Type", res.ContentType)
+	w.Header().Set("X-Original-Size", strconv.FormatInt(info.Size(), 10))
+	w.Header().Set("X-Image-Width", strconv.Itoa(res.Width))
+	w.Header().Set("X-Image-Height", strconv.Itoa(res.Height))
+	w.Write(res.Data)
+}
+
+// handleImagePresets lists the image presets and the formats this server
+// can encode.
+func handleImagePresets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"presets":  imageproc.Presets,
+		"encoders": imageproc.Encoders(),
+	})
+}
+
+func parseImageOptions(preset, width, height, quality, format string) (imageproc.Options, error) {
+	var opts imageproc.Options
+	if preset != "" && preset != "original" {
+		p, ok := imageproc.Presets[preset]
+		if !ok {
+			return opts, fmt.Errorf("unknown preset: %s", preset)
+		}
+		opts = p
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *int
+		max   int
+	}{
+		{"w", width, &opts.MaxWidth, 16384},
+		{"h", height, &opts.MaxHeight, 16384},
+		{"q", quality, &opts.Quality, 100},
+	} {
+		if f.value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f.value)
+		if err != nil || n < 0 || n > f.max {
+			return opts, fmt.Errorf("invalid %s: %s", f.name, f.value)
+		}
+		*f.dst = n
+	}
+	switch format {
+	case "", imageproc.FormatAuto, imageproc.FormatJPEG, imageproc.FormatPNG, imageproc.FormatWebP, imageproc.FormatAVIF:
+		opts.Format = format
+	default:
+		return opts, fmt.Errorf("unknown format: %s", format)
+	}
+	return opts, nil
+}
+
+func imageCacheKey(path string, info os.FileInfo, opts imageproc.Options) string {
+	format := opts.Format
+	if format == "" || format == imageproc.FormatAuto {
+		// the chosen format depends on what the client accepts
+		format = "auto:" + strconv.FormatBool(imageproc.AcceptsWebP(opts.Accept))
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%d\x00%d\x00%s",
+		path, info.Size(), info.ModTime().UnixNano(), opts.MaxWidth, opts.MaxHeight, opts.Quality, format)))
+	return hex.EncodeToString(h[:16])
+}
+
+// cached images are stored as <key>.<format>
+func readImageCache(key string) ([]byte, string, bool) {
+	matches, _ := filepath.Glob(filepath.Join(imageCacheDir, key+".*"))
+	if len(matches) == 0 {
+		return nil, "", false
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		return nil, "", false
+	}
+	return data, "image/" + strings.TrimPrefix(filepath.Ext(matches[0]), "."), true
+}
+
+func writeImageCache(key string, res *imageproc.Result) {
+	if err := os.MkdirAll(imageCacheDir, 0755); err != nil {
+		return
+	}
+	pruneImageCache()
+	os.WriteFile(filepath.Join(imageCacheDir, key+"."+res.Format), res.Data, 0644)
+}
+
+func pruneImageCache() {
+	entries, err := os.ReadDir(imageCacheDir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-imageCacheMaxAge)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(imageCacheDir, e.Name()))
+		}
+	}
+}
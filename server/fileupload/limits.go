@@ -0,0 +1,79 @@
+package fileupload
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Default upload limits, used for fields left zero in the saved limits.
+const (
+	defaultMaxFileSize  = 10 << 30 // 10 GiB
+	defaultMaxChunkSize = 8 << 20  // 8 MiB
+	defaultSessionTTL   = 24 * time.Hour
+)
+
+// Limits bound chunked uploads. Zero fields take the defaults.
+type Limits struct {
+	// MaxFileSize is the largest file a chunked upload may produce.
+	MaxFileSize int64 `json:"max_file_size"`
+	// MaxChunkSize is the largest single chunk accepted.
+	MaxChunkSize int64 `json:"max_chunk_size"`
+	// SessionTTLMinutes is how long an idle upload can still be resumed.
+	SessionTTLMinutes int `json:"session_ttl_minutes"`
+}
+
+var limitsFile = jsonfile.New[Limits](config.DataDir + "/upload-limits.json")
+
+// GetLimits returns the configured limits with defaults applied.
+func GetLimits() Limits {
+	l, _ := limitsFile.Get()
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = defaultMaxFileSize
+	}
+	if l.MaxChunkSize <= 0 {
+		l.MaxChunkSize = defaultMaxChunkSize
+	}
+	if l.SessionTTLMinutes <= 0 {
+		l.SessionTTLMinutes = int(defaultSessionTTL / time.Minute)
+	}
+	return l
+}
+
+func (l Limits) sessionTTL() time.Duration {
+	return time.Duration(l.SessionTTLMinutes) * time.Minute
+}
+
+// handleLimits reads (GET) or replaces (POST) the upload limits. It lives
+// under /api/settings/, so only admins reach it.
+func handleLimits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var l Limits
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if l.MaxFileSize < 0 || l.MaxChunkSize < 0 || l.SessionTTLMinutes < 0 {
+			writeJSONError(w, http.StatusBadRequest, "limits must not be negative")
+			return
+		}
+		if l.MaxFileSize > 0 && l.MaxChunkSize > l.MaxFileSize {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("max_chunk_size %d exceeds max_file_size %d", l.MaxChunkSize, l.MaxFileSize))
+			return
+		}
+		if err := limitsFile.Set(l); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, GetLimits())
+}
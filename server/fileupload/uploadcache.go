@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const uploadChunkSize = 2 * 1024 * 1024
@@ -20,6 +21,7 @@ type uploadMeta struct {
 	TotalChunks int    `json:"total_chunks"`
 	TotalSize   int64  `json:"total_size"`
 	ChmodExec   bool   `json:"chmod_exec"`
+	SHA256      string `json:"sha256,omitempty"`
 }
 
 func isFileHash(id string) bool {
@@ -149,31 +151,107 @@ func chunkMatchesHash(path string, data []byte) bool {
 	return hashBytes(existing) == hashBytes(data)
 }
 
-func assembleCachedFile(dir string, meta uploadMeta, destPath string) (int64, error) {
-	dst, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+func assembleCachedFile(dir string, meta uploadMeta, destPath string) (int64, string, error) {
+	parts := make([]string, meta.TotalChunks)
+	for i := range parts {
+		path, ok := findCachedChunk(dir, i)
+		if !ok {
+			return 0, "", fmt.Errorf("missing chunk %d", i)
+		}
+		parts[i] = path
+	}
+	return assembleChunks(parts, destPath, meta.TotalSize, meta.SHA256)
+}
+
+// integrityError is a size or checksum mismatch of an assembled upload.
+type integrityError struct {
+	msg string
+}
+
+func (e *integrityError) Error() string { return e.msg }
+
+// assembleChunks concatenates parts into destPath and returns the size and
+// SHA-256 of the result. It writes to a temp file next to destPath and only
+// renames it into place when the size (if positive) and hash (if set)
+// match, so a corrupted upload never replaces an existing file.
+func assembleChunks(parts []string, destPath string, wantSize int64, wantHash string) (int64, string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".upload-")
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
-	defer dst.Close()
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
+	h := sha256.New()
+	dst := io.MultiWriter(tmp, h)
 	var total int64
-	for i := 0; i < meta.TotalChunks; i++ {
-		path, ok := findCachedChunk(dir, i)
-		if !ok {
-			return 0, fmt.Errorf("missing chunk %d", i)
-		}
-		src, err := os.Open(path)
+	for _, part := range parts {
+		src, err := os.Open(part)
 		if err != nil {
-			return 0, err
+			return 0, "", err
 		}
 		n, err := io.Copy(dst, src)
 		src.Close()
 		if err != nil {
-			return 0, err
+			return 0, "", err
 		}
 		total += n
 	}
-	return total, nil
+	sum := hex.EncodeToString(h.Sum(nil))
+	if wantSize > 0 && total != wantSize {
+		return 0, "", &integrityError{fmt.Sprintf("size mismatch: received %d bytes, expected %d", total, wantSize)}
+	}
+	if wantHash != "" && !strings.EqualFold(sum, wantHash) {
+		return 0, "", &integrityError{fmt.Sprintf("checksum mismatch: got sha256 %s, expected %s", sum, wantHash)}
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp.Name(), destPath); err != nil {
+		return 0, "", err
+	}
+	return total, sum, nil
+}
+
+// cleanupStaleUploadCaches removes cached uploads that received nothing for
+// longer than maxIdle; their resume token no longer works afterwards.
+func cleanupStaleUploadCaches(maxIdle time.Duration) {
+	root, err := uploadCacheRoot()
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-maxIdle)
+	for _, e := range entries {
+		if !e.IsDir() || !isFileHash(e.Name()) {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		if lastUploadActivity(dir).Before(cutoff) {
+			removeUploadCache(dir)
+		}
+	}
+}
+
+// lastUploadActivity is the newest modification time within a cache dir.
+func lastUploadActivity(dir string) time.Time {
+	var last time.Time
+	if info, err := os.Stat(dir); err == nil {
+		last = info.ModTime()
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
 }
 
 func removeUploadCache(dir string) error {
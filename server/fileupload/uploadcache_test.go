@@ -26,7 +26,7 @@ func TestUploadCacheRoundTrip(t *testing.T) {
 		t.Fatalf("indices=%v", got)
 	}
 	out := filepath.Join(dir, "out.bin")
-	n, err := assembleCachedFile(dir, meta, out)
+	n, _, err := assembleCachedFile(dir, meta, out)
 	if err != nil {
 		t.Fatal(err)
 	}
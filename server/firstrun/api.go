@@ -0,0 +1,122 @@
+package firstrun
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+var (
+	configFileMu sync.RWMutex
+	configFile   string
+)
+
+// SetConfigFile sets the --config-file path of the running server, checked
+// by GET /api/setup/status. The API never writes config files.
+func SetConfigFile(path string) {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+	configFile = path
+}
+
+func getConfigFile() string {
+	configFileMu.RLock()
+	defer configFileMu.RUnlock()
+	return configFile
+}
+
+// SkipAuthPaths must bypass the auth middleware: before setup there is no
+// credential to log in with. The handlers check authorization themselves.
+var SkipAuthPaths = []string{"/api/setup/status", "/api/setup/run"}
+
+// RegisterAPI registers the setup wizard endpoints:
+//
+//	GET  /api/setup/status   -> State
+//	POST /api/setup/run {credential, domain, tunnel_name, start_tunnel, verify}   SSE: logs, a result event, then done
+//
+// Before the first credential exists anyone may call them, as with
+// /api/auth/setup; afterwards only admins.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/setup/status", handleStatus)
+	mux.HandleFunc("/api/setup/run", handleRun)
+}
+
+// allowed reports whether r may use the wizard, answering the request if
+// not. These paths skip the auth middleware, so token checks are throttled
+// here as they would be there.
+func allowed(w http.ResponseWriter, r *http.Request) bool {
+	if !auth.Initialized() {
+		return true
+	}
+	id, wait := auth.ThrottledIdentifyRequest(r)
+	if wait > 0 {
+		auth.WriteThrottled(w, wait)
+		return false
+	}
+	if id == nil || id.Role != auth.RoleAdmin {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return false
+	}
+	return true
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !allowed(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, Check(getConfigFile()))
+}
+
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !allowed(w, r) {
+		return
+	}
+	var opts Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	// the running server already has its config; only the CLI writes one
+	opts.ConfigFile = ""
+	opts.ProjectDir = ""
+	opts.Providers = nil
+
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+
+	res := Run(opts, sw.SendLog)
+
+	sw.Send(map[string]any{"type": "result", "result": res})
+	if res.Failed() {
+		sw.SendError("Setup finished with errors, see the failed steps")
+		return
+	}
+	done := map[string]string{"message": "Setup complete"}
+	if res.Credential != "" {
+		done["credential"] = res.Credential
+	}
+	if res.URL != "" {
+		done["url"] = res.URL
+	}
+	sw.SendDone(done)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
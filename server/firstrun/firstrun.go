@@ -0,0 +1,378 @@
+// Package firstrun sets up a new instance in one pass: the data directory,
+// a login credential, the encryption key pair, a config file with its AI
+// providers and, when a domain is given, a Cloudflare tunnel serving it.
+// Optionally the result is verified: each AI provider with a test call and
+// the domain with a DNS lookup.
+//
+// Every step is idempotent: whatever already exists is kept, so the wizard
+// can be re-run to finish an interrupted setup or to add the tunnel later.
+// The CLI (ai-critic init) and the API (/api/setup/*) share Run.
+package firstrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	cloudflareSettings "github.com/xhd2015/ai-critic/server/cloudflare"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/domains"
+	"github.com/xhd2015/ai-critic/server/encrypt"
+)
+
+// Step names, in the order Run performs them.
+const (
+	StepDataDir     = "data_dir"
+	StepCredentials = "credentials"
+	StepEncKeys     = "encryption_keys"
+	StepConfigFile  = "config_file"
+	StepAIProviders = "ai_providers"
+	StepCheckAI     = "check_ai"
+	StepTunnel      = "tunnel"
+	StepDomain      = "domain"
+	StepCheckDNS    = "check_dns"
+)
+
+// Step outcomes.
+const (
+	StepExisting = "existing" // already set up, left unchanged
+	StepCreated  = "created"
+	StepSkipped  = "skipped" // not requested
+	StepFailed   = "failed"
+	StepPassed   = "passed" // a check succeeded
+	// StepWarning is a check that found a problem which may go away by
+	// itself, such as a DNS record that has not propagated yet.
+	StepWarning = "warning"
+)
+
+// Options are the answers to the wizard's questions.
+type Options struct {
+	// ConfigFile is written if missing; empty skips the config file.
+	ConfigFile string `json:"config_file,omitempty"`
+	// ProjectDir is recorded as server.project_dir in a new config file.
+	ProjectDir string `json:"project_dir,omitempty"`
+	// Credential is the login password; empty generates one.
+	Credential string `json:"credential,omitempty"`
+	// Domain is served through a Cloudflare tunnel; empty skips the tunnel.
+	Domain string `json:"domain,omitempty"`
+	// TunnelName defaults to one derived from Domain.
+	TunnelName string `json:"tunnel_name,omitempty"`
+	// StartTunnel starts the tunnel right away; only possible on a running
+	// server. Otherwise it starts with the server.
+	StartTunnel bool `json:"start_tunnel,omitempty"`
+	// Providers are added to the config file, except names it already
+	// has. The first becomes the default provider if there is none.
+	Providers []config.ProviderConfig `json:"providers,omitempty"`
+	// Verify tests the API key of every provider in the config file with
+	// a call, and that the domain resolves.
+	Verify bool `json:"verify,omitempty"`
+}
+
+// StepResult reports one step.
+type StepResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Result reports a Run.
+type Result struct {
+	Steps []StepResult `json:"steps"`
+	// Credential is set only when Run generated it: it is shown once.
+	Credential string `json:"credential,omitempty"`
+	// URL is the public URL when a domain was set up.
+	URL string `json:"url,omitempty"`
+}
+
+// Failed reports whether any step failed.
+func (r *Result) Failed() bool {
+	for _, s := range r.Steps {
+		if s.Status == StepFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// State is what is already set up.
+type State struct {
+	Credentials bool `json:"credentials"`
+	EncKeys     bool `json:"encryption_keys"`
+	// ConfigFile is false when the file is missing or invalid.
+	ConfigFile  bool     `json:"config_file"`
+	ConfigError string   `json:"config_error,omitempty"`
+	Domains     []string `json:"domains"`
+	// Cloudflared* tell whether a tunnel can be set up on this machine.
+	CloudflaredInstalled     bool `json:"cloudflared_installed"`
+	CloudflaredAuthenticated bool `json:"cloudflared_authenticated"`
+	// Complete means the required steps are done; a tunnel is optional.
+	Complete bool `json:"complete"`
+}
+
+// Check reports the current state. configFile may be empty.
+func Check(configFile string) State {
+	st := State{
+		Credentials: auth.Initialized(),
+		EncKeys:     encrypt.Available(),
+		ConfigFile:  configFile == "",
+		Domains:     []string{},
+	}
+	if configFile != "" {
+		if err := validateConfigFile(configFile); err != nil {
+			st.ConfigError = err.Error()
+		} else {
+			st.ConfigFile = true
+		}
+	}
+	if cfg, err := domains.LoadDomains(); err == nil {
+		for _, d := range cfg.Domains {
+			st.Domains = append(st.Domains, d.Domain)
+		}
+	}
+	if cloudflareSettings.IsCommandAvailable("cloudflared") {
+		st.CloudflaredInstalled = true
+		st.CloudflaredAuthenticated = cloudflareSettings.CheckStatus().Authenticated
+	}
+	st.Complete = st.Credentials && st.EncKeys && st.ConfigFile
+	return st
+}
+
+// runMu serializes runs, so two first visitors cannot both set a credential.
+var runMu sync.Mutex
+
+// Run performs the setup steps, logging progress to logFn (may be nil).
+// A failed step does not stop the independent ones after it; the domain is
+// only added once its tunnel is configured.
+func Run(opts Options, logFn func(string)) *Result {
+	runMu.Lock()
+	defer runMu.Unlock()
+	if logFn == nil {
+		logFn = func(string) {}
+	}
+	res := &Result{Steps: []StepResult{}}
+	add := func(name, status, detail string) {
+		res.Steps = append(res.Steps, StepResult{Name: name, Status: status, Detail: detail})
+		if detail != "" {
+			logFn(fmt.Sprintf("%s: %s (%s)", name, status, detail))
+		} else {
+			logFn(fmt.Sprintf("%s: %s", name, status))
+		}
+	}
+
+	if _, err := os.Stat(config.DataDir); err == nil {
+		add(StepDataDir, StepExisting, config.DataDir)
+	} else if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		add(StepDataDir, StepFailed, err.Error())
+		return res // nothing else can be written
+	} else {
+		add(StepDataDir, StepCreated, config.DataDir)
+	}
+
+	if auth.Initialized() {
+		add(StepCredentials, StepExisting, "")
+	} else {
+		cred := strings.TrimSpace(opts.Credential)
+		generated := cred == ""
+		var err error
+		if generated {
+			cred, err = auth.GenerateCredential()
+		}
+		if err == nil {
+			err = auth.ImportCredentials([]string{cred})
+		}
+		if err != nil {
+			add(StepCredentials, StepFailed, err.Error())
+		} else {
+			if generated {
+				res.Credential = cred
+			}
+			add(StepCredentials, StepCreated, "")
+		}
+	}
+
+	if encrypt.Available() {
+		add(StepEncKeys, StepExisting, "")
+	} else if err := encrypt.GenerateKeys(); err != nil {
+		add(StepEncKeys, StepFailed, err.Error())
+	} else {
+		add(StepEncKeys, StepCreated, "")
+	}
+
+	switch {
+	case opts.ConfigFile == "":
+		add(StepConfigFile, StepSkipped, "")
+	case fileExists(opts.ConfigFile):
+		if err := validateConfigFile(opts.ConfigFile); err != nil {
+			add(StepConfigFile, StepFailed, err.Error())
+		} else {
+			add(StepConfigFile, StepExisting, opts.ConfigFile)
+		}
+	default:
+		if err := writeConfigFile(opts.ConfigFile, opts.ProjectDir); err != nil {
+			add(StepConfigFile, StepFailed, err.Error())
+		} else {
+			add(StepConfigFile, StepCreated, opts.ConfigFile)
+		}
+	}
+
+	configOK := opts.ConfigFile != "" && validateConfigFile(opts.ConfigFile) == nil
+	switch {
+	case len(opts.Providers) == 0:
+		add(StepAIProviders, StepSkipped, "")
+	case !configOK:
+		add(StepAIProviders, StepSkipped, "no valid config file")
+	default:
+		added, err := addProviders(opts.ConfigFile, opts.Providers)
+		switch {
+		case err != nil:
+			add(StepAIProviders, StepFailed, err.Error())
+		case len(added) == 0:
+			add(StepAIProviders, StepExisting, "")
+		default:
+			add(StepAIProviders, StepCreated, strings.Join(added, ", "))
+		}
+	}
+	switch {
+	case !opts.Verify:
+		add(StepCheckAI, StepSkipped, "")
+	case !configOK:
+		add(StepCheckAI, StepSkipped, "no valid config file")
+	default:
+		status, detail := checkProviders(opts.ConfigFile)
+		add(StepCheckAI, status, detail)
+	}
+
+	domain := strings.ToLower(strings.TrimSpace(opts.Domain))
+	if domain == "" {
+		add(StepTunnel, StepSkipped, "")
+		add(StepDomain, StepSkipped, "")
+		add(StepCheckDNS, StepSkipped, "")
+		return res
+	}
+	tunnelName, err := setupTunnel(domain, opts.TunnelName, logFn)
+	if err != nil {
+		add(StepTunnel, StepFailed, err.Error())
+		add(StepDomain, StepSkipped, "tunnel not configured")
+		add(StepCheckDNS, StepSkipped, "tunnel not configured")
+		return res
+	}
+	add(StepTunnel, StepCreated, tunnelName)
+
+	added, err := addDomain(domain, tunnelName)
+	if err != nil {
+		add(StepDomain, StepFailed, err.Error())
+		add(StepCheckDNS, StepSkipped, "domain not added")
+		return res
+	}
+	res.URL = "https://" + domain
+	if opts.StartTunnel {
+		if _, err := domains.StartTunnel(domain, logFn); err != nil {
+			add(StepDomain, StepFailed, fmt.Sprintf("added, but the tunnel did not start: %v", err))
+			add(StepCheckDNS, StepSkipped, "tunnel not started")
+			return res
+		}
+	}
+	if added {
+		add(StepDomain, StepCreated, res.URL)
+	} else {
+		add(StepDomain, StepExisting, res.URL)
+	}
+
+	if !opts.Verify {
+		add(StepCheckDNS, StepSkipped, "")
+	} else {
+		status, detail := checkDNS(domain)
+		add(StepCheckDNS, status, detail)
+	}
+	return res
+}
+
+// setupTunnel checks cloudflared and creates (or reuses) the named tunnel.
+func setupTunnel(domain, tunnelName string, logFn func(string)) (string, error) {
+	if !cloudflareSettings.IsCommandAvailable("cloudflared") {
+		return "", fmt.Errorf("cloudflared is not installed")
+	}
+	if !cloudflareSettings.CheckStatus().Authenticated {
+		return "", fmt.Errorf("cloudflared is not authenticated, run 'cloudflared tunnel login' first")
+	}
+	if tunnelName == "" {
+		if cfg, err := domains.LoadDomains(); err == nil && cfg.TunnelName != "" {
+			tunnelName = cfg.TunnelName
+		} else {
+			tunnelName = cloudflareSettings.DefaultTunnelName(domain)
+		}
+	}
+	if _, _, _, err := cloudflareSettings.EnsureUnifiedTunnelConfigured(tunnelName, logFn); err != nil {
+		return "", err
+	}
+	return tunnelName, nil
+}
+
+// addDomain records domain in the domains file so the server starts its
+// tunnel. It reports whether the domain was new.
+func addDomain(domain, tunnelName string) (bool, error) {
+	cfg, err := domains.LoadDomains()
+	if err != nil {
+		return false, err
+	}
+	if cfg.TunnelName == "" {
+		cfg.TunnelName = tunnelName
+	}
+	for _, d := range cfg.Domains {
+		if d.Domain == domain {
+			return false, domains.SaveDomains(cfg)
+		}
+	}
+	cfg.Domains = append(cfg.Domains, domains.DomainEntry{Domain: domain, Provider: domains.ProviderCloudflare})
+	return true, domains.SaveDomains(cfg)
+}
+
+func validateConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, res := config.Validate(data); len(res.Errors) > 0 {
+		return &config.ValidationError{File: path, Issues: res.Errors}
+	}
+	return nil
+}
+
+// writeConfigFile writes a minimal config that passes validation.
+func writeConfigFile(path, projectDir string) error {
+	cfg := config.Config{
+		AI: config.AIConfig{
+			Providers: []config.ProviderConfig{},
+			Models:    []config.ModelConfig{},
+		},
+		Server: config.ServerConfig{ProjectDir: projectDir},
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// O_EXCL: never overwrite a config written meanwhile
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
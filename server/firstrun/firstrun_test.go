@@ -0,0 +1,122 @@
+package firstrun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	cloudflareSettings "github.com/xhd2015/ai-critic/server/cloudflare"
+	"github.com/xhd2015/ai-critic/server/domains"
+	"github.com/xhd2015/ai-critic/server/encrypt"
+)
+
+// setupTemp points every file the wizard writes into a temp directory.
+func setupTemp(t *testing.T) string {
+	dir := t.TempDir()
+	t.Chdir(dir) // config.DataDir is relative to the working directory
+	auth.SetCredentialsFile(filepath.Join(dir, "credentials"))
+	auth.SetUsersFile(filepath.Join(dir, "users.json"))
+	encrypt.SetKeyFile(filepath.Join(dir, "enc-key"))
+	domains.SetDomainsFile(filepath.Join(dir, "domains.json"))
+	return dir
+}
+
+func stepStatus(res *Result) map[string]string {
+	m := make(map[string]string)
+	for _, s := range res.Steps {
+		m[s.Name] = s.Status
+	}
+	return m
+}
+
+func TestRunCreatesThenKeeps(t *testing.T) {
+	dir := setupTemp(t)
+	configFile := filepath.Join(dir, "conf", "config.json")
+
+	res := Run(Options{ConfigFile: configFile, ProjectDir: dir}, nil)
+	if res.Failed() {
+		t.Fatalf("first run failed: %+v", res.Steps)
+	}
+	want := map[string]string{
+		StepDataDir:     StepCreated,
+		StepCredentials: StepCreated,
+		StepEncKeys:     StepCreated,
+		StepConfigFile:  StepCreated,
+		StepTunnel:      StepSkipped,
+		StepDomain:      StepSkipped,
+	}
+	for name, status := range want {
+		if got := stepStatus(res)[name]; got != status {
+			t.Errorf("first run %s = %q, want %q", name, got, status)
+		}
+	}
+	if len(res.Credential) != 64 {
+		t.Errorf("generated credential = %q, want 64 hex chars", res.Credential)
+	}
+	if st := Check(configFile); !st.Complete {
+		t.Errorf("Check after run = %+v, want complete", st)
+	}
+
+	res = Run(Options{ConfigFile: configFile, Credential: "ignored"}, nil)
+	if res.Failed() {
+		t.Fatalf("second run failed: %+v", res.Steps)
+	}
+	for _, name := range []string{StepDataDir, StepCredentials, StepEncKeys, StepConfigFile} {
+		if got := stepStatus(res)[name]; got != StepExisting {
+			t.Errorf("second run %s = %q, want %q", name, got, StepExisting)
+		}
+	}
+	if res.Credential != "" {
+		t.Errorf("second run generated credential %q", res.Credential)
+	}
+}
+
+func TestRunGivenCredential(t *testing.T) {
+	setupTemp(t)
+	res := Run(Options{Credential: " secret-token "}, nil)
+	if res.Failed() {
+		t.Fatalf("run failed: %+v", res.Steps)
+	}
+	if res.Credential != "" {
+		t.Errorf("given credential echoed back: %q", res.Credential)
+	}
+	if got := stepStatus(res)[StepConfigFile]; got != StepSkipped {
+		t.Errorf("config_file = %q, want skipped", got)
+	}
+	if !auth.Initialized() {
+		t.Errorf("auth not initialized after run")
+	}
+}
+
+func TestRunInvalidConfigFile(t *testing.T) {
+	dir := setupTemp(t)
+	configFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configFile, []byte(`{"ai": {"models": 1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	res := Run(Options{ConfigFile: configFile}, nil)
+	if got := stepStatus(res)[StepConfigFile]; got != StepFailed {
+		t.Errorf("config_file = %q, want failed", got)
+	}
+	if st := Check(configFile); st.Complete || st.ConfigError == "" {
+		t.Errorf("Check = %+v, want incomplete with a config error", st)
+	}
+}
+
+func TestRunDomainWithoutCloudflared(t *testing.T) {
+	if cloudflareSettings.IsCommandAvailable("cloudflared") {
+		t.Skip("cloudflared is installed")
+	}
+	setupTemp(t)
+	res := Run(Options{Domain: "dev.example.com"}, nil)
+	if got := stepStatus(res)[StepTunnel]; got != StepFailed {
+		t.Errorf("tunnel = %q, want failed", got)
+	}
+	if got := stepStatus(res)[StepDomain]; got != StepSkipped {
+		t.Errorf("domain = %q, want skipped", got)
+	}
+	if res.URL != "" {
+		t.Errorf("URL = %q, want empty", res.URL)
+	}
+}
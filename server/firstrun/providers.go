@@ -0,0 +1,148 @@
+package firstrun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/ai"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// checkTimeout bounds each verification call.
+const checkTimeout = 15 * time.Second
+
+// lookupHost resolves a domain for the DNS check, replaced in tests.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// addProviders appends the providers whose names the config file does not
+// list yet, returning their names. The file is rewritten through a generic
+// map so settings this version does not know about are kept.
+func addProviders(path string, providers []config.ProviderConfig) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	aiSection, _ := raw["ai"].(map[string]any)
+	if aiSection == nil {
+		aiSection = map[string]any{}
+		raw["ai"] = aiSection
+	}
+	list, _ := aiSection["providers"].([]any)
+	have := make(map[string]bool, len(list))
+	for _, p := range list {
+		if m, ok := p.(map[string]any); ok {
+			name, _ := m["name"].(string)
+			have[name] = true
+		}
+	}
+
+	var added []string
+	for _, p := range providers {
+		if p.Name == "" {
+			return nil, fmt.Errorf("provider name is required")
+		}
+		if have[p.Name] {
+			continue
+		}
+		have[p.Name] = true
+		list = append(list, p)
+		added = append(added, p.Name)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	aiSection["providers"] = list
+	if def, _ := aiSection["default_provider"].(string); def == "" {
+		aiSection["default_provider"] = providers[0].Name
+	}
+
+	out, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, res := config.Validate(out); len(res.Errors) > 0 {
+		return nil, &config.ValidationError{File: path, Issues: res.Errors}
+	}
+	// api keys: keep the file private
+	if err := os.WriteFile(path, append(out, '\n'), 0600); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// checkProviders lists the models of every provider in the config file,
+// which needs both reachability and a valid API key. Environment overrides
+// apply, as they would for the server.
+func checkProviders(path string) (status, detail string) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return StepFailed, err.Error()
+	}
+	if len(cfg.AI.Providers) == 0 {
+		return StepSkipped, "no AI providers configured"
+	}
+	var problems, passed []string
+	for _, p := range cfg.AI.Providers {
+		if err := checkProvider(p); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", p.Name, err))
+		} else {
+			passed = append(passed, p.Name)
+		}
+	}
+	if len(problems) > 0 {
+		return StepFailed, strings.Join(problems, "; ")
+	}
+	return StepPassed, strings.Join(passed, ", ")
+}
+
+func checkProvider(p config.ProviderConfig) error {
+	cfg := ai.Config{
+		Provider: ai.ResolveProvider(p.Type, p.BaseURL),
+		APIKey:   p.APIKey,
+		BaseURL:  p.BaseURL,
+	}
+	if !cfg.Configured() {
+		return fmt.Errorf("no API key")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	req, err := ai.NewModelsRequest(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("API key rejected (%s)", resp.Status)
+	default:
+		return fmt.Errorf("test call failed: %s", resp.Status)
+	}
+}
+
+// checkDNS reports whether domain resolves. A record that was just routed
+// may take a few minutes to appear, so a failure is only a warning.
+func checkDNS(domain string) (status, detail string) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	addrs, err := lookupHost(ctx, domain)
+	if err != nil || len(addrs) == 0 {
+		return StepWarning, fmt.Sprintf("%s does not resolve yet; DNS changes can take a few minutes", domain)
+	}
+	return StepPassed, fmt.Sprintf("%s resolves to %s", domain, strings.Join(addrs, ", "))
+}
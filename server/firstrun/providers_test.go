@@ -0,0 +1,96 @@
+package firstrun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// fakeProvider serves an OpenAI-compatible /models that accepts only key.
+func fakeProvider(t *testing.T, key string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+key {
+			http.Error(w, "bad key", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/v1"
+}
+
+func TestRunAddsAndVerifiesProviders(t *testing.T) {
+	dir := setupTemp(t)
+	configFile := filepath.Join(dir, "config.json")
+	baseURL := fakeProvider(t, "good")
+
+	res := Run(Options{
+		ConfigFile: configFile,
+		Providers:  []config.ProviderConfig{{Name: "gw", BaseURL: baseURL, APIKey: "good"}},
+		Verify:     true,
+	}, nil)
+	if res.Failed() {
+		t.Fatalf("run failed: %+v", res.Steps)
+	}
+	if got := stepStatus(res); got[StepAIProviders] != StepCreated || got[StepCheckAI] != StepPassed {
+		t.Fatalf("steps = %v", got)
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AI.DefaultProvider != "gw" || len(cfg.AI.Providers) != 1 {
+		t.Errorf("config ai = %+v", cfg.AI)
+	}
+
+	// an existing name is kept as it is, and a rejected key fails the check
+	res = Run(Options{
+		ConfigFile: configFile,
+		Providers: []config.ProviderConfig{
+			{Name: "gw", BaseURL: baseURL, APIKey: "changed"},
+			{Name: "bad", BaseURL: baseURL, APIKey: "wrong"},
+		},
+		Verify: true,
+	}, nil)
+	if got := stepStatus(res); got[StepAIProviders] != StepCreated || got[StepCheckAI] != StepFailed {
+		t.Fatalf("steps = %v", got)
+	}
+	for _, s := range res.Steps {
+		if s.Name == StepCheckAI && !strings.Contains(s.Detail, "bad: API key rejected") {
+			t.Errorf("check detail = %q", s.Detail)
+		}
+	}
+	data, _ := os.ReadFile(configFile)
+	if strings.Contains(string(data), "changed") {
+		t.Errorf("existing provider overwritten:\n%s", data)
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	old := lookupHost
+	t.Cleanup(func() { lookupHost = old })
+
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return nil, errors.New("no such host")
+	}
+	if status, _ := checkDNS("new.example.com"); status != StepWarning {
+		t.Errorf("unresolved domain: %s, want %s", status, StepWarning)
+	}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"104.16.0.1"}, nil
+	}
+	if status, detail := checkDNS("app.example.com"); status != StepPassed || !strings.Contains(detail, "104.16.0.1") {
+		t.Errorf("resolved domain: %s %q", status, detail)
+	}
+}
@@ -0,0 +1,197 @@
+// Package githooks shows which git hooks a repository has installed and
+// lets server-initiated commits skip them. Hook managers (husky, the
+// pre-commit framework, lefthook) install hooks that silently lint,
+// rewrite messages or block commits; the review UI lists them and warns
+// before a commit runs them.
+//
+// Skipping is a per-repository setting stored in the repository's own git
+// config (ai-critic.disableHooks), so it applies to every commit the server
+// makes there and to nothing else: commits made in a terminal still run
+// the hooks.
+package githooks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// disableKey is the repository config key that makes server commits skip
+// hooks.
+const disableKey = "ai-critic.disableHooks"
+
+// MaxContentBytes bounds the hook content returned by Content.
+const MaxContentBytes = 256 << 10
+
+// CommitHooks are the hooks a plain commit runs, in order.
+var CommitHooks = []string{"pre-commit", "prepare-commit-msg", "commit-msg", "post-commit"}
+
+// Hook is one installed hook.
+type Hook struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Executable hooks are run by git; others are ignored.
+	Executable bool `json:"executable"`
+	// Manager is the tool that installed the hook, when recognizable:
+	// "husky", "pre-commit" or "lefthook".
+	Manager string `json:"manager,omitempty"`
+}
+
+// Info describes the hooks of a repository.
+type Info struct {
+	// Dir is the effective hooks directory.
+	Dir string `json:"dir"`
+	// HooksPath is the configured core.hooksPath, if any.
+	HooksPath string `json:"hooksPath,omitempty"`
+	Hooks     []Hook `json:"hooks"`
+	// Disabled reports whether server commits skip the hooks.
+	Disabled bool `json:"disabled"`
+	// CommitHooks are the hooks the next server commit will run; empty
+	// when Disabled.
+	CommitHooks []string `json:"commitHooks"`
+}
+
+// List returns the hooks installed in the repository at dir. Sample hooks
+// are left out.
+func List(dir string) (*Info, error) {
+	hooksDir, err := hooksDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Dir: hooksDir, Hooks: []Hook{}, CommitHooks: []string{}, Disabled: Disabled(dir)}
+	if out, err := gitrunner.NewCommand("config", "--get", "core.hooksPath").Dir(dir).Output(); err == nil {
+		info.HooksPath = strings.TrimSpace(string(out))
+	}
+
+	entries, err := os.ReadDir(hooksDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".sample") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := filepath.Join(hooksDir, name)
+		st, err := os.Stat(p)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		info.Hooks = append(info.Hooks, Hook{
+			Name:       name,
+			Path:       p,
+			Size:       st.Size(),
+			Executable: st.Mode()&0111 != 0,
+			Manager:    manager(hooksDir, p),
+		})
+	}
+	sort.Slice(info.Hooks, func(i, j int) bool { return info.Hooks[i].Name < info.Hooks[j].Name })
+
+	if !info.Disabled {
+		for _, name := range CommitHooks {
+			for _, h := range info.Hooks {
+				if h.Name == name && h.Executable {
+					info.CommitHooks = append(info.CommitHooks, name)
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// Content returns the script of the hook name.
+func Content(dir, name string) (*Hook, string, error) {
+	info, err := List(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, h := range info.Hooks {
+		if h.Name != name {
+			continue
+		}
+		if h.Size > MaxContentBytes {
+			return &h, "", fmt.Errorf("hook %s is larger than %d KB", name, MaxContentBytes>>10)
+		}
+		data, err := os.ReadFile(h.Path)
+		if err != nil {
+			return nil, "", err
+		}
+		return &h, string(data), nil
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// Disabled reports whether server commits in dir skip hooks.
+func Disabled(dir string) bool {
+	out, err := gitrunner.NewCommand("config", "--bool", "--get", disableKey).Dir(dir).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// SetDisabled turns hooks off or back on for server commits in dir.
+func SetDisabled(dir string, disabled bool) error {
+	var cmd *gitrunner.Command
+	if disabled {
+		cmd = gitrunner.NewCommand("config", "--local", "--bool", disableKey, "true")
+	} else {
+		cmd = gitrunner.NewCommand("config", "--local", "--unset", disableKey)
+	}
+	output, err := cmd.Dir(dir).Run()
+	if err != nil && (disabled || Disabled(dir)) {
+		return fmt.Errorf("failed to update %s: %s", disableKey, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// CommitArgs are the git options a server commit in dir starts with:
+// core.hooksPath pointed at a directory without hooks when they are
+// disabled. Unlike --no-verify this also skips prepare-commit-msg and
+// post-commit.
+func CommitArgs(dir string) []string {
+	if !Disabled(dir) {
+		return nil
+	}
+	return []string{"-c", "core.hooksPath=" + os.DevNull}
+}
+
+// hooksDir returns the hooks directory git uses in dir, which honors
+// core.hooksPath and linked worktrees.
+func hooksDir(dir string) (string, error) {
+	out, err := gitrunner.NewCommand("rev-parse", "--git-path", "hooks").Dir(dir).Output()
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", dir)
+	}
+	p := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return filepath.Clean(p), nil
+}
+
+// manager guesses which tool installed the hook at p.
+func manager(hooksDir, p string) string {
+	if strings.Contains(filepath.ToSlash(hooksDir), "/.husky") {
+		return "husky"
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 2048)
+	n, _ := f.Read(head)
+	text := string(head[:n])
+	switch {
+	case strings.Contains(text, "husky"):
+		return "husky"
+	case strings.Contains(text, "File generated by pre-commit"):
+		return "pre-commit"
+	case strings.Contains(text, "lefthook"):
+		return "lefthook"
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package githooks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestListAndDisable(t *testing.T) {
+	dir := t.TempDir()
+	if out, err := git(t, dir, "init", "-q"); err != nil {
+		t.Fatal(err, out)
+	}
+	hooks := filepath.Join(dir, ".git", "hooks")
+	os.MkdirAll(hooks, 0755)
+	os.WriteFile(filepath.Join(hooks, "pre-commit"), []byte("#!/bin/sh\n# File generated by pre-commit: https://pre-commit.com\necho blocked; exit 1\n"), 0755)
+	os.WriteFile(filepath.Join(hooks, "commit-msg"), []byte("#!/bin/sh\nexit 0\n"), 0644) // not executable
+	os.WriteFile(filepath.Join(hooks, "pre-push.sample"), []byte("#!/bin/sh\n"), 0755)
+
+	info, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Hooks) != 2 || info.Hooks[1].Name != "pre-commit" || info.Hooks[1].Manager != "pre-commit" || info.Hooks[0].Executable {
+		t.Errorf("hooks = %+v", info.Hooks)
+	}
+	if strings.Join(info.CommitHooks, ",") != "pre-commit" || info.Disabled {
+		t.Errorf("commit hooks = %v, disabled %v", info.CommitHooks, info.Disabled)
+	}
+	if _, content, err := Content(dir, "pre-commit"); err != nil || !strings.Contains(content, "blocked") {
+		t.Errorf("content = %q, %v", content, err)
+	}
+	if _, _, err := Content(dir, "../config"); !os.IsNotExist(err) {
+		t.Errorf("content outside the hooks: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	git(t, dir, "add", "a.txt")
+	commit := func() error {
+		_, err := git(t, dir, append(CommitArgs(dir), "commit", "-q", "-m", "m")...)
+		return err
+	}
+	if err := commit(); err == nil {
+		t.Fatal("the pre-commit hook did not run")
+	}
+
+	if err := SetDisabled(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := List(dir); !info.Disabled || len(info.CommitHooks) != 0 {
+		t.Errorf("after disabling: %+v", info)
+	}
+	if err := commit(); err != nil {
+		t.Errorf("commit with hooks disabled: %v", err)
+	}
+
+	if err := SetDisabled(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDisabled(dir, false); err != nil {
+		t.Errorf("enabling twice: %v", err)
+	}
+	if Disabled(dir) || CommitArgs(dir) != nil {
+		t.Error("hooks still disabled")
+	}
+}
+
+func TestHusky(t *testing.T) {
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	os.MkdirAll(filepath.Join(dir, ".husky", "_"), 0755)
+	os.WriteFile(filepath.Join(dir, ".husky", "_", "pre-commit"), []byte("#!/bin/sh\n. \"$(dirname \"$0\")/h\"\n"), 0755)
+	git(t, dir, "config", "core.hooksPath", ".husky/_")
+
+	info, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.HooksPath != ".husky/_" || len(info.Hooks) != 1 || info.Hooks[0].Manager != "husky" {
+		t.Errorf("info = %+v", info)
+	}
+}
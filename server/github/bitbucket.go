@@ -0,0 +1,156 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/gitutil"
+)
+
+// bitbucketForge is a Bitbucket Cloud repository.
+type bitbucketForge struct {
+	c    *client
+	repo string // workspace/name
+}
+
+// bbPull is the part of Bitbucket's pull request object we use.
+type bbPull struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Draft       bool   `json:"draft"`
+	CreatedOn   string `json:"created_on"`
+	UpdatedOn   string `json:"updated_on"`
+	Author      struct {
+		Nickname    string `json:"nickname"`
+		DisplayName string `json:"display_name"`
+	} `json:"author"`
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+		Commit struct {
+			Hash string `json:"hash"` // abbreviated
+		} `json:"commit"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"destination"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+func (p bbPull) toPullRequest() PullRequest {
+	author := p.Author.Nickname
+	if author == "" {
+		author = p.Author.DisplayName
+	}
+	return PullRequest{
+		Forge:     gitutil.ForgeBitbucket,
+		Number:    p.ID,
+		Title:     p.Title,
+		Body:      p.Description,
+		Author:    author,
+		Draft:     p.Draft,
+		HeadRef:   p.Source.Branch.Name,
+		HeadSHA:   p.Source.Commit.Hash,
+		BaseRef:   p.Destination.Branch.Name,
+		HTMLURL:   p.Links.HTML.Href,
+		CreatedAt: p.CreatedOn,
+		UpdatedAt: p.UpdatedOn,
+	}
+}
+
+func (f *bitbucketForge) pullPath(number int) string {
+	return fmt.Sprintf("/repositories/%s/pullrequests/%d", f.repo, number)
+}
+
+func (f *bitbucketForge) listPulls(ctx context.Context) ([]PullRequest, error) {
+	var page struct {
+		Values []bbPull `json:"values"`
+	}
+	if err := f.c.call(ctx, http.MethodGet, "/repositories/"+f.repo+"/pullrequests?state=OPEN&pagelen=50", nil, &page); err != nil {
+		return nil, err
+	}
+	pulls := make([]PullRequest, 0, len(page.Values))
+	for _, p := range page.Values {
+		pulls = append(pulls, p.toPullRequest())
+	}
+	return pulls, nil
+}
+
+func (f *bitbucketForge) getPull(ctx context.Context, number int) (*PullRequest, string, error) {
+	var p bbPull
+	if err := f.c.call(ctx, http.MethodGet, f.pullPath(number), nil, &p); err != nil {
+		return nil, "", err
+	}
+	diff, err := f.c.text(ctx, f.pullPath(number)+"/diff", "text/plain")
+	if err != nil {
+		return nil, "", err
+	}
+	pr := p.toPullRequest()
+	return &pr, diff, nil
+}
+
+// postReview posts the comments as inline comments, the body as a general
+// comment and then approves or requests changes if asked.
+func (f *bitbucketForge) postReview(ctx context.Context, number int, req *ReviewRequest) (*Review, error) {
+	path := f.pullPath(number)
+	var p bbPull
+	if err := f.c.call(ctx, http.MethodGet, path, nil, &p); err != nil {
+		return nil, err
+	}
+	// Bitbucket reports an abbreviated hash
+	if req.CommitID != "" && !strings.HasPrefix(req.CommitID, p.Source.Commit.Hash) {
+		return nil, &forgeError{forge: f.c.forge, status: http.StatusUnprocessableEntity, body: "commit_id is not the head of the pull request, it was updated since"}
+	}
+
+	for i, c := range req.Comments {
+		comment := map[string]interface{}{
+			"content": map[string]string{"raw": c.Body},
+			"inline":  map[string]interface{}{"path": c.Path, "to": c.Line},
+		}
+		if err := f.c.call(ctx, http.MethodPost, path+"/comments", comment, nil); err != nil {
+			return nil, fmt.Errorf("comment %d: %w", i+1, err)
+		}
+	}
+
+	review := &Review{State: "COMMENTED", HTMLURL: p.Links.HTML.Href}
+	if strings.TrimSpace(req.Body) != "" {
+		var posted struct {
+			ID    int64 `json:"id"`
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		}
+		if err := f.c.call(ctx, http.MethodPost, path+"/comments", map[string]interface{}{"content": map[string]string{"raw": req.Body}}, &posted); err != nil {
+			return nil, err
+		}
+		review.ID = posted.ID
+		if posted.Links.HTML.Href != "" {
+			review.HTMLURL = posted.Links.HTML.Href
+		}
+	}
+	switch req.Event {
+	case "APPROVE":
+		if err := f.c.call(ctx, http.MethodPost, path+"/approve", nil, nil); err != nil {
+			return nil, err
+		}
+		review.State = "APPROVED"
+	case "REQUEST_CHANGES":
+		if err := f.c.call(ctx, http.MethodPost, path+"/request-changes", nil, nil); err != nil {
+			return nil, err
+		}
+		review.State = "CHANGES_REQUESTED"
+	}
+	return review, nil
+}
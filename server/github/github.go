@@ -20,6 +20,7 @@ import (
 	"github.com/xhd2015/ai-critic/server/encrypt"
 	"github.com/xhd2015/ai-critic/server/projects"
 	"github.com/xhd2015/ai-critic/server/proxy/proxyselect"
+	"github.com/xhd2015/ai-critic/server/quota"
 )
 
 // OAuthConfig holds the GitHub OAuth configuration
@@ -119,10 +120,14 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/github/oauth-token", handleOAuthToken)
 	mux.HandleFunc("/api/github/repos", handleListRepos)
 	mux.HandleFunc("/api/github/clone", handleClone)
+	mux.HandleFunc("/api/projects/clone", handleProjectClone)
 	mux.HandleFunc("/api/ssh-keys/test", handleTestSSHKey)
 
 	// Git operations (fetch, pull)
 	registerGitOpsAPI(mux)
+
+	// Pull requests of a local clone's origin
+	registerPullsAPI(mux)
 }
 
 // handleOAuthConfig handles GET (retrieve) and POST (save) OAuth config
@@ -327,6 +332,10 @@ func handleClone(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: "repo_url is required"})
 		return
 	}
+	if err := quota.CheckDisk(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
 
 	// Prepare SSH key if using SSH
 	var keyFile *SSHKeyFile
@@ -374,19 +383,53 @@ func handleClone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	streamClone(w, r, cloneSpec{
+		repoURL:   req.RepoURL,
+		targetDir: targetDir,
+		name:      extractRepoName(req.RepoURL),
+		keyFile:   keyFile,
+		sshKeyID:  req.SSHKeyID,
+		useSSH:    req.UseSSH,
+	})
+}
+
+// cloneSpec is a clone streamed to the client and registered as a project.
+type cloneSpec struct {
+	repoURL   string
+	branch    string // empty for the remote's default branch
+	targetDir string
+	name      string
+	keyFile   *SSHKeyFile
+	sshKeyID  string
+	useSSH    bool
+	// removeOnFailure removes targetDir when the clone fails; set for
+	// directories we chose.
+	removeOnFailure bool
+}
+
+// streamClone clones c.repoURL, streaming git's progress as SSE, and
+// registers the clone in the request tenant's projects. The done event
+// carries dir and projectId.
+func streamClone(w http.ResponseWriter, r *http.Request, c cloneSpec) {
 	// Build git clone command using gitrunner to ensure proper environment
 	var keyPath string
-	if keyFile != nil {
-		keyPath = keyFile.Path
+	if c.keyFile != nil {
+		keyPath = c.keyFile.Path
+	}
+	gc := gitrunner.Clone(c.repoURL, c.targetDir, keyPath)
+	if c.branch != "" {
+		gc = gitrunner.NewCommand("clone", "--progress", "--branch", c.branch, "--", c.repoURL, c.targetDir)
+		if keyPath != "" {
+			gc = gc.WithSSHKey(keyPath)
+		}
 	}
-	gc := gitrunner.Clone(req.RepoURL, targetDir, keyPath)
 
 	// Auto-select a proxy from the server's saved proxy settings when
 	// the target host matches one of the configured domains. Explicit
 	// per-request overrides aren't supported for this endpoint today;
 	// callers that want to bypass the auto-selection would need to do
 	// so in the proxy settings.
-	proxy := proxyselect.ForRepoURL("", req.RepoURL)
+	proxy := proxyselect.ForRepoURL("", c.repoURL)
 	if proxy.URL != "" {
 		gc = gc.WithEnv("https_proxy", proxy.URL).WithEnv("HTTPS_PROXY", proxy.URL)
 	}
@@ -401,43 +444,52 @@ func handleClone(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log the clone command for diagnostics
-	sw.SendLog(fmt.Sprintf("$ git clone --progress %s %s", req.RepoURL, targetDir))
+	if c.branch != "" {
+		sw.SendLog(fmt.Sprintf("$ git clone --progress --branch %s %s %s", c.branch, c.repoURL, c.targetDir))
+	} else {
+		sw.SendLog(fmt.Sprintf("$ git clone --progress %s %s", c.repoURL, c.targetDir))
+	}
 	if proxy.Note != "" {
 		sw.SendLog(proxy.Note)
 	}
-	if keyFile != nil {
-		sw.SendLog(fmt.Sprintf("Using SSH key: %s (%d bytes)", keyFile.KeyType, keyFile.Size))
+	if c.keyFile != nil {
+		sw.SendLog(fmt.Sprintf("Using SSH key: %s (%d bytes)", c.keyFile.KeyType, c.keyFile.Size))
 	}
 
 	cloneErr := sw.StreamCmd(cmd)
 
 	if cloneErr != nil {
+		if c.removeOnFailure {
+			os.RemoveAll(c.targetDir)
+		}
 		sw.SendError(fmt.Sprintf("Clone failed: %v", cloneErr))
 		return
 	}
 
 	// Save project to store
-	repoName := extractRepoName(req.RepoURL)
 	var projectID string
-	if id, saveErr := projects.Add(projects.Project{
-		Name:     repoName,
-		RepoURL:  req.RepoURL,
-		Dir:      targetDir,
-		SSHKeyID: req.SSHKeyID,
-		UseSSH:   req.UseSSH,
+	if id, saveErr := projects.ForContext(r.Context()).Add(projects.Project{
+		Name:     c.name,
+		RepoURL:  c.repoURL,
+		Dir:      c.targetDir,
+		SSHKeyID: c.sshKeyID,
+		UseSSH:   c.useSSH,
 	}); saveErr != nil {
 		fmt.Printf("[GitHub] Warning: failed to save project: %v\n", saveErr)
 	} else {
 		projectID = id
 	}
 
-	sw.SendDone(map[string]string{"dir": targetDir, "projectId": projectID})
+	sw.SendDone(map[string]string{"dir": c.targetDir, "projectId": projectID})
 }
 
 // SSHTestRequest is sent by the frontend to test an SSH key
 type SSHTestRequest struct {
 	Host       string `json:"host"`
 	PrivateKey string `json:"private_key"`
+	// User is the SSH user, "git" when empty; some GitLab instances use
+	// "gitlab".
+	User string `json:"user,omitempty"`
 }
 
 // SSHTestResponse is returned after testing an SSH key
@@ -471,7 +523,11 @@ func handleTestSSHKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sw.SendLog(fmt.Sprintf("Testing SSH connection to git@%s...", req.Host))
+	user := req.User
+	if user == "" {
+		user = "git"
+	}
+	sw.SendLog(fmt.Sprintf("Testing SSH connection to %s@%s...", user, req.Host))
 
 	// Prepare SSH key (decrypt, normalize, validate, write to temp file)
 	keyFile, err := PrepareSSHKeyFile(req.PrivateKey)
@@ -491,7 +547,7 @@ func handleTestSSHKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run ssh -vT git@<host> to test connection (verbose for diagnostics)
+	// Run ssh -vT <user>@<host> to test connection (verbose for diagnostics)
 	// Use BatchMode=yes and SSH_ASKPASS_REQUIRE=never to prevent password prompts
 	cmd := exec.Command("ssh", "-v", "-T",
 		"-i", keyFile.Path,
@@ -499,14 +555,17 @@ func handleTestSSHKey(w http.ResponseWriter, r *http.Request) {
 		"-o", "UserKnownHostsFile=/dev/null",
 		"-o", "ConnectTimeout=10",
 		"-o", "BatchMode=yes",
-		fmt.Sprintf("git@%s", req.Host),
+		fmt.Sprintf("%s@%s", user, req.Host),
 	)
 	cmd.Env = append(os.Environ(), "SSH_ASKPASS_REQUIRE=never")
 
-	// Track success by inspecting output lines
+	// Track success by inspecting output lines: GitHub greets with "Hi",
+	// GitLab with "Welcome to GitLab" and Bitbucket says "authenticated via
+	// ssh key"
 	success := false
 	err = sw.StreamCmdFunc(cmd, func(line string) bool {
 		if strings.Contains(line, "successfully authenticated") ||
+			strings.Contains(line, "authenticated via ssh key") ||
 			strings.Contains(line, "Welcome to") ||
 			strings.Contains(line, "Hi ") {
 			success = true
@@ -514,7 +573,7 @@ func handleTestSSHKey(w http.ResponseWriter, r *http.Request) {
 		return true // always send as log
 	})
 
-	// ssh -T to GitHub returns exit code 1 even on success
+	// ssh -T to GitHub and Bitbucket returns exit code 1 even on success
 	if err != nil && !success {
 		sw.SendDone(map[string]string{"message": "SSH connection failed", "success": "false"})
 		return
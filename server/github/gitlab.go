@@ -0,0 +1,196 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/gitutil"
+)
+
+// gitlabForge is a project on a GitLab instance; its pull requests are
+// merge requests.
+type gitlabForge struct {
+	c       *client
+	project string // URL-escaped path, GitLab's project ID
+}
+
+// glMergeRequest is the part of GitLab's merge request object we use.
+type glMergeRequest struct {
+	IID            int    `json:"iid"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	Draft          bool   `json:"draft"`
+	WorkInProgress bool   `json:"work_in_progress"` // before GitLab 14
+	WebURL         string `json:"web_url"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+	SHA            string `json:"sha"`
+	SourceBranch   string `json:"source_branch"`
+	TargetBranch   string `json:"target_branch"`
+	Author         struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	DiffRefs struct {
+		BaseSHA  string `json:"base_sha"`
+		HeadSHA  string `json:"head_sha"`
+		StartSHA string `json:"start_sha"`
+	} `json:"diff_refs"`
+}
+
+func (m glMergeRequest) toPullRequest() PullRequest {
+	return PullRequest{
+		Forge:     gitutil.ForgeGitLab,
+		Number:    m.IID,
+		Title:     m.Title,
+		Body:      m.Description,
+		Author:    m.Author.Username,
+		Draft:     m.Draft || m.WorkInProgress,
+		HeadRef:   m.SourceBranch,
+		HeadSHA:   m.SHA,
+		BaseRef:   m.TargetBranch,
+		HTMLURL:   m.WebURL,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// glDiff is one file of a merge request diff.
+type glDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	AMode       string `json:"a_mode"`
+	BMode       string `json:"b_mode"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	Diff        string `json:"diff"`
+}
+
+// glDiffsPerPage is the page size of the diffs call, GitLab's maximum.
+const glDiffsPerPage = 100
+
+func (f *gitlabForge) mrPath(number int) string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%d", f.project, number)
+}
+
+func (f *gitlabForge) listPulls(ctx context.Context) ([]PullRequest, error) {
+	var mrs []glMergeRequest
+	if err := f.c.call(ctx, http.MethodGet, "/projects/"+f.project+"/merge_requests?state=opened&per_page=100", nil, &mrs); err != nil {
+		return nil, err
+	}
+	pulls := make([]PullRequest, 0, len(mrs))
+	for _, m := range mrs {
+		pulls = append(pulls, m.toPullRequest())
+	}
+	return pulls, nil
+}
+
+func (f *gitlabForge) getPull(ctx context.Context, number int) (*PullRequest, string, error) {
+	var m glMergeRequest
+	if err := f.c.call(ctx, http.MethodGet, f.mrPath(number), nil, &m); err != nil {
+		return nil, "", err
+	}
+	diff, err := f.diff(ctx, number)
+	if err != nil {
+		return nil, "", err
+	}
+	pr := m.toPullRequest()
+	return &pr, diff, nil
+}
+
+// diff assembles the unified diff of a merge request from its per-file
+// diffs, which carry the hunks but not the file headers.
+func (f *gitlabForge) diff(ctx context.Context, number int) (string, error) {
+	var b strings.Builder
+	for page := 1; ; page++ {
+		var diffs []glDiff
+		path := fmt.Sprintf("%s/diffs?page=%d&per_page=%d", f.mrPath(number), page, glDiffsPerPage)
+		if err := f.c.call(ctx, http.MethodGet, path, nil, &diffs); err != nil {
+			return "", err
+		}
+		for _, d := range diffs {
+			writeGitLabDiff(&b, d)
+		}
+		if b.Len() > maxDiffBytes {
+			return "", f.c.tooLarge()
+		}
+		if len(diffs) < glDiffsPerPage {
+			return b.String(), nil
+		}
+	}
+}
+
+func writeGitLabDiff(b *strings.Builder, d glDiff) {
+	fmt.Fprintf(b, "diff --git a/%s b/%s\n", d.OldPath, d.NewPath)
+	oldName, newName := "a/"+d.OldPath, "b/"+d.NewPath
+	switch {
+	case d.NewFile:
+		fmt.Fprintf(b, "new file mode %s\n", d.BMode)
+		oldName = "/dev/null"
+	case d.DeletedFile:
+		fmt.Fprintf(b, "deleted file mode %s\n", d.AMode)
+		newName = "/dev/null"
+	case d.RenamedFile:
+		fmt.Fprintf(b, "rename from %s\nrename to %s\n", d.OldPath, d.NewPath)
+	}
+	// mode changes, pure renames and binary files have no hunks
+	if d.Diff == "" {
+		return
+	}
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", oldName, newName)
+	b.WriteString(d.Diff)
+	if !strings.HasSuffix(d.Diff, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// postReview posts the comments as diff discussions, the body as a note and
+// approves if asked; GitLab has no review object grouping them.
+func (f *gitlabForge) postReview(ctx context.Context, number int, req *ReviewRequest) (*Review, error) {
+	if req.Event == "REQUEST_CHANGES" {
+		return nil, fmt.Errorf("%w: GitLab merge requests take COMMENT or APPROVE", errUnsupportedEvent)
+	}
+	path := f.mrPath(number)
+	var m glMergeRequest
+	if err := f.c.call(ctx, http.MethodGet, path, nil, &m); err != nil {
+		return nil, err
+	}
+	if req.CommitID != "" && req.CommitID != m.SHA {
+		return nil, &forgeError{forge: f.c.forge, status: http.StatusUnprocessableEntity, body: "commit_id is not the head of the merge request, it was updated since"}
+	}
+
+	for i, c := range req.Comments {
+		position := map[string]interface{}{
+			"position_type": "text",
+			"base_sha":      m.DiffRefs.BaseSHA,
+			"start_sha":     m.DiffRefs.StartSHA,
+			"head_sha":      m.DiffRefs.HeadSHA,
+			"new_path":      c.Path,
+			"new_line":      c.Line,
+		}
+		if err := f.c.call(ctx, http.MethodPost, path+"/discussions", map[string]interface{}{"body": c.Body, "position": position}, nil); err != nil {
+			return nil, fmt.Errorf("comment %d: %w", i+1, err)
+		}
+	}
+
+	review := &Review{State: "COMMENTED", HTMLURL: m.WebURL}
+	if strings.TrimSpace(req.Body) != "" {
+		var note struct {
+			ID int64 `json:"id"`
+		}
+		if err := f.c.call(ctx, http.MethodPost, path+"/notes", map[string]string{"body": req.Body}, &note); err != nil {
+			return nil, err
+		}
+		review.ID = note.ID
+		review.HTMLURL = fmt.Sprintf("%s#note_%d", m.WebURL, note.ID)
+	}
+	if req.Event == "APPROVE" {
+		if err := f.c.call(ctx, http.MethodPost, path+"/approve", map[string]string{"sha": m.SHA}, nil); err != nil {
+			return nil, err
+		}
+		review.State = "APPROVED"
+	}
+	return review, nil
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/gitutil"
 	"github.com/xhd2015/ai-critic/server/projects"
 	"github.com/xhd2015/ai-critic/server/proxy/proxyselect"
 )
@@ -24,6 +26,9 @@ type gitOpRequest struct {
 	// Optional: encrypted SSH key from browser.
 	// If empty, uses the project's configured SSH key (looked up from browser storage via ssh_key_id).
 	SSHKey string `json:"ssh_key,omitempty"`
+	// Optional: SSH user for an HTTPS origin used with SSHKey, "git" when
+	// empty; some GitLab instances use "gitlab".
+	SSHUser string `json:"ssh_user,omitempty"`
 }
 
 func handleGitFetch(w http.ResponseWriter, r *http.Request) {
@@ -64,7 +69,7 @@ func runGitOp(w http.ResponseWriter, r *http.Request, gitCmd string, gitArgs ...
 	}
 
 	// Look up project
-	projectList, err := projects.List()
+	projectList, err := projects.ForContext(r.Context()).List()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to list projects: %v", err), http.StatusInternalServerError)
 		return
@@ -133,6 +138,18 @@ func runGitOp(w http.ResponseWriter, r *http.Request, gitCmd string, gitArgs ...
 		sw.SendLog(fmt.Sprintf("$ git %s %s", gitCmd, project.Dir))
 	}
 
+	// A key only works over SSH: an HTTPS origin of any forge is rewritten
+	// to its SSH form for this command, through the environment so the
+	// remote-tracking refs of origin stay as they are.
+	if keyFile != nil {
+		if origin, sshURL := sshOrigin(project.Dir, req.SSHUser); sshURL != "" {
+			gc = gc.WithEnv("GIT_CONFIG_COUNT", "1").
+				WithEnv("GIT_CONFIG_KEY_0", "url."+sshURL+".insteadOf").
+				WithEnv("GIT_CONFIG_VALUE_0", origin)
+			sw.SendLog(fmt.Sprintf("Using SSH for the HTTPS origin: %s", sshURL))
+		}
+	}
+
 	if proxy.URL != "" {
 		gc = gc.WithEnv("https_proxy", proxy.URL).WithEnv("HTTPS_PROXY", proxy.URL)
 	}
@@ -148,6 +165,16 @@ func runGitOp(w http.ResponseWriter, r *http.Request, gitCmd string, gitArgs ...
 	cmdErr := sw.StreamCmd(cmd)
 	if cmdErr != nil {
 		sw.SendError(fmt.Sprintf("git %s failed: %v", gitCmd, cmdErr))
+		// a conflicted pull leaves a merge or rebase to finish via
+		// /api/review/conflicts
+		if gitCmd == "pull" {
+			if out, err := gitrunner.Diff("--name-only", "--diff-filter=U").Dir(project.Dir).Output(); err == nil && len(out) > 0 {
+				sw.SendDone(map[string]string{
+					"success":   "false",
+					"conflicts": strings.TrimSpace(string(out)),
+				})
+			}
+		}
 		return
 	}
 
@@ -155,3 +182,20 @@ func runGitOp(w http.ResponseWriter, r *http.Request, gitCmd string, gitArgs ...
 		"message": fmt.Sprintf("git %s completed successfully", gitCmd),
 	})
 }
+
+// sshOrigin returns the origin URL of dir and its SSH form, or an empty SSH
+// URL when origin already is SSH or has none.
+func sshOrigin(dir, sshUser string) (origin, sshURL string) {
+	out, err := gitrunner.NewCommand("remote", "get-url", "origin").Dir(dir).Output()
+	if err != nil {
+		return "", ""
+	}
+	origin = strings.TrimSpace(string(out))
+	if gitutil.IsSSH(origin) {
+		return origin, ""
+	}
+	if sshURL = gitutil.ToSSH(origin, sshUser); sshURL == origin {
+		return origin, ""
+	}
+	return origin, sshURL
+}
@@ -0,0 +1,124 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+	"github.com/xhd2015/ai-critic/server/quota"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// ProjectCloneRequest is the body of POST /api/projects/clone.
+type ProjectCloneRequest struct {
+	RepoURL string `json:"repo_url"`
+	// Branch to check out; the remote's default branch when empty.
+	Branch string `json:"branch,omitempty"`
+	// Name of the project and its workspace directory; the repository
+	// name when empty.
+	Name string `json:"name,omitempty"`
+	// SSHKey is the encrypted private key; the clone uses SSH when set.
+	SSHKey   string `json:"ssh_key,omitempty"`
+	SSHKeyID string `json:"ssh_key_id,omitempty"`
+}
+
+// handleProjectClone clones a repository into a new directory of the
+// tenant's workspace (see projects.Workspace) and registers it as a
+// project, streaming progress like /api/github/clone. The name cannot leave
+// the workspace, which the projects of members must be in.
+//
+//	POST /api/projects/clone {repo_url, branch, name, ssh_key, ssh_key_id} -> SSE, done {dir, projectId}
+func handleProjectClone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ProjectCloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: "Invalid request body"})
+		return
+	}
+	req.RepoURL = strings.TrimSpace(req.RepoURL)
+	if req.RepoURL == "" {
+		writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: "repo_url is required"})
+		return
+	}
+	// both are passed to git as arguments
+	if strings.HasPrefix(req.RepoURL, "-") || strings.HasPrefix(req.Branch, "-") || strings.ContainsAny(req.Branch, " \t\n") {
+		writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: "invalid repo_url or branch"})
+		return
+	}
+	name := req.Name
+	if name == "" {
+		name = extractRepoName(req.RepoURL)
+	}
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: fmt.Sprintf("invalid name %q", name)})
+		return
+	}
+	if err := quota.CheckDisk(r.Context()); err != nil {
+		quota.WriteError(w, err)
+		return
+	}
+
+	var keyFile *SSHKeyFile
+	if req.SSHKey != "" {
+		var err error
+		keyFile, err = PrepareSSHKeyFile(req.SSHKey)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, CloneResponse{Status: "error", Error: err.Error()})
+			return
+		}
+		defer keyFile.Cleanup()
+		req.RepoURL = convertToSSHURL(req.RepoURL)
+	}
+
+	workspace, err := filepath.Abs(projects.Workspace(tenant.Name(r.Context())))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, CloneResponse{Status: "error", Error: err.Error()})
+		return
+	}
+	targetDir, err := reserveDir(workspace, name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, CloneResponse{Status: "error", Error: err.Error()})
+		return
+	}
+
+	streamClone(w, r, cloneSpec{
+		repoURL:         req.RepoURL,
+		branch:          req.Branch,
+		targetDir:       targetDir,
+		name:            filepath.Base(targetDir),
+		keyFile:         keyFile,
+		sshKeyID:        req.SSHKeyID,
+		useSSH:          keyFile != nil,
+		removeOnFailure: true,
+	})
+}
+
+// reserveDir creates an empty directory for name under parent, adding -2,
+// -3, ... to the name while it is taken. git clones into empty directories.
+func reserveDir(parent, name string) (string, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	for i := 1; i <= 100; i++ {
+		dir := filepath.Join(parent, name)
+		if i > 1 {
+			dir = fmt.Sprintf("%s-%d", dir, i)
+		}
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free directory for %s in %s", name, parent)
+}
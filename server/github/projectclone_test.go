@@ -0,0 +1,74 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+func TestProjectClone(t *testing.T) {
+	t.Chdir(t.TempDir()) // the workspace and registry live under the working directory
+
+	// an upstream with a main and a dev branch
+	upstream := filepath.Join(t.TempDir(), "app")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", upstream},
+		{"-C", upstream, "commit", "-q", "--allow-empty", "-m", "v1"},
+		{"-C", upstream, "branch", "dev"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	clone := func(body string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/projects/clone", handleProjectClone)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/projects/clone", strings.NewReader(body)))
+		return rec
+	}
+	branch := func(dir string) string {
+		out, _ := exec.Command("git", "-C", dir, "branch", "--show-current").Output()
+		return strings.TrimSpace(string(out))
+	}
+
+	rec := clone(`{"repo_url":"` + upstream + `","branch":"dev"}`)
+	first, _ := filepath.Abs(".ai-critic/workspaces/app")
+	if !strings.Contains(rec.Body.String(), `"type":"done"`) || branch(first) != "dev" {
+		t.Fatalf("clone: %s", rec.Body)
+	}
+	p, err := projects.FindByDir(first)
+	if err != nil || p == nil || p.Name != "app" || p.RepoURL != upstream {
+		t.Errorf("registered %+v, %v", p, err)
+	}
+
+	// the name is taken: the second clone goes next to it
+	rec = clone(`{"repo_url":"` + upstream + `"}`)
+	if second := first + "-2"; !strings.Contains(rec.Body.String(), second) || branch(second) != "main" {
+		t.Errorf("second clone: %s", rec.Body)
+	}
+
+	// a failed clone leaves nothing behind
+	rec = clone(`{"repo_url":"` + upstream + `","branch":"nope","name":"broken"}`)
+	if !strings.Contains(rec.Body.String(), `"type":"error"`) {
+		t.Errorf("unknown branch: %s", rec.Body)
+	}
+	if _, err := os.Stat(".ai-critic/workspaces/broken"); !os.IsNotExist(err) {
+		t.Errorf("failed clone dir: %v", err)
+	}
+
+	for _, body := range []string{`{}`, `{"repo_url":"--upload-pack=x"}`, `{"repo_url":"x","name":"../up"}`, `{"repo_url":"x","branch":"-b"}`} {
+		if rec := clone(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d %s", body, rec.Code, rec.Body)
+		}
+	}
+}
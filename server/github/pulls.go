@@ -0,0 +1,502 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/gitutil"
+)
+
+// maxDiffBytes bounds the pull request diff handed to the review pipeline.
+const maxDiffBytes = 10 << 20
+
+// forgeKey is the repository config key naming the forge of a self-hosted
+// origin.
+const forgeKey = "ai-critic.forge"
+
+var (
+	// apiBaseURL is the GitHub REST API; tests point it and the others at
+	// a fake.
+	apiBaseURL = "https://api.github.com"
+	// gitlabBaseURL is the REST API of the GitLab instance at host.
+	gitlabBaseURL = func(host string) string { return "https://" + host + "/api/v4" }
+	// bitbucketBaseURL is the Bitbucket Cloud REST API.
+	bitbucketBaseURL = "https://api.bitbucket.org/2.0"
+	apiClient        = &http.Client{Timeout: 60 * time.Second}
+)
+
+// PullRequest is an open pull request of a repository; on GitLab it is a
+// merge request and Number its iid.
+type PullRequest struct {
+	// Forge is "github", "gitlab" or "bitbucket".
+	Forge     string `json:"forge"`
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	Body      string `json:"body,omitempty"`
+	Author    string `json:"author"`
+	Draft     bool   `json:"draft"`
+	HeadRef   string `json:"head_ref"`
+	HeadSHA   string `json:"head_sha"`
+	BaseRef   string `json:"base_ref"`
+	HTMLURL   string `json:"html_url"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ReviewComment is an inline comment on lines of the pull request's new
+// version; StartLine is set for a range.
+type ReviewComment struct {
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	StartLine int    `json:"start_line,omitempty"`
+	Body      string `json:"body"`
+}
+
+// ReviewRequest posts a review with inline comments to a pull request.
+// GitLab anchors a comment on a single line, the last of a range, and has
+// no REQUEST_CHANGES.
+type ReviewRequest struct {
+	Body string `json:"body"`
+	// Event is COMMENT (default), APPROVE or REQUEST_CHANGES.
+	Event string `json:"event"`
+	// CommitID is the head the comments refer to; a review of a head that
+	// has since moved is rejected, as its lines may no longer match.
+	CommitID string          `json:"commit_id,omitempty"`
+	Comments []ReviewComment `json:"comments"`
+}
+
+// Review is the posted review. Forges without review objects (GitLab,
+// Bitbucket) get the body as a comment, whose ID this is.
+type Review struct {
+	ID      int64  `json:"id"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+}
+
+// forgeError is a failed forge API call; its status is passed on.
+type forgeError struct {
+	forge  string
+	status int
+	body   string
+}
+
+func (e *forgeError) Error() string {
+	return fmt.Sprintf("%s API error: %s", e.forge, e.body)
+}
+
+// errUnsupportedEvent is a review event the forge has no equivalent for.
+var errUnsupportedEvent = errors.New("unsupported review event")
+
+// registerPullsAPI registers the pull request endpoints. dir is a local clone
+// whose origin names the repository and its forge: GitHub, GitLab (merge
+// requests) or Bitbucket, see originRemote. The forge's token is sent as for
+// /api/github/repos (Authorization: token ...); GitLab and Bitbucket get it
+// as a Bearer token, Basic credentials are passed unchanged. The diff is
+// what the review endpoints take as diffContext:
+//
+//	GET  /api/git/pulls?dir=...                    -> [PullRequest], open ones
+//	GET  /api/git/pulls/{number}?dir=...           -> {pull, diff}
+//	POST /api/git/pulls/{number}/reviews?dir=...   {ReviewRequest} -> Review
+//
+// /api/github/pulls serves the same, for clients predating other forges.
+func registerPullsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/git/pulls", handleListPulls)
+	mux.HandleFunc("/api/git/pulls/", handlePull)
+	mux.HandleFunc("/api/github/pulls", handleListPulls)
+	mux.HandleFunc("/api/github/pulls/", handlePull)
+}
+
+func handleListPulls(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, ok := pullsContext(w, r)
+	if !ok {
+		return
+	}
+	pulls, err := f.listPulls(r.Context())
+	if err != nil {
+		writeForgeError(w, err)
+		return
+	}
+	for i := range pulls {
+		pulls[i].Body = "" // listings stay small
+	}
+	writeJSON(w, http.StatusOK, pulls)
+}
+
+func handlePull(w http.ResponseWriter, r *http.Request) {
+	_, tail, _ := strings.Cut(r.URL.Path, "/pulls/")
+	numStr, rest, _ := strings.Cut(tail, "/")
+	number, err := strconv.Atoi(numStr)
+	if err != nil || number <= 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "invalid pull request number"})
+		return
+	}
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		handleGetPull(w, r, number)
+	case rest == "reviews" && r.Method == http.MethodPost:
+		handlePostReview(w, r, number)
+	case rest == "" || rest == "reviews":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func handleGetPull(w http.ResponseWriter, r *http.Request, number int) {
+	f, ok := pullsContext(w, r)
+	if !ok {
+		return
+	}
+	pull, diff, err := f.getPull(r.Context(), number)
+	if err != nil {
+		writeForgeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pull": pull, "diff": diff})
+}
+
+func handlePostReview(w http.ResponseWriter, r *http.Request, number int) {
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	f, ok := pullsContext(w, r)
+	if !ok {
+		return
+	}
+	review, err := f.postReview(r.Context(), number, &req)
+	if err != nil {
+		writeForgeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, review)
+}
+
+// validate checks req and normalizes its event.
+func (req *ReviewRequest) validate() error {
+	event := strings.ToUpper(req.Event)
+	switch event {
+	case "":
+		event = "COMMENT"
+	case "COMMENT", "APPROVE", "REQUEST_CHANGES":
+	default:
+		return fmt.Errorf("invalid event: %s", req.Event)
+	}
+	if strings.TrimSpace(req.Body) == "" && len(req.Comments) == 0 && event != "APPROVE" {
+		return errors.New("a review needs a body or comments")
+	}
+	for i, c := range req.Comments {
+		if c.Path == "" || c.Line <= 0 || strings.TrimSpace(c.Body) == "" {
+			return fmt.Errorf("comment %d: path, line and body are required", i+1)
+		}
+	}
+	req.Event = event
+	return nil
+}
+
+// payload validates req and converts it to the body of GitHub's "create a
+// review" call.
+func (req *ReviewRequest) payload() (map[string]interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	comments := make([]map[string]interface{}, 0, len(req.Comments))
+	for _, c := range req.Comments {
+		gc := map[string]interface{}{"path": c.Path, "line": c.Line, "side": "RIGHT", "body": c.Body}
+		if c.StartLine > 0 && c.StartLine < c.Line {
+			gc["start_line"] = c.StartLine
+			gc["start_side"] = "RIGHT"
+		}
+		comments = append(comments, gc)
+	}
+	payload := map[string]interface{}{"event": req.Event, "body": req.Body, "comments": comments}
+	if req.CommitID != "" {
+		payload["commit_id"] = req.CommitID
+	}
+	return payload, nil
+}
+
+// pullsContext reads the token and the repository of a pull request call,
+// answering the request itself when one is missing.
+func pullsContext(w http.ResponseWriter, r *http.Request) (forge, bool) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Authorization header required"})
+		return nil, false
+	}
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dir is required"})
+		return nil, false
+	}
+	remote, err := originRemote(dir)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	f, err := newForge(remote, token)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return f, true
+}
+
+// originRemote parses the origin of dir. The forge guessed from the host can
+// be set for a self-hosted instance with `git config ai-critic.forge gitlab`.
+func originRemote(dir string) (*gitutil.Remote, error) {
+	out, err := gitrunner.NewCommand("remote", "get-url", "origin").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("no origin remote in %s", dir)
+	}
+	remote, err := gitutil.ParseRemote(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, err
+	}
+	if out, err := gitrunner.NewCommand("config", "--get", forgeKey).Dir(dir).Output(); err == nil {
+		if err := remote.SetForge(strings.TrimSpace(string(out))); err != nil {
+			return nil, fmt.Errorf("%s: %v", forgeKey, err)
+		}
+	}
+	return remote, nil
+}
+
+// forge is the pull request API of a hosting service.
+type forge interface {
+	listPulls(ctx context.Context) ([]PullRequest, error)
+	// getPull returns the pull request and its unified diff.
+	getPull(ctx context.Context, number int) (*PullRequest, string, error)
+	// postReview posts a validated review.
+	postReview(ctx context.Context, number int, req *ReviewRequest) (*Review, error)
+}
+
+// newForge returns the API of the repository remote is on, authorized with
+// the Authorization header auth.
+func newForge(remote *gitutil.Remote, auth string) (forge, error) {
+	twoParts := strings.Count(remote.Path, "/") == 1
+	switch {
+	case remote.Forge == gitutil.ForgeGitHub && twoParts:
+		return &githubForge{
+			c:    &client{forge: "GitHub", base: apiBaseURL, auth: auth, accept: "application/vnd.github.v3+json"},
+			repo: remote.Path,
+		}, nil
+	case remote.Forge == gitutil.ForgeGitLab:
+		return &gitlabForge{
+			c:       &client{forge: "GitLab", base: gitlabBaseURL(remote.Host), auth: bearer(auth), accept: "application/json"},
+			project: url.PathEscape(remote.Path),
+		}, nil
+	case remote.Forge == gitutil.ForgeBitbucket && twoParts:
+		return &bitbucketForge{
+			c:    &client{forge: "Bitbucket", base: bitbucketBaseURL, auth: bearer(auth), accept: "application/json"},
+			repo: remote.Path,
+		}, nil
+	case remote.Forge == "":
+		return nil, fmt.Errorf("origin is not on GitHub, GitLab or Bitbucket: %s (set git config %s for a self-hosted instance)", remote.Host, forgeKey)
+	}
+	return nil, fmt.Errorf("origin is not a %s repository: %s/%s", gitutil.ForgeName(remote.Forge), remote.Host, remote.Path)
+}
+
+// bearer turns the "token ..." Authorization the UI sends into the Bearer
+// form GitLab and Bitbucket take; Basic credentials (Bitbucket app
+// passwords) pass unchanged.
+func bearer(auth string) string {
+	scheme, cred, ok := strings.Cut(auth, " ")
+	if !ok {
+		return "Bearer " + auth
+	}
+	if strings.EqualFold(scheme, "basic") {
+		return auth
+	}
+	return "Bearer " + cred
+}
+
+// githubForge is a github.com repository.
+type githubForge struct {
+	c    *client
+	repo string // owner/name
+}
+
+func (f *githubForge) listPulls(ctx context.Context) ([]PullRequest, error) {
+	var ghPulls []ghPull
+	if err := f.c.call(ctx, http.MethodGet, "/repos/"+f.repo+"/pulls?state=open&per_page=100", nil, &ghPulls); err != nil {
+		return nil, err
+	}
+	pulls := make([]PullRequest, 0, len(ghPulls))
+	for _, p := range ghPulls {
+		pulls = append(pulls, p.toPullRequest())
+	}
+	return pulls, nil
+}
+
+func (f *githubForge) getPull(ctx context.Context, number int) (*PullRequest, string, error) {
+	path := fmt.Sprintf("/repos/%s/pulls/%d", f.repo, number)
+	var p ghPull
+	if err := f.c.call(ctx, http.MethodGet, path, nil, &p); err != nil {
+		return nil, "", err
+	}
+	diff, err := f.c.text(ctx, path, "application/vnd.github.v3.diff")
+	if err != nil {
+		return nil, "", err
+	}
+	pr := p.toPullRequest()
+	return &pr, diff, nil
+}
+
+func (f *githubForge) postReview(ctx context.Context, number int, req *ReviewRequest) (*Review, error) {
+	payload, err := req.payload()
+	if err != nil {
+		return nil, err
+	}
+	var review Review
+	if err := f.c.call(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/pulls/%d/reviews", f.repo, number), payload, &review); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ghPull is the part of GitHub's pull request object we use.
+type ghPull struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Draft     bool   `json:"draft"`
+	HTMLURL   string `json:"html_url"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	User      struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func (p ghPull) toPullRequest() PullRequest {
+	return PullRequest{
+		Forge:     gitutil.ForgeGitHub,
+		Number:    p.Number,
+		Title:     p.Title,
+		Body:      p.Body,
+		Author:    p.User.Login,
+		Draft:     p.Draft,
+		HeadRef:   p.Head.Ref,
+		HeadSHA:   p.Head.SHA,
+		BaseRef:   p.Base.Ref,
+		HTMLURL:   p.HTMLURL,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// client calls the REST API of a forge.
+type client struct {
+	forge  string // display name, for errors
+	base   string
+	auth   string // Authorization header
+	accept string // media type of JSON answers
+}
+
+// text returns the plain text answer at path, such as a diff, bounded by
+// maxDiffBytes.
+func (c *client) text(ctx context.Context, path, accept string) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, nil, accept)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDiffBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxDiffBytes {
+		return "", c.tooLarge()
+	}
+	return string(data), nil
+}
+
+func (c *client) tooLarge() error {
+	return &forgeError{forge: c.forge, status: http.StatusRequestEntityTooLarge, body: fmt.Sprintf("diff is larger than %d MB", maxDiffBytes>>20)}
+}
+
+// call makes a JSON call and decodes the answer into out, if not nil.
+func (c *client) call(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := c.do(ctx, method, path, body, c.accept)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse %s response: %v", c.forge, err)
+	}
+	return nil
+}
+
+// do sends a request to the API; answers other than 2xx are returned as a
+// forgeError.
+func (c *client) do(ctx context.Context, method, path string, body interface{}, accept string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", c.auth)
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %v", c.forge, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		return nil, &forgeError{forge: c.forge, status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return resp, nil
+}
+
+func writeForgeError(w http.ResponseWriter, err error) {
+	var fe *forgeError
+	switch {
+	case errors.As(err, &fe):
+		writeJSON(w, fe.status, map[string]string{"error": err.Error()})
+	case errors.Is(err, errUnsupportedEvent):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,302 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/gitutil"
+)
+
+func TestNewForge(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string // type of the forge, empty for an error
+	}{
+		{"git@github.com:octo/app.git", "*github.githubForge"},
+		{"git@gitlab.com:group/sub/app.git", "*github.gitlabForge"},
+		{"https://bitbucket.org/ws/app.git", "*github.bitbucketForge"},
+		{"git@github.com:group/sub/app.git", ""},
+		{"git@git.example.com:team/app.git", ""},
+	}
+	for _, tt := range tests {
+		remote, err := gitutil.ParseRemote(tt.remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := newForge(remote, "token t")
+		if got := fmt.Sprintf("%T", f); (tt.want == "") != (err != nil) || (err == nil && got != tt.want) {
+			t.Errorf("%s: got %s, %v", tt.remote, got, err)
+		}
+	}
+	if f, _ := newForge(&gitutil.Remote{Host: "gitlab.com", Path: "group/sub/app", Forge: gitutil.ForgeGitLab}, "token t"); f.(*gitlabForge).project != "group%2Fsub%2Fapp" || f.(*gitlabForge).c.auth != "Bearer t" {
+		t.Errorf("gitlab forge = %+v", f)
+	}
+	if got := bearer("Basic dXNlcjpwYXNz"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("basic credentials: %s", got)
+	}
+}
+
+func TestReviewPayload(t *testing.T) {
+	req := ReviewRequest{Comments: []ReviewComment{
+		{Path: "a.go", Line: 14, StartLine: 12, Body: "range"},
+		{Path: "a.go", Line: 3, Body: "single"},
+	}}
+	p, err := req.payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := p["comments"].([]map[string]interface{})
+	if p["event"] != "COMMENT" || comments[0]["start_line"] != 12 || comments[1]["start_line"] != nil {
+		t.Errorf("payload = %+v", p)
+	}
+
+	bad := []ReviewRequest{
+		{Event: "MERGE", Body: "x"},
+		{},
+		{Comments: []ReviewComment{{Path: "a.go", Body: "no line"}}},
+	}
+	for _, req := range bad {
+		if _, err := req.payload(); err == nil {
+			t.Errorf("accepted %+v", req)
+		}
+	}
+	if _, err := (&ReviewRequest{Event: "approve"}).payload(); err != nil {
+		t.Errorf("approval without body: %v", err)
+	}
+}
+
+// cloneOf makes a repository whose origin is remote.
+func cloneOf(t *testing.T, remote string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"remote", "add", "origin", remote}} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+// serve sends a request with the token to the pull request endpoints.
+func serve(token, method, url, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	registerPullsAPI(mux)
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPullsAPI(t *testing.T) {
+	dir := cloneOf(t, "git@github.com:octo/app.git")
+
+	var posted map[string]interface{}
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		switch {
+		case r.URL.Path == "/repos/octo/app/pulls" && r.URL.Query().Get("state") == "open":
+			w.Write([]byte(`[{"number":7,"title":"Fix login","body":"long text","user":{"login":"ann"},"head":{"ref":"fix","sha":"abc"},"base":{"ref":"main"}}]`))
+		case r.URL.Path == "/repos/octo/app/pulls/7" && r.Header.Get("Accept") == "application/vnd.github.v3.diff":
+			w.Write([]byte("diff --git a/a.go b/a.go\n"))
+		case r.URL.Path == "/repos/octo/app/pulls/7":
+			w.Write([]byte(`{"number":7,"title":"Fix login","body":"long text","head":{"sha":"abc"}}`))
+		case r.URL.Path == "/repos/octo/app/pulls/7/reviews" && r.Method == http.MethodPost:
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.Write([]byte(`{"id":1,"state":"COMMENTED","html_url":"https://github.com/octo/app/pull/7#r1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+		}
+	}))
+	t.Cleanup(fake.Close)
+	saved := apiBaseURL
+	apiBaseURL = fake.URL
+	t.Cleanup(func() { apiBaseURL = saved })
+
+	do := serve
+	rec := do("t", http.MethodGet, "/api/github/pulls?dir="+dir, "")
+	var pulls []PullRequest
+	json.Unmarshal(rec.Body.Bytes(), &pulls)
+	if rec.Code != http.StatusOK || len(pulls) != 1 || pulls[0].Author != "ann" || pulls[0].HeadSHA != "abc" || pulls[0].Body != "" {
+		t.Errorf("list: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do("t", http.MethodGet, "/api/github/pulls/7?dir="+dir, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"diff":"diff --git a/a.go b/a.go\n"`) {
+		t.Errorf("get: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do("t", http.MethodPost, "/api/github/pulls/7/reviews?dir="+dir, `{"body":"LGTM","commit_id":"abc","comments":[{"path":"a.go","line":2,"body":"nit"}]}`)
+	if rec.Code != http.StatusOK || posted["commit_id"] != "abc" || posted["event"] != "COMMENT" {
+		t.Errorf("review: %d %s, posted %+v", rec.Code, rec.Body, posted)
+	}
+
+	if rec := do("bad", http.MethodGet, "/api/github/pulls?dir="+dir, ""); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Bad credentials") {
+		t.Errorf("bad token: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("", http.MethodGet, "/api/github/pulls?dir="+dir, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: %d", rec.Code)
+	}
+	if rec := do("t", http.MethodGet, "/api/github/pulls?dir="+t.TempDir(), ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("no origin: %d", rec.Code)
+	}
+	if rec := do("t", http.MethodGet, "/api/github/pulls/8?dir="+dir, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing pull: %d", rec.Code)
+	}
+}
+
+func TestGitLabMergeRequests(t *testing.T) {
+	dir := cloneOf(t, "git@git.example.com:group/sub/app.git")
+
+	var discussions, notes []map[string]interface{}
+	approved := false
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"401 Unauthorized"}`))
+			return
+		}
+		const mr = "/projects/group%2Fsub%2Fapp/merge_requests"
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch p := r.URL.EscapedPath(); {
+		case p == mr && r.URL.Query().Get("state") == "opened":
+			w.Write([]byte(`[{"iid":3,"title":"Add cache","description":"text","draft":true,"author":{"username":"bob"},"source_branch":"cache","target_branch":"main","sha":"def"}]`))
+		case p == mr+"/3/diffs":
+			w.Write([]byte(`[{"old_path":"a.go","new_path":"a.go","a_mode":"100644","b_mode":"100644","diff":"@@ -1 +1 @@\n-x\n+y\n"},{"old_path":"b.go","new_path":"b.go","b_mode":"100644","new_file":true,"diff":"@@ -0,0 +1 @@\n+z"}]`))
+		case p == mr+"/3" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"iid":3,"title":"Add cache","sha":"def","web_url":"https://git.example.com/group/sub/app/-/merge_requests/3","diff_refs":{"base_sha":"b","head_sha":"def","start_sha":"s"}}`))
+		case p == mr+"/3/discussions":
+			discussions = append(discussions, body)
+			w.Write([]byte(`{"id":"d1"}`))
+		case p == mr+"/3/notes":
+			notes = append(notes, body)
+			w.Write([]byte(`{"id":41}`))
+		case p == mr+"/3/approve":
+			approved = body["sha"] == "def"
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 Not Found"}`))
+		}
+	}))
+	t.Cleanup(fake.Close)
+	saved := gitlabBaseURL
+	gitlabBaseURL = func(host string) string { return fake.URL }
+	t.Cleanup(func() { gitlabBaseURL = saved })
+
+	// a self-hosted instance is named in the repository config
+	if rec := serve("t", http.MethodGet, "/api/git/pulls?dir="+dir, ""); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), forgeKey) {
+		t.Errorf("unknown host: %d %s", rec.Code, rec.Body)
+	}
+	if out, err := exec.Command("git", "-C", dir, "config", forgeKey, "gitlab").CombinedOutput(); err != nil {
+		t.Fatalf("%v %s", err, out)
+	}
+
+	rec := serve("t", http.MethodGet, "/api/git/pulls?dir="+dir, "")
+	var pulls []PullRequest
+	json.Unmarshal(rec.Body.Bytes(), &pulls)
+	if rec.Code != http.StatusOK || len(pulls) != 1 || pulls[0] != (PullRequest{Forge: "gitlab", Number: 3, Title: "Add cache", Author: "bob", Draft: true, HeadRef: "cache", HeadSHA: "def", BaseRef: "main"}) {
+		t.Errorf("list: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve("t", http.MethodGet, "/api/git/pulls/3?dir="+dir, "")
+	var got struct {
+		Diff string `json:"diff"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &got)
+	want := "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-x\n+y\n" +
+		"diff --git a/b.go b/b.go\nnew file mode 100644\n--- /dev/null\n+++ b/b.go\n@@ -0,0 +1 @@\n+z\n"
+	if rec.Code != http.StatusOK || got.Diff != want {
+		t.Errorf("get: %d %q", rec.Code, got.Diff)
+	}
+
+	rec = serve("t", http.MethodPost, "/api/git/pulls/3/reviews?dir="+dir, `{"body":"Looks good","event":"approve","commit_id":"def","comments":[{"path":"a.go","line":1,"body":"nit"}]}`)
+	var review Review
+	json.Unmarshal(rec.Body.Bytes(), &review)
+	if rec.Code != http.StatusOK || review.ID != 41 || review.State != "APPROVED" || !strings.HasSuffix(review.HTMLURL, "#note_41") {
+		t.Errorf("review: %d %s", rec.Code, rec.Body)
+	}
+	if len(discussions) != 1 || len(notes) != 1 || !approved {
+		t.Fatalf("posted discussions %+v, notes %+v, approved %v", discussions, notes, approved)
+	}
+	if pos := discussions[0]["position"].(map[string]interface{}); pos["head_sha"] != "def" || pos["new_line"] != float64(1) || pos["new_path"] != "a.go" {
+		t.Errorf("position = %+v", pos)
+	}
+
+	if rec := serve("t", http.MethodPost, "/api/git/pulls/3/reviews?dir="+dir, `{"body":"x","event":"REQUEST_CHANGES"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("request changes: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve("t", http.MethodPost, "/api/git/pulls/3/reviews?dir="+dir, `{"body":"x","commit_id":"old"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("moved head: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBitbucketPullRequests(t *testing.T) {
+	dir := cloneOf(t, "git@bitbucket.org:ws/app.git")
+
+	var comments []map[string]interface{}
+	requested := false
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		const pr = "/repositories/ws/app/pullrequests"
+		switch {
+		case r.URL.Path == pr && r.URL.Query().Get("state") == "OPEN":
+			w.Write([]byte(`{"values":[{"id":5,"title":"Tidy","author":{"display_name":"Cy"},"source":{"branch":{"name":"tidy"},"commit":{"hash":"0123456789ab"}},"destination":{"branch":{"name":"main"}},"links":{"html":{"href":"https://bitbucket.org/ws/app/pull-requests/5"}}}]}`))
+		case r.URL.Path == pr+"/5/diff":
+			w.Write([]byte("diff --git a/c.go b/c.go\n"))
+		case r.URL.Path == pr+"/5" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"id":5,"source":{"commit":{"hash":"0123456789ab"}},"links":{"html":{"href":"https://bitbucket.org/ws/app/pull-requests/5"}}}`))
+		case r.URL.Path == pr+"/5/comments":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			comments = append(comments, body)
+			w.Write([]byte(`{"id":9,"links":{"html":{"href":"https://bitbucket.org/ws/app/pull-requests/5#comment-9"}}}`))
+		case r.URL.Path == pr+"/5/request-changes":
+			requested = true
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(fake.Close)
+	saved := bitbucketBaseURL
+	bitbucketBaseURL = fake.URL
+	t.Cleanup(func() { bitbucketBaseURL = saved })
+
+	rec := serve("t", http.MethodGet, "/api/git/pulls?dir="+dir, "")
+	var pulls []PullRequest
+	json.Unmarshal(rec.Body.Bytes(), &pulls)
+	if rec.Code != http.StatusOK || len(pulls) != 1 || pulls[0].Forge != "bitbucket" || pulls[0].Author != "Cy" || pulls[0].HeadSHA != "0123456789ab" {
+		t.Errorf("list: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve("t", http.MethodGet, "/api/git/pulls/5?dir="+dir, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"diff":"diff --git a/c.go b/c.go\n"`) {
+		t.Errorf("get: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve("t", http.MethodPost, "/api/git/pulls/5/reviews?dir="+dir, `{"body":"Please fix","event":"REQUEST_CHANGES","commit_id":"0123456789abcdef","comments":[{"path":"c.go","line":4,"body":"typo"}]}`)
+	var review Review
+	json.Unmarshal(rec.Body.Bytes(), &review)
+	if rec.Code != http.StatusOK || review.ID != 9 || review.State != "CHANGES_REQUESTED" || !requested {
+		t.Errorf("review: %d %s", rec.Code, rec.Body)
+	}
+	if len(comments) != 2 || comments[0]["inline"].(map[string]interface{})["to"] != float64(4) || comments[1]["inline"] != nil {
+		t.Errorf("comments = %+v", comments)
+	}
+}
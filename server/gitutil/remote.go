@@ -0,0 +1,78 @@
+package gitutil
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Forges whose review APIs the server speaks.
+const (
+	ForgeGitHub    = "github"
+	ForgeGitLab    = "gitlab"
+	ForgeBitbucket = "bitbucket"
+)
+
+// Remote is a parsed repository URL.
+type Remote struct {
+	// Host is the hostname, without user or port.
+	Host string
+	// Path is the repository path without ".git", e.g. "owner/name" or
+	// "group/subgroup/name" on GitLab.
+	Path string
+	// Forge is one of the Forge constants, or empty when the host is not
+	// recognized.
+	Forge string
+}
+
+// ParseRemote parses a remote URL in any of its forms:
+// https://host/o/r.git, git@host:o/r.git or ssh://git@host:22/o/r.
+// The forge is guessed from the host: github.com, bitbucket.org, and
+// gitlab.com or any host with "gitlab" in its name; self-hosted instances
+// under other names need SetForge.
+func ParseRemote(remote string) (*Remote, error) {
+	s := strings.TrimSpace(remote)
+	var host, path string
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(s, "@"); ok && !strings.Contains(at, "/") {
+		host, path, _ = strings.Cut(rest, ":")
+	}
+	path = strings.Trim(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/")
+	if host == "" || !strings.Contains(path, "/") {
+		return nil, fmt.Errorf("not a hosted repository URL: %s", remote)
+	}
+	r := &Remote{Host: strings.ToLower(host), Path: path}
+	switch {
+	case r.Host == "github.com":
+		r.Forge = ForgeGitHub
+	case r.Host == "bitbucket.org":
+		r.Forge = ForgeBitbucket
+	case strings.Contains(r.Host, "gitlab"):
+		r.Forge = ForgeGitLab
+	}
+	return r, nil
+}
+
+// SetForge overrides the guessed forge, for self-hosted instances.
+func (r *Remote) SetForge(forge string) error {
+	switch forge {
+	case ForgeGitHub, ForgeGitLab, ForgeBitbucket:
+		r.Forge = forge
+		return nil
+	}
+	return fmt.Errorf("unknown forge: %s", forge)
+}
+
+// ForgeName is the display name of forge, e.g. "GitLab".
+func ForgeName(forge string) string {
+	switch forge {
+	case ForgeGitHub:
+		return "GitHub"
+	case ForgeGitLab:
+		return "GitLab"
+	case ForgeBitbucket:
+		return "Bitbucket"
+	}
+	return forge
+}
@@ -0,0 +1,169 @@
+package handoff
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+// qrSize is the edge length in pixels of generated QR codes.
+const qrSize = 320
+
+// RegisterAPI registers the handoff endpoints:
+//
+//	POST   /api/handoff {context, device, ttl_minutes}   save context under a new code
+//	GET    /api/handoff?code=CODE                        pick up a handoff
+//	GET    /api/handoff                                  the caller's pending handoffs
+//	DELETE /api/handoff?code=CODE                        discard a handoff
+//	GET    /api/handoff/qr?code=CODE                     PNG QR code of the handoff URL
+//	GET    /handoff/CODE                                 redirect to the saved route
+//
+// Handoffs are visible only to the user who created them. PagePath is
+// outside /api, so it checks the caller's credentials itself.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/handoff", handleHandoff)
+	mux.HandleFunc("/api/handoff/qr", handleQR)
+	mux.HandleFunc(PagePath, handlePage)
+}
+
+type handoffResponse struct {
+	Handoff
+	URL   string `json:"url"`
+	QRURL string `json:"qr_url"`
+}
+
+func newResponse(h Handoff) handoffResponse {
+	return handoffResponse{Handoff: h, URL: h.URL(), QRURL: "/api/handoff/qr?code=" + h.Code}
+}
+
+func handleHandoff(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserName(r)
+	switch r.Method {
+	case http.MethodGet:
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			handoffs := defaultManager.List(user)
+			resp := make([]handoffResponse, 0, len(handoffs))
+			for _, h := range handoffs {
+				resp = append(resp, newResponse(h))
+			}
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		h, ok := defaultManager.Get(code)
+		if !ok || h.User != user {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "handoff not found or expired"})
+			return
+		}
+		writeJSON(w, http.StatusOK, newResponse(h))
+	case http.MethodPost:
+		var req struct {
+			Context    Context `json:"context"`
+			Device     string  `json:"device"`
+			TTLMinutes float64 `json:"ttl_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		h, err := defaultManager.Create(user, req.Device, req.Context, time.Duration(req.TTLMinutes*float64(time.Minute)))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, newResponse(h))
+	case http.MethodDelete:
+		code := r.URL.Query().Get("code")
+		if h, ok := defaultManager.Get(code); !ok || h.User != user {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "handoff not found"})
+			return
+		}
+		if err := defaultManager.Delete(code); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handleQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	h, ok := defaultManager.Get(r.URL.Query().Get("code"))
+	if !ok || h.User != auth.UserName(r) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "handoff not found or expired"})
+		return
+	}
+	png, err := qrcode.Encode(baseURL(r)+h.URL(), qrcode.Medium, qrSize)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+var signInPage = template.Must(template.New("handoff").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex"><title>Continue review</title>
+<style>body{font-family:-apple-system,sans-serif;margin:0;padding:24px;background:#0f172a;color:#e2e8f0}a{color:#60a5fa}</style>
+</head><body>
+<h1 style="font-size:18px">Continue review</h1>
+<p>{{.}}</p>
+<p><a href="/">Open AI Critic</a></p>
+</body></html>`))
+
+// handlePage sends a signed-in creator to the handed-off route. Anyone else
+// learns nothing about the handoff, not even whether the code exists.
+func handlePage(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, PagePath)
+	// PagePath skips the auth middleware, so throttle token checks here
+	id, wait := auth.ThrottledIdentifyRequest(r)
+	if wait > 0 {
+		auth.WriteThrottled(w, wait)
+		return
+	}
+	if id == nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusUnauthorized)
+		signInPage.Execute(w, "Sign in on this device first, then open this link again.")
+		return
+	}
+	h, ok := defaultManager.Get(code)
+	if !ok || h.User != id.User {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNotFound)
+		signInPage.Execute(w, "This handoff code is invalid or has expired.")
+		return
+	}
+	http.Redirect(w, r, h.Context.Route, http.StatusFound)
+}
+
+// baseURL is the scheme and host the request reached the server on, so a
+// QR code scanned on another device points back through the same domain.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
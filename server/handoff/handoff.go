@@ -0,0 +1,226 @@
+// Package handoff moves a review in progress between devices: one device
+// saves its UI context (project, open file, diff position, agent session)
+// under a short code, and another picks it up by typing the code or
+// scanning its QR code.
+package handoff
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+const (
+	defaultTTL = 10 * time.Minute
+	maxTTL     = 24 * time.Hour
+
+	codeLength = 6
+	// codeAlphabet leaves out look-alikes (0/O, 1/I/L) so codes survive
+	// being read off a phone and typed on a laptop.
+	codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+	// PagePath opens a handoff in the browser; it redirects to the saved route.
+	PagePath = "/handoff/"
+)
+
+// Context is the UI state being handed off. Route is the frontend path
+// (with query) to reopen; the other fields let clients restore state the
+// route does not carry.
+type Context struct {
+	Route        string `json:"route"`
+	Project      string `json:"project,omitempty"`
+	Dir          string `json:"dir,omitempty"`
+	File         string `json:"file,omitempty"`
+	Line         int    `json:"line,omitempty"`
+	Hunk         int    `json:"hunk,omitempty"`
+	Staged       bool   `json:"staged,omitempty"`
+	AgentSession string `json:"agent_session,omitempty"`
+}
+
+// Handoff is a saved context waiting to be picked up.
+type Handoff struct {
+	Code      string  `json:"code"`
+	Context   Context `json:"context"`
+	User      string  `json:"user"` // auth.UserName of the creator
+	Device    string  `json:"device,omitempty"`
+	CreatedAt string  `json:"created_at"`
+	ExpiresAt string  `json:"expires_at"`
+}
+
+// URL is the path that opens the handoff.
+func (h Handoff) URL() string {
+	return PagePath + h.Code
+}
+
+func (h Handoff) expired(now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, h.ExpiresAt)
+	return err != nil || !now.Before(t)
+}
+
+type store struct {
+	Handoffs []Handoff `json:"handoffs"`
+}
+
+// Manager stores handoffs in handoffs.json.
+type Manager struct {
+	mu   sync.Mutex
+	file *jsonfile.JSONFile[store]
+}
+
+var defaultManager = NewManager(config.DataDir + "/handoffs.json")
+
+// NewManager creates a manager backed by the given file.
+func NewManager(path string) *Manager {
+	return &Manager{file: jsonfile.New[store](path)}
+}
+
+// Create saves ctx for user under a new code.
+func (m *Manager) Create(user, device string, ctx Context, ttl time.Duration) (Handoff, error) {
+	// the route is redirected to, so it must stay on this host
+	if !strings.HasPrefix(ctx.Route, "/") || strings.HasPrefix(ctx.Route, "//") || strings.HasPrefix(ctx.Route, "/\\") {
+		return Handoff{}, fmt.Errorf("route must be a path starting with /")
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	now := time.Now().UTC()
+	h := Handoff{
+		Context:   ctx,
+		User:      user,
+		Device:    device,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(ttl).Format(time.RFC3339),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.file.Update(func(st *store) error {
+		st.Handoffs = pruneExpired(st.Handoffs, now)
+		for {
+			code, err := newCode()
+			if err != nil {
+				return err
+			}
+			if !hasCode(st.Handoffs, code) {
+				h.Code = code
+				break
+			}
+		}
+		st.Handoffs = append(st.Handoffs, h)
+		return nil
+	})
+	if err != nil {
+		return Handoff{}, err
+	}
+	return h, nil
+}
+
+// Get returns an unexpired handoff by code. Codes are case-insensitive.
+func (m *Manager) Get(code string) (Handoff, bool) {
+	code = NormalizeCode(code)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, err := m.file.Get()
+	if err != nil {
+		return Handoff{}, false
+	}
+	now := time.Now()
+	for _, h := range st.Handoffs {
+		if h.Code == code && !h.expired(now) {
+			return h, true
+		}
+	}
+	return Handoff{}, false
+}
+
+// List returns user's unexpired handoffs, newest first.
+func (m *Manager) List(user string) []Handoff {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, err := m.file.Get()
+	if err != nil {
+		return []Handoff{}
+	}
+	active := pruneExpired(st.Handoffs, time.Now())
+	result := make([]Handoff, 0, len(active))
+	for i := len(active) - 1; i >= 0; i-- {
+		if active[i].User == user {
+			result = append(result, active[i])
+		}
+	}
+	return result
+}
+
+// Delete removes a handoff once it has been picked up or is no longer wanted.
+func (m *Manager) Delete(code string) error {
+	code = NormalizeCode(code)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := false
+	err := m.file.Update(func(st *store) error {
+		kept := st.Handoffs[:0]
+		for _, h := range st.Handoffs {
+			if h.Code == code {
+				found = true
+				continue
+			}
+			kept = append(kept, h)
+		}
+		st.Handoffs = kept
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("handoff not found")
+	}
+	return nil
+}
+
+// NormalizeCode upper-cases a code and drops separators users may type.
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func pruneExpired(handoffs []Handoff, now time.Time) []Handoff {
+	var kept []Handoff
+	for _, h := range handoffs {
+		if !h.expired(now) {
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+func hasCode(handoffs []Handoff, code string) bool {
+	for _, h := range handoffs {
+		if h.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func newCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate code: %w", err)
+		}
+		b.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,59 @@
+package handoff
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerLifecycle(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "handoffs.json"))
+
+	for _, route := range []string{"", "review", "//evil.example.com/", "/\\evil.example.com"} {
+		if _, err := m.Create("alice", "", Context{Route: route}, 0); err == nil {
+			t.Errorf("route %q accepted", route)
+		}
+	}
+
+	ctx := Context{Route: "/project/app/review?file=main.go", Dir: "/repo", File: "main.go", Line: 42, Hunk: 2, AgentSession: "s1"}
+	h, err := m.Create("alice", "phone", ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Code) != codeLength || strings.Trim(h.Code, codeAlphabet) != "" || h.URL() != "/handoff/"+h.Code {
+		t.Fatalf("unexpected handoff: %+v", h)
+	}
+
+	// codes are forgiving about case and separators
+	typed := strings.ToLower(h.Code[:3]) + "-" + h.Code[3:]
+	if got, ok := m.Get(typed); !ok || got.Context != ctx || got.Device != "phone" {
+		t.Fatalf("Get(%q) = %+v, %v", typed, got, ok)
+	}
+
+	expired, err := m.Create("alice", "", Context{Route: "/"}, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := m.Get(expired.Code); ok {
+		t.Fatalf("expired handoff still readable")
+	}
+
+	if _, err := m.Create("bob", "", Context{Route: "/"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if list := m.List("alice"); len(list) != 1 || list[0].Code != h.Code {
+		t.Fatalf("List(alice) = %+v", list)
+	}
+
+	if err := m.Delete(h.Code); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get(h.Code); ok {
+		t.Fatalf("deleted handoff still readable")
+	}
+	if err := m.Delete(h.Code); err == nil {
+		t.Fatalf("deleting twice succeeded")
+	}
+}
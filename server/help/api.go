@@ -0,0 +1,104 @@
+package help
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RegisterAPI registers the help endpoints:
+//
+//	GET /api/help                                  -> Index
+//	GET /api/help/openapi.json                     -> the OpenAPI spec
+//	GET /api/help/endpoints/{id}[?format=markdown] -> Endpoint, or its Markdown
+//	GET /api/help/context?route=/files/browse      -> ContextHelp
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/help", handleIndex)
+	mux.HandleFunc("/api/help/openapi.json", handleSpec)
+	mux.HandleFunc("/api/help/endpoints/", handleEndpoint)
+	mux.HandleFunc("/api/help/context", handleContext)
+}
+
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	index, err := GetIndex()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, index)
+}
+
+func handleSpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec())
+}
+
+func handleEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/help/endpoints/")
+	if id == "" || strings.Contains(id, "/") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "endpoint id is required"})
+		return
+	}
+	doc, err := GetEndpoint(id, baseURL(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if doc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown endpoint: " + id})
+		return
+	}
+	if r.URL.Query().Get("format") == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(Markdown(doc)))
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func handleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	route := r.URL.Query().Get("route")
+	if route == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "route is required"})
+		return
+	}
+	help, err := GetContext(route)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, help)
+}
+
+// baseURL is the scheme and host the request reached the server on, so the
+// generated curl commands work from where the docs are read.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,418 @@
+// Package help serves usage docs generated from the embedded OpenAPI spec,
+// so users of an exposed instance can learn what it offers without the
+// repository.
+//
+// The spec groups endpoints by tag. Each tag lists, under x-routes, the web
+// UI pages it belongs to; GetContext uses them to answer "what can I do here"
+// for the page the user is on.
+package help
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return specJSON
+}
+
+type spec struct {
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Tags  []specTag                           `json:"tags"`
+	Paths map[string]map[string]specOperation `json:"paths"`
+}
+
+type specTag struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Routes      []string `json:"x-routes"`
+}
+
+type specOperation struct {
+	OperationID string          `json:"operationId"`
+	Tags        []string        `json:"tags"`
+	Summary     string          `json:"summary"`
+	Description string          `json:"description"`
+	Parameters  []specParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                 `json:"required"`
+		Content  map[string]specMedia `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Description string               `json:"description"`
+		Content     map[string]specMedia `json:"content"`
+	} `json:"responses"`
+}
+
+type specParameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+	Schema      struct {
+		Type string   `json:"type"`
+		Enum []string `json:"enum"`
+	} `json:"schema"`
+	Example json.RawMessage `json:"example"`
+}
+
+type specMedia struct {
+	Example json.RawMessage `json:"example"`
+}
+
+// methods are the operations read from a path item, in display order.
+var methods = []string{"get", "post", "put", "patch", "delete"}
+
+// Parameter is one path or query parameter of an endpoint.
+type Parameter struct {
+	Name        string   `json:"name"`
+	In          string   `json:"in"`
+	Type        string   `json:"type,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Example     string   `json:"example,omitempty"`
+}
+
+// Response is one documented status of an endpoint.
+type Response struct {
+	Status      string          `json:"status"`
+	Description string          `json:"description"`
+	ContentType string          `json:"content_type,omitempty"`
+	Example     json.RawMessage `json:"example,omitempty"`
+}
+
+// Endpoint is the generated doc of one operation.
+type Endpoint struct {
+	ID          string      `json:"id"`
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	Topic       string      `json:"topic"`
+	Summary     string      `json:"summary"`
+	Description string      `json:"description,omitempty"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	// RequestExample is an example JSON body; RequestRequired tells
+	// whether a body must be sent at all.
+	RequestExample  json.RawMessage `json:"request_example,omitempty"`
+	RequestRequired bool            `json:"request_required,omitempty"`
+	Responses       []Response      `json:"responses"`
+	// Curl is a ready-to-run command against the instance that served the
+	// doc, or with a placeholder host when none was given.
+	Curl string `json:"curl"`
+}
+
+// EndpointSummary is an Endpoint as listed in a Topic.
+type EndpointSummary struct {
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Summary string `json:"summary"`
+}
+
+// Topic is a spec tag with its endpoints.
+type Topic struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Routes      []string          `json:"routes"`
+	Endpoints   []EndpointSummary `json:"endpoints"`
+}
+
+// Index lists every documented endpoint by topic.
+type Index struct {
+	Title       string  `json:"title"`
+	Version     string  `json:"version"`
+	Description string  `json:"description"`
+	Topics      []Topic `json:"topics"`
+}
+
+// ContextHelp is the help for one web UI page.
+type ContextHelp struct {
+	Route string `json:"route"`
+	// Matched is false when no topic claims the route; Topics then holds
+	// every topic.
+	Matched bool    `json:"matched"`
+	Topics  []Topic `json:"topics"`
+}
+
+type catalog struct {
+	index     Index
+	endpoints map[string]*Endpoint
+}
+
+var loadCatalog = sync.OnceValues(func() (*catalog, error) {
+	return parse(specJSON)
+})
+
+func parse(data []byte) (*catalog, error) {
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse openapi spec: %w", err)
+	}
+	c := &catalog{endpoints: make(map[string]*Endpoint)}
+	c.index.Title = s.Info.Title
+	c.index.Version = s.Info.Version
+	c.index.Description = s.Info.Description
+
+	topicIndex := make(map[string]int, len(s.Tags))
+	for i, t := range s.Tags {
+		routes := t.Routes
+		if routes == nil {
+			routes = []string{}
+		}
+		c.index.Topics = append(c.index.Topics, Topic{Name: t.Name, Description: t.Description, Routes: routes, Endpoints: []EndpointSummary{}})
+		topicIndex[t.Name] = i
+	}
+
+	paths := make([]string, 0, len(s.Paths))
+	for p := range s.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, m := range methods {
+			op, ok := s.Paths[p][m]
+			if !ok {
+				continue
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s: missing operationId", strings.ToUpper(m), p)
+			}
+			if _, dup := c.endpoints[op.OperationID]; dup {
+				return nil, fmt.Errorf("duplicate operationId %q", op.OperationID)
+			}
+			if len(op.Tags) == 0 {
+				return nil, fmt.Errorf("%s: no tag", op.OperationID)
+			}
+			ti, ok := topicIndex[op.Tags[0]]
+			if !ok {
+				return nil, fmt.Errorf("%s: undeclared tag %q", op.OperationID, op.Tags[0])
+			}
+			e := newEndpoint(strings.ToUpper(m), p, op)
+			c.endpoints[e.ID] = e
+			c.index.Topics[ti].Endpoints = append(c.index.Topics[ti].Endpoints, EndpointSummary{
+				ID: e.ID, Method: e.Method, Path: e.Path, Summary: e.Summary,
+			})
+		}
+	}
+	return c, nil
+}
+
+func newEndpoint(method, path string, op specOperation) *Endpoint {
+	e := &Endpoint{
+		ID:          op.OperationID,
+		Method:      method,
+		Path:        path,
+		Topic:       op.Tags[0],
+		Summary:     op.Summary,
+		Description: op.Description,
+	}
+	for _, p := range op.Parameters {
+		e.Parameters = append(e.Parameters, Parameter{
+			Name:        p.Name,
+			In:          p.In,
+			Type:        p.Schema.Type,
+			Enum:        p.Schema.Enum,
+			Required:    p.Required,
+			Description: p.Description,
+			Example:     exampleString(p.Example),
+		})
+	}
+	if op.RequestBody != nil {
+		e.RequestRequired = op.RequestBody.Required
+		if m, ok := op.RequestBody.Content["application/json"]; ok {
+			e.RequestExample = m.Example
+		}
+	}
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		r := op.Responses[status]
+		resp := Response{Status: status, Description: r.Description}
+		for ct, m := range r.Content {
+			resp.ContentType = ct
+			resp.Example = m.Example
+			break
+		}
+		e.Responses = append(e.Responses, resp)
+	}
+	return e
+}
+
+// exampleString renders a parameter example as it appears in a URL.
+func exampleString(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// GetIndex returns every documented endpoint by topic.
+func GetIndex() (*Index, error) {
+	c, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return &c.index, nil
+}
+
+// GetEndpoint returns the doc of the endpoint with operationId id, with its
+// curl command aimed at baseURL (e.g. "https://dev.example.com"); nil if
+// there is no such endpoint.
+func GetEndpoint(id, baseURL string) (*Endpoint, error) {
+	c, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	e, ok := c.endpoints[id]
+	if !ok {
+		return nil, nil
+	}
+	doc := *e
+	doc.Curl = curlCommand(&doc, baseURL)
+	return &doc, nil
+}
+
+// GetContext returns the topics of the web UI page at route, best match
+// first. A /project/<name> prefix is ignored, so project pages get the same
+// help as their global counterparts.
+func GetContext(route string) (*ContextHelp, error) {
+	c, err := loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	route = normalizeRoute(route)
+	type scored struct {
+		topic Topic
+		score int
+	}
+	var matches []scored
+	for _, t := range c.index.Topics {
+		best := -1
+		for _, p := range t.Routes {
+			if routeMatches(route, p) && len(p) > best {
+				best = len(p)
+			}
+		}
+		if best >= 0 {
+			matches = append(matches, scored{t, best})
+		}
+	}
+	help := &ContextHelp{Route: route, Matched: len(matches) > 0}
+	if !help.Matched {
+		help.Topics = c.index.Topics
+		return help, nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	for _, m := range matches {
+		help.Topics = append(help.Topics, m.topic)
+	}
+	return help, nil
+}
+
+func normalizeRoute(route string) string {
+	if i := strings.IndexAny(route, "?#"); i >= 0 {
+		route = route[:i]
+	}
+	route = "/" + strings.Trim(route, "/")
+	if rest, ok := strings.CutPrefix(route, "/project/"); ok {
+		route = "/"
+		if i := strings.Index(rest, "/"); i >= 0 {
+			route = rest[i:]
+		}
+	}
+	return route
+}
+
+// routeMatches reports whether route is the page pattern or below it. The
+// root pattern "/" only matches itself.
+func routeMatches(route, pattern string) bool {
+	if route == pattern {
+		return true
+	}
+	return pattern != "/" && strings.HasPrefix(route, pattern+"/")
+}
+
+// curlCommand builds a command calling e with its example values.
+func curlCommand(e *Endpoint, baseURL string) string {
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	path := e.Path
+	query := url.Values{}
+	for _, p := range e.Parameters {
+		value := p.Example
+		switch p.In {
+		case "path":
+			if value == "" {
+				value = "<" + p.Name + ">"
+			}
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(value))
+		case "query":
+			if value == "" && p.Required {
+				value = "<" + p.Name + ">"
+			}
+			if value != "" {
+				query.Set(p.Name, value)
+			}
+		}
+	}
+	u := strings.TrimRight(baseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	args := []string{"curl"}
+	if e.streams() {
+		args = append(args, "-N")
+	}
+	if e.Method != "GET" {
+		args = append(args, "-X", e.Method)
+	}
+	if e.ID != "ping" {
+		// double quotes so the shell expands the token
+		args = append(args, "-H", `"Authorization: Bearer $AI_CRITIC_TOKEN"`)
+	}
+	if len(e.RequestExample) > 0 {
+		var body bytes.Buffer
+		if err := json.Compact(&body, e.RequestExample); err == nil {
+			args = append(args, "-H", shellQuote("Content-Type: application/json"), "-d", shellQuote(body.String()))
+		}
+	}
+	args = append(args, shellQuote(u))
+	return strings.Join(args, " ")
+}
+
+// streams reports whether the endpoint answers with server-sent events.
+func (e *Endpoint) streams() bool {
+	for _, r := range e.Responses {
+		if r.ContentType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
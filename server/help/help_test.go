@@ -0,0 +1,150 @@
+package help
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSpecParses(t *testing.T) {
+	index, err := GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, topic := range index.Topics {
+		total += len(topic.Endpoints)
+		for _, e := range topic.Endpoints {
+			doc, err := GetEndpoint(e.ID, "")
+			if err != nil || doc == nil {
+				t.Fatalf("%s: doc %v, err %v", e.ID, doc, err)
+			}
+			if doc.Summary == "" || len(doc.Responses) == 0 {
+				t.Errorf("%s: missing summary or responses", e.ID)
+			}
+			if len(doc.RequestExample) > 0 && !json.Valid(doc.RequestExample) {
+				t.Errorf("%s: invalid request example", e.ID)
+			}
+		}
+	}
+	if total < 20 {
+		t.Errorf("only %d endpoints documented", total)
+	}
+}
+
+func TestParseRejectsBadSpecs(t *testing.T) {
+	for name, data := range map[string]string{
+		"no operationId": `{"tags":[{"name":"a"}],"paths":{"/x":{"get":{"tags":["a"]}}}}`,
+		"duplicate id":   `{"tags":[{"name":"a"}],"paths":{"/x":{"get":{"operationId":"x","tags":["a"]},"post":{"operationId":"x","tags":["a"]}}}}`,
+		"undeclared tag": `{"tags":[],"paths":{"/x":{"get":{"operationId":"x","tags":["a"]}}}}`,
+	} {
+		if _, err := parse([]byte(data)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestCurl(t *testing.T) {
+	doc, _ := GetEndpoint("readFile", "https://dev.example.com")
+	want := `curl -H "Authorization: Bearer $AI_CRITIC_TOKEN" 'https://dev.example.com/api/files/content?dir=%2Fhome%2Fme%2Fmy-app&path=src%2Fmain.go'`
+	if doc.Curl != want {
+		t.Errorf("curl =\n%s\nwant\n%s", doc.Curl, want)
+	}
+
+	doc, _ = GetEndpoint("reviewChat", "")
+	if !strings.HasPrefix(doc.Curl, "curl -N -X POST ") || !strings.Contains(doc.Curl, `-d '{"messages":[`) {
+		t.Errorf("chat curl = %s", doc.Curl)
+	}
+
+	doc, _ = GetEndpoint("helpEndpoint", "")
+	if !strings.Contains(doc.Curl, "/api/help/endpoints/readFile'") {
+		t.Errorf("path parameter not substituted: %s", doc.Curl)
+	}
+
+	doc, _ = GetEndpoint("ping", "")
+	if strings.Contains(doc.Curl, "Authorization") {
+		t.Errorf("ping needs no login: %s", doc.Curl)
+	}
+
+	if doc, _ := GetEndpoint("nope", ""); doc != nil {
+		t.Error("unknown endpoint found")
+	}
+}
+
+func TestContext(t *testing.T) {
+	for route, want := range map[string][]string{
+		"/project/my-app/files/browse/src": {"files", "search", "checkpoints"},
+		"/files/checkpoint/3?x=1":          {"checkpoints"},
+		"/home/settings/git":               {"usage", "projects", "scaffold"},
+		"/":                                {"review"},
+		"/project/my-app":                  {"review"},
+	} {
+		help, err := GetContext(route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, topic := range help.Topics {
+			got = append(got, topic.Name)
+		}
+		if !help.Matched || strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: matched %v, topics %v, want %v", route, help.Matched, got, want)
+		}
+	}
+
+	help, _ := GetContext("/terminal")
+	index, _ := GetIndex()
+	if help.Matched || len(help.Topics) != len(index.Topics) {
+		t.Errorf("unmatched route: matched %v, %d topics", help.Matched, len(help.Topics))
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	doc, _ := GetEndpoint("saveFile", "")
+	md := Markdown(doc)
+	for _, want := range []string{"## PUT `/api/files/content`", "### Request body", `"expected_hash": "5f2b..."`, "- **409** ", "### Try it"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/help/endpoints/listJobs", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	var doc Endpoint
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("endpoint: %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(doc.Curl, "'https://example.com/api/jobs?") {
+		t.Errorf("curl not aimed at the request host: %s", doc.Curl)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/help/endpoints/listJobs?format=markdown", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/markdown") {
+		t.Errorf("markdown content type = %q", rec.Header().Get("Content-Type"))
+	}
+
+	for path, code := range map[string]int{
+		"/api/help":                 http.StatusOK,
+		"/api/help/openapi.json":    http.StatusOK,
+		"/api/help/endpoints/nope":  http.StatusNotFound,
+		"/api/help/context":         http.StatusBadRequest,
+		"/api/help/context?route=/": http.StatusOK,
+		"/api/help/endpoints/a/b":   http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, code)
+		}
+	}
+}
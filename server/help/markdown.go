@@ -0,0 +1,69 @@
+package help
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the doc of e for display in a terminal or the help panel.
+func Markdown(e *Endpoint) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s `%s`\n\n%s\n", e.Method, e.Path, e.Summary)
+	if e.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", e.Description)
+	}
+
+	if len(e.Parameters) > 0 {
+		b.WriteString("\n### Parameters\n\n| Name | In | Type | Required | Description |\n|---|---|---|---|---|\n")
+		for _, p := range e.Parameters {
+			typ := p.Type
+			if len(p.Enum) > 0 {
+				typ = strings.Join(p.Enum, " \\| ")
+			}
+			required := ""
+			if p.Required {
+				required = "yes"
+			}
+			desc := p.Description
+			if p.Example != "" {
+				desc += fmt.Sprintf(" (e.g. `%s`)", p.Example)
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", p.Name, p.In, typ, required, desc)
+		}
+	}
+
+	if len(e.RequestExample) > 0 {
+		b.WriteString("\n### Request body\n\n```json\n")
+		b.WriteString(indentJSON(e.RequestExample))
+		b.WriteString("\n```\n")
+	}
+
+	b.WriteString("\n### Responses\n\n")
+	for _, r := range e.Responses {
+		fmt.Fprintf(&b, "- **%s** %s\n", r.Status, r.Description)
+	}
+	for _, r := range e.Responses {
+		if len(r.Example) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\nExample %s response:\n\n", r.Status)
+		if r.ContentType == "application/json" {
+			fmt.Fprintf(&b, "```json\n%s\n```\n", indentJSON(r.Example))
+		} else {
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimRight(exampleString(r.Example), "\n"))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n### Try it\n\n```sh\n%s\n```\n", e.Curl)
+	return b.String()
+}
+
+func indentJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,237 @@
+// Package highlight precomputes syntax highlighting for diffs on the
+// server, so clients render large diffs from token lists instead of running
+// a highlighter over every line themselves.
+//
+// Token classes are chroma's short CSS classes ("k", "s", "c1", ...), the
+// same ones used by /api/markdown/css, so one stylesheet covers both.
+package highlight
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// MaxLines bounds the diff lines highlighted per file; larger files are
+// returned without tokens and the client falls back to plain text.
+const MaxLines = 20000
+
+// cacheEntries is how many highlighted diffs are kept in memory.
+const cacheEntries = 256
+
+// Token is a run of text with a chroma CSS class ("" for plain text).
+type Token struct {
+	Text  string `json:"t"`
+	Class string `json:"c,omitempty"`
+}
+
+// Line kinds in a diff.
+const (
+	Context = ' '
+	Add     = '+'
+	Delete  = '-'
+)
+
+// Line is one line of a diff hunk, without its leading +/-/space.
+type Line struct {
+	Kind byte
+	Text string
+}
+
+// Diff returns tokens for each line, or nil when the file type has no
+// lexer or the diff is too large. Old (context and deleted) and new
+// (context and added) lines are lexed as separate streams so that
+// multi-line constructs such as block comments highlight correctly.
+// Results are cached by a hash of path and lines.
+func Diff(path string, lines []Line) [][]Token {
+	if len(lines) == 0 || len(lines) > MaxLines {
+		return nil
+	}
+	lexer := lexers.Match(path)
+	if lexer == nil {
+		return nil
+	}
+
+	key := diffKey(path, lines)
+	if tokens, ok := cache.get(key); ok {
+		return tokens
+	}
+
+	var oldIdx, newIdx []int
+	var oldText, newText strings.Builder
+	for i, l := range lines {
+		if l.Kind != Add {
+			oldIdx = append(oldIdx, i)
+			oldText.WriteString(l.Text)
+			oldText.WriteByte('\n')
+		}
+		if l.Kind != Delete {
+			newIdx = append(newIdx, i)
+			newText.WriteString(l.Text)
+			newText.WriteByte('\n')
+		}
+	}
+
+	out := make([][]Token, len(lines))
+	oldTokens := tokenizeLines(lexer, oldText.String(), len(oldIdx))
+	newTokens := tokenizeLines(lexer, newText.String(), len(newIdx))
+	for j, i := range oldIdx {
+		out[i] = oldTokens[j]
+	}
+	// context lines appear in both streams; the new side wins
+	for j, i := range newIdx {
+		out[i] = newTokens[j]
+	}
+
+	cache.put(key, out)
+	return out
+}
+
+// UnifiedDiff highlights a raw unified diff as produced by git diff. The
+// result has one entry per line of diff (split on "\n"); header and hunk
+// lines get nil. It returns nil when nothing could be highlighted.
+func UnifiedDiff(path string, diff string) [][]Token {
+	rawLines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	var lines []Line
+	var idx []int
+	inHunk := false
+	for i, raw := range rawLines {
+		if strings.HasPrefix(raw, "@@") {
+			inHunk = true
+			continue
+		}
+		if !inHunk || raw == "" {
+			continue
+		}
+		switch raw[0] {
+		case Context, Add, Delete:
+			lines = append(lines, Line{Kind: raw[0], Text: raw[1:]})
+			idx = append(idx, i)
+		case '\\':
+			// "\ No newline at end of file"
+		default:
+			// next file's header
+			inHunk = false
+		}
+	}
+	tokens := Diff(path, lines)
+	if tokens == nil {
+		return nil
+	}
+	out := make([][]Token, len(rawLines))
+	for j, i := range idx {
+		out[i] = tokens[j]
+	}
+	return out
+}
+
+// tokenizeLines lexes text and returns the tokens of its first n lines,
+// without trailing newlines.
+func tokenizeLines(lexer chroma.Lexer, text string, n int) [][]Token {
+	out := make([][]Token, n)
+	if n == 0 {
+		return out
+	}
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, text)
+	if err != nil {
+		return out
+	}
+	for i, line := range chroma.SplitTokensIntoLines(it.Tokens()) {
+		if i >= n {
+			break
+		}
+		var tokens []Token
+		for _, t := range line {
+			text := strings.TrimSuffix(t.Value, "\n")
+			if text == "" {
+				continue
+			}
+			class := tokenClass(t.Type)
+			if k := len(tokens) - 1; k >= 0 && tokens[k].Class == class {
+				tokens[k].Text += text
+				continue
+			}
+			tokens = append(tokens, Token{Text: text, Class: class})
+		}
+		out[i] = tokens
+	}
+	return out
+}
+
+// tokenClass maps a token type to its CSS class, falling back to the
+// parent category like chroma's HTML formatter does.
+func tokenClass(t chroma.TokenType) string {
+	for {
+		if cls, ok := chroma.StandardTypes[t]; ok {
+			return cls
+		}
+		parent := t.Parent()
+		if parent == t {
+			return ""
+		}
+		t = parent
+	}
+}
+
+func diffKey(path string, lines []Line) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	for _, l := range lines {
+		h.Write([]byte{l.Kind})
+		h.Write([]byte(l.Text))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lruCache is a small LRU of highlighted diffs keyed by diffKey.
+type lruCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // front is most recent; values are *cacheEntry
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key    string
+	tokens [][]Token
+}
+
+var cache = newLRUCache(cacheEntries)
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(key string) ([][]Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).tokens, true
+}
+
+func (c *lruCache) put(key string, tokens [][]Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).tokens = tokens
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, tokens: tokens})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
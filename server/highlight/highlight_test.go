@@ -0,0 +1,99 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func joinTokens(tokens []Token) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		sb.WriteString(t.Text)
+	}
+	return sb.String()
+}
+
+func hasClass(tokens []Token, text, class string) bool {
+	for _, t := range tokens {
+		if strings.Contains(t.Text, text) && t.Class == class {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiffSeparatesOldAndNewStreams(t *testing.T) {
+	lines := []Line{
+		{Kind: Context, Text: "package main"},
+		{Kind: Delete, Text: "/* removed"},
+		{Kind: Add, Text: "func main() {"},
+		{Kind: Context, Text: "x := 1"},
+	}
+	tokens := Diff("main.go", lines)
+	if len(tokens) != len(lines) {
+		t.Fatalf("got %d lines, want %d", len(tokens), len(lines))
+	}
+	for i, l := range lines {
+		if got := joinTokens(tokens[i]); got != l.Text {
+			t.Errorf("line %d text = %q, want %q", i, got, l.Text)
+		}
+	}
+	if !hasClass(tokens[2], "func", "kd") {
+		t.Errorf("added line not lexed as code: %+v", tokens[2])
+	}
+	// the unterminated comment only exists in the old stream, so the new
+	// side of the context line after it is still code
+	if hasClass(tokens[3], "x", "cm") {
+		t.Errorf("context line highlighted from the old side: %+v", tokens[3])
+	}
+}
+
+func TestDiffUnknownTypeOrTooLarge(t *testing.T) {
+	if got := Diff("notes.unknown-ext", []Line{{Kind: Add, Text: "hello"}}); got != nil {
+		t.Errorf("unknown type: got %v, want nil", got)
+	}
+	if got := Diff("main.go", make([]Line, MaxLines+1)); got != nil {
+		t.Errorf("too large: got %d lines, want nil", len(got))
+	}
+}
+
+func TestUnifiedDiffAlignsWithRawLines(t *testing.T) {
+	diff := "diff --git a/x.go b/x.go\n" +
+		"--- a/x.go\n" +
+		"+++ b/x.go\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" package x\n" +
+		"-var a = 1\n" +
+		"+var a = \"s\"\n" +
+		"\\ No newline at end of file\n"
+	tokens := UnifiedDiff("x.go", diff)
+	raw := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	if len(tokens) != len(raw) {
+		t.Fatalf("got %d entries, want %d", len(tokens), len(raw))
+	}
+	for _, i := range []int{0, 1, 2, 3, 7} {
+		if tokens[i] != nil {
+			t.Errorf("header line %d has tokens: %+v", i, tokens[i])
+		}
+	}
+	if got := joinTokens(tokens[6]); got != `var a = "s"` {
+		t.Errorf("added line = %q", got)
+	}
+	if !hasClass(tokens[6], `"s"`, "s") {
+		t.Errorf("string literal not classed: %+v", tokens[6])
+	}
+}
+
+func TestLRUCacheEvictsOldest(t *testing.T) {
+	c := newLRUCache(2)
+	c.put("a", [][]Token{{{Text: "a"}}})
+	c.put("b", nil)
+	c.get("a")
+	c.put("c", nil)
+	if _, ok := c.get("b"); ok {
+		t.Errorf("b should have been evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("a was recently used and should be kept")
+	}
+}
@@ -0,0 +1,142 @@
+// Package httpcache lets clients poll heavy read endpoints cheaply over slow
+// links. Responses carry an ETag of their body and a Last-Modified of when
+// that body was first served; conditional requests that still match are
+// answered 304 Not Modified without a body. This applies to POST reads too
+// (the review API takes its parameters in a JSON body): the web client
+// keeps the bodies it got and sends If-None-Match itself.
+//
+// Cache is the server side: a small LRU of computed results that handlers
+// key on the state the result was computed from, e.g. a repository's HEAD
+// and dirty files, so unchanged state skips the computation.
+package httpcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is a fixed-size LRU cache. Values are shared between callers,
+// which must not modify them.
+type Cache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value any
+	added time.Time
+}
+
+// New returns a cache holding at most max entries.
+func New(max int) *Cache {
+	return &Cache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the value stored under key and when it was stored.
+func (c *Cache) Get(key string) (value any, added time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	c.order.MoveToFront(el)
+	e := el.Value.(*entry)
+	return e.value, e.added, true
+}
+
+// Put stores value under key, evicting the least recently used entry if
+// the cache is full. It returns when the value was first stored: an
+// existing entry keeps its time.
+func (c *Cache) Put(key string, value any) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*entry)
+		e.value = value
+		return e.added
+	}
+	e := &entry{key: key, value: value, added: time.Now()}
+	c.entries[key] = c.order.PushFront(e)
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+	return e.added
+}
+
+// Len returns the number of entries.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// served remembers when each recent ETag was first served, which is the
+// Last-Modified of its body. A forgotten ETag is dated now: later than the
+// truth, so a client may refetch but never misses a change.
+var served = New(4096)
+
+// ETag returns the strong entity tag of body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WriteJSON writes v as a 200 JSON response with validators, or 304 Not
+// Modified if the request's conditional headers show the client has it.
+func WriteJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+	etag := ETag(body)
+	modTime := served.Put(etag, struct{}{})
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	// the client may keep the body but must revalidate before using it
+	h.Set("Cache-Control", "private, no-cache")
+	if NotModified(r, etag, modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// NotModified reports whether the client's copy, described by the
+// If-None-Match or, without it, the If-Modified-Since header of r, is
+// current for a body with etag last modified at modTime.
+func NotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		// HTTP dates have second precision
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
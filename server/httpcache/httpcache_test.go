@@ -0,0 +1,65 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2)
+	first := c.Put("a", 1)
+	c.Put("b", 2)
+	c.Get("a")
+	c.Put("c", 3)
+	if _, _, ok := c.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	if v, added, ok := c.Get("a"); !ok || v != 1 || !added.Equal(first) {
+		t.Errorf("a: %v %v %v", v, added, ok)
+	}
+	if again := c.Put("a", 4); !again.Equal(first) {
+		t.Error("replacing a value changed its time")
+	}
+}
+
+func TestWriteJSONConditional(t *testing.T) {
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/review/diff", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		WriteJSON(rec, req, map[string]string{"diff": "+a"})
+		return rec
+	}
+
+	rec := get("", "")
+	etag, lastMod := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"diff":"+a"}`+"\n" || etag == "" || lastMod == "" {
+		t.Fatalf("first response %d %q %q %q", rec.Code, rec.Body, etag, lastMod)
+	}
+
+	for _, tt := range []struct {
+		header, value string
+		code          int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-Modified-Since", lastMod, http.StatusNotModified},
+		{"If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusOK},
+	} {
+		rec := get(tt.header, tt.value)
+		if rec.Code != tt.code {
+			t.Errorf("%s: %s: got %d, want %d", tt.header, tt.value, rec.Code, tt.code)
+		}
+		if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("304 with a body")
+		}
+		if got := rec.Header().Get("Last-Modified"); got != lastMod {
+			t.Errorf("Last-Modified moved from %s to %s", lastMod, got)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Package imageproc shrinks images for viewing on a phone: it downsizes
+// them to fit a bounding box and re-encodes them as WebP, AVIF, JPEG or PNG.
+//
+// Decoding, resizing and JPEG/PNG encoding use the standard library only.
+// WebP and AVIF are encoded with the cwebp and avifenc command line tools
+// when they are installed; without them those formats fall back to JPEG
+// (or PNG for images with transparency).
+package imageproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+)
+
+// Output formats.
+const (
+	// FormatAuto picks the smallest format the client accepts: WebP when
+	// available, otherwise JPEG, or PNG for images with transparency.
+	FormatAuto = "auto"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+	FormatAVIF = "avif"
+)
+
+// MaxPixels bounds the decoded size of an input image, so a small but
+// highly compressed file cannot exhaust memory.
+const MaxPixels = 64 << 20
+
+// Options controls how an image is processed. Zero MaxWidth/MaxHeight keep
+// that dimension unbounded; images are never upscaled.
+type Options struct {
+	MaxWidth  int    `json:"max_width"`
+	MaxHeight int    `json:"max_height"`
+	Quality   int    `json:"quality"` // 1-100, 0 means DefaultQuality
+	Format    string `json:"format"`  // one of the Format constants, "" means FormatAuto
+	// Accept is the client's HTTP Accept header, consulted by FormatAuto.
+	Accept string `json:"-"`
+}
+
+// DefaultQuality is used when Options.Quality is 0.
+const DefaultQuality = 75
+
+// Presets are the named quality levels offered to clients.
+var Presets = map[string]Options{
+	"thumb":  {MaxWidth: 320, MaxHeight: 320, Quality: 60},
+	"low":    {MaxWidth: 1024, MaxHeight: 1024, Quality: 60},
+	"medium": {MaxWidth: 1920, MaxHeight: 1920, Quality: 75},
+	"high":   {MaxWidth: 2560, MaxHeight: 2560, Quality: 85},
+}
+
+// Result is a processed image.
+type Result struct {
+	Data        []byte
+	ContentType string
+	Format      string
+	Width       int
+	Height      int
+	// Original is true when the input was returned unchanged because
+	// re-encoding would not have made it smaller.
+	Original bool
+}
+
+// Encoders reports which formats can be produced on this machine.
+func Encoders() map[string]bool {
+	return map[string]bool{
+		FormatJPEG: true,
+		FormatPNG:  true,
+		FormatWebP: tool_resolve.IsAvailable("cwebp"),
+		FormatAVIF: tool_resolve.IsAvailable("avifenc"),
+	}
+}
+
+// Process decodes data (PNG, JPEG or GIF), fits it into the bounding box of
+// opts and re-encodes it.
+func Process(data []byte, opts Options) (*Result, error) {
+	cfg, srcFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %v", err)
+	}
+
+	w, h := FitSize(cfg.Width, cfg.Height, opts.MaxWidth, opts.MaxHeight)
+	img := src
+	if w != cfg.Width || h != cfg.Height {
+		img = Resize(src, w, h)
+	}
+
+	quality := opts.Quality
+	if quality <= 0 || quality > 100 {
+		quality = DefaultQuality
+	}
+	format := resolveFormat(opts.Format, opts.Accept, hasAlpha(img))
+
+	out, err := encode(img, format, quality)
+	if err != nil {
+		return nil, err
+	}
+	if w == cfg.Width && h == cfg.Height && len(out) >= len(data) {
+		return &Result{Data: data, ContentType: "image/" + srcFormat, Format: srcFormat, Width: w, Height: h, Original: true}, nil
+	}
+	return &Result{Data: out, ContentType: "image/" + format, Format: format, Width: w, Height: h}, nil
+}
+
+// FitSize scales w x h down to fit within maxW x maxH, preserving the aspect
+// ratio. A zero bound is ignored.
+func FitSize(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		if s := float64(maxH) / float64(h); s < scale {
+			scale = s
+		}
+	}
+	if scale == 1.0 {
+		return w, h
+	}
+	return max(1, int(float64(w)*scale+0.5)), max(1, int(float64(h)*scale+0.5))
+}
+
+// Resize downsamples src to w x h by averaging the source pixels that each
+// destination pixel covers, which keeps text in screenshots legible.
+func Resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(bl / n)
+			d[3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func resolveFormat(format, accept string, alpha bool) string {
+	enc := Encoders()
+	switch format {
+	case FormatJPEG, FormatPNG:
+		return format
+	case FormatWebP, FormatAVIF:
+		if enc[format] {
+			return format
+		}
+	case "", FormatAuto:
+		// AVIF is only produced on request: it encodes too slowly for
+		// on-the-fly browsing.
+		if enc[FormatWebP] && AcceptsWebP(accept) {
+			return FormatWebP
+		}
+	}
+	if alpha {
+		return FormatPNG
+	}
+	return FormatJPEG
+}
+
+// AcceptsWebP reports whether an HTTP Accept header allows WebP. An empty
+// header (non-browser clients) does.
+func AcceptsWebP(accept string) bool {
+	return accept == "" || strings.Contains(accept, "image/webp") || strings.Contains(accept, "image/*")
+}
+
+func hasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	return true
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatJPEG:
+		if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("encode jpeg: %v", err)
+		}
+	case FormatPNG:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("encode png: %v", err)
+		}
+	case FormatWebP:
+		return encodeExternal(img, ".webp", func(in, out string) *exec.Cmd {
+			return exec.Command("cwebp", "-quiet", "-q", fmt.Sprint(quality), in, "-o", out)
+		})
+	case FormatAVIF:
+		return encodeExternal(img, ".avif", func(in, out string) *exec.Cmd {
+			return exec.Command("avifenc", "-q", fmt.Sprint(quality), "-s", "8", in, out)
+		})
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeExternal writes img as a PNG to a temp dir and converts it with the
+// command built by mkCmd.
+func encodeExternal(img image.Image, ext string, mkCmd func(in, out string) *exec.Cmd) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "imageproc-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out"+ext)
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	cmd := mkCmd(in, out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(cmd.Path), err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(out)
+}
+
+// flatten composites img over white, since JPEG has no alpha channel.
+func flatten(img image.Image) image.Image {
+	if !hasAlpha(img) {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
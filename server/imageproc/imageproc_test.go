@@ -0,0 +1,113 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{1000, 500, 0, 0, 1000, 500},
+		{1000, 500, 2000, 2000, 1000, 500},
+		{1000, 500, 320, 320, 320, 160},
+		{500, 1000, 320, 320, 160, 320},
+		{1000, 500, 0, 100, 200, 100},
+		{3000, 2, 300, 0, 300, 1},
+	}
+	for _, tt := range tests {
+		w, h := FitSize(tt.w, tt.h, tt.maxW, tt.maxH)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("FitSize(%d, %d, %d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.maxW, tt.maxH, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{A: 255}
+			if x%2 == 0 {
+				c.R, c.G, c.B = 200, 200, 200
+			}
+			src.Set(x, y, c)
+		}
+	}
+	dst := Resize(src, 2, 1)
+	for x := 0; x < 2; x++ {
+		if got := dst.RGBAAt(x, 0); got != (color.RGBA{100, 100, 100, 255}) {
+			t.Errorf("pixel %d = %v, want gray", x, got)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	// a noisy opaque image, so PNG is larger than JPEG
+	src := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7919 % 251)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 255
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Process(buf.Bytes(), Options{MaxWidth: 320, MaxHeight: 320, Quality: 60, Format: FormatJPEG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != FormatJPEG || res.ContentType != "image/jpeg" || res.Width != 320 || res.Height != 240 || res.Original {
+		t.Fatalf("unexpected result: %s %s %dx%d original=%v", res.Format, res.ContentType, res.Width, res.Height, res.Original)
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(res.Data)); err != nil || format != "jpeg" || cfg.Width != 320 {
+		t.Fatalf("output decodes as %s %dx%d, %v", format, cfg.Width, cfg.Height, err)
+	}
+
+	// a tiny flat PNG is not worth re-encoding at the same size
+	tiny := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	buf.Reset()
+	png.Encode(&buf, tiny)
+	res, err = Process(buf.Bytes(), Options{Format: FormatJPEG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Original || res.ContentType != "image/png" || !bytes.Equal(res.Data, buf.Bytes()) {
+		t.Fatalf("tiny image was re-encoded: %s original=%v", res.ContentType, res.Original)
+	}
+
+	if _, err := Process([]byte("not an image"), Options{}); err == nil {
+		t.Fatalf("garbage input accepted")
+	}
+}
+
+func TestResolveFormat(t *testing.T) {
+	tests := []struct {
+		format, accept string
+		alpha          bool
+		want           string
+	}{
+		{FormatPNG, "", false, FormatPNG},
+		{FormatJPEG, "", true, FormatJPEG},
+		{FormatAuto, "text/html", false, FormatJPEG},
+		{FormatAuto, "text/html", true, FormatPNG},
+	}
+	for _, tt := range tests {
+		if got := resolveFormat(tt.format, tt.accept, tt.alpha); got != tt.want {
+			t.Errorf("resolveFormat(%q, %q, %v) = %q, want %q", tt.format, tt.accept, tt.alpha, got, tt.want)
+		}
+	}
+	if !Encoders()[FormatWebP] {
+		if got := resolveFormat(FormatWebP, "", false); got != FormatJPEG {
+			t.Errorf("webp without cwebp resolved to %q, want jpeg fallback", got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+)
+
+// RegisterAPI registers the job endpoints:
+//
+//	GET  /api/jobs?kind=git-push&status=running   list jobs, newest first
+//	GET  /api/jobs/detail?id=...                  one job with its log
+//	POST /api/jobs/cancel?id=...                  cancel a queued or running job
+//	GET  /api/jobs/stream?id=...&log_index=N      reattach to a job's output over SSE
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/jobs", handleList)
+	mux.HandleFunc("/api/jobs/detail", handleDetail)
+	mux.HandleFunc("/api/jobs/cancel", handleCancel)
+	mux.HandleFunc("/api/jobs/stream", handleStream)
+}
+
+func handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	status := Status(r.URL.Query().Get("status"))
+	result := []Info{}
+	for _, info := range defaultManager.List() {
+		if (kind == "" || info.Kind == kind) && (status == "" || info.Status == status) {
+			result = append(result, info)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func handleDetail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	j, ok := defaultManager.Get(r.URL.Query().Get("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, j.Info(true))
+}
+
+func handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if err := defaultManager.Cancel(r.URL.Query().Get("id")); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	j, ok := defaultManager.Get(r.URL.Query().Get("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return
+	}
+	from, _ := strconv.Atoi(r.URL.Query().Get("log_index"))
+	ServeSSE(w, r, j, from)
+}
+
+// ServeSSE streams a job over SSE: a {"type":"job","job_id":...} event, its
+// log lines from index from (as log/error events), then a done event with
+// "success", "status", "error" and the job's result fields. A client that
+// disconnects can resume with /api/jobs/stream?id=...&log_index=N, where N
+// counts the log events already received plus from.
+func ServeSSE(w http.ResponseWriter, r *http.Request, j *Job, from int) {
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+	sw.Send(map[string]string{"type": "job", "job_id": j.ID()})
+	StreamSSE(r.Context(), sw, j, from)
+}
+
+// StreamSSE writes the job's log from index from and its done event to an
+// existing SSE writer, returning early if ctx is done.
+func StreamSSE(ctx context.Context, sw *sse.Writer, j *Job, from int) {
+	stage := ""
+	for {
+		logs, next, changed := j.LogsSince(from)
+		for _, e := range logs {
+			if e.IsError {
+				sw.SendError(e.Message)
+			} else {
+				sw.SendLog(e.Message)
+			}
+		}
+		from = next
+
+		info := j.Info(false)
+		if info.Stage != stage {
+			stage = info.Stage
+			sw.SendStatus(stage, nil)
+		}
+		if info.Status.Finished() {
+			// Logs may have been appended between LogsSince and Info.
+			if logs, _, _ := j.LogsSince(from); len(logs) > 0 {
+				continue
+			}
+			done := map[string]string{
+				"success": strconv.FormatBool(info.Status == StatusSucceeded),
+				"status":  string(info.Status),
+			}
+			for k, v := range info.Result {
+				done[k] = v
+			}
+			if info.Error != "" {
+				sw.SendError(info.Error)
+				done["error"] = info.Error
+			}
+			sw.SendDone(done)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,251 @@
+// Package jobs runs long operations (git push/fetch, commit-message
+// generation, domain mapping...) as named background jobs that outlive the
+// HTTP request that started them. A client that disconnects can list jobs,
+// inspect one, cancel it, or reattach to its log stream over SSE.
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is the lifecycle state of a job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Finished reports whether the status is terminal.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// maxLogEntries caps the log kept per job; older lines are dropped.
+const maxLogEntries = 2000
+
+// LogEntry is one line of job output.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	IsError bool      `json:"is_error,omitempty"`
+}
+
+// Info is a snapshot of a job, as returned by the API and persisted.
+type Info struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"` // e.g. "git-push"
+	Title string `json:"title"`
+	// Status is the lifecycle state; Stage is a free-form progress label
+	// set by the job itself (e.g. "connecting").
+	Status     Status            `json:"status"`
+	Stage      string            `json:"stage,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Result     map[string]string `json:"result,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	// LogOffset is the number of lines dropped from the start of Logs.
+	LogOffset int        `json:"log_offset,omitempty"`
+	LogCount  int        `json:"log_count"`
+	Logs      []LogEntry `json:"logs,omitempty"`
+}
+
+// Func is the body of a job. It should return promptly once ctx is done.
+type Func func(ctx context.Context, j *Job) error
+
+// Job is a running or finished background job.
+type Job struct {
+	mu      sync.Mutex
+	info    Info
+	cancel  context.CancelFunc
+	done    chan struct{}
+	changed chan struct{} // closed and replaced on every update
+	onSave  func()
+}
+
+func newJob(info Info) *Job {
+	return &Job{
+		info:    info,
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// ID returns the job ID.
+func (j *Job) ID() string {
+	return j.info.ID
+}
+
+// Info returns a snapshot of the job; logs are included when withLogs is set.
+func (j *Job) Info(withLogs bool) Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := j.info
+	info.LogCount = info.LogOffset + len(j.info.Logs)
+	if info.Result != nil {
+		info.Result = make(map[string]string, len(j.info.Result))
+		for k, v := range j.info.Result {
+			info.Result[k] = v
+		}
+	}
+	if withLogs {
+		info.Logs = append([]LogEntry(nil), j.info.Logs...)
+	} else {
+		info.Logs = nil
+	}
+	return info
+}
+
+// Done is closed once the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait blocks until the job finishes and returns its final state.
+func (j *Job) Wait() Info {
+	<-j.done
+	return j.Info(true)
+}
+
+// Cancel asks the job to stop. It is a no-op once the job has finished.
+func (j *Job) Cancel() {
+	j.mu.Lock()
+	cancel := j.cancel
+	j.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Logf appends a line to the job log.
+func (j *Job) Logf(format string, args ...any) {
+	j.appendLog(fmt.Sprintf(format, args...), false)
+}
+
+// LogErrorf appends an error line to the job log.
+func (j *Job) LogErrorf(format string, args ...any) {
+	j.appendLog(fmt.Sprintf(format, args...), true)
+}
+
+func (j *Job) appendLog(msg string, isError bool) {
+	j.update(func(info *Info) {
+		info.Logs = append(info.Logs, LogEntry{Time: time.Now(), Message: msg, IsError: isError})
+		if n := len(info.Logs) - maxLogEntries; n > 0 {
+			info.Logs = append([]LogEntry(nil), info.Logs[n:]...)
+			info.LogOffset += n
+		}
+	})
+}
+
+// SetStage records a progress label such as "connecting".
+func (j *Job) SetStage(stage string) {
+	j.update(func(info *Info) { info.Stage = stage })
+}
+
+// SetResult records a key/value reported when the job finishes.
+func (j *Job) SetResult(key, value string) {
+	j.update(func(info *Info) {
+		if info.Result == nil {
+			info.Result = make(map[string]string)
+		}
+		info.Result[key] = value
+	})
+}
+
+// LogsSince returns log lines from absolute index from (counting dropped
+// lines), the index to resume from, and a channel closed on the next update.
+func (j *Job) LogsSince(from int) ([]LogEntry, int, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	start := from - j.info.LogOffset
+	if start < 0 {
+		start = 0
+	}
+	next := j.info.LogOffset + len(j.info.Logs)
+	if start >= len(j.info.Logs) {
+		return nil, next, j.changed
+	}
+	return append([]LogEntry(nil), j.info.Logs[start:]...), next, j.changed
+}
+
+func (j *Job) update(fn func(info *Info)) {
+	j.mu.Lock()
+	fn(&j.info)
+	close(j.changed)
+	j.changed = make(chan struct{})
+	onSave := j.onSave
+	j.mu.Unlock()
+	if onSave != nil {
+		onSave()
+	}
+}
+
+// RunCmd runs cmd, logging each output line, and kills it when ctx is done.
+// It returns the combined output.
+func (j *Job) RunCmd(ctx context.Context, cmd *exec.Cmd) (string, error) {
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		pr.Close()
+		return "", fmt.Errorf("failed to start: %v", err)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+		pw.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		cmd.Process.Kill()
+	})
+	defer stop()
+
+	var output strings.Builder
+	scanner := bufio.NewScanner(pr)
+	scanner.Split(splitLines)
+	for scanner.Scan() {
+		line := scanner.Text()
+		output.WriteString(line)
+		output.WriteString("\n")
+		if line != "" {
+			j.Logf("%s", line)
+		}
+	}
+	pr.Close()
+
+	err := <-waitErr
+	if ctx.Err() != nil {
+		return output.String(), ctx.Err()
+	}
+	return output.String(), err
+}
+
+// splitLines splits on \n or \r so progress output ("Writing objects: 45%")
+// shows up line by line.
+func splitLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
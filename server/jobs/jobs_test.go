@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitTimeout(t *testing.T, j *Job) Info {
+	t.Helper()
+	select {
+	case <-j.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("job %s did not finish", j.ID())
+	}
+	return j.Info(true)
+}
+
+func TestJobLifecycle(t *testing.T) {
+	m := NewManager("", 1)
+
+	tests := []struct {
+		name       string
+		fn         Func
+		cancel     bool
+		wantStatus Status
+		wantError  string
+	}{
+		{
+			name: "success",
+			fn: func(ctx context.Context, j *Job) error {
+				_, err := j.RunCmd(ctx, exec.Command("sh", "-c", "echo one; echo two >&2"))
+				j.SetResult("message", "ok")
+				return err
+			},
+			wantStatus: StatusSucceeded,
+		},
+		{
+			name:       "failure",
+			fn:         func(ctx context.Context, j *Job) error { return errors.New("boom") },
+			wantStatus: StatusFailed,
+			wantError:  "boom",
+		},
+		{
+			name: "canceled",
+			fn: func(ctx context.Context, j *Job) error {
+				_, err := j.RunCmd(ctx, exec.Command("sleep", "30"))
+				return err
+			},
+			cancel:     true,
+			wantStatus: StatusCanceled,
+			wantError:  "canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := m.Start("test", tt.name, tt.fn)
+			if tt.cancel {
+				time.Sleep(100 * time.Millisecond)
+				if err := m.Cancel(j.ID()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			info := waitTimeout(t, j)
+			if info.Status != tt.wantStatus || info.Error != tt.wantError {
+				t.Errorf("status = %s, error = %q; want %s, %q", info.Status, info.Error, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+
+	j, _ := m.Get(m.List()[2].ID)
+	info := j.Info(true)
+	if info.Title != "success" || info.LogCount != 2 || info.Result["message"] != "ok" {
+		t.Errorf("success job = %+v", info)
+	}
+}
+
+func TestManagerMarksInterruptedJobsOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	m := NewManager(path, 1)
+	release := make(chan struct{})
+	running := m.Start("test", "slow", func(ctx context.Context, j *Job) error {
+		j.Logf("working")
+		<-release
+		return nil
+	})
+	for running.Info(false).Status != StatusRunning {
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.saveNow()
+
+	restarted := NewManager(path, 1)
+	j, ok := restarted.Get(running.ID())
+	close(release)
+	waitTimeout(t, running)
+	if !ok {
+		t.Fatal("persisted job not loaded")
+	}
+	info := j.Info(true)
+	if info.Status != StatusFailed || info.Error != "interrupted by server restart" || len(info.Logs) != 1 {
+		t.Errorf("restored job = %+v", info)
+	}
+}
+
+func TestServeSSEResumesFromLogIndex(t *testing.T) {
+	m := NewManager("", 1)
+	j := m.Start("test", "sse", func(ctx context.Context, j *Job) error {
+		j.Logf("first")
+		j.Logf("second")
+		j.SetResult("message", "done!")
+		return nil
+	})
+	waitTimeout(t, j)
+
+	rec := httptest.NewRecorder()
+	ServeSSE(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/stream", nil), j, 1)
+	body := rec.Body.String()
+	if strings.Contains(body, "first") || !strings.Contains(body, `"message":"second"`) {
+		t.Errorf("expected only logs after index 1:\n%s", body)
+	}
+	if !strings.Contains(body, `"type":"done"`) || !strings.Contains(body, `"success":"true"`) || !strings.Contains(body, `"message":"done!"`) {
+		t.Errorf("missing done event:\n%s", body)
+	}
+}
@@ -0,0 +1,292 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/logging"
+)
+
+const (
+	// DefaultMaxConcurrent is how many jobs run at once; the rest queue.
+	DefaultMaxConcurrent = 4
+	// maxFinishedJobs is how many finished jobs are kept for inspection.
+	maxFinishedJobs = 100
+	// saveDebounce batches persistence of log-heavy jobs.
+	saveDebounce = time.Second
+)
+
+var log = logging.New("jobs")
+
+type store struct {
+	Jobs []Info `json:"jobs"`
+}
+
+// Manager runs jobs and persists their state to a JSON file.
+type Manager struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	seq     int
+	sem     chan struct{}
+	file    *jsonfile.JSONFile[store]
+	loaded  bool
+	saveMu  sync.Mutex
+	pending *time.Timer
+}
+
+// NewManager creates a manager persisting to path (empty disables
+// persistence) that runs at most maxConcurrent jobs at a time.
+func NewManager(path string, maxConcurrent int) *Manager {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrent
+	}
+	m := &Manager{
+		jobs: make(map[string]*Job),
+		sem:  make(chan struct{}, maxConcurrent),
+	}
+	if path != "" {
+		m.file = jsonfile.New[store](path)
+	}
+	return m
+}
+
+var defaultManager = NewManager(config.DataDir+"/jobs.json", DefaultMaxConcurrent)
+
+// Start runs fn as a background job on the default manager.
+func Start(kind, title string, fn Func) *Job {
+	return defaultManager.Start(kind, title, fn)
+}
+
+// Get returns a job of the default manager by ID.
+func Get(id string) (*Job, bool) {
+	return defaultManager.Get(id)
+}
+
+// Start queues fn as a new job and returns immediately.
+func (m *Manager) Start(kind, title string, fn Func) *Job {
+	m.load()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.mu.Lock()
+	m.seq++
+	id := fmt.Sprintf("%s-%d-%d", kind, time.Now().Unix(), m.seq)
+	j := newJob(Info{
+		ID:        id,
+		Kind:      kind,
+		Title:     title,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	})
+	j.cancel = cancel
+	j.onSave = m.saveSoon
+	m.jobs[id] = j
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	log.Infof("queued %s: %s", id, title)
+	go m.run(ctx, cancel, j, fn)
+	return j
+}
+
+func (m *Manager) run(ctx context.Context, cancel context.CancelFunc, j *Job, fn Func) {
+	defer cancel()
+
+	select {
+	case m.sem <- struct{}{}:
+		defer func() { <-m.sem }()
+	case <-ctx.Done():
+		m.finish(j, ctx.Err())
+		return
+	}
+
+	now := time.Now()
+	j.update(func(info *Info) {
+		info.Status = StatusRunning
+		info.StartedAt = &now
+	})
+	m.saveNow()
+
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		err = fn(ctx, j)
+	}()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	m.finish(j, err)
+}
+
+func (m *Manager) finish(j *Job, err error) {
+	now := time.Now()
+	j.update(func(info *Info) {
+		info.FinishedAt = &now
+		switch {
+		case errors.Is(err, context.Canceled):
+			info.Status = StatusCanceled
+			info.Error = "canceled"
+		case err != nil:
+			info.Status = StatusFailed
+			info.Error = err.Error()
+		default:
+			info.Status = StatusSucceeded
+		}
+	})
+	j.mu.Lock()
+	j.cancel = nil
+	status := j.info.Status
+	j.mu.Unlock()
+	close(j.done)
+	m.saveNow()
+
+	if err != nil && status == StatusFailed {
+		log.Warnf("%s failed: %v", j.ID(), err)
+	} else {
+		log.Infof("%s %s", j.ID(), status)
+	}
+}
+
+// Get returns a job by ID.
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.load()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// List returns snapshots (without logs) of all jobs, newest first.
+func (m *Manager) List() []Info {
+	m.load()
+	m.mu.Lock()
+	all := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		all = append(all, j)
+	}
+	m.mu.Unlock()
+
+	infos := make([]Info, 0, len(all))
+	for _, j := range all {
+		infos = append(infos, j.Info(false))
+	}
+	sort.Slice(infos, func(i, k int) bool {
+		return infos[i].CreatedAt.After(infos[k].CreatedAt)
+	})
+	return infos
+}
+
+// Cancel stops a queued or running job.
+func (m *Manager) Cancel(id string) error {
+	j, ok := m.Get(id)
+	if !ok {
+		return fmt.Errorf("job not found: %s", id)
+	}
+	if j.Info(false).Status.Finished() {
+		return fmt.Errorf("job %s already finished", id)
+	}
+	j.Cancel()
+	return nil
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinishedJobs.
+func (m *Manager) pruneLocked() {
+	var finished []Info
+	for _, j := range m.jobs {
+		if info := j.Info(false); info.Status.Finished() {
+			finished = append(finished, info)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].CreatedAt.Before(finished[k].CreatedAt)
+	})
+	for _, info := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, info.ID)
+	}
+}
+
+// load restores persisted jobs once. Jobs that were queued or running when
+// the server stopped are marked failed: their work did not complete.
+func (m *Manager) load() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded || m.file == nil {
+		m.loaded = true
+		return
+	}
+	m.loaded = true
+	st, err := m.file.Get()
+	if err != nil {
+		log.Warnf("failed to load jobs: %v", err)
+		return
+	}
+	for _, info := range st.Jobs {
+		if !info.Status.Finished() {
+			info.Status = StatusFailed
+			info.Error = "interrupted by server restart"
+			if info.FinishedAt == nil {
+				t := time.Now()
+				info.FinishedAt = &t
+			}
+		}
+		j := newJob(info)
+		close(j.done)
+		m.jobs[info.ID] = j
+	}
+}
+
+// saveSoon persists after a short delay, batching frequent log updates.
+func (m *Manager) saveSoon() {
+	if m.file == nil {
+		return
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if m.pending != nil {
+		return
+	}
+	m.pending = time.AfterFunc(saveDebounce, m.saveNow)
+}
+
+func (m *Manager) saveNow() {
+	if m.file == nil {
+		return
+	}
+	// Held across the write so an older snapshot never overwrites a newer one.
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if m.pending != nil {
+		m.pending.Stop()
+		m.pending = nil
+	}
+
+	m.mu.Lock()
+	all := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		all = append(all, j)
+	}
+	m.mu.Unlock()
+
+	st := store{Jobs: make([]Info, 0, len(all))}
+	for _, j := range all {
+		st.Jobs = append(st.Jobs, j.Info(true))
+	}
+	sort.Slice(st.Jobs, func(i, k int) bool {
+		return st.Jobs[i].CreatedAt.Before(st.Jobs[k].CreatedAt)
+	})
+	if err := m.file.Set(st); err != nil {
+		log.Warnf("failed to save jobs: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+)
+
+const (
+	defaultQueryLimit = 500
+	tailKeepalive     = 30 * time.Second
+)
+
+// RegisterAPI registers the log endpoints:
+//
+//	GET /api/logs?level=warn&component=agents&q=text&after=SEQ&limit=500
+//	GET /api/logs?tail=1 (or Accept: text/event-stream) streams matching entries over SSE
+//	GET|PUT /api/logs/level reads or sets the stdout level
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/logs", handleLogs)
+	mux.HandleFunc("/api/logs/level", handleLevel)
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	q := r.URL.Query()
+	f := Filter{
+		Component: q.Get("component"),
+		Contains:  q.Get("q"),
+	}
+	if v := q.Get("level"); v != "" {
+		level, err := ParseLevel(v)
+		if err != nil {
+			return f, err
+		}
+		f.MinLevel = level
+	}
+	if v := q.Get("after"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return f, err
+		}
+		f.AfterSeq = seq
+	}
+	return f, nil
+}
+
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultQueryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	if r.URL.Query().Get("tail") != "" || r.Header.Get("Accept") == "text/event-stream" {
+		tailLogs(w, r, f, limit)
+		return
+	}
+
+	entries := defaultBuffer.Query(f, limit)
+	if entries == nil {
+		entries = []Entry{}
+	}
+	last := f.AfterSeq
+	if len(entries) > 0 {
+		last = entries[len(entries)-1].Seq
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"entries":    entries,
+		"last_seq":   last,
+		"components": defaultBuffer.Components(),
+	})
+}
+
+type entryEvent struct {
+	Type string `json:"type"`
+	Entry
+}
+
+// tailLogs sends the last limit matching entries, then every new one until
+// the client disconnects. Each SSE message is {"type":"entry", ...Entry}.
+func tailLogs(w http.ResponseWriter, r *http.Request, f Filter, limit int) {
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the backlog so nothing is missed in between.
+	ch, unsubscribe := defaultBuffer.Subscribe()
+	defer unsubscribe()
+
+	for _, e := range defaultBuffer.Query(f, limit) {
+		sw.Send(entryEvent{Type: "entry", Entry: e})
+		f.AfterSeq = e.Seq
+	}
+
+	ticker := time.NewTicker(tailKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			sw.SendStatus("alive", nil)
+		case e := <-ch:
+			if !f.Match(e) {
+				continue
+			}
+			sw.Send(entryEvent{Type: "entry", Entry: e})
+		}
+	}
+}
+
+func handleLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		level, err := ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		SetOutputLevel(level)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"level": OutputLevel().String()})
+}
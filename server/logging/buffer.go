@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultCapacity is the number of entries kept in memory.
+const DefaultCapacity = 5000
+
+// subscriberBuffer is how many entries a slow tail subscriber may lag
+// behind before entries are dropped for it.
+const subscriberBuffer = 256
+
+// Buffer is a fixed-size ring of the most recent entries.
+type Buffer struct {
+	mu      sync.Mutex
+	entries []Entry
+	start   int // index of the oldest entry once the ring is full
+	nextSeq uint64
+	subs    map[chan Entry]struct{}
+}
+
+// NewBuffer creates a ring buffer holding up to capacity entries.
+func NewBuffer(capacity int) *Buffer {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Buffer{
+		entries: make([]Entry, 0, capacity),
+		nextSeq: 1,
+		subs:    make(map[chan Entry]struct{}),
+	}
+}
+
+var defaultBuffer = NewBuffer(DefaultCapacity)
+
+// add assigns the entry's sequence number and stores it.
+func (b *Buffer) add(e Entry) Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.Seq = b.nextSeq
+	b.nextSeq++
+	if len(b.entries) < cap(b.entries) {
+		b.entries = append(b.entries, e)
+	} else {
+		b.entries[b.start] = e
+		b.start = (b.start + 1) % len(b.entries)
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return e
+}
+
+// Filter selects entries from the buffer. Zero values match everything.
+type Filter struct {
+	MinLevel  Level
+	Component string // exact component name
+	Contains  string // case-insensitive substring of the message
+	AfterSeq  uint64 // only entries with Seq > AfterSeq
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Entry) bool {
+	if e.Level < f.MinLevel || e.Seq <= f.AfterSeq {
+		return false
+	}
+	if f.Component != "" && e.Component != f.Component {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(strings.ToLower(e.Message), strings.ToLower(f.Contains)) {
+		return false
+	}
+	return true
+}
+
+// Query returns up to limit matching entries, oldest first; the newest
+// ones are kept when more match. limit <= 0 returns all matches.
+func (b *Buffer) Query(f Filter, limit int) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var result []Entry
+	n := len(b.entries)
+	for i := 0; i < n; i++ {
+		e := b.entries[(b.start+i)%n]
+		if f.Match(e) {
+			result = append(result, e)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// Components lists the component names present in the buffer.
+func (b *Buffer) Components() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, e := range b.entries {
+		if !seen[e.Component] {
+			seen[e.Component] = true
+			names = append(names, e.Component)
+		}
+	}
+	return names
+}
+
+// Subscribe returns a channel receiving every new entry and a function
+// that ends the subscription.
+func (b *Buffer) Subscribe() (<-chan Entry, func()) {
+	ch := make(chan Entry, subscriberBuffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,168 @@
+// Package logging provides leveled, component-tagged server logs.
+//
+// Every entry is printed to stdout as "[component] message" (so the server
+// log file looks as before) and kept in an in-memory ring buffer that the
+// mobile frontend reads through /api/logs, optionally tailing it over SSE.
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// MarshalText encodes the level by name.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level name.
+func (l *Level) UnmarshalText(b []byte) error {
+	parsed, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// ParseLevel parses "debug", "info", "warn"/"warning" or "error".
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %q", s)
+}
+
+// Entry is one structured log record.
+type Entry struct {
+	Seq       uint64         `json:"seq"`
+	Time      time.Time      `json:"time"`
+	Level     Level          `json:"level"`
+	Component string         `json:"component"`
+	Message   string         `json:"message"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+func (e Entry) format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]", e.Component)
+	if e.Level >= LevelWarn {
+		fmt.Fprintf(&b, " %s:", strings.ToUpper(e.Level.String()))
+	}
+	b.WriteString(" ")
+	b.WriteString(e.Message)
+	if len(e.Fields) > 0 {
+		keys := make([]string, 0, len(e.Fields))
+		for k := range e.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, " %s=%v", k, e.Fields[k])
+		}
+	}
+	return b.String()
+}
+
+// Logger writes entries tagged with a component name.
+type Logger struct {
+	component string
+	fields    map[string]any
+}
+
+// New returns a logger for the given component, e.g. "unified-tunnel".
+func New(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// With returns a logger that attaches key=value to every entry.
+func (l *Logger) With(key string, value any) *Logger {
+	fields := make(map[string]any, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Logger{component: l.component, fields: fields}
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.log(LevelDebug, format, args) }
+func (l *Logger) Infof(format string, args ...any)  { l.log(LevelInfo, format, args) }
+func (l *Logger) Warnf(format string, args ...any)  { l.log(LevelWarn, format, args) }
+func (l *Logger) Errorf(format string, args ...any) { l.log(LevelError, format, args) }
+
+func (l *Logger) log(level Level, format string, args []any) {
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
+	}
+	e := defaultBuffer.add(Entry{
+		Time:      time.Now(),
+		Level:     level,
+		Component: l.component,
+		Message:   strings.TrimRight(msg, "\n"),
+		Fields:    l.fields,
+	})
+	writeOutput(e)
+}
+
+var (
+	levelMu     sync.RWMutex
+	outputLevel = LevelDebug
+)
+
+// SetOutputLevel sets the minimum level printed to stdout. The ring buffer
+// keeps every level regardless, so it can be filtered when queried.
+func SetOutputLevel(level Level) {
+	levelMu.Lock()
+	outputLevel = level
+	levelMu.Unlock()
+}
+
+// OutputLevel returns the minimum level printed to stdout.
+func OutputLevel() Level {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	return outputLevel
+}
+
+func writeOutput(e Entry) {
+	if e.Level < OutputLevel() {
+		return
+	}
+	fmt.Fprintln(os.Stdout, e.format())
+}
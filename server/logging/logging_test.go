@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBufferWrapsAndFilters(t *testing.T) {
+	b := NewBuffer(3)
+	for i, e := range []Entry{
+		{Level: LevelDebug, Component: "a", Message: "one"},
+		{Level: LevelInfo, Component: "b", Message: "two"},
+		{Level: LevelWarn, Component: "a", Message: "three"},
+		{Level: LevelError, Component: "b", Message: "Four"},
+	} {
+		if got := b.add(e); got.Seq != uint64(i+1) {
+			t.Fatalf("entry %d: seq = %d", i, got.Seq)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		limit  int
+		want   []string
+	}{
+		{"all, oldest dropped", Filter{}, 0, []string{"two", "three", "Four"}},
+		{"limit keeps newest", Filter{}, 2, []string{"three", "Four"}},
+		{"min level", Filter{MinLevel: LevelWarn}, 0, []string{"three", "Four"}},
+		{"component", Filter{Component: "b"}, 0, []string{"two", "Four"}},
+		{"contains ignores case", Filter{Contains: "four"}, 0, []string{"Four"}},
+		{"after seq", Filter{AfterSeq: 3}, 0, []string{"Four"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, e := range b.Query(tt.filter, tt.limit) {
+				got = append(got, e.Message)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLogs(t *testing.T) {
+	SetOutputLevel(LevelError + 1) // keep test output quiet
+	defer SetOutputLevel(LevelDebug)
+
+	New("logging-test").With("k", 1).Warnf("hello %s", "world")
+
+	rec := httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs?component=logging-test&level=warn", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Entries []Entry `json:"entries"`
+		LastSeq uint64  `json:"last_seq"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 1 {
+		t.Fatalf("entries = %+v", resp.Entries)
+	}
+	e := resp.Entries[0]
+	if e.Message != "hello world" || e.Level != LevelWarn || e.Fields["k"] != float64(1) || resp.LastSeq != e.Seq {
+		t.Errorf("entry = %+v, last_seq = %d", e, resp.LastSeq)
+	}
+
+	rec = httptest.NewRecorder()
+	handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/logs?level=loud", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid level: status = %d", rec.Code)
+	}
+}
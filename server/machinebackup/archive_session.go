@@ -1,6 +1,7 @@
 package machinebackup
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/xhd2015/ai-critic/server/storage"
 )
 
 const archiveSessionTTL = 30 * time.Minute
@@ -16,6 +19,22 @@ const archiveSessionTTL = 30 * time.Minute
 type archiveSession struct {
 	path    string
 	created time.Time
+
+	// remote holds the archive under remoteKey instead of path when it was
+	// offloaded to the configured storage backend.
+	remote    storage.Backend
+	remoteKey string
+}
+
+// remove deletes the archive wherever it is stored.
+func (s *archiveSession) remove() {
+	if s.remote != nil {
+		if err := s.remote.Delete(context.Background(), s.remoteKey); err != nil {
+			fmt.Fprintf(os.Stderr, "machine backup: delete %s from %s: %v\n", s.remoteKey, s.remote.Name(), err)
+		}
+		return
+	}
+	os.Remove(s.path)
 }
 
 var archiveSessions sync.Map
@@ -30,6 +49,18 @@ func registerArchiveSession(path string) (string, error) {
 	return token, nil
 }
 
+// registerRemoteArchiveSession registers an archive that was offloaded to
+// backend under key.
+func registerRemoteArchiveSession(backend storage.Backend, key string) (string, error) {
+	token, err := newArchiveToken()
+	if err != nil {
+		return "", err
+	}
+	archiveSessions.Store(token, &archiveSession{created: time.Now().UTC(), remote: backend, remoteKey: key})
+	go purgeExpiredArchiveSessions()
+	return token, nil
+}
+
 func openArchiveSession(token string) (io.ReadCloser, error) {
 	token = strings.TrimSpace(token)
 	if token == "" {
@@ -44,9 +75,17 @@ func openArchiveSession(token string) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("invalid archive session")
 	}
 	if time.Since(sess.created) > archiveSessionTTL {
-		os.Remove(sess.path)
+		sess.remove()
 		return nil, fmt.Errorf("archive session expired")
 	}
+	if sess.remote != nil {
+		body, err := sess.remote.Get(context.Background(), sess.remoteKey)
+		if err != nil {
+			sess.remove()
+			return nil, fmt.Errorf("open archive: %w", err)
+		}
+		return &remoteArchiveBody{ReadCloser: body, sess: sess}, nil
+	}
 	f, err := os.Open(sess.path)
 	if err != nil {
 		os.Remove(sess.path)
@@ -66,6 +105,17 @@ func (f *archiveSessionFile) Close() error {
 	return err
 }
 
+type remoteArchiveBody struct {
+	io.ReadCloser
+	sess *archiveSession
+}
+
+func (b *remoteArchiveBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.sess.remove()
+	return err
+}
+
 func newArchiveToken() (string, error) {
 	var b [16]byte
 	if _, err := rand.Read(b[:]); err != nil {
@@ -83,7 +133,7 @@ func purgeExpiredArchiveSessions() {
 			return true
 		}
 		if sess.created.Before(cutoff) {
-			os.Remove(sess.path)
+			sess.remove()
 			archiveSessions.Delete(key)
 		}
 		return true
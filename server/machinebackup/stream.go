@@ -2,12 +2,15 @@ package machinebackup
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 
+	"github.com/xhd2015/ai-critic/server/storage"
 	"github.com/xhd2015/ai-critic/server/streaming/progress"
 )
 
@@ -156,6 +159,31 @@ func packBackupArchive(pw *progress.Writer, prepared *backupPrepared) (token str
 	if err != nil {
 		return "", 0, fmt.Errorf("stat temp archive: %w", err)
 	}
+	if backend, ok := storage.Remote(); ok {
+		// keep the archive off the local disk until it is downloaded
+		key := "machine-backups/" + filepath.Base(tmpPath)
+		if err := pw.EmitProgress(progress.Item{
+			Layer:  "pack",
+			Name:   "offload",
+			Detail: fmt.Sprintf("uploading %s to %s", formatSize(info.Size()), backend.Name()),
+		}); err != nil {
+			return "", 0, err
+		}
+		if offloadErr := storage.Offload(context.Background(), backend, tmpPath, key); offloadErr == nil {
+			token, err = registerRemoteArchiveSession(backend, key)
+			if err != nil {
+				backend.Delete(context.Background(), key)
+				return "", 0, err
+			}
+			return token, info.Size(), nil
+		} else if err := pw.EmitProgress(progress.Item{
+			Layer:  "pack",
+			Name:   "offload",
+			Detail: "upload failed, keeping the archive locally: " + offloadErr.Error(),
+		}); err != nil {
+			return "", 0, err
+		}
+	}
 	token, err = registerArchiveSession(tmpPath)
 	if err != nil {
 		return "", 0, err
@@ -0,0 +1,119 @@
+package markdown
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// RegisterAPI registers the markdown endpoints:
+//
+//	POST /api/markdown/render {markdown, style, inline_styles, hard_wraps}   -> {html}
+//	GET  /api/markdown/file?path=...&style=...                             -> {path, html}
+//	GET  /api/markdown/css?style=...                                       stylesheet for class-highlighted code
+//	GET  /api/markdown/styles                                              available style names
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/markdown/render", handleRender)
+	mux.HandleFunc("/api/markdown/file", handleFile)
+	mux.HandleFunc("/api/markdown/css", handleCSS)
+	mux.HandleFunc("/api/markdown/styles", handleStyles)
+}
+
+func handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		Markdown string `json:"markdown"`
+		Options
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxSourceSize+4096)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	html, err := Render([]byte(req.Markdown), req.Options)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"html": html})
+}
+
+// handleFile renders a markdown file on the server, e.g. a project README.
+func handleFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path is required"})
+		return
+	}
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	if info.IsDir() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "path is a directory"})
+		return
+	}
+	if info.Size() > MaxSourceSize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "file too large to render"})
+		return
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	html, err := Render(src, Options{Style: q.Get("style"), InlineStyles: q.Get("inline_styles") == "true"})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"path": path, "html": html})
+}
+
+func handleCSS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	css, err := CSS(r.URL.Query().Get("style"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write([]byte(css))
+}
+
+func handleStyles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"default": DefaultStyle,
+		"styles":  styles.Names(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,119 @@
+// Package markdown renders markdown to HTML on the server, so phones can
+// show AI responses and README previews without the client-side markdown
+// and highlighting bundle.
+//
+// Output is safe to insert into a page: raw HTML in the source is dropped
+// and links with dangerous schemes (javascript:, vbscript:, ...) are
+// removed. Code blocks are highlighted with chroma, either with CSS classes
+// (pair with CSS for the style) or with inline styles.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// DefaultStyle is the chroma style used when Options.Style is empty.
+const DefaultStyle = "github"
+
+// MaxSourceSize bounds the markdown accepted for rendering.
+const MaxSourceSize = 1 << 20
+
+// Options controls rendering.
+type Options struct {
+	// Style is a chroma style name, e.g. "github" or "monokai".
+	Style string `json:"style"`
+	// InlineStyles emits style attributes on highlighted code instead of
+	// CSS classes, for contexts where the stylesheet is not loaded.
+	InlineStyles bool `json:"inline_styles"`
+	// HardWraps renders single newlines as <br>, as chat messages expect.
+	HardWraps bool `json:"hard_wraps"`
+}
+
+var (
+	renderersMu sync.Mutex
+	renderers   = make(map[Options]goldmark.Markdown)
+)
+
+// ValidStyle reports whether style names a known chroma style.
+func ValidStyle(style string) bool {
+	_, ok := styles.Registry[strings.ToLower(style)]
+	return ok
+}
+
+// Render converts GitHub-flavored markdown to sanitized HTML.
+func Render(src []byte, opts Options) (string, error) {
+	if len(src) > MaxSourceSize {
+		return "", fmt.Errorf("markdown too large: %d bytes (max %d)", len(src), MaxSourceSize)
+	}
+	md, err := renderer(opts)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := md.Convert(src, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CSS returns the stylesheet for code highlighted with CSS classes in the
+// given style.
+func CSS(style string) (string, error) {
+	if style == "" {
+		style = DefaultStyle
+	}
+	if !ValidStyle(style) {
+		return "", fmt.Errorf("unknown style: %s", style)
+	}
+	var buf bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get(style)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func renderer(opts Options) (goldmark.Markdown, error) {
+	opts.Style = strings.ToLower(opts.Style)
+	if opts.Style == "" {
+		opts.Style = DefaultStyle
+	}
+	if !ValidStyle(opts.Style) {
+		return nil, fmt.Errorf("unknown style: %s", opts.Style)
+	}
+
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	if md, ok := renderers[opts]; ok {
+		return md, nil
+	}
+
+	// html.WithUnsafe is deliberately not set: raw HTML is omitted and
+	// dangerous link URLs are dropped.
+	rendererOpts := []goldmark.Option{
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle(opts.Style),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(!opts.InlineStyles)),
+			),
+		),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	}
+	if opts.HardWraps {
+		rendererOpts = append(rendererOpts, goldmark.WithRendererOptions(html.WithHardWraps()))
+	}
+	md := goldmark.New(rendererOpts...)
+	renderers[opts] = md
+	return md, nil
+}
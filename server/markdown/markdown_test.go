@@ -0,0 +1,83 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "raw html is dropped",
+			src:     "hi <script>alert(1)</script> <img src=x onerror=alert(1)>",
+			want:    []string{"hi"},
+			notWant: []string{"<script", "onerror"},
+		},
+		{
+			name:    "dangerous links are dropped",
+			src:     "[x](javascript:alert(1)) [ok](https://example.com)",
+			want:    []string{`href="https://example.com"`},
+			notWant: []string{"javascript:"},
+		},
+		{
+			name:    "code highlighted with classes",
+			src:     "```go\nfunc main() {}\n```",
+			want:    []string{`class="chroma"`, `<span class="kd">func</span>`},
+			notWant: []string{"style="},
+		},
+		{
+			name: "code highlighted inline",
+			src:  "```go\nfunc main() {}\n```",
+			opts: Options{InlineStyles: true},
+			want: []string{"style="},
+		},
+		{
+			name: "gfm tables and task lists",
+			src:  "| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done",
+			want: []string{"<table>", "<td>2</td>", `type="checkbox"`},
+		},
+		{
+			name: "hard wraps",
+			src:  "line one\nline two",
+			opts: Options{HardWraps: true},
+			want: []string{"line one<br>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render([]byte(tt.src), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("output missing %q:\n%s", w, got)
+				}
+			}
+			for _, nw := range tt.notWant {
+				if strings.Contains(got, nw) {
+					t.Errorf("output contains %q:\n%s", nw, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStyles(t *testing.T) {
+	if _, err := Render([]byte("x"), Options{Style: "no-such-style"}); err == nil {
+		t.Errorf("unknown style accepted")
+	}
+	css, err := CSS("Monokai")
+	if err != nil || !strings.Contains(css, ".chroma") {
+		t.Fatalf("CSS(Monokai) = %q, %v", css, err)
+	}
+	if _, err := CSS("no-such-style"); err == nil {
+		t.Errorf("unknown style accepted")
+	}
+}
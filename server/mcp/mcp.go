@@ -0,0 +1,150 @@
+// Package mcp serves the Model Context Protocol at /api/mcp, so an MCP
+// capable agent can review and change a repository through tools instead of
+// raw shell access.
+//
+// Each tool call is served by making the equivalent HTTP API call through
+// the server's handler, with the caller's credentials: it passes the same
+// authentication, role checks, exec policy and audit log as the call made
+// from the web UI would.
+//
+// Only the request/response half of the streamable HTTP transport is
+// implemented: every POST is answered with a single JSON-RPC response and
+// the server never initiates messages.
+package mcp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// ProtocolVersion is the latest MCP revision the server speaks.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the revisions a client may negotiate.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+var (
+	dispatchMu sync.RWMutex
+	dispatcher http.Handler
+)
+
+// SetDispatcher sets the handler tool calls are served by. It must be the
+// server's handler behind authentication and auditing.
+func SetDispatcher(h http.Handler) {
+	dispatchMu.Lock()
+	defer dispatchMu.Unlock()
+	dispatcher = h
+}
+
+func getDispatcher() http.Handler {
+	dispatchMu.RLock()
+	defer dispatchMu.RUnlock()
+	return dispatcher
+}
+
+// RegisterAPI registers the MCP endpoint:
+//
+//	POST /api/mcp {JSON-RPC request}      -> JSON-RPC response
+//	POST /api/mcp {JSON-RPC notification} -> 202
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/mcp", handleMCP)
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func handleMCP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// no server-initiated stream to GET, no session to DELETE
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(w, rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: "invalid JSON-RPC message"}})
+		return
+	}
+	if len(req.ID) == 0 {
+		// notifications (e.g. notifications/initialized) need no answer
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp := rpcResponse{ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}
+		writeResponse(w, resp)
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		resp.Result, resp.Error = initialize(req.Params)
+	case "ping":
+		resp.Result = struct{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": tools}
+	case "tools/call":
+		resp.Result, resp.Error = callTool(r, req.Params)
+	default:
+		resp.Error = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	writeResponse(w, resp)
+}
+
+func writeResponse(w http.ResponseWriter, resp rpcResponse) {
+	resp.JSONRPC = "2.0"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func initialize(params json.RawMessage) (interface{}, *rpcError) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	// answer with the client's revision if supported, else ours
+	version := ProtocolVersion
+	for _, v := range supportedVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+		"serverInfo":      map[string]string{"name": "ai-critic", "version": "1.0.0"},
+		"instructions":    "Tools operate on git repositories on the server. dir is the repository directory; it defaults to the current project for get_diff, get_status, stage_file and unstage_file.",
+	}, nil
+}
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rpc posts a JSON-RPC message to the MCP endpoint.
+func rpc(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/mcp", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handleMCP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) (result json.RawMessage, rpcErr *rpcError) {
+	t.Helper()
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return resp.Result, resp.Error
+}
+
+// callResult calls a tool and returns the text of its result.
+func callResult(t *testing.T, name, args string) (text string, isError bool) {
+	t.Helper()
+	result, rpcErr := decode(t, rpc(t, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+name+`","arguments":`+args+`}}`))
+	if rpcErr != nil {
+		t.Fatalf("%s: %+v", name, rpcErr)
+	}
+	var res toolResult
+	if err := json.Unmarshal(result, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Content[0].Text, res.IsError
+}
+
+func TestInitializeAndList(t *testing.T) {
+	result, rpcErr := decode(t, rpc(t, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`))
+	if rpcErr != nil || !strings.Contains(string(result), `"protocolVersion":"2025-03-26"`) {
+		t.Errorf("initialize: %s %+v", result, rpcErr)
+	}
+
+	if rec := rpc(t, `{"jsonrpc":"2.0","method":"notifications/initialized"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("notification answered %d", rec.Code)
+	}
+
+	result, _ = decode(t, rpc(t, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`))
+	var list struct {
+		Tools []tool `json:"tools"`
+	}
+	if err := json.Unmarshal(result, &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tl := range list.Tools {
+		if !json.Valid(tl.InputSchema) {
+			t.Errorf("%s: invalid input schema", tl.Name)
+		}
+		names = append(names, tl.Name)
+	}
+	if got := strings.Join(names, ","); got != "get_diff,get_status,stage_file,unstage_file,run_tests,create_checkpoint" {
+		t.Errorf("tools %s", got)
+	}
+
+	if _, rpcErr := decode(t, rpc(t, `{"jsonrpc":"2.0","id":3,"method":"resources/list"}`)); rpcErr == nil || rpcErr.Code != codeMethodNotFound {
+		t.Errorf("unknown method: %+v", rpcErr)
+	}
+}
+
+func TestToolCallsGoThroughTheAPI(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/review/stage", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(body))
+		if strings.Contains(string(body), "secret.txt") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"not allowed"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	mux.HandleFunc("/api/review/diff", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"stagedDiff":"+a\n","workingTreeDiff":""}`))
+	})
+	mux.HandleFunc("/api/exec", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, r.URL.Path+" "+string(body))
+		w.Write([]byte(`{"type":"stdout","data":"--- FAIL: TestX\n"}` + "\n" + `{"type":"heartbeat"}` + "\n" + `{"type":"exit","code":1}` + "\n"))
+	})
+	SetDispatcher(mux)
+	defer SetDispatcher(nil)
+
+	if text, isErr := callResult(t, "stage_file", `{"dir":"/repo","path":"a.go"}`); isErr || text != `{"status":"ok"}` {
+		t.Errorf("stage_file: %q %v", text, isErr)
+	}
+	if text, isErr := callResult(t, "stage_file", `{"path":"secret.txt"}`); !isErr || !strings.Contains(text, "403 not allowed") {
+		t.Errorf("denied stage_file: %q %v", text, isErr)
+	}
+	if want := `POST /api/review/stage Bearer secret {"dir":"/repo","worktree":"","path":"a.go"}`; calls[0] != want {
+		t.Errorf("API call %q, want %q", calls[0], want)
+	}
+
+	if text, _ := callResult(t, "get_diff", `{}`); text != "Staged changes:\n\n+a\n\n" {
+		t.Errorf("get_diff: %q", text)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text, isErr := callResult(t, "run_tests", `{"dir":"`+dir+`"}`)
+	if !isErr || !strings.Contains(text, "--- FAIL: TestX") || !strings.HasSuffix(text, "exit code 1") {
+		t.Errorf("run_tests: %q %v", text, isErr)
+	}
+	if want := `/api/exec {"argv":["go","test","./..."],"dir":"` + dir + `"}`; calls[len(calls)-1] != want {
+		t.Errorf("exec call %q, want %q", calls[len(calls)-1], want)
+	}
+}
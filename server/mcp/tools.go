@@ -0,0 +1,346 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tool is an MCP tool backed by HTTP API calls.
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	// call runs the tool for request r; a returned error is reported to the
+	// agent as a failed tool call
+	call func(r *http.Request, args json.RawMessage) (string, error)
+}
+
+const repoProps = `"dir":{"type":"string","description":"Repository directory, defaults to the current project"},
+"worktree":{"type":"string","description":"Worktree of dir to use instead: path, branch or worktree ID"}`
+
+var tools = []tool{
+	{
+		Name:        "get_diff",
+		Description: "Show the staged and unstaged changes of a repository as unified diffs.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` + repoProps + `}}`),
+		call:        getDiff,
+	},
+	{
+		Name:        "get_status",
+		Description: "Show the branch and the changed, staged and untracked files of a repository.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` + repoProps + `}}`),
+		call:        repoCall("/api/review/status"),
+	},
+	{
+		Name:        "stage_file",
+		Description: "Stage a file (git add).",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` + repoProps + `,
+"path":{"type":"string","description":"File to stage, relative to dir"}},"required":["path"]}`),
+		call: repoCall("/api/review/stage"),
+	},
+	{
+		Name:        "unstage_file",
+		Description: "Unstage a file, keeping its changes in the working tree.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{` + repoProps + `,
+"path":{"type":"string","description":"File to unstage, relative to dir"}},"required":["path"]}`),
+		call: repoCall("/api/review/unstage"),
+	},
+	{
+		Name:        "run_tests",
+		Description: "Run the tests of a project and report their output and exit code. The command is subject to the server's exec policy.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{
+"dir":{"type":"string","description":"Project directory to run the tests in"},
+"command":{"type":"array","items":{"type":"string"},"description":"Test command and arguments, detected from the project (go test, npm test, cargo test, make test) when omitted"}},"required":["dir"]}`),
+		call: runTests,
+	},
+	{
+		Name:        "create_checkpoint",
+		Description: "Snapshot changed files of a project as a checkpoint that can be restored later.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{
+"project":{"type":"string","description":"Project name"},
+"project_dir":{"type":"string","description":"Project directory"},
+"name":{"type":"string","description":"Checkpoint name"},
+"message":{"type":"string","description":"What the checkpoint is for"},
+"file_paths":{"type":"array","items":{"type":"string"},"description":"Files to include, all changed files when omitted"}},"required":["project","project_dir"]}`),
+		call: createCheckpoint,
+	},
+}
+
+func findTool(name string) *tool {
+	for i := range tools {
+		if tools[i].Name == name {
+			return &tools[i]
+		}
+	}
+	return nil
+}
+
+// toolResult is the result of tools/call.
+type toolResult struct {
+	Content []toolContent `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type toolContent struct {
+	Type string `json:"type"` // always "text"
+	Text string `json:"text"`
+}
+
+func callTool(r *http.Request, params json.RawMessage) (interface{}, *rpcError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	t := findTool(p.Name)
+	if t == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + p.Name}
+	}
+	if len(p.Arguments) == 0 {
+		p.Arguments = json.RawMessage("{}")
+	}
+	text, err := t.call(r, p.Arguments)
+	if err != nil {
+		return toolResult{Content: []toolContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return toolResult{Content: []toolContent{{Type: "text", Text: text}}}, nil
+}
+
+// repoCall returns a tool posting its arguments to a review endpoint, which
+// all take dir, worktree and path, and returning the JSON response.
+func repoCall(path string) func(r *http.Request, args json.RawMessage) (string, error) {
+	return func(r *http.Request, args json.RawMessage) (string, error) {
+		var req struct {
+			Dir      string `json:"dir"`
+			Worktree string `json:"worktree"`
+			Path     string `json:"path,omitempty"`
+		}
+		if err := json.Unmarshal(args, &req); err != nil {
+			return "", err
+		}
+		data, err := callAPI(r, http.MethodPost, path, req)
+		return string(data), err
+	}
+}
+
+func getDiff(r *http.Request, args json.RawMessage) (string, error) {
+	var req struct {
+		Dir      string `json:"dir"`
+		Worktree string `json:"worktree"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return "", err
+	}
+	data, err := callAPI(r, http.MethodPost, "/api/review/diff", req)
+	if err != nil {
+		return "", err
+	}
+	var diff struct {
+		WorkingTreeDiff string `json:"workingTreeDiff"`
+		StagedDiff      string `json:"stagedDiff"`
+	}
+	if err := json.Unmarshal(data, &diff); err != nil {
+		return "", err
+	}
+	if diff.WorkingTreeDiff == "" && diff.StagedDiff == "" {
+		return "No changes.", nil
+	}
+	var b strings.Builder
+	if diff.StagedDiff != "" {
+		b.WriteString("Staged changes:\n\n" + diff.StagedDiff + "\n")
+	}
+	if diff.WorkingTreeDiff != "" {
+		b.WriteString("Unstaged changes:\n\n" + diff.WorkingTreeDiff + "\n")
+	}
+	return b.String(), nil
+}
+
+func runTests(r *http.Request, args json.RawMessage) (string, error) {
+	var req struct {
+		Dir     string   `json:"dir"`
+		Command []string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return "", err
+	}
+	if req.Dir == "" {
+		return "", fmt.Errorf("dir is required")
+	}
+	argv := req.Command
+	if len(argv) == 0 {
+		argv = detectTestCommand(req.Dir)
+		if argv == nil {
+			return "", fmt.Errorf("cannot tell how to run the tests of %s, pass a command", req.Dir)
+		}
+	}
+
+	data, err := callAPI(r, http.MethodPost, "/api/exec", map[string]interface{}{"argv": argv, "dir": req.Dir})
+	if err != nil {
+		return "", err
+	}
+	// the exec stream: stdout, stderr, heartbeat, exit and error events
+	var out strings.Builder
+	exitCode := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type    string `json:"type"`
+			Data    string `json:"data"`
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+		switch event.Type {
+		case "stdout", "stderr":
+			out.WriteString(event.Data)
+		case "exit":
+			exitCode = event.Code
+		case "error":
+			return "", fmt.Errorf("%s: %s", strings.Join(argv, " "), event.Message)
+		}
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("$ %s\n%s\nexit code %d", strings.Join(argv, " "), out.String(), exitCode)
+	}
+	return fmt.Sprintf("$ %s\n%s\nexit code 0", strings.Join(argv, " "), out.String()), nil
+}
+
+// testCommands are the test commands of project kinds, by the file marking
+// the kind, in order of preference.
+var testCommands = []struct {
+	file string
+	argv []string
+}{
+	{"go.mod", []string{"go", "test", "./..."}},
+	{"Cargo.toml", []string{"cargo", "test"}},
+	{"package.json", []string{"npm", "test"}},
+	{"Makefile", []string{"make", "test"}},
+}
+
+func detectTestCommand(dir string) []string {
+	for _, c := range testCommands {
+		if _, err := os.Stat(filepath.Join(dir, c.file)); err == nil {
+			return c.argv
+		}
+	}
+	return nil
+}
+
+func createCheckpoint(r *http.Request, args json.RawMessage) (string, error) {
+	var req struct {
+		Project    string   `json:"project"`
+		ProjectDir string   `json:"project_dir"`
+		Name       string   `json:"name"`
+		Message    string   `json:"message"`
+		FilePaths  []string `json:"file_paths"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return "", err
+	}
+	if req.Project == "" {
+		return "", fmt.Errorf("project is required")
+	}
+	query := url.Values{"project": {req.Project}}
+	if len(req.FilePaths) == 0 {
+		data, err := callAPI(r, http.MethodGet, "/api/checkpoints/current?"+url.Values{"project": {req.Project}, "project_dir": {req.ProjectDir}}.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		var changes []struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(data, &changes); err != nil {
+			return "", err
+		}
+		for _, c := range changes {
+			req.FilePaths = append(req.FilePaths, c.Path)
+		}
+		if len(req.FilePaths) == 0 {
+			return "", fmt.Errorf("no changed files to checkpoint")
+		}
+	}
+	data, err := callAPI(r, http.MethodPost, "/api/checkpoints?"+query.Encode(), req)
+	return string(data), err
+}
+
+// callAPI serves an API call through the dispatcher as the user of r and
+// returns the response body, or an error for a failed call.
+func callAPI(r *http.Request, method, path string, body interface{}) ([]byte, error) {
+	h := getDispatcher()
+	if h == nil {
+		return nil, fmt.Errorf("the MCP server is not connected to the API")
+	}
+	var reqBody bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody.Reset(data)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, path, &reqBody)
+	if err != nil {
+		return nil, err
+	}
+	// carry the caller's credentials and project, nothing about the MCP call
+	req.Header = r.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Header.Del("Mcp-Session-Id")
+	req.Header.Del("Mcp-Protocol-Version")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.RemoteAddr = r.RemoteAddr
+	req.Host = r.Host
+
+	rec := &responseRecorder{header: http.Header{}, status: http.StatusOK}
+	h.ServeHTTP(rec, req)
+	data := rec.body.Bytes()
+	if rec.status >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return nil, fmt.Errorf("%s %s: %d %s", method, strings.SplitN(path, "?", 2)[0], rec.status, msg)
+	}
+	return data, nil
+}
+
+// responseRecorder buffers the response of a dispatched API call.
+type responseRecorder struct {
+	header http.Header
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) Header() http.Header { return rec.header }
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wrote {
+		rec.status = status
+		rec.wrote = true
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wrote = true
+	return rec.body.Write(b)
+}
+
+// Flush is a no-op, streaming endpoints are read once they are done.
+func (rec *responseRecorder) Flush() {}
@@ -0,0 +1,298 @@
+// Package metrics exposes the server's metrics at /metrics in the
+// Prometheus text format, so self-hosters can scrape the instance into
+// their existing dashboards.
+//
+// Metrics are declared as package variables of the packages that update
+// them, with NewCounter, NewGauge and NewHistogram; values computed on
+// scrape, such as session counts, are registered with GaugeFunc.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prefix namespaces every metric name.
+const Prefix = "aicritic_"
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 30s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]collector{}
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry[c.name()] = c
+}
+
+// desc is what every metric has: a name, help text and label names.
+type desc struct {
+	fullName string
+	help     string
+	labels   []string
+}
+
+func (d *desc) name() string { return d.fullName }
+
+func (d *desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fullName, escapeHelp(d.help), d.fullName, typ)
+}
+
+// key joins label values into a map key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.fullName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString formats labels and their values as {a="x",b="y"}, with
+// extra appended (for the le label of histogram buckets).
+func (d *desc) labelString(key string, extra ...string) string {
+	var values []string
+	if key != "" || len(d.labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+	var parts []string
+	for i, l := range d.labels {
+		parts = append(parts, l+`="`+escapeValue(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+escapeValue(extra[i+1])+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter declares a counter; name gets Prefix and should end in _total.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{Prefix + name, help, labels}, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	k := c.key(labelValues)
+	c.mu.Lock()
+	c.values[k] += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.fullName, c.labelString(k), formatFloat(c.values[k]))
+	}
+}
+
+// Gauge is a value per label set that goes up and down.
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge declares a gauge; name gets Prefix.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{Prefix + name, help, labels}, values: map[string]float64{}}
+	register(g)
+	return g
+}
+
+// Add adds v (possibly negative) to the gauge of the label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	g.values[k] += v
+	g.mu.Unlock()
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	k := g.key(labelValues)
+	g.mu.Lock()
+	g.values[k] = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.header(w, "gauge")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.fullName, g.labelString(k), formatFloat(g.values[k]))
+	}
+}
+
+// gaugeFunc is a gauge whose values are collected on scrape.
+type gaugeFunc struct {
+	desc
+	collect func(set func(v float64, labelValues ...string))
+}
+
+// GaugeFunc declares a gauge computed on every scrape: collect calls set
+// once per label set. name gets Prefix.
+func GaugeFunc(name, help string, labels []string, collect func(set func(v float64, labelValues ...string))) {
+	register(&gaugeFunc{desc: desc{Prefix + name, help, labels}, collect: collect})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	values := map[string]float64{}
+	g.collect(func(v float64, labelValues ...string) {
+		values[g.key(labelValues)] = v
+	})
+	g.header(w, "gauge")
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.fullName, g.labelString(k), formatFloat(values[k]))
+	}
+}
+
+// Histogram counts observations into buckets per label set.
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, ascending, without +Inf
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram declares a histogram with the given bucket upper bounds
+// (DefaultBuckets if nil); name gets Prefix.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{desc: desc{Prefix + name, help, labels}, buckets: buckets, series: map[string]*histogramSeries{}}
+	register(h)
+	return h
+}
+
+// Observe records v for the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[k] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fullName, h.labelString(k, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fullName, h.labelString(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fullName, h.labelString(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fullName, h.labelString(k), s.count)
+	}
+}
+
+// Write writes every metric in the Prometheus text format, sorted by name.
+func Write(w io.Writer) {
+	registryMu.Lock()
+	list := make([]collector, 0, len(registry))
+	for _, c := range registry {
+		list = append(list, c)
+	}
+	registryMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	for _, c := range list {
+		c.write(w)
+	}
+}
+
+// RegisterAPI registers GET /metrics. It is admin only, enforced by
+// auth.Middleware: scrape with an admin API token as bearer token.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("scrape: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	return rec.Body.String()
+}
+
+func expectLines(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	for _, l := range lines {
+		if !strings.Contains(out, "\n"+l+"\n") && !strings.HasPrefix(out, l+"\n") {
+			t.Errorf("missing line %q in:\n%s", l, out)
+		}
+	}
+}
+
+func TestExposition(t *testing.T) {
+	c := NewCounter("test_things_total", "Things.\nCounted.", "kind")
+	c.Inc(`a"b`)
+	c.Add(2.5, `a"b`)
+	c.Add(-1, `a"b`)
+	h := NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	GaugeFunc("test_sessions", "Sessions.", []string{"status"}, func(set func(float64, ...string)) {
+		set(2, "running")
+		set(0, "error")
+	})
+
+	out := scrape(t)
+	expectLines(t, out,
+		`# HELP aicritic_test_things_total Things.\nCounted.`,
+		`# TYPE aicritic_test_things_total counter`,
+		`aicritic_test_things_total{kind="a\"b"} 3.5`,
+		`# TYPE aicritic_test_latency_seconds histogram`,
+		`aicritic_test_latency_seconds_bucket{le="0.1"} 1`,
+		`aicritic_test_latency_seconds_bucket{le="1"} 2`,
+		`aicritic_test_latency_seconds_bucket{le="+Inf"} 3`,
+		`aicritic_test_latency_seconds_sum 5.55`,
+		`aicritic_test_latency_seconds_count 3`,
+		`aicritic_test_sessions{status="error"} 0`,
+		`aicritic_test_sessions{status="running"} 2`,
+	)
+	if strings.Index(out, "aicritic_test_latency") > strings.Index(out, "aicritic_test_things") {
+		t.Error("metrics not sorted by name")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	var open string
+	mux.HandleFunc("/api/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		open = scrape(t)
+	})
+	h := Middleware(mux)
+	for _, path := range []string{"/api/items/1", "/api/items/2", "/nope", "/api/stream"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expectLines(t, open, `aicritic_sse_streams_active{route="/api/stream"} 1`)
+	out := scrape(t)
+	expectLines(t, out,
+		`aicritic_http_request_duration_seconds_count{method="GET",route="/api/items/{id}",code="418"} 2`,
+		`aicritic_http_request_duration_seconds_count{method="GET",route="unmatched",code="404"} 1`,
+		`aicritic_sse_streams_active{route="/api/stream"} 0`,
+	)
+	if strings.Contains(out, `route="/api/stream",code=`) {
+		t.Error("event stream counted in the latency histogram")
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	requestDuration = NewHistogram("http_request_duration_seconds",
+		"Latency of HTTP requests by route pattern, excluding event streams.",
+		nil, "method", "route", "code")
+	sseStreams = NewGauge("sse_streams_active",
+		"Server-sent event streams currently open, by route pattern.", "route")
+)
+
+// Middleware records request latency and open event streams. It must wrap
+// the ServeMux directly: the route label is the mux pattern that matched,
+// which the mux sets on the request it is given.
+func Middleware(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := &recorder{ResponseWriter: w, r: r}
+		defer func() {
+			if rw.stream != "" {
+				sseStreams.Add(-1, rw.stream)
+				return
+			}
+			code := rw.status
+			if code == 0 {
+				code = http.StatusOK
+			}
+			requestDuration.Observe(time.Since(start).Seconds(), r.Method, route(r), strconv.Itoa(code))
+		}()
+		mux.ServeHTTP(rw, r)
+	})
+}
+
+// route returns the pattern that matched r, with any method dropped as it
+// is a label of its own. Unmatched requests share one label, so scanners
+// probing random paths cannot grow the series without bound.
+func route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// recorder captures the status and notices when the response turns out
+// to be an event stream.
+type recorder struct {
+	http.ResponseWriter
+	r      *http.Request
+	status int
+	stream string // route of the open event stream, if this is one
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+		w.checkStream()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+		w.checkStream()
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+		w.checkStream()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recorder) checkStream() {
+	if w.status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = route(w.r)
+		sseStreams.Add(1, w.stream)
+	}
+}
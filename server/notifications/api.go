@@ -0,0 +1,130 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+// RegisterAPI registers the notification endpoints. Settings are admin only,
+// any user can subscribe their browser:
+//
+//	GET    /api/settings/notifications              -> {settings, event_types}
+//	POST   /api/settings/notifications {Settings}   -> {settings, event_types}
+//	POST   /api/settings/notifications/test         -> {results}
+//	GET    /api/notifications/vapid-public-key      -> {key}
+//	POST   /api/notifications/subscriptions {Subscription}
+//	DELETE /api/notifications/subscriptions?endpoint=...
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/settings/notifications", handleSettings)
+	mux.HandleFunc("/api/settings/notifications/test", handleTest)
+	mux.HandleFunc("/api/notifications/vapid-public-key", handlePublicKey)
+	mux.HandleFunc("/api/notifications/subscriptions", handleSubscriptions)
+}
+
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var s Settings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if err := SetSettings(s); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := GetSettings()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if s.Events == nil {
+		s.Events = map[string]bool{}
+	}
+	if s.Targets == nil {
+		s.Targets = []Target{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"settings": s, "event_types": EventTypes})
+}
+
+// handleTest delivers a test notification and reports each delivery.
+func handleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*sendTimeout)
+	defer cancel()
+	results := deliver(ctx, Notification{
+		Event: EventTest,
+		Title: "Test notification",
+		Body:  "Notifications from ai-critic reach this device.",
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+func handlePublicKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, err := VAPIDPublicKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"key": key})
+}
+
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var sub Subscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		sub.User = ""
+		if id := auth.FromContext(r.Context()); id != nil {
+			sub.User = id.User
+		}
+		if err := Subscribe(sub); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	case http.MethodDelete:
+		endpoint := r.URL.Query().Get("endpoint")
+		if endpoint == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "endpoint is required"})
+			return
+		}
+		if err := Unsubscribe(endpoint); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
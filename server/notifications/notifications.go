@@ -0,0 +1,328 @@
+// Package notifications tells users about events they would otherwise have
+// to keep a tab open for: an agent finished, a review completed, a push
+// failed, a public URL went down. Notifications go to the Web Push
+// subscriptions of browsers and to ntfy topics and webhooks configured in
+// the settings, filtered by per-event preferences.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/events"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/logging"
+)
+
+// Event types, the unit of the preferences.
+const (
+	EventAgentFinished  = "agent_finished"
+	EventReviewDone     = "review_done"
+	EventPushFailed     = "push_failed"
+	EventTunnelDegraded = "tunnel_degraded"
+	// EventTest is sent by the test endpoint and cannot be turned off.
+	EventTest = "test"
+)
+
+// EventTypes lists the event types that have a preference.
+var EventTypes = []string{EventAgentFinished, EventReviewDone, EventPushFailed, EventTunnelDegraded}
+
+// Target types.
+const (
+	TargetNtfy    = "ntfy"
+	TargetWebhook = "webhook"
+)
+
+const (
+	// sendTimeout bounds one delivery.
+	sendTimeout = 15 * time.Second
+	// maxBody keeps a notification well inside a push message.
+	maxBody = 1024
+)
+
+// Notification is what is delivered to every target.
+type Notification struct {
+	Event   string `json:"event"`
+	Title   string `json:"title"`
+	Body    string `json:"body,omitempty"`
+	Project string `json:"project,omitempty"` // project directory, if any
+	// URL is opened when the notification is clicked, relative to the web UI.
+	URL string `json:"url,omitempty"`
+	// Urgent notifications (failures) are delivered with high priority.
+	Urgent bool   `json:"urgent,omitempty"`
+	Time   string `json:"time"` // RFC3339
+}
+
+// Target is an ntfy topic or a webhook notifications are posted to.
+type Target struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // TargetNtfy or TargetWebhook
+	// URL is the topic URL (e.g. https://ntfy.sh/my-topic) or the webhook.
+	URL string `json:"url"`
+	// Token is sent as a bearer token, for protected ntfy topics.
+	Token string `json:"token,omitempty"`
+}
+
+// Settings are the notification preferences of the instance.
+type Settings struct {
+	// Events turns event types on or off; types not listed are on.
+	Events  map[string]bool `json:"events"`
+	Targets []Target        `json:"targets"`
+	// Subject identifies the sender to Web Push services, a mailto: or
+	// https: URL; a default is used when empty.
+	Subject string `json:"subject,omitempty"`
+}
+
+// Enabled reports whether notifications of event type are sent.
+func (s Settings) Enabled(event string) bool {
+	on, ok := s.Events[event]
+	return !ok || on
+}
+
+// Subscription is the Web Push subscription of a browser, as the browser's
+// PushSubscription serializes to JSON.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	// User subscribed the browser; CreatedAt is RFC3339.
+	User      string `json:"user,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+type state struct {
+	Settings      Settings       `json:"settings"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	// VAPIDKey is the base64url raw P-256 private key Web Push requests
+	// are signed with, generated on first use.
+	VAPIDKey string `json:"vapid_key,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	stateFile = jsonfile.New[state](config.DataDir + "/notifications.json")
+	log       = logging.New("notifications")
+	client    = &http.Client{Timeout: sendTimeout}
+)
+
+// GetSettings returns the notification settings.
+func GetSettings() (Settings, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	st, err := stateFile.Get()
+	return st.Settings, err
+}
+
+// SetSettings validates and saves the notification settings.
+func SetSettings(s Settings) error {
+	for i, t := range s.Targets {
+		if t.Type != TargetNtfy && t.Type != TargetWebhook {
+			return fmt.Errorf("target %d: unknown type %q, want %q or %q", i+1, t.Type, TargetNtfy, TargetWebhook)
+		}
+		if !isHTTPURL(t.URL) {
+			return fmt.Errorf("target %d: invalid URL %q", i+1, t.URL)
+		}
+		if t.ID == "" {
+			s.Targets[i].ID = fmt.Sprintf("%s-%d", t.Type, i+1)
+		}
+	}
+	for event := range s.Events {
+		if !isEventType(event) {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return stateFile.Update(func(st *state) error {
+		st.Settings = s
+		return nil
+	})
+}
+
+func isEventType(event string) bool {
+	for _, e := range EventTypes {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe adds or refreshes the Web Push subscription of a browser.
+func Subscribe(sub Subscription) error {
+	if !isHTTPURL(sub.Endpoint) || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return fmt.Errorf("a subscription needs an endpoint and p256dh and auth keys")
+	}
+	if _, _, err := decodeSubscriptionKeys(sub); err != nil {
+		return err
+	}
+	sub.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	mu.Lock()
+	defer mu.Unlock()
+	return stateFile.Update(func(st *state) error {
+		st.Subscriptions = append(removeSubscription(st.Subscriptions, sub.Endpoint), sub)
+		return nil
+	})
+}
+
+// Unsubscribe removes the subscription with endpoint.
+func Unsubscribe(endpoint string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	return stateFile.Update(func(st *state) error {
+		st.Subscriptions = removeSubscription(st.Subscriptions, endpoint)
+		return nil
+	})
+}
+
+func removeSubscription(subs []Subscription, endpoint string) []Subscription {
+	kept := subs[:0]
+	for _, s := range subs {
+		if s.Endpoint != endpoint {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// Notify sends n in the background to every subscription and target, unless
+// its event type is turned off. Failures are logged: notifications are best
+// effort.
+func Notify(n Notification) {
+	if n.Time == "" {
+		n.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	if len(n.Body) > maxBody {
+		n.Body = strings.ToValidUTF8(n.Body[:maxBody], "") + "…"
+	}
+	events.Publish(events.TopicNotifications, n.Event, n)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*sendTimeout)
+		defer cancel()
+		for _, res := range deliver(ctx, n) {
+			if res.Error != "" {
+				log.Warnf("%s notification to %s failed: %s", n.Event, res.Target, res.Error)
+			}
+		}
+	}()
+}
+
+// DeliveryResult is the outcome of delivering a notification to one target
+// or subscription.
+type DeliveryResult struct {
+	Target string `json:"target"` // target ID or subscription endpoint
+	Error  string `json:"error,omitempty"`
+}
+
+// deliver sends n to everything configured and returns the outcome of each
+// delivery. Subscriptions the push service reports gone are removed.
+func deliver(ctx context.Context, n Notification) []DeliveryResult {
+	mu.Lock()
+	st, err := stateFile.Get()
+	mu.Unlock()
+	if err != nil {
+		return []DeliveryResult{{Target: "settings", Error: err.Error()}}
+	}
+	if n.Event != EventTest && !st.Settings.Enabled(n.Event) {
+		return nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		resMu   sync.Mutex
+		results = []DeliveryResult{}
+	)
+	report := func(target string, err error) {
+		res := DeliveryResult{Target: target}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		resMu.Lock()
+		results = append(results, res)
+		resMu.Unlock()
+	}
+
+	for _, t := range st.Settings.Targets {
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			report(t.ID, sendToTarget(ctx, t, n))
+		}(t)
+	}
+
+	if len(st.Subscriptions) > 0 {
+		key, err := vapidKey()
+		if err != nil {
+			report("web-push", err)
+		} else {
+			payload, _ := json.Marshal(n)
+			for _, sub := range st.Subscriptions {
+				wg.Add(1)
+				go func(sub Subscription) {
+					defer wg.Done()
+					err := sendWebPush(ctx, key, st.Settings.Subject, sub, payload, n.Urgent)
+					if err == errSubscriptionGone {
+						log.Infof("removing expired push subscription %s", sub.Endpoint)
+						Unsubscribe(sub.Endpoint)
+					}
+					report(sub.Endpoint, err)
+				}(sub)
+			}
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// sendToTarget posts n to an ntfy topic, as a message with a title, or to
+// a webhook, as JSON.
+func sendToTarget(ctx context.Context, t Target, n Notification) error {
+	var req *http.Request
+	var err error
+	switch t.Type {
+	case TargetNtfy:
+		body := n.Body
+		if body == "" {
+			body = n.Title
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader([]byte(body)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Title", n.Title)
+		req.Header.Set("Tags", n.Event)
+		if n.Urgent {
+			req.Header.Set("Priority", "high")
+		}
+	case TargetWebhook:
+		data, _ := json.Marshal(n)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	default:
+		return fmt.Errorf("unknown target type %q", t.Type)
+	}
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", t.Type, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package notifications
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func useTempState(t *testing.T) {
+	t.Helper()
+	old := stateFile
+	stateFile = jsonfile.New[state](filepath.Join(t.TempDir(), "notifications.json"))
+	t.Cleanup(func() { stateFile = old })
+}
+
+func TestTargetsAndPreferences(t *testing.T) {
+	useTempState(t)
+
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, r.URL.Path+" "+r.Header.Get("Title")+" "+r.Header.Get("Priority")+" "+r.Header.Get("Authorization")+" "+string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	err := SetSettings(Settings{
+		Events: map[string]bool{EventAgentFinished: false},
+		Targets: []Target{
+			{Type: TargetNtfy, URL: srv.URL + "/topic", Token: "tk"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSettings(Settings{Targets: []Target{{Type: "email", URL: srv.URL}}}); err == nil {
+		t.Error("unknown target type accepted")
+	}
+	if err := SetSettings(Settings{Events: map[string]bool{"nope": true}}); err == nil {
+		t.Error("unknown event type accepted")
+	}
+
+	ctx := context.Background()
+	if res := deliver(ctx, Notification{Event: EventAgentFinished, Title: "done"}); len(res) != 0 {
+		t.Errorf("turned off event delivered: %+v", res)
+	}
+	res := deliver(ctx, Notification{Event: EventPushFailed, Title: "Push of main failed", Body: "rejected", Urgent: true})
+	if len(res) != 1 || res[0].Target != "ntfy-1" || res[0].Error != "" {
+		t.Fatalf("results %+v", res)
+	}
+	if want := "/topic Push of main failed high Bearer tk rejected"; len(got) != 1 || got[0] != want {
+		t.Errorf("ntfy got %q, want %q", got, want)
+	}
+}
+
+func TestWebhookTarget(t *testing.T) {
+	useTempState(t)
+
+	var n Notification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&n)
+	}))
+	defer srv.Close()
+
+	err := sendToTarget(context.Background(), Target{Type: TargetWebhook, URL: srv.URL}, Notification{Event: EventReviewDone, Title: "Auto review", Project: "/p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Event != EventReviewDone || n.Title != "Auto review" || n.Project != "/p" {
+		t.Errorf("webhook got %+v", n)
+	}
+}
+
+func TestWebPush(t *testing.T) {
+	useTempState(t)
+
+	// the browser side of a subscription
+	uaKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	var body []byte
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	sub := Subscription{Endpoint: srv.URL + "/push"}
+	sub.Keys.P256dh = b64.EncodeToString(uaKey.PublicKey().Bytes())
+	sub.Keys.Auth = b64.EncodeToString(authSecret)
+	if err := Subscribe(sub); err != nil {
+		t.Fatal(err)
+	}
+	gone := sub
+	gone.Endpoint = srv.URL + "/gone"
+	if err := Subscribe(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	res := deliver(context.Background(), Notification{Event: EventReviewDone, Title: "Review done", URL: "/project"})
+	if len(res) != 2 {
+		t.Fatalf("results %+v", res)
+	}
+	st, _ := stateFile.Get()
+	if len(st.Subscriptions) != 1 || st.Subscriptions[0].Endpoint != sub.Endpoint {
+		t.Errorf("gone subscription kept: %+v", st.Subscriptions)
+	}
+
+	if header.Get("Content-Encoding") != "aes128gcm" || header.Get("TTL") == "" {
+		t.Errorf("headers %v", header)
+	}
+	pub, err := VAPIDPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVAPID(t, header.Get("Authorization"), pub, srv.URL)
+
+	var n Notification
+	if err := json.Unmarshal(decryptPush(t, uaKey, authSecret, body), &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Title != "Review done" || n.URL != "/project" {
+		t.Errorf("decrypted %+v", n)
+	}
+}
+
+// decryptPush decrypts an aes128gcm message the way a browser does.
+func decryptPush(t *testing.T, uaKey *ecdh.PrivateKey, authSecret, body []byte) []byte {
+	t.Helper()
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Fatalf("record size %d", rs)
+	}
+	idLen := int(body[20])
+	asPub, err := ecdh.P256().NewPublicKey(body[21 : 21+idLen])
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := uaKey.ECDH(asPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce, err := contentKeys(shared, authSecret, salt, uaKey.PublicKey().Bytes(), asPub.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plain[len(plain)-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plain[:len(plain)-1]
+}
+
+// checkVAPID verifies the JWT of a VAPID Authorization header.
+func checkVAPID(t *testing.T, authz, pub, endpoint string) {
+	t.Helper()
+	rest, ok := strings.CutPrefix(authz, "vapid t=")
+	if !ok {
+		t.Fatalf("authorization %q", authz)
+	}
+	jwt, k, ok := strings.Cut(rest, ", k=")
+	if !ok || k != pub {
+		t.Fatalf("authorization %q, want key %s", authz, pub)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("jwt %q", jwt)
+	}
+	claims, _ := b64.DecodeString(parts[1])
+	var c struct {
+		Aud string `json:"aud"`
+		Sub string `json:"sub"`
+	}
+	json.Unmarshal(claims, &c)
+	if c.Aud != endpoint || c.Sub != defaultSubject {
+		t.Errorf("claims %s", claims)
+	}
+
+	raw, _ := b64.DecodeString(pub)
+	key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := b64.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		t.Error("VAPID signature does not verify")
+	}
+}
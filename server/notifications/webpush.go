@@ -0,0 +1,249 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSubject identifies the sender when the settings name none.
+	defaultSubject = "https://github.com/xhd2015/ai-critic"
+	// pushTTL is how long a push service keeps a message for an offline
+	// browser.
+	pushTTL = 24 * time.Hour
+	// recordSize is the aes128gcm record size; payloads fit in one record.
+	recordSize = 4096
+)
+
+// errSubscriptionGone is returned for subscriptions the push service no
+// longer knows.
+var errSubscriptionGone = errors.New("subscription expired or unsubscribed")
+
+var b64 = base64.RawURLEncoding
+
+// vapidKey returns the key Web Push requests are signed with, generating
+// and saving it on first use.
+func vapidKey() (*ecdsa.PrivateKey, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	st, err := stateFile.Get()
+	if err != nil {
+		return nil, err
+	}
+	if st.VAPIDKey != "" {
+		raw, err := b64.DecodeString(st.VAPIDKey)
+		if err != nil {
+			return nil, fmt.Errorf("stored VAPID key: %w", err)
+		}
+		return ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := key.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	err = stateFile.Update(func(st *state) error {
+		st.VAPIDKey = b64.EncodeToString(raw)
+		return nil
+	})
+	return key, err
+}
+
+// VAPIDPublicKey returns the public key browsers subscribe with (the
+// applicationServerKey), base64url encoded.
+func VAPIDPublicKey() (string, error) {
+	key, err := vapidKey()
+	if err != nil {
+		return "", err
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(pub), nil
+}
+
+// decodeSubscriptionKeys returns the browser's public key and auth secret.
+func decodeSubscriptionKeys(sub Subscription) (*ecdh.PublicKey, []byte, error) {
+	raw, err := b64.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh: %w", err)
+	}
+	pub, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh: %w", err)
+	}
+	secret, err := b64.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil || len(secret) != 16 {
+		return nil, nil, fmt.Errorf("auth: want 16 base64url encoded bytes")
+	}
+	return pub, secret, nil
+}
+
+// sendWebPush encrypts payload for the subscription (RFC 8291) and posts it
+// to the push service, signed with the VAPID key (RFC 8292).
+func sendWebPush(ctx context.Context, key *ecdsa.PrivateKey, subject string, sub Subscription, payload []byte, urgent bool) error {
+	body, err := encryptPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := vapidAuthorization(key, subject, sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprint(int(pushTTL.Seconds())))
+	req.Header.Set("Authorization", auth)
+	if urgent {
+		req.Header.Set("Urgency", "high")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return errSubscriptionGone
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// encryptPayload encrypts payload into a single aes128gcm record whose key
+// is derived from an ephemeral key agreement with the browser's key.
+func encryptPayload(sub Subscription, payload []byte) ([]byte, error) {
+	uaPub, authSecret, err := decodeSubscriptionKeys(sub)
+	if err != nil {
+		return nil, err
+	}
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaPub)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPub := asKey.PublicKey().Bytes()
+
+	cek, nonce, err := contentKeys(shared, authSecret, salt, uaPub.Bytes(), asPub)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > recordSize {
+		return nil, fmt.Errorf("payload of %d bytes is too large for a push message", len(payload))
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPub))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPub)))
+	header = append(header, asPub...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// contentKeys derives the content encryption key and nonce of a message
+// from the ECDH shared secret (RFC 8291 section 3.4).
+func contentKeys(shared, authSecret, salt, uaPub, asPub []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, shared, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPub) + string(asPub)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// vapidAuthorization returns the Authorization header of a push request to
+// endpoint: a JWT for the push service's origin signed with key, and key's
+// public half.
+func vapidAuthorization(key *ecdsa.PrivateKey, subject, endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if subject == "" {
+		subject = defaultSubject
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	unsigned := b64.EncodeToString(header) + "." + b64.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS wants r and s as two 32-byte big-endian integers
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, b64.EncodeToString(sig), b64.EncodeToString(pub)), nil
+}
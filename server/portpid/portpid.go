@@ -0,0 +1,142 @@
+// Package portpid finds the processes listening on TCP ports without
+// shelling out to lsof, which is missing from minimal containers and
+// whose flags differ across platforms. Linux reads procfs, macOS asks
+// libproc; elsewhere (or when the native lookup fails) lsof is still
+// used as a fallback.
+//
+// Only processes the current user may inspect are found, as with lsof
+// run without root.
+package portpid
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Listener is a process listening on a TCP port.
+type Listener struct {
+	Port    int
+	PID     int
+	Command string // short process name, as in ps -o comm
+}
+
+// errUnsupported is returned by the native lookup on platforms without one.
+var errUnsupported = errors.New("native port lookup not supported on this platform")
+
+// Listeners returns every TCP listener, one per port and process, sorted
+// by port and then PID.
+func Listeners() ([]Listener, error) {
+	ls, err := nativeListeners()
+	if err != nil {
+		var lsofErr error
+		ls, lsofErr = lsofListeners()
+		if lsofErr != nil {
+			if errors.Is(err, errUnsupported) {
+				return nil, lsofErr
+			}
+			return nil, fmt.Errorf("%v; lsof fallback: %v", err, lsofErr)
+		}
+	}
+	return dedupe(ls), nil
+}
+
+// PIDsOnPort returns the processes listening on port.
+func PIDsOnPort(port int) ([]int, error) {
+	ls, err := Listeners()
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, l := range ls {
+		if l.Port == port {
+			pids = append(pids, l.PID)
+		}
+	}
+	return pids, nil
+}
+
+// PortsForPID returns the ports pid is listening on.
+func PortsForPID(pid int) ([]int, error) {
+	ls, err := Listeners()
+	if err != nil {
+		return nil, err
+	}
+	var ports []int
+	for _, l := range ls {
+		if l.PID == pid {
+			ports = append(ports, l.Port)
+		}
+	}
+	return ports, nil
+}
+
+// dedupe sorts listeners and merges sockets of the same process on the
+// same port, e.g. its IPv4 and IPv6 ones.
+func dedupe(ls []Listener) []Listener {
+	sort.Slice(ls, func(i, j int) bool {
+		if ls[i].Port != ls[j].Port {
+			return ls[i].Port < ls[j].Port
+		}
+		return ls[i].PID < ls[j].PID
+	})
+	out := ls[:0]
+	for _, l := range ls {
+		if n := len(out); n > 0 && out[n-1].Port == l.Port && out[n-1].PID == l.PID {
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// lsofListeners runs lsof, which exits non-zero when nothing matches.
+func lsofListeners() ([]Listener, error) {
+	out, err := exec.Command("lsof", "-iTCP", "-sTCP:LISTEN", "-n", "-P", "-F", "pcn").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+			return nil, nil
+		}
+		var execErr *exec.Error
+		if errors.As(err, &execErr) && execErr.Err == exec.ErrNotFound {
+			return nil, fmt.Errorf("lsof not installed: install lsof (macOS: brew install lsof, Linux: apt-get install lsof)")
+		}
+		return nil, fmt.Errorf("failed to run lsof: %w", err)
+	}
+	return parseLsof(string(out)), nil
+}
+
+// parseLsof parses lsof -F pcn output: a p (PID) line starts each
+// process, followed by its c (command) line and an n (name, e.g.
+// "*:8080" or "[::1]:8080") line per socket.
+func parseLsof(out string) []Listener {
+	var ls []Listener
+	var pid int
+	var command string
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" {
+			continue
+		}
+		v := line[1:]
+		switch line[0] {
+		case 'p':
+			pid, _ = strconv.Atoi(v)
+			command = ""
+		case 'c':
+			command = v
+		case 'n':
+			i := strings.LastIndex(v, ":")
+			if i < 0 {
+				continue
+			}
+			if port, err := strconv.Atoi(v[i+1:]); err == nil && port > 0 && pid > 0 {
+				ls = append(ls, Listener{Port: port, PID: pid, Command: command})
+			}
+		}
+	}
+	return ls
+}
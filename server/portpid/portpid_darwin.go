@@ -0,0 +1,85 @@
+//go:build darwin && cgo
+
+package portpid
+
+/*
+#include <arpa/inet.h>
+#include <libproc.h>
+#include <stdlib.h>
+#include <sys/proc_info.h>
+
+// listening_ports stores in ports up to max TCP ports pid listens on and
+// returns how many it stored.
+static int listening_ports(int pid, int *ports, int max) {
+	int size = proc_pidinfo(pid, PROC_PIDLISTFDS, 0, NULL, 0);
+	if (size <= 0) {
+		return 0;
+	}
+	struct proc_fdinfo *fds = malloc(size);
+	if (fds == NULL) {
+		return 0;
+	}
+	size = proc_pidinfo(pid, PROC_PIDLISTFDS, 0, fds, size);
+	int n = 0;
+	for (int i = 0; i < size / (int)PROC_PIDLISTFD_SIZE && n < max; i++) {
+		if (fds[i].proc_fdtype != PROX_FDTYPE_SOCKET) {
+			continue;
+		}
+		struct socket_fdinfo si;
+		if (proc_pidfdinfo(pid, fds[i].proc_fd, PROC_PIDFDSOCKETINFO, &si, PROC_PIDFDSOCKETINFO_SIZE) != PROC_PIDFDSOCKETINFO_SIZE) {
+			continue;
+		}
+		if (si.psi.soi_kind != SOCKINFO_TCP || si.psi.soi_proto.pri_tcp.tcpsi_state != TSI_S_LISTEN) {
+			continue;
+		}
+		ports[n++] = ntohs((unsigned short)si.psi.soi_proto.pri_tcp.tcpsi_ini.insi_lport);
+	}
+	free(fds);
+	return n;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// maxPortsPerProcess bounds the listeners reported for one process.
+const maxPortsPerProcess = 256
+
+// nativeListeners asks libproc for every process's listening sockets.
+func nativeListeners() ([]Listener, error) {
+	n := C.proc_listpids(C.PROC_ALL_PIDS, 0, nil, 0)
+	if n <= 0 {
+		return nil, fmt.Errorf("proc_listpids failed")
+	}
+	// leave room for processes started in between
+	pids := make([]C.int, int(n)/C.sizeof_int+64)
+	n = C.proc_listpids(C.PROC_ALL_PIDS, 0, unsafe.Pointer(&pids[0]), C.int(len(pids)*C.sizeof_int))
+	if n <= 0 {
+		return nil, fmt.Errorf("proc_listpids failed")
+	}
+	pids = pids[:int(n)/C.sizeof_int]
+
+	var ls []Listener
+	ports := make([]C.int, maxPortsPerProcess)
+	name := make([]C.char, 64)
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		count := int(C.listening_ports(pid, &ports[0], C.int(len(ports))))
+		if count == 0 {
+			continue
+		}
+		command := ""
+		if C.proc_name(pid, unsafe.Pointer(&name[0]), C.uint32_t(len(name))) > 0 {
+			command = C.GoString(&name[0])
+		}
+		for _, port := range ports[:count] {
+			ls = append(ls, Listener{Port: int(port), PID: int(pid), Command: command})
+		}
+	}
+	return ls, nil
+}
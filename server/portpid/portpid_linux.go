@@ -0,0 +1,103 @@
+//go:build linux
+
+package portpid
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// nativeListeners reads the listening sockets from /proc/net/tcp{,6} and
+// finds their owners by the socket inodes in /proc/<pid>/fd.
+func nativeListeners() ([]Listener, error) {
+	inodes := make(map[string]int) // socket inode -> port
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if err != nil {
+			if name == "/proc/net/tcp6" && os.IsNotExist(err) {
+				continue // IPv6 disabled
+			}
+			return nil, err
+		}
+		err = parseProcNetTCP(f, inodes)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(inodes) == 0 {
+		return nil, nil
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var ls []Listener
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", p.Name())
+		// unreadable for other users' processes, or the process is gone
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		command := ""
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, ok := strings.CutPrefix(link, "socket:[")
+			if !ok {
+				continue
+			}
+			port, ok := inodes[strings.TrimSuffix(inode, "]")]
+			if !ok {
+				continue
+			}
+			if command == "" {
+				comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+				command = strings.TrimSpace(string(comm))
+			}
+			ls = append(ls, Listener{Port: port, PID: pid, Command: command})
+		}
+	}
+	return ls, nil
+}
+
+// tcpListen is the st column value of a listening socket.
+const tcpListen = "0A"
+
+// parseProcNetTCP adds the listening sockets of a /proc/net/tcp or tcp6
+// table to inodes, keyed by inode. Lines look like
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12345 ...
+func parseProcNetTCP(r io.Reader, inodes map[string]int) error {
+	sc := bufio.NewScanner(r)
+	sc.Scan() // header
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || fields[3] != tcpListen || fields[9] == "0" {
+			continue
+		}
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+		inodes[fields[9]] = int(port)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package portpid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetTCP(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0016 0100007F:9C40 01 00000000:00000000 00:00000000 00000000  1000        0 222 1 0000000000000000 20 4 30 10 -1
+   2: 00000000000000000000000001000000:1435 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 333 1 0000000000000000 100 0 0 10 0
+`
+	inodes := map[string]int{}
+	if err := parseProcNetTCP(strings.NewReader(table), inodes); err != nil {
+		t.Fatal(err)
+	}
+	if len(inodes) != 2 || inodes["111"] != 8080 || inodes["333"] != 5173 {
+		t.Errorf("inodes %v", inodes)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !(darwin && cgo)
+
+package portpid
+
+func nativeListeners() ([]Listener, error) {
+	return nil, errUnsupported
+}
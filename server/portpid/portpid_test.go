@@ -0,0 +1,49 @@
+package portpid
+
+import (
+	"net"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestOwnListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	pids, err := PIDsOnPort(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(pids, []int{os.Getpid()}) {
+		t.Errorf("PIDsOnPort(%d) = %v, want [%d]", port, pids, os.Getpid())
+	}
+	ports, err := PortsForPID(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(ports, port) {
+		t.Errorf("PortsForPID = %v, missing %d", ports, port)
+	}
+}
+
+func TestParseLsof(t *testing.T) {
+	out := "p123\ncnode\nn*:5173\nn[::1]:5173\np456\ncpython3\nn127.0.0.1:8000\n"
+	got := dedupe(parseLsof(out))
+	want := []Listener{{5173, 123, "node"}, {8000, 456, "python3"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	got := dedupe([]Listener{{80, 2, "b"}, {80, 1, "a"}, {22, 3, "c"}, {80, 1, "a"}})
+	want := []Listener{{22, 3, "c"}, {80, 1, "a"}, {80, 2, "b"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 type ProcessRegistry struct {
@@ -76,16 +76,16 @@ func WithLock(name string, fn func() error) error {
 	}
 
 	lockFile := getLockPath(name)
-	fd, err := syscall.Open(lockFile, syscall.O_CREAT|syscall.O_RDWR, 0644)
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open lock file: %w", err)
 	}
-	defer syscall.Close(fd)
+	defer f.Close()
 
-	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+	if err := procctl.Lock(f); err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
-	defer syscall.Flock(fd, syscall.LOCK_UN)
+	defer procctl.Unlock(f)
 
 	return fn()
 }
@@ -142,8 +142,7 @@ func IsProcessAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	err := syscall.Kill(pid, 0)
-	return err == nil
+	return procctl.Alive(pid)
 }
 
 func IsPortReachable(port int, path string) bool {
@@ -165,9 +164,9 @@ func StopProcess(pid int) error {
 		return nil
 	}
 
-	err := syscall.Kill(pid, syscall.SIGTERM)
+	err := procctl.Terminate(pid)
 	if err != nil {
-		err = syscall.Kill(pid, syscall.SIGKILL)
+		err = procctl.Kill(pid)
 		if err != nil {
 			return fmt.Errorf("failed to kill process %d: %w", pid, err)
 		}
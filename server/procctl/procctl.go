@@ -0,0 +1,34 @@
+// Package procctl is the process management the server and its tools share
+// across platforms: starting a child in its own process group, signaling
+// a process or its whole group, checking liveness and locking files.
+//
+// On Unix these are the usual signals, process groups and flock. On
+// Windows a "group" is a process tree: a child started with NewGroup gets
+// a new process group, Terminate and Kill go through taskkill (with /T for
+// the tree), and file locks use LockFileEx. Windows has no SIGTERM: a
+// graceful Terminate asks the process to close, which console programs
+// that do not handle it ignore, so callers escalate to Kill as they do on
+// Unix.
+package procctl
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// GroupAttr returns the attributes that start a child in a process group
+// of its own, so the group can be signaled without reaching the server.
+func GroupAttr() *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{}
+	setGroup(attr)
+	return attr
+}
+
+// NewGroup makes cmd start in a process group of its own, keeping its
+// other attributes.
+func NewGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	setGroup(cmd.SysProcAttr)
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package procctl
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func setGroup(attr *syscall.SysProcAttr) {
+	attr.Setpgid = true
+	attr.Pgid = 0
+}
+
+// SetOwnGroup moves the current process into a process group of its own.
+func SetOwnGroup() error {
+	return syscall.Setpgid(0, 0)
+}
+
+// GroupOf returns the process group of pid.
+func GroupOf(pid int) (int, error) {
+	return syscall.Getpgid(pid)
+}
+
+// Terminate asks pid to exit (SIGTERM).
+func Terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// Kill kills pid (SIGKILL).
+func Kill(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// TerminateGroup sends SIGTERM to the process group pgid.
+func TerminateGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGTERM)
+}
+
+// KillGroup sends SIGKILL to the process group pgid.
+func KillGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+// Resume continues a stopped process (SIGCONT).
+func Resume(pid int) error {
+	return syscall.Kill(pid, syscall.SIGCONT)
+}
+
+// Alive reports whether pid exists. A zombie counts as alive until reaped.
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Lock takes an exclusive lock on f, waiting for other holders.
+func Lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,65 @@
+//go:build unix
+
+package procctl
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGroupLifecycle(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	NewGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	pgid, err := GroupOf(pid)
+	if err != nil || pgid != pid {
+		t.Fatalf("GroupOf(%d) = %d, %v", pid, pgid, err)
+	}
+	if !Alive(pid) {
+		t.Fatal("started process not alive")
+	}
+	if err := KillGroup(pgid); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	if Alive(pid) {
+		t.Error("process alive after KillGroup and Wait")
+	}
+	if Alive(0) || Alive(-1) {
+		t.Error("non-positive PIDs reported alive")
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	a, _ := os.Create(path)
+	defer a.Close()
+	b, _ := os.Open(path)
+	defer b.Close()
+	if err := Lock(a); err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		Lock(b)
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("second lock taken while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	Unlock(a)
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second lock not taken after unlock")
+	}
+	Unlock(b)
+}
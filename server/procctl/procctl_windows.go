@@ -0,0 +1,95 @@
+//go:build windows
+
+package procctl
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+func setGroup(attr *syscall.SysProcAttr) {
+	attr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+}
+
+// SetOwnGroup is a no-op: a Windows process cannot change its group, and
+// its tree is addressed through its own PID anyway.
+func SetOwnGroup() error {
+	return nil
+}
+
+// GroupOf returns pid: the group operations address the process tree
+// rooted at it.
+func GroupOf(pid int) (int, error) {
+	if !Alive(pid) {
+		return 0, os.ErrProcessDone
+	}
+	return pid, nil
+}
+
+// Terminate asks pid to close.
+func Terminate(pid int) error {
+	return taskkill(pid)
+}
+
+// Kill forcibly ends pid.
+func Kill(pid int) error {
+	return taskkill(pid, "/F")
+}
+
+// TerminateGroup asks the process tree rooted at pgid to close.
+func TerminateGroup(pgid int) error {
+	return taskkill(pgid, "/T")
+}
+
+// KillGroup forcibly ends the process tree rooted at pgid.
+func KillGroup(pgid int) error {
+	return taskkill(pgid, "/T", "/F")
+}
+
+// Resume is a no-op: Windows processes are not stopped by job control.
+func Resume(pid int) error {
+	return nil
+}
+
+func taskkill(pid int, flags ...string) error {
+	args := append([]string{"/PID", strconv.Itoa(pid)}, flags...)
+	return exec.Command("taskkill", args...).Run()
+}
+
+// stillActive is the exit code GetExitCodeProcess reports for a running
+// process.
+const stillActive = 259
+
+// Alive reports whether pid is running.
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// access denied means it exists
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// Lock takes an exclusive lock on f, waiting for other holders.
+func Lock(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, ^uint32(0), ^uint32(0), ol)
+}
+
+// Unlock releases a lock taken with Lock.
+func Unlock(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, ^uint32(0), ^uint32(0), ol)
+}
@@ -0,0 +1,193 @@
+package projects
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// A request names the project it works on by ID with the X-Project-ID header
+// or the project_id query parameter; without either, the active project of
+// its browser session applies. Middleware resolves it once, and handlers
+// taking a dir fall back to it with Dir.
+const (
+	ProjectHeader = "X-Project-ID"
+	sessionCookie = "ai-critic-project-session"
+)
+
+var ErrNotFound = errors.New("project not found")
+
+// Get returns the project with the given ID.
+func (reg *Registry) Get(id string) (*Project, error) {
+	list, err := reg.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].ID == id {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// activeProjects maps tenant and session to the active project ID. It is
+// kept in memory: a restarted server starts with no active projects.
+var activeProjects = struct {
+	sync.Mutex
+	ids map[string]string
+}{ids: make(map[string]string)}
+
+func sessionKey(r *http.Request) string {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return ""
+	}
+	return tenant.Name(r.Context()) + "/" + c.Value
+}
+
+// Active returns the active project of the request's session, or nil.
+func Active(r *http.Request) *Project {
+	key := sessionKey(r)
+	if key == "" {
+		return nil
+	}
+	activeProjects.Lock()
+	id := activeProjects.ids[key]
+	activeProjects.Unlock()
+	if id == "" {
+		return nil
+	}
+	p, err := ForContext(r.Context()).Get(id)
+	if err != nil {
+		return nil // removed since
+	}
+	return p
+}
+
+// setActive makes id the active project of the request's session, starting
+// a session if needed; empty id clears it.
+func setActive(w http.ResponseWriter, r *http.Request, id string) {
+	key := sessionKey(r)
+	if key == "" {
+		if id == "" {
+			return
+		}
+		b := make([]byte, 16)
+		rand.Read(b)
+		value := hex.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    value,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		key = tenant.Name(r.Context()) + "/" + value
+	}
+	activeProjects.Lock()
+	defer activeProjects.Unlock()
+	if id == "" {
+		delete(activeProjects.ids, key)
+		return
+	}
+	activeProjects.ids[key] = id
+}
+
+type projectKey struct{}
+
+// FromContext returns the project of the request, set by Middleware, or nil.
+func FromContext(ctx context.Context) *Project {
+	p, _ := ctx.Value(projectKey{}).(*Project)
+	return p
+}
+
+// Dir returns dir, or the directory of the request's project when dir is
+// empty; empty if there is neither.
+func Dir(ctx context.Context, dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if p := FromContext(ctx); p != nil {
+		return p.Dir
+	}
+	return ""
+}
+
+// Middleware attaches the request's project to its context. A named project
+// that does not exist fails the request with 404. /api/projects is left
+// alone: its project_id parameters select what to manage.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/api/projects") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := r.Header.Get(ProjectHeader)
+		if id == "" {
+			id = r.URL.Query().Get("project_id")
+		}
+		var p *Project
+		if id != "" {
+			var err error
+			p, err = ForContext(r.Context()).Get(id)
+			if errors.Is(err, ErrNotFound) {
+				respondErr(w, http.StatusNotFound, "project not found: "+id)
+				return
+			}
+			if err != nil {
+				respondErr(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		} else {
+			p = Active(r)
+		}
+		if p != nil {
+			r = r.WithContext(context.WithValue(r.Context(), projectKey{}, p))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleActive gets, sets and clears the session's active project.
+//
+//	GET    /api/projects/active       -> {project: Project|null}
+//	PUT    /api/projects/active {id}  -> {project: Project}
+//	DELETE /api/projects/active
+func handleActive(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, map[string]*Project{"project": Active(r)})
+	case http.MethodPut:
+		var req struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+			respondErr(w, http.StatusBadRequest, "id is required")
+			return
+		}
+		p, err := ForContext(r.Context()).Get(req.ID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			respondErr(w, status, err.Error())
+			return
+		}
+		setActive(w, r, p.ID)
+		respondJSON(w, http.StatusOK, map[string]*Project{"project": p})
+	case http.MethodDelete:
+		setActive(w, r, "")
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
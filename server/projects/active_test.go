@@ -0,0 +1,93 @@
+package projects
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func TestMiddleware(t *testing.T) {
+	dataDir, file := config.DataDir, projectsFile
+	t.Cleanup(func() { config.DataDir, projectsFile = dataDir, file })
+	config.DataDir = t.TempDir()
+	projectsFile = filepath.Join(config.DataDir, "projects.json")
+
+	app, _ := Add(Project{ID: "1", Name: "app", Dir: "/src/app"})
+	lib, _ := Add(Project{ID: "2", Name: "lib", Dir: "/src/lib"})
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	mux.HandleFunc("/api/review/diff", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Dir(r.Context(), r.URL.Query().Get("dir"))))
+	})
+	handler := Middleware(mux)
+	var cookies []*http.Cookie
+	do := func(method, url, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if len(header) > 0 {
+			req.Header.Set(ProjectHeader, header[0])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if got := do(http.MethodGet, "/api/review/diff", "").Body.String(); got != "" {
+		t.Errorf("no project: %q", got)
+	}
+	if got := do(http.MethodGet, "/api/review/diff", "", app).Body.String(); got != "/src/app" {
+		t.Errorf("header: %q", got)
+	}
+	if got := do(http.MethodGet, "/api/review/diff?project_id="+lib, "").Body.String(); got != "/src/lib" {
+		t.Errorf("query: %q", got)
+	}
+	if got := do(http.MethodGet, "/api/review/diff?dir=/elsewhere", "", app).Body.String(); got != "/elsewhere" {
+		t.Errorf("explicit dir: %q", got)
+	}
+	if rec := do(http.MethodGet, "/api/review/diff", "", "9"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown project: %d %s", rec.Code, rec.Body)
+	}
+
+	// the active project applies to the session it was set in
+	if rec := do(http.MethodPut, "/api/projects/active", `{"id":"9"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("activate unknown: %d", rec.Code)
+	}
+	rec := do(http.MethodPut, "/api/projects/active", `{"id":"`+lib+`"}`)
+	cookies = rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("activate: %d %s %v", rec.Code, rec.Body, cookies)
+	}
+	if got := do(http.MethodGet, "/api/review/diff", "").Body.String(); got != "/src/lib" {
+		t.Errorf("active: %q", got)
+	}
+	if got := do(http.MethodGet, "/api/review/diff", "", app).Body.String(); got != "/src/app" {
+		t.Errorf("header over active: %q", got)
+	}
+	if rec := do(http.MethodGet, "/api/projects/active", ""); !strings.Contains(rec.Body.String(), `"name":"lib"`) {
+		t.Errorf("get active: %s", rec.Body)
+	}
+	saved := cookies
+	cookies = nil
+	if got := do(http.MethodGet, "/api/review/diff", "").Body.String(); got != "" {
+		t.Errorf("other session: %q", got)
+	}
+	cookies = saved
+
+	// removing the project deactivates it
+	Remove(lib)
+	if got := do(http.MethodGet, "/api/review/diff", "").Body.String(); got != "" {
+		t.Errorf("removed project: %q", got)
+	}
+	do(http.MethodPut, "/api/projects/active", `{"id":"`+app+`"}`)
+	do(http.MethodDelete, "/api/projects/active", "")
+	if rec := do(http.MethodGet, "/api/projects/active", ""); strings.TrimSpace(rec.Body.String()) != `{"project":null}` {
+		t.Errorf("after clear: %s", rec.Body)
+	}
+}
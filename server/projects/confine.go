@@ -0,0 +1,70 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// ErrOutsideWorkspace is returned when a member's project would be outside
+// their workspace.
+var ErrOutsideWorkspace = errors.New("directory is outside your workspace")
+
+// Workspace returns the workspace of the named tenant: the directory its
+// projects are cloned into, which a member's projects must be in.
+func Workspace(name string) string {
+	return tenant.PathOf(name, config.WorkspacesDir)
+}
+
+// Allowed reports whether a request may work in dir. Members are confined to
+// the directories of their registered projects, and what is inside them,
+// within their workspace; everyone else may use any directory. Handlers
+// check the directory they resolved, since only they know which of a
+// request's fields name one.
+func Allowed(ctx context.Context, dir string) (bool, error) {
+	name := tenant.Name(ctx)
+	if name == "" {
+		return true, nil
+	}
+	target := realPath(dir)
+	if !within(target, realPath(Workspace(name))) {
+		return false, nil
+	}
+	list, err := ForTenant(name).List()
+	if err != nil {
+		return false, err
+	}
+	for _, p := range list {
+		if p.Dir != "" && within(target, realPath(p.Dir)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// realPath returns the absolute, symlink-free form of path. Of a path that
+// does not exist yet, the existing part is resolved: a file to be created
+// through a symlink lands where the symlink points.
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	parent := filepath.Dir(abs)
+	if parent == abs {
+		return abs
+	}
+	return filepath.Join(realPath(parent), filepath.Base(abs))
+}
+
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
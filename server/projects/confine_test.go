@@ -0,0 +1,76 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+func TestAllowedConfinesMembers(t *testing.T) {
+	dataDir, workspaces, file := config.DataDir, config.WorkspacesDir, projectsFile
+	t.Cleanup(func() { config.DataDir, config.WorkspacesDir, projectsFile = dataDir, workspaces, file })
+	config.DataDir = t.TempDir()
+	config.WorkspacesDir = filepath.Join(config.DataDir, "workspaces")
+	projectsFile = filepath.Join(config.DataDir, "projects.json")
+
+	member := auth.WithIdentity(context.Background(), &auth.Identity{User: "carol", Role: auth.RoleMember})
+	admin := auth.WithIdentity(context.Background(), &auth.Identity{User: "bob", Role: auth.RoleAdmin})
+
+	app := filepath.Join(Workspace("carol"), "app")
+	other := filepath.Join(Workspace("carol"), "other")
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(app, "sub"), 0755)
+	os.MkdirAll(other, 0755)
+	os.Symlink(outside, filepath.Join(app, "escape"))
+	if _, err := ForContext(member).Add(Project{Name: "app", Dir: app}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		dir  string
+		want bool
+	}{
+		{"project dir", member, app, true},
+		{"inside project", member, filepath.Join(app, "sub"), true},
+		{"new file", member, filepath.Join(app, "sub", "new.go"), true},
+		{"outside", member, outside, false},
+		{"unregistered in workspace", member, other, false},
+		{"dot dot", member, app + "/..", false},
+		{"symlink out", member, filepath.Join(app, "escape"), false},
+		{"new file through symlink", member, filepath.Join(app, "escape", "new.go"), false},
+		{"admin anywhere", admin, outside, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allowed(tt.ctx, tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Allowed(%s) = %v, want %v", tt.dir, got, tt.want)
+			}
+		})
+	}
+
+	// a member's projects stay in their workspace
+	if _, err := ForContext(member).Add(Project{Name: "root", Dir: "/"}); !errors.Is(err, ErrOutsideWorkspace) {
+		t.Errorf("member added /: %v", err)
+	}
+	if _, err := ForContext(member).Add(Project{Name: "escape", Dir: filepath.Join(app, "escape")}); !errors.Is(err, ErrOutsideWorkspace) {
+		t.Errorf("member added a symlink out of the workspace: %v", err)
+	}
+	if _, err := ForContext(admin).Add(Project{Name: "outside", Dir: outside}); err != nil {
+		t.Errorf("admin added a project outside the workspace: %v", err)
+	}
+	if got, want := Workspace("carol"), filepath.Join(tenant.DirOf("carol"), "workspaces"); got != want {
+		t.Errorf("Workspace = %s, want %s", got, want)
+	}
+}
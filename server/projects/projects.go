@@ -1,7 +1,9 @@
 package projects
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,11 +15,43 @@ import (
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/tenant"
 	"github.com/xhd2015/gitops/git"
 )
 
 var projectsFile = config.ProjectsFile
 
+// Registry is a project list persisted in one JSON file. The package-level
+// functions use the global registry; request handlers use the registry of
+// the request's tenant so members of a shared instance each see their own
+// projects.
+type Registry struct {
+	file string
+	// root, if set, is the directory the projects must be in: the
+	// workspace of a member (see Workspace).
+	root string
+}
+
+// Global returns the instance-wide registry.
+func Global() *Registry {
+	return &Registry{file: projectsFile}
+}
+
+// ForContext returns the registry of the request's tenant (see package
+// tenant); the global registry for admins and unauthenticated requests.
+func ForContext(ctx context.Context) *Registry {
+	return ForTenant(tenant.Name(ctx))
+}
+
+// ForTenant returns the registry of the named tenant.
+func ForTenant(name string) *Registry {
+	reg := &Registry{file: tenant.PathOf(name, projectsFile)}
+	if name != "" {
+		reg.root = Workspace(name)
+	}
+	return reg
+}
+
 type Todo struct {
 	ID        string `json:"id"`
 	Text      string `json:"text"`
@@ -32,6 +66,13 @@ type WorktreeIDMap struct {
 	NextID   int            `json:"nextId,omitempty"`
 }
 
+// Values of Project.AgentChanges.
+const (
+	AgentChangesOff       = ""
+	AgentChangesChangeset = "changeset"
+	AgentChangesStage     = "stage"
+)
+
 type Project struct {
 	ID              string `json:"id"`
 	Name            string `json:"name"`
@@ -46,6 +87,12 @@ type Project struct {
 	ParentID        string `json:"parent_id,omitempty"`
 	Todos           []Todo `json:"todos,omitempty"`
 	Readme          string `json:"readme,omitempty"`
+	// AgentChanges controls what happens to files an agent session modifies:
+	// track them as a pending changeset, or also stage them.
+	AgentChanges string `json:"agent_changes,omitempty"`
+	// ArtifactPaths are the output paths (globs, relative to Dir or
+	// absolute) collected as artifacts after each agent run.
+	ArtifactPaths []string `json:"artifact_paths,omitempty"`
 
 	Worktrees *WorktreeIDMap `json:"worktrees,omitempty"`
 }
@@ -87,12 +134,12 @@ func gitStatusDirty(status GitStatusInfo) bool {
 
 var mu sync.RWMutex
 
-func ensureDir() error {
-	return os.MkdirAll(filepath.Dir(projectsFile), 0755)
+func (reg *Registry) ensureDir() error {
+	return os.MkdirAll(filepath.Dir(reg.file), 0755)
 }
 
-func loadAll() ([]Project, error) {
-	data, err := os.ReadFile(projectsFile)
+func (reg *Registry) loadAll() ([]Project, error) {
+	data, err := os.ReadFile(reg.file)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []Project{}, nil
@@ -106,21 +153,29 @@ func loadAll() ([]Project, error) {
 	return list, nil
 }
 
-func saveAll(list []Project) error {
-	if err := ensureDir(); err != nil {
+func (reg *Registry) saveAll(list []Project) error {
+	if err := reg.ensureDir(); err != nil {
 		return err
 	}
 	data, err := json.MarshalIndent(list, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(projectsFile, data, 0644)
+	return os.WriteFile(reg.file, data, 0644)
 }
 
+// Add registers p in the global registry; see Registry.Add.
 func Add(p Project) (string, error) {
+	return Global().Add(p)
+}
+
+func (reg *Registry) Add(p Project) (string, error) {
+	if reg.root != "" && !within(realPath(p.Dir), realPath(reg.root)) {
+		return "", ErrOutsideWorkspace
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	list, err := loadAll()
+	list, err := reg.loadAll()
 	if err != nil {
 		return "", err
 	}
@@ -136,22 +191,52 @@ func Add(p Project) (string, error) {
 		p.CreatedAt = time.Now().UTC().Format(time.RFC3339)
 	}
 	list = append(list, p)
-	if err := saveAll(list); err != nil {
+	if err := reg.saveAll(list); err != nil {
 		return "", err
 	}
 	return p.ID, nil
 }
 
+// List returns the projects of the global registry.
 func List() ([]Project, error) {
+	return Global().List()
+}
+
+func (reg *Registry) List() ([]Project, error) {
 	mu.RLock()
 	defer mu.RUnlock()
-	return loadAll()
+	return reg.loadAll()
+}
+
+// FindByDir looks dir up in the global registry.
+func FindByDir(dir string) (*Project, error) {
+	return Global().FindByDir(dir)
 }
 
+// FindByDir returns the project registered for dir, or nil if there is none.
+func (reg *Registry) FindByDir(dir string) (*Project, error) {
+	list, err := reg.List()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Clean(dir)
+	for i := range list {
+		if filepath.Clean(list[i].Dir) == dir {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Remove deletes a project from the global registry.
 func Remove(id string) error {
+	return Global().Remove(id)
+}
+
+func (reg *Registry) Remove(id string) error {
 	mu.Lock()
 	defer mu.Unlock()
-	list, err := loadAll()
+	list, err := reg.loadAll()
 	if err != nil {
 		return err
 	}
@@ -170,7 +255,7 @@ func Remove(id string) error {
 	if !found {
 		return fmt.Errorf("project not found: %s", id)
 	}
-	return saveAll(filtered)
+	return reg.saveAll(filtered)
 }
 
 // ProjectUpdate contains the fields that can be updated.
@@ -183,12 +268,27 @@ type ProjectUpdate struct {
 	GitUserEmail    *string `json:"git_user_email"`
 	ParentID        *string `json:"parent_id"`
 	Readme          *string `json:"readme"`
+	AgentChanges    *string `json:"agent_changes"`
+	// ArtifactPaths replaces the whole list when non-nil.
+	ArtifactPaths *[]string `json:"artifact_paths"`
 }
 
+// Update changes a project of the global registry.
 func Update(id string, updates ProjectUpdate) (*Project, error) {
+	return Global().Update(id, updates)
+}
+
+func (reg *Registry) Update(id string, updates ProjectUpdate) (*Project, error) {
+	if updates.AgentChanges != nil {
+		switch *updates.AgentChanges {
+		case AgentChangesOff, AgentChangesChangeset, AgentChangesStage:
+		default:
+			return nil, fmt.Errorf("invalid agent_changes: %q", *updates.AgentChanges)
+		}
+	}
 	mu.Lock()
 	defer mu.Unlock()
-	list, err := loadAll()
+	list, err := reg.loadAll()
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +317,13 @@ func Update(id string, updates ProjectUpdate) (*Project, error) {
 		if updates.Readme != nil {
 			list[i].Readme = *updates.Readme
 		}
-		if err := saveAll(list); err != nil {
+		if updates.AgentChanges != nil {
+			list[i].AgentChanges = *updates.AgentChanges
+		}
+		if updates.ArtifactPaths != nil {
+			list[i].ArtifactPaths = *updates.ArtifactPaths
+		}
+		if err := reg.saveAll(list); err != nil {
 			return nil, err
 		}
 		return &list[i], nil
@@ -230,6 +336,7 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/projects/resolve-dir", handleResolveDir)
 	mux.HandleFunc("/api/projects/todos", handleTodos)
 	mux.HandleFunc("/api/projects/readme", handleReadme)
+	mux.HandleFunc("/api/projects/active", handleActive)
 }
 
 func handleResolveDir(w http.ResponseWriter, r *http.Request) {
@@ -243,7 +350,7 @@ func handleResolveDir(w http.ResponseWriter, r *http.Request) {
 		respondErr(w, http.StatusBadRequest, "project is required")
 		return
 	}
-	dir, err := ResolveProjectDir(projectName, worktreeID)
+	dir, err := ForContext(r.Context()).ResolveProjectDir(projectName, worktreeID)
 	if err != nil {
 		respondErr(w, http.StatusNotFound, err.Error())
 		return
@@ -252,6 +359,7 @@ func handleResolveDir(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleReadme(w http.ResponseWriter, r *http.Request) {
+	reg := ForContext(r.Context())
 	projectID := r.URL.Query().Get("project_id")
 	if projectID == "" {
 		respondErr(w, http.StatusBadRequest, "project_id is required")
@@ -262,7 +370,7 @@ func handleReadme(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		mu.RLock()
 		defer mu.RUnlock()
-		list, err := loadAll()
+		list, err := reg.loadAll()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -286,7 +394,7 @@ func handleReadme(w http.ResponseWriter, r *http.Request) {
 
 		mu.Lock()
 		defer mu.Unlock()
-		list, err := loadAll()
+		list, err := reg.loadAll()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -306,7 +414,7 @@ func handleReadme(w http.ResponseWriter, r *http.Request) {
 		}
 
 		list[projectIndex].Readme = req.Readme
-		if err := saveAll(list); err != nil {
+		if err := reg.saveAll(list); err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -319,9 +427,10 @@ func handleReadme(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleProjects(w http.ResponseWriter, r *http.Request) {
+	reg := ForContext(r.Context())
 	switch r.Method {
 	case http.MethodGet:
-		list, err := List()
+		list, err := reg.List()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -403,7 +512,11 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			Dir:      absDir,
 			ParentID: req.ParentID,
 		}
-		projectID, err := Add(p)
+		projectID, err := reg.Add(p)
+		if errors.Is(err, ErrOutsideWorkspace) {
+			respondErr(w, http.StatusForbidden, err.Error())
+			return
+		}
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -415,7 +528,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			respondErr(w, http.StatusBadRequest, "id is required")
 			return
 		}
-		if err := Remove(id); err != nil {
+		if err := reg.Remove(id); err != nil {
 			respondErr(w, http.StatusNotFound, err.Error())
 			return
 		}
@@ -431,7 +544,7 @@ func handleProjects(w http.ResponseWriter, r *http.Request) {
 			respondErr(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
-		project, err := Update(id, updates)
+		project, err := reg.Update(id, updates)
 		if err != nil {
 			respondErr(w, http.StatusNotFound, err.Error())
 			return
@@ -453,6 +566,7 @@ func respondErr(w http.ResponseWriter, status int, msg string) {
 }
 
 func handleTodos(w http.ResponseWriter, r *http.Request) {
+	reg := ForContext(r.Context())
 	projectID := r.URL.Query().Get("project_id")
 	if projectID == "" {
 		respondErr(w, http.StatusBadRequest, "project_id is required")
@@ -461,7 +575,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		list, err := List()
+		list, err := reg.List()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -489,7 +603,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 
 		mu.Lock()
 		defer mu.Unlock()
-		list, err := loadAll()
+		list, err := reg.loadAll()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -516,7 +630,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 		}
 
 		list[projectIndex].Todos = append(list[projectIndex].Todos, todo)
-		if err := saveAll(list); err != nil {
+		if err := reg.saveAll(list); err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -539,7 +653,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 
 		mu.Lock()
 		defer mu.Unlock()
-		list, err := loadAll()
+		list, err := reg.loadAll()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -577,7 +691,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 			list[projectIndex].Todos[todoIndex].Done = *req.Done
 		}
 
-		if err := saveAll(list); err != nil {
+		if err := reg.saveAll(list); err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -592,7 +706,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 
 		mu.Lock()
 		defer mu.Unlock()
-		list, err := loadAll()
+		list, err := reg.loadAll()
 		if err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -624,7 +738,7 @@ func handleTodos(w http.ResponseWriter, r *http.Request) {
 		}
 
 		list[projectIndex].Todos = filteredTodos
-		if err := saveAll(list); err != nil {
+		if err := reg.saveAll(list); err != nil {
 			respondErr(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -644,11 +758,17 @@ type WorktreeInfo struct {
 	WorktreeID int    `json:"worktreeId"`
 }
 
+// ResolveProjectDir resolves a project directory in the global registry;
+// see Registry.ResolveProjectDir.
+func ResolveProjectDir(projectName, worktreeID string) (string, error) {
+	return Global().ResolveProjectDir(projectName, worktreeID)
+}
+
 // ResolveProjectDir resolves the actual project directory based on project name and optional worktree ID.
 // It looks up the project in the project list and returns its directory.
 // If worktreeID is provided, it resolves the correct worktree directory.
-func ResolveProjectDir(projectName, worktreeID string) (string, error) {
-	projects, err := List()
+func (reg *Registry) ResolveProjectDir(projectName, worktreeID string) (string, error) {
+	projects, err := reg.List()
 	if err != nil {
 		return "", fmt.Errorf("failed to list projects: %w", err)
 	}
@@ -678,7 +798,7 @@ func ResolveProjectDir(projectName, worktreeID string) (string, error) {
 	}
 
 	// Get worktrees for the project
-	worktrees, err := GetWorktreesForProject(projectDir)
+	worktrees, err := reg.GetWorktrees(projectDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to get worktrees: %w", err)
 	}
@@ -696,6 +816,11 @@ func ResolveProjectDir(projectName, worktreeID string) (string, error) {
 // GetWorktreesForProject returns all worktrees for a given git repository
 // with persistent IDs that remain stable across restarts.
 func GetWorktreesForProject(repoDir string) ([]WorktreeInfo, error) {
+	return Global().GetWorktrees(repoDir)
+}
+
+// GetWorktrees is GetWorktreesForProject with IDs kept in this registry.
+func (reg *Registry) GetWorktrees(repoDir string) ([]WorktreeInfo, error) {
 	cmd := exec.Command("git", "worktree", "list", "--porcelain")
 	cmd.Dir = repoDir
 	output, err := cmd.CombinedOutput()
@@ -704,7 +829,7 @@ func GetWorktreesForProject(repoDir string) ([]WorktreeInfo, error) {
 	}
 
 	worktrees := parseWorktreesOutput(string(output))
-	AssignWorktreeIDs(repoDir, worktrees)
+	reg.AssignWorktreeIDs(repoDir, worktrees)
 	return worktrees, nil
 }
 
@@ -743,10 +868,15 @@ func parseWorktreesOutput(output string) []WorktreeInfo {
 	return worktrees
 }
 
+// AssignWorktreeIDs assigns persistent IDs using the global registry.
+func AssignWorktreeIDs(repoDir string, worktrees []WorktreeInfo) {
+	Global().AssignWorktreeIDs(repoDir, worktrees)
+}
+
 // AssignWorktreeIDs assigns persistent IDs to worktrees by storing
 // the mapping in the project's config. Main worktree (first entry)
 // always gets ID 0. Other worktrees get stable IDs.
-func AssignWorktreeIDs(repoDir string, worktrees []WorktreeInfo) {
+func (reg *Registry) AssignWorktreeIDs(repoDir string, worktrees []WorktreeInfo) {
 	if len(worktrees) == 0 {
 		return
 	}
@@ -754,7 +884,7 @@ func AssignWorktreeIDs(repoDir string, worktrees []WorktreeInfo) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	projects, err := loadAll()
+	projects, err := reg.loadAll()
 	if err != nil {
 		for i := range worktrees {
 			worktrees[i].WorktreeID = i
@@ -825,6 +955,6 @@ func AssignWorktreeIDs(repoDir string, worktrees []WorktreeInfo) {
 	}
 
 	if changed {
-		_ = saveAll(projects)
+		_ = reg.saveAll(projects)
 	}
 }
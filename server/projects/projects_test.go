@@ -1,6 +1,13 @@
 package projects
 
-import "testing"
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
 
 func TestGitStatusDirty(t *testing.T) {
 	cases := []struct {
@@ -17,4 +24,47 @@ func TestGitStatusDirty(t *testing.T) {
 			t.Fatalf("gitStatusDirty(%+v) = %v, want %v", tc.status, got, tc.want)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestRegistryIsolatesTenants(t *testing.T) {
+	dataDir, workspaces, file := config.DataDir, config.WorkspacesDir, projectsFile
+	t.Cleanup(func() { config.DataDir, config.WorkspacesDir, projectsFile = dataDir, workspaces, file })
+	config.DataDir = t.TempDir()
+	config.WorkspacesDir = filepath.Join(config.DataDir, "workspaces")
+	projectsFile = filepath.Join(config.DataDir, "projects.json")
+
+	member := func(name string) context.Context {
+		return auth.WithIdentity(context.Background(), &auth.Identity{User: name, Role: auth.RoleMember})
+	}
+	admin := auth.WithIdentity(context.Background(), &auth.Identity{User: "bob", Role: auth.RoleAdmin})
+
+	if _, err := ForContext(member("carol")).Add(Project{Name: "carol-app", Dir: filepath.Join(Workspace("carol"), "carol-app")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ForContext(admin).Add(Project{Name: "shared", Dir: "/src/shared"}); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(ctx context.Context) []string {
+		list, err := ForContext(ctx).List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, p := range list {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+	if got := names(member("carol")); len(got) != 1 || got[0] != "carol-app" {
+		t.Errorf("carol sees %v, want [carol-app]", got)
+	}
+	if got := names(member("dave")); len(got) != 0 {
+		t.Errorf("dave sees %v, want none", got)
+	}
+	if got := names(admin); len(got) != 1 || got[0] != "shared" {
+		t.Errorf("admin sees %v, want [shared]", got)
+	}
+	if _, err := ForContext(member("dave")).ResolveProjectDir("carol-app", ""); err == nil {
+		t.Errorf("dave resolved carol's project")
+	}
+}
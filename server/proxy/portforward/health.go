@@ -0,0 +1,77 @@
+package portforward
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Health check statuses, as used by /api/ports/diagnostics.
+const (
+	HealthOK      = "ok"
+	HealthWarning = "warning"
+	HealthError   = "error"
+)
+
+// HealthCheck is one step of a provider's setup check.
+type HealthCheck struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	Status      string `json:"status"` // HealthOK, HealthWarning or HealthError
+	Description string `json:"description"`
+}
+
+// HealthChecker is implemented by providers that can verify their own setup
+// (binary installed, logged in, account capabilities) before a tunnel is
+// started.
+type HealthChecker interface {
+	HealthCheck() []HealthCheck
+}
+
+// OverallHealth is the worst status among checks.
+func OverallHealth(checks []HealthCheck) string {
+	overall := HealthOK
+	for _, c := range checks {
+		switch c.Status {
+		case HealthError:
+			return HealthError
+		case HealthWarning:
+			overall = HealthWarning
+		}
+	}
+	return overall
+}
+
+// ProviderHealth runs the health check of the named provider. ok is false
+// when the provider is unknown or does not implement HealthChecker.
+func (m *Manager) ProviderHealth(name string) (checks []HealthCheck, ok bool) {
+	m.mu.Lock()
+	p, exists := m.providers[name]
+	m.mu.Unlock()
+	if !exists {
+		return nil, false
+	}
+	hc, isChecker := p.(HealthChecker)
+	if !isChecker {
+		return nil, false
+	}
+	return hc.HealthCheck(), true
+}
+
+func handleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("provider")
+	checks, ok := defaultManager.ProviderHealth(name)
+	if !ok {
+		http.Error(w, "provider not found or has no health check: "+name, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"provider": name,
+		"overall":  OverallHealth(checks),
+		"checks":   checks,
+	})
+}
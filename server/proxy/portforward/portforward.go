@@ -11,7 +11,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/ai-critic/server/cloudflare"
@@ -19,7 +18,10 @@ import (
 	"github.com/xhd2015/ai-critic/server/cmdjson"
 	"github.com/xhd2015/ai-critic/server/config"
 	"github.com/xhd2015/ai-critic/server/domains"
+	"github.com/xhd2015/ai-critic/server/events"
 	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 	"github.com/xhd2015/ai-critic/server/quicktest"
 )
 
@@ -73,6 +75,8 @@ const (
 	ProviderCloudflareQuick  = "cloudflare_quick"
 	ProviderCloudflareTunnel = "cloudflare_tunnel"
 	ProviderCloudflareOwned  = "cloudflare_owned"
+	ProviderNgrok            = "ngrok"
+	ProviderTailscaleFunnel  = "tailscale_funnel"
 )
 
 // PortForwardType represents the type of port forward source
@@ -181,13 +185,11 @@ func (m *Manager) Unsubscribe(id int) {
 	}
 }
 
-// notifySubscribers sends the current port list to all subscribers.
-// Must be called with m.mu held.
+// notifySubscribers sends the current port list to all subscribers and
+// publishes it on the event bus. Must be called with m.mu held.
 func (m *Manager) notifySubscribers() {
-	if len(m.subscribers) == 0 {
-		return
-	}
 	ports := m.listLocked()
+	events.Publish(events.TopicPorts, "ports", ports)
 	for _, ch := range m.subscribers {
 		// Non-blocking send — drop if subscriber is slow
 		select {
@@ -568,70 +570,27 @@ type LocalPortInfo struct {
 
 // getListeningPorts returns all TCP listening ports with their PIDs, PPIDs and full command lines
 func getListeningPorts() ([]LocalPortInfo, error) {
-	// Use lsof to get listening TCP ports
-	cmd := exec.Command("lsof", "-iTCP", "-sTCP:LISTEN", "-n", "-P")
-	output, err := cmd.Output()
+	listeners, err := portpid.Listeners()
 	if err != nil {
-		// Check if lsof is not found in PATH
-		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
-			return nil, fmt.Errorf("lsof not installed: required to detect local listening ports. Install lsof (macOS: brew install lsof, Linux: apt-get install lsof)")
-		}
-		return nil, fmt.Errorf("failed to run lsof: %w", err)
+		return nil, err
 	}
-
-	// Collect unique PIDs and basic info from lsof
-	type lsofEntry struct {
-		port    int
-		pid     int
-		command string
-	}
-	var entries []lsofEntry
 	pidSet := make(map[int]struct{})
-
-	lines := strings.Split(string(output), "\n")
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
-			continue
-		}
-
-		// lsof columns: COMMAND PID USER FD TYPE DEVICE SIZE/OFF NODE NAME
-		fields := strings.Fields(line)
-		if len(fields) < 9 {
-			continue
-		}
-
-		command := fields[0]
-		pid, err := strconv.Atoi(fields[1])
-		if err != nil {
-			continue
-		}
-
-		// Parse NAME column which contains IP:PORT
-		nameField := fields[8]
-		port := 0
-		if idx := strings.LastIndex(nameField, ":"); idx != -1 {
-			portStr := nameField[idx+1:]
-			port, _ = strconv.Atoi(portStr)
-		}
-
-		if port > 0 {
-			entries = append(entries, lsofEntry{port: port, pid: pid, command: command})
-			pidSet[pid] = struct{}{}
-		}
+	for _, l := range listeners {
+		pidSet[l.PID] = struct{}{}
 	}
 
 	// Batch-fetch ppid and full cmdline for all PIDs via ps
 	ppidMap, cmdlineMap := fetchProcessDetails(pidSet)
 
 	// Build result
-	ports := make([]LocalPortInfo, 0, len(entries))
-	for _, e := range entries {
+	ports := make([]LocalPortInfo, 0, len(listeners))
+	for _, l := range listeners {
 		ports = append(ports, LocalPortInfo{
-			Port:    e.port,
-			PID:     e.pid,
-			PPID:    ppidMap[e.pid],
-			Command: e.command,
-			Cmdline: cmdlineMap[e.pid],
+			Port:    l.Port,
+			PID:     l.PID,
+			PPID:    ppidMap[l.PID],
+			Command: l.Command,
+			Cmdline: cmdlineMap[l.PID],
 		})
 	}
 
@@ -701,6 +660,8 @@ func RegisterAPI(mux *http.ServeMux) {
 	mux.HandleFunc("/api/ports/providers", handleProviders)
 	mux.HandleFunc("/api/ports/logs", handlePortLogs)
 	mux.HandleFunc("/api/ports/diagnostics", handleDiagnostics)
+	mux.HandleFunc("/api/ports/providers/health", handleProviderHealth)
+	mux.HandleFunc("/api/settings/tunnel-providers", handleTunnelSettings)
 	mux.HandleFunc("/api/ports/local", handleLocalPorts)
 	mux.HandleFunc("/api/ports/local/kill", handleKillProcess)
 	mux.HandleFunc("/api/ports/local/events", handleLocalPortEvents)
@@ -744,17 +705,9 @@ func handleKillProcess(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate that the PID exists by checking if it's running
-	err = syscall.Kill(pid, syscall.Signal(0))
-	if err != nil {
-		if err == syscall.ESRCH {
-			http.Error(w, "process not found", http.StatusNotFound)
-			return
-		}
-		// Permission denied means process exists but we can't signal it
-		if err != syscall.EPERM {
-			http.Error(w, fmt.Sprintf("failed to validate process: %v", err), http.StatusInternalServerError)
-			return
-		}
+	if !procctl.Alive(pid) {
+		http.Error(w, "process not found", http.StatusNotFound)
+		return
 	}
 
 	// Find what port this PID is listening on (if any)
@@ -784,9 +737,7 @@ func handleKillProcess(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	cmd := exec.Command("kill", strconv.Itoa(pid))
-	err = cmd.Run()
-	if err != nil {
+	if err := procctl.Terminate(pid); err != nil {
 		http.Error(w, fmt.Sprintf("failed to kill process %d: %v", pid, err), http.StatusInternalServerError)
 		return
 	}
@@ -858,7 +809,7 @@ func handleLocalPortEvents(w http.ResponseWriter, r *http.Request) {
 	// Send initial state
 	ports, err := getListeningPorts()
 	if err != nil {
-		// Send error and close connection for critical errors like missing lsof
+		// Send error and close connection for critical errors, e.g. ports cannot be listed
 		errMsg := err.Error()
 		fmt.Fprintf(w, "data: {\"error\":%q,\"fatal\":true}\n\n", errMsg)
 		flusher.Flush()
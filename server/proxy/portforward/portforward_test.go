@@ -82,3 +82,37 @@ func (p *testProvider) StopCount() int {
 	defer p.mu.Unlock()
 	return p.stops
 }
+
+func TestOverallHealth(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{nil, HealthOK},
+		{[]string{HealthOK, HealthOK}, HealthOK},
+		{[]string{HealthOK, HealthWarning}, HealthWarning},
+		{[]string{HealthWarning, HealthError, HealthOK}, HealthError},
+	}
+	for _, tt := range tests {
+		var checks []HealthCheck
+		for _, s := range tt.statuses {
+			checks = append(checks, HealthCheck{Status: s})
+		}
+		if got := OverallHealth(checks); got != tt.want {
+			t.Errorf("OverallHealth(%v) = %q, want %q", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"short":          "*****",
+		"2abcdefghijklm": "2abc******jklm",
+	}
+	for in, want := range tests {
+		if got := maskSecret(in); got != want {
+			t.Errorf("maskSecret(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package ngrok
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/proxy/portforward"
+)
+
+// Provider implements portforward.Provider using the ngrok agent
+type Provider struct{}
+
+var (
+	_ portforward.Provider      = (*Provider)(nil)
+	_ portforward.HealthChecker = (*Provider)(nil)
+)
+
+func (p *Provider) Name() string        { return portforward.ProviderNgrok }
+func (p *Provider) DisplayName() string { return "ngrok" }
+func (p *Provider) Description() string {
+	return "Tunneling via ngrok (*.ngrok-free.app or a reserved domain). Requires a free ngrok account auth token."
+}
+func (p *Provider) Available() bool { return portforward.IsCommandAvailable("ngrok") }
+
+func (p *Provider) Start(port int, _ string) (*portforward.TunnelHandle, error) {
+	logs := portforward.NewLogBuffer()
+	settings := portforward.GetTunnelSettings()
+
+	args := []string{"http", fmt.Sprintf("%d", port), "--log", "stdout", "--log-format", "json"}
+	if settings.NgrokDomain != "" {
+		args = append(args, "--domain", settings.NgrokDomain)
+		fmt.Fprintf(logs, "[setup] Using reserved domain: %s\n", settings.NgrokDomain)
+	}
+	cmd := exec.Command("ngrok", args...)
+	if settings.NgrokAuthToken != "" {
+		cmd.Env = append(os.Environ(), "NGROK_AUTHTOKEN="+settings.NgrokAuthToken)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe: %v", err)
+	}
+	cmd.Stderr = logs
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ngrok: %v", err)
+	}
+
+	resultCh := make(chan portforward.TunnelResult, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		found := make(chan portforward.TunnelResult, 1)
+
+		go func() {
+			reported := false
+			for scanner.Scan() {
+				line := scanner.Text()
+				logs.Write([]byte(line + "\n"))
+				// keep draining after reporting so ngrok never blocks on a full pipe
+				if reported {
+					continue
+				}
+				if url, errMsg := parseLogLine(line); url != "" {
+					found <- portforward.TunnelResult{PublicURL: url}
+					reported = true
+				} else if errMsg != "" {
+					found <- portforward.TunnelResult{Err: fmt.Errorf("ngrok: %s", errMsg)}
+					reported = true
+				}
+			}
+		}()
+
+		select {
+		case res := <-found:
+			resultCh <- res
+			if res.Err != nil {
+				cmd.Process.Kill()
+			}
+		case <-time.After(60 * time.Second):
+			resultCh <- portforward.TunnelResult{Err: fmt.Errorf("timeout waiting for ngrok tunnel URL (60s)")}
+			cmd.Process.Kill()
+			return
+		}
+
+		cmd.Wait()
+	}()
+
+	return &portforward.TunnelHandle{
+		Result: resultCh,
+		Logs:   logs,
+		Stop: func() {
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+		},
+	}, nil
+}
+
+// parseLogLine inspects one JSON log line of `ngrok --log-format json`,
+// returning the public URL once the tunnel has started, or the error
+// message of a fatal error (bad auth token, domain not reserved, ...).
+func parseLogLine(line string) (url string, errMsg string) {
+	var entry struct {
+		Level string `json:"lvl"`
+		Msg   string `json:"msg"`
+		URL   string `json:"url"`
+		Err   string `json:"err"`
+	}
+	if json.Unmarshal([]byte(line), &entry) != nil {
+		return "", ""
+	}
+	if entry.Msg == "started tunnel" && strings.HasPrefix(entry.URL, "https://") {
+		return entry.URL, ""
+	}
+	if entry.Level == "crit" || (entry.Level == "eror" && entry.Err != "" && entry.Err != "<nil>") {
+		msg := entry.Err
+		if msg == "" || msg == "<nil>" {
+			msg = entry.Msg
+		}
+		return "", msg
+	}
+	return "", ""
+}
+
+// HealthCheck verifies the ngrok binary and that an auth token is
+// configured in settings, the environment or ngrok's own config file.
+func (p *Provider) HealthCheck() []portforward.HealthCheck {
+	var checks []portforward.HealthCheck
+	if !portforward.IsCommandAvailable("ngrok") {
+		return append(checks, portforward.HealthCheck{
+			ID:          "installed",
+			Label:       "ngrok installed",
+			Status:      portforward.HealthError,
+			Description: "ngrok is not installed. Install it from https://ngrok.com/download",
+		})
+	}
+	version := ""
+	if out, err := exec.Command("ngrok", "version").CombinedOutput(); err == nil {
+		version = strings.TrimSpace(string(out))
+	}
+	checks = append(checks, portforward.HealthCheck{
+		ID:          "installed",
+		Label:       "ngrok installed",
+		Status:      portforward.HealthOK,
+		Description: version,
+	})
+
+	token := portforward.HealthCheck{ID: "auth_token", Label: "Auth token"}
+	switch {
+	case portforward.GetTunnelSettings().NgrokAuthToken != "":
+		token.Status = portforward.HealthOK
+		token.Description = "Auth token configured in settings."
+	case os.Getenv("NGROK_AUTHTOKEN") != "":
+		token.Status = portforward.HealthOK
+		token.Description = "Auth token set by NGROK_AUTHTOKEN."
+	case configHasAuthToken():
+		token.Status = portforward.HealthOK
+		token.Description = "Auth token found in the ngrok config file."
+	default:
+		token.Status = portforward.HealthError
+		token.Description = "No auth token. Copy yours from https://dashboard.ngrok.com/get-started/your-authtoken and save it in the tunnel provider settings."
+	}
+	checks = append(checks, token)
+
+	if domain := portforward.GetTunnelSettings().NgrokDomain; domain != "" {
+		checks = append(checks, portforward.HealthCheck{
+			ID:          "domain",
+			Label:       "Reserved domain",
+			Status:      portforward.HealthOK,
+			Description: domain,
+		})
+	}
+	return checks
+}
+
+// configHasAuthToken reports whether ngrok's default config file (v3
+// locations) contains an authtoken.
+func configHasAuthToken() bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	candidates := []string{
+		filepath.Join(home, ".config", "ngrok", "ngrok.yml"),
+		filepath.Join(home, "Library", "Application Support", "ngrok", "ngrok.yml"),
+		filepath.Join(home, ".ngrok2", "ngrok.yml"),
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "ngrok", "ngrok.yml"))
+	}
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "authtoken:") && strings.TrimSpace(strings.TrimPrefix(line, "authtoken:")) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
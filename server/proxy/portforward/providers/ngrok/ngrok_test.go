@@ -0,0 +1,48 @@
+package ngrok
+
+import "testing"
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantURL string
+		wantErr string
+	}{
+		{
+			name:    "started tunnel",
+			line:    `{"lvl":"info","msg":"started tunnel","name":"command_line","addr":"http://localhost:3000","url":"https://abcd-1-2-3-4.ngrok-free.app"}`,
+			wantURL: "https://abcd-1-2-3-4.ngrok-free.app",
+		},
+		{
+			name: "startup noise",
+			line: `{"lvl":"info","msg":"client session established","obj":"tunnels.session"}`,
+		},
+		{
+			name: "non-fatal error entry",
+			line: `{"lvl":"eror","msg":"heartbeat timeout","err":"<nil>"}`,
+		},
+		{
+			name:    "bad auth token",
+			line:    `{"lvl":"eror","msg":"session closing","obj":"tunnels.session","err":"authentication failed: The authtoken you specified does not look like a proper ngrok tunnel authtoken."}`,
+			wantErr: "authentication failed: The authtoken you specified does not look like a proper ngrok tunnel authtoken.",
+		},
+		{
+			name:    "crit without err",
+			line:    `{"lvl":"crit","msg":"command failed"}`,
+			wantErr: "command failed",
+		},
+		{
+			name: "not json",
+			line: "t=2024-01-01 lvl=info msg=\"started tunnel\" url=https://x.ngrok-free.app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, errMsg := parseLogLine(tt.line)
+			if url != tt.wantURL || errMsg != tt.wantErr {
+				t.Errorf("parseLogLine() = (%q, %q), want (%q, %q)", url, errMsg, tt.wantURL, tt.wantErr)
+			}
+		})
+	}
+}
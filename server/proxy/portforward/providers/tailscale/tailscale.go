@@ -0,0 +1,260 @@
+package tailscale
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/proxy/portforward"
+)
+
+// funnelPorts are the public HTTPS ports Tailscale Funnel can listen on.
+// Each forward takes one, so at most len(funnelPorts) can run at a time.
+var funnelPorts = []int{443, 8443, 10000}
+
+// Provider implements portforward.Provider using `tailscale funnel` in
+// foreground mode: the funnel lasts as long as the process.
+type Provider struct {
+	mu   sync.Mutex
+	used map[int]bool // public funnel ports in use
+}
+
+var (
+	_ portforward.Provider      = (*Provider)(nil)
+	_ portforward.HealthChecker = (*Provider)(nil)
+)
+
+func (p *Provider) Name() string        { return portforward.ProviderTailscaleFunnel }
+func (p *Provider) DisplayName() string { return "Tailscale Funnel" }
+func (p *Provider) Description() string {
+	return "Public HTTPS on your tailnet's *.ts.net name via Tailscale Funnel. Requires a Tailscale login with Funnel enabled."
+}
+func (p *Provider) Available() bool { return portforward.IsCommandAvailable("tailscale") }
+
+// acquirePort reserves a free public funnel port.
+func (p *Provider) acquirePort() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.used == nil {
+		p.used = make(map[int]bool)
+	}
+	for _, port := range funnelPorts {
+		if !p.used[port] {
+			p.used[port] = true
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("all Tailscale Funnel ports (%v) are in use", funnelPorts)
+}
+
+func (p *Provider) releasePort(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.used, port)
+}
+
+// funnelURLRegex matches the public URL printed by `tailscale funnel`,
+// e.g. "https://host.tail1234.ts.net:8443/".
+var funnelURLRegex = regexp.MustCompile(`https://[a-zA-Z0-9.-]+\.ts\.net(:[0-9]+)?`)
+
+func (p *Provider) Start(port int, _ string) (*portforward.TunnelHandle, error) {
+	logs := portforward.NewLogBuffer()
+
+	if err := ensureLoggedIn(logs); err != nil {
+		return nil, err
+	}
+
+	publicPort, err := p.acquirePort()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(logs, "[setup] Using public funnel port %d\n", publicPort)
+
+	cmd := exec.Command("tailscale", "funnel", fmt.Sprintf("--https=%d", publicPort), fmt.Sprintf("%d", port))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		p.releasePort(publicPort)
+		return nil, fmt.Errorf("failed to create pipe: %v", err)
+	}
+	// funnel prints its status (and errors) on either stream
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		p.releasePort(publicPort)
+		return nil, fmt.Errorf("failed to start tailscale funnel: %v", err)
+	}
+
+	var once sync.Once
+	release := func() { once.Do(func() { p.releasePort(publicPort) }) }
+
+	resultCh := make(chan portforward.TunnelResult, 1)
+
+	go func() {
+		defer release()
+		scanner := bufio.NewScanner(stdout)
+		urlFound := make(chan string, 1)
+
+		go func() {
+			reported := false
+			for scanner.Scan() {
+				line := scanner.Text()
+				logs.Write([]byte(line + "\n"))
+				if reported {
+					continue
+				}
+				if match := funnelURLRegex.FindString(line); match != "" {
+					urlFound <- match
+					reported = true
+				}
+			}
+		}()
+
+		select {
+		case url := <-urlFound:
+			resultCh <- portforward.TunnelResult{PublicURL: url}
+		case <-time.After(60 * time.Second):
+			resultCh <- portforward.TunnelResult{Err: fmt.Errorf("timeout waiting for tailscale funnel URL (60s); is Funnel enabled for this node?")}
+			cmd.Process.Kill()
+			return
+		}
+
+		cmd.Wait()
+	}()
+
+	return &portforward.TunnelHandle{
+		Result: resultCh,
+		Logs:   logs,
+		Stop: func() {
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+			release()
+		},
+	}, nil
+}
+
+// status is the subset of `tailscale status --json` used here.
+type status struct {
+	BackendState string `json:"BackendState"`
+	Self         struct {
+		DNSName string         `json:"DNSName"`
+		CapMap  map[string]any `json:"CapMap"`
+		Caps    []string       `json:"Capabilities"`
+	} `json:"Self"`
+}
+
+func getStatus() (*status, error) {
+	out, err := exec.Command("tailscale", "status", "--json").Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("tailscale status: %v", err)
+	}
+	var st status
+	if err := json.Unmarshal(out, &st); err != nil {
+		return nil, fmt.Errorf("parse tailscale status: %v", err)
+	}
+	return &st, nil
+}
+
+// hasFunnelAttr reports whether the node's capabilities include Funnel.
+func (st *status) hasFunnelAttr() bool {
+	for c := range st.Self.CapMap {
+		if strings.HasSuffix(c, "/funnel") || c == "funnel" {
+			return true
+		}
+	}
+	for _, c := range st.Self.Caps {
+		if strings.HasSuffix(c, "/funnel") || c == "funnel" {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureLoggedIn logs the node in with the auth key from settings when
+// tailscale is installed but not logged in.
+func ensureLoggedIn(logs io.Writer) error {
+	st, err := getStatus()
+	if err != nil {
+		return err
+	}
+	if st.BackendState == "Running" {
+		return nil
+	}
+	key := portforward.GetTunnelSettings().TailscaleAuthKey
+	if st.BackendState != "NeedsLogin" || key == "" {
+		return fmt.Errorf("tailscale is not running (state: %s); log in with `tailscale up` or save an auth key in the tunnel provider settings", st.BackendState)
+	}
+	fmt.Fprintf(logs, "[setup] Logging in to Tailscale with the configured auth key\n")
+	out, err := exec.Command("tailscale", "up", "--auth-key="+key).CombinedOutput()
+	logs.Write(out)
+	if err != nil {
+		return fmt.Errorf("tailscale up: %v", err)
+	}
+	return nil
+}
+
+// HealthCheck verifies the tailscale binary, the node's login state and
+// that Funnel is enabled for it.
+func (p *Provider) HealthCheck() []portforward.HealthCheck {
+	var checks []portforward.HealthCheck
+	if !portforward.IsCommandAvailable("tailscale") {
+		return append(checks, portforward.HealthCheck{
+			ID:          "installed",
+			Label:       "tailscale installed",
+			Status:      portforward.HealthError,
+			Description: "tailscale is not installed. Install it from https://tailscale.com/download",
+		})
+	}
+	version := ""
+	if out, err := exec.Command("tailscale", "version").CombinedOutput(); err == nil {
+		version = strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+	}
+	checks = append(checks, portforward.HealthCheck{
+		ID:          "installed",
+		Label:       "tailscale installed",
+		Status:      portforward.HealthOK,
+		Description: version,
+	})
+
+	st, err := getStatus()
+	if err != nil {
+		return append(checks, portforward.HealthCheck{
+			ID:          "logged_in",
+			Label:       "Logged in",
+			Status:      portforward.HealthError,
+			Description: err.Error() + " (is tailscaled running?)",
+		})
+	}
+	login := portforward.HealthCheck{ID: "logged_in", Label: "Logged in"}
+	switch {
+	case st.BackendState == "Running":
+		login.Status = portforward.HealthOK
+		login.Description = strings.TrimSuffix(st.Self.DNSName, ".")
+	case st.BackendState == "NeedsLogin" && portforward.GetTunnelSettings().TailscaleAuthKey != "":
+		login.Status = portforward.HealthWarning
+		login.Description = "Not logged in; the configured auth key will be used when a funnel starts."
+	default:
+		login.Status = portforward.HealthError
+		login.Description = fmt.Sprintf("Tailscale state is %s. Run `tailscale up` or save an auth key in the tunnel provider settings.", st.BackendState)
+	}
+	checks = append(checks, login)
+
+	if st.BackendState == "Running" {
+		funnel := portforward.HealthCheck{ID: "funnel", Label: "Funnel enabled"}
+		if st.hasFunnelAttr() {
+			funnel.Status = portforward.HealthOK
+			funnel.Description = "This node may use Tailscale Funnel."
+		} else {
+			funnel.Status = portforward.HealthWarning
+			funnel.Description = "Funnel does not appear to be enabled for this node. Enable HTTPS and the funnel node attribute in the tailnet policy."
+		}
+		checks = append(checks, funnel)
+	}
+	return checks
+}
@@ -0,0 +1,52 @@
+package tailscale
+
+import "testing"
+
+func TestAcquirePort(t *testing.T) {
+	p := &Provider{}
+	var got []int
+	for range funnelPorts {
+		port, err := p.acquirePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, port)
+	}
+	if _, err := p.acquirePort(); err == nil {
+		t.Fatalf("acquired more than %d funnel ports", len(funnelPorts))
+	}
+
+	p.releasePort(got[1])
+	port, err := p.acquirePort()
+	if err != nil || port != got[1] {
+		t.Fatalf("acquirePort() after release = %d, %v; want %d", port, err, got[1])
+	}
+}
+
+func TestFunnelURLRegex(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Available on the internet:\n", ""},
+		{"https://host.tail1234.ts.net/", "https://host.tail1234.ts.net"},
+		{"https://host.tail1234.ts.net:8443/", "https://host.tail1234.ts.net:8443"},
+		{"https://example.com/", ""},
+	}
+	for _, tt := range tests {
+		if got := funnelURLRegex.FindString(tt.line); got != tt.want {
+			t.Errorf("FindString(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestHasFunnelAttr(t *testing.T) {
+	var st status
+	if st.hasFunnelAttr() {
+		t.Fatalf("empty status has funnel")
+	}
+	st.Self.CapMap = map[string]any{"https://tailscale.com/cap/funnel": nil}
+	if !st.hasFunnelAttr() {
+		t.Fatalf("funnel capability not detected")
+	}
+}
@@ -0,0 +1,99 @@
+package portforward
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// TunnelSettings holds account credentials for third-party tunnel
+// providers. Empty fields fall back to the provider's own login (the ngrok
+// config file, an existing tailscale login).
+type TunnelSettings struct {
+	// NgrokAuthToken is passed to ngrok as NGROK_AUTHTOKEN.
+	NgrokAuthToken string `json:"ngrok_auth_token,omitempty"`
+	// NgrokDomain is a reserved ngrok domain to use instead of a random one.
+	NgrokDomain string `json:"ngrok_domain,omitempty"`
+	// TailscaleAuthKey logs the node in with `tailscale up --auth-key` when
+	// tailscale is installed but not logged in.
+	TailscaleAuthKey string `json:"tailscale_auth_key,omitempty"`
+}
+
+var tunnelSettingsFile = jsonfile.New[TunnelSettings](config.DataDir + "/tunnel-providers.json")
+
+// GetTunnelSettings returns the saved tunnel provider settings.
+func GetTunnelSettings() TunnelSettings {
+	s, err := tunnelSettingsFile.Get()
+	if err != nil {
+		return TunnelSettings{}
+	}
+	return s
+}
+
+// tunnelSettingsView is the API form of TunnelSettings: secrets are masked.
+type tunnelSettingsView struct {
+	NgrokAuthToken   string `json:"ngrok_auth_token"`
+	NgrokDomain      string `json:"ngrok_domain"`
+	TailscaleAuthKey string `json:"tailscale_auth_key"`
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", len(s)-8) + s[len(s)-4:]
+}
+
+// handleTunnelSettings reads (GET, secrets masked) or updates (POST) the
+// tunnel provider settings. In a POST, omitted fields are left unchanged
+// and empty strings clear them.
+func handleTunnelSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			NgrokAuthToken   *string `json:"ngrok_auth_token"`
+			NgrokDomain      *string `json:"ngrok_domain"`
+			TailscaleAuthKey *string `json:"tailscale_auth_key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		err := tunnelSettingsFile.Update(func(s *TunnelSettings) error {
+			if req.NgrokAuthToken != nil {
+				s.NgrokAuthToken = strings.TrimSpace(*req.NgrokAuthToken)
+			}
+			if req.NgrokDomain != nil {
+				s.NgrokDomain = strings.TrimSpace(*req.NgrokDomain)
+			}
+			if req.TailscaleAuthKey != nil {
+				s.TailscaleAuthKey = strings.TrimSpace(*req.TailscaleAuthKey)
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the file holds account secrets
+		os.Chmod(tunnelSettingsFile.GetPath(), 0600)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := GetTunnelSettings()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tunnelSettingsView{
+		NgrokAuthToken:   maskSecret(s.NgrokAuthToken),
+		NgrokDomain:      s.NgrokDomain,
+		TailscaleAuthKey: maskSecret(s.TailscaleAuthKey),
+	})
+}
@@ -0,0 +1,136 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// Usage is a tenant's consumption next to its limits.
+type Usage struct {
+	User          string `json:"user"`
+	Limits        Limits `json:"limits"`
+	AgentSessions int    `json:"agent_sessions"`
+	AITokensToday int64  `json:"ai_tokens_today"`
+	DiskBytes     int64  `json:"disk_bytes"`
+}
+
+// agentSessionCounter counts a tenant's running agent sessions; set by
+// the agents package, which depends on this one.
+var agentSessionCounter func(user string) int
+
+// SetAgentSessionCounter registers how running agent sessions are counted
+// for usage reports.
+func SetAgentSessionCounter(fn func(user string) int) {
+	agentSessionCounter = fn
+}
+
+// UsageOf reports user's current usage.
+func UsageOf(user string) Usage {
+	u := Usage{
+		User:          user,
+		Limits:        GetConfig().For(user),
+		AITokensToday: AITokensToday(user),
+		DiskBytes:     DiskUsage(user),
+	}
+	if agentSessionCounter != nil {
+		u.AgentSessions = agentSessionCounter(user)
+	}
+	return u
+}
+
+// RegisterAPI registers the quota endpoints:
+//
+//	GET  /api/quotas         limits configuration (admin)
+//	POST /api/quotas         replace the configuration (admin)
+//	GET  /api/quotas/usage   usage of every member (admin)
+//	GET  /api/quota          the caller's own limits and usage
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/quotas", handleConfig)
+	mux.HandleFunc("/api/quotas/usage", handleUsage)
+	mux.HandleFunc("/api/quota", handleOwnUsage)
+}
+
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var c Config
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if err := c.validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := configFile.Set(c); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, GetConfig())
+}
+
+func (c Config) validate() error {
+	check := func(who string, l Limits) error {
+		if l.MaxAgentSessions < 0 || l.DailyAITokens < 0 || l.DiskBytes < 0 {
+			return fmt.Errorf("%s: limits must not be negative", who)
+		}
+		return nil
+	}
+	if err := check("default", c.Default); err != nil {
+		return err
+	}
+	for user, l := range c.Users {
+		if err := check(user, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	users, err := auth.ListUsers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	usage := []Usage{}
+	for _, u := range users {
+		if u.Role == auth.RoleMember {
+			usage = append(usage, UsageOf(u.Name))
+		}
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func handleOwnUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	user := tenant.Name(r.Context())
+	if user == "" {
+		// admins and the global namespace are not limited
+		writeJSON(w, http.StatusOK, map[string]bool{"unlimited": true})
+		return
+	}
+	writeJSON(w, http.StatusOK, UsageOf(user))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,88 @@
+package quota
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// diskCacheTTL bounds how often a tenant's directories are walked; usage
+// is allowed to run slightly over the quota in between.
+const diskCacheTTL = 5 * time.Minute
+
+type diskEntry struct {
+	bytes int64
+	at    time.Time
+}
+
+var (
+	diskMu    sync.Mutex
+	diskCache = map[string]diskEntry{}
+)
+
+// DiskUsage returns the bytes used by user's data directory and registered
+// project directories, cached for diskCacheTTL.
+func DiskUsage(user string) int64 {
+	diskMu.Lock()
+	e, ok := diskCache[user]
+	diskMu.Unlock()
+	if ok && now().Sub(e.at) < diskCacheTTL {
+		return e.bytes
+	}
+
+	dirs := []string{tenant.DirOf(user)}
+	if list, err := projects.ForTenant(user).List(); err == nil {
+		for _, p := range list {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+	total := dirsSize(dirs)
+
+	diskMu.Lock()
+	diskCache[user] = diskEntry{bytes: total, at: now()}
+	diskMu.Unlock()
+	return total
+}
+
+// dirsSize sums regular file sizes under dirs, counting nested or repeated
+// directories once.
+func dirsSize(dirs []string) int64 {
+	clean := make([]string, len(dirs))
+	for i, dir := range dirs {
+		clean[i] = filepath.Clean(dir)
+	}
+	// walk nested directories first so their parents can skip them
+	sort.Slice(clean, func(i, j int) bool { return len(clean[i]) > len(clean[j]) })
+
+	var total int64
+	seen := map[string]bool{}
+	for _, dir := range clean {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && seen[path] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					total += info.Size()
+				}
+			}
+			return nil
+		})
+	}
+	return total
+}
@@ -0,0 +1,187 @@
+// Package quota caps what each tenant of a shared instance may use:
+// concurrent agent sessions, AI tokens per day and disk space.
+//
+// Quotas apply to members (see package tenant); admins and the global
+// namespace are never limited. A zero limit means unlimited.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// Resources reported in ExceededError.
+const (
+	ResourceAgentSessions = "agent_sessions"
+	ResourceAITokens      = "ai_tokens"
+	ResourceDisk          = "disk"
+)
+
+// Limits caps one tenant; zero fields are unlimited.
+type Limits struct {
+	MaxAgentSessions int   `json:"max_agent_sessions,omitempty"`
+	DailyAITokens    int64 `json:"daily_ai_tokens,omitempty"`
+	DiskBytes        int64 `json:"disk_bytes,omitempty"`
+}
+
+// Config holds the default limits and per-user overrides. An override
+// replaces the default as a whole.
+type Config struct {
+	Default Limits            `json:"default"`
+	Users   map[string]Limits `json:"users,omitempty"`
+}
+
+// For returns the limits that apply to user.
+func (c Config) For(user string) Limits {
+	if l, ok := c.Users[user]; ok {
+		return l
+	}
+	return c.Default
+}
+
+// ExceededError reports a request refused because a quota is used up.
+type ExceededError struct {
+	Resource string `json:"quota"`
+	Limit    int64  `json:"limit"`
+	Used     int64  `json:"used"`
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Resource {
+	case ResourceAgentSessions:
+		return fmt.Sprintf("quota exceeded: %d of %d concurrent agent sessions in use", e.Used, e.Limit)
+	case ResourceAITokens:
+		return fmt.Sprintf("quota exceeded: %d of %d AI tokens used today", e.Used, e.Limit)
+	case ResourceDisk:
+		return fmt.Sprintf("quota exceeded: %d MiB of %d MiB disk in use", e.Used>>20, e.Limit>>20)
+	}
+	return fmt.Sprintf("quota exceeded: %s", e.Resource)
+}
+
+// WriteError writes err as JSON: 429 with the quota details for an
+// ExceededError, 500 otherwise.
+func WriteError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if e, ok := err.(*ExceededError); ok {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": e.Error(),
+			"quota": e.Resource,
+			"limit": e.Limit,
+			"used":  e.Used,
+		})
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+var configFile = jsonfile.New[Config](config.DataDir + "/quotas.json")
+
+// GetConfig returns the saved quota configuration.
+func GetConfig() Config {
+	c, err := configFile.Get()
+	if err != nil {
+		return Config{}
+	}
+	return c
+}
+
+// limitsFor returns the tenant of ctx and its limits; ok is false when the
+// request is not subject to quotas.
+func limitsFor(ctx context.Context) (user string, limits Limits, ok bool) {
+	user = tenant.Name(ctx)
+	if user == "" {
+		return "", Limits{}, false
+	}
+	return user, GetConfig().For(user), true
+}
+
+// CheckAgentSessions refuses starting another agent session when the
+// tenant already runs its maximum; running is the number it runs now.
+func CheckAgentSessions(ctx context.Context, running int) error {
+	_, limits, ok := limitsFor(ctx)
+	if !ok || limits.MaxAgentSessions <= 0 || running < limits.MaxAgentSessions {
+		return nil
+	}
+	return &ExceededError{Resource: ResourceAgentSessions, Limit: int64(limits.MaxAgentSessions), Used: int64(running)}
+}
+
+// CheckAITokens refuses AI calls once the tenant used its daily tokens.
+func CheckAITokens(ctx context.Context) error {
+	user, limits, ok := limitsFor(ctx)
+	if !ok || limits.DailyAITokens <= 0 {
+		return nil
+	}
+	if used := AITokensToday(user); used >= limits.DailyAITokens {
+		return &ExceededError{Resource: ResourceAITokens, Limit: limits.DailyAITokens, Used: used}
+	}
+	return nil
+}
+
+// CheckDisk refuses writes once the tenant's data and projects take up its
+// disk quota.
+func CheckDisk(ctx context.Context) error {
+	user, limits, ok := limitsFor(ctx)
+	if !ok || limits.DiskBytes <= 0 {
+		return nil
+	}
+	if used := DiskUsage(user); used >= limits.DiskBytes {
+		return &ExceededError{Resource: ResourceDisk, Limit: limits.DiskBytes, Used: used}
+	}
+	return nil
+}
+
+// ---- AI token accounting ----
+
+type tokenUsage struct {
+	Day    string           `json:"day"` // YYYY-MM-DD, local time
+	Tokens map[string]int64 `json:"tokens"`
+}
+
+var (
+	usageMu   sync.Mutex
+	usageFile = jsonfile.New[tokenUsage](config.DataDir + "/quota-usage.json")
+	now       = time.Now // overridden in tests
+)
+
+func today() string {
+	return now().Format("2006-01-02")
+}
+
+// RecordAITokens adds n tokens to the request tenant's usage for today.
+func RecordAITokens(ctx context.Context, n int) {
+	user := tenant.Name(ctx)
+	if user == "" || n <= 0 {
+		return
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	day := today()
+	usageFile.Update(func(u *tokenUsage) error {
+		if u.Day != day || u.Tokens == nil {
+			*u = tokenUsage{Day: day, Tokens: make(map[string]int64)}
+		}
+		u.Tokens[user] += int64(n)
+		return nil
+	})
+}
+
+// AITokensToday returns the tokens user consumed today.
+func AITokensToday(user string) int64 {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u, err := usageFile.Get()
+	if err != nil || u.Day != today() {
+		return 0
+	}
+	return u.Tokens[user]
+}
@@ -0,0 +1,100 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+func setupFiles(t *testing.T, c Config) {
+	dir := t.TempDir()
+	oldConfig, oldUsage, oldNow := configFile, usageFile, now
+	t.Cleanup(func() { configFile, usageFile, now = oldConfig, oldUsage, oldNow })
+	configFile = jsonfile.New[Config](filepath.Join(dir, "quotas.json"))
+	usageFile = jsonfile.New[tokenUsage](filepath.Join(dir, "quota-usage.json"))
+	if err := configFile.Set(c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ctxFor(user string, role auth.Role) context.Context {
+	return auth.WithIdentity(context.Background(), &auth.Identity{User: user, Role: role})
+}
+
+func TestChecks(t *testing.T) {
+	setupFiles(t, Config{
+		Default: Limits{MaxAgentSessions: 2, DailyAITokens: 1000},
+		Users:   map[string]Limits{"vip": {}},
+	})
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	now = func() time.Time { return day }
+
+	carol := ctxFor("carol", auth.RoleMember)
+	RecordAITokens(carol, 600)
+	RecordAITokens(carol, 400)
+	RecordAITokens(ctxFor("bob", auth.RoleAdmin), 5000) // not tracked
+
+	tests := []struct {
+		name     string
+		err      error
+		resource string
+	}{
+		{"sessions below limit", CheckAgentSessions(carol, 1), ""},
+		{"sessions at limit", CheckAgentSessions(carol, 2), ResourceAgentSessions},
+		{"admin sessions unlimited", CheckAgentSessions(ctxFor("bob", auth.RoleAdmin), 50), ""},
+		{"override unlimited", CheckAgentSessions(ctxFor("vip", auth.RoleMember), 50), ""},
+		{"tokens used up", CheckAITokens(carol), ResourceAITokens},
+		{"other member tokens", CheckAITokens(ctxFor("dave", auth.RoleMember)), ""},
+		{"disk unlimited", CheckDisk(carol), ""},
+	}
+	for _, tt := range tests {
+		var exceeded *ExceededError
+		if tt.resource == "" {
+			if tt.err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, tt.err)
+			}
+			continue
+		}
+		if !errors.As(tt.err, &exceeded) || exceeded.Resource != tt.resource {
+			t.Errorf("%s: error = %v, want %s exceeded", tt.name, tt.err, tt.resource)
+		}
+	}
+
+	// the daily budget resets the next day
+	now = func() time.Time { return day.Add(24 * time.Hour) }
+	if err := CheckAITokens(carol); err != nil {
+		t.Errorf("next day: %v", err)
+	}
+	if got := AITokensToday("carol"); got != 0 {
+		t.Errorf("AITokensToday next day = %d", got)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, &ExceededError{Resource: ResourceAITokens, Limit: 10, Used: 12})
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), `"quota":"ai_tokens"`) {
+		t.Errorf("WriteError: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDirsSize(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "nested")
+	os.MkdirAll(nested, 0755)
+	os.WriteFile(filepath.Join(root, "a"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(nested, "b"), make([]byte, 50), 0644)
+
+	if got := dirsSize([]string{root, nested, root + "/"}); got != 150 {
+		t.Errorf("dirsSize = %d, want 150", got)
+	}
+}
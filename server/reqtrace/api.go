@@ -0,0 +1,108 @@
+package reqtrace
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+)
+
+const defaultLimit = 100
+
+// RegisterAPI registers the tracing endpoints (admin only):
+//
+//	GET    /api/debug/trace                                       -> {rules}
+//	POST   /api/debug/trace {prefix, duration_seconds, max_body_bytes} -> Rule
+//	DELETE /api/debug/trace?id=...     switch one rule off, all without id
+//	GET    /api/debug/trace/log?rule=...&path=/api/review/&since=RFC3339&limit=N   newest first
+//	DELETE /api/debug/trace/log        delete the log
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/debug/trace", handleRules)
+	mux.HandleFunc("/api/debug/trace/log", handleLog)
+}
+
+func handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rules": Rules()})
+	case http.MethodPost:
+		var req struct {
+			Prefix          string `json:"prefix"`
+			DurationSeconds int    `json:"duration_seconds"`
+			MaxBodyBytes    int    `json:"max_body_bytes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		var by string
+		if id := auth.FromContext(r.Context()); id != nil {
+			by = id.User
+		}
+		rule, err := Enable(req.Prefix, time.Duration(req.DurationSeconds)*time.Second, req.MaxBodyBytes, by)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		removed := Disable(id)
+		if id != "" && removed == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "rule not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handleLog(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if err := Clear(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	f := Filter{RuleID: q.Get("rule"), Path: q.Get("path")}
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be RFC3339"})
+			return
+		}
+		f.Since = t
+	}
+	limit := defaultLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+	entries, err := Query(f, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,462 @@
+// Package reqtrace logs full request and response bodies of selected
+// routes for debugging a misbehaving endpoint without rebuilding.
+//
+// Tracing is switched on per path prefix through /api/debug/trace and
+// switches itself off when its time window ends. Secrets are redacted the
+// way the audit log redacts them, plus credential headers. Entries are JSON
+// lines in config.DebugTraceLogFile, rotated once it grows past
+// maxLogBytes.
+package reqtrace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/audit"
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+const (
+	// DefaultDuration is the tracing window when none is given.
+	DefaultDuration = 10 * time.Minute
+	// MaxDuration bounds the tracing window.
+	MaxDuration = time.Hour
+	// DefaultMaxBodyBytes is how much of each body is logged by default.
+	DefaultMaxBodyBytes = 64 * 1024
+	// MaxMaxBodyBytes bounds Rule.MaxBodyBytes.
+	MaxMaxBodyBytes = 1024 * 1024
+
+	// maxLogBytes is the size at which the log is rotated to <file>.1.
+	maxLogBytes = 16 * 1024 * 1024
+
+	// selfPrefix is never traced: reading the log would log the log.
+	selfPrefix = "/api/debug/trace"
+
+	redacted = "[redacted]"
+)
+
+// sensitiveHeaders are never written to the log.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// Rule turns on tracing of paths starting with Prefix until ExpiresAt.
+type Rule struct {
+	ID           string    `json:"id"`
+	Prefix       string    `json:"prefix"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxBodyBytes int       `json:"max_body_bytes"`
+	Hits         int64     `json:"hits"`
+}
+
+// Body is a logged request or response body.
+type Body struct {
+	// JSON holds redacted JSON bodies; Text other textual bodies. Binary
+	// bodies are described by ContentType and Size only.
+	JSON        json.RawMessage `json:"json,omitempty"`
+	Text        string          `json:"text,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Size        int64           `json:"size"`
+	Truncated   bool            `json:"truncated,omitempty"`
+}
+
+// Entry is one traced call.
+type Entry struct {
+	Time            time.Time         `json:"time"`
+	RuleID          string            `json:"rule_id"`
+	User            string            `json:"user,omitempty"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	Status          int               `json:"status"`
+	DurationMS      int64             `json:"duration_ms"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	Request         *Body             `json:"request,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	Response        *Body             `json:"response,omitempty"`
+}
+
+var (
+	mu    sync.Mutex
+	rules []*Rule
+	// active mirrors len(rules) > 0 so untraced requests skip the lock.
+	active atomic.Bool
+
+	fileMu  sync.Mutex
+	logPath = config.DebugTraceLogFile
+)
+
+// SetFile points the trace log at path (used by tests).
+func SetFile(path string) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	logPath = path
+}
+
+// Enable starts tracing paths under prefix for d (DefaultDuration when 0),
+// logging up to maxBody bytes of each body (DefaultMaxBodyBytes when 0).
+// Enabling a prefix again replaces its rule.
+func Enable(prefix string, d time.Duration, maxBody int, by string) (*Rule, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("prefix must start with /")
+	}
+	if strings.HasPrefix(prefix, selfPrefix) {
+		return nil, fmt.Errorf("%s cannot be traced", selfPrefix)
+	}
+	if d == 0 {
+		d = DefaultDuration
+	}
+	if d < 0 || d > MaxDuration {
+		return nil, fmt.Errorf("duration must be between 0 and %s", MaxDuration)
+	}
+	if maxBody == 0 {
+		maxBody = DefaultMaxBodyBytes
+	}
+	if maxBody < 0 || maxBody > MaxMaxBodyBytes {
+		return nil, fmt.Errorf("max_body_bytes must be between 0 and %d", MaxMaxBodyBytes)
+	}
+	now := time.Now()
+	r := &Rule{
+		ID:           newID(),
+		Prefix:       prefix,
+		CreatedBy:    by,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(d),
+		MaxBodyBytes: maxBody,
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	kept := rules[:0]
+	for _, old := range rules {
+		if old.Prefix != prefix {
+			kept = append(kept, old)
+		}
+	}
+	rules = append(kept, r)
+	active.Store(true)
+	copied := *r
+	return &copied, nil
+}
+
+// Disable removes the rule with id, or every rule when id is empty, and
+// returns how many were removed.
+func Disable(id string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	kept := rules[:0]
+	for _, r := range rules {
+		if id != "" && r.ID != id {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(rules) - len(kept)
+	rules = kept
+	active.Store(len(rules) > 0)
+	return removed
+}
+
+// Rules returns the unexpired rules sorted by prefix.
+func Rules() []Rule {
+	mu.Lock()
+	defer mu.Unlock()
+	pruneLocked(time.Now())
+	list := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		list = append(list, Rule{
+			ID:           r.ID,
+			Prefix:       r.Prefix,
+			CreatedBy:    r.CreatedBy,
+			CreatedAt:    r.CreatedAt,
+			ExpiresAt:    r.ExpiresAt,
+			MaxBodyBytes: r.MaxBodyBytes,
+			Hits:         atomic.LoadInt64(&r.Hits),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Prefix < list[j].Prefix })
+	return list
+}
+
+func pruneLocked(now time.Time) {
+	kept := rules[:0]
+	for _, r := range rules {
+		if now.Before(r.ExpiresAt) {
+			kept = append(kept, r)
+		}
+	}
+	rules = kept
+	active.Store(len(rules) > 0)
+}
+
+// match returns the rule with the longest prefix covering path.
+func match(path string) *Rule {
+	if !active.Load() || strings.HasPrefix(path, selfPrefix) {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	pruneLocked(time.Now())
+	var best *Rule
+	for _, r := range rules {
+		if strings.HasPrefix(path, r.Prefix) && (best == nil || len(r.Prefix) > len(best.Prefix)) {
+			best = r
+		}
+	}
+	return best
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware logs the calls matched by a rule. It belongs inside
+// auth.Middleware so entries name the user.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := match(r.URL.Path)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		atomic.AddInt64(&rule.Hits, 1)
+
+		start := time.Now()
+		reqBody := captureRequest(r, rule.MaxBodyBytes)
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK, limit: rule.MaxBodyBytes}
+		next.ServeHTTP(rec, r)
+
+		e := Entry{
+			Time:            start,
+			RuleID:          rule.ID,
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Query:           audit.RedactQuery(r.URL.Query()),
+			Status:          rec.status,
+			DurationMS:      time.Since(start).Milliseconds(),
+			RequestHeaders:  headers(r.Header),
+			Request:         reqBody,
+			ResponseHeaders: headers(rec.Header()),
+			Response:        makeBody(rec.Header().Get("Content-Type"), rec.buf.Bytes(), rec.size, rec.size > int64(rec.buf.Len())),
+		}
+		if id := auth.FromContext(r.Context()); id != nil {
+			e.User = id.User
+		}
+		write(e)
+	})
+}
+
+// captureRequest reads up to limit bytes of the body and restores it for
+// the handler.
+func captureRequest(r *http.Request, limit int) *Body {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if len(data) == 0 {
+		return nil
+	}
+	truncated := len(data) > limit
+	size := int64(len(data))
+	if truncated {
+		data = data[:limit]
+		size = r.ContentLength
+	}
+	return makeBody(r.Header.Get("Content-Type"), data, size, truncated)
+}
+
+func makeBody(contentType string, data []byte, size int64, truncated bool) *Body {
+	if size == 0 {
+		return nil
+	}
+	b := &Body{ContentType: contentType, Size: size, Truncated: truncated}
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(ct, "json") || (ct == "" && looksJSON(data)):
+		var v interface{}
+		if !truncated && json.Unmarshal(data, &v) == nil {
+			b.JSON, _ = json.Marshal(audit.Redact(v))
+		} else {
+			// a truncated or invalid body cannot be redacted key by key
+			b.Text = redacted
+		}
+	case strings.Contains(ct, "x-www-form-urlencoded"):
+		if q, err := url.ParseQuery(string(data)); err == nil {
+			b.Text = audit.RedactQuery(q)
+		} else {
+			b.Text = redacted
+		}
+	case strings.HasPrefix(ct, "text/") || strings.Contains(ct, "xml") || ct == "":
+		b.Text = string(data)
+	}
+	return b
+}
+
+func looksJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+func headers(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for k, vals := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] || audit.IsSensitive(k) {
+			out[k] = redacted
+		} else {
+			out[k] = strings.Join(vals, ", ")
+		}
+	}
+	return out
+}
+
+// recorder captures status and the first limit bytes of the response while
+// passing through streaming (Flusher) support.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	limit       int
+	buf         bytes.Buffer
+	size        int64
+}
+
+func (s *recorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *recorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	if room := s.limit - s.buf.Len(); room > 0 {
+		s.buf.Write(b[:min(room, len(b))])
+	}
+	s.size += int64(len(b))
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *recorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *recorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func write(e Entry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "reqtrace: %v\n", err)
+		return
+	}
+	if info, err := os.Stat(logPath); err == nil && info.Size() > maxLogBytes {
+		os.Rename(logPath, logPath+".1")
+	}
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reqtrace: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// Filter selects entries in Query. Zero fields match everything.
+type Filter struct {
+	RuleID string
+	Path   string // prefix of the request path
+	Since  time.Time
+}
+
+// Query returns the newest entries matching f, newest first, at most limit.
+func Query(f Filter, limit int) ([]Entry, error) {
+	fileMu.Lock()
+	file, err := os.Open(logPath)
+	fileMu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var matched []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 8*MaxMaxBodyBytes)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if f.RuleID != "" && e.RuleID != f.RuleID {
+			continue
+		}
+		if f.Path != "" && !strings.HasPrefix(e.Path, f.Path) {
+			continue
+		}
+		if !f.Since.IsZero() && e.Time.Before(f.Since) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, min(len(matched), limit))
+	for i := len(matched) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, matched[i])
+	}
+	return result, nil
+}
+
+// Clear deletes the log and its rotated predecessor.
+func Clear() error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	for _, p := range []string{logPath, logPath + ".1"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package reqtrace
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setup(t *testing.T) http.Handler {
+	SetFile(filepath.Join(t.TempDir(), "trace.log"))
+	t.Cleanup(func() { Disable("") })
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"echo":` + string(body) + `,"token":"t0p"}`))
+	})
+	return Middleware(mux)
+}
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareTracesMatchingRoutes(t *testing.T) {
+	h := setup(t)
+	rule, err := Enable("/api/review/", time.Minute, 0, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(h, http.MethodPost, "/api/review/commit?api_key=k&dir=/r", `{"message":"m","password":"hunter2"}`)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"password":"hunter2"`) {
+		t.Fatalf("handler response altered: %d %s", rec.Code, rec.Body)
+	}
+	do(h, http.MethodGet, "/api/projects", "")
+
+	entries, err := Query(Filter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want only the traced route", len(entries))
+	}
+	e := entries[0]
+	if e.RuleID != rule.ID || e.Status != http.StatusCreated || e.Path != "/api/review/commit" {
+		t.Errorf("entry = %+v", e)
+	}
+	logged, _ := json.Marshal(e)
+	for _, secret := range []string{"hunter2", "Bearer secret", "session=abc", "t0p", "api_key=k"} {
+		if strings.Contains(string(logged), secret) {
+			t.Errorf("secret %q logged: %s", secret, logged)
+		}
+	}
+	if string(e.Request.JSON) != `{"message":"m","password":"[redacted]"}` {
+		t.Errorf("request body = %s", e.Request.JSON)
+	}
+	if !strings.Contains(string(e.Response.JSON), `"echo":{"message":"m","password":"[redacted]"}`) {
+		t.Errorf("response body = %s", e.Response.JSON)
+	}
+	if rules := Rules(); len(rules) != 1 || rules[0].Hits != 1 {
+		t.Errorf("rules = %+v", rules)
+	}
+}
+
+func TestTruncatedBodyIsNotLoggedRaw(t *testing.T) {
+	h := setup(t)
+	if _, err := Enable("/api/", time.Minute, 16, ""); err != nil {
+		t.Fatal(err)
+	}
+	do(h, http.MethodPost, "/api/x", `{"note":"long enough to be cut","password":"hunter2"}`)
+	entries, _ := Query(Filter{}, 1)
+	if len(entries) != 1 {
+		t.Fatal("not traced")
+	}
+	req := entries[0].Request
+	if !req.Truncated || req.Text != redacted || len(req.JSON) != 0 {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestRulesExpireAndReplace(t *testing.T) {
+	h := setup(t)
+	first, _ := Enable("/api/a", time.Minute, 0, "")
+	second, _ := Enable("/api/a", time.Minute, 0, "")
+	if rules := Rules(); len(rules) != 1 || rules[0].ID != second.ID || first.ID == second.ID {
+		t.Errorf("re-enabling did not replace: %+v", rules)
+	}
+
+	mu.Lock()
+	rules[0].ExpiresAt = time.Now().Add(-time.Second)
+	mu.Unlock()
+	do(h, http.MethodGet, "/api/a", "")
+	if entries, _ := Query(Filter{}, 10); len(entries) != 0 || len(Rules()) != 0 {
+		t.Errorf("expired rule still traces: %d entries", len(entries))
+	}
+
+	for _, bad := range []string{"api", selfPrefix + "/log"} {
+		if _, err := Enable(bad, 0, 0, ""); err == nil {
+			t.Errorf("prefix %q accepted", bad)
+		}
+	}
+	if _, err := Enable("/api", 2*MaxDuration, 0, ""); err == nil {
+		t.Error("over-long window accepted")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	setup(t)
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/debug/trace", strings.NewReader(`{"prefix":"/api/files","duration_seconds":60}`)))
+	var rule Rule
+	if err := json.Unmarshal(rec.Body.Bytes(), &rule); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("enable: %d %s", rec.Code, rec.Body)
+	}
+	if d := rule.ExpiresAt.Sub(rule.CreatedAt); d != time.Minute {
+		t.Errorf("window = %s", d)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/debug/trace?id=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/debug/trace?id="+rule.ID, nil))
+	if rec.Code != http.StatusOK || len(Rules()) != 0 {
+		t.Errorf("disable: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/debug/trace/log?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit: %d", rec.Code)
+	}
+}
@@ -0,0 +1,100 @@
+// Package restartstate carries in-memory server state across an
+// exec-restart. syscall.Exec keeps nothing but os.Args, so just before the
+// exec the server saves a snapshot to restart-state.json, and the new
+// process takes it on startup and restores what its flags did not set.
+package restartstate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// maxAge bounds how old a snapshot may be when taken. An older one was
+// left by an exec that failed, and no longer describes the server.
+const maxAge = 5 * time.Minute
+
+// File is where the snapshot is kept, replaced in tests.
+var File = config.RestartStateFile
+
+// State is what an exec-restart would otherwise lose.
+type State struct {
+	SavedAt       time.Time `json:"saved_at"`
+	QuickTest     bool      `json:"quick_test,omitempty"`
+	QuickTestKeep bool      `json:"quick_test_keep,omitempty"`
+	FrontendPort  int       `json:"frontend_port,omitempty"`
+	FrontendHost  string    `json:"frontend_host,omitempty"`
+	// Sessions are the headless agent sessions that were starting or
+	// running; they are relaunched under the same IDs.
+	Sessions []Session `json:"sessions,omitempty"`
+	// PortForwards are the user-added port forwards. Domain tunnels,
+	// exposed URLs and extra mappings are restored from their own config.
+	PortForwards []PortForward `json:"port_forwards,omitempty"`
+}
+
+// Session is an agent session to relaunch. Its API key is deliberately
+// not kept, so a restored session uses the configured credentials.
+type Session struct {
+	ID         string `json:"id"`
+	AgentID    string `json:"agent_id"`
+	ProjectDir string `json:"project_dir"`
+	Owner      string `json:"owner,omitempty"`
+}
+
+// PortForward is a port forward to start again.
+type PortForward struct {
+	Port     int    `json:"port"`
+	Label    string `json:"label"`
+	Provider string `json:"provider"`
+}
+
+// Save writes s, stamped with the current time, to File.
+func Save(s *State) error {
+	s.SavedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(File), 0755); err != nil {
+		return err
+	}
+	// credentials-free, but owners and project paths are still private
+	tmp := File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, File)
+}
+
+// Take reads and removes the snapshot, so it is restored at most once.
+// It returns nil if there is none or it is stale.
+func Take() (*State, error) {
+	data, err := os.ReadFile(File)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := os.Remove(File); err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if time.Since(s.SavedAt) > maxAge {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// Discard removes a snapshot that will not be used, e.g. after the exec
+// failed.
+func Discard() {
+	os.Remove(File)
+}
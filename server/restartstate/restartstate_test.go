@@ -0,0 +1,61 @@
+package restartstate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func useTempFile(t *testing.T) {
+	t.Helper()
+	old := File
+	File = filepath.Join(t.TempDir(), "restart-state.json")
+	t.Cleanup(func() { File = old })
+}
+
+func TestSaveTake(t *testing.T) {
+	useTempFile(t)
+
+	want := &State{
+		QuickTest:    true,
+		FrontendPort: 5173,
+		Sessions:     []Session{{ID: "agent-session-3", AgentID: "opencode", ProjectDir: "/p"}},
+		PortForwards: []PortForward{{Port: 8080, Label: "app", Provider: "localtunnel"}},
+	}
+	if err := Save(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !got.SavedAt.Equal(want.SavedAt) {
+		t.Fatalf("Take() = %+v", got)
+	}
+	got.SavedAt, want.SavedAt = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take() = %+v, want %+v", got, want)
+	}
+
+	if got, err := Take(); got != nil || err != nil {
+		t.Errorf("second Take() = %+v, %v; want nothing", got, err)
+	}
+}
+
+func TestTakeIgnoresStaleSnapshot(t *testing.T) {
+	useTempFile(t)
+
+	data, _ := json.Marshal(State{SavedAt: time.Now().Add(-time.Hour), QuickTest: true})
+	if err := os.WriteFile(File, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Take(); got != nil || err != nil {
+		t.Errorf("Take() = %+v, %v; want nothing", got, err)
+	}
+	if _, err := os.Stat(File); !os.IsNotExist(err) {
+		t.Errorf("stale snapshot not removed: %v", err)
+	}
+}
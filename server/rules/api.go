@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// RegisterAPI registers the rule pack endpoints. dir is a project whose
+// .ai-critic/rules packs are included:
+//
+//	GET    /api/rules?dir=...          -> [Pack]
+//	POST   /api/rules {Pack}           -> Pack, a new user pack
+//	GET    /api/rules/{name}?dir=...   -> Pack
+//	PUT    /api/rules/{name}?dir=...   {PackUpdate} -> Pack
+//	DELETE /api/rules/{name}           user packs only
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/rules", handlePacks)
+	mux.HandleFunc("/api/rules/", handlePack)
+}
+
+func handlePacks(w http.ResponseWriter, r *http.Request) {
+	owner := tenant.Name(r.Context())
+	switch r.Method {
+	case http.MethodGet:
+		packs, err := List(owner, projects.Dir(r.Context(), r.URL.Query().Get("dir")))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, packs)
+	case http.MethodPost:
+		var p Pack
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		created, err := Create(owner, p)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handlePack(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/rules/")
+	owner := tenant.Name(r.Context())
+	dir := projects.Dir(r.Context(), r.URL.Query().Get("dir"))
+	switch r.Method {
+	case http.MethodGet:
+		p, err := Get(owner, dir, name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		var u PackUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		p, err := Update(owner, dir, name, u)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodDelete:
+		if err := Delete(owner, name); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		status = http.StatusNotFound
+		err = errors.New("rule pack not found")
+	case errors.Is(err, ErrExists):
+		status = http.StatusConflict
+	case errors.Is(err, ErrReadOnly):
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
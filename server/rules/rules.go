@@ -0,0 +1,465 @@
+// Package rules keeps the review rules as named packs. A review applies the
+// enabled packs, in name order, unless the request turns packs on or off.
+//
+// Packs come from three places; a later one replaces an earlier pack of the
+// same name:
+//
+//   - builtin: the --rules-dir directory. Its REVIEW_RULES.md is the
+//     "default" pack, the markdown files of each subdirectory another pack.
+//     Their content is read-only.
+//   - user: directories under config.RulePacksDir (in the tenant's namespace
+//     for members), edited through /api/rules.
+//   - project: .ai-critic/rules in the reviewed repository. Markdown files
+//     directly inside form the "project" pack, each subdirectory another
+//     pack; an empty subdirectory turns off the pack of that name.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// Values of Pack.Source.
+const (
+	SourceBuiltin = "builtin"
+	SourceUser    = "user"
+	SourceProject = "project"
+)
+
+const (
+	// DefaultPack is the pack read from the builtin REVIEW_RULES.md.
+	DefaultPack = "default"
+	// ProjectPack holds the markdown files directly in ProjectDir.
+	ProjectPack = "project"
+	// ProjectDir is where a repository keeps its own packs.
+	ProjectDir = ".ai-critic/rules"
+	// MaxFileBytes bounds one rules file written through the API.
+	MaxFileBytes = 256 << 10
+
+	legacyFile = "REVIEW_RULES.md"
+	stateFile  = "packs.json"
+)
+
+var (
+	ErrExists   = errors.New("rule pack already exists")
+	ErrReadOnly = errors.New("rule pack is read-only")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	// builtinDir is the --rules-dir directory.
+	builtinDir = "rules"
+	// mu serializes changes to user packs.
+	mu sync.Mutex
+)
+
+// File is one markdown file of a pack.
+type File struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Pack is a named set of review rules.
+type Pack struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Enabled packs apply to reviews that do not choose otherwise.
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+	// Overrides is the source of the pack of the same name this one
+	// replaces, if any.
+	Overrides string `json:"overrides,omitempty"`
+	Files     []File `json:"files"`
+}
+
+// PackUpdate changes a pack; nil fields are kept. Builtin and project packs
+// only accept Enabled.
+type PackUpdate struct {
+	Description *string `json:"description"`
+	Enabled     *bool   `json:"enabled"`
+	Files       *[]File `json:"files"`
+}
+
+// Selection adjusts the packs of one review: Enable applies packs even if
+// they are disabled, Disable leaves out enabled ones.
+type Selection struct {
+	Enable  []string `json:"enable,omitempty"`
+	Disable []string `json:"disable,omitempty"`
+}
+
+// packState is what the registry remembers about a pack besides its files.
+type packState struct {
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// SetBuiltinDir sets the directory of the builtin packs.
+func SetBuiltinDir(dir string) {
+	builtinDir = dir
+}
+
+// rootOf returns the user packs directory of a tenant.
+func rootOf(owner string) string {
+	return tenant.PathOf(owner, config.RulePacksDir)
+}
+
+// List returns the packs that apply to projectDir (may be empty), sorted by
+// name.
+func List(owner, projectDir string) ([]Pack, error) {
+	state, err := loadState(owner)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Pack)
+	add := func(p Pack) {
+		if prev, ok := byName[p.Name]; ok {
+			p.Overrides = prev.Source
+		}
+		s := state[p.Name]
+		if p.Source == SourceUser {
+			p.Description = s.Description
+		}
+		p.Enabled = !s.Disabled
+		byName[p.Name] = &p
+	}
+	for _, p := range builtinPacks() {
+		add(p)
+	}
+	user, err := userPacks(owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range user {
+		add(p)
+	}
+	if projectDir != "" {
+		for _, p := range projectPacks(projectDir) {
+			add(p)
+		}
+	}
+
+	packs := make([]Pack, 0, len(byName))
+	for _, p := range byName {
+		packs = append(packs, *p)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Name < packs[j].Name })
+	return packs, nil
+}
+
+// Get returns the pack name as it applies to projectDir.
+func Get(owner, projectDir, name string) (*Pack, error) {
+	packs, err := List(owner, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// Resolve returns the packs a review of projectDir applies: the enabled
+// ones adjusted by sel, skipping packs without rules.
+func Resolve(owner, projectDir string, sel Selection) ([]Pack, error) {
+	packs, err := List(owner, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(packs))
+	for _, p := range packs {
+		known[p.Name] = true
+	}
+	want := make(map[string]bool)
+	for _, name := range sel.Enable {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown rule pack: %s", name)
+		}
+		want[name] = true
+	}
+	for _, name := range sel.Disable {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown rule pack: %s", name)
+		}
+		want[name] = false
+	}
+
+	var applied []Pack
+	for _, p := range packs {
+		on, ok := want[p.Name]
+		if !ok {
+			on = p.Enabled
+		}
+		if on && p.text() != "" {
+			applied = append(applied, p)
+		}
+	}
+	return applied, nil
+}
+
+// Text joins the rules of packs for the review prompt. A single pack is used
+// as it is, so a setup with only REVIEW_RULES.md keeps its prompt; several
+// get a heading each.
+func Text(packs []Pack) string {
+	if len(packs) == 1 {
+		return packs[0].text()
+	}
+	var parts []string
+	for _, p := range packs {
+		parts = append(parts, fmt.Sprintf("## Rule pack: %s\n\n%s", p.Name, p.text()))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (p Pack) text() string {
+	var parts []string
+	for _, f := range p.Files {
+		if c := strings.TrimSpace(f.Content); c != "" {
+			parts = append(parts, c)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Create adds a user pack of owner.
+func Create(owner string, p Pack) (*Pack, error) {
+	if err := checkPack(p.Name, p.Files); err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if existing, err := Get(owner, "", p.Name); err == nil {
+		if existing.Source == SourceBuiltin {
+			return nil, fmt.Errorf("%w: %s is a builtin pack", ErrExists, p.Name)
+		}
+		return nil, ErrExists
+	}
+	if err := writeFiles(owner, p.Name, p.Files); err != nil {
+		return nil, err
+	}
+	if err := updateState(owner, func(s map[string]packState) {
+		s[p.Name] = packState{Description: p.Description, Disabled: !p.Enabled}
+	}); err != nil {
+		return nil, err
+	}
+	return Get(owner, "", p.Name)
+}
+
+// Update changes a pack of owner; with projectDir, packs of that project
+// can be enabled or disabled too.
+func Update(owner, projectDir, name string, u PackUpdate) (*Pack, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := Get(owner, projectDir, name); err != nil {
+		return nil, err
+	}
+	if u.Description != nil || u.Files != nil {
+		if p, err := Get(owner, "", name); err != nil || p.Source != SourceUser {
+			return nil, ErrReadOnly
+		}
+	}
+	if u.Files != nil {
+		if err := checkPack(name, *u.Files); err != nil {
+			return nil, err
+		}
+		if err := writeFiles(owner, name, *u.Files); err != nil {
+			return nil, err
+		}
+	}
+	if err := updateState(owner, func(s map[string]packState) {
+		st := s[name]
+		if u.Description != nil {
+			st.Description = *u.Description
+		}
+		if u.Enabled != nil {
+			st.Disabled = !*u.Enabled
+		}
+		s[name] = st
+	}); err != nil {
+		return nil, err
+	}
+	return Get(owner, projectDir, name)
+}
+
+// Delete removes a user pack of owner.
+func Delete(owner, name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !validName.MatchString(name) {
+		return os.ErrNotExist
+	}
+	dir := filepath.Join(rootOf(owner), name)
+	if _, err := os.Stat(dir); err != nil {
+		if _, err := Get(owner, "", name); err == nil {
+			return ErrReadOnly
+		}
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return updateState(owner, func(s map[string]packState) { delete(s, name) })
+}
+
+func checkPack(name string, files []File) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid pack name: %q", name)
+	}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		if !validName.MatchString(f.Name) || !strings.HasSuffix(f.Name, ".md") {
+			return fmt.Errorf("invalid file name %q: want a .md name without directories", f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate file: %s", f.Name)
+		}
+		seen[f.Name] = true
+		if len(f.Content) > MaxFileBytes {
+			return fmt.Errorf("%s: larger than %d KB", f.Name, MaxFileBytes>>10)
+		}
+	}
+	return nil
+}
+
+// writeFiles replaces the files of a user pack.
+func writeFiles(owner, name string, files []File) error {
+	root := rootOf(owner)
+	tmp := filepath.Join(root, "."+name+".tmp")
+	os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(tmp, f.Name), []byte(f.Content), 0644); err != nil {
+			os.RemoveAll(tmp)
+			return err
+		}
+	}
+	dir := filepath.Join(root, name)
+	if err := os.RemoveAll(dir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+func builtinPacks() []Pack {
+	var packs []Pack
+	if content, err := os.ReadFile(filepath.Join(builtinDir, legacyFile)); err == nil {
+		packs = append(packs, Pack{
+			Name:   DefaultPack,
+			Source: SourceBuiltin,
+			Files:  []File{{Name: legacyFile, Content: string(content)}},
+		})
+	}
+	for _, name := range subdirs(builtinDir) {
+		if files := readFiles(filepath.Join(builtinDir, name)); len(files) > 0 {
+			packs = append(packs, Pack{Name: name, Source: SourceBuiltin, Files: files})
+		}
+	}
+	return packs
+}
+
+func userPacks(owner string) ([]Pack, error) {
+	root := rootOf(owner)
+	if _, err := os.Stat(root); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var packs []Pack
+	for _, name := range subdirs(root) {
+		packs = append(packs, Pack{Name: name, Source: SourceUser, Files: readFiles(filepath.Join(root, name))})
+	}
+	return packs, nil
+}
+
+func projectPacks(projectDir string) []Pack {
+	dir := filepath.Join(projectDir, ProjectDir)
+	var packs []Pack
+	if files := readFiles(dir); len(files) > 0 {
+		packs = append(packs, Pack{Name: ProjectPack, Source: SourceProject, Files: files})
+	}
+	for _, name := range subdirs(dir) {
+		packs = append(packs, Pack{Name: name, Source: SourceProject, Files: readFiles(filepath.Join(dir, name))})
+	}
+	return packs
+}
+
+// subdirs lists the pack directories of dir.
+func subdirs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && validName.MatchString(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// readFiles returns the markdown files of dir sorted by name; the pack's
+// rules are their contents in that order.
+func readFiles(dir string) []File {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	files := []File{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".md") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: e.Name(), Content: string(content)})
+	}
+	return files
+}
+
+func loadState(owner string) (map[string]packState, error) {
+	state := make(map[string]packState)
+	data, err := os.ReadFile(filepath.Join(rootOf(owner), stateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", stateFile, err)
+	}
+	return state, nil
+}
+
+func updateState(owner string, fn func(map[string]packState)) error {
+	state, err := loadState(owner)
+	if err != nil {
+		return err
+	}
+	fn(state)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rootOf(owner), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(rootOf(owner), stateFile), data, 0644)
+}
@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	savedData, savedPacks, savedBuiltin := config.DataDir, config.RulePacksDir, builtinDir
+	config.DataDir = t.TempDir()
+	config.RulePacksDir = config.DataDir + "/rule-packs"
+	builtinDir = t.TempDir()
+	t.Cleanup(func() { config.DataDir, config.RulePacksDir, builtinDir = savedData, savedPacks, savedBuiltin })
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func names(packs []Pack) string {
+	var s []string
+	for _, p := range packs {
+		s = append(s, p.Name)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestLegacyRulesFileIsTheDefaultPack(t *testing.T) {
+	setup(t)
+	write(t, filepath.Join(builtinDir, "REVIEW_RULES.md"), "- no panics\n")
+	packs, err := Resolve("", "", Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(packs) != DefaultPack || Text(packs) != "- no panics" {
+		t.Errorf("packs %s, text %q", names(packs), Text(packs))
+	}
+}
+
+func TestProjectOverrides(t *testing.T) {
+	setup(t)
+	project := t.TempDir()
+	write(t, filepath.Join(builtinDir, "REVIEW_RULES.md"), "default rules")
+	write(t, filepath.Join(builtinDir, "go/errors.md"), "wrap errors")
+	write(t, filepath.Join(builtinDir, "style/naming.md"), "short names")
+	write(t, filepath.Join(project, ProjectDir, "local.md"), "project rules")
+	write(t, filepath.Join(project, ProjectDir, "go/a.md"), "project go rules")
+	os.MkdirAll(filepath.Join(project, ProjectDir, "style"), 0755)
+
+	packs, err := List("", project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(packs) != "default,go,project,style" {
+		t.Fatalf("packs = %s", names(packs))
+	}
+	if packs[1].Source != SourceProject || packs[1].Overrides != SourceBuiltin {
+		t.Errorf("go pack = %+v", packs[1])
+	}
+
+	// the empty style directory turns that pack off
+	applied, err := Resolve("", project, Selection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(applied) != "default,go,project" {
+		t.Errorf("applied = %s", names(applied))
+	}
+	text := Text(applied)
+	if !strings.Contains(text, "## Rule pack: go\n\nproject go rules") || strings.Contains(text, "wrap errors") {
+		t.Errorf("text = %q", text)
+	}
+
+	// without the project its packs do not exist
+	if _, err := Resolve("", "", Selection{Enable: []string{"project"}}); err == nil {
+		t.Error("unknown pack accepted")
+	}
+}
+
+func TestSelection(t *testing.T) {
+	setup(t)
+	write(t, filepath.Join(builtinDir, "REVIEW_RULES.md"), "default rules")
+	if _, err := Create("", Pack{Name: "security", Files: []File{{Name: "a.md", Content: "no sql concat"}}}); err != nil {
+		t.Fatal(err)
+	}
+	applied, _ := Resolve("", "", Selection{})
+	if names(applied) != DefaultPack {
+		t.Errorf("a new pack is enabled only when asked: %s", names(applied))
+	}
+	applied, _ = Resolve("", "", Selection{Enable: []string{"security"}, Disable: []string{DefaultPack}})
+	if names(applied) != "security" {
+		t.Errorf("applied = %s", names(applied))
+	}
+
+	enabled := true
+	if _, err := Update("", "", "security", PackUpdate{Enabled: &enabled}); err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	if _, err := Update("", "", DefaultPack, PackUpdate{Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if applied, _ = Resolve("", "", Selection{}); names(applied) != "security" {
+		t.Errorf("applied = %s", names(applied))
+	}
+	files := []File{{Name: "b.md", Content: "x"}}
+	if _, err := Update("", "", DefaultPack, PackUpdate{Files: &files}); err != ErrReadOnly {
+		t.Errorf("builtin pack edited: %v", err)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	setup(t)
+	write(t, filepath.Join(builtinDir, "REVIEW_RULES.md"), "default rules")
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	do := func(user, method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		if user != "" {
+			req = req.WithContext(auth.WithIdentity(context.Background(), &auth.Identity{User: user, Role: auth.RoleMember}))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	pack := `{"name":"security","enabled":true,"files":[{"name":"a.md","content":"no sql concat"}]}`
+	if rec := do("alice", http.MethodPost, "/api/rules", pack); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("alice", http.MethodPost, "/api/rules", pack); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate: %d", rec.Code)
+	}
+	if rec := do("alice", http.MethodPost, "/api/rules", `{"name":"x","files":[{"name":"../a.md"}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad file name: %d", rec.Code)
+	}
+	if rec := do("alice", http.MethodPut, "/api/rules/security", `{"files":[{"name":"b.md","content":"v2"}]}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"v2"`) {
+		t.Errorf("update: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("alice", http.MethodGet, "/api/rules", ""); !strings.Contains(rec.Body.String(), `"security"`) {
+		t.Errorf("list: %s", rec.Body)
+	}
+
+	// another tenant has its own packs
+	if rec := do("bob", http.MethodGet, "/api/rules/security", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("other tenant: %d", rec.Code)
+	}
+
+	if rec := do("alice", http.MethodDelete, "/api/rules/default", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete builtin: %d", rec.Code)
+	}
+	if rec := do("alice", http.MethodDelete, "/api/rules/security", ""); rec.Code != http.StatusOK {
+		t.Errorf("delete: %d", rec.Code)
+	}
+	if rec := do("alice", http.MethodGet, "/api/rules/security", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted pack: %d", rec.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package scaffold
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// RegisterAPI registers the scaffolding endpoints:
+//
+//	GET  /api/scaffold/templates                                   -> []Template
+//	POST /api/scaffold/generate {template, dir, name, vars, no_git, parent_id}
+//	     -> GenerateResponse
+//
+// A generated project is registered in the request tenant's projects
+// registry.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/scaffold/templates", handleTemplates)
+	mux.HandleFunc("/api/scaffold/generate", handleGenerate)
+}
+
+// GenerateResponse is a Result plus the id of the registered project.
+type GenerateResponse struct {
+	Result
+	ProjectID string `json:"project_id"`
+}
+
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	list, err := List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	var req struct {
+		Options
+		ParentID string `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	res, err := Generate(req.Options)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	id, err := projects.ForContext(r.Context()).Add(projects.Project{
+		Name:     res.Name,
+		Dir:      res.Dir,
+		ParentID: req.ParentID,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "project generated but not registered: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, GenerateResponse{Result: *res, ProjectID: id})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,337 @@
+// Package scaffold generates new project directories from templates.
+//
+// A template is a directory tree. Files ending in .tmpl are rendered with
+// text/template and written without the suffix; other files are copied
+// verbatim. Path segments may also contain {{...}} actions. An optional
+// template.json at the root describes the template and its variables and is
+// not copied.
+//
+// Built-in templates are embedded in the binary; custom templates live in
+// one subdirectory each under config.TemplatesDir and shadow a built-in of
+// the same name.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+//go:embed all:templates
+var builtinFS embed.FS
+
+var templatesDir = config.TemplatesDir
+
+// manifestFile describes a template; it is never copied into the output.
+const manifestFile = "template.json"
+
+const tmplSuffix = ".tmpl"
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Variable is one value a template asks for. Default may itself reference
+// earlier variables, e.g. "example.com/{{.name}}".
+type Variable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Template is a template as listed by GET /api/scaffold/templates.
+type Template struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Builtin     bool       `json:"builtin"`
+	Variables   []Variable `json:"variables"`
+
+	fsys fs.FS
+}
+
+// Options selects a template and where to generate it.
+type Options struct {
+	Template string `json:"template"`
+	// Dir is the directory to create; it must not exist or be empty.
+	Dir string `json:"dir"`
+	// Name defaults to the base name of Dir and is always available to
+	// templates as {{.name}}.
+	Name string            `json:"name,omitempty"`
+	Vars map[string]string `json:"vars,omitempty"`
+	// NoGit skips git init.
+	NoGit bool `json:"no_git,omitempty"`
+}
+
+// Result reports what Generate created.
+type Result struct {
+	Dir   string            `json:"dir"`
+	Name  string            `json:"name"`
+	Files []string          `json:"files"`
+	Vars  map[string]string `json:"vars"`
+	Git   bool              `json:"git"`
+}
+
+// List returns the built-in and custom templates sorted by name.
+func List() ([]Template, error) {
+	byName := make(map[string]Template)
+	entries, err := fs.ReadDir(builtinFS, "templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub, err := fs.Sub(builtinFS, "templates/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		t, err := load(e.Name(), sub)
+		if err != nil {
+			return nil, err
+		}
+		t.Builtin = true
+		byName[t.Name] = t
+	}
+	custom, err := os.ReadDir(templatesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range custom {
+		if !e.IsDir() || !namePattern.MatchString(e.Name()) {
+			continue
+		}
+		t, err := load(e.Name(), os.DirFS(filepath.Join(templatesDir, e.Name())))
+		if err != nil {
+			return nil, err
+		}
+		byName[t.Name] = t
+	}
+	list := make([]Template, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get returns the named template.
+func Get(name string) (*Template, error) {
+	list, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("template not found: %s", name)
+}
+
+func load(name string, fsys fs.FS) (Template, error) {
+	t := Template{Name: name, fsys: fsys}
+	data, err := fs.ReadFile(fsys, manifestFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Variables = []Variable{}
+			return t, nil
+		}
+		return t, err
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("template %s: parse %s: %w", name, manifestFile, err)
+	}
+	t.Name = name
+	if t.Variables == nil {
+		t.Variables = []Variable{}
+	}
+	return t, nil
+}
+
+// Generate renders the template into opts.Dir and runs git init there.
+// On failure a directory it created is removed again.
+func Generate(opts Options) (*Result, error) {
+	if opts.Template == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+	if strings.TrimSpace(opts.Dir) == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	dir, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dir: %w", err)
+	}
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	t, err := Get(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := resolveVars(t.Variables, name, opts.Vars)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := prepareDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := render(t.fsys, dir, vars)
+	if err == nil && !opts.NoGit {
+		err = gitInit(dir)
+	}
+	if err != nil {
+		if created {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+	return &Result{
+		Dir:   dir,
+		Name:  name,
+		Files: files,
+		Vars:  vars,
+		Git:   !opts.NoGit,
+	}, nil
+}
+
+// resolveVars fills in defaults in declaration order, so a default can use
+// the variables before it.
+func resolveVars(decls []Variable, name string, given map[string]string) (map[string]string, error) {
+	vars := map[string]string{"name": name}
+	for k, v := range given {
+		if k != "name" {
+			vars[k] = v
+		}
+	}
+	for _, d := range decls {
+		if d.Name == "name" {
+			continue
+		}
+		if _, ok := vars[d.Name]; ok {
+			continue
+		}
+		if d.Required && d.Default == "" {
+			return nil, fmt.Errorf("variable %s is required", d.Name)
+		}
+		v, err := expand("default of "+d.Name, d.Default, vars)
+		if err != nil {
+			return nil, err
+		}
+		vars[d.Name] = v
+	}
+	return vars, nil
+}
+
+// prepareDir creates dir, or accepts it if it already exists and is empty.
+// It reports whether it created the directory.
+func prepareDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		if len(entries) > 0 {
+			return false, fmt.Errorf("dir is not empty: %s", dir)
+		}
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func render(fsys fs.FS, dir string, vars map[string]string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." || p == manifestFile {
+			return nil
+		}
+		rel, err := expand(p, p, vars)
+		if err != nil {
+			return err
+		}
+		rel = path.Clean(rel)
+		if rel == "." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return fmt.Errorf("%s: path escapes the project dir", p)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(target, tmplSuffix) {
+			target = strings.TrimSuffix(target, tmplSuffix)
+			rel = strings.TrimSuffix(rel, tmplSuffix)
+			out, err := expand(p, string(data), vars)
+			if err != nil {
+				return err
+			}
+			data = []byte(out)
+		}
+		mode := os.FileMode(0644)
+		if info, err := d.Info(); err == nil && info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		if err := os.WriteFile(target, data, mode); err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// expand executes text as a template; what names it in errors.
+func expand(what string, text string, vars map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(what).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", what, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("render %s: %w", what, err)
+	}
+	return buf.String(), nil
+}
+
+func gitInit(dir string) error {
+	for _, args := range [][]string{{"init"}, {"add", "-A"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
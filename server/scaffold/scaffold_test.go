@@ -0,0 +1,90 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGoService(t *testing.T) {
+	templatesDir = t.TempDir()
+	dir := filepath.Join(t.TempDir(), "demo")
+
+	res, err := Generate(Options{Template: "go-service", Dir: dir, Vars: map[string]string{"port": "9000"}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if res.Name != "demo" || res.Vars["module"] != "example.com/demo" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(goMod), "module example.com/demo\n") {
+		t.Errorf("go.mod = %q", goMod)
+	}
+	mainGo, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(mainGo), `flag.Int("port", 9000,`) {
+		t.Errorf("main.go did not get port substituted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitignore")); err != nil {
+		t.Errorf(".gitignore: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestFile)); !os.IsNotExist(err) {
+		t.Errorf("%s must not be copied", manifestFile)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		t.Errorf("git init: %v", err)
+	}
+
+	if _, err := Generate(Options{Template: "go-service", Dir: dir}); err == nil {
+		t.Errorf("expected error generating into a non-empty dir")
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	templatesDir = t.TempDir()
+	tdir := filepath.Join(templatesDir, "notes")
+	os.MkdirAll(filepath.Join(tdir, "{{.name}}"), 0755)
+	os.WriteFile(filepath.Join(tdir, manifestFile), []byte(`{"description":"Notes","variables":[{"name":"owner","required":true}]}`), 0644)
+	os.WriteFile(filepath.Join(tdir, "{{.name}}", "NOTES.md.tmpl"), []byte("by {{.owner}}\n"), 0644)
+
+	list, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, tm := range list {
+		if tm.Name == "notes" {
+			found = !tm.Builtin && tm.Description == "Notes"
+		}
+	}
+	if !found {
+		t.Fatalf("custom template not listed: %+v", list)
+	}
+
+	dir := filepath.Join(t.TempDir(), "x")
+	if _, err := Generate(Options{Template: "notes", Dir: dir, NoGit: true}); err == nil {
+		t.Fatalf("expected missing required variable error")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("dir should not be created on error")
+	}
+
+	res, err := Generate(Options{Template: "notes", Dir: dir, NoGit: true, Vars: map[string]string{"owner": "me"}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(res.Files) != 1 || res.Files[0] != "x/NOTES.md" {
+		t.Errorf("files = %v", res.Files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "x", "NOTES.md"))
+	if err != nil || string(data) != "by me\n" {
+		t.Errorf("NOTES.md = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// RegisterAPI registers the schedule endpoints.
+//
+//	GET    /api/schedules                  -> [Status]
+//	POST   /api/schedules {name, task, cron, params, enabled} -> Status
+//	GET    /api/schedules/tasks            -> [Task]
+//	GET    /api/schedules/{id}             -> Status
+//	PUT    /api/schedules/{id} {name, task, cron, params, enabled} -> Status
+//	DELETE /api/schedules/{id}
+//	POST   /api/schedules/{id}/run         -> Status
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/schedules", handleSchedules)
+	mux.HandleFunc("/api/schedules/tasks", handleTasks)
+	mux.HandleFunc("/api/schedules/", handleSchedule)
+}
+
+func handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := defaultManager.List()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var s Schedule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		st, err := defaultManager.Create(s)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Tasks())
+}
+
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/schedules/"), "/")
+	var st *Status
+	var err error
+	switch {
+	case action == "run" && r.Method == http.MethodPost:
+		st, err = defaultManager.RunNow(id)
+	case action != "":
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	case r.Method == http.MethodGet:
+		st, err = defaultManager.Get(id)
+	case r.Method == http.MethodPut:
+		var s Schedule
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		st, err = defaultManager.Update(id, s)
+	case r.Method == http.MethodDelete:
+		if err := defaultManager.Delete(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// writeError maps manager errors to statuses; the rest are invalid input.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrRunning):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,439 @@
+// Package scheduler runs the server's recurring maintenance: built-in tasks
+// (see tasks.go) on 5-field UTC cron expressions persisted in
+// schedules.json. Unlike package crontasks it runs no user commands.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/crontasks"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/logging"
+)
+
+// tickInterval is how often due schedules are looked for; cron has minute
+// resolution.
+const tickInterval = 15 * time.Second
+
+var log = logging.New("scheduler")
+
+var (
+	ErrNotFound = errors.New("schedule not found")
+	ErrRunning  = errors.New("schedule is already running")
+)
+
+// Schedule runs Task with Params whenever Cron matches.
+type Schedule struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Task      string            `json:"task"`
+	Cron      string            `json:"cron"`
+	Params    map[string]string `json:"params,omitempty"`
+	Enabled   bool              `json:"enabled"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	LastRun   *Run              `json:"last_run,omitempty"`
+}
+
+// Run is the outcome of one run of a schedule.
+type Run struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Output     string    `json:"output,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status is a schedule as listed by the API.
+type Status struct {
+	Schedule
+	Running   bool       `json:"running"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+}
+
+type store struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// defaultSchedules are written when schedules.json does not exist yet. The
+// enabled ones replace loops that used to run unconditionally.
+var defaultSchedules = []Schedule{
+	{ID: "disk-cleanup", Name: "Clean up stale uploads", Task: "disk-cleanup", Cron: "*/5 * * * *", Enabled: true},
+	{ID: "restart-tunnels", Name: "Restart unhealthy tunnels", Task: "restart-tunnels", Cron: "* * * * *", Enabled: true},
+	{ID: "git-fetch", Name: "Fetch all projects", Task: "git-fetch", Cron: "0 * * * *"},
+	{ID: "prune-checkpoints", Name: "Prune old checkpoints", Task: "prune-checkpoints", Cron: "0 3 * * *"},
+	{ID: "prune-session-checkpoints", Name: "Apply checkpoint retention", Task: "prune-session-checkpoints", Cron: "15 * * * *", Enabled: true},
+}
+
+// Manager owns the schedules and runs them while started.
+type Manager struct {
+	file *jsonfile.JSONFile[store]
+	now  func() time.Time
+
+	mu      sync.Mutex
+	loaded  bool
+	next    map[string]time.Time
+	running map[string]context.CancelFunc
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewManager creates a manager persisting to path.
+func NewManager(path string) *Manager {
+	return &Manager{
+		file:    jsonfile.New[store](path),
+		now:     time.Now,
+		next:    make(map[string]time.Time),
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+var defaultManager = NewManager(config.SchedulesFile)
+
+// Start starts the default manager.
+func Start() { defaultManager.Start() }
+
+// Stop stops the default manager, cancelling running tasks.
+func Stop() { defaultManager.Stop() }
+
+// Start begins looking for due schedules every tickInterval.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+		m.tick()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				m.tick()
+			}
+		}
+	}()
+}
+
+// Stop ends the tick loop, cancels running tasks and waits for them.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	for _, cancel := range m.running {
+		cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// load seeds the defaults on first use of the file.
+func (m *Manager) load() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loaded {
+		return
+	}
+	m.loaded = true
+	if m.file.Exists() {
+		return
+	}
+	now := m.now().UTC()
+	seed := make([]Schedule, len(defaultSchedules))
+	for i, s := range defaultSchedules {
+		s.CreatedAt, s.UpdatedAt = now, now
+		seed[i] = s
+	}
+	if err := m.file.Set(store{Schedules: seed}); err != nil {
+		log.Errorf("seed schedules: %v", err)
+	}
+}
+
+func (m *Manager) schedules() ([]Schedule, error) {
+	m.load()
+	data, err := m.file.Get()
+	if err != nil {
+		return nil, err
+	}
+	return data.Schedules, nil
+}
+
+// tick starts every enabled schedule that is due and not running. A
+// schedule's first run is at its first cron match after it is seen.
+func (m *Manager) tick() {
+	list, err := m.schedules()
+	if err != nil {
+		log.Errorf("load schedules: %v", err)
+		return
+	}
+	now := m.now()
+	for _, s := range list {
+		if !s.Enabled {
+			continue
+		}
+		m.mu.Lock()
+		next, ok := m.next[s.ID]
+		m.mu.Unlock()
+		if !ok || !now.Before(next) {
+			if ok {
+				if err := m.start(s); err != nil && !errors.Is(err, ErrRunning) {
+					log.Errorf("start %s: %v", s.ID, err)
+				}
+			}
+			m.setNext(s, now)
+		}
+	}
+}
+
+func (m *Manager) setNext(s Schedule, from time.Time) {
+	next, err := crontasks.NextCron(s.Cron, from)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		delete(m.next, s.ID)
+		return
+	}
+	m.next[s.ID] = next
+}
+
+// start runs s in the background unless it is running.
+func (m *Manager) start(s Schedule) error {
+	task, ok := tasks[s.Task]
+	if !ok {
+		return fmt.Errorf("unknown task %q", s.Task)
+	}
+	m.mu.Lock()
+	if _, running := m.running[s.ID]; running {
+		m.mu.Unlock()
+		return ErrRunning
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), task.Timeout)
+	m.running[s.ID] = cancel
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		run := &Run{StartedAt: m.now().UTC()}
+		out, err := runTask(ctx, task, s.Params)
+		run.FinishedAt = m.now().UTC()
+		run.Output = out
+		if err != nil {
+			run.Error = err.Error()
+			log.Warnf("%s (%s) failed: %v", s.ID, s.Task, err)
+		} else {
+			log.Infof("%s (%s): %s", s.ID, s.Task, out)
+		}
+
+		m.mu.Lock()
+		delete(m.running, s.ID)
+		m.mu.Unlock()
+		err = m.file.Update(func(data *store) error {
+			if i := indexOf(data.Schedules, s.ID); i >= 0 {
+				data.Schedules[i].LastRun = run
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("save run of %s: %v", s.ID, err)
+		}
+	}()
+	return nil
+}
+
+func runTask(ctx context.Context, task *Task, params map[string]string) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return task.Run(ctx, taskParams(task, params))
+}
+
+func indexOf(list []Schedule, id string) int {
+	for i, s := range list {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Manager) status(s Schedule) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{Schedule: s}
+	_, st.Running = m.running[s.ID]
+	if next, ok := m.next[s.ID]; ok && s.Enabled {
+		st.NextRunAt = &next
+	} else if s.Enabled {
+		if next, err := crontasks.NextCron(s.Cron, m.now()); err == nil {
+			st.NextRunAt = &next
+		}
+	}
+	return st
+}
+
+// List returns all schedules.
+func (m *Manager) List() ([]Status, error) {
+	list, err := m.schedules()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(list))
+	for _, s := range list {
+		out = append(out, m.status(s))
+	}
+	return out, nil
+}
+
+// Get returns a schedule by ID.
+func (m *Manager) Get(id string) (*Status, error) {
+	list, err := m.schedules()
+	if err != nil {
+		return nil, err
+	}
+	i := indexOf(list, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	st := m.status(list[i])
+	return &st, nil
+}
+
+// validate normalizes s and checks its task, cron and params.
+func validate(s *Schedule) error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Cron = strings.Join(strings.Fields(s.Cron), " ")
+	task, ok := tasks[s.Task]
+	if !ok {
+		return fmt.Errorf("unknown task %q, want one of %s", s.Task, strings.Join(taskNames(), ", "))
+	}
+	if s.Name == "" {
+		s.Name = task.Name
+	}
+	if _, err := crontasks.NextCron(s.Cron, time.Now()); err != nil {
+		return fmt.Errorf("invalid cron %q: %v", s.Cron, err)
+	}
+	for k := range s.Params {
+		if _, ok := task.Params[k]; !ok {
+			return fmt.Errorf("task %s has no param %q", s.Task, k)
+		}
+	}
+	return nil
+}
+
+// Create adds a schedule; the ID is generated.
+func (m *Manager) Create(s Schedule) (*Status, error) {
+	if err := validate(&s); err != nil {
+		return nil, err
+	}
+	m.load()
+	now := m.now().UTC()
+	s.ID = fmt.Sprintf("%s-%d", s.Task, now.UnixNano())
+	s.CreatedAt, s.UpdatedAt, s.LastRun = now, now, nil
+	err := m.file.Update(func(data *store) error {
+		data.Schedules = append(data.Schedules, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	st := m.status(s)
+	return &st, nil
+}
+
+// Update replaces the name, task, cron, params and enabled flag of a
+// schedule. Its next run is recomputed.
+func (m *Manager) Update(id string, s Schedule) (*Status, error) {
+	if err := validate(&s); err != nil {
+		return nil, err
+	}
+	m.load()
+	var updated Schedule
+	err := m.file.Update(func(data *store) error {
+		i := indexOf(data.Schedules, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+		cur := &data.Schedules[i]
+		cur.Name, cur.Task, cur.Cron, cur.Params, cur.Enabled = s.Name, s.Task, s.Cron, s.Params, s.Enabled
+		cur.UpdatedAt = m.now().UTC()
+		updated = *cur
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	delete(m.next, id)
+	m.mu.Unlock()
+	st := m.status(updated)
+	return &st, nil
+}
+
+// Delete removes a schedule, cancelling its run if any.
+func (m *Manager) Delete(id string) error {
+	m.load()
+	err := m.file.Update(func(data *store) error {
+		i := indexOf(data.Schedules, id)
+		if i < 0 {
+			return ErrNotFound
+		}
+		// a new slice: lists returned by Get share the old one
+		data.Schedules = append(append([]Schedule{}, data.Schedules[:i]...), data.Schedules[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.next, id)
+	if cancel, ok := m.running[id]; ok {
+		cancel()
+	}
+	return nil
+}
+
+// RunNow starts a schedule immediately, whether or not it is enabled.
+func (m *Manager) RunNow(id string) (*Status, error) {
+	list, err := m.schedules()
+	if err != nil {
+		return nil, err
+	}
+	i := indexOf(list, id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	if err := m.start(list[i]); err != nil {
+		return nil, err
+	}
+	st := m.status(list[i])
+	return &st, nil
+}
+
+func taskNames() []string {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testManager returns a manager on a temp file whose clock is *now, with a
+// "test" task counting its runs and a "slow" one waiting out its timeout.
+func testManager(t *testing.T) (m *Manager, now *time.Time, runs *atomic.Int32) {
+	runs = new(atomic.Int32)
+	tasks["test"] = &Task{Name: "test", Params: map[string]string{"msg": "hi"}, Timeout: time.Minute, Run: func(ctx context.Context, p map[string]string) (string, error) {
+		runs.Add(1)
+		return p["msg"], nil
+	}}
+	tasks["slow"] = &Task{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context, p map[string]string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}}
+	t.Cleanup(func() {
+		delete(tasks, "test")
+		delete(tasks, "slow")
+	})
+
+	now = new(time.Time)
+	*now = time.Date(2026, 5, 1, 10, 0, 30, 0, time.UTC)
+	m = NewManager(filepath.Join(t.TempDir(), "schedules.json"))
+	m.now = func() time.Time { return *now }
+	t.Cleanup(m.Stop)
+	return m, now, runs
+}
+
+func TestDefaults(t *testing.T) {
+	m, _, _ := testManager(t)
+	list, err := m.List()
+	if err != nil || len(list) != len(defaultSchedules) {
+		t.Fatalf("list = %v, %v", list, err)
+	}
+	for _, s := range list {
+		if _, ok := tasks[s.Task]; !ok {
+			t.Errorf("default %s has unknown task %s", s.ID, s.Task)
+		}
+		if s.Enabled != (s.NextRunAt != nil) {
+			t.Errorf("default %s: enabled %v, next %v", s.ID, s.Enabled, s.NextRunAt)
+		}
+	}
+
+	// deleted defaults stay deleted
+	if err := m.Delete("git-fetch"); err != nil {
+		t.Fatal(err)
+	}
+	again := NewManager(m.file.GetPath())
+	if list, _ := again.List(); len(list) != len(defaultSchedules)-1 {
+		t.Errorf("reloaded %d schedules", len(list))
+	}
+}
+
+func TestTick(t *testing.T) {
+	m, now, runs := testManager(t)
+	s, err := m.Create(Schedule{Task: "test", Cron: "*/2 * * * *", Params: map[string]string{"msg": "hello"}, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name == "" || s.NextRunAt == nil || !s.NextRunAt.Equal(time.Date(2026, 5, 1, 10, 2, 0, 0, time.UTC)) {
+		t.Fatalf("created %+v", s)
+	}
+
+	m.tick() // first sight: nothing is due
+	*now = now.Add(time.Minute)
+	m.tick()
+	m.wg.Wait()
+	if runs.Load() != 0 {
+		t.Fatalf("ran before 10:02: %d", runs.Load())
+	}
+	*now = now.Add(time.Minute)
+	m.tick()
+	m.wg.Wait()
+	m.tick() // not due again until 10:04
+	m.wg.Wait()
+	if runs.Load() != 1 {
+		t.Fatalf("runs = %d", runs.Load())
+	}
+	got, _ := m.Get(s.ID)
+	if got.LastRun == nil || got.LastRun.Output != "hello" || got.LastRun.Error != "" || !got.NextRunAt.Equal(time.Date(2026, 5, 1, 10, 4, 0, 0, time.UTC)) {
+		t.Errorf("after run %+v %+v", got, got.LastRun)
+	}
+
+	// disabled schedules only run on demand
+	if _, err := m.Update(s.ID, Schedule{Task: "test", Cron: "* * * * *"}); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(time.Hour)
+	m.tick()
+	m.tick()
+	m.wg.Wait()
+	if runs.Load() != 1 {
+		t.Errorf("disabled schedule ran: %d", runs.Load())
+	}
+	if _, err := m.RunNow(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	m.wg.Wait()
+	if got, _ := m.Get(s.ID); runs.Load() != 2 || got.LastRun.Output != "hi" {
+		t.Errorf("run now: %d %+v", runs.Load(), got.LastRun)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	m, _, _ := testManager(t)
+	s, err := m.Create(Schedule{Task: "slow", Cron: "0 0 * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RunNow(s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.RunNow(s.ID); err != ErrRunning {
+		t.Errorf("overlapping run: %v", err)
+	}
+	m.wg.Wait()
+	if got, _ := m.Get(s.ID); got.Running || got.LastRun == nil || !strings.Contains(got.LastRun.Error, "deadline") {
+		t.Errorf("after timeout %+v %+v", got, got.LastRun)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m, _, _ := testManager(t)
+	for _, s := range []Schedule{
+		{Task: "nope", Cron: "* * * * *"},
+		{Task: "test", Cron: "* * *"},
+		{Task: "test", Cron: "61 * * * *"},
+		{Task: "test", Cron: "* * * * *", Params: map[string]string{"other": "x"}},
+	} {
+		if _, err := m.Create(s); err == nil {
+			t.Errorf("%+v accepted", s)
+		}
+	}
+	if _, err := m.Update("nope", Schedule{Task: "test", Cron: "* * * * *"}); err != ErrNotFound {
+		t.Errorf("update unknown: %v", err)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	m, _, _ := testManager(t)
+	saved := defaultManager
+	defaultManager = m
+	t.Cleanup(func() { defaultManager = saved })
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/schedules", `{"name":"greet","task":"test","cron":"0 * * * *","enabled":true}`)
+	var s Status
+	json.Unmarshal(rec.Body.Bytes(), &s)
+	if rec.Code != http.StatusOK || s.ID == "" || s.NextRunAt == nil {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/schedules", `{"task":"test","cron":"bad"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad cron: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/schedules/tasks", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"git-fetch"`) {
+		t.Errorf("tasks: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, "/api/schedules/"+s.ID, `{"name":"greet","task":"test","cron":"30 * * * *"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"30 * * * *"`) {
+		t.Errorf("update: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/schedules/"+s.ID+"/run", ""); rec.Code != http.StatusOK {
+		t.Errorf("run: %d %s", rec.Code, rec.Body)
+	}
+	m.wg.Wait()
+	if rec := do(http.MethodGet, "/api/schedules/"+s.ID, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"output":"hi"`) {
+		t.Errorf("get: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/api/schedules/"+s.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/schedules/"+s.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted: %d", rec.Code)
+	}
+}
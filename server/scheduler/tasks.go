@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/checkpoint"
+	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+	"github.com/xhd2015/ai-critic/server/fileupload"
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// Task is a kind of maintenance a schedule can run. Tasks act on the
+// instance: the global project registry, the tunnel, the data directory.
+type Task struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Params are the accepted params and their defaults.
+	Params map[string]string `json:"params,omitempty"`
+	// Timeout bounds one run.
+	Timeout time.Duration `json:"-"`
+	// Run does the work and summarizes it in one line.
+	Run func(ctx context.Context, params map[string]string) (string, error) `json:"-"`
+}
+
+var tasks = map[string]*Task{
+	"git-fetch": {
+		Name:        "git-fetch",
+		Description: "Fetch all remotes of every project",
+		Timeout:     30 * time.Minute,
+		Run:         gitFetch,
+	},
+	"prune-checkpoints": {
+		Name:        "prune-checkpoints",
+		Description: "Remove all but the newest checkpoints of every project",
+		Params:      map[string]string{"keep_last": "20"},
+		Timeout:     10 * time.Minute,
+		Run:         pruneCheckpoints,
+	},
+	"prune-session-checkpoints": {
+		Name:        "prune-session-checkpoints",
+		Description: "Apply the checkpoint retention policy to the automatic checkpoints of every project",
+		Timeout:     10 * time.Minute,
+		Run:         pruneSessionCheckpoints,
+	},
+	"restart-tunnels": {
+		Name:        "restart-tunnels",
+		Description: "Restart the tunnel for mappings failing consecutive health checks",
+		Params:      map[string]string{"checks": "3", "interval": "10s"},
+		Timeout:     5 * time.Minute,
+		Run:         restartTunnels,
+	},
+	"disk-cleanup": {
+		Name:        "disk-cleanup",
+		Description: "Remove stale upload sessions and upload caches",
+		Timeout:     10 * time.Minute,
+		Run:         diskCleanup,
+	},
+}
+
+// Tasks returns the task types by name.
+func Tasks() []Task {
+	out := make([]Task, 0, len(tasks))
+	for _, name := range taskNames() {
+		out = append(out, *tasks[name])
+	}
+	return out
+}
+
+// taskParams returns the task's defaults overridden by params.
+func taskParams(task *Task, params map[string]string) map[string]string {
+	out := make(map[string]string, len(task.Params))
+	for k, v := range task.Params {
+		out[k] = v
+	}
+	for k, v := range params {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func gitFetch(ctx context.Context, _ map[string]string) (string, error) {
+	list, err := projects.List()
+	if err != nil {
+		return "", err
+	}
+	var errs []error
+	fetched := 0
+	for _, p := range list {
+		if _, err := os.Stat(p.Dir + "/.git"); err != nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "git", "fetch", "--all", "--prune", "--quiet")
+		cmd.Dir = p.Dir
+		// never wait for credentials nobody will type
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v: %s", p.Name, err, strings.TrimSpace(string(out))))
+			continue
+		}
+		fetched++
+	}
+	return fmt.Sprintf("fetched %d of %d projects", fetched, len(list)), errors.Join(errs...)
+}
+
+func pruneCheckpoints(_ context.Context, params map[string]string) (string, error) {
+	keep, err := strconv.Atoi(params["keep_last"])
+	if err != nil || keep < 1 {
+		return "", fmt.Errorf("keep_last must be a positive number, got %q", params["keep_last"])
+	}
+	list, err := projects.List()
+	if err != nil {
+		return "", err
+	}
+	var errs []error
+	removed, freed := 0, int64(0)
+	for _, p := range list {
+		res, err := checkpoint.PruneCheckpoints(p.Name, checkpoint.PruneRequest{KeepLast: keep})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		removed += len(res.Removed)
+		freed += res.FreedBytes
+	}
+	return fmt.Sprintf("removed %d checkpoints, freed %d bytes", removed, freed), errors.Join(errs...)
+}
+
+func pruneSessionCheckpoints(_ context.Context, _ map[string]string) (string, error) {
+	list, err := projects.List()
+	if err != nil {
+		return "", err
+	}
+	var errs []error
+	removed, freed := 0, int64(0)
+	for _, p := range list {
+		res, err := checkpoint.PruneSessionCheckpoints(p.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		removed += len(res.Removed)
+		freed += res.FreedBytes
+	}
+	return fmt.Sprintf("removed %d checkpoints, freed %d bytes", removed, freed), errors.Join(errs...)
+}
+
+func restartTunnels(ctx context.Context, params map[string]string) (string, error) {
+	checks, err := strconv.Atoi(params["checks"])
+	if err != nil || checks < 1 {
+		return "", fmt.Errorf("checks must be a positive number, got %q", params["checks"])
+	}
+	interval, err := time.ParseDuration(params["interval"])
+	if err != nil {
+		return "", fmt.Errorf("invalid interval: %v", err)
+	}
+	restarted, err := unified_tunnel.RestartUnhealthyMappings(ctx, checks, interval)
+	if len(restarted) == 0 {
+		return "no mapping restarted", err
+	}
+	sort.Strings(restarted)
+	return "restarted " + strings.Join(restarted, ", "), err
+}
+
+func diskCleanup(context.Context, map[string]string) (string, error) {
+	fileupload.CleanupStale()
+	return "removed stale uploads", nil
+}
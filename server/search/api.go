@@ -0,0 +1,91 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/projects"
+)
+
+// searchTimeout bounds one request; symbol indexing of a large repo is the
+// slow case.
+const searchTimeout = 60 * time.Second
+
+// RegisterAPI registers the search endpoint:
+//
+//	GET /api/search?dir=...&q=...&mode=text|symbol
+//	    text:   &regex=true&case=smart|sensitive|insensitive&include=*.go,src/**&exclude=vendor
+//	            &context=N&offset=N&limit=N&engine=auto|rg|go       -> Results
+//	    symbol: &offset=N&limit=N&engine=auto|ctags|gopls|go        -> SymbolResults
+//
+// include and exclude may be repeated or comma-separated.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/search", handleSearch)
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	q := r.URL.Query()
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), searchTimeout)
+	defer cancel()
+
+	switch q.Get("mode") {
+	case "", "text":
+		contextLines, _ := strconv.Atoi(q.Get("context"))
+		res, err := Text(ctx, Options{
+			Dir:     projects.Dir(r.Context(), q.Get("dir")),
+			Query:   q.Get("q"),
+			Regex:   q.Get("regex") == "true",
+			Case:    q.Get("case"),
+			Include: splitList(q["include"]),
+			Exclude: splitList(q["exclude"]),
+			Context: contextLines,
+			Offset:  offset,
+			Limit:   limit,
+			Engine:  q.Get("engine"),
+		})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	case "symbol":
+		res, err := Symbols(ctx, projects.Dir(r.Context(), q.Get("dir")), q.Get("q"), q.Get("engine"), offset, limit)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be text or symbol"})
+	}
+}
+
+// splitList flattens repeated and comma-separated query values.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
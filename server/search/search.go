@@ -0,0 +1,523 @@
+// Package search finds text and symbols in a project directory, so code can
+// be searched from the phone during review.
+//
+// Text search runs ripgrep when it is installed and otherwise a pure-Go
+// scanner with the same semantics: files ignored by git and hidden files
+// are skipped, as are binary and very large files. Results are sorted by
+// path and line so pages stay stable between requests.
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+)
+
+// Engines.
+const (
+	EngineAuto    = "auto"
+	EngineRipgrep = "rg"
+	EngineGo      = "go"
+)
+
+// Case modes. Smart is case-insensitive unless the query has an upper-case
+// letter, as in ripgrep's --smart-case.
+const (
+	CaseSmart       = "smart"
+	CaseSensitive   = "sensitive"
+	CaseInsensitive = "insensitive"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+	MaxContext   = 10
+	// MaxFileSize skips generated and data files; ripgrep gets the same limit.
+	MaxFileSize = 1 << 20
+	// MaxLineLength truncates long lines such as minified sources.
+	MaxLineLength = 500
+)
+
+// Options controls a text search.
+type Options struct {
+	Dir   string `json:"dir"`
+	Query string `json:"query"`
+	// Regex treats Query as a regular expression (RE2 syntax for the Go
+	// scanner, ripgrep's Rust syntax otherwise); else it is a literal.
+	Regex bool   `json:"regex,omitempty"`
+	Case  string `json:"case,omitempty"`
+	// Include and Exclude are globs: one without a slash matches a file or
+	// directory name anywhere, one with a slash matches the path from Dir;
+	// ** matches any number of directories.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Context is the number of lines before and after each match.
+	Context int    `json:"context,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+	Engine  string `json:"engine,omitempty"`
+}
+
+// Match is one matching line.
+type Match struct {
+	Path   string   `json:"path"` // slash-separated, relative to Dir
+	Line   int      `json:"line"`
+	Column int      `json:"column"` // 1-based byte column of the first match
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// Results is one page of matches.
+type Results struct {
+	Engine  string  `json:"engine"`
+	Matches []Match `json:"matches"`
+	Offset  int     `json:"offset"`
+	// NextOffset requests the following page; zero when this is the last.
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// Text searches opts.Dir for opts.Query.
+func Text(ctx context.Context, opts Options) (*Results, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	engine := opts.Engine
+	if engine == EngineAuto {
+		engine = EngineGo
+		if tool_resolve.IsAvailable("rg") {
+			engine = EngineRipgrep
+		}
+	}
+
+	// collect one past the page to learn whether there is a next one
+	want := opts.Offset + opts.Limit + 1
+	var matches []Match
+	var err error
+	switch engine {
+	case EngineRipgrep:
+		matches, err = ripgrep(ctx, opts, want)
+	case EngineGo:
+		matches, err = scan(ctx, opts, want)
+	default:
+		return nil, fmt.Errorf("unknown engine %q", opts.Engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Results{Engine: engine, Offset: opts.Offset, Matches: []Match{}}
+	if len(matches) > opts.Offset {
+		res.Matches = matches[opts.Offset:]
+	}
+	if len(res.Matches) > opts.Limit {
+		res.Matches = res.Matches[:opts.Limit]
+		res.NextOffset = opts.Offset + opts.Limit
+	}
+	if opts.Context > 0 {
+		addContext(opts.Dir, res.Matches, opts.Context)
+	}
+	return res, nil
+}
+
+func (o *Options) normalize() error {
+	if o.Dir == "" {
+		return fmt.Errorf("dir is required")
+	}
+	if o.Query == "" {
+		return fmt.Errorf("query is required")
+	}
+	info, err := os.Stat(o.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", o.Dir)
+	}
+	switch o.Case {
+	case "":
+		o.Case = CaseSmart
+	case CaseSmart, CaseSensitive, CaseInsensitive:
+	default:
+		return fmt.Errorf("case must be smart, sensitive or insensitive")
+	}
+	if o.Engine == "" {
+		o.Engine = EngineAuto
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultLimit
+	}
+	o.Limit = min(o.Limit, MaxLimit)
+	o.Offset = max(o.Offset, 0)
+	o.Context = min(max(o.Context, 0), MaxContext)
+	return nil
+}
+
+// ignoreCase resolves the case mode for query.
+func (o *Options) ignoreCase() bool {
+	switch o.Case {
+	case CaseSensitive:
+		return false
+	case CaseInsensitive:
+		return true
+	}
+	return !strings.ContainsFunc(o.Query, unicode.IsUpper)
+}
+
+// ripgrep runs rg and returns up to want matches sorted by path.
+func ripgrep(ctx context.Context, opts Options, want int) ([]Match, error) {
+	rg, err := tool_resolve.LookPath("rg")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--json", "--sort", "path", "--no-messages", "--max-filesize", fmt.Sprint(MaxFileSize)}
+	if !opts.Regex {
+		args = append(args, "--fixed-strings")
+	}
+	if opts.ignoreCase() {
+		args = append(args, "--ignore-case")
+	} else {
+		args = append(args, "--case-sensitive")
+	}
+	for _, g := range opts.Include {
+		args = append(args, "--glob", g)
+	}
+	for _, g := range opts.Exclude {
+		args = append(args, "--glob", "!"+g)
+	}
+	args = append(args, "--regexp", opts.Query, "--", ".")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, rg, args...)
+	cmd.Dir = opts.Dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	for len(matches) < want && sc.Scan() {
+		var ev rgEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || ev.Type != "match" {
+			continue
+		}
+		m := Match{
+			Path: strings.TrimPrefix(filepath.ToSlash(ev.Data.Path.Text), "./"),
+			Line: ev.Data.LineNumber,
+			Text: truncateLine(strings.TrimRight(ev.Data.Lines.Text, "\r\n")),
+		}
+		if len(ev.Data.Submatches) > 0 {
+			m.Column = ev.Data.Submatches[0].Start + 1
+		}
+		matches = append(matches, m)
+	}
+	done := len(matches) >= want
+	if done {
+		cancel() // stop rg once the page is full
+	}
+	io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+
+	if done {
+		return matches, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		switch exitErr.ExitCode() {
+		case 1: // no matches
+			return matches, nil
+		case 2: // errors, possibly alongside matches (unreadable files)
+			if len(matches) > 0 {
+				return matches, nil
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("rg: %s", msg)
+			}
+			return nil, fmt.Errorf("rg: %v", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rg: %v", err)
+	}
+	return matches, nil
+}
+
+// rgEvent is the part of a ripgrep --json message used here.
+type rgEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Path struct {
+			Text string `json:"text"`
+		} `json:"path"`
+		Lines struct {
+			Text string `json:"text"`
+		} `json:"lines"`
+		LineNumber int `json:"line_number"`
+		Submatches []struct {
+			Start int `json:"start"`
+		} `json:"submatches"`
+	} `json:"data"`
+}
+
+// scan is the pure-Go engine, used when ripgrep is not installed.
+func scan(ctx context.Context, opts Options, want int) ([]Match, error) {
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.ignoreCase() {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	files, err := listFiles(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !globsAllow(rel, opts.Include, opts.Exclude) {
+			continue
+		}
+		data, ok := readText(filepath.Join(opts.Dir, filepath.FromSlash(rel)))
+		if !ok {
+			continue
+		}
+		for i, line := range splitLines(data) {
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			matches = append(matches, Match{Path: rel, Line: i + 1, Column: loc[0] + 1, Text: truncateLine(line)})
+			if len(matches) >= want {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// listFiles returns the searchable files under dir, slash-separated and
+// sorted. Inside a git work tree these are the tracked and untracked but not
+// ignored files; elsewhere all files outside hidden directories.
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	if gitrunner.IsRepo(dir) {
+		out, err := gitrunner.NewCommand("ls-files", "--cached", "--others", "--exclude-standard", "-z").Dir(dir).Output()
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, rel := range strings.Split(string(out), "\x00") {
+			if rel == "" || seen[rel] || isHidden(rel) {
+				continue
+			}
+			seen[rel] = true
+			files = append(files, rel)
+		}
+	} else {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // unreadable entries are skipped, as rg does
+			}
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isHidden reports whether any component of a slash-separated path starts
+// with a dot; ripgrep skips those by default.
+func isHidden(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// readText reads a file for searching; ok is false for large, unreadable or
+// binary files.
+func readText(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > MaxFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	// a NUL byte near the start marks a binary file, as in git and ripgrep
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", false
+	}
+	return string(data), true
+}
+
+func splitLines(data string) []string {
+	data = strings.TrimSuffix(data, "\n")
+	if data == "" {
+		return nil
+	}
+	lines := strings.Split(data, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+func truncateLine(line string) string {
+	if len(line) <= MaxLineLength {
+		return line
+	}
+	cut := MaxLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut]
+}
+
+// addContext fills Before and After of each match, reading each file once.
+func addContext(dir string, matches []Match, n int) {
+	var path string
+	var lines []string
+	for i := range matches {
+		m := &matches[i]
+		if m.Path != path {
+			path = m.Path
+			data, _ := readText(filepath.Join(dir, filepath.FromSlash(path)))
+			lines = splitLines(data)
+		}
+		if m.Line < 1 || m.Line > len(lines) {
+			continue
+		}
+		for l := max(m.Line-n, 1); l < m.Line; l++ {
+			m.Before = append(m.Before, truncateLine(lines[l-1]))
+		}
+		for l := m.Line + 1; l <= min(m.Line+n, len(lines)); l++ {
+			m.After = append(m.After, truncateLine(lines[l-1]))
+		}
+	}
+}
+
+// globsAllow applies include and exclude globs to a slash-separated path
+// the way ripgrep's --glob does: excludes win, and with any include the path
+// must match one.
+func globsAllow(rel string, include, exclude []string) bool {
+	for _, g := range exclude {
+		if globMatch(g, rel, true) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, g := range include {
+		if globMatch(g, rel, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches a glob against rel. A glob without a slash matches the
+// base name, or with anyComponent any directory name too (so excluding
+// "vendor" drops everything below it).
+func globMatch(glob, rel string, anyComponent bool) bool {
+	glob = strings.TrimPrefix(glob, "/")
+	if !strings.Contains(glob, "/") {
+		parts := strings.Split(rel, "/")
+		if !anyComponent {
+			parts = parts[len(parts)-1:]
+		}
+		for _, part := range parts {
+			if ok, _ := filepath.Match(glob, part); ok {
+				return true
+			}
+		}
+		return false
+	}
+	re, err := regexp.Compile(globToRegexp(glob))
+	if err != nil {
+		return false
+	}
+	return re.MatchString(rel)
+}
+
+// globToRegexp translates a path glob with ** into an anchored regexp that
+// also matches everything below a matching directory.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return b.String()
+}
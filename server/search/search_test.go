@@ -0,0 +1,132 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func locations(matches []Match) []string {
+	out := []string{}
+	for _, m := range matches {
+		out = append(out, fmt.Sprintf("%s:%d:%d", m.Path, m.Line, m.Column))
+	}
+	return out
+}
+
+func TestTextGoEngine(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"main.go":           "package main\n\nfunc main() {\n\tHandleRequest()\n}\n",
+		"handler.go":        "package main\n\n// handleRequest serves\nfunc HandleRequest() {}\n",
+		"vendor/lib/lib.go": "package lib // HandleRequest\n",
+		".hidden/x.go":      "HandleRequest\n",
+		"web/app.ts":        "export const handleRequest = 1\n",
+		"bin.dat":           "HandleRequest\x00\x01",
+	})
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"smart case insensitive", Options{Query: "handlerequest"}, []string{"handler.go:3:4", "handler.go:4:6", "main.go:4:2", "vendor/lib/lib.go:1:16", "web/app.ts:1:14"}},
+		{"smart case sensitive", Options{Query: "handleRequest"}, []string{"handler.go:3:4", "web/app.ts:1:14"}},
+		{"include", Options{Query: "HandleRequest", Include: []string{"*.go"}, Case: CaseSensitive}, []string{"handler.go:4:6", "main.go:4:2", "vendor/lib/lib.go:1:16"}},
+		{"exclude dir", Options{Query: "HandleRequest", Exclude: []string{"vendor"}, Case: CaseSensitive}, []string{"handler.go:4:6", "main.go:4:2"}},
+		{"include path glob", Options{Query: "request", Include: []string{"web/**"}}, []string{"web/app.ts:1:20"}},
+		{"regex", Options{Query: `^func \w+\(`, Regex: true}, []string{"handler.go:4:1", "main.go:3:1"}},
+		{"literal", Options{Query: `main()`}, []string{"main.go:3:6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Dir = dir
+			tt.opts.Engine = EngineGo
+			res, err := Text(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := locations(res.Matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextPaginationAndContext(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "x1\nx2\nskip\nx3\nx4\n"})
+	opts := Options{Dir: dir, Query: "x", Limit: 3, Context: 1, Engine: EngineGo}
+	res, err := Text(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 3 || res.NextOffset != 3 {
+		t.Fatalf("page 1: %d matches, next %d", len(res.Matches), res.NextOffset)
+	}
+	if m := res.Matches[2]; m.Text != "x3" || !reflect.DeepEqual(m.Before, []string{"skip"}) || !reflect.DeepEqual(m.After, []string{"x4"}) {
+		t.Errorf("context = %+v", m)
+	}
+	opts.Offset = res.NextOffset
+	res, err = Text(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 || res.Matches[0].Text != "x4" || res.NextOffset != 0 {
+		t.Errorf("page 2: %+v", res)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		glob, path   string
+		anyComponent bool
+		want         bool
+	}{
+		{"*.go", "a/b/c.go", false, true},
+		{"*.go", "a/b/c.ts", false, false},
+		{"vendor", "vendor/x/y.go", true, true},
+		{"vendor", "vendor/x/y.go", false, false},
+		{"src/**", "src/a/b.ts", false, true},
+		{"src/*.ts", "src/a/b.ts", false, false},
+		{"**/testdata", "pkg/x/testdata/in.txt", true, true},
+		{"/docs/*.md", "docs/a.md", false, true},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.glob, tt.path, tt.anyComponent); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolsGoEngine(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"server.go": "package s\n\ntype Server struct{}\n\nfunc NewServer() *Server { return nil }\n\nfunc (s *Server) Serve() {}\n\nconst serverPort = 1\n",
+	})
+	res, err := Symbols(context.Background(), dir, "serve", EngineGo, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Symbol{
+		{Name: "Serve", Kind: "method", Path: "server.go", Line: 7, Container: "Server"},
+		{Name: "Server", Kind: "type", Path: "server.go", Line: 3},
+		{Name: "serverPort", Kind: "const", Path: "server.go", Line: 9},
+		{Name: "NewServer", Kind: "func", Path: "server.go", Line: 5},
+	}
+	if !reflect.DeepEqual(res.Symbols, want) {
+		t.Errorf("symbols = %+v", res.Symbols)
+	}
+}
@@ -0,0 +1,356 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+)
+
+// Symbol engines. Ctags indexes every language it knows; gopls answers
+// workspace symbol queries for Go modules; the built-in Go parser is the
+// fallback when neither tool is installed.
+const (
+	EngineCtags = "ctags"
+	EngineGopls = "gopls"
+)
+
+// indexTTL is how long a ctags or Go-parser index of a directory is reused,
+// so typing a query does not re-index the project on every keystroke.
+const indexTTL = 30 * time.Second
+
+// Symbol is a named declaration.
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Path      string `json:"path"` // slash-separated, relative to the searched dir
+	Line      int    `json:"line"`
+	Container string `json:"container,omitempty"` // e.g. the receiver type of a method
+}
+
+// SymbolResults is one page of symbols.
+type SymbolResults struct {
+	Engine     string   `json:"engine"`
+	Symbols    []Symbol `json:"symbols"`
+	Offset     int      `json:"offset"`
+	NextOffset int      `json:"next_offset,omitempty"`
+}
+
+// Symbols searches the declarations in dir whose names contain query,
+// case-insensitively. Exact matches come first, then prefixes, then the rest.
+func Symbols(ctx context.Context, dir, query, engine string, offset, limit int) (*SymbolResults, error) {
+	opts := Options{Dir: dir, Query: query, Offset: offset, Limit: limit, Engine: engine}
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+
+	var syms []Symbol
+	var err error
+	switch opts.Engine {
+	case EngineAuto:
+		engine = EngineGo
+		if tool_resolve.IsAvailable("ctags") {
+			if syms, err = indexed(ctx, dir, EngineCtags); err == nil {
+				engine = EngineCtags
+				break
+			}
+		}
+		if tool_resolve.IsAvailable("gopls") && isGoModule(dir) {
+			if syms, err = gopls(ctx, dir, query); err == nil {
+				engine = EngineGopls
+				break
+			}
+		}
+		syms, err = indexed(ctx, dir, EngineGo)
+	case EngineCtags, EngineGo:
+		engine = opts.Engine
+		syms, err = indexed(ctx, dir, engine)
+	case EngineGopls:
+		engine = opts.Engine
+		syms, err = gopls(ctx, dir, query)
+	default:
+		return nil, fmt.Errorf("unknown engine %q", opts.Engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if engine != EngineGopls {
+		// gopls has already matched and ranked
+		syms = rankSymbols(syms, query)
+	}
+
+	res := &SymbolResults{Engine: engine, Offset: opts.Offset, Symbols: []Symbol{}}
+	if len(syms) > opts.Offset {
+		res.Symbols = syms[opts.Offset:]
+	}
+	if len(res.Symbols) > opts.Limit {
+		res.Symbols = res.Symbols[:opts.Limit]
+		res.NextOffset = opts.Offset + opts.Limit
+	}
+	return res, nil
+}
+
+// rankSymbols keeps the symbols whose name contains query and orders them.
+func rankSymbols(syms []Symbol, query string) []Symbol {
+	q := strings.ToLower(query)
+	type ranked struct {
+		Symbol
+		rank int
+	}
+	var hits []ranked
+	for _, s := range syms {
+		name := strings.ToLower(s.Name)
+		switch {
+		case name == q:
+			hits = append(hits, ranked{s, 0})
+		case strings.HasPrefix(name, q):
+			hits = append(hits, ranked{s, 1})
+		case strings.Contains(name, q):
+			hits = append(hits, ranked{s, 2})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if len(a.Name) != len(b.Name) {
+			return len(a.Name) < len(b.Name)
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	out := make([]Symbol, len(hits))
+	for i, h := range hits {
+		out[i] = h.Symbol
+	}
+	return out
+}
+
+type indexEntry struct {
+	symbols []Symbol
+	builtAt time.Time
+}
+
+var (
+	indexMu    sync.Mutex
+	indexCache = make(map[string]indexEntry) // engine + "\x00" + dir
+)
+
+// indexed returns all symbols of dir from the ctags or Go-parser index,
+// rebuilding it when older than indexTTL.
+func indexed(ctx context.Context, dir, engine string) ([]Symbol, error) {
+	key := engine + "\x00" + filepath.Clean(dir)
+	indexMu.Lock()
+	e, ok := indexCache[key]
+	indexMu.Unlock()
+	if ok && time.Since(e.builtAt) < indexTTL {
+		return e.symbols, nil
+	}
+
+	var syms []Symbol
+	var err error
+	if engine == EngineCtags {
+		syms, err = ctags(ctx, dir)
+	} else {
+		syms, err = goSymbols(ctx, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	indexMu.Lock()
+	indexCache[key] = indexEntry{symbols: syms, builtAt: time.Now()}
+	indexMu.Unlock()
+	return syms, nil
+}
+
+// ctags indexes dir with Universal Ctags' JSON output. Exuberant Ctags has
+// no JSON output and fails here, which makes the caller fall back.
+func ctags(ctx context.Context, dir string) ([]Symbol, error) {
+	bin, err := tool_resolve.LookPath("ctags")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, bin, "-R", "--output-format=json", "--fields=+nKZ",
+		"--exclude=.git", "--exclude=node_modules", "--exclude=vendor", "-f", "-", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ctags: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var syms []Symbol
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		var tag struct {
+			Type  string `json:"_type"`
+			Name  string `json:"name"`
+			Path  string `json:"path"`
+			Line  int    `json:"line"`
+			Kind  string `json:"kind"`
+			Scope string `json:"scope"`
+		}
+		if json.Unmarshal(sc.Bytes(), &tag) != nil || tag.Type != "tag" {
+			continue
+		}
+		syms = append(syms, Symbol{
+			Name:      tag.Name,
+			Kind:      tag.Kind,
+			Path:      strings.TrimPrefix(filepath.ToSlash(tag.Path), "./"),
+			Line:      tag.Line,
+			Container: tag.Scope,
+		})
+	}
+	return syms, nil
+}
+
+// goplsLine matches one line of `gopls workspace_symbol` output:
+// /abs/path/file.go:12:6-10 Name Kind
+var goplsLine = regexp.MustCompile(`^(.+):(\d+):\d+(?:-\d+)? (\S+) (\S+)$`)
+
+// gopls asks gopls for the workspace symbols matching query in the Go
+// module at dir.
+func gopls(ctx context.Context, dir, query string) ([]Symbol, error) {
+	bin, err := tool_resolve.LookPath("gopls")
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, bin, "workspace_symbol", "-matcher", "fuzzy", query)
+	cmd.Dir = dir
+	cmd.Env = tool_resolve.AppendExtraPaths(os.Environ())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gopls: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	absDir, _ := filepath.Abs(dir)
+	var syms []Symbol
+	for _, line := range strings.Split(string(out), "\n") {
+		m := goplsLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		path := m[1]
+		if rel, err := filepath.Rel(absDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		} else {
+			continue // symbols from dependencies
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		s := Symbol{Name: m[3], Kind: strings.ToLower(m[4]), Path: filepath.ToSlash(path), Line: lineNo}
+		// methods and fields are reported as Type.Name
+		if i := strings.LastIndexByte(s.Name, '.'); i > 0 {
+			s.Container, s.Name = s.Name[:i], s.Name[i+1:]
+		}
+		syms = append(syms, s)
+	}
+	return syms, nil
+}
+
+func isGoModule(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// goSymbols parses the Go files of dir for their top-level declarations.
+func goSymbols(ctx context.Context, dir string) ([]Symbol, error) {
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var syms []Symbol
+	fset := token.NewFileSet()
+	for _, rel := range files {
+		if !strings.HasSuffix(rel, ".go") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		src, ok := readText(filepath.Join(dir, filepath.FromSlash(rel)))
+		if !ok {
+			continue
+		}
+		f, err := parser.ParseFile(fset, rel, src, parser.SkipObjectResolution)
+		if f == nil {
+			continue
+		}
+		_ = err // a partial AST still has useful declarations
+		syms = append(syms, fileSymbols(fset, rel, f)...)
+	}
+	return syms, nil
+}
+
+func fileSymbols(fset *token.FileSet, rel string, f *ast.File) []Symbol {
+	var syms []Symbol
+	add := func(name *ast.Ident, kind, container string) {
+		if name == nil || name.Name == "_" {
+			return
+		}
+		syms = append(syms, Symbol{Name: name.Name, Kind: kind, Path: rel, Line: fset.Position(name.Pos()).Line, Container: container})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(d.Name, "func", "")
+				continue
+			}
+			add(d.Name, "method", receiverType(d.Recv.List[0].Type))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name, "type", "")
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						add(name, kind, "")
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// receiverType names the type of a method receiver: T for T, *T and T[P].
+func receiverType(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package selfupdate updates the server binary from the latest GitHub
+// release, as published by script/release: one binary per platform named
+// ai-critic-server-<os>-<arch>[.exe], and a SHA256SUMS file listing their
+// checksums. A download is only installed when its checksum matches.
+package selfupdate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Repo is the GitHub repository releases are published to.
+const Repo = "WiseWiseWiser/mobile-coding-connector"
+
+// ChecksumsAsset is the release asset listing the binaries' SHA-256 sums,
+// in the format of sha256sum.
+const ChecksumsAsset = "SHA256SUMS"
+
+// apiBase is the GitHub API, replaced in tests.
+var apiBase = "https://api.github.com"
+
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// AssetName is the release binary for a platform; it must agree with the
+// names script/release builds.
+func AssetName(goos, goarch string) string {
+	name := fmt.Sprintf("ai-critic-server-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Release is the latest release as it applies to this binary.
+type Release struct {
+	Tag         string    `json:"tag"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Asset       string    `json:"asset"`
+	AssetURL    string    `json:"-"`
+	SHA256      string    `json:"sha256"`
+	// Current reports that the running binary is the release's binary.
+	Current bool `json:"current"`
+}
+
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Check fetches the latest release and its checksum for this platform,
+// and compares it with the running binary.
+func Check(ctx context.Context) (*Release, error) {
+	var gh githubRelease
+	if err := getJSON(ctx, apiBase+"/repos/"+Repo+"/releases/latest", &gh); err != nil {
+		return nil, fmt.Errorf("fetch latest release: %w", err)
+	}
+	rel := &Release{
+		Tag:         gh.TagName,
+		URL:         gh.HTMLURL,
+		PublishedAt: gh.PublishedAt,
+		Asset:       AssetName(runtime.GOOS, runtime.GOARCH),
+	}
+	var sumsURL string
+	for _, a := range gh.Assets {
+		switch a.Name {
+		case rel.Asset:
+			rel.AssetURL = a.URL
+		case ChecksumsAsset:
+			sumsURL = a.URL
+		}
+	}
+	if rel.AssetURL == "" {
+		return nil, fmt.Errorf("release %s has no binary for %s/%s (%s)", rel.Tag, runtime.GOOS, runtime.GOARCH, rel.Asset)
+	}
+	if sumsURL == "" {
+		return nil, fmt.Errorf("release %s has no %s to verify the download with", rel.Tag, ChecksumsAsset)
+	}
+	sums, err := get(ctx, sumsURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", ChecksumsAsset, err)
+	}
+	defer sums.Close()
+	if rel.SHA256, err = findChecksum(sums, rel.Asset); err != nil {
+		return nil, err
+	}
+
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	current, err := fileSHA256(exe)
+	if err != nil {
+		return nil, err
+	}
+	rel.Current = current == rel.SHA256
+	return rel, nil
+}
+
+// Apply downloads the release binary, verifies its checksum and replaces
+// the running binary with it, returning the binary's path. The running
+// process is unaffected until it restarts.
+func Apply(ctx context.Context, rel *Release) (string, error) {
+	exe, err := executable()
+	if err != nil {
+		return "", err
+	}
+	body, err := get(ctx, rel.AssetURL)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", rel.Asset, err)
+	}
+	defer body.Close()
+
+	// download next to the binary, so the final rename stays on one
+	// file system and is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".update-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", rel.Asset, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != rel.SHA256 {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", rel.Asset, sum, rel.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+	if err := replace(tmp.Name(), exe); err != nil {
+		return "", err
+	}
+	return exe, nil
+}
+
+// replace renames src over dst. Windows cannot replace a running binary,
+// but can rename it, so the old binary is moved aside first.
+func replace(src, dst string) error {
+	if runtime.GOOS == "windows" {
+		old := dst + ".old"
+		os.Remove(old)
+		if err := os.Rename(dst, old); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			os.Rename(old, dst)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(src, dst)
+}
+
+// executable is the running binary, replaced in tests.
+var executable = func() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// findChecksum returns the sum of name from a sha256sum listing.
+func findChecksum(r io.Reader, name string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a * before the name
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			sum := strings.ToLower(fields[0])
+			if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+				return "", fmt.Errorf("%s: invalid checksum for %s", ChecksumsAsset, name)
+			}
+			return sum, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return do(req)
+}
+
+func do(req *http.Request) (io.ReadCloser, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	body, err := do(req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
@@ -0,0 +1,111 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeGitHub serves a latest release whose binary for this platform is
+// binary, listed in SHA256SUMS with sum.
+func fakeGitHub(t *testing.T, binary, sum string) {
+	t.Helper()
+	asset := AssetName(runtime.GOOS, runtime.GOARCH)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/" + Repo + "/releases/latest":
+			fmt.Fprintf(w, `{"tag_name":"v2","html_url":"https://example.com/v2","assets":[
+				{"name":%q,"browser_download_url":"%s/dl/bin"},
+				{"name":"SHA256SUMS","browser_download_url":"%s/dl/sums"}]}`, asset, srv.URL, srv.URL)
+		case "/dl/bin":
+			w.Write([]byte(binary))
+		case "/dl/sums":
+			fmt.Fprintf(w, "%s  other-binary\n%s *%s\n", strings.Repeat("0", 64), sum, asset)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	oldBase := apiBase
+	apiBase = srv.URL
+	t.Cleanup(func() { apiBase = oldBase })
+}
+
+// fakeExecutable makes the running binary a temp file holding content.
+func fakeExecutable(t *testing.T, content string) string {
+	t.Helper()
+	exe := filepath.Join(t.TempDir(), "ai-critic-server")
+	if err := os.WriteFile(exe, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := executable
+	executable = func() (string, error) { return exe, nil }
+	t.Cleanup(func() { executable = old })
+	return exe
+}
+
+func sha(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestCheckAndApply(t *testing.T) {
+	fakeGitHub(t, "new binary", sha("new binary"))
+	exe := fakeExecutable(t, "old binary")
+
+	rel, err := Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Tag != "v2" || rel.SHA256 != sha("new binary") || rel.Current {
+		t.Fatalf("release = %+v", rel)
+	}
+	path, err := Apply(context.Background(), rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); path != exe || string(data) != "new binary" {
+		t.Fatalf("installed %q at %s", data, path)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	if rel, err = Check(context.Background()); err != nil || !rel.Current {
+		t.Errorf("after update: %+v, %v", rel, err)
+	}
+}
+
+func TestApplyRejectsChecksumMismatch(t *testing.T) {
+	fakeGitHub(t, "tampered binary", sha("new binary"))
+	exe := fakeExecutable(t, "old binary")
+
+	rel, err := Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Apply(context.Background(), rel); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Apply err = %v, want checksum mismatch", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "old binary" {
+		t.Errorf("binary replaced with %q", data)
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	if _, err := findChecksum(strings.NewReader("abc  a\n"), "a"); err == nil {
+		t.Error("accepted a malformed checksum")
+	}
+	if _, err := findChecksum(strings.NewReader(sha("x")+"  a\n"), "b"); err == nil {
+		t.Error("found a checksum for a missing file")
+	}
+}
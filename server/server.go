@@ -25,48 +25,82 @@ import (
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/agent-pro/agent/streaming/sse"
 	"github.com/xhd2015/ai-critic/server/actions"
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/agentchanges"
 	"github.com/xhd2015/ai-critic/server/agents"
 	opencode_exposed "github.com/xhd2015/ai-critic/server/agents/opencode/exposed_opencode"
 	"github.com/xhd2015/ai-critic/server/agents/web/cursorweb"
 	customagentapi "github.com/xhd2015/ai-critic/server/api"
+	"github.com/xhd2015/ai-critic/server/aiusage"
+	"github.com/xhd2015/ai-critic/server/metrics"
+	"github.com/xhd2015/ai-critic/server/diagnostics"
+	"github.com/xhd2015/ai-critic/server/artifacts"
+	"github.com/xhd2015/ai-critic/server/audit"
 	"github.com/xhd2015/ai-critic/server/auth"
 	"github.com/xhd2015/ai-critic/server/checkpoint"
 	cloudflareSettings "github.com/xhd2015/ai-critic/server/cloudflare"
-	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+	"github.com/xhd2015/ai-critic/server/compress"
 	serverconfig "github.com/xhd2015/ai-critic/server/config"
 	"github.com/xhd2015/ai-critic/server/env"
+	"github.com/xhd2015/ai-critic/server/depupdate"
+	"github.com/xhd2015/ai-critic/server/databackup"
 	"github.com/xhd2015/ai-critic/server/domains"
+	"github.com/xhd2015/ai-critic/server/editor"
 	"github.com/xhd2015/ai-critic/server/encrypt"
+	"github.com/xhd2015/ai-critic/server/events"
 	serverexec "github.com/xhd2015/ai-critic/server/exec"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
 	"github.com/xhd2015/ai-critic/server/exposedurls"
 	"github.com/xhd2015/ai-critic/server/fakellm"
+	"github.com/xhd2015/ai-critic/server/faults"
 	"github.com/xhd2015/ai-critic/server/features"
 	"github.com/xhd2015/ai-critic/server/filetransfer"
 	"github.com/xhd2015/ai-critic/server/fileupload"
+	"github.com/xhd2015/ai-critic/server/firstrun"
 	servergit "github.com/xhd2015/ai-critic/server/git"
 	servermachineanalyse "github.com/xhd2015/ai-critic/server/machineanalyse"
 	servermachinebackup "github.com/xhd2015/ai-critic/server/machinebackup"
 	serverprojectpull "github.com/xhd2015/ai-critic/server/projectpull"
 	"github.com/xhd2015/ai-critic/server/github"
+	"github.com/xhd2015/ai-critic/server/handoff"
+	"github.com/xhd2015/ai-critic/server/help"
+	"github.com/xhd2015/ai-critic/server/jobs"
 	"github.com/xhd2015/ai-critic/server/keepalive"
 	"github.com/xhd2015/ai-critic/server/localiterm2"
+	"github.com/xhd2015/ai-critic/server/logging"
 	"github.com/xhd2015/ai-critic/server/logs"
+	"github.com/xhd2015/ai-critic/server/markdown"
+	"github.com/xhd2015/ai-critic/server/mcp"
+	"github.com/xhd2015/ai-critic/server/notifications"
 	openclawapi "github.com/xhd2015/ai-critic/server/openclaw"
 	"github.com/xhd2015/ai-critic/server/projects"
 	"github.com/xhd2015/ai-critic/server/proxy/portforward"
 	pfcloudflare "github.com/xhd2015/ai-critic/server/proxy/portforward/providers/cloudflare"
 	pflocaltunnel "github.com/xhd2015/ai-critic/server/proxy/portforward/providers/localtunnel"
+	pfngrok "github.com/xhd2015/ai-critic/server/proxy/portforward/providers/ngrok"
+	pftailscale "github.com/xhd2015/ai-critic/server/proxy/portforward/providers/tailscale"
 	"github.com/xhd2015/ai-critic/server/proxy/proxyconfig"
 	"github.com/xhd2015/ai-critic/server/proxy/wsproxy"
 	"github.com/xhd2015/ai-critic/server/quicktest"
 	"github.com/xhd2015/ai-critic/server/crontasks"
 	"github.com/xhd2015/ai-critic/server/services"
+	"github.com/xhd2015/ai-critic/server/scaffold"
+	"github.com/xhd2015/ai-critic/server/search"
 	"github.com/xhd2015/ai-critic/server/settings"
+	"github.com/xhd2015/ai-critic/server/share"
 	"github.com/xhd2015/ai-critic/server/startup"
 	"github.com/xhd2015/ai-critic/server/sshservers"
 	"github.com/xhd2015/ai-critic/server/subprocess"
 	"github.com/xhd2015/ai-critic/server/terminal"
+	"github.com/xhd2015/ai-critic/server/quota"
+	"github.com/xhd2015/ai-critic/server/reqtrace"
+	"github.com/xhd2015/ai-critic/server/restartstate"
+	"github.com/xhd2015/ai-critic/server/rules"
+	"github.com/xhd2015/ai-critic/server/scheduler"
+	"github.com/xhd2015/ai-critic/server/snapshot"
+	"github.com/xhd2015/ai-critic/server/storage"
 	"github.com/xhd2015/ai-critic/server/tools"
+	"github.com/xhd2015/ai-critic/server/uptime"
 	"github.com/xhd2015/ai-critic/server/usage"
 	"github.com/xhd2015/wrk/wrkcli/wrkserver"
 	"github.com/xhd2015/kool/pkgs/web"
@@ -173,9 +207,14 @@ func EnsureFrontendDevServer(ctx context.Context) (chan struct{}, error) {
 func Serve(port int, dev bool) error {
 	mux := http.NewServeMux()
 
-	// Wrap with auth middleware - skip login, auth check, setup, credential generate, ping, public key and path-info endpoints
-	handler := auth.Middleware(mux, []string{
+	// Wrap with auth middleware - skip login, SSO, auth check, setup, credential generate, ping, public key and path-info endpoints.
+	// Tracing sits inside it so traced calls name their user, and so does
+	// resolving the request's project, which is per tenant.
+	handler := auth.Middleware(reqtrace.Middleware(projects.Middleware(metrics.Middleware(mux))), []string{
 		"/api/login",
+		"/api/auth/sso",
+		"/api/auth/sso/login",
+		"/api/auth/sso/callback",
 		"/api/auth/check",
 		"/api/auth/status",
 		"/api/auth/setup",
@@ -186,13 +225,56 @@ func Serve(port int, dev bool) error {
 		"/api/grok/usage",
 		"/api/codex/usage",
 		"/api/debug/log",
+		share.ViewPath,
+		terminal.SharedPath,
+		terminal.SharedTakeoverPath,
+		firstrun.SkipAuthPaths[0],
+		firstrun.SkipAuthPaths[1],
 	})
 
+	// Record every state-changing call, including ones auth rejects
+	handler = audit.Middleware(handler)
+
+	// MCP tool calls are served as API calls through the same checks
+	mcp.SetDispatcher(handler)
+
+	// Reviewers are read-only, except for review endpoints that read via
+	// POST or record their review state
+	auth.AllowForReviewers(
+		"/api/review/diff",
+		"/api/review/status",
+		"/api/review/branches",
+		"/api/review/log",
+		"/api/review/stash/list",
+		"/api/review/stash/show",
+		"/api/review/conflicts",
+		"/api/review/hooks",
+		"/api/review/hooks/show",
+		"/api/review/chat",
+		"/api/review/findings",
+		"/api/review/read-state",
+		"/api/review/read-state/mark",
+		"/api/review/read-state/unmark",
+		"/api/editor/open",
+		"/api/handoff",
+		// each tool call is checked again as the API call it makes
+		"/api/mcp",
+	)
+
+	// Injected faults wrap everything so they look like the network's
+	if faults.Enabled() {
+		handler = faults.Middleware(handler)
+	}
+
 	// Wrap with quick-test mode handler if enabled
 	if quicktest.Enabled() {
 		handler = wrapQuickTestHandler(handler)
 	}
 
+	// Compress last, so every response is compressed once, including
+	// injected faults and quick-test pages
+	handler = compress.Middleware(handler)
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		ReadTimeout:  30 * time.Second,
@@ -264,19 +346,24 @@ func Serve(port int, dev bool) error {
 		fmt.Printf("Serving quick-test server at http://localhost:%d\n", port)
 	}
 
+	setupCrashReports()
+
 	if delay := startup.CoreStartupDelay(); delay > 0 {
 		time.Sleep(delay)
 	}
 
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	listener, err := listen(port)
 	if err != nil {
 		return err
 	}
+	serverListener = listener
 	logBootstrapPhase("core_listen", port, "")
 	if !quicktest.Enabled() {
 		RunCoreStartup()
 	}
+	coreReady.Store(true)
 	logBootstrapPhase("core_ready", port, "")
+	go restoreRestartState()
 	if !quicktest.Enabled() {
 		go RunExtensionStartup()
 	}
@@ -325,9 +412,12 @@ func Serve(port int, dev bool) error {
 			fmt.Println("Stopping domain health check goroutines...")
 			domains.StopAllDomainHealthChecks()
 
-			// Stop unified tunnel health checks
-			fmt.Println("Stopping unified tunnel health checks...")
-			unified_tunnel.StopGlobalHealthChecks()
+			// Stop probing our own public URLs
+			uptime.Stop()
+
+			// Stop scheduled maintenance, including tunnel health checks
+			fmt.Println("Stopping scheduler...")
+			scheduler.Stop()
 
 			// Stop opencode web server if enabled
 			if opencode_exposed.IsWebServerEnabled() {
@@ -353,6 +443,9 @@ func Serve(port int, dev bool) error {
 			fmt.Println("Stopping cron tasks...")
 			crontasks.Shutdown()
 
+			// Stop config file watcher
+			serverconfig.StopWatcher()
+
 			// Stop all managed subprocesses
 			fmt.Println("Stopping all managed subprocesses...")
 			subprocess.GetManager().StopAll()
@@ -499,6 +592,8 @@ func RegisterAPI(mux *http.ServeMux) error {
 	portforward.RegisterDefaultProvider(&pflocaltunnel.Provider{})
 	portforward.RegisterDefaultProvider(&pfcloudflare.QuickProvider{})
 	portforward.RegisterDefaultProvider(&pfcloudflare.OwnedProvider{})
+	portforward.RegisterDefaultProvider(&pfngrok.Provider{})
+	portforward.RegisterDefaultProvider(&pftailscale.Provider{})
 
 	// Register cloudflare_tunnel provider from config if available
 	if cfg := serverconfig.Get(); cfg != nil {
@@ -533,6 +628,10 @@ func RegisterAPI(mux *http.ServeMux) error {
 
 	// Agents API
 	agents.RegisterAPI(mux)
+	// Review agent changes automatically after each run
+	agents.SetAutoReviewer(runAutoReview)
+	agents.SetSessionReviewer(runSessionReview)
+	setupAIUsage()
 
 	// Custom Agents API
 	customagentapi.RegisterCustomAgentsAPI(mux)
@@ -554,6 +653,8 @@ func RegisterAPI(mux *http.ServeMux) error {
 
 	// File upload API
 	fileupload.RegisterAPI(mux)
+	registerFileTreeAPI(mux)
+	registerFileContentAPI(mux)
 
 	// File transfer inbox API
 	filetransfer.RegisterAPI(mux)
@@ -579,6 +680,9 @@ func RegisterAPI(mux *http.ServeMux) error {
 	// Settings export/import API
 	settings.RegisterAPI(mux)
 
+	// Encrypted backup/restore of the data directory (admin only)
+	databackup.RegisterAPI(mux)
+
 	// Exposed URLs API
 	exposedurls.RegisterAPI(mux)
 
@@ -587,6 +691,7 @@ func RegisterAPI(mux *http.ServeMux) error {
 
 	// Logs API
 	logs.RegisterAPI(mux)
+	logging.RegisterAPI(mux)
 
 	// Fake LLM API for mockups
 	fakellm.RegisterAPI(mux)
@@ -600,6 +705,39 @@ func RegisterAPI(mux *http.ServeMux) error {
 	// Cron tasks API
 	crontasks.RegisterAPI(mux)
 
+	// Read-only share links for diffs and review findings
+	share.RegisterAPI(mux)
+	activity.RegisterAPI(mux)
+	jobs.RegisterAPI(mux)
+	agentchanges.RegisterAPI(mux)
+	audit.RegisterAPI(mux)
+	editor.RegisterAPI(mux)
+	handoff.RegisterAPI(mux)
+	markdown.RegisterAPI(mux)
+	storage.RegisterAPI(mux)
+	quota.RegisterAPI(mux)
+	uptime.RegisterAPI(mux)
+	search.RegisterAPI(mux)
+	firstrun.RegisterAPI(mux)
+	scaffold.RegisterAPI(mux)
+	depupdate.RegisterAPI(mux)
+	aiusage.RegisterAPI(mux)
+	metrics.RegisterAPI(mux)
+	diagnostics.RegisterAPI(mux)
+	help.RegisterAPI(mux)
+	reqtrace.RegisterAPI(mux)
+	artifacts.RegisterAPI(mux)
+	rules.RegisterAPI(mux)
+	snapshot.RegisterAPI(mux)
+	scheduler.RegisterAPI(mux)
+	execpolicy.RegisterAPI(mux)
+	mcp.RegisterAPI(mux)
+	notifications.RegisterAPI(mux)
+	events.RegisterAPI(mux)
+	if faults.Enabled() {
+		faults.RegisterAPI(mux)
+	}
+
 	// Grok/codex usage and debug log APIs (business plane on main server port)
 	usage.RegisterAPI(mux)
 
@@ -611,6 +749,10 @@ func RegisterAPI(mux *http.ServeMux) error {
 
 	// Server status API
 	RegisterServerStatusAPI(mux)
+	registerHealthAPI(mux)
+	registerHealthTierAPI(mux)
+	registerServerErrorsAPI(mux)
+	registerServerUpdateAPI(mux)
 
 	// Server config API
 	mux.HandleFunc("/api/server/config", func(w http.ResponseWriter, r *http.Request) {
@@ -1160,6 +1302,13 @@ func handleExecRestart(w http.ResponseWriter, r *http.Request) {
 		sw.SendLog(fmt.Sprintf("Found newer binary: %s", newerBin))
 	}
 
+	execRestart(w, sw, newerBin)
+}
+
+// execRestart shuts the server down gracefully and execs newerBin in its place
+// with the current arguments, so the PID and flags are preserved. Progress
+// is streamed to sw; on success it does not return.
+func execRestart(w http.ResponseWriter, sw *sse.Writer, newerBin string) {
 	// Get working directory
 	workDir, err := os.Getwd()
 	if err != nil {
@@ -1182,6 +1331,15 @@ func handleExecRestart(w http.ResponseWriter, r *http.Request) {
 
 	sw.SendLog("Preparing to exec...")
 
+	// Snapshot in-memory state for the new process, before shutdown stops it
+	if err := saveRestartState(); err != nil {
+		sw.SendLog(fmt.Sprintf("Warning: failed to save restart state: %v", err))
+	}
+	// Keep the socket accepting, so clients wait instead of being refused
+	if err := handOverListener(serverListener); err != nil {
+		sw.SendLog(fmt.Sprintf("Warning: listener not handed over, port will be closed during restart: %v", err))
+	}
+
 	// Set shutdown mode to restart so the shutdown flow knows to proceed with exec
 	SetShutdownMode("restart")
 
@@ -1218,10 +1376,12 @@ func handleExecRestart(w http.ResponseWriter, r *http.Request) {
 
 	// Execute the new binary, replacing current process
 	// syscall.Exec never returns on success
-	err = syscall.Exec(newerBin, args, os.Environ())
+	err = syscall.Exec(newerBin, args, execEnv())
 
 	// If we get here, exec failed
 	// Cannot send SSE anymore since we've already sent done, so just log
+	restartstate.Discard()
+	cancelHandOver()
 	fmt.Fprintf(os.Stderr, "ERROR: syscall.Exec failed: %v\n", err)
 }
 
@@ -1297,6 +1457,12 @@ func handleQuickTestExecRestart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := saveRestartState(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save restart state: %v\n", err)
+	}
+	if err := handOverListener(serverListener); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: listener not handed over: %v\n", err)
+	}
 	SetShutdownMode("restart")
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1316,8 +1482,10 @@ func handleQuickTestExecRestart(w http.ResponseWriter, r *http.Request) {
 
 	time.Sleep(200 * time.Millisecond)
 
-	err = syscall.Exec(absPath, os.Args, os.Environ())
+	err = syscall.Exec(absPath, os.Args, execEnv())
 	if err != nil {
+		restartstate.Discard()
+		cancelHandOver()
 		fmt.Fprintf(os.Stderr, "ERROR: syscall.Exec failed: %v\n", err)
 	}
 }
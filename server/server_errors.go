@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/crashreport"
+)
+
+// crashLoopWindow and crashLoopCount define a restart loop: that many
+// crashes within the window.
+const (
+	crashLoopWindow = 10 * time.Minute
+	crashLoopCount  = 3
+)
+
+// ServerErrors is the response of GET /api/server/errors
+type ServerErrors struct {
+	// LastCrash is the most recent unexpected exit, nil if there was none.
+	LastCrash *crashreport.Report `json:"last_crash"`
+	// RecentCrashes counts crashes within the last crashLoopWindow.
+	RecentCrashes int  `json:"recent_crashes"`
+	CrashLoop     bool `json:"crash_loop"`
+	// Crashes lists the kept reports, newest first.
+	Crashes []crashreport.Report `json:"crashes"`
+}
+
+// setupCrashReports turns a panic left by the previous run into a report and
+// routes fatal panics of this run into the crash output file.
+func setupCrashReports() {
+	if crashreport.CollectPending() {
+		fmt.Println("Recovered from a crash of the previous run, see /api/server/errors")
+	}
+	if err := crashreport.EnableCrashOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: crash output not enabled: %v\n", err)
+	}
+}
+
+// registerServerErrorsAPI registers GET (list) and DELETE (clear) of crash
+// reports at /api/server/errors.
+func registerServerErrorsAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/server/errors", handleServerErrors)
+}
+
+func handleServerErrors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		reports, err := crashreport.List()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, summarizeCrashes(reports, time.Now()))
+	case http.MethodDelete:
+		if err := crashreport.Clear(); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// summarizeCrashes builds the response from reports sorted newest first.
+func summarizeCrashes(reports []crashreport.Report, now time.Time) ServerErrors {
+	out := ServerErrors{Crashes: reports}
+	if out.Crashes == nil {
+		out.Crashes = []crashreport.Report{}
+	}
+	if len(reports) > 0 {
+		out.LastCrash = &reports[0]
+	}
+	for _, r := range reports {
+		if now.Sub(r.Time) <= crashLoopWindow {
+			out.RecentCrashes++
+		}
+	}
+	out.CrashLoop = out.RecentCrashes >= crashLoopCount
+	return out
+}
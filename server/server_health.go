@@ -0,0 +1,314 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/agents"
+	opencode_exposed "github.com/xhd2015/ai-critic/server/agents/opencode/exposed_opencode"
+	opencode_internal "github.com/xhd2015/ai-critic/server/agents/opencode/internal_opencode"
+	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// lowDiskBytes and lowDiskPercent flag the data directory's filesystem as
+// a problem when either limit is crossed.
+const (
+	lowDiskBytes   = 1 << 30
+	lowDiskPercent = 95
+)
+
+// healthCheckTimeout bounds the slower probes (opencode status, git).
+const healthCheckTimeout = 5 * time.Second
+
+var serverStartedAt = time.Now()
+
+// HealthReport is the combined status of the server's subsystems, so one
+// request answers "why is my domain 530".
+type HealthReport struct {
+	// Status is "ok" when Problems is empty and "degraded" otherwise.
+	Status      string         `json:"status"`
+	Problems    []string       `json:"problems"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Server      ServerHealth   `json:"server"`
+	Tunnels     []TunnelHealth `json:"tunnels"`
+	Agents      AgentsHealth   `json:"agents"`
+	Opencode    OpencodeHealth `json:"opencode"`
+	Disk        DataDiskHealth `json:"disk"`
+	Git         GitHealth      `json:"git"`
+	Frontend    FrontendHealth `json:"frontend"`
+}
+
+type ServerHealth struct {
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+	GoVersion string    `json:"go_version"`
+	Revision  string    `json:"revision,omitempty"` // vcs revision the binary was built from
+	Modified  bool      `json:"modified,omitempty"` // built from a dirty tree
+}
+
+type TunnelHealth struct {
+	Group        string                         `json:"group"`
+	Running      bool                           `json:"running"`
+	TunnelName   string                         `json:"tunnel_name,omitempty"`
+	DrainingPIDs []int                          `json:"draining_pids,omitempty"`
+	Mappings     []unified_tunnel.MappingHealth `json:"mappings"`
+	// RecentLogs are the last lines of cloudflared output, to spot
+	// registration or origin errors without opening the log endpoint.
+	RecentLogs []string `json:"recent_logs,omitempty"`
+}
+
+type AgentsHealth struct {
+	Total    int                       `json:"total"`
+	ByStatus map[string]int            `json:"by_status"`
+	Sessions []agents.AgentSessionInfo `json:"sessions"`
+}
+
+type OpencodeHealth struct {
+	Internal      *opencode_internal.ServerStatus   `json:"internal,omitempty"`
+	InternalError string                            `json:"internal_error,omitempty"`
+	Web           *opencode_exposed.WebServerStatus `json:"web,omitempty"`
+	WebError      string                            `json:"web_error,omitempty"`
+}
+
+type DataDiskHealth struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Available   uint64  `json:"available"`
+	UsedPercent float64 `json:"used_percent"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type GitHealth struct {
+	Available bool   `json:"available"`
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type FrontendHealth struct {
+	// Mode is "embedded" or "dev-server".
+	Mode string `json:"mode"`
+	// Build identifies the embedded build by its hashed entry bundle name,
+	// e.g. "index-BkX3f9aZ.js"; empty when no build is embedded.
+	Build string `json:"build,omitempty"`
+}
+
+func registerHealthAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/health/full", handleFullHealth)
+}
+
+func handleFullHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildHealthReport())
+}
+
+func buildHealthReport() *HealthReport {
+	report := &HealthReport{
+		GeneratedAt: time.Now(),
+		Server:      getServerHealth(),
+		Tunnels:     getTunnelHealth(),
+		Agents:      getAgentsHealth(),
+		Disk:        getDataDiskHealth(config.DataDir),
+		Frontend:    getFrontendHealth(),
+	}
+
+	// the opencode and git probes shell out or dial; run them together
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		report.Opencode = getOpencodeHealth()
+	}()
+	go func() {
+		defer wg.Done()
+		report.Git = getGitHealth()
+	}()
+	wg.Wait()
+
+	report.Problems = healthProblems(report)
+	report.Status = "ok"
+	if len(report.Problems) > 0 {
+		report.Status = "degraded"
+	}
+	return report
+}
+
+// healthProblems lists what needs attention, in the order a user should
+// look at it.
+func healthProblems(report *HealthReport) []string {
+	problems := []string{}
+	for _, t := range report.Tunnels {
+		if !t.Running && len(t.Mappings) > 0 {
+			problems = append(problems, fmt.Sprintf("tunnel %s is not running but has %d mapping(s)", t.Group, len(t.Mappings)))
+		}
+		for _, m := range t.Mappings {
+			if m.Checked && !m.Healthy && !m.Paused {
+				problems = append(problems, fmt.Sprintf("tunnel %s: %s (%s) failed %d health check(s)", t.Group, m.Hostname, m.Service, m.ConsecutiveFailures))
+			}
+		}
+	}
+	if n := report.Agents.ByStatus["error"]; n > 0 {
+		problems = append(problems, fmt.Sprintf("%d agent session(s) in error state", n))
+	}
+	if in := report.Opencode.Internal; in != nil && in.Registered && !in.Reachable {
+		problems = append(problems, fmt.Sprintf("internal opencode server (PID %d, port %d) is not reachable", in.PID, in.Port))
+	}
+	if web := report.Opencode.Web; web != nil && web.ExposedDomain != "" && !web.Running {
+		problems = append(problems, fmt.Sprintf("opencode web server for %s is not running", web.ExposedDomain))
+	}
+	if d := report.Disk; d.Error != "" {
+		problems = append(problems, "cannot read disk usage of "+d.Path+": "+d.Error)
+	} else if d.Available < lowDiskBytes || d.UsedPercent >= lowDiskPercent {
+		problems = append(problems, fmt.Sprintf("low disk space for %s: %d MiB available (%.0f%% used)", d.Path, d.Available>>20, d.UsedPercent))
+	}
+	if !report.Git.Available {
+		problems = append(problems, "git is not available: "+report.Git.Error)
+	}
+	if report.Frontend.Mode == "embedded" && report.Frontend.Build == "" {
+		problems = append(problems, "no frontend build is embedded in the server binary")
+	}
+	return problems
+}
+
+func getServerHealth() ServerHealth {
+	h := ServerHealth{
+		StartedAt: serverStartedAt,
+		Uptime:    time.Since(serverStartedAt).Round(time.Second).String(),
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				h.Revision = s.Value
+			case "vcs.modified":
+				h.Modified = s.Value == "true"
+			}
+		}
+	}
+	return h
+}
+
+func getTunnelHealth() []TunnelHealth {
+	tunnels := []TunnelHealth{}
+	for _, g := range unified_tunnel.GetTunnelGroupManager().Groups() {
+		status := g.GetStatus()
+		t := TunnelHealth{
+			Group:    g.Name(),
+			Mappings: g.MappingHealth(),
+		}
+		t.Running, _ = status["running"].(bool)
+		t.TunnelName, _ = status["tunnel_name"].(string)
+		t.DrainingPIDs, _ = status["draining_pids"].([]int)
+		for _, l := range g.TailLogs(10) {
+			t.RecentLogs = append(t.RecentLogs, l.Text)
+		}
+		tunnels = append(tunnels, t)
+	}
+	return tunnels
+}
+
+func getAgentsHealth() AgentsHealth {
+	sessions := agents.ListSessions()
+	h := AgentsHealth{
+		Total:    len(sessions),
+		ByStatus: make(map[string]int),
+		Sessions: make([]agents.AgentSessionInfo, 0, len(sessions)),
+	}
+	for _, s := range sessions {
+		h.ByStatus[s.Status]++
+		s.Review = nil // reviews are large and irrelevant here
+		h.Sessions = append(h.Sessions, s)
+	}
+	return h
+}
+
+func getOpencodeHealth() OpencodeHealth {
+	var h OpencodeHealth
+	if status, err := opencode_internal.GetServerStatus(); err != nil {
+		h.InternalError = err.Error()
+	} else {
+		h.Internal = status
+	}
+
+	// GetWebServerStatus probes ports; don't let a hung probe stall the report
+	done := make(chan struct{})
+	var web *opencode_exposed.WebServerStatus
+	var webErr error
+	go func() {
+		defer close(done)
+		web, webErr = opencode_exposed.GetWebServerStatus()
+	}()
+	select {
+	case <-done:
+		if webErr != nil {
+			h.WebError = webErr.Error()
+		} else {
+			h.Web = web
+		}
+	case <-time.After(healthCheckTimeout):
+		h.WebError = fmt.Sprintf("timed out after %v", healthCheckTimeout)
+	}
+	return h
+}
+
+func getDataDiskHealth(dir string) DataDiskHealth {
+	h := DataDiskHealth{Path: dir}
+	total, available, free, err := diskUsage(dir)
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Total = total
+	h.Available = available
+	if h.Total > 0 {
+		h.UsedPercent = float64(h.Total-free) / float64(h.Total) * 100
+	}
+	return h
+}
+
+func getGitHealth() GitHealth {
+	var h GitHealth
+	if err := gitrunner.EnsureAvailable(); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Available = true
+	h.Path, _ = tool_resolve.LookPath("git")
+	if out, err := gitrunner.NewCommand("--version").Output(); err == nil {
+		h.Version = strings.TrimSpace(strings.TrimPrefix(string(out), "git version "))
+	}
+	return h
+}
+
+func getFrontendHealth() FrontendHealth {
+	if frontendPort != 0 {
+		return FrontendHealth{Mode: "dev-server"}
+	}
+	h := FrontendHealth{Mode: "embedded"}
+	entries, err := fs.ReadDir(distFS, "ai-critic-react/dist/assets")
+	if err != nil {
+		return h
+	}
+	for _, e := range entries {
+		if name := e.Name(); strings.HasPrefix(name, "index-") && strings.HasSuffix(name, ".js") {
+			h.Build = name
+			break
+		}
+	}
+	return h
+}
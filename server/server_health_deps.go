@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/agents"
+	opencode_internal "github.com/xhd2015/ai-critic/server/agents/opencode/internal_opencode"
+	"github.com/xhd2015/ai-critic/server/ai"
+	cloudflareSettings "github.com/xhd2015/ai-critic/server/cloudflare"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// Dependency statuses. Unavailable marks something not installed or not
+// configured, which is not a failure by itself.
+const (
+	DependencyOK          = "ok"
+	DependencyDegraded    = "degraded"
+	DependencyDown        = "down"
+	DependencyUnavailable = "unavailable"
+)
+
+// dependencyCacheTTL keeps monitors polling /api/health/dependencies from
+// hitting the AI provider on every request.
+const dependencyCacheTTL = 30 * time.Second
+
+// coreReady is set once core startup finished and the API can be served.
+var coreReady atomic.Bool
+
+// DependencyHealth is the status of one external dependency
+type DependencyHealth struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Version   string `json:"version,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+}
+
+// DependenciesReport is the response of /api/health/dependencies
+type DependenciesReport struct {
+	// Status is "ok" when no dependency is down or degraded, "degraded" otherwise.
+	Status       string             `json:"status"`
+	Dependencies []DependencyHealth `json:"dependencies"`
+	GeneratedAt  time.Time          `json:"generated_at"`
+}
+
+// registerHealthTierAPI registers the probes for monitors:
+//
+//	GET /healthz                   the process is alive
+//	GET /readyz                    the API can be served (503 otherwise)
+//	GET /api/health/dependencies   git, cloudflared, AI provider and agent backends
+//
+// /healthz and /readyz are outside /api and need no auth.
+func registerHealthTierAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/api/health/dependencies", handleDependencyHealth)
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if problems := readinessProblems(); len(problems) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "not_ready", "problems": problems})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// readinessProblems lists why the API cannot be served; empty when ready.
+func readinessProblems() []string {
+	var problems []string
+	if !coreReady.Load() {
+		problems = append(problems, "core startup has not finished")
+	}
+	select {
+	case <-globalShutdownChan:
+		problems = append(problems, "server is shutting down")
+	default:
+	}
+	// settings, users and projects all live in the data directory
+	f, err := os.CreateTemp(config.DataDir, ".readyz-")
+	if err != nil {
+		problems = append(problems, "data directory is not writable: "+err.Error())
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	return problems
+}
+
+var (
+	dependencyMu     sync.Mutex
+	dependencyReport *DependenciesReport
+)
+
+func handleDependencyHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dependencyMu.Lock()
+	report := dependencyReport
+	if report == nil || time.Since(report.GeneratedAt) >= dependencyCacheTTL || r.URL.Query().Get("refresh") == "true" {
+		report = buildDependenciesReport()
+		dependencyReport = report
+	}
+	dependencyMu.Unlock()
+
+	status := http.StatusOK
+	for _, d := range report.Dependencies {
+		if d.Status == DependencyDown {
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, status, report)
+}
+
+func buildDependenciesReport() *DependenciesReport {
+	// every probe may shell out or dial; run them together
+	probes := []func() []DependencyHealth{
+		func() []DependencyHealth { return []DependencyHealth{gitDependency()} },
+		func() []DependencyHealth { return []DependencyHealth{cloudflaredDependency()} },
+		func() []DependencyHealth { return []DependencyHealth{aiProviderDependency()} },
+		agentDependencies,
+	}
+	results := make([][]DependencyHealth, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe()
+		}()
+	}
+	wg.Wait()
+
+	report := &DependenciesReport{Status: "ok", Dependencies: []DependencyHealth{}, GeneratedAt: time.Now()}
+	for _, deps := range results {
+		for _, d := range deps {
+			if d.Status == DependencyDown || d.Status == DependencyDegraded {
+				report.Status = "degraded"
+			}
+			report.Dependencies = append(report.Dependencies, d)
+		}
+	}
+	return report
+}
+
+func gitDependency() DependencyHealth {
+	h := getGitHealth()
+	if !h.Available {
+		return DependencyHealth{Name: "git", Status: DependencyDown, Detail: h.Error}
+	}
+	return DependencyHealth{Name: "git", Status: DependencyOK, Detail: h.Path, Version: h.Version}
+}
+
+// cloudflaredDependency is down when tunnels have mappings to serve but the
+// binary is missing or a tunnel is not running.
+func cloudflaredDependency() DependencyHealth {
+	d := DependencyHealth{Name: "cloudflared", Status: DependencyOK}
+	var stopped []string
+	mapped := 0
+	for _, t := range getTunnelHealth() {
+		if len(t.Mappings) == 0 {
+			continue
+		}
+		mapped++
+		if !t.Running {
+			stopped = append(stopped, t.Group)
+		}
+	}
+	if !cloudflareSettings.IsCommandAvailable("cloudflared") {
+		d.Status, d.Detail = DependencyUnavailable, "not installed"
+		if mapped > 0 {
+			d.Status = DependencyDown
+		}
+		return d
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, "cloudflared", "--version").Output(); err == nil {
+		d.Version = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	}
+	switch {
+	case len(stopped) > 0:
+		d.Status = DependencyDown
+		d.Detail = "tunnel not running: " + strings.Join(stopped, ", ")
+	case mapped > 0:
+		d.Detail = fmt.Sprintf("%d tunnel(s) running", mapped)
+	default:
+		d.Detail = "no tunnels configured"
+	}
+	return d
+}
+
+// aiProviderDependency lists the default provider's models, which needs
+// both reachability and a valid API key.
+func aiProviderDependency() DependencyHealth {
+	d := DependencyHealth{Name: "ai_provider"}
+	cfg := defaultAIConfig()
+	if !cfg.Configured() {
+		d.Status, d.Detail = DependencyUnavailable, "no AI provider configured"
+		return d
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	req, err := ai.NewModelsRequest(ctx, cfg)
+	if err != nil {
+		d.Status, d.Detail = DependencyDown, err.Error()
+		return d
+	}
+	baseURL := strings.TrimSuffix(strings.TrimSuffix(req.URL.String(), "/models"), "/api/tags")
+	d.Detail = baseURL
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	d.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		d.Status, d.Detail = DependencyDown, err.Error()
+		return d
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		d.Status = DependencyOK
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		d.Status, d.Detail = DependencyDown, baseURL+": API key rejected ("+resp.Status+")"
+	default:
+		// reachable, but e.g. no /models endpoint or rate limited
+		d.Status, d.Detail = DependencyDegraded, baseURL+": "+resp.Status
+	}
+	return d
+}
+
+// agentDependencies reports each agent backend: installed or not, and for
+// the opencode-based ones whether the internal server answers.
+func agentDependencies() []DependencyHealth {
+	var internalProblem string
+	if status, err := opencode_internal.GetServerStatus(); err == nil && status.Registered && !status.Reachable {
+		internalProblem = fmt.Sprintf("internal opencode server (PID %d, port %d) is not reachable", status.PID, status.Port)
+	}
+	var deps []DependencyHealth
+	for _, a := range agents.Backends() {
+		d := DependencyHealth{Name: "agent:" + string(a.ID), Status: DependencyOK, Detail: a.Command}
+		switch {
+		case !a.Installed:
+			d.Status, d.Detail = DependencyUnavailable, a.Command+" not installed"
+		case a.Command == "opencode" && internalProblem != "":
+			d.Status, d.Detail = DependencyDegraded, internalProblem
+		}
+		deps = append(deps, d)
+	}
+	return deps
+}
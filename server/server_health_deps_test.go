@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/env"
+)
+
+func TestReadyz(t *testing.T) {
+	oldDataDir, oldReady := config.DataDir, coreReady.Load()
+	t.Cleanup(func() {
+		config.DataDir = oldDataDir
+		coreReady.Store(oldReady)
+	})
+	config.DataDir = t.TempDir()
+
+	tests := []struct {
+		name    string
+		ready   bool
+		dataDir string
+		want    int
+	}{
+		{"starting", false, config.DataDir, http.StatusServiceUnavailable},
+		{"ready", true, config.DataDir, http.StatusOK},
+		{"data dir missing", true, config.DataDir + "/missing", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		coreReady.Store(tt.ready)
+		config.DataDir = tt.dataDir
+		rec := httptest.NewRecorder()
+		handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestAIProviderDependency(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Write([]byte(`{"data":[]}`))
+		case "Bearer limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer provider.Close()
+	t.Setenv(env.EnvOpenAIBaseURL, provider.URL)
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", DependencyUnavailable},
+		{"good", DependencyOK},
+		{"limited", DependencyDegraded},
+		{"bad", DependencyDown},
+	}
+	for _, tt := range tests {
+		t.Setenv(env.EnvOpenAIAPIKey, tt.key)
+		if got := aiProviderDependency(); got.Status != tt.want {
+			t.Errorf("key %q: status = %s (%s), want %s", tt.key, got.Status, got.Detail, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// diskUsage returns the size of the filesystem holding dir, the bytes
+// available to unprivileged users and the bytes free, in that order.
+func diskUsage(dir string) (total, available, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), st.Bfree * uint64(st.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package server
+
+import "golang.org/x/sys/windows"
+
+// diskUsage returns the size of the volume holding dir, the bytes
+// available to the current user and the bytes free, in that order.
+func diskUsage(dir string) (total, available, free uint64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(path, &available, &total, &free); err != nil {
+		return 0, 0, 0, err
+	}
+	return total, available, free, nil
+}
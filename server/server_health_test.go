@@ -0,0 +1,76 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	opencode_internal "github.com/xhd2015/ai-critic/server/agents/opencode/internal_opencode"
+	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
+)
+
+func healthyReport() *HealthReport {
+	return &HealthReport{
+		Tunnels: []TunnelHealth{{
+			Group:    "core",
+			Running:  true,
+			Mappings: []unified_tunnel.MappingHealth{{Hostname: "a.example.com", Checked: true, Healthy: true}},
+		}},
+		Agents:   AgentsHealth{ByStatus: map[string]int{"running": 1}},
+		Disk:     DataDiskHealth{Path: "/data", Total: 100 << 30, Available: 50 << 30, UsedPercent: 50},
+		Git:      GitHealth{Available: true},
+		Frontend: FrontendHealth{Mode: "embedded", Build: "index-abc.js"},
+	}
+}
+
+func TestHealthProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *HealthReport)
+		want   string // substring of the single expected problem; "" for none
+	}{
+		{"healthy", func(r *HealthReport) {}, ""},
+		{"tunnel down", func(r *HealthReport) { r.Tunnels[0].Running = false }, "tunnel core is not running"},
+		{"mapping unhealthy", func(r *HealthReport) {
+			r.Tunnels[0].Mappings[0].Healthy = false
+			r.Tunnels[0].Mappings[0].ConsecutiveFailures = 2
+		}, "a.example.com () failed 2"},
+		{"paused mapping ignored", func(r *HealthReport) {
+			r.Tunnels[0].Mappings[0].Healthy = false
+			r.Tunnels[0].Mappings[0].Paused = true
+		}, ""},
+		{"agent error", func(r *HealthReport) { r.Agents.ByStatus["error"] = 2 }, "2 agent session(s)"},
+		{"internal opencode unreachable", func(r *HealthReport) {
+			r.Opencode.Internal = &opencode_internal.ServerStatus{Registered: true, PID: 7, Port: 4096}
+		}, "PID 7, port 4096"},
+		{"low disk", func(r *HealthReport) { r.Disk.Available = 10 << 20 }, "low disk space"},
+		{"no git", func(r *HealthReport) { r.Git = GitHealth{Error: "not installed"} }, "git is not available"},
+		{"no frontend build", func(r *HealthReport) { r.Frontend.Build = "" }, "no frontend build"},
+		{"dev server", func(r *HealthReport) { r.Frontend = FrontendHealth{Mode: "dev-server"} }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := healthyReport()
+			tt.modify(r)
+			got := healthProblems(r)
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Fatalf("problems = %q, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || !strings.Contains(got[0], tt.want) {
+				t.Fatalf("problems = %q, want one containing %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataDiskHealth(t *testing.T) {
+	h := getDataDiskHealth(t.TempDir())
+	if h.Error != "" || h.Total == 0 || h.Available > h.Total {
+		t.Fatalf("unexpected disk health: %+v", h)
+	}
+	if h := getDataDiskHealth("/nonexistent/dir"); h.Error == "" {
+		t.Fatalf("expected an error for a missing directory")
+	}
+}
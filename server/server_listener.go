@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/env"
+)
+
+// serverListener is the listener Serve accepts on, handed over to the
+// process exec'd by an exec-restart.
+var serverListener net.Listener
+
+// HasInheritedListener reports whether this process was exec'd with the
+// listening socket of the server it replaces. The port then answers
+// before Serve runs, which must not be mistaken for another server.
+func HasInheritedListener() bool {
+	return os.Getenv(env.EnvListenFD) != ""
+}
+
+// listen returns the listener handed over by an exec-restart if there is
+// one for port, otherwise a new one.
+func listen(port int) (net.Listener, error) {
+	l, err := inheritedListener(port)
+	if err != nil {
+		fmt.Printf("Warning: not using the inherited listener: %v\n", err)
+	}
+	if l != nil {
+		fmt.Printf("Accepting on the listener inherited from the previous process\n")
+		return l, nil
+	}
+	return net.Listen("tcp", fmt.Sprintf(":%d", port))
+}
+
+func inheritedListener(port int) (net.Listener, error) {
+	v := os.Getenv(env.EnvListenFD)
+	if v == "" {
+		return nil, nil
+	}
+	// children must not take it for theirs
+	os.Unsetenv(env.EnvListenFD)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %q", env.EnvListenFD, v)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	// FileListener duplicates the descriptor
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	if addr, ok := l.Addr().(*net.TCPAddr); !ok || addr.Port != port {
+		l.Close()
+		return nil, fmt.Errorf("inherited listener is on %v, not port %d", l.Addr(), port)
+	}
+	return l, nil
+}
+
+// withoutListenFD drops a stale listener descriptor from environ.
+func withoutListenFD(environ []string) []string {
+	out := environ[:0:0]
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, env.EnvListenFD+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
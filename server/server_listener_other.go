@@ -0,0 +1,21 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// handOverListener is unsupported: without exec there is no process to
+// hand the socket to.
+func handOverListener(l net.Listener) error {
+	return errors.New("listener handover is not supported on this platform")
+}
+
+func execEnv() []string {
+	return withoutListenFD(os.Environ())
+}
+
+func cancelHandOver() {}
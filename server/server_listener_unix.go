@@ -0,0 +1,59 @@
+//go:build unix
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/xhd2015/ai-critic/server/env"
+)
+
+// handedOver keeps the duplicated socket open until the exec; the file's
+// finalizer would close it otherwise.
+var handedOver *os.File
+
+// handOverListener lets the process exec'd next accept on l. A duplicate
+// of the socket survives the shutdown closing l, so until the exec,
+// connections queue in its backlog instead of being refused. It stays
+// close-on-exec until execEnv, so subprocesses started during the
+// shutdown do not inherit it.
+func handOverListener(l net.Listener) error {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("cannot hand over a %T", l)
+	}
+	f, err := tl.File()
+	if err != nil {
+		return err
+	}
+	handedOver = f
+	return nil
+}
+
+// execEnv returns the environment to exec the next process with. Called
+// right before syscall.Exec, it lets the handed over socket survive the
+// exec and tells the process its descriptor.
+func execEnv() []string {
+	environ := withoutListenFD(os.Environ())
+	if handedOver == nil {
+		return environ
+	}
+	fd := handedOver.Fd()
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: listener not handed over: %v\n", errno)
+		return environ
+	}
+	return append(environ, env.EnvListenFD+"="+strconv.Itoa(int(fd)))
+}
+
+// cancelHandOver closes the duplicate after the exec failed.
+func cancelHandOver() {
+	if handedOver != nil {
+		handedOver.Close()
+		handedOver = nil
+	}
+}
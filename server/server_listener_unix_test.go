@@ -0,0 +1,75 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/env"
+)
+
+func TestListenerHandOver(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	t.Cleanup(cancelHandOver)
+	t.Setenv(env.EnvListenFD, "99")
+
+	if err := handOverListener(l); err != nil {
+		t.Fatal(err)
+	}
+	// until the exec, subprocesses must not inherit the socket
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, handedOver.Fd(), syscall.F_GETFD, 0)
+	if errno != 0 || flags&syscall.FD_CLOEXEC == 0 {
+		t.Fatalf("handed over fd is inherited before the exec (flags %#x, %v)", flags, errno)
+	}
+
+	// the server closing its listener must not close the port
+	l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("port closed with the listener: %v", err)
+	}
+	defer conn.Close()
+
+	var listenFD []string
+	for _, kv := range execEnv() {
+		if v, ok := strings.CutPrefix(kv, env.EnvListenFD+"="); ok {
+			listenFD = append(listenFD, v)
+		}
+	}
+	if len(listenFD) != 1 || listenFD[0] == "99" {
+		t.Fatalf("exec env has %s=%v", env.EnvListenFD, listenFD)
+	}
+	flags, _, errno = syscall.Syscall(syscall.SYS_FCNTL, handedOver.Fd(), syscall.F_GETFD, 0)
+	if errno != 0 || flags&syscall.FD_CLOEXEC != 0 {
+		t.Fatalf("handed over fd is close-on-exec (flags %#x, %v)", flags, errno)
+	}
+
+	// as the exec'd process would: the queued connection is accepted
+	os.Setenv(env.EnvListenFD, listenFD[0])
+	if !HasInheritedListener() {
+		t.Fatalf("%s not set", env.EnvListenFD)
+	}
+	inherited, err := listen(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	// listen took ownership of the handed over descriptor
+	handedOver = nil
+	if os.Getenv(env.EnvListenFD) != "" {
+		t.Errorf("%s left set for children", env.EnvListenFD)
+	}
+	accepted, err := inherited.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+}
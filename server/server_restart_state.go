@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/xhd2015/ai-critic/server/agents"
+	"github.com/xhd2015/ai-critic/server/proxy/portforward"
+	"github.com/xhd2015/ai-critic/server/quicktest"
+	"github.com/xhd2015/ai-critic/server/restartstate"
+)
+
+// restoredState is the snapshot taken over from the process this one was
+// exec'd from; nil after a normal start.
+var restoredState *restartstate.State
+
+// SetRestoredState hands the server the snapshot left by an exec-restart,
+// whose sessions and port forwards are restored once the server is up.
+func SetRestoredState(s *restartstate.State) {
+	restoredState = s
+}
+
+// saveRestartState snapshots what the exec'd process cannot rebuild from
+// its flags. It must run before shutdown stops the agent sessions.
+func saveRestartState() error {
+	s := &restartstate.State{
+		QuickTest:     quicktest.Enabled(),
+		QuickTestKeep: quicktest.KeepEnabled(),
+		FrontendPort:  frontendPort,
+		FrontendHost:  frontendHost,
+	}
+	for _, info := range agents.ListSessions() {
+		if info.Status != "starting" && info.Status != "running" {
+			continue
+		}
+		s.Sessions = append(s.Sessions, restartstate.Session{
+			ID:         info.ID,
+			AgentID:    info.AgentID,
+			ProjectDir: info.ProjectDir,
+			Owner:      info.Owner,
+		})
+	}
+	for _, pf := range portforward.GetDefaultManager().List() {
+		if pf.Type != portforward.PortForwardTypePortForward || pf.Status == portforward.StatusStopped {
+			continue
+		}
+		s.PortForwards = append(s.PortForwards, restartstate.PortForward{
+			Port:     pf.LocalPort,
+			Label:    pf.Label,
+			Provider: pf.Provider,
+		})
+	}
+	return restartstate.Save(s)
+}
+
+// restoreRestartState relaunches the agent sessions and port forwards of
+// the previous process. Failures are logged; the rest is still restored.
+func restoreRestartState() {
+	s := restoredState
+	if s == nil {
+		return
+	}
+	restoredState = nil
+	fmt.Printf("Restoring state from before exec-restart: %d agent session(s), %d port forward(s)\n", len(s.Sessions), len(s.PortForwards))
+	for _, pf := range s.PortForwards {
+		if _, err := portforward.GetDefaultManager().Add(pf.Port, pf.Label, pf.Provider); err != nil {
+			fmt.Printf("Warning: failed to restore port forward %d: %v\n", pf.Port, err)
+		}
+	}
+	for _, sess := range s.Sessions {
+		if err := agents.RestoreSession(sess.ID, sess.Owner, sess.AgentID, sess.ProjectDir); err != nil {
+			fmt.Printf("Warning: failed to restore agent session %s: %v\n", sess.ID, err)
+		}
+	}
+}
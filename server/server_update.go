@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/xhd2015/agent-pro/agent/streaming/sse"
+	"github.com/xhd2015/ai-critic/server/selfupdate"
+)
+
+// registerServerUpdateAPI registers /api/server/update: GET checks the
+// latest GitHub release against the running binary, POST installs it and
+// restarts through the exec-restart path.
+func registerServerUpdateAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/server/update", handleServerUpdate)
+}
+
+func handleServerUpdate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rel, err := selfupdate.Check(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, rel)
+	case http.MethodPost:
+		updateServer(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// updateServer streams the update's progress as SSE. An up-to-date binary
+// is left alone unless ?force=1.
+func updateServer(w http.ResponseWriter, r *http.Request) {
+	sw := sse.NewWriter(w)
+	if sw == nil {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	fail := func(format string, args ...any) {
+		sw.SendError(fmt.Sprintf(format, args...))
+		sw.SendDone(map[string]string{"success": "false"})
+	}
+
+	sw.SendLog("Checking latest release...")
+	rel, err := selfupdate.Check(r.Context())
+	if err != nil {
+		fail("Check failed: %v", err)
+		return
+	}
+	sw.SendLog(fmt.Sprintf("Latest release: %s (%s)", rel.Tag, rel.Asset))
+	if rel.Current && r.URL.Query().Get("force") != "1" {
+		sw.SendDone(map[string]string{"success": "true", "message": "Already up to date", "tag": rel.Tag})
+		return
+	}
+
+	sw.SendLog(fmt.Sprintf("Downloading %s...", rel.Asset))
+	bin, err := selfupdate.Apply(r.Context(), rel)
+	if err != nil {
+		fail("Update failed: %v", err)
+		return
+	}
+	sw.SendLog(fmt.Sprintf("Checksum verified, installed %s at %s", rel.Tag, bin))
+
+	execRestart(w, sw, bin)
+}
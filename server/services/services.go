@@ -8,15 +8,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/ai-critic/server/cloudflare"
 	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/portpid"
+	"github.com/xhd2015/ai-critic/server/procctl"
 	"github.com/xhd2015/ai-critic/server/proxy/portforward"
 )
 
@@ -848,7 +848,7 @@ func (m *Manager) start(id string, force bool) error {
 	cmd.Env = serviceEnv
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.SysProcAttr = procctl.GroupAttr()
 
 	if err := cmd.Start(); err != nil {
 		_, _ = logFile.WriteString(fmt.Sprintf("[%s] failed to start: %v\n", time.Now().Format(time.RFC3339), err))
@@ -1255,7 +1255,7 @@ func killConfiguredPortOwner(pf *ServicePortForward) error {
 	if pf == nil || pf.Port <= 0 {
 		return nil
 	}
-	pids, err := findListeningPIDs(pf.Port)
+	pids, err := portpid.PIDsOnPort(pf.Port)
 	if err != nil {
 		return err
 	}
@@ -1270,36 +1270,8 @@ func killConfiguredPortOwner(pf *ServicePortForward) error {
 	return nil
 }
 
-func findListeningPIDs(port int) ([]int, error) {
-	cmd := exec.Command("lsof", "-tiTCP:"+strconv.Itoa(port), "-sTCP:LISTEN", "-n", "-P")
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) == 0 {
-			return nil, nil
-		}
-		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
-			return nil, fmt.Errorf("lsof not installed: required for service port management")
-		}
-		return nil, err
-	}
-
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var pids []int
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		pid, convErr := strconv.Atoi(line)
-		if convErr == nil && pid > 0 {
-			pids = append(pids, pid)
-		}
-	}
-	return pids, nil
-}
-
 func processGroupID(pid int) (int, error) {
-	pgid, err := syscall.Getpgid(pid)
+	pgid, err := procctl.GroupOf(pid)
 	if err != nil {
 		return 0, err
 	}
@@ -1320,7 +1292,7 @@ func stopProcessGroup(pid int) error {
 }
 
 func signalProcessUntilExit(pid, signalTarget int, termTimeout, killTimeout time.Duration) error {
-	_ = syscall.Kill(-signalTarget, syscall.SIGTERM)
+	_ = procctl.TerminateGroup(signalTarget)
 	deadline := time.Now().Add(termTimeout)
 	for time.Now().Before(deadline) {
 		if !processAlive(pid) {
@@ -1329,9 +1301,9 @@ func signalProcessUntilExit(pid, signalTarget int, termTimeout, killTimeout time
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	_ = syscall.Kill(-signalTarget, syscall.SIGKILL)
+	_ = procctl.KillGroup(signalTarget)
 	if signalTarget != pid {
-		_ = syscall.Kill(pid, syscall.SIGKILL)
+		_ = procctl.Kill(pid)
 	}
 	deadline = time.Now().Add(killTimeout)
 	for time.Now().Before(deadline) {
@@ -1347,7 +1319,7 @@ func processAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	return syscall.Kill(pid, 0) == nil
+	return procctl.Alive(pid)
 }
 
 func serviceLogPath(id string) string {
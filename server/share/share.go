@@ -0,0 +1,331 @@
+// Package share publishes a diff or review finding as a read-only link with an
+// expiry. The link carries an unguessable token and grants access to nothing else.
+package share
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+const (
+	KindDiff    = "diff"
+	KindFinding = "finding"
+
+	defaultTTL      = 24 * time.Hour
+	maxTTL          = 30 * 24 * time.Hour
+	maxContentBytes = 1 << 20
+
+	// ViewPath is the auth-exempt JSON endpoint; PagePath serves the HTML view.
+	ViewPath = "/api/share/view"
+	PagePath = "/share/"
+)
+
+// Share is one published snippet.
+type Share struct {
+	Token     string `json:"token"`
+	Kind      string `json:"kind"`
+	Title     string `json:"title,omitempty"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	User      string `json:"user,omitempty"` // auth.UserName of the creator
+}
+
+// URL is the path of the read-only page for the share.
+func (s Share) URL() string {
+	return PagePath + s.Token
+}
+
+func (s Share) expired(now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err != nil || !now.Before(t)
+}
+
+type store struct {
+	Shares []Share `json:"shares"`
+}
+
+// Manager stores shares in shares.json.
+type Manager struct {
+	mu   sync.Mutex
+	file *jsonfile.JSONFile[store]
+}
+
+var (
+	defaultManager *Manager
+	initOnce       sync.Once
+)
+
+// getManager returns the manager of shares.json in the data directory,
+// created on first use so the configured directory is used.
+func getManager() *Manager {
+	initOnce.Do(func() {
+		defaultManager = NewManager(filepath.Join(config.DataDir, "shares.json"))
+	})
+	return defaultManager
+}
+
+// NewManager creates a manager backed by the given file.
+func NewManager(path string) *Manager {
+	return &Manager{file: jsonfile.New[store](path)}
+}
+
+// Create publishes content for user and returns the new share.
+func (m *Manager) Create(user, kind, title, content string, ttl time.Duration) (Share, error) {
+	if kind != KindDiff && kind != KindFinding {
+		return Share{}, fmt.Errorf("kind must be %q or %q", KindDiff, KindFinding)
+	}
+	if strings.TrimSpace(content) == "" {
+		return Share{}, fmt.Errorf("content is required")
+	}
+	if len(content) > maxContentBytes {
+		return Share{}, fmt.Errorf("content exceeds %d bytes", maxContentBytes)
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	token, err := newToken()
+	if err != nil {
+		return Share{}, err
+	}
+	now := time.Now().UTC()
+	s := Share{
+		Token:     token,
+		Kind:      kind,
+		Title:     title,
+		Content:   content,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(ttl).Format(time.RFC3339),
+		User:      user,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err = m.file.Update(func(st *store) error {
+		st.Shares = append(pruneExpired(st.Shares, now), s)
+		return nil
+	})
+	if err != nil {
+		return Share{}, err
+	}
+	return s, nil
+}
+
+// Get returns an unexpired share by token.
+func (m *Manager) Get(token string) (Share, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, err := m.file.Get()
+	if err != nil {
+		return Share{}, false
+	}
+	now := time.Now()
+	for _, s := range st.Shares {
+		if s.Token == token && !s.expired(now) {
+			return s, true
+		}
+	}
+	return Share{}, false
+}
+
+// List returns user's unexpired shares, newest first.
+func (m *Manager) List(user string) []Share {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, err := m.file.Get()
+	if err != nil {
+		return []Share{}
+	}
+	active := pruneExpired(st.Shares, time.Now())
+	result := make([]Share, 0, len(active))
+	for i := len(active) - 1; i >= 0; i-- {
+		if active[i].User == user {
+			result = append(result, active[i])
+		}
+	}
+	return result
+}
+
+// Revoke deletes a share of user so its link stops working.
+func (m *Manager) Revoke(user, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := false
+	err := m.file.Update(func(st *store) error {
+		kept := st.Shares[:0]
+		for _, s := range st.Shares {
+			if s.Token == token && s.User == user {
+				found = true
+				continue
+			}
+			kept = append(kept, s)
+		}
+		st.Shares = kept
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+func pruneExpired(shares []Share, now time.Time) []Share {
+	var kept []Share
+	for _, s := range shares {
+		if !s.expired(now) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RegisterAPI registers share endpoints. ViewPath and PagePath must be
+// exempt from auth; the management endpoints under /api/shares are not, and
+// list and revoke only the shares of the signed-in user.
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/shares", handleShares)
+	mux.HandleFunc(ViewPath, handleView)
+	mux.HandleFunc(PagePath, handlePage)
+}
+
+type shareResponse struct {
+	Share
+	URL string `json:"url"`
+}
+
+func handleShares(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserName(r)
+	switch r.Method {
+	case http.MethodGet:
+		shares := getManager().List(user)
+		resp := make([]shareResponse, 0, len(shares))
+		for _, s := range shares {
+			resp = append(resp, shareResponse{Share: s, URL: s.URL()})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req struct {
+			Kind     string  `json:"kind"`
+			Title    string  `json:"title"`
+			Content  string  `json:"content"`
+			TTLHours float64 `json:"ttl_hours"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		s, err := getManager().Create(user, req.Kind, req.Title, req.Content, time.Duration(req.TTLHours*float64(time.Hour)))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, shareResponse{Share: s, URL: s.URL()})
+	case http.MethodDelete:
+		if err := getManager().Revoke(user, r.URL.Query().Get("token")); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handleView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	s, ok := getManager().Get(r.URL.Query().Get("token"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "share not found or expired"})
+		return
+	}
+	// viewers need not learn who shared it
+	s.User = ""
+	writeJSON(w, http.StatusOK, s)
+}
+
+var pageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Shared {{.Kind}}{{end}}</title>
+<style>
+body{font-family:-apple-system,sans-serif;margin:0;padding:12px;background:#0f172a;color:#e2e8f0}
+h1{font-size:16px;margin:0 0 4px}.meta{font-size:12px;color:#94a3b8;margin-bottom:12px}
+pre{font-size:12px;background:#1e293b;padding:8px;border-radius:6px;overflow-x:auto;white-space:pre}
+.add{color:#4ade80}.del{color:#f87171}.hunk{color:#60a5fa}
+</style></head><body>
+<h1>{{if .Title}}{{.Title}}{{else}}Shared {{.Kind}}{{end}}</h1>
+<div class="meta">Read-only · expires {{.ExpiresAt}}</div>
+<pre>{{range .Lines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>
+</body></html>`))
+
+type pageLine struct {
+	Class string
+	Text  string
+}
+
+func handlePage(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, PagePath)
+	s, ok := getManager().Get(token)
+	if !ok {
+		http.Error(w, "share not found or expired", http.StatusNotFound)
+		return
+	}
+	var lines []pageLine
+	for _, text := range strings.Split(strings.TrimRight(s.Content, "\n"), "\n") {
+		class := ""
+		if s.Kind == KindDiff {
+			switch {
+			case strings.HasPrefix(text, "@@"):
+				class = "hunk"
+			case strings.HasPrefix(text, "+") && !strings.HasPrefix(text, "+++"):
+				class = "add"
+			case strings.HasPrefix(text, "-") && !strings.HasPrefix(text, "---"):
+				class = "del"
+			}
+		}
+		lines = append(lines, pageLine{Class: class, Text: text})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	pageTemplate.Execute(w, struct {
+		Share
+		Lines []pageLine
+	}{s, lines})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
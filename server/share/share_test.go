@@ -0,0 +1,102 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func TestManagerLifecycle(t *testing.T) {
+	m := NewManager(filepath.Join(t.TempDir(), "shares.json"))
+
+	if _, err := m.Create("alice", "secret", "", "x", 0); err == nil {
+		t.Fatalf("unknown kind accepted")
+	}
+	s, err := m.Create("alice", KindDiff, "fix", "@@ -1 +1 @@\n-a\n+b\n", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Token) != 32 || s.URL() != "/share/"+s.Token {
+		t.Fatalf("unexpected share: %+v", s)
+	}
+	if got, ok := m.Get(s.Token); !ok || got.Content != s.Content {
+		t.Fatalf("Get(%q) = %+v, %v", s.Token, got, ok)
+	}
+	if _, ok := m.Get("nope"); ok {
+		t.Fatalf("Get of unknown token succeeded")
+	}
+
+	expired, err := m.Create("alice", KindFinding, "", "finding", time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := m.Get(expired.Token); ok {
+		t.Fatalf("expired share still readable")
+	}
+	if list := m.List("alice"); len(list) != 1 || list[0].Token != s.Token {
+		t.Fatalf("List(alice) = %+v", list)
+	}
+	if list := m.List("bob"); len(list) != 0 {
+		t.Fatalf("List(bob) = %+v", list)
+	}
+
+	if err := m.Revoke("bob", s.Token); err == nil {
+		t.Fatalf("bob revoked alice's share")
+	}
+	if err := m.Revoke("alice", s.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get(s.Token); ok {
+		t.Fatalf("revoked share still readable")
+	}
+}
+
+func TestHandleSharesScopedToCreator(t *testing.T) {
+	dataDir := config.DataDir
+	t.Cleanup(func() { config.DataDir = dataDir })
+	config.DataDir = t.TempDir()
+
+	as := func(user, method, url, body string) *httptest.ResponseRecorder {
+		ctx := auth.WithIdentity(context.Background(), &auth.Identity{User: user, Role: auth.RoleMember})
+		req := httptest.NewRequest(method, url, strings.NewReader(body)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		handleShares(rec, req)
+		return rec
+	}
+
+	rec := as("alice", http.MethodPost, "/api/shares", `{"kind":"diff","content":"+a\n"}`)
+	var created Share
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Token == "" {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(filepath.Join(config.DataDir, "shares.json")); err != nil {
+		t.Fatalf("shares not kept in the configured data dir: %v", err)
+	}
+
+	tests := []struct {
+		user, method, url string
+		wantCode          int
+		wantBody          string
+	}{
+		{"bob", http.MethodGet, "/api/shares", http.StatusOK, "[]\n"},
+		{"bob", http.MethodDelete, "/api/shares?token=" + created.Token, http.StatusNotFound, ""},
+		{"alice", http.MethodGet, "/api/shares", http.StatusOK, created.Token},
+		{"alice", http.MethodDelete, "/api/shares?token=" + created.Token, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := as(tt.user, tt.method, tt.url, "")
+		if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s %s %s: %d %s", tt.user, tt.method, tt.url, rec.Code, rec.Body)
+		}
+	}
+}
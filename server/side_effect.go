@@ -5,23 +5,25 @@ import (
 	"time"
 
 	opencode_exposed "github.com/xhd2015/ai-critic/server/agents/opencode/exposed_opencode"
-	"github.com/xhd2015/ai-critic/server/cloudflare/unified_tunnel"
 	"github.com/xhd2015/ai-critic/server/domains"
 	"github.com/xhd2015/ai-critic/server/exposedurls"
 	"github.com/xhd2015/ai-critic/server/proxy/wsproxy"
 	"github.com/xhd2015/ai-critic/server/crontasks"
+	"github.com/xhd2015/ai-critic/server/scheduler"
 	"github.com/xhd2015/ai-critic/server/services"
 	"github.com/xhd2015/ai-critic/server/startup"
+	"github.com/xhd2015/ai-critic/server/uptime"
 	"github.com/xhd2015/ai-critic/server/usage"
 )
 
 func RunBackgroundTasks() {
 	fmt.Printf("[auto-task] Running background tasks\n")
 	opencode_exposed.StartHealthCheck()
-	unified_tunnel.StartGlobalHealthChecks()
 	services.StartHealthCheck()
 	crontasks.Start()
+	scheduler.Start()
 	usage.Start()
+	uptime.Start()
 }
 
 func runExtensionWork() {
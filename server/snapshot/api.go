@@ -0,0 +1,72 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/tenant"
+)
+
+// RegisterAPI registers the snapshot endpoints. The dir of a snapshot is
+// browsed and searched like a project: /api/files?project_dir=,
+// /api/files/content and /api/search?dir=.
+//
+//	GET    /api/snapshots                              -> [Snapshot], most recently used first
+//	POST   /api/snapshots {dir, ref}                   -> Snapshot
+//	POST   /api/snapshots {dir, project, checkpoint}   -> Snapshot
+//	DELETE /api/snapshots/{id}
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/snapshots", handleSnapshots)
+	mux.HandleFunc("/api/snapshots/", handleSnapshot)
+}
+
+func handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	owner := tenant.Name(r.Context())
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, List(owner))
+	case http.MethodPost:
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		s, err := Create(owner, req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/snapshots/")
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if err := Remove(tenant.Name(r.Context()), id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
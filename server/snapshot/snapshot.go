@@ -0,0 +1,424 @@
+// Package snapshot materializes read-only copies of a project as it was at a
+// commit or a checkpoint, so the file browser and search can show what the
+// tree looked like before an agent ran without touching the working tree.
+//
+// A snapshot is extracted with git archive into its own directory under
+// config.SnapshotsDir. It is not a git worktree, so the repository's
+// worktrees, refs and index are left alone; submodules are not included.
+// Files and directories are made read-only, and a snapshot is removed once
+// it has not been asked for within TTL. Directories left over by an earlier
+// server run are removed on first use.
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/checkpoint"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+const (
+	// TTL is how long a snapshot is kept after it was last asked for.
+	TTL = 30 * time.Minute
+	// MaxPerOwner bounds the snapshots of one owner; creating another
+	// removes the least recently used.
+	MaxPerOwner = 8
+)
+
+// ErrNotFound is returned for an unknown snapshot ID.
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot is a materialized, read-only copy of a project.
+type Snapshot struct {
+	ID      string `json:"id"`
+	RepoDir string `json:"repo_dir"`
+	// Ref is what was asked for: a commit, branch or tag, or empty for a
+	// checkpoint.
+	Ref string `json:"ref,omitempty"`
+	// Commit is the full hash the snapshot was extracted from.
+	Commit string `json:"commit"`
+	// Project and Checkpoint name the checkpoint whose files were laid
+	// over Commit.
+	Project    string `json:"project,omitempty"`
+	Checkpoint int    `json:"checkpoint,omitempty"`
+	// Dir is the snapshot; pass it as the directory to the file and search
+	// endpoints.
+	Dir       string `json:"dir"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	// Note explains where the snapshot may differ from the real tree.
+	Note string `json:"note,omitempty"`
+
+	owner string
+	used  time.Time
+	timer *time.Timer
+}
+
+// Request selects what to materialize: Ref, or the checkpoint Checkpoint
+// of Project.
+type Request struct {
+	Dir        string `json:"dir"`
+	Ref        string `json:"ref"`
+	Project    string `json:"project"`
+	Checkpoint int    `json:"checkpoint"`
+}
+
+var (
+	mu        sync.Mutex
+	snapshots = map[string]*Snapshot{}
+	// baseDir holds the snapshot directories; tests point it elsewhere.
+	baseDir   = config.SnapshotsDir
+	sweepOnce sync.Once
+)
+
+// Create materializes req for owner, or returns the existing snapshot of the
+// same commit and checkpoint, extending its lifetime.
+func Create(owner string, req Request) (*Snapshot, error) {
+	if req.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	if (req.Ref == "") == (req.Checkpoint == 0) {
+		return nil, fmt.Errorf("exactly one of ref and checkpoint is required")
+	}
+	sweepOnce.Do(sweepLeftovers)
+
+	s := &Snapshot{RepoDir: req.Dir, Ref: req.Ref, owner: owner}
+	var cp *checkpoint.Checkpoint
+	ref := req.Ref
+	if req.Checkpoint != 0 {
+		if req.Project == "" {
+			return nil, fmt.Errorf("project is required for a checkpoint")
+		}
+		var err error
+		if cp, err = checkpoint.GetCheckpoint(req.Project, req.Checkpoint); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		s.Project, s.Checkpoint = req.Project, req.Checkpoint
+		ref = cp.Commit
+		if ref == "" {
+			ref = "HEAD"
+			s.Note = "the checkpoint predates recording its commit; its files are laid over the current HEAD"
+		}
+	}
+	commit, err := resolveCommit(req.Dir, ref)
+	if err != nil {
+		return nil, err
+	}
+	s.Commit = commit
+
+	if existing := reuse(s); existing != nil {
+		return existing, nil
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s.ID = id
+	s.Dir = filepath.Join(baseDir, id)
+	if abs, err := filepath.Abs(s.Dir); err == nil {
+		s.Dir = abs
+	}
+	if err := extract(req.Dir, commit, s.Dir); err != nil {
+		removeDir(s.Dir)
+		return nil, err
+	}
+	if cp != nil {
+		if err := overlay(cp, req.Project, s.Dir); err != nil {
+			removeDir(s.Dir)
+			return nil, err
+		}
+	}
+	if err := makeReadOnly(s.Dir); err != nil {
+		removeDir(s.Dir)
+		return nil, err
+	}
+
+	now := time.Now()
+	s.CreatedAt = now.UTC().Format(time.RFC3339)
+	mu.Lock()
+	defer mu.Unlock()
+	snapshots[s.ID] = s
+	touch(s, now)
+	evict(owner)
+	return s, nil
+}
+
+// List returns owner's snapshots, most recently used first.
+func List(owner string) []*Snapshot {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []*Snapshot{}
+	for _, s := range snapshots {
+		if s.owner == owner {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].used.After(list[j].used) })
+	return list
+}
+
+// Remove deletes a snapshot of owner.
+func Remove(owner, id string) error {
+	mu.Lock()
+	s, ok := snapshots[id]
+	if !ok || s.owner != owner {
+		mu.Unlock()
+		return ErrNotFound
+	}
+	drop(s)
+	mu.Unlock()
+	return removeDir(s.Dir)
+}
+
+// reuse returns the live snapshot equal to s, touched, if there is one.
+func reuse(s *Snapshot) *Snapshot {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range snapshots {
+		if e.owner == s.owner && e.RepoDir == s.RepoDir && e.Commit == s.Commit &&
+			e.Project == s.Project && e.Checkpoint == s.Checkpoint {
+			touch(e, time.Now())
+			return e
+		}
+	}
+	return nil
+}
+
+// touch marks s used at now and (re)arms its expiry. mu must be held.
+func touch(s *Snapshot, now time.Time) {
+	s.used = now
+	s.ExpiresAt = now.Add(TTL).UTC().Format(time.RFC3339)
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	id := s.ID
+	s.timer = time.AfterFunc(TTL, func() {
+		mu.Lock()
+		e, ok := snapshots[id]
+		expired := ok && time.Since(e.used) >= TTL
+		if expired {
+			drop(e)
+		}
+		mu.Unlock()
+		if expired {
+			removeDir(e.Dir)
+		}
+	})
+}
+
+// evict removes owner's least recently used snapshots beyond MaxPerOwner.
+// mu must be held.
+func evict(owner string) {
+	var own []*Snapshot
+	for _, s := range snapshots {
+		if s.owner == owner {
+			own = append(own, s)
+		}
+	}
+	if len(own) <= MaxPerOwner {
+		return
+	}
+	sort.Slice(own, func(i, j int) bool { return own[i].used.Before(own[j].used) })
+	for _, s := range own[:len(own)-MaxPerOwner] {
+		drop(s)
+		go removeDir(s.Dir)
+	}
+}
+
+// drop forgets s. mu must be held.
+func drop(s *Snapshot) {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	delete(snapshots, s.ID)
+}
+
+// sweepLeftovers removes the snapshots of earlier server runs, which are
+// no longer tracked.
+func sweepLeftovers() {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		removeDir(filepath.Join(baseDir, e.Name()))
+	}
+}
+
+func resolveCommit(dir, ref string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref: %s", ref)
+	}
+	out, err := gitrunner.RevParse("--verify", "--quiet", ref+"^{commit}").Dir(dir).Output()
+	if err != nil {
+		if !gitrunner.IsRepo(dir) {
+			return "", fmt.Errorf("not a git repository: %s", dir)
+		}
+		return "", fmt.Errorf("%w: no commit %s", ErrNotFound, ref)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// extract writes the tree of commit into dir.
+func extract(repoDir, commit, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	cmd := gitrunner.NewCommand("archive", "--format=tar", commit).Dir(repoDir).Exec()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	untarErr := untar(stdout, dir)
+	// drain what untar left so git can exit
+	io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return untarErr
+}
+
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(h.Name) {
+			continue
+		}
+		p := filepath.Join(dir, h.Name)
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, 0755)
+		case tar.TypeReg:
+			err = writeFile(p, tr, os.FileMode(h.Mode)&0755)
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+				err = os.Symlink(h.Linkname, p)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(p string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// overlay lays the files of cp over the extracted commit in dir.
+func overlay(cp *checkpoint.Checkpoint, project, dir string) error {
+	for _, f := range cp.Files {
+		if !filepath.IsLocal(f.Path) {
+			continue
+		}
+		p := filepath.Join(dir, f.Path)
+		if f.Status == "deleted" {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		content, err := checkpoint.GetCheckpointFileContent(project, cp.ID, f.Path)
+		if err != nil {
+			return fmt.Errorf("checkpoint file %s: %v", f.Path, err)
+		}
+		mode := os.FileMode(0644)
+		if st, err := os.Stat(p); err == nil {
+			mode = st.Mode().Perm()
+		}
+		os.Remove(p) // replaces a symlink rather than writing through it
+		if err := writeFile(p, strings.NewReader(content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeReadOnly removes the write permission from everything under dir,
+// directories last so their contents can still be changed until then.
+func makeReadOnly(dir string) error {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.Chmod(p, info.Mode().Perm()&^0222)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i], 0555); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDir deletes a snapshot directory, making it writable first.
+func removeDir(dir string) error {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(p, 0755)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
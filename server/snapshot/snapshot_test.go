@@ -0,0 +1,169 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/checkpoint"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func write(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	os.MkdirAll(filepath.Dir(p), 0755)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
+
+// setup makes a repository with two commits and isolates the snapshot and
+// checkpoint storage.
+func setup(t *testing.T) (repo, first string) {
+	t.Chdir(t.TempDir()) // checkpoints live under the working directory
+	saved := baseDir
+	baseDir = t.TempDir()
+	t.Cleanup(func() {
+		for _, s := range List("") {
+			Remove("", s.ID)
+		}
+		baseDir = saved
+	})
+
+	repo = t.TempDir()
+	git(t, repo, "init", "-q")
+	write(t, repo, "main.go", "package main // v1\n")
+	write(t, repo, "pkg/util.go", "package pkg\n")
+	git(t, repo, "add", ".")
+	git(t, repo, "commit", "-q", "-m", "v1")
+	first = git(t, repo, "rev-parse", "HEAD")
+	write(t, repo, "main.go", "package main // v2\n")
+	git(t, repo, "rm", "-q", "pkg/util.go")
+	git(t, repo, "commit", "-q", "-am", "v2")
+	return repo, first
+}
+
+func TestCommitSnapshot(t *testing.T) {
+	repo, first := setup(t)
+
+	s, err := Create("", Request{Dir: repo, Ref: "HEAD~1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Commit != first || read(s.Dir, "main.go") != "package main // v1\n" || read(s.Dir, "pkg/util.go") != "package pkg\n" {
+		t.Errorf("snapshot %+v: main.go %q", s, read(s.Dir, "main.go"))
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, "main.go"), []byte("x"), 0644); err == nil && os.Geteuid() != 0 {
+		t.Error("snapshot file is writable")
+	}
+	if read(repo, "main.go") != "package main // v2\n" || git(t, repo, "worktree", "list", "--porcelain") != "worktree "+repo+"\nHEAD "+git(t, repo, "rev-parse", "HEAD")+"\nbranch "+git(t, repo, "symbolic-ref", "HEAD") {
+		t.Error("the repository was changed")
+	}
+
+	// the same commit by another name is the same snapshot
+	again, err := Create("", Request{Dir: repo, Ref: first})
+	if err != nil || again.ID != s.ID {
+		t.Errorf("again = %+v, %v", again, err)
+	}
+	if _, err := Create("other", Request{Dir: repo, Ref: first}); err != nil || len(List("")) != 1 || len(List("other")) != 1 {
+		t.Errorf("owners: %v, %d/%d", err, len(List("")), len(List("other")))
+	}
+	Remove("other", List("other")[0].ID)
+
+	if _, err := Create("", Request{Dir: repo, Ref: "nope"}); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("unknown ref: %v", err)
+	}
+	if _, err := Create("", Request{Dir: repo, Ref: "--output=x"}); err == nil {
+		t.Error("option accepted as ref")
+	}
+
+	if err := Remove("", s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.Dir); !os.IsNotExist(err) || len(List("")) != 0 {
+		t.Errorf("after remove: %v, %d", err, len(List("")))
+	}
+}
+
+func TestCheckpointSnapshot(t *testing.T) {
+	repo, _ := setup(t)
+	head := git(t, repo, "rev-parse", "HEAD")
+
+	// the agent's changes on top of HEAD, then it continues
+	write(t, repo, "main.go", "package main // agent\n")
+	write(t, repo, "new.go", "package main // new\n")
+	if _, err := checkpoint.CreateCheckpoint("app", checkpoint.CreateCheckpointRequest{ProjectDir: repo, FilePaths: []string{"main.go", "new.go"}}); err != nil {
+		t.Fatal(err)
+	}
+	write(t, repo, "main.go", "package main // later\n")
+	git(t, repo, "commit", "-q", "-am", "later")
+
+	s, err := Create("", Request{Dir: repo, Project: "app", Checkpoint: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Commit != head || s.Note != "" || read(s.Dir, "main.go") != "package main // agent\n" || read(s.Dir, "new.go") != "package main // new\n" {
+		t.Errorf("snapshot %+v: main.go %q new.go %q", s, read(s.Dir, "main.go"), read(s.Dir, "new.go"))
+	}
+	if _, err := Create("", Request{Dir: repo, Project: "app", Checkpoint: 9}); err == nil {
+		t.Error("unknown checkpoint accepted")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	repo, first := setup(t)
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/snapshots", `{"dir":"`+repo+`","ref":"`+first+`"}`)
+	var s Snapshot
+	json.Unmarshal(rec.Body.Bytes(), &s)
+	if rec.Code != http.StatusOK || s.Commit != first || s.Dir == "" || s.ExpiresAt == "" {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/api/snapshots", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), s.ID) {
+		t.Errorf("list: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/snapshots", `{"dir":"`+repo+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("no ref: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/snapshots", `{"dir":"`+repo+`","ref":"nope"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown ref: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/api/snapshots/"+s.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("delete: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/api/snapshots/"+s.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete again: %d", rec.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RegisterAPI registers the storage endpoints:
+//
+//	GET  /api/storage/settings   current settings, secrets masked
+//	POST /api/storage/settings   update; omitted fields are left unchanged
+//	POST /api/storage/test       round-trip a probe object through the backend
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/storage/settings", handleSettings)
+	mux.HandleFunc("/api/storage/test", handleTest)
+}
+
+// settingsRequest mirrors Settings with optional fields for partial updates.
+type settingsRequest struct {
+	Backend *string `json:"backend"`
+	S3      *struct {
+		Endpoint        *string `json:"endpoint"`
+		Region          *string `json:"region"`
+		Bucket          *string `json:"bucket"`
+		Prefix          *string `json:"prefix"`
+		AccessKeyID     *string `json:"access_key_id"`
+		SecretAccessKey *string `json:"secret_access_key"`
+	} `json:"s3"`
+}
+
+func (req *settingsRequest) apply(s *Settings) {
+	set := func(dst *string, v *string) {
+		if v != nil {
+			*dst = strings.TrimSpace(*v)
+		}
+	}
+	set(&s.Backend, req.Backend)
+	if c := req.S3; c != nil {
+		set(&s.S3.Endpoint, c.Endpoint)
+		set(&s.S3.Region, c.Region)
+		set(&s.S3.Bucket, c.Bucket)
+		set(&s.S3.Prefix, c.Prefix)
+		set(&s.S3.AccessKeyID, c.AccessKeyID)
+		// a form that round-trips the masked value keeps the saved secret
+		if c.SecretAccessKey == nil || s.S3.SecretAccessKey == "" || *c.SecretAccessKey != maskSecret(s.S3.SecretAccessKey) {
+			set(&s.S3.SecretAccessKey, c.SecretAccessKey)
+		}
+	}
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", len(s)-8) + s[len(s)-4:]
+}
+
+func settingsView(s Settings) Settings {
+	s.S3.SecretAccessKey = maskSecret(s.S3.SecretAccessKey)
+	if s.Backend == "" {
+		s.Backend = BackendLocal
+	}
+	return s
+}
+
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req settingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		err := settingsFile.Update(func(s *Settings) error {
+			next := *s
+			req.apply(&next)
+			if err := next.Validate(); err != nil {
+				return err
+			}
+			*s = next
+			return nil
+		})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, settingsView(GetSettings()))
+}
+
+// handleTest writes, reads back and deletes a small object with the saved
+// settings, or with the settings in the request body when given (so a form
+// can be checked before saving).
+func handleTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	s := GetSettings()
+	var req settingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	req.apply(&s)
+	if err := s.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if s.Backend != BackendS3 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no remote backend configured"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := probe(ctx, NewS3(s.S3)); err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ok": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"latency_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+func probe(ctx context.Context, b Backend) error {
+	key := fmt.Sprintf(".probe/%d", time.Now().UnixNano())
+	data := []byte("ai-critic storage probe")
+	if err := b.Put(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	defer b.Delete(context.Background(), key)
+	rc, err := b.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, data) {
+		return fmt.Errorf("read back %d bytes that differ from what was written", len(got))
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,118 @@
+// Package storage moves large artifacts (machine backup archives, ...) off
+// the local disk into an optional S3-compatible bucket (AWS S3, MinIO, R2,
+// ...). Callers keep their existing APIs: they hand a finished file to
+// Offload and later read it back with Open, whichever backend holds it.
+//
+// Without configuration everything stays on disk and Remote reports false.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+)
+
+// Backend names accepted in Settings.Backend.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Settings selects where large artifacts are stored.
+type Settings struct {
+	// Backend is "local" (the default when empty) or "s3".
+	Backend string   `json:"backend,omitempty"`
+	S3      S3Config `json:"s3"`
+}
+
+// S3Config addresses an S3-compatible bucket. Requests use path-style URLs
+// ({endpoint}/{bucket}/{key}), which every S3-compatible server accepts.
+type S3Config struct {
+	// Endpoint is the server URL, e.g. "https://s3.us-east-1.amazonaws.com"
+	// or "http://127.0.0.1:9000" for a local MinIO.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region defaults to us-east-1, which MinIO accepts.
+	Region string `json:"region,omitempty"`
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix is prepended to every key, e.g. "ai-critic/".
+	Prefix          string `json:"prefix,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+// Backend stores objects by key.
+type Backend interface {
+	Name() string
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get returns the object's content; the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var settingsFile = jsonfile.New[Settings](config.DataDir + "/storage.json")
+
+// GetSettings returns the saved storage settings.
+func GetSettings() Settings {
+	s, err := settingsFile.Get()
+	if err != nil {
+		return Settings{}
+	}
+	return s
+}
+
+// Validate reports missing or invalid fields for the selected backend.
+func (s Settings) Validate() error {
+	switch s.Backend {
+	case "", BackendLocal:
+		return nil
+	case BackendS3:
+		c := s.S3
+		if c.Endpoint == "" || c.Bucket == "" {
+			return fmt.Errorf("s3 endpoint and bucket are required")
+		}
+		if !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+			return fmt.Errorf("s3 endpoint must start with http:// or https://")
+		}
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return fmt.Errorf("s3 access key id and secret access key are required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown storage backend: %s", s.Backend)
+	}
+}
+
+// Remote returns the configured remote backend, or false when artifacts
+// stay on the local disk.
+func Remote() (Backend, bool) {
+	s := GetSettings()
+	if s.Backend != BackendS3 || s.Validate() != nil {
+		return nil, false
+	}
+	return NewS3(s.S3), true
+}
+
+// Offload uploads the file at localPath to backend under key and removes
+// the local copy. On error the local file is left in place.
+func Offload(ctx context.Context, backend Backend, localPath, key string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = backend.Put(ctx, key, f, info.Size())
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("upload %s to %s: %w", key, backend.Name(), err)
+	}
+	return os.Remove(localPath)
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory object store that checks requests are signed.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") ||
+		r.Header.Get("x-amz-date") == "" {
+		http.Error(w, "<Error><Message>unsigned request</Message></Error>", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Message>The specified key does not exist.</Message></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, S3Config) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, S3Config{Endpoint: srv.URL + "/", Bucket: "bkt", Prefix: "p/", AccessKeyID: "AKID", SecretAccessKey: "secret"}
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	b := NewS3(cfg)
+	ctx := context.Background()
+
+	if err := probe(ctx, b); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Fatalf("probe left objects behind: %v", fake.objects)
+	}
+
+	_, err := b.Get(ctx, "missing")
+	if err == nil || !strings.Contains(err.Error(), "The specified key does not exist.") {
+		t.Fatalf("Get(missing) error = %v", err)
+	}
+}
+
+func TestOffloadRemovesLocalFile(t *testing.T) {
+	fake, cfg := newFakeS3(t)
+	b := NewS3(cfg)
+	path := filepath.Join(t.TempDir(), "archive.tar.xz")
+	os.WriteFile(path, []byte("archive"), 0644)
+
+	if err := Offload(context.Background(), b, path, "machine-backups/a b.tar.xz"); err != nil {
+		t.Fatalf("Offload: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("local file still present: %v", err)
+	}
+	if got := string(fake.objects["/bkt/p/machine-backups/a b.tar.xz"]); got != "archive" {
+		t.Fatalf("stored object = %q, objects: %v", got, fake.objects)
+	}
+
+	// a failed upload keeps the local file
+	os.WriteFile(path, []byte("archive"), 0644)
+	bad := NewS3(S3Config{Endpoint: cfg.Endpoint, Bucket: "bkt", AccessKeyID: "wrong", SecretAccessKey: "x"})
+	if err := Offload(context.Background(), bad, path, "k"); err == nil {
+		t.Fatalf("Offload with bad credentials succeeded")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("local file removed after a failed upload: %v", err)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := map[string]string{
+		"bkt/dir/file.tar.xz": "bkt/dir/file.tar.xz",
+		"bkt/a b+c=d@e":       "bkt/a%20b%2Bc%3Dd%40e",
+		"bkt/ü~":              "bkt/%C3%BC~",
+	}
+	for in, want := range tests {
+		if got := escapePath(in); got != want {
+			t.Errorf("escapePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	full := S3Config{Endpoint: "https://s3.example.com", Bucket: "b", AccessKeyID: "a", SecretAccessKey: "s"}
+	tests := []struct {
+		name    string
+		s       Settings
+		wantErr bool
+	}{
+		{"default local", Settings{}, false},
+		{"s3 complete", Settings{Backend: BackendS3, S3: full}, false},
+		{"s3 missing bucket", Settings{Backend: BackendS3, S3: S3Config{Endpoint: full.Endpoint, AccessKeyID: "a", SecretAccessKey: "s"}}, true},
+		{"s3 endpoint without scheme", Settings{Backend: BackendS3, S3: S3Config{Endpoint: "s3.example.com", Bucket: "b", AccessKeyID: "a", SecretAccessKey: "s"}}, true},
+		{"unknown backend", Settings{Backend: "gcs"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -8,8 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"sync"
-	"syscall"
 	"time"
+
+	"github.com/xhd2015/ai-critic/server/procctl"
 )
 
 // Manager manages multiple subprocesses
@@ -91,11 +92,7 @@ func (m *Manager) StartProcess(id string, name string, cmd *exec.Cmd, healthChec
 	}
 
 	// Create process group so it won't receive parent's signals
-	if cmd.SysProcAttr == nil {
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
-	}
-	cmd.SysProcAttr.Setpgid = true
-	cmd.SysProcAttr.Pgid = 0
+	procctl.NewGroup(cmd)
 
 	process := &Process{
 		ID:            id,
@@ -163,7 +160,7 @@ func (m *Manager) monitorProcess(p *Process) {
 
 		// Kill the entire process group
 		if p.Cmd.Process != nil {
-			syscall.Kill(-p.Cmd.Process.Pid, syscall.SIGTERM)
+			procctl.TerminateGroup(p.Cmd.Process.Pid)
 
 			// Wait for graceful shutdown
 			select {
@@ -172,7 +169,7 @@ func (m *Manager) monitorProcess(p *Process) {
 			case <-time.After(5 * time.Second):
 				// Force kill after timeout
 				if p.Cmd.Process != nil {
-					syscall.Kill(-p.Cmd.Process.Pid, syscall.SIGKILL)
+					procctl.KillGroup(p.Cmd.Process.Pid)
 				}
 				<-done
 			}
@@ -193,7 +190,7 @@ func (m *Manager) monitorProcess(p *Process) {
 		m.mu.Unlock()
 
 		if p.Cmd.Process != nil {
-			syscall.Kill(-p.Cmd.Process.Pid, syscall.SIGTERM)
+			procctl.TerminateGroup(p.Cmd.Process.Pid)
 			<-done
 		}
 
@@ -299,7 +296,7 @@ func (m *Manager) StopAll() {
 			case <-time.After(10 * time.Second):
 				// Force kill if needed
 				if proc.Cmd.Process != nil {
-					syscall.Kill(-proc.Cmd.Process.Pid, syscall.SIGKILL)
+					procctl.KillGroup(proc.Cmd.Process.Pid)
 				}
 			}
 		}(p)
@@ -0,0 +1,73 @@
+// Package tenant isolates the data of member users on a shared instance.
+//
+// A member (auth.RoleMember) gets a namespace under DataDir/tenants/<user>
+// that mirrors the layout of DataDir itself: their project registry,
+// settings and other per-user files live there instead of in the global
+// files. Admins, reviewers, credentials-file tokens and unauthenticated
+// requests (quicktest, local CLI) keep using the global data directory.
+package tenant
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+// Name returns the tenant of the request's identity, or "" for the global
+// namespace.
+func Name(ctx context.Context) string {
+	id := auth.FromContext(ctx)
+	if id == nil || id.Role != auth.RoleMember {
+		return ""
+	}
+	return id.User
+}
+
+// Dir returns the data directory of the request's tenant: DataDir itself
+// for the global namespace.
+func Dir(ctx context.Context) string {
+	return DirOf(Name(ctx))
+}
+
+// DirOf returns the data directory of the named tenant.
+func DirOf(name string) string {
+	if name == "" {
+		return config.DataDir
+	}
+	return filepath.Join(config.DataDir, "tenants", safeName(name))
+}
+
+// Path maps a path under DataDir (e.g. config.ProjectsFile) into the
+// request's tenant namespace. Paths outside DataDir are returned unchanged.
+func Path(ctx context.Context, path string) string {
+	return PathOf(Name(ctx), path)
+}
+
+// PathOf is Path for a tenant name.
+func PathOf(name, path string) string {
+	if name == "" {
+		return path
+	}
+	rel, err := filepath.Rel(config.DataDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(DirOf(name), rel)
+}
+
+// safeName keeps a user name from escaping the tenants directory.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
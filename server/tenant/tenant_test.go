@@ -0,0 +1,40 @@
+package tenant
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/xhd2015/ai-critic/server/auth"
+	"github.com/xhd2015/ai-critic/server/config"
+)
+
+func TestPath(t *testing.T) {
+	projects := config.DataDir + "/projects.json"
+	tenants := filepath.Join(config.DataDir, "tenants")
+
+	tests := []struct {
+		name string
+		id   *auth.Identity
+		path string
+		want string
+	}{
+		{"unauthenticated", nil, projects, projects},
+		{"admin", &auth.Identity{User: "bob", Role: auth.RoleAdmin}, projects, projects},
+		{"reviewer", &auth.Identity{User: "alice", Role: auth.RoleReviewer}, projects, projects},
+		{"member", &auth.Identity{User: "carol", Role: auth.RoleMember}, projects, filepath.Join(tenants, "carol", "projects.json")},
+		{"member nested", &auth.Identity{User: "carol", Role: auth.RoleMember}, config.DataDir + "/projects/x/y.json", filepath.Join(tenants, "carol", "projects", "x", "y.json")},
+		{"member outside data dir", &auth.Identity{User: "carol", Role: auth.RoleMember}, "/etc/hosts", "/etc/hosts"},
+		{"member name with slashes", &auth.Identity{User: "../evil", Role: auth.RoleMember}, projects, filepath.Join(tenants, ".._evil", "projects.json")},
+		{"member named dot-dot", &auth.Identity{User: "..", Role: auth.RoleMember}, projects, filepath.Join(tenants, "_..", "projects.json")},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.id != nil {
+			ctx = auth.WithIdentity(ctx, tt.id)
+		}
+		if got := Path(ctx, tt.path); got != tt.want {
+			t.Errorf("%s: Path(%q) = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
@@ -34,6 +34,12 @@ type TerminalConfig struct {
 	Shell      string   `json:"shell,omitempty"`       // shell path or name (default: "bash")
 	ShellFlags []string `json:"shell_flags,omitempty"` // shell flags (default: ["-i"])
 	PS1        string   `json:"ps1,omitempty"`         // custom PS1 prompt string
+	// ScrollbackLines is how much recent output the scrollback endpoint
+	// returns by default (default: DefaultScrollbackLines).
+	ScrollbackLines int `json:"scrollback_lines,omitempty"`
+	// KillOnDisconnect ends a shell when the client that opened it
+	// disconnects, instead of keeping it for reconnects.
+	KillOnDisconnect bool `json:"kill_on_disconnect,omitempty"`
 }
 
 // LoadConfig reads the terminal config from disk.
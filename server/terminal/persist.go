@@ -0,0 +1,196 @@
+package terminal
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+	"github.com/xhd2015/dot-pkgs/go-pkgs/shell/ptywrap"
+)
+
+// DefaultScrollbackLines is the scrollback returned for a session when the
+// config sets none.
+const DefaultScrollbackLines = 5000
+
+// closeDelete is the close code a client sends to end the session along with
+// its connection, as ptywrap's own handler accepts.
+const closeDelete = 4000
+
+// killOnDisconnect reports whether sessions end when their first client
+// disconnects, which is ptywrap's behavior.
+func killOnDisconnect() bool {
+	cfg, err := LoadConfig()
+	return err == nil && cfg.KillOnDisconnect
+}
+
+// scrollbackLines returns the configured scrollback size in lines.
+func scrollbackLines() int {
+	cfg, err := LoadConfig()
+	if err != nil || cfg.ScrollbackLines <= 0 {
+		return DefaultScrollbackLines
+	}
+	return cfg.ScrollbackLines
+}
+
+// sessionExists reports whether mgr has a session id; Scrollback returns a
+// non-nil copy for every session, even one with no output yet.
+func sessionExists(mgr *ptywrap.Manager, id string) bool {
+	return mgr.Scrollback(id) != nil
+}
+
+// handleTerminalWebSocket serves /api/terminal like
+// ptywrap.HandleTerminalWebSocket, attaching to session_id if it exists and
+// starting a shell otherwise, if the exec policy allows it, but the shell
+// outlives the connection: see serveAttached. The policy only sees the
+// shell's launch argv; the command lines typed into it are not checked.
+func handleTerminalWebSocket(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Manager) {
+	q := r.URL.Query()
+	sessionID := q.Get("session_id")
+	newSession := sessionID == "" || !sessionExists(mgr, sessionID)
+	if killOnDisconnect() {
+		if newSession {
+			if err := execpolicy.Authorize(r, execpolicy.SourceTerminal, shellArgv(mgr), q.Get("cwd")); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		ptywrap.HandleTerminalWebSocket(w, r, mgr)
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Failed to upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	if newSession {
+		if err := execpolicy.Authorize(r, execpolicy.SourceTerminal, shellArgv(mgr), q.Get("cwd")); err != nil {
+			conn.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
+			conn.Close()
+			return
+		}
+		name := q.Get("name")
+		if name == "" {
+			name = "Terminal"
+		}
+		info, err := mgr.CreateCommand(name, q.Get("cwd"), nil)
+		if err != nil {
+			conn.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
+			conn.Close()
+			return
+		}
+		sessionID = info.ID
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"session_id","session_id":"%s"}`, sessionID)))
+	serveOwner(conn, sessionID, q.Get("attach_mode"), mgr)
+}
+
+// shellArgv is the command a new terminal session runs, as the exec policy
+// sees it.
+func shellArgv(mgr *ptywrap.Manager) []string {
+	shell := mgr.Spawn.Shell
+	if shell == "" {
+		shell = "bash"
+	}
+	flags := mgr.Spawn.ShellFlags
+	if flags == nil {
+		flags = []string{"-i"}
+	}
+	return append([]string{shell}, flags...)
+}
+
+// serveAttached serves conn on a session until either ends. ptywrap makes
+// the first interactive connection the session's writer and kills the shell
+// when the writer goes away, so a dropped mobile connection loses it.
+// Unless KillOnDisconnect is set, interactive connections attach instead:
+// they write and resize all the same, but leave the shell running when they
+// disconnect, for the same or another device to reconnect to by session_id,
+// receiving the scrollback. Closing with code 4000 still ends the session.
+func serveAttached(conn *websocket.Conn, sessionID, attachMode string, mgr *ptywrap.Manager) {
+	if killOnDisconnect() {
+		ptywrap.ServeSessionWebSocket(conn, sessionID, attachMode, mgr)
+		return
+	}
+	if attachMode == "" || attachMode == "interactive" {
+		attachMode = "attach"
+	}
+	var deleteOnClose atomic.Bool
+	conn.SetCloseHandler(func(code int, _ string) error {
+		if code == closeDelete {
+			deleteOnClose.Store(true)
+		}
+		// answer the close as the default handler does
+		msg := websocket.FormatCloseMessage(code, "")
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return nil
+	})
+	ptywrap.ServeSessionWebSocket(conn, sessionID, attachMode, mgr)
+	if deleteOnClose.Load() {
+		mgr.Remove(sessionID)
+	}
+}
+
+// lastLines returns the last n lines of data.
+func lastLines(data []byte, n int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end-- // a trailing newline does not start another line
+	}
+	for i := 0; i < n; i++ {
+		j := bytes.LastIndexByte(data[:end], '\n')
+		if j < 0 {
+			return data
+		}
+		end = j
+	}
+	return data[end+1:]
+}
+
+// handleScrollback returns the recent output of a session, raw as written
+// by the program, for clients that reconnect or just want to look. ptywrap
+// keeps the last 256 KiB of output per session; lines, by default the
+// configured scrollback_lines, limits how much of it is returned.
+//
+//	GET /api/terminal/sessions/{id}/scrollback?lines=N -> raw output
+func handleScrollback(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Manager, sessionID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lines := scrollbackLines()
+	if s := r.URL.Query().Get("lines"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "lines must be a positive number", http.StatusBadRequest)
+			return
+		}
+		lines = n
+	}
+	data := mgr.Scrollback(sessionID)
+	if data == nil {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(lastLines(data, lines))
+}
+
+// sessionsHandler serves /api/terminal/sessions/ with ptywrap's session API,
+// adding the scrollback route.
+func sessionsHandler(mgr *ptywrap.Manager) http.HandlerFunc {
+	sessions := http.NewServeMux()
+	ptywrap.RegisterSessionAPI(sessions, mgr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/terminal/sessions/")
+		if id, ok := strings.CutSuffix(path, "/scrollback"); ok && id != "" {
+			handleScrollback(w, r, mgr, id)
+			return
+		}
+		sessions.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,135 @@
+package terminal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+)
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		data string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"", 3, ""},
+	}
+	for _, tt := range tests {
+		if got := string(lastLines([]byte(tt.data), tt.n)); got != tt.want {
+			t.Errorf("lastLines(%q, %d) = %q, want %q", tt.data, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSessionSurvivesDisconnect(t *testing.T) {
+	old := getConfigFile()
+	SetConfigFile(filepath.Join(t.TempDir(), "terminal.json"))
+	t.Cleanup(func() { SetConfigFile(old) })
+	execpolicy.SetFiles(filepath.Join(t.TempDir(), "exec-policy.json"), filepath.Join(t.TempDir(), "exec-decisions.log"))
+	t.Cleanup(func() { execpolicy.SetFiles(config.ExecPolicyFile, config.ExecDecisionsLogFile) })
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/terminal"
+
+	dial := func(query string) (*websocket.Conn, string) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hello struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := json.Unmarshal(msg, &hello); err != nil || hello.SessionID == "" {
+			t.Fatalf("first message %q", msg)
+		}
+		return conn, hello.SessionID
+	}
+	closeWith := func(conn *websocket.Conn, code int) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+		conn.Close()
+	}
+	status := func(id string) string {
+		resp, err := http.Get(srv.URL + "/api/terminal/sessions")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var list struct {
+			Sessions []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"sessions"`
+		}
+		json.NewDecoder(resp.Body).Decode(&list)
+		for _, s := range list.Sessions {
+			if s.ID == id {
+				return s.Status
+			}
+		}
+		return ""
+	}
+
+	conn, id := dial("?cwd=" + t.TempDir())
+	conn.WriteMessage(websocket.BinaryMessage, []byte("echo marker-$((40+2))\n"))
+	closeWith(conn, websocket.CloseNormalClosure)
+
+	// the shell keeps running, and its output is there when reconnecting
+	deadline := time.Now().Add(10 * time.Second)
+	var out []byte
+	for time.Now().Before(deadline) && !strings.Contains(string(out), "marker-42") {
+		time.Sleep(50 * time.Millisecond)
+		resp, err := http.Get(srv.URL + "/api/terminal/sessions/" + id + "/scrollback?lines=50")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if !strings.Contains(string(out), "marker-42") {
+		t.Fatalf("scrollback: %q", out)
+	}
+	if s := status(id); s != "running" {
+		t.Fatalf("status after disconnect = %q", s)
+	}
+
+	conn, again := dial("?session_id=" + id)
+	if again != id {
+		t.Fatalf("reconnected to %s, want %s", again, id)
+	}
+	closeWith(conn, closeDelete)
+	for time.Now().Before(deadline) && status(id) != "" {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if s := status(id); s != "" {
+		t.Errorf("session after close 4000: %q", s)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/terminal/sessions/nope/scrollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session: %d", resp.StatusCode)
+	}
+}
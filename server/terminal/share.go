@@ -0,0 +1,450 @@
+package terminal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xhd2015/dot-pkgs/go-pkgs/shell/ptywrap"
+)
+
+// A terminal session can be shared with a short-lived link. Guests holding
+// the token watch the session read-only; one of them may ask to take over
+// the keyboard, and while the owner grants it the guest is the only writer
+// and the owner's connections watch instead. The owner can reclaim control
+// or revoke the link at any time. Shares live in memory, like the sessions.
+const (
+	// SharedPath is the auth-exempt WebSocket a guest watches the session
+	// on; SharedTakeoverPath is where the guest asks for control.
+	SharedPath         = "/api/terminal/shared"
+	SharedTakeoverPath = "/api/terminal/shared/takeover"
+
+	defaultShareTTL = time.Hour
+	maxShareTTL     = 24 * time.Hour
+)
+
+// Who has the keyboard of a shared session.
+const (
+	ControlOwner = "owner"
+	ControlGuest = "guest"
+)
+
+var (
+	errShareNotFound = errors.New("share not found or expired")
+	errNoRequest     = errors.New("no pending takeover request")
+)
+
+// TakeoverRequest is a guest asking for control.
+type TakeoverRequest struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// TerminalShare is a link to a terminal session.
+type TerminalShare struct {
+	Token     string    `json:"token"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Control is ControlOwner, or ControlGuest while a takeover is granted.
+	Control string `json:"control"`
+	// Request is the pending takeover request, if any.
+	Request *TakeoverRequest `json:"request,omitempty"`
+	// Guest is the granted request while Control is ControlGuest.
+	Guest *TakeoverRequest `json:"guest,omitempty"`
+	// Observers counts the guests connected.
+	Observers int `json:"observers"`
+
+	timer *time.Timer
+}
+
+// URL is the WebSocket path guests connect to.
+func (s *TerminalShare) URL() string {
+	return SharedPath + "?token=" + s.Token
+}
+
+// guestView is what guests see of a share: no other guest's request ID.
+type guestView struct {
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Control   string    `json:"control"`
+	// Pending and Granted refer to the request of the asking guest.
+	Pending bool `json:"pending"`
+	Granted bool `json:"granted"`
+}
+
+type peerKind int
+
+const (
+	peerOwner peerKind = iota
+	peerGuest          // the guest holding control
+	peerObserver
+)
+
+type peer struct {
+	session string
+	token   string // share the peer came by; empty for the owner
+	kind    peerKind
+	// watching is set for owner connections made while a guest had control
+	watching bool
+}
+
+// shares holds the shares by token and the connections to shared sessions,
+// so that handing over control can drop the ones that must change role:
+// ptywrap fixes a connection's role when it attaches, and clients reconnect.
+var shares = struct {
+	sync.Mutex
+	byToken map[string]*TerminalShare
+	peers   map[*websocket.Conn]peer
+}{
+	byToken: make(map[string]*TerminalShare),
+	peers:   make(map[*websocket.Conn]peer),
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createShare shares a session for ttl, capped at maxShareTTL.
+func createShare(mgr *ptywrap.Manager, sessionID string, ttl time.Duration) (*TerminalShare, error) {
+	if !sessionExists(mgr, sessionID) {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if ttl <= 0 {
+		ttl = defaultShareTTL
+	}
+	if ttl > maxShareTTL {
+		ttl = maxShareTTL
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	s := &TerminalShare{
+		Token:     token,
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		Control:   ControlOwner,
+	}
+	s.timer = time.AfterFunc(ttl, func() { revokeShare(token) })
+
+	shares.Lock()
+	defer shares.Unlock()
+	shares.byToken[token] = s
+	return s.snapshot(), nil
+}
+
+// snapshot copies s for callers outside the lock; shares must be held.
+func (s *TerminalShare) snapshot() *TerminalShare {
+	out := *s
+	out.timer = nil
+	for _, p := range shares.peers {
+		if p.token == s.Token {
+			out.Observers++
+		}
+	}
+	return &out
+}
+
+// listShares returns the shares, newest first.
+func listShares() []*TerminalShare {
+	shares.Lock()
+	defer shares.Unlock()
+	list := make([]*TerminalShare, 0, len(shares.byToken))
+	for _, s := range shares.byToken {
+		list = append(list, s.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// revokeShare ends a share and disconnects its guests.
+func revokeShare(token string) error {
+	shares.Lock()
+	defer shares.Unlock()
+	s, ok := shares.byToken[token]
+	if !ok {
+		return errShareNotFound
+	}
+	s.timer.Stop()
+	delete(shares.byToken, token)
+	for conn, p := range shares.peers {
+		// the owner gets control back too
+		if p.token == token || s.Control == ControlGuest && p.session == s.SessionID && p.watching {
+			conn.Close()
+		}
+	}
+	return nil
+}
+
+// requestTakeover records a guest's request for control, replacing any
+// earlier one, and returns its ID.
+func requestTakeover(token, name string) (string, error) {
+	id, err := newShareToken()
+	if err != nil {
+		return "", err
+	}
+	shares.Lock()
+	defer shares.Unlock()
+	s, ok := shares.byToken[token]
+	if !ok {
+		return "", errShareNotFound
+	}
+	s.Request = &TakeoverRequest{ID: id, Name: name, RequestedAt: time.Now().UTC()}
+	return id, nil
+}
+
+// Owner answers to takeover requests.
+const (
+	TakeoverGrant   = "grant"
+	TakeoverDeny    = "deny"
+	TakeoverReclaim = "reclaim"
+)
+
+// answerTakeover grants or denies the pending request, or reclaims control.
+// Connections whose role changes are closed; they reconnect in the new one.
+func answerTakeover(token, action string) (*TerminalShare, error) {
+	shares.Lock()
+	defer shares.Unlock()
+	s, ok := shares.byToken[token]
+	if !ok {
+		return nil, errShareNotFound
+	}
+	// drop tells the connections to close
+	var drop func(p peer) bool
+	switch action {
+	case TakeoverGrant:
+		if s.Request == nil {
+			return nil, errNoRequest
+		}
+		if killOnDisconnect() {
+			return nil, fmt.Errorf("taking over needs kill_on_disconnect off: the owner's shell would end")
+		}
+		s.Control, s.Guest, s.Request = ControlGuest, s.Request, nil
+		drop = func(p peer) bool { return p.kind == peerGuest || p.kind == peerOwner && !p.watching }
+	case TakeoverDeny:
+		if s.Request == nil {
+			return nil, errNoRequest
+		}
+		s.Request = nil
+		return s.snapshot(), nil
+	case TakeoverReclaim:
+		if s.Control == ControlOwner {
+			return s.snapshot(), nil
+		}
+		s.Control, s.Guest = ControlOwner, nil
+		drop = func(p peer) bool { return p.kind == peerGuest || p.kind == peerOwner && p.watching }
+	default:
+		return nil, fmt.Errorf("action must be %s, %s or %s", TakeoverGrant, TakeoverDeny, TakeoverReclaim)
+	}
+	for conn, p := range shares.peers {
+		if p.session == s.SessionID && drop(p) {
+			conn.Close()
+		}
+	}
+	return s.snapshot(), nil
+}
+
+// serveOwner serves an owner connection to a session, which only watches
+// while a guest has control.
+func serveOwner(conn *websocket.Conn, sessionID, attachMode string, mgr *ptywrap.Manager) {
+	p := peer{session: sessionID, kind: peerOwner}
+	shares.Lock()
+	for _, s := range shares.byToken {
+		if s.SessionID == sessionID && s.Control == ControlGuest {
+			p.watching = true
+		}
+	}
+	shares.Unlock()
+	defer trackPeer(conn, p)()
+	if p.watching {
+		ptywrap.ServeSessionWebSocket(conn, sessionID, "observer", mgr)
+		return
+	}
+	serveAttached(conn, sessionID, attachMode, mgr)
+}
+
+// trackPeer records conn until the returned func is called.
+func trackPeer(conn *websocket.Conn, p peer) func() {
+	shares.Lock()
+	shares.peers[conn] = p
+	shares.Unlock()
+	return func() {
+		shares.Lock()
+		delete(shares.peers, conn)
+		shares.Unlock()
+	}
+}
+
+// handleShared serves a guest's connection: read-only, unless request names
+// the granted takeover request.
+//
+//	GET /api/terminal/shared?token=T[&request=ID] -> WebSocket
+func handleShared(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Manager) {
+	token := r.URL.Query().Get("token")
+	shares.Lock()
+	s, ok := shares.byToken[token]
+	var sessionID string
+	kind := peerObserver
+	if ok {
+		sessionID = s.SessionID
+		if req := r.URL.Query().Get("request"); s.Control == ControlGuest && req != "" && req == s.Guest.ID {
+			kind = peerGuest
+		}
+	}
+	shares.Unlock()
+	if !ok {
+		http.Error(w, errShareNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, "Failed to upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"session_id","session_id":"%s"}`, sessionID)))
+	defer trackPeer(conn, peer{session: sessionID, token: token, kind: kind})()
+	if kind == peerGuest {
+		serveAttached(conn, sessionID, "attach", mgr)
+		return
+	}
+	ptywrap.ServeSessionWebSocket(conn, sessionID, "observer", mgr)
+}
+
+// handleSharedTakeover lets a guest ask for control and follow the answer.
+//
+//	POST /api/terminal/shared/takeover?token=T {name} -> {request_id}
+//	GET  /api/terminal/shared/takeover?token=T&request=ID -> guestView
+func handleSharedTakeover(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req) // the name is optional
+		id, err := requestTakeover(token, req.Name)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"request_id": id})
+	case http.MethodGet:
+		reqID := r.URL.Query().Get("request")
+		shares.Lock()
+		s, ok := shares.byToken[token]
+		var view guestView
+		if ok {
+			view = guestView{
+				SessionID: s.SessionID,
+				ExpiresAt: s.ExpiresAt,
+				Control:   s.Control,
+				Pending:   reqID != "" && s.Request != nil && s.Request.ID == reqID,
+				Granted:   reqID != "" && s.Guest != nil && s.Guest.ID == reqID,
+			}
+		}
+		shares.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": errShareNotFound.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type shareResponse struct {
+	*TerminalShare
+	URL string `json:"url"`
+}
+
+// handleShares manages the shares of the owner's sessions.
+//
+//	GET    /api/terminal/shares                          -> []TerminalShare
+//	POST   /api/terminal/shares {session_id, ttl_minutes} -> TerminalShare
+//	DELETE /api/terminal/shares?token=T
+func handleShares(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Manager) {
+	switch r.Method {
+	case http.MethodGet:
+		list := listShares()
+		resp := make([]shareResponse, 0, len(list))
+		for _, s := range list {
+			resp = append(resp, shareResponse{s, s.URL()})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req struct {
+			SessionID  string  `json:"session_id"`
+			TTLMinutes float64 `json:"ttl_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		s, err := createShare(mgr, req.SessionID, time.Duration(req.TTLMinutes*float64(time.Minute)))
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, shareResponse{s, s.URL()})
+	case http.MethodDelete:
+		if err := revokeShare(r.URL.Query().Get("token")); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleShareTakeover is the owner's side of the takeover handshake.
+//
+//	POST /api/terminal/shares/takeover {token, action: grant|deny|reclaim} -> TerminalShare
+func handleShareTakeover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Token  string `json:"token"`
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	s, err := answerTakeover(req.Token, req.Action)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errShareNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, errNoRequest) {
+			status = http.StatusConflict
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, shareResponse{s, s.URL()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
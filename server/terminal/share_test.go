@@ -0,0 +1,159 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
+)
+
+func TestShareTakeover(t *testing.T) {
+	old := getConfigFile()
+	SetConfigFile(filepath.Join(t.TempDir(), "terminal.json"))
+	t.Cleanup(func() { SetConfigFile(old) })
+	execpolicy.SetFiles(filepath.Join(t.TempDir(), "exec-policy.json"), filepath.Join(t.TempDir(), "exec-decisions.log"))
+	t.Cleanup(func() { execpolicy.SetFiles(config.ExecPolicyFile, config.ExecDecisionsLogFile) })
+
+	mux := http.NewServeMux()
+	RegisterAPI(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsBase := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dial := func(path string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(wsBase+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	call := func(method, path string, body, out interface{}) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(data))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+	scrollback := func(id string) string {
+		resp, err := http.Get(srv.URL + "/api/terminal/sessions/" + id + "/scrollback")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return string(out)
+	}
+	waitFor := func(id, marker string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) && !strings.Contains(scrollback(id), marker) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if !strings.Contains(scrollback(id), marker) {
+			t.Fatalf("%s not in scrollback: %q", marker, scrollback(id))
+		}
+	}
+	// closed reports whether the server closes conn, draining its output
+	closed := func(conn *websocket.Conn) bool {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return !strings.Contains(err.Error(), "timeout")
+			}
+		}
+	}
+
+	owner := dial("/api/terminal?cwd=" + t.TempDir())
+	defer owner.Close()
+	_, msg, err := owner.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hello struct {
+		SessionID string `json:"session_id"`
+	}
+	json.Unmarshal(msg, &hello)
+	id := hello.SessionID
+
+	var share struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	if code := call(http.MethodPost, "/api/terminal/shares", map[string]interface{}{"session_id": id}, &share); code != http.StatusOK {
+		t.Fatalf("create share: %d", code)
+	}
+	if code := call(http.MethodPost, "/api/terminal/shares", map[string]interface{}{"session_id": "nope"}, nil); code != http.StatusNotFound {
+		t.Errorf("share unknown session: %d", code)
+	}
+
+	// an observer's input goes nowhere
+	observer := dial(share.URL)
+	observer.WriteMessage(websocket.BinaryMessage, []byte("echo observer-$((1+1))\n"))
+	owner.WriteMessage(websocket.BinaryMessage, []byte("echo owner-$((2+2))\n"))
+	waitFor(id, "owner-4")
+	if strings.Contains(scrollback(id), "observer-2") {
+		t.Fatal("observer input reached the shell")
+	}
+	observer.Close()
+
+	var takeover struct {
+		RequestID string `json:"request_id"`
+	}
+	call(http.MethodPost, SharedTakeoverPath+"?token="+share.Token, map[string]string{"name": "guest"}, &takeover)
+	if takeover.RequestID == "" {
+		t.Fatal("no request id")
+	}
+	if code := call(http.MethodPost, "/api/terminal/shares/takeover", map[string]string{"token": share.Token, "action": TakeoverGrant}, nil); code != http.StatusOK {
+		t.Fatalf("grant: %d", code)
+	}
+	if !closed(owner) {
+		t.Fatal("owner connection kept writing after the grant")
+	}
+	var view guestView
+	call(http.MethodGet, SharedTakeoverPath+"?token="+share.Token+"&request="+takeover.RequestID, nil, &view)
+	if !view.Granted || view.Control != ControlGuest {
+		t.Fatalf("guest view: %+v", view)
+	}
+
+	guest := dial(share.URL + "&request=" + takeover.RequestID)
+	guest.WriteMessage(websocket.BinaryMessage, []byte("echo guest-$((2+3))\n"))
+	waitFor(id, "guest-5")
+
+	if code := call(http.MethodPost, "/api/terminal/shares/takeover", map[string]string{"token": share.Token, "action": TakeoverReclaim}, nil); code != http.StatusOK {
+		t.Fatalf("reclaim: %d", code)
+	}
+	if !closed(guest) {
+		t.Fatal("guest connection kept writing after the reclaim")
+	}
+	if code := call(http.MethodPost, "/api/terminal/shares/takeover", map[string]string{"token": share.Token, "action": TakeoverGrant}, nil); code != http.StatusConflict {
+		t.Errorf("grant without request: %d", code)
+	}
+
+	if code := call(http.MethodDelete, "/api/terminal/shares?token="+share.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("revoke: %d", code)
+	}
+	if code := call(http.MethodDelete, "/api/terminal/shares?token="+share.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("revoke again: %d", code)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(wsBase+share.URL, nil); err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("revoked share still connects")
+	}
+	dial("/api/terminal?session_id="+id).WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeDelete, ""), time.Now().Add(time.Second))
+}
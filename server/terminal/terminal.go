@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/xhd2015/agent-pro/agent/exec/tool_resolve"
 	"github.com/xhd2015/ai-critic/server/encrypt"
+	"github.com/xhd2015/ai-critic/server/execpolicy"
 	"github.com/xhd2015/dot-pkgs/go-pkgs/shell/ptywrap"
 )
 
@@ -64,10 +65,20 @@ func RegisterAPI(mux *http.ServeMux) {
 			handleSSHWebSocket(w, r, mgr)
 			return
 		}
-		ptywrap.HandleTerminalWebSocket(w, r, mgr)
+		handleTerminalWebSocket(w, r, mgr)
 	})
-	ptywrap.RegisterSessionAPI(mux, mgr)
+	sessions := sessionsHandler(mgr)
+	mux.Handle("/api/terminal/sessions", sessions)
+	mux.Handle("/api/terminal/sessions/", sessions)
 	mux.HandleFunc("/api/terminal/config", handleConfig)
+	mux.HandleFunc("/api/terminal/shares", func(w http.ResponseWriter, r *http.Request) {
+		handleShares(w, r, mgr)
+	})
+	mux.HandleFunc("/api/terminal/shares/takeover", handleShareTakeover)
+	mux.HandleFunc(SharedPath, func(w http.ResponseWriter, r *http.Request) {
+		handleShared(w, r, mgr)
+	})
+	mux.HandleFunc(SharedTakeoverPath, handleSharedTakeover)
 }
 
 type sshControlMessage struct {
@@ -147,6 +158,11 @@ func handleSSHWebSocket(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Man
 			sshPort = p
 		}
 	}
+	if err := execpolicy.Authorize(r, execpolicy.SourceTerminal, []string{"ssh", sshUser + "@" + sshHost}, ""); err != nil {
+		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"error","message":%q}`, err.Error())))
+		conn.Close()
+		return
+	}
 	sshName := fmt.Sprintf("%s@%s", sshUser, sshHost)
 	sessionID, err := createSSHSession(mgr, sshName, sshHost, sshPort, sshUser, tmpKeyFile.Name())
 	if err != nil {
@@ -155,7 +171,7 @@ func handleSSHWebSocket(w http.ResponseWriter, r *http.Request, mgr *ptywrap.Man
 		return
 	}
 	conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":"session_id","session_id":"%s"}`, sessionID)))
-	ptywrap.ServeSessionWebSocket(conn, sessionID, r.URL.Query().Get("attach_mode"), mgr)
+	serveOwner(conn, sessionID, r.URL.Query().Get("attach_mode"), mgr)
 }
 
 func createSSHSession(mgr *ptywrap.Manager, name, host string, port int, user, sshKeyPath string) (string, error) {
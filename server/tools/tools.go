@@ -588,7 +588,7 @@ var requiredTools = []toolDef{
 		name:        "lsof",
 		category:    CategoryNetwork,
 		description: "List open files and network connections",
-		purpose:     "Detect local listening ports for port forwarding",
+		purpose:     "Fallback for detecting local listening ports where the native lookup is unavailable",
 		docURL:      "https://man7.org/linux/man-pages/man8/lsof.8.html",
 		versionCmd:  []string{"lsof", "-v"},
 		installMacOS: []string{
@@ -736,6 +736,38 @@ var requiredTools = []toolDef{
 		},
 		installWindows: "Download from https://tailscale.com/download/windows",
 	},
+	{
+		name:        "cwebp",
+		category:    CategoryOther,
+		description: "WebP image encoder",
+		purpose:     "Re-encode screenshots and images as WebP to cut mobile data usage",
+		docURL:      "https://developers.google.com/speed/webp/docs/cwebp",
+		versionCmd:  []string{"cwebp", "-version"},
+		installMacOS: []string{
+			"brew install webp",
+		},
+		installLinux: []string{
+			"apt-get update",
+			"apt-get install -y webp",
+		},
+		installWindows: "Download from https://developers.google.com/speed/webp/download",
+	},
+	{
+		name:        "avifenc",
+		category:    CategoryOther,
+		description: "AVIF image encoder from libavif",
+		purpose:     "Encode images as AVIF, smaller than WebP at the cost of slower encoding",
+		docURL:      "https://github.com/AOMediaCodec/libavif",
+		versionCmd:  []string{"avifenc", "--version"},
+		installMacOS: []string{
+			"brew install libavif",
+		},
+		installLinux: []string{
+			"apt-get update",
+			"apt-get install -y libavif-bin",
+		},
+		installWindows: "Download from https://github.com/AOMediaCodec/libavif/releases",
+	},
 }
 
 // getInstallStepsForOS returns the install steps for the current OS.
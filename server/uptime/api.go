@@ -0,0 +1,78 @@
+package uptime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// RegisterAPI registers the uptime endpoints:
+//
+//	GET  /api/health/uptime        state of each public URL (?history=true adds samples)
+//	POST /api/health/uptime/check  probe now and return the fresh report
+//	GET  /api/settings/uptime      monitor settings (admin)
+//	POST /api/settings/uptime      replace monitor settings (admin)
+func RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/health/uptime", handleReport)
+	mux.HandleFunc("/api/health/uptime/check", handleCheck)
+	mux.HandleFunc("/api/settings/uptime", handleSettings)
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, _ := settingsFile.Get()
+	writeJSON(w, http.StatusOK, defaultMonitor.report(s, r.URL.Query().Get("history") == "true"))
+}
+
+func handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, _ := settingsFile.Get()
+	defaultMonitor.check(r.Context(), s)
+	writeJSON(w, http.StatusOK, defaultMonitor.report(s, false))
+}
+
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var s Settings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		if s.IntervalSeconds < 0 || s.FailureThreshold < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "interval_seconds and failure_threshold must not be negative"})
+			return
+		}
+		for _, raw := range append([]string{s.WebhookURL}, s.ExtraURLs...) {
+			if raw == "" {
+				continue
+			}
+			if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid URL: " + raw})
+				return
+			}
+		}
+		if err := settingsFile.Set(s); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, _ := settingsFile.Get()
+	writeJSON(w, http.StatusOK, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,403 @@
+// Package uptime monitors the instance's own public URLs from the outside:
+// it periodically requests each configured domain through its tunnel, keeps
+// a latency/availability history, and raises an alert when a public URL
+// stops answering while the local server is still fine.
+package uptime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/activity"
+	"github.com/xhd2015/ai-critic/server/config"
+	"github.com/xhd2015/ai-critic/server/domains"
+	"github.com/xhd2015/ai-critic/server/jsonfile"
+	"github.com/xhd2015/ai-critic/server/logging"
+	"github.com/xhd2015/ai-critic/server/notifications"
+)
+
+const (
+	defaultInterval         = time.Minute
+	defaultFailureThreshold = 3
+	// maxSamples keeps a day of history at the default interval.
+	maxSamples   = 1440
+	probeTimeout = 15 * time.Second
+)
+
+// Target states.
+const (
+	StateUnknown   = "unknown"
+	StateUp        = "up"
+	StateDown      = "down"       // unreachable from outside while the local server answers
+	StateLocalDown = "local_down" // the local server does not answer either; no alert
+)
+
+// Settings configure the monitor. Zero values take the defaults, so the
+// monitor runs out of the box for every configured domain.
+type Settings struct {
+	Disabled         bool `json:"disabled"`
+	IntervalSeconds  int  `json:"interval_seconds"`
+	FailureThreshold int  `json:"failure_threshold"`
+	// WebhookURL receives a JSON POST on every down/recovered alert. The web
+	// UI is usually reached through the very URL that broke, so this is the
+	// way to hear about it.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// ExtraURLs are probed in addition to the configured domains.
+	ExtraURLs []string `json:"extra_urls,omitempty"`
+}
+
+func (s Settings) interval() time.Duration {
+	if s.IntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(s.IntervalSeconds) * time.Second
+}
+
+func (s Settings) threshold() int {
+	if s.FailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+	return s.FailureThreshold
+}
+
+// Sample is the result of one probe.
+type Sample struct {
+	Time      time.Time `json:"time"`
+	OK        bool      `json:"ok"`
+	LatencyMS int64     `json:"latency_ms"`
+	Status    int       `json:"status,omitempty"`
+	// ViaCloudflare reports a cf-ray header on the response, i.e. the
+	// request really went through Cloudflare's edge.
+	ViaCloudflare bool   `json:"via_cloudflare,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// TargetStatus is the state and history of one public URL.
+type TargetStatus struct {
+	URL              string    `json:"url"`
+	State            string    `json:"state"`
+	Since            time.Time `json:"since,omitempty"` // when State was entered
+	ConsecutiveFails int       `json:"consecutive_failures"`
+	UptimePercent    float64   `json:"uptime_percent"` // over History
+	AvgLatencyMS     int64     `json:"avg_latency_ms"` // of successful samples in History
+	History          []Sample  `json:"history,omitempty"`
+}
+
+// Report is the response of GET /api/health/uptime.
+type Report struct {
+	Settings  Settings       `json:"settings"`
+	LastCheck time.Time      `json:"last_check,omitempty"`
+	LocalOK   bool           `json:"local_ok"`
+	Targets   []TargetStatus `json:"targets"`
+}
+
+// Alert is sent to the webhook and recorded on the activity timeline.
+type Alert struct {
+	Event string    `json:"event"` // "down" or "recovered"
+	URL   string    `json:"url"`
+	Error string    `json:"error,omitempty"`
+	Since time.Time `json:"since"`
+	Time  time.Time `json:"time"`
+}
+
+var (
+	settingsFile = jsonfile.New[Settings](config.DataDir + "/uptime.json")
+	log          = logging.New("uptime")
+)
+
+// monitor holds per-target state; its hooks are swapped in tests.
+type monitor struct {
+	mu        sync.Mutex
+	targets   map[string]*TargetStatus
+	lastCheck time.Time
+	localOK   bool
+
+	publicURLs func(Settings) []string
+	localURL   func() string
+	notify     func(Settings, Alert)
+	client     *http.Client
+
+	stop chan struct{}
+}
+
+func newMonitor() *monitor {
+	return &monitor{
+		targets:    make(map[string]*TargetStatus),
+		publicURLs: publicURLs,
+		localURL:   localURL,
+		notify:     sendAlert,
+		client:     &http.Client{Timeout: probeTimeout},
+	}
+}
+
+var defaultMonitor = newMonitor()
+
+// Start begins the background probe loop.
+func Start() {
+	defaultMonitor.start()
+}
+
+// Stop ends the background probe loop.
+func Stop() {
+	defaultMonitor.mu.Lock()
+	defer defaultMonitor.mu.Unlock()
+	if defaultMonitor.stop != nil {
+		close(defaultMonitor.stop)
+		defaultMonitor.stop = nil
+	}
+}
+
+func (m *monitor) start() {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		// tunnels come up after extension startup; give them a head start
+		select {
+		case <-time.After(30 * time.Second):
+		case <-stop:
+			return
+		}
+		for {
+			s, _ := settingsFile.Get()
+			if !s.Disabled {
+				m.check(context.Background(), s)
+			}
+			select {
+			case <-time.After(s.interval()):
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// publicURLs are the Cloudflare domains serving this instance plus the
+// configured extra URLs.
+func publicURLs(s Settings) []string {
+	var urls []string
+	if cfg, err := domains.LoadDomains(); err == nil {
+		for _, d := range cfg.Domains {
+			if d.Provider == domains.ProviderCloudflare {
+				urls = append(urls, "https://"+d.Domain+"/ping")
+			}
+		}
+	}
+	return append(urls, s.ExtraURLs...)
+}
+
+func localURL() string {
+	port := domains.GetServerPort()
+	if port == 0 {
+		return ""
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d/ping", port)
+}
+
+// check probes the local server and every public URL once, updating the
+// history and raising alerts on state changes.
+func (m *monitor) check(ctx context.Context, s Settings) {
+	urls := m.publicURLs(s)
+	localOK := true
+	if u := m.localURL(); u != "" {
+		localOK = m.probe(ctx, u).OK
+	}
+
+	samples := make([]Sample, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			samples[i] = m.probe(ctx, u)
+		}()
+	}
+	wg.Wait()
+
+	var alerts []Alert
+	m.mu.Lock()
+	now := time.Now()
+	m.lastCheck, m.localOK = now, localOK
+	seen := make(map[string]bool, len(urls))
+	for i, u := range urls {
+		seen[u] = true
+		t := m.targets[u]
+		if t == nil {
+			t = &TargetStatus{URL: u, State: StateUnknown, Since: now}
+			m.targets[u] = t
+		}
+		if a, ok := t.record(samples[i], localOK, s.threshold()); ok {
+			alerts = append(alerts, a)
+		}
+	}
+	// drop domains that were removed from the configuration
+	for u := range m.targets {
+		if !seen[u] {
+			delete(m.targets, u)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, a := range alerts {
+		m.notify(s, a)
+	}
+}
+
+// record appends a sample and moves the state machine, returning the alert
+// to raise, if any.
+func (t *TargetStatus) record(sample Sample, localOK bool, threshold int) (Alert, bool) {
+	t.History = append(t.History, sample)
+	if len(t.History) > maxSamples {
+		t.History = t.History[len(t.History)-maxSamples:]
+	}
+	var up int
+	var latency int64
+	for _, h := range t.History {
+		if h.OK {
+			up++
+			latency += h.LatencyMS
+		}
+	}
+	t.UptimePercent = float64(up) * 100 / float64(len(t.History))
+	t.AvgLatencyMS = 0
+	if up > 0 {
+		t.AvgLatencyMS = latency / int64(up)
+	}
+
+	prev := t.State
+	if sample.OK {
+		t.ConsecutiveFails = 0
+		t.setState(StateUp, sample.Time)
+		if prev == StateDown {
+			return Alert{Event: "recovered", URL: t.URL, Since: t.Since, Time: sample.Time}, true
+		}
+		return Alert{}, false
+	}
+
+	t.ConsecutiveFails++
+	if !localOK {
+		// the server itself is the problem, which the public URL cannot
+		// be blamed for; an outage already alerted stays down
+		if prev != StateDown {
+			t.setState(StateLocalDown, sample.Time)
+		}
+		return Alert{}, false
+	}
+	if t.ConsecutiveFails < threshold || prev == StateDown {
+		return Alert{}, false
+	}
+	// the outage started with the first failed probe
+	since := sample.Time
+	if n := len(t.History) - t.ConsecutiveFails; n >= 0 && n < len(t.History) {
+		since = t.History[n].Time
+	}
+	t.State, t.Since = StateDown, since
+	return Alert{Event: "down", URL: t.URL, Error: sample.Error, Since: since, Time: sample.Time}, true
+}
+
+func (t *TargetStatus) setState(state string, at time.Time) {
+	if t.State != state {
+		t.State, t.Since = state, at
+	}
+}
+
+func (m *monitor) probe(ctx context.Context, url string) Sample {
+	sample := Sample{Time: time.Now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := m.client.Do(req)
+	sample.LatencyMS = time.Since(sample.Time).Milliseconds()
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	sample.Status = resp.StatusCode
+	sample.ViaCloudflare = resp.Header.Get("Cf-Ray") != ""
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		sample.Error = resp.Status
+	case strings.HasSuffix(url, "/ping") && strings.TrimSpace(string(body)) != "pong":
+		// something answered, but not this server (e.g. a Cloudflare error page)
+		sample.Error = "unexpected response body"
+	default:
+		sample.OK = true
+	}
+	return sample
+}
+
+// sendAlert logs the alert, records it on the activity timeline and posts it
+// to the webhook, if configured.
+func sendAlert(s Settings, a Alert) {
+	title := "Public URL recovered: " + a.URL
+	status := "ok"
+	if a.Event == "down" {
+		title = "Public URL unreachable: " + a.URL
+		status = "error"
+		log.Warnf("%s while the local server is up: %s", title, a.Error)
+		notifications.Notify(notifications.Notification{
+			Event:  notifications.EventTunnelDegraded,
+			Title:  title,
+			Body:   a.Error,
+			Urgent: true,
+		})
+	} else {
+		log.Infof("%s after %s", title, a.Time.Sub(a.Since).Round(time.Second))
+	}
+	activity.Record("", activity.Event{
+		Kind:   activity.KindTunnel,
+		Title:  title,
+		Detail: a.Error,
+		Status: status,
+		Ref:    a.URL,
+	})
+	if s.WebhookURL == "" {
+		return
+	}
+	data, _ := json.Marshal(a)
+	client := &http.Client{Timeout: probeTimeout}
+	resp, err := client.Post(s.WebhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Warnf("webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Warnf("webhook returned %s", resp.Status)
+	}
+}
+
+func (m *monitor) report(s Settings, withHistory bool) Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := Report{Settings: s, LastCheck: m.lastCheck, LocalOK: m.localOK, Targets: []TargetStatus{}}
+	for _, t := range m.targets {
+		c := *t
+		c.History = nil
+		if withHistory {
+			c.History = append([]Sample(nil), t.History...)
+		}
+		r.Targets = append(r.Targets, c)
+	}
+	sort.Slice(r.Targets, func(i, j int) bool { return r.Targets[i].URL < r.Targets[j].URL })
+	return r
+}
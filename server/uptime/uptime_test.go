@@ -0,0 +1,85 @@
+package uptime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// switchable serves "pong" while up and 502 (like a broken tunnel) otherwise.
+func switchable(t *testing.T, up *atomic.Bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cf-Ray", "test")
+		w.Write([]byte("pong"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMonitorAlerts(t *testing.T) {
+	var publicUp, localUp atomic.Bool
+	public := switchable(t, &publicUp)
+	local := switchable(t, &localUp)
+
+	var alerts []Alert
+	m := newMonitor()
+	m.publicURLs = func(Settings) []string { return []string{public.URL + "/ping"} }
+	m.localURL = func() string { return local.URL + "/ping" }
+	m.notify = func(_ Settings, a Alert) { alerts = append(alerts, a) }
+	s := Settings{FailureThreshold: 2}
+
+	steps := []struct {
+		name         string
+		public, loc  bool
+		state        string
+		wantAlerts   int
+		lastAlertEvt string
+	}{
+		{"healthy", true, true, StateUp, 0, ""},
+		{"first failure is tolerated", false, true, StateUp, 0, ""},
+		{"threshold reached", false, true, StateDown, 1, "down"},
+		{"alerted only once", false, true, StateDown, 1, "down"},
+		{"recovery", true, true, StateUp, 2, "recovered"},
+		{"local outage is not a tunnel outage", false, false, StateLocalDown, 2, "recovered"},
+		{"still local", false, false, StateLocalDown, 2, "recovered"},
+		{"local back but tunnel still broken", false, true, StateDown, 3, "down"},
+	}
+	for _, step := range steps {
+		publicUp.Store(step.public)
+		localUp.Store(step.loc)
+		m.check(context.Background(), s)
+
+		r := m.report(s, true)
+		if len(r.Targets) != 1 {
+			t.Fatalf("%s: targets = %+v", step.name, r.Targets)
+		}
+		if got := r.Targets[0].State; got != step.state {
+			t.Errorf("%s: state = %s, want %s", step.name, got, step.state)
+		}
+		if len(alerts) != step.wantAlerts {
+			t.Fatalf("%s: %d alerts, want %d", step.name, len(alerts), step.wantAlerts)
+		}
+		if step.wantAlerts > 0 && alerts[len(alerts)-1].Event != step.lastAlertEvt {
+			t.Errorf("%s: last alert = %+v", step.name, alerts[len(alerts)-1])
+		}
+	}
+
+	r := m.report(s, true)
+	tgt := r.Targets[0]
+	if len(tgt.History) != len(steps) || !tgt.History[0].ViaCloudflare {
+		t.Errorf("history = %+v", tgt.History)
+	}
+	if want := 200.0 / float64(len(steps)); tgt.UptimePercent != want {
+		t.Errorf("uptime = %v, want %v", tgt.UptimePercent, want)
+	}
+	// the down alert dates the outage from its first failed probe
+	if down := alerts[0]; !down.Since.Equal(tgt.History[1].Time) {
+		t.Errorf("down since %v, want %v", down.Since, tgt.History[1].Time)
+	}
+}
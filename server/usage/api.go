@@ -4,14 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/xhd2015/ai-critic/macosapp/codexusage"
 	"github.com/xhd2015/ai-critic/macosapp/debuglog"
-	"github.com/xhd2015/ai-critic/macosapp/grokusage"
-)
-
-var (
-	grokService  = grokusage.NewService()
-	codexService = codexusage.NewService()
 )
 
 type debugSettingsResponse struct {
@@ -25,45 +18,10 @@ type debugSettingsRequest struct {
 
 // RegisterAPI registers grok/codex usage and debug log settings on the main server.
 func RegisterAPI(mux *http.ServeMux) {
-	mux.HandleFunc("/api/grok/usage", handleGrokUsage)
-	mux.HandleFunc("/api/codex/usage", handleCodexUsage)
+	registerUsageAPI(mux)
 	mux.HandleFunc("/api/debug/log", handleDebugLog)
 }
 
-// Start begins background refresh loops for usage services.
-func Start() {
-	grokService.Start()
-	codexService.Start()
-}
-
-// Stop ends background refresh loops for usage services.
-func Stop() {
-	grokService.Stop()
-	codexService.Stop()
-}
-
-func handleGrokUsage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	grokService.EnsureFetch()
-	resp := grokService.Get()
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
-}
-
-func handleCodexUsage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	codexService.EnsureFetch()
-	resp := codexService.Get()
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
-}
-
 func handleDebugLog(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -94,4 +52,4 @@ func handleDebugLog(w http.ResponseWriter, r *http.Request) {
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package usage
+
+import "net/http"
+
+// Grok and Codex usage is read by driving their CLIs in a pseudo-terminal,
+// which this platform lacks: the endpoints report it as unsupported.
+func registerUsageAPI(mux *http.ServeMux) {
+	unsupported := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "usage tracking is not supported on this platform", http.StatusNotImplemented)
+	}
+	mux.HandleFunc("/api/grok/usage", unsupported)
+	mux.HandleFunc("/api/codex/usage", unsupported)
+}
+
+// Start does nothing on this platform.
+func Start() {}
+
+// Stop does nothing on this platform.
+func Stop() {}
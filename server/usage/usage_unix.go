@@ -0,0 +1,55 @@
+//go:build unix
+
+package usage
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/xhd2015/ai-critic/macosapp/codexusage"
+	"github.com/xhd2015/ai-critic/macosapp/grokusage"
+)
+
+var (
+	grokService  = grokusage.NewService()
+	codexService = codexusage.NewService()
+)
+
+func registerUsageAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/api/grok/usage", handleGrokUsage)
+	mux.HandleFunc("/api/codex/usage", handleCodexUsage)
+}
+
+// Start begins background refresh loops for usage services.
+func Start() {
+	grokService.Start()
+	codexService.Start()
+}
+
+// Stop ends background refresh loops for usage services.
+func Stop() {
+	grokService.Stop()
+	codexService.Stop()
+}
+
+func handleGrokUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	grokService.EnsureFetch()
+	resp := grokService.Get()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func handleCodexUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	codexService.EnsureFetch()
+	resp := codexService.Get()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
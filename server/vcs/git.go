@@ -0,0 +1,160 @@
+package vcs
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	gitrunner "github.com/xhd2015/agent-pro/agent/git_runner"
+	"github.com/xhd2015/ai-critic/server/githooks"
+)
+
+// gitVCS is the git backend, run through gitrunner for its environment
+// handling.
+type gitVCS struct{}
+
+func (gitVCS) Name() string { return "git" }
+
+func (gitVCS) Detect(dir string) error {
+	if err := gitrunner.EnsureAvailable(); err != nil {
+		return err
+	}
+	if err := gitrunner.RevParse("--git-dir").Dir(dir).RunSilent(); err != nil {
+		return fmt.Errorf("not a git repository: %s", dir)
+	}
+	return nil
+}
+
+func (g gitVCS) Status(dir string) (*Status, error) {
+	branch, err := g.CurrentBranch(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branch: %v", err)
+	}
+	output, err := gitrunner.Status("--porcelain=v1").Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %v", err)
+	}
+
+	st := &Status{Branch: branch, Files: []FileChange{}}
+	for _, line := range strings.Split(string(output), "\n") {
+		if len(line) < 3 {
+			continue
+		}
+		indexStatus := line[0]    // staged status
+		workTreeStatus := line[1] // unstaged status
+		path := strings.TrimSpace(line[3:])
+		// renamed files are "old -> new"
+		if idx := strings.Index(path, " -> "); idx >= 0 {
+			path = path[idx+4:]
+		}
+
+		if indexStatus != ' ' && indexStatus != '?' {
+			st.Files = append(st.Files, FileChange{Path: path, Status: GitStatusName(indexStatus), Staged: true})
+		}
+		if workTreeStatus != ' ' {
+			st.Files = append(st.Files, FileChange{Path: path, Status: GitStatusName(workTreeStatus)})
+		}
+	}
+	return st, nil
+}
+
+func (gitVCS) Diff(dir string) (string, string, error) {
+	working, err := gitrunner.Diff().Dir(dir).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get working tree diff: %v", err)
+	}
+	staged, err := gitrunner.DiffCached().Dir(dir).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get staged diff: %v", err)
+	}
+	return string(working), string(staged), nil
+}
+
+func (gitVCS) Stage(dir, path string) error {
+	if output, err := gitrunner.Add(path).Dir(dir).Run(); err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (gitVCS) Unstage(dir, path string) error {
+	if output, err := gitrunner.Reset(path).Dir(dir).Run(); err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (gitVCS) Commit(dir, message string, author Author) (string, error) {
+	// the identity is stored in the repository's config, as the UI's git
+	// user settings expect
+	if author.Name != "" {
+		if output, err := gitrunner.Config("user.name", author.Name).Dir(dir).Run(); err != nil {
+			return "", fmt.Errorf("failed to set git user.name: %s", output)
+		}
+	}
+	if author.Email != "" {
+		if output, err := gitrunner.Config("user.email", author.Email).Dir(dir).Run(); err != nil {
+			return "", fmt.Errorf("failed to set git user.email: %s", output)
+		}
+	}
+	args := append(githooks.CommitArgs(dir), "commit", "-m", message)
+	output, err := gitrunner.NewCommand(args...).Dir(dir).Run()
+	if err != nil {
+		return string(output), fmt.Errorf("%s", output)
+	}
+	return string(output), nil
+}
+
+func (gitVCS) CurrentBranch(dir string) (string, error) {
+	return gitrunner.GetCurrentBranch(dir)
+}
+
+func (gitVCS) Branches(dir string) ([]Branch, error) {
+	// most recently committed first
+	output, err := gitrunner.ForEachRef(
+		"--sort=-committerdate",
+		"--format=%(refname:short)\t%(committerdate:iso8601)\t%(HEAD)",
+		"refs/heads/",
+	).Dir(dir).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %v", err)
+	}
+
+	var branches []Branch
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		branches = append(branches, Branch{
+			Name:      parts[0],
+			Date:      strings.TrimSpace(parts[1]),
+			IsCurrent: strings.TrimSpace(parts[2]) == "*",
+		})
+	}
+	return branches, nil
+}
+
+func (gitVCS) PushCmd(dir, branch, keyPath string) *exec.Cmd {
+	return gitrunner.Push(branch, keyPath).Dir(dir).Exec()
+}
+
+// GitStatusName converts a git status character to a human-readable status.
+func GitStatusName(c byte) string {
+	switch c {
+	case 'A':
+		return "added"
+	case 'M':
+		return "modified"
+	case 'D':
+		return "deleted"
+	case 'R':
+		return "renamed"
+	case 'C':
+		return "copied"
+	case '?':
+		return "untracked"
+	default:
+		return "modified"
+	}
+}
@@ -0,0 +1,56 @@
+package vcs
+
+import (
+	"time"
+
+	"github.com/xhd2015/ai-critic/server/metrics"
+)
+
+var commandDuration = metrics.NewHistogram("git_command_duration_seconds",
+	"Duration of version control operations, by backend and operation.",
+	nil, "backend", "op")
+
+// timed records the duration of each operation of a backend. PushCmd is
+// not timed: the push runs later, as a job.
+type timed struct {
+	VCS
+}
+
+func (t timed) observe(op string, start time.Time) {
+	commandDuration.Observe(time.Since(start).Seconds(), t.Name(), op)
+}
+
+func (t timed) Status(dir string) (*Status, error) {
+	defer t.observe("status", time.Now())
+	return t.VCS.Status(dir)
+}
+
+func (t timed) Diff(dir string) (string, string, error) {
+	defer t.observe("diff", time.Now())
+	return t.VCS.Diff(dir)
+}
+
+func (t timed) Stage(dir, path string) error {
+	defer t.observe("stage", time.Now())
+	return t.VCS.Stage(dir, path)
+}
+
+func (t timed) Unstage(dir, path string) error {
+	defer t.observe("unstage", time.Now())
+	return t.VCS.Unstage(dir, path)
+}
+
+func (t timed) Commit(dir, message string, author Author) (string, error) {
+	defer t.observe("commit", time.Now())
+	return t.VCS.Commit(dir, message, author)
+}
+
+func (t timed) CurrentBranch(dir string) (string, error) {
+	defer t.observe("current_branch", time.Now())
+	return t.VCS.CurrentBranch(dir)
+}
+
+func (t timed) Branches(dir string) ([]Branch, error) {
+	defer t.observe("branches", time.Now())
+	return t.VCS.Branches(dir)
+}
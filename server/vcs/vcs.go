@@ -0,0 +1,102 @@
+// Package vcs puts the version control operations of the review API behind
+// one interface, so the review UI can front repositories that are not plain
+// git. Git is the default backend; others (Jujutsu, Mercurial) are added
+// with Register and tried first, which lets a colocated jj repository be
+// handled by jj rather than by its .git directory.
+package vcs
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+)
+
+// ErrUnsupported is returned for operations a backend has no equivalent
+// for, such as staging in a VCS without an index.
+var ErrUnsupported = errors.New("not supported by this version control system")
+
+// FileChange is one changed file. Status is "added", "modified",
+// "deleted", "renamed", "copied" or "untracked".
+type FileChange struct {
+	Path   string
+	Status string
+	Staged bool
+}
+
+// Status is the state of a working copy.
+type Status struct {
+	// Branch is the current branch (bookmark), empty when detached.
+	Branch string
+	Files  []FileChange
+}
+
+// Branch is a local branch.
+type Branch struct {
+	Name      string
+	IsCurrent bool
+	Date      string // ISO date of the last commit
+}
+
+// Author overrides the committer identity; empty fields keep the
+// configured one.
+type Author struct {
+	Name  string
+	Email string
+}
+
+// VCS is a version control backend. Diffs are in git's unified format
+// (hg diff --git, jj diff --git), which the review UI parses.
+type VCS interface {
+	// Name identifies the backend, e.g. "git".
+	Name() string
+	// Detect returns nil if dir is inside a repository of this backend,
+	// otherwise an error saying why not.
+	Detect(dir string) error
+
+	Status(dir string) (*Status, error)
+	// Diff returns the unstaged and the staged changes; a VCS without an
+	// index reports everything as unstaged.
+	Diff(dir string) (working, staged string, err error)
+	Stage(dir, path string) error
+	Unstage(dir, path string) error
+	// Commit records the staged changes (all changes without an index)
+	// and returns the tool's output.
+	Commit(dir, message string, author Author) (string, error)
+	CurrentBranch(dir string) (string, error)
+	Branches(dir string) ([]Branch, error)
+	// PushCmd returns the command pushing branch to the default remote;
+	// keyPath is an SSH key file, if any. It is run as a job.
+	PushCmd(dir, branch, keyPath string) *exec.Cmd
+}
+
+var (
+	mu       sync.RWMutex
+	backends []VCS
+	// git is the default backend.
+	git VCS = gitVCS{}
+)
+
+// Register adds a backend. Backends are tried in registration order, all
+// before git.
+func Register(v VCS) {
+	mu.Lock()
+	defer mu.Unlock()
+	backends = append(backends, v)
+}
+
+// For returns the backend of the repository dir is in. When none matches,
+// the error is git's: the default "not a git repository".
+func For(dir string) (VCS, error) {
+	mu.RLock()
+	registered := backends
+	mu.RUnlock()
+	for _, v := range registered {
+		if v.Detect(dir) == nil {
+			return timed{v}, nil
+		}
+	}
+	if err := git.Detect(dir); err != nil {
+		return nil, err
+	}
+	return timed{git}, nil
+}
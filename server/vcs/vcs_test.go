@@ -0,0 +1,106 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v %s", args, err, out)
+	}
+}
+
+func TestGit(t *testing.T) {
+	dir := t.TempDir()
+	run(t, dir, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644)
+	run(t, dir, "add", "a.txt")
+	run(t, dir, "commit", "-q", "-m", "init")
+
+	v, err := For(dir)
+	if err != nil || v.Name() != "git" {
+		t.Fatalf("For = %v, %v", v, err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("new\n"), 0644)
+	if err := v.Stage(dir, "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := v.Status(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Branch != "main" || len(st.Files) != 2 ||
+		st.Files[0] != (FileChange{Path: "a.txt", Status: "modified"}) ||
+		st.Files[1] != (FileChange{Path: "b.txt", Status: "added", Staged: true}) {
+		t.Errorf("status = %+v", st)
+	}
+	working, staged, err := v.Diff(dir)
+	if err != nil || !strings.Contains(working, "+two") || !strings.Contains(staged, "+new") {
+		t.Errorf("diff = %q, %q, %v", working, staged, err)
+	}
+
+	if err := v.Unstage(dir, "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Stage(dir, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Commit(dir, "change a", Author{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := v.Status(dir); len(st.Files) != 1 || st.Files[0].Status != "untracked" {
+		t.Errorf("after commit: %+v", st)
+	}
+	branches, err := v.Branches(dir)
+	if err != nil || len(branches) != 1 || !branches[0].IsCurrent || branches[0].Name != "main" {
+		t.Errorf("branches = %+v, %v", branches, err)
+	}
+
+	if _, err := For(t.TempDir()); err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("non-repository: %v", err)
+	}
+}
+
+// markerVCS claims directories containing a marker file.
+type markerVCS struct{ gitVCS }
+
+func (markerVCS) Name() string { return "marker" }
+
+func (markerVCS) Detect(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".marker")); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (markerVCS) Stage(dir, path string) error { return ErrUnsupported }
+
+func TestRegisteredBackendsComeFirst(t *testing.T) {
+	saved := backends
+	t.Cleanup(func() { backends = saved })
+	Register(markerVCS{})
+
+	dir := t.TempDir()
+	run(t, dir, "init", "-q")
+	if v, err := For(dir); err != nil || v.Name() != "git" {
+		t.Errorf("plain git repository: %v, %v", v, err)
+	}
+	os.WriteFile(filepath.Join(dir, ".marker"), nil, 0644)
+	v, err := For(dir)
+	if err != nil || v.Name() != "marker" {
+		t.Fatalf("colocated repository: %v, %v", v, err)
+	}
+	if err := v.Stage(dir, "x"); err != ErrUnsupported {
+		t.Errorf("stage = %v", err)
+	}
+}